@@ -0,0 +1,139 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// azprovider-diag explains why a LoadBalancer service has no external IP by re-running
+// the decisions of the cloud provider against the live cluster and Azure resources.
+// It never changes any Kubernetes or Azure resources.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/component-base/logs"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+type options struct {
+	kubeconfig  string
+	cloudConfig string
+	namespace   string
+	clusterName string
+	output      string
+}
+
+// errDiagnosisFailed is returned when the diagnosis finds a failing step, which is reported
+// by exit code 2 to tell it apart from the failures of the tool itself.
+var errDiagnosisFailed = errors.New("the diagnosis found a failing step")
+
+func main() {
+	o := &options{}
+	command := &cobra.Command{
+		Use:   "azprovider-diag service",
+		Short: "Explain why a LoadBalancer service has no external IP",
+		Long: `azprovider-diag re-runs the load balancer reconciliation of the Azure cloud provider for a service
+in read-only mode, i.e., load balancer selection, frontend IP address selection, health probe
+construction and security rules, and reports the first failing step.`,
+		Args: cobra.ExactArgs(1),
+		// The errors are printed by main so that errDiagnosisFailed is not reported twice.
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The usage is only printed for the errors of the flags and arguments.
+			cmd.SilenceUsage = true
+			if o.output != outputText && o.output != outputJSON {
+				return fmt.Errorf("unsupported output format %q, supported values are %s and %s", o.output, outputText, outputJSON)
+			}
+			diagnosis, err := run(cmd.Context(), o, args[0])
+			if err != nil {
+				return err
+			}
+			if err := printDiagnosis(cmd.OutOrStdout(), diagnosis, o.output); err != nil {
+				return err
+			}
+			if diagnosis.FirstFailure() != nil {
+				return errDiagnosisFailed
+			}
+			return nil
+		},
+	}
+
+	fs := command.Flags()
+	fs.StringVar(&o.kubeconfig, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file.")
+	fs.StringVar(&o.cloudConfig, "cloud-config", "", "Path to the cloud provider configuration file, i.e., azure.json.")
+	fs.StringVarP(&o.namespace, "namespace", "n", metav1.NamespaceDefault, "Namespace of the service.")
+	fs.StringVar(&o.clusterName, "cluster-name", "kubernetes", "The cluster name passed to the cloud controller manager with --cluster-name.")
+	fs.StringVarP(&o.output, "output", "o", outputText, "Output format, text or json.")
+	_ = command.MarkFlagRequired("cloud-config")
+
+	logs.InitLogs()
+	err := command.Execute()
+	// os.Exit skips the deferred calls, so the logs are flushed before exiting.
+	logs.FlushLogs()
+
+	switch {
+	case errors.Is(err, errDiagnosisFailed):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, o *options, serviceName string) (*provider.ServiceDiagnosis, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the kubernetes client: %w", err)
+	}
+
+	service, err := kubeClient.CoreV1().Services(o.namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service %s/%s: %w", o.namespace, serviceName, err)
+	}
+	nodeList, err := kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	nodes := make([]*v1.Node, 0, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes = append(nodes, &nodeList.Items[i])
+	}
+
+	configFile, err := os.Open(o.cloudConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the cloud config %s: %w", o.cloudConfig, err)
+	}
+	defer configFile.Close()
+	// The background loops of the cloud controller manager are not started.
+	az, err := provider.NewCloudWithoutFeatureGates(ctx, configFile, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize the cloud provider: %w", err)
+	}
+
+	return az.DiagnoseService(ctx, o.clusterName, service, nodes), nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// printDiagnosis writes the diagnosis report in the given format.
+func printDiagnosis(w io.Writer, diagnosis *provider.ServiceDiagnosis, output string) error {
+	if output == outputJSON {
+		data, err := json.MarshalIndent(diagnosis, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	fmt.Fprintf(w, "Service %s\n", diagnosis.Service)
+	for _, step := range diagnosis.Steps {
+		result := "OK"
+		if !step.Passed {
+			result = "FAILED"
+		}
+		fmt.Fprintf(w, "  [%s] %s: %s\n", result, step.Name, step.Message)
+	}
+	if failure := diagnosis.FirstFailure(); failure != nil {
+		fmt.Fprintf(w, "\nThe first failing step is %s: %s\n", failure.Name, failure.Message)
+	} else {
+		fmt.Fprintln(w, "\nAll steps passed.")
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+func TestPrintDiagnosis(t *testing.T) {
+	diagnosis := &provider.ServiceDiagnosis{
+		Service: "default/svc",
+		Steps: []provider.DiagnosisStep{
+			{Name: provider.DiagnosisStepServiceType, Passed: true, Message: "LoadBalancer service, internal: false"},
+			{Name: provider.DiagnosisStepFrontendIPAddress, Message: "public IP address pip does not exist"},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, printDiagnosis(&buf, diagnosis, outputText))
+	assert.Equal(t, `Service default/svc
+  [OK] ServiceType: LoadBalancer service, internal: false
+  [FAILED] FrontendIPAddress: public IP address pip does not exist
+
+The first failing step is FrontendIPAddress: public IP address pip does not exist
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, printDiagnosis(&buf, diagnosis, outputJSON))
+	var decoded provider.ServiceDiagnosis
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, *diagnosis, decoded)
+}
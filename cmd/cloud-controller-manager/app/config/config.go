@@ -60,6 +60,8 @@ type Config struct {
 	SharedInformers informers.SharedInformerFactory
 
 	DynamicReloadingConfig DynamicReloadingConfig
+
+	ServiceControllerShardingConfig ServiceControllerShardingConfig
 }
 
 type DynamicReloadingConfig struct {
@@ -69,6 +71,11 @@ type DynamicReloadingConfig struct {
 	CloudConfigKey             string
 }
 
+type ServiceControllerShardingConfig struct {
+	// ShardCount is the number of shards of the service controller. Sharding is disabled if it is not greater than 1.
+	ShardCount int
+}
+
 type completedConfig struct {
 	*Config
 }
@@ -58,6 +58,7 @@ import (
 	cloudcontrollerconfig "sigs.k8s.io/cloud-provider-azure/cmd/cloud-controller-manager/app/config"
 	"sigs.k8s.io/cloud-provider-azure/cmd/cloud-controller-manager/app/dynamic"
 	"sigs.k8s.io/cloud-provider-azure/cmd/cloud-controller-manager/app/options"
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
 	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
 	"sigs.k8s.io/cloud-provider-azure/pkg/version"
 	"sigs.k8s.io/cloud-provider-azure/pkg/version/verflag"
@@ -97,15 +98,15 @@ func NewCloudControllerManagerCommand() *cobra.Command {
 				os.Exit(1)
 			}
 
-			if c.ComponentConfig.Generic.LeaderElection.LeaderElect {
+			// When the service controller is sharded, every replica runs the controllers, and each controller
+			// or shard of the service controller is run by the replica holding its own lease.
+			if c.ComponentConfig.Generic.LeaderElection.LeaderElect && c.ServiceControllerShardingConfig.ShardCount <= 1 {
 				// Identity used to distinguish between multiple cloud controller manager instances
-				id, err := os.Hostname()
+				id, err := leaderElectionIdentity()
 				if err != nil {
 					klog.Errorf("Run: failed to get host name: %v", err)
 					os.Exit(1)
 				}
-				// add a uniquifier so that two processes on the same host don't accidentally both become active
-				id = id + "_" + string(uuid.NewUUID())
 
 				// Lock required for leader election
 				rl, err := resourcelock.NewFromKubeconfig(c.ComponentConfig.Generic.LeaderElection.ResourceLock,
@@ -174,6 +175,64 @@ func NewCloudControllerManagerCommand() *cobra.Command {
 	return cmd
 }
 
+// leaderElectionIdentity returns the identity used to distinguish between multiple cloud controller manager instances.
+func leaderElectionIdentity() (string, error) {
+	id, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	// add a uniquifier so that two processes on the same host don't accidentally both become active
+	return id + "_" + string(uuid.NewUUID()), nil
+}
+
+// runWithLeaderElection runs the function while holding the lease, and exits the process if the lease is lost.
+func runWithLeaderElection(ctx context.Context, c *cloudcontrollerconfig.CompletedConfig, id, leaseName string, run func(ctx context.Context)) {
+	rl, err := resourcelock.NewFromKubeconfig(c.ComponentConfig.Generic.LeaderElection.ResourceLock,
+		c.ComponentConfig.Generic.LeaderElection.ResourceNamespace,
+		leaseName,
+		resourcelock.ResourceLockConfig{
+			Identity:      id,
+			EventRecorder: c.EventRecorder,
+		},
+		c.Kubeconfig,
+		c.ComponentConfig.Generic.LeaderElection.RenewDeadline.Duration)
+	if err != nil {
+		klog.Fatalf("error creating lock %s: %v", leaseName, err)
+	}
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:          rl,
+		LeaseDuration: c.ComponentConfig.Generic.LeaderElection.LeaseDuration.Duration,
+		RenewDeadline: c.ComponentConfig.Generic.LeaderElection.RenewDeadline.Duration,
+		RetryPeriod:   c.ComponentConfig.Generic.LeaderElection.RetryPeriod.Duration,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: run,
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil {
+					// the controllers are being restarted, e.g. the cloud config is reloaded
+					klog.V(1).Infof("leaderelection of %s stopped", leaseName)
+					return
+				}
+				klog.ErrorS(nil, "leaderelection lost", "lease", leaseName)
+				klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+			},
+		},
+		ReleaseOnCancel: true,
+		Name:            leaseName,
+	})
+}
+
+// serviceControllerShardLeaseName returns the name of the lease of the shard of the service controller.
+func serviceControllerShardLeaseName(c *cloudcontrollerconfig.CompletedConfig, shard int) string {
+	return fmt.Sprintf("%s-service-shard-%d", c.ComponentConfig.Generic.LeaderElection.ResourceName, shard)
+}
+
+// serviceControllerSharedResourceLeaseName returns the name of the lease serializing the writes of the shards of the
+// service controller to the resources shared by the load balancers.
+func serviceControllerSharedResourceLeaseName(c *cloudcontrollerconfig.CompletedConfig) string {
+	return fmt.Sprintf("%s-service-shared-resources", c.ComponentConfig.Generic.LeaderElection.ResourceName)
+}
+
 // RunWrapper adapts the ccm boot logic to the leader elector call back function
 func RunWrapper(s *options.CloudControllerManagerOptions, c *cloudcontrollerconfig.Config, h *controllerhealthz.MutableHealthzHandler) func(ctx context.Context) {
 	return func(ctx context.Context) {
@@ -284,18 +343,23 @@ func StartHTTPServer(c *cloudcontrollerconfig.CompletedConfig, stopCh <-chan str
 		electionChecker = leaderelection.NewLeaderHealthzAdaptor(time.Second * 20)
 		checks = append(checks, electionChecker)
 	}
+	// the Azure checks are only installed on /readyz, so that an outage of Azure doesn't fail the liveness probe,
+	// which would restart the controller in a loop and lose the state of the degraded mode
+	readyzChecks := append(append([]healthz.HealthChecker{}, checks...), azureHealthCheckers.checkers()...)
 
 	healthzHandler := controllerhealthz.NewMutableHealthzHandler(checks...)
 	// Start the controller manager HTTP server
 	if c.SecureServing != nil {
 		unsecuredMux := genericcontrollermanager.NewBaseHandler(&c.ComponentConfig.Generic.Debugging, healthzHandler)
+		unsecuredMux.Handle(AzureDebugPath, azureDebugHandler)
+		unsecuredMux.Handle(AzureRateLimitersPath, azclients.RateLimiterHandler())
 		handler := genericcontrollermanager.BuildHandlerChain(unsecuredMux, &c.Authorization, &c.Authentication)
 		// TODO: handle stoppedCh returned by c.SecureServing.Serve
 		if _, _, err := c.SecureServing.Serve(handler, 0, stopCh); err != nil {
 			return nil, err
 		}
 
-		healthz.InstallReadyzHandler(unsecuredMux, checks...)
+		healthz.InstallReadyzHandler(unsecuredMux, readyzChecks...)
 	}
 
 	return healthzHandler, nil
@@ -311,6 +375,12 @@ func Run(ctx context.Context, c *cloudcontrollerconfig.CompletedConfig, h *contr
 		err   error
 	)
 
+	// every replica initializes the cloud provider for the shards of the service controller, while the provider-wide
+	// loops are run by the replica holding the lease of the other controllers.
+	if c.ServiceControllerShardingConfig.ShardCount > 1 {
+		ctx = provider.WithDeferredProviderLoops(ctx)
+	}
+
 	if c.ComponentConfig.KubeCloudShared.CloudProvider.CloudConfigFile != "" {
 		cloud, err = provider.NewCloudFromConfigFile(ctx, c.ComponentConfig.KubeCloudShared.CloudProvider.CloudConfigFile, true)
 		if err != nil {
@@ -327,6 +397,11 @@ func Run(ctx context.Context, c *cloudcontrollerconfig.CompletedConfig, h *contr
 		klog.Fatalf("cloud provider is nil, please check if the --cloud-config is set properly")
 	}
 
+	if az, ok := cloud.(*provider.Cloud); ok {
+		azureDebugHandler.setHandler(az.DebugHandler())
+		azureHealthCheckers.setCheckers(az.HealthCheckers())
+	}
+
 	if !cloud.HasClusterID() {
 		if c.ComponentConfig.KubeCloudShared.AllowUntaggedCloud {
 			klog.Warning("detected a cluster without a ClusterID.  A ClusterID will be required in the future.  Please tag your cluster to avoid any future issues")
@@ -366,6 +441,70 @@ func startControllers(ctx context.Context, controllerContext genericcontrollerma
 		informerUserCloud.SetInformers(completedConfig.SharedInformers)
 	}
 
+	if completedConfig.ServiceControllerShardingConfig.ShardCount > 1 {
+		return startShardedControllers(ctx, controllerContext, completedConfig, stopCh, cloud, controllers, healthzHandler)
+	}
+	return runControllers(ctx, controllerContext, completedConfig, stopCh, cloud, controllers, healthzHandler)
+}
+
+// startShardedControllers starts the shards of the service controller and the other controllers, each of which is
+// run by the replica holding its own lease, so that multiple replicas reconcile the services in parallel.
+func startShardedControllers(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, stopCh <-chan struct{},
+	cloud cloudprovider.Interface, controllers map[string]initFunc, healthzHandler *controllerhealthz.MutableHealthzHandler) error {
+	id, err := leaderElectionIdentity()
+	if err != nil {
+		return fmt.Errorf("failed to get host name: %w", err)
+	}
+
+	otherControllers := make(map[string]initFunc)
+	for controllerName, initFn := range controllers {
+		if controllerName != names.ServiceLBController {
+			otherControllers[controllerName] = initFn
+		}
+	}
+	if _, found := controllers[names.ServiceLBController]; found &&
+		genericcontrollermanager.IsControllerEnabled(names.ServiceLBController, ControllersDisabledByDefault, completedConfig.ComponentConfig.Generic.Controllers) {
+		if az, ok := cloud.(*provider.Cloud); ok {
+			// the shards on different replicas update the backend pool references of the same VMs without ETags
+			leaderElection := completedConfig.ComponentConfig.Generic.LeaderElection
+			lock, err := resourcelock.NewFromKubeconfig(resourcelock.LeasesResourceLock,
+				leaderElection.ResourceNamespace,
+				serviceControllerSharedResourceLeaseName(completedConfig),
+				resourcelock.ResourceLockConfig{Identity: id},
+				completedConfig.Kubeconfig,
+				leaderElection.RenewDeadline.Duration)
+			if err != nil {
+				return fmt.Errorf("failed to create the shared resource lock of the service controller: %w", err)
+			}
+			az.SetSharedResourceLock(lock, leaderElection.LeaseDuration.Duration, leaderElection.RetryPeriod.Duration)
+		}
+		for shard := 0; shard < completedConfig.ServiceControllerShardingConfig.ShardCount; shard++ {
+			shard := shard
+			go runWithLeaderElection(ctx, completedConfig, id, serviceControllerShardLeaseName(completedConfig, shard), func(ctx context.Context) {
+				if err := startServiceControllerShard(ctx, controllerContext, completedConfig, cloud, shard); err != nil {
+					klog.Fatalf("error running shard %d of the service controller: %v", shard, err)
+				}
+			})
+		}
+	}
+
+	// the informers used by the cloud provider are needed by the shards on all the replicas
+	completedConfig.SharedInformers.Start(stopCh)
+
+	runWithLeaderElection(ctx, completedConfig, id, completedConfig.ComponentConfig.Generic.LeaderElection.ResourceName, func(ctx context.Context) {
+		if az, ok := cloud.(*provider.Cloud); ok {
+			az.StartProviderLoops(ctx)
+		}
+		if err := runControllers(ctx, controllerContext, completedConfig, ctx.Done(), cloud, otherControllers, healthzHandler); err != nil {
+			klog.Fatalf("error running controllers: %v", err)
+		}
+	})
+	return nil
+}
+
+// runControllers runs the controllers until the stop channel is closed.
+func runControllers(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, stopCh <-chan struct{},
+	cloud cloudprovider.Interface, controllers map[string]initFunc, healthzHandler *controllerhealthz.MutableHealthzHandler) error {
 	var controllerChecks []healthz.HealthChecker
 	for controllerName, initFn := range controllers {
 		if !genericcontrollermanager.IsControllerEnabled(controllerName, ControllersDisabledByDefault, completedConfig.ComponentConfig.Generic.Controllers) {
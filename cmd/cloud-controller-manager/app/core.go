@@ -27,6 +27,8 @@ import (
 	"strings"
 
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
 	cloudprovider "k8s.io/cloud-provider"
 	nodecontroller "k8s.io/cloud-provider/controllers/node"
 	nodelifecyclecontroller "k8s.io/cloud-provider/controllers/nodelifecycle"
@@ -41,6 +43,7 @@ import (
 	nodeipamcontroller "sigs.k8s.io/cloud-provider-azure/pkg/nodeipam"
 	nodeipamconfig "sigs.k8s.io/cloud-provider-azure/pkg/nodeipam/config"
 	"sigs.k8s.io/cloud-provider-azure/pkg/nodeipam/ipam"
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
 )
 
 func startCloudNodeController(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
@@ -84,25 +87,101 @@ func startCloudNodeLifecycleController(ctx context.Context, controllerContext ge
 
 func startServiceController(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
 	// Start the service controller
-	serviceController, err := servicecontroller.New(
-		cloud,
-		completedConfig.ClientBuilder.ClientOrDie("service-controller"),
-		completedConfig.SharedInformers.Core().V1().Services(),
-		completedConfig.SharedInformers.Core().V1().Nodes(),
-		completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
-		utilfeature.DefaultFeatureGate,
-	)
+	serviceController, serviceInformerFactory, err := newServiceController(completedConfig, cloud, 0, 0)
 	if err != nil {
 		// This error shouldn't fail. It lives like this as a legacy.
 		klog.Errorf("Failed to start service controller: %v", err)
 		return nil, false, nil
 	}
+	if serviceInformerFactory != nil {
+		serviceInformerFactory.Start(stopCh)
+	}
 
 	go serviceController.Run(ctx, int(completedConfig.ComponentConfig.ServiceController.ConcurrentServiceSyncs), controllerContext.ControllerManagerMetrics)
 
 	return nil, true, nil
 }
 
+// startServiceControllerShard runs the shard of the service controller reconciling the services of the load
+// balancers whose names are hashed to the shard until the context is canceled.
+func startServiceControllerShard(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, shard int) error {
+	if _, ok := cloud.(*provider.Cloud); !ok {
+		return fmt.Errorf("sharding the service controller is not supported by cloud provider %s", cloud.ProviderName())
+	}
+	shardCount := completedConfig.ServiceControllerShardingConfig.ShardCount
+	serviceController, serviceInformerFactory, err := newServiceController(completedConfig, cloud, shard, shardCount)
+	if err != nil {
+		return err
+	}
+	if serviceInformerFactory != nil {
+		serviceInformerFactory.Start(ctx.Done())
+	}
+	// the node informer of the service controller is shared with the other controllers
+	completedConfig.SharedInformers.Start(ctx.Done())
+
+	klog.Infof("Started shard %d/%d of the service controller", shard, shardCount)
+	serviceController.Run(ctx, int(completedConfig.ComponentConfig.ServiceController.ConcurrentServiceSyncs), controllerContext.ControllerManagerMetrics)
+	return nil
+}
+
+// newServiceController creates the service controller. The service controller watches the services through a
+// dedicated informer instead of the shared one if the services are transformed, i.e. when they are filtered by
+// their loadBalancerClass. If shardCount is greater than 1, the service controller is the shard reconciling only the
+// services whose load balancers are hashed to it.
+func newServiceController(completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, shard, shardCount int) (*servicecontroller.Controller, informers.SharedInformerFactory, error) {
+	var transforms []cache.TransformFunc
+	az, isAzure := cloud.(*provider.Cloud)
+	if isAzure && az.IsLoadBalancerClassFilteringEnabled() {
+		// The service controller only reconciles the services without a loadBalancerClass, so the classes are rewritten.
+		transforms = append(transforms, az.TransformServiceLoadBalancerClass)
+		klog.Infof("service controller reconciles the services with loadBalancerClass %q, ignoring the services without a class: %t", az.LoadBalancerClass, az.IgnoreServicesWithoutLoadBalancerClass)
+	}
+
+	var serviceInformerFactory informers.SharedInformerFactory
+	serviceInformer := completedConfig.SharedInformers.Core().V1().Services()
+	if len(transforms) > 0 {
+		serviceInformerFactory = informers.NewSharedInformerFactory(completedConfig.VersionedClient, completedConfig.ComponentConfig.Generic.MinResyncPeriod.Duration)
+		serviceInformer = serviceInformerFactory.Core().V1().Services()
+		if err := serviceInformer.Informer().SetTransform(func(obj interface{}) (interface{}, error) {
+			var err error
+			for _, transform := range transforms {
+				if obj, err = transform(obj); err != nil {
+					return nil, err
+				}
+			}
+			return obj, nil
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	nodeInformer := completedConfig.SharedInformers.Core().V1().Nodes()
+	if isAzure {
+		serviceInformer = withServiceResync(serviceInformer, az.ServiceResync)
+		nodeInformer = withNodeSync(nodeInformer, az.NodeSync)
+		if az.EnableNodeChangeDetection {
+			nodeInformer = withNodeChangeDetection(nodeInformer, az)
+		}
+	}
+	if isAzure && shardCount > 1 {
+		serviceInformer = withServiceShard(serviceInformer, az, shard, shardCount)
+		cloud = az.ServiceShardCloud(shard, shardCount)
+	}
+
+	serviceController, err := servicecontroller.New(
+		cloud,
+		completedConfig.ClientBuilder.ClientOrDie("service-controller"),
+		serviceInformer,
+		nodeInformer,
+		completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
+		utilfeature.DefaultFeatureGate,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return serviceController, serviceInformerFactory, nil
+}
+
 func startRouteController(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
 	if !completedConfig.ComponentConfig.KubeCloudShared.ConfigureCloudRoutes {
 		klog.Infof("Will not configure cloud provider routes, --configure-cloud-routes: %v.", completedConfig.ComponentConfig.KubeCloudShared.ConfigureCloudRoutes)
@@ -153,20 +232,28 @@ func startNodeIpamController(ctx context.Context, controllerContext genericcontr
 		return nil, false, nil
 	}
 
-	// failure: bad cidrs in config
-	clusterCIDRs, dualStack, err := processCIDRs(completedConfig.ComponentConfig.KubeCloudShared.ClusterCIDR)
-	if err != nil {
-		return nil, false, err
-	}
+	allocatorType := ipam.CIDRAllocatorType(completedConfig.ComponentConfig.KubeCloudShared.CIDRAllocatorType)
 
-	// failure: more than one cidr but they are not configured as dual stack
-	if len(clusterCIDRs) > 1 && !dualStack {
-		return nil, false, fmt.Errorf("len of ClusterCIDRs==%v and they are not configured as dual stack (at least one from each IPFamily", len(clusterCIDRs))
-	}
+	// the subnet allocator allocates from the address prefixes of the pod subnet instead of the cluster cidrs
+	var clusterCIDRs []*net.IPNet
+	var err error
+	if allocatorType != ipam.SubnetAllocatorType || len(strings.TrimSpace(completedConfig.ComponentConfig.KubeCloudShared.ClusterCIDR)) != 0 {
+		var dualStack bool
+		// failure: bad cidrs in config
+		clusterCIDRs, dualStack, err = processCIDRs(completedConfig.ComponentConfig.KubeCloudShared.ClusterCIDR)
+		if err != nil {
+			return nil, false, err
+		}
 
-	// failure: more than cidrs is not allowed even with dual stack
-	if len(clusterCIDRs) > 2 {
-		return nil, false, fmt.Errorf("len of clusters is:%v > more than max allowed of 2", len(clusterCIDRs))
+		// failure: more than one cidr but they are not configured as dual stack
+		if len(clusterCIDRs) > 1 && !dualStack {
+			return nil, false, fmt.Errorf("len of ClusterCIDRs==%v and they are not configured as dual stack (at least one from each IPFamily", len(clusterCIDRs))
+		}
+
+		// failure: more than cidrs is not allowed even with dual stack
+		if len(clusterCIDRs) > 2 {
+			return nil, false, fmt.Errorf("len of clusters is:%v > more than max allowed of 2", len(clusterCIDRs))
+		}
 	}
 
 	// service cidr processing
@@ -213,7 +300,8 @@ func startNodeIpamController(ctx context.Context, controllerContext genericcontr
 		serviceCIDR,
 		secondaryServiceCIDR,
 		nodeCIDRMaskSizes,
-		ipam.CIDRAllocatorType(completedConfig.ComponentConfig.KubeCloudShared.CIDRAllocatorType),
+		completedConfig.NodeIPAMControllerConfig.PodSubnetName,
+		allocatorType,
 	)
 	if err != nil {
 		return nil, true, err
@@ -0,0 +1,57 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/http"
+	"sync"
+)
+
+// AzureDebugPath is the path serving the resource inventory of the cloud provider.
+const AzureDebugPath = "/debug/azure"
+
+// AzureRateLimitersPath is the path serving and adjusting the rate limiters of the Azure clients.
+const AzureRateLimitersPath = "/debug/azure/ratelimiters"
+
+// mutableDebugHandler serves the debug handler of the current cloud provider instance.
+// The HTTP server is started before the cloud provider is initialized, and the cloud
+// provider is re-created when the cloud config is reloaded, so the handler is swappable.
+type mutableDebugHandler struct {
+	lock    sync.RWMutex
+	handler http.Handler
+}
+
+func (h *mutableDebugHandler) setHandler(handler http.Handler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.handler = handler
+}
+
+func (h *mutableDebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.RLock()
+	handler := h.handler
+	h.lock.RUnlock()
+
+	if handler == nil {
+		http.Error(w, "the cloud provider is not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// azureDebugHandler is installed on the secure serving mux at AzureDebugPath.
+var azureDebugHandler = &mutableDebugHandler{}
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"net/http"
+	"sync"
+
+	"k8s.io/apiserver/pkg/server/healthz"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+// mutableAzureHealthCheckers runs the Azure health checks of the current cloud provider instance.
+// The health checks are installed before the cloud provider is initialized, and the cloud provider
+// is re-created when the cloud config is reloaded, so the checks are swappable. The checks pass
+// until the cloud provider is initialized.
+type mutableAzureHealthCheckers struct {
+	lock   sync.RWMutex
+	checks map[string]healthz.HealthChecker
+}
+
+func (h *mutableAzureHealthCheckers) setCheckers(checks []healthz.HealthChecker) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.checks = make(map[string]healthz.HealthChecker, len(checks))
+	for _, check := range checks {
+		h.checks[check.Name()] = check
+	}
+}
+
+// checkers returns the named health checks delegating to the checks of the current cloud provider.
+func (h *mutableAzureHealthCheckers) checkers() []healthz.HealthChecker {
+	names := []string{provider.AzureTokenHealthCheckName, provider.AzureARMHealthCheckName, provider.AzureInformersHealthCheckName}
+	checks := make([]healthz.HealthChecker, 0, len(names))
+	for _, name := range names {
+		name := name
+		checks = append(checks, healthz.NamedCheck(name, func(req *http.Request) error {
+			h.lock.RLock()
+			check := h.checks[name]
+			h.lock.RUnlock()
+
+			if check == nil {
+				return nil
+			}
+			return check.Check(req)
+		}))
+	}
+	return checks
+}
+
+// azureHealthCheckers is installed on the readiness endpoint.
+var azureHealthCheckers = &mutableAzureHealthCheckers{}
@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apiserver/pkg/server/healthz"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+func TestMutableAzureHealthCheckers(t *testing.T) {
+	h := &mutableAzureHealthCheckers{}
+	checks := h.checkers()
+	assert.Len(t, checks, 3)
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	for _, check := range checks {
+		assert.NoError(t, check.Check(req))
+	}
+
+	h.setCheckers([]healthz.HealthChecker{
+		healthz.NamedCheck(provider.AzureARMHealthCheckName, func(_ *http.Request) error {
+			return errors.New("unreachable")
+		}),
+	})
+	for _, check := range checks {
+		if check.Name() == provider.AzureARMHealthCheckName {
+			assert.Error(t, check.Check(req))
+		} else {
+			assert.NoError(t, check.Check(req))
+		}
+	}
+}
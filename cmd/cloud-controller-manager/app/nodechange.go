@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// nodeChangeDetector decides if the update of a node is relevant to the load balancers.
+type nodeChangeDetector interface {
+	IsNodeChangeRelevantToLoadBalancers(prevNode, newNode *v1.Node) bool
+}
+
+// nodeChangeInformer filters the updates of the nodes delivered to the event handlers by the nodeChangeDetector.
+type nodeChangeInformer struct {
+	cache.SharedIndexInformer
+	detector nodeChangeDetector
+}
+
+func (i *nodeChangeInformer) AddEventHandler(handler cache.ResourceEventHandler) (cache.ResourceEventHandlerRegistration, error) {
+	return i.SharedIndexInformer.AddEventHandler(&nodeChangeHandler{ResourceEventHandler: handler, detector: i.detector})
+}
+
+func (i *nodeChangeInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, resyncPeriod time.Duration) (cache.ResourceEventHandlerRegistration, error) {
+	return i.SharedIndexInformer.AddEventHandlerWithResyncPeriod(&nodeChangeHandler{ResourceEventHandler: handler, detector: i.detector}, resyncPeriod)
+}
+
+// nodeChangeHandler drops the updates of the nodes irrelevant to the load balancers, and delivers the relevant ones
+// as additions, so that the handler synchronizes the nodes even if it does not notice the change itself. The
+// resyncs, i.e. the updates without a new resource version, are delivered as is.
+type nodeChangeHandler struct {
+	cache.ResourceEventHandler
+	detector nodeChangeDetector
+}
+
+func (h *nodeChangeHandler) OnUpdate(oldObj, newObj interface{}) {
+	oldNode, ok1 := oldObj.(*v1.Node)
+	newNode, ok2 := newObj.(*v1.Node)
+	if !ok1 || !ok2 || oldNode.ResourceVersion == newNode.ResourceVersion {
+		h.ResourceEventHandler.OnUpdate(oldObj, newObj)
+		return
+	}
+
+	if !h.detector.IsNodeChangeRelevantToLoadBalancers(oldNode, newNode) {
+		klog.V(6).Infof("nodeChangeHandler: skipping the update of node %s irrelevant to the load balancers", newNode.Name)
+		return
+	}
+	h.ResourceEventHandler.OnAdd(newNode, false)
+}
+
+type nodeChangeNodeInformer struct {
+	coreinformers.NodeInformer
+	informer *nodeChangeInformer
+}
+
+func (i *nodeChangeNodeInformer) Informer() cache.SharedIndexInformer {
+	return i.informer
+}
+
+// withNodeChangeDetection returns the node informer whose event handlers are only notified of the updates of the
+// nodes relevant to the load balancers.
+func withNodeChangeDetection(informer coreinformers.NodeInformer, detector nodeChangeDetector) coreinformers.NodeInformer {
+	klog.Infof("service controller only synchronizes the nodes on the updates relevant to the load balancers")
+	return &nodeChangeNodeInformer{
+		NodeInformer: informer,
+		informer:     &nodeChangeInformer{SharedIndexInformer: informer.Informer(), detector: detector},
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+type fakeNodeChangeDetector struct {
+	relevant bool
+}
+
+func (d *fakeNodeChangeDetector) IsNodeChangeRelevantToLoadBalancers(_, _ *v1.Node) bool {
+	return d.relevant
+}
+
+func TestNodeChangeHandler(t *testing.T) {
+	var added, updated int
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { added++ },
+		UpdateFunc: func(oldObj, newObj interface{}) { updated++ },
+	}
+	oldNode := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", ResourceVersion: "1"}}
+	newNode := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", ResourceVersion: "2"}}
+	detector := &fakeNodeChangeDetector{}
+	changeHandler := &nodeChangeHandler{ResourceEventHandler: handler, detector: detector}
+
+	// the irrelevant updates are dropped while the resyncs are delivered as is
+	changeHandler.OnUpdate(oldNode, newNode)
+	changeHandler.OnUpdate(oldNode, oldNode)
+	assert.Equal(t, 0, added)
+	assert.Equal(t, 1, updated)
+
+	// the relevant updates are delivered as additions
+	detector.relevant = true
+	changeHandler.OnUpdate(oldNode, newNode)
+	assert.Equal(t, 1, added)
+	assert.Equal(t, 1, updated)
+}
+
+func TestWithNodeChangeDetection(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	nodeInformer := withNodeChangeDetection(factory.Core().V1().Nodes(), &fakeNodeChangeDetector{})
+	informer, ok := nodeInformer.Informer().(*nodeChangeInformer)
+	assert.True(t, ok)
+	assert.Equal(t, factory.Core().V1().Nodes().Informer(), informer.SharedIndexInformer)
+	assert.NotNil(t, nodeInformer.Lister())
+}
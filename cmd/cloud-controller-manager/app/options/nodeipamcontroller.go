@@ -40,6 +40,7 @@ func (o *NodeIPAMControllerOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.Int32Var(&o.NodeCIDRMaskSize, "node-cidr-mask-size", consts.DefaultNodeCIDRMaskSize, "Mask size for node cidr in cluster. Default is 24 for IPv4 and 64 for IPv6.")
 	fs.Int32Var(&o.NodeCIDRMaskSizeIPv4, "node-cidr-mask-size-ipv4", 0, "Mask size for IPv4 node cidr in dual-stack cluster. Default is 24.")
 	fs.Int32Var(&o.NodeCIDRMaskSizeIPv6, "node-cidr-mask-size-ipv6", 0, "Mask size for IPv6 node cidr in dual-stack cluster. Default is 64.")
+	fs.StringVar(&o.PodSubnetName, "pod-subnet-name", "", "Name of the subnet in the virtual network of the cluster from which node cidrs are allocated. Requires --cidr-allocator-type to be SubnetAllocator")
 }
 
 // ApplyTo fills up NodeIpamController config with options.
@@ -60,6 +61,7 @@ func (o *NodeIPAMControllerOptions) ApplyTo(cfg *nodeipamconfig.NodeIPAMControll
 	cfg.NodeCIDRMaskSize = o.NodeCIDRMaskSize
 	cfg.NodeCIDRMaskSizeIPv4 = o.NodeCIDRMaskSizeIPv4
 	cfg.NodeCIDRMaskSizeIPv6 = o.NodeCIDRMaskSizeIPv6
+	cfg.PodSubnetName = o.PodSubnetName
 
 	return nil
 }
@@ -79,6 +79,8 @@ type CloudControllerManagerOptions struct {
 	NodeStatusUpdateFrequency metav1.Duration
 
 	DynamicReloading *DynamicReloadingOptions
+
+	ServiceControllerSharding *ServiceControllerShardingOptions
 }
 
 // NewCloudControllerManagerOptions creates a new ExternalCMServer with a default config.
@@ -100,6 +102,7 @@ func NewCloudControllerManagerOptions() (*CloudControllerManagerOptions, error)
 		Authorization:             apiserveroptions.NewDelegatingAuthorizationOptions(),
 		NodeStatusUpdateFrequency: componentConfig.NodeStatusUpdateFrequency,
 		DynamicReloading:          defaultDynamicReloadingOptions(),
+		ServiceControllerSharding: defaultServiceControllerShardingOptions(),
 	}
 
 	s.Authentication.RemoteKubeConfigFileOptional = true
@@ -137,6 +140,7 @@ func (o *CloudControllerManagerOptions) Flags(allControllers, disabledByDefaultC
 	o.Generic.AddFlags(&fss, allControllers, disabledByDefaultControllers, names.CCMControllerAliases())
 	o.KubeCloudShared.AddFlags(fss.FlagSet("generic"))
 	o.ServiceController.AddFlags(fss.FlagSet("service controller"))
+	o.ServiceControllerSharding.AddFlags(fss.FlagSet("service controller"))
 	o.NodeIPAMController.AddFlags(fss.FlagSet("node ipam controller"))
 
 	o.SecureServing.AddFlags(fss.FlagSet("secure serving"))
@@ -180,6 +184,9 @@ func (o *CloudControllerManagerOptions) ApplyTo(
 	if err = o.DynamicReloading.ApplyTo(&c.DynamicReloadingConfig); err != nil {
 		return err
 	}
+	if err = o.ServiceControllerSharding.ApplyTo(&c.ServiceControllerShardingConfig); err != nil {
+		return err
+	}
 	if o.SecureServing.BindPort != 0 || o.SecureServing.Listener != nil {
 		o.Authentication.RemoteKubeConfigFile = o.Kubeconfig
 		o.Authorization.RemoteKubeConfigFile = o.Kubeconfig
@@ -243,6 +250,7 @@ func (o *CloudControllerManagerOptions) Validate(allControllers, disabledByDefau
 	errors = append(errors, o.Authentication.Validate()...)
 	errors = append(errors, o.Authorization.Validate()...)
 	errors = append(errors, o.DynamicReloading.Validate()...)
+	errors = append(errors, o.ServiceControllerSharding.Validate()...)
 
 	if len(o.KubeCloudShared.CloudProvider.Name) == 0 {
 		errors = append(errors, fmt.Errorf("--cloud-provider cannot be empty"))
@@ -252,6 +260,10 @@ func (o *CloudControllerManagerOptions) Validate(allControllers, disabledByDefau
 		errors = append(errors, fmt.Errorf("--concurrent-service-syncs is limited to 1 only"))
 	}
 
+	if o.ServiceControllerSharding.ShardCount > 1 && !o.Generic.LeaderElection.LeaderElect {
+		errors = append(errors, fmt.Errorf("--service-controller-shards requires --leader-elect to be set to true"))
+	}
+
 	if !o.DynamicReloading.EnableDynamicReloading && o.KubeCloudShared.CloudProvider.CloudConfigFile == "" {
 		errors = append(errors, fmt.Errorf("--cloud-config cannot be empty when --enable-dynamic-reloading is not set to true"))
 	}
@@ -140,6 +140,9 @@ func TestDefaultFlags(t *testing.T) {
 			CloudConfigSecretNamespace: "kube-system",
 			CloudConfigKey:             "",
 		},
+		ServiceControllerSharding: &ServiceControllerShardingOptions{
+			ShardCount: 0,
+		},
 	}
 	if !reflect.DeepEqual(expected, s) {
 		t.Errorf("Got different run options than expected.\nDifference detected on:\n%s", diff.ObjectReflectDiff(expected, s))
@@ -184,6 +187,7 @@ func TestAddFlags(t *testing.T) {
 		"--use-service-account-credentials=false",
 		"--enable-dynamic-reloading=true",
 		"--cloud-config-secret-name=test-secret",
+		"--service-controller-shards=4",
 	}
 	err := fs.Parse(args)
 	if err != nil {
@@ -285,6 +289,9 @@ func TestAddFlags(t *testing.T) {
 			CloudConfigSecretNamespace: "kube-system",
 			CloudConfigKey:             "cloud-config",
 		},
+		ServiceControllerSharding: &ServiceControllerShardingOptions{
+			ShardCount: 4,
+		},
 	}
 	if !reflect.DeepEqual(expected, s) {
 		t.Errorf("Got different run options than expected.\nDifference detected on:\n%s", diff.ObjectReflectDiff(expected, s))
@@ -334,6 +341,27 @@ func TestValidate(t *testing.T) {
 				return s
 			},
 		},
+		{
+			desc:     "should return an error if the service controller is sharded without leader election",
+			expected: "--service-controller-shards requires --leader-elect to be set to true",
+			generateTestCloudControllerManagerOptions: func() *CloudControllerManagerOptions {
+				s, _ := NewCloudControllerManagerOptions()
+				s.KubeCloudShared.CloudProvider.CloudConfigFile = "azure.json"
+				s.Generic.LeaderElection.LeaderElect = false
+				s.ServiceControllerSharding.ShardCount = 2
+				return s
+			},
+		},
+		{
+			desc:     "should return an error if the number of service controller shards is negative",
+			expected: "--service-controller-shards must not be negative",
+			generateTestCloudControllerManagerOptions: func() *CloudControllerManagerOptions {
+				s, _ := NewCloudControllerManagerOptions()
+				s.KubeCloudShared.CloudProvider.CloudConfigFile = "azure.json"
+				s.ServiceControllerSharding.ShardCount = -1
+				return s
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	app "sigs.k8s.io/cloud-provider-azure/cmd/cloud-controller-manager/app/config"
+)
+
+// ServiceControllerShardingOptions holds the configurations of sharding the service controller
+type ServiceControllerShardingOptions struct {
+	ShardCount int
+}
+
+// AddFlags adds flags related to sharding the service controller for controller manager to the specified FlagSet
+func (o *ServiceControllerShardingOptions) AddFlags(fs *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+
+	fs.IntVar(&o.ShardCount, "service-controller-shards", o.ShardCount, "The number of shards of the service controller. "+
+		"Each shard is run by the replica holding its own lease, and reconciles the services of the load balancers whose names are hashed to it. "+
+		"The updates of the backend pool references of the VMs are serialized across the replicas by a shared lease. Sharding is disabled if it is not greater than 1.")
+}
+
+// ApplyTo fills up service controller sharding config with options
+func (o *ServiceControllerShardingOptions) ApplyTo(cfg *app.ServiceControllerShardingConfig) error {
+	if o == nil {
+		return nil
+	}
+
+	cfg.ShardCount = o.ShardCount
+
+	return nil
+}
+
+// Validate checks validation of ServiceControllerShardingOptions
+func (o *ServiceControllerShardingOptions) Validate() []error {
+	if o == nil {
+		return nil
+	}
+
+	if o.ShardCount < 0 {
+		return []error{fmt.Errorf("--service-controller-shards must not be negative")}
+	}
+	return nil
+}
+
+func defaultServiceControllerShardingOptions() *ServiceControllerShardingOptions {
+	return &ServiceControllerShardingOptions{
+		ShardCount: 0,
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+// getResyncPeriod returns the jittered interval of the reconciliation, or 0 if it is not configured.
+func getResyncPeriod(config *provider.ReconcileIntervalConfig) time.Duration {
+	if config == nil || config.IntervalInSeconds <= 0 {
+		return 0
+	}
+	period := time.Duration(config.IntervalInSeconds) * time.Second
+	if config.JitterFactor > 0 {
+		period = wait.Jitter(period, config.JitterFactor)
+	}
+	return period
+}
+
+// resyncInformer replaces the resync period of the event handlers added to the informer. The resyncs are delivered
+// to the handlers as additions, so that the handlers reconcile the unchanged objects as well. If coalesce is set,
+// only the first resync of each period is delivered, for the handlers reconciling all the objects at once.
+type resyncInformer struct {
+	cache.SharedIndexInformer
+	period   time.Duration
+	coalesce bool
+}
+
+func (i *resyncInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, _ time.Duration) (cache.ResourceEventHandlerRegistration, error) {
+	resyncHandler := &fullResyncHandler{ResourceEventHandler: handler}
+	if i.coalesce {
+		resyncHandler.coalesceWithin = i.period / 2
+	}
+	return i.SharedIndexInformer.AddEventHandlerWithResyncPeriod(resyncHandler, i.period)
+}
+
+// fullResyncHandler delivers the resyncs, i.e. the updates without a new resource version, as additions. The
+// resyncs within coalesceWithin since the last delivered one are dropped. The notifications of a handler are
+// delivered sequentially by the informer.
+type fullResyncHandler struct {
+	cache.ResourceEventHandler
+	coalesceWithin time.Duration
+	lastResync     time.Time
+}
+
+func (h *fullResyncHandler) OnUpdate(oldObj, newObj interface{}) {
+	oldMeta, err1 := meta.Accessor(oldObj)
+	newMeta, err2 := meta.Accessor(newObj)
+	if err1 != nil || err2 != nil || oldMeta.GetResourceVersion() != newMeta.GetResourceVersion() {
+		h.ResourceEventHandler.OnUpdate(oldObj, newObj)
+		return
+	}
+
+	now := time.Now()
+	if h.coalesceWithin > 0 && now.Sub(h.lastResync) < h.coalesceWithin {
+		return
+	}
+	h.lastResync = now
+	h.ResourceEventHandler.OnAdd(newObj, false)
+}
+
+type resyncServiceInformer struct {
+	coreinformers.ServiceInformer
+	informer *resyncInformer
+}
+
+func (i *resyncServiceInformer) Informer() cache.SharedIndexInformer {
+	return i.informer
+}
+
+type resyncNodeInformer struct {
+	coreinformers.NodeInformer
+	informer *resyncInformer
+}
+
+func (i *resyncNodeInformer) Informer() cache.SharedIndexInformer {
+	return i.informer
+}
+
+// withServiceResync returns the service informer whose event handlers reconcile all the services periodically by
+// the configured interval. The informer is returned as is if the interval is not configured.
+func withServiceResync(informer coreinformers.ServiceInformer, config *provider.ReconcileIntervalConfig) coreinformers.ServiceInformer {
+	period := getResyncPeriod(config)
+	if period == 0 {
+		return informer
+	}
+	klog.Infof("service controller reconciles all the services every %s", period)
+	return &resyncServiceInformer{
+		ServiceInformer: informer,
+		informer:        &resyncInformer{SharedIndexInformer: informer.Informer(), period: period},
+	}
+}
+
+// withNodeSync returns the node informer whose event handlers synchronize the nodes periodically by the configured
+// interval. The informer is returned as is if the interval is not configured. The resyncs of the nodes are coalesced
+// because the service controller synchronizes all the nodes on any node event.
+func withNodeSync(informer coreinformers.NodeInformer, config *provider.ReconcileIntervalConfig) coreinformers.NodeInformer {
+	period := getResyncPeriod(config)
+	if period == 0 {
+		return informer
+	}
+	klog.Infof("service controller synchronizes the nodes of the load balancers every %s", period)
+	return &resyncNodeInformer{
+		NodeInformer: informer,
+		informer:     &resyncInformer{SharedIndexInformer: informer.Informer(), period: period, coalesce: true},
+	}
+}
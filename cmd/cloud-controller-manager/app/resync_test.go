@@ -0,0 +1,92 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+func TestGetResyncPeriod(t *testing.T) {
+	assert.Equal(t, time.Duration(0), getResyncPeriod(nil))
+	assert.Equal(t, time.Duration(0), getResyncPeriod(&provider.ReconcileIntervalConfig{IntervalInSeconds: -1}))
+	assert.Equal(t, 10*time.Minute, getResyncPeriod(&provider.ReconcileIntervalConfig{IntervalInSeconds: 600}))
+
+	for i := 0; i < 10; i++ {
+		period := getResyncPeriod(&provider.ReconcileIntervalConfig{IntervalInSeconds: 600, JitterFactor: 0.5})
+		assert.GreaterOrEqual(t, period, 10*time.Minute)
+		assert.Less(t, period, 15*time.Minute)
+	}
+}
+
+func TestFullResyncHandler(t *testing.T) {
+	var added, updated int
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { added++ },
+		UpdateFunc: func(oldObj, newObj interface{}) { updated++ },
+	}
+	oldNode := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", ResourceVersion: "1"}}
+	newNode := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", ResourceVersion: "2"}}
+
+	// the resyncs are delivered as additions
+	resyncHandler := &fullResyncHandler{ResourceEventHandler: handler}
+	resyncHandler.OnUpdate(oldNode, oldNode)
+	resyncHandler.OnUpdate(oldNode, oldNode)
+	resyncHandler.OnUpdate(oldNode, newNode)
+	assert.Equal(t, 2, added)
+	assert.Equal(t, 1, updated)
+
+	// the resyncs are coalesced
+	added, updated = 0, 0
+	resyncHandler = &fullResyncHandler{ResourceEventHandler: handler, coalesceWithin: time.Hour}
+	resyncHandler.OnUpdate(oldNode, oldNode)
+	resyncHandler.OnUpdate(newNode, newNode)
+	resyncHandler.OnUpdate(oldNode, newNode)
+	assert.Equal(t, 1, added)
+	assert.Equal(t, 1, updated)
+}
+
+func TestWithServiceResync(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	serviceInformer := factory.Core().V1().Services()
+	nodeInformer := factory.Core().V1().Nodes()
+
+	assert.Equal(t, serviceInformer, withServiceResync(serviceInformer, nil))
+	assert.Equal(t, nodeInformer, withNodeSync(nodeInformer, &provider.ReconcileIntervalConfig{}))
+
+	resyncServiceInformer := withServiceResync(serviceInformer, &provider.ReconcileIntervalConfig{IntervalInSeconds: 600})
+	informer, ok := resyncServiceInformer.Informer().(*resyncInformer)
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Minute, informer.period)
+	assert.False(t, informer.coalesce)
+	assert.Equal(t, serviceInformer.Lister(), resyncServiceInformer.Lister())
+
+	informer, ok = withNodeSync(nodeInformer, &provider.ReconcileIntervalConfig{IntervalInSeconds: 300}).Informer().(*resyncInformer)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Minute, informer.period)
+	assert.True(t, informer.coalesce)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+// serviceShardInformer delivers to the event handlers added to the informer only the events of the services
+// reconciled by the shard. The service moved to another shard is dropped silently instead of being delivered as a
+// deletion, so that the shard does not clean up its load balancer.
+type serviceShardInformer struct {
+	cache.SharedIndexInformer
+	owns func(service *v1.Service) bool
+}
+
+func (i *serviceShardInformer) AddEventHandler(handler cache.ResourceEventHandler) (cache.ResourceEventHandlerRegistration, error) {
+	return i.SharedIndexInformer.AddEventHandler(&serviceShardHandler{ResourceEventHandler: handler, owns: i.owns})
+}
+
+func (i *serviceShardInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, resyncPeriod time.Duration) (cache.ResourceEventHandlerRegistration, error) {
+	return i.SharedIndexInformer.AddEventHandlerWithResyncPeriod(&serviceShardHandler{ResourceEventHandler: handler, owns: i.owns}, resyncPeriod)
+}
+
+// serviceShardHandler drops the events of the services reconciled by other shards.
+type serviceShardHandler struct {
+	cache.ResourceEventHandler
+	owns func(service *v1.Service) bool
+}
+
+func (h *serviceShardHandler) owned(obj interface{}) bool {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	service, ok := obj.(*v1.Service)
+	return !ok || h.owns(service)
+}
+
+func (h *serviceShardHandler) OnAdd(obj interface{}, isInInitialList bool) {
+	if h.owned(obj) {
+		h.ResourceEventHandler.OnAdd(obj, isInInitialList)
+	}
+}
+
+func (h *serviceShardHandler) OnUpdate(oldObj, newObj interface{}) {
+	if h.owned(newObj) {
+		h.ResourceEventHandler.OnUpdate(oldObj, newObj)
+	}
+}
+
+func (h *serviceShardHandler) OnDelete(obj interface{}) {
+	if h.owned(obj) {
+		h.ResourceEventHandler.OnDelete(obj)
+	}
+}
+
+type shardServiceInformer struct {
+	coreinformers.ServiceInformer
+	informer *serviceShardInformer
+}
+
+func (i *shardServiceInformer) Informer() cache.SharedIndexInformer {
+	return i.informer
+}
+
+// withServiceShard returns the service informer whose event handlers only see the services reconciled by the shard.
+func withServiceShard(informer coreinformers.ServiceInformer, az *provider.Cloud, shard, shardCount int) coreinformers.ServiceInformer {
+	return &shardServiceInformer{
+		ServiceInformer: informer,
+		informer: &serviceShardInformer{
+			SharedIndexInformer: informer.Informer(),
+			owns: func(service *v1.Service) bool {
+				return az.GetServiceShard(service, shardCount) == shard
+			},
+		},
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+func TestServiceShardHandler(t *testing.T) {
+	var added, updated, deleted []string
+	handler := &serviceShardHandler{
+		ResourceEventHandler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { added = append(added, obj.(*v1.Service).Name) },
+			UpdateFunc: func(_, newObj interface{}) { updated = append(updated, newObj.(*v1.Service).Name) },
+			DeleteFunc: func(obj interface{}) { deleted = append(deleted, "deleted") },
+		},
+		owns: func(service *v1.Service) bool {
+			return service.Annotations["shard"] == "0"
+		},
+	}
+	owned := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "owned", Annotations: map[string]string{"shard": "0"}}}
+	moved := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "owned", Annotations: map[string]string{"shard": "1"}}}
+	other := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "other", Annotations: map[string]string{"shard": "1"}}}
+
+	handler.OnAdd(owned, true)
+	handler.OnAdd(other, true)
+	assert.Equal(t, []string{"owned"}, added)
+
+	// the service moved to another shard is not delivered as a deletion
+	handler.OnUpdate(owned, owned)
+	handler.OnUpdate(owned, moved)
+	handler.OnUpdate(moved, owned)
+	assert.Equal(t, []string{"owned", "owned"}, updated)
+	assert.Empty(t, deleted)
+
+	handler.OnDelete(other)
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/other", Obj: other})
+	assert.Empty(t, deleted)
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/owned", Obj: owned})
+	assert.Len(t, deleted, 1)
+}
+
+func TestWithServiceShard(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	serviceInformer := factory.Core().V1().Services()
+
+	shardInformer := withServiceShard(serviceInformer, &provider.Cloud{}, 1, 2)
+	informer, ok := shardInformer.Informer().(*serviceShardInformer)
+	assert.True(t, ok)
+	assert.Equal(t, serviceInformer.Lister(), shardInformer.Lister())
+
+	// the external services without annotations are hashed to the same shard by every replica
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default"}}
+	assert.Equal(t, (&provider.Cloud{}).GetServiceShard(svc, 2) == 1, informer.owns(svc))
+}
@@ -31,6 +31,7 @@ import (
 	"k8s.io/component-base/config"
 	"k8s.io/component-base/term"
 	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
 	controllerhealthz "k8s.io/controller-manager/pkg/healthz"
 	"k8s.io/klog/v2"
 
@@ -38,6 +39,7 @@ import (
 	"sigs.k8s.io/cloud-provider-azure/cmd/cloud-node-manager/app/options"
 	nodeprovider "sigs.k8s.io/cloud-provider-azure/pkg/node"
 	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager"
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
 	"sigs.k8s.io/cloud-provider-azure/pkg/version"
 	"sigs.k8s.io/cloud-provider-azure/pkg/version/verflag"
 )
@@ -130,12 +132,13 @@ func startControllers(ctx context.Context, c *cloudnodeconfig.Config, stopCh <-c
 	klog.V(1).Infof("Starting cloud-node-manager...")
 
 	// Start the CloudNodeController
+	nodeProvider := nodeprovider.NewNodeProvider(ctx, c.UseInstanceMetadata, c.CloudConfigFilePath)
 	nodeController := nodemanager.NewCloudNodeController(
 		c.NodeName,
 		c.SharedInformers.Core().V1().Nodes(),
 		// cloud node controller uses existing cluster role from node-controller
 		c.ClientBuilder.ClientOrDie("node-controller"),
-		nodeprovider.NewNodeProvider(ctx, c.UseInstanceMetadata, c.CloudConfigFilePath),
+		nodeProvider,
 		c.NodeStatusUpdateFrequency.Duration,
 		c.WaitForRoutes,
 		c.EnableDeprecatedBetaTopologyLabels)
@@ -144,6 +147,12 @@ func startControllers(ctx context.Context, c *cloudnodeconfig.Config, stopCh <-c
 
 	check := controllerhealthz.NamedPingChecker(c.NodeName)
 	healthzHandler.AddHealthChecker(check)
+	// check the Azure dependencies of the node provider, e.g., the instance metadata service.
+	if healthCheckable, ok := nodeProvider.(controller.HealthCheckable); ok {
+		if realCheck := healthCheckable.HealthChecker(); realCheck != nil {
+			healthzHandler.AddHealthChecker(controllerhealthz.NamedHealthChecker(provider.AzureIMDSHealthCheckName, realCheck))
+		}
+	}
 
 	klog.Infof("Started cloud-node-manager")
 
@@ -17,6 +17,7 @@ limitations under the License.
 package azclient
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm/policy"
@@ -33,6 +34,20 @@ type ARMClientConfig struct {
 	// ResourceManagerEndpoint is the cloud's resource manager endpoint. If set, cloud provider queries this endpoint
 	// in order to generate an autorest.Environment instance instead of using one of the pre-defined Environments.
 	ResourceManagerEndpoint string `json:"resourceManagerEndpoint,omitempty" yaml:"resourceManagerEndpoint,omitempty"`
+	// HTTPSProxy is the URL of the proxy of the outbound HTTPS requests. It takes precedence over the HTTPS_PROXY environment variable.
+	HTTPSProxy string `json:"httpsProxy,omitempty" yaml:"httpsProxy,omitempty"`
+	// NoProxy is a comma-separated list of the hosts, domains, IPs and CIDRs bypassing HTTPSProxy.
+	NoProxy string `json:"noProxy,omitempty" yaml:"noProxy,omitempty"`
+	// CABundlePath is the path of a PEM bundle of the CA certificates trusted in addition to the system ones.
+	CABundlePath string `json:"caBundlePath,omitempty" yaml:"caBundlePath,omitempty"`
+}
+
+// newTransport returns the transport with the proxy and the CA bundle applied, or nil if neither is configured.
+func (config *ARMClientConfig) newTransport() (*http.Transport, error) {
+	if config == nil || (config.HTTPSProxy == "" && config.CABundlePath == "") {
+		return nil, nil
+	}
+	return utils.NewTransportWithProxyAndCA(config.HTTPSProxy, config.NoProxy, config.CABundlePath)
 }
 
 func NewClientOptionFromARMClientConfig(config *ARMClientConfig) (*policy.ClientOptions, error) {
@@ -45,7 +60,19 @@ func NewClientOptionFromARMClientConfig(config *ARMClientConfig) (*policy.Client
 		//set cloud
 		var cloudConfig *cloud.Configuration
 		cloudConfig, err = GetAzureCloudConfig(config)
+		if err != nil {
+			return nil, err
+		}
 		options.ClientOptions.Cloud = *cloudConfig
+
+		var transport *http.Transport
+		transport, err = config.newTransport()
+		if err != nil {
+			return nil, err
+		}
+		if transport != nil {
+			options.ClientOptions.Transport = &http.Client{Transport: transport}
+		}
 	} else {
 		options.ClientOptions.Cloud = cloud.AzurePublic
 	}
@@ -65,5 +65,17 @@ func GetDefaultResourceClientOption(armConfig *ARMClientConfig, factoryConfig *C
 		}
 	}
 	options.Transport = DefaultResourceClientTransport
-	return options, err
+	transport, err := armConfig.newTransport()
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		options.Transport = &http.Client{
+			Transport: armbalancer.New(context.Background(), armbalancer.Options{
+				Transport: transport,
+				PoolSize:  100,
+			}),
+		}
+	}
+	return options, nil
 }
@@ -18,8 +18,13 @@ package utils
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -46,3 +51,98 @@ func init() {
 		}
 	})
 }
+
+// NewTransportWithProxyAndCA returns a copy of DefaultTransport sending the HTTPS requests through httpsProxy,
+// except the ones to the hosts matched by noProxy, and trusting the CA certificates in caBundlePath in addition
+// to the system ones. It is required in locked-down networks where the environment variables are insufficient.
+func NewTransportWithProxyAndCA(httpsProxy, noProxy, caBundlePath string) (*http.Transport, error) {
+	transport := DefaultTransport.Clone()
+
+	if httpsProxy != "" {
+		proxyURL, err := url.Parse(httpsProxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid HTTPS proxy %q: it must be a URL like http://proxy.example.com:3128", httpsProxy)
+		}
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if !strings.EqualFold(req.URL.Scheme, "https") {
+				return http.ProxyFromEnvironment(req)
+			}
+			if !useProxy(req.URL.Host, noProxy) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	}
+
+	if caBundlePath != "" {
+		caBundle, err := os.ReadFile(caBundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA bundle %s: %w", caBundlePath, err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no PEM certificate is found in the CA bundle %s", caBundlePath)
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+
+	return transport, nil
+}
+
+// useProxy returns false if the host is matched by the comma-separated hosts, domains, IPs and CIDRs in noProxy.
+// A domain matches its subdomains as well, and a domain with a leading "." only matches its subdomains.
+func useProxy(host, noProxy string) bool {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	hostname = strings.ToLower(hostname)
+	ip := net.ParseIP(hostname)
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return false
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return false
+			}
+			continue
+		}
+
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		if entryIP := net.ParseIP(entryHost); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return false
+			}
+			continue
+		}
+		if strings.HasPrefix(entryHost, ".") {
+			if strings.HasSuffix(hostname, entryHost) {
+				return false
+			}
+			continue
+		}
+		if hostname == entryHost || strings.HasSuffix(hostname, "."+entryHost) {
+			return false
+		}
+	}
+
+	return true
+}
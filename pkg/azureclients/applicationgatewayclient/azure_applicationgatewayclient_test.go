@@ -0,0 +1,177 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applicationgatewayclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/utils/pointer"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient/mockarmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const testResourceID = "/subscriptions/subscriptionID/resourceGroups/rg/providers/" + applicationGatewayResourceType + "/appgw"
+
+func TestNew(t *testing.T) {
+	config := &azclients.ClientConfig{
+		SubscriptionID:          "sub",
+		ResourceManagerEndpoint: "endpoint",
+		Location:                "eastus",
+		RateLimitConfig: &azclients.RateLimitConfig{
+			CloudProviderRateLimit:            true,
+			CloudProviderRateLimitQPS:         0.5,
+			CloudProviderRateLimitBucket:      1,
+			CloudProviderRateLimitQPSWrite:    0.5,
+			CloudProviderRateLimitBucketWrite: 1,
+		},
+		Backoff: &retry.Backoff{Steps: 1},
+	}
+
+	appGatewayClient := New(config)
+	assert.Equal(t, "sub", appGatewayClient.subscriptionID)
+	assert.NotEmpty(t, appGatewayClient.rateLimiterReader)
+	assert.NotEmpty(t, appGatewayClient.rateLimiterWriter)
+}
+
+func TestGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"name":"appgw","etag":"etag"}`))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	appGatewayClient := getTestApplicationGatewayClient(armClient)
+	result, rerr := appGatewayClient.Get(context.TODO(), "rg", "appgw")
+	assert.Nil(t, rerr)
+	assert.Equal(t, "appgw", pointer.StringDeref(result.Name, ""))
+	assert.Equal(t, "etag", pointer.StringDeref(result.Etag, ""))
+}
+
+func TestGetNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	appGatewayClient := getTestApplicationGatewayClient(armClient)
+	result, rerr := appGatewayClient.Get(context.TODO(), "rg", "appgw")
+	assert.Empty(t, result.Name)
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusNotFound, rerr.HTTPStatusCode)
+}
+
+func TestGetThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, throttleErr).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	appGatewayClient := getTestApplicationGatewayClient(armClient)
+	result, rerr := appGatewayClient.Get(context.TODO(), "rg", "appgw")
+	assert.Empty(t, result)
+	assert.Equal(t, throttleErr, rerr)
+	assert.Equal(t, throttleErr.RetryAfter, appGatewayClient.RetryAfterReader)
+}
+
+func TestCreateOrUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	appGateway := getTestApplicationGateway()
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(""))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PutResource(gomock.Any(), testResourceID, appGateway, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	appGatewayClient := getTestApplicationGatewayClient(armClient)
+	rerr := appGatewayClient.CreateOrUpdate(context.TODO(), "rg", "appgw", appGateway, "etag")
+	assert.Nil(t, rerr)
+}
+
+func TestCreateOrUpdateNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	createOrUpdateErr := &retry.Error{
+		RawError:  fmt.Errorf("azure cloud provider rate limited(%s) for operation %q", "write", "AppGatewayCreateOrUpdate"),
+		Retriable: true,
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	appGatewayClient := getTestApplicationGatewayClient(armClient)
+	appGatewayClient.rateLimiterWriter = flowcontrol.NewFakeNeverRateLimiter()
+	rerr := appGatewayClient.CreateOrUpdate(context.TODO(), "rg", "appgw", getTestApplicationGateway(), "")
+	assert.Equal(t, createOrUpdateErr, rerr)
+}
+
+func getTestApplicationGateway() network.ApplicationGateway {
+	return network.ApplicationGateway{
+		ID:       pointer.String(testResourceID),
+		Name:     pointer.String("appgw"),
+		Location: pointer.String("eastus"),
+	}
+}
+
+func getTestApplicationGatewayClient(armClient armclient.Interface) *Client {
+	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(&azclients.RateLimitConfig{})
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    "subscriptionID",
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+	}
+}
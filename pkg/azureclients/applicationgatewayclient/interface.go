@@ -0,0 +1,40 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applicationgatewayclient
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	// APIVersion is the API version for network.
+	APIVersion = "2022-07-01"
+)
+
+// Interface is the client interface for Application Gateways.
+// Don't forget to run "hack/update-mock-clients.sh" command to generate the mock client.
+type Interface interface {
+	// Get gets an application gateway.
+	Get(ctx context.Context, resourceGroupName string, applicationGatewayName string) (result network.ApplicationGateway, rerr *retry.Error)
+
+	// CreateOrUpdate creates or updates an application gateway.
+	CreateOrUpdate(ctx context.Context, resourceGroupName string, applicationGatewayName string, parameters network.ApplicationGateway, etag string) *retry.Error
+}
@@ -17,10 +17,13 @@ limitations under the License.
 package armclient
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"html"
+	"io"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
@@ -33,6 +36,7 @@ import (
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/tracing"
+	"golang.org/x/sync/singleflight"
 	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
@@ -40,6 +44,27 @@ import (
 	"sigs.k8s.io/cloud-provider-azure/pkg/version"
 )
 
+const (
+	etagHeader        = "ETag"
+	ifNoneMatchHeader = "If-None-Match"
+
+	// etagCacheSize is the max number of the cached GET responses revalidated by ETags.
+	etagCacheSize = 256
+	// etagCacheMaxBytes is the max total size of the bodies of the cached GET responses, so that a few large
+	// payloads don't take the memory saved by not fetching them again.
+	etagCacheMaxBytes = 32 * 1024 * 1024
+	// etagCacheTTL is how long a cached GET response is kept after it is fetched or revalidated.
+	etagCacheTTL = 10 * time.Minute
+)
+
+// etagCachedResourceTypes are the lower-cased types of the resources whose GET responses are cached
+// and revalidated by ETags. They are the large payloads changing rarely. The load balancers are
+// revalidated by the load balancer client instead, which caches the decoded ones rather than the
+// raw bodies, so that their bodies are decoded from the connection directly.
+var etagCachedResourceTypes = map[string]bool{
+	"microsoft.network/networksecuritygroups": true,
+}
+
 // there is one sender per TLS renegotiation type, i.e. count of tls.RenegotiationSupport enums
 
 type defaultSender struct {
@@ -62,36 +87,23 @@ type Client struct {
 	baseURI          string
 	apiVersion       string
 	regionalEndpoint string
+	clusterName      string
+
+	asyncOperationTracker azureclients.AsyncOperationTracker
+
+	// getGroup coalesces the concurrent identical GET requests.
+	getGroup singleflight.Group
+	// etagCache holds the last responses with ETags of the GET requests of etagCachedResourceTypes
+	// keyed by the URL, which are revalidated by conditional GETs. It is bounded by the total size of
+	// the bodies.
+	etagCache *SizedLRUCache
 }
 
 func sender() autorest.Sender {
 	// note that we can't init defaultSenders in init() since it will
 	// execute before calling code has had a chance to enable tracing
 	defaultSenders.init.Do(func() {
-		// copied from http.DefaultTransport with a TLS minimum version.
-		transport := &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second, // the same as default transport
-				KeepAlive: 30 * time.Second, // the same as default transport
-			}).DialContext,
-			ForceAttemptHTTP2:     false,            // respect custom dialer (default is true)
-			MaxIdleConns:          100,              // Zero means no limit, the same as default transport
-			MaxIdleConnsPerHost:   100,              // Default is 2, ref:https://cs.opensource.google/go/go/+/go1.18.4:src/net/http/transport.go;l=58
-			IdleConnTimeout:       90 * time.Second, // the same as default transport
-			TLSHandshakeTimeout:   10 * time.Second, // the same as default transport
-			ExpectContinueTimeout: 1 * time.Second,  // the same as default transport
-			TLSClientConfig: &tls.Config{
-				MinVersion:    tls.VersionTLS12,     //force to use TLS 1.2
-				Renegotiation: tls.RenegotiateNever, // the same as default transport https://pkg.go.dev/crypto/tls#RenegotiationSupport
-			},
-		}
-		var roundTripper http.RoundTripper = transport
-		if tracing.IsEnabled() {
-			roundTripper = tracing.NewTransport(transport)
-		}
-		j, _ := cookiejar.New(nil)
-		defaultSenders.sender = &http.Client{Jar: j, Transport: roundTripper}
+		defaultSenders.sender = newSender(NewTransport())
 
 		// In go-autorest SDK https://github.com/Azure/go-autorest/blob/master/autorest/sender.go#L258-L287,
 		// if ARM returns http.StatusTooManyRequests, the sender doesn't increase the retry attempt count,
@@ -110,15 +122,53 @@ func sender() autorest.Sender {
 	return defaultSenders.sender
 }
 
+// NewTransport returns the default transport of the ARM requests.
+func NewTransport() *http.Transport {
+	// copied from http.DefaultTransport with a TLS minimum version.
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second, // the same as default transport
+			KeepAlive: 30 * time.Second, // the same as default transport
+		}).DialContext,
+		ForceAttemptHTTP2:     false,            // respect custom dialer (default is true)
+		MaxIdleConns:          100,              // Zero means no limit, the same as default transport
+		MaxIdleConnsPerHost:   100,              // Default is 2, ref:https://cs.opensource.google/go/go/+/go1.18.4:src/net/http/transport.go;l=58
+		IdleConnTimeout:       90 * time.Second, // the same as default transport
+		TLSHandshakeTimeout:   10 * time.Second, // the same as default transport
+		ExpectContinueTimeout: 1 * time.Second,  // the same as default transport
+		TLSClientConfig: &tls.Config{
+			MinVersion:    tls.VersionTLS12,     //force to use TLS 1.2
+			Renegotiation: tls.RenegotiateNever, // the same as default transport https://pkg.go.dev/crypto/tls#RenegotiationSupport
+		},
+	}
+}
+
+// newSender returns a sender of the requests through the transport.
+func newSender(transport *http.Transport) autorest.Sender {
+	var roundTripper http.RoundTripper = transport
+	if tracing.IsEnabled() {
+		roundTripper = tracing.NewTransport(transport)
+	}
+	j, _ := cookiejar.New(nil)
+	return &http.Client{Jar: j, Transport: roundTripper}
+}
+
 // New creates a ARM client
 func New(authorizer autorest.Authorizer, clientConfig azureclients.ClientConfig, baseURI, apiVersion string, sendDecoraters ...autorest.SendDecorator) *Client {
 	restClient := autorest.NewClientWithUserAgent(clientConfig.UserAgent)
 	restClient.Authorizer = authorizer
 	restClient.Sender = sender()
+	if clientConfig.Transport != nil {
+		restClient.Sender = newSender(clientConfig.Transport)
+	}
 
 	if clientConfig.UserAgent == "" {
 		restClient.UserAgent = GetUserAgent(restClient)
 	}
+	if clientConfig.UserAgentSuffix != "" {
+		restClient.UserAgent = fmt.Sprintf("%s %s", restClient.UserAgent, clientConfig.UserAgentSuffix)
+	}
 
 	if clientConfig.RestClientConfig.PollingDelay == nil {
 		restClient.PollingDelay = 5 * time.Second
@@ -154,6 +204,10 @@ func New(authorizer autorest.Authorizer, clientConfig azureclients.ClientConfig,
 		baseURI:          baseURI,
 		apiVersion:       apiVersion,
 		regionalEndpoint: fmt.Sprintf("%s.%s", clientConfig.Location, url.Host),
+		clusterName:      clientConfig.ClusterName,
+
+		asyncOperationTracker: clientConfig.AsyncOperationTracker,
+		etagCache:             NewSizedLRUCache(etagCacheSize, etagCacheMaxBytes),
 	}
 	client.client.Sender = autorest.DecorateSender(client.client,
 		autorest.DoCloseIfError(),
@@ -294,6 +348,30 @@ func (c *Client) WaitForAsyncOperationResult(ctx context.Context, future *azure.
 	return future.GetResult(c.client)
 }
 
+// resumeAsyncOperation waits for the tracked in-flight operation on the resource, which may be issued before the
+// controller restarts, so that the new request does not conflict with it.
+func (c *Client) resumeAsyncOperation(ctx context.Context, resourceID string) *retry.Error {
+	if c.asyncOperationTracker == nil {
+		return nil
+	}
+	future := c.asyncOperationTracker.Get(resourceID)
+	if future == nil {
+		return nil
+	}
+
+	klog.V(2).Infof("Resuming the in-flight operation on resource %s", resourceID)
+	if err := future.WaitForCompletionRef(ctx, c.client); err != nil {
+		if ctx.Err() != nil {
+			klog.V(5).Infof("Received error in resumeAsyncOperation: '%v'", err)
+			return retry.GetError(nil, err)
+		}
+		// the operation has failed, and the new request would still be issued
+		klog.Warningf("The in-flight operation on resource %s failed: %v", resourceID, err)
+	}
+	c.asyncOperationTracker.Delete(resourceID)
+	return nil
+}
+
 // SendAsync send a request and return a future object representing the async result as well as the origin http response
 func (c *Client) SendAsync(ctx context.Context, request *http.Request) (*azure.Future, *http.Response, *retry.Error) {
 	asyncResponse, rerr := c.Send(ctx, request)
@@ -363,17 +441,201 @@ func (c *Client) GetResource(ctx context.Context, resourceID string, decorators
 		return nil, retry.NewError(false, err)
 	}
 
-	return c.Send(ctx, request, DoHackRegionalRetryForGET(c))
+	// The concurrent GETs of the same URL, e.g., by the controllers reconciling the same
+	// resource after restart, share a single call to ARM.
+	sent := false
+	resultCh := c.getGroup.DoChan(request.URL.String(), func() (interface{}, error) {
+		sent = true
+		return newSharedGetResponse(c.sendConditionalGet(ctx, request)), nil
+	})
+	select {
+	case <-ctx.Done():
+		go func() {
+			result := <-resultCh
+			result.Val.(*sharedGetResponse).discard(result.Shared)
+		}()
+		return nil, retry.GetError(nil, ctx.Err())
+	case result := <-resultCh:
+		response, rerr := result.Val.(*sharedGetResponse).get(result.Shared)
+		if !sent && rerr != nil && ctx.Err() == nil &&
+			(errors.Is(rerr.RawError, context.Canceled) || errors.Is(rerr.RawError, context.DeadlineExceeded)) {
+			// the request is cancelled by the context of another caller, so send it again
+			klog.V(5).Infof("GetResource: the shared request of resource %s is cancelled, sending it again", resourceID)
+			return c.sendConditionalGet(ctx, request)
+		}
+		return response, rerr
+	}
+}
+
+// cachedGetResponse is the last response with an ETag of a GET request.
+type cachedGetResponse struct {
+	etag      string
+	header    http.Header
+	body      []byte
+	expiresAt time.Time
+}
+
+// isETagCachedResource returns true if the resource is of etagCachedResourceTypes. The child resources,
+// e.g., the backend pools of a load balancer, are not cached.
+func isETagCachedResource(resourceID string) bool {
+	idx := strings.LastIndex(strings.ToLower(resourceID), "/providers/")
+	if idx < 0 {
+		return false
+	}
+	parts := strings.Split(strings.Trim(resourceID[idx+len("/providers/"):], "/"), "/")
+	return len(parts) == 3 && etagCachedResourceTypes[strings.ToLower(parts[0]+"/"+parts[1])]
+}
+
+// toResponse returns a 200 response with the cached header and body.
+func (r *cachedGetResponse) toResponse(request *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       request,
+	}
+}
+
+// sendConditionalGet sends the GET request with the ETag of the cached response in If-None-Match
+// and returns the cached response if ARM responds 304 Not Modified, which saves the bandwidth and
+// the throttling quota of the large payloads changing rarely, e.g., security groups.
+// The GET requests of the other resources are sent as is.
+func (c *Client) sendConditionalGet(ctx context.Context, request *http.Request) (*http.Response, *retry.Error) {
+	if !isETagCachedResource(request.URL.Path) {
+		return c.Send(ctx, request, DoHackRegionalRetryForGET(c))
+	}
+
+	key := request.URL.String()
+	var cached *cachedGetResponse
+	if v, ok := c.etagCache.Get(key); ok && time.Now().Before(v.(*cachedGetResponse).expiresAt) {
+		cached = v.(*cachedGetResponse)
+		if request.Header == nil {
+			request.Header = make(http.Header)
+		}
+		request.Header.Set(ifNoneMatchHeader, cached.etag)
+	} else {
+		request.Header.Del(ifNoneMatchHeader)
+	}
+
+	response, rerr := c.Send(ctx, request, DoHackRegionalRetryForGET(c))
+	if response == nil {
+		return response, rerr
+	}
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		klog.V(6).Infof("sendConditionalGet: %s is not modified since ETag %s", request.URL.Path, cached.etag)
+		c.CloseResponse(ctx, response)
+		revalidated := *cached
+		revalidated.expiresAt = time.Now().Add(etagCacheTTL)
+		c.etagCache.Add(key, &revalidated, int64(len(revalidated.body)))
+		return cached.toResponse(request), nil
+	}
+
+	etag := response.Header.Get(etagHeader)
+	if rerr != nil || response.StatusCode != http.StatusOK || etag == "" || response.Body == nil {
+		c.etagCache.Remove(key)
+		return response, rerr
+	}
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		c.etagCache.Remove(key)
+		return response, retry.GetError(response, err)
+	}
+	c.etagCache.Add(key, &cachedGetResponse{
+		etag:      etag,
+		header:    response.Header.Clone(),
+		body:      body,
+		expiresAt: time.Now().Add(etagCacheTTL),
+	}, int64(len(body)))
+	return response, nil
+}
+
+// sharedGetResponse is the result of a GET request shared by the concurrent callers.
+type sharedGetResponse struct {
+	response *http.Response
+	rerr     *retry.Error
+
+	// readOnce reads the body of the response once it is shared by multiple callers.
+	readOnce sync.Once
+	body     []byte
+}
+
+func newSharedGetResponse(response *http.Response, rerr *retry.Error) *sharedGetResponse {
+	return &sharedGetResponse{
+		response: response,
+		rerr:     rerr,
+	}
+}
+
+// get returns the response. The response is returned as is to its only caller, so that the body is read
+// from the connection directly. Otherwise, the body is read into memory and each caller gets a copy of
+// the response with its own body, so that each caller can read and close it.
+func (s *sharedGetResponse) get(shared bool) (*http.Response, *retry.Error) {
+	if !shared {
+		return s.response, s.rerr
+	}
+
+	var response *http.Response
+	rerr := s.rerr
+	if s.response != nil {
+		s.readOnce.Do(func() {
+			if s.response.Body == nil {
+				return
+			}
+			body, err := io.ReadAll(s.response.Body)
+			_ = s.response.Body.Close()
+			if err != nil && s.rerr == nil {
+				s.rerr = retry.GetError(s.response, err)
+			}
+			s.body = body
+		})
+		rerr = s.rerr
+		r := *s.response
+		r.Header = s.response.Header.Clone()
+		if s.response.Body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(s.body))
+		}
+		response = &r
+	}
+	if rerr != nil {
+		e := *rerr
+		rerr = &e
+	}
+	return response, rerr
+}
+
+// discard closes the body of the response abandoned by a caller.
+func (s *sharedGetResponse) discard(shared bool) {
+	if response, _ := s.get(shared); response != nil && response.Body != nil {
+		_ = response.Body.Close()
+	}
 }
 
 // PutResource puts a resource by resource ID
 func (c *Client) PutResource(ctx context.Context, resourceID string, parameters interface{}, decorators ...autorest.PrepareDecorator) (*http.Response, *retry.Error) {
+	if rerr := c.resumeAsyncOperation(ctx, resourceID); rerr != nil {
+		return nil, rerr
+	}
+
 	future, rerr := c.PutResourceAsync(ctx, resourceID, parameters, decorators...)
 	if rerr != nil {
 		return nil, rerr
 	}
 
+	if c.asyncOperationTracker != nil {
+		c.asyncOperationTracker.Set(resourceID, future)
+	}
 	response, err := c.WaitForAsyncOperationResult(ctx, future, "armclient.PutResource")
+	// keep tracking the operation if the context is canceled before it is completed
+	if c.asyncOperationTracker != nil && ctx.Err() == nil {
+		c.asyncOperationTracker.Delete(resourceID)
+	}
 	if err != nil {
 		if response != nil {
 			klog.V(5).Infof("Received error in WaitForAsyncOperationResult: '%s', response code %d", err.Error(), response.StatusCode)
@@ -661,7 +923,8 @@ func (c *Client) CloseResponse(ctx context.Context, response *http.Response) {
 func (c *Client) prepareRequest(ctx context.Context, decorators ...autorest.PrepareDecorator) (*http.Request, error) {
 	decorators = append(
 		decorators,
-		withAPIVersion(c.apiVersion))
+		withAPIVersion(c.apiVersion),
+		withOperationAnnotation(c.clusterName))
 	preparer := autorest.CreatePreparer(decorators...)
 	return preparer.Prepare((&http.Request{}).WithContext(ctx))
 }
@@ -23,7 +23,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -38,9 +40,11 @@ import (
 )
 
 const (
-	testResourceID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testPIP"
-	operationURI   = "/subscriptions/subscription/providers/Microsoft.Network/locations/eastus/operations/op?api-version=2019-01-01"
-	expectedURI    = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testPIP?api-version=2019-01-01"
+	testResourceID    = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testPIP"
+	testLBResourceID  = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/testLB"
+	testNSGResourceID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/testNSG"
+	operationURI      = "/subscriptions/subscription/providers/Microsoft.Network/locations/eastus/operations/op?api-version=2019-01-01"
+	expectedURI       = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testPIP?api-version=2019-01-01"
 )
 
 func TestSend(t *testing.T) {
@@ -133,6 +137,30 @@ func TestDoHackRegionalRetryForGET(t *testing.T) {
 	}
 }
 
+func TestDoHackRegionalRetryForGETNotModified(t *testing.T) {
+	regionalCount := 0
+	regionalServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		regionalCount++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer regionalServer.Close()
+	globalServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer globalServer.Close()
+
+	azConfig := azureclients.ClientConfig{Backoff: &retry.Backoff{Steps: 1}, UserAgent: "test", Location: "eastus"}
+	armClient := New(nil, azConfig, globalServer.URL, "2019-01-01")
+	targetURL, _ := url.Parse(regionalServer.URL)
+	armClient.regionalEndpoint = targetURL.Host
+
+	request, err := armClient.PrepareGetRequest(context.Background(), autorest.WithPath(testResourceID), autorest.WithHeader("If-None-Match", `W/"1"`))
+	assert.NoError(t, err)
+	response, _ := armClient.Send(context.Background(), request, DoHackRegionalRetryForGET(armClient))
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+	assert.Equal(t, 0, regionalCount)
+}
+
 func TestSendFailure(t *testing.T) {
 	count := 0
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -382,6 +410,112 @@ func TestGetResource(t *testing.T) {
 	}
 }
 
+func TestGetResourceCoalescesConcurrentRequests(t *testing.T) {
+	var count int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		<-release
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("{data: testPIP}"))
+	}))
+	defer server.Close()
+
+	azConfig := azureclients.ClientConfig{Backoff: &retry.Backoff{Steps: 1}, UserAgent: "test", Location: "eastus"}
+	armClient := New(nil, azConfig, server.URL, "2019-01-01")
+	armClient.client.RetryDuration = time.Millisecond * 1
+
+	const callers = 5
+	wg := sync.WaitGroup{}
+	bodies := make([]string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, rerr := armClient.GetResource(context.Background(), testResourceID)
+			assert.Nil(t, rerr)
+			body, _ := io.ReadAll(response.Body)
+			bodies[i] = string(body)
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&count) == 1 }, time.Second, 10*time.Millisecond)
+	// wait for the other callers to join the in-flight request
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	for _, body := range bodies {
+		assert.Equal(t, "{data: testPIP}", body)
+	}
+
+	// the requests are not coalesced after the in-flight one completes
+	_, rerr := armClient.GetResource(context.Background(), testResourceID)
+	assert.Nil(t, rerr)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
+
+func TestSharedGetResponse(t *testing.T) {
+	newResponse := func() *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{data: testPIP}"))}
+	}
+
+	// the body is not read into memory if the response is not shared
+	response := newResponse()
+	unshared, rerr := newSharedGetResponse(response, nil).get(false)
+	assert.Nil(t, rerr)
+	assert.Same(t, response, unshared)
+
+	shared := newSharedGetResponse(newResponse(), nil)
+	for i := 0; i < 2; i++ {
+		response, rerr := shared.get(true)
+		assert.Nil(t, rerr)
+		body, _ := io.ReadAll(response.Body)
+		assert.Equal(t, "{data: testPIP}", string(body))
+	}
+}
+
+func TestGetResourceSharedRequestCancelled(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			// the first request is cancelled by its caller
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("{data: testPIP}"))
+	}))
+	defer server.Close()
+
+	azConfig := azureclients.ClientConfig{Backoff: &retry.Backoff{Steps: 1}, UserAgent: "test", Location: "eastus"}
+	armClient := New(nil, azConfig, server.URL, "2019-01-01")
+	armClient.client.RetryDuration = time.Millisecond * 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		_, rerr := armClient.GetResource(ctx, testResourceID)
+		assert.NotNil(t, rerr)
+	}()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&count) == 1 }, time.Second, 10*time.Millisecond)
+
+	followerDone := make(chan struct{})
+	go func() {
+		defer close(followerDone)
+		response, rerr := armClient.GetResource(context.Background(), testResourceID)
+		assert.Nil(t, rerr)
+		body, _ := io.ReadAll(response.Body)
+		assert.Equal(t, "{data: testPIP}", string(body))
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-leaderDone
+	<-followerDone
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
+
 func TestPutResource(t *testing.T) {
 	handlers := []func(http.ResponseWriter, *http.Request){
 		func(rw http.ResponseWriter, req *http.Request) {
@@ -422,6 +556,91 @@ func TestPutResource(t *testing.T) {
 	assert.Equal(t, true, rerr.Retriable)
 }
 
+func TestPutResourceWithContextTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == "PUT" {
+			rw.Header().Set("Azure-AsyncOperation",
+				fmt.Sprintf("http://%s%s", req.Host, operationURI))
+			rw.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write([]byte(`{"status":"InProgress"}`))
+	}))
+	defer server.Close()
+
+	azConfig := azureclients.ClientConfig{Backoff: &retry.Backoff{Steps: 1}, UserAgent: "test", Location: "eastus"}
+	armClient := New(nil, azConfig, server.URL, "2019-01-01")
+	armClient.client.PollingDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	response, rerr := armClient.PutResource(ctx, testResourceID, nil)
+	assert.Nil(t, response)
+	assert.NotNil(t, rerr)
+	assert.ErrorIs(t, rerr.RawError, context.DeadlineExceeded)
+	assert.True(t, rerr.Retriable)
+}
+
+type fakeAsyncOperationTracker struct {
+	futures map[string]*azure.Future
+}
+
+func (t *fakeAsyncOperationTracker) Get(resourceID string) *azure.Future {
+	return t.futures[resourceID]
+}
+
+func (t *fakeAsyncOperationTracker) Set(resourceID string, future *azure.Future) {
+	t.futures[resourceID] = future
+}
+
+func (t *fakeAsyncOperationTracker) Delete(resourceID string) {
+	delete(t.futures, resourceID)
+}
+
+func TestPutResourceResumesTrackedOperation(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests = append(requests, fmt.Sprintf("%s %s", req.Method, req.URL.String()))
+		switch {
+		case req.Method == "PUT":
+			rw.Header().Set("Azure-AsyncOperation",
+				fmt.Sprintf("http://%s%s", req.Host, operationURI))
+			rw.WriteHeader(http.StatusCreated)
+		case req.URL.String() == operationURI:
+			rw.WriteHeader(http.StatusOK)
+			_, _ = rw.Write([]byte(`{"status":"Succeeded"}`))
+		default:
+			rw.WriteHeader(http.StatusOK)
+			_, _ = rw.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	tracker := &fakeAsyncOperationTracker{futures: map[string]*azure.Future{}}
+	azConfig := azureclients.ClientConfig{Backoff: &retry.Backoff{Steps: 1}, UserAgent: "test", Location: "eastus", AsyncOperationTracker: tracker}
+	armClient := New(nil, azConfig, server.URL, "2019-01-01")
+	armClient.client.PollingDelay = time.Millisecond
+
+	// the operation issued before the restart is persisted as JSON
+	future, rerr := armClient.PutResourceAsync(context.Background(), testResourceID, nil)
+	assert.Nil(t, rerr)
+	futureJSON, err := future.MarshalJSON()
+	assert.NoError(t, err)
+	resumedFuture := &azure.Future{}
+	assert.NoError(t, resumedFuture.UnmarshalJSON(futureJSON))
+	tracker.Set(testResourceID, resumedFuture)
+	requests = []string{}
+
+	response, rerr := armClient.PutResource(context.Background(), testResourceID, nil)
+	assert.Nil(t, rerr)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "GET "+operationURI, requests[0])
+	assert.Equal(t, "PUT "+expectedURI, requests[1])
+	assert.Empty(t, tracker.futures)
+}
+
 func getTestServer(t *testing.T, counter *int) *httptest.Server {
 	serverFuncs := []func(rw http.ResponseWriter, req *http.Request){
 		func(rw http.ResponseWriter, req *http.Request) {
@@ -705,6 +924,63 @@ func TestGetUserAgent(t *testing.T) {
 
 	userAgent := GetUserAgent(armClient.client)
 	assert.Contains(t, userAgent, armClient.client.UserAgent)
+
+	armClient = New(nil, azureclients.ClientConfig{UserAgent: "test", UserAgentSuffix: "cluster-a"}, "", "2019-01-01")
+	assert.True(t, strings.HasSuffix(armClient.client.UserAgent, " test cluster-a"))
+}
+
+func TestOperationAnnotation(t *testing.T) {
+	for _, tc := range []struct {
+		description                  string
+		clusterName                  string
+		annotation                   *OperationAnnotation
+		expectedAnnotation           string
+		expectedCorrelationRequestID string
+	}{
+		{
+			description: "no annotation",
+		},
+		{
+			description:        "cluster name only",
+			clusterName:        "cluster",
+			expectedAnnotation: "cluster=cluster",
+		},
+		{
+			description:                  "cluster name and operation annotation",
+			clusterName:                  "cluster",
+			annotation:                   &OperationAnnotation{Controller: "service", ReconcileID: "id"},
+			expectedAnnotation:           "cluster=cluster; controller=service; reconcile-id=id",
+			expectedCorrelationRequestID: "id",
+		},
+		{
+			description:        "operation annotation without reconcile ID",
+			annotation:         &OperationAnnotation{Controller: "route"},
+			expectedAnnotation: "controller=route",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tc.expectedAnnotation, r.Header.Get(operationAnnotationHeader))
+				assert.Equal(t, tc.expectedCorrelationRequestID, r.Header.Get(correlationRequestIDHeader))
+				assert.True(t, strings.HasSuffix(r.Header.Get("User-Agent"), " test suffix"))
+				w.WriteHeader(http.StatusOK)
+				_, err := w.Write([]byte("{}"))
+				assert.NoError(t, err)
+			}))
+			defer server.Close()
+
+			azConfig := azureclients.ClientConfig{Backoff: &retry.Backoff{Steps: 1}, UserAgent: "test", UserAgentSuffix: "suffix", ClusterName: tc.clusterName}
+			armClient := New(nil, azConfig, server.URL, "2019-01-01")
+
+			ctx := context.Background()
+			if tc.annotation != nil {
+				ctx = WithOperationAnnotation(ctx, *tc.annotation)
+			}
+			response, rerr := armClient.GetResource(ctx, testResourceID)
+			assert.Nil(t, rerr)
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+		})
+	}
 }
 
 func TestGetResourceID(t *testing.T) {
@@ -749,3 +1025,116 @@ func TestGetResourceID(t *testing.T) {
 		})
 	}
 }
+
+func TestGetResourceWithETag(t *testing.T) {
+	var count int32
+	etag := `W/"1"`
+	body := "{data: testNSG}"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	azConfig := azureclients.ClientConfig{Backoff: &retry.Backoff{Steps: 1}, UserAgent: "test", Location: "eastus"}
+	armClient := New(nil, azConfig, server.URL, "2019-01-01")
+	armClient.client.RetryDuration = time.Millisecond * 1
+
+	getBody := func() string {
+		response, rerr := armClient.GetResource(context.Background(), testNSGResourceID)
+		assert.Nil(t, rerr)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, etag, response.Header.Get("ETag"))
+		b, _ := io.ReadAll(response.Body)
+		return string(b)
+	}
+
+	assert.Equal(t, "{data: testNSG}", getBody())
+	// the cached response is returned if the resource is not modified
+	assert.Equal(t, "{data: testNSG}", getBody())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+	// the cache is refreshed after the resource is modified
+	etag = `W/"2"`
+	body = "{data: updatedNSG}"
+	assert.Equal(t, "{data: updatedNSG}", getBody())
+	assert.Equal(t, "{data: updatedNSG}", getBody())
+	assert.Equal(t, int32(4), atomic.LoadInt32(&count))
+
+	// the expired response is not revalidated
+	key := server.URL + testNSGResourceID + "?api-version=2019-01-01"
+	v, ok := armClient.etagCache.Get(key)
+	assert.True(t, ok)
+	v.(*cachedGetResponse).expiresAt = time.Now()
+	assert.Equal(t, "{data: updatedNSG}", getBody())
+	assert.Equal(t, int32(5), atomic.LoadInt32(&count))
+
+	// the responses of the other resources are not cached
+	for _, resourceID := range []string{testResourceID, testLBResourceID} {
+		_, rerr := armClient.GetResource(context.Background(), resourceID)
+		assert.Nil(t, rerr)
+		_, rerr = armClient.GetResource(context.Background(), resourceID)
+		assert.Nil(t, rerr)
+	}
+	assert.Equal(t, int32(9), atomic.LoadInt32(&count))
+	assert.Equal(t, 1, armClient.etagCache.Len())
+}
+
+func TestIsETagCachedResource(t *testing.T) {
+	assert.True(t, isETagCachedResource(testNSGResourceID))
+	assert.False(t, isETagCachedResource(testLBResourceID))
+	assert.False(t, isETagCachedResource(testResourceID))
+	assert.False(t, isETagCachedResource(testNSGResourceID+"/securityRules/rule"))
+	assert.False(t, isETagCachedResource("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups"))
+}
+
+func TestByStreamingJSON(t *testing.T) {
+	type resource struct {
+		Name string `json:"name"`
+	}
+	for _, tc := range []struct {
+		desc        string
+		body        string
+		expected    resource
+		expectedErr bool
+	}{
+		{
+			desc:     "should decode the body",
+			body:     `{"name": "lb1"}`,
+			expected: resource{Name: "lb1"},
+		},
+		{
+			desc:     "should skip the byte order mark",
+			body:     "\xef\xbb\xbf" + `{"name": "lb1"}`,
+			expected: resource{Name: "lb1"},
+		},
+		{
+			desc: "should not report an empty body",
+		},
+		{
+			desc:        "should report a truncated body",
+			body:        `{"name": "lb`,
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var result resource
+			response := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(tc.body))}
+			err := autorest.Respond(response, ByStreamingJSON(&result))
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestIsEmptyJSONBody(t *testing.T) {
+	assert.True(t, isEmptyJSONBody(nil))
+	assert.True(t, isEmptyJSONBody([]byte("{}")))
+	assert.False(t, isEmptyJSONBody([]byte(`{"name": "lb1"}`)))
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package armclient
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/lru"
+)
+
+// SizedLRUCache is an LRU cache bounded by both the number of the entries and their total size, so that a few
+// large payloads, e.g., the load balancers with thousands of rules, don't take the memory saved by caching them.
+// It is safe for concurrent use.
+type SizedLRUCache struct {
+	cache *lru.Cache
+	// lock serializes the additions, which evict the oldest entries until the total size, bytes, is within
+	// maxBytes.
+	lock     sync.Mutex
+	bytes    int64
+	maxBytes int64
+}
+
+// sizedLRUCacheEntry is a value in SizedLRUCache and its size.
+type sizedLRUCacheEntry struct {
+	value interface{}
+	size  int64
+}
+
+// NewSizedLRUCache creates a SizedLRUCache holding at most maxEntries entries of maxBytes in total.
+func NewSizedLRUCache(maxEntries int, maxBytes int64) *SizedLRUCache {
+	c := &SizedLRUCache{maxBytes: maxBytes}
+	c.cache = lru.NewWithEvictionFunc(maxEntries, func(_ lru.Key, value interface{}) {
+		atomic.AddInt64(&c.bytes, -value.(*sizedLRUCacheEntry).size)
+	})
+	return c
+}
+
+// Get returns the value of the key and marks it as the most recently used.
+func (c *SizedLRUCache) Get(key string) (interface{}, bool) {
+	v, ok := c.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*sizedLRUCacheEntry).value, true
+}
+
+// Add adds the value of the given size and evicts the oldest entries until the total size is within the limit.
+// The values larger than the limit are not cached, and the value replaced by them is removed.
+func (c *SizedLRUCache) Add(key string, value interface{}, size int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// the replaced value is removed first, so that its size is deducted by the eviction func
+	c.cache.Remove(key)
+	if size > c.maxBytes {
+		klog.V(6).Infof("SizedLRUCache: skip caching %s of %d bytes", key, size)
+		return
+	}
+	c.cache.Add(key, &sizedLRUCacheEntry{value: value, size: size})
+	atomic.AddInt64(&c.bytes, size)
+	for atomic.LoadInt64(&c.bytes) > c.maxBytes && c.cache.Len() > 1 {
+		c.cache.RemoveOldest()
+	}
+}
+
+// Remove removes the value of the key if any.
+func (c *SizedLRUCache) Remove(key string) {
+	c.cache.Remove(key)
+}
+
+// Len returns the number of the cached values.
+func (c *SizedLRUCache) Len() int {
+	return c.cache.Len()
+}
+
+// Bytes returns the total size of the cached values.
+func (c *SizedLRUCache) Bytes() int64 {
+	return atomic.LoadInt64(&c.bytes)
+}
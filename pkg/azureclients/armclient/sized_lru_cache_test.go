@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package armclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizedLRUCache(t *testing.T) {
+	cache := NewSizedLRUCache(3, 10)
+
+	cache.Add("lb1", "1234", 4)
+	cache.Add("lb2", "1234", 4)
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, int64(8), cache.Bytes())
+
+	// the replaced value is not counted twice
+	cache.Add("lb2", "123", 3)
+	assert.Equal(t, int64(7), cache.Bytes())
+	v, ok := cache.Get("lb2")
+	assert.True(t, ok)
+	assert.Equal(t, "123", v)
+
+	// the oldest values are evicted to keep the total size within the limit
+	cache.Add("lb3", "1234", 4)
+	_, ok = cache.Get("lb1")
+	assert.False(t, ok)
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, int64(7), cache.Bytes())
+
+	// the values larger than the limit are not cached
+	cache.Add("lb2", "12345678901", 11)
+	_, ok = cache.Get("lb2")
+	assert.False(t, ok)
+	assert.Equal(t, int64(4), cache.Bytes())
+
+	// the number of the values is bounded as well
+	cache.Add("lb4", "1", 1)
+	cache.Add("lb5", "1", 1)
+	cache.Add("lb6", "1", 1)
+	assert.Equal(t, 3, cache.Len())
+	assert.Equal(t, int64(3), cache.Bytes())
+
+	cache.Remove("lb6")
+	assert.Equal(t, int64(2), cache.Bytes())
+}
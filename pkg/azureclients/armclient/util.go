@@ -17,8 +17,11 @@ limitations under the License.
 package armclient
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
 	"io"
@@ -35,6 +38,72 @@ import (
 	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
 )
 
+const (
+	// operationAnnotationHeader carries the cluster, the controller and the reconcile ID of the operation issuing
+	// the request, so that Azure support can correlate the throttling and the failures with them.
+	operationAnnotationHeader = "x-ms-client-annotation"
+	// correlationRequestIDHeader is logged by ARM for all the requests of the same reconcile.
+	correlationRequestIDHeader = "x-ms-correlation-request-id"
+)
+
+// OperationAnnotation identifies the operation issuing the ARM requests.
+type OperationAnnotation struct {
+	// Controller is the controller running the operation, e.g., service or route.
+	Controller string
+	// ReconcileID identifies a single reconcile of the controller, and is sent as the correlation request ID.
+	ReconcileID string
+}
+
+type operationAnnotationKey struct{}
+
+// WithOperationAnnotation returns a copy of the context annotating the ARM requests issued with it.
+func WithOperationAnnotation(ctx context.Context, annotation OperationAnnotation) context.Context {
+	return context.WithValue(ctx, operationAnnotationKey{}, annotation)
+}
+
+// OperationAnnotationFromContext returns the operation annotation of the context if any.
+func OperationAnnotationFromContext(ctx context.Context) (OperationAnnotation, bool) {
+	annotation, ok := ctx.Value(operationAnnotationKey{}).(OperationAnnotation)
+	return annotation, ok
+}
+
+// withOperationAnnotation puts the cluster name and the operation annotation of the request context into the
+// request headers.
+func withOperationAnnotation(clusterName string) autorest.PrepareDecorator {
+	return func(p autorest.Preparer) autorest.Preparer {
+		return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+			r, err := p.Prepare(r)
+			if err != nil {
+				return r, err
+			}
+
+			var parts []string
+			if clusterName != "" {
+				parts = append(parts, "cluster="+clusterName)
+			}
+			annotation, ok := OperationAnnotationFromContext(r.Context())
+			if ok && annotation.Controller != "" {
+				parts = append(parts, "controller="+annotation.Controller)
+			}
+			if ok && annotation.ReconcileID != "" {
+				parts = append(parts, "reconcile-id="+annotation.ReconcileID)
+			}
+			if len(parts) == 0 {
+				return r, nil
+			}
+
+			if r.Header == nil {
+				r.Header = make(http.Header)
+			}
+			r.Header.Set(operationAnnotationHeader, strings.Join(parts, "; "))
+			if ok && annotation.ReconcileID != "" {
+				r.Header.Set(correlationRequestIDHeader, annotation.ReconcileID)
+			}
+			return r, nil
+		})
+	}
+}
+
 func NewRateLimitSendDecorater(ratelimiter flowcontrol.RateLimiter, mc *metrics.MetricContext) autorest.SendDecorator {
 	return func(s autorest.Sender) autorest.Sender {
 		return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
@@ -114,25 +183,24 @@ func DoHackRegionalRetryForGET(c *Client) autorest.SendDecorator {
 				return response, rerr
 			}
 
-			bodyBytes, _ := io.ReadAll(response.Body)
-			defer func() {
-				response.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-			}()
-
-			bodyString := string(bodyBytes)
-			trimmed := strings.TrimSpace(bodyString)
-			klog.V(6).Infof("Send.sendRequest got response with ContentLength %d, StatusCode %d and responseBody length %d", response.ContentLength, response.StatusCode, len(trimmed))
+			// Only the leading bytes of the body are read to tell the empty bodies, so that the multi-MB
+			// payloads of large resources are decoded from the body directly by the callers.
+			trimmed := bytes.TrimSpace(peekBody(response))
+			klog.V(6).Infof("Send.sendRequest got response with ContentLength %d and StatusCode %d", response.ContentLength, response.StatusCode)
 
 			// Hack: retry the regional ARM endpoint in case of ARM traffic split and arm resource group replication is too slow
 			// Empty content and 2xx http status code are returned in this case.
 			// Issue: https://github.com/kubernetes-sigs/cloud-provider-azure/issues/1296
 			// Such situation also needs retrying that ContentLength is -1, StatusCode is 200 and an empty body is returned.
-			emptyResp := (response.ContentLength == 0 || trimmed == "" || trimmed == "{}") && response.StatusCode >= 200 && response.StatusCode < 300
+			emptyResp := (response.ContentLength == 0 || isEmptyJSONBody(trimmed)) && response.StatusCode >= 200 && response.StatusCode < 300
 			if !emptyResp {
-				if rerr == nil || response.StatusCode == http.StatusNotFound || c.regionalEndpoint == "" {
+				// 304 Not Modified is the expected response of a conditional GET of an unchanged resource
+				if rerr == nil || response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusNotModified || c.regionalEndpoint == "" {
 					return response, rerr
 				}
 
+				// the error bodies are small, so they are read as a whole
+				bodyBytes := readBody(response)
 				var body map[string]interface{}
 				if e := json.Unmarshal(bodyBytes, &body); e != nil {
 					klog.Errorf("Send.sendRequest: error in parsing response body string %q: %s, Skip retrying regional host", bodyBytes, e.Error())
@@ -177,13 +245,8 @@ func DoHackRegionalRetryForGET(c *Client) autorest.SendDecorator {
 			}
 
 			// Do the same check on regional response just like the global one
-			bodyBytes, _ = io.ReadAll(regionalResponse.Body)
-			defer func() {
-				regionalResponse.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-			}()
-			bodyString = string(bodyBytes)
-			trimmed = strings.TrimSpace(bodyString)
-			emptyResp = (regionalResponse.ContentLength == 0 || trimmed == "" || trimmed == "{}") && regionalResponse.StatusCode >= 200 && regionalResponse.StatusCode < 300
+			trimmed = bytes.TrimSpace(peekBody(regionalResponse))
+			emptyResp = (regionalResponse.ContentLength == 0 || isEmptyJSONBody(trimmed)) && regionalResponse.StatusCode >= 200 && regionalResponse.StatusCode < 300
 			if emptyResp {
 				contentLengthErrStr := fmt.Sprintf("empty response with trimmed body %q, ContentLength %d and StatusCode %d", trimmed, regionalResponse.ContentLength, regionalResponse.StatusCode)
 				klog.Errorf(contentLengthErrStr)
@@ -194,3 +257,74 @@ func DoHackRegionalRetryForGET(c *Client) autorest.SendDecorator {
 		})
 	}
 }
+
+// emptyBodyPeekSize is the number of the leading bytes of a response body read to tell whether it is empty.
+const emptyBodyPeekSize = 512
+
+// peekBody returns up to emptyBodyPeekSize leading bytes of the response body without consuming them.
+// The bodies longer than that are never empty JSON bodies.
+func peekBody(response *http.Response) []byte {
+	if response.Body == nil {
+		return nil
+	}
+	reader := bufio.NewReaderSize(response.Body, emptyBodyPeekSize)
+	peeked, _ := reader.Peek(emptyBodyPeekSize)
+	response.Body = struct {
+		io.Reader
+		io.Closer
+	}{reader, response.Body}
+	return peeked
+}
+
+// readBody reads the whole response body and replaces it with the bytes read.
+func readBody(response *http.Response) []byte {
+	if response.Body == nil {
+		return nil
+	}
+	bodyBytes, _ := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	return bodyBytes
+}
+
+// isEmptyJSONBody returns true if the trimmed response body is empty or an empty JSON object.
+func isEmptyJSONBody(trimmed []byte) bool {
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("{}"))
+}
+
+// utf8BOM is the UTF-8 byte order mark some responses start with.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// ByStreamingJSON returns a RespondDecorator that decodes the JSON response body into v.
+// Unlike autorest.ByUnmarshallingJSON, it decodes from the body directly instead of reading
+// the whole body into memory first. An empty body is not an error.
+func ByStreamingJSON(v interface{}) autorest.RespondDecorator {
+	return ByDecodingJSON(func(decoder *json.Decoder) error {
+		return decoder.Decode(v)
+	})
+}
+
+// ByDecodingJSON returns a RespondDecorator that decodes the JSON response body by decode from a decoder reading
+// the body directly. Since json.Decoder.Decode buffers the whole value it decodes, decode may read the multi-MB
+// payloads of large resources, e.g., load balancers with thousands of rules, token by token and decode the elements
+// of their large arrays one by one, so that only one element is buffered at a time. An empty body is not an error.
+func ByDecodingJSON(decode func(decoder *json.Decoder) error) autorest.RespondDecorator {
+	return func(r autorest.Responder) autorest.Responder {
+		return autorest.ResponderFunc(func(resp *http.Response) error {
+			err := r.Respond(resp)
+			if err != nil || resp.Body == nil {
+				return err
+			}
+
+			body := bufio.NewReader(resp.Body)
+			// Skip the UTF-8 byte order mark like autorest.ByUnmarshallingJSON.
+			if bom, _ := body.Peek(len(utf8BOM)); bytes.Equal(bom, utf8BOM) {
+				_, _ = body.Discard(len(utf8BOM))
+			}
+			if err := decode(json.NewDecoder(body)); err != nil && !errors.Is(err, io.EOF) {
+				return fmt.Errorf("failed to decode the JSON response body: %w", err)
+			}
+			return nil
+		})
+	}
+}
@@ -17,9 +17,11 @@ limitations under the License.
 package azureclients
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
 	"k8s.io/client-go/util/flowcontrol"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
@@ -38,6 +40,27 @@ type ClientConfig struct {
 	Backoff                 *retry.Backoff
 	UserAgent               string
 	DisableAzureStackCloud  bool
+	AsyncOperationTracker   AsyncOperationTracker
+	// UserAgentSuffix is appended to the user agent of the requests.
+	UserAgentSuffix string
+	// ClusterName is put into the operation annotation header of the requests.
+	ClusterName string
+	// Transport overrides the default transport of the requests if the proxy or the CA bundle is configured.
+	Transport *http.Transport
+	// APIVersion overrides the default API version of the clients supporting it, e.g., the load balancer client
+	// using the network API version negotiated with the target cloud.
+	APIVersion string
+}
+
+// AsyncOperationTracker records the futures of the in-flight long-running operations, so that they can be resumed
+// after the controller restarts instead of issuing duplicate requests conflicting with them.
+type AsyncOperationTracker interface {
+	// Get returns the future of the in-flight operation on the resource, or nil if there is none.
+	Get(resourceID string) *azure.Future
+	// Set records the future of the in-flight operation on the resource.
+	Set(resourceID string, future *azure.Future)
+	// Delete removes the operation on the resource after it is completed.
+	Delete(resourceID string)
 }
 
 // WithRateLimiter returns a new ClientConfig with rateLimitConfig set.
@@ -0,0 +1,307 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureclients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+const (
+	// RateLimiterOperationRead is the operation of the rate limiter of the read calls.
+	RateLimiterOperationRead = "read"
+	// RateLimiterOperationWrite is the operation of the rate limiter of the write calls.
+	RateLimiterOperationWrite = "write"
+)
+
+// RateLimiterState describes the token bucket of a rate limiter.
+type RateLimiterState struct {
+	Client string `json:"client"`
+	// SubscriptionID is the subscription of the client, which tells apart the instances of a client for different
+	// subscriptions, e.g., the route table client of a peered VNet in another subscription.
+	SubscriptionID string `json:"subscriptionID,omitempty"`
+	Operation      string `json:"operation"`
+	// Enabled is false if the calls are not rate limited.
+	Enabled bool    `json:"enabled"`
+	QPS     float32 `json:"qps,omitempty"`
+	Bucket  int     `json:"bucket,omitempty"`
+	Tokens  float64 `json:"tokens,omitempty"`
+}
+
+// TunableRateLimiter is a token bucket flowcontrol.RateLimiter whose QPS and bucket size can be
+// adjusted at runtime. Its state is reported by metrics.
+type TunableRateLimiter struct {
+	client         string
+	subscriptionID string
+	operation      string
+
+	lock    sync.RWMutex
+	enabled bool
+	qps     float32
+	bucket  int
+	limiter *rate.Limiter
+}
+
+var _ flowcontrol.RateLimiter = &TunableRateLimiter{}
+
+func newTunableRateLimiter(client, subscriptionID, operation string, enabled bool, qps float32, bucket int) *TunableRateLimiter {
+	l := &TunableRateLimiter{
+		client:         client,
+		subscriptionID: subscriptionID,
+		operation:      operation,
+		limiter:        rate.NewLimiter(rate.Inf, 0),
+	}
+	if enabled {
+		l.setRate(qps, bucket)
+	}
+	return l
+}
+
+// TryAccept returns true if a token is taken immediately.
+func (l *TunableRateLimiter) TryAccept() bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if !l.enabled {
+		return true
+	}
+	accepted := l.limiter.Allow()
+	if !accepted {
+		metrics.RateLimiterThrottledCount(l.client, l.subscriptionID, l.operation)
+	}
+	metrics.SetRateLimiterTokens(l.client, l.subscriptionID, l.operation, l.limiter.Tokens())
+	return accepted
+}
+
+// Accept returns once a token becomes available.
+func (l *TunableRateLimiter) Accept() {
+	_ = l.Wait(context.Background())
+}
+
+// Wait returns nil if a token is taken before the context is done.
+func (l *TunableRateLimiter) Wait(ctx context.Context) error {
+	l.lock.RLock()
+	limiter, enabled := l.limiter, l.enabled
+	l.lock.RUnlock()
+
+	if !enabled {
+		return nil
+	}
+	err := limiter.Wait(ctx)
+	metrics.SetRateLimiterTokens(l.client, l.subscriptionID, l.operation, limiter.Tokens())
+	return err
+}
+
+// Stop stops the rate limiter.
+func (l *TunableRateLimiter) Stop() {}
+
+// QPS returns the QPS of the rate limiter.
+func (l *TunableRateLimiter) QPS() float32 {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.qps
+}
+
+// SetRate enables the rate limiter with the QPS and bucket size. The bucket is refilled if the
+// rate limiter was disabled.
+func (l *TunableRateLimiter) SetRate(qps float32, bucket int) error {
+	if qps <= 0 || bucket <= 0 {
+		return fmt.Errorf("the QPS and bucket size of the rate limiter should be positive, got QPS=%g, bucket=%d", qps, bucket)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.setRate(qps, bucket)
+	return nil
+}
+
+// setRate sets the QPS and bucket size. The caller should hold the lock.
+func (l *TunableRateLimiter) setRate(qps float32, bucket int) {
+	if l.enabled {
+		l.limiter.SetLimit(rate.Limit(qps))
+		l.limiter.SetBurst(bucket)
+	} else {
+		l.limiter = rate.NewLimiter(rate.Limit(qps), bucket)
+	}
+	l.enabled, l.qps, l.bucket = true, qps, bucket
+	metrics.SetRateLimiterState(l.client, l.subscriptionID, l.operation, qps, bucket, l.limiter.Tokens())
+}
+
+// State returns the current state of the token bucket.
+func (l *TunableRateLimiter) State() RateLimiterState {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	state := RateLimiterState{
+		Client:         l.client,
+		SubscriptionID: l.subscriptionID,
+		Operation:      l.operation,
+		Enabled:        l.enabled,
+	}
+	if l.enabled {
+		state.QPS, state.Bucket, state.Tokens = l.qps, l.bucket, l.limiter.Tokens()
+	}
+	return state
+}
+
+// rateLimiterRegistry records the latest rate limiters of each client, keyed by the client name, the subscription and
+// the operation.
+var rateLimiterRegistry = struct {
+	lock     sync.RWMutex
+	limiters map[string]*TunableRateLimiter
+}{
+	limiters: make(map[string]*TunableRateLimiter),
+}
+
+func rateLimiterKey(client, subscriptionID, operation string) string {
+	return client + "/" + strings.ToLower(subscriptionID) + "/" + operation
+}
+
+// NewRegisteredRateLimiter creates new read and write rate limiters of the client for the subscription from
+// RateLimitConfig, and registers them so that they can be tuned at runtime by RateLimiterHandler. The rate limiters
+// replace the ones registered by the previous instance of the client for the same subscription, e.g., before the
+// cloud config is reloaded, while the instances for other subscriptions keep their own.
+func NewRegisteredRateLimiter(client, subscriptionID string, config *RateLimitConfig) (flowcontrol.RateLimiter, flowcontrol.RateLimiter) {
+	readLimiter := newTunableRateLimiter(client, subscriptionID, RateLimiterOperationRead, false, 0, 0)
+	writeLimiter := newTunableRateLimiter(client, subscriptionID, RateLimiterOperationWrite, false, 0, 0)
+	if RateLimitEnabled(config) {
+		readLimiter = newTunableRateLimiter(client, subscriptionID, RateLimiterOperationRead, true, config.CloudProviderRateLimitQPS, config.CloudProviderRateLimitBucket)
+		writeLimiter = newTunableRateLimiter(client, subscriptionID, RateLimiterOperationWrite, true, config.CloudProviderRateLimitQPSWrite, config.CloudProviderRateLimitBucketWrite)
+	}
+
+	rateLimiterRegistry.lock.Lock()
+	defer rateLimiterRegistry.lock.Unlock()
+	rateLimiterRegistry.limiters[rateLimiterKey(client, subscriptionID, RateLimiterOperationRead)] = readLimiter
+	rateLimiterRegistry.limiters[rateLimiterKey(client, subscriptionID, RateLimiterOperationWrite)] = writeLimiter
+	return readLimiter, writeLimiter
+}
+
+// GetRateLimiterStates returns the states of the registered rate limiters sorted by the client name, the subscription
+// and the operation.
+func GetRateLimiterStates() []RateLimiterState {
+	rateLimiterRegistry.lock.RLock()
+	defer rateLimiterRegistry.lock.RUnlock()
+
+	states := make([]RateLimiterState, 0, len(rateLimiterRegistry.limiters))
+	for _, limiter := range rateLimiterRegistry.limiters {
+		states = append(states, limiter.State())
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Client != states[j].Client {
+			return states[i].Client < states[j].Client
+		}
+		if states[i].SubscriptionID != states[j].SubscriptionID {
+			return states[i].SubscriptionID < states[j].SubscriptionID
+		}
+		return states[i].Operation < states[j].Operation
+	})
+	return states
+}
+
+// SetRateLimit sets the QPS and bucket size of the registered rate limiter of the client, the subscription and the
+// operation. The subscription can be omitted if the client is registered for a single subscription.
+func SetRateLimit(client, subscriptionID, operation string, qps float32, bucket int) (RateLimiterState, error) {
+	limiter, err := getRegisteredRateLimiter(client, subscriptionID, operation)
+	if err != nil {
+		return RateLimiterState{}, err
+	}
+	if err := limiter.SetRate(qps, bucket); err != nil {
+		return RateLimiterState{}, err
+	}
+	klog.Infof("SetRateLimit: set the %s rate limiter of client %s in subscription %q to QPS=%g, bucket=%d",
+		operation, client, limiter.subscriptionID, qps, bucket)
+	return limiter.State(), nil
+}
+
+// getRegisteredRateLimiter returns the registered rate limiter of the client, the subscription and the operation. If
+// the subscription is empty, the only rate limiter of the client and the operation is returned.
+func getRegisteredRateLimiter(client, subscriptionID, operation string) (*TunableRateLimiter, error) {
+	rateLimiterRegistry.lock.RLock()
+	defer rateLimiterRegistry.lock.RUnlock()
+
+	if limiter, found := rateLimiterRegistry.limiters[rateLimiterKey(client, subscriptionID, operation)]; found {
+		return limiter, nil
+	}
+	if subscriptionID != "" {
+		return nil, fmt.Errorf("rate limiter %s of client %s in subscription %q is not found", operation, client, subscriptionID)
+	}
+
+	var matched []*TunableRateLimiter
+	for _, limiter := range rateLimiterRegistry.limiters {
+		if limiter.client == client && limiter.operation == operation {
+			matched = append(matched, limiter)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, fmt.Errorf("rate limiter %s of client %s is not found", operation, client)
+	case 1:
+		return matched[0], nil
+	default:
+		return nil, fmt.Errorf("client %s is registered for %d subscriptions, the subscription of the rate limiter %s should be specified",
+			client, len(matched), operation)
+	}
+}
+
+// RateLimiterHandler returns an http.Handler serving the states of the registered rate limiters on GET, and
+// adjusting the QPS and bucket size of a rate limiter by a RateLimiterState on PUT. The adjustments are lost when
+// the clients are re-created. The caller is responsible for protecting it with authentication and authorization.
+func RateLimiterHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result interface{}
+		switch r.Method {
+		case http.MethodGet:
+			result = GetRateLimiterStates()
+		case http.MethodPut:
+			var request RateLimiterState
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, fmt.Sprintf("failed to parse the request: %v", err), http.StatusBadRequest)
+				return
+			}
+			state, err := SetRateLimit(request.Client, request.SubscriptionID, request.Operation, request.QPS, request.Bucket)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			result = state
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			klog.Errorf("RateLimiterHandler: failed to marshal the rate limiters: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
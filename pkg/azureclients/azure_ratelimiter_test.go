@@ -0,0 +1,156 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureclients
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTunableRateLimiter(t *testing.T) {
+	limiter := newTunableRateLimiter("test", "sub", RateLimiterOperationRead, false, 0, 0)
+	for i := 0; i < 10; i++ {
+		assert.True(t, limiter.TryAccept())
+	}
+	assert.Equal(t, RateLimiterState{Client: "test", SubscriptionID: "sub", Operation: RateLimiterOperationRead}, limiter.State())
+
+	assert.Error(t, limiter.SetRate(0, 1))
+	assert.Error(t, limiter.SetRate(1, 0))
+
+	assert.NoError(t, limiter.SetRate(0.001, 2))
+	assert.True(t, limiter.TryAccept())
+	assert.True(t, limiter.TryAccept())
+	assert.False(t, limiter.TryAccept())
+	state := limiter.State()
+	assert.True(t, state.Enabled)
+	assert.Equal(t, float32(0.001), state.QPS)
+	assert.Equal(t, 2, state.Bucket)
+	assert.Less(t, state.Tokens, 1.0)
+
+	assert.NoError(t, limiter.SetRate(1000, 3))
+	assert.Equal(t, float32(1000), limiter.QPS())
+	assert.Equal(t, 3, limiter.State().Bucket)
+}
+
+func TestNewRegisteredRateLimiter(t *testing.T) {
+	readLimiter, writeLimiter := NewRegisteredRateLimiter("test_client", "sub1", &RateLimitConfig{
+		CloudProviderRateLimit:            true,
+		CloudProviderRateLimitQPS:         3,
+		CloudProviderRateLimitBucket:      10,
+		CloudProviderRateLimitQPSWrite:    1,
+		CloudProviderRateLimitBucketWrite: 3,
+	})
+	assert.Equal(t, float32(3), readLimiter.QPS())
+	assert.Equal(t, float32(1), writeLimiter.QPS())
+
+	// the limiters of a new instance of the client replace the old ones
+	_, writeLimiter = NewRegisteredRateLimiter("test_client", "sub1", nil)
+	assert.True(t, writeLimiter.TryAccept())
+
+	// the subscription can be omitted if the client is registered for a single subscription
+	state, err := SetRateLimit("test_client", "", RateLimiterOperationWrite, 2, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimiterState{Client: "test_client", SubscriptionID: "sub1", Operation: RateLimiterOperationWrite, Enabled: true, QPS: 2, Bucket: 5, Tokens: 5}, state)
+	assert.Equal(t, float32(2), writeLimiter.QPS())
+
+	_, err = SetRateLimit("unknown_client", "", RateLimiterOperationWrite, 2, 5)
+	assert.Error(t, err)
+
+	// the instances of the client for other subscriptions keep their own rate limiters
+	_, otherWriteLimiter := NewRegisteredRateLimiter("test_client", "sub2", nil)
+	_, err = SetRateLimit("test_client", "", RateLimiterOperationWrite, 3, 5)
+	assert.Error(t, err)
+	_, err = SetRateLimit("test_client", "SUB2", RateLimiterOperationWrite, 3, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(2), writeLimiter.QPS())
+	assert.Equal(t, float32(3), otherWriteLimiter.QPS())
+	_, err = SetRateLimit("test_client", "sub3", RateLimiterOperationWrite, 3, 5)
+	assert.Error(t, err)
+
+	var subscriptions []string
+	for _, state := range GetRateLimiterStates() {
+		if state.Client == "test_client" && state.Operation == RateLimiterOperationRead {
+			subscriptions = append(subscriptions, state.SubscriptionID)
+			assert.False(t, state.Enabled)
+		}
+	}
+	assert.Equal(t, []string{"sub1", "sub2"}, subscriptions)
+}
+
+func TestRateLimiterHandler(t *testing.T) {
+	_, _ = NewRegisteredRateLimiter("handler_client", "sub", nil)
+	handler := RateLimiterHandler()
+
+	for _, tc := range []struct {
+		desc           string
+		method         string
+		body           string
+		expectedStatus int
+		expectedState  *RateLimiterState
+	}{
+		{
+			desc:           "GET should list the rate limiters",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "PUT should adjust the rate limiter",
+			method:         http.MethodPut,
+			body:           `{"client": "handler_client", "operation": "write", "qps": 5, "bucket": 10}`,
+			expectedStatus: http.StatusOK,
+			expectedState:  &RateLimiterState{Client: "handler_client", SubscriptionID: "sub", Operation: RateLimiterOperationWrite, Enabled: true, QPS: 5, Bucket: 10, Tokens: 10},
+		},
+		{
+			desc:           "PUT should reject the invalid rate",
+			method:         http.MethodPut,
+			body:           `{"client": "handler_client", "operation": "write", "qps": 5}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "PUT should reject the invalid request",
+			method:         http.MethodPut,
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "other methods should not be allowed",
+			method:         http.MethodPost,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(tc.method, "/debug/azure/ratelimiters", strings.NewReader(tc.body)))
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			if tc.expectedState != nil {
+				var state RateLimiterState
+				assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &state))
+				assert.Equal(t, *tc.expectedState, state)
+			}
+			if tc.method == http.MethodGet {
+				var states []RateLimiterState
+				assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &states))
+				assert.NotEmpty(t, states)
+			}
+		})
+	}
+}
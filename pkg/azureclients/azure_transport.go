@@ -0,0 +1,139 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureclients
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// TransportConfig configures the proxy and the trusted CAs of the outbound requests to ARM, AAD and IMDS.
+// It is required in locked-down networks where the environment variables of the proxy are insufficient.
+type TransportConfig struct {
+	// HTTPSProxy is the URL of the proxy of the HTTPS requests. It takes precedence over the HTTPS_PROXY environment variable.
+	HTTPSProxy string
+	// NoProxy is a comma-separated list of the hosts, domains, IPs and CIDRs bypassing HTTPSProxy.
+	// A domain matches its subdomains as well, and a domain with a leading "." only matches its subdomains.
+	NoProxy string
+	// CABundlePath is the path of a PEM bundle of the CA certificates trusted in addition to the system ones.
+	CABundlePath string
+}
+
+// IsEmpty returns true if neither the proxy nor the CA bundle is configured.
+func (c *TransportConfig) IsEmpty() bool {
+	return c == nil || (c.HTTPSProxy == "" && c.CABundlePath == "")
+}
+
+// ApplyTo applies the proxy and the CA bundle to the transport.
+func (c *TransportConfig) ApplyTo(transport *http.Transport) error {
+	if c.IsEmpty() {
+		return nil
+	}
+
+	if c.HTTPSProxy != "" {
+		proxyURL, err := url.Parse(c.HTTPSProxy)
+		if err != nil || proxyURL.Host == "" {
+			return fmt.Errorf("invalid HTTPS proxy %q: it must be a URL like http://proxy.example.com:3128", c.HTTPSProxy)
+		}
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if !strings.EqualFold(req.URL.Scheme, "https") {
+				return http.ProxyFromEnvironment(req)
+			}
+			if !c.useProxy(req.URL.Host) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	}
+
+	if c.CABundlePath != "" {
+		caBundle, err := os.ReadFile(c.CABundlePath)
+		if err != nil {
+			return fmt.Errorf("failed to read the CA bundle %s: %w", c.CABundlePath, err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return fmt.Errorf("no PEM certificate is found in the CA bundle %s", c.CABundlePath)
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+
+	return nil
+}
+
+// useProxy returns false if the host is matched by NoProxy.
+func (c *TransportConfig) useProxy(host string) bool {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	hostname = strings.ToLower(hostname)
+	ip := net.ParseIP(hostname)
+
+	for _, entry := range strings.Split(c.NoProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return false
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return false
+			}
+			continue
+		}
+
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		if entryIP := net.ParseIP(entryHost); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return false
+			}
+			continue
+		}
+		if strings.HasPrefix(entryHost, ".") {
+			if strings.HasSuffix(hostname, entryHost) {
+				return false
+			}
+			continue
+		}
+		if hostname == entryHost || strings.HasSuffix(hostname, "."+entryHost) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureclients
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportConfigUseProxy(t *testing.T) {
+	config := &TransportConfig{
+		HTTPSProxy: "http://proxy.example.com:3128",
+		NoProxy:    "login.example.com, .internal.example.com,10.0.0.0/8,192.168.0.1,vault.example.com:8443",
+	}
+	for host, expected := range map[string]bool{
+		"management.azure.com":              true,
+		"login.example.com":                 false,
+		"sub.login.example.com":             false,
+		"internal.example.com":              true,
+		"a.internal.example.com":            false,
+		"10.1.2.3":                          false,
+		"10.1.2.3:443":                      false,
+		"192.168.0.1":                       false,
+		"192.168.0.2":                       true,
+		"vault.example.com:8443":            false,
+		"vault.example.com:443":             true,
+		"MANAGEMENT.INTERNAL.EXAMPLE.COM":   false,
+		"management.chinacloudapi.cn:443":   true,
+		"management.usgovcloudapi.net:8443": true,
+	} {
+		assert.Equal(t, expected, config.useProxy(host), host)
+	}
+
+	config.NoProxy = "*"
+	assert.False(t, config.useProxy("management.azure.com"))
+}
+
+func TestTransportConfigApplyTo(t *testing.T) {
+	t.Run("should not change the transport if nothing is configured", func(t *testing.T) {
+		config := &TransportConfig{NoProxy: "localhost"}
+		assert.True(t, config.IsEmpty())
+		transport := &http.Transport{}
+		assert.NoError(t, config.ApplyTo(transport))
+		assert.Nil(t, transport.Proxy)
+		assert.Nil(t, transport.TLSClientConfig)
+	})
+
+	t.Run("should send the HTTPS requests through the proxy", func(t *testing.T) {
+		config := &TransportConfig{HTTPSProxy: "http://proxy.example.com:3128", NoProxy: "login.example.com"}
+		transport := &http.Transport{}
+		assert.NoError(t, config.ApplyTo(transport))
+
+		req, _ := http.NewRequest(http.MethodGet, "https://management.azure.com/subscriptions", nil)
+		proxyURL, err := transport.Proxy(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "proxy.example.com:3128", proxyURL.Host)
+
+		req, _ = http.NewRequest(http.MethodGet, "https://login.example.com/tenant", nil)
+		proxyURL, err = transport.Proxy(req)
+		assert.NoError(t, err)
+		assert.Nil(t, proxyURL)
+	})
+
+	t.Run("should report an invalid proxy", func(t *testing.T) {
+		config := &TransportConfig{HTTPSProxy: "proxy.example.com"}
+		assert.Error(t, config.ApplyTo(&http.Transport{}))
+	})
+
+	t.Run("should trust the CA bundle", func(t *testing.T) {
+		caBundlePath := filepath.Join(t.TempDir(), "ca.pem")
+		assert.NoError(t, os.WriteFile(caBundlePath, newTestCertificatePEM(t), 0600))
+
+		config := &TransportConfig{CABundlePath: caBundlePath}
+		transport := &http.Transport{}
+		assert.NoError(t, config.ApplyTo(transport))
+		assert.NotNil(t, transport.TLSClientConfig.RootCAs)
+	})
+
+	t.Run("should report a CA bundle without certificates", func(t *testing.T) {
+		caBundlePath := filepath.Join(t.TempDir(), "ca.pem")
+		assert.NoError(t, os.WriteFile(caBundlePath, []byte("not a certificate"), 0600))
+
+		config := &TransportConfig{CABundlePath: caBundlePath}
+		assert.Error(t, config.ApplyTo(&http.Transport{}))
+
+		config.CABundlePath = filepath.Join(t.TempDir(), "missing.pem")
+		assert.Error(t, config.ApplyTo(&http.Transport{}))
+	})
+}
+
+func newTestCertificatePEM(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -58,7 +58,7 @@ func New(config *azclients.ClientConfig) *Client {
 	baseURI := config.ResourceManagerEndpoint
 	authorizer := config.Authorizer
 	armClient := armclient.New(authorizer, *config, baseURI, APIVersion)
-	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(config.RateLimitConfig)
+	rateLimiterReader, rateLimiterWriter := azclients.NewRegisteredRateLimiter("deployments", config.SubscriptionID, config.RateLimitConfig)
 
 	if azclients.RateLimitEnabled(config.RateLimitConfig) {
 		klog.V(2).Infof("Azure DeploymentClient (read ops) using rate limit config: QPS=%g, bucket=%d",
@@ -0,0 +1,181 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosticsettingclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/utils/pointer"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient/mockarmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	testResourceURI = "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/nsg"
+	testResourceID  = testResourceURI + "/providers/" + diagnosticSettingResourceType + "/ds"
+)
+
+func TestNew(t *testing.T) {
+	config := &azclients.ClientConfig{
+		SubscriptionID:          "sub",
+		ResourceManagerEndpoint: "endpoint",
+		Location:                "eastus",
+		RateLimitConfig: &azclients.RateLimitConfig{
+			CloudProviderRateLimit:            true,
+			CloudProviderRateLimitQPS:         0.5,
+			CloudProviderRateLimitBucket:      1,
+			CloudProviderRateLimitQPSWrite:    0.5,
+			CloudProviderRateLimitBucketWrite: 1,
+		},
+		Backoff: &retry.Backoff{Steps: 1},
+	}
+
+	diagnosticSettingClient := New(config)
+	assert.Equal(t, "sub", diagnosticSettingClient.subscriptionID)
+	assert.NotEmpty(t, diagnosticSettingClient.rateLimiterReader)
+	assert.NotEmpty(t, diagnosticSettingClient.rateLimiterWriter)
+}
+
+func TestGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"name":"ds","properties":{"workspaceId":"workspace"}}`))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	diagnosticSettingClient := getTestDiagnosticSettingClient(armClient)
+	result, rerr := diagnosticSettingClient.Get(context.TODO(), testResourceURI, "ds")
+	assert.Nil(t, rerr)
+	assert.Equal(t, "ds", pointer.StringDeref(result.Name, ""))
+	assert.Equal(t, "workspace", pointer.StringDeref(result.Properties.WorkspaceID, ""))
+}
+
+func TestGetNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	diagnosticSettingClient := getTestDiagnosticSettingClient(armClient)
+	result, rerr := diagnosticSettingClient.Get(context.TODO(), testResourceURI, "ds")
+	assert.Empty(t, result.Name)
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusNotFound, rerr.HTTPStatusCode)
+}
+
+func TestGetThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, throttleErr).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	diagnosticSettingClient := getTestDiagnosticSettingClient(armClient)
+	result, rerr := diagnosticSettingClient.Get(context.TODO(), testResourceURI, "ds")
+	assert.Empty(t, result)
+	assert.Equal(t, throttleErr, rerr)
+	assert.Equal(t, throttleErr.RetryAfter, diagnosticSettingClient.RetryAfterReader)
+}
+
+func TestCreateOrUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	setting := getTestDiagnosticSetting()
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(""))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PutResource(gomock.Any(), testResourceID, setting).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	diagnosticSettingClient := getTestDiagnosticSettingClient(armClient)
+	rerr := diagnosticSettingClient.CreateOrUpdate(context.TODO(), testResourceURI, "ds", setting)
+	assert.Nil(t, rerr)
+}
+
+func TestCreateOrUpdateNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	createOrUpdateErr := &retry.Error{
+		RawError:  fmt.Errorf("azure cloud provider rate limited(%s) for operation %q", "write", "DiagnosticSettingCreateOrUpdate"),
+		Retriable: true,
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	diagnosticSettingClient := getTestDiagnosticSettingClient(armClient)
+	diagnosticSettingClient.rateLimiterWriter = flowcontrol.NewFakeNeverRateLimiter()
+	rerr := diagnosticSettingClient.CreateOrUpdate(context.TODO(), testResourceURI, "ds", getTestDiagnosticSetting())
+	assert.Equal(t, createOrUpdateErr, rerr)
+}
+
+func getTestDiagnosticSetting() DiagnosticSettingsResource {
+	return DiagnosticSettingsResource{
+		Name: pointer.String("ds"),
+		Properties: &DiagnosticSettings{
+			WorkspaceID: pointer.String("workspace"),
+			Logs:        &[]LogSettings{{CategoryGroup: pointer.String("allLogs"), Enabled: pointer.Bool(true)}},
+		},
+	}
+}
+
+func getTestDiagnosticSettingClient(armClient armclient.Interface) *Client {
+	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(&azclients.RateLimitConfig{})
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    "subscriptionID",
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+	}
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosticsettingclient
+
+import (
+	"context"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	// APIVersion is the API version for diagnostic settings.
+	APIVersion = "2021-05-01-preview"
+)
+
+// Interface is the client interface for the diagnostic settings of Azure resources.
+// Don't forget to run "hack/update-mock-clients.sh" command to generate the mock client.
+type Interface interface {
+	// Get gets a diagnostic setting of the resource.
+	Get(ctx context.Context, resourceURI string, name string) (result DiagnosticSettingsResource, rerr *retry.Error)
+
+	// CreateOrUpdate creates or updates a diagnostic setting of the resource.
+	CreateOrUpdate(ctx context.Context, resourceURI string, name string, parameters DiagnosticSettingsResource) *retry.Error
+}
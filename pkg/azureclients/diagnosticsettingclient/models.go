@@ -0,0 +1,58 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnosticsettingclient
+
+import (
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// DiagnosticSettingsResource is a diagnostic setting of an Azure resource, which sends the logs and the metrics of
+// the resource to a Log Analytics workspace or a storage account.
+type DiagnosticSettingsResource struct {
+	autorest.Response `json:"-"`
+	// Properties are the properties of the diagnostic setting.
+	Properties *DiagnosticSettings `json:"properties,omitempty"`
+	// ID is the resource ID of the diagnostic setting.
+	ID *string `json:"id,omitempty"`
+	// Name is the name of the diagnostic setting.
+	Name *string `json:"name,omitempty"`
+}
+
+// DiagnosticSettings are the destinations and the categories of a diagnostic setting.
+type DiagnosticSettings struct {
+	// StorageAccountID is the resource ID of the storage account the logs and the metrics are archived to.
+	StorageAccountID *string `json:"storageAccountId,omitempty"`
+	// WorkspaceID is the resource ID of the Log Analytics workspace the logs and the metrics are sent to.
+	WorkspaceID *string `json:"workspaceId,omitempty"`
+	// Logs are the log categories of the diagnostic setting.
+	Logs *[]LogSettings `json:"logs,omitempty"`
+	// Metrics are the metric categories of the diagnostic setting.
+	Metrics *[]MetricSettings `json:"metrics,omitempty"`
+}
+
+// LogSettings enables a log category or a category group.
+type LogSettings struct {
+	Category      *string `json:"category,omitempty"`
+	CategoryGroup *string `json:"categoryGroup,omitempty"`
+	Enabled       *bool   `json:"enabled,omitempty"`
+}
+
+// MetricSettings enables a metric category.
+type MetricSettings struct {
+	Category *string `json:"category,omitempty"`
+	Enabled  *bool   `json:"enabled,omitempty"`
+}
@@ -67,7 +67,7 @@ func New(config *azclients.ClientConfig) *Client {
 
 	klog.V(2).Infof("Azure DisksClient using API version: %s", apiVersion)
 	armClient := armclient.New(authorizer, *config, baseURI, apiVersion)
-	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(config.RateLimitConfig)
+	rateLimiterReader, rateLimiterWriter := azclients.NewRegisteredRateLimiter("disks", config.SubscriptionID, config.RateLimitConfig)
 
 	if azclients.RateLimitEnabled(config.RateLimitConfig) {
 		klog.V(2).Infof("Azure DisksClient (read ops) using rate limit config: QPS=%g, bucket=%d",
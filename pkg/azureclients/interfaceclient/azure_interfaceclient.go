@@ -68,7 +68,7 @@ func New(config *azclients.ClientConfig) *Client {
 		apiVersion = AzureStackCloudAPIVersion
 	}
 	armClient := armclient.New(authorizer, *config, baseURI, apiVersion)
-	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(config.RateLimitConfig)
+	rateLimiterReader, rateLimiterWriter := azclients.NewRegisteredRateLimiter("interfaces", config.SubscriptionID, config.RateLimitConfig)
 
 	if azclients.RateLimitEnabled(config.RateLimitConfig) {
 		klog.V(2).Infof("Azure InterfacesClient (read ops) using rate limit config: QPS=%g, bucket=%d",
@@ -18,6 +18,10 @@ package loadbalancerclient
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -34,11 +38,23 @@ import (
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
 	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+	"sigs.k8s.io/cloud-provider-azure/pkg/util/deepcopy"
 )
 
 var _ Interface = &Client{}
 
-const lbResourceType = "Microsoft.Network/loadBalancers"
+const (
+	lbResourceType = "Microsoft.Network/loadBalancers"
+
+	etagHeader        = "ETag"
+	ifNoneMatchHeader = "If-None-Match"
+
+	// decodedLBCacheSize is the max number of the cached decoded load balancers.
+	decodedLBCacheSize = 256
+	// decodedLBCacheMaxBytes is the max total size of the response bodies of the cached decoded load balancers,
+	// which approximates the memory they take.
+	decodedLBCacheMaxBytes = 64 * 1024 * 1024
+)
 
 // Client implements LoadBalancer client Interface.
 type Client struct {
@@ -53,6 +69,31 @@ type Client struct {
 	// ARM throttling configures.
 	RetryAfterReader time.Time
 	RetryAfterWriter time.Time
+
+	// decodedLBCache caches the decoded load balancers and their ETags by the resource ID. The load balancers
+	// are fetched by conditional GETs with the ETags, and the decoded ones are reused if they are not modified,
+	// so that neither the multi-MB payloads nor their raw bytes are kept in memory. It is bounded by the total
+	// size of the response bodies.
+	decodedLBCache *armclient.SizedLRUCache
+}
+
+// decodedLoadBalancer is a decoded load balancer, the expand query it is fetched with and the ETag of its response.
+type decodedLoadBalancer struct {
+	expand string
+	etag   string
+	lb     *network.LoadBalancer
+}
+
+// countingReadCloser counts the bytes read from the response body.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
 }
 
 type backendPoolsToBeMigrated struct {
@@ -67,8 +108,11 @@ func New(config *azclients.ClientConfig) *Client {
 	if strings.EqualFold(config.CloudName, AzureStackCloudName) && !config.DisableAzureStackCloud {
 		apiVersion = AzureStackCloudAPIVersion
 	}
+	if config.APIVersion != "" {
+		apiVersion = config.APIVersion
+	}
 	armClient := armclient.New(authorizer, *config, baseURI, apiVersion)
-	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(config.RateLimitConfig)
+	rateLimiterReader, rateLimiterWriter := azclients.NewRegisteredRateLimiter("load_balancers", config.SubscriptionID, config.RateLimitConfig)
 
 	if azclients.RateLimitEnabled(config.RateLimitConfig) {
 		klog.V(2).Infof("Azure LoadBalancersClient (read ops) using rate limit config: QPS=%g, bucket=%d",
@@ -85,6 +129,7 @@ func New(config *azclients.ClientConfig) *Client {
 		rateLimiterWriter: rateLimiterWriter,
 		subscriptionID:    config.SubscriptionID,
 		cloudName:         config.CloudName,
+		decodedLBCache:    armclient.NewSizedLRUCache(decodedLBCacheSize, decodedLBCacheMaxBytes),
 	}
 
 	return client
@@ -131,26 +176,75 @@ func (c *Client) getLB(ctx context.Context, resourceGroupName string, loadBalanc
 	)
 	result := network.LoadBalancer{}
 
-	response, rerr := c.armClient.GetResourceWithExpandQuery(ctx, resourceID, expand)
+	var cached *decodedLoadBalancer
+	if v, ok := c.decodedLBCache.Get(resourceID); ok && v.(*decodedLoadBalancer).expand == expand {
+		cached = v.(*decodedLoadBalancer)
+	}
+	response, rerr := c.armClient.GetResource(ctx, resourceID, getLBDecorators(expand, cached)...)
+	if response != nil && response.StatusCode == http.StatusNotModified {
+		c.armClient.CloseResponse(ctx, response)
+		// The concurrent GETs are coalesced by armclient, so the response may be of a conditional GET sent with the
+		// ETag of another decoded load balancer, in which case the load balancer is fetched again.
+		if cached != nil && response.Request != nil && response.Request.Header.Get(ifNoneMatchHeader) == cached.etag {
+			klog.V(6).Infof("loadbalancer.get: resourceID %s is not modified since ETag %s", resourceID, cached.etag)
+			result = *(deepcopy.Copy(cached.lb).(*network.LoadBalancer))
+			result.Response = autorest.Response{Response: response}
+			return result, nil
+		}
+		response, rerr = c.armClient.GetResource(ctx, resourceID, getLBDecorators(expand, nil)...)
+	}
 	defer c.armClient.CloseResponse(ctx, response)
 	if rerr != nil {
 		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.get.request", resourceID, rerr.Error())
+		c.decodedLBCache.Remove(resourceID)
 		return result, rerr
 	}
 
+	body := &countingReadCloser{ReadCloser: response.Body}
+	if response.Body != nil {
+		response.Body = body
+	}
 	err := autorest.Respond(
 		response,
 		azure.WithErrorUnlessStatusCode(http.StatusOK),
-		autorest.ByUnmarshallingJSON(&result))
+		armclient.ByDecodingJSON(func(decoder *json.Decoder) error {
+			return decodeLoadBalancer(decoder, &result)
+		}))
 	if err != nil {
 		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.get.respond", resourceID, err)
+		c.decodedLBCache.Remove(resourceID)
 		return result, retry.GetError(response, err)
 	}
 
+	if etag := response.Header.Get(etagHeader); etag != "" {
+		c.decodedLBCache.Add(resourceID, &decodedLoadBalancer{
+			expand: expand,
+			etag:   etag,
+			lb:     deepcopy.Copy(&result).(*network.LoadBalancer),
+		}, body.n)
+	} else {
+		c.decodedLBCache.Remove(resourceID)
+	}
+
 	result.Response = autorest.Response{Response: response}
 	return result, nil
 }
 
+// getLBDecorators returns the decorators of the GET request of a load balancer, which is a conditional GET with
+// the ETag of the decoded load balancer if any.
+func getLBDecorators(expand string, cached *decodedLoadBalancer) []autorest.PrepareDecorator {
+	var decorators []autorest.PrepareDecorator
+	if expand != "" {
+		decorators = append(decorators, autorest.WithQueryParameters(map[string]interface{}{
+			"$expand": autorest.Encode("query", expand),
+		}))
+	}
+	if cached != nil {
+		decorators = append(decorators, autorest.WithHeader(ifNoneMatchHeader, cached.etag))
+	}
+	return decorators
+}
+
 // List gets a list of LoadBalancer in the resource group.
 func (c *Client) List(ctx context.Context, resourceGroupName string) ([]network.LoadBalancer, *retry.Error) {
 	mc := metrics.NewMetricContext("load_balancers", "list", resourceGroupName, c.subscriptionID, "")
@@ -287,7 +381,7 @@ func (c *Client) createOrUpdateResponder(resp *http.Response) (*network.LoadBala
 	err := autorest.Respond(
 		resp,
 		azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated),
-		autorest.ByUnmarshallingJSON(&result))
+		armclient.ByStreamingJSON(result))
 	result.Response = autorest.Response{Response: resp}
 	return result, retry.GetError(resp, err)
 }
@@ -332,6 +426,7 @@ func (c *Client) deleteLB(ctx context.Context, resourceGroupName string, loadBal
 		loadBalancerName,
 	)
 
+	c.decodedLBCache.Remove(resourceID)
 	return c.armClient.DeleteResource(ctx, resourceID)
 }
 
@@ -340,7 +435,7 @@ func (c *Client) listResponder(resp *http.Response) (result network.LoadBalancer
 		resp,
 		autorest.ByIgnoring(),
 		azure.WithErrorUnlessStatusCode(http.StatusOK),
-		autorest.ByUnmarshallingJSON(&result))
+		armclient.ByStreamingJSON(&result))
 	result.Response = autorest.Response{Response: resp}
 	return
 }
@@ -657,3 +752,253 @@ func (c *Client) migrateToIPBasedBackendPool(ctx context.Context, resourceGroupN
 	klog.Infof("Response: %v", response)
 	return nil
 }
+
+// GetLoadBalancingRuleHealth gets the health of the backend addresses of a load balancing rule.
+func (c *Client) GetLoadBalancingRuleHealth(ctx context.Context, resourceGroupName string, loadBalancerName string, loadBalancingRuleName string) (LoadBalancingRuleHealth, *retry.Error) {
+	mc := metrics.NewMetricContext("load_balancers", "get_load_balancing_rule_health", resourceGroupName, c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterReader.TryAccept() {
+		mc.RateLimitedCount()
+		return LoadBalancingRuleHealth{}, retry.GetRateLimitError(false, "LBRuleHealth")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterReader.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("LBRuleHealth", "client throttled", c.RetryAfterReader)
+		return LoadBalancingRuleHealth{}, rerr
+	}
+
+	result, rerr := c.getLoadBalancingRuleHealth(ctx, resourceGroupName, loadBalancerName, loadBalancingRuleName)
+	mc.Observe(rerr)
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterReader = rerr.RetryAfter
+		}
+
+		return result, rerr
+	}
+
+	return result, nil
+}
+
+// getLoadBalancingRuleHealth gets the health of the backend addresses of a load balancing rule.
+// The health is computed asynchronously, so the result is polled if the request is accepted.
+func (c *Client) getLoadBalancingRuleHealth(ctx context.Context, resourceGroupName string, loadBalancerName string, loadBalancingRuleName string) (LoadBalancingRuleHealth, *retry.Error) {
+	resourceID := armclient.GetChildResourceID(
+		c.subscriptionID,
+		resourceGroupName,
+		lbResourceType,
+		loadBalancerName,
+		"loadBalancingRules",
+		loadBalancingRuleName,
+	)
+	result := LoadBalancingRuleHealth{}
+
+	queryParameters := map[string]interface{}{
+		"api-version": HealthAPIVersion,
+	}
+	response, rerr := c.armClient.PostResource(ctx, resourceID, "health", map[string]interface{}{}, queryParameters)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.rulehealth.request", resourceID, rerr.Error())
+		return result, rerr
+	}
+
+	if response != nil && response.StatusCode == http.StatusAccepted {
+		future, err := azure.NewFutureFromResponse(response)
+		if err != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.rulehealth.future", resourceID, err)
+			return result, retry.GetError(response, err)
+		}
+		asyncResponse, err := c.armClient.WaitForAsyncOperationResult(ctx, &future, "LBRuleHealth")
+		defer c.armClient.CloseResponse(ctx, asyncResponse)
+		if err != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.rulehealth.wait", resourceID, err)
+			return result, retry.GetError(asyncResponse, err)
+		}
+		response = asyncResponse
+	}
+
+	err := autorest.Respond(
+		response,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result))
+	if err != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "loadbalancer.rulehealth.respond", resourceID, err)
+		return result, retry.GetError(response, err)
+	}
+
+	return result, nil
+}
+
+// decodeLoadBalancer decodes the load balancer token by token. The arrays of the sub-resources, e.g., the rules and
+// the probes, are decoded element by element, so that the decoder buffers one sub-resource at a time instead of the
+// whole multi-MB payload of a load balancer with thousands of rules.
+func decodeLoadBalancer(decoder *json.Decoder, lb *network.LoadBalancer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		// an empty body is io.EOF
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("unexpected token %v of a load balancer", token)
+	}
+
+	fields := make(map[string]json.RawMessage)
+	var properties *network.LoadBalancerPropertiesFormat
+	for decoder.More() {
+		key, err := decodeJSONKey(decoder)
+		if err != nil {
+			return err
+		}
+		if key == "properties" {
+			if properties, err = decodeLoadBalancerProperties(decoder); err != nil {
+				return err
+			}
+			continue
+		}
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return err
+		}
+		fields[key] = raw
+	}
+	if err := expectJSONDelim(decoder, '}'); err != nil {
+		return err
+	}
+
+	// the other fields are small, and they are decoded by the unmarshaler of the load balancer
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := lb.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	lb.LoadBalancerPropertiesFormat = properties
+	return nil
+}
+
+// decodeLoadBalancerProperties decodes the properties of a load balancer, which may be null.
+func decodeLoadBalancerProperties(decoder *json.Decoder) (*network.LoadBalancerPropertiesFormat, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if token == nil {
+		return nil, nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("unexpected token %v of the properties of a load balancer", token)
+	}
+
+	properties := &network.LoadBalancerPropertiesFormat{}
+	fields := make(map[string]json.RawMessage)
+	for decoder.More() {
+		key, err := decodeJSONKey(decoder)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "frontendIPConfigurations":
+			properties.FrontendIPConfigurations, err = decodeJSONArray[network.FrontendIPConfiguration](decoder)
+		case "backendAddressPools":
+			properties.BackendAddressPools, err = decodeJSONArray[network.BackendAddressPool](decoder)
+		case "loadBalancingRules":
+			properties.LoadBalancingRules, err = decodeJSONArray[network.LoadBalancingRule](decoder)
+		case "probes":
+			properties.Probes, err = decodeJSONArray[network.Probe](decoder)
+		case "inboundNatRules":
+			properties.InboundNatRules, err = decodeJSONArray[network.InboundNatRule](decoder)
+		case "inboundNatPools":
+			properties.InboundNatPools, err = decodeJSONArray[network.InboundNatPool](decoder)
+		case "outboundRules":
+			properties.OutboundRules, err = decodeJSONArray[network.OutboundRule](decoder)
+		default:
+			var raw json.RawMessage
+			err = decoder.Decode(&raw)
+			fields[key] = raw
+		}
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	if err := expectJSONDelim(decoder, '}'); err != nil {
+		return nil, err
+	}
+
+	if len(fields) > 0 {
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, properties); err != nil {
+			return nil, err
+		}
+	}
+	return properties, nil
+}
+
+// decodeJSONArray decodes a JSON array, which may be null, element by element.
+func decodeJSONArray[T any](decoder *json.Decoder) (*[]T, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if token == nil {
+		return nil, nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("unexpected token %v of an array of %T", token, *new(T))
+	}
+
+	items := make([]T, 0)
+	for decoder.More() {
+		var item T
+		if err := decoder.Decode(&item); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		items = append(items, item)
+	}
+	if err := expectJSONDelim(decoder, ']'); err != nil {
+		return nil, err
+	}
+	return &items, nil
+}
+
+// decodeJSONKey decodes the key of the next field of a JSON object.
+func decodeJSONKey(decoder *json.Decoder) (string, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	key, ok := token.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected token %v of a key", token)
+	}
+	return key, nil
+}
+
+// expectJSONDelim decodes the next token, which is expected to be the delimiter.
+func expectJSONDelim(decoder *json.Decoder, expected json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("unexpected token %v, expected %v", token, expected)
+	}
+	return nil
+}
+
+// unexpectedEOF returns io.ErrUnexpectedEOF for io.EOF, which is only expected before the first token, so that a
+// truncated body is not taken as an empty one.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
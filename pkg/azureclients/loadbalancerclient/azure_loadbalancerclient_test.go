@@ -23,6 +23,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -95,7 +98,7 @@ func TestGetNotFound(t *testing.T) {
 		Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
 	}
 	armClient := mockarmclient.NewMockInterface(ctrl)
-	armClient.EXPECT().GetResourceWithExpandQuery(gomock.Any(), testResourceID, "").Return(response, nil).Times(1)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, nil).Times(1)
 	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
 
 	lbClient := getTestLoadBalancerClient(armClient)
@@ -115,7 +118,7 @@ func TestGetInternalError(t *testing.T) {
 		Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
 	}
 	armClient := mockarmclient.NewMockInterface(ctrl)
-	armClient.EXPECT().GetResourceWithExpandQuery(gomock.Any(), testResourceID, "").Return(response, nil).Times(1)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, nil).Times(1)
 	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
 
 	lbClient := getTestLoadBalancerClient(armClient)
@@ -141,7 +144,7 @@ func TestGetThrottle(t *testing.T) {
 		RetryAfter:     time.Unix(100, 0),
 	}
 	armClient := mockarmclient.NewMockInterface(ctrl)
-	armClient.EXPECT().GetResourceWithExpandQuery(gomock.Any(), testResourceID, "").Return(response, throttleErr).Times(1)
+	armClient.EXPECT().GetResource(gomock.Any(), testResourceID).Return(response, throttleErr).Times(1)
 	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
 
 	lbClient := getTestLoadBalancerClient(armClient)
@@ -150,6 +153,186 @@ func TestGetThrottle(t *testing.T) {
 	assert.Equal(t, throttleErr, rerr)
 }
 
+func TestGetWithETag(t *testing.T) {
+	lb := getTestLargeLoadBalancer("lb1", 3)
+	lb.Etag = pointer.String(`W/"1"`)
+	var count int
+	var ifNoneMatches []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		ifNoneMatches = append(ifNoneMatches, r.Header.Get("If-None-Match"))
+		assert.Equal(t, "frontendIPConfigurations", r.URL.Query().Get("$expand"))
+		if r.Header.Get("If-None-Match") == *lb.Etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", *lb.Etag)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(marshalLoadBalancerWithReadOnlyFields(t, lb))
+	}))
+	defer server.Close()
+
+	azConfig := azclients.ClientConfig{Backoff: &retry.Backoff{Steps: 1}, UserAgent: "test", Location: "eastus"}
+	lbClient := getTestLoadBalancerClient(armclient.New(nil, azConfig, server.URL, "2019-01-01"))
+	get := func() network.LoadBalancer {
+		result, rerr := lbClient.Get(context.TODO(), "rg", "lb1", "frontendIPConfigurations")
+		assert.Nil(t, rerr)
+		result.Response = autorest.Response{}
+		return result
+	}
+
+	result := get()
+	assert.Equal(t, lb, result)
+	(*result.LoadBalancingRules)[0].Name = pointer.String("mutated")
+
+	// the decoded load balancer is reused if it is not modified, and it is not changed by the callers
+	assert.Equal(t, lb, get())
+
+	lb.Etag = pointer.String(`W/"2"`)
+	(*lb.Probes)[0].Port = pointer.Int32(8080)
+	assert.Equal(t, lb, get())
+	assert.Equal(t, 3, count)
+	assert.Equal(t, []string{"", `W/"1"`, `W/"1"`}, ifNoneMatches)
+
+	// the decoded load balancer is sized by its response body
+	assert.Equal(t, 1, lbClient.decodedLBCache.Len())
+	assert.Equal(t, int64(len(marshalLoadBalancerWithReadOnlyFields(t, lb))), lbClient.decodedLBCache.Bytes())
+
+	// the decoded load balancer is dropped once it is deleted
+	armClient := mockarmclient.NewMockInterface(gomock.NewController(t))
+	armClient.EXPECT().DeleteResource(gomock.Any(), testResourceID).Return(nil)
+	lbClient.armClient = armClient
+	assert.Nil(t, lbClient.deleteLB(context.TODO(), "rg", "lb1"))
+	_, ok := lbClient.decodedLBCache.Get(testResourceID)
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), lbClient.decodedLBCache.Bytes())
+}
+
+func TestGetWithETagCacheBounded(t *testing.T) {
+	lbs := map[string][]byte{}
+	for _, name := range []string{"lb1", "lb2", "lb3"} {
+		lbs[name] = marshalLoadBalancerWithReadOnlyFields(t, getTestLargeLoadBalancer(name, 3))
+	}
+	var count int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `W/"1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		count++
+		w.Header().Set("ETag", `W/"1"`)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(lbs[path.Base(r.URL.Path)])
+	}))
+	defer server.Close()
+
+	azConfig := azclients.ClientConfig{Backoff: &retry.Backoff{Steps: 1}, UserAgent: "test", Location: "eastus"}
+	lbClient := getTestLoadBalancerClient(armclient.New(nil, azConfig, server.URL, "2019-01-01"))
+	// room for two load balancers only
+	lbClient.decodedLBCache = armclient.NewSizedLRUCache(decodedLBCacheSize, int64(len(lbs["lb1"])+len(lbs["lb2"])))
+	get := func(name, expand string) {
+		_, rerr := lbClient.Get(context.TODO(), "rg", name, expand)
+		assert.Nil(t, rerr)
+	}
+
+	get("lb1", "")
+	get("lb2", "")
+	get("lb1", "")
+	// the bodies of the load balancers not modified are not sent again
+	assert.Equal(t, 2, count)
+
+	// the least recently used load balancer is evicted
+	get("lb3", "")
+	assert.Equal(t, 2, lbClient.decodedLBCache.Len())
+	get("lb1", "")
+	assert.Equal(t, 3, count)
+	get("lb2", "")
+	assert.Equal(t, 4, count)
+
+	// the load balancer fetched with another expand query is not reused
+	get("lb2", "frontendIPConfigurations")
+	assert.Equal(t, 5, count)
+}
+
+func TestDecodeLoadBalancer(t *testing.T) {
+	lb := getTestLargeLoadBalancer("lb1", 3)
+	lb.Etag = pointer.String("etag")
+	lb.Sku = &network.LoadBalancerSku{Name: network.LoadBalancerSkuNameStandard}
+	lb.Tags = map[string]*string{"foo": pointer.String("bar")}
+	lb.ResourceGUID = pointer.String("guid")
+	lb.ProvisioningState = network.ProvisioningStateSucceeded
+	lb.FrontendIPConfigurations = &[]network.FrontendIPConfiguration{{Name: pointer.String("fip")}}
+	lb.BackendAddressPools = &[]network.BackendAddressPool{getTestBackendAddressPool("lb1", "pool")}
+	lb.OutboundRules = &[]network.OutboundRule{{Name: pointer.String("outbound")}}
+	lbBytes := marshalLoadBalancerWithReadOnlyFields(t, lb)
+
+	for _, tc := range []struct {
+		desc        string
+		body        string
+		expected    network.LoadBalancer
+		expectedErr bool
+	}{
+		{
+			desc:     "should decode the load balancer the same as the unmarshaler",
+			body:     string(lbBytes),
+			expected: lb,
+		},
+		{
+			desc:     "should decode the empty body",
+			body:     "",
+			expected: network.LoadBalancer{},
+		},
+		{
+			desc:     "should decode the null properties and arrays",
+			body:     `{"name": "lb1", "properties": {"probes": null, "loadBalancingRules": []}}`,
+			expected: network.LoadBalancer{Name: pointer.String("lb1"), LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{LoadBalancingRules: &[]network.LoadBalancingRule{}}},
+		},
+		{
+			desc:        "should not take the truncated body as an empty one",
+			body:        string(lbBytes[:len(lbBytes)/2]),
+			expectedErr: true,
+		},
+		{
+			desc:        "should report the invalid body",
+			body:        `{"properties": {"probes": {}}}`,
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var result network.LoadBalancer
+			err := autorest.Respond(
+				&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(tc.body))},
+				armclient.ByDecodingJSON(func(decoder *json.Decoder) error {
+					return decodeLoadBalancer(decoder, &result)
+				}))
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+// marshalLoadBalancerWithReadOnlyFields marshals the load balancer including its read-only fields, which are
+// dropped by its marshaler.
+func marshalLoadBalancerWithReadOnlyFields(t *testing.T, lb network.LoadBalancer) []byte {
+	data, err := json.Marshal(lb)
+	assert.NoError(t, err)
+	var fields map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &fields))
+	fields["name"] = lb.Name
+	fields["etag"] = lb.Etag
+	if properties, ok := fields["properties"].(map[string]interface{}); ok {
+		properties["resourceGuid"] = lb.ResourceGUID
+		properties["provisioningState"] = lb.ProvisioningState
+	}
+	data, err = json.Marshal(fields)
+	assert.NoError(t, err)
+	return data
+}
+
 func TestList(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -390,6 +573,138 @@ func TestMigrateToIpBasedBackendPools(t *testing.T) {
 	assert.Nil(t, rerr)
 }
 
+func TestGetLoadBalancingRuleHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ruleResourceID := testResourceID + "/loadBalancingRules/rule1"
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"up":1,"down":1,"loadBalancerBackendAddresses":[{"ipAddress":"10.0.0.4","state":"Up"},{"ipAddress":"10.0.0.5","state":"Down","reason":"Probe failed"}]}`))),
+	}
+	armClient.EXPECT().PostResource(gomock.Any(), ruleResourceID, "health", gomock.Any(), map[string]interface{}{"api-version": HealthAPIVersion}).Return(response, nil)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any())
+
+	lbClient := getTestLoadBalancerClient(armClient)
+	result, rerr := lbClient.GetLoadBalancingRuleHealth(context.TODO(), "rg", "lb1", "rule1")
+	assert.Nil(t, rerr)
+	expected := LoadBalancingRuleHealth{
+		Up:   pointer.Int32(1),
+		Down: pointer.Int32(1),
+		LoadBalancerBackendAddresses: &[]BackendAddressHealth{
+			{IPAddress: pointer.String("10.0.0.4"), State: pointer.String("Up")},
+			{IPAddress: pointer.String("10.0.0.5"), State: pointer.String("Down"), Reason: pointer.String("Probe failed")},
+		},
+	}
+	assert.Equal(t, expected, result)
+}
+
+func TestGetLoadBalancingRuleHealthThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PostResource(gomock.Any(), gomock.Any(), "health", gomock.Any(), gomock.Any()).Return(response, throttleErr)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any())
+
+	lbClient := getTestLoadBalancerClient(armClient)
+	result, rerr := lbClient.GetLoadBalancingRuleHealth(context.TODO(), "rg", "lb1", "rule1")
+	assert.Empty(t, result)
+	assert.Equal(t, throttleErr, rerr)
+}
+
+func BenchmarkGetLargeLoadBalancer(b *testing.B) {
+	lbBytes, err := json.Marshal(getTestLargeLoadBalancer("lb1", 3000))
+	assert.NoError(b, err)
+
+	for _, tc := range []struct {
+		desc     string
+		modified bool
+	}{
+		{desc: "modified", modified: true},
+		{desc: "unmodified"},
+	} {
+		b.Run(tc.desc, func(b *testing.B) {
+			var version int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.modified {
+					version++
+				}
+				etag := fmt.Sprintf(`W/"%d"`, version)
+				if r.Header.Get("If-None-Match") == etag {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", etag)
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(lbBytes)
+			}))
+			defer server.Close()
+
+			azConfig := azclients.ClientConfig{Backoff: &retry.Backoff{Steps: 1}, UserAgent: "test", Location: "eastus"}
+			lbClient := getTestLoadBalancerClient(armclient.New(nil, azConfig, server.URL, "2019-01-01"))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, rerr := lbClient.getLB(context.TODO(), "rg", "lb1", ""); rerr != nil {
+					b.Fatal(rerr.Error())
+				}
+			}
+		})
+	}
+}
+
+// getTestLargeLoadBalancer returns a load balancer with the given number of rules and probes.
+func getTestLargeLoadBalancer(name string, ruleCount int) network.LoadBalancer {
+	lb := getTestLoadBalancer(name)
+	rules := make([]network.LoadBalancingRule, 0, ruleCount)
+	probes := make([]network.Probe, 0, ruleCount)
+	for i := 0; i < ruleCount; i++ {
+		ruleName := fmt.Sprintf("a%d-TCP-%d", i, 1000+i)
+		probes = append(probes, network.Probe{
+			Name: pointer.String(ruleName),
+			ID:   pointer.String(fmt.Sprintf("%s/probes/%s", *lb.ID, ruleName)),
+			ProbePropertiesFormat: &network.ProbePropertiesFormat{
+				Protocol:          network.ProbeProtocolTCP,
+				Port:              pointer.Int32(int32(1000 + i)),
+				IntervalInSeconds: pointer.Int32(5),
+				ProbeThreshold:    pointer.Int32(2),
+			},
+		})
+		rules = append(rules, network.LoadBalancingRule{
+			Name: pointer.String(ruleName),
+			ID:   pointer.String(fmt.Sprintf("%s/loadBalancingRules/%s", *lb.ID, ruleName)),
+			LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+				Protocol:                network.TransportProtocolTCP,
+				FrontendPort:            pointer.Int32(int32(1000 + i)),
+				BackendPort:             pointer.Int32(int32(1000 + i)),
+				FrontendIPConfiguration: &network.SubResource{ID: pointer.String(fmt.Sprintf("%s/frontendIPConfigurations/a%d", *lb.ID, i))},
+				BackendAddressPool:      &network.SubResource{ID: pointer.String(fmt.Sprintf("%s/backendAddressPools/kubernetes", *lb.ID))},
+				Probe:                   &network.SubResource{ID: pointer.String(fmt.Sprintf("%s/probes/%s", *lb.ID, ruleName))},
+				IdleTimeoutInMinutes:    pointer.Int32(4),
+				EnableFloatingIP:        pointer.Bool(true),
+			},
+		})
+	}
+	lb.LoadBalancerPropertiesFormat = &network.LoadBalancerPropertiesFormat{
+		LoadBalancingRules: &rules,
+		Probes:             &probes,
+	}
+	return lb
+}
+
 func getTestLoadBalancer(name string) network.LoadBalancer {
 	return network.LoadBalancer{
 		ID:       pointer.String(fmt.Sprintf("/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/%s", name)),
@@ -415,5 +730,6 @@ func getTestLoadBalancerClient(armClient armclient.Interface) *Client {
 		subscriptionID:    "subscriptionID",
 		rateLimiterReader: rateLimiterReader,
 		rateLimiterWriter: rateLimiterWriter,
+		decodedLBCache:    armclient.NewSizedLRUCache(decodedLBCacheSize, decodedLBCacheMaxBytes),
 	}
 }
@@ -27,10 +27,15 @@ import (
 const (
 	// APIVersion is the API version for network.
 	APIVersion = "2022-07-01"
+	// MaxAPIVersion is the newest API version the client can be configured with, whose load balancer
+	// schema is compatible with the models of the client.
+	MaxAPIVersion = "2023-04-01"
 	// AzureStackCloudAPIVersion is the API version for Azure Stack
 	AzureStackCloudAPIVersion = "2018-11-01"
 	// AzureStackCloudName is the cloud name of Azure Stack
 	AzureStackCloudName = "AZURESTACKCLOUD"
+	// HealthAPIVersion is the API version for the health of load balancing rules.
+	HealthAPIVersion = "2023-04-01"
 )
 
 // Interface is the client interface for LoadBalancer.
@@ -59,4 +64,29 @@ type Interface interface {
 
 	// MigrateToIPBasedBackendPool migrates a NIC-based backend pool to IP-based.
 	MigrateToIPBasedBackendPool(ctx context.Context, resourceGroupName string, loadBalancerName string, backendPoolNames []string) *retry.Error
+
+	// GetLoadBalancingRuleHealth gets the health of the backend addresses of a load balancing rule.
+	GetLoadBalancingRuleHealth(ctx context.Context, resourceGroupName string, loadBalancerName string, loadBalancingRuleName string) (LoadBalancingRuleHealth, *retry.Error)
+}
+
+// LoadBalancingRuleHealth is the health of the backend addresses of a load balancing rule.
+type LoadBalancingRuleHealth struct {
+	// Up is the number of backend addresses which are up.
+	Up *int32 `json:"up,omitempty"`
+	// Down is the number of backend addresses which are down.
+	Down *int32 `json:"down,omitempty"`
+	// LoadBalancerBackendAddresses is the health of each backend address.
+	LoadBalancerBackendAddresses *[]BackendAddressHealth `json:"loadBalancerBackendAddresses,omitempty"`
+}
+
+// BackendAddressHealth is the health of a backend address of a load balancing rule.
+type BackendAddressHealth struct {
+	// IPAddress is the IP address of the backend address.
+	IPAddress *string `json:"ipAddress,omitempty"`
+	// NetworkInterfaceIPConfigurationID is the ID of the network interface ip configuration of the backend address.
+	NetworkInterfaceIPConfigurationID *string `json:"networkInterfaceIPConfigurationId,omitempty"`
+	// State is the health state of the backend address, e.g. "Up" or "Down".
+	State *string `json:"state,omitempty"`
+	// Reason is the reason of the health state.
+	Reason *string `json:"reason,omitempty"`
 }
@@ -27,6 +27,7 @@ import (
 
 	network "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 	gomock "github.com/golang/mock/gomock"
+	loadbalancerclient "sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient"
 	retry "sigs.k8s.io/cloud-provider-azure/pkg/retry"
 )
 
@@ -139,6 +140,21 @@ func (mr *MockInterfaceMockRecorder) GetLBBackendPool(ctx, resourceGroupName, lo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLBBackendPool", reflect.TypeOf((*MockInterface)(nil).GetLBBackendPool), ctx, resourceGroupName, loadBalancerName, backendPoolName, expand)
 }
 
+// GetLoadBalancingRuleHealth mocks base method.
+func (m *MockInterface) GetLoadBalancingRuleHealth(ctx context.Context, resourceGroupName, loadBalancerName, loadBalancingRuleName string) (loadbalancerclient.LoadBalancingRuleHealth, *retry.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoadBalancingRuleHealth", ctx, resourceGroupName, loadBalancerName, loadBalancingRuleName)
+	ret0, _ := ret[0].(loadbalancerclient.LoadBalancingRuleHealth)
+	ret1, _ := ret[1].(*retry.Error)
+	return ret0, ret1
+}
+
+// GetLoadBalancingRuleHealth indicates an expected call of GetLoadBalancingRuleHealth.
+func (mr *MockInterfaceMockRecorder) GetLoadBalancingRuleHealth(ctx, resourceGroupName, loadBalancerName, loadBalancingRuleName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoadBalancingRuleHealth", reflect.TypeOf((*MockInterface)(nil).GetLoadBalancingRuleHealth), ctx, resourceGroupName, loadBalancerName, loadBalancingRuleName)
+}
+
 // List mocks base method.
 func (m *MockInterface) List(ctx context.Context, resourceGroupName string) ([]network.LoadBalancer, *retry.Error) {
 	m.ctrl.T.Helper()
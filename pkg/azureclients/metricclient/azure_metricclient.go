@@ -0,0 +1,151 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+var _ Interface = &Client{}
+
+const metricResourceType = "Microsoft.Insights/metrics"
+
+// Client implements Metric client Interface.
+type Client struct {
+	armClient      armclient.Interface
+	subscriptionID string
+	cloudName      string
+
+	// Rate limiting configures.
+	rateLimiterReader flowcontrol.RateLimiter
+
+	// ARM throttling configures.
+	RetryAfterReader time.Time
+}
+
+// New creates a new Metric client with ratelimiting.
+func New(config *azclients.ClientConfig) *Client {
+	baseURI := config.ResourceManagerEndpoint
+	authorizer := config.Authorizer
+	apiVersion := APIVersion
+	armClient := armclient.New(authorizer, *config, baseURI, apiVersion)
+	rateLimiterReader, _ := azclients.NewRegisteredRateLimiter("metrics", config.SubscriptionID, config.RateLimitConfig)
+
+	if azclients.RateLimitEnabled(config.RateLimitConfig) {
+		klog.V(2).Infof("Azure MetricsClient (read ops) using rate limit config: QPS=%g, bucket=%d",
+			config.RateLimitConfig.CloudProviderRateLimitQPS,
+			config.RateLimitConfig.CloudProviderRateLimitBucket)
+	}
+
+	client := &Client{
+		armClient:         armClient,
+		rateLimiterReader: rateLimiterReader,
+		subscriptionID:    config.SubscriptionID,
+		cloudName:         config.CloudName,
+	}
+
+	return client
+}
+
+// getMetricsID returns the ID of the metrics of the resource, which is an extension resource of it.
+func getMetricsID(resourceURI string) string {
+	return fmt.Sprintf("%s/providers/%s", strings.TrimSuffix(resourceURI, "/"), metricResourceType)
+}
+
+// List lists the metric values of the resource.
+func (c *Client) List(ctx context.Context, resourceURI, timespan, interval, metricNames, aggregation, filter string) (Response, *retry.Error) {
+	mc := metrics.NewMetricContext("metrics", "list", "", c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterReader.TryAccept() {
+		mc.RateLimitedCount()
+		return Response{}, retry.GetRateLimitError(false, "MetricList")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterReader.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("MetricList", "client throttled", c.RetryAfterReader)
+		return Response{}, rerr
+	}
+
+	result, rerr := c.listMetrics(ctx, resourceURI, timespan, interval, metricNames, aggregation, filter)
+	mc.Observe(rerr)
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterReader = rerr.RetryAfter
+		}
+
+		return result, rerr
+	}
+
+	return result, nil
+}
+
+// listMetrics lists the metric values of the resource.
+func (c *Client) listMetrics(ctx context.Context, resourceURI, timespan, interval, metricNames, aggregation, filter string) (Response, *retry.Error) {
+	resourceID := getMetricsID(resourceURI)
+	result := Response{}
+
+	queries := map[string]interface{}{}
+	for key, value := range map[string]string{
+		"timespan":    timespan,
+		"interval":    interval,
+		"metricnames": metricNames,
+		"aggregation": aggregation,
+		"$filter":     filter,
+	} {
+		if value != "" {
+			queries[key] = value
+		}
+	}
+
+	response, rerr := c.armClient.GetResourceWithQueries(ctx, resourceID, queries)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "metric.list.request", resourceID, rerr.Error())
+		return result, rerr
+	}
+
+	err := autorest.Respond(
+		response,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result))
+	if err != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "metric.list.respond", resourceID, err)
+		return result, retry.GetError(response, err)
+	}
+
+	result.Response = autorest.Response{Response: response}
+	return result, nil
+}
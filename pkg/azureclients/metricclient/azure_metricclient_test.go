@@ -0,0 +1,163 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/utils/pointer"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient/mockarmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	testResourceURI = "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb"
+	testResourceID  = testResourceURI + "/providers/" + metricResourceType
+	testTimespan    = "2023-01-01T00:00:00Z/2023-01-01T00:05:00Z"
+)
+
+func TestNew(t *testing.T) {
+	config := &azclients.ClientConfig{
+		SubscriptionID:          "sub",
+		ResourceManagerEndpoint: "endpoint",
+		Location:                "eastus",
+		RateLimitConfig: &azclients.RateLimitConfig{
+			CloudProviderRateLimit:       true,
+			CloudProviderRateLimitQPS:    0.5,
+			CloudProviderRateLimitBucket: 1,
+		},
+		Backoff: &retry.Backoff{Steps: 1},
+	}
+
+	metricClient := New(config)
+	assert.Equal(t, "sub", metricClient.subscriptionID)
+	assert.NotEmpty(t, metricClient.rateLimiterReader)
+}
+
+func TestList(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"value":[{"name":{"value":"UsedSnatPorts"},"timeseries":[{"metadatavalues":[{"name":{"value":"frontendipaddress"},"value":"1.2.3.4"}],"data":[{"timeStamp":"2023-01-01T00:04:00Z","average":10}]}]}]}`))),
+	}
+	queries := map[string]interface{}{
+		"timespan":    testTimespan,
+		"interval":    "PT1M",
+		"metricnames": "UsedSnatPorts",
+		"aggregation": "Average",
+		"$filter":     "FrontendIPAddress eq '*'",
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResourceWithQueries(gomock.Any(), testResourceID, queries).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	metricClient := getTestMetricClient(armClient)
+	result, rerr := metricClient.List(context.TODO(), testResourceURI, testTimespan, "PT1M", "UsedSnatPorts", "Average", "FrontendIPAddress eq '*'")
+	assert.Nil(t, rerr)
+	assert.Equal(t, 1, len(*result.Value))
+	metric := (*result.Value)[0]
+	assert.Equal(t, "UsedSnatPorts", pointer.StringDeref(metric.Name.Value, ""))
+	timeseries := (*metric.Timeseries)[0]
+	assert.Equal(t, "1.2.3.4", pointer.StringDeref((*timeseries.Metadatavalues)[0].Value, ""))
+	assert.Equal(t, 10.0, *(*timeseries.Data)[0].Average)
+}
+
+func TestListWithoutOptionalQueries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"value":[]}`))),
+	}
+	queries := map[string]interface{}{
+		"metricnames": "VipAvailability",
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResourceWithQueries(gomock.Any(), testResourceID, queries).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	metricClient := getTestMetricClient(armClient)
+	result, rerr := metricClient.List(context.TODO(), testResourceURI, "", "", "VipAvailability", "", "")
+	assert.Nil(t, rerr)
+	assert.Empty(t, *result.Value)
+}
+
+func TestListThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResourceWithQueries(gomock.Any(), testResourceID, gomock.Any()).Return(response, throttleErr).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	metricClient := getTestMetricClient(armClient)
+	result, rerr := metricClient.List(context.TODO(), testResourceURI, testTimespan, "PT1M", "UsedSnatPorts", "Average", "")
+	assert.Empty(t, result)
+	assert.Equal(t, throttleErr, rerr)
+	assert.Equal(t, throttleErr.RetryAfter, metricClient.RetryAfterReader)
+}
+
+func TestListNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	listErr := &retry.Error{
+		RawError:  fmt.Errorf("azure cloud provider rate limited(%s) for operation %q", "read", "MetricList"),
+		Retriable: true,
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	metricClient := getTestMetricClient(armClient)
+	metricClient.rateLimiterReader = flowcontrol.NewFakeNeverRateLimiter()
+	_, rerr := metricClient.List(context.TODO(), testResourceURI, testTimespan, "PT1M", "UsedSnatPorts", "Average", "")
+	assert.Equal(t, listErr, rerr)
+}
+
+func getTestMetricClient(armClient armclient.Interface) *Client {
+	rateLimiterReader, _ := azclients.NewRateLimiter(&azclients.RateLimitConfig{})
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    "subscriptionID",
+		rateLimiterReader: rateLimiterReader,
+	}
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricclient
+
+import (
+	"context"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	// APIVersion is the API version for metrics.
+	APIVersion = "2018-01-01"
+)
+
+// Interface is the client interface for the metrics of Azure resources.
+// Don't forget to run "hack/update-mock-clients.sh" command to generate the mock client.
+type Interface interface {
+	// List lists the metric values of the resource in the timespan, e.g., "2023-01-01T00:00:00Z/2023-01-01T00:05:00Z",
+	// with the interval, e.g., "PT1M". The metric names and the aggregations are comma separated, and the filter
+	// splits the values by the dimensions, e.g., "FrontendIPAddress eq '*'".
+	List(ctx context.Context, resourceURI, timespan, interval, metricNames, aggregation, filter string) (result Response, rerr *retry.Error)
+}
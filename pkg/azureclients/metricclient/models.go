@@ -0,0 +1,72 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricclient
+
+import (
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/date"
+)
+
+// Response is the metric values of an Azure resource.
+type Response struct {
+	autorest.Response `json:"-"`
+	// Timespan is the timespan of the metric values.
+	Timespan *string `json:"timespan,omitempty"`
+	// Interval is the interval of the metric values.
+	Interval *string `json:"interval,omitempty"`
+	// Value is the metrics of the resource.
+	Value *[]Metric `json:"value,omitempty"`
+}
+
+// Metric is the values of a metric, split by the dimensions in the filter.
+type Metric struct {
+	ID   *string            `json:"id,omitempty"`
+	Name *LocalizableString `json:"name,omitempty"`
+	Unit *string            `json:"unit,omitempty"`
+	// Timeseries is the values of the metric for each combination of the dimension values.
+	Timeseries *[]TimeSeriesElement `json:"timeseries,omitempty"`
+}
+
+// LocalizableString is the name of a metric or a dimension.
+type LocalizableString struct {
+	Value          *string `json:"value,omitempty"`
+	LocalizedValue *string `json:"localizedValue,omitempty"`
+}
+
+// TimeSeriesElement is the values of a metric for a combination of the dimension values.
+type TimeSeriesElement struct {
+	// Metadatavalues are the dimension values of the time series.
+	Metadatavalues *[]MetadataValue `json:"metadatavalues,omitempty"`
+	// Data are the values of the time series by time.
+	Data *[]MetricValue `json:"data,omitempty"`
+}
+
+// MetadataValue is the value of a dimension.
+type MetadataValue struct {
+	Name  *LocalizableString `json:"name,omitempty"`
+	Value *string            `json:"value,omitempty"`
+}
+
+// MetricValue is the aggregated values of a metric at a time.
+type MetricValue struct {
+	TimeStamp *date.Time `json:"timeStamp,omitempty"`
+	Average   *float64   `json:"average,omitempty"`
+	Minimum   *float64   `json:"minimum,omitempty"`
+	Maximum   *float64   `json:"maximum,omitempty"`
+	Total     *float64   `json:"total,omitempty"`
+	Count     *float64   `json:"count,omitempty"`
+}
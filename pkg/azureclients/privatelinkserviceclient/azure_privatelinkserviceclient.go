@@ -68,7 +68,7 @@ func New(config *azclients.ClientConfig) *Client {
 	}
 	armClient := armclient.New(config.Authorizer, *config, config.ResourceManagerEndpoint, apiVersion)
 
-	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(config.RateLimitConfig)
+	rateLimiterReader, rateLimiterWriter := azclients.NewRegisteredRateLimiter("private_link_services", config.SubscriptionID, config.RateLimitConfig)
 	if azclients.RateLimitEnabled(config.RateLimitConfig) {
 		klog.V(2).Infof("Azure PrivateLinkServicesClient (read ops) using rate limit config: QPS=%g, bucket=%d",
 			config.RateLimitConfig.CloudProviderRateLimitQPS,
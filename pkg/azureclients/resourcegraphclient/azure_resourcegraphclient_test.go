@@ -0,0 +1,146 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcegraphclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/client-go/util/flowcontrol"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient/mockarmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const testQuery = "Resources | where type =~ 'microsoft.compute/virtualmachines' | project id"
+
+func TestNew(t *testing.T) {
+	config := &azclients.ClientConfig{
+		SubscriptionID:          "sub",
+		ResourceManagerEndpoint: "endpoint",
+		Location:                "eastus",
+		RateLimitConfig: &azclients.RateLimitConfig{
+			CloudProviderRateLimit:       true,
+			CloudProviderRateLimitQPS:    0.5,
+			CloudProviderRateLimitBucket: 1,
+		},
+		Backoff: &retry.Backoff{Steps: 1},
+	}
+
+	resourceGraphClient := New(config)
+	assert.Equal(t, "sub", resourceGraphClient.subscriptionID)
+	assert.NotEmpty(t, resourceGraphClient.rateLimiterReader)
+}
+
+func TestResources(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"totalRecords":1,"count":1,"data":[{"id":"vm1"}]}`))),
+	}
+	expectedRequest := QueryRequest{Subscriptions: []string{"subscriptionID"}, Query: testQuery}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PostResource(gomock.Any(), resourceGraphProviderID, "resources", expectedRequest, map[string]interface{}{}).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	resourceGraphClient := getTestResourceGraphClient(armClient)
+	result, rerr := resourceGraphClient.Resources(context.TODO(), QueryRequest{Query: testQuery})
+	assert.Nil(t, rerr)
+	assert.Equal(t, int64(1), result.TotalRecords)
+	assert.Equal(t, []map[string]interface{}{{"id": "vm1"}}, result.Data)
+}
+
+func TestResourcesWithSubscriptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader([]byte(`{"totalRecords":0,"count":0,"data":[]}`))),
+	}
+	request := QueryRequest{Subscriptions: []string{"other"}, Query: testQuery}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PostResource(gomock.Any(), resourceGraphProviderID, "resources", request, map[string]interface{}{}).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	resourceGraphClient := getTestResourceGraphClient(armClient)
+	result, rerr := resourceGraphClient.Resources(context.TODO(), request)
+	assert.Nil(t, rerr)
+	assert.Empty(t, result.Data)
+}
+
+func TestResourcesThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().PostResource(gomock.Any(), resourceGraphProviderID, "resources", gomock.Any(), gomock.Any()).Return(response, throttleErr).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	resourceGraphClient := getTestResourceGraphClient(armClient)
+	result, rerr := resourceGraphClient.Resources(context.TODO(), QueryRequest{Query: testQuery})
+	assert.Empty(t, result)
+	assert.Equal(t, throttleErr, rerr)
+	assert.Equal(t, throttleErr.RetryAfter, resourceGraphClient.RetryAfterReader)
+}
+
+func TestResourcesNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	resourcesErr := &retry.Error{
+		RawError:  fmt.Errorf("azure cloud provider rate limited(%s) for operation %q", "read", "ResourceGraphResources"),
+		Retriable: true,
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	resourceGraphClient := getTestResourceGraphClient(armClient)
+	resourceGraphClient.rateLimiterReader = flowcontrol.NewFakeNeverRateLimiter()
+	_, rerr := resourceGraphClient.Resources(context.TODO(), QueryRequest{Query: testQuery})
+	assert.Equal(t, resourcesErr, rerr)
+}
+
+func getTestResourceGraphClient(armClient armclient.Interface) *Client {
+	rateLimiterReader, _ := azclients.NewRateLimiter(&azclients.RateLimitConfig{})
+	return &Client{
+		armClient:         armClient,
+		subscriptionID:    "subscriptionID",
+		rateLimiterReader: rateLimiterReader,
+	}
+}
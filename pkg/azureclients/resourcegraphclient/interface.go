@@ -0,0 +1,56 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcegraphclient
+
+import (
+	"context"
+
+	"github.com/Azure/go-autorest/autorest"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	// APIVersion is the API version for Azure Resource Graph.
+	APIVersion = "2021-03-01"
+)
+
+// QueryRequest is a query of Azure Resource Graph.
+type QueryRequest struct {
+	// Subscriptions are the subscriptions the query is evaluated against.
+	Subscriptions []string `json:"subscriptions,omitempty"`
+	// Query is the Kusto query of the resources.
+	Query string `json:"query"`
+}
+
+// QueryResponse is the result of a query of Azure Resource Graph, with the rows in the objectArray format.
+type QueryResponse struct {
+	autorest.Response `json:"-"`
+	// TotalRecords is the number of the rows matching the query.
+	TotalRecords int64 `json:"totalRecords"`
+	// Count is the number of the rows returned in Data.
+	Count int64 `json:"count"`
+	// Data are the rows returned by the query.
+	Data []map[string]interface{} `json:"data"`
+}
+
+// Interface is the client interface for Azure Resource Graph.
+// Don't forget to run "hack/update-mock-clients.sh" command to generate the mock client.
+type Interface interface {
+	// Resources queries the resources with Azure Resource Graph.
+	Resources(ctx context.Context, request QueryRequest) (QueryResponse, *retry.Error)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package skuclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+var _ Interface = &Client{}
+
+// Client implements compute ResourceSkus client Interface.
+type Client struct {
+	armClient      armclient.Interface
+	subscriptionID string
+	cloudName      string
+
+	// Rate limiting configures.
+	rateLimiterReader flowcontrol.RateLimiter
+	rateLimiterWriter flowcontrol.RateLimiter
+
+	// ARM throttling configures.
+	RetryAfterReader time.Time
+	RetryAfterWriter time.Time
+}
+
+// New creates a new compute ResourceSkus client with ratelimiting.
+func New(config *azclients.ClientConfig) *Client {
+	baseURI := config.ResourceManagerEndpoint
+	authorizer := config.Authorizer
+	apiVersion := APIVersion
+	armClient := armclient.New(authorizer, *config, baseURI, apiVersion)
+	rateLimiterReader, rateLimiterWriter := azclients.NewRegisteredRateLimiter("skus", config.SubscriptionID, config.RateLimitConfig)
+
+	if azclients.RateLimitEnabled(config.RateLimitConfig) {
+		klog.V(2).Infof("Azure ResourceSkusClient (read ops) using rate limit config: QPS=%g, bucket=%d",
+			config.RateLimitConfig.CloudProviderRateLimitQPS,
+			config.RateLimitConfig.CloudProviderRateLimitBucket)
+		klog.V(2).Infof("Azure ResourceSkusClient (write ops) using rate limit config: QPS=%g, bucket=%d",
+			config.RateLimitConfig.CloudProviderRateLimitQPSWrite,
+			config.RateLimitConfig.CloudProviderRateLimitBucketWrite)
+	}
+
+	client := &Client{
+		armClient:         armClient,
+		rateLimiterReader: rateLimiterReader,
+		rateLimiterWriter: rateLimiterWriter,
+		subscriptionID:    config.SubscriptionID,
+		cloudName:         config.CloudName,
+	}
+
+	return client
+}
+
+// List gets the compute resource SKUs available in the location.
+func (c *Client) List(ctx context.Context, location string) ([]compute.ResourceSku, *retry.Error) {
+	mc := metrics.NewMetricContext("skus", "list", "", c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterReader.TryAccept() {
+		mc.RateLimitedCount()
+		return nil, retry.GetRateLimitError(false, "SKUsList")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterReader.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("SKUsList", "client throttled", c.RetryAfterReader)
+		return nil, rerr
+	}
+
+	result, rerr := c.listResourceSkus(ctx, location)
+	mc.Observe(rerr)
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterReader = rerr.RetryAfter
+		}
+
+		return result, rerr
+	}
+
+	return result, nil
+}
+
+// listResourceSkus gets the compute resource SKUs available in the location, following the next links.
+func (c *Client) listResourceSkus(ctx context.Context, location string) ([]compute.ResourceSku, *retry.Error) {
+	resourceID := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Compute/skus",
+		autorest.Encode("path", c.subscriptionID),
+	)
+
+	result := make([]compute.ResourceSku, 0)
+	response, rerr := c.armClient.GetResourceWithQueries(ctx, resourceID, map[string]interface{}{
+		"$filter": fmt.Sprintf("location eq '%s'", location),
+	})
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "sku.list.request", resourceID, rerr.Error())
+		return result, rerr
+	}
+
+	page, err := c.listResponder(response)
+	if err != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "sku.list.respond", resourceID, err)
+		return result, retry.GetError(response, err)
+	}
+
+	for {
+		if page.Value != nil {
+			result = append(result, *page.Value...)
+		}
+
+		// Abort the loop when there's no nextLink in the response.
+		nextLink := pointer.StringDeref(page.NextLink, "")
+		if nextLink == "" {
+			break
+		}
+
+		if page, rerr = c.listNextResults(ctx, nextLink); rerr != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "sku.list.next", resourceID, rerr.Error())
+			return result, rerr
+		}
+	}
+
+	return result, nil
+}
+
+// listNextResults retrieves the next set of results.
+func (c *Client) listNextResults(ctx context.Context, nextLink string) (compute.ResourceSkusResult, *retry.Error) {
+	request, err := c.armClient.PrepareGetRequest(ctx, autorest.WithBaseURL(nextLink))
+	if err != nil {
+		return compute.ResourceSkusResult{}, retry.NewError(false, err)
+	}
+
+	response, rerr := c.armClient.Send(ctx, request)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		return compute.ResourceSkusResult{}, rerr
+	}
+
+	result, err := c.listResponder(response)
+	if err != nil {
+		return result, retry.GetError(response, err)
+	}
+	return result, nil
+}
+
+func (c *Client) listResponder(resp *http.Response) (result compute.ResourceSkusResult, err error) {
+	err = autorest.Respond(
+		resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result),
+		autorest.ByClosing())
+	result.Response = autorest.Response{Response: resp}
+	return
+}
@@ -45,6 +45,24 @@ const (
 	vmResourceType   = "virtualMachines"
 )
 
+// InstanceError is the error of updating a VMSS VM in UpdateVMs, which tells the failed VMs apart.
+type InstanceError struct {
+	// InstanceID is the instance ID of the failed VM.
+	InstanceID string
+	// Err is the error of the request.
+	Err error
+}
+
+// Error returns the message of the error of the request.
+func (e *InstanceError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the request.
+func (e *InstanceError) Unwrap() error {
+	return e.Err
+}
+
 // Client implements VMSS client Interface.
 type Client struct {
 	armClient      armclient.Interface
@@ -69,7 +87,7 @@ func New(config *azclients.ClientConfig) *Client {
 		apiVersion = AzureStackCloudAPIVersion
 	}
 	armClient := armclient.New(authorizer, *config, baseURI, apiVersion)
-	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(config.RateLimitConfig)
+	rateLimiterReader, rateLimiterWriter := azclients.NewRegisteredRateLimiter("vmssvm", config.SubscriptionID, config.RateLimitConfig)
 
 	if azclients.RateLimitEnabled(config.RateLimitConfig) {
 		klog.V(2).Infof("Azure vmssVM client (read ops) using rate limit config: QPS=%g, bucket=%d",
@@ -496,6 +514,7 @@ func (c *Client) UpdateVMs(ctx context.Context, resourceGroupName string, VMScal
 // updateVMSSVMs updates a list of VirtualMachineScaleSetVM from map[instanceID]compute.VirtualMachineScaleSetVM.
 func (c *Client) updateVMSSVMs(ctx context.Context, resourceGroupName string, VMScaleSetName string, instances map[string]compute.VirtualMachineScaleSetVM, batchSize int) *retry.Error {
 	resources := make(map[string]interface{})
+	instanceIDs := make(map[string]string)
 	for instanceID, parameter := range instances {
 		resourceID := armclient.GetChildResourceID(
 			c.subscriptionID,
@@ -506,10 +525,12 @@ func (c *Client) updateVMSSVMs(ctx context.Context, resourceGroupName string, VM
 			instanceID,
 		)
 		resources[resourceID] = parameter
+		instanceIDs[resourceID] = instanceID
 	}
 
 	responses := c.armClient.PutResourcesInBatches(ctx, resources, batchSize)
 	errors := make([]*retry.Error, 0)
+	failedInstanceIDs := make([]string, 0)
 	for resourceID, resp := range responses {
 		if resp == nil {
 			continue
@@ -535,6 +556,7 @@ func (c *Client) updateVMSSVMs(ctx context.Context, resourceGroupName string, VM
 			}
 
 			errors = append(errors, resp.Error)
+			failedInstanceIDs = append(failedInstanceIDs, instanceIDs[resourceID])
 			continue
 		}
 
@@ -543,6 +565,7 @@ func (c *Client) updateVMSSVMs(ctx context.Context, resourceGroupName string, VM
 			if rerr != nil {
 				klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "vmssvm.put.respond", resourceID, rerr.Error())
 				errors = append(errors, rerr)
+				failedInstanceIDs = append(failedInstanceIDs, instanceIDs[resourceID])
 			}
 		}
 	}
@@ -551,7 +574,7 @@ func (c *Client) updateVMSSVMs(ctx context.Context, resourceGroupName string, VM
 	if len(errors) > 0 {
 		rerr := &retry.Error{}
 		errs := make([]error, 0)
-		for _, err := range errors {
+		for i, err := range errors {
 			if !err.Retriable && strings.Contains(err.Error().Error(), consts.ConcurrentRequestConflictMessage) {
 				err.Retriable = true
 				err.RetryAfter = time.Now().Add(5 * time.Second)
@@ -560,7 +583,7 @@ func (c *Client) updateVMSSVMs(ctx context.Context, resourceGroupName string, VM
 			if err.IsThrottled() && err.RetryAfter.After(rerr.RetryAfter) {
 				rerr.RetryAfter = err.RetryAfter
 			}
-			errs = append(errs, err.Error())
+			errs = append(errs, &InstanceError{InstanceID: failedInstanceIDs[i], Err: err.Error()})
 		}
 		rerr.RawError = utilerrors.Flatten(utilerrors.NewAggregate(errs))
 		return rerr
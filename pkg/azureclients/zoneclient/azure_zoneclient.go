@@ -38,6 +38,7 @@ const computeResourceProvider = "Microsoft.Compute"
 type resourceTypeMetadata struct {
 	ResourceType string         `json:"resourceType"`
 	ZoneMappings []zoneMappings `json:"zoneMappings"`
+	APIVersions  []string       `json:"apiVersions"`
 }
 
 type zoneMappings struct {
@@ -136,3 +137,33 @@ func (c *Client) getZones(ctx context.Context, subscriptionID string) (map[strin
 
 	return regionZoneMap, nil
 }
+
+// GetAPIVersions gets the API versions of the resource type supported by the resource provider
+func (c *Client) GetAPIVersions(ctx context.Context, subscriptionID, providerNamespace, resourceType string) ([]string, *retry.Error) {
+	resourceID := armclient.GetProviderResourceID(subscriptionID, providerNamespace)
+
+	response, rerr := c.armClient.GetResource(ctx, resourceID)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "provider.get.request", resourceID, rerr.Error())
+		return nil, rerr
+	}
+
+	result := providerListDataProperty{}
+	err := autorest.Respond(
+		response,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result))
+	if err != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "provider.get.respond", resourceID, err)
+		return nil, retry.GetError(response, err)
+	}
+
+	for _, rt := range result.ResourceTypes {
+		if strings.EqualFold(rt.ResourceType, resourceType) {
+			return rt.APIVersions, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -177,3 +177,27 @@ func TestGetInternalError(t *testing.T) {
 	assert.NotNil(t, rerr)
 	assert.Equal(t, http.StatusInternalServerError, rerr.HTTPStatusCode)
 }
+
+func TestGetAPIVersions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body: io.NopCloser(bytes.NewReader([]byte(`{
+	"id": "/subscriptions/subscriptionID/providers/Microsoft.Network",
+	"resourceTypes": [
+		{"resourceType": "publicIPAddresses", "apiVersions": ["2018-11-01"]},
+		{"resourceType": "loadBalancers", "apiVersions": ["2022-07-01", "2018-11-01"]}
+	]
+}`))),
+	}
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), "/subscriptions/subscriptionID/providers/Microsoft.Network").Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	zoneClient := getTestZoneClient(armClient)
+	versions, rerr := zoneClient.GetAPIVersions(context.TODO(), zoneClient.subscriptionID, "Microsoft.Network", "loadBalancers")
+	assert.Nil(t, rerr)
+	assert.Equal(t, []string{"2022-07-01", "2018-11-01"}, versions)
+}
@@ -35,4 +35,7 @@ const (
 // Don't forget to run "hack/update-mock-clients.sh" command to generate the mock client.
 type Interface interface {
 	GetZones(ctx context.Context, subscriptionID string) (map[string][]string, *retry.Error)
+
+	// GetAPIVersions gets the API versions of the resource type supported by the resource provider.
+	GetAPIVersions(ctx context.Context, subscriptionID, providerNamespace, resourceType string) ([]string, *retry.Error)
 }
@@ -52,6 +52,21 @@ func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
 	return m.recorder
 }
 
+// GetAPIVersions mocks base method.
+func (m *MockInterface) GetAPIVersions(ctx context.Context, subscriptionID, providerNamespace, resourceType string) ([]string, *retry.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIVersions", ctx, subscriptionID, providerNamespace, resourceType)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(*retry.Error)
+	return ret0, ret1
+}
+
+// GetAPIVersions indicates an expected call of GetAPIVersions.
+func (mr *MockInterfaceMockRecorder) GetAPIVersions(ctx, subscriptionID, providerNamespace, resourceType interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIVersions", reflect.TypeOf((*MockInterface)(nil).GetAPIVersions), ctx, subscriptionID, providerNamespace, resourceType)
+}
+
 // GetZones mocks base method.
 func (m *MockInterface) GetZones(ctx context.Context, subscriptionID string) (map[string][]string, *retry.Error) {
 	m.ctrl.T.Helper()
@@ -30,6 +30,11 @@ const (
 	// VMTypeVmssFlex is the vmssflex vm type
 	VMTypeVmssFlex = "vmssflex"
 
+	// NodeShutdownBehaviorTaint marks the node as shut down, so that it is tainted by the cloud node lifecycle controller.
+	NodeShutdownBehaviorTaint = "Taint"
+	// NodeShutdownBehaviorIgnore leaves the node untouched.
+	NodeShutdownBehaviorIgnore = "Ignore"
+
 	// ExternalResourceGroupLabel is the label representing the node is in a different
 	// resource group from other cloud provider components
 	ExternalResourceGroupLabel = "kubernetes.azure.com/resource-group"
@@ -37,6 +42,46 @@ const (
 	ManagedByAzureLabel = "kubernetes.azure.com/managed"
 	// NotManagedByAzureLabelValue is the label value representing the node is not managed by cloud provider azure
 	NotManagedByAzureLabelValue = "false"
+	// InstanceProviderLabel is the label of the nodes which are not Azure VMs, e.g. Arc-enabled servers or on-prem
+	// nodes in hybrid clusters. Its value is the name of the instance provider serving the node.
+	InstanceProviderLabel = "kubernetes.azure.com/instance-provider"
+	// LabelInstanceProviderName is the name of the built-in instance provider serving the instance information
+	// from the labels of the node.
+	LabelInstanceProviderName = "label"
+	// InstanceIDLabel is the label of the instance ID of the nodes served by the built-in label instance provider.
+	InstanceIDLabel = "kubernetes.azure.com/instance-id"
+	// NodeLoadBalancerBackendNICAnnotation is the annotation of the node specifying the network interface which joins
+	// the load balancer backend pools, in the format of "<nic name>" or "<nic name>/<ipconfig name>".
+	NodeLoadBalancerBackendNICAnnotation = "kubernetes.azure.com/load-balancer-backend-nic"
+	// NodeNICAcceleratedNetworkingAnnotation is the annotation of the node reporting whether accelerated networking
+	// is enabled on the primary network interface.
+	NodeNICAcceleratedNetworkingAnnotation = "kubernetes.azure.com/nic-accelerated-networking"
+	// NodeNICTypeAnnotation is the annotation of the node reporting the type (SKU) of the primary network interface,
+	// e.g. Standard or Elastic.
+	NodeNICTypeAnnotation = "kubernetes.azure.com/nic-type"
+	// NodeNICPrivateIPsAnnotation is the annotation of the node reporting the comma-separated private IPs of all
+	// ip configurations of the primary network interface.
+	NodeNICPrivateIPsAnnotation = "kubernetes.azure.com/nic-private-ips"
+	// NodeOSImageSKUAnnotation is the annotation of the Windows node reporting the SKU of the OS image,
+	// e.g. 2022-datacenter-core-smalldisk.
+	NodeOSImageSKUAnnotation = "kubernetes.azure.com/os-image-sku"
+	// NodeLicenseTypeAnnotation is the annotation of the Windows node reporting the license type of the VM,
+	// e.g. Windows_Server for Azure Hybrid Benefit.
+	NodeLicenseTypeAnnotation = "kubernetes.azure.com/license-type"
+	// NodeEphemeralOSDiskAnnotation is the annotation of the Windows node reporting whether the OS disk is ephemeral.
+	NodeEphemeralOSDiskAnnotation = "kubernetes.azure.com/ephemeral-os-disk"
+	// NodeExcludedWhileDeallocatedAnnotation is the annotation of the node recording that the cloud provider has labeled
+	// the node with "node.kubernetes.io/exclude-from-external-load-balancers" because its VM is deallocated.
+	NodeExcludedWhileDeallocatedAnnotation = "kubernetes.azure.com/excluded-while-deallocated"
+	// NodeCIDRMaskSizeIPv4Label is the label of the nodes specifying the mask size of the IPv4 pod CIDR allocated by
+	// the cloud CIDR allocator, which takes precedence over the tag on the VMSS or VMAS of the node pool.
+	NodeCIDRMaskSizeIPv4Label = "kubernetes.azure.com/node-cidr-mask-size-ipv4"
+	// NodeCIDRMaskSizeIPv6Label is the label of the nodes specifying the mask size of the IPv6 pod CIDR allocated by
+	// the cloud CIDR allocator, which takes precedence over the tag on the VMSS or VMAS of the node pool.
+	NodeCIDRMaskSizeIPv6Label = "kubernetes.azure.com/node-cidr-mask-size-ipv6"
+	// NodeReservedPodCIDRsAnnotation is the annotation of the node recording the comma-separated pod CIDRs reserved by
+	// the cloud CIDR allocator before they are set on the node, so that they are kept after the allocator restarts.
+	NodeReservedPodCIDRsAnnotation = "kubernetes.azure.com/reserved-pod-cidrs"
 
 	// LabelFailureDomainBetaZone refer to https://github.com/kubernetes/api/blob/8519c5ea46199d57724725d5b969c5e8e0533692/core/v1/well_known_labels.go#L22-L23
 	LabelFailureDomainBetaZone = "failure-domain.beta.kubernetes.io/zone"
@@ -194,6 +239,20 @@ const (
 	BackoffJitterDefault = 1.0
 )
 
+// cloud capabilities
+const (
+	// NetworkResourceProvider is the namespace of the network resource provider
+	NetworkResourceProvider = "Microsoft.Network"
+	// LoadBalancerResourceType is the resource type of the load balancers in the network resource provider
+	LoadBalancerResourceType = "loadBalancers"
+	// IPBasedBackendPoolMinAPIVersion is the minimum network API version supporting IP-based backend pools
+	IPBasedBackendPoolMinAPIVersion = "2020-04-01"
+	// ProbeThresholdMinAPIVersion is the minimum network API version supporting the probeThreshold of health probes
+	ProbeThresholdMinAPIVersion = "2022-05-01"
+	// BackendAddressAdminStateMinAPIVersion is the minimum network API version supporting the adminState of backend addresses
+	BackendAddressAdminStateMinAPIVersion = "2023-04-01"
+)
+
 // IP family variables
 const (
 	IPVersionIPv6            bool   = true
@@ -236,11 +295,24 @@ const (
 	// ref: https://docs.microsoft.com/en-us/azure/azure-subscription-service-limits#load-balancer.
 	MaximumLoadBalancerRuleCount = 250
 
+	// MaximumLoadBalancerFrontendIPConfigurationCount is the maximum number of frontend IP configurations of a
+	// standard load balancer.
+	// ref: https://docs.microsoft.com/en-us/azure/azure-subscription-service-limits#load-balancer.
+	MaximumLoadBalancerFrontendIPConfigurationCount = 600
+
+	// BackendPoolUpdateMaxAttempts is the maximum number of attempts to update the addresses of a backend pool
+	// when it is changed concurrently by others.
+	BackendPoolUpdateMaxAttempts = 3
+
 	// LoadBalancerSkuBasic is the load balancer basic sku
 	LoadBalancerSkuBasic = "basic"
 	// LoadBalancerSkuStandard is the load balancer standard sku
 	LoadBalancerSkuStandard = "standard"
 
+	// IgnoredLoadBalancerClass is the spec.loadBalancerClass the service controller sees for the services without
+	// a class when they are ignored by the cloud provider.
+	IgnoredLoadBalancerClass = "kubernetes.azure.com/ignored-by-cloud-provider"
+
 	// ServiceAnnotationLoadBalancerInternal is the annotation used on the service
 	ServiceAnnotationLoadBalancerInternal = "service.beta.kubernetes.io/azure-load-balancer-internal"
 
@@ -248,6 +320,20 @@ const (
 	// to specify what subnet it is exposed on
 	ServiceAnnotationLoadBalancerInternalSubnet = "service.beta.kubernetes.io/azure-load-balancer-internal-subnet"
 
+	// ServiceAnnotationLoadBalancerInternalAndExternal is the annotation used on the service to expose it by both the
+	// internal and the external load balancers at the same time. The load balancing rules are created on both, and the
+	// IPs of both frontends are reported in the status of the service. The load balancer IP of the service only applies
+	// to the load balancer selected by ServiceAnnotationLoadBalancerInternal, the frontend of the other one is allocated
+	// automatically, e.g. in the subnet specified by ServiceAnnotationLoadBalancerInternalSubnet.
+	ServiceAnnotationLoadBalancerInternalAndExternal = "service.beta.kubernetes.io/azure-load-balancer-internal-and-external"
+
+	// ServiceAnnotationLoadBalancerInternalIPAllocation is the annotation used on the internal service
+	// to specify the subnet and the private IP of the frontend, in the form of "<subnet>/<ip>", or the
+	// subnet and the address range the private IP is allocated from, in the form of "<subnet>/<cidr>".
+	// The address is validated against the IP configurations of the subnet before the load balancer
+	// is updated. It cannot be used together with the loadBalancerIP of the service.
+	ServiceAnnotationLoadBalancerInternalIPAllocation = "service.beta.kubernetes.io/azure-load-balancer-internal-ip-allocation"
+
 	// ServiceAnnotationLoadBalancerMode is the annotation used on the service to specify
 	// which load balancer should be associated with the service. This is valid when using the basic
 	// sku load balancer, or it would be ignored.
@@ -315,15 +401,59 @@ const (
 	// `/` would be configured by default.
 	ServiceAnnotationLoadBalancerHealthProbeRequestPath = "service.beta.kubernetes.io/azure-load-balancer-health-probe-request-path"
 
+	// ServiceAnnotationLoadBalancerHealthProbeRequestHeaders determines the request headers of the load balancer health probe,
+	// in the format of `name1:value1,name2:value2`, e.g., `Host:example.com`. This is only useful for the HTTP and HTTPS.
+	// The headers are validated but not applied until the network API version in use supports them.
+	ServiceAnnotationLoadBalancerHealthProbeRequestHeaders = "service.beta.kubernetes.io/azure-load-balancer-health-probe-request-headers"
+
+	// ServiceAnnotationLoadBalancerHealthProbeExpectedStatusCodes determines the status codes regarded as healthy responses
+	// of the load balancer health probe, in the format of comma-separated codes or ranges, e.g., `200-299,301`. This is only
+	// useful for the HTTP and HTTPS. The status codes are validated but not applied until the network API version in use
+	// supports them.
+	ServiceAnnotationLoadBalancerHealthProbeExpectedStatusCodes = "service.beta.kubernetes.io/azure-load-balancer-health-probe-expected-status-codes"
+
+	// ServiceAnnotationLoadBalancerHealthProbeTarget points the health probes of all ports of a service with
+	// externalTrafficPolicy=Cluster to a node level health check endpoint instead of the service NodePorts,
+	// so that the nodes with broken kube-proxy are removed from rotation. The supported values are
+	// `kube-proxy` (HTTP probe on 10256/healthz), `<port>` (TCP probe on the node port) and `<port>/<path>`
+	// (HTTP probe on the node port and request path). It is ignored by services with externalTrafficPolicy=Local.
+	ServiceAnnotationLoadBalancerHealthProbeTarget = "service.beta.kubernetes.io/azure-load-balancer-health-probe-target"
+
+	// HealthProbeTargetKubeProxy is the value of ServiceAnnotationLoadBalancerHealthProbeTarget
+	// which points the health probes to the healthz endpoint of kube-proxy.
+	HealthProbeTargetKubeProxy = "kube-proxy"
+
 	// ServiceAnnotationAzurePIPTags determines what tags should be applied to the public IP of the service. The cluster name
 	// and service names tags (which is managed by controller manager itself) would keep unchanged. The supported format
 	// is `a=b,c=d,...`. After updated, the old user-assigned tags would not be replaced by the new ones.
 	ServiceAnnotationAzurePIPTags = "service.beta.kubernetes.io/azure-pip-tags"
 
+	// ServiceAnnotationAzureResourceTags determines what tags should be applied to the public IPs and the private link
+	// service created for the service. The supported format is `a=b,c=d,...`. Unlike ServiceAnnotationAzurePIPTags, the
+	// tags removed from the annotation are removed from the resources. The tags in ServiceAnnotationAzurePIPTags take
+	// precedence on the public IPs. The keys prefixed with `k8s-azure-` are reserved.
+	ServiceAnnotationAzureResourceTags = "service.beta.kubernetes.io/azure-resource-tags"
+
 	// ServiceAnnotationDisableLoadBalancerFloatingIP is the annotation used on the service to disable floating IP in load balancer rule.
 	// If omitted, the default value is false
 	ServiceAnnotationDisableLoadBalancerFloatingIP = "service.beta.kubernetes.io/azure-disable-load-balancer-floating-ip"
 
+	// ServiceAnnotationLoadBalancerTrafficDistribution mirrors spec.trafficDistribution of the service, which is not available in the
+	// Kubernetes API the provider is built with. If it is PreferClose and the pod IPs are in the backend pools, the new connections
+	// are sent to the pods in the zone of the zonal frontend IPs of the service, and the pods in other zones only receive new connections
+	// if there is no ready pod in that zone. The services with Topology Aware Routing, i.e., the annotation
+	// "service.kubernetes.io/topology-mode: Auto", are treated as PreferClose as well. Unlike kube-proxy, which routes the traffic by
+	// the zone of the client node and the hints of the EndpointSlices, the load balancer prefers the zone of the frontend IPs regardless
+	// of the hints, and the pods in other zones are drained, or removed if the admin state of the backend addresses is not supported by
+	// the target cloud. It is only supported with the backend pool type podIP, and is ignored with a warning event otherwise.
+	ServiceAnnotationLoadBalancerTrafficDistribution = "service.beta.kubernetes.io/azure-load-balancer-traffic-distribution"
+
+	// TrafficDistributionPreferClose is the traffic distribution preferring the backends topologically close to the clients.
+	TrafficDistributionPreferClose = "PreferClose"
+
+	// TopologyModeAuto is the value of the annotation "service.kubernetes.io/topology-mode" enabling Topology Aware Routing.
+	TopologyModeAuto = "Auto"
+
 	// ServiceAnnotationAdditionalPublicIPs sets the additional Public IPs (split by comma) besides the service's Public IP configured on LoadBalancer.
 	// These additional Public IPs would be consumed by kube-proxy to configure the iptables rules on each node. Note they would not be configured
 	// automatically on Azure LoadBalancer. Instead, they need to be configured manually (e.g. on Azure cross-region LoadBalancer by another operator).
@@ -336,6 +466,58 @@ const (
 	// ServiceAnnotationDisableTCPReset is the annotation used on the service to disable TCP reset on the load balancer.
 	ServiceAnnotationDisableTCPReset = "service.beta.kubernetes.io/azure-load-balancer-disable-tcp-reset"
 
+	// ServiceAnnotationLoadBalancerSessionPersistence is the annotation used on the service to specify the session
+	// persistence (distribution mode) of the load balancing rules, which can be None, ClientIP or ClientIPProtocol.
+	// It takes priority over spec.sessionAffinity, and can be overridden by the port annotation
+	// "service.beta.kubernetes.io/port_{port}_session_persistence".
+	ServiceAnnotationLoadBalancerSessionPersistence = "service.beta.kubernetes.io/azure-load-balancer-session-persistence"
+
+	// ServiceAnnotationLoadBalancerCombineProtocols is the annotation used on the service to combine the TCP and UDP
+	// ports with the same port number into one load balancing rule with protocol All. It is only supported by standard
+	// load balancers. The ports are not combined if their backend ports are different, e.g. when the floating IP is
+	// disabled and the node ports are different.
+	ServiceAnnotationLoadBalancerCombineProtocols = "service.beta.kubernetes.io/azure-load-balancer-combine-protocols"
+
+	// ServiceAnnotationLoadBalancerAdoptExistingRules is the annotation used on the service to take ownership of the
+	// load balancing rules created out-of-band on the frontend IP configuration and ports of the service, together with
+	// the health probes only referenced by them. They are replaced by the rules and probes of the service instead of
+	// being reported as conflicts. The rules on the frontend IP configurations of the service which do not carry the
+	// ownership marker in their names are pruned as well once they are no longer expected. The rules owned by other
+	// services are never adopted.
+	ServiceAnnotationLoadBalancerAdoptExistingRules = "service.beta.kubernetes.io/azure-load-balancer-adopt-existing-rules"
+
+	// ServiceAnnotationRetainPublicIP is the annotation used on the service to keep the managed public IP when it
+	// would be released, e.g. when the service is deleted. The service is removed from the tags of the retained public
+	// IP, so that it can be referenced by name by other services later.
+	ServiceAnnotationRetainPublicIP = "service.beta.kubernetes.io/azure-retain-public-ip"
+
+	// ServiceAnnotationPIPZoneRedundant is the annotation used on the service to move the managed public IP to the
+	// availability zones of the region after the region gains zones. The zones of an existing public IP cannot be
+	// updated, so a zone-redundant public IP suffixed with ZoneRedundantPublicIPNameSuffix is created, the frontend
+	// of the service is switched to it, and the regional public IP is released afterwards. The IP of the service
+	// changes. Only works with the standard load balancer.
+	ServiceAnnotationPIPZoneRedundant = "service.beta.kubernetes.io/azure-pip-zone-redundant"
+
+	// ZoneRedundantPublicIPNameSuffix is the suffix of the name of the zone-redundant public IP replacing the regional
+	// managed public IP of the service.
+	ZoneRedundantPublicIPNameSuffix = "-zr"
+
+	// ServiceAnnotationPIPTagSelector is the annotation used on the service to select a free pre-created public IP
+	// from a pool by tags, e.g. `pool=web,env=prod`. The pool is the resource group of the public IPs of the service.
+	// A public IP is free if it is not tagged with any service. The selected public IP is tagged with the service
+	// while in use, and is returned to the pool instead of being deleted when it is released. It is ignored if
+	// the public IP name or the load balancer IP of the service is specified.
+	ServiceAnnotationPIPTagSelector = "service.beta.kubernetes.io/azure-pip-tag-selector"
+
+	// ServiceAnnotationLoadBalancerAdditionalFrontends is the annotation used on the external service to request
+	// additional IPv4 frontend IP configurations, each with its own managed public IP, besides the one of each IP
+	// family. The load balancing rules of the service are duplicated across them with identical port mappings, and
+	// all the IPs are reported in the status of the service. The floating IP must be enabled, and the value is an
+	// integer between 0 and MaxAdditionalFrontends.
+	ServiceAnnotationLoadBalancerAdditionalFrontends = "service.beta.kubernetes.io/azure-load-balancer-additional-frontends"
+	// MaxAdditionalFrontends is the max number of additional frontend IP configurations of a service.
+	MaxAdditionalFrontends = 10
+
 	// ServiceTagKey is the service key applied for public IP tags.
 	ServiceTagKey       = "k8s-azure-service"
 	LegacyServiceTagKey = "service"
@@ -345,6 +527,21 @@ const (
 	// ServiceUsingDNSKey is the service name consuming the DNS label on the public IP
 	ServiceUsingDNSKey       = "k8s-azure-dns-label-service"
 	LegacyServiceUsingDNSKey = "kubernetes-dns-label-service"
+	// ServiceResourceTagsKey records the keys of the tags applied by ServiceAnnotationAzureResourceTags, so that
+	// the tags removed from the annotation can be removed from the resource. The keys not fitting in the value of one
+	// tag are continued in the tags with the suffixes -1, -2, etc.
+	ServiceResourceTagsKey = "k8s-azure-service-resource-tags"
+	// ClaimedFromPoolTagKey marks the public IP selected from a pool by ServiceAnnotationPIPTagSelector, so that it
+	// is returned to the pool instead of being deleted even if the selector of the service is changed.
+	ClaimedFromPoolTagKey = "k8s-azure-claimed-from-pool"
+	// ReservedTagKeyPrefix is the prefix of the tag keys managed by the cloud provider.
+	ReservedTagKeyPrefix = "k8s-azure-"
+	// MaxTagsPerResource is the max number of tags of an Azure resource
+	MaxTagsPerResource = 50
+	// TagKeyMaxLength is the max length of the tag keys
+	TagKeyMaxLength = 512
+	// TagValueMaxLength is the max length of the tag values
+	TagValueMaxLength = 256
 
 	// DefaultLoadBalancerSourceRanges is the default value of the load balancer source ranges
 	DefaultLoadBalancerSourceRanges = "0.0.0.0/0"
@@ -356,6 +553,17 @@ const (
 	LoadBalancerMinimumPriority = 500
 	// LoadBalancerMaximumPriority is the maximum priority
 	LoadBalancerMaximumPriority = 4096
+	// AzureLoadBalancerServiceTag is the service tag of the source addresses of the load balancer health probes
+	AzureLoadBalancerServiceTag = "AzureLoadBalancer"
+	// VirtualNetworkServiceTag is the service tag of the address space of the virtual network
+	VirtualNetworkServiceTag = "VirtualNetwork"
+
+	// NodePortSecurityRuleNamePrefix is the name prefix of the security rules of the node port range.
+	NodePortSecurityRuleNamePrefix = "k8s-azure-nodeport-"
+	// DefaultNodePortRange is the default node port range of the cluster.
+	DefaultNodePortRange = "30000-32767"
+	// DefaultNodePortSecurityRulePriority is the default priority of the first security rule of the node port range.
+	DefaultNodePortSecurityRulePriority = 4000
 
 	// FrontendIPConfigIDTemplate is the template of the frontend IP configuration
 	FrontendIPConfigIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/frontendIPConfigurations/%s"
@@ -363,9 +571,27 @@ const (
 	BackendPoolIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/backendAddressPools/%s"
 	// LoadBalancerProbeIDTemplate is the template of the load balancer probe
 	LoadBalancerProbeIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/probes/%s"
+	// RouteTableIDTemplate is the template of the route table
+	RouteTableIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/routeTables/%s"
 
 	// InternalLoadBalancerNameSuffix is load balancer suffix
 	InternalLoadBalancerNameSuffix = "-internal"
+	// OutboundNameInfix is the infix between the load balancer name and the names of the outbound rules managed
+	// by the cloud provider, which are also the names of their frontend IP configurations
+	OutboundNameInfix = "-outbound-"
+	// IPv6OutboundNameSuffix is the suffix of the names of the public IP, the frontend IP configuration and
+	// the outbound rule for the IPv6 outbound connectivity of a load balancer
+	IPv6OutboundNameSuffix = OutboundNameInfix + "IPv6"
+	// DefaultIPv6OutboundIdleTimeoutInMinutes is the default idle timeout of the IPv6 outbound rules
+	DefaultIPv6OutboundIdleTimeoutInMinutes = 4
+	// NodePoolOutboundAdditionalNameInfix is the infix between the name of a node pool outbound rule and the index of
+	// the frontend IP configurations of its additional public IP prefixes
+	NodePoolOutboundAdditionalNameInfix = "-additional-"
+
+	// OutboundTypeLoadBalancer means the outbound traffic of the nodes is handled by the load balancer
+	OutboundTypeLoadBalancer = "loadBalancer"
+	// OutboundTypeNATGateway means the outbound traffic of the nodes is handled by the NAT gateway of the subnet
+	OutboundTypeNATGateway = "natGateway"
 
 	// FrontendIPConfigNameMaxLength is the max length of the frontend IP configuration
 	FrontendIPConfigNameMaxLength = 80
@@ -373,13 +599,50 @@ const (
 	LoadBalancerRuleNameMaxLength = 80
 	// IPFamilySuffixLength is the length of suffix length of IP family ("-IPv4", "-IPv6")
 	IPFamilySuffixLength = 5
+	// BackendPoolNameMaxLength is the max length of the load balancer backend pool
+	BackendPoolNameMaxLength = 80
+
+	// ResourceNamingModeCompatible keeps the names of the load balancer sub-resources
+	// the same as the previous versions. Long names may be truncated without a hash suffix.
+	ResourceNamingModeCompatible = "compatible"
+	// ResourceNamingModeHashed truncates the names of the load balancer sub-resources
+	// exceeding the length limit and appends a hash suffix of the full name to avoid collisions.
+	ResourceNamingModeHashed = "hashed"
+
+	// LocalServiceBackendPoolNameTemplateNamespace is the placeholder of the service namespace
+	// in the name template of the dedicated backend pools of local services
+	LocalServiceBackendPoolNameTemplateNamespace = "{namespace}"
+	// LocalServiceBackendPoolNameTemplateName is the placeholder of the service name
+	// in the name template of the dedicated backend pools of local services
+	LocalServiceBackendPoolNameTemplateName = "{name}"
+	// LocalServiceBackendPoolNameTemplateHash is the placeholder of the hash of the namespaced
+	// service name in the name template of the dedicated backend pools of local services
+	LocalServiceBackendPoolNameTemplateHash = "{hash}"
+	// DefaultLocalServiceBackendPoolNameTemplate is the default name template of the dedicated backend pools of local services
+	DefaultLocalServiceBackendPoolNameTemplate = LocalServiceBackendPoolNameTemplateNamespace + "-" + LocalServiceBackendPoolNameTemplateName
+
+	// TagTemplateResourcePublicIPAddress is the resource type of the tag templates of the public IPs
+	TagTemplateResourcePublicIPAddress = "publicIPAddress"
+	// TagTemplateResourceLoadBalancer is the resource type of the tag templates of the load balancers
+	TagTemplateResourceLoadBalancer = "loadBalancer"
+	// TagTemplateResourcePrivateLinkService is the resource type of the tag templates of the private link services
+	TagTemplateResourcePrivateLinkService = "privateLinkService"
+	// TagTemplateResourceRouteTable is the resource type of the tag templates of the route table
+	TagTemplateResourceRouteTable = "routeTable"
+	// TagTemplateClusterName is the placeholder of the cluster name in the tag templates
+	TagTemplateClusterName = "{clusterName}"
+	// TagTemplateServiceNamespace is the placeholder of the service namespace in the tag templates
+	TagTemplateServiceNamespace = "{serviceNamespace}"
+	// TagTemplateServiceName is the placeholder of the service name in the tag templates
+	TagTemplateServiceName = "{serviceName}"
+	// TagTemplateNodePool is the placeholder of the primary VMSet of the load balancer in the tag templates
+	TagTemplateNodePool = "{nodePool}"
 
 	// LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration is the lb backend pool config type node IP configuration
 	LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration = "nodeIPConfiguration"
 	// LoadBalancerBackendPoolConfigurationTypeNodeIP is the lb backend pool config type node ip
 	LoadBalancerBackendPoolConfigurationTypeNodeIP = "nodeIP"
 	// LoadBalancerBackendPoolConfigurationTypePODIP is the lb backend pool config type pod ip
-	// TODO (nilo19): support pod IP in the future
 	LoadBalancerBackendPoolConfigurationTypePODIP = "podIP"
 )
 
@@ -445,6 +708,67 @@ const (
 	DefaultCloudProviderConfigSecKey       = "cloud-config"
 )
 
+// in-flight long-running operations
+const (
+	// AsyncOperationsConfigMapName is the name of the configmap persisting the in-flight long-running operations.
+	AsyncOperationsConfigMapName = "cloud-provider-azure-async-operations"
+	// AsyncOperationsConfigMapNamespace is the namespace of the configmap persisting the in-flight long-running operations.
+	AsyncOperationsConfigMapNamespace = "kube-system"
+	// AsyncOperationsConfigMapKey is the key of the in-flight long-running operations in the configmap.
+	AsyncOperationsConfigMapKey = "operations"
+)
+
+// backend pool snapshot
+const (
+	// BackendPoolSnapshotConfigMapName is the name of the configmap mirroring the membership of the backend pools.
+	BackendPoolSnapshotConfigMapName = "cloud-provider-azure-backend-pools"
+	// BackendPoolSnapshotConfigMapNamespace is the namespace of the configmap mirroring the membership of the backend pools.
+	BackendPoolSnapshotConfigMapNamespace = "kube-system"
+)
+
+// load balancer desired states
+const (
+	// LoadBalancerDesiredStateConfigMapName is the name of the configmap persisting the desired states of the services
+	// reconciled last time, keyed by <namespace>.<name> of the services.
+	LoadBalancerDesiredStateConfigMapName = "cloud-provider-azure-desired-states"
+	// LoadBalancerDesiredStateConfigMapNamespace is the namespace of the configmap persisting the desired states of the services.
+	LoadBalancerDesiredStateConfigMapNamespace = "kube-system"
+)
+
+// security logging
+const (
+	// SecurityLoggingDiagnosticSettingNameDefault is the default name of the diagnostic settings of the managed
+	// load balancers and security groups.
+	SecurityLoggingDiagnosticSettingNameDefault = "cloud-provider-azure"
+	// SecurityLoggingNetworkWatcherResourceGroupDefault is the default resource group of the network watcher, which
+	// is the resource group Azure creates the network watchers in.
+	SecurityLoggingNetworkWatcherResourceGroupDefault = "NetworkWatcherRG"
+	// SecurityLoggingFlowLogNameTemplate is the name of the flow log of a security group, which is the one given by
+	// the Azure portal, i.e. "<securityGroupName>-<resourceGroupName>-flowlog".
+	SecurityLoggingFlowLogNameTemplate = "%s-%s-flowlog"
+	// SecurityLoggingAllLogsCategoryGroup is the category group of all the logs of a resource.
+	SecurityLoggingAllLogsCategoryGroup = "allLogs"
+	// SecurityLoggingAllMetricsCategory is the category of all the metrics of a resource.
+	SecurityLoggingAllMetricsCategory = "AllMetrics"
+)
+
+// custom resources
+const (
+	// CustomResourceGroup is the API group of the custom resources read by the cloud provider.
+	CustomResourceGroup = "cloud-provider-azure.sigs.k8s.io"
+	// CustomResourceVersion is the API version of the custom resources read by the cloud provider.
+	CustomResourceVersion = "v1alpha1"
+	// MultipleStandardLoadBalancerConfigurationResource is the plural resource name of the MultipleStandardLoadBalancerConfiguration custom resources.
+	MultipleStandardLoadBalancerConfigurationResource = "multiplestandardloadbalancerconfigurations"
+	// AzureLoadBalancerConfigurationResource is the plural resource name of the AzureLoadBalancerConfiguration custom resources.
+	AzureLoadBalancerConfigurationResource = "azureloadbalancerconfigurations"
+
+	// ServiceAnnotationAzureLoadBalancerConfigurationName is the name of the AzureLoadBalancerConfiguration custom
+	// resource in the namespace of the service configuring its load balancer with typed fields instead of annotations.
+	// The fields are converted to the equivalent annotations, which cannot be set on the service at the same time.
+	ServiceAnnotationAzureLoadBalancerConfigurationName = "service.beta.kubernetes.io/azure-load-balancer-configuration-name"
+)
+
 // RateLimited error string
 const RateLimited = "rate limited"
 
@@ -457,10 +781,30 @@ const (
 	PortAnnotationNoLBRule      PortParams = "no_lb_rule"
 	// NoHealthProbeRule determines whether the port is only used for health probe. no lb probe rule will be created.
 	PortAnnotationNoHealthProbeRule PortParams = "no_probe_rule"
+	// PortAnnotationSessionPersistence determines the session persistence of the load balancing rule of the port.
+	PortAnnotationSessionPersistence PortParams = "session_persistence"
+	// PortAnnotationHealthProbeManagementPort replaces the health probe of the load balancing rule of the port with a
+	// TCP probe on the given port of the nodes, e.g., the management port of network virtual appliances.
+	// It cannot be used together with no_probe_rule or the health probe port annotation of the same port.
+	PortAnnotationHealthProbeManagementPort PortParams = "health_probe_management_port"
+	// PortAnnotationFrontendPort exposes the port on the given frontend port of the load balancer instead of the
+	// service port, e.g., to serve a well-known external port different from the port in the service spec. The
+	// traffic still reaches the backends on the service port, or the node port if the floating IP is disabled.
+	PortAnnotationFrontendPort PortParams = "frontend_port"
 )
 
 type PortParams string
 
+// session persistence
+const (
+	// SessionPersistenceNone distributes the traffic by the 5-tuple of the connections.
+	SessionPersistenceNone = "None"
+	// SessionPersistenceClientIP distributes the traffic from the same client IP to the same backend.
+	SessionPersistenceClientIP = "ClientIP"
+	// SessionPersistenceClientIPProtocol distributes the traffic from the same client IP and protocol to the same backend.
+	SessionPersistenceClientIPProtocol = "ClientIPProtocol"
+)
+
 // health probe
 const (
 	HealthProbeAnnotationPrefixPattern = "health-probe_%s"
@@ -490,6 +834,14 @@ const (
 	// `/healthz` would be configured by default.
 	HealthProbeParamsRequestPath  HealthProbeParams = "request-path"
 	HealthProbeDefaultRequestPath string            = "/healthz"
+
+	// HealthProbeParamsRequestHeaders determines the request headers of the load balancer health probe.
+	// The format is the same as ServiceAnnotationLoadBalancerHealthProbeRequestHeaders.
+	HealthProbeParamsRequestHeaders HealthProbeParams = "request-headers"
+
+	// HealthProbeParamsExpectedStatusCodes determines the expected status codes of the load balancer health probe.
+	// The format is the same as ServiceAnnotationLoadBalancerHealthProbeExpectedStatusCodes.
+	HealthProbeParamsExpectedStatusCodes HealthProbeParams = "expected-status-codes"
 )
 
 type HealthProbeParams string
@@ -517,6 +869,8 @@ const (
 	ServiceAnnotationPLSFqdns = "service.beta.kubernetes.io/azure-pls-fqdns"
 
 	// ServiceAnnotationPLSProxyProtocol determines whether TCP Proxy protocol needs to be enabled on the PLS.
+	// The proxy protocol v2 header carrying the client IP is only added to the connections through the PLS, so the
+	// HTTP and HTTPS health probes sent to the ports serving the traffic are replaced by TCP probes.
 	ServiceAnnotationPLSProxyProtocol = "service.beta.kubernetes.io/azure-pls-proxy-protocol"
 
 	// ServiceAnnotationPLSVisibility determines a space separated list of Azure subscription IDs for which the PLS is visible.
@@ -527,6 +881,12 @@ const (
 	// automatically approved, only works when visibility is set to "*".
 	ServiceAnnotationPLSAutoApproval = "service.beta.kubernetes.io/azure-pls-auto-approval"
 
+	// ServiceAnnotationPLSConfig configures the PLS with a JSON object, e.g.,
+	// {"visibility":["*"],"autoApproval":["sub1"],"natSubnet":"pls-subnet","natIPAddressCount":2,"natIPAddresses":["10.0.0.4"],"fqdns":["pls.example.com"]}.
+	// The visibility, auto-approval and fqdns of the PLS are only reconciled if they are set in the object or by their own annotations,
+	// so that the manual changes to the other fields are kept. A field cannot be set both in the object and by its own annotation.
+	ServiceAnnotationPLSConfig = "service.beta.kubernetes.io/azure-pls-config"
+
 	// ID string used to create a not existing PLS placehold in plsCache to avoid redundant
 	PrivateLinkServiceNotExistID = "PrivateLinkServiceNotExistID"
 
@@ -540,8 +900,52 @@ const (
 	PLSDefaultNumOfIPConfig = 1
 )
 
+// application gateway
+const (
+	// ServiceAnnotationApplicationGateway determines whether the service is exposed by HTTP listeners of the
+	// Application Gateway set by applicationGatewayName in the cloud config instead of load balancer rules.
+	ServiceAnnotationApplicationGateway = "service.beta.kubernetes.io/azure-application-gateway"
+
+	// ServiceAnnotationApplicationGatewayHostName determines the host name of the HTTP listeners of the service,
+	// which allows the services to share the frontend ports of the Application Gateway.
+	ServiceAnnotationApplicationGatewayHostName = "service.beta.kubernetes.io/azure-application-gateway-host-name"
+
+	// ApplicationGatewayFrontendPortPrefix is the name prefix of the frontend ports added by the cloud provider.
+	ApplicationGatewayFrontendPortPrefix = "k8s-port-"
+)
+
+// azure firewall
+const (
+	// ServiceAnnotationAzureFirewallDNAT determines whether the service is exposed publicly by the DNAT rules of the
+	// Azure Firewall set by azureFirewallName in the cloud config, which translate the traffic to the public IP of the
+	// firewall to the frontend of the service on the internal load balancer.
+	ServiceAnnotationAzureFirewallDNAT = "service.beta.kubernetes.io/azure-firewall-dnat"
+
+	// ServiceAnnotationAzureFirewallPublicIPName determines the name of the public IP of the Azure Firewall the DNAT
+	// rules of the service are created on. If not set, the public IP of the first IP configuration of the firewall is used.
+	ServiceAnnotationAzureFirewallPublicIPName = "service.beta.kubernetes.io/azure-firewall-public-ip-name"
+
+	// AzureFirewallNATRuleCollectionPrefix is the name prefix of the NAT rule collection managed by the cloud provider,
+	// which is followed by the cluster name.
+	AzureFirewallNATRuleCollectionPrefix = "k8s-dnat-"
+
+	// AzureFirewallNATRuleCollectionPriorityDefault is the default priority of the NAT rule collection managed by the cloud provider.
+	AzureFirewallNATRuleCollectionPriorityDefault = 1000
+)
+
 const (
 	VMSSTagForBatchOperation = "aks-managed-coordination"
+
+	// DefaultVMSSVMUpdateChunkSize is the default max number of VMSS VMs updated in one chunk.
+	DefaultVMSSVMUpdateChunkSize = 100
+	// DefaultVMSSVMUpdateChunkConcurrency is the default number of VMSS VM chunks updated in parallel.
+	// The VMs of a chunk are already updated in parallel by PutVMSSVMBatchSize.
+	DefaultVMSSVMUpdateChunkConcurrency = 1
+	// DefaultHostUpdateConcurrency is the default number of hosts of an availability set or a VMSS Flex
+	// updated in parallel when ensuring them in a backend pool.
+	DefaultHostUpdateConcurrency = 10
+	// DefaultVMSSConvergenceIntervalInSeconds is the default interval for retrying the unconverged VMSS VMs.
+	DefaultVMSSConvergenceIntervalInSeconds = 60
 )
 
 type LoadBalancerBackendPoolUpdateOperation string
@@ -549,8 +953,64 @@ type LoadBalancerBackendPoolUpdateOperation string
 const (
 	LoadBalancerBackendPoolUpdateOperationAdd    LoadBalancerBackendPoolUpdateOperation = "add"
 	LoadBalancerBackendPoolUpdateOperationRemove LoadBalancerBackendPoolUpdateOperation = "remove"
+	LoadBalancerBackendPoolUpdateOperationDrain  LoadBalancerBackendPoolUpdateOperation = "drain"
 
 	DefaultLoadBalancerBackendPoolUpdateIntervalInSeconds = 30
+	DefaultLoadBalancerBackendPoolRepairIntervalInSeconds = 300
+
+	DefaultAvailabilitySetNICReconcileIntervalInSeconds = 600
+
+	// DefaultNodeAddressCacheTTLInSeconds is the default TTL of the addresses of the nodes returned by NodeAddresses.
+	DefaultNodeAddressCacheTTLInSeconds = 60
+
+	// DefaultInstanceNotFoundConsecutiveChecks is the default number of consecutive checks not finding the VM of a node
+	// before the VM is declared missing.
+	DefaultInstanceNotFoundConsecutiveChecks = 3
+	// DefaultInstanceNotFoundGracePeriodInSeconds is the default minimum time between the first check not finding the
+	// VM of a node and the VM being declared missing.
+	DefaultInstanceNotFoundGracePeriodInSeconds = 300
+	// DefaultDegradedModeProbeIntervalInSeconds is the default interval of probing ARM for the degraded mode.
+	DefaultDegradedModeProbeIntervalInSeconds = 30
+	// DefaultDegradedModeFailureThreshold is the default number of consecutive failed probes of ARM entering the
+	// degraded mode.
+	DefaultDegradedModeFailureThreshold = 3
+	// DefaultDegradedModeRecoveryThreshold is the default number of consecutive successful probes of ARM leaving the
+	// degraded mode.
+	DefaultDegradedModeRecoveryThreshold = 2
+	// DefaultDegradedModeMaxBackoffInSeconds is the default maximum interval of probing ARM in the degraded mode.
+	DefaultDegradedModeMaxBackoffInSeconds = 300
+	// DefaultInstancesWebhookTimeoutInSeconds is the default timeout of the calls to the instances webhook.
+	DefaultInstancesWebhookTimeoutInSeconds = 5
+	// DefaultServiceIPChangeWebhookTimeoutInSeconds is the default timeout of the requests to the webhook notified of
+	// the changes of the external IPs of the services.
+	DefaultServiceIPChangeWebhookTimeoutInSeconds = 5
+	// ServiceExternalIPsChangedEventReason is the reason of the events recorded on the services when their external
+	// IPs change, which is watched by the automation outside the cluster.
+	ServiceExternalIPsChangedEventReason = "ServiceExternalIPsChanged"
+
+	// DefaultNodePortSecurityRulesReconcileIntervalInSeconds is the default interval for reconciling the security
+	// rules of the node port range.
+	DefaultNodePortSecurityRulesReconcileIntervalInSeconds = 300
+
+	// DefaultLoadBalancerNodeExclusionReconcileIntervalInSeconds is the default interval for removing the nodes
+	// newly excluded by loadBalancerNodeExclusion from the backend pools.
+	DefaultLoadBalancerNodeExclusionReconcileIntervalInSeconds = 30
+
+	// DefaultLoadBalancerDriftVerificationIntervalInSeconds is the default interval for verifying the load balancers
+	// of the services in the read-only mode.
+	DefaultLoadBalancerDriftVerificationIntervalInSeconds = 300
+
+	// DefaultSNATExhaustionAdvisorIntervalInSeconds is the default interval for checking the SNAT port utilization of
+	// the node pools.
+	DefaultSNATExhaustionAdvisorIntervalInSeconds = 300
+	// DefaultSNATExhaustionUtilizationThresholdPercent is the default percentage of the allocated SNAT ports used by
+	// a node, above which its node pool is approaching SNAT exhaustion.
+	DefaultSNATExhaustionUtilizationThresholdPercent = 80
+	// SNATPortExhaustionEventReason is the reason of the events recorded on the nodes approaching SNAT exhaustion.
+	SNATPortExhaustionEventReason = "SNATPortExhaustion"
+	// SNATPortExhaustionMitigatedEventReason is the reason of the events recorded on the nodes whose SNAT exhaustion
+	// is mitigated by scaling the allocated outbound ports or attaching an additional public IP prefix.
+	SNATPortExhaustionMitigatedEventReason = "SNATPortExhaustionMitigated"
 
 	ServiceNameLabel = "kubernetes.io/service-name"
 )
@@ -35,11 +35,26 @@ func IsK8sServiceUsingInternalLoadBalancer(service *v1.Service) bool {
 	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationLoadBalancerInternal, TrueAnnotationValue)
 }
 
+// IsK8sServiceInternalAndExternal return if service is exposed by both the internal and the external load balancers.
+func IsK8sServiceInternalAndExternal(service *v1.Service) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationLoadBalancerInternalAndExternal, TrueAnnotationValue)
+}
+
 // IsK8sServiceDisableLoadBalancerFloatingIP return if floating IP in load balancer is disabled in kubernetes service annotations
 func IsK8sServiceDisableLoadBalancerFloatingIP(service *v1.Service) bool {
 	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationDisableLoadBalancerFloatingIP, TrueAnnotationValue)
 }
 
+// IsK8sServiceTrafficDistributionPreferClose returns true if the traffic distribution of the service is PreferClose,
+// or if Topology Aware Routing is enabled for the service
+func IsK8sServiceTrafficDistributionPreferClose(service *v1.Service) bool {
+	if _, found := service.Annotations[ServiceAnnotationLoadBalancerTrafficDistribution]; found {
+		return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationLoadBalancerTrafficDistribution, TrafficDistributionPreferClose)
+	}
+	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, v1.AnnotationTopologyMode, TopologyModeAuto) ||
+		expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, v1.DeprecatedAnnotationTopologyAwareHints, TopologyModeAuto)
+}
+
 // GetHealthProbeConfigOfPortFromK8sSvcAnnotation get health probe configuration for port
 func GetHealthProbeConfigOfPortFromK8sSvcAnnotation(annotations map[string]string, port int32, key HealthProbeParams, validators ...BusinessValidator) (*string, error) {
 	return GetAttributeValueInSvcAnnotation(annotations, BuildHealthProbeAnnotationKeyForPort(port, key), validators...)
@@ -65,11 +80,41 @@ func IsPLSEnabled(annotations map[string]string) bool {
 	return expectAttributeInSvcAnnotationBeEqualTo(annotations, ServiceAnnotationPLSCreation, TrueAnnotationValue)
 }
 
+// IsApplicationGatewayEnabled return true if ServiceAnnotationApplicationGateway is true
+func IsApplicationGatewayEnabled(annotations map[string]string) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(annotations, ServiceAnnotationApplicationGateway, TrueAnnotationValue)
+}
+
+// IsAzureFirewallDNATEnabled return true if ServiceAnnotationAzureFirewallDNAT is true
+func IsAzureFirewallDNATEnabled(annotations map[string]string) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(annotations, ServiceAnnotationAzureFirewallDNAT, TrueAnnotationValue)
+}
+
 // IsTCPResetDisabled return true if ServiceAnnotationDisableTCPReset is true
 func IsTCPResetDisabled(annotations map[string]string) bool {
 	return expectAttributeInSvcAnnotationBeEqualTo(annotations, ServiceAnnotationDisableTCPReset, TrueAnnotationValue)
 }
 
+// IsLBRuleAdoptionEnabled return true if ServiceAnnotationLoadBalancerAdoptExistingRules is true
+func IsLBRuleAdoptionEnabled(annotations map[string]string) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(annotations, ServiceAnnotationLoadBalancerAdoptExistingRules, TrueAnnotationValue)
+}
+
+// IsPublicIPRetained return true if ServiceAnnotationRetainPublicIP is true
+func IsPublicIPRetained(annotations map[string]string) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(annotations, ServiceAnnotationRetainPublicIP, TrueAnnotationValue)
+}
+
+// IsPIPZoneRedundant return true if ServiceAnnotationPIPZoneRedundant is true
+func IsPIPZoneRedundant(annotations map[string]string) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(annotations, ServiceAnnotationPIPZoneRedundant, TrueAnnotationValue)
+}
+
+// IsLBRuleProtocolCombinationEnabled return true if ServiceAnnotationLoadBalancerCombineProtocols is true
+func IsLBRuleProtocolCombinationEnabled(annotations map[string]string) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(annotations, ServiceAnnotationLoadBalancerCombineProtocols, TrueAnnotationValue)
+}
+
 // Getint32ValueFromK8sSvcAnnotation get health probe configuration for port
 func Getint32ValueFromK8sSvcAnnotation(annotations map[string]string, key string, validators ...Int32BusinessValidator) (*int32, error) {
 	val, err := GetAttributeValueInSvcAnnotation(annotations, key)
@@ -145,6 +145,48 @@ func TestIsK8sServiceUsingInternalLoadBalancer(t *testing.T) {
 	}
 }
 
+func TestIsK8sServiceTrafficDistributionPreferClose(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{
+		{
+			name:        "traffic distribution is PreferClose",
+			annotations: map[string]string{ServiceAnnotationLoadBalancerTrafficDistribution: TrafficDistributionPreferClose},
+			want:        true,
+		},
+		{
+			name:        "topology aware routing is enabled",
+			annotations: map[string]string{v1.AnnotationTopologyMode: TopologyModeAuto},
+			want:        true,
+		},
+		{
+			name:        "deprecated topology aware hints are enabled",
+			annotations: map[string]string{v1.DeprecatedAnnotationTopologyAwareHints: "auto"},
+			want:        true,
+		},
+		{
+			name: "traffic distribution overrides topology aware routing",
+			annotations: map[string]string{
+				ServiceAnnotationLoadBalancerTrafficDistribution: "Default",
+				v1.AnnotationTopologyMode:                        TopologyModeAuto,
+			},
+		},
+		{
+			name: "nothing is set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if got := IsK8sServiceTrafficDistributionPreferClose(service); got != tt.want {
+				t.Errorf("IsK8sServiceTrafficDistributionPreferClose() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetHealthProbeConfigOfPortFromK8sSvcAnnotation(t *testing.T) {
 	type args struct {
 		annotations map[string]string
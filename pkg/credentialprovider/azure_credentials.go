@@ -81,7 +81,7 @@ func newAcrProviderFromConfigReader(configReader io.Reader) (*acrProvider, error
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	servicePrincipalToken, err := providerconfig.GetServicePrincipalToken(config, env, env.ServiceManagementEndpoint)
+	servicePrincipalToken, err := providerconfig.GetServicePrincipalToken(config, env, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create service principal token: %w", err)
 	}
@@ -38,8 +38,68 @@ var (
 
 	apiMetrics       = registerAPIMetrics(metricLabels...)
 	operationMetrics = registerOperationMetrics(metricLabels...)
+
+	backendPoolRepairMetrics = registerBackendPoolRepairMetrics()
+
+	backendPoolMembershipMetrics = registerBackendPoolMembershipMetrics()
+
+	vmssUnconvergedInstances = registerVMSSConvergenceMetrics()
+
+	loadBalancerRuleBackends = registerLoadBalancerBackendHealthMetrics()
+
+	rateLimiterMetrics = registerRateLimiterMetrics()
+
+	loadBalancerDriftedServices = registerLoadBalancerDriftMetrics()
+
+	serviceAzureResourceMetrics = registerServiceCostAttributionMetrics()
+
+	clientCertificateAge = registerClientCertificateMetrics()
+
+	serviceLoadBalancerMetrics = registerServiceLoadBalancerMetrics()
+
+	nodePoolSNATMetrics = registerNodePoolSNATMetrics()
+
+	degradedModeMetrics = registerDegradedModeMetrics()
 )
 
+// ServiceAzureResources is the Azure networking resources consumed by a LoadBalancer service.
+type ServiceAzureResources struct {
+	Namespace    string
+	Name         string
+	LoadBalancer string
+	// PublicIPIDs are the IDs of the public IPs on the frontend of the service.
+	PublicIPIDs []string
+	// PrivateLinkServiceIDs are the IDs of the private link services attached to the frontend of the service.
+	PrivateLinkServiceIDs []string
+	// LoadBalancingRules is the number of the load balancing rules on the frontend of the service.
+	LoadBalancingRules int
+	// OutboundPorts is the number of the outbound ports allocated by the outbound rules on the frontend of the service.
+	OutboundPorts int
+}
+
+// ServiceLoadBalancerMetrics is the Azure Monitor metrics of a frontend IP of the load balancer of a LoadBalancer
+// service. The metrics not reported by Azure Monitor are nil.
+type ServiceLoadBalancerMetrics struct {
+	Namespace    string
+	Name         string
+	LoadBalancer string
+	FrontendIP   string
+	// AllocatedSNATPorts is the average number of the SNAT ports allocated to the backend instances.
+	AllocatedSNATPorts *float64
+	// UsedSNATPorts is the average number of the SNAT ports used by the backend instances.
+	UsedSNATPorts *float64
+	// DataPathAvailability is the average availability of the data path of the frontend IP in percent.
+	DataPathAvailability *float64
+}
+
+// NodePoolSNATPortUtilization is the SNAT port utilization of the nodes of a node pool outbound configuration on a
+// load balancer, i.e., the highest ratio of the used SNAT ports to the allocated SNAT ports among the nodes.
+type NodePoolSNATPortUtilization struct {
+	LoadBalancer string
+	NodePool     string
+	Ratio        float64
+}
+
 // apiCallMetrics is the metrics measuring the performance of a single API call
 // e.g., GET, POST ...
 type apiCallMetrics struct {
@@ -49,6 +109,61 @@ type apiCallMetrics struct {
 	throttledCount   *metrics.CounterVec
 }
 
+// backendPoolRepairCallMetrics is the metrics measuring the corrections made
+// by the repair loops of the backend pools, i.e., the dedicated backend pools
+// of local services and the backend pool references of availability set NICs.
+type backendPoolRepairCallMetrics struct {
+	corrections *metrics.CounterVec
+	nicRepairs  *metrics.CounterVec
+}
+
+// backendPoolMembershipCallMetrics is the metrics comparing the desired node membership
+// of the backend pools with their actual membership in Azure, and counting the drift
+// corrected by the reconciliation.
+type backendPoolMembershipCallMetrics struct {
+	members          *metrics.GaugeVec
+	driftCorrections *metrics.CounterVec
+}
+
+// rateLimiterCallMetrics is the metrics measuring the token bucket state of
+// the rate limiters of the Azure clients.
+type rateLimiterCallMetrics struct {
+	qps            *metrics.GaugeVec
+	bucketSize     *metrics.GaugeVec
+	tokens         *metrics.GaugeVec
+	throttledCount *metrics.CounterVec
+}
+
+// serviceCostAttributionMetrics is the metrics mapping the LoadBalancer services
+// to the Azure resources they consume.
+type serviceCostAttributionMetrics struct {
+	publicIPs           *metrics.GaugeVec
+	privateLinkServices *metrics.GaugeVec
+	loadBalancingRules  *metrics.GaugeVec
+	outboundPorts       *metrics.GaugeVec
+}
+
+// serviceLoadBalancerCallMetrics is the metrics of the load balancers of the LoadBalancer services
+// queried from Azure Monitor.
+type serviceLoadBalancerCallMetrics struct {
+	snatPorts            *metrics.GaugeVec
+	snatPortUtilization  *metrics.GaugeVec
+	dataPathAvailability *metrics.GaugeVec
+}
+
+// nodePoolSNATCallMetrics is the metrics of the SNAT port utilization of the node pools checked by the SNAT
+// exhaustion advisor, and of the mitigations applied by it.
+type nodePoolSNATCallMetrics struct {
+	snatPortUtilization *metrics.GaugeVec
+	mitigations         *metrics.CounterVec
+}
+
+// degradedModeCallMetrics is the metrics of the state of the degraded mode entered when ARM is unreachable.
+type degradedModeCallMetrics struct {
+	state       *metrics.GaugeVec
+	transitions *metrics.CounterVec
+}
+
 // operationCallMetrics is the metrics measuring the performance of a whole operation
 // e.g., the create / update / delete process of a loadbalancer or route.
 type operationCallMetrics struct {
@@ -120,6 +235,171 @@ func (mc *MetricContext) CountFailedOperation() {
 	operationMetrics.operationFailureCount.WithLabelValues(mc.attributes...).Inc()
 }
 
+// ObserveLocalServiceBackendPoolCorrections records the number of backend pool
+// addresses added or removed when repairing the backend pool of a local service.
+func ObserveLocalServiceBackendPoolCorrections(loadBalancerName, operation string, count int) {
+	if count <= 0 {
+		return
+	}
+	backendPoolRepairMetrics.corrections.WithLabelValues(strings.ToLower(loadBalancerName), operation).Add(float64(count))
+}
+
+// ObserveNICBackendPoolRepairs records the number of backend pool references added
+// to or removed from the NICs of availability set nodes by the NIC repair loop.
+func ObserveNICBackendPoolRepairs(operation string, count int) {
+	if count <= 0 {
+		return
+	}
+	backendPoolRepairMetrics.nicRepairs.WithLabelValues(operation).Add(float64(count))
+}
+
+// SetBackendPoolMembership records the number of the desired members of a backend pool computed during the
+// reconciliation, the number of its actual members in Azure, and the numbers of the missing and unexpected members.
+func SetBackendPoolMembership(loadBalancerName, backendPoolName string, desired, actual, missing, unexpected int) {
+	loadBalancerName, backendPoolName = strings.ToLower(loadBalancerName), strings.ToLower(backendPoolName)
+	backendPoolMembershipMetrics.members.WithLabelValues(loadBalancerName, backendPoolName, "desired").Set(float64(desired))
+	backendPoolMembershipMetrics.members.WithLabelValues(loadBalancerName, backendPoolName, "actual").Set(float64(actual))
+	backendPoolMembershipMetrics.members.WithLabelValues(loadBalancerName, backendPoolName, "missing").Set(float64(missing))
+	backendPoolMembershipMetrics.members.WithLabelValues(loadBalancerName, backendPoolName, "unexpected").Set(float64(unexpected))
+}
+
+// ObserveBackendPoolDriftCorrections records the number of members added to or removed from a backend pool
+// to correct its drift from the desired membership.
+func ObserveBackendPoolDriftCorrections(loadBalancerName, backendPoolName, operation string, count int) {
+	if count <= 0 {
+		return
+	}
+	backendPoolMembershipMetrics.driftCorrections.WithLabelValues(strings.ToLower(loadBalancerName), strings.ToLower(backendPoolName), operation).Add(float64(count))
+}
+
+// SetVMSSUnconvergedInstances records the number of VMSS VMs whose backend pool membership
+// has not converged to the desired state.
+func SetVMSSUnconvergedInstances(resourceGroup, vmssName string, count int) {
+	vmssUnconvergedInstances.WithLabelValues(strings.ToLower(resourceGroup), strings.ToLower(vmssName)).Set(float64(count))
+}
+
+// SetLoadBalancerRuleBackendHealth records the number of backend addresses of a load balancing rule
+// which are up and down according to the health probe.
+func SetLoadBalancerRuleBackendHealth(loadBalancerName, ruleName string, up, down int) {
+	loadBalancerRuleBackends.WithLabelValues(strings.ToLower(loadBalancerName), strings.ToLower(ruleName), "up").Set(float64(up))
+	loadBalancerRuleBackends.WithLabelValues(strings.ToLower(loadBalancerName), strings.ToLower(ruleName), "down").Set(float64(down))
+}
+
+// DeleteLoadBalancerRuleBackendHealth removes the backend health of a load balancing rule which no longer exists.
+func DeleteLoadBalancerRuleBackendHealth(loadBalancerName, ruleName string) {
+	for _, state := range []string{"up", "down"} {
+		loadBalancerRuleBackends.Delete(map[string]string{
+			"load_balancer": strings.ToLower(loadBalancerName),
+			"rule":          strings.ToLower(ruleName),
+			"state":         state,
+		})
+	}
+}
+
+// SetLoadBalancerDriftedServices records the number of services whose load balancers drift from the services
+// in the read-only mode, by the kind of the drift.
+func SetLoadBalancerDriftedServices(drift string, count int) {
+	loadBalancerDriftedServices.WithLabelValues(drift).Set(float64(count))
+}
+
+// SetServiceAzureResources replaces the recorded Azure resources of the services by the given ones, so that the
+// resources of the deleted services are removed.
+func SetServiceAzureResources(services []ServiceAzureResources) {
+	serviceAzureResourceMetrics.publicIPs.Reset()
+	serviceAzureResourceMetrics.privateLinkServices.Reset()
+	serviceAzureResourceMetrics.loadBalancingRules.Reset()
+	serviceAzureResourceMetrics.outboundPorts.Reset()
+	for _, service := range services {
+		for _, id := range service.PublicIPIDs {
+			serviceAzureResourceMetrics.publicIPs.WithLabelValues(service.Namespace, service.Name, strings.ToLower(service.LoadBalancer), strings.ToLower(id)).Set(1)
+		}
+		for _, id := range service.PrivateLinkServiceIDs {
+			serviceAzureResourceMetrics.privateLinkServices.WithLabelValues(service.Namespace, service.Name, strings.ToLower(id)).Set(1)
+		}
+		serviceAzureResourceMetrics.loadBalancingRules.WithLabelValues(service.Namespace, service.Name, strings.ToLower(service.LoadBalancer)).Set(float64(service.LoadBalancingRules))
+		serviceAzureResourceMetrics.outboundPorts.WithLabelValues(service.Namespace, service.Name, strings.ToLower(service.LoadBalancer)).Set(float64(service.OutboundPorts))
+	}
+}
+
+// SetServiceLoadBalancerMetrics replaces the recorded Azure Monitor metrics of the load balancers of the services by
+// the given ones, so that the metrics of the deleted services and frontend IPs are removed.
+func SetServiceLoadBalancerMetrics(records []ServiceLoadBalancerMetrics) {
+	serviceLoadBalancerMetrics.snatPorts.Reset()
+	serviceLoadBalancerMetrics.snatPortUtilization.Reset()
+	serviceLoadBalancerMetrics.dataPathAvailability.Reset()
+	for _, record := range records {
+		loadBalancer := strings.ToLower(record.LoadBalancer)
+		if record.AllocatedSNATPorts != nil {
+			serviceLoadBalancerMetrics.snatPorts.WithLabelValues(record.Namespace, record.Name, loadBalancer, record.FrontendIP, "allocated").Set(*record.AllocatedSNATPorts)
+		}
+		if record.UsedSNATPorts != nil {
+			serviceLoadBalancerMetrics.snatPorts.WithLabelValues(record.Namespace, record.Name, loadBalancer, record.FrontendIP, "used").Set(*record.UsedSNATPorts)
+		}
+		if record.AllocatedSNATPorts != nil && *record.AllocatedSNATPorts > 0 && record.UsedSNATPorts != nil {
+			serviceLoadBalancerMetrics.snatPortUtilization.WithLabelValues(record.Namespace, record.Name, loadBalancer, record.FrontendIP).Set(*record.UsedSNATPorts / *record.AllocatedSNATPorts)
+		}
+		if record.DataPathAvailability != nil {
+			serviceLoadBalancerMetrics.dataPathAvailability.WithLabelValues(record.Namespace, record.Name, loadBalancer, record.FrontendIP).Set(*record.DataPathAvailability)
+		}
+	}
+}
+
+// SetNodePoolSNATPortUtilization replaces the recorded SNAT port utilization of the node pools by the given ones, so
+// that the utilization of the removed node pools is removed.
+func SetNodePoolSNATPortUtilization(utilizations []NodePoolSNATPortUtilization) {
+	nodePoolSNATMetrics.snatPortUtilization.Reset()
+	for _, utilization := range utilizations {
+		nodePoolSNATMetrics.snatPortUtilization.WithLabelValues(strings.ToLower(utilization.LoadBalancer), utilization.NodePool).Set(utilization.Ratio)
+	}
+}
+
+// ObserveSNATExhaustionMitigation records a mitigation of the SNAT exhaustion of a node pool, e.g., scaling the
+// allocated outbound ports or attaching an additional public IP prefix.
+func ObserveSNATExhaustionMitigation(loadBalancerName, nodePool, action string) {
+	nodePoolSNATMetrics.mitigations.WithLabelValues(strings.ToLower(loadBalancerName), nodePool, action).Inc()
+}
+
+// SetDegradedModeState records the current state of the degraded mode, which is 1 for the given state and 0 for the
+// other states.
+func SetDegradedModeState(state string, states []string) {
+	for _, s := range states {
+		value := float64(0)
+		if s == state {
+			value = 1
+		}
+		degradedModeMetrics.state.WithLabelValues(s).Set(value)
+	}
+}
+
+// ObserveDegradedModeTransition records a transition between the states of the degraded mode.
+func ObserveDegradedModeTransition(from, to string) {
+	degradedModeMetrics.transitions.WithLabelValues(from, to).Inc()
+}
+
+// SetRateLimiterState records the QPS, the bucket size and the available tokens of the rate limiter of an Azure
+// client for the read or write operations.
+func SetRateLimiterState(client, subscriptionID, operation string, qps float32, bucketSize int, tokens float64) {
+	rateLimiterMetrics.qps.WithLabelValues(client, subscriptionID, operation).Set(float64(qps))
+	rateLimiterMetrics.bucketSize.WithLabelValues(client, subscriptionID, operation).Set(float64(bucketSize))
+	rateLimiterMetrics.tokens.WithLabelValues(client, subscriptionID, operation).Set(tokens)
+}
+
+// SetRateLimiterTokens records the available tokens of the rate limiter of an Azure client.
+func SetRateLimiterTokens(client, subscriptionID, operation string, tokens float64) {
+	rateLimiterMetrics.tokens.WithLabelValues(client, subscriptionID, operation).Set(tokens)
+}
+
+// RateLimiterThrottledCount records the metrics for the calls rejected by the rate limiter of an Azure client.
+func RateLimiterThrottledCount(client, subscriptionID, operation string) {
+	rateLimiterMetrics.throttledCount.WithLabelValues(client, subscriptionID, operation).Inc()
+}
+
+// SetAADClientCertificateAge records the age of the AAD client certificate fetched from an Azure Key Vault,
+// i.e., the time since the certificate became valid.
+func SetAADClientCertificateAge(keyVault, certificate string, age time.Duration) {
+	clientCertificateAge.WithLabelValues(strings.ToLower(keyVault), certificate).Set(age.Seconds())
+}
+
 // registerAPIMetrics registers the API metrics.
 func registerAPIMetrics(attributes ...string) *apiCallMetrics {
 	metrics := &apiCallMetrics{
@@ -199,3 +479,326 @@ func registerOperationMetrics(attributes ...string) *operationCallMetrics {
 
 	return metrics
 }
+
+// registerBackendPoolRepairMetrics registers the backend pool repair metrics.
+func registerBackendPoolRepairMetrics() *backendPoolRepairCallMetrics {
+	metrics := &backendPoolRepairCallMetrics{
+		corrections: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "local_service_backend_pool_corrections",
+				Help:           "Number of backend pool addresses corrected by the local service backend pool repair loop",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"load_balancer", "operation"},
+		),
+		nicRepairs: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "availability_set_nic_backend_pool_repairs",
+				Help:           "Number of backend pool references of availability set NICs repaired by the NIC repair loop",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"operation"},
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.corrections)
+	legacyregistry.MustRegister(metrics.nicRepairs)
+
+	return metrics
+}
+
+// registerBackendPoolMembershipMetrics registers the backend pool membership metrics.
+func registerBackendPoolMembershipMetrics() *backendPoolMembershipCallMetrics {
+	metrics := &backendPoolMembershipCallMetrics{
+		members: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "backend_pool_members",
+				Help:           "Number of the desired, actual, missing and unexpected members of the backend pools during the last reconciliation",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"load_balancer", "backend_pool", "state"},
+		),
+		driftCorrections: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "backend_pool_drift_corrections",
+				Help:           "Number of backend pool members added or removed to correct the drift from the desired membership",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"load_balancer", "backend_pool", "operation"},
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.members)
+	legacyregistry.MustRegister(metrics.driftCorrections)
+
+	return metrics
+}
+
+// registerVMSSConvergenceMetrics registers the VMSS convergence metrics.
+func registerVMSSConvergenceMetrics() *metrics.GaugeVec {
+	unconvergedInstances := metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      consts.AzureMetricsNamespace,
+			Name:           "vmss_unconverged_instances",
+			Help:           "Number of VMSS VMs whose backend pool membership has not converged to the desired state",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource_group", "vmss"},
+	)
+
+	legacyregistry.MustRegister(unconvergedInstances)
+
+	return unconvergedInstances
+}
+
+// registerLoadBalancerBackendHealthMetrics registers the backend health metrics of the load balancing rules.
+func registerLoadBalancerBackendHealthMetrics() *metrics.GaugeVec {
+	ruleBackends := metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      consts.AzureMetricsNamespace,
+			Name:           "load_balancer_rule_backends",
+			Help:           "Number of backend addresses of the load balancing rules by the health probe state",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"load_balancer", "rule", "state"},
+	)
+
+	legacyregistry.MustRegister(ruleBackends)
+
+	return ruleBackends
+}
+
+// registerRateLimiterMetrics registers the rate limiter metrics.
+func registerRateLimiterMetrics() *rateLimiterCallMetrics {
+	labels := []string{"client", "subscription_id", "operation"}
+	metrics := &rateLimiterCallMetrics{
+		qps: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "rate_limiter_qps",
+				Help:           "QPS of the rate limiter of an Azure client",
+				StabilityLevel: metrics.ALPHA,
+			},
+			labels,
+		),
+		bucketSize: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "rate_limiter_bucket_size",
+				Help:           "Bucket size of the rate limiter of an Azure client",
+				StabilityLevel: metrics.ALPHA,
+			},
+			labels,
+		),
+		tokens: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "rate_limiter_tokens",
+				Help:           "Available tokens in the bucket of the rate limiter of an Azure client after the last call",
+				StabilityLevel: metrics.ALPHA,
+			},
+			labels,
+		),
+		throttledCount: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "rate_limiter_throttled_count",
+				Help:           "Number of Azure API calls rejected by the rate limiter of an Azure client",
+				StabilityLevel: metrics.ALPHA,
+			},
+			labels,
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.qps)
+	legacyregistry.MustRegister(metrics.bucketSize)
+	legacyregistry.MustRegister(metrics.tokens)
+	legacyregistry.MustRegister(metrics.throttledCount)
+
+	return metrics
+}
+
+// registerLoadBalancerDriftMetrics registers the drift metrics of the load balancers.
+func registerLoadBalancerDriftMetrics() *metrics.GaugeVec {
+	driftedServices := metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      consts.AzureMetricsNamespace,
+			Name:           "load_balancer_drifted_services",
+			Help:           "Number of services whose load balancers drift from the services in the read-only mode",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"drift"},
+	)
+
+	legacyregistry.MustRegister(driftedServices)
+
+	return driftedServices
+}
+
+// registerServiceCostAttributionMetrics registers the metrics of the Azure resources consumed by the services.
+func registerServiceCostAttributionMetrics() *serviceCostAttributionMetrics {
+	metrics := &serviceCostAttributionMetrics{
+		publicIPs: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "service_public_ip_info",
+				Help:           "Public IPs on the frontend of the LoadBalancer services, always 1",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"namespace", "service", "load_balancer", "public_ip_id"},
+		),
+		privateLinkServices: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "service_private_link_service_info",
+				Help:           "Private link services attached to the frontend of the LoadBalancer services, always 1",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"namespace", "service", "private_link_service_id"},
+		),
+		loadBalancingRules: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "service_load_balancing_rules",
+				Help:           "Number of the load balancing rules of the LoadBalancer services",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"namespace", "service", "load_balancer"},
+		),
+		outboundPorts: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "service_outbound_ports",
+				Help:           "Number of the outbound ports allocated by the outbound rules on the frontend of the LoadBalancer services",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"namespace", "service", "load_balancer"},
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.publicIPs)
+	legacyregistry.MustRegister(metrics.privateLinkServices)
+	legacyregistry.MustRegister(metrics.loadBalancingRules)
+	legacyregistry.MustRegister(metrics.outboundPorts)
+
+	return metrics
+}
+
+// registerClientCertificateMetrics registers the metrics of the AAD client certificates fetched from Azure Key Vault.
+func registerClientCertificateMetrics() *metrics.GaugeVec {
+	certificateAge := metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      consts.AzureMetricsNamespace,
+			Name:           "aad_client_certificate_age_seconds",
+			Help:           "Time since the AAD client certificate fetched from Azure Key Vault became valid",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"key_vault", "certificate"},
+	)
+
+	legacyregistry.MustRegister(certificateAge)
+
+	return certificateAge
+}
+
+// registerServiceLoadBalancerMetrics registers the Azure Monitor metrics of the load balancers of the services.
+func registerServiceLoadBalancerMetrics() *serviceLoadBalancerCallMetrics {
+	labels := []string{"namespace", "service", "load_balancer", "frontend_ip"}
+	metrics := &serviceLoadBalancerCallMetrics{
+		snatPorts: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "service_load_balancer_snat_ports",
+				Help:           "Average number of the SNAT ports allocated to and used by the backend instances on the frontend IPs of the LoadBalancer services",
+				StabilityLevel: metrics.ALPHA,
+			},
+			append(labels, "state"),
+		),
+		snatPortUtilization: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "service_load_balancer_snat_port_utilization_ratio",
+				Help:           "Ratio of the used SNAT ports to the allocated SNAT ports on the frontend IPs of the LoadBalancer services",
+				StabilityLevel: metrics.ALPHA,
+			},
+			labels,
+		),
+		dataPathAvailability: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "service_load_balancer_data_path_availability_percent",
+				Help:           "Average availability of the data path of the frontend IPs of the LoadBalancer services in percent",
+				StabilityLevel: metrics.ALPHA,
+			},
+			labels,
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.snatPorts)
+	legacyregistry.MustRegister(metrics.snatPortUtilization)
+	legacyregistry.MustRegister(metrics.dataPathAvailability)
+
+	return metrics
+}
+
+// registerNodePoolSNATMetrics registers the SNAT exhaustion metrics of the node pools.
+func registerNodePoolSNATMetrics() *nodePoolSNATCallMetrics {
+	metrics := &nodePoolSNATCallMetrics{
+		snatPortUtilization: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "node_pool_snat_port_utilization_ratio",
+				Help:           "Highest ratio of the used SNAT ports to the allocated SNAT ports among the nodes of the node pool outbound configurations",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"load_balancer", "node_pool"},
+		),
+		mitigations: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "node_pool_snat_exhaustion_mitigations",
+				Help:           "Number of the mitigations applied to the node pools approaching SNAT exhaustion by the action",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"load_balancer", "node_pool", "action"},
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.snatPortUtilization)
+	legacyregistry.MustRegister(metrics.mitigations)
+
+	return metrics
+}
+
+// registerDegradedModeMetrics registers the metrics of the degraded mode.
+func registerDegradedModeMetrics() *degradedModeCallMetrics {
+	metrics := &degradedModeCallMetrics{
+		state: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "degraded_mode_state",
+				Help:           "State of the degraded mode entered when ARM is unreachable, which is 1 for the current state",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"state"},
+		),
+		transitions: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "degraded_mode_transitions",
+				Help:           "Number of the transitions between the states of the degraded mode",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{"from", "to"},
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.state)
+	legacyregistry.MustRegister(metrics.transitions)
+
+	return metrics
+}
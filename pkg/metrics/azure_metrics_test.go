@@ -20,11 +20,14 @@ import (
 	"bytes"
 	"flag"
 	"testing"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/assert"
 
+	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
 )
 
 type FakeLogger struct {
@@ -112,3 +115,122 @@ func TestAzureMetricResultCode(t *testing.T) {
 		assert.Equal(t, tc.expectedResutCode, fakeLogger.infoBuffer.String())
 	}
 }
+
+func TestSetServiceAzureResources(t *testing.T) {
+	SetServiceAzureResources([]ServiceAzureResources{
+		{
+			Namespace:          "default",
+			Name:               "svc1",
+			LoadBalancer:       "LB",
+			PublicIPIDs:        []string{"PIP-ID"},
+			LoadBalancingRules: 2,
+			OutboundPorts:      1024,
+		},
+	})
+	value, err := testutil.GetGaugeMetricValue(serviceAzureResourceMetrics.publicIPs.WithLabelValues("default", "svc1", "lb", "pip-id"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), value)
+	value, err = testutil.GetGaugeMetricValue(serviceAzureResourceMetrics.loadBalancingRules.WithLabelValues("default", "svc1", "lb"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), value)
+	value, err = testutil.GetGaugeMetricValue(serviceAzureResourceMetrics.outboundPorts.WithLabelValues("default", "svc1", "lb"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1024), value)
+
+	// the resources of the deleted services are removed
+	SetServiceAzureResources(nil)
+	value, err = testutil.GetGaugeMetricValue(serviceAzureResourceMetrics.loadBalancingRules.WithLabelValues("default", "svc1", "lb"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), value)
+}
+
+func TestSetServiceLoadBalancerMetrics(t *testing.T) {
+	SetServiceLoadBalancerMetrics([]ServiceLoadBalancerMetrics{
+		{
+			Namespace:            "default",
+			Name:                 "svc1",
+			LoadBalancer:         "LB",
+			FrontendIP:           "1.2.3.4",
+			AllocatedSNATPorts:   pointer.Float64(1024),
+			UsedSNATPorts:        pointer.Float64(256),
+			DataPathAvailability: pointer.Float64(100),
+		},
+		{
+			// internal load balancers have no SNAT ports
+			Namespace:            "default",
+			Name:                 "svc2",
+			LoadBalancer:         "LB-internal",
+			FrontendIP:           "10.0.0.4",
+			DataPathAvailability: pointer.Float64(50),
+		},
+	})
+	value, err := testutil.GetGaugeMetricValue(serviceLoadBalancerMetrics.snatPorts.WithLabelValues("default", "svc1", "lb", "1.2.3.4", "used"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(256), value)
+	value, err = testutil.GetGaugeMetricValue(serviceLoadBalancerMetrics.snatPortUtilization.WithLabelValues("default", "svc1", "lb", "1.2.3.4"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, value)
+	value, err = testutil.GetGaugeMetricValue(serviceLoadBalancerMetrics.dataPathAvailability.WithLabelValues("default", "svc2", "lb-internal", "10.0.0.4"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(50), value)
+
+	// the metrics of the deleted services are removed
+	SetServiceLoadBalancerMetrics(nil)
+	value, err = testutil.GetGaugeMetricValue(serviceLoadBalancerMetrics.snatPorts.WithLabelValues("default", "svc1", "lb", "1.2.3.4", "used"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), value)
+}
+
+func TestNodePoolSNATMetrics(t *testing.T) {
+	SetNodePoolSNATPortUtilization([]NodePoolSNATPortUtilization{{LoadBalancer: "LB", NodePool: "pool1", Ratio: 0.9}})
+	value, err := testutil.GetGaugeMetricValue(nodePoolSNATMetrics.snatPortUtilization.WithLabelValues("lb", "pool1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.9, value)
+
+	// the utilization of the removed node pools is removed
+	SetNodePoolSNATPortUtilization(nil)
+	value, err = testutil.GetGaugeMetricValue(nodePoolSNATMetrics.snatPortUtilization.WithLabelValues("lb", "pool1"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), value)
+
+	ObserveSNATExhaustionMitigation("LB", "pool1", "scale_ports")
+	count, err := testutil.GetCounterMetricValue(nodePoolSNATMetrics.mitigations.WithLabelValues("lb", "pool1", "scale_ports"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), count)
+}
+
+func TestDegradedModeMetrics(t *testing.T) {
+	states := []string{"Healthy", "Degraded"}
+	SetDegradedModeState("Degraded", states)
+	value, err := testutil.GetGaugeMetricValue(degradedModeMetrics.state.WithLabelValues("Degraded"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), value)
+	value, err = testutil.GetGaugeMetricValue(degradedModeMetrics.state.WithLabelValues("Healthy"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), value)
+
+	ObserveDegradedModeTransition("Healthy", "Degraded")
+	count, err := testutil.GetCounterMetricValue(degradedModeMetrics.transitions.WithLabelValues("Healthy", "Degraded"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), count)
+}
+
+func TestBackendPoolMembership(t *testing.T) {
+	SetBackendPoolMembership("LB", "Pool", 3, 2, 1, 0)
+	value, err := testutil.GetGaugeMetricValue(backendPoolMembershipMetrics.members.WithLabelValues("lb", "pool", "missing"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), value)
+
+	ObserveBackendPoolDriftCorrections("LB", "Pool", "add", 1)
+	ObserveBackendPoolDriftCorrections("LB", "Pool", "add", 0)
+	count, err := testutil.GetCounterMetricValue(backendPoolMembershipMetrics.driftCorrections.WithLabelValues("lb", "pool", "add"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), count)
+}
+
+func TestSetAADClientCertificateAge(t *testing.T) {
+	SetAADClientCertificateAge("https://Vault.vault.azure.net", "cert", 90*time.Minute)
+	value, err := testutil.GetGaugeMetricValue(clientCertificateAge.WithLabelValues("https://vault.vault.azure.net", "cert"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(5400), value)
+}
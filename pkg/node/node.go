@@ -20,12 +20,17 @@ import (
 	"bytes"
 	"context"
 
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
+	controllerhealthz "k8s.io/controller-manager/pkg/healthz"
 	"k8s.io/klog/v2"
 
 	azureprovider "sigs.k8s.io/cloud-provider-azure/pkg/provider"
+	"sigs.k8s.io/cloud-provider-azure/pkg/providerid"
 )
 
 // IMDSNodeProvider implements nodemanager.NodeProvider.
@@ -53,6 +58,11 @@ func (np *IMDSNodeProvider) NodeAddresses(ctx context.Context, name types.NodeNa
 	return np.azure.NodeAddresses(ctx, name)
 }
 
+// HealthChecker returns the health check of reaching the instance metadata service.
+func (np *IMDSNodeProvider) HealthChecker() controllerhealthz.UnnamedHealthChecker {
+	return np.azure.IMDSHealthChecker()
+}
+
 // InstanceID returns the cloud provider ID of the specified instance.
 // Note that if the instance does not exist or is no longer running, we must return ("", cloudprovider.InstanceNotFound)
 func (np *IMDSNodeProvider) InstanceID(ctx context.Context, name types.NodeName) (string, error) {
@@ -61,7 +71,7 @@ func (np *IMDSNodeProvider) InstanceID(ctx context.Context, name types.NodeName)
 		return "", err
 	}
 
-	return np.azure.ProviderName() + "://" + instanceID, nil
+	return providerid.FromResourceID(instanceID), nil
 }
 
 // InstanceType returns the type of the specified instance.
@@ -83,3 +93,13 @@ func (np *IMDSNodeProvider) GetZone(ctx context.Context, name types.NodeName) (c
 func (np *IMDSNodeProvider) GetPlatformSubFaultDomain() (string, error) {
 	return np.azure.GetPlatformSubFaultDomain()
 }
+
+// GetNetworkInterface returns the primary network interface of the specified instance.
+func (np *IMDSNodeProvider) GetNetworkInterface(ctx context.Context, name types.NodeName) (*network.Interface, error) {
+	return np.azure.GetNodeNetworkInterface(ctx, name)
+}
+
+// GetVirtualMachine returns the OS properties and the instance view of the specified instance.
+func (np *IMDSNodeProvider) GetVirtualMachine(ctx context.Context, name types.NodeName) (*compute.VirtualMachine, error) {
+	return np.azure.GetNodeVirtualMachine(ctx, name)
+}
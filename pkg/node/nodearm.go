@@ -21,12 +21,16 @@ import (
 	"os"
 	"runtime"
 
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 
 	azureprovider "sigs.k8s.io/cloud-provider-azure/pkg/provider"
+	"sigs.k8s.io/cloud-provider-azure/pkg/providerid"
 )
 
 // ARMNodeProvider implements nodemanager.NodeProvider.
@@ -75,7 +79,7 @@ func (np *ARMNodeProvider) InstanceID(ctx context.Context, name types.NodeName)
 		return "", err
 	}
 
-	return np.azure.ProviderName() + "://" + instanceID, nil
+	return providerid.FromResourceID(instanceID), nil
 }
 
 // InstanceType returns the type of the specified instance.
@@ -102,3 +106,13 @@ func (np *ARMNodeProvider) GetZone(ctx context.Context, name types.NodeName) (cl
 func (np *ARMNodeProvider) GetPlatformSubFaultDomain() (string, error) {
 	return "", nil
 }
+
+// GetNetworkInterface returns the primary network interface of the specified instance.
+func (np *ARMNodeProvider) GetNetworkInterface(ctx context.Context, name types.NodeName) (*network.Interface, error) {
+	return np.azure.GetNodeNetworkInterface(ctx, name)
+}
+
+// GetVirtualMachine returns the OS properties and the instance view of the specified instance.
+func (np *ARMNodeProvider) GetVirtualMachine(ctx context.Context, name types.NodeName) (*compute.VirtualMachine, error) {
+	return np.azure.GetNodeVirtualMachine(ctx, name)
+}
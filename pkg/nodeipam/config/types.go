@@ -32,4 +32,7 @@ type NodeIPAMControllerConfiguration struct {
 	// NodeCIDRMaskSizeIPv6 is the mask size for IPv6 node cidr in dual-stack cluster.
 	// This can be used only with dual stack clusters and is incompatible with single stack clusters.
 	NodeCIDRMaskSizeIPv6 int32
+	// PodSubnetName is the name of the subnet in the virtual network of the cluster from which
+	// the node cidrs are allocated. This can be used only with the SubnetAllocator.
+	PodSubnetName string
 }
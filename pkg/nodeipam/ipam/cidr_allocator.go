@@ -43,6 +43,9 @@ const (
 	// CloudAllocatorType is the allocator that uses cloud platform
 	// support to do node CIDR range allocations.
 	CloudAllocatorType CIDRAllocatorType = "CloudAllocator"
+	// SubnetAllocatorType is the allocator that carves node CIDR ranges
+	// from the address prefixes of an Azure subnet.
+	SubnetAllocatorType CIDRAllocatorType = "SubnetAllocator"
 )
 
 // TODO: figure out the good setting for those constants.
@@ -90,6 +93,9 @@ type CIDRAllocatorParams struct {
 	SecondaryServiceCIDR *net.IPNet
 	// NodeCIDRMaskSizes is list of node cidr mask sizes
 	NodeCIDRMaskSizes []int
+	// PodSubnetName is the name of the subnet in the virtual network of the cluster
+	// from which the subnet allocator allocates node cidrs
+	PodSubnetName string
 }
 
 // New creates a new CIDR range allocator.
@@ -104,6 +110,8 @@ func New(kubeClient clientset.Interface, cloud cloudprovider.Interface, nodeInfo
 		return NewCIDRRangeAllocator(kubeClient, nodeInformer, allocatorParams, nodeList)
 	case CloudAllocatorType:
 		return NewCloudCIDRAllocator(kubeClient, cloud, nodeInformer, allocatorParams, nodeList)
+	case SubnetAllocatorType:
+		return NewSubnetCIDRAllocator(kubeClient, cloud, nodeInformer, allocatorParams, nodeList)
 	default:
 		return nil, fmt.Errorf("invalid CIDR allocator type: %v", allocatorType)
 	}
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,6 +30,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	informers "k8s.io/client-go/informers/core/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -38,6 +41,7 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 	netutils "k8s.io/utils/net"
+	"k8s.io/utils/pointer"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	"sigs.k8s.io/cloud-provider-azure/pkg/nodeipam/ipam/cidrset"
@@ -48,7 +52,7 @@ import (
 )
 
 // cloudCIDRAllocator allocates node CIDRs according to the node subnet mask size
-// tagged on each VMSS/VMAS.
+// labeled on the node or tagged on each VMSS/VMAS.
 type cloudCIDRAllocator struct {
 	client clientset.Interface
 	cloud  *providerazure.Cloud
@@ -77,6 +81,11 @@ type cloudCIDRAllocator struct {
 	clusterCIDRs               []*net.IPNet
 
 	nodeNamePodCIDRsMap map[string][]string
+	// reservedCIDRs holds the CIDRs of the services and the subnets in the virtual network overlapping with the
+	// cluster CIDRs, keyed by their owners, which are never allocated to the nodes.
+	reservedCIDRs map[string][]string
+	// podSubnetName is the subnet from which the node CIDRs are allocated, which is not reserved.
+	podSubnetName string
 }
 
 var _ CIDRAllocator = (*cloudCIDRAllocator)(nil)
@@ -117,6 +126,8 @@ func NewCloudCIDRAllocator(
 		maxSubnetMaskSizes:         make([]int, len(allocatorParams.ClusterCIDRs)),
 		clusterCIDRs:               allocatorParams.ClusterCIDRs,
 		nodeNamePodCIDRsMap:        make(map[string][]string),
+		reservedCIDRs:              make(map[string][]string),
+		podSubnetName:              allocatorParams.PodSubnetName,
 	}
 
 	// update the node subnet mask size
@@ -126,7 +137,7 @@ func NewCloudCIDRAllocator(
 				klog.Warningf("NewCloudCIDRAllocator: failed when trying to read the node mask size on node %s: no provider ID", node.Name)
 				continue
 			}
-			err := ca.updateNodeSubnetMaskSizes(node.Name, node.Spec.ProviderID)
+			err := ca.updateNodeSubnetMaskSizes(node.Name, node.Spec.ProviderID, node.Labels)
 			if err != nil {
 				return nil, err
 			}
@@ -147,18 +158,22 @@ func NewCloudCIDRAllocator(
 	}
 	ca.cidrSets = cidrSets
 
+	// The service ranges are reserved instead of only being filtered out, so that they are kept in the cidr sets
+	// when the node subnet mask sizes are updated.
 	if allocatorParams.ServiceCIDR != nil {
-		filterOutServiceRange(ca.clusterCIDRs, ca.cidrSets, allocatorParams.ServiceCIDR)
+		ca.reserveCIDR("service/primary", allocatorParams.ServiceCIDR)
 	} else {
 		klog.V(0).Info("No Service CIDR provided. Skipping filtering out service addresses.")
 	}
 
 	if allocatorParams.SecondaryServiceCIDR != nil {
-		filterOutServiceRange(ca.clusterCIDRs, ca.cidrSets, allocatorParams.SecondaryServiceCIDR)
+		ca.reserveCIDR("service/secondary", allocatorParams.SecondaryServiceCIDR)
 	} else {
 		klog.V(0).Info("No Secondary Service CIDR provided. Skipping filtering out secondary service addresses.")
 	}
 
+	ca.reserveSubnetRanges()
+
 	// mark the CIDRs on the existing nodes as used
 	if nodeList != nil {
 		for _, node := range nodeList.Items {
@@ -176,6 +191,20 @@ func NewCloudCIDRAllocator(
 				return nil, err
 			}
 		}
+
+		// keep the CIDRs reserved for the nodes before the restart unless they conflict with the CIDRs on the nodes
+		for _, node := range nodeList.Items {
+			node := node
+			if len(node.Spec.PodCIDRs) != 0 {
+				continue
+			}
+			if reservedCIDRs := ca.getNodeReservedPodCIDRs(&node); reservedCIDRs != nil {
+				klog.V(4).Infof("Node %v has reserved CIDRs %v, occupying them in CIDR map", node.Name, reservedCIDRs)
+				if err := ca.occupyReservedPodCIDRs(node.Name, reservedCIDRs); err != nil {
+					return nil, err
+				}
+			}
+		}
 	}
 
 	_, _ = nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -223,8 +252,9 @@ func (ca *cloudCIDRAllocator) updateMaxSubnetMaskSizes() {
 	ca.maxSubnetMaskSizes = maxNodeSubnetMaskSizes
 }
 
-// updateNodeSubnetMaskSizes gets the node's VMSS/VMAS, reads the mask size tag on it and updates them into the map
-func (ca *cloudCIDRAllocator) updateNodeSubnetMaskSizes(nodeName, providerID string) error {
+// updateNodeSubnetMaskSizes reads the mask sizes from the labels of the node, or from the tags on the node's VMSS/VMAS
+// if they are not labeled, and updates them into the map
+func (ca *cloudCIDRAllocator) updateNodeSubnetMaskSizes(nodeName, providerID string, nodeLabels map[string]string) error {
 	ca.lock.Lock()
 	defer ca.lock.Unlock()
 
@@ -232,9 +262,18 @@ func (ca *cloudCIDRAllocator) updateNodeSubnetMaskSizes(nodeName, providerID str
 		klog.Warningf("updateNodeSubnetMaskSizes(%s): empty providerID", providerID)
 	}
 
-	ipv4Mask, ipv6Mask, err := ca.cloud.VMSet.GetNodeCIDRMasksByProviderID(providerID)
-	if err != nil {
-		klog.Warningf("updateNodeSubnetMaskSizes(%s): cannot get node subnet mask size by providerID: %v", providerID, err)
+	ipv4Mask, ipv6Mask := getNodeCIDRMaskSizesFromLabels(nodeName, nodeLabels)
+	if ipv4Mask == 0 || ipv6Mask == 0 {
+		ipv4TagMask, ipv6TagMask, err := ca.cloud.VMSet.GetNodeCIDRMasksByProviderID(providerID)
+		if err != nil {
+			klog.Warningf("updateNodeSubnetMaskSizes(%s): cannot get node subnet mask size by providerID: %v", providerID, err)
+		}
+		if ipv4Mask == 0 {
+			ipv4Mask = ipv4TagMask
+		}
+		if ipv6Mask == 0 {
+			ipv6Mask = ipv6TagMask
+		}
 	}
 
 	if ipv4Mask == 0 {
@@ -264,6 +303,166 @@ func (ca *cloudCIDRAllocator) updateNodeSubnetMaskSizes(nodeName, providerID str
 	return nil
 }
 
+// getNodeCIDRMaskSizesFromLabels returns the mask sizes of the pod CIDRs declared by the labels of the node, or 0 if
+// they are not declared or invalid.
+func getNodeCIDRMaskSizesFromLabels(nodeName string, nodeLabels map[string]string) (ipv4Mask, ipv6Mask int) {
+	parseMaskSize := func(key string, bits int) int {
+		value, ok := nodeLabels[key]
+		if !ok {
+			return 0
+		}
+		maskSize, err := strconv.Atoi(value)
+		if err != nil || maskSize <= 0 || maskSize > bits {
+			klog.Warningf("getNodeCIDRMaskSizesFromLabels: ignoring the invalid value %q of the label %s on node %s", value, key, nodeName)
+			return 0
+		}
+		return maskSize
+	}
+	return parseMaskSize(consts.NodeCIDRMaskSizeIPv4Label, 32), parseMaskSize(consts.NodeCIDRMaskSizeIPv6Label, 128)
+}
+
+// reserveSubnetRanges marks the address prefixes of the subnets in the virtual network overlapping with the cluster
+// CIDRs as used, so that the pod CIDRs do not conflict with the existing subnet usage.
+func (ca *cloudCIDRAllocator) reserveSubnetRanges() {
+	if ca.cloud.VnetName == "" {
+		return
+	}
+	subnets, err := ca.cloud.ListSubnets(ca.cloud.VnetName)
+	if err != nil {
+		klog.Warningf("reserveSubnetRanges: failed to list the subnets of the virtual network %s, the pod CIDRs may conflict with them: %v", ca.cloud.VnetName, err)
+		return
+	}
+	for _, subnet := range subnets {
+		if subnet.SubnetPropertiesFormat == nil || (ca.podSubnetName != "" && strings.EqualFold(pointer.StringDeref(subnet.Name, ""), ca.podSubnetName)) {
+			continue
+		}
+		var prefixes []string
+		if subnet.AddressPrefix != nil {
+			prefixes = append(prefixes, *subnet.AddressPrefix)
+		}
+		if subnet.AddressPrefixes != nil {
+			prefixes = append(prefixes, *subnet.AddressPrefixes...)
+		}
+		for _, prefix := range prefixes {
+			_, cidr, err := net.ParseCIDR(prefix)
+			if err != nil {
+				klog.Warningf("reserveSubnetRanges: failed to parse the address prefix %s of the subnet %s: %v", prefix, pointer.StringDeref(subnet.Name, ""), err)
+				continue
+			}
+			ca.reserveCIDR("subnet/"+pointer.StringDeref(subnet.Name, ""), cidr)
+		}
+	}
+}
+
+// reserveCIDR marks the CIDR as used by the owner in the cidr sets of the cluster CIDRs overlapping with it.
+func (ca *cloudCIDRAllocator) reserveCIDR(owner string, cidr *net.IPNet) {
+	for idx, clusterCIDR := range ca.clusterCIDRs {
+		if !cidrsOverlap(clusterCIDR, cidr) {
+			continue
+		}
+		if err := ca.cidrSets[idx].Occupy(cidr); err != nil {
+			klog.Errorf("Error reserving cidr %v of %s out of cluster cidr:%v (index:%v): %v", cidr, owner, clusterCIDR, idx, err)
+			continue
+		}
+		ca.lock.Lock()
+		if !sets.NewString(ca.reservedCIDRs[owner]...).Has(cidr.String()) {
+			klog.V(2).Infof("reserveCIDR: reserved cidr %v of %s out of cluster cidr %v", cidr, owner, clusterCIDR)
+			ca.reservedCIDRs[owner] = append(ca.reservedCIDRs[owner], cidr.String())
+		}
+		ca.lock.Unlock()
+	}
+}
+
+// cidrsOverlap returns true if the two CIDRs have a nonempty intersection.
+func cidrsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP.Mask(a.Mask)) || b.Contains(a.IP.Mask(b.Mask))
+}
+
+// getConflictingCIDROwner returns the owner of the reserved or allocated CIDRs overlapping with the given CIDR of the
+// node, or an empty string if there is no conflict.
+func (ca *cloudCIDRAllocator) getConflictingCIDROwner(nodeName string, cidr *net.IPNet) string {
+	ca.lock.Lock()
+	defer ca.lock.Unlock()
+
+	for owner, cidrs := range ca.getOccupiedCIDRsLocked() {
+		if owner == nodeName {
+			continue
+		}
+		for _, occupied := range cidrs {
+			_, occupiedCIDR, err := net.ParseCIDR(occupied)
+			if err == nil && cidrsOverlap(occupiedCIDR, cidr) {
+				return owner
+			}
+		}
+	}
+	return ""
+}
+
+// getOccupiedCIDRsLocked returns the CIDRs allocated to the nodes and the reserved CIDRs keyed by their owners. The
+// owners of the reserved CIDRs contain "/" so that they never collide with the node names. The caller should hold the
+// lock.
+func (ca *cloudCIDRAllocator) getOccupiedCIDRsLocked() map[string][]string {
+	occupied := make(map[string][]string, len(ca.nodeNamePodCIDRsMap)+len(ca.reservedCIDRs))
+	for nodeName, cidrs := range ca.nodeNamePodCIDRsMap {
+		occupied[nodeName] = cidrs
+	}
+	for owner, cidrs := range ca.reservedCIDRs {
+		occupied[owner] = cidrs
+	}
+	return occupied
+}
+
+// getNodeReservedPodCIDRs returns the pod CIDRs reserved for the node by the annotation, or nil if there is none or
+// they are no longer valid, e.g., the cluster CIDRs or the node subnet mask sizes are changed, or they conflict with
+// the reserved or allocated CIDRs.
+func (ca *cloudCIDRAllocator) getNodeReservedPodCIDRs(node *v1.Node) []*net.IPNet {
+	value, ok := node.Annotations[consts.NodeReservedPodCIDRsAnnotation]
+	if !ok || value == "" {
+		return nil
+	}
+	cidrStrings := strings.Split(value, ",")
+	if len(cidrStrings) != len(ca.clusterCIDRs) {
+		klog.Warningf("getNodeReservedPodCIDRs: ignoring the reserved CIDRs %s of node %s which do not match the cluster CIDRs", value, node.Name)
+		return nil
+	}
+	ca.lock.Lock()
+	maskSizes := ca.nodeNameSubnetMaskSizesMap[node.Name]
+	ca.lock.Unlock()
+
+	cidrs := make([]*net.IPNet, len(cidrStrings))
+	for i, cidrString := range cidrStrings {
+		_, cidr, err := net.ParseCIDR(strings.TrimSpace(cidrString))
+		if err != nil {
+			klog.Warningf("getNodeReservedPodCIDRs: ignoring the invalid reserved CIDRs %s of node %s: %v", value, node.Name, err)
+			return nil
+		}
+		maskSize, _ := cidr.Mask.Size()
+		if !ca.clusterCIDRs[i].Contains(cidr.IP) || (len(maskSizes) > i && maskSizes[i] != maskSize) {
+			klog.Warningf("getNodeReservedPodCIDRs: ignoring the reserved CIDR %s of node %s which is out of the cluster CIDR %v or does not match the node subnet mask size", cidr, node.Name, ca.clusterCIDRs[i])
+			return nil
+		}
+		if owner := ca.getConflictingCIDROwner(node.Name, cidr); owner != "" {
+			klog.Warningf("getNodeReservedPodCIDRs: ignoring the reserved CIDR %s of node %s which conflicts with %s", cidr, node.Name, owner)
+			return nil
+		}
+		cidrs[i] = cidr
+	}
+	return cidrs
+}
+
+// occupyReservedPodCIDRs marks the pod CIDRs reserved for the node as used.
+func (ca *cloudCIDRAllocator) occupyReservedPodCIDRs(nodeName string, cidrs []*net.IPNet) error {
+	for i, cidr := range cidrs {
+		if err := ca.cidrSets[i].Occupy(cidr); err != nil {
+			return fmt.Errorf("failed to mark reserved cidr[%v] at i [%v] as occupied for node %s: %w", cidr, i, nodeName, err)
+		}
+	}
+	ca.lock.Lock()
+	ca.nodeNamePodCIDRsMap[nodeName] = cidrsAsString(cidrs)
+	ca.lock.Unlock()
+	return nil
+}
+
 func (ca *cloudCIDRAllocator) Run(stopCh <-chan struct{}) {
 	defer utilruntime.HandleCrash()
 
@@ -345,6 +544,12 @@ func (ca *cloudCIDRAllocator) occupyCIDRs(node *v1.Node) error {
 			return fmt.Errorf("node:%s has an allocated cidr: %v at index:%v that does not exist in cluster cidrs configuration", node.Name, cidr, i)
 		}
 
+		// The CIDR set on the node is kept, but the conflict should be resolved manually.
+		if owner := ca.getConflictingCIDROwner(node.Name, podCIDR); owner != "" {
+			klog.Warningf("occupyCIDRs: cidr %v of node %s conflicts with %s", podCIDR, node.Name, owner)
+			nodeutil.RecordNodeStatusChange(ca.recorder, node, "CIDRConflict")
+		}
+
 		if err := ca.cidrSets[i].Occupy(podCIDR); err != nil {
 			return fmt.Errorf("failed to mark cidr[%v] at i [%v] as occupied for node %s: %w", podCIDR, i, node.Name, err)
 		}
@@ -370,7 +575,7 @@ func (ca *cloudCIDRAllocator) AllocateOrOccupyCIDR(node *v1.Node) error {
 		return nil
 	}
 
-	err := ca.updateNodeSubnetMaskSizes(node.Name, node.Spec.ProviderID)
+	err := ca.updateNodeSubnetMaskSizes(node.Name, node.Spec.ProviderID, node.Labels)
 	if err != nil {
 		klog.Errorf("AllocateOrOccupyCIDR(%s): failed to update node subnet mask sizes: %v", node.Name, err)
 		return err
@@ -380,9 +585,12 @@ func (ca *cloudCIDRAllocator) AllocateOrOccupyCIDR(node *v1.Node) error {
 	// Keep the mask size in each cidr set the max one when new node added in.
 	// The mask size would not change unless the new node is from a new VMSS/VMAS
 	// and the mask value tagging on it is different from the existing ones.
+	ca.lock.Lock()
+	occupiedCIDRs := ca.getOccupiedCIDRsLocked()
+	ca.lock.Unlock()
 	for i, cidrSet := range ca.cidrSets {
 		cidrSet := cidrSet
-		err := cidrSet.UpdateSubnetMaskSize(ca.maxSubnetMaskSizes[i], ca.nodeNamePodCIDRsMap)
+		err := cidrSet.UpdateSubnetMaskSize(ca.maxSubnetMaskSizes[i], occupiedCIDRs)
 		if err != nil {
 			ca.removeNodeFromProcessing(node.Name)
 			return err
@@ -394,6 +602,20 @@ func (ca *cloudCIDRAllocator) AllocateOrOccupyCIDR(node *v1.Node) error {
 		return ca.occupyCIDRs(node)
 	}
 
+	// reuse the CIDRs reserved for the node which failed to be set on it
+	if reservedCIDRs := ca.getNodeReservedPodCIDRs(node); reservedCIDRs != nil {
+		if err := ca.occupyReservedPodCIDRs(node.Name, reservedCIDRs); err != nil {
+			ca.removeNodeFromProcessing(node.Name)
+			return err
+		}
+		klog.V(4).Infof("Putting node %s with the reserved CIDRs into the work queue", node.Name)
+		ca.nodeUpdateChannel <- nodeReservedCIDRs{
+			nodeName:       node.Name,
+			allocatedCIDRs: reservedCIDRs,
+		}
+		return nil
+	}
+
 	allocated := nodeReservedCIDRs{
 		nodeName:       node.Name,
 		allocatedCIDRs: make([]*net.IPNet, len(ca.cidrSets)),
@@ -457,7 +679,16 @@ func (ca *cloudCIDRAllocator) updateCIDRsAllocation(data nodeReservedCIDRs) erro
 		return nil
 	}
 
-	// If we reached here, it means that the node has no CIDR currently assigned. So we set it.
+	// If we reached here, it means that the node has no CIDR currently assigned. So we set it after persisting
+	// the reservation, so that the CIDRs are kept if the allocator restarts before they are set.
+	reservation := strings.Join(cidrsString, ",")
+	if node.Annotations[consts.NodeReservedPodCIDRsAnnotation] != reservation {
+		if err = utilnode.PatchNodeAnnotation(ca.client, types.NodeName(node.Name), consts.NodeReservedPodCIDRsAnnotation, reservation); err != nil {
+			klog.Errorf("Failed to persist the reserved CIDRs %v of node %v: %v", cidrsString, node.Name, err)
+			return err
+		}
+	}
+
 	for i := 0; i < cidrUpdateRetries; i++ {
 		if err = utilnode.PatchNodeCIDRs(ca.client, types.NodeName(node.Name), cidrsString); err == nil {
 			return nil
@@ -493,11 +724,21 @@ func (ca *cloudCIDRAllocator) updateCIDRsAllocation(data nodeReservedCIDRs) erro
 }
 
 func (ca *cloudCIDRAllocator) ReleaseCIDR(node *v1.Node) error {
-	if node == nil || len(node.Spec.PodCIDRs) == 0 {
+	if node == nil {
 		return nil
 	}
+	podCIDRs := node.Spec.PodCIDRs
+	if len(podCIDRs) == 0 {
+		// release the CIDRs reserved for the node which have not been set on it
+		ca.lock.Lock()
+		podCIDRs = ca.nodeNamePodCIDRsMap[node.Name]
+		ca.lock.Unlock()
+		if len(podCIDRs) == 0 {
+			return nil
+		}
+	}
 
-	for i, cidr := range node.Spec.PodCIDRs {
+	for i, cidr := range podCIDRs {
 		_, podCIDR, err := net.ParseCIDR(cidr)
 		if err != nil {
 			return fmt.Errorf("failed to parse CIDR %s on Node %v: %w", cidr, node.Name, err)
@@ -513,7 +754,9 @@ func (ca *cloudCIDRAllocator) ReleaseCIDR(node *v1.Node) error {
 		}
 
 	}
+	ca.lock.Lock()
 	delete(ca.nodeNamePodCIDRsMap, node.Name)
+	ca.lock.Unlock()
 
 	return nil
 }
@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
@@ -32,6 +33,7 @@ import (
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/utils/pointer"
 
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
@@ -110,6 +112,8 @@ func TestNewCloudCIDRAllocator(t *testing.T) {
 		Clientset: clientSet,
 	}
 	cloud := azureprovider.GetTestCloud(ctrl)
+	mockSubnetsClient := cloud.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetsClient.EXPECT().List(gomock.Any(), "rg", "vnet").Return(nil, nil).Times(1)
 	nodeInformer := getFakeNodeInformer(fakeNodeHandler)
 	allocatorParams := CIDRAllocatorParams{
 		ClusterCIDRs: func() []*net.IPNet {
@@ -184,6 +188,7 @@ func TestUpdateNodeSubnetMaskSizes(t *testing.T) {
 	for _, tc := range []struct {
 		description, providerID            string
 		tags                               map[string]*string
+		labels                             map[string]string
 		expectedNodeNameSubnetMaskSizesMap map[string][]int
 		expectedErr                        error
 	}{
@@ -205,6 +210,19 @@ func TestUpdateNodeSubnetMaskSizes(t *testing.T) {
 			},
 			expectedNodeNameSubnetMaskSizesMap: map[string][]int{"vmss-0": {24, 64}},
 		},
+		{
+			description: "updateNodeSubnetMaskSizes should prefer the mask sizes on the node labels",
+			providerID:  "azure:///subscriptions/sub/resourceGroups/rg1/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/0",
+			tags: map[string]*string{
+				consts.VMSetCIDRIPV4TagKey: pointer.String("25"),
+				consts.VMSetCIDRIPV6TagKey: pointer.String("65"),
+			},
+			labels: map[string]string{
+				consts.NodeCIDRMaskSizeIPv4Label: "26",
+				consts.NodeCIDRMaskSizeIPv6Label: "invalid",
+			},
+			expectedNodeNameSubnetMaskSizesMap: map[string][]int{"vmss-0": {26, 65}},
+		},
 		{
 			description: "updateNodeSubnetMaskSizes should report an error if the ipv4 mask is smaller than the cluster mask",
 			providerID:  "azure:///subscriptions/sub/resourceGroups/rg1/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/0",
@@ -255,9 +273,97 @@ func TestUpdateNodeSubnetMaskSizes(t *testing.T) {
 				nodeNameSubnetMaskSizesMap: make(map[string][]int),
 			}
 
-			err = ca.updateNodeSubnetMaskSizes("vmss-0", tc.providerID)
+			err = ca.updateNodeSubnetMaskSizes("vmss-0", tc.providerID, tc.labels)
 			assert.Equal(t, tc.expectedErr, err)
 			assert.Equal(t, tc.expectedNodeNameSubnetMaskSizesMap, ca.nodeNameSubnetMaskSizesMap)
 		})
 	}
 }
+
+func TestCloudCIDRAllocatorReservedCIDRs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newNode := func(name string, podCIDRs []string, reservedCIDRs string) *v1.Node {
+		node := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					consts.NodeCIDRMaskSizeIPv4Label: "24",
+					consts.NodeCIDRMaskSizeIPv6Label: "64",
+				},
+			},
+			Spec: v1.NodeSpec{
+				ProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/" + name,
+				PodCIDRs:   podCIDRs,
+			},
+		}
+		if len(podCIDRs) > 0 {
+			node.Spec.PodCIDR = podCIDRs[0]
+		}
+		if reservedCIDRs != "" {
+			node.Annotations = map[string]string{consts.NodeReservedPodCIDRsAnnotation: reservedCIDRs}
+		}
+		return node
+	}
+	fakeNodeHandler := &testutil.FakeNodeHandler{
+		Existing: []*v1.Node{
+			newNode("node0", []string{"10.240.1.0/24", "beef::/64"}, ""),
+			newNode("node1", nil, "10.240.2.0/24,beef:0:0:1::/64"),
+			// the reservation conflicting with the subnet is ignored
+			newNode("node2", nil, "10.240.0.0/24,beef:0:0:2::/64"),
+		},
+		Clientset: fake.NewSimpleClientset(),
+	}
+	nodeList := &v1.NodeList{}
+	for _, node := range fakeNodeHandler.Existing {
+		nodeList.Items = append(nodeList.Items, *node)
+	}
+
+	cloud := azureprovider.GetTestCloud(ctrl)
+	mockSubnetsClient := cloud.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetsClient.EXPECT().List(gomock.Any(), "rg", "vnet").Return([]network.Subnet{
+		{
+			Name:                   pointer.String("subnet1"),
+			SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: pointer.String("10.240.0.0/24")},
+		},
+		{
+			Name:                   pointer.String("subnet2"),
+			SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: pointer.String("10.0.0.0/16")},
+		},
+	}, nil).Times(1)
+	allocatorParams := CIDRAllocatorParams{
+		ClusterCIDRs: func() []*net.IPNet {
+			_, cidrIPV4, _ := net.ParseCIDR("10.240.0.0/16")
+			_, cidrIPV6, _ := net.ParseCIDR("beef::/48")
+			return []*net.IPNet{cidrIPV4, cidrIPV6}
+		}(),
+	}
+
+	allocator, err := NewCloudCIDRAllocator(fakeNodeHandler, cloud, getFakeNodeInformer(fakeNodeHandler), allocatorParams, nodeList)
+	assert.NoError(t, err)
+	ca := allocator.(*cloudCIDRAllocator)
+	assert.Equal(t, map[string][]string{"subnet/subnet1": {"10.240.0.0/24"}}, ca.reservedCIDRs)
+	assert.Equal(t, map[string][]string{
+		"node0": {"10.240.1.0/24", "beef::/64"},
+		"node1": {"10.240.2.0/24", "beef:0:0:1::/64"},
+	}, ca.nodeNamePodCIDRsMap)
+
+	// node1 reuses the reserved CIDRs, and node2 is allocated with the CIDRs conflicting with nothing.
+	assert.NoError(t, ca.AllocateOrOccupyCIDR(fakeNodeHandler.Existing[1]))
+	assert.Equal(t, []string{"10.240.2.0/24", "beef:0:0:1::/64"}, cidrsAsString((<-ca.nodeUpdateChannel).allocatedCIDRs))
+	assert.NoError(t, ca.AllocateOrOccupyCIDR(fakeNodeHandler.Existing[2]))
+	allocated := <-ca.nodeUpdateChannel
+	assert.Equal(t, []string{"10.240.3.0/24", "beef:0:0:2::/64"}, cidrsAsString(allocated.allocatedCIDRs))
+
+	// the reservation is persisted before the CIDRs are set on the node.
+	assert.NoError(t, ca.updateCIDRsAllocation(allocated))
+	updatedNodes := fakeNodeHandler.GetUpdatedNodesCopy()
+	updatedNode := updatedNodes[len(updatedNodes)-1]
+	assert.Equal(t, "10.240.3.0/24,beef:0:0:2::/64", updatedNode.Annotations[consts.NodeReservedPodCIDRsAnnotation])
+	assert.Equal(t, []string{"10.240.3.0/24", "beef:0:0:2::/64"}, updatedNode.Spec.PodCIDRs)
+
+	// the reserved CIDRs of the deleted node are released.
+	assert.NoError(t, ca.ReleaseCIDR(fakeNodeHandler.Existing[1]))
+	assert.NotContains(t, ca.nodeNamePodCIDRsMap, "node1")
+}
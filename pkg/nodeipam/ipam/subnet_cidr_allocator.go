@@ -0,0 +1,194 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	informers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+	netutils "k8s.io/utils/net"
+	"k8s.io/utils/pointer"
+
+	providerazure "sigs.k8s.io/cloud-provider-azure/pkg/provider"
+)
+
+const (
+	// subnetUsageRefreshPeriod is the period to reserve the addresses newly used by the ip configurations in the pod subnet.
+	subnetUsageRefreshPeriod = 5 * time.Minute
+
+	// azureReservedLeadingAddresses is the number of the leading addresses reserved by Azure in each address prefix of a subnet.
+	azureReservedLeadingAddresses = 4
+)
+
+// subnetCIDRAllocator allocates node CIDRs from the address prefixes of an Azure subnet, so that the pod IPs are
+// routable in the virtual network. The allocations are recorded on the nodes as the ledger, and the addresses
+// reserved by Azure or used by the ip configurations in the subnet are never allocated.
+type subnetCIDRAllocator struct {
+	*cloudCIDRAllocator
+}
+
+var _ CIDRAllocator = (*subnetCIDRAllocator)(nil)
+
+// NewSubnetCIDRAllocator creates a new subnet CIDR allocator, which allocates node CIDRs from the address prefixes of
+// the pod subnet instead of the cluster CIDRs.
+func NewSubnetCIDRAllocator(
+	client clientset.Interface,
+	cloud cloudprovider.Interface,
+	nodeInformer informers.NodeInformer,
+	allocatorParams CIDRAllocatorParams,
+	nodeList *v1.NodeList,
+) (CIDRAllocator, error) {
+	az, ok := cloud.(*providerazure.Cloud)
+	if !ok {
+		return nil, fmt.Errorf("subnetCIDRAllocator does not support %v provider", cloud.ProviderName())
+	}
+	if allocatorParams.PodSubnetName == "" {
+		return nil, fmt.Errorf("subnetCIDRAllocator requires the name of the pod subnet")
+	}
+
+	subnet, exists, err := az.GetSubnetWithExpand(az.VnetName, allocatorParams.PodSubnetName, "ipConfigurations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the pod subnet %s/%s: %w", az.VnetName, allocatorParams.PodSubnetName, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("the pod subnet %s/%s is not found", az.VnetName, allocatorParams.PodSubnetName)
+	}
+	subnetCIDRs, err := getSubnetCIDRs(subnet)
+	if err != nil {
+		return nil, err
+	}
+	if len(allocatorParams.ClusterCIDRs) > 0 {
+		klog.Warningf("NewSubnetCIDRAllocator: ignoring the cluster CIDRs %v, the node CIDRs are allocated from the pod subnet %s", allocatorParams.ClusterCIDRs, allocatorParams.PodSubnetName)
+	}
+	allocatorParams.ClusterCIDRs = subnetCIDRs
+
+	allocator, err := NewCloudCIDRAllocator(client, cloud, nodeInformer, allocatorParams, nodeList)
+	if err != nil {
+		return nil, err
+	}
+	sa := &subnetCIDRAllocator{cloudCIDRAllocator: allocator.(*cloudCIDRAllocator)}
+	sa.reserveAzureReservedAddresses()
+	sa.reserveIPConfigurationAddresses(subnet)
+
+	klog.V(0).Infof("Using subnet CIDR allocator (subnet: %s, CIDRs: %v)", allocatorParams.PodSubnetName, subnetCIDRs)
+	return sa, nil
+}
+
+// getSubnetCIDRs returns the address prefixes of the subnet with the IPv4 ones first. At most one address prefix of
+// each IP family is supported, in the same way as the cluster CIDRs.
+func getSubnetCIDRs(subnet network.Subnet) ([]*net.IPNet, error) {
+	if subnet.SubnetPropertiesFormat == nil {
+		return nil, fmt.Errorf("the pod subnet %s has no address prefix", pointer.StringDeref(subnet.Name, ""))
+	}
+	var prefixes []string
+	if subnet.AddressPrefix != nil {
+		prefixes = append(prefixes, *subnet.AddressPrefix)
+	}
+	if subnet.AddressPrefixes != nil {
+		prefixes = append(prefixes, *subnet.AddressPrefixes...)
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("the pod subnet %s has no address prefix", pointer.StringDeref(subnet.Name, ""))
+	}
+
+	cidrs, err := netutils.ParseCIDRs(prefixes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the address prefixes of the pod subnet %s: %w", pointer.StringDeref(subnet.Name, ""), err)
+	}
+	sort.SliceStable(cidrs, func(i, j int) bool {
+		return !netutils.IsIPv6CIDR(cidrs[i]) && netutils.IsIPv6CIDR(cidrs[j])
+	})
+	// The same prefix may be in both the address prefix and the address prefixes.
+	var res []*net.IPNet
+	for _, cidr := range cidrs {
+		if len(res) > 0 && res[len(res)-1].String() == cidr.String() {
+			continue
+		}
+		if len(res) > 0 && netutils.IsIPv6CIDR(res[len(res)-1]) == netutils.IsIPv6CIDR(cidr) {
+			return nil, fmt.Errorf("the pod subnet %s has more than one address prefix of the same IP family", pointer.StringDeref(subnet.Name, ""))
+		}
+		res = append(res, cidr)
+	}
+	return res, nil
+}
+
+// reserveAzureReservedAddresses reserves the leading and the last addresses of each address prefix of the subnet,
+// which are reserved by Azure.
+func (sa *subnetCIDRAllocator) reserveAzureReservedAddresses() {
+	for _, clusterCIDR := range sa.clusterCIDRs {
+		ones, bits := clusterCIDR.Mask.Size()
+		leadingMaskSize := bits - 2
+		if leadingMaskSize < ones {
+			leadingMaskSize = ones
+		}
+		sa.reserveCIDR("azure/reserved", &net.IPNet{IP: clusterCIDR.IP, Mask: net.CIDRMask(leadingMaskSize, bits)})
+
+		lastIP := make(net.IP, len(clusterCIDR.IP))
+		for i := range clusterCIDR.IP {
+			lastIP[i] = clusterCIDR.IP[i] | ^clusterCIDR.Mask[i]
+		}
+		sa.reserveCIDR("azure/reserved", &net.IPNet{IP: lastIP, Mask: net.CIDRMask(bits, bits)})
+	}
+}
+
+// reserveIPConfigurationAddresses reserves the private IPs of the ip configurations in the subnet. The reservations
+// are kept even if the ip configurations are deleted, until the allocator restarts.
+func (sa *subnetCIDRAllocator) reserveIPConfigurationAddresses(subnet network.Subnet) {
+	if subnet.SubnetPropertiesFormat == nil || subnet.IPConfigurations == nil {
+		return
+	}
+	for _, ipConfig := range *subnet.IPConfigurations {
+		if ipConfig.IPConfigurationPropertiesFormat == nil || ipConfig.PrivateIPAddress == nil {
+			continue
+		}
+		ip := netutils.ParseIPSloppy(*ipConfig.PrivateIPAddress)
+		if ip == nil {
+			klog.Warningf("reserveIPConfigurationAddresses: failed to parse the private IP %s of the ip configuration %s", *ipConfig.PrivateIPAddress, pointer.StringDeref(ipConfig.ID, ""))
+			continue
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+		sa.reserveCIDR("ipconfig/"+pointer.StringDeref(ipConfig.ID, ""), &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+}
+
+// refreshSubnetUsage reserves the addresses used by the ip configurations newly created in the subnet.
+func (sa *subnetCIDRAllocator) refreshSubnetUsage() {
+	subnet, exists, err := sa.cloud.GetSubnetWithExpand(sa.cloud.VnetName, sa.podSubnetName, "ipConfigurations")
+	if err != nil || !exists {
+		klog.Warningf("refreshSubnetUsage: failed to get the pod subnet %s/%s (exists: %t): %v", sa.cloud.VnetName, sa.podSubnetName, exists, err)
+		return
+	}
+	sa.reserveIPConfigurationAddresses(subnet)
+}
+
+func (sa *subnetCIDRAllocator) Run(stopCh <-chan struct{}) {
+	go wait.Until(sa.refreshSubnetUsage, subnetUsageRefreshPeriod, stopCh)
+	sa.cloudCIDRAllocator.Run(stopCh)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	azureprovider "sigs.k8s.io/cloud-provider-azure/pkg/provider"
+	"sigs.k8s.io/cloud-provider-azure/pkg/util/controller/testutil"
+)
+
+func TestGetSubnetCIDRs(t *testing.T) {
+	for _, tc := range []struct {
+		description   string
+		subnet        network.Subnet
+		expectedCIDRs []string
+		expectedErr   error
+	}{
+		{
+			description: "getSubnetCIDRs should return the IPv4 address prefix first",
+			subnet: network.Subnet{
+				Name: pointer.String("subnet"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+					AddressPrefixes: &[]string{"fd00::/64", "10.240.0.0/16"},
+				},
+			},
+			expectedCIDRs: []string{"10.240.0.0/16", "fd00::/64"},
+		},
+		{
+			description: "getSubnetCIDRs should deduplicate the address prefix in the address prefixes",
+			subnet: network.Subnet{
+				Name: pointer.String("subnet"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+					AddressPrefix:   pointer.String("10.240.0.0/16"),
+					AddressPrefixes: &[]string{"10.240.0.0/16"},
+				},
+			},
+			expectedCIDRs: []string{"10.240.0.0/16"},
+		},
+		{
+			description: "getSubnetCIDRs should report an error if there are multiple address prefixes of the same IP family",
+			subnet: network.Subnet{
+				Name: pointer.String("subnet"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+					AddressPrefixes: &[]string{"10.240.0.0/16", "10.241.0.0/16"},
+				},
+			},
+			expectedErr: fmt.Errorf("the pod subnet subnet has more than one address prefix of the same IP family"),
+		},
+		{
+			description: "getSubnetCIDRs should report an error if there is no address prefix",
+			subnet: network.Subnet{
+				Name:                   pointer.String("subnet"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{},
+			},
+			expectedErr: fmt.Errorf("the pod subnet subnet has no address prefix"),
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			cidrs, err := getSubnetCIDRs(tc.subnet)
+			assert.Equal(t, tc.expectedErr, err)
+			if tc.expectedErr == nil {
+				assert.Equal(t, tc.expectedCIDRs, cidrsAsString(cidrs))
+			}
+		})
+	}
+}
+
+func TestSubnetCIDRAllocator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node0",
+			Labels: map[string]string{
+				consts.NodeCIDRMaskSizeIPv4Label: "24",
+				consts.NodeCIDRMaskSizeIPv6Label: "80",
+			},
+		},
+		Spec: v1.NodeSpec{
+			ProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/node0",
+		},
+	}
+	fakeNodeHandler := &testutil.FakeNodeHandler{
+		Existing:  []*v1.Node{node},
+		Clientset: fake.NewSimpleClientset(),
+	}
+
+	podSubnet := network.Subnet{
+		Name: pointer.String("podsubnet"),
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+			AddressPrefixes: &[]string{"10.240.0.0/22", "fd00::/64"},
+			IPConfigurations: &[]network.IPConfiguration{
+				{
+					ID:                              pointer.String("ipconfig1"),
+					IPConfigurationPropertiesFormat: &network.IPConfigurationPropertiesFormat{PrivateIPAddress: pointer.String("10.240.1.5")},
+				},
+			},
+		},
+	}
+	cloud := azureprovider.GetTestCloud(ctrl)
+	mockSubnetsClient := cloud.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "podsubnet", "ipConfigurations").Return(podSubnet, nil).Times(1)
+	// the pod subnet itself is not reserved as an existing subnet
+	mockSubnetsClient.EXPECT().List(gomock.Any(), "rg", "vnet").Return([]network.Subnet{podSubnet}, nil).Times(1)
+
+	allocator, err := NewSubnetCIDRAllocator(fakeNodeHandler, cloud, getFakeNodeInformer(fakeNodeHandler), CIDRAllocatorParams{PodSubnetName: "podsubnet"}, &v1.NodeList{Items: []v1.Node{*node}})
+	assert.NoError(t, err)
+	sa := allocator.(*subnetCIDRAllocator)
+	assert.Equal(t, []string{"10.240.0.0/22", "fd00::/64"}, cidrsAsString(sa.clusterCIDRs))
+	assert.Equal(t, map[string][]string{
+		"azure/reserved":     {"10.240.0.0/30", "10.240.3.255/32", "fd00::/126", "fd00::ffff:ffff:ffff:ffff/128"},
+		"ipconfig/ipconfig1": {"10.240.1.5/32"},
+	}, sa.reservedCIDRs)
+
+	// the node CIDRs skip the addresses reserved by Azure and used by the ip configurations.
+	assert.NoError(t, sa.AllocateOrOccupyCIDR(node))
+	allocated := <-sa.nodeUpdateChannel
+	assert.Equal(t, []string{"10.240.2.0/24", "fd00::1:0:0:0/80"}, cidrsAsString(allocated.allocatedCIDRs))
+}
+
+func TestNewSubnetCIDRAllocatorWithoutSubnet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fakeNodeHandler := &testutil.FakeNodeHandler{Clientset: fake.NewSimpleClientset()}
+	cloud := azureprovider.GetTestCloud(ctrl)
+
+	_, err := NewSubnetCIDRAllocator(fakeNodeHandler, cloud, getFakeNodeInformer(fakeNodeHandler), CIDRAllocatorParams{}, nil)
+	assert.Equal(t, fmt.Errorf("subnetCIDRAllocator requires the name of the pod subnet"), err)
+}
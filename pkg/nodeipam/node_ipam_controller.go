@@ -119,6 +119,7 @@ func NewNodeIpamController(
 	serviceCIDR *net.IPNet,
 	secondaryServiceCIDR *net.IPNet,
 	nodeCIDRMaskSizes []int,
+	podSubnetName string,
 	allocatorType ipam.CIDRAllocatorType) (*Controller, error) {
 
 	if kubeClient == nil {
@@ -138,8 +139,12 @@ func NewNodeIpamController(
 		_ = RegisterMetricAndTrackRateLimiterUsage("node_ipam_controller", kubeClient.CoreV1().RESTClient().GetRateLimiter())
 	}
 
-	// Cloud CIDR allocator does not rely on clusterCIDR or nodeCIDRMaskSize for allocation.
-	if allocatorType != ipam.CloudAllocatorType {
+	// Cloud CIDR allocator does not rely on clusterCIDR or nodeCIDRMaskSize for allocation,
+	// and subnet CIDR allocator allocates from the address prefixes of the pod subnet.
+	if allocatorType == ipam.SubnetAllocatorType && podSubnetName == "" {
+		klog.Fatal("Controller: Must specify --pod-subnet-name if --cidr-allocator-type is SubnetAllocator")
+	}
+	if allocatorType != ipam.CloudAllocatorType && allocatorType != ipam.SubnetAllocatorType {
 		if len(clusterCIDRs) == 0 {
 			klog.Fatal("Controller: Must specify --cluster-cidr if --allocate-node-cidrs is set")
 		}
@@ -175,6 +180,7 @@ func NewNodeIpamController(
 		ServiceCIDR:          ic.serviceCIDR,
 		SecondaryServiceCIDR: ic.secondaryServiceCIDR,
 		NodeCIDRMaskSizes:    nodeCIDRMaskSizes,
+		PodSubnetName:        podSubnetName,
 	}
 
 	ic.cidrAllocator, err = ipam.New(kubeClient, cloud, nodeInformer, ic.allocatorType, allocatorParams)
@@ -20,6 +20,8 @@ import (
 	context "context"
 	reflect "reflect"
 
+	compute "github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	network "github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 	gomock "github.com/golang/mock/gomock"
 	v1 "k8s.io/api/core/v1"
 	types "k8s.io/apimachinery/pkg/types"
@@ -49,6 +51,21 @@ func (m *NodeProvider) EXPECT() *NodeProviderMockRecorder {
 	return m.recorder
 }
 
+// GetNetworkInterface mocks base method.
+func (m *NodeProvider) GetNetworkInterface(arg0 context.Context, arg1 types.NodeName) (*network.Interface, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNetworkInterface", arg0, arg1)
+	ret0, _ := ret[0].(*network.Interface)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNetworkInterface indicates an expected call of GetNetworkInterface.
+func (mr *NodeProviderMockRecorder) GetNetworkInterface(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNetworkInterface", reflect.TypeOf((*NodeProvider)(nil).GetNetworkInterface), arg0, arg1)
+}
+
 // GetPlatformSubFaultDomain mocks base method.
 func (m *NodeProvider) GetPlatformSubFaultDomain() (string, error) {
 	m.ctrl.T.Helper()
@@ -79,6 +96,21 @@ func (mr *NodeProviderMockRecorder) GetZone(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetZone", reflect.TypeOf((*NodeProvider)(nil).GetZone), arg0, arg1)
 }
 
+// GetVirtualMachine mocks base method.
+func (m *NodeProvider) GetVirtualMachine(arg0 context.Context, arg1 types.NodeName) (*compute.VirtualMachine, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVirtualMachine", arg0, arg1)
+	ret0, _ := ret[0].(*compute.VirtualMachine)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVirtualMachine indicates an expected call of GetVirtualMachine.
+func (mr *NodeProviderMockRecorder) GetVirtualMachine(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVirtualMachine", reflect.TypeOf((*NodeProvider)(nil).GetVirtualMachine), arg0, arg1)
+}
+
 // InstanceID mocks base method.
 func (m *NodeProvider) InstanceID(arg0 context.Context, arg1 types.NodeName) (string, error) {
 	m.ctrl.T.Helper()
@@ -22,9 +22,13 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -45,6 +49,7 @@ import (
 	cloudnodeutil "k8s.io/cloud-provider/node/helpers"
 	nodeutil "k8s.io/component-helpers/node/util"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 )
@@ -61,6 +66,12 @@ type NodeProvider interface {
 	GetZone(ctx context.Context, name types.NodeName) (cloudprovider.Zone, error)
 	// GetPlatformSubFaultDomain returns the PlatformSubFaultDomain from IMDS if set.
 	GetPlatformSubFaultDomain() (string, error)
+	// GetNetworkInterface returns the primary network interface of the specified instance.
+	// The properties not available to the provider are left empty.
+	GetNetworkInterface(ctx context.Context, name types.NodeName) (*network.Interface, error)
+	// GetVirtualMachine returns the OS properties and the instance view of the specified instance.
+	// The properties not available to the provider are left empty.
+	GetVirtualMachine(ctx context.Context, name types.NodeName) (*compute.VirtualMachine, error)
 }
 
 // labelReconcile holds information about a label to reconcile and how to reconcile it.
@@ -118,6 +129,10 @@ var updateNetworkConditionBackoff = wait.Backoff{
 const (
 	v4Suffix = "IPv4"
 	v6Suffix = "IPv6"
+
+	// provisioningFailedEventReason is the reason of the events reporting the provisioning failures of the VM.
+	provisioningFailedEventReason = "VMProvisioningFailed"
+	provisioningStateFailedPrefix = "ProvisioningState/failed"
 )
 
 // CloudNodeController reconciles node information.
@@ -134,6 +149,10 @@ type CloudNodeController struct {
 	labelReconcileInfo []labelReconcile
 
 	enableBetaTopologyLabels bool
+
+	// lastProvisioningFailures records the provisioning failures last reported as events
+	// so that the same failures are not reported on every status update.
+	lastProvisioningFailures string
 }
 
 // NewCloudNodeController creates a CloudNodeController object
@@ -217,6 +236,192 @@ func (cnc *CloudNodeController) UpdateNodeStatus(ctx context.Context) {
 	if err != nil {
 		klog.Errorf("Error reconciling node labels for node %q, err: %v", node.Name, err)
 	}
+
+	err = cnc.reconcileNodeNICAnnotations(ctx, node)
+	if err != nil {
+		klog.Errorf("Error reconciling network interface annotations for node %q, err: %v", node.Name, err)
+	}
+
+	if isWindowsNode(node) {
+		err = cnc.reconcileWindowsNode(ctx, node)
+		if err != nil {
+			klog.Errorf("Error reconciling Windows VM metadata for node %q, err: %v", node.Name, err)
+		}
+	}
+}
+
+// nicAnnotationKeys lists the annotations reporting the properties of the primary network interface.
+var nicAnnotationKeys = []string{
+	consts.NodeNICAcceleratedNetworkingAnnotation,
+	consts.NodeNICTypeAnnotation,
+	consts.NodeNICPrivateIPsAnnotation,
+}
+
+// reconcileNodeNICAnnotations reports the properties of the primary network interface of the node
+// as node annotations. The annotations of the properties unknown to the node provider are removed.
+func (cnc *CloudNodeController) reconcileNodeNICAnnotations(ctx context.Context, node *v1.Node) error {
+	nic, err := cnc.nodeProvider.GetNetworkInterface(ctx, types.NodeName(node.Name))
+	if err != nil {
+		return fmt.Errorf("getting network interface for node %q: %w", node.Name, err)
+	}
+	if nic == nil {
+		return nil
+	}
+
+	return cnc.reconcileNodeAnnotations(ctx, node, nicAnnotationKeys, getNICAnnotations(nic), "network interface")
+}
+
+// reconcileNodeAnnotations patches the node with the desired values of the given annotation keys.
+// The annotations of the keys without desired values are removed.
+func (cnc *CloudNodeController) reconcileNodeAnnotations(ctx context.Context, node *v1.Node, keys []string, desired map[string]string, kind string) error {
+	annotationsToUpdate := map[string]interface{}{}
+	for _, key := range keys {
+		value, found := desired[key]
+		current, exists := node.Annotations[key]
+		if found && (!exists || current != value) {
+			annotationsToUpdate[key] = value
+		} else if !found && exists {
+			// Setting the value to null removes the annotation in the merge patch.
+			annotationsToUpdate[key] = nil
+		}
+	}
+	if len(annotationsToUpdate) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotationsToUpdate,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal the annotations patch: %w", err)
+	}
+	klog.V(2).Infof("Updating %s annotations of node %q: %s", kind, node.Name, string(patch))
+	if _, err := cnc.kubeClient.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to patch %s annotations: %w", kind, err)
+	}
+	return nil
+}
+
+// getNICAnnotations returns the annotations of the known properties of the network interface.
+func getNICAnnotations(nic *network.Interface) map[string]string {
+	annotations := map[string]string{}
+	if nic.InterfacePropertiesFormat == nil {
+		return annotations
+	}
+
+	if nic.EnableAcceleratedNetworking != nil {
+		annotations[consts.NodeNICAcceleratedNetworkingAnnotation] = strconv.FormatBool(*nic.EnableAcceleratedNetworking)
+	}
+	if nic.NicType != "" {
+		annotations[consts.NodeNICTypeAnnotation] = string(nic.NicType)
+	}
+	if nic.IPConfigurations != nil {
+		var privateIPs []string
+		for _, ipConfig := range *nic.IPConfigurations {
+			if ipConfig.InterfaceIPConfigurationPropertiesFormat != nil && ipConfig.PrivateIPAddress != nil && *ipConfig.PrivateIPAddress != "" {
+				privateIPs = append(privateIPs, *ipConfig.PrivateIPAddress)
+			}
+		}
+		if len(privateIPs) > 0 {
+			annotations[consts.NodeNICPrivateIPsAnnotation] = strings.Join(privateIPs, ",")
+		}
+	}
+	return annotations
+}
+
+// vmAnnotationKeys lists the annotations reporting the OS properties of the Windows VMs.
+var vmAnnotationKeys = []string{
+	consts.NodeOSImageSKUAnnotation,
+	consts.NodeLicenseTypeAnnotation,
+	consts.NodeEphemeralOSDiskAnnotation,
+}
+
+// isWindowsNode returns true if the node runs Windows.
+func isWindowsNode(node *v1.Node) bool {
+	return strings.EqualFold(node.Labels[v1.LabelOSStable], string(v1.Windows))
+}
+
+// reconcileWindowsNode reports the OS properties of the VM of the Windows node as node annotations, and the
+// provisioning failures of the VM and its extensions as node events, to help debugging the agent pool rollouts.
+func (cnc *CloudNodeController) reconcileWindowsNode(ctx context.Context, node *v1.Node) error {
+	vm, err := cnc.nodeProvider.GetVirtualMachine(ctx, types.NodeName(node.Name))
+	if err != nil {
+		return fmt.Errorf("getting virtual machine for node %q: %w", node.Name, err)
+	}
+	if vm == nil {
+		return nil
+	}
+
+	failures := getProvisioningFailures(vm)
+	if len(failures) > 0 {
+		message := strings.Join(failures, "; ")
+		if message != cnc.lastProvisioningFailures && cnc.recorder != nil {
+			nodeRef := &v1.ObjectReference{
+				Kind: "Node",
+				Name: node.Name,
+				UID:  node.UID,
+			}
+			cnc.recorder.Event(nodeRef, v1.EventTypeWarning, provisioningFailedEventReason, message)
+		}
+		cnc.lastProvisioningFailures = message
+	} else {
+		cnc.lastProvisioningFailures = ""
+	}
+
+	return cnc.reconcileNodeAnnotations(ctx, node, vmAnnotationKeys, getVMAnnotations(vm), "virtual machine")
+}
+
+// getVMAnnotations returns the annotations of the known OS properties of the VM.
+func getVMAnnotations(vm *compute.VirtualMachine) map[string]string {
+	annotations := map[string]string{}
+	if vm.VirtualMachineProperties == nil {
+		return annotations
+	}
+
+	if vm.LicenseType != nil && *vm.LicenseType != "" {
+		annotations[consts.NodeLicenseTypeAnnotation] = *vm.LicenseType
+	}
+	if vm.StorageProfile != nil {
+		if vm.StorageProfile.ImageReference != nil && vm.StorageProfile.ImageReference.Sku != nil && *vm.StorageProfile.ImageReference.Sku != "" {
+			annotations[consts.NodeOSImageSKUAnnotation] = *vm.StorageProfile.ImageReference.Sku
+		}
+		if vm.StorageProfile.OsDisk != nil {
+			ephemeral := vm.StorageProfile.OsDisk.DiffDiskSettings != nil &&
+				strings.EqualFold(string(vm.StorageProfile.OsDisk.DiffDiskSettings.Option), string(compute.Local))
+			annotations[consts.NodeEphemeralOSDiskAnnotation] = strconv.FormatBool(ephemeral)
+		}
+	}
+	return annotations
+}
+
+// getProvisioningFailures returns the failed provisioning statuses of the VM and its extensions.
+func getProvisioningFailures(vm *compute.VirtualMachine) []string {
+	if vm.VirtualMachineProperties == nil || vm.InstanceView == nil {
+		return nil
+	}
+
+	var failures []string
+	appendFailures := func(prefix string, statuses *[]compute.InstanceViewStatus) {
+		if statuses == nil {
+			return
+		}
+		for _, status := range *statuses {
+			code := pointer.StringDeref(status.Code, "")
+			if !strings.HasPrefix(strings.ToLower(code), strings.ToLower(provisioningStateFailedPrefix)) {
+				continue
+			}
+			failures = append(failures, fmt.Sprintf("%s%s: %s", prefix, code, pointer.StringDeref(status.Message, "")))
+		}
+	}
+	appendFailures("", vm.InstanceView.Statuses)
+	if vm.InstanceView.Extensions != nil {
+		for _, extension := range *vm.InstanceView.Extensions {
+			appendFailures(fmt.Sprintf("extension %s: ", pointer.StringDeref(extension.Name, "")), extension.Statuses)
+		}
+	}
+	return failures
 }
 
 // reconcileNodeLabels reconciles node labels transitioning from beta to GA
@@ -23,6 +23,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
@@ -37,6 +39,7 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 	cloudproviderapi "k8s.io/cloud-provider/api"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	mocknodeprovider "sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/mock"
@@ -658,6 +661,7 @@ func TestUpdateNodeAddresses(t *testing.T) {
 			Address: "10.0.0.1",
 		},
 	}, nil)
+	mockNP.EXPECT().GetNetworkInterface(ctx, types.NodeName("node0")).Return(nil, nil)
 	cloudNodeController.UpdateNodeStatus(ctx)
 	updatedNodes := fnh.GetUpdatedNodesCopy()
 	assert.Equal(t, 2, len(updatedNodes[0].Status.Addresses), "Node Addresses not correctly updated")
@@ -876,6 +880,168 @@ func Test_reconcileNodeLabels(t *testing.T) {
 	}
 }
 
+func Test_reconcileNodeNICAnnotations(t *testing.T) {
+	testcases := []struct {
+		name                string
+		annotations         map[string]string
+		nic                 *network.Interface
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:        "should do nothing if the network interface is not reported",
+			annotations: map[string]string{"foo": "bar"},
+			expectedAnnotations: map[string]string{
+				"foo": "bar",
+			},
+		},
+		{
+			name:        "should add the annotations of the network interface",
+			annotations: map[string]string{"foo": "bar"},
+			nic: &network.Interface{
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+					EnableAcceleratedNetworking: pointer.Bool(true),
+					NicType:                     network.Standard,
+					IPConfigurations: &[]network.InterfaceIPConfiguration{
+						{InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{PrivateIPAddress: pointer.String("10.0.0.4")}},
+						{InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{PrivateIPAddress: pointer.String("10.0.0.5")}},
+					},
+				},
+			},
+			expectedAnnotations: map[string]string{
+				"foo": "bar",
+				consts.NodeNICAcceleratedNetworkingAnnotation: "true",
+				consts.NodeNICTypeAnnotation:                  "Standard",
+				consts.NodeNICPrivateIPsAnnotation:            "10.0.0.4,10.0.0.5",
+			},
+		},
+		{
+			name: "should update the changed annotations and remove the unknown ones",
+			annotations: map[string]string{
+				consts.NodeNICAcceleratedNetworkingAnnotation: "false",
+				consts.NodeNICTypeAnnotation:                  "Standard",
+				consts.NodeNICPrivateIPsAnnotation:            "10.0.0.4",
+			},
+			nic: &network.Interface{
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+					IPConfigurations: &[]network.InterfaceIPConfiguration{
+						{InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{PrivateIPAddress: pointer.String("10.0.0.6")}},
+					},
+				},
+			},
+			expectedAnnotations: map[string]string{
+				consts.NodeNICPrivateIPsAnnotation: "10.0.0.6",
+			},
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			testNode := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "node01",
+					Annotations: test.annotations,
+				},
+			}
+
+			clientset := fake.NewSimpleClientset(testNode)
+			mockNP := mocknodeprovider.NewMockNodeProvider(ctrl)
+			mockNP.EXPECT().GetNetworkInterface(gomock.Any(), types.NodeName("node01")).Return(test.nic, nil)
+			cnc := &CloudNodeController{
+				kubeClient:   clientset,
+				nodeProvider: mockNP,
+			}
+
+			err := cnc.reconcileNodeNICAnnotations(context.TODO(), testNode)
+			assert.NoError(t, err)
+
+			actualNode, err := clientset.CoreV1().Nodes().Get(context.TODO(), "node01", metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedAnnotations, actualNode.Annotations)
+		})
+	}
+}
+
+func Test_reconcileWindowsNode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	testNode := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node01",
+			Labels: map[string]string{v1.LabelOSStable: "windows"},
+			Annotations: map[string]string{
+				consts.NodeLicenseTypeAnnotation: "Windows_Client",
+			},
+		},
+	}
+	vm := &compute.VirtualMachine{
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			LicenseType: pointer.String("Windows_Server"),
+			StorageProfile: &compute.StorageProfile{
+				ImageReference: &compute.ImageReference{Sku: pointer.String("2022-datacenter-core-smalldisk")},
+				OsDisk: &compute.OSDisk{
+					OsType:           compute.OperatingSystemTypesWindows,
+					DiffDiskSettings: &compute.DiffDiskSettings{Option: compute.Local},
+				},
+			},
+			InstanceView: &compute.VirtualMachineInstanceView{
+				Statuses: &[]compute.InstanceViewStatus{
+					{Code: pointer.String("ProvisioningState/succeeded")},
+					{Code: pointer.String("PowerState/running")},
+				},
+				Extensions: &[]compute.VirtualMachineExtensionInstanceView{
+					{
+						Name: pointer.String("vmssCSE"),
+						Statuses: &[]compute.InstanceViewStatus{
+							{Code: pointer.String("ProvisioningState/failed/1"), Message: pointer.String("exit code 1")},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(testNode)
+	mockNP := mocknodeprovider.NewMockNodeProvider(ctrl)
+	mockNP.EXPECT().GetVirtualMachine(gomock.Any(), types.NodeName("node01")).Return(vm, nil).Times(2)
+	recorder := record.NewFakeRecorder(10)
+	cnc := &CloudNodeController{
+		kubeClient:   clientset,
+		nodeProvider: mockNP,
+		recorder:     recorder,
+	}
+
+	assert.True(t, isWindowsNode(testNode))
+	err := cnc.reconcileWindowsNode(context.TODO(), testNode)
+	assert.NoError(t, err)
+
+	actualNode, err := clientset.CoreV1().Nodes().Get(context.TODO(), "node01", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		consts.NodeOSImageSKUAnnotation:      "2022-datacenter-core-smalldisk",
+		consts.NodeLicenseTypeAnnotation:     "Windows_Server",
+		consts.NodeEphemeralOSDiskAnnotation: "true",
+	}, actualNode.Annotations)
+	assert.Equal(t, "Warning VMProvisioningFailed extension vmssCSE: ProvisioningState/failed/1: exit code 1", <-recorder.Events)
+
+	// The same failures are reported only once.
+	err = cnc.reconcileWindowsNode(context.TODO(), actualNode)
+	assert.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestGetVMAnnotations(t *testing.T) {
+	assert.Empty(t, getVMAnnotations(&compute.VirtualMachine{}))
+	assert.Equal(t, map[string]string{
+		consts.NodeEphemeralOSDiskAnnotation: "false",
+	}, getVMAnnotations(&compute.VirtualMachine{
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			StorageProfile: &compute.StorageProfile{OsDisk: &compute.OSDisk{}},
+		},
+	}))
+}
+
 // Tests that node address changes are detected correctly
 func TestNodeAddressesChangeDetected(t *testing.T) {
 	testcases := []struct {
@@ -35,8 +35,11 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -52,21 +55,29 @@ import (
 	"k8s.io/klog/v2"
 
 	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationgatewayclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/azurefirewallclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/blobclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/containerserviceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/deploymentclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/diagnosticsettingclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/diskclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/fileclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/flowlogclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/metricclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatednsclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatednszonegroupclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privateendpointclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/resourcegraphclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/routeclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/routetableclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/skuclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/snapshotclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/storageaccountclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient"
@@ -90,6 +101,8 @@ var (
 	defaultExcludeMasterFromStandardLB = true
 	// Outbound SNAT is enabled by default.
 	defaultDisableOutboundSNAT = false
+	// Outbound SNAT is disabled by default when the outbound traffic is handled by the NAT gateway.
+	defaultDisableOutboundSNATWithNATGateway = true
 	// RouteUpdateWaitingInSeconds is 30 seconds by default.
 	defaultRouteUpdateWaitingInSeconds = 30
 	nodeOutOfServiceTaint              = &v1.Taint{
@@ -140,6 +153,13 @@ type Config struct {
 	RouteTableName string `json:"routeTableName,omitempty" yaml:"routeTableName,omitempty"`
 	// The name of the resource group that the RouteTable is deployed in
 	RouteTableResourceGroup string `json:"routeTableResourceGroup,omitempty" yaml:"routeTableResourceGroup,omitempty"`
+	// RouteTableSubscriptionID is the ID of the subscription that the RouteTable is deployed in, e.g., the one of a
+	// hub VNet peered with the cluster VNet. If not set, the network resource subscription is used.
+	// When set, the node subnets are validated to be associated with the RouteTable.
+	RouteTableSubscriptionID string `json:"routeTableSubscriptionID,omitempty" yaml:"routeTableSubscriptionID,omitempty"`
+	// RouteTableCredentials is the credentials profile used to manage the RouteTable and its routes.
+	// If not set, the credentials of the cluster are used. The tenant of the cluster is used if tenantId is not set.
+	RouteTableCredentials *ratelimitconfig.AzureAuthConfig `json:"routeTableCredentials,omitempty" yaml:"routeTableCredentials,omitempty"`
 	// (Optional) The name of the availability set that should be used as the load balancer backend
 	// If this is set, the Azure cloudprovider will only add nodes from that availability set to the load
 	// balancer backend pool. If this is not set, and multiple agent pools (availability sets) are used, then
@@ -167,6 +187,15 @@ type Config struct {
 	// the `Tags` is changed. However, the old tags would be deleted if they are neither included in `Tags` nor
 	// in `SystemTags` after the update of `Tags`.
 	SystemTags string `json:"systemTags,omitempty" yaml:"systemTags,omitempty"`
+	// TagTemplates determines the tags applied to each type of resources in addition to `Tags` and `TagsMap`,
+	// keyed by the resource type: publicIPAddress, loadBalancer, privateLinkService and routeTable. The tag values
+	// may contain the placeholders {clusterName}, {serviceNamespace}, {serviceName} (public IPs and private link
+	// services) and {nodePool} (load balancers). The templated tags take precedence over `Tags` and `TagsMap`, and
+	// are reconciled in the same way, so the user tags listed in `SystemTags` are kept.
+	TagTemplates map[string]map[string]string `json:"tagTemplates,omitempty" yaml:"tagTemplates,omitempty"`
+	// SecurityRuleDescriptionTemplate is the description of the security rules of the services, which may contain
+	// the placeholders {clusterName}, {serviceNamespace} and {serviceName}. The shared security rules have no description.
+	SecurityRuleDescriptionTemplate string `json:"securityRuleDescriptionTemplate,omitempty" yaml:"securityRuleDescriptionTemplate,omitempty"`
 	// Sku of Load Balancer and Public IP. Candidate values are: basic and standard.
 	// If not set, it will be default to basic.
 	LoadBalancerSku string `json:"loadBalancerSku,omitempty" yaml:"loadBalancerSku,omitempty"`
@@ -183,6 +212,49 @@ type Config struct {
 	//   "external": for external LoadBalancer
 	//   "all": for both internal and external LoadBalancer
 	PreConfiguredBackendPoolLoadBalancerTypes string `json:"preConfiguredBackendPoolLoadBalancerTypes,omitempty" yaml:"preConfiguredBackendPoolLoadBalancerTypes,omitempty"`
+	// LoadBalancerClass is the spec.loadBalancerClass of the services reconciled by the cloud provider in addition
+	// to the services without a class. If not set, only the services without a class are reconciled.
+	LoadBalancerClass string `json:"loadBalancerClass,omitempty" yaml:"loadBalancerClass,omitempty"`
+	// IgnoreServicesWithoutLoadBalancerClass stops reconciling the services without a spec.loadBalancerClass,
+	// so that they can be handled by another load balancer controller. It requires LoadBalancerClass to be set.
+	IgnoreServicesWithoutLoadBalancerClass bool `json:"ignoreServicesWithoutLoadBalancerClass,omitempty" yaml:"ignoreServicesWithoutLoadBalancerClass,omitempty"`
+	// ApplicationGatewayName is the name of an existing Application Gateway. The services with the annotation
+	// "service.beta.kubernetes.io/azure-application-gateway: true" are exposed by its HTTP listeners.
+	ApplicationGatewayName string `json:"applicationGatewayName,omitempty" yaml:"applicationGatewayName,omitempty"`
+	// ApplicationGatewayResourceGroup is the resource group of the Application Gateway. If not set, it
+	// defaults to ResourceGroup.
+	ApplicationGatewayResourceGroup string `json:"applicationGatewayResourceGroup,omitempty" yaml:"applicationGatewayResourceGroup,omitempty"`
+	// AzureFirewallName is the name of an existing Azure Firewall with classic rules. The services with the annotation
+	// "service.beta.kubernetes.io/azure-firewall-dnat: true" are exposed by the internal load balancer and the DNAT
+	// rules of the firewall, so that all the ingress traffic traverses the firewall.
+	AzureFirewallName string `json:"azureFirewallName,omitempty" yaml:"azureFirewallName,omitempty"`
+	// AzureFirewallResourceGroup is the resource group of the Azure Firewall. If not set, it defaults to ResourceGroup.
+	AzureFirewallResourceGroup string `json:"azureFirewallResourceGroup,omitempty" yaml:"azureFirewallResourceGroup,omitempty"`
+	// AzureFirewallNATRuleCollectionPriority is the priority of the NAT rule collection of the DNAT rules managed by
+	// the cloud provider, which must be unique in the firewall. Defaults to 1000.
+	AzureFirewallNATRuleCollectionPriority int32 `json:"azureFirewallNATRuleCollectionPriority,omitempty" yaml:"azureFirewallNATRuleCollectionPriority,omitempty"`
+
+	// EnsureHealthProbeSecurityRule creates a security rule allowing the health probes from the AzureLoadBalancer
+	// service tag to the probe ports of the service when they are denied by other rules of the security group, e.g.
+	// when the cluster uses a deny-by-default security group. If not set, only a warning event is emitted.
+	EnsureHealthProbeSecurityRule bool `json:"ensureHealthProbeSecurityRule,omitempty" yaml:"ensureHealthProbeSecurityRule,omitempty"`
+
+	// NodePortSecurityRules manages the security rules restricting the node port range of the nodes to the health
+	// probes of the load balancers and the configured CIDRs. If not set, the rules are not managed.
+	NodePortSecurityRules *NodePortSecurityRulesConfig `json:"nodePortSecurityRules,omitempty" yaml:"nodePortSecurityRules,omitempty"`
+
+	// ServiceResync configures the periodic full reconciliation of all the load balancer services by the service
+	// controller. If not set, the services are only reconciled when they are changed.
+	ServiceResync *ReconcileIntervalConfig `json:"serviceResync,omitempty" yaml:"serviceResync,omitempty"`
+	// NodeSync configures the periodic synchronization of the nodes of the load balancers by the service controller.
+	// If not set, the default period of the service controller is used.
+	NodeSync *ReconcileIntervalConfig `json:"nodeSync,omitempty" yaml:"nodeSync,omitempty"`
+	// EnableNodeChangeDetection only lets the updates of the nodes relevant to the load balancers trigger the
+	// synchronization of the nodes by the service controller, i.e. the changes of the exclusion labels, the labels
+	// selected by the load balancer and node pool configurations, the provider IDs, addresses and readiness. The
+	// relevant updates not noticed by the service controller, e.g. of the labels selected by loadBalancerNodeExclusion,
+	// trigger the synchronization as well.
+	EnableNodeChangeDetection bool `json:"enableNodeChangeDetection,omitempty" yaml:"enableNodeChangeDetection,omitempty"`
 
 	// DisableAvailabilitySetNodes disables VMAS nodes support when "VMType" is set to "vmss".
 	DisableAvailabilitySetNodes bool `json:"disableAvailabilitySetNodes,omitempty" yaml:"disableAvailabilitySetNodes,omitempty"`
@@ -205,12 +277,30 @@ type Config struct {
 	// ExcludeMasterFromStandardLB excludes master nodes from standard load balancer.
 	// If not set, it will be default to true.
 	ExcludeMasterFromStandardLB *bool `json:"excludeMasterFromStandardLB,omitempty" yaml:"excludeMasterFromStandardLB,omitempty"`
+	// LoadBalancerNodeExclusion excludes the nodes selected by labels or taints from the load balancers, in addition to
+	// the nodes labeled with "node.kubernetes.io/exclude-from-external-load-balancers". The nodes are re-evaluated
+	// whenever they are updated, so they can be pulled out of the backend pools by labeling without restarting.
+	LoadBalancerNodeExclusion *LoadBalancerNodeExclusionConfig `json:"loadBalancerNodeExclusion,omitempty" yaml:"loadBalancerNodeExclusion,omitempty"`
 	// DisableOutboundSNAT disables the outbound SNAT for public load balancer rules.
 	// It should only be set when loadBalancerSku is standard. If not set, it will be default to false.
 	DisableOutboundSNAT *bool `json:"disableOutboundSNAT,omitempty" yaml:"disableOutboundSNAT,omitempty"`
 
 	// Maximum allowed LoadBalancer Rule Count is the limit enforced by Azure Load balancer
 	MaximumLoadBalancerRuleCount int `json:"maximumLoadBalancerRuleCount,omitempty" yaml:"maximumLoadBalancerRuleCount,omitempty"`
+	// MaximumLoadBalancerFrontendIPConfigurationCount is the maximum number of frontend IP configurations of a load
+	// balancer enforced by the load balancer limit guardrails. Default is 600.
+	MaximumLoadBalancerFrontendIPConfigurationCount int `json:"maximumLoadBalancerFrontendIPConfigurationCount,omitempty" yaml:"maximumLoadBalancerFrontendIPConfigurationCount,omitempty"`
+	// MaximumLoadBalancerProbeCount is the maximum number of health probes of a load balancer enforced by the load
+	// balancer limit guardrails. The probes are not limited if it is not set.
+	MaximumLoadBalancerProbeCount int `json:"maximumLoadBalancerProbeCount,omitempty" yaml:"maximumLoadBalancerProbeCount,omitempty"`
+	// EnableLoadBalancerLimitGuardrails refuses, with a warning event on the service, to update a load balancer if
+	// the update would add frontend IP configurations, rules or probes beyond maximumLoadBalancerFrontendIPConfigurationCount,
+	// maximumLoadBalancerRuleCount or maximumLoadBalancerProbeCount, instead of failing the request at the Azure limits.
+	EnableLoadBalancerLimitGuardrails bool `json:"enableLoadBalancerLimitGuardrails,omitempty" yaml:"enableLoadBalancerLimitGuardrails,omitempty"`
+	// EnableLoadBalancerAutoSelectionOnLimits places the new services on the next eligible load balancer if the
+	// service would exceed the limits of the most eligible one. Only works with multiple standard load balancers and
+	// requires enableLoadBalancerLimitGuardrails to be true.
+	EnableLoadBalancerAutoSelectionOnLimits bool `json:"enableLoadBalancerAutoSelectionOnLimits,omitempty" yaml:"enableLoadBalancerAutoSelectionOnLimits,omitempty"`
 	// Backoff retry limit
 	CloudProviderBackoffRetries int `json:"cloudProviderBackoffRetries,omitempty" yaml:"cloudProviderBackoffRetries,omitempty"`
 	// Backoff duration
@@ -226,6 +316,18 @@ type Config struct {
 	// VmssVirtualMachinesCacheTTLInSeconds sets the cache TTL for vmssVirtualMachines
 	VmssVirtualMachinesCacheTTLInSeconds int `json:"vmssVirtualMachinesCacheTTLInSeconds,omitempty" yaml:"vmssVirtualMachinesCacheTTLInSeconds,omitempty"`
 
+	// NodeAddressCacheTTLInSeconds sets the cache TTL for the addresses of the nodes returned by NodeAddresses.
+	// Default is 60 seconds. A negative value disables the cache.
+	NodeAddressCacheTTLInSeconds int `json:"nodeAddressCacheTTLInSeconds,omitempty" yaml:"nodeAddressCacheTTLInSeconds,omitempty"`
+	// InstanceNotFoundConfirmation delays reporting the VMs of the nodes missing when ARM cannot find them, e.g.,
+	// because of the replication lag or after moving the VMs to another resource group, so that the Node objects
+	// are not deleted before the VMs are confirmed to be gone.
+	InstanceNotFoundConfirmation *InstanceNotFoundConfirmationConfig `json:"instanceNotFoundConfirmation,omitempty" yaml:"instanceNotFoundConfirmation,omitempty"`
+	// DegradedMode enters the degraded mode when ARM is unreachable, e.g., during an outage of the Azure
+	// authentication, in which the node existence checks return the results cached before instead of reporting the
+	// VMs missing, and the writes of the load balancers, the security group and the routes are paused, so that the
+	// nodes are not deleted en masse. Only works in cloud-controller-manager.
+	DegradedMode *DegradedModeConfig `json:"degradedMode,omitempty" yaml:"degradedMode,omitempty"`
 	// VmssFlexCacheTTLInSeconds sets the cache TTL for VMSS Flex
 	VmssFlexCacheTTLInSeconds int `json:"vmssFlexCacheTTLInSeconds,omitempty" yaml:"vmssFlexCacheTTLInSeconds,omitempty"`
 	// VmssFlexVMCacheTTLInSeconds sets the cache TTL for vmss flex vms
@@ -245,20 +347,71 @@ type Config struct {
 	AvailabilitySetsCacheTTLInSeconds int `json:"availabilitySetsCacheTTLInSeconds,omitempty" yaml:"availabilitySetsCacheTTLInSeconds,omitempty"`
 	// PublicIPCacheTTLInSeconds sets the cache TTL for public ip
 	PublicIPCacheTTLInSeconds int `json:"publicIPCacheTTLInSeconds,omitempty" yaml:"publicIPCacheTTLInSeconds,omitempty"`
+	// ComputeSKUCacheTTLInSeconds sets the cache TTL for compute SKUs. Default is one day.
+	ComputeSKUCacheTTLInSeconds int `json:"computeSKUCacheTTLInSeconds,omitempty" yaml:"computeSKUCacheTTLInSeconds,omitempty"`
 	// RouteUpdateWaitingInSeconds is the delay time for waiting route updates to take effect. This waiting delay is added
 	// because the routes are not taken effect when the async route updating operation returns success. Default is 30 seconds.
 	RouteUpdateWaitingInSeconds int `json:"routeUpdateWaitingInSeconds,omitempty" yaml:"routeUpdateWaitingInSeconds,omitempty"`
+	// RouteReconciliationDryRun makes the route controller only log the changes it would make to the route table,
+	// e.g., to review them before managing a route table shared with custom routes. The route operations changing
+	// the route table fail, so the routes of the nodes are not reported as created. Default is false.
+	RouteReconciliationDryRun bool `json:"routeReconciliationDryRun,omitempty" yaml:"routeReconciliationDryRun,omitempty"`
+	// RouteNextHops routes the pod CIDRs of the node pools through network virtual appliances instead of the nodes,
+	// e.g., to inspect the east-west traffic of the pods. The pod CIDRs of the other node pools are routed to the nodes.
+	RouteNextHops []RouteNextHopConfig `json:"routeNextHops,omitempty" yaml:"routeNextHops,omitempty"`
+	// InstancesWebhook delegates the Instances and InstancesV2 calls to an external gRPC endpoint, e.g., to serve
+	// custom provider ID schemes or hybrid nodes. The calls not handled by the endpoint are served by Azure.
+	InstancesWebhook *InstancesWebhookConfig `json:"instancesWebhook,omitempty" yaml:"instancesWebhook,omitempty"`
+	// ServiceIPChangeNotification notifies the changes of the external IPs of the load balancer services, e.g. when
+	// they are allocated, re-allocated or released, so that the DNS records and firewall rules outside the cluster
+	// can be updated immediately.
+	ServiceIPChangeNotification *ServiceIPChangeNotificationConfig `json:"serviceIPChangeNotification,omitempty" yaml:"serviceIPChangeNotification,omitempty"`
+	// SecurityLogging enables the diagnostic settings of the load balancers and the security group managed by the
+	// provider, and the flow logs of the security group, when the provider starts, so that the security logs are
+	// collected consistently across the clusters. Only works in cloud-controller-manager.
+	SecurityLogging *SecurityLoggingConfig `json:"securityLogging,omitempty" yaml:"securityLogging,omitempty"`
 	// The user agent for Azure customer usage attribution
 	UserAgent string `json:"userAgent,omitempty" yaml:"userAgent,omitempty"`
+	// UserAgentSuffix is appended to the user agent of all the requests to Azure, e.g., to tell the clusters or the
+	// deployments apart in the Azure support cases.
+	UserAgentSuffix string `json:"userAgentSuffix,omitempty" yaml:"userAgentSuffix,omitempty"`
+	// ClusterName is put into the x-ms-client-annotation header of all the requests to ARM together with the controller
+	// and the reconcile ID of the operation, so that Azure support can correlate the throttling and the failures with
+	// the clusters and the controllers. The reconcile ID is sent as the x-ms-correlation-request-id as well.
+	ClusterName string `json:"clusterName,omitempty" yaml:"clusterName,omitempty"`
 	// LoadBalancerBackendPoolConfigurationType defines how vms join the load balancer backend pools. Supported values
 	// are `nodeIPConfiguration`, `nodeIP` and `podIP`.
 	// `nodeIPConfiguration`: vm network interfaces will be attached to the inbound backend pool of the load balancer (default);
 	// `nodeIP`: vm private IPs will be attached to the inbound backend pool of the load balancer;
-	// `podIP`: pod IPs will be attached to the inbound backend pool of the load balancer (not supported yet).
+	// `podIP`: the IPs of the pods backing each service will be attached to a dedicated inbound backend pool of the service,
+	// which requires routable pod IPs, e.g., Azure CNI. The pods are load balanced directly at their target ports.
+	// Other strategies can be registered with RegisterBackendPoolType and selected by their registered names.
 	LoadBalancerBackendPoolConfigurationType string `json:"loadBalancerBackendPoolConfigurationType,omitempty" yaml:"loadBalancerBackendPoolConfigurationType,omitempty"`
 	// PutVMSSVMBatchSize defines how many requests the client send concurrently when putting the VMSS VMs.
 	// If it is smaller than or equal to zero, the request will be sent one by one in sequence (default).
 	PutVMSSVMBatchSize int `json:"putVMSSVMBatchSize" yaml:"putVMSSVMBatchSize"`
+	// VMSSVMUpdateChunkSize defines the max number of VMSS VMs updated in one chunk when joining or leaving the
+	// backend pools. Default is 100.
+	VMSSVMUpdateChunkSize int `json:"vmssVMUpdateChunkSize,omitempty" yaml:"vmssVMUpdateChunkSize,omitempty"`
+	// VMSSVMUpdateChunkConcurrency defines how many chunks of VMSS VMs are updated in parallel. The VMs of each chunk
+	// are sent PutVMSSVMBatchSize at a time, so the number of concurrent requests is the product of both. Default is 1.
+	VMSSVMUpdateChunkConcurrency int `json:"vmssVMUpdateChunkConcurrency,omitempty" yaml:"vmssVMUpdateChunkConcurrency,omitempty"`
+	// HostUpdateConcurrency defines how many hosts of an availability set or a VMSS Flex are updated in parallel
+	// when ensuring them in the backend pools. The VM sets are updated in parallel. Default is 10.
+	HostUpdateConcurrency int `json:"hostUpdateConcurrency,omitempty" yaml:"hostUpdateConcurrency,omitempty"`
+	// LoadBalancerBackendNICSelector selects the network interface of the availability set nodes which joins the
+	// backend pools of the load balancer, by the subnet of the ip configurations or the tag of the network interface.
+	// The node annotation "kubernetes.azure.com/load-balancer-backend-nic" takes precedence over it. The primary
+	// network interface is used if none of the network interfaces of the node matches.
+	LoadBalancerBackendNICSelector *LoadBalancerBackendNICSelector `json:"loadBalancerBackendNICSelector,omitempty" yaml:"loadBalancerBackendNICSelector,omitempty"`
+	// NodeShutdownPowerStates configures whether the node is marked as shut down for each power state of the VM.
+	// By default, the nodes of stopped, deallocated and hibernated VMs are marked as shut down.
+	NodeShutdownPowerStates *NodeShutdownPowerStates `json:"nodeShutdownPowerStates,omitempty" yaml:"nodeShutdownPowerStates,omitempty"`
+	// PreserveDeallocatedNodes keeps the nodes of deallocated and hibernated VMs out of the load balancer backend
+	// pools until the VMs are started again. The nodes are labeled with "node.kubernetes.io/exclude-from-external-load-balancers"
+	// and report the "VMDeallocated" condition while the VMs are deallocated. The Node objects are kept since the
+	// deallocated VMs still exist. Only works in cloud-controller-manager.
+	PreserveDeallocatedNodes bool `json:"preserveDeallocatedNodes,omitempty" yaml:"preserveDeallocatedNodes,omitempty"`
 	// PrivateLinkServiceResourceGroup determines the specific resource group of the private link services user want to use
 	PrivateLinkServiceResourceGroup string `json:"privateLinkServiceResourceGroup,omitempty" yaml:"privateLinkServiceResourceGroup,omitempty"`
 
@@ -273,14 +426,335 @@ type Config struct {
 	// If the length is not 0, it is assumed the multiple standard load balancers mode is on. In this case,
 	// there must be one configuration named "<clustername>" or an error will be reported.
 	MultipleStandardLoadBalancerConfigurations []MultipleStandardLoadBalancerConfiguration `json:"multipleStandardLoadBalancerConfigurations,omitempty" yaml:"multipleStandardLoadBalancerConfigurations,omitempty"`
+	// MultipleStandardLoadBalancerConfigurationNamespace is the namespace of the MultipleStandardLoadBalancerConfiguration
+	// custom resources watched at runtime. If any custom resource exists in the namespace, the custom resources replace
+	// MultipleStandardLoadBalancerConfigurations, which are used again once all the custom resources are deleted. The
+	// name of a custom resource is the name of the load balancer, and its spec is a MultipleStandardLoadBalancerConfigurationSpec.
+	// The changes are applied by the next reconciliation of the services and the nodes. Only works with the IP-based
+	// backend pools. Disabled if not set.
+	MultipleStandardLoadBalancerConfigurationNamespace string `json:"multipleStandardLoadBalancerConfigurationNamespace,omitempty" yaml:"multipleStandardLoadBalancerConfigurationNamespace,omitempty"`
+	// OutboundType is how the outbound traffic of the nodes is handled. Supported values are "loadBalancer" (default)
+	// and "natGateway". With "natGateway", the subnet of the nodes must be associated with a NAT gateway, the outbound
+	// rules are not created and the outbound SNAT of the load balancing rules is disabled. Only works with the standard
+	// load balancer.
+	OutboundType string `json:"outboundType,omitempty" yaml:"outboundType,omitempty"`
+	// IPv6OutboundConfig configures the IPv6 outbound connectivity of the nodes in the IPv6 backend pools of the
+	// external standard load balancers in dual-stack clusters. The IPv6 outbound rules are not managed if it is not set.
+	IPv6OutboundConfig *IPv6OutboundConfig `json:"ipv6OutboundConfig,omitempty" yaml:"ipv6OutboundConfig,omitempty"`
+	// NodePoolOutboundConfigurations assigns the public IP prefixes to the node pools selected by labels, so that the
+	// outbound traffic of different node pools egresses from different IPs, e.g., for allow-listing. Only works with the
+	// standard load balancer and the nodeIP backend pool type, and requires disableOutboundSNAT to be true.
+	NodePoolOutboundConfigurations []NodePoolOutboundConfiguration `json:"nodePoolOutboundConfigurations,omitempty" yaml:"nodePoolOutboundConfigurations,omitempty"`
+	// SNATExhaustionAdvisor checks the SNAT port utilization of the nodes of the node pool outbound configurations
+	// from Azure Monitor, and warns by metrics and events of the nodes when a node pool approaches SNAT exhaustion. The
+	// exhaustion is mitigated as configured by the node pool outbound configurations. Only works in cloud-controller-manager.
+	SNATExhaustionAdvisor *SNATExhaustionAdvisorConfig `json:"snatExhaustionAdvisor,omitempty" yaml:"snatExhaustionAdvisor,omitempty"`
+	// NamespaceDefaultServiceAnnotations maps the namespaces to the default annotations of the load balancer services
+	// in them, e.g., to default all the services in a namespace to the internal load balancer in a subnet. A default
+	// annotation is applied when the service omits it and the AzureLoadBalancerConfiguration of the service does not
+	// set its equivalent field. Only the annotations prefixed with service.beta.kubernetes.io/ can be defaulted.
+	NamespaceDefaultServiceAnnotations map[string]map[string]string `json:"namespaceDefaultServiceAnnotations,omitempty" yaml:"namespaceDefaultServiceAnnotations,omitempty"`
 
 	// DisableAPICallCache disables the cache for Azure API calls. It is for ARG support and not all resources will be disabled.
 	DisableAPICallCache bool `json:"disableAPICallCache,omitempty" yaml:"disableAPICallCache,omitempty"`
+	// EnableLoadBalancerDesiredStateCache persists the fingerprint of the desired state of each service reconciled
+	// successfully in the configmap kube-system/cloud-provider-azure-desired-states, and skips the reconcile of the
+	// service when neither the service, the addresses and the exclusion of the nodes, the membership of the backend
+	// pools nor the etags of the load balancer and the security group in Azure changed since then. Telling that costs
+	// a conditional GET of the load balancer and a GET of the security group bypassing the cache on each sync, and the
+	// same two GETs after each successful reconcile to compute the fingerprint. The services with the Azure Firewall
+	// DNAT rules, the private link services, the internal and external counterparts or the dedicated backend pools are
+	// always reconciled.
+	EnableLoadBalancerDesiredStateCache bool `json:"enableLoadBalancerDesiredStateCache,omitempty" yaml:"enableLoadBalancerDesiredStateCache,omitempty"`
 
 	// RouteUpdateIntervalInSeconds is the interval for updating routes. Default is 30 seconds.
 	RouteUpdateIntervalInSeconds int `json:"routeUpdateIntervalInSeconds,omitempty" yaml:"routeUpdateIntervalInSeconds,omitempty"`
-	// LoadBalancerBackendPoolUpdateIntervalInSeconds is the interval for updating load balancer backend pool of local services. Default is 30 seconds.
+	// LoadBalancerBackendPoolUpdateIntervalInSeconds is the interval for updating load balancer backend pool of local services,
+	// and for replacing the changed private IPs of nodes in the IP-based backend pools. Default is 30 seconds.
 	LoadBalancerBackendPoolUpdateIntervalInSeconds int `json:"loadBalancerBackendPoolUpdateIntervalInSeconds,omitempty" yaml:"loadBalancerBackendPoolUpdateIntervalInSeconds,omitempty"`
+	// LoadBalancerBackendPoolRepairIntervalInSeconds is the interval for recomputing the backend pools of local services
+	// from endpoint slices and repairing any drift. Default is 300 seconds. A negative value disables the repair loop.
+	LoadBalancerBackendPoolRepairIntervalInSeconds int `json:"loadBalancerBackendPoolRepairIntervalInSeconds,omitempty" yaml:"loadBalancerBackendPoolRepairIntervalInSeconds,omitempty"`
+	// AvailabilitySetNICReconcileIntervalInSeconds is the interval for repairing the backend pool references of the NICs
+	// of availability set nodes. Default is 600 seconds. A negative value disables the reconciliation.
+	AvailabilitySetNICReconcileIntervalInSeconds int `json:"availabilitySetNICReconcileIntervalInSeconds,omitempty" yaml:"availabilitySetNICReconcileIntervalInSeconds,omitempty"`
+	// VMSSConvergenceIntervalInSeconds is the interval for retrying the update of the VMSS VMs whose backend pool membership
+	// has not converged to the desired state. Default is 60 seconds. A negative value disables the retries.
+	VMSSConvergenceIntervalInSeconds int `json:"vmssConvergenceIntervalInSeconds,omitempty" yaml:"vmssConvergenceIntervalInSeconds,omitempty"`
+	// LoadBalancerBackendHealthReportIntervalInSeconds is the interval for querying the backend health of the load
+	// balancing rules of the services, which is reported by metrics and events of the services. The backend health is
+	// only available on standard load balancers. If not set or not positive, the backend health is not reported.
+	LoadBalancerBackendHealthReportIntervalInSeconds int `json:"loadBalancerBackendHealthReportIntervalInSeconds,omitempty" yaml:"loadBalancerBackendHealthReportIntervalInSeconds,omitempty"`
+
+	// LoadBalancerProvisioningTimeoutInSeconds is the timeout of creating or updating a load balancer, including
+	// waiting for the long-running operation to complete. When it is exceeded, the operation is canceled and the
+	// reconciliation of the service is retried. If not set or not positive, the polling duration of the client is used.
+	LoadBalancerProvisioningTimeoutInSeconds int `json:"loadBalancerProvisioningTimeoutInSeconds,omitempty" yaml:"loadBalancerProvisioningTimeoutInSeconds,omitempty"`
+	// PrivateLinkServiceProvisioningTimeoutInSeconds is the timeout of creating or updating a private link service.
+	// If not set or not positive, the polling duration of the client is used.
+	PrivateLinkServiceProvisioningTimeoutInSeconds int `json:"privateLinkServiceProvisioningTimeoutInSeconds,omitempty" yaml:"privateLinkServiceProvisioningTimeoutInSeconds,omitempty"`
+	// PublicIPProvisioningTimeoutInSeconds is the timeout of creating or updating a public IP address.
+	// If not set or not positive, the polling duration of the client is used.
+	PublicIPProvisioningTimeoutInSeconds int `json:"publicIPProvisioningTimeoutInSeconds,omitempty" yaml:"publicIPProvisioningTimeoutInSeconds,omitempty"`
+	// EnableAsyncOperationTracking persists the in-flight long-running operations in a configmap, so that they are
+	// resumed after the cloud-controller-manager restarts instead of being conflicted by duplicate requests.
+	EnableAsyncOperationTracking bool `json:"enableAsyncOperationTracking,omitempty" yaml:"enableAsyncOperationTracking,omitempty"`
+
+	// ReadOnlyMode makes the cloud provider reconcile nothing, e.g., for the standby clusters in disaster recovery sharing
+	// the load balancers with the primary cluster. The services get the status of their existing load balancers, and
+	// the drift between the load balancers and the services is reported by metrics and events of the services. The
+	// routes are not supported in the read-only mode. Only works in cloud-controller-manager.
+	ReadOnlyMode bool `json:"readOnlyMode,omitempty" yaml:"readOnlyMode,omitempty"`
+	// LoadBalancerDriftVerificationIntervalInSeconds is the interval for verifying the load balancers of the services
+	// in the read-only mode. Default is 300 seconds. A negative value disables the verification.
+	LoadBalancerDriftVerificationIntervalInSeconds int `json:"loadBalancerDriftVerificationIntervalInSeconds,omitempty" yaml:"loadBalancerDriftVerificationIntervalInSeconds,omitempty"`
+	// ServiceCostAttributionIntervalInSeconds is the interval for exporting the Azure resources consumed by each
+	// LoadBalancer service as metrics, e.g., the public IPs, the load balancing rules and the private link services,
+	// so that the networking costs can be attributed to the services. Disabled if not set. Only works in cloud-controller-manager.
+	ServiceCostAttributionIntervalInSeconds int `json:"serviceCostAttributionIntervalInSeconds,omitempty" yaml:"serviceCostAttributionIntervalInSeconds,omitempty"`
+	// BackendPoolSnapshotIntervalInSeconds is the interval for mirroring the addresses of the backend pools used by the
+	// services, with the nodes and the services they belong to, to the configmap kube-system/cloud-provider-azure-backend-pools,
+	// so that the Azure state can be audited without Azure credentials. Disabled if not set. Only works in cloud-controller-manager.
+	BackendPoolSnapshotIntervalInSeconds int `json:"backendPoolSnapshotIntervalInSeconds,omitempty" yaml:"backendPoolSnapshotIntervalInSeconds,omitempty"`
+	// LoadBalancerMetricsExportIntervalInSeconds is the interval for querying Azure Monitor for the SNAT port usage and
+	// the data path availability of the frontend IPs of the LoadBalancer services, which are exported as metrics labeled
+	// by the services, e.g., for alerting on the SNAT port exhaustion. The metrics are only available on standard load
+	// balancers. Disabled if not set. Only works in cloud-controller-manager.
+	LoadBalancerMetricsExportIntervalInSeconds int `json:"loadBalancerMetricsExportIntervalInSeconds,omitempty" yaml:"loadBalancerMetricsExportIntervalInSeconds,omitempty"`
+	// EnableHealthProbeAutoDetection derives the protocol, the request path and the port of the health probes from the
+	// readiness probes of the pods selected by the services, for the service ports without any health probe annotation
+	// or app protocol. It requires watching all pods. Only works in cloud-controller-manager.
+	EnableHealthProbeAutoDetection bool `json:"enableHealthProbeAutoDetection,omitempty" yaml:"enableHealthProbeAutoDetection,omitempty"`
+	// EnableFrontendIPConfigAdoption adopts the orphaned frontend IP configurations and public IPs of the services
+	// recreated with new UIDs, e.g., after restoring the cluster, by matching their IPs, instead of creating duplicate
+	// ones. The adopted frontend IP configurations are renamed after the services. Only works in cloud-controller-manager.
+	EnableFrontendIPConfigAdoption bool `json:"enableFrontendIPConfigAdoption,omitempty" yaml:"enableFrontendIPConfigAdoption,omitempty"`
+
+	// ResourceNamingMode determines how the names of load balancer sub-resources exceeding the length limit are generated.
+	// Supported values are "compatible" (default) and "hashed". In the "hashed" mode, the dedicated backend pools of local
+	// services, the load balancing rules and the health probes are truncated and suffixed with a hash of the full name.
+	ResourceNamingMode string `json:"resourceNamingMode,omitempty" yaml:"resourceNamingMode,omitempty"`
+	// LocalServiceBackendPoolNameTemplate is the name template of the dedicated backend pools of local services
+	// when using multiple standard load balancers. The placeholders {namespace}, {name} and {hash} are replaced by
+	// the namespace, the name and the hash of the namespaced name of the service. Default is "{namespace}-{name}".
+	// Existing backend pools with names generated by the default template or PreviousLocalServiceBackendPoolNameTemplates
+	// are migrated to the new names automatically. The backend pools named by other templates are not recognized.
+	LocalServiceBackendPoolNameTemplate string `json:"localServiceBackendPoolNameTemplate,omitempty" yaml:"localServiceBackendPoolNameTemplate,omitempty"`
+	// PreviousLocalServiceBackendPoolNameTemplates are the name templates used before LocalServiceBackendPoolNameTemplate
+	// is changed, so that the dedicated backend pools named by them can be migrated instead of being leaked.
+	PreviousLocalServiceBackendPoolNameTemplates []string `json:"previousLocalServiceBackendPoolNameTemplates,omitempty" yaml:"previousLocalServiceBackendPoolNameTemplates,omitempty"`
+
+	// HTTPSProxy is the URL of the proxy of the outbound HTTPS requests to ARM and AAD, e.g., http://proxy.example.com:3128.
+	// It takes precedence over the HTTPS_PROXY environment variable.
+	HTTPSProxy string `json:"httpsProxy,omitempty" yaml:"httpsProxy,omitempty"`
+	// NoProxy is a comma-separated list of the hosts, domains, IPs and CIDRs bypassing HTTPSProxy.
+	NoProxy string `json:"noProxy,omitempty" yaml:"noProxy,omitempty"`
+	// CABundlePath is the path of a PEM bundle of the CA certificates trusted by the outbound requests
+	// to ARM, AAD and IMDS in addition to the system ones, e.g., the CA of a TLS-intercepting proxy.
+	CABundlePath string `json:"caBundlePath,omitempty" yaml:"caBundlePath,omitempty"`
+}
+
+// LoadBalancerBackendNICSelector selects the network interface and the ip configuration of the nodes with
+// multiple network interfaces which join the backend pools of the load balancer.
+type LoadBalancerBackendNICSelector struct {
+	// SubnetName selects the network interface with an ip configuration in the subnet. The ip configuration
+	// in the subnet joins the backend pools.
+	SubnetName string `json:"subnetName,omitempty" yaml:"subnetName,omitempty"`
+	// TagKey selects the network interface with the tag.
+	TagKey string `json:"tagKey,omitempty" yaml:"tagKey,omitempty"`
+	// TagValue is the value of the tag. Any value matches if it is empty.
+	TagValue string `json:"tagValue,omitempty" yaml:"tagValue,omitempty"`
+}
+
+// NodeShutdownPowerStates configures the behavior of the nodes in each power state of the VM. The behavior
+// can be "Taint" (default), which marks the node as shut down, or "Ignore", which leaves the node untouched.
+// Ignoring a state is useful when the VMs are stopped and started by cost-saving automation.
+type NodeShutdownPowerStates struct {
+	// Stopped is the behavior of the nodes of stopped VMs.
+	Stopped string `json:"stopped,omitempty" yaml:"stopped,omitempty"`
+	// Deallocated is the behavior of the nodes of deallocating and deallocated VMs.
+	Deallocated string `json:"deallocated,omitempty" yaml:"deallocated,omitempty"`
+	// Hibernated is the behavior of the nodes of hibernated VMs.
+	Hibernated string `json:"hibernated,omitempty" yaml:"hibernated,omitempty"`
+}
+
+// LoadBalancerNodeExclusionConfig selects the nodes to be excluded from the load balancers. A node is excluded if it
+// matches the node selector or has any of the taints.
+type LoadBalancerNodeExclusionConfig struct {
+	// NodeSelector excludes the nodes matching the label selector.
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty" yaml:"nodeSelector,omitempty"`
+	// TaintKeys excludes the nodes having a taint with any of the keys, regardless of its value and effect.
+	TaintKeys []string `json:"taintKeys,omitempty" yaml:"taintKeys,omitempty"`
+	// ReconcileIntervalInSeconds is the interval for removing the newly excluded nodes from the IP-based backend pools,
+	// instead of waiting for the next reconciliation of the services. Default is 30 seconds. A negative value disables
+	// the removal. The nodes are added back to the backend pools by the next reconciliation of the services.
+	ReconcileIntervalInSeconds int `json:"reconcileIntervalInSeconds,omitempty" yaml:"reconcileIntervalInSeconds,omitempty"`
+}
+
+// ReconcileIntervalConfig configures the interval of a periodic reconciliation. The interval is jittered once by
+// each replica of the cloud controller manager, so that the replicas do not reconcile at the same time.
+type ReconcileIntervalConfig struct {
+	// IntervalInSeconds is the interval of the reconciliation. A non-positive value keeps the default behavior.
+	IntervalInSeconds int `json:"intervalInSeconds,omitempty" yaml:"intervalInSeconds,omitempty"`
+	// JitterFactor stretches the interval by a random factor in [0, JitterFactor). Default is 0, i.e. no jitter.
+	JitterFactor float64 `json:"jitterFactor,omitempty" yaml:"jitterFactor,omitempty"`
+}
+
+// NodePortSecurityRulesConfig configures the security rules of the node port range in the security group set by
+// securityGroupName. For each IP family of the nodes, the rules allow the traffic to the node port range of the
+// subnets of the nodes from the AzureLoadBalancer service tag and the allowed source CIDRs, and deny the traffic
+// from the other sources, including the virtual network unless it is allowed. The rules are updated when the node
+// port range or the subnets of the nodes change. The load balancer rules of the services with floating IP disabled
+// are still allowed by the security rules of the services, which have higher priorities.
+type NodePortSecurityRulesConfig struct {
+	// Enabled enables the security rules. The existing rules are removed if it is false.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// NodePortRange is the node port range of the cluster, e.g. "30000-32767", which is the default.
+	NodePortRange string `json:"nodePortRange,omitempty" yaml:"nodePortRange,omitempty"`
+	// AllowedSourceCIDRs are the CIDRs allowed to access the node port range besides the health probes.
+	AllowedSourceCIDRs []string `json:"allowedSourceCIDRs,omitempty" yaml:"allowedSourceCIDRs,omitempty"`
+	// Priority is the priority of the first security rule, which must not be used by the other rules of the security
+	// group. The rules take up to 6 consecutive priorities. Default is 4000.
+	Priority int32 `json:"priority,omitempty" yaml:"priority,omitempty"`
+	// ReconcileIntervalInSeconds is the interval for reconciling the security rules. Default is 300 seconds.
+	ReconcileIntervalInSeconds int `json:"reconcileIntervalInSeconds,omitempty" yaml:"reconcileIntervalInSeconds,omitempty"`
+}
+
+// InstanceNotFoundConfirmationConfig configures the confirmation of the missing VMs of the nodes. A VM is reported
+// missing only after it is found by neither ARM nor Azure Resource Graph in ConsecutiveChecks consecutive checks
+// spanning at least GracePeriodInSeconds. It is reported to exist until then, and any check finding the VM restarts
+// the confirmation.
+type InstanceNotFoundConfirmationConfig struct {
+	// Enabled enables the confirmation. The VMs not found by ARM are reported missing immediately if it is false.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// ConsecutiveChecks is the number of consecutive checks not finding the VM. Default is 3.
+	ConsecutiveChecks int `json:"consecutiveChecks,omitempty" yaml:"consecutiveChecks,omitempty"`
+	// GracePeriodInSeconds is the minimum time between the first check not finding the VM and the VM being reported
+	// missing. Default is 300 seconds.
+	GracePeriodInSeconds int `json:"gracePeriodInSeconds,omitempty" yaml:"gracePeriodInSeconds,omitempty"`
+}
+
+// DegradedModeConfig configures the degraded mode. ARM is probed periodically, and the degraded mode is entered
+// after the consecutive failed probes, in which the probes back off exponentially, and left after the consecutive
+// successful probes.
+type DegradedModeConfig struct {
+	// Enabled enables the degraded mode.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// ProbeIntervalInSeconds is the interval of probing ARM out of the degraded mode. Default is 30 seconds.
+	ProbeIntervalInSeconds int `json:"probeIntervalInSeconds,omitempty" yaml:"probeIntervalInSeconds,omitempty"`
+	// FailureThreshold is the number of consecutive failed probes entering the degraded mode. Default is 3.
+	FailureThreshold int `json:"failureThreshold,omitempty" yaml:"failureThreshold,omitempty"`
+	// RecoveryThreshold is the number of consecutive successful probes leaving the degraded mode. Default is 2.
+	RecoveryThreshold int `json:"recoveryThreshold,omitempty" yaml:"recoveryThreshold,omitempty"`
+	// MaxBackoffInSeconds is the maximum interval of probing ARM in the degraded mode, which is doubled by each
+	// failed probe. Default is 300 seconds.
+	MaxBackoffInSeconds int `json:"maxBackoffInSeconds,omitempty" yaml:"maxBackoffInSeconds,omitempty"`
+}
+
+// InstancesWebhookConfig configures the external gRPC endpoint serving the Instances and InstancesV2 calls.
+type InstancesWebhookConfig struct {
+	// Endpoint is the gRPC target of the endpoint, e.g. "unix:///var/run/instances.sock" or "dns:///webhook:443".
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// CAFile is the CA bundle verifying the TLS certificate of the endpoint. The system roots are used if empty.
+	CAFile string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	// Insecure connects to the endpoint without TLS, e.g., for a unix socket.
+	Insecure bool `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	// TimeoutInSeconds is the timeout of each call to the endpoint. Default is 5 seconds.
+	TimeoutInSeconds int `json:"timeoutInSeconds,omitempty" yaml:"timeoutInSeconds,omitempty"`
+}
+
+// ServiceIPChangeNotificationConfig configures the notifications of the changes of the external IPs of the services.
+// An event with the reason "ServiceExternalIPsChanged" is recorded on the service for each change.
+type ServiceIPChangeNotificationConfig struct {
+	// WebhookURL is the HTTP(S) URL the changes are posted to as JSON, in addition to the events. Optional.
+	WebhookURL string `json:"webhookURL,omitempty" yaml:"webhookURL,omitempty"`
+	// TimeoutInSeconds is the timeout of each request to the webhook. Default is 5 seconds.
+	TimeoutInSeconds int `json:"timeoutInSeconds,omitempty" yaml:"timeoutInSeconds,omitempty"`
+}
+
+// SecurityLoggingConfig configures the destinations of the diagnostic settings and the flow logs enabled on the
+// managed load balancers and security group. The existing diagnostic settings and flow logs with the same names are
+// updated if they do not send to the configured destinations.
+type SecurityLoggingConfig struct {
+	// WorkspaceID is the resource ID of the Log Analytics workspace the diagnostic settings send to. At least one of
+	// WorkspaceID and StorageAccountID is required.
+	WorkspaceID string `json:"workspaceID,omitempty" yaml:"workspaceID,omitempty"`
+	// StorageAccountID is the resource ID of the storage account the diagnostic settings archive to and the flow logs
+	// are stored in. Required by the flow logs.
+	StorageAccountID string `json:"storageAccountID,omitempty" yaml:"storageAccountID,omitempty"`
+	// DiagnosticSettingName is the name of the diagnostic settings. Default is "cloud-provider-azure".
+	DiagnosticSettingName string `json:"diagnosticSettingName,omitempty" yaml:"diagnosticSettingName,omitempty"`
+	// NetworkWatcherName is the name of the network watcher of the region the flow logs are created in. The flow logs
+	// are not enabled if it is not set.
+	NetworkWatcherName string `json:"networkWatcherName,omitempty" yaml:"networkWatcherName,omitempty"`
+	// NetworkWatcherResourceGroup is the resource group of the network watcher. Default is "NetworkWatcherRG".
+	NetworkWatcherResourceGroup string `json:"networkWatcherResourceGroup,omitempty" yaml:"networkWatcherResourceGroup,omitempty"`
+	// FlowLogRetentionDays is the number of days the flow logs are retained in the storage account. The flow logs
+	// are retained forever if it is 0.
+	FlowLogRetentionDays int32 `json:"flowLogRetentionDays,omitempty" yaml:"flowLogRetentionDays,omitempty"`
+	// IntervalInSeconds is the interval for ensuring the diagnostic settings and the flow logs again after they are
+	// ensured at startup, e.g., to cover the load balancers created later. They are only ensured at startup if it is
+	// not set.
+	IntervalInSeconds int `json:"intervalInSeconds,omitempty" yaml:"intervalInSeconds,omitempty"`
+}
+
+// RouteNextHopConfig configures the network virtual appliance the pod CIDR routes of some node pools go through.
+// The routes keep the VirtualAppliance next hop type, with the IP address of the appliance instead of the node.
+type RouteNextHopConfig struct {
+	// VMSetNames are the names of the availability sets or the scale sets of the node pools. Required.
+	VMSetNames []string `json:"vmSetNames,omitempty" yaml:"vmSetNames,omitempty"`
+	// NextHopIPAddresses are the IP addresses of the network virtual appliance, at most one per IP family. Required.
+	NextHopIPAddresses []string `json:"nextHopIPAddresses,omitempty" yaml:"nextHopIPAddresses,omitempty"`
+}
+
+// IPv6OutboundConfig configures the IPv6 outbound rules. When enabled, a public IPv6 address, a frontend IP
+// configuration and an outbound rule named "<lbName>-outbound-IPv6" are created on each external load balancer
+// with an IPv6 backend pool, and removed together with the last frontend IP configuration of the services.
+type IPv6OutboundConfig struct {
+	// Enabled enables the IPv6 outbound rules. The existing IPv6 outbound rules are removed if it is false.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// AllocatedOutboundPorts is the number of SNAT ports allocated to each backend instance, which must be a
+	// multiple of 8 and not larger than 64000. If not set, the ports are allocated by the size of the backend pool.
+	AllocatedOutboundPorts int32 `json:"allocatedOutboundPorts,omitempty" yaml:"allocatedOutboundPorts,omitempty"`
+	// IdleTimeoutInMinutes is the idle timeout of the outbound flows, between 4 and 120. Default is 4.
+	IdleTimeoutInMinutes int32 `json:"idleTimeoutInMinutes,omitempty" yaml:"idleTimeoutInMinutes,omitempty"`
+	// DisableTCPReset disables sending bidirectional TCP reset on the idle timeout of the outbound flows.
+	DisableTCPReset bool `json:"disableTCPReset,omitempty" yaml:"disableTCPReset,omitempty"`
+}
+
+// NodePoolOutboundConfiguration configures the outbound IPs of a node pool. A frontend IP configuration of the public
+// IP prefix, a backend pool of the IPv4 addresses of the selected nodes and an outbound rule named
+// "<lbName>-outbound-<name>" are created on each external load balancer. A node selected by multiple configurations
+// only joins the first one, since a backend instance can only be referenced by one outbound rule.
+type NodePoolOutboundConfiguration struct {
+	// Name of the configuration, which must be unique and not be "IPv6".
+	Name string `json:"name" yaml:"name"`
+	// NodeSelector selects the nodes of the node pool.
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector" yaml:"nodeSelector"`
+	// PublicIPPrefixID is the resource ID of the public IPv4 prefix the outbound traffic of the nodes egresses from.
+	PublicIPPrefixID string `json:"publicIPPrefixID" yaml:"publicIPPrefixID"`
+	// AllocatedOutboundPorts is the number of SNAT ports allocated to each node, which must be a multiple of 8 and not
+	// larger than 64000. If not set, the ports are allocated by the size of the backend pool.
+	AllocatedOutboundPorts int32 `json:"allocatedOutboundPorts,omitempty" yaml:"allocatedOutboundPorts,omitempty"`
+	// IdleTimeoutInMinutes is the idle timeout of the outbound flows, between 4 and 120. Default is 4.
+	IdleTimeoutInMinutes int32 `json:"idleTimeoutInMinutes,omitempty" yaml:"idleTimeoutInMinutes,omitempty"`
+	// MaxAllocatedOutboundPorts enables the SNAT exhaustion advisor to double the SNAT ports allocated to each node,
+	// up to this number, when the node pool approaches SNAT exhaustion. It must be a multiple of 8, not larger than
+	// 64000 and not less than allocatedOutboundPorts. The scaled ports are kept until it is changed. Disabled if not set.
+	MaxAllocatedOutboundPorts int32 `json:"maxAllocatedOutboundPorts,omitempty" yaml:"maxAllocatedOutboundPorts,omitempty"`
+	// AdditionalPublicIPPrefixIDs are the resource IDs of the public IPv4 prefixes the SNAT exhaustion advisor
+	// attaches to the outbound rule one by one in order, when the node pool approaches SNAT exhaustion and the
+	// allocated outbound ports cannot be scaled further. The attached ones are kept until removed from the list.
+	AdditionalPublicIPPrefixIDs []string `json:"additionalPublicIPPrefixIDs,omitempty" yaml:"additionalPublicIPPrefixIDs,omitempty"`
+}
+
+// SNATExhaustionAdvisorConfig configures the SNAT exhaustion advisor of the node pool outbound configurations.
+type SNATExhaustionAdvisorConfig struct {
+	// IntervalInSeconds is the interval for checking the SNAT port utilization of the node pools. Default is 300 seconds.
+	IntervalInSeconds int `json:"intervalInSeconds,omitempty" yaml:"intervalInSeconds,omitempty"`
+	// UtilizationThresholdPercent is the percentage of the allocated SNAT ports used by a node, above which its node
+	// pool is approaching SNAT exhaustion, between 1 and 100. Default is 80.
+	UtilizationThresholdPercent int32 `json:"utilizationThresholdPercent,omitempty" yaml:"utilizationThresholdPercent,omitempty"`
 }
 
 // MultipleStandardLoadBalancerConfiguration stores the properties regarding multiple standard load balancers.
@@ -364,6 +838,11 @@ type Cloud struct {
 	InterfacesClient                interfaceclient.Interface
 	RouteTablesClient               routetableclient.Interface
 	LoadBalancerClient              loadbalancerclient.Interface
+	ApplicationGatewayClient        applicationgatewayclient.Interface
+	AzureFirewallClient             azurefirewallclient.Interface
+	DiagnosticSettingsClient        diagnosticsettingclient.Interface
+	FlowLogsClient                  flowlogclient.Interface
+	MetricsClient                   metricclient.Interface
 	PublicIPAddressesClient         publicipclient.Interface
 	SecurityGroupsClient            securitygroupclient.Interface
 	VirtualMachinesClient           vmclient.Interface
@@ -375,8 +854,10 @@ type Cloud struct {
 	VirtualMachineScaleSetsClient   vmssclient.Interface
 	VirtualMachineScaleSetVMsClient vmssvmclient.Interface
 	VirtualMachineSizesClient       vmsizeclient.Interface
+	ComputeSKUClient                skuclient.Interface
 	AvailabilitySetsClient          vmasclient.Interface
 	ZoneClient                      zoneclient.Interface
+	ResourceGraphClient             resourcegraphclient.Interface
 	privateendpointclient           privateendpointclient.Interface
 	privatednsclient                privatednsclient.Interface
 	privatednszonegroupclient       privatednszonegroupclient.Interface
@@ -392,24 +873,36 @@ type Cloud struct {
 
 	// ipv6DualStack allows overriding for unit testing.  It's normally initialized from featuregates
 	ipv6DualStackEnabled bool
-	// Lock for access to node caches, includes nodeZones, nodeResourceGroups, and unmanagedNodes.
+	// Lock for access to node caches, includes nodeTopology, nodeResourceGroups, and unmanagedNodes.
 	nodeCachesLock sync.RWMutex
 	// nodeNames holds current nodes for tracking added nodes in VM caches.
 	nodeNames sets.Set[string]
-	// nodeZones is a mapping from Zone to a sets.Set[string] of Node's names in the Zone
-	// it is updated by the nodeInformer
-	nodeZones map[string]sets.Set[string]
+	// nodeTopology holds the zones, scale sets, private IPs and load balancers of the nodes.
+	nodeTopology nodeTopologyStore
 	// nodeResourceGroups holds nodes external resource groups
 	nodeResourceGroups map[string]string
 	// unmanagedNodes holds a list of nodes not managed by Azure cloud provider.
 	unmanagedNodes sets.Set[string]
 	// excludeLoadBalancerNodes holds a list of nodes that should be excluded from LoadBalancer.
-	excludeLoadBalancerNodes   sets.Set[string]
-	nodePrivateIPs             map[string]sets.Set[string]
-	nodePrivateIPToNodeNameMap map[string]string
+	excludeLoadBalancerNodes sets.Set[string]
+	// newlyExcludedNodes holds the nodes excluded from LoadBalancer since the last removal from the backend pools.
+	newlyExcludedNodes sets.Set[string]
+	// loadBalancerNodeExclusionSelector is parsed from the node selector of LoadBalancerNodeExclusion.
+	loadBalancerNodeExclusionSelector labels.Selector
+	// nodesWithStalePrivateIPs holds the private IPs removed from the existing nodes, which may still be in the backend pools.
+	nodesWithStalePrivateIPs map[string]*stalePrivateIPs
+	// nodeBackendNICs holds the values of the annotation of nodes specifying the network interface joining the backend pools.
+	nodeBackendNICs map[string]string
+	// nonVMNodes holds the nodes served by instance providers, keyed by the node name.
+	nonVMNodes map[string]*v1.Node
+	// instanceProviders holds the registered instance providers of the nodes which are not Azure VMs.
+	instanceProviders map[string]InstanceProvider
 	// nodeInformerSynced is for determining if the informer has synced.
 	nodeInformerSynced cache.InformerSynced
 
+	// nodeAddressCache caches the addresses of the nodes returned by NodeAddresses. It is nil if the cache is disabled.
+	nodeAddressCache *nodeAddressCache
+
 	// routeCIDRsLock holds lock for routeCIDRs cache.
 	routeCIDRsLock sync.Mutex
 	// routeCIDRs holds cache for route CIDRs.
@@ -419,6 +912,17 @@ type Cloud struct {
 	regionZonesMap   map[string][]string
 	refreshZonesLock sync.RWMutex
 
+	// capabilities holds the features supported by the target cloud, detected at initialization.
+	capabilities *cloudCapabilities
+	// transport is the transport of the outbound requests if the proxy or the CA bundle is configured.
+	transport *http.Transport
+	// servicePrincipalToken is the token of the credentials of the cloud provider, which is nil without credentials.
+	servicePrincipalToken *adal.ServicePrincipalToken
+	// informersSynced holds whether the informers set by SetInformers have synced, keyed by the resources.
+	informersSynced map[string]cache.InformerSynced
+	// informersSetAt is when the informers are set by SetInformers.
+	informersSetAt time.Time
+
 	KubeClient         clientset.Interface
 	eventBroadcaster   record.EventBroadcaster
 	eventRecorder      record.EventRecorder
@@ -437,11 +941,25 @@ type Cloud struct {
 	plsCache azcache.Resource
 	// a timed cache storing storage account properties to avoid querying storage account frequently
 	storageAccountCache azcache.Resource
+	// compute SKU cache
+	// key: [location]
+	// Value: map of [lower case SKU name]*ComputeSKU
+	computeSKUCache azcache.Resource
+
+	// dynamicClient reads the custom resources configuring the cloud provider.
+	dynamicClient dynamic.Interface
 
 	// Add service lister to always get latest service
 	serviceLister corelisters.ServiceLister
+	// podLister is used to detect the health probes from the readiness probes of the pods if EnableHealthProbeAutoDetection is set.
+	podLister corelisters.PodLister
+	// nodeLister is used to find the node pools of the nodes if RouteNextHops is set.
+	nodeLister corelisters.NodeLister
 	// node-sync-loop routine and service-reconcile routine should not update LoadBalancer at the same time
 	serviceReconcileLock sync.Mutex
+	// sharedResourceLease serializes the writes to the backend pool references of the VMs across the replicas if
+	// the service controller is sharded.
+	sharedResourceLease *sharedResourceLease
 
 	*ManagedDiskController
 	*controllerCommon
@@ -449,12 +967,47 @@ type Cloud struct {
 	// multipleStandardLoadBalancerConfigurationsSynced make sure the `reconcileMultipleStandardLoadBalancerConfigurations`
 	// runs only once every time the cloud provide restarts.
 	multipleStandardLoadBalancerConfigurationsSynced bool
+	// fileMultipleStandardLoadBalancerConfigurations are the MultipleStandardLoadBalancerConfigurations of the
+	// configuration file, used when no MultipleStandardLoadBalancerConfiguration custom resource exists.
+	fileMultipleStandardLoadBalancerConfigurations []MultipleStandardLoadBalancerConfiguration
 	// nodesWithCorrectLoadBalancerByPrimaryVMSet marks nodes that are matched with load balancers by primary vmSet.
 	nodesWithCorrectLoadBalancerByPrimaryVMSet      sync.Map
 	multipleStandardLoadBalancersActiveServicesLock sync.Mutex
 	multipleStandardLoadBalancersActiveNodesLock    sync.Mutex
 	localServiceNameToServiceInfoMap                sync.Map
 	endpointSlicesCache                             sync.Map
+	// serviceOperationAnnotations maps the services being reconciled to the annotations of their ARM requests.
+	serviceOperationAnnotations sync.Map
+	// serviceReconcileStates maps the services to the phases completed by their last failed reconcile.
+	serviceReconcileStates sync.Map
+	// loadBalancerDesiredStates mirrors the desired states persisted in the configmap if
+	// EnableLoadBalancerDesiredStateCache is set. The configmap is loaded on the first use.
+	loadBalancerDesiredStates       sync.Map
+	loadBalancerDesiredStatesLock   sync.Mutex
+	loadBalancerDesiredStatesLoaded bool
+	// lbResourceCounts maps the lower case names of the load balancers to their last known loadBalancerResourceCounts.
+	lbResourceCounts sync.Map
+
+	// asyncOperationTracker persists the in-flight long-running operations if EnableAsyncOperationTracking is set.
+	asyncOperationTracker *asyncOperationTracker
+
+	// routeTableAssociatedSubnets records the IDs of the node subnets validated to be associated with the route table.
+	routeTableAssociatedSubnets sync.Map
+
+	// instanceNotFoundRecords tracks the VMs not found by the consecutive checks if InstanceNotFoundConfirmation is
+	// enabled, keyed by the lower case provider IDs.
+	instanceNotFoundRecords map[string]*instanceNotFoundRecord
+	instanceNotFoundLock    sync.Mutex
+
+	// degradedMode tracks whether ARM is unreachable if DegradedMode is enabled, and caches the node existence.
+	degradedMode *degradedModeTracker
+
+	// instancesWebhook serves the Instances and InstancesV2 calls if InstancesWebhook is configured.
+	instancesWebhook *instancesWebhook
+
+	// serviceIPChangeNotifier notifies the changes of the external IPs of the services if
+	// ServiceIPChangeNotification is configured.
+	serviceIPChangeNotifier *serviceIPChangeNotifier
 }
 
 // NewCloud returns a Cloud with initialized clients
@@ -520,14 +1073,11 @@ func (az *Cloud) configSecretMetadata(secretName, secretNamespace, cloudConfigKe
 
 func NewCloudFromSecret(ctx context.Context, clientBuilder cloudprovider.ControllerClientBuilder, secretName, secretNamespace, cloudConfigKey string) (cloudprovider.Interface, error) {
 	az := &Cloud{
-		nodeNames:                  sets.New[string](),
-		nodeZones:                  map[string]sets.Set[string]{},
-		nodeResourceGroups:         map[string]string{},
-		unmanagedNodes:             sets.New[string](),
-		routeCIDRs:                 map[string]string{},
-		excludeLoadBalancerNodes:   sets.New[string](),
-		nodePrivateIPs:             map[string]sets.Set[string]{},
-		nodePrivateIPToNodeNameMap: map[string]string{},
+		nodeNames:                sets.New[string](),
+		nodeResourceGroups:       map[string]string{},
+		unmanagedNodes:           sets.New[string](),
+		routeCIDRs:               map[string]string{},
+		excludeLoadBalancerNodes: sets.New[string](),
 	}
 
 	az.configSecretMetadata(secretName, secretNamespace, cloudConfigKey)
@@ -553,14 +1103,11 @@ func NewCloudWithoutFeatureGates(ctx context.Context, configReader io.Reader, ca
 	}
 
 	az := &Cloud{
-		nodeNames:                  sets.New[string](),
-		nodeZones:                  map[string]sets.Set[string]{},
-		nodeResourceGroups:         map[string]string{},
-		unmanagedNodes:             sets.New[string](),
-		routeCIDRs:                 map[string]string{},
-		excludeLoadBalancerNodes:   sets.New[string](),
-		nodePrivateIPs:             map[string]sets.Set[string]{},
-		nodePrivateIPToNodeNameMap: map[string]string{},
+		nodeNames:                sets.New[string](),
+		nodeResourceGroups:       map[string]string{},
+		unmanagedNodes:           sets.New[string](),
+		routeCIDRs:               map[string]string{},
+		excludeLoadBalancerNodes: sets.New[string](),
 	}
 
 	err = az.InitializeCloudFromConfig(ctx, config, false, callFromCCM)
@@ -603,6 +1150,22 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		return fmt.Errorf("disableAvailabilitySetNodes %v is only supported when vmType is 'vmss'", config.DisableAvailabilitySetNodes)
 	}
 
+	if config.IgnoreServicesWithoutLoadBalancerClass && config.LoadBalancerClass == "" {
+		return fmt.Errorf("ignoreServicesWithoutLoadBalancerClass is only supported when loadBalancerClass is set")
+	}
+
+	if config.NodeShutdownPowerStates != nil {
+		for state, behavior := range map[string]string{
+			vmPowerStateStopped:     config.NodeShutdownPowerStates.Stopped,
+			vmPowerStateDeallocated: config.NodeShutdownPowerStates.Deallocated,
+			vmPowerStateHibernated:  config.NodeShutdownPowerStates.Hibernated,
+		} {
+			if behavior != "" && !strings.EqualFold(behavior, consts.NodeShutdownBehaviorTaint) && !strings.EqualFold(behavior, consts.NodeShutdownBehaviorIgnore) {
+				return fmt.Errorf("nodeShutdownPowerStates.%s %q is not supported, supported values are %q and %q", state, behavior, consts.NodeShutdownBehaviorTaint, consts.NodeShutdownBehaviorIgnore)
+			}
+		}
+	}
+
 	if config.CloudConfigType == "" {
 		// The default cloud config type is cloudConfigTypeMerge.
 		config.CloudConfigType = cloudConfigTypeMerge
@@ -616,18 +1179,63 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		}
 	}
 
-	if config.LoadBalancerBackendPoolConfigurationType == "" ||
-		// TODO(nilo19): support pod IP mode in the future
-		strings.EqualFold(config.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypePODIP) {
+	if config.LoadBalancerBackendPoolConfigurationType == "" {
 		config.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration
+	} else if _, found := getBackendPoolType(config.LoadBalancerBackendPoolConfigurationType); !found {
+		return fmt.Errorf("loadBalancerBackendPoolConfigurationType %s is not supported, supported values are %v", config.LoadBalancerBackendPoolConfigurationType, registeredBackendPoolTypes())
+	}
+
+	if config.ResourceNamingMode == "" {
+		config.ResourceNamingMode = consts.ResourceNamingModeCompatible
+	} else {
+		supportedResourceNamingModes := sets.New(
+			strings.ToLower(consts.ResourceNamingModeCompatible),
+			strings.ToLower(consts.ResourceNamingModeHashed))
+		if !supportedResourceNamingModes.Has(strings.ToLower(config.ResourceNamingMode)) {
+			return fmt.Errorf("resourceNamingMode %s is not supported, supported values are %v", config.ResourceNamingMode, supportedResourceNamingModes.UnsortedList())
+		}
+	}
+
+	if config.OutboundType == "" {
+		config.OutboundType = consts.OutboundTypeLoadBalancer
 	} else {
-		supportedLoadBalancerBackendPoolConfigurationTypes := sets.New(
-			strings.ToLower(consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration),
-			strings.ToLower(consts.LoadBalancerBackendPoolConfigurationTypeNodeIP),
-			strings.ToLower(consts.LoadBalancerBackendPoolConfigurationTypePODIP))
-		if !supportedLoadBalancerBackendPoolConfigurationTypes.Has(strings.ToLower(config.LoadBalancerBackendPoolConfigurationType)) {
-			return fmt.Errorf("loadBalancerBackendPoolConfigurationType %s is not supported, supported values are %v", config.LoadBalancerBackendPoolConfigurationType, supportedLoadBalancerBackendPoolConfigurationTypes.UnsortedList())
+		supportedOutboundTypes := sets.New(
+			strings.ToLower(consts.OutboundTypeLoadBalancer),
+			strings.ToLower(consts.OutboundTypeNATGateway))
+		if !supportedOutboundTypes.Has(strings.ToLower(config.OutboundType)) {
+			return fmt.Errorf("outboundType %s is not supported, supported values are %v", config.OutboundType, supportedOutboundTypes.UnsortedList())
+		}
+		if strings.EqualFold(config.OutboundType, consts.OutboundTypeNATGateway) &&
+			config.IPv6OutboundConfig != nil && config.IPv6OutboundConfig.Enabled {
+			return fmt.Errorf("ipv6OutboundConfig should not be enabled when outboundType is %s", consts.OutboundTypeNATGateway)
+		}
+	}
+
+	if config.LocalServiceBackendPoolNameTemplate == "" {
+		config.LocalServiceBackendPoolNameTemplate = consts.DefaultLocalServiceBackendPoolNameTemplate
+	} else if err := validateLocalServiceBackendPoolNameTemplate("localServiceBackendPoolNameTemplate", config.LocalServiceBackendPoolNameTemplate); err != nil {
+		return err
+	}
+	for _, template := range config.PreviousLocalServiceBackendPoolNameTemplates {
+		if err := validateLocalServiceBackendPoolNameTemplate("previousLocalServiceBackendPoolNameTemplates", template); err != nil {
+			return err
+		}
+	}
+
+	if err := validateTagTemplates(config.TagTemplates, config.SecurityRuleDescriptionTemplate); err != nil {
+		return err
+	}
+
+	if err := validateIPv6OutboundConfig(config.IPv6OutboundConfig, config.LoadBalancerSku, config.DisableOutboundSNAT); err != nil {
+		return err
+	}
+
+	if config.LoadBalancerNodeExclusion != nil && config.LoadBalancerNodeExclusion.NodeSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(config.LoadBalancerNodeExclusion.NodeSelector)
+		if err != nil {
+			return fmt.Errorf("invalid node selector of loadBalancerNodeExclusion: %w", err)
 		}
+		az.loadBalancerNodeExclusionSelector = selector
 	}
 
 	env, err := ratelimitconfig.ParseAzureEnvironment(config.Cloud, config.ResourceManagerEndpoint, config.IdentitySystem)
@@ -635,7 +1243,13 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		return err
 	}
 
-	servicePrincipalToken, err := ratelimitconfig.GetServicePrincipalToken(&config.AzureAuthConfig, env, env.ServiceManagementEndpoint)
+	transport, err := newOutboundTransport(config)
+	if err != nil {
+		return err
+	}
+	az.transport = transport
+
+	servicePrincipalToken, err := ratelimitconfig.GetServicePrincipalToken(&config.AzureAuthConfig, env, "")
 	if errors.Is(err, ratelimitconfig.ErrorNoAuth) {
 		// Only controller-manager would lazy-initialize from secret, and credentials are required for such case.
 		if fromSecret {
@@ -655,6 +1269,8 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 	} else if err != nil {
 		return err
 	}
+	az.setTokenSender(servicePrincipalToken)
+	az.servicePrincipalToken = servicePrincipalToken
 
 	// Initialize rate limiting config options.
 	ratelimitconfig.InitializeCloudProviderRateLimitConfig(&config.CloudProviderRateLimitConfig)
@@ -666,13 +1282,43 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		return err
 	}
 
+	err = validateRouteNextHops(config.RouteNextHops)
+	if err != nil {
+		return err
+	}
+
+	err = az.initInstancesWebhook(config.InstancesWebhook)
+	if err != nil {
+		return err
+	}
+
+	err = az.initServiceIPChangeNotifier(config.ServiceIPChangeNotification)
+	if err != nil {
+		return err
+	}
+
+	err = validateSecurityLoggingConfig(config.SecurityLogging)
+	if err != nil {
+		return err
+	}
+
 	az.Config = *config
 	az.Environment = *env
 	az.ResourceRequestBackoff = resourceRequestBackoff
+	if callFromCCM && az.EnableAsyncOperationTracking && az.asyncOperationTracker == nil {
+		az.asyncOperationTracker = newAsyncOperationTracker()
+		// the config may be reloaded from the secret after the kube client is initialized
+		if az.KubeClient != nil {
+			az.asyncOperationTracker.initialize(ctx, az.KubeClient)
+		}
+	}
 	az.Metadata, err = NewInstanceMetadataService(consts.ImdsServer)
 	if err != nil {
 		return err
 	}
+	if az.transport != nil {
+		az.Metadata.transport = az.transport
+	}
 
 	// No credentials provided, InstanceMetadataService would be used for getting Azure resources.
 	// Note that this only applies to Kubelet, controller-manager should configure credentials for managing Azure resources.
@@ -689,6 +1335,28 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 	if az.MaximumLoadBalancerRuleCount == 0 {
 		az.MaximumLoadBalancerRuleCount = consts.MaximumLoadBalancerRuleCount
 	}
+	if az.MaximumLoadBalancerFrontendIPConfigurationCount == 0 {
+		az.MaximumLoadBalancerFrontendIPConfigurationCount = consts.MaximumLoadBalancerFrontendIPConfigurationCount
+	}
+
+	// probing the target cloud only in CCM, the features are gated on the API version of the client otherwise
+	if callFromCCM {
+		az.capabilities = az.detectCloudCapabilities(ctx)
+		// recreating the clients so that the load balancer client uses the negotiated API version
+		if az.capabilities.networkAPIVersion != az.getLoadBalancerClientAPIVersion() {
+			klog.V(2).Infof("configuring the load balancer client with the negotiated network API version %s", az.capabilities.networkAPIVersion)
+			if err := az.configureMultiTenantClients(servicePrincipalToken); err != nil {
+				return err
+			}
+		}
+	}
+	if az.useIPBasedBackendPool() && !az.getCloudCapabilities().ipBasedBackendPool {
+		return fmt.Errorf("loadBalancerBackendPoolConfigurationType %s is not supported by the network API version %s of the target cloud",
+			az.LoadBalancerBackendPoolConfigurationType, az.getCloudCapabilities().networkAPIVersion)
+	}
+	if az.usePodIPBackendPool() && !az.useStandardLoadBalancer() {
+		return fmt.Errorf("loadBalancerBackendPoolConfigurationType %s requires the standard load balancer", az.LoadBalancerBackendPoolConfigurationType)
+	}
 
 	if strings.EqualFold(consts.VMTypeVMSS, az.Config.VMType) {
 		az.VMSet, err = newScaleSet(ctx, az)
@@ -707,18 +1375,35 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		}
 	}
 
-	if az.isLBBackendPoolTypeNodeIPConfig() {
-		az.LoadBalancerBackendPool = newBackendPoolTypeNodeIPConfig(az)
-	} else if az.isLBBackendPoolTypeNodeIP() {
-		az.LoadBalancerBackendPool = newBackendPoolTypeNodeIP(az)
+	az.LoadBalancerBackendPool, err = az.newLoadBalancerBackendPool()
+	if err != nil {
+		return err
 	}
 
-	if az.useMultipleStandardLoadBalancers() {
+	if az.useMultipleStandardLoadBalancers() || az.MultipleStandardLoadBalancerConfigurationNamespace != "" {
 		if err := az.checkEnableMultipleStandardLoadBalancers(); err != nil {
 			return err
 		}
 	}
 
+	if len(az.NodePoolOutboundConfigurations) > 0 {
+		if err := az.checkNodePoolOutboundConfigurations(); err != nil {
+			return err
+		}
+	}
+
+	if az.SNATExhaustionAdvisor != nil {
+		if err := az.checkSNATExhaustionAdvisorConfig(); err != nil {
+			return err
+		}
+	}
+
+	if len(az.NamespaceDefaultServiceAnnotations) > 0 {
+		if err := az.checkNamespaceDefaultServiceAnnotations(); err != nil {
+			return err
+		}
+	}
+
 	err = az.initCaches()
 	if err != nil {
 		return err
@@ -728,19 +1413,38 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		return err
 	}
 
+	if callFromCCM && az.useNATGatewayOutbound() {
+		if err := az.checkSubnetNATGatewayAssociation(); err != nil {
+			return err
+		}
+	}
+
 	// updating routes and syncing zones only in CCM
 	if callFromCCM {
-		// start delayed route updater.
-		if az.RouteUpdateIntervalInSeconds == 0 {
-			az.RouteUpdateIntervalInSeconds = consts.DefaultRouteUpdateIntervalInSeconds
+		if !az.ReadOnlyMode {
+			// start delayed route updater.
+			if az.RouteUpdateIntervalInSeconds == 0 {
+				az.RouteUpdateIntervalInSeconds = consts.DefaultRouteUpdateIntervalInSeconds
+			}
+			az.routeUpdater = newDelayedRouteUpdater(az, time.Duration(az.RouteUpdateIntervalInSeconds)*time.Second)
+			go az.routeUpdater.run(ctx)
+
+			// start backend pool updater.
+			// the multiple standard load balancers may be enabled later by the custom resources.
+			if az.useMultipleStandardLoadBalancers() || az.MultipleStandardLoadBalancerConfigurationNamespace != "" || az.usePodIPBackendPool() {
+				az.backendPoolUpdater = newLoadBalancerBackendPoolUpdater(az, time.Duration(az.LoadBalancerBackendPoolUpdateIntervalInSeconds)*time.Second)
+				go az.backendPoolUpdater.run(ctx)
+			}
+		}
+
+		// start probing ARM for the degraded mode.
+		if az.degradedMode != nil {
+			go az.runDegradedModeLoop(ctx)
 		}
-		az.routeUpdater = newDelayedRouteUpdater(az, time.Duration(az.RouteUpdateIntervalInSeconds)*time.Second)
-		go az.routeUpdater.run(ctx)
 
-		// start backend pool updater.
-		if az.useMultipleStandardLoadBalancers() {
-			az.backendPoolUpdater = newLoadBalancerBackendPoolUpdater(az, time.Duration(az.LoadBalancerBackendPoolUpdateIntervalInSeconds)*time.Second)
-			go az.backendPoolUpdater.run(ctx)
+		// the provider-wide loops are started by the replica holding the lease if they are deferred.
+		if ctx.Value(deferredProviderLoopsKey{}) == nil {
+			az.StartProviderLoops(ctx)
 		}
 
 		// Azure Stack does not support zone at the moment
@@ -760,6 +1464,108 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 	return nil
 }
 
+// deferredProviderLoopsKey is the key of the contexts in which InitializeCloudFromConfig does not start the
+// provider-wide loops.
+type deferredProviderLoopsKey struct{}
+
+// WithDeferredProviderLoops returns a context in which InitializeCloudFromConfig does not start the provider-wide
+// loops writing to Azure, e.g., when every replica of cloud-controller-manager initializes the cloud provider for the
+// shards of the service controller, so that the loops are started by StartProviderLoops on the replica holding the
+// lease only.
+func WithDeferredProviderLoops(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deferredProviderLoopsKey{}, true)
+}
+
+// StartProviderLoops starts the provider-wide loops reconciling or reporting the Azure resources shared by all the
+// services and nodes until the context is canceled. They must be run by a single replica.
+func (az *Cloud) StartProviderLoops(ctx context.Context) {
+	if az.ReadOnlyMode {
+		// start verifying the load balancers instead of reconciling them.
+		if az.LoadBalancerDriftVerificationIntervalInSeconds == 0 {
+			az.LoadBalancerDriftVerificationIntervalInSeconds = consts.DefaultLoadBalancerDriftVerificationIntervalInSeconds
+		}
+		if az.LoadBalancerDriftVerificationIntervalInSeconds > 0 {
+			go az.runLoadBalancerDriftVerificationLoop(ctx, time.Duration(az.LoadBalancerDriftVerificationIntervalInSeconds)*time.Second)
+		}
+	} else {
+		if az.backendPoolUpdater != nil && az.LoadBalancerBackendPoolRepairIntervalInSeconds > 0 {
+			go az.runLocalServiceBackendPoolRepairLoop(ctx, time.Duration(az.LoadBalancerBackendPoolRepairIntervalInSeconds)*time.Second)
+		}
+
+		// start removing the nodes newly excluded by labels or taints from the IP-based backend pools.
+		if az.LoadBalancerNodeExclusion != nil {
+			if az.LoadBalancerNodeExclusion.ReconcileIntervalInSeconds == 0 {
+				az.LoadBalancerNodeExclusion.ReconcileIntervalInSeconds = consts.DefaultLoadBalancerNodeExclusionReconcileIntervalInSeconds
+			}
+			if az.useNodeIPBackendPool() && az.LoadBalancerNodeExclusion.ReconcileIntervalInSeconds > 0 {
+				go az.runLoadBalancerNodeExclusionLoop(ctx, time.Duration(az.LoadBalancerNodeExclusion.ReconcileIntervalInSeconds)*time.Second)
+			}
+		}
+
+		// start replacing the changed private IPs of the nodes in the IP-based backend pools.
+		if az.useNodeIPBackendPool() {
+			go az.runNodePrivateIPUpdateLoop(ctx, time.Duration(az.LoadBalancerBackendPoolUpdateIntervalInSeconds)*time.Second)
+		}
+
+		// start NIC backend pool reconciliation of availability set nodes.
+		if az.AvailabilitySetNICReconcileIntervalInSeconds == 0 {
+			az.AvailabilitySetNICReconcileIntervalInSeconds = consts.DefaultAvailabilitySetNICReconcileIntervalInSeconds
+		}
+		if az.VMType == consts.VMTypeStandard && az.useNodeIPConfigBackendPool() && az.AvailabilitySetNICReconcileIntervalInSeconds > 0 {
+			go az.runAvailabilitySetNICReconcileLoop(ctx, time.Duration(az.AvailabilitySetNICReconcileIntervalInSeconds)*time.Second)
+		}
+
+		// start reconciling the security rules of the node port range.
+		if az.NodePortSecurityRules != nil {
+			if az.NodePortSecurityRules.ReconcileIntervalInSeconds == 0 {
+				az.NodePortSecurityRules.ReconcileIntervalInSeconds = consts.DefaultNodePortSecurityRulesReconcileIntervalInSeconds
+			}
+			if az.NodePortSecurityRules.ReconcileIntervalInSeconds > 0 {
+				go az.runNodePortSecurityRulesLoop(ctx, time.Duration(az.NodePortSecurityRules.ReconcileIntervalInSeconds)*time.Second)
+			}
+		}
+
+		// start convergence of the VMSS VMs.
+		if az.VMSSConvergenceIntervalInSeconds == 0 {
+			az.VMSSConvergenceIntervalInSeconds = consts.DefaultVMSSConvergenceIntervalInSeconds
+		}
+		if az.VMType == consts.VMTypeVMSS && az.VMSSConvergenceIntervalInSeconds > 0 {
+			go az.runVMSSConvergenceLoop(ctx, time.Duration(az.VMSSConvergenceIntervalInSeconds)*time.Second)
+		}
+
+		// start ensuring the diagnostic settings and the flow logs of the managed load balancers and security group.
+		if az.SecurityLogging != nil {
+			go az.runSecurityLoggingLoop(ctx, az.SecurityLogging)
+		}
+	}
+
+	// start reporting the backend health of the load balancers.
+	if az.useStandardLoadBalancer() && az.LoadBalancerBackendHealthReportIntervalInSeconds > 0 {
+		go az.runLoadBalancerBackendHealthReportLoop(ctx, time.Duration(az.LoadBalancerBackendHealthReportIntervalInSeconds)*time.Second)
+	}
+
+	// start exporting the Azure resources consumed by the services.
+	if az.ServiceCostAttributionIntervalInSeconds > 0 {
+		go az.runServiceCostAttributionLoop(ctx, time.Duration(az.ServiceCostAttributionIntervalInSeconds)*time.Second)
+	}
+
+	// start mirroring the backend pools of the services to the snapshot configmap.
+	if az.BackendPoolSnapshotIntervalInSeconds > 0 {
+		go az.runBackendPoolSnapshotLoop(ctx, time.Duration(az.BackendPoolSnapshotIntervalInSeconds)*time.Second)
+	}
+
+	// start exporting the Azure Monitor metrics of the load balancers of the services.
+	if az.useStandardLoadBalancer() && az.LoadBalancerMetricsExportIntervalInSeconds > 0 {
+		go az.runLoadBalancerMetricsExportLoop(ctx, time.Duration(az.LoadBalancerMetricsExportIntervalInSeconds)*time.Second)
+	}
+
+	// start warning about and mitigating the SNAT exhaustion of the node pools.
+	if az.SNATExhaustionAdvisor != nil {
+		go az.runSNATExhaustionAdvisorLoop(ctx, time.Duration(az.SNATExhaustionAdvisor.IntervalInSeconds)*time.Second)
+	}
+
+}
+
 func (az *Cloud) useMultipleStandardLoadBalancers() bool {
 	return az.useStandardLoadBalancer() && len(az.MultipleStandardLoadBalancerConfigurations) > 0
 }
@@ -770,13 +1576,29 @@ func (az *Cloud) useSingleStandardLoadBalancer() bool {
 
 // Multiple standard load balancer mode only supports IP-based load balancers.
 func (az *Cloud) checkEnableMultipleStandardLoadBalancers() error {
-	if az.isLBBackendPoolTypeNodeIPConfig() {
-		return fmt.Errorf("multiple standard load balancers cannot be used with backend pool type %s", consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration)
+	if err := az.validateMultipleStandardLoadBalancerConfigurations(az.MultipleStandardLoadBalancerConfigurations); err != nil {
+		return err
+	}
+
+	if az.LoadBalancerBackendPoolUpdateIntervalInSeconds == 0 {
+		az.LoadBalancerBackendPoolUpdateIntervalInSeconds = consts.DefaultLoadBalancerBackendPoolUpdateIntervalInSeconds
+	}
+	if az.LoadBalancerBackendPoolRepairIntervalInSeconds == 0 {
+		az.LoadBalancerBackendPoolRepairIntervalInSeconds = consts.DefaultLoadBalancerBackendPoolRepairIntervalInSeconds
+	}
+
+	return nil
+}
+
+// validateMultipleStandardLoadBalancerConfigurations checks the names and the primary VMSets of the configurations are unique.
+func (az *Cloud) validateMultipleStandardLoadBalancerConfigurations(multiSLBConfigs []MultipleStandardLoadBalancerConfiguration) error {
+	if !az.useNodeIPBackendPool() {
+		return fmt.Errorf("multiple standard load balancers cannot be used with backend pool type %s", az.LoadBalancerBackendPoolConfigurationType)
 	}
 
 	names := sets.New[string]()
 	primaryVMSets := sets.New[string]()
-	for _, multiSLBConfig := range az.MultipleStandardLoadBalancerConfigurations {
+	for _, multiSLBConfig := range multiSLBConfigs {
 		if names.Has(multiSLBConfig.Name) {
 			return fmt.Errorf("duplicated multiple standard load balancer configuration name %s", multiSLBConfig.Name)
 		}
@@ -791,23 +1613,32 @@ func (az *Cloud) checkEnableMultipleStandardLoadBalancers() error {
 		primaryVMSets.Insert(multiSLBConfig.PrimaryVMSet)
 	}
 
-	if az.LoadBalancerBackendPoolUpdateIntervalInSeconds == 0 {
-		az.LoadBalancerBackendPoolUpdateIntervalInSeconds = consts.DefaultLoadBalancerBackendPoolUpdateIntervalInSeconds
-	}
-
 	return nil
 }
 
-func (az *Cloud) isLBBackendPoolTypeNodeIPConfig() bool {
-	return strings.EqualFold(az.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration)
+func (az *Cloud) getPutVMSSVMBatchSize() int {
+	return az.PutVMSSVMBatchSize
 }
 
-func (az *Cloud) isLBBackendPoolTypeNodeIP() bool {
-	return strings.EqualFold(az.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypeNodeIP)
+func (az *Cloud) getVMSSVMUpdateChunkSize() int {
+	if az.VMSSVMUpdateChunkSize <= 0 {
+		return consts.DefaultVMSSVMUpdateChunkSize
+	}
+	return az.VMSSVMUpdateChunkSize
 }
 
-func (az *Cloud) getPutVMSSVMBatchSize() int {
-	return az.PutVMSSVMBatchSize
+func (az *Cloud) getVMSSVMUpdateChunkConcurrency() int {
+	if az.VMSSVMUpdateChunkConcurrency <= 0 {
+		return consts.DefaultVMSSVMUpdateChunkConcurrency
+	}
+	return az.VMSSVMUpdateChunkConcurrency
+}
+
+func (az *Cloud) getHostUpdateConcurrency() int {
+	if az.HostUpdateConcurrency <= 0 {
+		return consts.DefaultHostUpdateConcurrency
+	}
+	return az.HostUpdateConcurrency
 }
 
 func (az *Cloud) initCaches() (err error) {
@@ -848,6 +1679,29 @@ func (az *Cloud) initCaches() (err error) {
 	if az.storageAccountCache, err = az.newStorageAccountCache(); err != nil {
 		return err
 	}
+
+	if az.computeSKUCache, err = az.newComputeSKUCache(); err != nil {
+		return err
+	}
+
+	if az.InstanceNotFoundConfirmation != nil {
+		if az.InstanceNotFoundConfirmation.ConsecutiveChecks <= 0 {
+			az.InstanceNotFoundConfirmation.ConsecutiveChecks = consts.DefaultInstanceNotFoundConsecutiveChecks
+		}
+		if az.InstanceNotFoundConfirmation.GracePeriodInSeconds <= 0 {
+			az.InstanceNotFoundConfirmation.GracePeriodInSeconds = consts.DefaultInstanceNotFoundGracePeriodInSeconds
+		}
+	}
+	if az.DegradedMode != nil && az.DegradedMode.Enabled {
+		az.degradedMode = newDegradedModeTracker(az.DegradedMode)
+	}
+	if az.NodeAddressCacheTTLInSeconds == 0 {
+		az.NodeAddressCacheTTLInSeconds = consts.DefaultNodeAddressCacheTTLInSeconds
+	}
+	if az.NodeAddressCacheTTLInSeconds > 0 && !az.Config.DisableAPICallCache {
+		az.nodeAddressCache = newNodeAddressCache(time.Duration(az.NodeAddressCacheTTLInSeconds) * time.Second)
+		az.subscribeNodeAddressChanges()
+	}
 	return nil
 }
 
@@ -857,6 +1711,15 @@ func (az *Cloud) setLBDefaults(config *Config) error {
 	}
 
 	if strings.EqualFold(config.LoadBalancerSku, consts.LoadBalancerSkuStandard) {
+		// The outbound traffic is handled by the NAT gateway, so the load balancing rules should not provide SNAT.
+		if strings.EqualFold(config.OutboundType, consts.OutboundTypeNATGateway) {
+			if config.DisableOutboundSNAT == nil {
+				config.DisableOutboundSNAT = &defaultDisableOutboundSNATWithNATGateway
+			} else if !*config.DisableOutboundSNAT {
+				return fmt.Errorf("disableOutboundSNAT should not be false when outboundType is %s, because the outbound traffic is handled by the NAT gateway", consts.OutboundTypeNATGateway)
+			}
+		}
+
 		// Do not add master nodes to standard LB by default.
 		if config.ExcludeMasterFromStandardLB == nil {
 			config.ExcludeMasterFromStandardLB = &defaultExcludeMasterFromStandardLB
@@ -870,6 +1733,9 @@ func (az *Cloud) setLBDefaults(config *Config) error {
 		if config.DisableOutboundSNAT != nil && *config.DisableOutboundSNAT {
 			return fmt.Errorf("disableOutboundSNAT should only set when loadBalancerSku is standard")
 		}
+		if strings.EqualFold(config.OutboundType, consts.OutboundTypeNATGateway) {
+			return fmt.Errorf("outboundType %s should only set when loadBalancerSku is standard", consts.OutboundTypeNATGateway)
+		}
 	}
 	return nil
 }
@@ -887,12 +1753,45 @@ func (az *Cloud) configureMultiTenantClients(servicePrincipalToken *adal.Service
 		if err != nil {
 			return err
 		}
+
+		az.setTokenSender(multiTenantServicePrincipalToken.PrimaryToken)
+		for _, token := range multiTenantServicePrincipalToken.AuxiliaryTokens {
+			az.setTokenSender(token)
+		}
+		az.setTokenSender(networkResourceServicePrincipalToken)
 	}
 
-	az.configAzureClients(servicePrincipalToken, multiTenantServicePrincipalToken, networkResourceServicePrincipalToken)
+	routeTableServicePrincipalToken, err := az.getRouteTableServicePrincipalToken()
+	if err != nil {
+		return err
+	}
+
+	az.configAzureClients(servicePrincipalToken, multiTenantServicePrincipalToken, networkResourceServicePrincipalToken, routeTableServicePrincipalToken)
 	return nil
 }
 
+// getRouteTableServicePrincipalToken returns the token of the credentials profile of the route table,
+// or nil if the route table is managed with the credentials of the cluster.
+func (az *Cloud) getRouteTableServicePrincipalToken() (*adal.ServicePrincipalToken, error) {
+	if az.RouteTableCredentials == nil {
+		return nil, nil
+	}
+
+	authConfig := *az.RouteTableCredentials
+	if authConfig.TenantID == "" {
+		authConfig.TenantID = az.TenantID
+	}
+	if authConfig.IdentitySystem == "" {
+		authConfig.IdentitySystem = az.IdentitySystem
+	}
+	token, err := ratelimitconfig.GetServicePrincipalToken(&authConfig, &az.Environment, "")
+	if err != nil {
+		return nil, fmt.Errorf("getting the service principal token of the route table credentials: %w", err)
+	}
+	az.setTokenSender(token)
+	return token, nil
+}
+
 func (az *Cloud) setCloudProviderBackoffDefaults(config *Config) wait.Backoff {
 	// Conditionally configure resource request backoff
 	resourceRequestBackoff := wait.Backoff{
@@ -936,12 +1835,14 @@ func (az *Cloud) setCloudProviderBackoffDefaults(config *Config) wait.Backoff {
 func (az *Cloud) configAzureClients(
 	servicePrincipalToken *adal.ServicePrincipalToken,
 	multiTenantServicePrincipalToken *adal.MultiTenantServicePrincipalToken,
-	networkResourceServicePrincipalToken *adal.ServicePrincipalToken) {
+	networkResourceServicePrincipalToken *adal.ServicePrincipalToken,
+	routeTableServicePrincipalToken *adal.ServicePrincipalToken) {
 	azClientConfig := az.getAzureClientConfig(servicePrincipalToken)
 
 	// Prepare AzureClientConfig for all azure clients
 	interfaceClientConfig := azClientConfig.WithRateLimiter(az.Config.InterfaceRateLimit)
 	vmSizeClientConfig := azClientConfig.WithRateLimiter(az.Config.VirtualMachineSizeRateLimit)
+	computeSKUClientConfig := azClientConfig.WithRateLimiter(az.Config.ComputeSKURateLimit)
 	snapshotClientConfig := azClientConfig.WithRateLimiter(az.Config.SnapshotRateLimit)
 	storageAccountClientConfig := azClientConfig.WithRateLimiter(az.Config.StorageAccountRateLimit)
 	diskClientConfig := azClientConfig.WithRateLimiter(az.Config.DiskRateLimit)
@@ -955,8 +1856,16 @@ func (az *Cloud) configAzureClients(
 	subnetClientConfig := azClientConfig.WithRateLimiter(az.Config.SubnetsRateLimit)
 	routeTableClientConfig := azClientConfig.WithRateLimiter(az.Config.RouteTableRateLimit)
 	loadBalancerClientConfig := azClientConfig.WithRateLimiter(az.Config.LoadBalancerRateLimit)
+	if az.capabilities != nil {
+		loadBalancerClientConfig.APIVersion = az.capabilities.networkAPIVersion
+	}
 	securityGroupClientConfig := azClientConfig.WithRateLimiter(az.Config.SecurityGroupRateLimit)
 	publicIPClientConfig := azClientConfig.WithRateLimiter(az.Config.PublicIPAddressRateLimit)
+	applicationGatewayClientConfig := azClientConfig.WithRateLimiter(az.Config.ApplicationGatewayRateLimit)
+	azureFirewallClientConfig := azClientConfig.WithRateLimiter(az.Config.AzureFirewallRateLimit)
+	diagnosticSettingClientConfig := azClientConfig.WithRateLimiter(az.Config.DiagnosticSettingRateLimit)
+	flowLogClientConfig := azClientConfig.WithRateLimiter(az.Config.FlowLogRateLimit)
+	metricClientConfig := azClientConfig.WithRateLimiter(az.Config.MetricRateLimit)
 	containerServiceConfig := azClientConfig.WithRateLimiter(az.Config.ContainerServiceRateLimit)
 	deploymentConfig := azClientConfig.WithRateLimiter(az.Config.DeploymentRateLimit)
 	privateDNSConfig := azClientConfig.WithRateLimiter(az.Config.PrivateDNSRateLimit)
@@ -969,6 +1878,7 @@ func (az *Cloud) configAzureClients(
 	blobClientConfig := azClientConfig.WithRateLimiter(nil)
 	vmasClientConfig := azClientConfig.WithRateLimiter(az.Config.AvailabilitySetRateLimit)
 	zoneClientConfig := azClientConfig.WithRateLimiter(nil)
+	resourceGraphClientConfig := azClientConfig.WithRateLimiter(az.Config.ResourceGraphRateLimit)
 
 	// If uses network resources in different AAD Tenant, update Authorizer for VM/VMSS/VMAS client config
 	if multiTenantServicePrincipalToken != nil {
@@ -988,6 +1898,11 @@ func (az *Cloud) configAzureClients(
 		loadBalancerClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
 		securityGroupClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
 		publicIPClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
+		applicationGatewayClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
+		azureFirewallClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
+		diagnosticSettingClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
+		flowLogClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
+		metricClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
 	}
 
 	if az.UsesNetworkResourceInDifferentSubscription() {
@@ -997,11 +1912,29 @@ func (az *Cloud) configAzureClients(
 		loadBalancerClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
 		securityGroupClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
 		publicIPClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+		applicationGatewayClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+		azureFirewallClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+		diagnosticSettingClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+		flowLogClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+		metricClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+	}
+
+	// If the route table is in a different subscription or managed with its own credentials, e.g., in a peered hub VNet,
+	// update SubscriptionID and Authorizer for the route and route table client config
+	if routeTableServicePrincipalToken != nil {
+		routeTableServicePrincipalTokenAuthorizer := autorest.NewBearerAuthorizer(routeTableServicePrincipalToken)
+		routeClientConfig.Authorizer = routeTableServicePrincipalTokenAuthorizer
+		routeTableClientConfig.Authorizer = routeTableServicePrincipalTokenAuthorizer
+	}
+	if az.RouteTableSubscriptionID != "" {
+		routeClientConfig.SubscriptionID = az.RouteTableSubscriptionID
+		routeTableClientConfig.SubscriptionID = az.RouteTableSubscriptionID
 	}
 
 	// Initialize all azure clients based on client config
 	az.InterfacesClient = interfaceclient.New(interfaceClientConfig)
 	az.VirtualMachineSizesClient = vmsizeclient.New(vmSizeClientConfig)
+	az.ComputeSKUClient = skuclient.New(computeSKUClientConfig)
 	az.SnapshotsClient = snapshotclient.New(snapshotClientConfig)
 	az.StorageAccountClient = storageaccountclient.New(storageAccountClientConfig)
 	az.DisksClient = diskclient.New(diskClientConfig)
@@ -1014,6 +1947,11 @@ func (az *Cloud) configAzureClients(
 	az.LoadBalancerClient = loadbalancerclient.New(loadBalancerClientConfig)
 	az.SecurityGroupsClient = securitygroupclient.New(securityGroupClientConfig)
 	az.PublicIPAddressesClient = publicipclient.New(publicIPClientConfig)
+	az.ApplicationGatewayClient = applicationgatewayclient.New(applicationGatewayClientConfig)
+	az.AzureFirewallClient = azurefirewallclient.New(azureFirewallClientConfig)
+	az.DiagnosticSettingsClient = diagnosticsettingclient.New(diagnosticSettingClientConfig)
+	az.FlowLogsClient = flowlogclient.New(flowLogClientConfig)
+	az.MetricsClient = metricclient.New(metricClientConfig)
 	az.FileClient = fileclient.New(fileClientConfig)
 	az.BlobClient = blobclient.New(blobClientConfig)
 	az.AvailabilitySetsClient = vmasclient.New(vmasClientConfig)
@@ -1024,6 +1962,7 @@ func (az *Cloud) configAzureClients(
 	az.PrivateLinkServiceClient = privatelinkserviceclient.New(privateLinkServiceConfig)
 	az.containerServiceClient = containerserviceclient.New(containerServiceConfig)
 	az.deploymentClient = deploymentclient.New(deploymentConfig)
+	az.ResourceGraphClient = resourcegraphclient.New(resourceGraphClientConfig)
 
 	if az.ZoneClient == nil {
 		az.ZoneClient = zoneclient.New(zoneClientConfig)
@@ -1040,6 +1979,13 @@ func (az *Cloud) getAzureClientConfig(servicePrincipalToken *adal.ServicePrincip
 		Backoff:                 &retry.Backoff{Steps: 1},
 		DisableAzureStackCloud:  az.Config.DisableAzureStackCloud,
 		UserAgent:               az.Config.UserAgent,
+		UserAgentSuffix:         az.Config.UserAgentSuffix,
+		ClusterName:             az.Config.ClusterName,
+		Transport:               az.transport,
+	}
+
+	if az.asyncOperationTracker != nil {
+		azClientConfig.AsyncOperationTracker = az.asyncOperationTracker
 	}
 
 	if az.Config.CloudProviderBackoff {
@@ -1096,6 +2042,33 @@ func ParseConfig(configReader io.Reader) (*Config, error) {
 	return &config, nil
 }
 
+// newOutboundTransport returns the transport of the outbound requests with the proxy and the CA bundle applied,
+// or nil if neither is configured.
+func newOutboundTransport(config *Config) (*http.Transport, error) {
+	transportConfig := &azclients.TransportConfig{
+		HTTPSProxy:   config.HTTPSProxy,
+		NoProxy:      config.NoProxy,
+		CABundlePath: config.CABundlePath,
+	}
+	if transportConfig.IsEmpty() {
+		return nil, nil
+	}
+
+	transport := armclient.NewTransport()
+	if err := transportConfig.ApplyTo(transport); err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// setTokenSender sends the token requests to AAD through the outbound transport if it is configured.
+func (az *Cloud) setTokenSender(token *adal.ServicePrincipalToken) {
+	if token == nil || az.transport == nil {
+		return
+	}
+	token.SetSender(&http.Client{Transport: az.transport})
+}
+
 func (az *Cloud) isStackCloud() bool {
 	return strings.EqualFold(az.Config.Cloud, consts.AzureStackCloudName) && !az.Config.DisableAzureStackCloud
 }
@@ -1106,6 +2079,20 @@ func (az *Cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder,
 	az.eventBroadcaster = record.NewBroadcaster()
 	az.eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: az.KubeClient.CoreV1().Events("")})
 	az.eventRecorder = az.eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "azure-cloud-provider"})
+	if az.asyncOperationTracker != nil {
+		az.asyncOperationTracker.initialize(context.Background(), az.KubeClient)
+	}
+	dynamicClient, err := dynamic.NewForConfig(clientBuilder.ConfigOrDie("azure-cloud-provider"))
+	if err != nil {
+		klog.Errorf("Initialize: failed to create the dynamic client, the custom resources cannot be read: %v", err)
+		return
+	}
+	az.dynamicClient = dynamicClient
+	if az.MultipleStandardLoadBalancerConfigurationNamespace != "" {
+		if err := az.initMultipleStandardLoadBalancerConfigurationInformer(stop); err != nil {
+			klog.Errorf("Initialize: failed to watch the multiple standard load balancer configurations: %v", err)
+		}
+	}
 }
 
 // LoadBalancer returns a balancer interface. Also returns true if the interface is supported, false otherwise.
@@ -1115,11 +2102,17 @@ func (az *Cloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
 
 // Instances returns an instances interface. Also returns true if the interface is supported, false otherwise.
 func (az *Cloud) Instances() (cloudprovider.Instances, bool) {
+	if az.instancesWebhook != nil {
+		return az.instancesWebhook, true
+	}
 	return az, true
 }
 
 // InstancesV2 returns an instancesV2 interface. Also returns true if the interface is supported, false otherwise.
 func (az *Cloud) InstancesV2() (cloudprovider.InstancesV2, bool) {
+	if az.instancesWebhook != nil {
+		return az.instancesWebhook, true
+	}
 	return az, true
 }
 
@@ -1140,6 +2133,9 @@ func (az *Cloud) Clusters() (cloudprovider.Clusters, bool) {
 
 // Routes returns a routes interface along with whether the interface is supported.
 func (az *Cloud) Routes() (cloudprovider.Routes, bool) {
+	if az.ReadOnlyMode {
+		return nil, false
+	}
 	return az, true
 }
 
@@ -1187,12 +2183,19 @@ func (az *Cloud) SetInformers(informerFactory informers.SharedInformerFactory) {
 			node := obj.(*v1.Node)
 			az.updateNodeCaches(nil, node)
 			az.updateNodeTaint(node)
+			az.updateNodeDeallocation(node)
 		},
 		UpdateFunc: func(prev, obj interface{}) {
 			prevNode := prev.(*v1.Node)
 			newNode := obj.(*v1.Node)
+			az.nodeCachesLock.RLock()
+			wasExcluded := az.shouldNodeExcludedFromLoadBalancer(newNode.Name)
+			previousIPs := sets.List(az.nodeTopology.getPrivateIPs(newNode.Name))
+			az.nodeCachesLock.RUnlock()
 			az.updateNodeCaches(prevNode, newNode)
+			az.updateLocalServiceBackendPoolsOfNode(newNode.Name, wasExcluded, previousIPs)
 			az.updateNodeTaint(newNode)
+			az.updateNodeDeallocation(newNode)
 		},
 		DeleteFunc: func(obj interface{}) {
 			node, isNode := obj.(*v1.Node)
@@ -1214,11 +2217,25 @@ func (az *Cloud) SetInformers(informerFactory informers.SharedInformerFactory) {
 
 			klog.V(4).Infof("Removing node %s from VMSet cache.", node.Name)
 			_ = az.VMSet.DeleteCacheForNode(node.Name)
+			if az.nodeAddressCache != nil {
+				az.nodeAddressCache.delete(types.NodeName(node.Name))
+			}
+			az.resetInstanceNotFound(node.Spec.ProviderID)
 		},
 	})
 	az.nodeInformerSynced = nodeInformer.HasSynced
+	az.nodeLister = informerFactory.Core().V1().Nodes().Lister()
 
+	serviceInformer := informerFactory.Core().V1().Services().Informer()
 	az.serviceLister = informerFactory.Core().V1().Services().Lister()
+	az.informersSynced = map[string]cache.InformerSynced{
+		"nodes":    nodeInformer.HasSynced,
+		"services": serviceInformer.HasSynced,
+	}
+	az.informersSetAt = time.Now()
+	if az.EnableHealthProbeAutoDetection {
+		az.podLister = informerFactory.Core().V1().Pods().Lister()
+	}
 
 	az.setUpEndpointSlicesInformer(informerFactory)
 }
@@ -1232,23 +2249,15 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 		// Remove from nodeNames cache.
 		az.nodeNames.Delete(prevNode.ObjectMeta.Name)
 
-		// Remove from nodeZones cache.
-		prevZone, ok := prevNode.ObjectMeta.Labels[v1.LabelTopologyZone]
-		if ok && az.isAvailabilityZone(prevZone) {
-			az.nodeZones[prevZone].Delete(prevNode.ObjectMeta.Name)
-			if az.nodeZones[prevZone].Len() == 0 {
-				az.nodeZones[prevZone] = nil
-			}
-		}
-
 		// Remove from nodeResourceGroups cache.
-		_, ok = prevNode.ObjectMeta.Labels[consts.ExternalResourceGroupLabel]
+		_, ok := prevNode.ObjectMeta.Labels[consts.ExternalResourceGroupLabel]
 		if ok {
 			delete(az.nodeResourceGroups, prevNode.ObjectMeta.Name)
 		}
 
 		managed, ok := prevNode.ObjectMeta.Labels[consts.ManagedByAzureLabel]
-		isNodeManagedByCloudProvider := !ok || !strings.EqualFold(managed, consts.NotManagedByAzureLabelValue)
+		_, hasInstanceProvider := prevNode.ObjectMeta.Labels[consts.InstanceProviderLabel]
+		isNodeManagedByCloudProvider := (!ok || !strings.EqualFold(managed, consts.NotManagedByAzureLabelValue)) && !hasInstanceProvider
 
 		klog.Infof("managed=%v, ok=%v, isNodeManagedByCloudProvider=%v",
 			managed, ok, isNodeManagedByCloudProvider)
@@ -1264,11 +2273,16 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 			az.nodesWithCorrectLoadBalancerByPrimaryVMSet.Delete(strings.ToLower(prevNode.ObjectMeta.Name))
 		}
 
-		// Remove from nodePrivateIPs cache.
-		for _, address := range getNodePrivateIPAddresses(prevNode) {
-			klog.V(4).Infof("removing IP address %s of the node %s", address, prevNode.Name)
-			az.nodePrivateIPs[prevNode.Name].Delete(address)
-			delete(az.nodePrivateIPToNodeNameMap, address)
+		// Remove from nodeBackendNICs cache.
+		delete(az.nodeBackendNICs, prevNode.ObjectMeta.Name)
+
+		// Remove from nonVMNodes cache.
+		delete(az.nonVMNodes, prevNode.ObjectMeta.Name)
+
+		// Remove from the node topology if the node is deleted, otherwise the topology is updated below.
+		if newNode == nil {
+			az.updateNodePrivateIPs(prevNode.Name, nil)
+			az.nodeTopology.delete(prevNode.Name)
 		}
 	}
 
@@ -1276,14 +2290,13 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 		// Add to nodeNames cache.
 		az.nodeNames.Insert(newNode.ObjectMeta.Name)
 
-		// Add to nodeZones cache.
-		newZone, ok := newNode.ObjectMeta.Labels[v1.LabelTopologyZone]
-		if ok && az.isAvailabilityZone(newZone) {
-			if az.nodeZones[newZone] == nil {
-				az.nodeZones[newZone] = sets.New[string]()
-			}
-			az.nodeZones[newZone].Insert(newNode.ObjectMeta.Name)
+		// Update the zone and the scale set of the node in the node topology.
+		var zone string
+		if newZone, ok := newNode.ObjectMeta.Labels[v1.LabelTopologyZone]; ok && az.isAvailabilityZone(newZone) {
+			zone = newZone
 		}
+		vmSetName, _ := extractScaleSetNameByProviderID(newNode.Spec.ProviderID)
+		az.nodeTopology.setPlacement(newNode.ObjectMeta.Name, zone, vmSetName)
 
 		// Add to nodeResourceGroups cache.
 		newRG, ok := newNode.ObjectMeta.Labels[consts.ExternalResourceGroupLabel]
@@ -1293,7 +2306,8 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 
 		_, hasExcludeBalancerLabel := newNode.ObjectMeta.Labels[v1.LabelNodeExcludeBalancers]
 		managed, ok := newNode.ObjectMeta.Labels[consts.ManagedByAzureLabel]
-		isNodeManagedByCloudProvider := !ok || !strings.EqualFold(managed, consts.NotManagedByAzureLabelValue)
+		_, hasInstanceProvider := newNode.ObjectMeta.Labels[consts.InstanceProviderLabel]
+		isNodeManagedByCloudProvider := (!ok || !strings.EqualFold(managed, consts.NotManagedByAzureLabelValue)) && !hasInstanceProvider
 
 		// Update unmanagedNodes cache
 		if !isNodeManagedByCloudProvider {
@@ -1310,25 +2324,43 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 			az.excludeLoadBalancerNodes.Insert(newNode.ObjectMeta.Name)
 			klog.V(6).Infof("excluding Node %q from LoadBalancer because it has exclude-from-external-load-balancers label", newNode.ObjectMeta.Name)
 
+		case az.isNodeSelectedByLoadBalancerNodeExclusion(newNode):
+			// The service controller does not resync the services on the changes of the labels or taints selected
+			// by the configuration, so the nodes excluded by the update are removed from the backend pools separately.
+			if prevNode != nil && !az.excludeLoadBalancerNodes.Has(newNode.ObjectMeta.Name) {
+				if az.newlyExcludedNodes == nil {
+					az.newlyExcludedNodes = sets.New[string]()
+				}
+				az.newlyExcludedNodes.Insert(newNode.ObjectMeta.Name)
+			}
+			az.excludeLoadBalancerNodes.Insert(newNode.ObjectMeta.Name)
+			klog.V(6).Infof("excluding Node %q from LoadBalancer because it is selected by loadBalancerNodeExclusion", newNode.ObjectMeta.Name)
+
 		default:
 			// Nodes not falling into the three cases above are valid backends and
 			// should not appear in excludeLoadBalancerNodes cache.
 			az.excludeLoadBalancerNodes.Delete(newNode.ObjectMeta.Name)
+			az.newlyExcludedNodes.Delete(newNode.ObjectMeta.Name)
 		}
 
-		// Add to nodePrivateIPs cache
-		for _, address := range getNodePrivateIPAddresses(newNode) {
-			if az.nodePrivateIPs[newNode.Name] == nil {
-				az.nodePrivateIPs[newNode.Name] = sets.New[string]()
-			}
-			if az.nodePrivateIPToNodeNameMap == nil {
-				az.nodePrivateIPToNodeNameMap = make(map[string]string)
+		// Add to nonVMNodes cache.
+		if hasInstanceProvider {
+			if az.nonVMNodes == nil {
+				az.nonVMNodes = make(map[string]*v1.Node)
 			}
+			az.nonVMNodes[newNode.ObjectMeta.Name] = newNode
+		}
 
-			klog.V(6).Infof("adding IP address %s of the node %s", address, newNode.Name)
-			az.nodePrivateIPs[newNode.Name].Insert(address)
-			az.nodePrivateIPToNodeNameMap[address] = newNode.Name
+		// Add to nodeBackendNICs cache.
+		if backendNIC := strings.TrimSpace(newNode.ObjectMeta.Annotations[consts.NodeLoadBalancerBackendNICAnnotation]); backendNIC != "" {
+			if az.nodeBackendNICs == nil {
+				az.nodeBackendNICs = make(map[string]string)
+			}
+			az.nodeBackendNICs[newNode.ObjectMeta.Name] = backendNIC
 		}
+
+		// Update the private IPs of the node in the node topology.
+		az.updateNodePrivateIPs(newNode.Name, getNodePrivateIPAddresses(newNode))
 	}
 }
 
@@ -1373,13 +2405,7 @@ func (az *Cloud) GetActiveZones() (sets.Set[string], error) {
 		return nil, fmt.Errorf("node informer is not synced when trying to GetActiveZones")
 	}
 
-	zones := sets.New[string]()
-	for zone, nodes := range az.nodeZones {
-		if len(nodes) > 0 {
-			zones.Insert(zone)
-		}
-	}
-	return zones, nil
+	return az.nodeTopology.getZones(), nil
 }
 
 // GetLocation returns the location in which k8s cluster is currently running.
@@ -1462,7 +2488,8 @@ func (az *Cloud) GetUnmanagedNodes() (sets.Set[string], error) {
 	return sets.New(az.unmanagedNodes.UnsortedList()...), nil
 }
 
-// ShouldNodeExcludedFromLoadBalancer returns true if node is unmanaged, in external resource group or labeled with "node.kubernetes.io/exclude-from-external-load-balancers".
+// ShouldNodeExcludedFromLoadBalancer returns true if node is unmanaged, in external resource group, labeled with "node.kubernetes.io/exclude-from-external-load-balancers"
+// or selected by loadBalancerNodeExclusion.
 func (az *Cloud) ShouldNodeExcludedFromLoadBalancer(nodeName string) (bool, error) {
 	// Kubelet won't set az.nodeInformerSynced, always return nil.
 	if az.nodeInformerSynced == nil {
@@ -1475,12 +2502,18 @@ func (az *Cloud) ShouldNodeExcludedFromLoadBalancer(nodeName string) (bool, erro
 		return false, fmt.Errorf("node informer is not synced when trying to fetch node caches")
 	}
 
+	return az.shouldNodeExcludedFromLoadBalancer(nodeName), nil
+}
+
+// shouldNodeExcludedFromLoadBalancer is the same as ShouldNodeExcludedFromLoadBalancer except that
+// the caller should hold the lock of the node caches.
+func (az *Cloud) shouldNodeExcludedFromLoadBalancer(nodeName string) bool {
 	// Return true if the node is in external resource group.
 	if cachedRG, ok := az.nodeResourceGroups[nodeName]; ok && !strings.EqualFold(cachedRG, az.ResourceGroup) {
-		return true, nil
+		return true
 	}
 
-	return az.excludeLoadBalancerNodes.Has(nodeName), nil
+	return az.excludeLoadBalancerNodes.Has(nodeName)
 }
 
 func (az *Cloud) getActiveNodesByLoadBalancerName(lbName string) sets.Set[string] {
@@ -0,0 +1,519 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	applicationGatewayBackendAddressPools = "backendAddressPools"
+	applicationGatewayBackendHTTPSettings = "backendHttpSettingsCollection"
+	applicationGatewayHTTPListeners       = "httpListeners"
+	applicationGatewayFrontendPorts       = "frontendPorts"
+
+	// applicationGatewayRulePriorityMax is the max priority of the request routing rules.
+	applicationGatewayRulePriorityMax = 20000
+	// applicationGatewayRequestTimeoutInSeconds is the request timeout of the backend HTTP settings.
+	applicationGatewayRequestTimeoutInSeconds = 30
+)
+
+// reconcileServiceApplicationGateway exposes the service by the HTTP listeners of the Application Gateway, and
+// removes the load balancer resources of the service in case it was exposed by a load balancer before.
+func (az *Cloud) reconcileServiceApplicationGateway(clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	serviceName := getServiceName(service)
+	klog.V(2).Infof("reconcileServiceApplicationGateway: Start reconciling Service %q with Application Gateway %q", serviceName, az.ApplicationGatewayName)
+
+	status, err := az.reconcileApplicationGateway(service, nodes, true /* wantLb */)
+	if err != nil {
+		klog.Errorf("reconcileApplicationGateway(%s) failed: %v", serviceName, err)
+		return nil, err
+	}
+
+	if err := az.cleanupLoadBalancerResources(clusterName, service); err != nil {
+		klog.Errorf("cleanupLoadBalancerResources(%s) failed: %v", serviceName, err)
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// reconcileApplicationGateway adds, updates or removes the backend pool, backend HTTP settings, HTTP listeners and
+// request routing rules of the service in the Application Gateway. The children are owned by the service if their
+// names start with the rule prefix of the service. It returns the status of the service if wantLb is true.
+func (az *Cloud) reconcileApplicationGateway(service *v1.Service, nodes []*v1.Node, wantLb bool) (*v1.LoadBalancerStatus, error) {
+	if az.ApplicationGatewayName == "" {
+		if wantLb {
+			return nil, fmt.Errorf("reconcileApplicationGateway: applicationGatewayName must be set in the cloud config to use the annotation %s", consts.ServiceAnnotationApplicationGateway)
+		}
+		return nil, nil
+	}
+
+	serviceName := getServiceName(service)
+	appGateway, exists, err := az.getApplicationGateway()
+	if err != nil {
+		return nil, err
+	}
+	if !exists || appGateway.ApplicationGatewayPropertiesFormat == nil {
+		if wantLb {
+			return nil, fmt.Errorf("reconcileApplicationGateway: Application Gateway %s/%s not found", az.getApplicationGatewayResourceGroup(), az.ApplicationGatewayName)
+		}
+		return nil, nil
+	}
+	props := appGateway.ApplicationGatewayPropertiesFormat
+	appGatewayID := pointer.StringDeref(appGateway.ID, "")
+	prefix := az.getRulePrefix(service)
+
+	var frontendIPConfig *network.ApplicationGatewayFrontendIPConfiguration
+	var expectedPools []network.ApplicationGatewayBackendAddressPool
+	var expectedSettings []network.ApplicationGatewayBackendHTTPSettings
+	var expectedListeners []network.ApplicationGatewayHTTPListener
+	var expectedRules []network.ApplicationGatewayRequestRoutingRule
+	changed := false
+	if wantLb {
+		frontendIPConfig, err = selectApplicationGatewayFrontendIPConfig(props.FrontendIPConfigurations, requiresInternalLoadBalancer(service))
+		if err != nil {
+			return nil, err
+		}
+
+		backendAddresses, err := az.getApplicationGatewayBackendAddresses(nodes)
+		if err != nil {
+			return nil, err
+		}
+		expectedPools = append(expectedPools, network.ApplicationGatewayBackendAddressPool{
+			Name: pointer.String(prefix),
+			ApplicationGatewayBackendAddressPoolPropertiesFormat: &network.ApplicationGatewayBackendAddressPoolPropertiesFormat{
+				BackendAddresses: &backendAddresses,
+			},
+		})
+
+		hostName := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationApplicationGatewayHostName])
+		for _, port := range service.Spec.Ports {
+			if port.Protocol != v1.ProtocolTCP {
+				klog.Warningf("reconcileApplicationGateway: ignoring port %d of service %s because only TCP ports are exposed by HTTP listeners", port.Port, serviceName)
+				continue
+			}
+			if port.NodePort == 0 {
+				return nil, fmt.Errorf("reconcileApplicationGateway: port %d of service %s has no node port", port.Port, serviceName)
+			}
+
+			if ensureApplicationGatewayFrontendPort(&appGateway, port.Port) {
+				changed = true
+			}
+			name := fmt.Sprintf("%s-%s-%d", prefix, port.Protocol, port.Port)
+			listener := network.ApplicationGatewayHTTPListener{
+				Name: pointer.String(name),
+				ApplicationGatewayHTTPListenerPropertiesFormat: &network.ApplicationGatewayHTTPListenerPropertiesFormat{
+					FrontendIPConfiguration: &network.SubResource{ID: frontendIPConfig.ID},
+					FrontendPort:            &network.SubResource{ID: pointer.String(getApplicationGatewayChildID(appGatewayID, applicationGatewayFrontendPorts, getApplicationGatewayFrontendPortName(props.FrontendPorts, port.Port)))},
+					Protocol:                network.HTTP,
+				},
+			}
+			if hostName != "" {
+				listener.HostName = pointer.String(hostName)
+			}
+			expectedListeners = append(expectedListeners, listener)
+			expectedSettings = append(expectedSettings, network.ApplicationGatewayBackendHTTPSettings{
+				Name: pointer.String(name),
+				ApplicationGatewayBackendHTTPSettingsPropertiesFormat: &network.ApplicationGatewayBackendHTTPSettingsPropertiesFormat{
+					Port:                pointer.Int32(port.NodePort),
+					Protocol:            network.HTTP,
+					CookieBasedAffinity: network.Disabled,
+					RequestTimeout:      pointer.Int32(applicationGatewayRequestTimeoutInSeconds),
+				},
+			})
+			expectedRules = append(expectedRules, network.ApplicationGatewayRequestRoutingRule{
+				Name: pointer.String(name),
+				ApplicationGatewayRequestRoutingRulePropertiesFormat: &network.ApplicationGatewayRequestRoutingRulePropertiesFormat{
+					RuleType:            network.Basic,
+					HTTPListener:        &network.SubResource{ID: pointer.String(getApplicationGatewayChildID(appGatewayID, applicationGatewayHTTPListeners, name))},
+					BackendAddressPool:  &network.SubResource{ID: pointer.String(getApplicationGatewayChildID(appGatewayID, applicationGatewayBackendAddressPools, prefix))},
+					BackendHTTPSettings: &network.SubResource{ID: pointer.String(getApplicationGatewayChildID(appGatewayID, applicationGatewayBackendHTTPSettings, name))},
+				},
+			})
+		}
+	}
+
+	isOwned := func(name *string) bool {
+		n := strings.ToLower(pointer.StringDeref(name, ""))
+		return n == strings.ToLower(prefix) || strings.HasPrefix(n, strings.ToLower(prefix)+"-")
+	}
+
+	// backend address pools
+	pools, existingPools := make([]network.ApplicationGatewayBackendAddressPool, 0), map[string]string{}
+	if props.BackendAddressPools != nil {
+		for _, pool := range *props.BackendAddressPools {
+			if !isOwned(pool.Name) {
+				pools = append(pools, pool)
+				continue
+			}
+			existingPools[strings.ToLower(pointer.StringDeref(pool.Name, ""))] = getApplicationGatewayBackendAddressPoolFingerprint(pool)
+		}
+	}
+	expectedPoolFingerprints := map[string]string{}
+	for _, pool := range expectedPools {
+		expectedPoolFingerprints[strings.ToLower(pointer.StringDeref(pool.Name, ""))] = getApplicationGatewayBackendAddressPoolFingerprint(pool)
+	}
+	changed = changed || !reflect.DeepEqual(existingPools, expectedPoolFingerprints)
+	props.BackendAddressPools = &pools
+	*props.BackendAddressPools = append(*props.BackendAddressPools, expectedPools...)
+
+	// backend HTTP settings
+	settings, existingSettings := make([]network.ApplicationGatewayBackendHTTPSettings, 0), map[string]string{}
+	if props.BackendHTTPSettingsCollection != nil {
+		for _, setting := range *props.BackendHTTPSettingsCollection {
+			if !isOwned(setting.Name) {
+				settings = append(settings, setting)
+				continue
+			}
+			existingSettings[strings.ToLower(pointer.StringDeref(setting.Name, ""))] = getApplicationGatewayBackendHTTPSettingsFingerprint(setting)
+		}
+	}
+	expectedSettingFingerprints := map[string]string{}
+	for _, setting := range expectedSettings {
+		expectedSettingFingerprints[strings.ToLower(pointer.StringDeref(setting.Name, ""))] = getApplicationGatewayBackendHTTPSettingsFingerprint(setting)
+	}
+	changed = changed || !reflect.DeepEqual(existingSettings, expectedSettingFingerprints)
+	settings = append(settings, expectedSettings...)
+	props.BackendHTTPSettingsCollection = &settings
+
+	// HTTP listeners
+	listeners, existingListeners := make([]network.ApplicationGatewayHTTPListener, 0), map[string]string{}
+	if props.HTTPListeners != nil {
+		for _, listener := range *props.HTTPListeners {
+			if !isOwned(listener.Name) {
+				listeners = append(listeners, listener)
+				continue
+			}
+			existingListeners[strings.ToLower(pointer.StringDeref(listener.Name, ""))] = getApplicationGatewayHTTPListenerFingerprint(listener)
+		}
+	}
+	expectedListenerFingerprints := map[string]string{}
+	for _, listener := range expectedListeners {
+		expectedListenerFingerprints[strings.ToLower(pointer.StringDeref(listener.Name, ""))] = getApplicationGatewayHTTPListenerFingerprint(listener)
+	}
+	changed = changed || !reflect.DeepEqual(existingListeners, expectedListenerFingerprints)
+	listeners = append(listeners, expectedListeners...)
+	props.HTTPListeners = &listeners
+
+	// request routing rules, which keep their priorities
+	rules, existingRules, priorities, usedPriorities := make([]network.ApplicationGatewayRequestRoutingRule, 0), map[string]string{}, map[string]int32{}, sets.New[int32]()
+	if props.RequestRoutingRules != nil {
+		for _, rule := range *props.RequestRoutingRules {
+			priority := int32(0)
+			if rule.ApplicationGatewayRequestRoutingRulePropertiesFormat != nil {
+				priority = pointer.Int32Deref(rule.Priority, 0)
+			}
+			if !isOwned(rule.Name) {
+				rules = append(rules, rule)
+				usedPriorities.Insert(priority)
+				continue
+			}
+			name := strings.ToLower(pointer.StringDeref(rule.Name, ""))
+			existingRules[name] = getApplicationGatewayRequestRoutingRuleFingerprint(rule)
+			priorities[name] = priority
+		}
+	}
+	expectedRuleFingerprints := map[string]string{}
+	for i := range expectedRules {
+		name := strings.ToLower(pointer.StringDeref(expectedRules[i].Name, ""))
+		expectedRuleFingerprints[name] = getApplicationGatewayRequestRoutingRuleFingerprint(expectedRules[i])
+		if priority, ok := priorities[name]; ok && priority > 0 && !usedPriorities.Has(priority) {
+			expectedRules[i].Priority = pointer.Int32(priority)
+			usedPriorities.Insert(priority)
+		}
+	}
+	for i := range expectedRules {
+		if expectedRules[i].Priority != nil {
+			continue
+		}
+		priority, err := getApplicationGatewayRulePriority(usedPriorities)
+		if err != nil {
+			return nil, err
+		}
+		expectedRules[i].Priority = pointer.Int32(priority)
+		usedPriorities.Insert(priority)
+		changed = true
+	}
+	changed = changed || !reflect.DeepEqual(existingRules, expectedRuleFingerprints)
+	rules = append(rules, expectedRules...)
+	props.RequestRoutingRules = &rules
+
+	if removeUnusedApplicationGatewayFrontendPorts(&appGateway) {
+		changed = true
+	}
+
+	if changed {
+		klog.V(2).Infof("reconcileApplicationGateway for service(%s): updating Application Gateway %s, wantLb = %t", serviceName, az.ApplicationGatewayName, wantLb)
+		if err := az.createOrUpdateApplicationGateway(appGateway); err != nil {
+			return nil, err
+		}
+	}
+
+	if !wantLb {
+		return nil, nil
+	}
+	return az.getApplicationGatewayFrontendStatus(frontendIPConfig)
+}
+
+// getApplicationGatewayServiceStatus returns the status of the service exposed by the HTTP listeners of the
+// Application Gateway.
+func (az *Cloud) getApplicationGatewayServiceStatus(service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	if az.ApplicationGatewayName == "" {
+		return nil, false, nil
+	}
+
+	appGateway, exists, err := az.getApplicationGateway()
+	if err != nil || !exists || appGateway.ApplicationGatewayPropertiesFormat == nil || appGateway.HTTPListeners == nil {
+		return nil, false, err
+	}
+
+	prefix := strings.ToLower(az.getRulePrefix(service)) + "-"
+	for _, listener := range *appGateway.HTTPListeners {
+		if !strings.HasPrefix(strings.ToLower(pointer.StringDeref(listener.Name, "")), prefix) ||
+			listener.ApplicationGatewayHTTPListenerPropertiesFormat == nil || listener.FrontendIPConfiguration == nil {
+			continue
+		}
+
+		if appGateway.FrontendIPConfigurations != nil {
+			for i := range *appGateway.FrontendIPConfigurations {
+				frontendIPConfig := &(*appGateway.FrontendIPConfigurations)[i]
+				if strings.EqualFold(pointer.StringDeref(frontendIPConfig.ID, ""), pointer.StringDeref(listener.FrontendIPConfiguration.ID, "")) {
+					status, err := az.getApplicationGatewayFrontendStatus(frontendIPConfig)
+					return status, true, err
+				}
+			}
+		}
+		return nil, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// getApplicationGatewayFrontendStatus returns the status with the IP address of the frontend IP configuration.
+func (az *Cloud) getApplicationGatewayFrontendStatus(frontendIPConfig *network.ApplicationGatewayFrontendIPConfiguration) (*v1.LoadBalancerStatus, error) {
+	if frontendIPConfig == nil || frontendIPConfig.ApplicationGatewayFrontendIPConfigurationPropertiesFormat == nil {
+		return nil, nil
+	}
+
+	ip := pointer.StringDeref(frontendIPConfig.PrivateIPAddress, "")
+	if frontendIPConfig.PublicIPAddress != nil {
+		pipID := pointer.StringDeref(frontendIPConfig.PublicIPAddress.ID, "")
+		resource, err := azure.ParseResourceID(pipID)
+		if err != nil {
+			return nil, fmt.Errorf("getApplicationGatewayFrontendStatus: failed to parse public IP ID %q: %w", pipID, err)
+		}
+		pip, exists, err := az.getPublicIPAddress(resource.ResourceGroup, resource.ResourceName, azcache.CacheReadTypeDefault)
+		if err != nil {
+			return nil, err
+		}
+		if !exists || pip.PublicIPAddressPropertiesFormat == nil {
+			return nil, fmt.Errorf("getApplicationGatewayFrontendStatus: public IP %q of the Application Gateway not found", pipID)
+		}
+		ip = pointer.StringDeref(pip.IPAddress, "")
+	}
+
+	if ip == "" {
+		return nil, nil
+	}
+	return &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: ip}}}, nil
+}
+
+// getApplicationGatewayBackendAddresses returns the sorted IPv4 addresses of the nodes which are not excluded
+// from load balancers.
+func (az *Cloud) getApplicationGatewayBackendAddresses(nodes []*v1.Node) ([]network.ApplicationGatewayBackendAddress, error) {
+	ips := sets.New[string]()
+	for _, node := range nodes {
+		shouldExcludeLoadBalancer, err := az.ShouldNodeExcludedFromLoadBalancer(node.Name)
+		if err != nil {
+			klog.Errorf("ShouldNodeExcludedFromLoadBalancer(%s) failed with error: %v", node.Name, err)
+			return nil, err
+		}
+		if shouldExcludeLoadBalancer {
+			klog.V(4).Infof("getApplicationGatewayBackendAddresses: excluding unmanaged/external-resource-group node %q", node.Name)
+			continue
+		}
+
+		if ip := getNodePrivateIPAddress(node, false); ip != "" {
+			ips.Insert(ip)
+		}
+	}
+
+	addresses := make([]network.ApplicationGatewayBackendAddress, 0, ips.Len())
+	for _, ip := range sets.List(ips) {
+		addresses = append(addresses, network.ApplicationGatewayBackendAddress{IPAddress: pointer.String(ip)})
+	}
+	return addresses, nil
+}
+
+// selectApplicationGatewayFrontendIPConfig returns the first public frontend IP configuration, or the first private
+// one for internal services.
+func selectApplicationGatewayFrontendIPConfig(frontendIPConfigs *[]network.ApplicationGatewayFrontendIPConfiguration, isInternal bool) (*network.ApplicationGatewayFrontendIPConfiguration, error) {
+	if frontendIPConfigs != nil {
+		for i := range *frontendIPConfigs {
+			frontendIPConfig := &(*frontendIPConfigs)[i]
+			if frontendIPConfig.ApplicationGatewayFrontendIPConfigurationPropertiesFormat == nil {
+				continue
+			}
+			if isPublic := frontendIPConfig.PublicIPAddress != nil; isPublic != isInternal {
+				return frontendIPConfig, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("selectApplicationGatewayFrontendIPConfig: no frontend IP configuration found for the internal(%t) service", isInternal)
+}
+
+// ensureApplicationGatewayFrontendPort adds a frontend port for the port if there is none. It returns true if
+// the frontend port is added.
+func ensureApplicationGatewayFrontendPort(appGateway *network.ApplicationGateway, port int32) bool {
+	if getApplicationGatewayFrontendPortName(appGateway.FrontendPorts, port) != "" {
+		return false
+	}
+
+	frontendPorts := make([]network.ApplicationGatewayFrontendPort, 0)
+	if appGateway.FrontendPorts != nil {
+		frontendPorts = append(frontendPorts, *appGateway.FrontendPorts...)
+	}
+	frontendPorts = append(frontendPorts, network.ApplicationGatewayFrontendPort{
+		Name: pointer.String(fmt.Sprintf("%s%d", consts.ApplicationGatewayFrontendPortPrefix, port)),
+		ApplicationGatewayFrontendPortPropertiesFormat: &network.ApplicationGatewayFrontendPortPropertiesFormat{
+			Port: pointer.Int32(port),
+		},
+	})
+	appGateway.FrontendPorts = &frontendPorts
+	return true
+}
+
+// removeUnusedApplicationGatewayFrontendPorts removes the frontend ports added by the cloud provider which are
+// not used by any HTTP listener. It returns true if any frontend port is removed.
+func removeUnusedApplicationGatewayFrontendPorts(appGateway *network.ApplicationGateway) bool {
+	if appGateway.FrontendPorts == nil {
+		return false
+	}
+
+	usedFrontendPortIDs := sets.New[string]()
+	if appGateway.HTTPListeners != nil {
+		for _, listener := range *appGateway.HTTPListeners {
+			if listener.ApplicationGatewayHTTPListenerPropertiesFormat != nil && listener.FrontendPort != nil {
+				usedFrontendPortIDs.Insert(strings.ToLower(pointer.StringDeref(listener.FrontendPort.ID, "")))
+			}
+		}
+	}
+
+	removed := false
+	frontendPorts := make([]network.ApplicationGatewayFrontendPort, 0)
+	for _, frontendPort := range *appGateway.FrontendPorts {
+		name := pointer.StringDeref(frontendPort.Name, "")
+		id := getApplicationGatewayChildID(pointer.StringDeref(appGateway.ID, ""), applicationGatewayFrontendPorts, name)
+		if strings.HasPrefix(name, consts.ApplicationGatewayFrontendPortPrefix) && !usedFrontendPortIDs.Has(strings.ToLower(id)) {
+			removed = true
+			continue
+		}
+		frontendPorts = append(frontendPorts, frontendPort)
+	}
+	appGateway.FrontendPorts = &frontendPorts
+	return removed
+}
+
+// getApplicationGatewayFrontendPortName returns the name of the frontend port for the port.
+func getApplicationGatewayFrontendPortName(frontendPorts *[]network.ApplicationGatewayFrontendPort, port int32) string {
+	if frontendPorts == nil {
+		return ""
+	}
+	for _, frontendPort := range *frontendPorts {
+		if frontendPort.ApplicationGatewayFrontendPortPropertiesFormat != nil && pointer.Int32Deref(frontendPort.Port, 0) == port {
+			return pointer.StringDeref(frontendPort.Name, "")
+		}
+	}
+	return ""
+}
+
+// getApplicationGatewayRulePriority returns the lowest unused priority of the request routing rules.
+func getApplicationGatewayRulePriority(usedPriorities sets.Set[int32]) (int32, error) {
+	for priority := int32(1); priority <= applicationGatewayRulePriorityMax; priority++ {
+		if !usedPriorities.Has(priority) {
+			return priority, nil
+		}
+	}
+	return 0, fmt.Errorf("getApplicationGatewayRulePriority: all the %d priorities of the request routing rules are used", applicationGatewayRulePriorityMax)
+}
+
+func getApplicationGatewayChildID(appGatewayID, childType, name string) string {
+	return fmt.Sprintf("%s/%s/%s", appGatewayID, childType, name)
+}
+
+func getApplicationGatewayBackendAddressPoolFingerprint(pool network.ApplicationGatewayBackendAddressPool) string {
+	ips := make([]string, 0)
+	if pool.ApplicationGatewayBackendAddressPoolPropertiesFormat != nil && pool.BackendAddresses != nil {
+		for _, address := range *pool.BackendAddresses {
+			ips = append(ips, pointer.StringDeref(address.IPAddress, ""))
+		}
+	}
+	sort.Strings(ips)
+	return strings.Join(ips, ",")
+}
+
+func getApplicationGatewayBackendHTTPSettingsFingerprint(setting network.ApplicationGatewayBackendHTTPSettings) string {
+	if setting.ApplicationGatewayBackendHTTPSettingsPropertiesFormat == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%s", pointer.Int32Deref(setting.Port, 0), setting.Protocol)
+}
+
+func getApplicationGatewayHTTPListenerFingerprint(listener network.ApplicationGatewayHTTPListener) string {
+	if listener.ApplicationGatewayHTTPListenerPropertiesFormat == nil {
+		return ""
+	}
+	var frontendIPConfigID, frontendPortID string
+	if listener.FrontendIPConfiguration != nil {
+		frontendIPConfigID = pointer.StringDeref(listener.FrontendIPConfiguration.ID, "")
+	}
+	if listener.FrontendPort != nil {
+		frontendPortID = pointer.StringDeref(listener.FrontendPort.ID, "")
+	}
+	return strings.ToLower(fmt.Sprintf("%s/%s/%s/%s", frontendIPConfigID, frontendPortID, listener.Protocol, pointer.StringDeref(listener.HostName, "")))
+}
+
+func getApplicationGatewayRequestRoutingRuleFingerprint(rule network.ApplicationGatewayRequestRoutingRule) string {
+	if rule.ApplicationGatewayRequestRoutingRulePropertiesFormat == nil {
+		return ""
+	}
+	ids := make([]string, 0)
+	for _, subResource := range []*network.SubResource{rule.HTTPListener, rule.BackendAddressPool, rule.BackendHTTPSettings} {
+		if subResource != nil {
+			ids = append(ids, pointer.StringDeref(subResource.ID, ""))
+		} else {
+			ids = append(ids, "")
+		}
+	}
+	return strings.ToLower(fmt.Sprintf("%s/%s", rule.RuleType, strings.Join(ids, "/")))
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+)
+
+func (az *Cloud) getApplicationGatewayResourceGroup() string {
+	if az.ApplicationGatewayResourceGroup != "" {
+		return az.ApplicationGatewayResourceGroup
+	}
+
+	return az.ResourceGroup
+}
+
+// getApplicationGateway gets the Application Gateway set by applicationGatewayName in the cloud config.
+func (az *Cloud) getApplicationGateway() (network.ApplicationGateway, bool, error) {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	appGateway, rerr := az.ApplicationGatewayClient.Get(ctx, az.getApplicationGatewayResourceGroup(), az.ApplicationGatewayName)
+	exists, rerr := checkResourceExistsFromError(rerr)
+	if rerr != nil {
+		return appGateway, false, rerr.Error()
+	}
+
+	if !exists {
+		klog.V(2).Infof("Application Gateway %s/%s not found", az.getApplicationGatewayResourceGroup(), az.ApplicationGatewayName)
+		return appGateway, false, nil
+	}
+
+	return appGateway, true, nil
+}
+
+// createOrUpdateApplicationGateway invokes az.ApplicationGatewayClient.CreateOrUpdate with the etag of the
+// Application Gateway.
+func (az *Cloud) createOrUpdateApplicationGateway(appGateway network.ApplicationGateway) error {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	rerr := az.ApplicationGatewayClient.CreateOrUpdate(ctx, az.getApplicationGatewayResourceGroup(), az.ApplicationGatewayName, appGateway, pointer.StringDeref(appGateway.Etag, ""))
+	if rerr == nil {
+		return nil
+	}
+
+	appGatewayJSON, _ := json.Marshal(appGateway)
+	klog.Warningf("ApplicationGatewayClient.CreateOrUpdate(%s) failed: %v, ApplicationGateway request: %s", az.ApplicationGatewayName, rerr.Error(), string(appGatewayJSON))
+	if rerr.HTTPStatusCode == http.StatusPreconditionFailed {
+		klog.V(3).Infof("Application Gateway %s is changed by another operation, the update would be retried", az.ApplicationGatewayName)
+	}
+	return rerr.Error()
+}
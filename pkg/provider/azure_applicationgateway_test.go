@@ -0,0 +1,195 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationgatewayclient/mockapplicationgatewayclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const testApplicationGatewayID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationGateways/appgw"
+
+func getTestApplicationGateway() network.ApplicationGateway {
+	return network.ApplicationGateway{
+		Name: pointer.String("appgw"),
+		ID:   pointer.String(testApplicationGatewayID),
+		Etag: pointer.String("etag"),
+		ApplicationGatewayPropertiesFormat: &network.ApplicationGatewayPropertiesFormat{
+			FrontendIPConfigurations: &[]network.ApplicationGatewayFrontendIPConfiguration{
+				{
+					Name: pointer.String("private"),
+					ID:   pointer.String(testApplicationGatewayID + "/frontendIPConfigurations/private"),
+					ApplicationGatewayFrontendIPConfigurationPropertiesFormat: &network.ApplicationGatewayFrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddress: pointer.String("10.1.0.4"),
+					},
+				},
+			},
+			FrontendPorts: &[]network.ApplicationGatewayFrontendPort{
+				{
+					Name: pointer.String("port-8080"),
+					ApplicationGatewayFrontendPortPropertiesFormat: &network.ApplicationGatewayFrontendPortPropertiesFormat{
+						Port: pointer.Int32(8080),
+					},
+				},
+			},
+			BackendAddressPools: &[]network.ApplicationGatewayBackendAddressPool{
+				{Name: pointer.String("other-pool")},
+			},
+			RequestRoutingRules: &[]network.ApplicationGatewayRequestRoutingRule{
+				{
+					Name: pointer.String("other-rule"),
+					ApplicationGatewayRequestRoutingRulePropertiesFormat: &network.ApplicationGatewayRequestRoutingRulePropertiesFormat{
+						Priority: pointer.Int32(1),
+					},
+				},
+			},
+		},
+	}
+}
+
+func getTestApplicationGatewayNodes() []*v1.Node {
+	return []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node2"},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.5"}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.4"}}},
+		},
+	}
+}
+
+func TestReconcileApplicationGateway(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.ApplicationGatewayName = "appgw"
+	mockClient := az.ApplicationGatewayClient.(*mockapplicationgatewayclient.MockInterface)
+
+	service := getInternalTestService("service", 80, 8080)
+	service.Annotations[consts.ServiceAnnotationApplicationGateway] = consts.TrueAnnotationValue
+	service.Annotations[consts.ServiceAnnotationApplicationGatewayHostName] = "www.contoso.com"
+	prefix := az.getRulePrefix(&service)
+
+	// the children of the service are added
+	var updated network.ApplicationGateway
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "appgw").Return(getTestApplicationGateway(), nil)
+	mockClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "appgw", gomock.Any(), "etag").DoAndReturn(
+		func(ctx context.Context, resourceGroupName, applicationGatewayName string, parameters network.ApplicationGateway, etag string) *retry.Error {
+			updated = parameters
+			return nil
+		})
+	status, err := az.reconcileApplicationGateway(&service, getTestApplicationGatewayNodes(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.1.0.4"}}}, status)
+
+	assert.Equal(t, 2, len(*updated.BackendAddressPools))
+	pool := (*updated.BackendAddressPools)[1]
+	assert.Equal(t, prefix, *pool.Name)
+	assert.Equal(t, []network.ApplicationGatewayBackendAddress{{IPAddress: pointer.String("10.0.0.4")}, {IPAddress: pointer.String("10.0.0.5")}}, *pool.BackendAddresses)
+
+	assert.Equal(t, 2, len(*updated.FrontendPorts))
+	assert.Equal(t, "port-8080", *(*updated.FrontendPorts)[0].Name)
+	assert.Equal(t, "k8s-port-80", *(*updated.FrontendPorts)[1].Name)
+
+	assert.Equal(t, 2, len(*updated.HTTPListeners))
+	listener := (*updated.HTTPListeners)[1]
+	assert.Equal(t, prefix+"-TCP-8080", *listener.Name)
+	assert.Equal(t, testApplicationGatewayID+"/frontendIPConfigurations/private", *listener.FrontendIPConfiguration.ID)
+	assert.Equal(t, testApplicationGatewayID+"/frontendPorts/port-8080", *listener.FrontendPort.ID)
+	assert.Equal(t, "www.contoso.com", *listener.HostName)
+
+	assert.Equal(t, 2, len(*updated.BackendHTTPSettingsCollection))
+	assert.Equal(t, getBackendPort(8080), *(*updated.BackendHTTPSettingsCollection)[1].Port)
+
+	assert.Equal(t, 3, len(*updated.RequestRoutingRules))
+	assert.Equal(t, "other-rule", *(*updated.RequestRoutingRules)[0].Name)
+	assert.Equal(t, int32(2), *(*updated.RequestRoutingRules)[1].Priority)
+	assert.Equal(t, int32(3), *(*updated.RequestRoutingRules)[2].Priority)
+	assert.Equal(t, testApplicationGatewayID+"/backendAddressPools/"+prefix, *(*updated.RequestRoutingRules)[2].BackendAddressPool.ID)
+
+	// nothing is updated if the children are up to date
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "appgw").Return(updated, nil)
+	status, err = az.reconcileApplicationGateway(&service, getTestApplicationGatewayNodes(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.1.0.4"}}}, status)
+
+	// the status is got from the listeners of the service
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "appgw").Return(updated, nil)
+	status, exists, err := az.getApplicationGatewayServiceStatus(&service)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.1.0.4"}}}, status)
+
+	// the children of the service and the unused frontend ports are removed
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "appgw").Return(updated, nil)
+	mockClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "appgw", gomock.Any(), "etag").DoAndReturn(
+		func(ctx context.Context, resourceGroupName, applicationGatewayName string, parameters network.ApplicationGateway, etag string) *retry.Error {
+			assert.Equal(t, getTestApplicationGateway().BackendAddressPools, parameters.BackendAddressPools)
+			assert.Equal(t, getTestApplicationGateway().FrontendPorts, parameters.FrontendPorts)
+			assert.Equal(t, getTestApplicationGateway().RequestRoutingRules, parameters.RequestRoutingRules)
+			assert.Empty(t, *parameters.HTTPListeners)
+			assert.Empty(t, *parameters.BackendHTTPSettingsCollection)
+			return nil
+		})
+	status, err = az.reconcileApplicationGateway(&service, nil, false)
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+}
+
+func TestReconcileApplicationGatewayErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	mockClient := az.ApplicationGatewayClient.(*mockapplicationgatewayclient.MockInterface)
+	service := getTestService("service", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationApplicationGateway: consts.TrueAnnotationValue}, false, 80)
+
+	// the Application Gateway is not configured
+	_, err := az.reconcileApplicationGateway(&service, nil, true)
+	assert.Error(t, err)
+	_, err = az.reconcileApplicationGateway(&service, nil, false)
+	assert.NoError(t, err)
+
+	// the Application Gateway is not found
+	az.ApplicationGatewayName = "appgw"
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "appgw").Return(network.ApplicationGateway{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).Times(2)
+	_, err = az.reconcileApplicationGateway(&service, nil, true)
+	assert.Error(t, err)
+	_, err = az.reconcileApplicationGateway(&service, nil, false)
+	assert.NoError(t, err)
+
+	// there is no public frontend IP configuration for the external service
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "appgw").Return(getTestApplicationGateway(), nil)
+	_, err = az.reconcileApplicationGateway(&service, nil, true)
+	assert.Error(t, err)
+}
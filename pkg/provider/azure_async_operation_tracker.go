@@ -0,0 +1,204 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// asyncOperationsPersistTimeout is the timeout of writing the tracked operations to the configmap.
+const asyncOperationsPersistTimeout = 10 * time.Second
+
+// asyncOperationTracker persists the futures of the in-flight long-running operations in a configmap, so that the
+// Azure clients resume polling them after the cloud-controller-manager restarts instead of issuing duplicate requests.
+// The operations are only tracked in memory before the kube client is initialized. The configmap is written in the
+// background, and the changes made while it is being written are coalesced into the next write, so that the ARM
+// requests are not blocked by the API server.
+type asyncOperationTracker struct {
+	lock       sync.Mutex
+	kubeClient clientset.Interface
+	// futures are the marshaled futures of the operations, keyed by the lower-cased resource IDs.
+	futures map[string]json.RawMessage
+	// dirty is true if the operations are changed since the last snapshot written to the configmap.
+	dirty bool
+	// persisting is true while the configmap is being written in the background.
+	persisting bool
+	// writers tracks the background writes of the configmap.
+	writers sync.WaitGroup
+}
+
+func newAsyncOperationTracker() *asyncOperationTracker {
+	return &asyncOperationTracker{
+		futures: make(map[string]json.RawMessage),
+	}
+}
+
+// initialize loads the operations persisted before the restart, and persists the operations tracked before.
+func (t *asyncOperationTracker) initialize(ctx context.Context, kubeClient clientset.Interface) {
+	cm, err := kubeClient.CoreV1().ConfigMaps(consts.AsyncOperationsConfigMapNamespace).Get(ctx, consts.AsyncOperationsConfigMapName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.Errorf("asyncOperationTracker: failed to get configmap %s/%s: %v", consts.AsyncOperationsConfigMapNamespace, consts.AsyncOperationsConfigMapName, err)
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.kubeClient = kubeClient
+	trackedBefore := len(t.futures) > 0
+	if err == nil && cm.Data[consts.AsyncOperationsConfigMapKey] != "" {
+		futures := make(map[string]json.RawMessage)
+		if err := json.Unmarshal([]byte(cm.Data[consts.AsyncOperationsConfigMapKey]), &futures); err != nil {
+			klog.Errorf("asyncOperationTracker: failed to parse the operations in configmap %s/%s: %v", consts.AsyncOperationsConfigMapNamespace, consts.AsyncOperationsConfigMapName, err)
+		}
+		for resourceID, future := range futures {
+			if _, found := t.futures[resourceID]; !found {
+				klog.V(2).Infof("asyncOperationTracker: found the in-flight operation on resource %s", resourceID)
+				t.futures[resourceID] = future
+			}
+		}
+	}
+	if trackedBefore {
+		t.requestPersist()
+	}
+}
+
+// Get returns the future of the in-flight operation on the resource, or nil if there is none.
+func (t *asyncOperationTracker) Get(resourceID string) *azure.Future {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	data, found := t.futures[strings.ToLower(resourceID)]
+	if !found {
+		return nil
+	}
+	future := &azure.Future{}
+	if err := future.UnmarshalJSON(data); err != nil {
+		klog.Warningf("asyncOperationTracker: failed to parse the operation on resource %s: %v", resourceID, err)
+		delete(t.futures, strings.ToLower(resourceID))
+		t.requestPersist()
+		return nil
+	}
+	return future
+}
+
+// Set records the future of the in-flight operation on the resource.
+func (t *asyncOperationTracker) Set(resourceID string, future *azure.Future) {
+	data, err := future.MarshalJSON()
+	if err != nil {
+		klog.Warningf("asyncOperationTracker: failed to marshal the operation on resource %s: %v", resourceID, err)
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.futures[strings.ToLower(resourceID)] = data
+	t.requestPersist()
+}
+
+// Delete removes the operation on the resource after it is completed.
+func (t *asyncOperationTracker) Delete(resourceID string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, found := t.futures[strings.ToLower(resourceID)]; !found {
+		return
+	}
+	delete(t.futures, strings.ToLower(resourceID))
+	t.requestPersist()
+}
+
+// requestPersist marks the operations changed, and starts writing them to the configmap in the background unless a
+// write is in progress, which writes them again after it completes. The caller should hold the lock.
+func (t *asyncOperationTracker) requestPersist() {
+	if t.kubeClient == nil {
+		return
+	}
+	t.dirty = true
+	if t.persisting {
+		return
+	}
+	t.persisting = true
+	t.writers.Add(1)
+	go func() {
+		defer t.writers.Done()
+		for {
+			t.lock.Lock()
+			if !t.dirty {
+				t.persisting = false
+				t.lock.Unlock()
+				return
+			}
+			data, err := json.Marshal(t.futures)
+			t.dirty = false
+			t.lock.Unlock()
+
+			if err != nil {
+				klog.Errorf("asyncOperationTracker: failed to marshal the operations: %v", err)
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), asyncOperationsPersistTimeout)
+			t.persist(ctx, data)
+			cancel()
+		}
+	}()
+}
+
+// persist writes the snapshot of the tracked operations to the configmap. The failures are only logged, since the
+// operations are still tracked in memory.
+func (t *asyncOperationTracker) persist(ctx context.Context, data []byte) {
+	configMaps := t.kubeClient.CoreV1().ConfigMaps(consts.AsyncOperationsConfigMapNamespace)
+	cm, err := configMaps.Get(ctx, consts.AsyncOperationsConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      consts.AsyncOperationsConfigMapName,
+				Namespace: consts.AsyncOperationsConfigMapNamespace,
+			},
+			Data: map[string]string{consts.AsyncOperationsConfigMapKey: string(data)},
+		}
+		if _, err := configMaps.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			klog.Errorf("asyncOperationTracker: failed to create configmap %s/%s: %v", consts.AsyncOperationsConfigMapNamespace, consts.AsyncOperationsConfigMapName, err)
+		}
+		return
+	}
+	if err != nil {
+		klog.Errorf("asyncOperationTracker: failed to get configmap %s/%s: %v", consts.AsyncOperationsConfigMapNamespace, consts.AsyncOperationsConfigMapName, err)
+		return
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[consts.AsyncOperationsConfigMapKey] = string(data)
+	if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		klog.Errorf("asyncOperationTracker: failed to update configmap %s/%s: %v", consts.AsyncOperationsConfigMapNamespace, consts.AsyncOperationsConfigMapName, err)
+	}
+}
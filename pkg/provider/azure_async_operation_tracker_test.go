@@ -0,0 +1,108 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func getTestFuture(t *testing.T, operationURL string) *azure.Future {
+	resourceURL, _ := url.Parse("https://management.azure.com/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb")
+	future, err := azure.NewFutureFromResponse(&http.Response{
+		StatusCode: http.StatusCreated,
+		Header:     http.Header{"Azure-Asyncoperation": []string{operationURL}},
+		Request:    &http.Request{Method: http.MethodPut, URL: resourceURL},
+	})
+	assert.NoError(t, err)
+	return &future
+}
+
+func TestAsyncOperationTracker(t *testing.T) {
+	resourceID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/LB"
+	operationURL := "https://management.azure.com/subscriptions/sub/providers/Microsoft.Network/locations/eastus/operations/op"
+	kubeClient := fake.NewSimpleClientset()
+
+	// the operations tracked before the kube client is initialized should be persisted
+	tracker := newAsyncOperationTracker()
+	tracker.Set(resourceID, getTestFuture(t, operationURL))
+	tracker.initialize(context.TODO(), kubeClient)
+	tracker.writers.Wait()
+	cm, err := kubeClient.CoreV1().ConfigMaps(consts.AsyncOperationsConfigMapNamespace).Get(context.TODO(), consts.AsyncOperationsConfigMapName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, cm.Data[consts.AsyncOperationsConfigMapKey], operationURL)
+
+	// the operations should be resumed after restarts
+	restartedTracker := newAsyncOperationTracker()
+	assert.Nil(t, restartedTracker.Get(resourceID))
+	restartedTracker.initialize(context.TODO(), kubeClient)
+	future := restartedTracker.Get(resourceID)
+	assert.NotNil(t, future)
+	assert.Equal(t, operationURL, future.PollingURL())
+
+	restartedTracker.Delete(resourceID)
+	assert.Nil(t, restartedTracker.Get(resourceID))
+	restartedTracker.writers.Wait()
+	cm, err = kubeClient.CoreV1().ConfigMaps(consts.AsyncOperationsConfigMapNamespace).Get(context.TODO(), consts.AsyncOperationsConfigMapName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotContains(t, cm.Data[consts.AsyncOperationsConfigMapKey], operationURL)
+}
+
+func TestAsyncOperationTrackerCoalescesWrites(t *testing.T) {
+	operationURL := "https://management.azure.com/subscriptions/sub/providers/Microsoft.Network/locations/eastus/operations/op"
+	kubeClient := fake.NewSimpleClientset()
+	tracker := newAsyncOperationTracker()
+	tracker.initialize(context.TODO(), kubeClient)
+
+	// the configmap is written in the background, so the operations are tracked while the API server is slow
+	started, written := make(chan struct{}), make(chan struct{})
+	writes := 0
+	kubeClient.PrependReactor("get", "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+		writes++
+		if writes == 1 {
+			close(started)
+			<-written
+		}
+		return false, nil, nil
+	})
+	for i := 0; i < 10; i++ {
+		tracker.Set(fmt.Sprintf("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb%d", i), getTestFuture(t, operationURL))
+		if i == 0 {
+			<-started
+		}
+	}
+	close(written)
+	tracker.writers.Wait()
+
+	// the changes made during the first write are coalesced into the second one
+	assert.Equal(t, 2, writes)
+	cm, err := kubeClient.CoreV1().ConfigMaps(consts.AsyncOperationsConfigMapNamespace).Get(context.TODO(), consts.AsyncOperationsConfigMapName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, cm.Data[consts.AsyncOperationsConfigMapKey], "lb9")
+}
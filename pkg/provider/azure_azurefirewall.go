@@ -0,0 +1,310 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	v1 "k8s.io/api/core/v1"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// reconcileAzureFirewall adds, updates or removes the DNAT rules of the service in the NAT rule collection of the
+// cluster in the Azure Firewall. The rules translate the traffic to the public IP of the firewall to the frontend IP
+// of the service on the internal load balancer. The rules are owned by the service if their names start with the
+// rule prefix of the service, and the collection is removed once it has no rules. It returns the public IP of the
+// firewall if wantLb is true.
+func (az *Cloud) reconcileAzureFirewall(clusterName string, service *v1.Service, lbIPs []string, wantLb bool) (string, error) {
+	if az.AzureFirewallName == "" {
+		if wantLb {
+			return "", fmt.Errorf("reconcileAzureFirewall: azureFirewallName must be set in the cloud config to use the annotation %s", consts.ServiceAnnotationAzureFirewallDNAT)
+		}
+		return "", nil
+	}
+
+	serviceName := getServiceName(service)
+	firewall, exists, err := az.getAzureFirewall()
+	if err != nil {
+		return "", err
+	}
+	if !exists || firewall.AzureFirewallPropertiesFormat == nil {
+		if wantLb {
+			return "", fmt.Errorf("reconcileAzureFirewall: Azure Firewall %s/%s not found", az.getAzureFirewallResourceGroup(), az.AzureFirewallName)
+		}
+		return "", nil
+	}
+	props := firewall.AzureFirewallPropertiesFormat
+	prefix := az.getRulePrefix(service)
+	collectionName := consts.AzureFirewallNATRuleCollectionPrefix + clusterName
+
+	var firewallIP string
+	var expectedRules []network.AzureFirewallNatRule
+	if wantLb {
+		if firewallIP, err = az.getAzureFirewallPublicIP(&firewall, service.Annotations[consts.ServiceAnnotationAzureFirewallPublicIPName]); err != nil {
+			return "", err
+		}
+		if expectedRules, err = getExpectedAzureFirewallNATRules(service, prefix, firewallIP, lbIPs); err != nil {
+			return "", err
+		}
+	}
+
+	isOwned := func(name *string) bool {
+		return strings.HasPrefix(strings.ToLower(pointer.StringDeref(name, "")), strings.ToLower(prefix)+"-")
+	}
+
+	collections := make([]network.AzureFirewallNatRuleCollection, 0)
+	var collection *network.AzureFirewallNatRuleCollection
+	if props.NatRuleCollections != nil {
+		for i := range *props.NatRuleCollections {
+			c := (*props.NatRuleCollections)[i]
+			if strings.EqualFold(pointer.StringDeref(c.Name, ""), collectionName) {
+				collection = &c
+				continue
+			}
+			if c.AzureFirewallNatRuleCollectionProperties != nil {
+				if err := checkAzureFirewallNATRuleConflicts(pointer.StringDeref(c.Name, ""), c.Rules, expectedRules); err != nil {
+					return "", err
+				}
+			}
+			collections = append(collections, c)
+		}
+	}
+
+	rules, existingRules := make([]network.AzureFirewallNatRule, 0), map[string]string{}
+	if collection != nil && collection.AzureFirewallNatRuleCollectionProperties != nil && collection.Rules != nil {
+		for _, rule := range *collection.Rules {
+			if !isOwned(rule.Name) {
+				rules = append(rules, rule)
+				continue
+			}
+			existingRules[strings.ToLower(pointer.StringDeref(rule.Name, ""))] = getAzureFirewallNATRuleFingerprint(rule)
+		}
+	}
+	if err := checkAzureFirewallNATRuleConflicts(collectionName, &rules, expectedRules); err != nil {
+		return "", err
+	}
+	expectedRuleFingerprints := map[string]string{}
+	for _, rule := range expectedRules {
+		expectedRuleFingerprints[strings.ToLower(pointer.StringDeref(rule.Name, ""))] = getAzureFirewallNATRuleFingerprint(rule)
+	}
+	if reflect.DeepEqual(existingRules, expectedRuleFingerprints) {
+		if !wantLb {
+			return "", nil
+		}
+		return firewallIP, nil
+	}
+
+	rules = append(rules, expectedRules...)
+	if len(rules) > 0 {
+		if collection == nil {
+			priority := az.AzureFirewallNATRuleCollectionPriority
+			if priority == 0 {
+				priority = consts.AzureFirewallNATRuleCollectionPriorityDefault
+			}
+			collection = &network.AzureFirewallNatRuleCollection{
+				Name: pointer.String(collectionName),
+				AzureFirewallNatRuleCollectionProperties: &network.AzureFirewallNatRuleCollectionProperties{
+					Priority: pointer.Int32(priority),
+					Action:   &network.AzureFirewallNatRCAction{Type: network.Dnat},
+				},
+			}
+		} else if collection.AzureFirewallNatRuleCollectionProperties == nil {
+			collection.AzureFirewallNatRuleCollectionProperties = &network.AzureFirewallNatRuleCollectionProperties{}
+		}
+		collection.Rules = &rules
+		collections = append(collections, *collection)
+	} else {
+		klog.V(2).Infof("reconcileAzureFirewall for service(%s): removing the empty NAT rule collection %s", serviceName, collectionName)
+	}
+	props.NatRuleCollections = &collections
+
+	klog.V(2).Infof("reconcileAzureFirewall for service(%s): updating Azure Firewall %s, wantLb = %t", serviceName, az.AzureFirewallName, wantLb)
+	if err := az.createOrUpdateAzureFirewall(firewall); err != nil {
+		return "", err
+	}
+
+	if !wantLb {
+		return "", nil
+	}
+	return firewallIP, nil
+}
+
+// getExpectedAzureFirewallNATRules returns the DNAT rules of the ports of the service, which translate the traffic
+// to the public IP of the firewall to the IPv4 frontend IP of the service on the internal load balancer.
+func getExpectedAzureFirewallNATRules(service *v1.Service, prefix, firewallIP string, lbIPs []string) ([]network.AzureFirewallNatRule, error) {
+	var translatedAddress string
+	for _, ip := range lbIPs {
+		if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil {
+			translatedAddress = ip
+			break
+		}
+	}
+	if translatedAddress == "" {
+		return nil, fmt.Errorf("getExpectedAzureFirewallNATRules: no IPv4 frontend IP of service %s found in %q", getServiceName(service), lbIPs)
+	}
+
+	sourceAddresses := []string{"*"}
+	sourceRanges, err := servicehelpers.GetLoadBalancerSourceRanges(service)
+	if err != nil {
+		return nil, err
+	}
+	if !servicehelpers.IsAllowAll(sourceRanges) {
+		sourceAddresses = sourceRanges.StringSlice()
+		sort.Strings(sourceAddresses)
+	}
+
+	rules := make([]network.AzureFirewallNatRule, 0, len(service.Spec.Ports))
+	for _, port := range service.Spec.Ports {
+		var protocol network.AzureFirewallNetworkRuleProtocol
+		switch port.Protocol {
+		case v1.ProtocolTCP:
+			protocol = network.AzureFirewallNetworkRuleProtocolTCP
+		case v1.ProtocolUDP:
+			protocol = network.AzureFirewallNetworkRuleProtocolUDP
+		default:
+			klog.Warningf("getExpectedAzureFirewallNATRules: ignoring port %d of service %s because protocol %s is not supported by DNAT rules", port.Port, getServiceName(service), port.Protocol)
+			continue
+		}
+
+		portString := strconv.Itoa(int(port.Port))
+		rules = append(rules, network.AzureFirewallNatRule{
+			Name:                 pointer.String(fmt.Sprintf("%s-%s-%d", prefix, port.Protocol, port.Port)),
+			SourceAddresses:      &sourceAddresses,
+			DestinationAddresses: &[]string{firewallIP},
+			DestinationPorts:     &[]string{portString},
+			Protocols:            &[]network.AzureFirewallNetworkRuleProtocol{protocol},
+			TranslatedAddress:    pointer.String(translatedAddress),
+			TranslatedPort:       pointer.String(portString),
+		})
+	}
+	return rules, nil
+}
+
+// checkAzureFirewallNATRuleConflicts returns an error if one of the rules, which are not owned by the service,
+// translates the same destination IP, port and protocol as one of the expected rules.
+func checkAzureFirewallNATRuleConflicts(collectionName string, rules *[]network.AzureFirewallNatRule, expectedRules []network.AzureFirewallNatRule) error {
+	if len(expectedRules) == 0 || rules == nil {
+		return nil
+	}
+
+	for _, rule := range *rules {
+		for _, expected := range expectedRules {
+			if stringSlicesIntersect(rule.DestinationAddresses, expected.DestinationAddresses) &&
+				stringSlicesIntersect(rule.DestinationPorts, expected.DestinationPorts) &&
+				protocolsIntersect(rule.Protocols, expected.Protocols) {
+				return fmt.Errorf("checkAzureFirewallNATRuleConflicts: rule %s of NAT rule collection %s conflicts with rule %s of the service",
+					pointer.StringDeref(rule.Name, ""), collectionName, pointer.StringDeref(expected.Name, ""))
+			}
+		}
+	}
+	return nil
+}
+
+// getAzureFirewallPublicIP returns the IP address of the public IP of the firewall with the given name, or of the
+// first IP configuration with a public IP if the name is empty.
+func (az *Cloud) getAzureFirewallPublicIP(firewall *network.AzureFirewall, pipName string) (string, error) {
+	if firewall.IPConfigurations != nil {
+		for _, ipConfig := range *firewall.IPConfigurations {
+			if ipConfig.AzureFirewallIPConfigurationPropertiesFormat == nil || ipConfig.PublicIPAddress == nil {
+				continue
+			}
+			pipID := pointer.StringDeref(ipConfig.PublicIPAddress.ID, "")
+			resource, err := azure.ParseResourceID(pipID)
+			if err != nil {
+				return "", fmt.Errorf("getAzureFirewallPublicIP: failed to parse public IP ID %q: %w", pipID, err)
+			}
+			if pipName != "" && !strings.EqualFold(resource.ResourceName, pipName) {
+				continue
+			}
+
+			pip, exists, err := az.getPublicIPAddress(resource.ResourceGroup, resource.ResourceName, azcache.CacheReadTypeDefault)
+			if err != nil {
+				return "", err
+			}
+			if !exists || pip.PublicIPAddressPropertiesFormat == nil || pointer.StringDeref(pip.IPAddress, "") == "" {
+				return "", fmt.Errorf("getAzureFirewallPublicIP: IP address of public IP %q of the Azure Firewall not found", pipID)
+			}
+			return pointer.StringDeref(pip.IPAddress, ""), nil
+		}
+	}
+
+	if pipName != "" {
+		return "", fmt.Errorf("getAzureFirewallPublicIP: public IP %s is not associated with Azure Firewall %s", pipName, az.AzureFirewallName)
+	}
+	return "", fmt.Errorf("getAzureFirewallPublicIP: no public IP is associated with Azure Firewall %s", az.AzureFirewallName)
+}
+
+func getAzureFirewallNATRuleFingerprint(rule network.AzureFirewallNatRule) string {
+	sortedStrings := func(s *[]string) []string {
+		if s == nil {
+			return nil
+		}
+		sorted := append([]string{}, *s...)
+		sort.Strings(sorted)
+		return sorted
+	}
+	var protocols []string
+	if rule.Protocols != nil {
+		for _, protocol := range *rule.Protocols {
+			protocols = append(protocols, strings.ToLower(string(protocol)))
+		}
+		sort.Strings(protocols)
+	}
+	return fmt.Sprintf("%v|%v|%v|%v|%s|%s", sortedStrings(rule.SourceAddresses), sortedStrings(rule.DestinationAddresses),
+		sortedStrings(rule.DestinationPorts), protocols, pointer.StringDeref(rule.TranslatedAddress, ""), pointer.StringDeref(rule.TranslatedPort, ""))
+}
+
+func stringSlicesIntersect(a, b *[]string) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	for _, x := range *a {
+		for _, y := range *b {
+			if strings.EqualFold(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func protocolsIntersect(a, b *[]network.AzureFirewallNetworkRuleProtocol) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	for _, x := range *a {
+		for _, y := range *b {
+			if x == y || x == network.AzureFirewallNetworkRuleProtocolAny || y == network.AzureFirewallNetworkRuleProtocolAny {
+				return true
+			}
+		}
+	}
+	return false
+}
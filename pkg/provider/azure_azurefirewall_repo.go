@@ -0,0 +1,72 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+)
+
+func (az *Cloud) getAzureFirewallResourceGroup() string {
+	if az.AzureFirewallResourceGroup != "" {
+		return az.AzureFirewallResourceGroup
+	}
+
+	return az.ResourceGroup
+}
+
+// getAzureFirewall gets the Azure Firewall set by azureFirewallName in the cloud config.
+func (az *Cloud) getAzureFirewall() (network.AzureFirewall, bool, error) {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	firewall, rerr := az.AzureFirewallClient.Get(ctx, az.getAzureFirewallResourceGroup(), az.AzureFirewallName)
+	exists, rerr := checkResourceExistsFromError(rerr)
+	if rerr != nil {
+		return firewall, false, rerr.Error()
+	}
+
+	if !exists {
+		klog.V(2).Infof("Azure Firewall %s/%s not found", az.getAzureFirewallResourceGroup(), az.AzureFirewallName)
+		return firewall, false, nil
+	}
+
+	return firewall, true, nil
+}
+
+// createOrUpdateAzureFirewall invokes az.AzureFirewallClient.CreateOrUpdate with the etag of the Azure Firewall.
+func (az *Cloud) createOrUpdateAzureFirewall(firewall network.AzureFirewall) error {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	rerr := az.AzureFirewallClient.CreateOrUpdate(ctx, az.getAzureFirewallResourceGroup(), az.AzureFirewallName, firewall, pointer.StringDeref(firewall.Etag, ""))
+	if rerr == nil {
+		return nil
+	}
+
+	firewallJSON, _ := json.Marshal(firewall)
+	klog.Warningf("AzureFirewallClient.CreateOrUpdate(%s) failed: %v, AzureFirewall request: %s", az.AzureFirewallName, rerr.Error(), string(firewallJSON))
+	if rerr.HTTPStatusCode == http.StatusPreconditionFailed {
+		klog.V(3).Infof("Azure Firewall %s is changed by another operation, the update would be retried", az.AzureFirewallName)
+	}
+	return rerr.Error()
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/azurefirewallclient/mockazurefirewallclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getTestAzureFirewall() network.AzureFirewall {
+	return network.AzureFirewall{
+		Name: pointer.String("fw"),
+		Etag: pointer.String("etag"),
+		AzureFirewallPropertiesFormat: &network.AzureFirewallPropertiesFormat{
+			IPConfigurations: &[]network.AzureFirewallIPConfiguration{
+				{
+					Name: pointer.String("ipconfig"),
+					AzureFirewallIPConfigurationPropertiesFormat: &network.AzureFirewallIPConfigurationPropertiesFormat{
+						PrivateIPAddress: pointer.String("10.1.0.4"),
+						PublicIPAddress:  &network.SubResource{ID: pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/fw-pip")},
+					},
+				},
+			},
+			NatRuleCollections: &[]network.AzureFirewallNatRuleCollection{
+				{
+					Name: pointer.String("other"),
+					AzureFirewallNatRuleCollectionProperties: &network.AzureFirewallNatRuleCollectionProperties{
+						Priority: pointer.Int32(100),
+						Action:   &network.AzureFirewallNatRCAction{Type: network.Dnat},
+						Rules: &[]network.AzureFirewallNatRule{
+							{
+								Name:                 pointer.String("other-rule"),
+								DestinationAddresses: &[]string{"1.2.3.4"},
+								DestinationPorts:     &[]string{"443"},
+								Protocols:            &[]network.AzureFirewallNetworkRuleProtocol{network.AzureFirewallNetworkRuleProtocolTCP},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func setTestAzureFirewallPublicIP(az *Cloud) {
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{
+		{
+			Name: pointer.String("fw-pip"),
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress: pointer.String("1.2.3.4"),
+			},
+		},
+	}, nil).AnyTimes()
+}
+
+func TestReconcileAzureFirewall(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.AzureFirewallName = "fw"
+	setTestAzureFirewallPublicIP(az)
+	mockClient := az.AzureFirewallClient.(*mockazurefirewallclient.MockInterface)
+
+	service := getTestService("service", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationAzureFirewallDNAT: consts.TrueAnnotationValue}, false, 80)
+	service.Spec.LoadBalancerSourceRanges = []string{"20.0.0.0/16", "10.0.0.0/16"}
+	prefix := az.getRulePrefix(&service)
+
+	// the collection with the rules of the service is added
+	var updated network.AzureFirewall
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "fw").Return(getTestAzureFirewall(), nil)
+	mockClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "fw", gomock.Any(), "etag").DoAndReturn(
+		func(ctx context.Context, resourceGroupName, azureFirewallName string, parameters network.AzureFirewall, etag string) *retry.Error {
+			updated = parameters
+			return nil
+		})
+	firewallIP, err := az.reconcileAzureFirewall("kubernetes", &service, []string{"fd00::5", "10.0.0.5"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.3.4", firewallIP)
+	collections := *updated.NatRuleCollections
+	assert.Equal(t, 2, len(collections))
+	assert.Equal(t, "k8s-dnat-kubernetes", pointer.StringDeref(collections[1].Name, ""))
+	assert.Equal(t, int32(consts.AzureFirewallNATRuleCollectionPriorityDefault), pointer.Int32Deref(collections[1].Priority, 0))
+	assert.Equal(t, network.Dnat, collections[1].Action.Type)
+	assert.Equal(t, []network.AzureFirewallNatRule{
+		{
+			Name:                 pointer.String(prefix + "-TCP-80"),
+			SourceAddresses:      &[]string{"10.0.0.0/16", "20.0.0.0/16"},
+			DestinationAddresses: &[]string{"1.2.3.4"},
+			DestinationPorts:     &[]string{"80"},
+			Protocols:            &[]network.AzureFirewallNetworkRuleProtocol{network.AzureFirewallNetworkRuleProtocolTCP},
+			TranslatedAddress:    pointer.String("10.0.0.5"),
+			TranslatedPort:       pointer.String("80"),
+		},
+	}, *collections[1].Rules)
+
+	// nothing is updated if the rules are up to date
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "fw").Return(updated, nil)
+	firewallIP, err = az.reconcileAzureFirewall("kubernetes", &service, []string{"10.0.0.5"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.3.4", firewallIP)
+
+	// the empty collection is removed with the rules of the service
+	var removed network.AzureFirewall
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "fw").Return(updated, nil)
+	mockClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "fw", gomock.Any(), "etag").DoAndReturn(
+		func(ctx context.Context, resourceGroupName, azureFirewallName string, parameters network.AzureFirewall, etag string) *retry.Error {
+			removed = parameters
+			return nil
+		})
+	firewallIP, err = az.reconcileAzureFirewall("kubernetes", &service, nil, false)
+	assert.NoError(t, err)
+	assert.Empty(t, firewallIP)
+	assert.Equal(t, *getTestAzureFirewall().NatRuleCollections, *removed.NatRuleCollections)
+}
+
+func TestReconcileAzureFirewallErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	service := getTestService("service", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationAzureFirewallDNAT: consts.TrueAnnotationValue}, false, 443)
+
+	// the firewall is not set in the cloud config
+	_, err := az.reconcileAzureFirewall("kubernetes", &service, []string{"10.0.0.5"}, true)
+	assert.Error(t, err)
+	_, err = az.reconcileAzureFirewall("kubernetes", &service, nil, false)
+	assert.NoError(t, err)
+
+	az.AzureFirewallName = "fw"
+	setTestAzureFirewallPublicIP(az)
+	mockClient := az.AzureFirewallClient.(*mockazurefirewallclient.MockInterface)
+
+	// the rule conflicts with a rule which is not managed by the cloud provider
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "fw").Return(getTestAzureFirewall(), nil)
+	_, err = az.reconcileAzureFirewall("kubernetes", &service, []string{"10.0.0.5"}, true)
+	assert.ErrorContains(t, err, "conflicts with rule")
+
+	// the public IP is not associated with the firewall
+	service.Annotations[consts.ServiceAnnotationAzureFirewallPublicIPName] = "other-pip"
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "fw").Return(getTestAzureFirewall(), nil)
+	_, err = az.reconcileAzureFirewall("kubernetes", &service, []string{"10.0.0.5"}, true)
+	assert.ErrorContains(t, err, "is not associated with Azure Firewall")
+
+	// no IPv4 frontend IP of the service
+	service.Annotations[consts.ServiceAnnotationAzureFirewallPublicIPName] = "fw-pip"
+	mockClient.EXPECT().Get(gomock.Any(), "rg", "fw").Return(getTestAzureFirewall(), nil)
+	_, err = az.reconcileAzureFirewall("kubernetes", &service, []string{"fd00::5"}, true)
+	assert.ErrorContains(t, err, "no IPv4 frontend IP")
+}
+
+func TestAzureFirewallDNATRequiresInternalLoadBalancer(t *testing.T) {
+	service := getTestService("service", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationAzureFirewallDNAT: consts.TrueAnnotationValue}, false, 80)
+	assert.True(t, requiresInternalLoadBalancer(&service))
+
+	flipped := flipServiceInternalAnnotation(&service)
+	assert.False(t, requiresInternalLoadBalancer(flipped))
+	assert.NotContains(t, flipped.Annotations, consts.ServiceAnnotationAzureFirewallDNAT)
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// backendPoolSnapshot is the membership of a backend pool exported to the snapshot configmap.
+type backendPoolSnapshot struct {
+	LoadBalancer string `json:"loadBalancer"`
+	BackendPool  string `json:"backendPool"`
+	// Services are the services whose load balancing rules send the traffic to the backend pool.
+	Services []string                    `json:"services"`
+	Members  []backendPoolSnapshotMember `json:"members"`
+}
+
+// backendPoolSnapshotMember is an address of a backend pool, with the node it belongs to if known.
+type backendPoolSnapshotMember struct {
+	IPAddress         string `json:"ipAddress,omitempty"`
+	IPConfigurationID string `json:"ipConfigurationID,omitempty"`
+	NodeName          string `json:"nodeName,omitempty"`
+}
+
+// runBackendPoolSnapshotLoop periodically mirrors the membership of the backend pools of the services to the
+// snapshot configmap.
+func (az *Cloud) runBackendPoolSnapshotLoop(ctx context.Context, interval time.Duration) {
+	klog.V(2).Info("runBackendPoolSnapshotLoop: started")
+	err := wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		if err := az.exportBackendPoolSnapshot(ctx); err != nil {
+			klog.Warningf("runBackendPoolSnapshotLoop: failed to export the backend pools: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runBackendPoolSnapshotLoop: stopped due to %s", err.Error())
+}
+
+// exportBackendPoolSnapshot writes the membership of the backend pools used by the load balancing rules of the
+// services to the snapshot configmap, one key per backend pool, so that the Azure state can be audited against the
+// cluster without Azure credentials. The configmap is only updated if the membership changed.
+func (az *Cloud) exportBackendPoolSnapshot(ctx context.Context) error {
+	if az.serviceLister == nil || az.KubeClient == nil {
+		klog.V(4).Info("exportBackendPoolSnapshot: the service lister or the kube client is not initialized, skip exporting")
+		return nil
+	}
+	services, err := az.serviceLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string]string)
+	for _, snapshot := range az.getBackendPoolSnapshots(services, lbs) {
+		content, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		data[getBackendPoolSnapshotKey(snapshot.LoadBalancer, snapshot.BackendPool)] = string(content)
+	}
+
+	configMaps := az.KubeClient.CoreV1().ConfigMaps(consts.BackendPoolSnapshotConfigMapNamespace)
+	cm, err := configMaps.Get(ctx, consts.BackendPoolSnapshotConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      consts.BackendPoolSnapshotConfigMapName,
+				Namespace: consts.BackendPoolSnapshotConfigMapNamespace,
+			},
+			Data: data,
+		}
+		if _, err := configMaps.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create configmap %s/%s: %w", consts.BackendPoolSnapshotConfigMapNamespace, consts.BackendPoolSnapshotConfigMapName, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %s/%s: %w", consts.BackendPoolSnapshotConfigMapNamespace, consts.BackendPoolSnapshotConfigMapName, err)
+	}
+	if reflect.DeepEqual(cm.Data, data) || (len(cm.Data) == 0 && len(data) == 0) {
+		return nil
+	}
+	cm.Data = data
+	if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update configmap %s/%s: %w", consts.BackendPoolSnapshotConfigMapNamespace, consts.BackendPoolSnapshotConfigMapName, err)
+	}
+	return nil
+}
+
+// getBackendPoolSnapshots returns the membership of the backend pools referenced by the load balancing rules of the
+// services, sorted by the load balancer and backend pool names.
+func (az *Cloud) getBackendPoolSnapshots(services []*v1.Service, lbs []network.LoadBalancer) []*backendPoolSnapshot {
+	var snapshots []*backendPoolSnapshot
+	for _, lb := range lbs {
+		if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil || lb.LoadBalancingRules == nil {
+			continue
+		}
+
+		// the services are found by the rules referencing the backend pools
+		servicesByBackendPoolID := make(map[string]sets.Set[string])
+		for _, rule := range *lb.LoadBalancingRules {
+			if rule.LoadBalancingRulePropertiesFormat == nil {
+				continue
+			}
+			var backendPoolIDs []string
+			if rule.BackendAddressPool != nil {
+				backendPoolIDs = append(backendPoolIDs, pointer.StringDeref(rule.BackendAddressPool.ID, ""))
+			}
+			if rule.BackendAddressPools != nil {
+				for _, bp := range *rule.BackendAddressPools {
+					backendPoolIDs = append(backendPoolIDs, pointer.StringDeref(bp.ID, ""))
+				}
+			}
+			for _, service := range services {
+				if service.Spec.Type != v1.ServiceTypeLoadBalancer || !az.isServiceReconciledByLoadBalancerClass(service) ||
+					!az.serviceOwnsRule(service, pointer.StringDeref(rule.Name, "")) {
+					continue
+				}
+				for _, backendPoolID := range backendPoolIDs {
+					backendPoolID = strings.ToLower(backendPoolID)
+					if servicesByBackendPoolID[backendPoolID] == nil {
+						servicesByBackendPoolID[backendPoolID] = sets.New[string]()
+					}
+					servicesByBackendPoolID[backendPoolID].Insert(getServiceName(service))
+				}
+			}
+		}
+
+		for _, bp := range *lb.BackendAddressPools {
+			serviceNames, found := servicesByBackendPoolID[strings.ToLower(pointer.StringDeref(bp.ID, ""))]
+			if !found {
+				continue
+			}
+			snapshots = append(snapshots, &backendPoolSnapshot{
+				LoadBalancer: pointer.StringDeref(lb.Name, ""),
+				BackendPool:  pointer.StringDeref(bp.Name, ""),
+				Services:     sets.List(serviceNames),
+				Members:      az.getBackendPoolSnapshotMembers(bp),
+			})
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].LoadBalancer != snapshots[j].LoadBalancer {
+			return snapshots[i].LoadBalancer < snapshots[j].LoadBalancer
+		}
+		return snapshots[i].BackendPool < snapshots[j].BackendPool
+	})
+	return snapshots
+}
+
+// getBackendPoolSnapshotMembers returns the IP addresses and the IP configurations of the backend pool with the
+// nodes they belong to, which are looked up in the caches.
+func (az *Cloud) getBackendPoolSnapshotMembers(bp network.BackendAddressPool) []backendPoolSnapshotMember {
+	members := []backendPoolSnapshotMember{}
+	if bp.BackendAddressPoolPropertiesFormat == nil {
+		return members
+	}
+	if bp.LoadBalancerBackendAddresses != nil {
+		az.nodeCachesLock.RLock()
+		for _, address := range *bp.LoadBalancerBackendAddresses {
+			if address.LoadBalancerBackendAddressPropertiesFormat == nil || pointer.StringDeref(address.IPAddress, "") == "" {
+				continue
+			}
+			ip := *address.IPAddress
+			nodeName, _ := az.nodeTopology.getNodeNameByIP(ip)
+			members = append(members, backendPoolSnapshotMember{IPAddress: ip, NodeName: nodeName})
+		}
+		az.nodeCachesLock.RUnlock()
+	}
+	if bp.BackendIPConfigurations != nil {
+		for _, ipConfig := range *bp.BackendIPConfigurations {
+			ipConfigID := pointer.StringDeref(ipConfig.ID, "")
+			nodeName, _, err := az.VMSet.GetNodeNameByIPConfigurationID(ipConfigID)
+			if err != nil {
+				klog.V(4).Infof("getBackendPoolSnapshotMembers: failed to get the node of IP configuration %s: %v", ipConfigID, err)
+			}
+			members = append(members, backendPoolSnapshotMember{IPConfigurationID: ipConfigID, NodeName: nodeName})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].IPAddress != members[j].IPAddress {
+			return members[i].IPAddress < members[j].IPAddress
+		}
+		return members[i].IPConfigurationID < members[j].IPConfigurationID
+	})
+	return members
+}
+
+// getBackendPoolSnapshotKey returns the key of the backend pool in the snapshot configmap. The names of the load
+// balancers and the backend pools only contain the characters allowed in the keys.
+func getBackendPoolSnapshotKey(lbName, backendPoolName string) string {
+	return fmt.Sprintf("%s.%s", lbName, backendPoolName)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestExportBackendPoolSnapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	client := fake.NewSimpleClientset(&svc)
+	az.KubeClient = client
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	az.serviceLister = informerFactory.Core().V1().Services().Lister()
+	_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+	az.nodeTopology.setPrivateIPs("node1", sets.New[string]("10.0.0.4"))
+
+	bpID := az.getBackendPoolID("testCluster", "testCluster")
+	lb := network.LoadBalancer{
+		Name: pointer.String("testCluster"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{
+					ID:   pointer.String(bpID),
+					Name: pointer.String("testCluster"),
+					BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+						LoadBalancerBackendAddresses: &[]network.LoadBalancerBackendAddress{
+							{LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String("10.0.0.5")}},
+							{LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String("10.0.0.4")}},
+						},
+					},
+				},
+				{
+					// not referenced by the rules of the services
+					ID:   pointer.String(az.getBackendPoolID("testCluster", "unmanaged")),
+					Name: pointer.String("unmanaged"),
+				},
+			},
+			LoadBalancingRules: &[]network.LoadBalancingRule{
+				{
+					Name: pointer.String(az.getLoadBalancerRuleName(&svc, v1.ProtocolTCP, 80, false)),
+					LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+						BackendAddressPool: &network.SubResource{ID: pointer.String(bpID)},
+					},
+				},
+				{
+					Name: pointer.String("other-rule"),
+					LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+						BackendAddressPool: &network.SubResource{ID: pointer.String(az.getBackendPoolID("testCluster", "unmanaged"))},
+					},
+				},
+			},
+		},
+	}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return([]network.LoadBalancer{lb}, nil).Times(2)
+
+	assert.NoError(t, az.exportBackendPoolSnapshot(context.TODO()))
+	cm, err := client.CoreV1().ConfigMaps(consts.BackendPoolSnapshotConfigMapNamespace).Get(context.TODO(), consts.BackendPoolSnapshotConfigMapName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(cm.Data))
+	var snapshot backendPoolSnapshot
+	assert.NoError(t, json.Unmarshal([]byte(cm.Data["testCluster.testCluster"]), &snapshot))
+	assert.Equal(t, backendPoolSnapshot{
+		LoadBalancer: "testCluster",
+		BackendPool:  "testCluster",
+		Services:     []string{"default/svc1"},
+		Members: []backendPoolSnapshotMember{
+			{IPAddress: "10.0.0.4", NodeName: "node1"},
+			{IPAddress: "10.0.0.5"},
+		},
+	}, snapshot)
+
+	// the configmap is updated when the membership changes
+	az.nodeTopology.setPrivateIPs("node2", sets.New[string]("10.0.0.5"))
+	assert.NoError(t, az.exportBackendPoolSnapshot(context.TODO()))
+	cm, err = client.CoreV1().ConfigMaps(consts.BackendPoolSnapshotConfigMapNamespace).Get(context.TODO(), consts.BackendPoolSnapshotConfigMapName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, cm.Data["testCluster.testCluster"], `"nodeName":"node2"`)
+}
@@ -43,7 +43,7 @@ func (az *Cloud) RequestBackoff() (resourceRequestBackoff wait.Backoff) {
 
 // Event creates a event for the specified object.
 func (az *Cloud) Event(obj runtime.Object, eventType, reason, message string) {
-	if obj != nil && reason != "" {
+	if obj != nil && reason != "" && az.eventRecorder != nil {
 		az.eventRecorder.Event(obj, eventType, reason, message)
 	}
 }
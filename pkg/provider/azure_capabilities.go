@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// cloudCapabilities describes the load balancer features supported by the target cloud,
+// e.g., Azure public cloud, Azure China, Azure Government or Azure Stack.
+type cloudCapabilities struct {
+	// networkAPIVersion is the newest network API version supported by both
+	// the target cloud and the load balancer client.
+	networkAPIVersion string
+
+	ipBasedBackendPool       bool
+	probeThreshold           bool
+	backendAddressAdminState bool
+}
+
+// newCloudCapabilities returns the capabilities available with the given network API version.
+func newCloudCapabilities(networkAPIVersion string) *cloudCapabilities {
+	return &cloudCapabilities{
+		networkAPIVersion:        networkAPIVersion,
+		ipBasedBackendPool:       networkAPIVersion >= consts.IPBasedBackendPoolMinAPIVersion,
+		probeThreshold:           networkAPIVersion >= consts.ProbeThresholdMinAPIVersion,
+		backendAddressAdminState: networkAPIVersion >= consts.BackendAddressAdminStateMinAPIVersion,
+	}
+}
+
+// getLoadBalancerClientAPIVersion returns the default network API version of the load balancer client.
+func (az *Cloud) getLoadBalancerClientAPIVersion() string {
+	if az.isStackCloud() {
+		return loadbalancerclient.AzureStackCloudAPIVersion
+	}
+	return loadbalancerclient.APIVersion
+}
+
+// getLoadBalancerClientMaxAPIVersion returns the newest network API version the load balancer client can be
+// configured with.
+func (az *Cloud) getLoadBalancerClientMaxAPIVersion() string {
+	if az.isStackCloud() {
+		return loadbalancerclient.AzureStackCloudAPIVersion
+	}
+	return loadbalancerclient.MaxAPIVersion
+}
+
+// getCloudCapabilities returns the detected capabilities of the target cloud. It falls back to
+// the capabilities implied by the API version of the load balancer client if nothing is detected.
+func (az *Cloud) getCloudCapabilities() *cloudCapabilities {
+	if az.capabilities == nil {
+		return newCloudCapabilities(az.getLoadBalancerClientAPIVersion())
+	}
+	return az.capabilities
+}
+
+// detectCloudCapabilities probes the load balancer API versions supported by the target cloud
+// and negotiates the newest one that is not newer than the max API version of the client. The
+// load balancer client is configured with the negotiated API version, so that the features gated
+// on it, e.g., the admin state of the backend addresses, are accepted by the target cloud.
+func (az *Cloud) detectCloudCapabilities(ctx context.Context) *cloudCapabilities {
+	clientAPIVersion := az.getLoadBalancerClientAPIVersion()
+	if az.ZoneClient == nil {
+		return newCloudCapabilities(clientAPIVersion)
+	}
+
+	subscriptionID := az.SubscriptionID
+	if az.UsesNetworkResourceInDifferentSubscription() {
+		subscriptionID = az.NetworkResourceSubscriptionID
+	}
+	apiVersions, rerr := az.ZoneClient.GetAPIVersions(ctx, subscriptionID, consts.NetworkResourceProvider, consts.LoadBalancerResourceType)
+	if rerr != nil {
+		klog.Warningf("detectCloudCapabilities: failed to get the supported API versions of %s/%s, falling back to %s: %s",
+			consts.NetworkResourceProvider, consts.LoadBalancerResourceType, clientAPIVersion, rerr.Error().Error())
+		return newCloudCapabilities(clientAPIVersion)
+	}
+
+	apiVersion := negotiateAPIVersion(apiVersions, az.getLoadBalancerClientMaxAPIVersion())
+	if apiVersion == "" {
+		klog.Warningf("detectCloudCapabilities: none of the API versions %v of %s/%s is supported by the client, falling back to %s",
+			apiVersions, consts.NetworkResourceProvider, consts.LoadBalancerResourceType, clientAPIVersion)
+		return newCloudCapabilities(clientAPIVersion)
+	}
+
+	capabilities := newCloudCapabilities(apiVersion)
+	klog.V(2).Infof("detectCloudCapabilities: negotiated network API version %s, ipBasedBackendPool: %t, probeThreshold: %t, backendAddressAdminState: %t",
+		capabilities.networkAPIVersion, capabilities.ipBasedBackendPool, capabilities.probeThreshold, capabilities.backendAddressAdminState)
+	return capabilities
+}
+
+// negotiateAPIVersion returns the newest stable API version in apiVersions that is not newer than
+// maxAPIVersion, or an empty string if there is none.
+func negotiateAPIVersion(apiVersions []string, maxAPIVersion string) string {
+	var negotiated string
+	for _, apiVersion := range apiVersions {
+		if strings.Contains(apiVersion, "-preview") || apiVersion > maxAPIVersion {
+			continue
+		}
+		if apiVersion > negotiated {
+			negotiated = apiVersion
+		}
+	}
+	return negotiated
+}
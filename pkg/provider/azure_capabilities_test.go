@@ -0,0 +1,135 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/zoneclient/mockzoneclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		apiVersions []string
+		expected    string
+	}{
+		{
+			desc:        "should return the newest version not newer than the client",
+			apiVersions: []string{"2018-11-01", "2023-04-01", "2022-05-01", "2020-04-01"},
+			expected:    "2022-05-01",
+		},
+		{
+			desc:        "should skip the preview versions",
+			apiVersions: []string{"2018-11-01", "2022-06-01-preview"},
+			expected:    "2018-11-01",
+		},
+		{
+			desc:        "should return an empty string if no version is supported",
+			apiVersions: []string{"2023-04-01"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, negotiateAPIVersion(tc.apiVersions, "2022-07-01"))
+		})
+	}
+}
+
+func TestDetectCloudCapabilities(t *testing.T) {
+	for _, tc := range []struct {
+		desc         string
+		stackCloud   bool
+		apiVersions  []string
+		rerr         *retry.Error
+		expectedCaps *cloudCapabilities
+	}{
+		{
+			desc:         "should negotiate the newest API version on the public cloud",
+			apiVersions:  []string{"2023-05-01", "2023-04-01", "2022-07-01", "2018-11-01"},
+			expectedCaps: &cloudCapabilities{networkAPIVersion: "2023-04-01", ipBasedBackendPool: true, probeThreshold: true, backendAddressAdminState: true},
+		},
+		{
+			desc:         "should disable backendAddressAdminState on clouds lagging behind",
+			apiVersions:  []string{"2022-07-01", "2018-11-01"},
+			expectedCaps: &cloudCapabilities{networkAPIVersion: "2022-07-01", ipBasedBackendPool: true, probeThreshold: true},
+		},
+		{
+			desc:         "should disable probeThreshold on clouds lagging behind",
+			apiVersions:  []string{"2020-11-01", "2018-11-01"},
+			expectedCaps: &cloudCapabilities{networkAPIVersion: "2020-11-01", ipBasedBackendPool: true},
+		},
+		{
+			desc:         "should be capped by the client API version on Azure Stack",
+			stackCloud:   true,
+			apiVersions:  []string{"2022-07-01", "2018-11-01"},
+			expectedCaps: &cloudCapabilities{networkAPIVersion: "2018-11-01"},
+		},
+		{
+			desc:         "should fall back to the client API version if the probing fails",
+			rerr:         retry.NewError(false, http.ErrServerClosed),
+			expectedCaps: &cloudCapabilities{networkAPIVersion: "2022-07-01", ipBasedBackendPool: true, probeThreshold: true},
+		},
+		{
+			desc:         "should fall back to the client API version if no API version is negotiated",
+			apiVersions:  []string{"2023-05-01"},
+			expectedCaps: &cloudCapabilities{networkAPIVersion: "2022-07-01", ipBasedBackendPool: true, probeThreshold: true},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			az := GetTestCloud(ctrl)
+			if tc.stackCloud {
+				az.Config.Cloud = consts.AzureStackCloudName
+			}
+			mockZoneClient := mockzoneclient.NewMockInterface(ctrl)
+			mockZoneClient.EXPECT().GetAPIVersions(gomock.Any(), az.SubscriptionID, consts.NetworkResourceProvider, consts.LoadBalancerResourceType).Return(tc.apiVersions, tc.rerr)
+			az.ZoneClient = mockZoneClient
+
+			assert.Equal(t, tc.expectedCaps, az.detectCloudCapabilities(context.Background()))
+		})
+	}
+}
+
+func TestSetProbeNumberOfProbes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	properties := &network.ProbePropertiesFormat{}
+	az.setProbeNumberOfProbes(properties, pointer.Int32(3))
+	assert.Equal(t, pointer.Int32(3), properties.ProbeThreshold)
+	assert.Nil(t, properties.NumberOfProbes)
+	assert.Equal(t, int32(3), getProbeNumberOfProbes(properties))
+
+	az.capabilities = newCloudCapabilities("2018-11-01")
+	properties = &network.ProbePropertiesFormat{}
+	az.setProbeNumberOfProbes(properties, pointer.Int32(3))
+	assert.Nil(t, properties.ProbeThreshold)
+	assert.Equal(t, pointer.Int32(3), properties.NumberOfProbes)
+	assert.Equal(t, int32(3), getProbeNumberOfProbes(properties))
+}
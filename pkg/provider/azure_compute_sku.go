@@ -0,0 +1,179 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+const (
+	computeSKUResourceTypeVirtualMachines = "virtualMachines"
+
+	computeSKUCapabilityVCPUs    = "vCPUs"
+	computeSKUCapabilityMemoryGB = "MemoryGB"
+	computeSKUCapabilityGPUs     = "GPUs"
+)
+
+// ComputeSKU is the capability of a VM size in a location reported by the compute resource SKUs API.
+type ComputeSKU struct {
+	// Name is the name of the VM size, e.g. Standard_D2s_v3.
+	Name string
+	// Tier is the pricing tier of the VM size, e.g. Standard or Basic.
+	Tier string
+	// Family is the family of the VM size, e.g. standardDSv3Family.
+	Family string
+	// VCPUs is the number of vCPUs.
+	VCPUs int64
+	// MemoryGB is the memory in GB.
+	MemoryGB float64
+	// GPUs is the number of GPUs.
+	GPUs int64
+	// Zones are the availability zone IDs, e.g. "1", in which the VM size is available for the subscription.
+	Zones sets.Set[string]
+	// Restricted is true if the VM size is not available in the location for the subscription.
+	Restricted bool
+}
+
+func (az *Cloud) newComputeSKUCache() (azcache.Resource, error) {
+	getter := func(key string) (interface{}, error) {
+		ctx, cancel := getContextWithCancel()
+		defer cancel()
+
+		location := key
+		skus, rerr := az.ComputeSKUClient.List(ctx, location)
+		if rerr != nil {
+			return nil, rerr.Error()
+		}
+
+		skuMap := make(map[string]*ComputeSKU)
+		for i := range skus {
+			if !strings.EqualFold(pointer.StringDeref(skus[i].ResourceType, ""), computeSKUResourceTypeVirtualMachines) {
+				continue
+			}
+			sku := newComputeSKU(&skus[i], location)
+			skuMap[strings.ToLower(sku.Name)] = sku
+		}
+		klog.V(2).Infof("newComputeSKUCache: got %d VM sizes in location %s", len(skuMap), location)
+		return skuMap, nil
+	}
+
+	if az.ComputeSKUCacheTTLInSeconds == 0 {
+		az.ComputeSKUCacheTTLInSeconds = computeSKUCacheTTLDefaultInSeconds
+	}
+	return azcache.NewTimedCache(time.Duration(az.ComputeSKUCacheTTLInSeconds)*time.Second, getter, az.Config.DisableAPICallCache)
+}
+
+// newComputeSKU converts the resource SKU of a VM size in the location.
+func newComputeSKU(sku *compute.ResourceSku, location string) *ComputeSKU {
+	result := &ComputeSKU{
+		Name:   pointer.StringDeref(sku.Name, ""),
+		Tier:   pointer.StringDeref(sku.Tier, ""),
+		Family: pointer.StringDeref(sku.Family, ""),
+		Zones:  sets.New[string](),
+	}
+
+	if sku.Capabilities != nil {
+		for _, capability := range *sku.Capabilities {
+			value := pointer.StringDeref(capability.Value, "")
+			switch pointer.StringDeref(capability.Name, "") {
+			case computeSKUCapabilityVCPUs:
+				result.VCPUs, _ = strconv.ParseInt(value, 10, 64)
+			case computeSKUCapabilityMemoryGB:
+				result.MemoryGB, _ = strconv.ParseFloat(value, 64)
+			case computeSKUCapabilityGPUs:
+				result.GPUs, _ = strconv.ParseInt(value, 10, 64)
+			}
+		}
+	}
+
+	if sku.LocationInfo != nil {
+		for _, locationInfo := range *sku.LocationInfo {
+			if strings.EqualFold(pointer.StringDeref(locationInfo.Location, ""), location) && locationInfo.Zones != nil {
+				result.Zones.Insert(*locationInfo.Zones...)
+			}
+		}
+	}
+
+	if sku.Restrictions != nil {
+		for _, restriction := range *sku.Restrictions {
+			switch restriction.Type {
+			case compute.Location:
+				result.Restricted = true
+			case compute.Zone:
+				if restriction.RestrictionInfo != nil && restriction.RestrictionInfo.Zones != nil {
+					result.Zones.Delete(*restriction.RestrictionInfo.Zones...)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// GetComputeSKU returns the capability of the VM size in the location, which defaults to the location of the
+// cluster. It returns nil if the VM size is not offered in the location. The SKUs of each location are cached
+// and refreshed daily by default.
+func (az *Cloud) GetComputeSKU(location, vmSize string) (*ComputeSKU, error) {
+	if location == "" {
+		location = az.Location
+	}
+	location = strings.ToLower(location)
+
+	cached, err := az.computeSKUCache.Get(location, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil {
+		return nil, nil
+	}
+	return cached.(map[string]*ComputeSKU)[strings.ToLower(vmSize)], nil
+}
+
+// ValidateZoneForVMSize returns an error if the VM size is not available in the zone of the cluster location.
+// The zone can be either the zone ID, e.g. "1", or the zone label, e.g. "eastus-1".
+func (az *Cloud) ValidateZoneForVMSize(vmSize, zone string) error {
+	sku, err := az.GetComputeSKU("", vmSize)
+	if err != nil {
+		return err
+	}
+	if sku == nil {
+		return fmt.Errorf("VM size %s is not offered in location %s", vmSize, az.Location)
+	}
+	if sku.Restricted {
+		return fmt.Errorf("VM size %s is not available in location %s for the subscription", vmSize, az.Location)
+	}
+
+	zoneID := zone
+	if az.isAvailabilityZone(zone) {
+		zoneID = az.GetZoneID(zone)
+	}
+	if !sku.Zones.Has(zoneID) {
+		return fmt.Errorf("VM size %s is not available in zone %s of location %s, available zones: %v", vmSize, zone, az.Location, sets.List(sku.Zones))
+	}
+	return nil
+}
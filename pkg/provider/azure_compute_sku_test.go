@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/skuclient/mockskuclient"
+)
+
+func buildTestResourceSku(resourceType, name string, zones []string, capabilities map[string]string) compute.ResourceSku {
+	skuCapabilities := make([]compute.ResourceSkuCapabilities, 0)
+	for capabilityName, value := range capabilities {
+		skuCapabilities = append(skuCapabilities, compute.ResourceSkuCapabilities{
+			Name:  pointer.String(capabilityName),
+			Value: pointer.String(value),
+		})
+	}
+	return compute.ResourceSku{
+		ResourceType: pointer.String(resourceType),
+		Name:         pointer.String(name),
+		Tier:         pointer.String("Standard"),
+		Family:       pointer.String("standardNCFamily"),
+		LocationInfo: &[]compute.ResourceSkuLocationInfo{
+			{Location: pointer.String("eastus"), Zones: &zones},
+		},
+		Capabilities: &skuCapabilities,
+	}
+}
+
+func TestGetComputeSKU(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.Location = "eastus"
+
+	gpuSKU := buildTestResourceSku("virtualMachines", "Standard_NC6", []string{"1", "2", "3"}, map[string]string{
+		computeSKUCapabilityVCPUs:    "6",
+		computeSKUCapabilityMemoryGB: "56",
+		computeSKUCapabilityGPUs:     "1",
+	})
+	gpuSKU.Restrictions = &[]compute.ResourceSkuRestrictions{
+		{
+			Type:            compute.Zone,
+			RestrictionInfo: &compute.ResourceSkuRestrictionInfo{Zones: &[]string{"3"}},
+		},
+	}
+	restrictedSKU := buildTestResourceSku("virtualMachines", "Standard_M128", []string{"1"}, nil)
+	restrictedSKU.Restrictions = &[]compute.ResourceSkuRestrictions{{Type: compute.Location}}
+	mockSKUClient := az.ComputeSKUClient.(*mockskuclient.MockInterface)
+	mockSKUClient.EXPECT().List(gomock.Any(), "eastus").Return([]compute.ResourceSku{
+		gpuSKU,
+		restrictedSKU,
+		buildTestResourceSku("disks", "Premium_LRS", nil, nil),
+	}, nil).Times(1)
+
+	sku, err := az.GetComputeSKU("EastUS", "standard_nc6")
+	assert.NoError(t, err)
+	assert.Equal(t, &ComputeSKU{
+		Name:     "Standard_NC6",
+		Tier:     "Standard",
+		Family:   "standardNCFamily",
+		VCPUs:    6,
+		MemoryGB: 56,
+		GPUs:     1,
+		Zones:    sets.New("1", "2"),
+	}, sku)
+
+	// The SKUs of other resource types are ignored.
+	sku, err = az.GetComputeSKU("", "Premium_LRS")
+	assert.NoError(t, err)
+	assert.Nil(t, sku)
+
+	assert.NoError(t, az.ValidateZoneForVMSize("Standard_NC6", "1"))
+	assert.NoError(t, az.ValidateZoneForVMSize("Standard_NC6", "eastus-2"))
+	assert.EqualError(t, az.ValidateZoneForVMSize("Standard_NC6", "eastus-3"), "VM size Standard_NC6 is not available in zone eastus-3 of location eastus, available zones: [1 2]")
+	assert.EqualError(t, az.ValidateZoneForVMSize("Standard_M128", "1"), "VM size Standard_M128 is not available in location eastus for the subscription")
+	assert.EqualError(t, az.ValidateZoneForVMSize("Standard_D2s_v3", "1"), "VM size Standard_D2s_v3 is not offered in location eastus")
+}
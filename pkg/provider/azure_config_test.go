@@ -283,6 +283,7 @@ func TestInitializeCloudFromSecret(t *testing.T) {
 
 			mockZoneClient := mockzoneclient.NewMockInterface(ctrl)
 			mockZoneClient.EXPECT().GetZones(gomock.Any(), gomock.Any()).Return(map[string][]string{"eastus": {"1", "2", "3"}}, nil).MaxTimes(1)
+			mockZoneClient.EXPECT().GetAPIVersions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]string{"2022-07-01"}, nil).MaxTimes(1)
 			az.ZoneClient = mockZoneClient
 
 			err := az.InitializeCloudFromSecret(context.Background())
@@ -0,0 +1,327 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+// DebugSnapshot is a point-in-time view of the resources managed by the cloud provider.
+// It is built from the cached data only and never calls the Azure APIs.
+type DebugSnapshot struct {
+	GeneratedAt                  time.Time                   `json:"generatedAt"`
+	LoadBalancers                []DebugLoadBalancer         `json:"loadBalancers"`
+	PublicIPAddresses            []DebugPublicIPAddress      `json:"publicIPAddresses"`
+	LocalServices                []DebugLocalService         `json:"localServices"`
+	Caches                       []DebugCacheState           `json:"caches"`
+	PendingBackendPoolOperations []DebugBackendPoolOperation `json:"pendingBackendPoolOperations"`
+	Nodes                        []DebugNode                 `json:"nodes"`
+}
+
+// DebugLoadBalancer describes a cached load balancer.
+type DebugLoadBalancer struct {
+	Name                string             `json:"name"`
+	FrontendIPConfigs   []string           `json:"frontendIPConfigs"`
+	LoadBalancingRules  []string           `json:"loadBalancingRules"`
+	Probes              []string           `json:"probes"`
+	BackendPools        []DebugBackendPool `json:"backendPools"`
+	ProvisioningState   string             `json:"provisioningState,omitempty"`
+	CacheEntryCreatedOn time.Time          `json:"cacheEntryCreatedOn"`
+}
+
+// DebugBackendPool describes the members of a backend pool.
+type DebugBackendPool struct {
+	Name      string   `json:"name"`
+	IPs       []string `json:"ips,omitempty"`
+	IPConfigs []string `json:"ipConfigs,omitempty"`
+}
+
+// DebugPublicIPAddress describes a cached public IP address and what it is assigned to.
+type DebugPublicIPAddress struct {
+	ResourceGroup string `json:"resourceGroup"`
+	Name          string `json:"name"`
+	IPAddress     string `json:"ipAddress,omitempty"`
+	IPConfigID    string `json:"ipConfigID,omitempty"`
+	ServiceTag    string `json:"serviceTag,omitempty"`
+}
+
+// DebugLocalService describes an externalTrafficPolicy=Local service that uses a dedicated backend pool.
+type DebugLocalService struct {
+	Name             string `json:"name"`
+	LoadBalancerName string `json:"loadBalancerName"`
+	IPFamily         string `json:"ipFamily"`
+}
+
+// DebugCacheState describes the state of a resource cache.
+type DebugCacheState struct {
+	Name          string     `json:"name"`
+	Disabled      bool       `json:"disabled"`
+	Entries       int        `json:"entries"`
+	OldestEntryOn *time.Time `json:"oldestEntryOn,omitempty"`
+}
+
+// DebugBackendPoolOperation describes a backend pool update that has not been processed yet.
+type DebugBackendPoolOperation struct {
+	ServiceName      string   `json:"serviceName"`
+	LoadBalancerName string   `json:"loadBalancerName"`
+	BackendPoolName  string   `json:"backendPoolName"`
+	Kind             string   `json:"kind"`
+	NodeIPs          []string `json:"nodeIPs"`
+}
+
+// DebugNode describes the topology of a node known by the cloud provider.
+type DebugNode struct {
+	Name             string   `json:"name"`
+	Zone             string   `json:"zone,omitempty"`
+	VMSetName        string   `json:"vmSetName,omitempty"`
+	PrivateIPs       []string `json:"privateIPs,omitempty"`
+	LoadBalancerName string   `json:"loadBalancerName,omitempty"`
+	Excluded         bool     `json:"excluded"`
+}
+
+// DebugHandler returns an http.Handler serving the JSON snapshot of the resources managed
+// by the cloud provider. The caller is responsible for protecting it with authentication
+// and authorization.
+func (az *Cloud) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		data, err := json.MarshalIndent(az.DebugSnapshot(), "", "  ")
+		if err != nil {
+			klog.Errorf("DebugHandler: failed to marshal the snapshot: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
+
+// DebugSnapshot builds a DebugSnapshot from the current state of the caches.
+func (az *Cloud) DebugSnapshot() *DebugSnapshot {
+	snapshot := &DebugSnapshot{
+		GeneratedAt:                  time.Now().UTC(),
+		LoadBalancers:                []DebugLoadBalancer{},
+		PublicIPAddresses:            []DebugPublicIPAddress{},
+		LocalServices:                []DebugLocalService{},
+		Caches:                       []DebugCacheState{},
+		PendingBackendPoolOperations: []DebugBackendPoolOperation{},
+		Nodes:                        []DebugNode{},
+	}
+
+	for _, entry := range getCacheEntries(az.lbCache) {
+		if lb, ok := entry.Data.(*network.LoadBalancer); ok && lb != nil {
+			snapshot.LoadBalancers = append(snapshot.LoadBalancers, newDebugLoadBalancer(lb, entry.CreatedOn))
+		}
+	}
+	sort.Slice(snapshot.LoadBalancers, func(i, j int) bool {
+		return snapshot.LoadBalancers[i].Name < snapshot.LoadBalancers[j].Name
+	})
+
+	for _, entry := range getCacheEntries(az.pipCache) {
+		pips, ok := entry.Data.(*sync.Map)
+		if !ok || pips == nil {
+			continue
+		}
+		pips.Range(func(_, value interface{}) bool {
+			pip := value.(*network.PublicIPAddress)
+			snapshot.PublicIPAddresses = append(snapshot.PublicIPAddresses, newDebugPublicIPAddress(entry.Key, pip))
+			return true
+		})
+	}
+	sort.Slice(snapshot.PublicIPAddresses, func(i, j int) bool {
+		if snapshot.PublicIPAddresses[i].ResourceGroup != snapshot.PublicIPAddresses[j].ResourceGroup {
+			return snapshot.PublicIPAddresses[i].ResourceGroup < snapshot.PublicIPAddresses[j].ResourceGroup
+		}
+		return snapshot.PublicIPAddresses[i].Name < snapshot.PublicIPAddresses[j].Name
+	})
+
+	az.localServiceNameToServiceInfoMap.Range(func(key, value interface{}) bool {
+		si := value.(*serviceInfo)
+		snapshot.LocalServices = append(snapshot.LocalServices, DebugLocalService{
+			Name:             key.(string),
+			LoadBalancerName: si.lbName,
+			IPFamily:         si.ipFamily,
+		})
+		return true
+	})
+	sort.Slice(snapshot.LocalServices, func(i, j int) bool {
+		return snapshot.LocalServices[i].Name < snapshot.LocalServices[j].Name
+	})
+
+	for _, c := range []struct {
+		name  string
+		cache azcache.Resource
+	}{
+		{"vm", az.vmCache},
+		{"loadBalancer", az.lbCache},
+		{"networkSecurityGroup", az.nsgCache},
+		{"routeTable", az.rtCache},
+		{"publicIPAddress", az.pipCache},
+		{"privateLinkService", az.plsCache},
+		{"storageAccount", az.storageAccountCache},
+	} {
+		if c.cache == nil {
+			continue
+		}
+		snapshot.Caches = append(snapshot.Caches, newDebugCacheState(c.name, c.cache))
+	}
+
+	if updater, ok := az.backendPoolUpdater.(*loadBalancerBackendPoolUpdater); ok && updater != nil {
+		updater.lock.Lock()
+		for _, operation := range updater.operations {
+			op := operation.(*loadBalancerBackendPoolUpdateOperation)
+			snapshot.PendingBackendPoolOperations = append(snapshot.PendingBackendPoolOperations, DebugBackendPoolOperation{
+				ServiceName:      op.serviceName,
+				LoadBalancerName: op.loadBalancerName,
+				BackendPoolName:  op.backendPoolName,
+				Kind:             string(op.kind),
+				NodeIPs:          append([]string{}, op.nodeIPs...),
+			})
+		}
+		updater.lock.Unlock()
+	}
+
+	az.nodeCachesLock.RLock()
+	for nodeName, topology := range az.nodeTopology.nodes {
+		snapshot.Nodes = append(snapshot.Nodes, DebugNode{
+			Name:             nodeName,
+			Zone:             topology.zone,
+			VMSetName:        topology.vmSetName,
+			PrivateIPs:       sets.List(topology.privateIPs),
+			LoadBalancerName: topology.loadBalancerName,
+			Excluded:         az.excludeLoadBalancerNodes.Has(nodeName),
+		})
+	}
+	az.nodeCachesLock.RUnlock()
+	sort.Slice(snapshot.Nodes, func(i, j int) bool {
+		return snapshot.Nodes[i].Name < snapshot.Nodes[j].Name
+	})
+
+	return snapshot
+}
+
+// getCacheEntries returns the entries stored in the cache, or nil if the cache is disabled.
+func getCacheEntries(c azcache.Resource) []*azcache.AzureCacheEntry {
+	if c == nil || c.GetStore() == nil {
+		return nil
+	}
+	var entries []*azcache.AzureCacheEntry
+	for _, item := range c.GetStore().List() {
+		if entry, ok := item.(*azcache.AzureCacheEntry); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func newDebugCacheState(name string, c azcache.Resource) DebugCacheState {
+	state := DebugCacheState{Name: name}
+	if c.GetStore() == nil {
+		state.Disabled = true
+		return state
+	}
+	for _, entry := range getCacheEntries(c) {
+		state.Entries++
+		if state.OldestEntryOn == nil || entry.CreatedOn.Before(*state.OldestEntryOn) {
+			createdOn := entry.CreatedOn
+			state.OldestEntryOn = &createdOn
+		}
+	}
+	return state
+}
+
+func newDebugLoadBalancer(lb *network.LoadBalancer, createdOn time.Time) DebugLoadBalancer {
+	debugLB := DebugLoadBalancer{
+		Name:                pointer.StringDeref(lb.Name, ""),
+		FrontendIPConfigs:   []string{},
+		LoadBalancingRules:  []string{},
+		Probes:              []string{},
+		BackendPools:        []DebugBackendPool{},
+		CacheEntryCreatedOn: createdOn,
+	}
+	if lb.LoadBalancerPropertiesFormat == nil {
+		return debugLB
+	}
+	debugLB.ProvisioningState = string(lb.ProvisioningState)
+	if lb.FrontendIPConfigurations != nil {
+		for _, fip := range *lb.FrontendIPConfigurations {
+			debugLB.FrontendIPConfigs = append(debugLB.FrontendIPConfigs, pointer.StringDeref(fip.Name, ""))
+		}
+	}
+	if lb.LoadBalancingRules != nil {
+		for _, rule := range *lb.LoadBalancingRules {
+			debugLB.LoadBalancingRules = append(debugLB.LoadBalancingRules, pointer.StringDeref(rule.Name, ""))
+		}
+	}
+	if lb.Probes != nil {
+		for _, probe := range *lb.Probes {
+			debugLB.Probes = append(debugLB.Probes, pointer.StringDeref(probe.Name, ""))
+		}
+	}
+	if lb.BackendAddressPools != nil {
+		for _, bp := range *lb.BackendAddressPools {
+			debugBP := DebugBackendPool{Name: pointer.StringDeref(bp.Name, "")}
+			if bp.BackendAddressPoolPropertiesFormat != nil {
+				if bp.LoadBalancerBackendAddresses != nil {
+					for _, address := range *bp.LoadBalancerBackendAddresses {
+						if address.LoadBalancerBackendAddressPropertiesFormat != nil {
+							debugBP.IPs = append(debugBP.IPs, pointer.StringDeref(address.IPAddress, ""))
+						}
+					}
+				}
+				if bp.BackendIPConfigurations != nil {
+					for _, ipConf := range *bp.BackendIPConfigurations {
+						debugBP.IPConfigs = append(debugBP.IPConfigs, pointer.StringDeref(ipConf.ID, ""))
+					}
+				}
+			}
+			debugLB.BackendPools = append(debugLB.BackendPools, debugBP)
+		}
+	}
+	return debugLB
+}
+
+func newDebugPublicIPAddress(resourceGroup string, pip *network.PublicIPAddress) DebugPublicIPAddress {
+	debugPIP := DebugPublicIPAddress{
+		ResourceGroup: resourceGroup,
+		Name:          pointer.StringDeref(pip.Name, ""),
+		ServiceTag:    getServiceFromPIPServiceTags(pip.Tags),
+	}
+	if pip.PublicIPAddressPropertiesFormat != nil {
+		debugPIP.IPAddress = pointer.StringDeref(pip.IPAddress, "")
+		if pip.IPConfiguration != nil {
+			debugPIP.IPConfigID = pointer.StringDeref(pip.IPConfiguration.ID, "")
+		}
+	}
+	return debugPIP
+}
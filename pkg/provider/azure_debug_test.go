@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestDebugSnapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.lbCache.Set("lb1", &network.LoadBalancer{
+		Name: pointer.String("lb1"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: pointer.String("fip")}},
+			LoadBalancingRules:       &[]network.LoadBalancingRule{{Name: pointer.String("rule")}},
+			Probes:                   &[]network.Probe{{Name: pointer.String("probe")}},
+			BackendAddressPools: &[]network.BackendAddressPool{
+				getTestBackendAddressPoolWithIPs("lb1", "default-svc1", []string{"10.0.0.1"}),
+			},
+		},
+	})
+	pips := &sync.Map{}
+	pips.Store("pip1", &network.PublicIPAddress{
+		Name: pointer.String("pip1"),
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			IPAddress:       pointer.String("1.2.3.4"),
+			IPConfiguration: &network.IPConfiguration{ID: pointer.String("fipID")},
+		},
+		Tags: map[string]*string{consts.ServiceTagKey: pointer.String("default/svc1")},
+	})
+	az.pipCache.Set("rg", pips)
+	az.localServiceNameToServiceInfoMap.Store("default/svc1", newServiceInfo(consts.IPVersionIPv4String, "lb1"))
+	az.nodeTopology.setPrivateIPs("node1", sets.New[string]("10.0.0.1"))
+	az.nodeTopology.setPlacement("node1", "eastus-1", "vmss")
+	az.excludeLoadBalancerNodes.Insert("node1")
+	updater := newLoadBalancerBackendPoolUpdater(az, 0)
+	updater.addOperation(getAddIPsToBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.0.0.2"}))
+	az.backendPoolUpdater = updater
+
+	snapshot := az.DebugSnapshot()
+	assert.Equal(t, []DebugLoadBalancer{
+		{
+			Name:                "lb1",
+			FrontendIPConfigs:   []string{"fip"},
+			LoadBalancingRules:  []string{"rule"},
+			Probes:              []string{"probe"},
+			BackendPools:        []DebugBackendPool{{Name: "default-svc1", IPs: []string{"10.0.0.1"}}},
+			CacheEntryCreatedOn: snapshot.LoadBalancers[0].CacheEntryCreatedOn,
+		},
+	}, snapshot.LoadBalancers)
+	assert.Equal(t, []DebugPublicIPAddress{
+		{ResourceGroup: "rg", Name: "pip1", IPAddress: "1.2.3.4", IPConfigID: "fipID", ServiceTag: "default/svc1"},
+	}, snapshot.PublicIPAddresses)
+	assert.Equal(t, []DebugLocalService{
+		{Name: "default/svc1", LoadBalancerName: "lb1", IPFamily: consts.IPVersionIPv4String},
+	}, snapshot.LocalServices)
+	assert.Equal(t, []DebugBackendPoolOperation{
+		{
+			ServiceName:      "default/svc1",
+			LoadBalancerName: "lb1",
+			BackendPoolName:  "default-svc1",
+			Kind:             string(consts.LoadBalancerBackendPoolUpdateOperationAdd),
+			NodeIPs:          []string{"10.0.0.2"},
+		},
+	}, snapshot.PendingBackendPoolOperations)
+	assert.Equal(t, []DebugNode{
+		{Name: "node1", Zone: "eastus-1", VMSetName: "vmss", PrivateIPs: []string{"10.0.0.1"}, Excluded: true},
+	}, snapshot.Nodes)
+	for _, c := range snapshot.Caches {
+		switch c.Name {
+		case "loadBalancer", "publicIPAddress":
+			assert.Equal(t, 1, c.Entries)
+			assert.NotNil(t, c.OldestEntryOn)
+		}
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	handler := az.DebugHandler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/azure", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var snapshot DebugSnapshot
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &snapshot))
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/debug/azure", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+const (
+	// degradedModeStateHealthy is the state in which ARM is reachable.
+	degradedModeStateHealthy = "Healthy"
+	// degradedModeStateDegraded is the state entered after the consecutive failed probes of ARM.
+	degradedModeStateDegraded = "Degraded"
+	// degradedModeStateRecovering is the state after a successful probe of ARM in the degraded mode, which is left
+	// after the consecutive successful probes, or goes back to the degraded state after a failed probe.
+	degradedModeStateRecovering = "Recovering"
+
+	// instanceStateTTL is the time after which the cached state of the VM of a node is pruned if it is not refreshed
+	// out of the degraded mode, e.g., after the node is deleted.
+	instanceStateTTL = time.Hour
+)
+
+var (
+	degradedModeStates = []string{degradedModeStateHealthy, degradedModeStateDegraded, degradedModeStateRecovering}
+
+	// errDegradedMode is returned by the writes paused in the degraded mode.
+	errDegradedMode = errors.New("ARM is unreachable, the writes are paused in the degraded mode")
+)
+
+// instanceState is the existence and the shutdown state of the VM of a node cached for the degraded mode.
+type instanceState struct {
+	exists   bool
+	shutdown bool
+}
+
+// cachedInstanceState is an instanceState with the time it is last refreshed.
+type cachedInstanceState struct {
+	instanceState
+	refreshed time.Time
+}
+
+// degradedModeTracker is the state machine of the degraded mode driven by the probes of ARM, which also caches the
+// existence and the shutdown state of the VMs of the nodes returned out of the degraded mode. A nil tracker is never
+// degraded, i.e., the degraded mode is disabled.
+type degradedModeTracker struct {
+	probeInterval     time.Duration
+	maxBackoff        time.Duration
+	failureThreshold  int
+	recoveryThreshold int
+
+	lock      sync.RWMutex
+	state     string
+	failures  int
+	successes int
+	backoff   time.Duration
+	// instanceStates is keyed by the lower case provider IDs.
+	instanceStates map[string]cachedInstanceState
+}
+
+// newDegradedModeTracker creates a tracker in the healthy state, and sets the defaults of the config.
+func newDegradedModeTracker(config *DegradedModeConfig) *degradedModeTracker {
+	if config.ProbeIntervalInSeconds <= 0 {
+		config.ProbeIntervalInSeconds = consts.DefaultDegradedModeProbeIntervalInSeconds
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = consts.DefaultDegradedModeFailureThreshold
+	}
+	if config.RecoveryThreshold <= 0 {
+		config.RecoveryThreshold = consts.DefaultDegradedModeRecoveryThreshold
+	}
+	if config.MaxBackoffInSeconds < config.ProbeIntervalInSeconds {
+		config.MaxBackoffInSeconds = consts.DefaultDegradedModeMaxBackoffInSeconds
+	}
+	metrics.SetDegradedModeState(degradedModeStateHealthy, degradedModeStates)
+	return &degradedModeTracker{
+		probeInterval:     time.Duration(config.ProbeIntervalInSeconds) * time.Second,
+		maxBackoff:        time.Duration(config.MaxBackoffInSeconds) * time.Second,
+		failureThreshold:  config.FailureThreshold,
+		recoveryThreshold: config.RecoveryThreshold,
+		state:             degradedModeStateHealthy,
+		instanceStates:    make(map[string]cachedInstanceState),
+	}
+}
+
+// isDegraded returns true if ARM is not confirmed reachable, i.e., in the degraded or recovering state.
+func (t *degradedModeTracker) isDegraded() bool {
+	if t == nil {
+		return false
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.state != degradedModeStateHealthy
+}
+
+// checkWrites returns errDegradedMode if the writes are paused in the degraded mode. It wraps a RetryError with the
+// interval before the next probe of ARM, so that the service controller retries after it instead of at its own rate
+// limited pace, which would fail fast on every attempt until ARM is reachable again.
+func (t *degradedModeTracker) checkWrites() error {
+	if t == nil {
+		return nil
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if t.state == degradedModeStateHealthy {
+		return nil
+	}
+	retryAfter := t.probeInterval
+	if t.state == degradedModeStateDegraded && t.backoff > retryAfter {
+		retryAfter = t.backoff
+	}
+	return fmt.Errorf("%w: %w", errDegradedMode, cloudproviderapi.NewRetryError(fmt.Sprintf("retrying in %s", retryAfter), retryAfter))
+}
+
+// observe transits the state by the result of a probe of ARM, and returns the interval before the next probe, which
+// is doubled by each failed probe in the degraded state up to the max backoff.
+func (t *degradedModeTracker) observe(err error) time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	from := t.state
+	switch {
+	case err != nil && t.state == degradedModeStateHealthy:
+		t.failures++
+		if t.failures >= t.failureThreshold {
+			t.state = degradedModeStateDegraded
+			t.backoff = t.probeInterval
+		}
+	case err != nil:
+		t.state = degradedModeStateDegraded
+		t.successes = 0
+		t.backoff *= 2
+		if t.backoff > t.maxBackoff {
+			t.backoff = t.maxBackoff
+		}
+	case t.state == degradedModeStateHealthy:
+		t.failures = 0
+		t.pruneInstanceStates(time.Now())
+	default:
+		t.state = degradedModeStateRecovering
+		t.successes++
+		if t.successes >= t.recoveryThreshold {
+			t.state = degradedModeStateHealthy
+			t.failures = 0
+			t.successes = 0
+			t.backoff = 0
+		}
+	}
+
+	if t.state != from {
+		if t.state == degradedModeStateDegraded {
+			klog.Warningf("degradedModeTracker: entering the degraded state from %s, ARM is unreachable: %v", from, err)
+		} else {
+			klog.Infof("degradedModeTracker: entering the %s state from %s", t.state, from)
+		}
+		metrics.ObserveDegradedModeTransition(from, t.state)
+		metrics.SetDegradedModeState(t.state, degradedModeStates)
+	}
+	if t.state == degradedModeStateDegraded {
+		return t.backoff
+	}
+	return t.probeInterval
+}
+
+// getInstanceState returns the cached state of the VM of the node. The VM is assumed existing and running if it is
+// not cached, so that the node is not deleted in the degraded mode.
+func (t *degradedModeTracker) getInstanceState(providerID string) instanceState {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if state, found := t.instanceStates[strings.ToLower(providerID)]; found {
+		return state.instanceState
+	}
+	return instanceState{exists: true}
+}
+
+// pruneInstanceStates removes the cached states of the VMs not refreshed within instanceStateTTL, so that the cache
+// does not grow with the deleted nodes. It is only called in the healthy state, in which the states are refreshed by
+// the node lifecycle controller, and must be called with the lock held.
+func (t *degradedModeTracker) pruneInstanceStates(now time.Time) {
+	for key, state := range t.instanceStates {
+		if now.Sub(state.refreshed) > instanceStateTTL {
+			delete(t.instanceStates, key)
+		}
+	}
+}
+
+// setInstanceExists caches the existence of the VM of the node.
+func (t *degradedModeTracker) setInstanceExists(providerID string, exists bool) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := strings.ToLower(providerID)
+	state := t.instanceStates[key]
+	state.exists = exists
+	state.refreshed = time.Now()
+	t.instanceStates[key] = state
+}
+
+// setInstanceShutdown caches the shutdown state of the VM of the node.
+func (t *degradedModeTracker) setInstanceShutdown(providerID string, shutdown bool) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := strings.ToLower(providerID)
+	state, found := t.instanceStates[key]
+	if !found {
+		state.exists = true
+	}
+	state.shutdown = shutdown
+	state.refreshed = time.Now()
+	t.instanceStates[key] = state
+}
+
+// runDegradedModeLoop probes ARM and transits the state of the degraded mode until the context is canceled.
+func (az *Cloud) runDegradedModeLoop(ctx context.Context) {
+	klog.V(2).Info("runDegradedModeLoop: started")
+	interval := az.degradedMode.probeInterval
+	for {
+		select {
+		case <-ctx.Done():
+			klog.Infof("runDegradedModeLoop: stopped due to %s", ctx.Err().Error())
+			return
+		case <-time.After(interval):
+		}
+		interval = az.degradedMode.observe(az.checkARMHealth(ctx))
+	}
+}
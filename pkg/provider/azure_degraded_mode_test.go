@@ -0,0 +1,187 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestDegradedModeTrackerObserve(t *testing.T) {
+	tracker := newDegradedModeTracker(&DegradedModeConfig{
+		Enabled:                true,
+		ProbeIntervalInSeconds: 10,
+		FailureThreshold:       2,
+		RecoveryThreshold:      2,
+		MaxBackoffInSeconds:    30,
+	})
+	failed := errors.New("unreachable")
+
+	// a success resets the failures in the healthy state
+	assert.Equal(t, 10*time.Second, tracker.observe(failed))
+	assert.Equal(t, 10*time.Second, tracker.observe(nil))
+	assert.Equal(t, 10*time.Second, tracker.observe(failed))
+	assert.False(t, tracker.isDegraded())
+
+	// the consecutive failures enter the degraded state, and double the backoff up to the max
+	assert.Equal(t, 10*time.Second, tracker.observe(failed))
+	assert.Equal(t, degradedModeStateDegraded, tracker.state)
+	assertDegradedModeRetry(t, tracker.checkWrites(), 10*time.Second)
+	assert.Equal(t, 20*time.Second, tracker.observe(failed))
+	assertDegradedModeRetry(t, tracker.checkWrites(), 20*time.Second)
+	assert.Equal(t, 30*time.Second, tracker.observe(failed))
+	assert.Equal(t, 30*time.Second, tracker.observe(failed))
+
+	// a failure while recovering goes back to the degraded state
+	assert.Equal(t, 10*time.Second, tracker.observe(nil))
+	assert.Equal(t, degradedModeStateRecovering, tracker.state)
+	assert.True(t, tracker.isDegraded())
+	assert.Equal(t, 30*time.Second, tracker.observe(failed))
+	assert.Equal(t, degradedModeStateDegraded, tracker.state)
+
+	// the consecutive successes leave the degraded mode
+	tracker.observe(nil)
+	tracker.observe(nil)
+	assert.Equal(t, degradedModeStateHealthy, tracker.state)
+	assert.NoError(t, tracker.checkWrites())
+
+	// the nil tracker is never degraded
+	var disabled *degradedModeTracker
+	assert.False(t, disabled.isDegraded())
+	assert.NoError(t, disabled.checkWrites())
+}
+
+func TestNewDegradedModeTrackerDefaults(t *testing.T) {
+	config := &DegradedModeConfig{Enabled: true}
+	tracker := newDegradedModeTracker(config)
+	assert.Equal(t, &DegradedModeConfig{
+		Enabled:                true,
+		ProbeIntervalInSeconds: 30,
+		FailureThreshold:       3,
+		RecoveryThreshold:      2,
+		MaxBackoffInSeconds:    300,
+	}, config)
+	assert.Equal(t, 30*time.Second, tracker.probeInterval)
+	assert.Equal(t, 300*time.Second, tracker.maxBackoff)
+}
+
+func TestInstancesInDegradedMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.degradedMode = newDegradedModeTracker(&DegradedModeConfig{Enabled: true})
+
+	// the existence is cached out of the degraded mode
+	unmanagedProviderID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm0"
+	exists, err := az.InstanceExistsByProviderID(context.TODO(), unmanagedProviderID)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, instanceState{exists: true}, az.degradedMode.getInstanceState(unmanagedProviderID))
+
+	// the VMs are not listed in the degraded mode, so the nodes are not deleted while ARM is unreachable
+	goneProviderID := "azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"
+	shutdownProviderID := "azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm2"
+	az.degradedMode.setInstanceExists(goneProviderID, false)
+	az.degradedMode.setInstanceShutdown(shutdownProviderID, true)
+	az.degradedMode.state = degradedModeStateDegraded
+
+	for providerID, expected := range map[string]instanceState{
+		goneProviderID:     {exists: false},
+		shutdownProviderID: {exists: true, shutdown: true},
+		"azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/VM3": {exists: true},
+	} {
+		exists, err := az.InstanceExistsByProviderID(context.TODO(), providerID)
+		assert.NoError(t, err)
+		assert.Equal(t, expected.exists, exists, providerID)
+		shutdown, err := az.InstanceShutdownByProviderID(context.TODO(), providerID)
+		assert.NoError(t, err)
+		assert.Equal(t, expected.shutdown, shutdown, providerID)
+	}
+
+	// the nodes without the provider ID are assumed existing
+	exists, err = az.InstanceExists(context.TODO(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "vm4"}})
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestPruneInstanceStates(t *testing.T) {
+	tracker := newDegradedModeTracker(&DegradedModeConfig{Enabled: true})
+	staleProviderID := "azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm0"
+	freshProviderID := "azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"
+	tracker.setInstanceShutdown(staleProviderID, true)
+	tracker.setInstanceShutdown(freshProviderID, true)
+	staleKey := strings.ToLower(staleProviderID)
+	stale := tracker.instanceStates[staleKey]
+	stale.refreshed = time.Now().Add(-2 * instanceStateTTL)
+	tracker.instanceStates[staleKey] = stale
+
+	// the states are not pruned in the degraded mode, in which they are not refreshed
+	tracker.state = degradedModeStateDegraded
+	tracker.observe(errors.New("unreachable"))
+	assert.Len(t, tracker.instanceStates, 2)
+
+	// the stale states are pruned in the healthy state
+	tracker.state = degradedModeStateHealthy
+	tracker.observe(nil)
+	assert.Len(t, tracker.instanceStates, 1)
+	assert.Equal(t, instanceState{exists: true}, tracker.getInstanceState(staleProviderID))
+	assert.Equal(t, instanceState{exists: true, shutdown: true}, tracker.getInstanceState(freshProviderID))
+}
+
+func TestWritesPausedInDegradedMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.degradedMode = newDegradedModeTracker(&DegradedModeConfig{Enabled: true})
+	az.degradedMode.state = degradedModeStateDegraded
+	service := getTestService("service", v1.ProtocolTCP, nil, false, 80)
+
+	retryAfter := time.Duration(consts.DefaultDegradedModeProbeIntervalInSeconds) * time.Second
+	_, err := az.EnsureLoadBalancer(context.TODO(), testClusterName, &service, nil)
+	assertDegradedModeRetry(t, err, retryAfter)
+	assertDegradedModeRetry(t, az.UpdateLoadBalancer(context.TODO(), testClusterName, &service, nil), retryAfter)
+	assertDegradedModeRetry(t, az.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, &service), retryAfter)
+	assertDegradedModeRetry(t, az.CreateRoute(context.TODO(), testClusterName, "", &cloudprovider.Route{TargetNode: "node"}), retryAfter)
+	assertDegradedModeRetry(t, az.DeleteRoute(context.TODO(), testClusterName, &cloudprovider.Route{TargetNode: "node"}), retryAfter)
+	_, err = az.ListRoutes(context.TODO(), testClusterName)
+	assertDegradedModeRetry(t, err, retryAfter)
+	assertDegradedModeRetry(t, az.CreateOrUpdateLB(&service, network.LoadBalancer{Name: pointer.String("lb")}), retryAfter)
+	assertDegradedModeRetry(t, az.CreateOrUpdateSecurityGroup(network.SecurityGroup{Name: pointer.String("nsg")}), retryAfter)
+}
+
+// assertDegradedModeRetry asserts that the error is errDegradedMode retried by the service controller after retryAfter.
+func assertDegradedModeRetry(t *testing.T, err error, retryAfter time.Duration) {
+	assert.ErrorIs(t, err, errDegradedMode)
+	var retryErr *cloudproviderapi.RetryError
+	if assert.ErrorAs(t, err, &retryErr) {
+		assert.Equal(t, retryAfter, retryErr.RetryAfter())
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+const (
+	// DiagnosisStepServiceType checks the service is a LoadBalancer service managed by the cloud provider.
+	DiagnosisStepServiceType = "ServiceType"
+	// DiagnosisStepLoadBalancerSelection checks the load balancer the service is or would be placed on.
+	DiagnosisStepLoadBalancerSelection = "LoadBalancerSelection"
+	// DiagnosisStepFrontendIPAddress checks the IP address the frontend IP configuration would use.
+	DiagnosisStepFrontendIPAddress = "FrontendIPAddress"
+	// DiagnosisStepHealthProbes checks the load balancing rules and health probes can be built.
+	DiagnosisStepHealthProbes = "HealthProbes"
+	// DiagnosisStepSecurityGroup checks the security rules of the service.
+	DiagnosisStepSecurityGroup = "SecurityGroup"
+	// DiagnosisStepFrontendIPConfiguration checks the service has a frontend IP configuration.
+	DiagnosisStepFrontendIPConfiguration = "FrontendIPConfiguration"
+)
+
+// DiagnosisStep is the result of one step of the load balancer reconciliation.
+type DiagnosisStep struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+// ServiceDiagnosis explains the state of the load balancer of a service.
+type ServiceDiagnosis struct {
+	Service string          `json:"service"`
+	Steps   []DiagnosisStep `json:"steps"`
+}
+
+// FirstFailure returns the first failing step, or nil if all steps passed.
+func (d *ServiceDiagnosis) FirstFailure() *DiagnosisStep {
+	for i := range d.Steps {
+		if !d.Steps[i].Passed {
+			return &d.Steps[i]
+		}
+	}
+	return nil
+}
+
+func (d *ServiceDiagnosis) pass(name, format string, args ...interface{}) {
+	d.Steps = append(d.Steps, DiagnosisStep{Name: name, Passed: true, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *ServiceDiagnosis) fail(name, format string, args ...interface{}) *ServiceDiagnosis {
+	d.Steps = append(d.Steps, DiagnosisStep{Name: name, Message: fmt.Sprintf(format, args...)})
+	return d
+}
+
+// DiagnoseService re-runs the decisions EnsureLoadBalancer makes for the service, i.e.,
+// load balancer selection, frontend IP address selection, health probe construction and
+// security rules, without changing any Azure resources. It stops at the first failing step.
+// Like EnsureLoadBalancer, the service is diagnosed with its AzureLoadBalancerConfiguration
+// and the default annotations of its namespace.
+func (az *Cloud) DiagnoseService(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) *ServiceDiagnosis {
+	d := &ServiceDiagnosis{Service: getServiceName(service)}
+
+	if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+		return d.fail(DiagnosisStepServiceType, "the service type is %s, only LoadBalancer services get an external IP", service.Spec.Type)
+	}
+	if !az.isServiceReconciledByLoadBalancerClass(service) {
+		return d.fail(DiagnosisStepServiceType, "the service has loadBalancerClass %q and is not managed by the cloud provider", pointer.StringDeref(service.Spec.LoadBalancerClass, ""))
+	}
+	service, err := az.withAzureLoadBalancerConfiguration(ctx, service)
+	if err != nil {
+		return d.fail(DiagnosisStepServiceType, "failed to apply the load balancer configuration of the service: %v", err)
+	}
+	isInternal := requiresInternalLoadBalancer(service)
+	d.pass(DiagnosisStepServiceType, "LoadBalancer service, internal: %t", isInternal)
+
+	existingLBs, err := az.ListManagedLBs(service, nodes, clusterName)
+	if err != nil {
+		return d.fail(DiagnosisStepLoadBalancerSelection, "failed to list the load balancers: %v", err)
+	}
+	expectedLBName, err := az.getAzureLoadBalancerName(service, existingLBs, clusterName, az.VMSet.GetPrimaryVMSetName(), isInternal)
+	if err != nil {
+		return d.fail(DiagnosisStepLoadBalancerSelection, "failed to select the load balancer: %v", err)
+	}
+	lb, _, status, _, exists, err := az.getServiceLoadBalancer(service, clusterName, nodes, false, existingLBs)
+	if err != nil {
+		return d.fail(DiagnosisStepLoadBalancerSelection, "failed to get the load balancer of the service: %v", err)
+	}
+	lbName := pointer.StringDeref(lb.Name, "")
+	switch {
+	case status != nil && !strings.EqualFold(lbName, expectedLBName):
+		d.pass(DiagnosisStepLoadBalancerSelection, "the service is on load balancer %s and will be moved to load balancer %s", lbName, expectedLBName)
+	case status != nil:
+		d.pass(DiagnosisStepLoadBalancerSelection, "the service is on load balancer %s", lbName)
+	case exists:
+		d.pass(DiagnosisStepLoadBalancerSelection, "the service will be added to the existing load balancer %s", expectedLBName)
+	default:
+		d.pass(DiagnosisStepLoadBalancerSelection, "the load balancer %s does not exist and will be created", expectedLBName)
+	}
+
+	v4Enabled, v6Enabled := getIPFamiliesEnabled(service)
+	var isIPv6s []bool
+	if v4Enabled || !v6Enabled {
+		isIPv6s = append(isIPv6s, false)
+	}
+	if v6Enabled {
+		isIPv6s = append(isIPv6s, true)
+	}
+
+	for _, isIPv6 := range isIPv6s {
+		if isInternal {
+			subnetName := az.SubnetName
+			if subnet := getInternalSubnet(service); subnet != nil {
+				subnetName = *subnet
+			}
+			if _, existsSubnet, err := az.getSubnet(az.VnetName, subnetName); err != nil {
+				return d.fail(DiagnosisStepFrontendIPAddress, "failed to get subnet %s in virtual network %s: %v", subnetName, az.VnetName, err)
+			} else if !existsSubnet {
+				return d.fail(DiagnosisStepFrontendIPAddress, "subnet %s does not exist in virtual network %s", subnetName, az.VnetName)
+			}
+			d.pass(DiagnosisStepFrontendIPAddress, "the frontend IP address will be allocated from subnet %s (IPv6: %t)", subnetName, isIPv6)
+			continue
+		}
+		pipName, shouldPIPExisted, err := az.determinePublicIPName(clusterName, service, isIPv6)
+		if err != nil {
+			return d.fail(DiagnosisStepFrontendIPAddress, "failed to determine the public IP address (IPv6: %t): %v", isIPv6, err)
+		}
+		pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
+		if shouldPIPExisted {
+			if _, existsPIP, err := az.getPublicIPAddress(pipResourceGroup, pipName, azcache.CacheReadTypeDefault); err != nil {
+				return d.fail(DiagnosisStepFrontendIPAddress, "failed to get public IP address %s: %v", pipName, err)
+			} else if !existsPIP {
+				return d.fail(DiagnosisStepFrontendIPAddress, "public IP address %s specified by the service does not exist in resource group %s", pipName, pipResourceGroup)
+			}
+		}
+		d.pass(DiagnosisStepFrontendIPAddress, "the frontend will use public IP address %s in resource group %s (IPv6: %t)", pipName, pipResourceGroup, isIPv6)
+	}
+
+	var probeNames []string
+	for _, isIPv6 := range isIPv6s {
+		probes, _, err := az.getExpectedLBRules(service, "frontendIPConfigID", "backendPoolID", expectedLBName, isIPv6)
+		if err != nil {
+			return d.fail(DiagnosisStepHealthProbes, "failed to build the load balancing rules and health probes (IPv6: %t): %v", isIPv6, err)
+		}
+		for _, probe := range probes {
+			probeNames = append(probeNames, fmt.Sprintf("%s(%s:%d)", pointer.StringDeref(probe.Name, ""), probe.Protocol, pointer.Int32Deref(probe.Port, 0)))
+		}
+	}
+	d.pass(DiagnosisStepHealthProbes, "expected health probes: %v", probeNames)
+
+	if az.SecurityGroupName == "" {
+		d.pass(DiagnosisStepSecurityGroup, "no security group is configured")
+	} else {
+		sg, err := az.getSecurityGroup(azcache.CacheReadTypeDefault)
+		if err != nil {
+			return d.fail(DiagnosisStepSecurityGroup, "failed to get security group %s: %v", az.SecurityGroupName, err)
+		}
+		ruleCount := 0
+		if sg.SecurityGroupPropertiesFormat != nil && sg.SecurityRules != nil {
+			for _, rule := range *sg.SecurityRules {
+				if az.serviceOwnsRule(service, pointer.StringDeref(rule.Name, "")) {
+					ruleCount++
+				}
+			}
+		}
+		if ruleCount == 0 && status != nil {
+			return d.fail(DiagnosisStepSecurityGroup, "security group %s has no rules for the service, traffic to the frontend is blocked", az.SecurityGroupName)
+		}
+		d.pass(DiagnosisStepSecurityGroup, "security group %s has %d rules for the service", az.SecurityGroupName, ruleCount)
+	}
+
+	if status == nil || len(status.Ingress) == 0 {
+		return d.fail(DiagnosisStepFrontendIPConfiguration, "the service has no frontend IP configuration yet, check the events of the service for reconciliation errors")
+	}
+	var ingressIPs []string
+	for _, ingress := range status.Ingress {
+		ingressIPs = append(ingressIPs, ingress.IP)
+	}
+	d.pass(DiagnosisStepFrontendIPConfiguration, "the service is exposed on %v", ingressIPs)
+
+	return d
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestDiagnoseService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc                string
+		service             v1.Service
+		namespaceDefaults   map[string]string
+		expectedInternal    bool
+		expectedFailureStep string
+	}{
+		{
+			desc: "ClusterIP services do not get an external IP",
+			service: func() v1.Service {
+				svc := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+				svc.Spec.Type = v1.ServiceTypeClusterIP
+				return svc
+			}(),
+			expectedFailureStep: DiagnosisStepServiceType,
+		},
+		{
+			desc: "user specified public IP address is not found",
+			service: func() v1.Service {
+				svc := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+				setServiceLoadBalancerIP(&svc, "1.2.3.4")
+				return svc
+			}(),
+			expectedFailureStep: DiagnosisStepFrontendIPAddress,
+		},
+		{
+			desc: "invalid health probe annotation",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
+				consts.ServiceAnnotationLoadBalancerHealthProbeTarget: "invalid",
+			}, false, 80),
+			expectedFailureStep: DiagnosisStepHealthProbes,
+		},
+		{
+			desc:                "the service has not been reconciled",
+			service:             getTestService("test1", v1.ProtocolTCP, nil, false, 80),
+			expectedFailureStep: DiagnosisStepFrontendIPConfiguration,
+		},
+		{
+			desc:    "the service should be diagnosed with the default annotations of its namespace",
+			service: getTestService("test1", v1.ProtocolTCP, nil, false, 80),
+			namespaceDefaults: map[string]string{
+				consts.ServiceAnnotationLoadBalancerInternal: "true",
+			},
+			expectedInternal:    true,
+			expectedFailureStep: DiagnosisStepFrontendIPConfiguration,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.NamespaceDefaultServiceAnnotations = map[string]map[string]string{tc.service.Namespace: tc.namespaceDefaults}
+			mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+			mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.LoadBalancer{}, nil).AnyTimes()
+			mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+			mockPIPClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.PublicIPAddress{}, nil).AnyTimes()
+			mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+			mockSGClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(network.SecurityGroup{}, nil).AnyTimes()
+			mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+			mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", gomock.Any()).Return(network.Subnet{
+				ID:                     pointer.String("subnet"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: pointer.String("10.0.0.0/24")},
+			}, nil).AnyTimes()
+
+			d := az.DiagnoseService(context.TODO(), testClusterName, &tc.service, []*v1.Node{})
+			failure := d.FirstFailure()
+			assert.NotNil(t, failure)
+			assert.Equal(t, tc.expectedFailureStep, failure.Name)
+			assert.Equal(t, failure, &d.Steps[len(d.Steps)-1])
+			if d.Steps[0].Passed {
+				assert.Equal(t, fmt.Sprintf("LoadBalancer service, internal: %t", tc.expectedInternal), d.Steps[0].Message)
+			}
+			assert.Empty(t, tc.service.Annotations[consts.ServiceAnnotationLoadBalancerInternal])
+		})
+	}
+}
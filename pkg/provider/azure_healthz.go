@@ -0,0 +1,155 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/klog/v2"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	// AzureTokenHealthCheckName is the name of the health check of acquiring the token of the Azure credentials.
+	AzureTokenHealthCheckName = "azure-token"
+	// AzureARMHealthCheckName is the name of the health check of reaching Azure Resource Manager.
+	AzureARMHealthCheckName = "azure-arm"
+	// AzureInformersHealthCheckName is the name of the health check of the sync of the informers of the cloud provider.
+	AzureInformersHealthCheckName = "azure-informers"
+	// AzureIMDSHealthCheckName is the name of the health check of reaching the instance metadata service.
+	AzureIMDSHealthCheckName = "azure-imds"
+
+	// azureHealthCheckInterval is the minimum interval between the checks calling Azure, so that the frequent
+	// probes of the health endpoints neither consume the rate limits nor flood Azure.
+	azureHealthCheckInterval = time.Minute
+	// informerSyncGracePeriod is the period after the informers are set in which they are not reported unsynced.
+	informerSyncGracePeriod = 5 * time.Minute
+)
+
+// cachedHealthCheck runs the check at most once per interval, and returns the last result in between.
+type cachedHealthCheck struct {
+	interval time.Duration
+	check    func(ctx context.Context) error
+
+	lock      sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+func newCachedHealthCheck(check func(ctx context.Context) error) *cachedHealthCheck {
+	return &cachedHealthCheck{
+		interval: azureHealthCheckInterval,
+		check:    check,
+	}
+}
+
+// Check returns the last result of the check if it is run in the interval, otherwise runs it.
+func (c *cachedHealthCheck) Check(req *http.Request) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.interval {
+		return c.err
+	}
+	c.err = c.check(req.Context())
+	c.checkedAt = time.Now()
+	return c.err
+}
+
+// HealthCheckers returns the readiness checks of the Azure credentials and dependencies of the cloud provider, i.e.,
+// acquiring the token, reaching Azure Resource Manager and the sync of the informers, so that the controller running
+// but unable to talk to Azure can be alerted on. They are not meant for the liveness probe, since restarting the
+// controller doesn't fix an outage of Azure but loses the state of the degraded mode. The checks calling Azure are
+// run at most once a minute.
+func (az *Cloud) HealthCheckers() []healthz.HealthChecker {
+	return []healthz.HealthChecker{
+		healthz.NamedCheck(AzureTokenHealthCheckName, newCachedHealthCheck(az.checkTokenHealth).Check),
+		healthz.NamedCheck(AzureARMHealthCheckName, newCachedHealthCheck(az.checkARMHealth).Check),
+		healthz.NamedCheck(AzureInformersHealthCheckName, az.checkInformersHealth),
+	}
+}
+
+// IMDSHealthChecker returns the health check of reaching the instance metadata service, which is run at most once a
+// minute.
+func (az *Cloud) IMDSHealthChecker() healthz.HealthChecker {
+	return healthz.NamedCheck(AzureIMDSHealthCheckName, newCachedHealthCheck(az.checkIMDSHealth).Check)
+}
+
+// checkTokenHealth returns an error if the token of the Azure credentials cannot be acquired or refreshed.
+func (az *Cloud) checkTokenHealth(ctx context.Context) error {
+	if az.servicePrincipalToken == nil {
+		return nil
+	}
+	if err := az.servicePrincipalToken.EnsureFreshWithContext(ctx); err != nil {
+		klog.Warningf("checkTokenHealth: failed to acquire the token of the Azure credentials: %s", err.Error())
+		return fmt.Errorf("failed to acquire the token of the Azure credentials: %w", err)
+	}
+	return nil
+}
+
+// checkARMHealth returns an error if Azure Resource Manager cannot be reached with the credentials, by getting the
+// security group. The security group not found or the requests throttled are not errors, since ARM is reachable.
+func (az *Cloud) checkARMHealth(ctx context.Context) error {
+	if az.servicePrincipalToken == nil || az.SecurityGroupsClient == nil || az.SecurityGroupName == "" {
+		return nil
+	}
+	_, rerr := az.SecurityGroupsClient.Get(ctx, az.SecurityGroupResourceGroup, az.SecurityGroupName, "")
+	if rerr == nil || rerr.IsNotFound() || rerr.IsThrottled() || strings.Contains(rerr.Error().Error(), consts.RateLimited) {
+		return nil
+	}
+	klog.Warningf("checkARMHealth: failed to reach Azure Resource Manager: %s", rerr.Error().Error())
+	return fmt.Errorf("failed to reach Azure Resource Manager: %w", rerr.Error())
+}
+
+// checkInformersHealth returns an error if the informers set by SetInformers have not synced in the grace period.
+func (az *Cloud) checkInformersHealth(_ *http.Request) error {
+	if az.informersSetAt.IsZero() || time.Since(az.informersSetAt) < informerSyncGracePeriod {
+		return nil
+	}
+	var unsynced []string
+	for resource, synced := range az.informersSynced {
+		if !synced() {
+			unsynced = append(unsynced, resource)
+		}
+	}
+	if len(unsynced) == 0 {
+		return nil
+	}
+	sort.Strings(unsynced)
+	return fmt.Errorf("the informers of %s have not synced in %s", strings.Join(unsynced, ", "), informerSyncGracePeriod)
+}
+
+// checkIMDSHealth returns an error if the instance metadata service cannot be reached.
+func (az *Cloud) checkIMDSHealth(_ context.Context) error {
+	if az.Metadata == nil {
+		return nil
+	}
+	if _, err := az.Metadata.GetMetadata(azcache.CacheReadTypeForceRefresh); err != nil {
+		klog.Warningf("checkIMDSHealth: failed to reach the instance metadata service: %s", err.Error())
+		return fmt.Errorf("failed to reach the instance metadata service: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestCachedHealthCheck(t *testing.T) {
+	var calls int
+	check := newCachedHealthCheck(func(_ context.Context) error {
+		calls++
+		return errors.New("failed")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+
+	assert.Error(t, check.Check(req))
+	assert.Error(t, check.Check(req))
+	assert.Equal(t, 1, calls)
+
+	// the check is run again after the interval
+	check.checkedAt = time.Now().Add(-azureHealthCheckInterval)
+	assert.Error(t, check.Check(req))
+	assert.Equal(t, 2, calls)
+}
+
+func TestCheckARMHealth(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		rerr        *retry.Error
+		expectedErr bool
+	}{
+		{
+			desc: "reachable ARM should be healthy",
+		},
+		{
+			desc: "not found security group should be healthy",
+			rerr: &retry.Error{HTTPStatusCode: http.StatusNotFound},
+		},
+		{
+			desc: "throttled requests should be healthy",
+			rerr: &retry.Error{HTTPStatusCode: http.StatusTooManyRequests},
+		},
+		{
+			desc: "rate limited requests should be healthy",
+			rerr: retry.GetRateLimitError(false, "NSGGet"),
+		},
+		{
+			desc:        "unauthorized requests should be unhealthy",
+			rerr:        &retry.Error{HTTPStatusCode: http.StatusUnauthorized, RawError: errors.New("unauthorized")},
+			expectedErr: true,
+		},
+		{
+			desc:        "unreachable ARM should be unhealthy",
+			rerr:        retry.NewError(true, errors.New("connection refused")),
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			az.servicePrincipalToken = &adal.ServicePrincipalToken{}
+			mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+			mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", "").Return(network.SecurityGroup{}, tc.rerr).Times(1)
+
+			err := az.checkARMHealth(context.TODO())
+			assert.Equal(t, tc.expectedErr, err != nil)
+		})
+	}
+
+	// ARM is not checked without credentials
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	assert.NoError(t, az.checkARMHealth(context.TODO()))
+}
+
+func TestCheckTokenHealth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	oauthConfig, err := adal.NewOAuthConfig(server.URL, "tenant")
+	assert.NoError(t, err)
+	newToken := func(expiresOn time.Time) *adal.ServicePrincipalToken {
+		token, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, "client", "resource", adal.Token{
+			AccessToken:  "token",
+			RefreshToken: "refresh",
+			ExpiresOn:    json.Number(fmt.Sprintf("%d", expiresOn.Unix())),
+		})
+		assert.NoError(t, err)
+		return token
+	}
+
+	az := &Cloud{}
+	assert.NoError(t, az.checkTokenHealth(context.TODO()))
+
+	az.servicePrincipalToken = newToken(time.Now().Add(time.Hour))
+	assert.NoError(t, az.checkTokenHealth(context.TODO()))
+
+	// the expired token cannot be refreshed
+	az.servicePrincipalToken = newToken(time.Now().Add(-time.Hour))
+	assert.Error(t, az.checkTokenHealth(context.TODO()))
+}
+
+func TestCheckInformersHealth(t *testing.T) {
+	az := &Cloud{}
+	assert.NoError(t, az.checkInformersHealth(nil))
+
+	synced := false
+	az.informersSynced = map[string]cache.InformerSynced{
+		"nodes":    func() bool { return true },
+		"services": func() bool { return synced },
+	}
+	az.informersSetAt = time.Now()
+	assert.NoError(t, az.checkInformersHealth(nil))
+
+	// the informers not synced in the grace period are unhealthy
+	az.informersSetAt = time.Now().Add(-informerSyncGracePeriod)
+	err := az.checkInformersHealth(nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "services")
+
+	synced = true
+	assert.NoError(t, az.checkInformersHealth(nil))
+}
+
+func TestCheckIMDSHealth(t *testing.T) {
+	healthy := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"compute":{"name":"vm"}}`))
+	}))
+	defer server.Close()
+
+	az := &Cloud{}
+	assert.NoError(t, az.checkIMDSHealth(context.TODO()))
+
+	var err error
+	az.Metadata, err = NewInstanceMetadataService(server.URL + "/")
+	assert.NoError(t, err)
+	assert.NoError(t, az.checkIMDSHealth(context.TODO()))
+
+	healthy = false
+	assert.Error(t, az.checkIMDSHealth(context.TODO()))
+}
@@ -75,6 +75,26 @@ type ComputeMetadata struct {
 	VMScaleSetName         string `json:"vmScaleSetName,omitempty"`
 	SubscriptionID         string `json:"subscriptionId,omitempty"`
 	ResourceID             string `json:"resourceId,omitempty"`
+	Publisher              string `json:"publisher,omitempty"`
+	Offer                  string `json:"offer,omitempty"`
+	LicenseType            string `json:"licenseType,omitempty"`
+
+	StorageProfile *StorageProfileMetadata `json:"storageProfile,omitempty"`
+}
+
+// StorageProfileMetadata represents the storage profile of the instance.
+type StorageProfileMetadata struct {
+	OSDisk *OSDiskMetadata `json:"osDisk,omitempty"`
+}
+
+// OSDiskMetadata represents the OS disk of the instance.
+type OSDiskMetadata struct {
+	DiffDiskSettings *DiffDiskSettingsMetadata `json:"diffDiskSettings,omitempty"`
+}
+
+// DiffDiskSettingsMetadata represents the ephemeral disk settings of the OS disk.
+type DiffDiskSettingsMetadata struct {
+	Option string `json:"option,omitempty"`
 }
 
 // InstanceMetadata represents instance information.
@@ -103,6 +123,8 @@ type LoadBalancerMetadata struct {
 type InstanceMetadataService struct {
 	imdsServer string
 	imsCache   azcache.Resource
+	// transport overrides the default transport of the requests if the proxy or the CA bundle is configured.
+	transport http.RoundTripper
 }
 
 // NewInstanceMetadataService creates an instance of the InstanceMetadataService accessor object.
@@ -189,7 +211,7 @@ func (ims *InstanceMetadataService) getInstanceMetadata(key string) (*InstanceMe
 	q.Add("api-version", consts.ImdsInstanceAPIVersion)
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{}
+	client := &http.Client{Transport: ims.transport}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -227,7 +249,7 @@ func (ims *InstanceMetadataService) getLoadBalancerMetadata() (*LoadBalancerMeta
 	q.Add("api-version", consts.ImdsLoadBalancerAPIVersion)
 	req.URL.RawQuery = q.Encode()
 
-	client := &http.Client{}
+	client := &http.Client{Transport: ims.transport}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,162 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/resourcegraphclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/providerid"
+)
+
+// instanceNotFoundRecord tracks the consecutive checks not finding the VM of a node.
+type instanceNotFoundRecord struct {
+	firstNotFound time.Time
+	checks        int
+}
+
+// confirmInstanceNotFound is called after ARM cannot find the VM with the given provider ID. It returns true if the
+// VM is confirmed to be gone, i.e., InstanceNotFoundConfirmation is disabled, or neither ARM nor Azure Resource Graph
+// found the VM in the configured number of consecutive checks spanning at least the grace period.
+func (az *Cloud) confirmInstanceNotFound(ctx context.Context, providerID string) (bool, error) {
+	if az.InstanceNotFoundConfirmation == nil || !az.InstanceNotFoundConfirmation.Enabled {
+		return true, nil
+	}
+
+	exists, err := az.instanceExistsInResourceGraph(ctx, providerID)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		klog.V(2).Infof("confirmInstanceNotFound: instance %q is not found by ARM but exists in Azure Resource Graph", providerID)
+		az.resetInstanceNotFound(providerID)
+		return false, nil
+	}
+
+	key := strings.ToLower(providerID)
+	now := time.Now()
+
+	az.instanceNotFoundLock.Lock()
+	defer az.instanceNotFoundLock.Unlock()
+
+	if az.instanceNotFoundRecords == nil {
+		az.instanceNotFoundRecords = make(map[string]*instanceNotFoundRecord)
+	}
+	record, ok := az.instanceNotFoundRecords[key]
+	if !ok {
+		record = &instanceNotFoundRecord{firstNotFound: now}
+		az.instanceNotFoundRecords[key] = record
+	}
+	record.checks++
+
+	gracePeriod := time.Duration(az.InstanceNotFoundConfirmation.GracePeriodInSeconds) * time.Second
+	if record.checks < az.InstanceNotFoundConfirmation.ConsecutiveChecks || now.Sub(record.firstNotFound) < gracePeriod {
+		klog.V(2).Infof("confirmInstanceNotFound: instance %q is not found in %d consecutive checks since %s, waiting for the confirmation",
+			providerID, record.checks, record.firstNotFound.Format(time.RFC3339))
+		return false, nil
+	}
+
+	klog.Warningf("confirmInstanceNotFound: instance %q is not found in %d consecutive checks since %s, reporting it missing",
+		providerID, record.checks, record.firstNotFound.Format(time.RFC3339))
+	delete(az.instanceNotFoundRecords, key)
+	return true, nil
+}
+
+// resetInstanceNotFound forgets the checks not finding the VM with the given provider ID.
+func (az *Cloud) resetInstanceNotFound(providerID string) {
+	if providerID == "" {
+		return
+	}
+
+	az.instanceNotFoundLock.Lock()
+	defer az.instanceNotFoundLock.Unlock()
+	delete(az.instanceNotFoundRecords, strings.ToLower(providerID))
+}
+
+// instanceExistsInResourceGraph returns true if Azure Resource Graph finds the VM with the given provider ID.
+// It returns false if the Resource Graph client is not configured. The VM is matched by its name in the
+// subscription rather than by its resource ID, so that a VM moved to another resource group is still found. If the
+// node of the VM is known, the VM ID is matched against the system UUID of the node as well, so that another VM
+// with the same name does not count.
+func (az *Cloud) instanceExistsInResourceGraph(ctx context.Context, providerID string) (bool, error) {
+	if az.ResourceGraphClient == nil {
+		return false, nil
+	}
+
+	p, err := providerid.Parse(providerID)
+	if err != nil {
+		return false, err
+	}
+
+	// The VMSS VMs are in the ComputeResources table instead of Resources. The resource group is the only segment
+	// of the resource ID left out of the match.
+	table, resourceType := "Resources", "microsoft.compute/virtualmachines"
+	if p.IsScaleSetVM() {
+		table, resourceType = "ComputeResources", "microsoft.compute/virtualmachinescalesets/virtualmachines"
+	}
+	resourceID := p.ResourceID()
+	idSuffix := resourceID[strings.Index(resourceID, "/providers/"):]
+	request := resourcegraphclient.QueryRequest{
+		Subscriptions: []string{p.SubscriptionID},
+		Query: fmt.Sprintf("%s | where type =~ '%s' and id endswith '%s' | project id, vmId = tostring(properties.vmId)",
+			table, resourceType, strings.ReplaceAll(idSuffix, "'", "\\'")),
+	}
+	response, rerr := az.ResourceGraphClient.Resources(ctx, request)
+	if rerr != nil {
+		return false, rerr.Error()
+	}
+
+	systemUUID := az.getNodeSystemUUIDByProviderID(providerID)
+	for _, row := range response.Data {
+		id, _ := row["id"].(string)
+		vmID, _ := row["vmId"].(string)
+		if systemUUID != "" && vmID != "" && !strings.EqualFold(vmID, systemUUID) {
+			klog.V(4).Infof("instanceExistsInResourceGraph: skipping VM %s of instance %q, whose VM ID %s differs from the system UUID %s of the node",
+				id, providerID, vmID, systemUUID)
+			continue
+		}
+		if !strings.EqualFold(id, resourceID) {
+			klog.V(2).Infof("instanceExistsInResourceGraph: instance %q is found as %s", providerID, id)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// getNodeSystemUUIDByProviderID returns the system UUID of the node with the given provider ID, which is the VM ID of
+// its VM, or "" if the node is not found.
+func (az *Cloud) getNodeSystemUUIDByProviderID(providerID string) string {
+	if az.nodeLister == nil {
+		return ""
+	}
+	nodes, err := az.nodeLister.List(labels.Everything())
+	if err != nil {
+		return ""
+	}
+	for _, node := range nodes {
+		if strings.EqualFold(node.Spec.ProviderID, providerID) {
+			return node.Status.NodeInfo.SystemUUID
+		}
+	}
+	return ""
+}
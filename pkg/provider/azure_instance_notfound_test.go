@@ -0,0 +1,214 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/resourcegraphclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/resourcegraphclient/mockresourcegraphclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const testMissingVMProviderID = "azure:///subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm3"
+
+func setTestMissingVM(cloud *Cloud) {
+	mockVMsClient := cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMsClient.EXPECT().Get(gomock.Any(), cloud.ResourceGroup, "vm3", gomock.Any()).Return(compute.VirtualMachine{}, &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}).AnyTimes()
+}
+
+func TestInstanceExistsByProviderIDConfirmation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.InstanceNotFoundConfirmation = &InstanceNotFoundConfirmationConfig{
+		Enabled:              true,
+		ConsecutiveChecks:    3,
+		GracePeriodInSeconds: 300,
+	}
+	setTestMissingVM(cloud)
+	mockResourceGraphClient := cloud.ResourceGraphClient.(*mockresourcegraphclient.MockInterface)
+	mockResourceGraphClient.EXPECT().Resources(gomock.Any(), gomock.Any()).Return(resourcegraphclient.QueryResponse{}, nil).AnyTimes()
+
+	for i := 0; i < 3; i++ {
+		exists, err := cloud.InstanceExistsByProviderID(context.Background(), testMissingVMProviderID)
+		assert.NoError(t, err)
+		assert.True(t, exists, "the instance should not be reported missing within the grace period")
+	}
+
+	// Moves the first check out of the grace period.
+	record := cloud.instanceNotFoundRecords[strings.ToLower(testMissingVMProviderID)]
+	assert.Equal(t, 3, record.checks)
+	record.firstNotFound = time.Now().Add(-301 * time.Second)
+
+	exists, err := cloud.InstanceExistsByProviderID(context.Background(), testMissingVMProviderID)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	assert.Empty(t, cloud.instanceNotFoundRecords)
+}
+
+func TestInstanceExistsByProviderIDConfirmationChecks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.InstanceNotFoundConfirmation = &InstanceNotFoundConfirmationConfig{
+		Enabled:              true,
+		ConsecutiveChecks:    2,
+		GracePeriodInSeconds: 1,
+	}
+	setTestMissingVM(cloud)
+	mockResourceGraphClient := cloud.ResourceGraphClient.(*mockresourcegraphclient.MockInterface)
+	mockResourceGraphClient.EXPECT().Resources(gomock.Any(), gomock.Any()).Return(resourcegraphclient.QueryResponse{}, nil).AnyTimes()
+
+	exists, err := cloud.InstanceExistsByProviderID(context.Background(), testMissingVMProviderID)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// The grace period has elapsed but not enough checks are done.
+	cloud.instanceNotFoundRecords[strings.ToLower(testMissingVMProviderID)].firstNotFound = time.Now().Add(-time.Minute)
+	exists, err = cloud.InstanceExistsByProviderID(context.Background(), testMissingVMProviderID)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestInstanceExistsByProviderIDConfirmationFoundByResourceGraph(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.InstanceNotFoundConfirmation = &InstanceNotFoundConfirmationConfig{
+		Enabled:              true,
+		ConsecutiveChecks:    1,
+		GracePeriodInSeconds: 1,
+	}
+	setTestMissingVM(cloud)
+	cloud.instanceNotFoundRecords = map[string]*instanceNotFoundRecord{
+		strings.ToLower(testMissingVMProviderID): {firstNotFound: time.Now().Add(-time.Hour), checks: 5},
+	}
+	mockResourceGraphClient := cloud.ResourceGraphClient.(*mockresourcegraphclient.MockInterface)
+	mockResourceGraphClient.EXPECT().Resources(gomock.Any(), resourcegraphclient.QueryRequest{
+		Subscriptions: []string{"subscription"},
+		Query:         "Resources | where type =~ 'microsoft.compute/virtualmachines' and id endswith '/providers/Microsoft.Compute/virtualMachines/vm3' | project id, vmId = tostring(properties.vmId)",
+	}).Return(resourcegraphclient.QueryResponse{
+		Count: 1,
+		Data:  []map[string]interface{}{{"id": "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm3"}},
+	}, nil)
+
+	exists, err := cloud.InstanceExistsByProviderID(context.Background(), testMissingVMProviderID)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Empty(t, cloud.instanceNotFoundRecords)
+}
+
+func TestInstanceExistsByProviderIDConfirmationError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.InstanceNotFoundConfirmation = &InstanceNotFoundConfirmationConfig{Enabled: true}
+	setTestMissingVM(cloud)
+	mockResourceGraphClient := cloud.ResourceGraphClient.(*mockresourcegraphclient.MockInterface)
+	mockResourceGraphClient.EXPECT().Resources(gomock.Any(), gomock.Any()).Return(resourcegraphclient.QueryResponse{}, &retry.Error{HTTPStatusCode: http.StatusTooManyRequests})
+
+	_, err := cloud.InstanceExistsByProviderID(context.Background(), testMissingVMProviderID)
+	assert.Error(t, err)
+	assert.Empty(t, cloud.instanceNotFoundRecords)
+}
+
+func TestInstanceExistsInResourceGraphScaleSetVM(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	mockResourceGraphClient := cloud.ResourceGraphClient.(*mockresourcegraphclient.MockInterface)
+	mockResourceGraphClient.EXPECT().Resources(gomock.Any(), resourcegraphclient.QueryRequest{
+		Subscriptions: []string{"sub"},
+		Query:         "ComputeResources | where type =~ 'microsoft.compute/virtualmachinescalesets/virtualmachines' and id endswith '/providers/Microsoft.Compute/virtualMachineScaleSets/ss/virtualMachines/0' | project id, vmId = tostring(properties.vmId)",
+	}).Return(resourcegraphclient.QueryResponse{}, nil)
+
+	exists, err := cloud.instanceExistsInResourceGraph(context.Background(), "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/ss/virtualMachines/0")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestInstanceExistsInResourceGraphMovedVM(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "vm3"},
+		Spec:       v1.NodeSpec{ProviderID: testMissingVMProviderID},
+		Status:     v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{SystemUUID: "9C2B5E0A-0000-0000-0000-000000000001"}},
+	}
+	indexer := toolscache.NewIndexer(toolscache.MetaNamespaceKeyFunc, toolscache.Indexers{})
+	_ = indexer.Add(node)
+	cloud.nodeLister = corelisters.NewNodeLister(indexer)
+	mockResourceGraphClient := cloud.ResourceGraphClient.(*mockresourcegraphclient.MockInterface)
+
+	// the VM moved to another resource group is found by its name and VM ID
+	mockResourceGraphClient.EXPECT().Resources(gomock.Any(), gomock.Any()).Return(resourcegraphclient.QueryResponse{
+		Count: 2,
+		Data: []map[string]interface{}{
+			{"id": "/subscriptions/subscription/resourceGroups/rg1/providers/Microsoft.Compute/virtualMachines/vm3", "vmId": "9c2b5e0a-0000-0000-0000-000000000002"},
+			{"id": "/subscriptions/subscription/resourceGroups/rg2/providers/Microsoft.Compute/virtualMachines/vm3", "vmId": "9c2b5e0a-0000-0000-0000-000000000001"},
+		},
+	}, nil)
+	exists, err := cloud.instanceExistsInResourceGraph(context.Background(), testMissingVMProviderID)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// another VM with the same name does not count
+	mockResourceGraphClient.EXPECT().Resources(gomock.Any(), gomock.Any()).Return(resourcegraphclient.QueryResponse{
+		Count: 1,
+		Data: []map[string]interface{}{
+			{"id": "/subscriptions/subscription/resourceGroups/rg1/providers/Microsoft.Compute/virtualMachines/vm3", "vmId": "9c2b5e0a-0000-0000-0000-000000000002"},
+		},
+	}, nil)
+	exists, err = cloud.instanceExistsInResourceGraph(context.Background(), testMissingVMProviderID)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// the VM of an unknown node is matched by its name only
+	_ = indexer.Delete(node)
+	mockResourceGraphClient.EXPECT().Resources(gomock.Any(), gomock.Any()).Return(resourcegraphclient.QueryResponse{
+		Count: 1,
+		Data: []map[string]interface{}{
+			{"id": "/subscriptions/subscription/resourceGroups/rg1/providers/Microsoft.Compute/virtualMachines/vm3", "vmId": "9c2b5e0a-0000-0000-0000-000000000002"},
+		},
+	}, nil)
+	exists, err = cloud.instanceExistsInResourceGraph(context.Background(), testMissingVMProviderID)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
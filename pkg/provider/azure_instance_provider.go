@@ -0,0 +1,133 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/providerid"
+)
+
+// InstanceProvider provides the instance information of the nodes which are not Azure VMs, e.g.,
+// Arc-enabled servers or on-prem nodes in hybrid clusters. The nodes are labeled with
+// "kubernetes.azure.com/instance-provider=<name>" and are treated as unmanaged nodes: they are
+// not added to the load balancer backend pools, and they are always assumed to exist.
+type InstanceProvider interface {
+	// InstanceID returns the instance ID of the node, which is used to build its provider ID.
+	// It must be a valid label value if it is served from a label.
+	InstanceID(ctx context.Context, node *v1.Node) (string, error)
+	// InstanceMetadata returns the instance type, addresses and zone of the node.
+	// The provider ID in the returned metadata is ignored.
+	InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error)
+}
+
+// labelInstanceProvider serves the instance information from the labels of the node.
+type labelInstanceProvider struct{}
+
+// InstanceID returns the value of the instance ID label, or the node name if the label is not set.
+func (labelInstanceProvider) InstanceID(_ context.Context, node *v1.Node) (string, error) {
+	if instanceID := node.Labels[consts.InstanceIDLabel]; instanceID != "" {
+		return instanceID, nil
+	}
+	return node.Name, nil
+}
+
+// InstanceMetadata returns the instance type and the zone from the well-known labels, and keeps
+// the addresses reported by kubelet.
+func (labelInstanceProvider) InstanceMetadata(_ context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
+	return &cloudprovider.InstanceMetadata{
+		InstanceType:  node.Labels[v1.LabelInstanceTypeStable],
+		NodeAddresses: node.Status.Addresses,
+		Zone:          node.Labels[v1.LabelTopologyZone],
+		Region:        node.Labels[v1.LabelTopologyRegion],
+	}, nil
+}
+
+// RegisterInstanceProvider registers the instance provider serving the nodes labeled with
+// "kubernetes.azure.com/instance-provider=<name>". The built-in "label" provider can be overridden.
+func (az *Cloud) RegisterInstanceProvider(name string, provider InstanceProvider) {
+	az.nodeCachesLock.Lock()
+	defer az.nodeCachesLock.Unlock()
+
+	if az.instanceProviders == nil {
+		az.instanceProviders = make(map[string]InstanceProvider)
+	}
+	az.instanceProviders[name] = provider
+}
+
+// getNodeInstanceProvider returns the instance provider of the node, or nil if the node is not
+// served by an instance provider.
+func (az *Cloud) getNodeInstanceProvider(node *v1.Node) (InstanceProvider, error) {
+	if !isNonVMNode(node) {
+		return nil, nil
+	}
+	name := node.Labels[consts.InstanceProviderLabel]
+
+	az.nodeCachesLock.RLock()
+	provider, found := az.instanceProviders[name]
+	az.nodeCachesLock.RUnlock()
+	if found {
+		return provider, nil
+	}
+	if name == consts.LabelInstanceProviderName {
+		return labelInstanceProvider{}, nil
+	}
+	return nil, fmt.Errorf("instance provider %q of node %s is not registered", name, node.Name)
+}
+
+// isNonVMNode returns true if the node is served by an instance provider.
+func isNonVMNode(node *v1.Node) bool {
+	_, ok := node.Labels[consts.InstanceProviderLabel]
+	return ok
+}
+
+// getNonVMNode returns the cached node served by an instance provider, or nil if not found.
+func (az *Cloud) getNonVMNode(nodeName string) *v1.Node {
+	az.nodeCachesLock.RLock()
+	defer az.nodeCachesLock.RUnlock()
+
+	return az.nonVMNodes[nodeName]
+}
+
+// getNonVMInstanceMetadata returns the metadata of the node served by the instance provider.
+func (az *Cloud) getNonVMInstanceMetadata(ctx context.Context, node *v1.Node, provider InstanceProvider) (*cloudprovider.InstanceMetadata, error) {
+	meta, err := provider.InstanceMetadata(ctx, node)
+	if err != nil {
+		klog.Errorf("InstanceMetadata: failed to get the metadata of node %s from the instance provider: %v", node.Name, err)
+		return &cloudprovider.InstanceMetadata{}, err
+	}
+	if meta == nil {
+		meta = &cloudprovider.InstanceMetadata{}
+	}
+
+	meta.ProviderID = node.Spec.ProviderID
+	if meta.ProviderID == "" {
+		instanceID, err := provider.InstanceID(ctx, node)
+		if err != nil {
+			klog.Errorf("InstanceMetadata: failed to get the instance ID of node %s from the instance provider: %v", node.Name, err)
+			return &cloudprovider.InstanceMetadata{}, err
+		}
+		meta.ProviderID = providerid.FromResourceID(instanceID)
+	}
+	return meta, nil
+}
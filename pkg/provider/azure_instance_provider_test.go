@@ -0,0 +1,149 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	cloudprovider "k8s.io/cloud-provider"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+type fakeInstanceProvider struct{}
+
+func (fakeInstanceProvider) InstanceID(_ context.Context, node *v1.Node) (string, error) {
+	return "arc-" + node.Name, nil
+}
+
+func (fakeInstanceProvider) InstanceMetadata(_ context.Context, _ *v1.Node) (*cloudprovider.InstanceMetadata, error) {
+	return &cloudprovider.InstanceMetadata{InstanceType: "arc", ProviderID: "ignored"}, nil
+}
+
+func TestInstanceProvider(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.nodeNames = sets.New[string]()
+	az.RegisterInstanceProvider("arc", fakeInstanceProvider{})
+
+	labelNode := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "onprem-1",
+			Labels: map[string]string{
+				consts.InstanceProviderLabel:      consts.LabelInstanceProviderName,
+				consts.InstanceIDLabel:            "server-1",
+				v1.LabelInstanceTypeStable:        "bare-metal",
+				v1.LabelTopologyZone:              "dc-1",
+				v1.LabelTopologyRegion:            "onprem",
+				consts.ExternalResourceGroupLabel: "rg",
+			},
+		},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.4"}},
+		},
+	}
+	arcNode := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "arc-1",
+			Labels: map[string]string{consts.InstanceProviderLabel: "arc"},
+		},
+	}
+	unknownNode := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "unknown-1",
+			Labels: map[string]string{consts.InstanceProviderLabel: "unknown"},
+		},
+	}
+	for _, node := range []*v1.Node{labelNode, arcNode, unknownNode} {
+		az.updateNodeCaches(nil, node)
+	}
+
+	t.Run("should treat the nodes as unmanaged and exclude them from load balancers", func(t *testing.T) {
+		for _, name := range []string{"onprem-1", "arc-1", "unknown-1"} {
+			unmanaged, err := az.IsNodeUnmanaged(name)
+			assert.NoError(t, err)
+			assert.True(t, unmanaged)
+			assert.True(t, az.excludeLoadBalancerNodes.Has(name))
+		}
+	})
+
+	t.Run("should serve the instance ID from the instance provider", func(t *testing.T) {
+		instanceID, err := az.InstanceID(context.TODO(), "onprem-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "server-1", instanceID)
+
+		instanceID, err = az.InstanceID(context.TODO(), "arc-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "arc-arc-1", instanceID)
+
+		_, err = az.InstanceID(context.TODO(), "unknown-1")
+		assert.Error(t, err)
+	})
+
+	t.Run("should serve the instance metadata from the instance provider", func(t *testing.T) {
+		meta, err := az.InstanceMetadata(context.TODO(), labelNode)
+		assert.NoError(t, err)
+		assert.Equal(t, &cloudprovider.InstanceMetadata{
+			ProviderID:    "azure://server-1",
+			InstanceType:  "bare-metal",
+			NodeAddresses: labelNode.Status.Addresses,
+			Zone:          "dc-1",
+			Region:        "onprem",
+		}, meta)
+
+		arcNode := arcNode.DeepCopy()
+		arcNode.Spec.ProviderID = "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.HybridCompute/machines/arc-1"
+		meta, err = az.InstanceMetadata(context.TODO(), arcNode)
+		assert.NoError(t, err)
+		assert.Equal(t, &cloudprovider.InstanceMetadata{ProviderID: arcNode.Spec.ProviderID, InstanceType: "arc"}, meta)
+
+		_, err = az.InstanceMetadata(context.TODO(), unknownNode)
+		assert.Error(t, err)
+	})
+
+	t.Run("should assume the nodes exist and are not shut down", func(t *testing.T) {
+		for _, node := range []*v1.Node{labelNode, arcNode} {
+			exists, err := az.InstanceExists(context.TODO(), node)
+			assert.NoError(t, err)
+			assert.True(t, exists)
+
+			shutdown, err := az.InstanceShutdown(context.TODO(), node)
+			assert.NoError(t, err)
+			assert.False(t, shutdown)
+		}
+
+		exists, err := az.InstanceExistsByProviderID(context.TODO(), "azure://server-1")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("should forget the nodes once they are deleted", func(t *testing.T) {
+		az.updateNodeCaches(labelNode, nil)
+		assert.Nil(t, az.getNonVMNode("onprem-1"))
+		unmanaged, err := az.IsNodeUnmanaged("onprem-1")
+		assert.NoError(t, err)
+		assert.False(t, unmanaged)
+	})
+}
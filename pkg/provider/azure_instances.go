@@ -23,10 +23,13 @@ import (
 	"os"
 	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
 
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
@@ -37,6 +40,10 @@ const (
 	vmPowerStateStopped      = "stopped"
 	vmPowerStateDeallocated  = "deallocated"
 	vmPowerStateDeallocating = "deallocating"
+	vmPowerStateHibernated   = "hibernated"
+
+	vmHibernationStatePrefix     = "HibernationState/"
+	vmHibernationStateHibernated = "hibernated"
 
 	// nodeNameEnvironmentName is the environment variable name for getting node name.
 	// It is only used for out-of-tree cloud provider.
@@ -67,7 +74,8 @@ func (az *Cloud) addressGetter(nodeName types.NodeName) ([]v1.NodeAddress, error
 	return addresses, nil
 }
 
-// NodeAddresses returns the addresses of the specified instance.
+// NodeAddresses returns the addresses of the specified instance. The addresses are cached within
+// nodeAddressCacheTTLInSeconds unless the cache is disabled.
 func (az *Cloud) NodeAddresses(ctx context.Context, name types.NodeName) ([]v1.NodeAddress, error) {
 	// Returns nil for unmanaged nodes because azure cloud provider couldn't fetch information for them.
 	unmanaged, err := az.IsNodeUnmanaged(string(name))
@@ -79,6 +87,23 @@ func (az *Cloud) NodeAddresses(ctx context.Context, name types.NodeName) ([]v1.N
 		return nil, nil
 	}
 
+	if az.nodeAddressCache == nil {
+		return az.getNodeAddresses(name)
+	}
+	if addresses, ok := az.nodeAddressCache.get(name); ok {
+		return addresses, nil
+	}
+	addresses, err := az.getNodeAddresses(name)
+	if err != nil {
+		return nil, err
+	}
+	az.nodeAddressCache.set(name, addresses)
+	return addresses, nil
+}
+
+// getNodeAddresses gets the addresses of the node from the instance metadata for the local instance, or from the
+// Azure ARM API otherwise.
+func (az *Cloud) getNodeAddresses(name types.NodeName) ([]v1.NodeAddress, error) {
 	if az.UseInstanceMetadata {
 		metadata, err := az.Metadata.GetMetadata(azcache.CacheReadTypeDefault)
 		if err != nil {
@@ -184,11 +209,28 @@ func (az *Cloud) NodeAddressesByProviderID(ctx context.Context, providerID strin
 
 // InstanceExistsByProviderID returns true if the instance with the given provider id still exists and is running.
 // If false is returned with no error, the instance will be immediately deleted by the cloud controller manager.
+// In the degraded mode, the existence cached out of the degraded mode is returned, so that the nodes are not deleted
+// while ARM is unreachable.
 func (az *Cloud) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
 	if providerID == "" {
 		return false, errNodeNotInitialized
 	}
 
+	if az.degradedMode.isDegraded() {
+		exists := az.degradedMode.getInstanceState(providerID).exists
+		klog.V(2).Infof("InstanceExistsByProviderID: returning the cached existence %t of node %q in the degraded mode", exists, providerID)
+		return exists, nil
+	}
+
+	exists, err := az.instanceExistsByProviderID(ctx, providerID)
+	if err == nil {
+		az.degradedMode.setInstanceExists(providerID, exists)
+	}
+	return exists, err
+}
+
+func (az *Cloud) instanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+
 	// Returns true for unmanaged nodes because azure cloud provider always assumes them exists.
 	if az.IsNodeUnmanagedByProviderID(providerID) {
 		klog.V(4).Infof("InstanceExistsByProviderID: assuming unmanaged node %q exists", providerID)
@@ -203,7 +245,8 @@ func (az *Cloud) InstanceExistsByProviderID(ctx context.Context, providerID stri
 	name, err := az.VMSet.GetNodeNameByProviderID(providerID)
 	if err != nil {
 		if errors.Is(err, cloudprovider.InstanceNotFound) {
-			return false, nil
+			gone, err := az.confirmInstanceNotFound(ctx, providerID)
+			return !gone, err
 		}
 		return false, err
 	}
@@ -211,11 +254,13 @@ func (az *Cloud) InstanceExistsByProviderID(ctx context.Context, providerID stri
 	_, err = az.InstanceID(ctx, name)
 	if err != nil {
 		if errors.Is(err, cloudprovider.InstanceNotFound) {
-			return false, nil
+			gone, err := az.confirmInstanceNotFound(ctx, providerID)
+			return !gone, err
 		}
 		return false, err
 	}
 
+	az.resetInstanceNotFound(providerID)
 	return true, nil
 }
 
@@ -229,13 +274,18 @@ func (az *Cloud) InstanceExists(ctx context.Context, node *v1.Node) (bool, error
 	if err != nil {
 		return false, err
 	}
-	if unmanaged {
+	if unmanaged || isNonVMNode(node) {
 		klog.V(4).Infof("InstanceExists: omitting unmanaged node %q", node.Name)
 		return true, nil
 	}
 
 	providerID := node.Spec.ProviderID
 	if providerID == "" {
+		if az.degradedMode.isDegraded() {
+			klog.V(2).Infof("InstanceExists: assuming node %q without provider ID exists in the degraded mode", node.Name)
+			return true, nil
+		}
+
 		var err error
 		providerID, err = cloudprovider.GetInstanceProviderID(ctx, az, types.NodeName(node.Name))
 		if err != nil {
@@ -251,11 +301,27 @@ func (az *Cloud) InstanceExists(ctx context.Context, node *v1.Node) (bool, error
 	return az.InstanceExistsByProviderID(ctx, providerID)
 }
 
-// InstanceShutdownByProviderID returns true if the instance is in safe state to detach volumes
+// InstanceShutdownByProviderID returns true if the instance is in safe state to detach volumes.
+// In the degraded mode, the shutdown state cached out of the degraded mode is returned.
 func (az *Cloud) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
 	if providerID == "" {
 		return false, nil
 	}
+
+	if az.degradedMode.isDegraded() {
+		shutdown := az.degradedMode.getInstanceState(providerID).shutdown
+		klog.V(2).Infof("InstanceShutdownByProviderID: returning the cached shutdown state %t of node %q in the degraded mode", shutdown, providerID)
+		return shutdown, nil
+	}
+
+	shutdown, err := az.instanceShutdownByProviderID(providerID)
+	if err == nil {
+		az.degradedMode.setInstanceShutdown(providerID, shutdown)
+	}
+	return shutdown, err
+}
+
+func (az *Cloud) instanceShutdownByProviderID(providerID string) (bool, error) {
 	if az.VMSet == nil {
 		// vmSet == nil indicates credentials are not provided.
 		return false, fmt.Errorf("no credentials provided for Azure cloud provider")
@@ -293,9 +359,51 @@ func (az *Cloud) InstanceShutdownByProviderID(ctx context.Context, providerID st
 	}
 	klog.V(3).Infof("InstanceShutdownByProviderID gets provisioning state %q for node %q", provisioningState, nodeName)
 
-	status := strings.ToLower(powerStatus)
 	provisioningSucceeded := strings.EqualFold(strings.ToLower(provisioningState), strings.ToLower(string(consts.ProvisioningStateSucceeded)))
-	return provisioningSucceeded && (status == vmPowerStateStopped || status == vmPowerStateDeallocated || status == vmPowerStateDeallocating), nil
+	return provisioningSucceeded && az.isShutdownPowerState(powerStatus), nil
+}
+
+// isShutdownPowerState returns true if the node of the VM in the power state should be marked as shut down.
+func (az *Cloud) isShutdownPowerState(powerState string) bool {
+	var behavior string
+	switch strings.ToLower(powerState) {
+	case vmPowerStateStopped:
+		if az.NodeShutdownPowerStates != nil {
+			behavior = az.NodeShutdownPowerStates.Stopped
+		}
+	case vmPowerStateDeallocated, vmPowerStateDeallocating:
+		if az.NodeShutdownPowerStates != nil {
+			behavior = az.NodeShutdownPowerStates.Deallocated
+		}
+	case vmPowerStateHibernated:
+		if az.NodeShutdownPowerStates != nil {
+			behavior = az.NodeShutdownPowerStates.Hibernated
+		}
+	default:
+		return false
+	}
+	return !strings.EqualFold(behavior, consts.NodeShutdownBehaviorIgnore)
+}
+
+// getPowerStateFromStatuses returns the power state from the instance view statuses of the VM, and false if
+// the power state is not found. Deallocated VMs which are hibernated are reported as hibernated.
+func getPowerStateFromStatuses(statuses []compute.InstanceViewStatus) (string, bool) {
+	var powerState string
+	var found, hibernated bool
+	for _, status := range statuses {
+		state := pointer.StringDeref(status.Code, "")
+		if !found && strings.HasPrefix(state, vmPowerStatePrefix) {
+			powerState = strings.TrimPrefix(state, vmPowerStatePrefix)
+			found = true
+		}
+		if strings.EqualFold(state, vmHibernationStatePrefix+vmHibernationStateHibernated) {
+			hibernated = true
+		}
+	}
+	if found && hibernated && strings.EqualFold(powerState, vmPowerStateDeallocated) {
+		return vmPowerStateHibernated, true
+	}
+	return powerState, found
 }
 
 // InstanceShutdown returns true if the instance is shutdown according to the cloud provider.
@@ -308,12 +416,16 @@ func (az *Cloud) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, err
 	if err != nil {
 		return false, err
 	}
-	if unmanaged {
+	if unmanaged || isNonVMNode(node) {
 		klog.V(4).Infof("InstanceShutdown: omitting unmanaged node %q", node.Name)
 		return false, nil
 	}
 	providerID := node.Spec.ProviderID
 	if providerID == "" {
+		if az.degradedMode.isDegraded() {
+			return false, nil
+		}
+
 		var err error
 		providerID, err = cloudprovider.GetInstanceProviderID(ctx, az, types.NodeName(node.Name))
 		if err != nil {
@@ -361,6 +473,17 @@ func (az *Cloud) InstanceID(ctx context.Context, name types.NodeName) (string, e
 		return "", err
 	}
 	if unmanaged {
+		// InstanceID is served by the instance provider for the nodes which are not Azure VMs.
+		if node := az.getNonVMNode(nodeName); node != nil {
+			provider, err := az.getNodeInstanceProvider(node)
+			if err != nil {
+				return "", err
+			}
+			if provider != nil {
+				return provider.InstanceID(ctx, node)
+			}
+		}
+
 		// InstanceID is same with nodeName for unmanaged nodes.
 		klog.V(4).Infof("InstanceID: getting ID %q for unmanaged node %q", name, name)
 		return nodeName, nil
@@ -511,6 +634,15 @@ func (az *Cloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudpro
 	if node == nil {
 		return &meta, nil
 	}
+	// The nodes which are not Azure VMs are served by the instance providers.
+	provider, err := az.getNodeInstanceProvider(node)
+	if err != nil {
+		return &meta, err
+	}
+	if provider != nil {
+		return az.getNonVMInstanceMetadata(ctx, node, provider)
+	}
+
 	unmanaged, err := az.IsNodeUnmanaged(node.Name)
 	if err != nil {
 		return &meta, err
@@ -0,0 +1,106 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+// GetNodeNetworkInterface returns the primary network interface of the specified instance. For the local
+// instance with instance metadata enabled, only the MAC address and the private IPs of the ip configurations
+// are filled since the other properties are not available from the instance metadata service.
+// It returns nil for unmanaged nodes.
+func (az *Cloud) GetNodeNetworkInterface(ctx context.Context, name types.NodeName) (*network.Interface, error) {
+	unmanaged, err := az.IsNodeUnmanaged(string(name))
+	if err != nil {
+		return nil, err
+	}
+	if unmanaged {
+		klog.V(4).Infof("GetNodeNetworkInterface: omitting unmanaged node %q", name)
+		return nil, nil
+	}
+
+	if az.UseInstanceMetadata {
+		metadata, err := az.Metadata.GetMetadata(azcache.CacheReadTypeDefault)
+		if err != nil {
+			return nil, err
+		}
+
+		if metadata.Compute == nil || metadata.Network == nil {
+			return nil, fmt.Errorf("failure of getting instance metadata")
+		}
+
+		isLocalInstance, err := az.isCurrentInstance(name, metadata.Compute.Name)
+		if err != nil {
+			return nil, err
+		}
+		if isLocalInstance {
+			return getLocalInstanceNetworkInterface(metadata.Network.Interface)
+		}
+	}
+
+	if az.VMSet == nil {
+		// vmSet == nil indicates credentials are not provided.
+		return nil, fmt.Errorf("no credentials provided for Azure cloud provider")
+	}
+	nic, err := az.VMSet.GetPrimaryInterface(string(name))
+	if err != nil {
+		return nil, err
+	}
+	return &nic, nil
+}
+
+// getLocalInstanceNetworkInterface converts the primary network interface got from instance metadata.
+func getLocalInstanceNetworkInterface(netInterfaces []NetworkInterface) (*network.Interface, error) {
+	if len(netInterfaces) == 0 {
+		return nil, fmt.Errorf("no interface is found for the instance")
+	}
+
+	netInterface := netInterfaces[0]
+	ipConfigs := make([]network.InterfaceIPConfiguration, 0)
+	appendIPConfigs := func(addresses []IPAddress, version network.IPVersion) {
+		for _, address := range addresses {
+			if address.PrivateIP == "" {
+				continue
+			}
+			ipConfigs = append(ipConfigs, network.InterfaceIPConfiguration{
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+					PrivateIPAddress:        pointer.String(address.PrivateIP),
+					PrivateIPAddressVersion: version,
+				},
+			})
+		}
+	}
+	appendIPConfigs(netInterface.IPV4.IPAddress, network.IPv4)
+	appendIPConfigs(netInterface.IPV6.IPAddress, network.IPv6)
+
+	return &network.Interface{
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			MacAddress:       pointer.String(netInterface.MAC),
+			IPConfigurations: &ipConfigs,
+		},
+	}, nil
+}
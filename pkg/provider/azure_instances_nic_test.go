@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient/mockinterfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+)
+
+func TestGetLocalInstanceNetworkInterface(t *testing.T) {
+	_, err := getLocalInstanceNetworkInterface(nil)
+	assert.Error(t, err)
+
+	nic, err := getLocalInstanceNetworkInterface([]NetworkInterface{
+		{
+			IPV4: NetworkData{IPAddress: []IPAddress{{PrivateIP: "10.0.0.4", PublicIP: "1.2.3.4"}, {PrivateIP: "10.0.0.5"}}},
+			IPV6: NetworkData{IPAddress: []IPAddress{{PrivateIP: "fd00::4"}, {}}},
+			MAC:  "000D3A000000",
+		},
+		{
+			IPV4: NetworkData{IPAddress: []IPAddress{{PrivateIP: "10.1.0.4"}}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "000D3A000000", pointer.StringDeref(nic.MacAddress, ""))
+	assert.Nil(t, nic.EnableAcceleratedNetworking)
+	var privateIPs []string
+	for _, ipConfig := range *nic.IPConfigurations {
+		privateIPs = append(privateIPs, pointer.StringDeref(ipConfig.PrivateIPAddress, ""))
+	}
+	assert.Equal(t, []string{"10.0.0.4", "10.0.0.5", "fd00::4"}, privateIPs)
+	assert.Equal(t, network.IPv6, (*nic.IPConfigurations)[2].PrivateIPAddressVersion)
+}
+
+func TestGetNodeNetworkInterface(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	nicID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic1"
+	mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "vm1", gomock.Any()).Return(buildDefaultTestVirtualMachine(asID, []string{nicID}), nil)
+	expectedNIC := buildDefaultTestInterface(true, nil)
+	expectedNIC.Name = pointer.String("nic1")
+	expectedNIC.EnableAcceleratedNetworking = pointer.Bool(true)
+	mockInterfaceClient := az.InterfacesClient.(*mockinterfaceclient.MockInterface)
+	mockInterfaceClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "nic1", gomock.Any()).Return(expectedNIC, nil)
+
+	nic, err := az.GetNodeNetworkInterface(context.TODO(), "vm1")
+	assert.NoError(t, err)
+	assert.Equal(t, &expectedNIC, nic)
+
+	// Unmanaged nodes are omitted.
+	az.unmanagedNodes.Insert("vm2")
+	nic, err = az.GetNodeNetworkInterface(context.TODO(), "vm2")
+	assert.NoError(t, err)
+	assert.Nil(t, nic)
+}
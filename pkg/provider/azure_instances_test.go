@@ -388,6 +388,73 @@ func TestInstanceShutdownByProviderID(t *testing.T) {
 	}
 }
 
+func TestGetPowerStateFromStatuses(t *testing.T) {
+	testcases := []struct {
+		name          string
+		codes         []string
+		expected      string
+		expectedFound bool
+	}{
+		{
+			name:  "should return false if the power state is not found",
+			codes: []string{"ProvisioningState/succeeded"},
+		},
+		{
+			name:          "should return the power state",
+			codes:         []string{"ProvisioningState/succeeded", "PowerState/stopped"},
+			expected:      "stopped",
+			expectedFound: true,
+		},
+		{
+			name:          "should return hibernated if the deallocated VM is hibernated",
+			codes:         []string{"ProvisioningState/succeeded", "PowerState/deallocated", "HibernationState/Hibernated"},
+			expected:      vmPowerStateHibernated,
+			expectedFound: true,
+		},
+		{
+			name:          "should ignore the hibernation state if the VM is not deallocated",
+			codes:         []string{"HibernationState/Hibernated", "PowerState/starting"},
+			expected:      "starting",
+			expectedFound: true,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			statuses := make([]compute.InstanceViewStatus, 0, len(test.codes))
+			for _, code := range test.codes {
+				statuses = append(statuses, compute.InstanceViewStatus{Code: pointer.String(code)})
+			}
+			powerState, found := getPowerStateFromStatuses(statuses)
+			assert.Equal(t, test.expected, powerState)
+			assert.Equal(t, test.expectedFound, found)
+		})
+	}
+}
+
+func TestIsShutdownPowerState(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cloud := GetTestCloud(ctrl)
+
+	for _, powerState := range []string{"Stopped", "deallocated", "deallocating", "hibernated"} {
+		assert.True(t, cloud.isShutdownPowerState(powerState), powerState)
+	}
+	for _, powerState := range []string{"running", "starting", "stopping", "unknown"} {
+		assert.False(t, cloud.isShutdownPowerState(powerState), powerState)
+	}
+
+	cloud.NodeShutdownPowerStates = &NodeShutdownPowerStates{
+		Stopped:     consts.NodeShutdownBehaviorTaint,
+		Deallocated: "ignore",
+		Hibernated:  consts.NodeShutdownBehaviorIgnore,
+	}
+	assert.True(t, cloud.isShutdownPowerState("stopped"))
+	for _, powerState := range []string{"deallocated", "deallocating", "hibernated"} {
+		assert.False(t, cloud.isShutdownPowerState(powerState), powerState)
+	}
+}
+
 func TestNodeAddresses(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,146 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+// GetNodeVirtualMachine returns the OS properties and the instance view of the specified instance. For the local
+// instance with instance metadata enabled, only the image, license type and OS disk settings are filled since the
+// instance view is not available from the instance metadata service. It returns nil for unmanaged nodes and the
+// VMSS Flex VMs.
+func (az *Cloud) GetNodeVirtualMachine(ctx context.Context, name types.NodeName) (*compute.VirtualMachine, error) {
+	unmanaged, err := az.IsNodeUnmanaged(string(name))
+	if err != nil {
+		return nil, err
+	}
+	if unmanaged {
+		klog.V(4).Infof("GetNodeVirtualMachine: omitting unmanaged node %q", name)
+		return nil, nil
+	}
+
+	if az.UseInstanceMetadata {
+		metadata, err := az.Metadata.GetMetadata(azcache.CacheReadTypeDefault)
+		if err != nil {
+			return nil, err
+		}
+
+		if metadata.Compute == nil {
+			return nil, fmt.Errorf("failure of getting instance metadata")
+		}
+
+		isLocalInstance, err := az.isCurrentInstance(name, metadata.Compute.Name)
+		if err != nil {
+			return nil, err
+		}
+		if isLocalInstance {
+			return getLocalInstanceVirtualMachine(metadata.Compute), nil
+		}
+	}
+
+	if az.VMSet == nil {
+		// vmSet == nil indicates credentials are not provided.
+		return nil, fmt.Errorf("no credentials provided for Azure cloud provider")
+	}
+
+	if ss, ok := az.VMSet.(*ScaleSet); ok {
+		vmManagementType, err := ss.getVMManagementTypeByNodeName(string(name), azcache.CacheReadTypeUnsafe)
+		if err != nil {
+			return nil, err
+		}
+		if vmManagementType == ManagedByVmssUniform {
+			vm, err := ss.getVmssVM(string(name), azcache.CacheReadTypeDefault)
+			if err != nil {
+				return nil, err
+			}
+			return getScaleSetVMVirtualMachine(vm.VirtualMachineScaleSetVMProperties), nil
+		}
+		if vmManagementType != ManagedByAvSet {
+			return nil, nil
+		}
+	} else if _, ok := az.VMSet.(*FlexScaleSet); ok {
+		return nil, nil
+	}
+
+	vm, err := az.getVirtualMachine(name, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+	return &vm, nil
+}
+
+// getLocalInstanceVirtualMachine converts the compute metadata got from instance metadata.
+func getLocalInstanceVirtualMachine(metadata *ComputeMetadata) *compute.VirtualMachine {
+	storageProfile := &compute.StorageProfile{
+		ImageReference: &compute.ImageReference{
+			Publisher: pointer.String(metadata.Publisher),
+			Offer:     pointer.String(metadata.Offer),
+			Sku:       pointer.String(metadata.SKU),
+		},
+		OsDisk: &compute.OSDisk{
+			OsType: compute.OperatingSystemTypes(metadata.OSType),
+		},
+	}
+	if metadata.StorageProfile != nil && metadata.StorageProfile.OSDisk != nil &&
+		metadata.StorageProfile.OSDisk.DiffDiskSettings != nil && metadata.StorageProfile.OSDisk.DiffDiskSettings.Option != "" {
+		storageProfile.OsDisk.DiffDiskSettings = &compute.DiffDiskSettings{
+			Option: compute.DiffDiskOptions(metadata.StorageProfile.OSDisk.DiffDiskSettings.Option),
+		}
+	}
+
+	vm := &compute.VirtualMachine{
+		Name: pointer.String(metadata.Name),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			StorageProfile: storageProfile,
+		},
+	}
+	if metadata.LicenseType != "" {
+		vm.LicenseType = pointer.String(metadata.LicenseType)
+	}
+	return vm
+}
+
+// getScaleSetVMVirtualMachine converts the properties of the VMSS VM shared with the standalone VMs.
+func getScaleSetVMVirtualMachine(properties *compute.VirtualMachineScaleSetVMProperties) *compute.VirtualMachine {
+	vm := &compute.VirtualMachine{
+		VirtualMachineProperties: &compute.VirtualMachineProperties{},
+	}
+	if properties == nil {
+		return vm
+	}
+
+	vm.LicenseType = properties.LicenseType
+	vm.StorageProfile = properties.StorageProfile
+	vm.ProvisioningState = properties.ProvisioningState
+	if properties.InstanceView != nil {
+		vm.InstanceView = &compute.VirtualMachineInstanceView{
+			Statuses:   properties.InstanceView.Statuses,
+			Extensions: properties.InstanceView.Extensions,
+		}
+	}
+	return vm
+}
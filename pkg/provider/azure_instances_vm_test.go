@@ -0,0 +1,94 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+)
+
+func TestGetLocalInstanceVirtualMachine(t *testing.T) {
+	vm := getLocalInstanceVirtualMachine(&ComputeMetadata{
+		Name:        "vm1",
+		OSType:      "Windows",
+		Publisher:   "MicrosoftWindowsServer",
+		Offer:       "WindowsServer",
+		SKU:         "2022-datacenter-core-smalldisk",
+		LicenseType: "Windows_Server",
+		StorageProfile: &StorageProfileMetadata{
+			OSDisk: &OSDiskMetadata{DiffDiskSettings: &DiffDiskSettingsMetadata{Option: "Local"}},
+		},
+	})
+	assert.Equal(t, "vm1", pointer.StringDeref(vm.Name, ""))
+	assert.Equal(t, "Windows_Server", pointer.StringDeref(vm.LicenseType, ""))
+	assert.Equal(t, "2022-datacenter-core-smalldisk", pointer.StringDeref(vm.StorageProfile.ImageReference.Sku, ""))
+	assert.Equal(t, compute.OperatingSystemTypesWindows, vm.StorageProfile.OsDisk.OsType)
+	assert.Equal(t, compute.Local, vm.StorageProfile.OsDisk.DiffDiskSettings.Option)
+	assert.Nil(t, vm.InstanceView)
+
+	vm = getLocalInstanceVirtualMachine(&ComputeMetadata{Name: "vm2", OSType: "Linux"})
+	assert.Nil(t, vm.LicenseType)
+	assert.Nil(t, vm.StorageProfile.OsDisk.DiffDiskSettings)
+}
+
+func TestGetScaleSetVMVirtualMachine(t *testing.T) {
+	assert.NotNil(t, getScaleSetVMVirtualMachine(nil).VirtualMachineProperties)
+
+	statuses := &[]compute.InstanceViewStatus{{Code: pointer.String("ProvisioningState/failed/VMExtensionProvisioningError")}}
+	extensions := &[]compute.VirtualMachineExtensionInstanceView{{Name: pointer.String("vmssCSE")}}
+	vm := getScaleSetVMVirtualMachine(&compute.VirtualMachineScaleSetVMProperties{
+		LicenseType:       pointer.String("Windows_Server"),
+		ProvisioningState: pointer.String("Failed"),
+		InstanceView: &compute.VirtualMachineScaleSetVMInstanceView{
+			Statuses:   statuses,
+			Extensions: extensions,
+		},
+	})
+	assert.Equal(t, "Windows_Server", pointer.StringDeref(vm.LicenseType, ""))
+	assert.Equal(t, "Failed", pointer.StringDeref(vm.ProvisioningState, ""))
+	assert.Equal(t, statuses, vm.InstanceView.Statuses)
+	assert.Equal(t, extensions, vm.InstanceView.Extensions)
+}
+
+func TestGetNodeVirtualMachine(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	expectedVM := buildDefaultTestVirtualMachine(asID, nil)
+	expectedVM.Name = pointer.String("vm1")
+	mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "vm1", gomock.Any()).Return(expectedVM, nil)
+
+	vm, err := az.GetNodeVirtualMachine(context.TODO(), "vm1")
+	assert.NoError(t, err)
+	assert.Equal(t, &expectedVM, vm)
+
+	// Unmanaged nodes are omitted.
+	az.unmanagedNodes.Insert("vm2")
+	vm, err = az.GetNodeVirtualMachine(context.TODO(), "vm2")
+	assert.NoError(t, err)
+	assert.Nil(t, vm)
+}
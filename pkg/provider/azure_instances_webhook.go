@@ -0,0 +1,333 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// instancesWebhookMethodPrefix is the gRPC service of the instances webhook. The methods are named after the
+// Instances and InstancesV2 methods, e.g. "/cloudprovider.azure.instances.v1.Instances/InstanceMetadata", and both
+// the requests and the responses are google.protobuf.Struct messages, so that the endpoint can be implemented
+// without generated stubs.
+const instancesWebhookMethodPrefix = "/cloudprovider.azure.instances.v1.Instances/"
+
+// instancesWebhookRequest is the request of the instances webhook. Only the fields known to the call are set.
+type instancesWebhookRequest struct {
+	NodeName   string            `json:"nodeName,omitempty"`
+	ProviderID string            `json:"providerID,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// instancesWebhookResponse is the response of the instances webhook. The call is served by Azure if Handled is
+// false, otherwise the fields of the call are returned, e.g. Exists for InstanceExists.
+type instancesWebhookResponse struct {
+	Handled       bool             `json:"handled,omitempty"`
+	Exists        bool             `json:"exists,omitempty"`
+	Shutdown      bool             `json:"shutdown,omitempty"`
+	ProviderID    string           `json:"providerID,omitempty"`
+	InstanceID    string           `json:"instanceID,omitempty"`
+	InstanceType  string           `json:"instanceType,omitempty"`
+	Zone          string           `json:"zone,omitempty"`
+	Region        string           `json:"region,omitempty"`
+	NodeAddresses []v1.NodeAddress `json:"nodeAddresses,omitempty"`
+}
+
+var (
+	_ cloudprovider.Instances   = (*instancesWebhook)(nil)
+	_ cloudprovider.InstancesV2 = (*instancesWebhook)(nil)
+)
+
+// instancesWebhook delegates the Instances and InstancesV2 calls to the external gRPC endpoint.
+// The calls not handled by the endpoint are served by the embedded Azure implementation.
+type instancesWebhook struct {
+	*Cloud
+
+	conn    *grpc.ClientConn
+	timeout time.Duration
+}
+
+// initInstancesWebhook connects to the instances webhook if it is configured. The connection is established lazily
+// by the first call. The previous connection is closed when the config is reloaded.
+func (az *Cloud) initInstancesWebhook(config *InstancesWebhookConfig) error {
+	if az.instancesWebhook != nil {
+		if err := az.instancesWebhook.conn.Close(); err != nil {
+			klog.Warningf("initInstancesWebhook: failed to close the previous connection: %v", err)
+		}
+		az.instancesWebhook = nil
+	}
+	if config == nil {
+		return nil
+	}
+	if config.Endpoint == "" {
+		return errors.New("instancesWebhook: endpoint must not be empty")
+	}
+
+	var creds credentials.TransportCredentials
+	switch {
+	case config.Insecure:
+		creds = insecure.NewCredentials()
+	case config.CAFile != "":
+		var err error
+		creds, err = credentials.NewClientTLSFromFile(config.CAFile, "")
+		if err != nil {
+			return fmt.Errorf("instancesWebhook: failed to load the CA file: %w", err)
+		}
+	default:
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.Dial(config.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("instancesWebhook: failed to connect to %s: %w", config.Endpoint, err)
+	}
+
+	timeout := consts.DefaultInstancesWebhookTimeoutInSeconds
+	if config.TimeoutInSeconds > 0 {
+		timeout = config.TimeoutInSeconds
+	}
+	az.instancesWebhook = &instancesWebhook{
+		Cloud:   az,
+		conn:    conn,
+		timeout: time.Duration(timeout) * time.Second,
+	}
+	klog.Infof("initInstancesWebhook: delegating the instances calls to %s", config.Endpoint)
+	return nil
+}
+
+// call invokes the method of the webhook. It returns nil if the webhook does not handle the call.
+func (w *instancesWebhook) call(ctx context.Context, method string, request *instancesWebhookRequest) (*instancesWebhookResponse, error) {
+	in, err := toStruct(request)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	out := &structpb.Struct{}
+	if err := w.conn.Invoke(ctx, instancesWebhookMethodPrefix+method, in, out); err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			klog.V(4).Infof("instancesWebhook: %s is not implemented, falling back to Azure", method)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("instancesWebhook: %s failed: %w", method, err)
+	}
+
+	response := &instancesWebhookResponse{}
+	if err := fromStruct(out, response); err != nil {
+		return nil, fmt.Errorf("instancesWebhook: invalid %s response: %w", method, err)
+	}
+	if !response.Handled {
+		return nil, nil
+	}
+	return response, nil
+}
+
+// toStruct converts the JSON object to a protobuf Struct.
+func toStruct(obj interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(m)
+}
+
+// fromStruct converts the protobuf Struct to the JSON object.
+func fromStruct(s *structpb.Struct, obj interface{}) error {
+	data, err := json.Marshal(s.AsMap())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, obj)
+}
+
+// nodeWebhookRequest returns the webhook request of the node.
+func nodeWebhookRequest(node *v1.Node) *instancesWebhookRequest {
+	return &instancesWebhookRequest{
+		NodeName:   node.Name,
+		ProviderID: node.Spec.ProviderID,
+		Labels:     node.Labels,
+	}
+}
+
+// InstanceExists returns true if the instance for the given node exists according to the webhook or Azure.
+func (w *instancesWebhook) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
+	if node == nil {
+		return w.Cloud.InstanceExists(ctx, node)
+	}
+	response, err := w.call(ctx, "InstanceExists", nodeWebhookRequest(node))
+	if err != nil {
+		return false, err
+	}
+	if response == nil {
+		return w.Cloud.InstanceExists(ctx, node)
+	}
+	return response.Exists, nil
+}
+
+// InstanceShutdown returns true if the instance for the given node is shutdown according to the webhook or Azure.
+func (w *instancesWebhook) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
+	if node == nil {
+		return w.Cloud.InstanceShutdown(ctx, node)
+	}
+	response, err := w.call(ctx, "InstanceShutdown", nodeWebhookRequest(node))
+	if err != nil {
+		return false, err
+	}
+	if response == nil {
+		return w.Cloud.InstanceShutdown(ctx, node)
+	}
+	return response.Shutdown, nil
+}
+
+// InstanceMetadata returns the instance's metadata from the webhook or Azure. The provider ID of the node is kept
+// if the webhook does not return one.
+func (w *instancesWebhook) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
+	if node == nil {
+		return w.Cloud.InstanceMetadata(ctx, node)
+	}
+	response, err := w.call(ctx, "InstanceMetadata", nodeWebhookRequest(node))
+	if err != nil {
+		return &cloudprovider.InstanceMetadata{}, err
+	}
+	if response == nil {
+		return w.Cloud.InstanceMetadata(ctx, node)
+	}
+
+	providerID := response.ProviderID
+	if providerID == "" {
+		providerID = node.Spec.ProviderID
+	}
+	return &cloudprovider.InstanceMetadata{
+		ProviderID:    providerID,
+		InstanceType:  response.InstanceType,
+		NodeAddresses: response.NodeAddresses,
+		Zone:          response.Zone,
+		Region:        response.Region,
+	}, nil
+}
+
+// NodeAddresses returns the addresses of the specified instance from the webhook or Azure.
+func (w *instancesWebhook) NodeAddresses(ctx context.Context, name types.NodeName) ([]v1.NodeAddress, error) {
+	response, err := w.call(ctx, "NodeAddresses", &instancesWebhookRequest{NodeName: string(name)})
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return w.Cloud.NodeAddresses(ctx, name)
+	}
+	return response.NodeAddresses, nil
+}
+
+// NodeAddressesByProviderID returns the addresses of the specified instance from the webhook or Azure.
+func (w *instancesWebhook) NodeAddressesByProviderID(ctx context.Context, providerID string) ([]v1.NodeAddress, error) {
+	response, err := w.call(ctx, "NodeAddressesByProviderID", &instancesWebhookRequest{ProviderID: providerID})
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return w.Cloud.NodeAddressesByProviderID(ctx, providerID)
+	}
+	return response.NodeAddresses, nil
+}
+
+// InstanceID returns the cloud provider ID of the specified instance from the webhook or Azure.
+func (w *instancesWebhook) InstanceID(ctx context.Context, name types.NodeName) (string, error) {
+	response, err := w.call(ctx, "InstanceID", &instancesWebhookRequest{NodeName: string(name)})
+	if err != nil {
+		return "", err
+	}
+	if response == nil {
+		return w.Cloud.InstanceID(ctx, name)
+	}
+	if response.InstanceID == "" {
+		return "", cloudprovider.InstanceNotFound
+	}
+	return response.InstanceID, nil
+}
+
+// InstanceType returns the type of the specified instance from the webhook or Azure.
+func (w *instancesWebhook) InstanceType(ctx context.Context, name types.NodeName) (string, error) {
+	response, err := w.call(ctx, "InstanceType", &instancesWebhookRequest{NodeName: string(name)})
+	if err != nil {
+		return "", err
+	}
+	if response == nil {
+		return w.Cloud.InstanceType(ctx, name)
+	}
+	return response.InstanceType, nil
+}
+
+// InstanceTypeByProviderID returns the type of the specified instance from the webhook or Azure.
+func (w *instancesWebhook) InstanceTypeByProviderID(ctx context.Context, providerID string) (string, error) {
+	response, err := w.call(ctx, "InstanceTypeByProviderID", &instancesWebhookRequest{ProviderID: providerID})
+	if err != nil {
+		return "", err
+	}
+	if response == nil {
+		return w.Cloud.InstanceTypeByProviderID(ctx, providerID)
+	}
+	return response.InstanceType, nil
+}
+
+// InstanceExistsByProviderID returns true if the instance with the given provider id exists according to
+// the webhook or Azure.
+func (w *instancesWebhook) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	response, err := w.call(ctx, "InstanceExistsByProviderID", &instancesWebhookRequest{ProviderID: providerID})
+	if err != nil {
+		return false, err
+	}
+	if response == nil {
+		return w.Cloud.InstanceExistsByProviderID(ctx, providerID)
+	}
+	return response.Exists, nil
+}
+
+// InstanceShutdownByProviderID returns true if the instance with the given provider id is shutdown according to
+// the webhook or Azure.
+func (w *instancesWebhook) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	response, err := w.call(ctx, "InstanceShutdownByProviderID", &instancesWebhookRequest{ProviderID: providerID})
+	if err != nil {
+		return false, err
+	}
+	if response == nil {
+		return w.Cloud.InstanceShutdownByProviderID(ctx, providerID)
+	}
+	return response.Shutdown, nil
+}
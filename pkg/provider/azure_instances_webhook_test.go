@@ -0,0 +1,148 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// startTestInstancesWebhook serves the instances webhook methods with the given handlers.
+// The other methods return Unimplemented.
+func startTestInstancesWebhook(t *testing.T, handlers map[string]func(*structpb.Struct) (*structpb.Struct, error)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	server := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		in := &structpb.Struct{}
+		if err := stream.RecvMsg(in); err != nil {
+			return err
+		}
+		handler, found := handlers[method]
+		if !found {
+			return status.Error(codes.Unimplemented, method)
+		}
+		out, err := handler(in)
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(out)
+	}))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func TestInstancesWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	endpoint := startTestInstancesWebhook(t, map[string]func(*structpb.Struct) (*structpb.Struct, error){
+		instancesWebhookMethodPrefix + "InstanceMetadata": func(in *structpb.Struct) (*structpb.Struct, error) {
+			request := in.AsMap()
+			if request["nodeName"] != "hybrid-node" {
+				return structpb.NewStruct(map[string]interface{}{"handled": false})
+			}
+			assert.Equal(t, map[string]interface{}{"pool": "onprem"}, request["labels"])
+			return structpb.NewStruct(map[string]interface{}{
+				"handled":      true,
+				"providerID":   "custom://hybrid-node",
+				"instanceType": "bare-metal",
+				"zone":         "rack-1",
+				"nodeAddresses": []interface{}{
+					map[string]interface{}{"type": "InternalIP", "address": "192.168.0.4"},
+				},
+			})
+		},
+		instancesWebhookMethodPrefix + "InstanceExistsByProviderID": func(in *structpb.Struct) (*structpb.Struct, error) {
+			return structpb.NewStruct(map[string]interface{}{"handled": true, "exists": true})
+		},
+		instancesWebhookMethodPrefix + "InstanceShutdown": func(in *structpb.Struct) (*structpb.Struct, error) {
+			return nil, status.Error(codes.Unavailable, "unavailable")
+		},
+	})
+	assert.NoError(t, az.initInstancesWebhook(&InstancesWebhookConfig{Endpoint: endpoint, Insecure: true}))
+	defer func() {
+		assert.NoError(t, az.initInstancesWebhook(nil))
+	}()
+
+	instances, ok := az.InstancesV2()
+	assert.True(t, ok)
+	assert.Equal(t, az.instancesWebhook, instances)
+
+	// Handled by the webhook.
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "hybrid-node", Labels: map[string]string{"pool": "onprem"}}}
+	meta, err := instances.InstanceMetadata(context.TODO(), node)
+	assert.NoError(t, err)
+	assert.Equal(t, &cloudprovider.InstanceMetadata{
+		ProviderID:    "custom://hybrid-node",
+		InstanceType:  "bare-metal",
+		Zone:          "rack-1",
+		NodeAddresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.4"}},
+	}, meta)
+
+	exists, err := az.instancesWebhook.InstanceExistsByProviderID(context.TODO(), "custom://hybrid-node")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// Not handled by the webhook: served by Azure, which assumes the unmanaged nodes exist.
+	az.unmanagedNodes.Insert("unmanaged-node")
+	exists, err = instances.InstanceExists(context.TODO(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged-node"}})
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// The errors of the webhook are returned.
+	_, err = instances.InstanceShutdown(context.TODO(), node)
+	assert.Equal(t, codes.Unavailable, status.Code(errors.Unwrap(err)))
+}
+
+func TestInitInstancesWebhook(t *testing.T) {
+	az := &Cloud{}
+	assert.NoError(t, az.initInstancesWebhook(nil))
+	assert.Nil(t, az.instancesWebhook)
+
+	assert.Error(t, az.initInstancesWebhook(&InstancesWebhookConfig{}))
+	assert.Error(t, az.initInstancesWebhook(&InstancesWebhookConfig{Endpoint: "localhost:443", CAFile: "/not/exist"}))
+
+	assert.NoError(t, az.initInstancesWebhook(&InstancesWebhookConfig{Endpoint: "localhost:443", TimeoutInSeconds: 1}))
+	assert.Equal(t, int64(1), int64(az.instancesWebhook.timeout.Seconds()))
+	instances, _ := az.Instances()
+	assert.Equal(t, az.instancesWebhook, instances)
+
+	assert.NoError(t, az.initInstancesWebhook(nil))
+	instances, _ = az.Instances()
+	assert.Equal(t, az, instances)
+}
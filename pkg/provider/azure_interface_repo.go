@@ -26,6 +26,7 @@ import (
 func (az *Cloud) CreateOrUpdateInterface(service *v1.Service, nic network.Interface) error {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 
 	rerr := az.InterfacesClient.CreateOrUpdate(ctx, az.ResourceGroup, *nic.Name, nic)
 	klog.V(10).Infof("InterfacesClient.CreateOrUpdate(%s): end", *nic.Name)
@@ -0,0 +1,321 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// validateIPv6OutboundConfig returns an error if the IPv6 outbound rules are enabled on basic load balancers,
+// or the outbound rule properties are out of range.
+func validateIPv6OutboundConfig(config *IPv6OutboundConfig, loadBalancerSku string, disableOutboundSNAT *bool) error {
+	if config == nil || !config.Enabled {
+		return nil
+	}
+	if loadBalancerSku != "" && !strings.EqualFold(loadBalancerSku, consts.LoadBalancerSkuStandard) {
+		return fmt.Errorf("ipv6OutboundConfig is only supported by the standard load balancer")
+	}
+	// The load balancing rules must disable the outbound SNAT if the backend pool is referenced by an outbound rule.
+	if !pointer.BoolDeref(disableOutboundSNAT, false) {
+		return fmt.Errorf("ipv6OutboundConfig requires disableOutboundSNAT to be true")
+	}
+	if config.AllocatedOutboundPorts < 0 || config.AllocatedOutboundPorts > 64000 || config.AllocatedOutboundPorts%8 != 0 {
+		return fmt.Errorf("allocatedOutboundPorts %d of ipv6OutboundConfig must be a multiple of 8 between 0 and 64000", config.AllocatedOutboundPorts)
+	}
+	if config.IdleTimeoutInMinutes == 0 {
+		config.IdleTimeoutInMinutes = consts.DefaultIPv6OutboundIdleTimeoutInMinutes
+	} else if config.IdleTimeoutInMinutes < 4 || config.IdleTimeoutInMinutes > 120 {
+		return fmt.Errorf("idleTimeoutInMinutes %d of ipv6OutboundConfig must be between 4 and 120", config.IdleTimeoutInMinutes)
+	}
+	return nil
+}
+
+// getIPv6OutboundName returns the name of the public IP, the frontend IP configuration and the outbound rule
+// for the IPv6 outbound connectivity of the load balancer.
+func getIPv6OutboundName(lbName string) string {
+	return lbName + consts.IPv6OutboundNameSuffix
+}
+
+// isIPv6OutboundEnabled returns true if the IPv6 outbound rules are managed.
+func (az *Cloud) isIPv6OutboundEnabled() bool {
+	return az.ipv6DualStackEnabled && az.useStandardLoadBalancer() && !az.useNATGatewayOutbound() &&
+		az.IPv6OutboundConfig != nil && az.IPv6OutboundConfig.Enabled
+}
+
+// reconcileIPv6OutboundRule ensures the IPv6 outbound rule and its frontend IP configuration on the external load
+// balancer if the IPv6 outbound rules are enabled and the load balancer has the IPv6 backend pool and the frontend IP
+// configurations of the services. Otherwise, they are removed, and the name of the public IP to be deleted after
+// updating the load balancer is returned. It returns true if the load balancer is changed.
+func (az *Cloud) reconcileIPv6OutboundRule(clusterName string, lb *network.LoadBalancer) (bool, string, error) {
+	if lb == nil || lb.LoadBalancerPropertiesFormat == nil || isInternalLoadBalancer(lb) {
+		return false, "", nil
+	}
+	lbName := pointer.StringDeref(lb.Name, "")
+	name := getIPv6OutboundName(lbName)
+	backendPoolID := az.getBackendPoolID(lbName, getBackendPoolName(clusterName, consts.IPVersionIPv6))
+
+	if !az.isIPv6OutboundEnabled() || !hasBackendPool(lb, backendPoolID) || !hasServiceFrontendIPConfigs(lb) {
+		if removeOutboundRule(lb, name) {
+			klog.V(2).Infof("reconcileIPv6OutboundRule: removing the IPv6 outbound rule %s from the load balancer %s", name, lbName)
+			return true, name, nil
+		}
+		return false, "", nil
+	}
+
+	pip, err := az.ensureIPv6OutboundPublicIP(clusterName, name)
+	if err != nil {
+		return false, "", err
+	}
+
+	fipConfigID := az.getFrontendIPConfigID(lbName, name)
+	expectedFIPConfig := network.FrontendIPConfiguration{
+		Name: pointer.String(name),
+		ID:   pointer.String(fipConfigID),
+		FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+			PublicIPAddress: &network.PublicIPAddress{ID: pip.ID},
+		},
+	}
+	expectedRule := network.OutboundRule{
+		Name: pointer.String(name),
+		OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+			Protocol:                 network.LoadBalancerOutboundRuleProtocolAll,
+			AllocatedOutboundPorts:   pointer.Int32(az.IPv6OutboundConfig.AllocatedOutboundPorts),
+			IdleTimeoutInMinutes:     pointer.Int32(az.IPv6OutboundConfig.IdleTimeoutInMinutes),
+			EnableTCPReset:           pointer.Bool(!az.IPv6OutboundConfig.DisableTCPReset),
+			FrontendIPConfigurations: &[]network.SubResource{{ID: pointer.String(fipConfigID)}},
+			BackendAddressPool:       &network.SubResource{ID: pointer.String(backendPoolID)},
+		},
+	}
+	changed := ensureOutboundRule(lb, expectedFIPConfig, expectedRule)
+	if changed {
+		klog.V(2).Infof("reconcileIPv6OutboundRule: updating the IPv6 outbound rule %s of the load balancer %s", name, lbName)
+	}
+	return changed, "", nil
+}
+
+// ensureIPv6OutboundPublicIP creates the public IPv6 address of the IPv6 outbound rule if it does not exist.
+func (az *Cloud) ensureIPv6OutboundPublicIP(clusterName, pipName string) (*network.PublicIPAddress, error) {
+	pipResourceGroup := az.ResourceGroup
+	pip, existsPip, err := az.getPublicIPAddress(pipResourceGroup, pipName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+	if existsPip {
+		return &pip, nil
+	}
+
+	pip = network.PublicIPAddress{
+		Name:     pointer.String(pipName),
+		Location: pointer.String(az.Location),
+		Sku: &network.PublicIPAddressSku{
+			Name: network.PublicIPAddressSkuNameStandard,
+		},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			PublicIPAllocationMethod: network.Static,
+			PublicIPAddressVersion:   network.IPv6,
+		},
+		Tags: az.getConfigTags(consts.TagTemplateResourcePublicIPAddress, tagTemplateValues{clusterName: clusterName}),
+	}
+	pip.Tags[consts.ClusterNameKey] = pointer.String(clusterName)
+	if az.HasExtendedLocation() {
+		pip.ExtendedLocation = &network.ExtendedLocation{
+			Name: &az.ExtendedLocationName,
+			Type: getExtendedLocationTypeFromString(az.ExtendedLocationType),
+		}
+	} else {
+		zones, err := az.getRegionZonesBackoff(az.Location)
+		if err != nil {
+			return nil, err
+		}
+		if len(zones) > 0 {
+			pip.Zones = &zones
+		}
+	}
+
+	klog.V(2).Infof("ensureIPv6OutboundPublicIP: creating the public IP %s/%s", pipResourceGroup, pipName)
+	if err := az.CreateOrUpdatePIP(nil, pipResourceGroup, pip); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	pip, rerr := az.PublicIPAddressesClient.Get(ctx, pipResourceGroup, pipName, "")
+	if rerr != nil {
+		return nil, rerr.Error()
+	}
+	return &pip, nil
+}
+
+// ensureOutboundRule adds or updates the outbound rule and its frontend IP configuration on the load balancer.
+// It returns true if the load balancer is changed.
+func ensureOutboundRule(lb *network.LoadBalancer, expectedFIPConfig network.FrontendIPConfiguration, expectedRule network.OutboundRule) bool {
+	changed := ensureOutboundFrontendIPConfig(lb, expectedFIPConfig)
+
+	var rules []network.OutboundRule
+	if lb.OutboundRules != nil {
+		rules = *lb.OutboundRules
+	}
+	i := findOutboundRuleByName(rules, pointer.StringDeref(expectedRule.Name, ""))
+	switch {
+	case i < 0:
+		rules = append(rules, expectedRule)
+		changed = true
+	case !equalOutboundRule(rules[i], expectedRule):
+		rules[i] = expectedRule
+		changed = true
+	}
+	lb.OutboundRules = &rules
+	return changed
+}
+
+// ensureOutboundFrontendIPConfig adds or updates the frontend IP configuration of an outbound rule on the load
+// balancer. It returns true if the load balancer is changed.
+func ensureOutboundFrontendIPConfig(lb *network.LoadBalancer, expectedFIPConfig network.FrontendIPConfiguration) bool {
+	var changed bool
+	var fipConfigs []network.FrontendIPConfiguration
+	if lb.FrontendIPConfigurations != nil {
+		fipConfigs = *lb.FrontendIPConfigurations
+	}
+	i := findFrontendIPConfigByName(fipConfigs, pointer.StringDeref(expectedFIPConfig.Name, ""))
+	switch {
+	case i < 0:
+		fipConfigs = append(fipConfigs, expectedFIPConfig)
+		changed = true
+	case !equalOutboundFrontendIPConfig(fipConfigs[i], expectedFIPConfig):
+		fipConfigs[i] = expectedFIPConfig
+		changed = true
+	}
+	lb.FrontendIPConfigurations = &fipConfigs
+	return changed
+}
+
+// removeOutboundRule removes the outbound rule and its frontend IP configuration from the load balancer.
+// It returns true if the load balancer is changed.
+func removeOutboundRule(lb *network.LoadBalancer, name string) bool {
+	var changed bool
+	if lb.OutboundRules != nil {
+		rules := *lb.OutboundRules
+		if i := findOutboundRuleByName(rules, name); i >= 0 {
+			rules = append(rules[:i], rules[i+1:]...)
+			lb.OutboundRules = &rules
+			changed = true
+		}
+	}
+	if lb.FrontendIPConfigurations != nil {
+		fipConfigs := *lb.FrontendIPConfigurations
+		if i := findFrontendIPConfigByName(fipConfigs, name); i >= 0 {
+			fipConfigs = append(fipConfigs[:i], fipConfigs[i+1:]...)
+			lb.FrontendIPConfigurations = &fipConfigs
+			changed = true
+		}
+	}
+	return changed
+}
+
+// hasBackendPool returns true if the load balancer has the backend pool.
+func hasBackendPool(lb *network.LoadBalancer, backendPoolID string) bool {
+	if lb.BackendAddressPools == nil {
+		return false
+	}
+	for _, bp := range *lb.BackendAddressPools {
+		if strings.EqualFold(pointer.StringDeref(bp.ID, ""), backendPoolID) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasServiceFrontendIPConfigs returns true if the load balancer has the frontend IP configurations other than the
+// ones of the outbound rules managed by the cloud provider.
+func hasServiceFrontendIPConfigs(lb *network.LoadBalancer) bool {
+	if lb.FrontendIPConfigurations == nil {
+		return false
+	}
+	for _, fipConfig := range *lb.FrontendIPConfigurations {
+		if !isManagedOutboundResourceName(pointer.StringDeref(lb.Name, ""), pointer.StringDeref(fipConfig.Name, "")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isManagedOutboundResourceName returns true if the name is of an outbound rule managed by the cloud provider,
+// or its frontend IP configuration.
+func isManagedOutboundResourceName(lbName, name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), strings.ToLower(lbName+consts.OutboundNameInfix))
+}
+
+func findFrontendIPConfigByName(fipConfigs []network.FrontendIPConfiguration, name string) int {
+	for i := range fipConfigs {
+		if strings.EqualFold(pointer.StringDeref(fipConfigs[i].Name, ""), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func findOutboundRuleByName(rules []network.OutboundRule, name string) int {
+	for i := range rules {
+		if strings.EqualFold(pointer.StringDeref(rules[i].Name, ""), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// equalOutboundRule returns true if the existing outbound rule has the expected properties.
+func equalOutboundRule(existing, expected network.OutboundRule) bool {
+	s, t := existing.OutboundRulePropertiesFormat, expected.OutboundRulePropertiesFormat
+	if s == nil || s.FrontendIPConfigurations == nil || len(*s.FrontendIPConfigurations) != len(*t.FrontendIPConfigurations) {
+		return false
+	}
+	for i := range *t.FrontendIPConfigurations {
+		if !equalSubResource(&(*s.FrontendIPConfigurations)[i], &(*t.FrontendIPConfigurations)[i]) {
+			return false
+		}
+	}
+	return strings.EqualFold(string(s.Protocol), string(t.Protocol)) &&
+		pointer.Int32Deref(s.AllocatedOutboundPorts, 0) == pointer.Int32Deref(t.AllocatedOutboundPorts, 0) &&
+		pointer.Int32Deref(s.IdleTimeoutInMinutes, 0) == pointer.Int32Deref(t.IdleTimeoutInMinutes, 0) &&
+		pointer.BoolDeref(s.EnableTCPReset, false) == pointer.BoolDeref(t.EnableTCPReset, false) &&
+		equalSubResource(s.BackendAddressPool, t.BackendAddressPool)
+}
+
+// equalOutboundFrontendIPConfig returns true if the existing frontend IP configuration of the outbound rule
+// references the same public IP or public IP prefix as the expected one.
+func equalOutboundFrontendIPConfig(existing, expected network.FrontendIPConfiguration) bool {
+	s, t := existing.FrontendIPConfigurationPropertiesFormat, expected.FrontendIPConfigurationPropertiesFormat
+	if s == nil {
+		return false
+	}
+	var sPIPID, tPIPID string
+	if s.PublicIPAddress != nil {
+		sPIPID = pointer.StringDeref(s.PublicIPAddress.ID, "")
+	}
+	if t.PublicIPAddress != nil {
+		tPIPID = pointer.StringDeref(t.PublicIPAddress.ID, "")
+	}
+	return strings.EqualFold(sPIPID, tPIPID) && equalSubResource(s.PublicIPPrefix, t.PublicIPPrefix)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestValidateIPv6OutboundConfig(t *testing.T) {
+	for _, tc := range []struct {
+		desc                string
+		config              *IPv6OutboundConfig
+		loadBalancerSku     string
+		disableOutboundSNAT *bool
+		expectedErr         bool
+		expectedIdleTimeout int32
+	}{
+		{
+			desc: "nil config should be allowed",
+		},
+		{
+			desc:            "disabled config should not be validated",
+			config:          &IPv6OutboundConfig{AllocatedOutboundPorts: 7},
+			loadBalancerSku: consts.LoadBalancerSkuBasic,
+		},
+		{
+			desc:                "idle timeout should be defaulted",
+			config:              &IPv6OutboundConfig{Enabled: true, AllocatedOutboundPorts: 1024},
+			disableOutboundSNAT: pointer.Bool(true),
+			expectedIdleTimeout: consts.DefaultIPv6OutboundIdleTimeoutInMinutes,
+		},
+		{
+			desc:                "basic load balancer should not be allowed",
+			config:              &IPv6OutboundConfig{Enabled: true},
+			loadBalancerSku:     consts.LoadBalancerSkuBasic,
+			disableOutboundSNAT: pointer.Bool(true),
+			expectedErr:         true,
+		},
+		{
+			desc:        "outbound SNAT of the load balancing rules should be disabled",
+			config:      &IPv6OutboundConfig{Enabled: true},
+			expectedErr: true,
+		},
+		{
+			desc:                "allocated outbound ports should be a multiple of 8",
+			config:              &IPv6OutboundConfig{Enabled: true, AllocatedOutboundPorts: 1001},
+			disableOutboundSNAT: pointer.Bool(true),
+			expectedErr:         true,
+		},
+		{
+			desc:                "idle timeout should not be larger than 120",
+			config:              &IPv6OutboundConfig{Enabled: true, IdleTimeoutInMinutes: 121},
+			disableOutboundSNAT: pointer.Bool(true),
+			expectedErr:         true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := validateIPv6OutboundConfig(tc.config, tc.loadBalancerSku, tc.disableOutboundSNAT)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			if tc.expectedIdleTimeout != 0 {
+				assert.Equal(t, tc.expectedIdleTimeout, tc.config.IdleTimeoutInMinutes)
+			}
+		})
+	}
+}
+
+func TestReconcileIPv6OutboundRule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.ipv6DualStackEnabled = true
+	az.IPv6OutboundConfig = &IPv6OutboundConfig{Enabled: true, AllocatedOutboundPorts: 1024, IdleTimeoutInMinutes: 30}
+
+	name := "testCluster-outbound-IPv6"
+	pipID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/" + name
+	fipConfigID := az.getFrontendIPConfigID("testCluster", name)
+	backendPoolID := az.getBackendPoolID("testCluster", "testCluster-IPv6")
+	pip := network.PublicIPAddress{
+		Name: pointer.String(name),
+		ID:   pointer.String(pipID),
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			PublicIPAddressVersion: network.IPv6,
+		},
+	}
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil).Times(2)
+	mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", name, gomock.Any()).DoAndReturn(
+		func(_, _, _ interface{}, pip network.PublicIPAddress) interface{} {
+			assert.Equal(t, network.IPv6, pip.PublicIPAddressVersion)
+			assert.Equal(t, network.PublicIPAddressSkuNameStandard, pip.Sku.Name)
+			assert.Equal(t, "testCluster", *pip.Tags[consts.ClusterNameKey])
+			return nil
+		}).Times(1)
+	mockPIPClient.EXPECT().Get(gomock.Any(), "rg", name, "").Return(pip, nil).Times(1)
+
+	lb := &network.LoadBalancer{
+		Name: pointer.String("testCluster"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: pointer.String("service-fip")}},
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{Name: pointer.String("testCluster"), ID: pointer.String(az.getBackendPoolID("testCluster", "testCluster"))},
+				{Name: pointer.String("testCluster-IPv6"), ID: pointer.String(backendPoolID)},
+			},
+		},
+	}
+	changed, pipToDelete, err := az.reconcileIPv6OutboundRule(testClusterName, lb)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Empty(t, pipToDelete)
+	assert.Len(t, *lb.FrontendIPConfigurations, 2)
+	assert.Equal(t, pipID, *(*lb.FrontendIPConfigurations)[1].PublicIPAddress.ID)
+	assert.Equal(t, []network.OutboundRule{
+		{
+			Name: pointer.String(name),
+			OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+				Protocol:                 network.LoadBalancerOutboundRuleProtocolAll,
+				AllocatedOutboundPorts:   pointer.Int32(1024),
+				IdleTimeoutInMinutes:     pointer.Int32(30),
+				EnableTCPReset:           pointer.Bool(true),
+				FrontendIPConfigurations: &[]network.SubResource{{ID: pointer.String(fipConfigID)}},
+				BackendAddressPool:       &network.SubResource{ID: pointer.String(backendPoolID)},
+			},
+		},
+	}, *lb.OutboundRules)
+
+	// The cache of the public IPs is invalidated after the public IP is created.
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{pip}, nil).AnyTimes()
+	changed, _, err = az.reconcileIPv6OutboundRule(testClusterName, lb)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	az.IPv6OutboundConfig.IdleTimeoutInMinutes = 60
+	changed, _, err = az.reconcileIPv6OutboundRule(testClusterName, lb)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, int32(60), *(*lb.OutboundRules)[0].IdleTimeoutInMinutes)
+
+	// The outbound rule is removed together with the last frontend IP configuration of the services.
+	*lb.FrontendIPConfigurations = (*lb.FrontendIPConfigurations)[1:]
+	changed, pipToDelete, err = az.reconcileIPv6OutboundRule(testClusterName, lb)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, name, pipToDelete)
+	assert.Empty(t, *lb.FrontendIPConfigurations)
+	assert.Empty(t, *lb.OutboundRules)
+
+	changed, pipToDelete, err = az.reconcileIPv6OutboundRule(testClusterName, lb)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Empty(t, pipToDelete)
+
+	// Internal load balancers are not changed.
+	internalLB := &network.LoadBalancer{
+		Name:                         pointer.String("testCluster-internal"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+	}
+	changed, _, err = az.reconcileIPv6OutboundRule(testClusterName, internalLB)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Nil(t, internalLB.OutboundRules)
+}
@@ -81,12 +81,25 @@ func (az *Cloud) existsPip(clusterName string, service *v1.Service) bool {
 // GetLoadBalancer returns whether the specified load balancer and its components exist, and
 // if so, what its status is.
 func (az *Cloud) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
+	if service, err = az.withAzureLoadBalancerConfiguration(ctx, service); err != nil {
+		return nil, false, err
+	}
+
+	if consts.IsApplicationGatewayEnabled(service.Annotations) {
+		return az.getApplicationGatewayServiceStatus(service)
+	}
+
 	existingLBs, err := az.ListLB(service)
 	if err != nil {
 		return nil, az.existsPip(clusterName, service), err
 	}
 
 	_, _, status, _, existsLb, err := az.getServiceLoadBalancer(service, clusterName, nil, false, &existingLBs)
+	if err == nil && existsLb && consts.IsK8sServiceInternalAndExternal(service) {
+		var counterpartStatus *v1.LoadBalancerStatus
+		_, _, counterpartStatus, _, _, err = az.getServiceLoadBalancer(getCounterpartService(service), clusterName, nil, false, &existingLBs)
+		status = mergeLoadBalancerStatus(status, counterpartStatus)
+	}
 	if err != nil || existsLb {
 		return status, existsLb || az.existsPip(clusterName, service), err
 	}
@@ -121,7 +134,26 @@ func (az *Cloud) reconcileService(ctx context.Context, clusterName string, servi
 	resourceBaseName := az.GetLoadBalancerName(context.TODO(), "", service)
 	klog.V(2).Infof("reconcileService: Start reconciling Service %q with its resource basename %q", serviceName, resourceBaseName)
 
-	lb, err := az.reconcileLoadBalancer(clusterName, service, nodes, true /* wantLb */)
+	if _, err := getServiceResourceTags(service); err != nil {
+		az.Event(service, v1.EventTypeWarning, "InvalidResourceTags", err.Error())
+		return nil, err
+	}
+	az.checkServiceTrafficDistribution(service)
+
+	isAzureFirewallDNAT := consts.IsAzureFirewallDNATEnabled(service.Annotations)
+	if isAzureFirewallDNAT && consts.IsK8sServiceInternalAndExternal(service) {
+		return nil, fmt.Errorf("reconcileService: the annotations %s and %s cannot be used together",
+			consts.ServiceAnnotationAzureFirewallDNAT, consts.ServiceAnnotationLoadBalancerInternalAndExternal)
+	}
+
+	if lbStatus, ok := az.getCachedLoadBalancerStatus(clusterName, service, nodes); ok {
+		klog.V(2).Infof("reconcileService: skipping service %q since its desired state is unchanged", serviceName)
+		return lbStatus, nil
+	}
+
+	// The retries after a failure with the same service and nodes resume at the failed phase.
+	state := az.getServiceReconcileState(service, nodes)
+	lb, err := az.ensureServiceLoadBalancer(state, reconcilePhaseLoadBalancer, clusterName, service, nodes)
 	if err != nil {
 		klog.Errorf("reconcileLoadBalancer(%s) failed: %v", serviceName, err)
 		return nil, err
@@ -135,42 +167,128 @@ func (az *Cloud) reconcileService(ctx context.Context, clusterName string, servi
 		}
 	}
 
-	serviceIPs := lbIPsPrimaryPIPs
-	klog.V(2).Infof("reconcileService: reconciling security group for service %q with IPs %q, wantLb = true", serviceName, serviceIPs)
-	if _, err := az.reconcileSecurityGroup(clusterName, service, &serviceIPs, lb.Name, true /* wantLb */); err != nil {
-		klog.Errorf("reconcileSecurityGroup(%s) failed: %#v", serviceName, err)
+	serviceIPs := append([]string{}, lbIPsPrimaryPIPs...)
+	isInternalAndExternal := consts.IsK8sServiceInternalAndExternal(service)
+	var (
+		counterpartService *v1.Service
+		counterpartLB      *network.LoadBalancer
+		counterpartIPs     []string
+	)
+	if isInternalAndExternal {
+		counterpartService = getCounterpartService(service)
+		klog.V(2).Infof("reconcileService: reconciling the counterpart load balancer of service %q, internal = %t", serviceName, requiresInternalLoadBalancer(counterpartService))
+		if counterpartLB, err = az.ensureServiceLoadBalancer(state, reconcilePhaseCounterpartLoadBalancer, clusterName, counterpartService, nodes); err != nil {
+			klog.Errorf("reconcileLoadBalancer(%s) for the counterpart failed: %v", serviceName, err)
+			return nil, err
+		}
+		var counterpartStatus *v1.LoadBalancerStatus
+		counterpartStatus, counterpartIPs, _, err = az.getServiceLoadBalancerStatus(counterpartService, counterpartLB)
+		if err != nil {
+			klog.Errorf("getServiceLoadBalancerStatus(%s) for the counterpart failed: %v", serviceName, err)
+			return nil, err
+		}
+		lbStatus = mergeLoadBalancerStatus(lbStatus, counterpartStatus)
+		serviceIPs = append(serviceIPs, counterpartIPs...)
+	}
+
+	// The service is exposed publicly by the DNAT rules of the Azure Firewall, which translate the traffic to the
+	// public IP of the firewall to the frontend of the service on the internal load balancer. The rules are removed
+	// in case the annotation is removed from the service.
+	firewallIP, err := az.reconcileAzureFirewall(clusterName, service, lbIPsPrimaryPIPs, isAzureFirewallDNAT)
+	if err != nil {
+		klog.Errorf("reconcileAzureFirewall(%s) failed: %v", serviceName, err)
 		return nil, err
 	}
+	statusIPs := serviceIPs
+	if firewallIP != "" {
+		lbStatus = mergeLoadBalancerStatus(&v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: firewallIP}}}, lbStatus)
+		statusIPs = append([]string{firewallIP}, serviceIPs...)
+	}
 
-	for _, fipConfig := range fipConfigs {
-		if err := az.reconcilePrivateLinkService(clusterName, service, fipConfig, true /* wantPLS */); err != nil {
-			klog.Errorf("reconcilePrivateLinkService(%s) failed: %#v", serviceName, err)
+	// When the internal annotation flips, the new frontends are created above before the previous ones on the load
+	// balancer of the opposite type are removed below. The security rules of the previous frontend IPs are kept
+	// until then, so the service is temporarily exposed by both instead of being unreachable in between.
+	var flippedLBIPs []string
+	if !isInternalAndExternal {
+		if flippedLBIPs, err = az.getServiceIPsOnFlippedLoadBalancer(clusterName, service, statusIPs); err != nil {
+			klog.Errorf("getServiceIPsOnFlippedLoadBalancer(%s) failed: %v", serviceName, err)
 			return nil, err
 		}
+		if len(flippedLBIPs) > 0 {
+			az.Event(service, v1.EventTypeNormal, "LoadBalancerTransition", fmt.Sprintf(
+				"Temporarily exposing the service by both the new frontend IPs %q and the previous frontend IPs %q until the previous ones are removed",
+				serviceIPs, flippedLBIPs))
+		}
+	}
+
+	securityGroupIPs := append(append([]string{}, serviceIPs...), flippedLBIPs...)
+	if !state.isCompleted(reconcilePhaseSecurityGroup) {
+		klog.V(2).Infof("reconcileService: reconciling security group for service %q with IPs %q, wantLb = true", serviceName, securityGroupIPs)
+		if _, err := az.reconcileSecurityGroup(clusterName, service, &securityGroupIPs, lb.Name, true /* wantLb */); err != nil {
+			klog.Errorf("reconcileSecurityGroup(%s) failed: %#v", serviceName, err)
+			return nil, err
+		}
+		state.complete(reconcilePhaseSecurityGroup, "")
+	}
+
+	if !state.isCompleted(reconcilePhasePrivateLinkService) {
+		for _, fipConfig := range fipConfigs {
+			if err := az.reconcilePrivateLinkService(clusterName, service, fipConfig, true /* wantPLS */); err != nil {
+				klog.Errorf("reconcilePrivateLinkService(%s) failed: %#v", serviceName, err)
+				return nil, err
+			}
+		}
+		state.complete(reconcilePhasePrivateLinkService, "")
 	}
 
 	updateService := updateServiceLoadBalancerIPs(service, lbIPsPrimaryPIPs)
-	flippedService := flipServiceInternalAnnotation(updateService)
-	if _, err := az.reconcileLoadBalancer(clusterName, flippedService, nil, false /* wantLb */); err != nil {
-		klog.Errorf("reconcileLoadBalancer(%s) failed: %#v", serviceName, err)
-		return nil, err
+	pipService, pipLBName := updateService, pointer.StringDeref(lb.Name, "")
+	if !isInternalAndExternal {
+		flippedService := flipServiceInternalAnnotation(updateService)
+		if _, err := az.reconcileLoadBalancer(clusterName, flippedService, nil, false /* wantLb */); err != nil {
+			klog.Errorf("reconcileLoadBalancer(%s) failed: %#v", serviceName, err)
+			return nil, err
+		}
+		if len(flippedLBIPs) > 0 {
+			klog.V(2).Infof("reconcileService: revoking the security rules of the previous frontend IPs %q of service %q", flippedLBIPs, serviceName)
+			if _, err := az.reconcileSecurityGroup(clusterName, service, &serviceIPs, lb.Name, true /* wantLb */); err != nil {
+				klog.Errorf("reconcileSecurityGroup(%s) failed: %#v", serviceName, err)
+				return nil, err
+			}
+			az.Event(service, v1.EventTypeNormal, "LoadBalancerTransitionCompleted", fmt.Sprintf("Removed the previous frontend IPs %q of the service", flippedLBIPs))
+		}
+	} else if !requiresInternalLoadBalancer(counterpartService) {
+		// The public IPs belong to the external counterpart of the internal service.
+		pipService, pipLBName = updateServiceLoadBalancerIPs(counterpartService, counterpartIPs), pointer.StringDeref(counterpartLB.Name, "")
 	}
 
 	// lb is not reused here because the ETAG may be changed in above operations, hence reconcilePublicIP() would get lb again from cache.
 	klog.V(2).Infof("reconcileService: reconciling pip")
-	if _, err := az.reconcilePublicIPs(clusterName, updateService, pointer.StringDeref(lb.Name, ""), true /* wantLb */); err != nil {
+	if _, err := az.reconcilePublicIPs(clusterName, pipService, pipLBName, true /* wantLb */); err != nil {
 		klog.Errorf("reconcilePublicIP(%s) failed: %#v", serviceName, err)
 		return nil, err
 	}
 
+	// Remove the listeners of the Application Gateway in case the annotation is removed from the service.
+	if az.ApplicationGatewayName != "" {
+		if _, err := az.reconcileApplicationGateway(service, nil, false /* wantLb */); err != nil {
+			klog.Errorf("reconcileApplicationGateway(%s) failed: %#v", serviceName, err)
+			return nil, err
+		}
+	}
+
 	lbName := strings.ToLower(pointer.StringDeref(lb.Name, ""))
 	key := strings.ToLower(serviceName)
-	if az.useMultipleStandardLoadBalancers() && isLocalService(service) {
-		az.localServiceNameToServiceInfoMap.Store(key, newServiceInfo(getServiceIPFamily(service), lbName))
+	if az.useDedicatedBackendPool(service) {
+		si := newServiceInfo(getServiceIPFamily(service), lbName)
+		si.preferredZone = az.getServicePreferredZone(service, lb)
+		az.localServiceNameToServiceInfoMap.Store(key, si)
 	} else {
 		az.localServiceNameToServiceInfoMap.Delete(key)
 	}
 
+	az.resetServiceReconcileState(service)
+	az.persistLoadBalancerDesiredState(clusterName, service, nodes, pointer.StringDeref(lb.Name, ""))
 	return lbStatus, nil
 }
 
@@ -180,11 +298,24 @@ func (az *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, ser
 	// the service may be switched from an internal LB to a public one, or vice versa.
 	// Here we'll firstly ensure service do not lie in the opposite LB.
 
+	service, err := az.withAzureLoadBalancerConfiguration(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	if az.ReadOnlyMode {
+		return az.getReadOnlyLoadBalancerStatus(ctx, clusterName, service)
+	}
+	if err := az.degradedMode.checkWrites(); err != nil {
+		klog.Warningf("EnsureLoadBalancer: pausing service %s: %s", service.Name, err.Error())
+		return nil, err
+	}
+
 	// Serialize service reconcile process
 	az.serviceReconcileLock.Lock()
 	defer az.serviceReconcileLock.Unlock()
+	defer az.startServiceReconcile(service)()
 
-	var err error
 	serviceName := getServiceName(service)
 	mc := metrics.NewMetricContext("services", "ensure_loadbalancer", az.ResourceGroup, az.getNetworkResourceSubscriptionID(), serviceName)
 	klog.V(5).InfoS("EnsureLoadBalancer Start", "service", serviceName, "cluster", clusterName, "service_spec", service)
@@ -195,11 +326,17 @@ func (az *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, ser
 		klog.V(5).InfoS("EnsureLoadBalancer Finish", "service", serviceName, "cluster", clusterName, "service_spec", service, "error", err)
 	}()
 
-	lbStatus, err := az.reconcileService(ctx, clusterName, service, nodes)
+	var lbStatus *v1.LoadBalancerStatus
+	if consts.IsApplicationGatewayEnabled(service.Annotations) {
+		lbStatus, err = az.reconcileServiceApplicationGateway(clusterName, service, nodes)
+	} else {
+		lbStatus, err = az.reconcileService(ctx, clusterName, service, nodes)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	az.notifyServiceIPChange(service, getLoadBalancerStatusIPs(&service.Status.LoadBalancer), getLoadBalancerStatusIPs(lbStatus))
 	isOperationSucceeded = true
 	return lbStatus, nil
 }
@@ -214,19 +351,33 @@ func (az *Cloud) getLatestService(serviceName string, deepcopy bool) (*v1.Servic
 		return nil, false, nil
 	case err != nil:
 		return nil, false, err
-	default:
-		if deepcopy {
-			return latestService.DeepCopy(), true, nil
-		}
-		return latestService, true, nil
 	}
+	// the services configured by AzureLoadBalancerConfiguration are always copied
+	configuredService, err := az.withAzureLoadBalancerConfiguration(context.Background(), latestService)
+	if err != nil {
+		return nil, false, err
+	}
+	if deepcopy && configuredService == latestService {
+		return latestService.DeepCopy(), true, nil
+	}
+	return configuredService, true, nil
 }
 
 // UpdateLoadBalancer updates hosts under the specified load balancer.
 func (az *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	if az.ReadOnlyMode {
+		klog.V(4).Infof("UpdateLoadBalancer: skipping service %s in the read-only mode", service.Name)
+		return nil
+	}
+	if err := az.degradedMode.checkWrites(); err != nil {
+		klog.Warningf("UpdateLoadBalancer: pausing service %s: %s", service.Name, err.Error())
+		return err
+	}
+
 	// Serialize service reconcile process
 	az.serviceReconcileLock.Lock()
 	defer az.serviceReconcileLock.Unlock()
+	defer az.startServiceReconcile(service)()
 
 	var err error
 	serviceName := getServiceName(service)
@@ -241,7 +392,7 @@ func (az *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, ser
 	// In case UpdateLoadBalancer gets stale service spec, retrieve the latest from lister
 	service, serviceExists, err := az.getLatestService(serviceName, true)
 	if err != nil {
-		return fmt.Errorf("UpdateLoadBalancer: failed to get latest service %s: %w", service.Name, err)
+		return fmt.Errorf("UpdateLoadBalancer: failed to get latest service %s: %w", serviceName, err)
 	}
 	if !serviceExists {
 		isOperationSucceeded = true
@@ -249,6 +400,16 @@ func (az *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, ser
 		return nil
 	}
 
+	if consts.IsApplicationGatewayEnabled(service.Annotations) {
+		if service.ObjectMeta.DeletionTimestamp == nil && service.Spec.Type == v1.ServiceTypeLoadBalancer {
+			if _, err = az.reconcileApplicationGateway(service, nodes, true /* wantLb */); err != nil {
+				return err
+			}
+		}
+		isOperationSucceeded = true
+		return nil
+	}
+
 	shouldUpdateLB, err := az.shouldUpdateLoadBalancer(clusterName, service, nodes)
 	if err != nil {
 		return err
@@ -276,26 +437,67 @@ func (az *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, ser
 // have multiple underlying components, meaning a Get could say that the LB
 // doesn't exist even if some part of it is still laying around.
 func (az *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	if az.ReadOnlyMode {
+		klog.V(2).Infof("EnsureLoadBalancerDeleted: keeping the load balancer of service %s in the read-only mode", service.Name)
+		return nil
+	}
+	if err := az.degradedMode.checkWrites(); err != nil {
+		klog.Warningf("EnsureLoadBalancerDeleted: pausing service %s: %s", service.Name, err.Error())
+		return err
+	}
+
 	// Serialize service reconcile process
 	az.serviceReconcileLock.Lock()
 	defer az.serviceReconcileLock.Unlock()
+	defer az.startServiceReconcile(service)()
 
 	var err error
 	serviceName := getServiceName(service)
 	mc := metrics.NewMetricContext("services", "ensure_loadbalancer_deleted", az.ResourceGroup, az.getNetworkResourceSubscriptionID(), serviceName)
 	klog.V(5).InfoS("EnsureLoadBalancerDeleted Start", "service", serviceName, "cluster", clusterName, "service_spec", service)
+	az.resetServiceReconcileState(service)
+	az.forgetLoadBalancerDesiredState(service)
 	isOperationSucceeded := false
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded)
 		klog.V(5).InfoS("EnsureLoadBalancerDeleted Finish", "service", serviceName, "cluster", clusterName, "service_spec", service, "error", err)
 	}()
 
+	// the resources are cleaned up by the annotations of the service if its configuration is already deleted.
+	if configured, configErr := az.withAzureLoadBalancerConfiguration(ctx, service); configErr == nil {
+		service = configured
+	} else {
+		klog.Warningf("EnsureLoadBalancerDeleted: cleaning up the resources of service %s by its annotations: %v", serviceName, configErr)
+	}
+
+	if _, err = az.reconcileApplicationGateway(service, nil, false /* wantLb */); err != nil {
+		return err
+	}
+
+	if _, err = az.reconcileAzureFirewall(clusterName, service, nil, false /* wantLb */); err != nil {
+		return err
+	}
+
+	if err = az.cleanupLoadBalancerResources(clusterName, service); err != nil {
+		return err
+	}
+
+	klog.V(2).Infof("Delete service (%s): FINISH", serviceName)
+	az.notifyServiceIPChange(service, getLoadBalancerStatusIPs(&service.Status.LoadBalancer), nil)
+	isOperationSucceeded = true
+
+	return nil
+}
+
+// cleanupLoadBalancerResources removes the load balancer rules, security rules and public IPs of the service.
+func (az *Cloud) cleanupLoadBalancerResources(clusterName string, service *v1.Service) error {
+	serviceName := getServiceName(service)
 	_, _, _, lbIPsPrimaryPIPs, _, err := az.getServiceLoadBalancer(service, clusterName, nil, false, &[]network.LoadBalancer{})
 	if err != nil && !retry.HasStatusForbiddenOrIgnoredError(err) {
 		return err
 	}
 	serviceIPsToCleanup := lbIPsPrimaryPIPs
-	klog.V(2).Infof("EnsureLoadBalancerDeleted: reconciling security group for service %q with IPs %q, wantLb = false", serviceName, serviceIPsToCleanup)
+	klog.V(2).Infof("cleanupLoadBalancerResources: reconciling security group for service %q with IPs %q, wantLb = false", serviceName, serviceIPsToCleanup)
 	_, err = az.reconcileSecurityGroup(clusterName, service, &serviceIPsToCleanup, nil, false /* wantLb */)
 	if err != nil {
 		return err
@@ -316,14 +518,11 @@ func (az *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName stri
 		return err
 	}
 
-	if az.useMultipleStandardLoadBalancers() && isLocalService(service) {
+	if az.useDedicatedBackendPool(service) {
 		key := strings.ToLower(serviceName)
 		az.localServiceNameToServiceInfoMap.Delete(key)
 	}
 
-	klog.V(2).Infof("Delete service (%s): FINISH", serviceName)
-	isOperationSucceeded = true
-
 	return nil
 }
 
@@ -523,7 +722,7 @@ func (az *Cloud) cleanOrphanedLoadBalancer(lb *network.LoadBalancer, existingLBs
 			}
 
 			vmssNamesMap := map[string]bool{vmssName: true}
-			if err := az.VMSet.EnsureBackendPoolDeletedFromVMSets(vmssNamesMap, lbBackendPoolIDsToDelete); err != nil {
+			if err := az.ensureBackendPoolDeletedFromVMSets(vmssNamesMap, lbBackendPoolIDsToDelete); err != nil {
 				klog.Errorf("cleanOrphanedLoadBalancer(%s, %s, %s): failed to EnsureBackendPoolDeletedFromVMSets: %v", lbName, serviceName, clusterName, err)
 				return err
 			}
@@ -549,7 +748,7 @@ func (az *Cloud) safeDeleteLoadBalancer(lb network.LoadBalancer, clusterName, vm
 	if v6Enabled {
 		lbBackendPoolIDsToDelete = append(lbBackendPoolIDsToDelete, lbBackendPoolIDs[consts.IPVersionIPv6])
 	}
-	if _, err := az.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolIDsToDelete, vmSetName, lb.BackendAddressPools, true); err != nil {
+	if _, err := az.ensureBackendPoolDeletedFromVMSet(service, lbBackendPoolIDsToDelete, vmSetName, lb.BackendAddressPools, true); err != nil {
 		return retry.NewError(false, fmt.Errorf("safeDeleteLoadBalancer: failed to EnsureBackendPoolDeleted: %w", err))
 	}
 
@@ -568,6 +767,7 @@ func (az *Cloud) safeDeleteLoadBalancer(lb network.LoadBalancer, clusterName, vm
 			if az.MultipleStandardLoadBalancerConfigurations[i].ActiveNodes != nil {
 				for nodeName := range az.MultipleStandardLoadBalancerConfigurations[i].ActiveNodes {
 					az.nodesWithCorrectLoadBalancerByPrimaryVMSet.Delete(strings.ToLower(nodeName))
+					az.setNodeLoadBalancerName(nodeName, "")
 				}
 			}
 			az.MultipleStandardLoadBalancerConfigurations[i].ActiveNodes = sets.New[string]()
@@ -656,7 +856,7 @@ func (az *Cloud) getServiceLoadBalancer(
 				pointer.StringDeref(existingLB.Name, ""),
 			)
 
-			if isLocalService(service) && az.useMultipleStandardLoadBalancers() {
+			if az.useDedicatedBackendPool(service) {
 				// No need for the endpoint slice informer to update the backend pool
 				// for the service because the main loop will delete the old backend pool
 				// and create a new one in the new load balancer.
@@ -819,9 +1019,11 @@ func (az *Cloud) getServiceLoadBalancerStatus(service *v1.Service, lb *network.L
 	isInternal := requiresInternalLoadBalancer(service)
 	serviceName := getServiceName(service)
 	lbIngresses := []v1.LoadBalancerIngress{}
+	var additionalFrontendIPs []string
 	for i := range *lb.FrontendIPConfigurations {
 		ipConfiguration := (*lb.FrontendIPConfigurations)[i]
 		owns, isPrimaryService, _ := az.serviceOwnsFrontendIP(ipConfiguration, service)
+		isAdditionalFrontend := !isInternal && az.getAdditionalFrontendIndex(service, pointer.StringDeref(ipConfiguration.Name, "")) > 0
 		if owns {
 			klog.V(2).Infof("get(%s): lb(%s) - found frontend IP config, primary service: %v", serviceName, pointer.StringDeref(lb.Name, ""), isPrimaryService)
 
@@ -851,6 +1053,11 @@ func (az *Cloud) getServiceLoadBalancerStatus(service *v1.Service, lb *network.L
 
 			klog.V(2).Infof("getServiceLoadBalancerStatus gets ingress IP %q from frontendIPConfiguration %q for service %q", pointer.StringDeref(lbIP, ""), pointer.StringDeref(ipConfiguration.Name, ""), serviceName)
 
+			// The IPs of the additional frontends are reported after the ones of the primary frontends.
+			if isAdditionalFrontend {
+				additionalFrontendIPs = append(additionalFrontendIPs, pointer.StringDeref(lbIP, ""))
+				continue
+			}
 			lbIngresses = append(lbIngresses, v1.LoadBalancerIngress{IP: pointer.StringDeref(lbIP, "")})
 			lbIPsPrimaryPIPs = append(lbIPsPrimaryPIPs, pointer.StringDeref(lbIP, ""))
 			fipConfigs = append(fipConfigs, &ipConfiguration)
@@ -859,6 +1066,10 @@ func (az *Cloud) getServiceLoadBalancerStatus(service *v1.Service, lb *network.L
 	if len(lbIngresses) == 0 {
 		return nil, nil, nil, nil
 	}
+	for _, ip := range additionalFrontendIPs {
+		lbIngresses = append(lbIngresses, v1.LoadBalancerIngress{IP: ip})
+		lbIPsPrimaryPIPs = append(lbIPsPrimaryPIPs, ip)
+	}
 
 	// set additional public IPs to LoadBalancerStatus, so that kube-proxy would create their iptables rules.
 	additionalIPs, err := getServiceAdditionalPublicIPs(service)
@@ -883,6 +1094,10 @@ func (az *Cloud) determinePublicIPName(clusterName string, service *v1.Service,
 	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
 	if id := getServicePIPPrefixID(service, isIPv6); id != "" {
 		pipName, err := az.getPublicIPName(clusterName, service, isIPv6)
+		if err != nil {
+			return "", false, err
+		}
+		pipName, err = az.getZoneRedundantPublicIPName(service, pipName)
 		return pipName, false, err
 	}
 
@@ -891,8 +1106,29 @@ func (az *Cloud) determinePublicIPName(clusterName string, service *v1.Service,
 	// Assume that the service without loadBalancerIP set is a primary service.
 	// If a secondary service doesn't set the loadBalancerIP, it is not allowed to share the IP.
 	if len(loadBalancerIP) == 0 {
+		if selector := getServicePIPTagSelector(service); selector != nil {
+			pipName, err := az.selectPublicIPFromPool(service, selector, isIPv6)
+			return pipName, true, err
+		}
 		pipName, err := az.getPublicIPName(clusterName, service, isIPv6)
-		return pipName, false, err
+		if err != nil {
+			return "", false, err
+		}
+		zoneRedundantPIPName, err := az.getZoneRedundantPublicIPName(service, pipName)
+		if err != nil {
+			return "", false, err
+		}
+		if zoneRedundantPIPName != pipName {
+			return zoneRedundantPIPName, false, nil
+		}
+		adoptedPIPName, err := az.findAdoptablePublicIPName(clusterName, service, pipName, isIPv6)
+		if err != nil {
+			return "", false, err
+		}
+		if adoptedPIPName != "" {
+			return adoptedPIPName, false, nil
+		}
+		return pipName, false, nil
 	}
 
 	// For the services with loadBalancerIP set, an existing public IP is required, primary
@@ -909,14 +1145,54 @@ func (az *Cloud) determinePublicIPName(clusterName string, service *v1.Service,
 	return "", false, fmt.Errorf("user supplied IP Address %s was not found in resource group %s", loadBalancerIP, pipResourceGroup)
 }
 
+// getServiceIPsOnFlippedLoadBalancer returns the frontend IPs of the service on the load balancer of the opposite type,
+// which exist during the transition after the internal annotation of the service flips. To avoid listing the load
+// balancers in every reconciliation, they are only looked up if the ingress IPs in the service status are not served
+// by the wanted load balancer.
+func (az *Cloud) getServiceIPsOnFlippedLoadBalancer(clusterName string, service *v1.Service, serviceIPs []string) ([]string, error) {
+	wantedIPs := sets.New(serviceIPs...)
+	var hasUnwantedIngressIP bool
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" && !wantedIPs.Has(ingress.IP) {
+			hasUnwantedIngressIP = true
+			break
+		}
+	}
+	if !hasUnwantedIngressIP {
+		return nil, nil
+	}
+
+	flippedService := flipServiceInternalAnnotation(service)
+	existingLBs, err := az.ListManagedLBs(flippedService, nil, clusterName)
+	if err != nil || existingLBs == nil {
+		return nil, err
+	}
+	isInternal := requiresInternalLoadBalancer(flippedService)
+	for i := range *existingLBs {
+		existingLB := (*existingLBs)[i]
+		if isInternalLoadBalancer(&existingLB) != isInternal {
+			continue
+		}
+		status, lbIPs, _, err := az.getServiceLoadBalancerStatus(flippedService, &existingLB)
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			return lbIPs, nil
+		}
+	}
+	return nil, nil
+}
+
 func flipServiceInternalAnnotation(service *v1.Service) *v1.Service {
 	copyService := service.DeepCopy()
 	if copyService.Annotations == nil {
 		copyService.Annotations = map[string]string{}
 	}
-	if v, ok := copyService.Annotations[consts.ServiceAnnotationLoadBalancerInternal]; ok && v == consts.TrueAnnotationValue {
-		// If it is internal now, we make it external by remove the annotation
+	if requiresInternalLoadBalancer(copyService) {
+		// If it is internal now, we make it external by remove the annotations
 		delete(copyService.Annotations, consts.ServiceAnnotationLoadBalancerInternal)
+		delete(copyService.Annotations, consts.ServiceAnnotationAzureFirewallDNAT)
 	} else {
 		// If it is external now, we make it internal
 		copyService.Annotations[consts.ServiceAnnotationLoadBalancerInternal] = consts.TrueAnnotationValue
@@ -924,10 +1200,56 @@ func flipServiceInternalAnnotation(service *v1.Service) *v1.Service {
 	return copyService
 }
 
+// getCounterpartService returns the service exposed by the other load balancer of the service with
+// ServiceAnnotationLoadBalancerInternalAndExternal, i.e. the internal one for the external service and vice versa.
+// The load balancer IPs of the service are removed, so that the frontend of the counterpart is allocated automatically.
+func getCounterpartService(service *v1.Service) *v1.Service {
+	counterpart := flipServiceInternalAnnotation(service)
+	counterpart.Spec.LoadBalancerIP = ""
+	for _, isIPv6 := range []bool{consts.IPVersionIPv4, consts.IPVersionIPv6} {
+		delete(counterpart.Annotations, consts.ServiceAnnotationLoadBalancerIPDualStack[isIPv6])
+	}
+	if requiresInternalLoadBalancer(counterpart) {
+		// Additional frontends are only supported by the external load balancer.
+		delete(counterpart.Annotations, consts.ServiceAnnotationLoadBalancerAdditionalFrontends)
+	}
+	return counterpart
+}
+
+// mergeLoadBalancerStatus appends the ingresses of the other status which are not in the status yet.
+func mergeLoadBalancerStatus(status, other *v1.LoadBalancerStatus) *v1.LoadBalancerStatus {
+	if other == nil {
+		return status
+	}
+	if status == nil {
+		status = &v1.LoadBalancerStatus{}
+	}
+	existingIPs := sets.New[string]()
+	for _, ingress := range status.Ingress {
+		existingIPs.Insert(ingress.IP)
+	}
+	for _, ingress := range other.Ingress {
+		if !existingIPs.Has(ingress.IP) {
+			existingIPs.Insert(ingress.IP)
+			status.Ingress = append(status.Ingress, ingress)
+		}
+	}
+	return status
+}
+
 func updateServiceLoadBalancerIPs(service *v1.Service, serviceIPs []string) *v1.Service {
 	copyService := service.DeepCopy()
 	if copyService != nil {
+		// Only the first IP of each family is set, which is the IP of the primary frontend.
+		setFamilies := map[bool]bool{}
 		for _, serviceIP := range serviceIPs {
+			if parsedIP := net.ParseIP(serviceIP); parsedIP != nil {
+				isIPv6 := parsedIP.To4() == nil
+				if setFamilies[isIPv6] {
+					continue
+				}
+				setFamilies[isIPv6] = true
+			}
 			setServiceLoadBalancerIP(copyService, serviceIP)
 		}
 	}
@@ -955,6 +1277,14 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 			if err != nil {
 				return nil, err
 			}
+		} else if isPublicIPInServicePool(service, &pip) && getServiceFromPIPServiceTags(pip.Tags) == "" {
+			// claim the free public IP selected from the pool
+			klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) - claiming from the pool", serviceName, pipName)
+			changed, err = claimPublicIPFromPool(&pip, serviceName, clusterName)
+			if err != nil {
+				return nil, err
+			}
+			isUserAssignedPIP = false
 		}
 
 		if pip.Tags == nil {
@@ -977,6 +1307,7 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 
 					ctx, cancel := getContextWithCancel()
 					defer cancel()
+					ctx = az.withServiceOperationAnnotation(ctx, service)
 					pip, rerr = az.PublicIPAddressesClient.Get(ctx, pipResourceGroup, *pip.Name, "")
 					if rerr != nil {
 						return nil, rerr.Error()
@@ -1047,10 +1378,24 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 		}
 		klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) - creating", serviceName, *pip.Name)
 	}
-	if !isUserAssignedPIP && az.ensurePIPTagged(service, &pip) {
+	if !isUserAssignedPIP && az.ensurePIPTagged(clusterName, service, &pip) {
+		if err := az.ensureResourceTagsValid(service, pipName, pip.Tags); err != nil {
+			return nil, err
+		}
 		changed = true
 	}
 
+	if foundDNSLabelAnnotation {
+		heldByRegionalPIP, err := az.isDomainNameLabelHeldByRegionalPublicIP(service, pipName, domainNameLabel)
+		if err != nil {
+			return nil, err
+		}
+		if heldByRegionalPIP {
+			// the public IP is ensured again with the label once the regional public IP is released
+			klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) - deferring the DNS label %s held by the regional public IP", serviceName, pipName, domainNameLabel)
+			foundDNSLabelAnnotation = false
+		}
+	}
 	if foundDNSLabelAnnotation {
 		updatedDNSSettings, err := reconcileDNSSettings(&pip, domainNameLabel, serviceName, pipName, isUserAssignedPIP)
 		if err != nil {
@@ -1082,6 +1427,7 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 	pip, rerr := az.PublicIPAddressesClient.Get(ctx, pipResourceGroup, *pip.Name, "")
 	if rerr != nil {
 		return nil, rerr.Error()
@@ -1343,6 +1689,13 @@ func (az *Cloud) isFrontendIPChanged(
 				return true, nil
 			}
 		}
+		allocation, err := parseInternalIPAllocation(service)
+		if err != nil {
+			return false, err
+		}
+		if allocation != nil && allocation.isIPv6() == isIPv6 {
+			return !allocation.contains(pointer.StringDeref(config.PrivateIPAddress, "")), nil
+		}
 		return loadBalancerIP != "" && !strings.EqualFold(loadBalancerIP, pointer.StringDeref(config.PrivateIPAddress, "")), nil
 	}
 	pipName, _, err := az.determinePublicIPName(clusterName, service, isIPv6)
@@ -1478,6 +1831,9 @@ func (az *Cloud) findFrontendIPConfigsOfService(
 	pipRG := az.getPublicIPAddressResourceGroup(service)
 	for _, config := range *fipConfigs {
 		config := config
+		if az.getAdditionalFrontendIndex(service, pointer.StringDeref(config.Name, "")) > 0 {
+			continue
+		}
 		owns, _, fipIPVersion := az.serviceOwnsFrontendIP(config, service)
 		if owns {
 			var fipIsIPv6 bool
@@ -1601,11 +1957,20 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 	// Delete backend pools for local service if:
 	// 1. the cluster is migrating from multi-slb to single-slb,
 	// 2. the service is changed from local to cluster.
-	if !az.useMultipleStandardLoadBalancers() || !isLocalService(service) {
-		existingLBs, err = az.cleanupLocalServiceBackendPool(service, nodes, existingLBs, clusterName)
-		if err != nil {
-			klog.Errorf("reconcileLoadBalancer: failed to cleanup local service backend pool for service %q, error: %s", serviceName, err.Error())
-			return nil, err
+	// If the load balancer is wanted, the backend pools are deleted after the
+	// load balancing rules are switched to the shared backend pool to avoid
+	// the connectivity gap.
+	var isTransitioningToClusterService bool
+	if !az.useDedicatedBackendPool(service) {
+		if wantLb && az.hasLocalServiceBackendPool(service, existingLBs) {
+			isTransitioningToClusterService = true
+			az.Event(service, v1.EventTypeNormal, "ExternalTrafficPolicyTransition", "Switching the service from the dedicated backend pools to the shared backend pools")
+		} else {
+			existingLBs, err = az.cleanupLocalServiceBackendPool(service, nodes, existingLBs, clusterName)
+			if err != nil {
+				klog.Errorf("reconcileLoadBalancer: failed to cleanup local service backend pool for service %q, error: %s", serviceName, err.Error())
+				return nil, err
+			}
 		}
 	}
 
@@ -1634,7 +1999,12 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 	dirtyLb := false
 
 	// reconcile the load balancer's backend pool configuration.
+	var isTransitioningToLocalService bool
 	if wantLb {
+		if az.useDedicatedBackendPool(service) && az.serviceRulesUseSharedBackendPool(service, lb, clusterName) {
+			isTransitioningToLocalService = true
+			az.Event(service, v1.EventTypeNormal, "ExternalTrafficPolicyTransition", "Creating and populating the dedicated backend pools for the service")
+		}
 		preConfig, changed, shouldRefreshLB, err := az.LoadBalancerBackendPool.ReconcileBackendPools(clusterName, service, lb)
 		if err != nil {
 			return lb, err
@@ -1701,14 +2071,25 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 	}
 	v4Enabled, v6Enabled := getIPFamiliesEnabled(service)
 	if wantLb && v4Enabled {
+		if az.adoptLoadBalancerRules(lb, lbFrontendIPConfigIDs[false], service) {
+			dirtyLb = true
+		}
 		if err = az.checkLoadBalancerResourcesConflicts(lb, lbFrontendIPConfigIDs[false], service); err != nil {
 			return nil, err
 		}
 		if err := getExpectedLBRule(consts.IPVersionIPv4); err != nil {
 			return nil, err
 		}
+		additionalRules, err := az.getExpectedAdditionalFrontendLBRules(service, lbName, expectedRules)
+		if err != nil {
+			return nil, err
+		}
+		expectedRules = append(expectedRules, additionalRules...)
 	}
 	if wantLb && v6Enabled {
+		if az.adoptLoadBalancerRules(lb, lbFrontendIPConfigIDs[true], service) {
+			dirtyLb = true
+		}
 		if err = az.checkLoadBalancerResourcesConflicts(lb, lbFrontendIPConfigIDs[true], service); err != nil {
 			return nil, err
 		}
@@ -1717,6 +2098,10 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 		}
 	}
 
+	if changed := az.pruneLoadBalancerRulesByOwnership(lb, service, clusterName, ownedFIPConfigs, toDeleteConfigs, lbBackendPoolIDs, expectedRules); changed {
+		dirtyLb = true
+	}
+
 	if changed := az.reconcileLBProbes(lb, service, serviceName, wantLb, expectedProbes); changed {
 		dirtyLb = true
 	}
@@ -1724,7 +2109,19 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 	if changed := az.reconcileLBRules(lb, service, serviceName, wantLb, expectedRules); changed {
 		dirtyLb = true
 	}
-	if changed := az.ensureLoadBalancerTagged(lb); changed {
+	if changed := az.ensureLoadBalancerTagged(clusterName, lb); changed {
+		dirtyLb = true
+	}
+	ipv6OutboundChanged, ipv6OutboundPIPToDelete, err := az.reconcileIPv6OutboundRule(clusterName, lb)
+	if err != nil {
+		return nil, err
+	}
+	if ipv6OutboundChanged {
+		dirtyLb = true
+	}
+	if changed, err := az.reconcileNodePoolOutboundRules(lb, nodes); err != nil {
+		return nil, err
+	} else if changed {
 		dirtyLb = true
 	}
 
@@ -1756,6 +2153,9 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 			}
 		} else {
 			klog.V(2).Infof("reconcileLoadBalancer: reconcileLoadBalancer for service(%s): lb(%s) - updating", serviceName, lbName)
+			if err := az.checkLoadBalancerLimits(service, lb); err != nil {
+				return nil, err
+			}
 			err := az.CreateOrUpdateLB(service, *lb)
 			if err != nil {
 				klog.Errorf("reconcileLoadBalancer for service(%s) abort backoff: lb(%s) - updating: %s", serviceName, lbName, err.Error())
@@ -1774,9 +2174,37 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 			lb = newLB
 
 			addOrUpdateLBInList(existingLBs, newLB)
+
+			if isTransitioningToLocalService {
+				az.Event(service, v1.EventTypeNormal, "ExternalTrafficPolicyTransition", "Switched the load balancing rules to the dedicated backend pools")
+			}
+		}
+	}
+
+	// The public IP of the IPv6 outbound rule can only be deleted after it is released by the load balancer.
+	if ipv6OutboundPIPToDelete != "" {
+		klog.V(2).Infof("reconcileLoadBalancer for service(%s): deleting the public IP %s of the IPv6 outbound rule", serviceName, ipv6OutboundPIPToDelete)
+		if err := az.DeletePublicIP(service, az.ResourceGroup, ipv6OutboundPIPToDelete); err != nil {
+			return nil, err
 		}
 	}
 
+	if isTransitioningToClusterService {
+		az.Event(service, v1.EventTypeNormal, "ExternalTrafficPolicyTransition", "Switched the load balancing rules to the shared backend pools")
+		existingLBs, err = az.cleanupLocalServiceBackendPool(service, nodes, existingLBs, clusterName)
+		if err != nil {
+			klog.Errorf("reconcileLoadBalancer: failed to cleanup local service backend pool for service %q, error: %s", serviceName, err.Error())
+			return nil, err
+		}
+		for i := range *existingLBs {
+			if strings.EqualFold(pointer.StringDeref((*existingLBs)[i].Name, ""), lbName) {
+				lb = &(*existingLBs)[i]
+				break
+			}
+		}
+		az.Event(service, v1.EventTypeNormal, "ExternalTrafficPolicyTransition", "Deleted the dedicated backend pools of the service")
+	}
+
 	if wantLb && nodes != nil && !isBackendPoolPreConfigured {
 		// Add the machines to the backend pool if they're not already
 		vmSetName := az.mapLoadBalancerNameToVMSet(lbName, clusterName)
@@ -1855,6 +2283,7 @@ func (az *Cloud) removeNodeFromLBConfig(nodeNameToLBConfigIDXMap map[string]int,
 		az.multipleStandardLoadBalancersActiveNodesLock.Lock()
 		az.MultipleStandardLoadBalancerConfigurations[idx].ActiveNodes.Delete(strings.ToLower(nodeName))
 		az.multipleStandardLoadBalancersActiveNodesLock.Unlock()
+		az.setNodeLoadBalancerName(strings.ToLower(nodeName), "")
 	}
 }
 
@@ -1899,11 +2328,16 @@ func (az *Cloud) accommodateNodesByPrimaryVMSet(
 			continue
 		}
 
+		// The scale sets of the VMSS instances are known from their provider IDs.
 		// TODO(niqi): reduce the API calls for VMAS and standalone VMs
-		vmSetName, err := az.VMSet.GetNodeVMSetName(node)
-		if err != nil {
-			klog.Errorf("accommodateNodesByPrimaryVMSet: failed to get vmSetName for node(%s): %s", node.Name, err.Error())
-			return err
+		vmSetName := az.getNodeVMSetNameFromTopology(node.Name)
+		if vmSetName == "" {
+			var err error
+			vmSetName, err = az.VMSet.GetNodeVMSetName(node)
+			if err != nil {
+				klog.Errorf("accommodateNodesByPrimaryVMSet: failed to get vmSetName for node(%s): %s", node.Name, err.Error())
+				return err
+			}
 		}
 		for i := range az.MultipleStandardLoadBalancerConfigurations {
 			multiSLBConfig := az.MultipleStandardLoadBalancerConfigurations[i]
@@ -1923,6 +2357,7 @@ func (az *Cloud) accommodateNodesByPrimaryVMSet(
 					az.multipleStandardLoadBalancersActiveNodesLock.Lock()
 					az.MultipleStandardLoadBalancerConfigurations[i].ActiveNodes = safeAddKeyToStringsSet(az.MultipleStandardLoadBalancerConfigurations[i].ActiveNodes, strings.ToLower(node.Name))
 					az.multipleStandardLoadBalancersActiveNodesLock.Unlock()
+					az.setNodeLoadBalancerName(strings.ToLower(node.Name), multiSLBConfig.Name)
 				}
 				break
 			}
@@ -2022,6 +2457,7 @@ func (az *Cloud) accommodateNodesByNodeSelector(
 		az.multipleStandardLoadBalancersActiveNodesLock.Lock()
 		az.MultipleStandardLoadBalancerConfigurations[minNodesIDX].ActiveNodes = safeAddKeyToStringsSet(az.MultipleStandardLoadBalancerConfigurations[minNodesIDX].ActiveNodes, strings.ToLower(node.Name))
 		az.multipleStandardLoadBalancersActiveNodesLock.Unlock()
+		az.setNodeLoadBalancerName(strings.ToLower(node.Name), az.MultipleStandardLoadBalancerConfigurations[minNodesIDX].Name)
 	}
 
 	return nil
@@ -2106,9 +2542,11 @@ func (az *Cloud) reconcileLBProbes(lb *network.LoadBalancer, service *v1.Service
 	if lb.Probes != nil {
 		updatedProbes = *lb.Probes
 	}
+	// the prefix is computed once for the load balancers shared by thousands of rules
+	rulePrefix := az.getRulePrefix(service)
 	for i := len(updatedProbes) - 1; i >= 0; i-- {
 		existingProbe := updatedProbes[i]
-		if az.serviceOwnsRule(service, *existingProbe.Name) {
+		if isNameOwnedByPrefix(*existingProbe.Name, rulePrefix) {
 			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb probe(%s) - considering evicting", serviceName, wantLb, *existingProbe.Name)
 			keepProbe := false
 			if findProbe(expectedProbes, existingProbe) {
@@ -2152,9 +2590,10 @@ func (az *Cloud) reconcileLBRules(lb *network.LoadBalancer, service *v1.Service,
 	}
 
 	// update rules: remove unwanted
+	rulePrefix := az.getRulePrefix(service)
 	for i := len(updatedRules) - 1; i >= 0; i-- {
 		existingRule := updatedRules[i]
-		if az.serviceOwnsRule(service, *existingRule.Name) {
+		if isNameOwnedByPrefix(*existingRule.Name, rulePrefix) {
 			keepRule := false
 			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb rule(%s) - considering evicting", serviceName, wantLb, *existingRule.Name)
 			if findRule(expectedRules, existingRule, wantLb) {
@@ -2251,7 +2690,16 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string,
 			if subnetName == nil {
 				subnetName = &az.SubnetName
 			}
-			subnet, existsSubnet, err = az.getSubnet(az.VnetName, *subnetName)
+			allocation, err := parseInternalIPAllocation(service)
+			if err != nil {
+				return nil, toDeleteConfigs, false, err
+			}
+			// The IP configurations of the subnet are required to validate the requested private IP.
+			expand := ""
+			if allocation != nil {
+				expand = subnetIPConfigurationsExpand
+			}
+			subnet, existsSubnet, err = az.GetSubnetWithExpand(az.VnetName, *subnetName, expand)
 			if err != nil {
 				return nil, toDeleteConfigs, false, err
 			}
@@ -2261,6 +2709,18 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string,
 		}
 
 		pipRG := az.getPublicIPAddressResourceGroup(service)
+		additionalFrontendCount, err := getAdditionalFrontendCount(service)
+		if err != nil {
+			return nil, toDeleteConfigs, false, err
+		}
+
+		adopted, err := az.adoptFrontendIPConfigs(clusterName, service, lb, newConfigs, lbFrontendIPConfigNames)
+		if err != nil {
+			return nil, toDeleteConfigs, false, err
+		}
+		if adopted {
+			dirtyConfigs = true
+		}
 
 		for i := len(newConfigs) - 1; i >= 0; i-- {
 			config := newConfigs[i]
@@ -2270,6 +2730,15 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string,
 				continue
 			}
 			klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): checking owned frontend IP configuration %s", serviceName, pointer.StringDeref(config.Name, ""))
+			if index := az.getAdditionalFrontendIndex(service, pointer.StringDeref(config.Name, "")); index > 0 {
+				if index > additionalFrontendCount {
+					klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb additional frontendconfig(%s) - dropping", serviceName, wantLb, *config.Name)
+					toDeleteConfigs = append(toDeleteConfigs, newConfigs[i])
+					newConfigs = append(newConfigs[:i], newConfigs[i+1:]...)
+					dirtyConfigs = true
+				}
+				continue
+			}
 			var isIPv6 bool
 			var err error
 			if fipIPVersion != "" {
@@ -2328,7 +2797,21 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string,
 					}
 					return privateIP != ""
 				}
-				if loadBalancerIP != "" {
+				var currentIPs []string
+				if status != nil {
+					for _, ingress := range status.Ingress {
+						currentIPs = append(currentIPs, ingress.IP)
+					}
+				}
+				allocatedIP, err := getInternalIPAllocationPrivateIP(service, &subnet, isIPv6, currentIPs)
+				if err != nil {
+					return err
+				}
+				if allocatedIP != "" {
+					klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): use private IP %q from annotation %s", serviceName, allocatedIP, consts.ServiceAnnotationLoadBalancerInternalIPAllocation)
+					configProperties.PrivateIPAllocationMethod = network.Static
+					configProperties.PrivateIPAddress = pointer.String(allocatedIP)
+				} else if loadBalancerIP != "" {
 					klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): use loadBalancerIP %q from Service spec", serviceName, loadBalancerIP)
 					configProperties.PrivateIPAllocationMethod = network.Static
 					configProperties.PrivateIPAddress = &loadBalancerIP
@@ -2387,6 +2870,23 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string,
 				return nil, toDeleteConfigs, false, err
 			}
 		}
+
+		existingFIPNames := make(map[string]bool)
+		for _, config := range newConfigs {
+			existingFIPNames[strings.ToLower(pointer.StringDeref(config.Name, ""))] = true
+		}
+		for i := 1; i <= additionalFrontendCount; i++ {
+			if existingFIPNames[strings.ToLower(az.getAdditionalFrontendIPConfigName(service, i))] {
+				continue
+			}
+			newConfig, err := az.newAdditionalFrontendIPConfig(clusterName, service, lbName, i)
+			if err != nil {
+				return nil, toDeleteConfigs, false, err
+			}
+			newConfigs = append(newConfigs, newConfig)
+			klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb additional frontendconfig(%s) - adding", serviceName, wantLb, pointer.StringDeref(newConfig.Name, ""))
+			dirtyConfigs = true
+		}
 	}
 
 	if dirtyConfigs {
@@ -2434,7 +2934,11 @@ func (az *Cloud) checkLoadBalancerResourcesConflicts(
 	if service.Spec.Ports == nil {
 		return nil
 	}
-	ports := service.Spec.Ports
+	// the rules of the service are exposed on the frontend ports
+	ports, err := getServiceFrontendPorts(service)
+	if err != nil {
+		return err
+	}
 
 	for _, port := range ports {
 		if lb.LoadBalancingRules != nil {
@@ -2541,8 +3045,9 @@ func (az *Cloud) getExpectedLBRules(
 	// take precedence over user defined probe configuration
 	// healthcheck proxy server serves http requests
 	// https://github.com/kubernetes/kubernetes/blob/7c013c3f64db33cf19f38bb2fc8d9182e42b0b7b/pkg/proxy/healthcheck/service_health.go#L236
+	// The node level health checks are skipped if the pods are the backends.
 	var nodeEndpointHealthprobe *network.Probe
-	if servicehelpers.NeedsHealthCheck(service) && !(consts.IsPLSEnabled(service.Annotations) && consts.IsPLSProxyProtocolEnabled(service.Annotations)) {
+	if servicehelpers.NeedsHealthCheck(service) && !az.usePodIPBackendPool() && !isPLSProxyProtocolEnabled(service) {
 		podPresencePath, podPresencePort := servicehelpers.GetServiceHealthCheckPathPort(service)
 		lbRuleName := az.getLoadBalancerRuleName(service, v1.ProtocolTCP, podPresencePort, isIPv6)
 		probeInterval, numberOfProbes, err := az.getHealthProbeConfigProbeIntervalAndNumOfProbe(service, podPresencePort)
@@ -2556,12 +3061,25 @@ func (az *Cloud) getExpectedLBRules(
 				Protocol:          network.ProbeProtocolHTTP,
 				Port:              pointer.Int32(podPresencePort),
 				IntervalInSeconds: probeInterval,
-				ProbeThreshold:    numberOfProbes,
 			},
 		}
+		az.setProbeNumberOfProbes(nodeEndpointHealthprobe.ProbePropertiesFormat, numberOfProbes)
 		expectedProbes = append(expectedProbes, *nodeEndpointHealthprobe)
 	}
 
+	// For services with externalTrafficPolicy=Cluster, all probes can be pointed to a
+	// node level health check target, e.g., the healthz endpoint of kube-proxy.
+	if nodeEndpointHealthprobe == nil && !az.usePodIPBackendPool() {
+		targetProbe, err := az.buildHealthProbeForTarget(service, isIPv6)
+		if err != nil {
+			return nil, nil, err
+		}
+		if targetProbe != nil {
+			nodeEndpointHealthprobe = targetProbe
+			expectedProbes = append(expectedProbes, *nodeEndpointHealthprobe)
+		}
+	}
+
 	// In HA mode, lb forward traffic of all port to backend
 	// HA mode is only supported on standard loadbalancer SKU in internal mode
 	if consts.IsK8sServiceUsingInternalLoadBalancer(service) &&
@@ -2575,10 +3093,21 @@ func (az *Cloud) getExpectedLBRules(
 		if err != nil {
 			return nil, nil, fmt.Errorf("error generate lb rule for ha mod loadbalancer. err: %w", err)
 		}
+		probePorts, err := getHAModeHealthProbePorts(service)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(probePorts) == 0 && nodeEndpointHealthprobe != nil {
+			return nil, nil, fmt.Errorf("the health probe of the HA ports rule cannot be disabled for service %s using externalTrafficPolicy=Local or annotation %s",
+				service.Name, consts.ServiceAnnotationLoadBalancerHealthProbeTarget)
+		}
 		//Here we need to find one health probe rule for the HA lb rule.
 		if nodeEndpointHealthprobe == nil {
+			if len(probePorts) == 0 {
+				klog.V(2).Infof("getExpectedLBRules lb name (%s) rule name (%s) no health probe required", lbName, lbRuleName)
+			}
 			// use user customized health probe rule if any
-			for _, port := range service.Spec.Ports {
+			for _, port := range probePorts {
 				portprobe, err := az.buildHealthProbeRulesForPort(service, port, lbRuleName)
 				if err != nil {
 					klog.V(2).ErrorS(err, "error occurred when buildHealthProbeRulesForPort", "service", service.Name, "namespace", service.Namespace,
@@ -2605,10 +3134,22 @@ func (az *Cloud) getExpectedLBRules(
 		})
 		// end of HA mode handling
 	} else {
-		// generate lb rule for each port defined in svc object
+		if _, err := getServiceFrontendPorts(service); err != nil {
+			return expectedProbes, expectedRules, err
+		}
 
+		// generate lb rule for each port defined in svc object
+		combinedPorts := az.getProtocolCombinedPorts(service, isIPv6)
 		for _, port := range service.Spec.Ports {
-			lbRuleName := az.getLoadBalancerRuleName(service, port.Protocol, port.Port, isIPv6)
+			ruleProtocol := port.Protocol
+			if combinedPorts[port.Port] {
+				// the UDP port is folded into the rule of the TCP port with the same port number
+				if port.Protocol == v1.ProtocolUDP {
+					continue
+				}
+				ruleProtocol = v1.Protocol(network.TransportProtocolAll)
+			}
+			lbRuleName := az.getLoadBalancerRuleName(service, ruleProtocol, port.Port, isIPv6)
 			klog.V(2).Infof("getExpectedLBRules lb name (%s) rule name (%s)", lbName, lbRuleName)
 			isNoLBRuleRequired, err := consts.IsLBRuleOnK8sServicePortDisabled(service.Annotations, port.Port)
 			if err != nil {
@@ -2628,6 +3169,10 @@ func (az *Cloud) getExpectedLBRules(
 			if err != nil {
 				return expectedProbes, expectedRules, fmt.Errorf("failed to parse transport protocol: %w", err)
 			}
+			if combinedPorts[port.Port] {
+				allProto := network.TransportProtocolAll
+				transportProto = &allProto
+			}
 			props, err := az.getExpectedLoadBalancingRulePropertiesForPort(service, lbFrontendIPConfigID, lbBackendPoolID, port, *transportProto)
 			if err != nil {
 				return expectedProbes, expectedRules, fmt.Errorf("error generate lb rule for ha mod loadbalancer. err: %w", err)
@@ -2659,7 +3204,15 @@ func (az *Cloud) getExpectedLBRules(
 					}
 				}
 			}
-			if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) {
+			if az.usePodIPBackendPool() {
+				// The pods in the backend pool receive the traffic at the target ports directly.
+				podPort, err := az.getPodBackendPort(service, port)
+				if err != nil {
+					return expectedProbes, expectedRules, err
+				}
+				props.BackendPort = pointer.Int32(podPort)
+				props.EnableFloatingIP = pointer.Bool(false)
+			} else if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) {
 				props.BackendPort = pointer.Int32(port.NodePort)
 				props.EnableFloatingIP = pointer.Bool(false)
 			}
@@ -2680,9 +3233,14 @@ func (az *Cloud) getExpectedLoadBalancingRulePropertiesForPort(
 	lbBackendPoolID string, servicePort v1.ServicePort, transportProto network.TransportProtocol) (*network.LoadBalancingRulePropertiesFormat, error) {
 	var err error
 
-	loadDistribution := network.LoadDistributionDefault
-	if service.Spec.SessionAffinity == v1.ServiceAffinityClientIP {
-		loadDistribution = network.LoadDistributionSourceIP
+	loadDistribution, err := getLoadDistribution(service, servicePort.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	frontendPort, err := getFrontendPort(service, servicePort)
+	if err != nil {
+		return nil, err
 	}
 
 	var lbIdleTimeout *int32
@@ -2703,7 +3261,7 @@ func (az *Cloud) getExpectedLoadBalancingRulePropertiesForPort(
 
 	props := &network.LoadBalancingRulePropertiesFormat{
 		Protocol:            transportProto,
-		FrontendPort:        pointer.Int32(servicePort.Port),
+		FrontendPort:        pointer.Int32(frontendPort),
 		BackendPort:         pointer.Int32(servicePort.Port),
 		DisableOutboundSnat: pointer.Bool(az.disableLoadBalancerOutboundSNAT()),
 		EnableFloatingIP:    pointer.Bool(true),
@@ -2729,6 +3287,114 @@ func (az *Cloud) getExpectedLoadBalancingRulePropertiesForPort(
 	return props, nil
 }
 
+// getProtocolCombinedPorts returns the port numbers whose TCP and UDP ports are combined into one load balancing
+// rule with protocol All, which requires the annotation ServiceAnnotationLoadBalancerCombineProtocols and a
+// standard load balancer. The ports are only combined if they have the same backend port.
+func (az *Cloud) getProtocolCombinedPorts(service *v1.Service, isIPv6 bool) map[int32]bool {
+	combinedPorts := make(map[int32]bool)
+	if !consts.IsLBRuleProtocolCombinationEnabled(service.Annotations) || !az.useStandardLoadBalancer() {
+		return combinedPorts
+	}
+
+	// the node ports are the backend ports if the floating IP is disabled, which includes the IPv6 internal load balancers
+	useNodePort := consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) || (consts.IsK8sServiceUsingInternalLoadBalancer(service) && isIPv6)
+	tcpPorts := make(map[int32][]v1.ServicePort)
+	udpPorts := make(map[int32][]v1.ServicePort)
+	for _, port := range service.Spec.Ports {
+		if isNoLBRuleRequired, _ := consts.IsLBRuleOnK8sServicePortDisabled(service.Annotations, port.Port); isNoLBRuleRequired {
+			continue
+		}
+		switch port.Protocol {
+		case v1.ProtocolTCP:
+			tcpPorts[port.Port] = append(tcpPorts[port.Port], port)
+		case v1.ProtocolUDP:
+			udpPorts[port.Port] = append(udpPorts[port.Port], port)
+		}
+	}
+	for portNumber, ports := range tcpPorts {
+		if len(ports) != 1 || len(udpPorts[portNumber]) != 1 {
+			continue
+		}
+		if az.usePodIPBackendPool() {
+			tcpPodPort, tcpErr := az.getPodBackendPort(service, ports[0])
+			udpPodPort, udpErr := az.getPodBackendPort(service, udpPorts[portNumber][0])
+			if tcpErr != nil || udpErr != nil || tcpPodPort != udpPodPort {
+				klog.V(2).Infof("getProtocolCombinedPorts: skip combining the TCP and UDP port %d of service %s because the target ports are different",
+					portNumber, getServiceName(service))
+				continue
+			}
+		} else if useNodePort && ports[0].NodePort != udpPorts[portNumber][0].NodePort {
+			klog.V(2).Infof("getProtocolCombinedPorts: skip combining the TCP and UDP port %d of service %s because the node ports are different",
+				portNumber, getServiceName(service))
+			continue
+		}
+		combinedPorts[portNumber] = true
+	}
+	return combinedPorts
+}
+
+// getLoadDistribution returns the load distribution of the load balancing rule for the port. The port annotation
+// takes priority over the service annotation, which takes priority over spec.sessionAffinity.
+func getLoadDistribution(service *v1.Service, port int32) (network.LoadDistribution, error) {
+	loadDistribution := network.LoadDistributionDefault
+	if service.Spec.SessionAffinity == v1.ServiceAffinityClientIP {
+		loadDistribution = network.LoadDistributionSourceIP
+	}
+
+	keys := []string{consts.ServiceAnnotationLoadBalancerSessionPersistence}
+	if port != 0 {
+		keys = append(keys, consts.BuildAnnotationKeyForPort(port, consts.PortAnnotationSessionPersistence))
+	}
+	for _, key := range keys {
+		value, found := service.Annotations[key]
+		if !found {
+			continue
+		}
+		switch {
+		case strings.EqualFold(strings.TrimSpace(value), consts.SessionPersistenceNone):
+			loadDistribution = network.LoadDistributionDefault
+		case strings.EqualFold(strings.TrimSpace(value), consts.SessionPersistenceClientIP):
+			loadDistribution = network.LoadDistributionSourceIP
+		case strings.EqualFold(strings.TrimSpace(value), consts.SessionPersistenceClientIPProtocol):
+			loadDistribution = network.LoadDistributionSourceIPProtocol
+		default:
+			return "", fmt.Errorf("invalid value %q of annotation %s, supported values are %s, %s and %s",
+				value, key, consts.SessionPersistenceNone, consts.SessionPersistenceClientIP, consts.SessionPersistenceClientIPProtocol)
+		}
+	}
+	return loadDistribution, nil
+}
+
+// getHAModeHealthProbePorts returns the ports whose health probe can be attached to the HA ports rule in order.
+// The ports with no_probe_rule are skipped, and the ports with a management port take precedence. Since the
+// HA ports rule has only one health probe, the management ports of all ports must be the same.
+func getHAModeHealthProbePorts(service *v1.Service) ([]v1.ServicePort, error) {
+	var ports, managementPortPorts []v1.ServicePort
+	var managementPort *int32
+	for _, port := range service.Spec.Ports {
+		portManagementPort, err := getHealthProbeManagementPort(service, port.Port)
+		if err != nil {
+			return nil, err
+		}
+		if portManagementPort != nil {
+			if managementPort != nil && *managementPort != *portManagementPort {
+				return nil, fmt.Errorf("the HA ports rule supports only one health probe, but different management ports %d and %d are set", *managementPort, *portManagementPort)
+			}
+			managementPort = portManagementPort
+			managementPortPorts = append(managementPortPorts, port)
+			continue
+		}
+		if isNoHealthProbeRule, _ := consts.IsHealthProbeRuleOnK8sServicePortDisabled(service.Annotations, port.Port); isNoHealthProbeRule {
+			continue
+		}
+		ports = append(ports, port)
+	}
+	if managementPort != nil {
+		return managementPortPorts, nil
+	}
+	return ports, nil
+}
+
 // getExpectedHAModeLoadBalancingRuleProperties build load balancing rule for lb in HA mode
 func (az *Cloud) getExpectedHAModeLoadBalancingRuleProperties(
 	service *v1.Service,
@@ -2786,12 +3452,12 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 	}
 
 	disableFloatingIP := false
-	if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) {
+	if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) || az.usePodIPBackendPool() {
 		disableFloatingIP = true
 	}
 
 	backendIPAddresses := map[bool][]string{}
-	if wantLb && disableFloatingIP {
+	if wantLb && disableFloatingIP && !az.usePodIPBackendPool() {
 		lb, exist, err := az.getAzureLoadBalancer(pointer.StringDeref(lbName, ""), azcache.CacheReadTypeDefault)
 		if err != nil {
 			return nil, err
@@ -2821,10 +3487,16 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 	if len(serviceTags) != 0 {
 		delete(sourceRanges, consts.DefaultLoadBalancerSourceRanges)
 	}
+	// The source ranges of the services exposed by the Azure Firewall are enforced by the DNAT rules, and the
+	// traffic reaching the internal load balancer is SNATed by the firewall.
+	isAzureFirewallDNAT := consts.IsAzureFirewallDNATEnabled(service.Annotations)
+	if isAzureFirewallDNAT {
+		sourceRanges, serviceTags = nil, nil
+	}
 
 	sourceAddressPrefixes := map[bool][]string{}
 	if (sourceRanges == nil || servicehelpers.IsAllowAll(sourceRanges)) && len(serviceTags) == 0 {
-		if !requiresInternalLoadBalancer(service) || len(service.Spec.LoadBalancerSourceRanges) > 0 {
+		if !requiresInternalLoadBalancer(service) || (len(service.Spec.LoadBalancerSourceRanges) > 0 && !isAzureFirewallDNAT) {
 			sourceAddressPrefixes[false] = []string{"Internet"}
 			sourceAddressPrefixes[true] = []string{"Internet"}
 		}
@@ -2857,12 +3529,31 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 			return nil, err
 		}
 	}
+	if description := az.getSecurityRuleDescription(clusterName, service); description != nil {
+		for i := range expectedSecurityRules {
+			expectedSecurityRules[i].Description = description
+		}
+	}
+
+	// verify the health probes from the AzureLoadBalancer service tag are not denied by the security group,
+	// and allow them if EnsureHealthProbeSecurityRule is set
+	var probePorts []int32
+	if wantLb {
+		probePorts, err = az.getHealthProbePorts(service)
+		if err != nil {
+			klog.Warningf("reconcileSecurityGroup(%s): failed to get the health probe ports: %v", serviceName, err)
+		}
+		if sg.SecurityGroupPropertiesFormat != nil && sg.SecurityRules != nil {
+			expectedSecurityRules = append(expectedSecurityRules, az.getExpectedHealthProbeSecurityRules(service, *sg.SecurityRules, probePorts)...)
+		}
+	}
 
 	// update security rules
 	dirtySg, updatedRules, err := az.reconcileSecurityRules(sg, service, serviceName, wantLb, expectedSecurityRules, ports, sourceAddressPrefixes, destinationIPAddresses)
 	if err != nil {
 		return nil, err
 	}
+	az.verifyHealthProbeSecurityRules(service, pointer.StringDeref(sg.Name, ""), updatedRules, probePorts)
 
 	changed := az.ensureSecurityGroupTagged(&sg)
 	if changed {
@@ -2994,6 +3685,18 @@ func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup,
 			klog.V(10).Infof("reconcile(%s)(%t): sg rule(%s) - already exists", serviceName, wantLb, *expectedRule.Name)
 			foundRule = true
 		}
+		if foundRule && !allowsConsolidation(expectedRule) && expectedRule.Description != nil {
+			index, existingRule, _ := findSecurityRuleByName(updatedRules, pointer.StringDeref(expectedRule.Name, ""))
+			if existingRule.SecurityRulePropertiesFormat != nil &&
+				pointer.StringDeref(existingRule.Description, "") != *expectedRule.Description {
+				klog.V(10).Infof("reconcile(%s)(%t): sg rule(%s) - updating description", serviceName, wantLb, *expectedRule.Name)
+				properties := *existingRule.SecurityRulePropertiesFormat
+				properties.Description = expectedRule.Description
+				existingRule.SecurityRulePropertiesFormat = &properties
+				updatedRules[index] = existingRule
+				dirtySg = true
+			}
+		}
 		if foundRule && allowsConsolidation(expectedRule) {
 			index, _ := findConsolidationCandidate(updatedRules, expectedRule)
 			if updatedRules[index].DestinationAddressPrefixes != nil {
@@ -3038,7 +3741,11 @@ func (az *Cloud) getExpectedSecurityRules(wantLb bool, ports []v1.ServicePort, s
 				return nil, err
 			}
 			dstPort := port.Port
-			if disableFloatingIP {
+			if az.usePodIPBackendPool() {
+				if dstPort, err = az.getPodBackendPort(service, port); err != nil {
+					return nil, err
+				}
+			} else if disableFloatingIP {
 				dstPort = port.NodePort
 			}
 			for j := range sourceAddressPrefixes {
@@ -3056,7 +3763,11 @@ func (az *Cloud) getExpectedSecurityRules(wantLb bool, ports []v1.ServicePort, s
 					},
 				}
 
-				if len(destinationIPAddresses) == 1 && disableFloatingIP {
+				if len(destinationIPAddresses) == 1 && az.usePodIPBackendPool() {
+					// The pods are added to and removed from the backend pools without reconciling the
+					// service, so the traffic to the whole virtual network is allowed instead of the pod IPs.
+					nsgRule.DestinationAddressPrefix = pointer.String(consts.VirtualNetworkServiceTag)
+				} else if len(destinationIPAddresses) == 1 && disableFloatingIP {
 					nsgRule.DestinationAddressPrefixes = &(backendIPAddresses)
 				} else if len(destinationIPAddresses) == 1 && !disableFloatingIP {
 					// continue to use DestinationAddressPrefix to avoid NSG updates for existing rules.
@@ -3302,11 +4013,24 @@ func shouldReleaseExistingOwnedPublicIP(existingPip *network.PublicIPAddress, lb
 }
 
 // ensurePIPTagged ensures the public IP of the service is tagged as configured
-func (az *Cloud) ensurePIPTagged(service *v1.Service, pip *network.PublicIPAddress) bool {
-	configTags := parseTags(az.Tags, az.TagsMap)
+func (az *Cloud) ensurePIPTagged(clusterName string, service *v1.Service, pip *network.PublicIPAddress) bool {
+	configTags := az.getConfigTags(consts.TagTemplateResourcePublicIPAddress, newServiceTagTemplateValues(clusterName, service))
+	serviceTags, err := getServiceResourceTags(service)
+	if err != nil {
+		// the annotation is validated before reconciling the service
+		klog.Warningf("ensurePIPTagged: ignoring the invalid tags of service %s: %v", getServiceName(service), err)
+	}
 	annotationTags := make(map[string]*string)
+	for k, v := range serviceTags {
+		annotationTags[k] = v
+	}
 	if _, ok := service.Annotations[consts.ServiceAnnotationAzurePIPTags]; ok {
-		annotationTags = parseTags(service.Annotations[consts.ServiceAnnotationAzurePIPTags], map[string]string{})
+		for k, v := range parseTags(service.Annotations[consts.ServiceAnnotationAzurePIPTags], map[string]string{}) {
+			if found, key := findKeyInMapCaseInsensitive(annotationTags, k); found {
+				delete(annotationTags, key)
+			}
+			annotationTags[k] = v
+		}
 	}
 
 	for k, v := range annotationTags {
@@ -3319,9 +4043,9 @@ func (az *Cloud) ensurePIPTagged(service *v1.Service, pip *network.PublicIPAddre
 	}
 
 	// include the cluster name and service names tags when comparing
-	var clusterName, serviceNames, serviceNameUsingDNS *string
+	var clusterNameTag, serviceNames, serviceNameUsingDNS *string
 	if v := getClusterFromPIPClusterTags(pip.Tags); v != "" {
-		clusterName = &v
+		clusterNameTag = &v
 	}
 	if v := getServiceFromPIPServiceTags(pip.Tags); v != "" {
 		serviceNames = &v
@@ -3329,8 +4053,8 @@ func (az *Cloud) ensurePIPTagged(service *v1.Service, pip *network.PublicIPAddre
 	if v := getServiceFromPIPDNSTags(pip.Tags); v != "" {
 		serviceNameUsingDNS = &v
 	}
-	if clusterName != nil {
-		configTags[consts.ClusterNameKey] = clusterName
+	if clusterNameTag != nil {
+		configTags[consts.ClusterNameKey] = clusterNameTag
 	}
 	if serviceNames != nil {
 		configTags[consts.ServiceTagKey] = serviceNames
@@ -3339,10 +4063,11 @@ func (az *Cloud) ensurePIPTagged(service *v1.Service, pip *network.PublicIPAddre
 		configTags[consts.ServiceUsingDNSKey] = serviceNameUsingDNS
 	}
 
+	removed := reconcileServiceResourceTags(pip.Tags, configTags, serviceTags)
 	tags, changed := az.reconcileTags(pip.Tags, configTags)
 	pip.Tags = tags
 
-	return changed
+	return changed || removed
 }
 
 // reconcilePublicIPs reconciles the PublicIP resources similar to how the LB is reconciled.
@@ -3478,7 +4203,13 @@ func (az *Cloud) getPublicIPUpdates(
 		deletedDesiredPublicIP    bool
 		pipsToBeDeleted           []*network.PublicIPAddress
 		pipsToBeUpdated           []*network.PublicIPAddress
+		additionalPIPNames        map[string]bool
 	)
+	if wantLb && !isInternal && !isIPv6 {
+		if additionalPIPNames, err = az.getAdditionalPublicIPNames(clusterName, service); err != nil {
+			return false, nil, false, nil, err
+		}
+	}
 	for i := range pips {
 		pip := pips[i]
 		if pip.PublicIPAddressPropertiesFormat != nil && pip.PublicIPAddressPropertiesFormat.PublicIPAddressVersion != "" {
@@ -3510,12 +4241,37 @@ func (az *Cloud) getPublicIPUpdates(
 				dirtyPIP = true
 			}
 			if !isUserAssignedPIP {
-				changed := az.ensurePIPTagged(service, &pip)
+				changed := az.ensurePIPTagged(clusterName, service, &pip)
 				if changed {
+					// the invalid tags do not block releasing the public IP of the deleted service
+					if wantLb {
+						if err := az.ensureResourceTagsValid(service, pipName, pip.Tags); err != nil {
+							return false, nil, false, nil, err
+						}
+					}
 					dirtyPIP = true
 				}
 			}
-			if shouldReleaseExistingOwnedPublicIP(&pip, wantLb, isInternal, isUserAssignedPIP, desiredPipName, serviceIPTagRequest) {
+			// The public IPs of the additional frontends are kept besides the desired one.
+			shouldRelease := !additionalPIPNames[pipName] &&
+				shouldReleaseExistingOwnedPublicIP(&pip, wantLb, isInternal, isUserAssignedPIP, desiredPipName, serviceIPTagRequest)
+			isInPool := isPublicIPClaimedFromPool(&pip) || isPublicIPInServicePool(service, &pip)
+			if shouldRelease && (consts.IsPublicIPRetained(service.Annotations) || isInPool) {
+				// Keep the public ip and only remove the service from its tags.
+				klog.V(2).Infof("reconcilePublicIP for service(%s): retaining pip %s", serviceName, pipName)
+				if wantLb {
+					if err = unbindServiceFromPIP(&pip, service, serviceName, clusterName, isUserAssignedPIP); err != nil {
+						return false, nil, false, nil, err
+					}
+				}
+				if isInPool {
+					returnPublicIPToPool(&pip)
+					az.Event(service, v1.EventTypeNormal, "ReturnedPublicIPToPool", fmt.Sprintf("The public IP %s is returned to the pool", pipName))
+				} else {
+					az.Event(service, v1.EventTypeNormal, "RetainedPublicIP", fmt.Sprintf("The public IP %s is retained and no longer owned by the service", pipName))
+				}
+				dirtyPIP = true
+			} else if shouldRelease {
 				// Then, release the public ip
 				pipsToBeDeleted = append(pipsToBeDeleted, &pip)
 
@@ -3547,7 +4303,7 @@ func (az *Cloud) getPublicIPUpdates(
 func (az *Cloud) safeDeletePublicIP(service *v1.Service, pipResourceGroup string, pip *network.PublicIPAddress, lb *network.LoadBalancer) error {
 	// Remove references if pip.IPConfiguration is not nil.
 	if pip.PublicIPAddressPropertiesFormat != nil &&
-		pip.PublicIPAddressPropertiesFormat.IPConfiguration != nil {
+		(pip.PublicIPAddressPropertiesFormat.IPConfiguration != nil || pip.PublicIPAddressPropertiesFormat.NatGateway != nil) {
 		// Fetch latest pip to check if the pip in the cache is stale.
 		// In some cases the public IP to be deleted is still referencing
 		// the frontend IP config on the LB. This is because the pip is
@@ -3557,6 +4313,11 @@ func (az *Cloud) safeDeletePublicIP(service *v1.Service, pipResourceGroup string
 			klog.Errorf("safeDeletePublicIP: failed to get latest public IP %s/%s: %s", pipResourceGroup, *pip.Name, err.Error())
 			return err
 		}
+		if ok {
+			if blocker := getPublicIPDeletionBlocker(&latestPIP, lb); blocker != "" {
+				return az.skipDeletingPublicIP(service, pipResourceGroup, pip, &latestPIP, blocker)
+			}
+		}
 		if ok && latestPIP.PublicIPAddressPropertiesFormat != nil &&
 			latestPIP.PublicIPAddressPropertiesFormat.IPConfiguration != nil &&
 			lb != nil && lb.LoadBalancerPropertiesFormat != nil &&
@@ -3633,6 +4394,59 @@ func (az *Cloud) safeDeletePublicIP(service *v1.Service, pipResourceGroup string
 	return nil
 }
 
+// getPublicIPDeletionBlocker returns the reason why the public IP cannot be deleted safely, or an empty string if it
+// can. The public IP is shared and must be kept if it is associated with a NAT gateway, if it is referenced by an IP
+// configuration other than the frontend IP configurations of the given load balancer, e.g. the frontends of other load
+// balancers or network interfaces, or if its frontend IP configuration is used by inbound NAT rules, inbound NAT pools
+// or outbound rules.
+func getPublicIPDeletionBlocker(pip *network.PublicIPAddress, lb *network.LoadBalancer) string {
+	if pip.PublicIPAddressPropertiesFormat == nil {
+		return ""
+	}
+	if pip.NatGateway != nil {
+		return fmt.Sprintf("it is associated with the NAT gateway %s", pointer.StringDeref(pip.NatGateway.ID, ""))
+	}
+	if pip.IPConfiguration == nil {
+		return ""
+	}
+	ipConfigurationID := pointer.StringDeref(pip.IPConfiguration.ID, "")
+	if ipConfigurationID == "" {
+		return ""
+	}
+	if lb != nil && lb.LoadBalancerPropertiesFormat != nil && lb.FrontendIPConfigurations != nil {
+		for _, config := range *lb.FrontendIPConfigurations {
+			if !strings.EqualFold(ipConfigurationID, pointer.StringDeref(config.ID, "")) {
+				continue
+			}
+			if config.FrontendIPConfigurationPropertiesFormat != nil &&
+				((config.InboundNatRules != nil && len(*config.InboundNatRules) > 0) ||
+					(config.InboundNatPools != nil && len(*config.InboundNatPools) > 0) ||
+					(config.OutboundRules != nil && len(*config.OutboundRules) > 0)) {
+				return fmt.Sprintf("its frontend IP configuration %s is used by inbound NAT rules, inbound NAT pools or outbound rules", ipConfigurationID)
+			}
+			return ""
+		}
+	}
+	return fmt.Sprintf("it is referenced by the IP configuration %s", ipConfigurationID)
+}
+
+// skipDeletingPublicIP keeps the shared public IP instead of deleting it. The service is removed from the tags of
+// the public IP, so that it is not released again in the following reconciliations.
+func (az *Cloud) skipDeletingPublicIP(service *v1.Service, pipResourceGroup string, pip, latestPIP *network.PublicIPAddress, reason string) error {
+	serviceName := getServiceName(service)
+	pipName := pointer.StringDeref(pip.Name, "")
+	klog.Warningf("safeDeletePublicIP for service(%s): skip deleting public IP %s/%s because %s", serviceName, pipResourceGroup, pipName, reason)
+	az.Event(service, v1.EventTypeWarning, "SkippedPublicIPDeletion", fmt.Sprintf("The public IP %s is not deleted because %s", pipName, reason))
+
+	latestPIP.Tags = pip.Tags
+	if latestPIP.Tags != nil && isSVCNameInPIPTag(getServiceFromPIPServiceTags(latestPIP.Tags), serviceName) {
+		if err := unbindServiceFromPIP(latestPIP, service, serviceName, "", false); err != nil {
+			return err
+		}
+	}
+	return az.CreateOrUpdatePIP(service, pipResourceGroup, *latestPIP)
+}
+
 func findRule(rules []network.LoadBalancingRule, rule network.LoadBalancingRule, wantLB bool) bool {
 	for _, existingRule := range rules {
 		if strings.EqualFold(pointer.StringDeref(existingRule.Name, ""), pointer.StringDeref(rule.Name, "")) &&
@@ -3662,7 +4476,7 @@ func equalLoadBalancingRulePropertiesFormat(s *network.LoadBalancingRuleProperti
 
 	properties = properties && equalSubResource(s.FrontendIPConfiguration, t.FrontendIPConfiguration) &&
 		equalSubResource(s.BackendAddressPool, t.BackendAddressPool) &&
-		reflect.DeepEqual(s.LoadDistribution, t.LoadDistribution) &&
+		equalLoadDistribution(s.LoadDistribution, t.LoadDistribution) &&
 		reflect.DeepEqual(s.FrontendPort, t.FrontendPort) &&
 		reflect.DeepEqual(s.BackendPort, t.BackendPort) &&
 		equalSubResource(s.Probe, t.Probe) &&
@@ -3675,6 +4489,17 @@ func equalLoadBalancingRulePropertiesFormat(s *network.LoadBalancingRuleProperti
 	return properties
 }
 
+// equalLoadDistribution checks whether the load distributions are equal, an empty load distribution is Default.
+func equalLoadDistribution(s, t network.LoadDistribution) bool {
+	if s == "" {
+		s = network.LoadDistributionDefault
+	}
+	if t == "" {
+		t = network.LoadDistributionDefault
+	}
+	return strings.EqualFold(string(s), string(t))
+}
+
 func equalSubResource(s *network.SubResource, t *network.SubResource) bool {
 	if s == nil && t == nil {
 		return true
@@ -3753,8 +4578,12 @@ func (az *Cloud) isBackendPoolPreConfigured(service *v1.Service) bool {
 	return preConfigured
 }
 
-// Check if service requires an internal load balancer.
+// Check if service requires an internal load balancer. The services exposed by the DNAT rules of the Azure Firewall
+// always use the internal load balancer.
 func requiresInternalLoadBalancer(service *v1.Service) bool {
+	if consts.IsAzureFirewallDNATEnabled(service.Annotations) {
+		return true
+	}
 	if l, found := service.Annotations[consts.ServiceAnnotationLoadBalancerInternal]; found {
 		return l == consts.TrueAnnotationValue
 	}
@@ -3763,6 +4592,9 @@ func requiresInternalLoadBalancer(service *v1.Service) bool {
 }
 
 func getInternalSubnet(service *v1.Service) *string {
+	if allocation, err := parseInternalIPAllocation(service); err == nil && allocation != nil {
+		return &allocation.subnetName
+	}
 	if requiresInternalLoadBalancer(service) {
 		if l, found := service.Annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet]; found && strings.TrimSpace(l) != "" {
 			return &l
@@ -4019,11 +4851,14 @@ func unbindServiceFromPIP(pip *network.PublicIPAddress, service *v1.Service,
 }
 
 // ensureLoadBalancerTagged ensures every load balancer in the resource group is tagged as configured
-func (az *Cloud) ensureLoadBalancerTagged(lb *network.LoadBalancer) bool {
-	if az.Tags == "" && (az.TagsMap == nil || len(az.TagsMap) == 0) {
+func (az *Cloud) ensureLoadBalancerTagged(clusterName string, lb *network.LoadBalancer) bool {
+	if !az.hasConfigTags(consts.TagTemplateResourceLoadBalancer) {
 		return false
 	}
-	tags := parseTags(az.Tags, az.TagsMap)
+	tags := az.getConfigTags(consts.TagTemplateResourceLoadBalancer, tagTemplateValues{
+		clusterName: clusterName,
+		nodePool:    az.getLoadBalancerNodePool(pointer.StringDeref(lb.Name, ""), clusterName),
+	})
 	if lb.Tags == nil {
 		lb.Tags = make(map[string]*string)
 	}
@@ -4081,6 +4916,7 @@ func (az *Cloud) getAzureLoadBalancerName(
 		}
 
 		currentLBName := az.getServiceCurrentLoadBalancerName(service)
+		eligibleLBs = az.filterLoadBalancersWithinLimits(service, currentLBName, eligibleLBs, isInternal)
 		lbNamePrefix = getMostEligibleLBForService(currentLBName, eligibleLBs, existingLBs)
 	}
 
@@ -4290,7 +5126,7 @@ func (az *Cloud) isLoadBalancerInUseByService(service *v1.Service, lbConfig Mult
 func (az *Cloud) serviceOwnsFrontendIP(fip network.FrontendIPConfiguration, service *v1.Service) (bool, bool, network.IPVersion) {
 	var isPrimaryService bool
 	baseName := az.GetLoadBalancerName(context.TODO(), "", service)
-	if strings.HasPrefix(pointer.StringDeref(fip.Name, ""), baseName) {
+	if isNameOwnedByPrefix(pointer.StringDeref(fip.Name, ""), baseName) {
 		klog.V(6).Infof("serviceOwnsFrontendIP: found primary service %s of the frontend IP config %s", service.Name, *fip.Name)
 		isPrimaryService = true
 		return true, isPrimaryService, ""
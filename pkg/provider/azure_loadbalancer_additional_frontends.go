@@ -0,0 +1,153 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// getAdditionalFrontendCount returns the number of additional IPv4 frontend IP configurations requested by
+// ServiceAnnotationLoadBalancerAdditionalFrontends.
+func getAdditionalFrontendCount(service *v1.Service) (int, error) {
+	count, err := consts.Getint32ValueFromK8sSvcAnnotation(service.Annotations, consts.ServiceAnnotationLoadBalancerAdditionalFrontends, func(val *int32) error {
+		if *val < 0 || *val > consts.MaxAdditionalFrontends {
+			return fmt.Errorf("the value must be between 0 and %d", consts.MaxAdditionalFrontends)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse annotation %s: %w", consts.ServiceAnnotationLoadBalancerAdditionalFrontends, err)
+	}
+	if count == nil || *count == 0 {
+		return 0, nil
+	}
+	if requiresInternalLoadBalancer(service) {
+		return 0, fmt.Errorf("annotation %s is only supported by external services", consts.ServiceAnnotationLoadBalancerAdditionalFrontends)
+	}
+	if v4Enabled, _ := getIPFamiliesEnabled(service); !v4Enabled {
+		return 0, fmt.Errorf("annotation %s requires the IPv4 family of the service", consts.ServiceAnnotationLoadBalancerAdditionalFrontends)
+	}
+	if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) {
+		// The load balancing rules of the frontends share the same backend ports, which requires the floating IP.
+		return 0, fmt.Errorf("annotation %s cannot be used together with %s", consts.ServiceAnnotationLoadBalancerAdditionalFrontends, consts.ServiceAnnotationDisableLoadBalancerFloatingIP)
+	}
+	return int(*count), nil
+}
+
+// getAdditionalFrontendIPConfigName returns the name of the additional frontend IP configuration with the index.
+func (az *Cloud) getAdditionalFrontendIPConfigName(service *v1.Service, index int) string {
+	return fmt.Sprintf("%s-%d", az.getFrontendIPConfigNames(service)[consts.IPVersionIPv4], index)
+}
+
+// getAdditionalFrontendIndex returns the index of the additional frontend IP configuration, or 0 if the frontend
+// IP configuration is not an additional one of the service.
+func (az *Cloud) getAdditionalFrontendIndex(service *v1.Service, fipName string) int {
+	prefix := az.getFrontendIPConfigNames(service)[consts.IPVersionIPv4] + "-"
+	if len(fipName) <= len(prefix) || !strings.EqualFold(fipName[:len(prefix)], prefix) {
+		return 0
+	}
+	index, err := strconv.Atoi(fipName[len(prefix):])
+	if err != nil || index < 1 {
+		return 0
+	}
+	return index
+}
+
+// getAdditionalPublicIPName returns the name of the managed public IP of the additional frontend IP configuration.
+func (az *Cloud) getAdditionalPublicIPName(clusterName string, service *v1.Service, index int) (string, error) {
+	pipName, err := az.getPublicIPName(clusterName, service, consts.IPVersionIPv4)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d", pipName, index), nil
+}
+
+// getAdditionalPublicIPNames returns the names of the managed public IPs of the additional frontend IP
+// configurations of the service.
+func (az *Cloud) getAdditionalPublicIPNames(clusterName string, service *v1.Service) (map[string]bool, error) {
+	count, err := getAdditionalFrontendCount(service)
+	if err != nil {
+		return nil, err
+	}
+	pipNames := make(map[string]bool)
+	for i := 1; i <= count; i++ {
+		pipName, err := az.getAdditionalPublicIPName(clusterName, service, i)
+		if err != nil {
+			return nil, err
+		}
+		pipNames[pipName] = true
+	}
+	return pipNames, nil
+}
+
+// newAdditionalFrontendIPConfig ensures the public IP of the additional frontend IP configuration with the index
+// and returns the frontend IP configuration referencing it.
+func (az *Cloud) newAdditionalFrontendIPConfig(clusterName string, service *v1.Service, lbName string, index int) (network.FrontendIPConfiguration, error) {
+	pipName, err := az.getAdditionalPublicIPName(clusterName, service, index)
+	if err != nil {
+		return network.FrontendIPConfiguration{}, err
+	}
+	pip, err := az.ensurePublicIPExists(service, pipName, "", clusterName, false, false, consts.IPVersionIPv4)
+	if err != nil {
+		return network.FrontendIPConfiguration{}, err
+	}
+	fipName := az.getAdditionalFrontendIPConfigName(service, index)
+	return network.FrontendIPConfiguration{
+		Name: pointer.String(fipName),
+		ID:   pointer.String(fmt.Sprintf(consts.FrontendIPConfigIDTemplate, az.getNetworkResourceSubscriptionID(), az.ResourceGroup, lbName, fipName)),
+		FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+			PublicIPAddress: &network.PublicIPAddress{ID: pip.ID},
+		},
+	}, nil
+}
+
+// getExpectedAdditionalFrontendLBRules duplicates the IPv4 load balancing rules of the service for each additional
+// frontend IP configuration. The duplicated rules share the health probes of the original ones.
+func (az *Cloud) getExpectedAdditionalFrontendLBRules(service *v1.Service, lbName string, rules []network.LoadBalancingRule) ([]network.LoadBalancingRule, error) {
+	count, err := getAdditionalFrontendCount(service)
+	if err != nil {
+		return nil, err
+	}
+	var additionalRules []network.LoadBalancingRule
+	for i := 1; i <= count; i++ {
+		fipID := az.getFrontendIPConfigID(lbName, az.getAdditionalFrontendIPConfigName(service, i))
+		for _, rule := range rules {
+			if rule.LoadBalancingRulePropertiesFormat == nil {
+				continue
+			}
+			props := *rule.LoadBalancingRulePropertiesFormat
+			props.FrontendIPConfiguration = &network.SubResource{ID: pointer.String(fipID)}
+			additionalRules = append(additionalRules, network.LoadBalancingRule{
+				Name:                              pointer.String(fmt.Sprintf("%s-%d", pointer.StringDeref(rule.Name, ""), i)),
+				LoadBalancingRulePropertiesFormat: &props,
+			})
+		}
+	}
+	if len(additionalRules) > 0 {
+		klog.V(4).Infof("getExpectedAdditionalFrontendLBRules for service(%s): duplicated %d rules for %d additional frontends", getServiceName(service), len(rules), count)
+	}
+	return additionalRules, nil
+}
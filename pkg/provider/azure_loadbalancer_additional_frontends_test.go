@@ -0,0 +1,212 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestGetAdditionalFrontendCount(t *testing.T) {
+	for _, tc := range []struct {
+		desc          string
+		annotations   map[string]string
+		internal      bool
+		expectedCount int
+		expectedErr   bool
+	}{
+		{
+			desc: "no additional frontend without the annotation",
+		},
+		{
+			desc:          "the count in the annotation",
+			annotations:   map[string]string{consts.ServiceAnnotationLoadBalancerAdditionalFrontends: "2"},
+			expectedCount: 2,
+		},
+		{
+			desc:        "an error should be returned if the count is out of range",
+			annotations: map[string]string{consts.ServiceAnnotationLoadBalancerAdditionalFrontends: "11"},
+			expectedErr: true,
+		},
+		{
+			desc:        "an error should be returned for internal services",
+			annotations: map[string]string{consts.ServiceAnnotationLoadBalancerAdditionalFrontends: "1"},
+			internal:    true,
+			expectedErr: true,
+		},
+		{
+			desc: "an error should be returned if the floating IP is disabled",
+			annotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerAdditionalFrontends: "1",
+				consts.ServiceAnnotationDisableLoadBalancerFloatingIP:   "true",
+			},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := getTestService("test1", v1.ProtocolTCP, tc.annotations, false, 80)
+			if tc.internal {
+				svc.Annotations[consts.ServiceAnnotationLoadBalancerInternal] = consts.TrueAnnotationValue
+			}
+			count, err := getAdditionalFrontendCount(&svc)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedCount, count)
+		})
+	}
+}
+
+func TestGetAdditionalFrontendIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	assert.Equal(t, "atest1-2", az.getAdditionalFrontendIPConfigName(&svc, 2))
+	assert.Equal(t, 2, az.getAdditionalFrontendIndex(&svc, "atest1-2"))
+	assert.Equal(t, 0, az.getAdditionalFrontendIndex(&svc, "atest1"))
+	assert.Equal(t, 0, az.getAdditionalFrontendIndex(&svc, "atest1-IPv6"))
+	assert.Equal(t, 0, az.getAdditionalFrontendIndex(&svc, "atest1-0"))
+	assert.Equal(t, 0, az.getAdditionalFrontendIndex(&svc, "aother-1"))
+}
+
+func TestGetExpectedAdditionalFrontendLBRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerAdditionalFrontends: "2"}, false, 80)
+	probeID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/probes/atest1-TCP-80"
+	rules := []network.LoadBalancingRule{
+		{
+			Name: pointer.String("atest1-TCP-80"),
+			LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+				FrontendIPConfiguration: &network.SubResource{ID: pointer.String(az.getFrontendIPConfigID("lb", "atest1"))},
+				Protocol:                network.TransportProtocolTCP,
+				FrontendPort:            pointer.Int32(80),
+				BackendPort:             pointer.Int32(80),
+				Probe:                   &network.SubResource{ID: pointer.String(probeID)},
+			},
+		},
+	}
+
+	additionalRules, err := az.getExpectedAdditionalFrontendLBRules(&svc, "lb", rules)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(additionalRules))
+	for i, rule := range additionalRules {
+		assert.Equal(t, fmt.Sprintf("atest1-TCP-80-%d", i+1), pointer.StringDeref(rule.Name, ""))
+		assert.Equal(t, az.getFrontendIPConfigID("lb", fmt.Sprintf("atest1-%d", i+1)), pointer.StringDeref(rule.FrontendIPConfiguration.ID, ""))
+		assert.Equal(t, probeID, pointer.StringDeref(rule.Probe.ID, ""))
+		assert.Equal(t, int32(80), pointer.Int32Deref(rule.FrontendPort, 0))
+	}
+	// The original rule is not changed.
+	assert.Equal(t, az.getFrontendIPConfigID("lb", "atest1"), pointer.StringDeref(rules[0].FrontendIPConfiguration.ID, ""))
+}
+
+func TestGetServiceLoadBalancerStatusWithAdditionalFrontends(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerAdditionalFrontends: "1"}, false, 80)
+	pipID := func(name string) string {
+		return "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/" + name
+	}
+	newPIP := func(name, ip string) network.PublicIPAddress {
+		return network.PublicIPAddress{
+			Name: pointer.String(name),
+			ID:   pointer.String(pipID(name)),
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress:              pointer.String(ip),
+				PublicIPAddressVersion: network.IPv4,
+			},
+		}
+	}
+	newFIP := func(name, pipName string) network.FrontendIPConfiguration {
+		return network.FrontendIPConfiguration{
+			Name: pointer.String(name),
+			ID:   pointer.String(az.getFrontendIPConfigID("lb", name)),
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+				PublicIPAddress: &network.PublicIPAddress{ID: pointer.String(pipID(pipName))},
+			},
+		}
+	}
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{
+		newPIP("testCluster-atest1", "1.2.3.4"),
+		newPIP("testCluster-atest1-1", "1.2.3.5"),
+	}, nil).AnyTimes()
+
+	lb := &network.LoadBalancer{
+		Name: pointer.String("lb"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			// The additional frontend is listed first, but its IP is reported after the primary one.
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				newFIP("atest1-1", "testCluster-atest1-1"),
+				newFIP("atest1", "testCluster-atest1"),
+			},
+		},
+	}
+	status, lbIPs, fipConfigs, err := az.getServiceLoadBalancerStatus(&svc, lb)
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.LoadBalancerIngress{{IP: "1.2.3.4"}, {IP: "1.2.3.5"}}, status.Ingress)
+	assert.Equal(t, []string{"1.2.3.4", "1.2.3.5"}, lbIPs)
+	assert.Equal(t, 1, len(fipConfigs))
+
+	updatedSvc := updateServiceLoadBalancerIPs(&svc, lbIPs)
+	assert.Equal(t, "1.2.3.4", updatedSvc.Annotations[consts.ServiceAnnotationLoadBalancerIPDualStack[false]])
+}
+
+func TestGetPublicIPUpdatesKeepsAdditionalPublicIPs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerAdditionalFrontends: "1"}, false, 80)
+	newPIP := func(name, ip string) network.PublicIPAddress {
+		return network.PublicIPAddress{
+			Name: pointer.String(name),
+			Tags: map[string]*string{
+				consts.ServiceTagKey:  pointer.String("default/test1"),
+				consts.ClusterNameKey: pointer.String(testClusterName),
+			},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress:              pointer.String(ip),
+				PublicIPAddressVersion: network.IPv4,
+			},
+		}
+	}
+	pips := []network.PublicIPAddress{
+		newPIP("testCluster-atest1", "1.2.3.4"),
+		newPIP("testCluster-atest1-1", "1.2.3.5"),
+		newPIP("testCluster-atest1-2", "1.2.3.6"),
+	}
+
+	_, pipsToBeDeleted, _, _, err := az.getPublicIPUpdates(
+		testClusterName, &svc, pips, true, false, "testCluster-atest1", "default/test1", serviceIPTagRequest{}, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pipsToBeDeleted))
+	assert.Equal(t, "testCluster-atest1-2", pointer.StringDeref(pipsToBeDeleted[0].Name, ""))
+}
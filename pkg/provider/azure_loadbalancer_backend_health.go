@@ -0,0 +1,201 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+// ruleBackendHealth is the health of the backend addresses of a load balancing rule.
+type ruleBackendHealth struct {
+	up   int
+	down int
+	// downIPs are the sorted IP addresses of the backend addresses failing the health probe.
+	downIPs []string
+}
+
+func newRuleBackendHealth(health loadbalancerclient.LoadBalancingRuleHealth) ruleBackendHealth {
+	h := ruleBackendHealth{
+		up:   int(pointer.Int32Deref(health.Up, 0)),
+		down: int(pointer.Int32Deref(health.Down, 0)),
+	}
+	if health.LoadBalancerBackendAddresses != nil {
+		for _, address := range *health.LoadBalancerBackendAddresses {
+			if !strings.EqualFold(pointer.StringDeref(address.State, ""), "Up") {
+				h.downIPs = append(h.downIPs, pointer.StringDeref(address.IPAddress, ""))
+			}
+		}
+	}
+	sort.Strings(h.downIPs)
+	return h
+}
+
+// lbRuleKey identifies a load balancing rule.
+type lbRuleKey struct {
+	loadBalancerName string
+	ruleName         string
+}
+
+// loadBalancerBackendHealthReporter records the backend health reported by the backend
+// health report loop. It is only used by the loop, so no lock is needed.
+type loadBalancerBackendHealthReporter struct {
+	// rules records the load balancing rules whose backend health metrics have been reported.
+	rules map[lbRuleKey]bool
+	// services records the last reported backend health of each service, keyed by the rule name.
+	services map[string]map[string]ruleBackendHealth
+}
+
+// runLoadBalancerBackendHealthReportLoop periodically reports the backend health of the load balancing rules.
+func (az *Cloud) runLoadBalancerBackendHealthReportLoop(ctx context.Context, interval time.Duration) {
+	klog.V(2).Info("runLoadBalancerBackendHealthReportLoop: started")
+	reporter := &loadBalancerBackendHealthReporter{}
+	err := wait.PollUntilContextCancel(ctx, interval, false, func(ctx context.Context) (bool, error) {
+		if err := az.reportLoadBalancerBackendHealth(ctx, reporter); err != nil {
+			klog.Warningf("runLoadBalancerBackendHealthReportLoop: failed to report the backend health: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runLoadBalancerBackendHealthReportLoop: stopped due to %s", err.Error())
+}
+
+// reportLoadBalancerBackendHealth queries the backend health of the load balancing rules of the services, and reports
+// it by metrics. An event is emitted on the service when the backend health of its rules changes. The results are not
+// written to the service annotations because changing the annotations triggers the reconciliation of the service.
+func (az *Cloud) reportLoadBalancerBackendHealth(ctx context.Context, reporter *loadBalancerBackendHealthReporter) error {
+	if az.serviceLister == nil {
+		klog.V(4).Info("reportLoadBalancerBackendHealth: the service lister is not initialized, skip reporting")
+		return nil
+	}
+	services, err := az.serviceLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	rules := make(map[lbRuleKey]bool)
+	serviceHealth := make(map[string]map[string]ruleBackendHealth)
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil ||
+			!az.isServiceReconciledByLoadBalancerClass(service) {
+			continue
+		}
+
+		health := make(map[string]ruleBackendHealth)
+		for _, lb := range lbs {
+			if lb.LoadBalancerPropertiesFormat == nil || lb.LoadBalancingRules == nil {
+				continue
+			}
+			lbName := pointer.StringDeref(lb.Name, "")
+			for _, rule := range *lb.LoadBalancingRules {
+				ruleName := pointer.StringDeref(rule.Name, "")
+				if !az.serviceOwnsRule(service, ruleName) {
+					continue
+				}
+				// keep the metrics of the rule if its health cannot be queried this time
+				rules[lbRuleKey{loadBalancerName: lbName, ruleName: ruleName}] = true
+
+				ruleHealth, rerr := az.LoadBalancerClient.GetLoadBalancingRuleHealth(ctx, az.getLoadBalancerResourceGroup(), lbName, ruleName)
+				if rerr != nil {
+					errs = append(errs, fmt.Errorf("failed to get the health of rule %s of load balancer %s: %w", ruleName, lbName, rerr.Error()))
+					continue
+				}
+				h := newRuleBackendHealth(ruleHealth)
+				metrics.SetLoadBalancerRuleBackendHealth(lbName, ruleName, h.up, h.down)
+				health[ruleName] = h
+			}
+		}
+		if len(health) == 0 {
+			continue
+		}
+
+		serviceName := getServiceName(service)
+		serviceHealth[serviceName] = health
+		if last, found := reporter.services[serviceName]; !found || !reflect.DeepEqual(last, health) {
+			az.emitLoadBalancerBackendHealthEvents(service, last, health)
+		}
+	}
+
+	for key := range reporter.rules {
+		if !rules[key] {
+			metrics.DeleteLoadBalancerRuleBackendHealth(key.loadBalancerName, key.ruleName)
+		}
+	}
+	reporter.rules = rules
+	for serviceName, health := range reporter.services {
+		// keep the last health of the services whose rules cannot be queried this time
+		if _, found := serviceHealth[serviceName]; !found && len(errs) > 0 {
+			serviceHealth[serviceName] = health
+		}
+	}
+	reporter.services = serviceHealth
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// emitLoadBalancerBackendHealthEvents emits a warning event for each rule of the service with backends failing
+// the health probe, or a normal event if all the backends of the service recover.
+func (az *Cloud) emitLoadBalancerBackendHealthEvents(service *v1.Service, last, health map[string]ruleBackendHealth) {
+	ruleNames := make([]string, 0, len(health))
+	for ruleName := range health {
+		ruleNames = append(ruleNames, ruleName)
+	}
+	sort.Strings(ruleNames)
+
+	unhealthy := false
+	for _, ruleName := range ruleNames {
+		h := health[ruleName]
+		if h.down == 0 {
+			continue
+		}
+		unhealthy = true
+		warningMsg := fmt.Sprintf("%d/%d backends of load balancing rule %s are failing the health probe", h.down, h.up+h.down, ruleName)
+		if len(h.downIPs) > 0 {
+			warningMsg = fmt.Sprintf("%s: %s", warningMsg, strings.Join(h.downIPs, ", "))
+		}
+		az.Event(service, v1.EventTypeWarning, "UnhealthyLoadBalancerBackends", warningMsg)
+	}
+
+	wasUnhealthy := false
+	for _, h := range last {
+		if h.down > 0 {
+			wasUnhealthy = true
+			break
+		}
+	}
+	if !unhealthy && wasUnhealthy {
+		az.Event(service, v1.EventTypeNormal, "HealthyLoadBalancerBackends", "All backends of the load balancing rules are passing the health probe")
+	}
+}
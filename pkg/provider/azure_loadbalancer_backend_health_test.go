@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getTestLoadBalancingRuleHealth(upIPs, downIPs []string) loadbalancerclient.LoadBalancingRuleHealth {
+	addresses := []loadbalancerclient.BackendAddressHealth{}
+	for _, ip := range upIPs {
+		addresses = append(addresses, loadbalancerclient.BackendAddressHealth{IPAddress: pointer.String(ip), State: pointer.String("Up")})
+	}
+	for _, ip := range downIPs {
+		addresses = append(addresses, loadbalancerclient.BackendAddressHealth{IPAddress: pointer.String(ip), State: pointer.String("Down")})
+	}
+	return loadbalancerclient.LoadBalancingRuleHealth{
+		Up:                           pointer.Int32(int32(len(upIPs))),
+		Down:                         pointer.Int32(int32(len(downIPs))),
+		LoadBalancerBackendAddresses: &addresses,
+	}
+}
+
+func TestReportLoadBalancerBackendHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	cloud.eventRecorder = recorder
+
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	client := fake.NewSimpleClientset(&svc)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	cloud.serviceLister = informerFactory.Core().V1().Services().Lister()
+	_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+
+	ruleName := cloud.getLoadBalancerRuleName(&svc, v1.ProtocolTCP, 80, false)
+	lb := network.LoadBalancer{
+		Name: pointer.String("lb1"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			LoadBalancingRules: &[]network.LoadBalancingRule{
+				{Name: pointer.String(ruleName)},
+				{Name: pointer.String("other-rule")},
+			},
+		},
+	}
+	mockLBClient := cloud.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.LoadBalancer{lb}, nil).AnyTimes()
+
+	reporter := &loadBalancerBackendHealthReporter{}
+	for _, tc := range []struct {
+		desc          string
+		health        loadbalancerclient.LoadBalancingRuleHealth
+		rerr          *retry.Error
+		expectedEvent string
+	}{
+		{
+			desc:          "backends failing the health probe should be reported",
+			health:        getTestLoadBalancingRuleHealth([]string{"10.0.0.1"}, []string{"10.0.0.3", "10.0.0.2"}),
+			expectedEvent: "Warning UnhealthyLoadBalancerBackends 2/3 backends of load balancing rule " + ruleName + " are failing the health probe: 10.0.0.2, 10.0.0.3",
+		},
+		{
+			desc:   "unchanged health should not be reported again",
+			health: getTestLoadBalancingRuleHealth([]string{"10.0.0.1"}, []string{"10.0.0.3", "10.0.0.2"}),
+		},
+		{
+			desc: "failure to get the health should not be reported",
+			rerr: &retry.Error{HTTPStatusCode: http.StatusInternalServerError},
+		},
+		{
+			desc:          "recovered backends should be reported",
+			health:        getTestLoadBalancingRuleHealth([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, nil),
+			expectedEvent: "Normal HealthyLoadBalancerBackends All backends of the load balancing rules are passing the health probe",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			mockLBClient.EXPECT().GetLoadBalancingRuleHealth(gomock.Any(), gomock.Any(), "lb1", ruleName).Return(tc.health, tc.rerr).Times(1)
+
+			err := cloud.reportLoadBalancerBackendHealth(context.TODO(), reporter)
+			assert.Equal(t, tc.rerr != nil, err != nil)
+			assert.True(t, reporter.rules[lbRuleKey{loadBalancerName: "lb1", ruleName: ruleName}])
+			assert.False(t, reporter.rules[lbRuleKey{loadBalancerName: "lb1", ruleName: "other-rule"}])
+
+			select {
+			case event := <-recorder.Events:
+				assert.Equal(t, tc.expectedEvent, event)
+			default:
+				assert.Empty(t, tc.expectedEvent)
+			}
+		})
+	}
+}
@@ -37,6 +37,8 @@ import (
 	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
 )
 
+// BackendPool is the strategy of how the backends join the backend pools of the load balancers.
+// The strategies are registered with RegisterBackendPoolType and selected by loadBalancerBackendPoolConfigurationType.
 type BackendPool interface {
 	// EnsureHostsInPool ensures the nodes join the backend pool of the load balancer
 	EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, backendPoolID, vmSetName, clusterName, lbName string, backendPool network.BackendAddressPool) error
@@ -67,7 +69,7 @@ func newBackendPoolTypeNodeIPConfig(c *Cloud) BackendPool {
 }
 
 func (bc *backendPoolTypeNodeIPConfig) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, backendPoolID, vmSetName, clusterName, lbName string, backendPool network.BackendAddressPool) error {
-	return bc.VMSet.EnsureHostsInPool(service, nodes, backendPoolID, vmSetName)
+	return bc.ensureHostsInVMSetPool(service, nodes, backendPoolID, vmSetName)
 }
 
 func isLBBackendPoolsExisting(lbBackendPoolNames map[bool]string, bpName *string) (found, isIPv6 bool) {
@@ -142,7 +144,7 @@ func (bc *backendPoolTypeNodeIPConfig) CleanupVMSetFromBackendPoolByCondition(sl
 			findBackendpoolToBeDeleted(consts.IPVersionIPv6)
 		}
 		// decouple the backendPool from the node
-		shouldRefreshLB, err := bc.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolIDsSlice, vmSetName, &backendpoolToBeDeleted, true)
+		shouldRefreshLB, err := bc.ensureBackendPoolDeletedFromVMSet(service, lbBackendPoolIDsSlice, vmSetName, &backendpoolToBeDeleted, true)
 		if err != nil {
 			return nil, err
 		}
@@ -255,7 +257,7 @@ func (bc *backendPoolTypeNodeIPConfig) ReconcileBackendPools(clusterName string,
 	}
 	if len(backendpoolToBeDeleted) > 0 {
 		// decouple the backendPool from the node
-		updated, err := bc.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolIDsSlice, vmSetName, &backendpoolToBeDeleted, false)
+		updated, err := bc.ensureBackendPoolDeletedFromVMSet(service, lbBackendPoolIDsSlice, vmSetName, &backendpoolToBeDeleted, false)
 		if err != nil {
 			return false, false, false, err
 		}
@@ -352,8 +354,8 @@ func (bc *backendPoolTypeNodeIPConfig) GetBackendPrivateIPs(clusterName string,
 						klog.Errorf("bc.GetBackendPrivateIPs for service (%s): GetNodeNameByIPConfigurationID failed with error: %v", serviceName, err)
 						continue
 					}
-					privateIPsSet, ok := bc.nodePrivateIPs[nodeName]
-					if !ok {
+					privateIPsSet := bc.nodeTopology.getPrivateIPs(nodeName)
+					if privateIPsSet.Len() == 0 {
 						klog.Warningf("bc.GetBackendPrivateIPs for service (%s): failed to get private IPs of node %s", serviceName, nodeName)
 						continue
 					}
@@ -385,15 +387,12 @@ func newBackendPoolTypeNodeIP(c *Cloud) BackendPool {
 
 func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, backendPoolID, vmSetName, clusterName, lbName string, backendPool network.BackendAddressPool) error {
 	isIPv6 := isBackendPoolIPv6(pointer.StringDeref(backendPool.Name, ""))
-	vnetResourceGroup := bi.ResourceGroup
-	if len(bi.VnetResourceGroup) > 0 {
-		vnetResourceGroup = bi.VnetResourceGroup
-	}
-	vnetID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s", bi.SubscriptionID, vnetResourceGroup, bi.VnetName)
+	vnetID := bi.getVnetResourceID()
 
 	var (
 		changed               bool
 		numOfAdd, numOfDelete int
+		numOfDesired          int
 		activeNodes           sets.Set[string]
 		err                   error
 	)
@@ -421,6 +420,7 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 	}
 
 	lbBackendPoolName := bi.getBackendPoolNameForService(service, clusterName, isIPv6)
+	var nodeIPsToBeAdded, nodeIPsToBeDeleted []string
 	if strings.EqualFold(pointer.StringDeref(backendPool.Name, ""), lbBackendPoolName) &&
 		backendPool.BackendAddressPoolPropertiesFormat != nil {
 		backendPool.VirtualNetwork = &network.SubResource{
@@ -441,7 +441,6 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 			}
 		}
 
-		var nodeIPsToBeAdded []string
 		nodePrivateIPsSet := sets.New[string]()
 		for _, node := range nodes {
 			if isControlPlaneNode(node) {
@@ -459,6 +458,7 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 				}
 			}
 
+			numOfDesired++
 			if !existingIPs.Has(privateIP) {
 				name := node.Name
 				klog.V(6).Infof("bi.EnsureHostsInPool: adding %s with ip address %s", name, privateIP)
@@ -468,7 +468,6 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 		}
 		changed = bi.addNodeIPAddressesToBackendPool(&backendPool, nodeIPsToBeAdded)
 
-		var nodeIPsToBeDeleted []string
 		for _, loadBalancerBackendAddress := range *backendPool.LoadBalancerBackendAddresses {
 			ip := pointer.StringDeref(loadBalancerBackendAddress.IPAddress, "")
 			if !nodePrivateIPsSet.Has(ip) {
@@ -477,7 +476,7 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 				changed = true
 				numOfDelete++
 			} else if bi.useMultipleStandardLoadBalancers() && activeNodes != nil {
-				nodeName, ok := bi.nodePrivateIPToNodeNameMap[ip]
+				nodeName, ok := bi.nodeTopology.getNodeNameByIP(ip)
 				if !ok {
 					klog.Warningf("bi.EnsureHostsInPool: cannot find node name for private IP %s", ip)
 					continue
@@ -491,12 +490,24 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 			}
 		}
 		removeNodeIPAddressesFromBackendPool(backendPool, nodeIPsToBeDeleted, false, bi.useMultipleStandardLoadBalancers())
+		metrics.SetBackendPoolMembership(lbName, lbBackendPoolName, numOfDesired, existingIPs.Len(), numOfAdd, numOfDelete)
 	}
 	if changed {
 		klog.V(2).Infof("bi.EnsureHostsInPool: updating backend pool %s of load balancer %s to add %d nodes and remove %d nodes", lbBackendPoolName, lbName, numOfAdd, numOfDelete)
-		if err := bi.CreateOrUpdateLBBackendPool(lbName, backendPool); err != nil {
+		applyChanges := func(latest *network.BackendAddressPool) bool {
+			if latest.BackendAddressPoolPropertiesFormat == nil {
+				latest.BackendAddressPoolPropertiesFormat = &network.BackendAddressPoolPropertiesFormat{}
+			}
+			latest.VirtualNetwork = &network.SubResource{ID: &vnetID}
+			added := bi.addNodeIPAddressesToBackendPool(latest, nodeIPsToBeAdded)
+			removed := removeNodeIPAddressesFromBackendPool(*latest, nodeIPsToBeDeleted, false, bi.useMultipleStandardLoadBalancers())
+			return added || removed
+		}
+		if err := bi.updateLBBackendPoolAddresses(lbName, backendPool, applyChanges); err != nil {
 			return fmt.Errorf("bi.EnsureHostsInPool: failed to update backend pool %s: %w", lbBackendPoolName, err)
 		}
+		metrics.ObserveBackendPoolDriftCorrections(lbName, lbBackendPoolName, string(consts.LoadBalancerBackendPoolUpdateOperationAdd), numOfAdd)
+		metrics.ObserveBackendPoolDriftCorrections(lbName, lbBackendPoolName, string(consts.LoadBalancerBackendPoolUpdateOperationRemove), numOfDelete)
 	}
 
 	return nil
@@ -648,7 +659,7 @@ func (bi *backendPoolTypeNodeIP) ReconcileBackendPools(clusterName string, servi
 		// 3. Decouple vmss from the lb if the backend pool is empty when using
 		// ip-based LB. Ref: https://github.com/kubernetes-sigs/cloud-provider-azure/pull/2829.
 		klog.V(2).Infof("bi.ReconcileBackendPools for service (%s) and vmSet (%s): ensuring the LB is decoupled from the VMSet", serviceName, vmSetName)
-		shouldRefreshLB, err = bi.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolIDsSlice, vmSetName, lb.BackendAddressPools, true)
+		shouldRefreshLB, err = bi.ensureBackendPoolDeletedFromVMSet(service, lbBackendPoolIDsSlice, vmSetName, lb.BackendAddressPools, true)
 		if err != nil {
 			klog.Errorf("bi.ReconcileBackendPools for service (%s): failed to EnsureBackendPoolDeleted: %s", serviceName, err.Error())
 			return false, false, false, err
@@ -658,7 +669,7 @@ func (bi *backendPoolTypeNodeIP) ReconcileBackendPools(clusterName string, servi
 			bp := newBackendPools[i]
 			var nodeIPAddressesToBeDeleted []string
 			for nodeName := range bi.excludeLoadBalancerNodes {
-				for ip := range bi.nodePrivateIPs[nodeName] {
+				for ip := range bi.nodeTopology.getPrivateIPs(nodeName) {
 					klog.V(2).Infof("bi.ReconcileBackendPools for service (%s): found unwanted node private IP %s, decouple it from the LB %s", serviceName, ip, lbName)
 					nodeIPAddressesToBeDeleted = append(nodeIPAddressesToBeDeleted, ip)
 				}
@@ -705,13 +716,29 @@ func (bi *backendPoolTypeNodeIP) ReconcileBackendPools(clusterName string, servi
 
 	shouldRefreshLB = shouldRefreshLB || isMigration
 
+	// Remove the dedicated backend pools of the local service that are named by
+	// previous naming configurations. The load balancing rules will be switched
+	// to the backend pools with new names in the same load balancer update.
+	if bi.useMultipleStandardLoadBalancers() && isLocalService(service) {
+		if bi.removeStaleLocalServiceBackendPools(service, lb, lbBackendPoolNames) {
+			changed = true
+		}
+	}
+
 	for _, ipFamily := range service.Spec.IPFamilies {
-		if foundBackendPools[ipFamily == v1.IPv6Protocol] {
+		isIPv6 := ipFamily == v1.IPv6Protocol
+		if foundBackendPools[isIPv6] {
 			continue
 		}
 		isBackendPoolPreConfigured = newBackendPool(lb, isBackendPoolPreConfigured,
 			bi.PreConfiguredBackendPoolLoadBalancerTypes, serviceName,
-			lbBackendPoolNames[ipFamily == v1.IPv6Protocol])
+			lbBackendPoolNames[isIPv6])
+		// Pre-populate the dedicated backend pool of a local service so that
+		// it is not empty when the load balancing rules start to use it.
+		if bi.useMultipleStandardLoadBalancers() && isLocalService(service) {
+			bp := &(*lb.BackendAddressPools)[len(*lb.BackendAddressPools)-1]
+			bi.prewarmLocalServiceBackendPool(service, bp, isIPv6)
+		}
 		changed = true
 	}
 
@@ -759,6 +786,15 @@ func (bi *backendPoolTypeNodeIP) GetBackendPrivateIPs(clusterName string, servic
 	return backendPrivateIPv4s.UnsortedList(), backendPrivateIPv6s.UnsortedList()
 }
 
+// getVnetResourceID returns the resource ID of the virtual network of the cluster.
+func (az *Cloud) getVnetResourceID() string {
+	vnetResourceGroup := az.ResourceGroup
+	if len(az.VnetResourceGroup) > 0 {
+		vnetResourceGroup = az.VnetResourceGroup
+	}
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s", az.SubscriptionID, vnetResourceGroup, az.VnetName)
+}
+
 func newBackendPool(lb *network.LoadBalancer, isBackendPoolPreConfigured bool, preConfiguredBackendPoolLoadBalancerTypes, serviceName, lbBackendPoolName string) bool {
 	if isBackendPoolPreConfigured {
 		klog.V(2).Infof("newBackendPool for service (%s)(true): lb backendpool - PreConfiguredBackendPoolLoadBalancerTypes %s has been set but can not find corresponding backend pool %q, ignoring it",
@@ -790,7 +826,7 @@ func (az *Cloud) addNodeIPAddressesToBackendPool(backendPool *network.BackendAdd
 	addresses := *backendPool.LoadBalancerBackendAddresses
 	for _, ipAddress := range nodeIPAddresses {
 		if !hasIPAddressInBackendPool(backendPool, ipAddress) {
-			name := az.nodePrivateIPToNodeNameMap[ipAddress]
+			name, _ := az.nodeTopology.getNodeNameByIP(ipAddress)
 			klog.V(4).Infof("bi.addNodeIPAddressesToBackendPool: adding %s to the backend pool %s", ipAddress, pointer.StringDeref(backendPool.Name, ""))
 			addresses = append(addresses, network.LoadBalancerBackendAddress{
 				Name: pointer.String(name),
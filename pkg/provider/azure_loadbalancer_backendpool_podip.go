@@ -0,0 +1,537 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	v1 "k8s.io/api/core/v1"
+	discovery_v1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+// backendPoolTypePodIP puts the IPs of the pods backing a service into the dedicated backend pools
+// of the service, so that the load balancer sends the traffic to the target ports of the pods directly
+// instead of the node ports. It requires the pod IPs to be routable in the virtual network, e.g., Azure CNI.
+// The pods that are terminating but still serving are kept in the backend pools with the admin state
+// Drain, so that their established connections are not reset. If the traffic distribution of the service
+// is PreferClose, the ready pods outside the zone of the frontend IPs are drained as well as long as there
+// is a ready pod in that zone. If the admin state is not supported by the network API version of the
+// target cloud, the pods to be drained are removed from the backend pools instead.
+type backendPoolTypePodIP struct {
+	*Cloud
+}
+
+func newBackendPoolTypePodIP(c *Cloud) BackendPool {
+	return &backendPoolTypePodIP{c}
+}
+
+func (bp *backendPoolTypePodIP) EnsureHostsInPool(service *v1.Service, _ []*v1.Node, _, _, clusterName, lbName string, backendPool network.BackendAddressPool) error {
+	isIPv6 := isBackendPoolIPv6(pointer.StringDeref(backendPool.Name, ""))
+	lbBackendPoolName := bp.getBackendPoolNameForService(service, clusterName, isIPv6)
+	if !strings.EqualFold(pointer.StringDeref(backendPool.Name, ""), lbBackendPoolName) ||
+		backendPool.BackendAddressPoolPropertiesFormat == nil {
+		return nil
+	}
+
+	var preferredZone string
+	if consts.IsK8sServiceTrafficDistributionPreferClose(service) {
+		lb, _, err := bp.getAzureLoadBalancer(lbName, azcache.CacheReadTypeDefault)
+		if err != nil {
+			return err
+		}
+		preferredZone = bp.getServicePreferredZone(service, lb)
+	}
+	readyIPs, drainingIPs, err := bp.getServicePodIPs(service, isIPv6, preferredZone)
+	if err != nil {
+		return err
+	}
+
+	vnetID := bp.getVnetResourceID()
+	backendPool.VirtualNetwork = &network.SubResource{ID: &vnetID}
+	numOfExisting := len(getPodIPAddressesAdminStates(&backendPool))
+	numOfAdd, numOfDrain, numOfDelete := setPodIPAddressesOfBackendPool(&backendPool, readyIPs, drainingIPs)
+	metrics.SetBackendPoolMembership(lbName, lbBackendPoolName, readyIPs.Len()+drainingIPs.Len(), numOfExisting, numOfAdd, numOfDelete)
+	if numOfAdd+numOfDrain+numOfDelete == 0 {
+		return nil
+	}
+
+	klog.V(2).Infof("bp.EnsureHostsInPool: updating backend pool %s of load balancer %s to add %d pods, drain %d pods and remove %d pods",
+		lbBackendPoolName, lbName, numOfAdd, numOfDrain, numOfDelete)
+	applyChanges := func(latest *network.BackendAddressPool) bool {
+		if latest.BackendAddressPoolPropertiesFormat == nil {
+			latest.BackendAddressPoolPropertiesFormat = &network.BackendAddressPoolPropertiesFormat{}
+		}
+		latest.VirtualNetwork = &network.SubResource{ID: &vnetID}
+		added, drained, removed := setPodIPAddressesOfBackendPool(latest, readyIPs, drainingIPs)
+		return added+drained+removed > 0
+	}
+	if err := bp.updateLBBackendPoolAddresses(lbName, backendPool, applyChanges); err != nil {
+		return fmt.Errorf("bp.EnsureHostsInPool: failed to update backend pool %s: %w", lbBackendPoolName, err)
+	}
+	metrics.ObserveBackendPoolDriftCorrections(lbName, lbBackendPoolName, string(consts.LoadBalancerBackendPoolUpdateOperationAdd), numOfAdd)
+	metrics.ObserveBackendPoolDriftCorrections(lbName, lbBackendPoolName, string(consts.LoadBalancerBackendPoolUpdateOperationDrain), numOfDrain)
+	metrics.ObserveBackendPoolDriftCorrections(lbName, lbBackendPoolName, string(consts.LoadBalancerBackendPoolUpdateOperationRemove), numOfDelete)
+	return nil
+}
+
+// CleanupVMSetFromBackendPoolByCondition is a no-op because the VMs are never in the backend pools of the pods.
+func (bp *backendPoolTypePodIP) CleanupVMSetFromBackendPoolByCondition(slb *network.LoadBalancer, _ *v1.Service, _ []*v1.Node, _ string, _ func(string) bool) (*network.LoadBalancer, error) {
+	return slb, nil
+}
+
+func (bp *backendPoolTypePodIP) ReconcileBackendPools(clusterName string, service *v1.Service, lb *network.LoadBalancer) (bool, bool, bool, error) {
+	var changed bool
+	serviceName := getServiceName(service)
+	lbBackendPoolNames := bp.getBackendPoolNamesForService(service, clusterName)
+	isBackendPoolPreConfigured := bp.isBackendPoolPreConfigured(service)
+
+	foundBackendPools := map[bool]bool{}
+	if lb.BackendAddressPools != nil {
+		for _, backendPool := range *lb.BackendAddressPools {
+			if found, isIPv6 := isLBBackendPoolsExisting(lbBackendPoolNames, backendPool.Name); found {
+				klog.V(10).Infof("bp.ReconcileBackendPools for service (%s): found wanted backendpool. Not adding anything", serviceName)
+				foundBackendPools[isIPv6] = true
+			} else {
+				klog.V(10).Infof("bp.ReconcileBackendPools for service (%s): found unmanaged backendpool %s", serviceName, pointer.StringDeref(backendPool.Name, ""))
+			}
+		}
+	}
+
+	if bp.removeStaleLocalServiceBackendPools(service, lb, lbBackendPoolNames) {
+		changed = true
+	}
+
+	for _, ipFamily := range service.Spec.IPFamilies {
+		isIPv6 := ipFamily == v1.IPv6Protocol
+		if foundBackendPools[isIPv6] {
+			continue
+		}
+		isBackendPoolPreConfigured = newBackendPool(lb, isBackendPoolPreConfigured,
+			bp.PreConfiguredBackendPoolLoadBalancerTypes, serviceName,
+			lbBackendPoolNames[isIPv6])
+		bp.prewarmPodIPBackendPool(service, &(*lb.BackendAddressPools)[len(*lb.BackendAddressPools)-1], isIPv6, bp.getServicePreferredZone(service, lb))
+		changed = true
+	}
+
+	return isBackendPoolPreConfigured, changed, false, nil
+}
+
+func (bp *backendPoolTypePodIP) GetBackendPrivateIPs(clusterName string, service *v1.Service, lb *network.LoadBalancer) ([]string, []string) {
+	// The pod IPs are read from the backend pools in the same way as the node IPs.
+	return (&backendPoolTypeNodeIP{bp.Cloud}).GetBackendPrivateIPs(clusterName, service, lb)
+}
+
+// prewarmPodIPBackendPool adds the pod IPs of the service to its newly created backend pool,
+// so that the traffic is not blackholed after the load balancing rules are switched to it.
+func (bp *backendPoolTypePodIP) prewarmPodIPBackendPool(service *v1.Service, backendPool *network.BackendAddressPool, isIPv6 bool, preferredZone string) {
+	readyIPs, drainingIPs, err := bp.getServicePodIPs(service, isIPv6, preferredZone)
+	if err != nil {
+		klog.V(2).Infof("prewarmPodIPBackendPool: failed to get the pod IPs of service %s, the backend pool %s will be populated later: %s",
+			getServiceName(service), pointer.StringDeref(backendPool.Name, ""), err.Error())
+		return
+	}
+	if readyIPs.Len() == 0 {
+		return
+	}
+
+	klog.V(2).Infof("prewarmPodIPBackendPool: adding %s to the backend pool %s of service %s",
+		strings.Join(sets.List(readyIPs), ","), pointer.StringDeref(backendPool.Name, ""), getServiceName(service))
+	if backendPool.BackendAddressPoolPropertiesFormat == nil {
+		backendPool.BackendAddressPoolPropertiesFormat = &network.BackendAddressPoolPropertiesFormat{}
+	}
+	backendPool.VirtualNetwork = &network.SubResource{
+		ID: pointer.String(bp.getVnetResourceID()),
+	}
+	_, _, _ = setPodIPAddressesOfBackendPool(backendPool, readyIPs, drainingIPs)
+}
+
+// getServicePodIPs gets the IPs of the given IP family of the pods that should receive new
+// connections and the ones whose connections should be drained from the EndpointSlices of the service.
+func (az *Cloud) getServicePodIPs(service *v1.Service, isIPv6 bool, preferredZone string) (sets.Set[string], sets.Set[string], error) {
+	eps, err := az.getServiceEndpointSlices(service)
+	if err != nil {
+		return nil, nil, err
+	}
+	readyIPs, drainingIPs := az.getBackendPoolPodIPs(eps, preferredZone)
+	return sets.New(filterIPsByFamily(sets.List(readyIPs), isIPv6)...),
+		sets.New(filterIPsByFamily(sets.List(drainingIPs), isIPv6)...),
+		nil
+}
+
+// getBackendPoolPodIPs gets the ready and the draining IPs of the pods in the EndpointSlices of a
+// service. There is no draining IP if the admin state of the backend addresses is not supported by the
+// target cloud, so that the pods to be drained are removed from the backend pools.
+func (az *Cloud) getBackendPoolPodIPs(eps []*discovery_v1.EndpointSlice, preferredZone string) (sets.Set[string], sets.Set[string]) {
+	readyIPs, drainingIPs := getEndpointSlicesPodIPs(eps, preferredZone)
+	if !az.getCloudCapabilities().backendAddressAdminState {
+		return readyIPs, sets.New[string]()
+	}
+	return readyIPs, drainingIPs
+}
+
+// getEndpointSlicesPodIPs gets the IPs of the pods in the EndpointSlices of a service. The IPs of the
+// ready endpoints are returned as the ready IPs, and the IPs of the terminating endpoints that are
+// still serving are returned as the draining IPs. Following the semantics of kube-proxy, if there is no
+// ready endpoint, the serving terminating endpoints are returned as the ready IPs instead. A nil condition
+// is regarded as true for ready and serving, and false for terminating. If the preferred zone is not empty
+// and there is a ready endpoint in it, the ready endpoints in other zones are returned as the draining IPs.
+func getEndpointSlicesPodIPs(eps []*discovery_v1.EndpointSlice, preferredZone string) (sets.Set[string], sets.Set[string]) {
+	readyIPs, drainingIPs := sets.New[string](), sets.New[string]()
+	readyIPsInPreferredZone := sets.New[string]()
+	for _, es := range eps {
+		if es == nil || es.AddressType == discovery_v1.AddressTypeFQDN {
+			continue
+		}
+		for _, endpoint := range es.Endpoints {
+			conditions := endpoint.Conditions
+			terminating := pointer.BoolDeref(conditions.Terminating, false)
+			if !terminating && pointer.BoolDeref(conditions.Ready, true) {
+				readyIPs.Insert(endpoint.Addresses...)
+				if preferredZone != "" && strings.EqualFold(pointer.StringDeref(endpoint.Zone, ""), preferredZone) {
+					readyIPsInPreferredZone.Insert(endpoint.Addresses...)
+				}
+				continue
+			}
+			if terminating && pointer.BoolDeref(conditions.Serving, true) {
+				drainingIPs.Insert(endpoint.Addresses...)
+			}
+		}
+	}
+	if readyIPs.Len() == 0 {
+		return drainingIPs, readyIPs
+	}
+	if readyIPsInPreferredZone.Len() > 0 {
+		return readyIPsInPreferredZone, drainingIPs.Union(readyIPs).Difference(readyIPsInPreferredZone)
+	}
+	return readyIPs, drainingIPs.Difference(readyIPs)
+}
+
+// checkServiceTrafficDistribution emits a warning event if the traffic distribution annotation of the service is
+// not supported, i.e., the value is not PreferClose or the pod IPs are not in the backend pools, in which case the
+// traffic is distributed to the backends in all zones.
+func (az *Cloud) checkServiceTrafficDistribution(service *v1.Service) {
+	value, found := service.Annotations[consts.ServiceAnnotationLoadBalancerTrafficDistribution]
+	if !found {
+		return
+	}
+	if !strings.EqualFold(value, consts.TrafficDistributionPreferClose) {
+		az.Event(service, v1.EventTypeWarning, "UnsupportedTrafficDistribution", fmt.Sprintf(
+			"the traffic distribution %q of the annotation %s is not supported, only %s is supported",
+			value, consts.ServiceAnnotationLoadBalancerTrafficDistribution, consts.TrafficDistributionPreferClose))
+		return
+	}
+	if !az.usePodIPBackendPool() {
+		az.Event(service, v1.EventTypeWarning, "UnsupportedTrafficDistribution", fmt.Sprintf(
+			"the annotation %s is ignored, the traffic distribution %s is only supported with the backend pool type %s, not %s",
+			consts.ServiceAnnotationLoadBalancerTrafficDistribution, consts.TrafficDistributionPreferClose,
+			consts.LoadBalancerBackendPoolConfigurationTypePODIP, az.LoadBalancerBackendPoolConfigurationType))
+	}
+}
+
+// getServicePreferredZone returns the zone, in the format of the zone labels of the nodes, whose pods
+// should receive the new connections of the service whose traffic distribution is PreferClose. It is the
+// zone of the frontend IPs of the service if all of them are pinned to the same single zone, and is empty
+// if the pod IPs are not in the backend pools or the frontend IPs are zone-redundant or in different zones.
+func (az *Cloud) getServicePreferredZone(service *v1.Service, lb *network.LoadBalancer) string {
+	if !az.usePodIPBackendPool() || !consts.IsK8sServiceTrafficDistributionPreferClose(service) ||
+		lb == nil || lb.LoadBalancerPropertiesFormat == nil || lb.FrontendIPConfigurations == nil {
+		return ""
+	}
+
+	var preferredZoneID string
+	for _, fip := range *lb.FrontendIPConfigurations {
+		if owns, _, _ := az.serviceOwnsFrontendIP(fip, service); !owns {
+			continue
+		}
+		zones, err := az.getFrontendIPConfigZones(fip)
+		if err != nil {
+			klog.Warningf("getServicePreferredZone: failed to get the zones of the frontend IP config %s of service %s, fall back to all zones: %s",
+				pointer.StringDeref(fip.Name, ""), getServiceName(service), err.Error())
+			return ""
+		}
+		if len(zones) != 1 || (preferredZoneID != "" && preferredZoneID != zones[0]) {
+			klog.V(4).Infof("getServicePreferredZone: the frontend IPs of service %s are not in the same single zone, fall back to all zones", getServiceName(service))
+			return ""
+		}
+		preferredZoneID = zones[0]
+	}
+	zoneID, err := strconv.Atoi(preferredZoneID)
+	if err != nil {
+		return ""
+	}
+	return az.makeZone(az.Location, zoneID)
+}
+
+// getFrontendIPConfigZones returns the zones of the frontend IP config, which are the zones of the
+// public IP for a public frontend IP config.
+func (az *Cloud) getFrontendIPConfigZones(fip network.FrontendIPConfiguration) ([]string, error) {
+	if fip.FrontendIPConfigurationPropertiesFormat == nil || fip.PublicIPAddress == nil {
+		if fip.Zones == nil {
+			return nil, nil
+		}
+		return *fip.Zones, nil
+	}
+
+	pipID := pointer.StringDeref(fip.PublicIPAddress.ID, "")
+	resource, err := azure.ParseResourceID(pipID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public IP ID %q: %w", pipID, err)
+	}
+	pip, exists, err := az.getPublicIPAddress(resource.ResourceGroup, resource.ResourceName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("public IP %q not found", pipID)
+	}
+	if pip.Zones == nil {
+		return nil, nil
+	}
+	return *pip.Zones, nil
+}
+
+// getPodBackendPort returns the port of the pods serving the service port, i.e., the resolved target port.
+// A named target port is resolved by the ports of the EndpointSlices of the service.
+func (az *Cloud) getPodBackendPort(service *v1.Service, port v1.ServicePort) (int32, error) {
+	if port.TargetPort.Type == intstr.Int {
+		if port.TargetPort.IntVal == 0 {
+			return port.Port, nil
+		}
+		return port.TargetPort.IntVal, nil
+	}
+
+	eps, err := az.getServiceEndpointSlices(service)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve the target port %s of service %s: %w", port.TargetPort.StrVal, getServiceName(service), err)
+	}
+	for _, es := range eps {
+		for _, esPort := range es.Ports {
+			if pointer.StringDeref(esPort.Name, "") == port.Name && esPort.Port != nil &&
+				(esPort.Protocol == nil || *esPort.Protocol == port.Protocol) {
+				return *esPort.Port, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("failed to resolve the target port %s of service %s: no port named %q is found in the EndpointSlices",
+		port.TargetPort.StrVal, getServiceName(service), port.Name)
+}
+
+// getPodIPAddressesAdminStates returns the admin states of the IP addresses in the backend pool.
+// An unset admin state is returned as None.
+func getPodIPAddressesAdminStates(backendPool *network.BackendAddressPool) map[string]network.LoadBalancerBackendAddressAdminState {
+	adminStates := make(map[string]network.LoadBalancerBackendAddressAdminState)
+	if backendPool.BackendAddressPoolPropertiesFormat == nil || backendPool.LoadBalancerBackendAddresses == nil {
+		return adminStates
+	}
+	for _, address := range *backendPool.LoadBalancerBackendAddresses {
+		if address.LoadBalancerBackendAddressPropertiesFormat == nil || pointer.StringDeref(address.IPAddress, "") == "" {
+			continue
+		}
+		adminState := address.AdminState
+		if adminState == "" {
+			adminState = network.LoadBalancerBackendAddressAdminStateNone
+		}
+		adminStates[pointer.StringDeref(address.IPAddress, "")] = adminState
+	}
+	return adminStates
+}
+
+// setPodIPAddressesAdminState sets the admin state of the pod IPs in the backend pool. The missing IPs
+// are added to the backend pool unless they are to be drained. It returns true if the backend pool is changed.
+func setPodIPAddressesAdminState(backendPool *network.BackendAddressPool, podIPs []string, adminState network.LoadBalancerBackendAddressAdminState) bool {
+	if backendPool.BackendAddressPoolPropertiesFormat == nil {
+		backendPool.BackendAddressPoolPropertiesFormat = &network.BackendAddressPoolPropertiesFormat{}
+	}
+	if backendPool.LoadBalancerBackendAddresses == nil {
+		backendPool.LoadBalancerBackendAddresses = &[]network.LoadBalancerBackendAddress{}
+	}
+
+	var changed bool
+	addresses := *backendPool.LoadBalancerBackendAddresses
+	existingAdminStates := getPodIPAddressesAdminStates(backendPool)
+	for _, podIP := range podIPs {
+		existingAdminState, found := existingAdminStates[podIP]
+		if !found {
+			if adminState == network.LoadBalancerBackendAddressAdminStateDrain {
+				continue
+			}
+			klog.V(4).Infof("setPodIPAddressesAdminState: adding %s to the backend pool %s", podIP, pointer.StringDeref(backendPool.Name, ""))
+			// the admin state None is left unset, so that it is not sent to the clouds not supporting it
+			address := network.LoadBalancerBackendAddress{
+				Name: pointer.String(getPodIPBackendAddressName(podIP)),
+				LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+					IPAddress: pointer.String(podIP),
+				},
+			}
+			if adminState != network.LoadBalancerBackendAddressAdminStateNone {
+				address.AdminState = adminState
+			}
+			addresses = append(addresses, address)
+			changed = true
+			continue
+		}
+		if existingAdminState == adminState {
+			continue
+		}
+		for i := range addresses {
+			if addresses[i].LoadBalancerBackendAddressPropertiesFormat != nil && pointer.StringDeref(addresses[i].IPAddress, "") == podIP {
+				klog.V(4).Infof("setPodIPAddressesAdminState: setting the admin state of %s in the backend pool %s to %s", podIP, pointer.StringDeref(backendPool.Name, ""), adminState)
+				addresses[i].AdminState = adminState
+				changed = true
+			}
+		}
+	}
+	backendPool.LoadBalancerBackendAddresses = &addresses
+	return changed
+}
+
+// setPodIPAddressesOfBackendPool makes the backend pool contain exactly the ready and draining pod IPs
+// with the matching admin states. It returns the numbers of the IPs added or undrained, drained and removed.
+func setPodIPAddressesOfBackendPool(backendPool *network.BackendAddressPool, readyIPs, drainingIPs sets.Set[string]) (int, int, int) {
+	var ipsToBeAdded, ipsToBeDrained, ipsToBeDeleted []string
+	existingAdminStates := getPodIPAddressesAdminStates(backendPool)
+	for _, ip := range sets.List(readyIPs) {
+		if adminState, found := existingAdminStates[ip]; !found || adminState != network.LoadBalancerBackendAddressAdminStateNone {
+			ipsToBeAdded = append(ipsToBeAdded, ip)
+		}
+	}
+	for _, ip := range sets.List(drainingIPs) {
+		if adminState, found := existingAdminStates[ip]; found && adminState != network.LoadBalancerBackendAddressAdminStateDrain {
+			ipsToBeDrained = append(ipsToBeDrained, ip)
+		}
+	}
+	for ip := range existingAdminStates {
+		if !readyIPs.Has(ip) && !drainingIPs.Has(ip) {
+			ipsToBeDeleted = append(ipsToBeDeleted, ip)
+		}
+	}
+	sort.Strings(ipsToBeDeleted)
+
+	_ = removeNodeIPAddressesFromBackendPool(*backendPool, ipsToBeDeleted, false, true)
+	_ = setPodIPAddressesAdminState(backendPool, ipsToBeAdded, network.LoadBalancerBackendAddressAdminStateNone)
+	_ = setPodIPAddressesAdminState(backendPool, ipsToBeDrained, network.LoadBalancerBackendAddressAdminStateDrain)
+	return len(ipsToBeAdded), len(ipsToBeDrained), len(ipsToBeDeleted)
+}
+
+// getPodIPBackendAddressName returns the name of the backend address of the pod IP.
+func getPodIPBackendAddressName(podIP string) string {
+	return strings.ReplaceAll(podIP, ":", "-")
+}
+
+// updatePodIPBackendPools sends the operations updating the pod IPs in the backend pools
+// of the service to the batch updater.
+func (az *Cloud) updatePodIPBackendPools(serviceName string, si *serviceInfo, readyIPs, drainingIPs, ipsToBeDeleted []string) {
+	if az.backendPoolUpdater == nil {
+		return
+	}
+	for isIPv6, bpName := range az.getLocalServiceBackendPoolNamesOfIPFamily(serviceName, si.ipFamily) {
+		if ips := filterIPsByFamily(ipsToBeDeleted, isIPv6); len(ips) > 0 {
+			az.backendPoolUpdater.addOperation(getRemoveIPsFromBackendPoolOperation(serviceName, si.lbName, bpName, ips))
+		}
+		if ips := filterIPsByFamily(drainingIPs, isIPv6); len(ips) > 0 {
+			az.backendPoolUpdater.addOperation(getDrainIPsInBackendPoolOperation(serviceName, si.lbName, bpName, ips))
+		}
+		if ips := filterIPsByFamily(readyIPs, isIPv6); len(ips) > 0 {
+			az.backendPoolUpdater.addOperation(getAddIPsToBackendPoolOperation(serviceName, si.lbName, bpName, ips))
+		}
+	}
+}
+
+// repairPodIPBackendPool compares the pod IPs and their admin states in the backend pools of the service
+// with the ones computed from the endpoint slices, and sends update operations to the batch updater if
+// there is any drift. It returns the number of addresses to be corrected.
+func (az *Cloud) repairPodIPBackendPool(ctx context.Context, svc *v1.Service, serviceName string, si *serviceInfo) (int, error) {
+	eps, err := az.getServiceEndpointSlices(svc)
+	if err != nil {
+		return 0, err
+	}
+	readyIPs, drainingIPs := az.getBackendPoolPodIPs(eps, si.preferredZone)
+
+	var corrections int
+	for isIPv6, bpName := range az.getLocalServiceBackendPoolNamesOfIPFamily(serviceName, si.ipFamily) {
+		bp, rerr := az.LoadBalancerClient.GetLBBackendPool(ctx, az.ResourceGroup, si.lbName, bpName, "")
+		if rerr != nil {
+			if rerr.IsNotFound() {
+				klog.V(4).Infof("repairPodIPBackendPool: backend pool %s/%s not found, skip repairing", si.lbName, bpName)
+				continue
+			}
+			return corrections, rerr.Error()
+		}
+
+		existingAdminStates := getPodIPAddressesAdminStates(&bp)
+		var ipsToBeAdded, ipsToBeDrained, ipsToBeDeleted []string
+		for _, ip := range filterIPsByFamily(sets.List(readyIPs), isIPv6) {
+			if adminState, found := existingAdminStates[ip]; !found || adminState != network.LoadBalancerBackendAddressAdminStateNone {
+				ipsToBeAdded = append(ipsToBeAdded, ip)
+			}
+		}
+		for _, ip := range filterIPsByFamily(sets.List(drainingIPs), isIPv6) {
+			if adminState, found := existingAdminStates[ip]; found && adminState != network.LoadBalancerBackendAddressAdminStateDrain {
+				ipsToBeDrained = append(ipsToBeDrained, ip)
+			}
+		}
+		for ip := range existingAdminStates {
+			if !readyIPs.Has(ip) && !drainingIPs.Has(ip) {
+				ipsToBeDeleted = append(ipsToBeDeleted, ip)
+			}
+		}
+		sort.Strings(ipsToBeDeleted)
+		if len(ipsToBeAdded)+len(ipsToBeDrained)+len(ipsToBeDeleted) == 0 {
+			continue
+		}
+
+		klog.V(2).InfoS("repairPodIPBackendPool: detected backend pool drift",
+			"service", serviceName,
+			"load balancer", si.lbName,
+			"backend pool", bpName,
+			"IPs to be added", strings.Join(ipsToBeAdded, ","),
+			"IPs to be drained", strings.Join(ipsToBeDrained, ","),
+			"IPs to be deleted", strings.Join(ipsToBeDeleted, ","))
+		if az.backendPoolUpdater != nil {
+			if len(ipsToBeDeleted) > 0 {
+				az.backendPoolUpdater.addOperation(getRemoveIPsFromBackendPoolOperation(serviceName, si.lbName, bpName, ipsToBeDeleted))
+			}
+			if len(ipsToBeDrained) > 0 {
+				az.backendPoolUpdater.addOperation(getDrainIPsInBackendPoolOperation(serviceName, si.lbName, bpName, ipsToBeDrained))
+			}
+			if len(ipsToBeAdded) > 0 {
+				az.backendPoolUpdater.addOperation(getAddIPsToBackendPoolOperation(serviceName, si.lbName, bpName, ipsToBeAdded))
+			}
+		}
+		metrics.ObserveLocalServiceBackendPoolCorrections(si.lbName, string(consts.LoadBalancerBackendPoolUpdateOperationAdd), len(ipsToBeAdded))
+		metrics.ObserveLocalServiceBackendPoolCorrections(si.lbName, string(consts.LoadBalancerBackendPoolUpdateOperationDrain), len(ipsToBeDrained))
+		metrics.ObserveLocalServiceBackendPoolCorrections(si.lbName, string(consts.LoadBalancerBackendPoolUpdateOperationRemove), len(ipsToBeDeleted))
+		corrections += len(ipsToBeAdded) + len(ipsToBeDrained) + len(ipsToBeDeleted)
+	}
+
+	return corrections, nil
+}
@@ -0,0 +1,616 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	discovery_v1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// podEndpoint is the IP, the conditions and the zone of a pod endpoint in the test EndpointSlices.
+type podEndpoint struct {
+	ip          string
+	ready       bool
+	serving     bool
+	terminating bool
+	zone        string
+}
+
+func getTestPodEndpointSlice(name, namespace, svcName string, podEndpoints ...podEndpoint) *discovery_v1.EndpointSlice {
+	endpoints := make([]discovery_v1.Endpoint, 0)
+	for _, ep := range podEndpoints {
+		endpoint := discovery_v1.Endpoint{
+			Addresses: []string{ep.ip},
+			Conditions: discovery_v1.EndpointConditions{
+				Ready:       pointer.Bool(ep.ready),
+				Serving:     pointer.Bool(ep.serving),
+				Terminating: pointer.Bool(ep.terminating),
+			},
+		}
+		if ep.zone != "" {
+			endpoint.Zone = pointer.String(ep.zone)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return &discovery_v1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				consts.ServiceNameLabel: svcName,
+			},
+		},
+		AddressType: discovery_v1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+		Ports: []discovery_v1.EndpointPort{
+			{
+				Name:     pointer.String("http"),
+				Protocol: protocolPtr(v1.ProtocolTCP),
+				Port:     pointer.Int32(8080),
+			},
+		},
+	}
+}
+
+func protocolPtr(protocol v1.Protocol) *v1.Protocol {
+	return &protocol
+}
+
+func getTestBackendAddressPoolWithAdminStates(lbName, bpName string, adminStates map[string]network.LoadBalancerBackendAddressAdminState) network.BackendAddressPool {
+	bp := getTestBackendAddressPoolWithIPs(lbName, bpName, nil)
+	for _, ip := range sets.List(sets.KeySet(adminStates)) {
+		*bp.LoadBalancerBackendAddresses = append(*bp.LoadBalancerBackendAddresses, network.LoadBalancerBackendAddress{
+			Name: pointer.String(getPodIPBackendAddressName(ip)),
+			LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+				IPAddress:  pointer.String(ip),
+				AdminState: adminStates[ip],
+			},
+		})
+	}
+	return bp
+}
+
+func TestGetEndpointSlicesPodIPs(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		endpoints           []podEndpoint
+		preferredZone       string
+		expectedReadyIPs    []string
+		expectedDrainingIPs []string
+	}{
+		{
+			name: "ready and terminating serving endpoints",
+			endpoints: []podEndpoint{
+				{ip: "10.1.0.1", ready: true, serving: true},
+				{ip: "10.1.0.2", serving: true, terminating: true},
+				{ip: "10.1.0.3", terminating: true},
+			},
+			expectedReadyIPs:    []string{"10.1.0.1"},
+			expectedDrainingIPs: []string{"10.1.0.2"},
+		},
+		{
+			name: "terminating serving endpoints are used if there is no ready endpoint",
+			endpoints: []podEndpoint{
+				{ip: "10.1.0.2", serving: true, terminating: true},
+				{ip: "10.1.0.3", terminating: true},
+			},
+			expectedReadyIPs:    []string{"10.1.0.2"},
+			expectedDrainingIPs: []string{},
+		},
+		{
+			name:                "no endpoint",
+			expectedReadyIPs:    []string{},
+			expectedDrainingIPs: []string{},
+		},
+		{
+			name: "ready endpoints in other zones are drained if there is a ready endpoint in the preferred zone",
+			endpoints: []podEndpoint{
+				{ip: "10.1.0.1", ready: true, serving: true, zone: "westus-1"},
+				{ip: "10.1.0.2", ready: true, serving: true, zone: "westus-2"},
+				{ip: "10.1.0.3", ready: true, serving: true},
+				{ip: "10.1.0.4", serving: true, terminating: true, zone: "westus-1"},
+			},
+			preferredZone:       "westus-1",
+			expectedReadyIPs:    []string{"10.1.0.1"},
+			expectedDrainingIPs: []string{"10.1.0.2", "10.1.0.3", "10.1.0.4"},
+		},
+		{
+			name: "ready endpoints in all zones are used if there is no ready endpoint in the preferred zone",
+			endpoints: []podEndpoint{
+				{ip: "10.1.0.1", serving: true, terminating: true, zone: "westus-1"},
+				{ip: "10.1.0.2", ready: true, serving: true, zone: "westus-2"},
+				{ip: "10.1.0.3", ready: true, serving: true, zone: "westus-3"},
+			},
+			preferredZone:       "westus-1",
+			expectedReadyIPs:    []string{"10.1.0.2", "10.1.0.3"},
+			expectedDrainingIPs: []string{"10.1.0.1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			es := getTestPodEndpointSlice("eps1", "default", "svc1", tc.endpoints...)
+			readyIPs, drainingIPs := getEndpointSlicesPodIPs([]*discovery_v1.EndpointSlice{es, nil}, tc.preferredZone)
+			assert.Equal(t, tc.expectedReadyIPs, sets.List(readyIPs))
+			assert.Equal(t, tc.expectedDrainingIPs, sets.List(drainingIPs))
+		})
+	}
+}
+
+func TestCheckServiceTrafficDistribution(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	cloud.eventRecorder = recorder
+
+	preferClose := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerTrafficDistribution: consts.TrafficDistributionPreferClose,
+	}, false, 80)
+	topologyAware := getTestService("svc2", v1.ProtocolTCP, map[string]string{
+		v1.AnnotationTopologyMode: consts.TopologyModeAuto,
+	}, false, 80)
+	invalid := getTestService("svc3", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerTrafficDistribution: "PreferFar",
+	}, false, 80)
+
+	// the annotation is rejected with the backend pool types other than podIP
+	cloud.checkServiceTrafficDistribution(&preferClose)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "UnsupportedTrafficDistribution")
+	cloud.checkServiceTrafficDistribution(&topologyAware)
+	assert.Empty(t, recorder.Events)
+
+	cloud.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	cloud.checkServiceTrafficDistribution(&preferClose)
+	assert.Empty(t, recorder.Events)
+	cloud.checkServiceTrafficDistribution(&invalid)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "PreferFar")
+}
+
+func TestGetServicePreferredZone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	svc := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerTrafficDistribution: consts.TrafficDistributionPreferClose,
+	}, false, 80)
+	fipName := cloud.getDefaultFrontendIPConfigName(&svc)
+	mockPIPClient := cloud.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{
+		{
+			Name:  pointer.String("pip-zonal"),
+			Zones: &[]string{"2"},
+		},
+		{
+			Name:  pointer.String("pip-zone-redundant"),
+			Zones: &[]string{"1", "2", "3"},
+		},
+	}, nil).AnyTimes()
+
+	for _, tc := range []struct {
+		name            string
+		annotations     map[string]string
+		fips            []network.FrontendIPConfiguration
+		expectedZone    string
+		backendPoolType string
+	}{
+		{
+			name: "zonal internal frontend",
+			fips: []network.FrontendIPConfiguration{
+				{
+					Name:                                    pointer.String(fipName),
+					Zones:                                   &[]string{"1"},
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+				},
+			},
+			expectedZone: "westus-1",
+		},
+		{
+			name: "zonal public frontend",
+			fips: []network.FrontendIPConfiguration{
+				{
+					Name: pointer.String(fipName),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.PublicIPAddress{ID: pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pip-zonal")},
+					},
+				},
+			},
+			expectedZone: "westus-2",
+		},
+		{
+			name: "zone-redundant public frontend",
+			fips: []network.FrontendIPConfiguration{
+				{
+					Name: pointer.String(fipName),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.PublicIPAddress{ID: pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pip-zone-redundant")},
+					},
+				},
+			},
+		},
+		{
+			name: "frontends in different zones",
+			fips: []network.FrontendIPConfiguration{
+				{
+					Name:                                    pointer.String(fipName),
+					Zones:                                   &[]string{"1"},
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+				},
+				{
+					Name:                                    pointer.String(fipName + "-" + consts.IPVersionIPv6String),
+					Zones:                                   &[]string{"3"},
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+				},
+			},
+		},
+		{
+			name: "frontends of other services are ignored",
+			fips: []network.FrontendIPConfiguration{
+				{
+					Name:                                    pointer.String(fipName),
+					Zones:                                   &[]string{"1"},
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+				},
+				{
+					Name:                                    pointer.String("other"),
+					Zones:                                   &[]string{"3"},
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+				},
+			},
+			expectedZone: "westus-1",
+		},
+		{
+			name:        "traffic distribution is not PreferClose",
+			annotations: map[string]string{},
+			fips: []network.FrontendIPConfiguration{
+				{
+					Name:                                    pointer.String(fipName),
+					Zones:                                   &[]string{"1"},
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+				},
+			},
+		},
+		{
+			name:            "node IPs are in the backend pools",
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypeNodeIP,
+			fips: []network.FrontendIPConfiguration{
+				{
+					Name:                                    pointer.String(fipName),
+					Zones:                                   &[]string{"1"},
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+			if tc.backendPoolType != "" {
+				cloud.LoadBalancerBackendPoolConfigurationType = tc.backendPoolType
+			}
+			service := svc.DeepCopy()
+			if tc.annotations != nil {
+				service.Annotations = tc.annotations
+			}
+			lb := &network.LoadBalancer{
+				Name: pointer.String("lb1"),
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					FrontendIPConfigurations: &tc.fips,
+				},
+			}
+			assert.Equal(t, tc.expectedZone, cloud.getServicePreferredZone(service, lb))
+		})
+	}
+}
+
+func TestSetPodIPAddressesOfBackendPool(t *testing.T) {
+	bp := getTestBackendAddressPoolWithAdminStates("lb1", "default-svc1", map[string]network.LoadBalancerBackendAddressAdminState{
+		"10.1.0.1": "",
+		"10.1.0.2": network.LoadBalancerBackendAddressAdminStateNone,
+		"10.1.0.3": network.LoadBalancerBackendAddressAdminStateDrain,
+		"10.1.0.4": network.LoadBalancerBackendAddressAdminStateNone,
+	})
+
+	added, drained, removed := setPodIPAddressesOfBackendPool(&bp, sets.New("10.1.0.1", "10.1.0.3", "10.1.0.5"), sets.New("10.1.0.2", "10.1.0.6"))
+	assert.Equal(t, 2, added)
+	assert.Equal(t, 1, drained)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, map[string]network.LoadBalancerBackendAddressAdminState{
+		"10.1.0.1": network.LoadBalancerBackendAddressAdminStateNone,
+		"10.1.0.2": network.LoadBalancerBackendAddressAdminStateDrain,
+		"10.1.0.3": network.LoadBalancerBackendAddressAdminStateNone,
+		"10.1.0.5": network.LoadBalancerBackendAddressAdminStateNone,
+	}, getPodIPAddressesAdminStates(&bp))
+
+	added, drained, removed = setPodIPAddressesOfBackendPool(&bp, sets.New("10.1.0.1", "10.1.0.3", "10.1.0.5"), sets.New("10.1.0.2", "10.1.0.6"))
+	assert.Zero(t, added+drained+removed)
+}
+
+func TestGetPodBackendPort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.endpointSlicesCache = sync.Map{}
+	cloud.endpointSlicesCache.Store("default/eps1", getTestPodEndpointSlice("eps1", "default", "svc1", podEndpoint{ip: "10.1.0.1", ready: true, serving: true}))
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+
+	for _, tc := range []struct {
+		name         string
+		port         v1.ServicePort
+		expectedPort int32
+		expectedErr  bool
+	}{
+		{
+			name:         "target port is unset",
+			port:         v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP},
+			expectedPort: 80,
+		},
+		{
+			name:         "numeric target port",
+			port:         v1.ServicePort{Port: 80, Protocol: v1.ProtocolTCP, TargetPort: intstr.FromInt(8000)},
+			expectedPort: 8000,
+		},
+		{
+			name:         "named target port",
+			port:         v1.ServicePort{Name: "http", Port: 80, Protocol: v1.ProtocolTCP, TargetPort: intstr.FromString("web")},
+			expectedPort: 8080,
+		},
+		{
+			name:        "named target port of another protocol",
+			port:        v1.ServicePort{Name: "http", Port: 80, Protocol: v1.ProtocolUDP, TargetPort: intstr.FromString("web")},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			port, err := cloud.getPodBackendPort(&svc, tc.port)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedPort, port)
+		})
+	}
+}
+
+func TestEnsureHostsInPoolPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	cloud.capabilities = newCloudCapabilities(consts.BackendAddressAdminStateMinAPIVersion)
+	cloud.endpointSlicesCache = sync.Map{}
+	cloud.endpointSlicesCache.Store("default/eps1", getTestPodEndpointSlice("eps1", "default", "svc1",
+		podEndpoint{ip: "10.1.0.1", ready: true, serving: true},
+		podEndpoint{ip: "10.1.0.2", serving: true, terminating: true},
+	))
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	bpName := cloud.getBackendPoolNameForService(&svc, "kubernetes", false)
+	assert.Equal(t, "default-svc1", bpName)
+
+	bp := getTestBackendAddressPoolWithAdminStates("lb1", bpName, map[string]network.LoadBalancerBackendAddressAdminState{
+		"10.1.0.2": network.LoadBalancerBackendAddressAdminStateNone,
+		"10.1.0.3": network.LoadBalancerBackendAddressAdminStateNone,
+	})
+	expectedBP := getTestBackendAddressPoolWithAdminStates("lb1", bpName, map[string]network.LoadBalancerBackendAddressAdminState{
+		"10.1.0.1": "",
+		"10.1.0.2": network.LoadBalancerBackendAddressAdminStateDrain,
+	})
+	*expectedBP.LoadBalancerBackendAddresses = []network.LoadBalancerBackendAddress{
+		(*expectedBP.LoadBalancerBackendAddresses)[1],
+		(*expectedBP.LoadBalancerBackendAddresses)[0],
+	}
+	expectedBP.VirtualNetwork = &network.SubResource{ID: pointer.String(cloud.getVnetResourceID())}
+
+	mockLBClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), gomock.Any(), "lb1", bpName, expectedBP, gomock.Any()).Return(nil)
+	cloud.LoadBalancerClient = mockLBClient
+
+	backendPool := newBackendPoolTypePodIP(cloud)
+	err := backendPool.EnsureHostsInPool(&svc, nil, "", "", "kubernetes", "lb1", bp)
+	assert.NoError(t, err)
+
+	// The terminating pods are removed if the admin state is not supported by the target cloud.
+	cloud.capabilities = newCloudCapabilities(consts.ProbeThresholdMinAPIVersion)
+	expectedBP = getTestBackendAddressPoolWithAdminStates("lb1", bpName, map[string]network.LoadBalancerBackendAddressAdminState{
+		"10.1.0.1": "",
+	})
+	expectedBP.VirtualNetwork = &network.SubResource{ID: pointer.String(cloud.getVnetResourceID())}
+	mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), gomock.Any(), "lb1", bpName, expectedBP, gomock.Any()).Return(nil)
+	err = backendPool.EnsureHostsInPool(&svc, nil, "", "", "kubernetes", "lb1", bp)
+	assert.NoError(t, err)
+
+	// The shared backend pool of the cluster is not touched.
+	err = backendPool.EnsureHostsInPool(&svc, nil, "", "", "kubernetes", "lb1", getTestBackendAddressPoolWithIPs("lb1", "kubernetes", nil))
+	assert.NoError(t, err)
+}
+
+func TestReconcileBackendPoolsPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	cloud.endpointSlicesCache = sync.Map{}
+	cloud.endpointSlicesCache.Store("default/eps1", getTestPodEndpointSlice("eps1", "default", "svc1", podEndpoint{ip: "10.1.0.1", ready: true, serving: true}))
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	lb := network.LoadBalancer{
+		Name: pointer.String("lb1"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{Name: pointer.String("kubernetes")},
+			},
+		},
+	}
+
+	backendPool := newBackendPoolTypePodIP(cloud)
+	_, changed, shouldRefresh, err := backendPool.ReconcileBackendPools("kubernetes", &svc, &lb)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.False(t, shouldRefresh)
+	assert.Len(t, *lb.BackendAddressPools, 2)
+	bp := (*lb.BackendAddressPools)[1]
+	assert.Equal(t, "default-svc1", pointer.StringDeref(bp.Name, ""))
+	assert.Equal(t, map[string]network.LoadBalancerBackendAddressAdminState{
+		"10.1.0.1": network.LoadBalancerBackendAddressAdminStateNone,
+	}, getPodIPAddressesAdminStates(&bp))
+
+	_, changed, _, err = backendPool.ReconcileBackendPools("kubernetes", &svc, &lb)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestRepairPodIPBackendPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	cloud.capabilities = newCloudCapabilities(consts.BackendAddressAdminStateMinAPIVersion)
+	cloud.localServiceNameToServiceInfoMap = sync.Map{}
+	cloud.localServiceNameToServiceInfoMap.Store("default/svc1", newServiceInfo(consts.IPVersionIPv4String, "lb1"))
+
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false)
+	client := fake.NewSimpleClientset(&svc)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	cloud.serviceLister = informerFactory.Core().V1().Services().Lister()
+	_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+	cloud.endpointSlicesCache = sync.Map{}
+	cloud.endpointSlicesCache.Store("default/eps1", getTestPodEndpointSlice("eps1", "default", "svc1",
+		podEndpoint{ip: "10.1.0.1", ready: true, serving: true},
+		podEndpoint{ip: "10.1.0.2", serving: true, terminating: true},
+		podEndpoint{ip: "10.1.0.3", ready: true, serving: true},
+	))
+
+	mockLBClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	mockLBClient.EXPECT().GetLBBackendPool(gomock.Any(), gomock.Any(), "lb1", "default-svc1", "").Return(
+		getTestBackendAddressPoolWithAdminStates("lb1", "default-svc1", map[string]network.LoadBalancerBackendAddressAdminState{
+			"10.1.0.1": network.LoadBalancerBackendAddressAdminStateNone,
+			"10.1.0.2": network.LoadBalancerBackendAddressAdminStateNone,
+			"10.1.0.4": network.LoadBalancerBackendAddressAdminStateNone,
+			"10.1.0.5": network.LoadBalancerBackendAddressAdminStateDrain,
+		}), nil)
+	cloud.LoadBalancerClient = mockLBClient
+
+	u := newLoadBalancerBackendPoolUpdater(cloud, time.Second)
+	cloud.backendPoolUpdater = u
+
+	corrections := cloud.repairLocalServiceBackendPools(context.Background())
+	assert.Equal(t, 4, corrections)
+	assert.Equal(t, []batchOperation{
+		getRemoveIPsFromBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.1.0.4", "10.1.0.5"}),
+		getDrainIPsInBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.1.0.2"}),
+		getAddIPsToBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.1.0.3"}),
+	}, u.operations)
+}
+
+func TestLoadBalancerBackendPoolUpdaterPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	cloud.capabilities = newCloudCapabilities(consts.BackendAddressAdminStateMinAPIVersion)
+	cloud.localServiceNameToServiceInfoMap = sync.Map{}
+	cloud.localServiceNameToServiceInfoMap.Store("default/svc1", newServiceInfo(consts.IPVersionIPv4String, "lb1"))
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false)
+	client := fake.NewSimpleClientset(&svc)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	cloud.serviceLister = informerFactory.Core().V1().Services().Lister()
+	_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+
+	existingBP := getTestBackendAddressPoolWithAdminStates("lb1", "default-svc1", map[string]network.LoadBalancerBackendAddressAdminState{
+		"10.1.0.1": network.LoadBalancerBackendAddressAdminStateDrain,
+		"10.1.0.2": network.LoadBalancerBackendAddressAdminStateNone,
+	})
+	expectedBP := getTestBackendAddressPoolWithAdminStates("lb1", "default-svc1", map[string]network.LoadBalancerBackendAddressAdminState{
+		"10.1.0.1": network.LoadBalancerBackendAddressAdminStateNone,
+		"10.1.0.2": network.LoadBalancerBackendAddressAdminStateDrain,
+		"10.1.0.3": "",
+	})
+	mockLBClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	mockLBClient.EXPECT().GetLBBackendPool(gomock.Any(), gomock.Any(), "lb1", "default-svc1", "").Return(existingBP, nil)
+	mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), gomock.Any(), "lb1", "default-svc1", expectedBP, gomock.Any()).Return(nil)
+	cloud.LoadBalancerClient = mockLBClient
+
+	u := newLoadBalancerBackendPoolUpdater(cloud, time.Second)
+	u.addOperation(getDrainIPsInBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.1.0.2", "10.1.0.4"}))
+	u.addOperation(getAddIPsToBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.1.0.1", "10.1.0.3"}))
+	u.process()
+	assert.Empty(t, u.operations)
+
+	// The pods to be drained are removed if the admin state is not supported by the target cloud.
+	cloud.capabilities = newCloudCapabilities(consts.ProbeThresholdMinAPIVersion)
+	existingBP = getTestBackendAddressPoolWithAdminStates("lb1", "default-svc1", map[string]network.LoadBalancerBackendAddressAdminState{
+		"10.1.0.1": "",
+		"10.1.0.2": "",
+	})
+	expectedBP = getTestBackendAddressPoolWithAdminStates("lb1", "default-svc1", map[string]network.LoadBalancerBackendAddressAdminState{
+		"10.1.0.1": "",
+	})
+	mockLBClient.EXPECT().GetLBBackendPool(gomock.Any(), gomock.Any(), "lb1", "default-svc1", "").Return(existingBP, nil)
+	mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), gomock.Any(), "lb1", "default-svc1", expectedBP, gomock.Any()).Return(nil)
+	u.addOperation(getDrainIPsInBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.1.0.2"}))
+	u.process()
+	assert.Empty(t, u.operations)
+}
+
+func TestGetExpectedLBRulesPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	cloud.endpointSlicesCache = sync.Map{}
+	cloud.endpointSlicesCache.Store("default/eps1", getTestPodEndpointSlice("eps1", "default", "svc1", podEndpoint{ip: "10.1.0.1", ready: true, serving: true}))
+	svc := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerHealthProbeProtocol: "tcp",
+	}, false, 80)
+	svc.Spec.Ports[0].Name = "http"
+	svc.Spec.Ports[0].TargetPort = intstr.FromString("web")
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	svc.Spec.HealthCheckNodePort = 32000
+
+	probes, rules, err := cloud.getExpectedLBRules(&svc, "frontendIPConfigID", "backendPoolID", "lb1", false)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, int32(8080), pointer.Int32Deref(rules[0].BackendPort, 0))
+	assert.False(t, pointer.BoolDeref(rules[0].EnableFloatingIP, true))
+	assert.Len(t, probes, 1)
+	assert.Equal(t, int32(8080), pointer.Int32Deref(probes[0].Port, 0))
+	assert.Equal(t, network.ProbeProtocolTCP, probes[0].Protocol)
+}
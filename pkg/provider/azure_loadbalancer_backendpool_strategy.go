@@ -0,0 +1,148 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// BackendPoolFactory creates the backend pool strategy of the cloud. It is called once during the
+// initialization of the cloud, after the VMSet has been set up.
+type BackendPoolFactory func(az *Cloud) (BackendPool, error)
+
+// BackendPoolTraits describes the backends a backend pool strategy puts into the backend pools. The
+// features depending on the kind of the backends, e.g., the IP-based backend pool API or the loops
+// maintaining the node IPs in the backend pools, are enabled according to the traits.
+type BackendPoolTraits struct {
+	// IPBased is true if the backends are referenced by their IP addresses instead of the IP
+	// configurations of the network interfaces. It requires the IP-based backend pools of the network API.
+	IPBased bool
+	// NodeBackends is true if the backends are the nodes, e.g., the node IPs or the node network
+	// interfaces, rather than the pods.
+	NodeBackends bool
+}
+
+// backendPoolType is a registered backend pool strategy.
+type backendPoolType struct {
+	traits  BackendPoolTraits
+	factory BackendPoolFactory
+}
+
+var (
+	backendPoolTypesLock sync.RWMutex
+	// backendPoolTypes maps the lower-cased names of the backend pool types to the strategies.
+	backendPoolTypes = map[string]backendPoolType{}
+)
+
+func init() {
+	RegisterBackendPoolType(consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration,
+		BackendPoolTraits{NodeBackends: true},
+		func(az *Cloud) (BackendPool, error) {
+			return newBackendPoolTypeNodeIPConfig(az), nil
+		})
+	RegisterBackendPoolType(consts.LoadBalancerBackendPoolConfigurationTypeNodeIP,
+		BackendPoolTraits{IPBased: true, NodeBackends: true},
+		func(az *Cloud) (BackendPool, error) {
+			return newBackendPoolTypeNodeIP(az), nil
+		})
+	RegisterBackendPoolType(consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+		BackendPoolTraits{IPBased: true},
+		func(az *Cloud) (BackendPool, error) {
+			return newBackendPoolTypePodIP(az), nil
+		})
+}
+
+// RegisterBackendPoolType registers the backend pool strategy which can be selected by setting
+// loadBalancerBackendPoolConfigurationType to the given name in the cloud config. The name is
+// case-insensitive, and registering an existing name overrides the previous strategy. It must be
+// called before the cloud is initialized, e.g., in the init function of the package providing the strategy.
+func RegisterBackendPoolType(name string, traits BackendPoolTraits, factory BackendPoolFactory) {
+	backendPoolTypesLock.Lock()
+	defer backendPoolTypesLock.Unlock()
+
+	backendPoolTypes[strings.ToLower(name)] = backendPoolType{traits: traits, factory: factory}
+}
+
+// getBackendPoolType returns the registered backend pool strategy of the given name.
+func getBackendPoolType(name string) (backendPoolType, bool) {
+	backendPoolTypesLock.RLock()
+	defer backendPoolTypesLock.RUnlock()
+
+	poolType, found := backendPoolTypes[strings.ToLower(name)]
+	return poolType, found
+}
+
+// registeredBackendPoolTypes returns the sorted lower-cased names of the registered backend pool types.
+func registeredBackendPoolTypes() []string {
+	backendPoolTypesLock.RLock()
+	defer backendPoolTypesLock.RUnlock()
+
+	names := make([]string, 0, len(backendPoolTypes))
+	for name := range backendPoolTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newLoadBalancerBackendPool creates the backend pool strategy selected by the cloud config.
+func (az *Cloud) newLoadBalancerBackendPool() (BackendPool, error) {
+	poolType, found := getBackendPoolType(az.LoadBalancerBackendPoolConfigurationType)
+	if !found {
+		return nil, fmt.Errorf("loadBalancerBackendPoolConfigurationType %s is not registered, registered values are %v", az.LoadBalancerBackendPoolConfigurationType, registeredBackendPoolTypes())
+	}
+	backendPool, err := poolType.factory(az)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the backend pool of type %s: %w", az.LoadBalancerBackendPoolConfigurationType, err)
+	}
+	return backendPool, nil
+}
+
+// getBackendPoolTraits returns the traits of the backend pool strategy selected by the cloud config.
+func (az *Cloud) getBackendPoolTraits() BackendPoolTraits {
+	poolType, _ := getBackendPoolType(az.LoadBalancerBackendPoolConfigurationType)
+	return poolType.traits
+}
+
+// useIPBasedBackendPool returns true if the backends are referenced by their IP addresses.
+func (az *Cloud) useIPBasedBackendPool() bool {
+	return az.getBackendPoolTraits().IPBased
+}
+
+// useNodeIPBackendPool returns true if the private IPs of the nodes are put into the backend pools.
+func (az *Cloud) useNodeIPBackendPool() bool {
+	traits := az.getBackendPoolTraits()
+	return traits.IPBased && traits.NodeBackends
+}
+
+// useNodeIPConfigBackendPool returns true if the IP configurations of the node network interfaces
+// are put into the backend pools.
+func (az *Cloud) useNodeIPConfigBackendPool() bool {
+	traits := az.getBackendPoolTraits()
+	return !traits.IPBased && traits.NodeBackends
+}
+
+// usePodIPBackendPool returns true if the IPs of the pods backing the services are put into the backend pools.
+func (az *Cloud) usePodIPBackendPool() bool {
+	traits := az.getBackendPoolTraits()
+	return traits.IPBased && !traits.NodeBackends
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestNewLoadBalancerBackendPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	restoreBackendPoolTypes(t)
+	fakeBackendPool := NewMockBackendPool(ctrl)
+	RegisterBackendPoolType("fakeStrategy", BackendPoolTraits{IPBased: true}, func(_ *Cloud) (BackendPool, error) {
+		return fakeBackendPool, nil
+	})
+	RegisterBackendPoolType("brokenStrategy", BackendPoolTraits{}, func(_ *Cloud) (BackendPool, error) {
+		return nil, errors.New("broken")
+	})
+
+	for _, tc := range []struct {
+		desc            string
+		backendPoolType string
+		expected        func(*Cloud) BackendPool
+		expectedErr     bool
+	}{
+		{
+			desc:            "built-in nodeIPConfiguration strategy",
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration,
+			expected:        newBackendPoolTypeNodeIPConfig,
+		},
+		{
+			desc:            "built-in nodeIP strategy",
+			backendPoolType: "NodeIP",
+			expected:        newBackendPoolTypeNodeIP,
+		},
+		{
+			desc:            "built-in podIP strategy",
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+			expected:        newBackendPoolTypePodIP,
+		},
+		{
+			desc:            "registered strategy",
+			backendPoolType: "FakeStrategy",
+			expected:        func(*Cloud) BackendPool { return fakeBackendPool },
+		},
+		{
+			desc:            "factory error",
+			backendPoolType: "brokenStrategy",
+			expectedErr:     true,
+		},
+		{
+			desc:            "unregistered strategy",
+			backendPoolType: "unknown",
+			expectedErr:     true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerBackendPoolConfigurationType = tc.backendPoolType
+			backendPool, err := az.newLoadBalancerBackendPool()
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected(az), backendPool)
+		})
+	}
+}
+
+func TestBackendPoolTraits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	restoreBackendPoolTypes(t)
+	RegisterBackendPoolType("podStrategy", BackendPoolTraits{IPBased: true}, func(_ *Cloud) (BackendPool, error) {
+		return nil, nil
+	})
+
+	for _, tc := range []struct {
+		backendPoolType           string
+		expectedIPBased           bool
+		expectedNodeIPBased       bool
+		expectedNodeIPConfigBased bool
+		expectedPodIPBased        bool
+	}{
+		{
+			backendPoolType:           consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration,
+			expectedNodeIPConfigBased: true,
+		},
+		{
+			backendPoolType:     consts.LoadBalancerBackendPoolConfigurationTypeNodeIP,
+			expectedIPBased:     true,
+			expectedNodeIPBased: true,
+		},
+		{
+			backendPoolType:    consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+			expectedIPBased:    true,
+			expectedPodIPBased: true,
+		},
+		{
+			backendPoolType:    "PodStrategy",
+			expectedIPBased:    true,
+			expectedPodIPBased: true,
+		},
+		{
+			backendPoolType: "unknown",
+		},
+	} {
+		t.Run(tc.backendPoolType, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerBackendPoolConfigurationType = tc.backendPoolType
+			assert.Equal(t, tc.expectedIPBased, az.useIPBasedBackendPool())
+			assert.Equal(t, tc.expectedNodeIPBased, az.useNodeIPBackendPool())
+			assert.Equal(t, tc.expectedNodeIPConfigBased, az.useNodeIPConfigBackendPool())
+			assert.Equal(t, tc.expectedPodIPBased, az.usePodIPBackendPool())
+		})
+	}
+}
+
+func TestRegisteredBackendPoolTypes(t *testing.T) {
+	restoreBackendPoolTypes(t)
+	assert.Equal(t, []string{"nodeip", "nodeipconfiguration", "podip"}, registeredBackendPoolTypes())
+
+	RegisterBackendPoolType("Custom", BackendPoolTraits{}, nil)
+	assert.Equal(t, []string{"custom", "nodeip", "nodeipconfiguration", "podip"}, registeredBackendPoolTypes())
+}
+
+// restoreBackendPoolTypes restores the registered backend pool types when the test finishes.
+func restoreBackendPoolTypes(t *testing.T) {
+	backendPoolTypesLock.RLock()
+	saved := make(map[string]backendPoolType, len(backendPoolTypes))
+	for name, poolType := range backendPoolTypes {
+		saved[name] = poolType
+	}
+	backendPoolTypesLock.RUnlock()
+
+	t.Cleanup(func() {
+		backendPoolTypesLock.Lock()
+		defer backendPoolTypesLock.Unlock()
+		backendPoolTypes = saved
+	})
+}
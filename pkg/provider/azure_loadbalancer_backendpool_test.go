@@ -374,7 +374,7 @@ func TestEnsureHostsInPoolNodeIP(t *testing.T) {
 		t.Run(tc.desc, func(t *testing.T) {
 			az := GetTestCloud(ctrl)
 			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
-			az.nodePrivateIPToNodeNameMap = map[string]string{
+			az.nodeTopology.nodeNamesByIP = map[string]string{
 				"10.0.0.2": "vmss-0",
 				"2001::2":  "vmss-0",
 				"10.0.0.1": "vmss-1",
@@ -387,7 +387,7 @@ func TestEnsureHostsInPoolNodeIP(t *testing.T) {
 			if len(tc.multiSLBConfigs) > 0 {
 				az.MultipleStandardLoadBalancerConfigurations = tc.multiSLBConfigs
 				az.LoadBalancerSku = consts.LoadBalancerSkuStandard
-				az.nodePrivateIPToNodeNameMap = map[string]string{
+				az.nodeTopology.nodeNamesByIP = map[string]string{
 					"10.0.0.2": "vmss-0",
 					"2001::2":  "vmss-0",
 					"10.0.0.1": "vmss-1",
@@ -420,10 +420,8 @@ func TestEnsureHostsInPoolNodeIP(t *testing.T) {
 				az.endpointSlicesCache.Store("another/eps", epsInAnotherNamespace)
 			}
 			az.KubeClient = kubeClient
-			az.nodePrivateIPs = map[string]sets.Set[string]{
-				"vmss-0": sets.New[string]("1.2.3.4"),
-				"vmss-1": sets.New[string]("5.6.7.8"),
-			}
+			az.nodeTopology.setPrivateIPs("vmss-0", sets.New[string]("1.2.3.4"))
+			az.nodeTopology.setPrivateIPs("vmss-1", sets.New[string]("5.6.7.8"))
 
 			service := getTestServiceDualStack("svc-1", v1.ProtocolTCP, nil, 80)
 			if tc.local {
@@ -805,7 +803,7 @@ func TestReconcileBackendPoolsNodeIP(t *testing.T) {
 	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIP
 	az.KubeClient = fake.NewSimpleClientset(nodes[0], nodes[1])
 	az.excludeLoadBalancerNodes = sets.New("vmss-0")
-	az.nodePrivateIPs["vmss-0"] = sets.New("10.0.0.1")
+	az.nodeTopology.setPrivateIPs("vmss-0", sets.New("10.0.0.1"))
 
 	lbClient := mockloadbalancerclient.NewMockInterface(ctrl)
 	lbClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), bp, gomock.Any()).Return(nil)
@@ -1015,9 +1013,7 @@ func TestGetBackendPrivateIPsNodeIPConfig(t *testing.T) {
 	mockVMSet.EXPECT().GetNodeNameByIPConfigurationID("ipconfig2").Return("node2", "", nil)
 
 	az := GetTestCloud(ctrl)
-	az.nodePrivateIPs = map[string]sets.Set[string]{
-		"node1": sets.New("1.2.3.4", "fe80::1"),
-	}
+	az.nodeTopology.setPrivateIPs("node1", sets.New("1.2.3.4", "fe80::1"))
 	az.VMSet = mockVMSet
 	bc := newBackendPoolTypeNodeIPConfig(az)
 	svc := getTestService("svc1", "TCP", nil, false)
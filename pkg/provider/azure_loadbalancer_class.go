@@ -0,0 +1,57 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// IsLoadBalancerClassFilteringEnabled returns true if the services are filtered by spec.loadBalancerClass, in
+// which case the service controller must watch the services through TransformServiceLoadBalancerClass.
+func (az *Cloud) IsLoadBalancerClassFilteringEnabled() bool {
+	return az.LoadBalancerClass != ""
+}
+
+// isServiceReconciledByLoadBalancerClass returns true if the cloud provider reconciles the service according
+// to its spec.loadBalancerClass.
+func (az *Cloud) isServiceReconciledByLoadBalancerClass(service *v1.Service) bool {
+	if service.Spec.LoadBalancerClass == nil {
+		return !az.IgnoreServicesWithoutLoadBalancerClass
+	}
+	return az.LoadBalancerClass != "" && *service.Spec.LoadBalancerClass == az.LoadBalancerClass
+}
+
+// TransformServiceLoadBalancerClass is the transform of the service informer of the service controller, which
+// only reconciles the services without a spec.loadBalancerClass. The class of the services reconciled by the
+// cloud provider is cleared, and the services without a class are given consts.IgnoredLoadBalancerClass if they
+// are ignored. The objects in the informer cache must not be written back to the API server as a whole.
+func (az *Cloud) TransformServiceLoadBalancerClass(obj interface{}) (interface{}, error) {
+	service, ok := obj.(*v1.Service)
+	if !ok || service.Spec.Type != v1.ServiceTypeLoadBalancer {
+		return obj, nil
+	}
+
+	if az.isServiceReconciledByLoadBalancerClass(service) {
+		service.Spec.LoadBalancerClass = nil
+	} else if service.Spec.LoadBalancerClass == nil {
+		service.Spec.LoadBalancerClass = pointer.String(consts.IgnoredLoadBalancerClass)
+	}
+	return service, nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestTransformServiceLoadBalancerClass(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		description              string
+		loadBalancerClass        string
+		ignoreServicesWithoutCls bool
+		serviceType              v1.ServiceType
+		serviceClass             *string
+		expectedClass            *string
+	}{
+		{
+			description:   "services without a class are reconciled by default",
+			serviceType:   v1.ServiceTypeLoadBalancer,
+			expectedClass: nil,
+		},
+		{
+			description:       "the class of the cloud provider is cleared",
+			loadBalancerClass: "azure",
+			serviceType:       v1.ServiceTypeLoadBalancer,
+			serviceClass:      pointer.String("azure"),
+			expectedClass:     nil,
+		},
+		{
+			description:       "other classes are kept",
+			loadBalancerClass: "azure",
+			serviceType:       v1.ServiceTypeLoadBalancer,
+			serviceClass:      pointer.String("metallb"),
+			expectedClass:     pointer.String("metallb"),
+		},
+		{
+			description:              "services without a class are ignored per policy",
+			loadBalancerClass:        "azure",
+			ignoreServicesWithoutCls: true,
+			serviceType:              v1.ServiceTypeLoadBalancer,
+			expectedClass:            pointer.String(consts.IgnoredLoadBalancerClass),
+		},
+		{
+			description:              "services of other types are not changed",
+			loadBalancerClass:        "azure",
+			ignoreServicesWithoutCls: true,
+			serviceType:              v1.ServiceTypeClusterIP,
+			expectedClass:            nil,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerClass = tc.loadBalancerClass
+			az.IgnoreServicesWithoutLoadBalancerClass = tc.ignoreServicesWithoutCls
+			service := getTestService("service", v1.ProtocolTCP, nil, false, 80)
+			service.Spec.Type = tc.serviceType
+			service.Spec.LoadBalancerClass = tc.serviceClass
+
+			obj, err := az.TransformServiceLoadBalancerClass(&service)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedClass, obj.(*v1.Service).Spec.LoadBalancerClass)
+			assert.Equal(t, tc.loadBalancerClass != "", az.IsLoadBalancerClassFilteringEnabled())
+		})
+	}
+}
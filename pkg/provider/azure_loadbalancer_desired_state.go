@@ -0,0 +1,294 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// useLoadBalancerDesiredStateCache returns true if the reconcile of the service can be short-circuited by the
+// desired state persisted in the configmap. The services depending on the resources not covered by the
+// fingerprint are always reconciled.
+func (az *Cloud) useLoadBalancerDesiredStateCache(service *v1.Service) bool {
+	return az.EnableLoadBalancerDesiredStateCache &&
+		az.KubeClient != nil &&
+		!consts.IsAzureFirewallDNATEnabled(service.Annotations) &&
+		!consts.IsPLSEnabled(service.Annotations) &&
+		!consts.IsK8sServiceInternalAndExternal(service) &&
+		!az.useDedicatedBackendPool(service)
+}
+
+// getLoadBalancerDesiredState returns the desired state of the service on the load balancer, which is the name of
+// the load balancer followed by the fingerprint of the service, the nodes, the rules, probes and frontends of the
+// service, the managed backend pools and the etags of the load balancer and the security group. The security group
+// is read from Azure, so the load balancer should be read from Azure as well, by the conditional GET revalidating
+// the ETag of the last response, to tell the changes made out-of-band.
+func (az *Cloud) getLoadBalancerDesiredState(clusterName string, service *v1.Service, nodes []*v1.Node, lb *network.LoadBalancer) (string, error) {
+	sg, err := az.getSecurityGroup(azcache.CacheReadTypeForceRefresh)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		rules        []network.LoadBalancingRule
+		probes       []network.Probe
+		frontends    []network.FrontendIPConfiguration
+		backendPools []network.BackendAddressPool
+	)
+	if lb.LoadBalancerPropertiesFormat != nil {
+		if lb.LoadBalancingRules != nil {
+			for _, rule := range *lb.LoadBalancingRules {
+				if az.serviceOwnsRule(service, pointer.StringDeref(rule.Name, "")) {
+					rules = append(rules, rule)
+				}
+			}
+		}
+		if lb.Probes != nil {
+			for _, probe := range *lb.Probes {
+				if az.serviceOwnsRule(service, pointer.StringDeref(probe.Name, "")) {
+					probes = append(probes, probe)
+				}
+			}
+		}
+		if lb.FrontendIPConfigurations != nil {
+			for _, fip := range *lb.FrontendIPConfigurations {
+				if owns, _, _ := az.serviceOwnsFrontendIP(fip, service); owns {
+					frontends = append(frontends, fip)
+				}
+			}
+		}
+		// the membership of the backend pools doesn't always change the etag of the load balancer
+		if lb.BackendAddressPools != nil {
+			managedBackendPoolIDs := sets.New[string]()
+			for _, id := range az.getBackendPoolIDs(clusterName, pointer.StringDeref(lb.Name, "")) {
+				managedBackendPoolIDs.Insert(strings.ToLower(id))
+			}
+			for _, pool := range *lb.BackendAddressPools {
+				if managedBackendPoolIDs.Has(strings.ToLower(pointer.StringDeref(pool.ID, ""))) {
+					backendPools = append(backendPools, pool)
+				}
+			}
+		}
+	}
+
+	data, err := json.Marshal(struct {
+		Service      uint64
+		LBETag       string
+		SGETag       string
+		Rules        []network.LoadBalancingRule
+		Probes       []network.Probe
+		Frontends    []network.FrontendIPConfiguration
+		BackendPools []network.BackendAddressPool
+	}{
+		Service:      az.getServiceReconcileFingerprint(service, nodes),
+		LBETag:       pointer.StringDeref(lb.Etag, ""),
+		SGETag:       pointer.StringDeref(sg.Etag, ""),
+		Rules:        rules,
+		Probes:       probes,
+		Frontends:    frontends,
+		BackendPools: backendPools,
+	})
+	if err != nil {
+		return "", err
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write(data)
+	return fmt.Sprintf("%s/%x", pointer.StringDeref(lb.Name, ""), hash.Sum64()), nil
+}
+
+// getCachedLoadBalancerStatus returns the status of the service if nothing changed since the desired state
+// persisted in the configmap was reconciled.
+func (az *Cloud) getCachedLoadBalancerStatus(clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, bool) {
+	if !az.useLoadBalancerDesiredStateCache(service) {
+		return nil, false
+	}
+	persisted, ok := az.getPersistedLoadBalancerDesiredState(service)
+	if !ok {
+		return nil, false
+	}
+	lbName, _, found := strings.Cut(persisted, "/")
+	if !found {
+		return nil, false
+	}
+
+	lb, exists, err := az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeForceRefresh)
+	if err != nil || !exists {
+		return nil, false
+	}
+	desired, err := az.getLoadBalancerDesiredState(clusterName, service, nodes, lb)
+	if err != nil {
+		klog.Warningf("getCachedLoadBalancerStatus: failed to get the desired state of service %q: %v", getServiceName(service), err)
+		return nil, false
+	}
+	if desired != persisted {
+		klog.V(4).Infof("getCachedLoadBalancerStatus: the desired state of service %q changed from %q to %q", getServiceName(service), persisted, desired)
+		return nil, false
+	}
+
+	status, _, _, err := az.getServiceLoadBalancerStatus(service, lb)
+	if err != nil || status == nil {
+		return nil, false
+	}
+	return status, true
+}
+
+// persistLoadBalancerDesiredState persists the desired state of the service reconciled on the load balancer in the
+// configmap. It is not persisted in the service, whose updates would trigger another reconcile. The errors are only
+// logged, and the service is reconciled next time.
+func (az *Cloud) persistLoadBalancerDesiredState(clusterName string, service *v1.Service, nodes []*v1.Node, lbName string) {
+	if !az.useLoadBalancerDesiredStateCache(service) {
+		return
+	}
+	serviceName := getServiceName(service)
+	persisted, ok := az.getPersistedLoadBalancerDesiredState(service)
+	if !ok {
+		return
+	}
+
+	// the load balancer and the security group are read from Azure, so the etags are the ones after the reconcile
+	// even if it didn't update them
+	lb, exists, err := az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeForceRefresh)
+	if err != nil || !exists {
+		klog.Warningf("persistLoadBalancerDesiredState: failed to get load balancer %q of service %q, exists = %t: %v", lbName, serviceName, exists, err)
+		return
+	}
+	desired, err := az.getLoadBalancerDesiredState(clusterName, service, nodes, lb)
+	if err != nil {
+		klog.Warningf("persistLoadBalancerDesiredState: failed to get the desired state of service %q: %v", serviceName, err)
+		return
+	}
+	if desired == persisted {
+		return
+	}
+
+	if err := az.patchLoadBalancerDesiredState(service, &desired); err != nil {
+		klog.Warningf("persistLoadBalancerDesiredState: failed to persist the desired state of service %q: %v", serviceName, err)
+		return
+	}
+	klog.V(4).Infof("persistLoadBalancerDesiredState: persisted the desired state %q of service %q", desired, serviceName)
+}
+
+// forgetLoadBalancerDesiredState removes the desired state of the deleted service from the configmap.
+func (az *Cloud) forgetLoadBalancerDesiredState(service *v1.Service) {
+	if !az.EnableLoadBalancerDesiredStateCache || az.KubeClient == nil {
+		return
+	}
+	if persisted, ok := az.getPersistedLoadBalancerDesiredState(service); !ok || persisted == "" {
+		return
+	}
+	if err := az.patchLoadBalancerDesiredState(service, nil); err != nil {
+		klog.Warningf("forgetLoadBalancerDesiredState: failed to remove the desired state of service %q: %v", getServiceName(service), err)
+	}
+}
+
+// getLoadBalancerDesiredStateKey returns the key of the service in the configmap. The namespaces and the names of
+// the services don't contain dots, so the key is unique.
+func getLoadBalancerDesiredStateKey(service *v1.Service) string {
+	return fmt.Sprintf("%s.%s", service.Namespace, service.Name)
+}
+
+// getPersistedLoadBalancerDesiredState returns the desired state of the service persisted in the configmap, which
+// is loaded once and mirrored in memory afterwards. It returns false if the configmap can't be loaded.
+func (az *Cloud) getPersistedLoadBalancerDesiredState(service *v1.Service) (string, bool) {
+	if err := az.loadLoadBalancerDesiredStates(); err != nil {
+		klog.Warningf("getPersistedLoadBalancerDesiredState: failed to load the desired states: %v", err)
+		return "", false
+	}
+	if value, ok := az.loadBalancerDesiredStates.Load(getLoadBalancerDesiredStateKey(service)); ok {
+		return value.(string), true
+	}
+	return "", true
+}
+
+// loadLoadBalancerDesiredStates loads the desired states persisted in the configmap into memory if they aren't yet.
+func (az *Cloud) loadLoadBalancerDesiredStates() error {
+	az.loadBalancerDesiredStatesLock.Lock()
+	defer az.loadBalancerDesiredStatesLock.Unlock()
+	if az.loadBalancerDesiredStatesLoaded {
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	cm, err := az.KubeClient.CoreV1().ConfigMaps(consts.LoadBalancerDesiredStateConfigMapNamespace).Get(ctx, consts.LoadBalancerDesiredStateConfigMapName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get configmap %s/%s: %w", consts.LoadBalancerDesiredStateConfigMapNamespace, consts.LoadBalancerDesiredStateConfigMapName, err)
+	}
+	if err == nil {
+		for key, value := range cm.Data {
+			az.loadBalancerDesiredStates.Store(key, value)
+		}
+	}
+	az.loadBalancerDesiredStatesLoaded = true
+	return nil
+}
+
+// patchLoadBalancerDesiredState sets the desired state of the service in the configmap, or removes it if desired is
+// nil. Only the key of the service is patched, so the services reconciled concurrently, e.g., by other shards, don't
+// conflict.
+func (az *Cloud) patchLoadBalancerDesiredState(service *v1.Service, desired *string) error {
+	key := getLoadBalancerDesiredStateKey(service)
+	patch, err := json.Marshal(map[string]interface{}{
+		"data": map[string]*string{key: desired},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	configMaps := az.KubeClient.CoreV1().ConfigMaps(consts.LoadBalancerDesiredStateConfigMapNamespace)
+	_, err = configMaps.Patch(ctx, consts.LoadBalancerDesiredStateConfigMapName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) && desired != nil {
+		cm := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      consts.LoadBalancerDesiredStateConfigMapName,
+				Namespace: consts.LoadBalancerDesiredStateConfigMapNamespace,
+			},
+			Data: map[string]string{key: *desired},
+		}
+		if _, err = configMaps.Create(ctx, cm, metav1.CreateOptions{}); apierrors.IsAlreadyExists(err) {
+			_, err = configMaps.Patch(ctx, consts.LoadBalancerDesiredStateConfigMapName, types.MergePatchType, patch, metav1.PatchOptions{})
+		}
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to patch configmap %s/%s: %w", consts.LoadBalancerDesiredStateConfigMapNamespace, consts.LoadBalancerDesiredStateConfigMapName, err)
+	}
+
+	if desired != nil {
+		az.loadBalancerDesiredStates.Store(key, *desired)
+	} else {
+		az.loadBalancerDesiredStates.Delete(key)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestLoadBalancerDesiredState(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.EnableLoadBalancerDesiredStateCache = true
+
+	svc := getInternalTestService("service", 80)
+	svc.UID = "uid"
+	client := fake.NewSimpleClientset(&svc)
+	az.KubeClient = client
+	nodes := []*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.5"}}},
+	}}
+
+	lbName := "testCluster-internal"
+	fipName := az.GetLoadBalancerName(context.TODO(), "", &svc)
+	lb := network.LoadBalancer{
+		Name: pointer.String(lbName),
+		Etag: pointer.String("lb-etag"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{
+					Name: pointer.String(fipName),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddress: pointer.String("10.0.0.4"),
+					},
+				},
+			},
+			LoadBalancingRules: &[]network.LoadBalancingRule{
+				{Name: pointer.String(az.getLoadBalancerRuleName(&svc, v1.ProtocolTCP, 80, false))},
+				{Name: pointer.String("other-rule")},
+			},
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{
+					ID: pointer.String(az.getBackendPoolID(lbName, testClusterName)),
+					BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+						LoadBalancerBackendAddresses: &[]network.LoadBalancerBackendAddress{
+							{Name: pointer.String("node"), LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String("10.0.0.5")}},
+						},
+					},
+				},
+				{ID: pointer.String(az.getBackendPoolID(lbName, "other-pool"))},
+			},
+		},
+	}
+	sg := network.SecurityGroup{Name: pointer.String("nsg"), Etag: pointer.String("sg-etag")}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	azureLB := lb
+	mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, lbName, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _, _ string) (network.LoadBalancer, error) {
+			return azureLB, nil
+		}).AnyTimes()
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "nsg", gomock.Any()).Return(sg, nil).AnyTimes()
+
+	// nothing is persisted before the service is reconciled
+	_, ok := az.getCachedLoadBalancerStatus(testClusterName, &svc, nodes)
+	assert.False(t, ok)
+
+	az.persistLoadBalancerDesiredState(testClusterName, &svc, nodes, lbName)
+	persistedService, err := client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, svc.Annotations, persistedService.Annotations)
+	cm, err := client.CoreV1().ConfigMaps(consts.LoadBalancerDesiredStateConfigMapNamespace).Get(context.TODO(), consts.LoadBalancerDesiredStateConfigMapName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	desiredState := cm.Data["default.service"]
+	assert.True(t, strings.HasPrefix(desiredState, lbName+"/"))
+
+	// the desired states persisted by the previous process are loaded
+	az.loadBalancerDesiredStates = sync.Map{}
+	az.loadBalancerDesiredStatesLoaded = false
+
+	// the reconcile is short-circuited while nothing changed
+	status, ok := az.getCachedLoadBalancerStatus(testClusterName, persistedService, nodes)
+	assert.True(t, ok)
+	assert.Equal(t, &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.4"}}}, status)
+
+	// the changes made out-of-band are seen even if the load balancer is cached
+	azureLB.Etag = pointer.String("out-of-band-etag")
+	_, ok = az.getCachedLoadBalancerStatus(testClusterName, persistedService, nodes)
+	assert.False(t, ok)
+	azureLB = lb
+
+	// the changes of the service, the nodes or the load balancer are reconciled
+	changedService := persistedService.DeepCopy()
+	changedService.Spec.Ports[0].Port = 81
+	_, ok = az.getCachedLoadBalancerStatus(testClusterName, changedService, nodes)
+	assert.False(t, ok)
+
+	_, ok = az.getCachedLoadBalancerStatus(testClusterName, persistedService, append(nodes, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}}))
+	assert.False(t, ok)
+
+	// the changes of the node addresses or the exclusion of the nodes are reconciled
+	changedNode := nodes[0].DeepCopy()
+	changedNode.Status.Addresses[0].Address = "10.0.0.6"
+	_, ok = az.getCachedLoadBalancerStatus(testClusterName, persistedService, []*v1.Node{changedNode})
+	assert.False(t, ok)
+
+	az.excludeLoadBalancerNodes.Insert("node")
+	_, ok = az.getCachedLoadBalancerStatus(testClusterName, persistedService, nodes)
+	assert.False(t, ok)
+	az.excludeLoadBalancerNodes.Delete("node")
+
+	// the changes of the rules of other services or the unmanaged backend pools don't matter
+	changedLB := lb
+	changedLB.LoadBalancingRules = &[]network.LoadBalancingRule{(*lb.LoadBalancingRules)[0]}
+	changedLB.BackendAddressPools = &[]network.BackendAddressPool{(*lb.BackendAddressPools)[0]}
+	desired, err := az.getLoadBalancerDesiredState(testClusterName, persistedService, nodes, &changedLB)
+	assert.NoError(t, err)
+	assert.Equal(t, desiredState, desired)
+
+	// the changes of the membership of the managed backend pools are reconciled
+	changedLB.BackendAddressPools = &[]network.BackendAddressPool{{ID: (*lb.BackendAddressPools)[0].ID}}
+	desired, err = az.getLoadBalancerDesiredState(testClusterName, persistedService, nodes, &changedLB)
+	assert.NoError(t, err)
+	assert.NotEqual(t, desiredState, desired)
+	changedLB.BackendAddressPools = lb.BackendAddressPools
+
+	changedLB.Etag = pointer.String("changed-etag")
+	desired, err = az.getLoadBalancerDesiredState(testClusterName, persistedService, nodes, &changedLB)
+	assert.NoError(t, err)
+	assert.NotEqual(t, desiredState, desired)
+
+	// the desired state of the deleted service is removed
+	az.forgetLoadBalancerDesiredState(persistedService)
+	cm, err = client.CoreV1().ConfigMaps(consts.LoadBalancerDesiredStateConfigMapNamespace).Get(context.TODO(), consts.LoadBalancerDesiredStateConfigMapName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, cm.Data)
+	_, ok = az.getCachedLoadBalancerStatus(testClusterName, persistedService, nodes)
+	assert.False(t, ok)
+
+	// the cache is only used if enabled
+	az.persistLoadBalancerDesiredState(testClusterName, &svc, nodes, lbName)
+	az.EnableLoadBalancerDesiredStateCache = false
+	_, ok = az.getCachedLoadBalancerStatus(testClusterName, persistedService, nodes)
+	assert.False(t, ok)
+}
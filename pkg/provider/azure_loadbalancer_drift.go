@@ -0,0 +1,283 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+const (
+	// LoadBalancerDriftNotFound means no load balancer has a frontend IP configuration of the service.
+	LoadBalancerDriftNotFound = "LoadBalancerNotFound"
+	// LoadBalancerDriftIngressIPs means the IPs of the service are not on the frontend of the load balancer.
+	LoadBalancerDriftIngressIPs = "IngressIPMismatch"
+	// LoadBalancerDriftLoadBalancingRules means the load balancing rules of some ports of the service are missing.
+	LoadBalancerDriftLoadBalancingRules = "LoadBalancingRulesMissing"
+	// LoadBalancerDriftSecurityRules means the security group has no rules for the service.
+	LoadBalancerDriftSecurityRules = "SecurityRulesMissing"
+)
+
+var loadBalancerDriftKinds = []string{
+	LoadBalancerDriftNotFound,
+	LoadBalancerDriftIngressIPs,
+	LoadBalancerDriftLoadBalancingRules,
+	LoadBalancerDriftSecurityRules,
+}
+
+// loadBalancerDrift is a difference between a service and its load balancer.
+type loadBalancerDrift struct {
+	kind    string
+	message string
+}
+
+// loadBalancerDriftReporter records the drifts reported by the drift verification loop.
+// It is only used by the loop, so no lock is needed.
+type loadBalancerDriftReporter struct {
+	// services records the last reported drifts of each service.
+	services map[string][]loadBalancerDrift
+}
+
+// getReadOnlyLoadBalancerStatus returns the status of the existing load balancer of the service without changing
+// any Azure resources, which is used instead of reconciling the service in the read-only mode.
+func (az *Cloud) getReadOnlyLoadBalancerStatus(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, error) {
+	status, exists, err := az.GetLoadBalancer(ctx, clusterName, service)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || status == nil {
+		return nil, fmt.Errorf("the load balancer of service %s does not exist and is not created in the read-only mode", getServiceName(service))
+	}
+	return status, nil
+}
+
+// runLoadBalancerDriftVerificationLoop periodically verifies the load balancers of the services in the read-only mode.
+func (az *Cloud) runLoadBalancerDriftVerificationLoop(ctx context.Context, interval time.Duration) {
+	klog.V(2).Info("runLoadBalancerDriftVerificationLoop: started")
+	reporter := &loadBalancerDriftReporter{}
+	err := wait.PollUntilContextCancel(ctx, interval, false, func(ctx context.Context) (bool, error) {
+		if err := az.verifyLoadBalancerDrift(ctx, reporter); err != nil {
+			klog.Warningf("runLoadBalancerDriftVerificationLoop: failed to verify the load balancers: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runLoadBalancerDriftVerificationLoop: stopped due to %s", err.Error())
+}
+
+// verifyLoadBalancerDrift compares the load balancers with the services, and reports the number of drifted services
+// by metrics. An event is emitted on the service when its drifts change. Like EnsureLoadBalancer, the services are
+// compared with their AzureLoadBalancerConfiguration and the default annotations of their namespaces applied.
+func (az *Cloud) verifyLoadBalancerDrift(ctx context.Context, reporter *loadBalancerDriftReporter) error {
+	if az.serviceLister == nil {
+		klog.V(4).Info("verifyLoadBalancerDrift: the service lister is not initialized, skip verifying")
+		return nil
+	}
+	services, err := az.serviceLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		return err
+	}
+	var sg *network.SecurityGroup
+	if az.SecurityGroupName != "" {
+		securityGroup, err := az.getSecurityGroup(azcache.CacheReadTypeDefault)
+		if err != nil {
+			return fmt.Errorf("failed to get security group %s: %w", az.SecurityGroupName, err)
+		}
+		sg = &securityGroup
+	}
+
+	var errs []error
+	driftedServices := make(map[string]int)
+	serviceDrifts := make(map[string][]loadBalancerDrift)
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil ||
+			!az.isServiceReconciledByLoadBalancerClass(service) {
+			continue
+		}
+
+		serviceName := getServiceName(service)
+		last := reporter.services[serviceName]
+		drifts, err := az.getConfiguredLoadBalancerDrifts(ctx, service, lbs, sg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to verify the load balancer of service %s: %w", serviceName, err))
+			// keep the last drifts of the service if it cannot be verified this time
+			drifts = last
+		} else if !reflect.DeepEqual(last, drifts) {
+			az.emitLoadBalancerDriftEvents(service, last, drifts)
+		}
+		if len(drifts) == 0 {
+			continue
+		}
+
+		serviceDrifts[serviceName] = drifts
+		for _, drift := range drifts {
+			driftedServices[drift.kind]++
+		}
+	}
+
+	for _, kind := range loadBalancerDriftKinds {
+		metrics.SetLoadBalancerDriftedServices(kind, driftedServices[kind])
+	}
+	reporter.services = serviceDrifts
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// getConfiguredLoadBalancerDrifts returns the drifts of the load balancer of the service with its load balancer
+// configuration applied.
+func (az *Cloud) getConfiguredLoadBalancerDrifts(ctx context.Context, service *v1.Service, lbs []network.LoadBalancer, sg *network.SecurityGroup) ([]loadBalancerDrift, error) {
+	configured, err := az.withAzureLoadBalancerConfiguration(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	return az.getLoadBalancerDrifts(configured, lbs, sg)
+}
+
+// getLoadBalancerDrifts returns the differences between the service and its load balancer, or nil if there is none.
+// The security rules are not verified if sg is nil.
+func (az *Cloud) getLoadBalancerDrifts(service *v1.Service, lbs []network.LoadBalancer, sg *network.SecurityGroup) ([]loadBalancerDrift, error) {
+	isInternal := requiresInternalLoadBalancer(service)
+	var (
+		lb     *network.LoadBalancer
+		status *v1.LoadBalancerStatus
+	)
+	for i := range lbs {
+		if isInternalLoadBalancer(&lbs[i]) != isInternal {
+			continue
+		}
+		lbStatus, _, _, err := az.getServiceLoadBalancerStatus(service, &lbs[i])
+		if err != nil {
+			return nil, err
+		}
+		if lbStatus != nil {
+			lb, status = &lbs[i], lbStatus
+			break
+		}
+	}
+	if lb == nil {
+		return []loadBalancerDrift{{
+			kind:    LoadBalancerDriftNotFound,
+			message: fmt.Sprintf("no load balancer has a frontend IP configuration of the service (internal: %t)", isInternal),
+		}}, nil
+	}
+	lbName := pointer.StringDeref(lb.Name, "")
+
+	var drifts []loadBalancerDrift
+	frontendIPs := sets.New[string]()
+	for _, ingress := range status.Ingress {
+		frontendIPs.Insert(ingress.IP)
+	}
+	serviceIPs := sets.New[string]()
+	for _, ip := range getServiceLoadBalancerIPs(service) {
+		if ip != "" {
+			serviceIPs.Insert(ip)
+		}
+	}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			serviceIPs.Insert(ingress.IP)
+		}
+	}
+	if missingIPs := serviceIPs.Difference(frontendIPs); missingIPs.Len() > 0 {
+		drifts = append(drifts, loadBalancerDrift{
+			kind:    LoadBalancerDriftIngressIPs,
+			message: fmt.Sprintf("IPs %v of the service are not on the frontend of load balancer %s, which has IPs %v", sets.List(missingIPs), lbName, sets.List(frontendIPs)),
+		})
+	}
+
+	existingRuleNames := sets.New[string]()
+	if lb.LoadBalancerPropertiesFormat != nil && lb.LoadBalancingRules != nil {
+		for _, rule := range *lb.LoadBalancingRules {
+			existingRuleNames.Insert(strings.ToLower(pointer.StringDeref(rule.Name, "")))
+		}
+	}
+	v4Enabled, v6Enabled := getIPFamiliesEnabled(service)
+	var isIPv6s []bool
+	if v4Enabled || !v6Enabled {
+		isIPv6s = append(isIPv6s, false)
+	}
+	if v6Enabled {
+		isIPv6s = append(isIPv6s, true)
+	}
+	var missingRuleNames []string
+	for _, isIPv6 := range isIPv6s {
+		_, expectedRules, err := az.getExpectedLBRules(service, "", "", lbName, isIPv6)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range expectedRules {
+			if ruleName := pointer.StringDeref(rule.Name, ""); !existingRuleNames.Has(strings.ToLower(ruleName)) {
+				missingRuleNames = append(missingRuleNames, ruleName)
+			}
+		}
+	}
+	if len(missingRuleNames) > 0 {
+		drifts = append(drifts, loadBalancerDrift{
+			kind:    LoadBalancerDriftLoadBalancingRules,
+			message: fmt.Sprintf("load balancing rules %v of the service are missing on load balancer %s", missingRuleNames, lbName),
+		})
+	}
+
+	if sg != nil && len(service.Spec.Ports) > 0 {
+		ownsRule := false
+		if sg.SecurityGroupPropertiesFormat != nil && sg.SecurityRules != nil {
+			for _, rule := range *sg.SecurityRules {
+				if az.serviceOwnsRule(service, pointer.StringDeref(rule.Name, "")) {
+					ownsRule = true
+					break
+				}
+			}
+		}
+		if !ownsRule {
+			drifts = append(drifts, loadBalancerDrift{
+				kind:    LoadBalancerDriftSecurityRules,
+				message: fmt.Sprintf("security group %s has no rules for the service", pointer.StringDeref(sg.Name, az.SecurityGroupName)),
+			})
+		}
+	}
+
+	return drifts, nil
+}
+
+// emitLoadBalancerDriftEvents emits a warning event for each drift of the service, or a normal event if the
+// drifts of the service are resolved.
+func (az *Cloud) emitLoadBalancerDriftEvents(service *v1.Service, last, drifts []loadBalancerDrift) {
+	for _, drift := range drifts {
+		az.Event(service, v1.EventTypeWarning, "LoadBalancerDrift", fmt.Sprintf("%s: %s", drift.kind, drift.message))
+	}
+	if len(drifts) == 0 && len(last) > 0 {
+		az.Event(service, v1.EventTypeNormal, "LoadBalancerDriftResolved", "The load balancer matches the service")
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func getTestDriftLoadBalancer(az *Cloud, service *v1.Service, withRules bool) network.LoadBalancer {
+	lb := network.LoadBalancer{
+		Name: pointer.String("testCluster-internal"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{
+					Name: pointer.String(az.getDefaultFrontendIPConfigName(service)),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddress: pointer.String("10.0.0.6"),
+					},
+				},
+			},
+			LoadBalancingRules: &[]network.LoadBalancingRule{},
+		},
+	}
+	if withRules {
+		lb.LoadBalancingRules = &[]network.LoadBalancingRule{
+			{Name: pointer.String(az.getLoadBalancerRuleName(service, v1.ProtocolTCP, 80, false))},
+		}
+	}
+	return lb
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.ReadOnlyMode = true
+	svc := getInternalTestService("svc1", 80)
+
+	_, supported := az.Routes()
+	assert.False(t, supported)
+
+	// no Azure API is called when updating or deleting the load balancer
+	assert.NoError(t, az.UpdateLoadBalancer(context.TODO(), testClusterName, &svc, nil))
+	assert.NoError(t, az.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, &svc))
+
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.PublicIPAddress{}, nil).AnyTimes()
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.LoadBalancer{getTestDriftLoadBalancer(az, &svc, true)}, nil).Times(1)
+	status, err := az.EnsureLoadBalancer(context.TODO(), testClusterName, &svc, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.6"}}}, status)
+
+	az.lbCache.Delete(az.ResourceGroup)
+	mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.LoadBalancer{}, nil).AnyTimes()
+	_, err = az.EnsureLoadBalancer(context.TODO(), testClusterName, &svc, nil)
+	assert.Error(t, err)
+}
+
+func TestVerifyLoadBalancerDrift(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+
+	svc := getInternalTestService("svc1", 80)
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "10.0.0.6"}}
+	client := fake.NewSimpleClientset(&svc)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	az.serviceLister = informerFactory.Core().V1().Services().Lister()
+	_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+
+	sg := network.SecurityGroup{
+		Name: pointer.String("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				{Name: pointer.String(az.getRulePrefix(&svc) + "-TCP-80-Internet")},
+			},
+		},
+	}
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), gomock.Any(), "nsg", gomock.Any()).Return(sg, nil).AnyTimes()
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+
+	reporter := &loadBalancerDriftReporter{}
+	for _, tc := range []struct {
+		desc           string
+		lbs            []network.LoadBalancer
+		expectedDrifts []string
+		expectedEvent  string
+	}{
+		{
+			desc: "no drift should be reported if the load balancer matches the service",
+			lbs:  []network.LoadBalancer{getTestDriftLoadBalancer(az, &svc, true)},
+		},
+		{
+			desc:           "missing load balancing rules should be reported",
+			lbs:            []network.LoadBalancer{getTestDriftLoadBalancer(az, &svc, false)},
+			expectedDrifts: []string{LoadBalancerDriftLoadBalancingRules},
+			expectedEvent:  "Warning LoadBalancerDrift LoadBalancingRulesMissing: load balancing rules [" + az.getLoadBalancerRuleName(&svc, v1.ProtocolTCP, 80, false) + "] of the service are missing on load balancer testCluster-internal",
+		},
+		{
+			desc:           "unchanged drifts should not be reported again",
+			lbs:            []network.LoadBalancer{getTestDriftLoadBalancer(az, &svc, false)},
+			expectedDrifts: []string{LoadBalancerDriftLoadBalancingRules},
+		},
+		{
+			desc:           "missing load balancer should be reported",
+			lbs:            []network.LoadBalancer{},
+			expectedDrifts: []string{LoadBalancerDriftNotFound},
+			expectedEvent:  "Warning LoadBalancerDrift LoadBalancerNotFound: no load balancer has a frontend IP configuration of the service (internal: true)",
+		},
+		{
+			desc:          "resolved drifts should be reported",
+			lbs:           []network.LoadBalancer{getTestDriftLoadBalancer(az, &svc, true)},
+			expectedEvent: "Normal LoadBalancerDriftResolved The load balancer matches the service",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az.lbCache.Delete(az.ResourceGroup)
+			mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(tc.lbs, nil).Times(1)
+
+			assert.NoError(t, az.verifyLoadBalancerDrift(context.TODO(), reporter))
+			var drifts []string
+			for _, drift := range reporter.services["default/svc1"] {
+				drifts = append(drifts, drift.kind)
+			}
+			assert.Equal(t, tc.expectedDrifts, drifts)
+
+			select {
+			case event := <-recorder.Events:
+				assert.Equal(t, tc.expectedEvent, event)
+			default:
+				assert.Empty(t, tc.expectedEvent)
+			}
+		})
+	}
+}
+
+func TestVerifyLoadBalancerDriftWithNamespaceDefaults(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	az.NamespaceDefaultServiceAnnotations = map[string]map[string]string{
+		"default": {consts.ServiceAnnotationLoadBalancerInternal: "true"},
+	}
+
+	// the service is internal only by the default annotations of its namespace
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "10.0.0.6"}}
+	client := fake.NewSimpleClientset(&svc)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	az.serviceLister = informerFactory.Core().V1().Services().Lister()
+	_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+
+	internalSvc := getInternalTestService("svc1", 80)
+	sg := network.SecurityGroup{
+		Name: pointer.String("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				{Name: pointer.String(az.getRulePrefix(&internalSvc) + "-TCP-80-Internet")},
+			},
+		},
+	}
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), gomock.Any(), "nsg", gomock.Any()).Return(sg, nil).AnyTimes()
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.LoadBalancer{getTestDriftLoadBalancer(az, &internalSvc, true)}, nil).Times(1)
+
+	reporter := &loadBalancerDriftReporter{}
+	assert.NoError(t, az.verifyLoadBalancerDrift(context.TODO(), reporter))
+	assert.Empty(t, reporter.services["default/svc1"])
+	assert.Empty(t, recorder.Events)
+}
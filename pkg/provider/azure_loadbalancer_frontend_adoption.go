@@ -0,0 +1,251 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// adoptFrontendIPConfigs adopts the orphaned frontend IP configurations of the service if EnableFrontendIPConfigAdoption
+// is set. The names of the frontend IP configurations are bound to the UID of the service, so they are orphaned when
+// the service is recreated with a new UID, e.g., after restoring the cluster. A frontend IP configuration is adopted if:
+// 1. it is not named after any existing service;
+// 2. its private IP is in the status of the internal service, or its public IP is the one of the external service;
+// 3. it is only referenced by the orphaned load balancing rules.
+// The adopted frontend IP configurations are renamed after the service, and the orphaned load balancing rules
+// referencing them are removed, so that the rules of the service are created instead of duplicate frontends.
+func (az *Cloud) adoptFrontendIPConfigs(
+	clusterName string,
+	service *v1.Service,
+	lb *network.LoadBalancer,
+	configs []network.FrontendIPConfiguration,
+	lbFrontendIPConfigNames map[bool]string,
+) (bool, error) {
+	if !az.EnableFrontendIPConfigAdoption || az.serviceLister == nil {
+		return false, nil
+	}
+	serviceName := getServiceName(service)
+	v4Enabled, v6Enabled := getIPFamiliesEnabled(service)
+	requiredFamilies := map[bool]bool{false: v4Enabled, true: v6Enabled}
+	for _, config := range configs {
+		if isOwned, _, _ := az.serviceOwnsFrontendIP(config, service); isOwned {
+			// The service has been reconciled with its current UID, nothing is to be adopted.
+			return false, nil
+		}
+	}
+
+	existingServices, err := az.serviceLister.List(labels.Everything())
+	if err != nil {
+		return false, fmt.Errorf("adoptFrontendIPConfigs: failed to list services: %w", err)
+	}
+	var adopted bool
+	for i := range configs {
+		config := &configs[i]
+		if az.isFrontendIPConfigOwnedByServices(config, existingServices) {
+			continue
+		}
+		isIPv6, matched, err := az.frontendIPConfigMatchesService(clusterName, service, config)
+		if err != nil {
+			return adopted, err
+		}
+		if !matched || !requiredFamilies[isIPv6] {
+			continue
+		}
+		orphanedRules, ok := az.getOrphanedRulesOfFrontendIPConfig(lb, config, existingServices)
+		if !ok {
+			klog.V(2).Infof("adoptFrontendIPConfigs for service (%s): the frontend IP configuration %s is referenced by other resources, skip adopting it", serviceName, pointer.StringDeref(config.Name, ""))
+			continue
+		}
+
+		newName := lbFrontendIPConfigNames[isIPv6]
+		klog.V(2).Infof("adoptFrontendIPConfigs for service (%s): adopting the frontend IP configuration %s as %s and removing the orphaned rules %v",
+			serviceName, pointer.StringDeref(config.Name, ""), newName, orphanedRules)
+		removeLoadBalancingRules(lb, orphanedRules)
+		config.Name = pointer.String(newName)
+		config.ID = pointer.String(fmt.Sprintf(consts.FrontendIPConfigIDTemplate, az.getNetworkResourceSubscriptionID(), az.ResourceGroup, pointer.StringDeref(lb.Name, ""), newName))
+		if config.FrontendIPConfigurationPropertiesFormat != nil {
+			config.LoadBalancingRules = nil
+		}
+		requiredFamilies[isIPv6] = false
+		adopted = true
+	}
+	return adopted, nil
+}
+
+// isFrontendIPConfigOwnedByServices returns true if the frontend IP configuration is named after any of the services.
+func (az *Cloud) isFrontendIPConfigOwnedByServices(config *network.FrontendIPConfiguration, services []*v1.Service) bool {
+	for _, service := range services {
+		if isNameOwnedByPrefix(pointer.StringDeref(config.Name, ""), az.GetLoadBalancerName(context.TODO(), "", service)) {
+			return true
+		}
+	}
+	return false
+}
+
+// frontendIPConfigMatchesService returns true and the IP family if the IP of the frontend IP configuration belongs to
+// the service. The private IP must be in the status of the internal service, and the public IP must be the one
+// determined for the external service.
+func (az *Cloud) frontendIPConfigMatchesService(clusterName string, service *v1.Service, config *network.FrontendIPConfiguration) (bool, bool, error) {
+	if config.FrontendIPConfigurationPropertiesFormat == nil {
+		return false, false, nil
+	}
+	if requiresInternalLoadBalancer(service) {
+		privateIP := net.ParseIP(pointer.StringDeref(config.PrivateIPAddress, ""))
+		if privateIP == nil {
+			return false, false, nil
+		}
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if privateIP.Equal(net.ParseIP(ingress.IP)) {
+				return privateIP.To4() == nil, true, nil
+			}
+		}
+		return false, false, nil
+	}
+
+	if config.PublicIPAddress == nil || config.PublicIPAddress.ID == nil {
+		return false, false, nil
+	}
+	pipRG := az.getPublicIPAddressResourceGroup(service)
+	for _, isIPv6 := range []bool{false, true} {
+		pipName, _, err := az.determinePublicIPName(clusterName, service, isIPv6)
+		if err != nil {
+			return false, false, err
+		}
+		pip, found, err := az.getPublicIPAddress(pipRG, pipName, azcache.CacheReadTypeDefault)
+		if err != nil {
+			return false, false, err
+		}
+		if found && strings.EqualFold(pointer.StringDeref(pip.ID, ""), *config.PublicIPAddress.ID) {
+			return isIPv6, true, nil
+		}
+	}
+	return false, false, nil
+}
+
+// getOrphanedRulesOfFrontendIPConfig returns the names of the load balancing rules referencing the frontend IP
+// configuration. It returns false if any of them is owned by the existing services, or the frontend IP configuration
+// is referenced by outbound rules, inbound NAT rules or inbound NAT pools.
+func (az *Cloud) getOrphanedRulesOfFrontendIPConfig(lb *network.LoadBalancer, config *network.FrontendIPConfiguration, services []*v1.Service) ([]string, bool) {
+	if config.FrontendIPConfigurationPropertiesFormat != nil &&
+		((config.OutboundRules != nil && len(*config.OutboundRules) > 0) ||
+			(config.InboundNatRules != nil && len(*config.InboundNatRules) > 0) ||
+			(config.InboundNatPools != nil && len(*config.InboundNatPools) > 0)) {
+		return nil, false
+	}
+	if lb.LoadBalancerPropertiesFormat == nil || lb.LoadBalancingRules == nil {
+		return nil, true
+	}
+	var orphanedRules []string
+	for _, rule := range *lb.LoadBalancingRules {
+		if rule.LoadBalancingRulePropertiesFormat == nil || rule.FrontendIPConfiguration == nil ||
+			!strings.EqualFold(pointer.StringDeref(rule.FrontendIPConfiguration.ID, ""), pointer.StringDeref(config.ID, "")) {
+			continue
+		}
+		for _, service := range services {
+			if az.serviceOwnsRule(service, pointer.StringDeref(rule.Name, "")) {
+				return nil, false
+			}
+		}
+		orphanedRules = append(orphanedRules, pointer.StringDeref(rule.Name, ""))
+	}
+	return orphanedRules, true
+}
+
+// removeLoadBalancingRules removes the load balancing rules with the given names from the load balancer.
+func removeLoadBalancingRules(lb *network.LoadBalancer, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	var rules []network.LoadBalancingRule
+	for _, rule := range *lb.LoadBalancingRules {
+		removed := false
+		for _, name := range names {
+			if strings.EqualFold(pointer.StringDeref(rule.Name, ""), name) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			rules = append(rules, rule)
+		}
+	}
+	lb.LoadBalancingRules = &rules
+}
+
+// findAdoptablePublicIPName returns the name of the public IP created for the service before it was recreated with a
+// new UID, if EnableFrontendIPConfigAdoption is set and the public IP named after the current UID does not exist.
+// The public IP must be tagged with the service or with no service, and its IP must be in the status of the service
+// if the status is set. It is re-tagged with the service when it is ensured.
+func (az *Cloud) findAdoptablePublicIPName(clusterName string, service *v1.Service, defaultPIPName string, isIPv6 bool) (string, error) {
+	if !az.EnableFrontendIPConfigAdoption {
+		return "", nil
+	}
+	pipRG := az.getPublicIPAddressResourceGroup(service)
+	pips, err := az.listPIP(pipRG, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return "", err
+	}
+	statusIPs := make(map[string]bool)
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			statusIPs[ingress.IP] = true
+		}
+	}
+
+	serviceName := getServiceName(service)
+	var candidate string
+	for _, pip := range pips {
+		if strings.EqualFold(pointer.StringDeref(pip.Name, ""), defaultPIPName) {
+			return "", nil
+		}
+		if pip.PublicIPAddressPropertiesFormat == nil || pip.IPAddress == nil || (pip.PublicIPAddressVersion == network.IPv6) != isIPv6 {
+			continue
+		}
+		if cluster := getClusterFromPIPClusterTags(pip.Tags); cluster != "" && !strings.EqualFold(cluster, clusterName) {
+			continue
+		}
+		serviceTag := getServiceFromPIPServiceTags(pip.Tags)
+		taggedWithService := isSVCNameInPIPTag(serviceTag, serviceName)
+		if len(statusIPs) > 0 {
+			// The IP in the status takes precedence, the public IP of a foreign name without service tags can be adopted.
+			if statusIPs[*pip.IPAddress] && (taggedWithService || serviceTag == "") {
+				candidate = pointer.StringDeref(pip.Name, "")
+			}
+			continue
+		}
+		// Without the status, only the public IP tagged with the service alone is adopted.
+		if taggedWithService && len(parsePIPServiceTag(&serviceTag)) == 1 && candidate == "" {
+			candidate = pointer.StringDeref(pip.Name, "")
+		}
+	}
+	if candidate != "" {
+		klog.V(2).Infof("findAdoptablePublicIPName for service (%s): adopting the public IP %s instead of creating %s", serviceName, candidate, defaultPIPName)
+	}
+	return candidate, nil
+}
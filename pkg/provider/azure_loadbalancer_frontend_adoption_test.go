@@ -0,0 +1,196 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestAdoptFrontendIPConfigs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newFrontendIPConfig := func(name, ip string) network.FrontendIPConfiguration {
+		return network.FrontendIPConfiguration{
+			Name: pointer.String(name),
+			ID:   pointer.String(fmt.Sprintf(consts.FrontendIPConfigIDTemplate, "subscription", "rg", "lb", name)),
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+				PrivateIPAddress: pointer.String(ip),
+			},
+		}
+	}
+	newRule := func(name, frontendName string) network.LoadBalancingRule {
+		return network.LoadBalancingRule{
+			Name: pointer.String(name),
+			LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+				FrontendIPConfiguration: &network.SubResource{
+					ID: pointer.String(fmt.Sprintf(consts.FrontendIPConfigIDTemplate, "subscription", "rg", "lb", frontendName)),
+				},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		desc              string
+		disabled          bool
+		configs           []network.FrontendIPConfiguration
+		rules             []network.LoadBalancingRule
+		expectedAdopted   bool
+		expectedFIPNames  []string
+		expectedRuleNames []string
+	}{
+		{
+			desc:              "the orphaned frontend IP configuration with the IP of the service should be adopted",
+			configs:           []network.FrontendIPConfiguration{newFrontendIPConfig("aold", "10.0.0.5"), newFrontendIPConfig("aother", "10.0.0.6")},
+			rules:             []network.LoadBalancingRule{newRule("aold-TCP-80", "aold"), newRule("aother-TCP-80", "aother")},
+			expectedAdopted:   true,
+			expectedFIPNames:  []string{"atest1", "aother"},
+			expectedRuleNames: []string{"aother-TCP-80"},
+		},
+		{
+			desc:              "the frontend IP configuration of an existing service should not be adopted",
+			configs:           []network.FrontendIPConfiguration{newFrontendIPConfig("aexisting", "10.0.0.5")},
+			rules:             []network.LoadBalancingRule{newRule("aexisting-TCP-80", "aexisting")},
+			expectedFIPNames:  []string{"aexisting"},
+			expectedRuleNames: []string{"aexisting-TCP-80"},
+		},
+		{
+			desc:              "the frontend IP configuration referenced by the rules of an existing service should not be adopted",
+			configs:           []network.FrontendIPConfiguration{newFrontendIPConfig("aold", "10.0.0.5")},
+			rules:             []network.LoadBalancingRule{newRule("aexisting-TCP-443", "aold")},
+			expectedFIPNames:  []string{"aold"},
+			expectedRuleNames: []string{"aexisting-TCP-443"},
+		},
+		{
+			desc:              "the frontend IP configuration should not be adopted if the adoption is disabled",
+			disabled:          true,
+			configs:           []network.FrontendIPConfiguration{newFrontendIPConfig("aold", "10.0.0.5")},
+			rules:             []network.LoadBalancingRule{newRule("aold-TCP-80", "aold")},
+			expectedFIPNames:  []string{"aold"},
+			expectedRuleNames: []string{"aold-TCP-80"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.EnableFrontendIPConfigAdoption = !tc.disabled
+
+			svc := getInternalTestService("test1", 80)
+			svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "10.0.0.5"}}
+			existingSvc := getInternalTestService("existing", 443)
+			existingSvc.UID = types.UID("existing")
+			client := fake.NewSimpleClientset(&svc, &existingSvc)
+			informerFactory := informers.NewSharedInformerFactory(client, 0)
+			az.serviceLister = informerFactory.Core().V1().Services().Lister()
+			_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+			_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&existingSvc)
+
+			lb := &network.LoadBalancer{
+				Name: pointer.String("lb"),
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					FrontendIPConfigurations: &tc.configs,
+					LoadBalancingRules:       &tc.rules,
+				},
+			}
+			adopted, err := az.adoptFrontendIPConfigs(testClusterName, &svc, lb, tc.configs, az.getFrontendIPConfigNames(&svc))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedAdopted, adopted)
+
+			var fipNames, ruleNames []string
+			for _, config := range tc.configs {
+				fipNames = append(fipNames, pointer.StringDeref(config.Name, ""))
+			}
+			for _, rule := range *lb.LoadBalancingRules {
+				ruleNames = append(ruleNames, pointer.StringDeref(rule.Name, ""))
+			}
+			assert.Equal(t, tc.expectedFIPNames, fipNames)
+			assert.Equal(t, tc.expectedRuleNames, ruleNames)
+		})
+	}
+}
+
+func TestFindAdoptablePublicIPName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newPIP := func(name, ip, serviceTag string) network.PublicIPAddress {
+		return network.PublicIPAddress{
+			Name: pointer.String(name),
+			ID:   pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/" + name),
+			Tags: map[string]*string{consts.ServiceTagKey: pointer.String(serviceTag)},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress:              pointer.String(ip),
+				PublicIPAddressVersion: network.IPv4,
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		desc            string
+		statusIP        string
+		pips            []network.PublicIPAddress
+		expectedPIPName string
+	}{
+		{
+			desc:            "the public IP tagged with the service alone should be adopted without the status",
+			pips:            []network.PublicIPAddress{newPIP("pip-shared", "1.2.3.3", "default/test1,default/test2"), newPIP("pip-old", "1.2.3.4", "default/test1")},
+			expectedPIPName: "pip-old",
+		},
+		{
+			desc:            "the public IP with the IP in the status and no service tag should be adopted",
+			statusIP:        "1.2.3.5",
+			pips:            []network.PublicIPAddress{newPIP("pip-old", "1.2.3.4", "default/test1"), newPIP("pip-foreign", "1.2.3.5", "")},
+			expectedPIPName: "pip-foreign",
+		},
+		{
+			desc:     "the public IP of another service should not be adopted",
+			statusIP: "1.2.3.5",
+			pips:     []network.PublicIPAddress{newPIP("pip-other", "1.2.3.5", "default/other")},
+		},
+		{
+			desc: "no public IP should be adopted if the public IP of the service exists",
+			pips: []network.PublicIPAddress{newPIP("pip-old", "1.2.3.4", "default/test1"), newPIP("testCluster-atest1", "1.2.3.5", "default/test1")},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.EnableFrontendIPConfigAdoption = true
+			mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+			mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return(tc.pips, nil).Times(1)
+
+			svc := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+			if tc.statusIP != "" {
+				svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: tc.statusIP}}
+			}
+			pipName, err := az.findAdoptablePublicIPName(testClusterName, &svc, "testCluster-atest1", false)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPIPName, pipName)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// getFrontendPort returns the frontend port of the load balancing rule of the service port, which is the service
+// port unless it is remapped by the frontend port annotation of the port.
+func getFrontendPort(service *v1.Service, port v1.ServicePort) (int32, error) {
+	key := consts.BuildAnnotationKeyForPort(port.Port, consts.PortAnnotationFrontendPort)
+	frontendPort, err := consts.Getint32ValueFromK8sSvcAnnotation(service.Annotations, key, func(val *int32) error {
+		if *val < 1 || *val > 65535 {
+			return fmt.Errorf("port %d is out of range", *val)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse annotation %s: %w", key, err)
+	}
+	if frontendPort == nil {
+		return port.Port, nil
+	}
+	return *frontendPort, nil
+}
+
+// getServiceFrontendPorts returns the ports of the service with their frontend ports instead of the service ports.
+// It fails if several ports of the same protocol are exposed on the same frontend port, which would be rejected by
+// Azure. The ports without load balancing rules are skipped.
+func getServiceFrontendPorts(service *v1.Service) ([]v1.ServicePort, error) {
+	ports := make([]v1.ServicePort, 0, len(service.Spec.Ports))
+	servicePortsByFrontendPort := make(map[string]int32)
+	for _, port := range service.Spec.Ports {
+		if isNoLBRuleRequired, _ := consts.IsLBRuleOnK8sServicePortDisabled(service.Annotations, port.Port); isNoLBRuleRequired {
+			continue
+		}
+		frontendPort, err := getFrontendPort(service, port)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%s/%d", port.Protocol, frontendPort)
+		if servicePort, found := servicePortsByFrontendPort[key]; found && servicePort != port.Port {
+			return nil, fmt.Errorf("the %s service ports %d and %d of service %s are both exposed on the frontend port %d",
+				port.Protocol, servicePort, port.Port, getServiceName(service), frontendPort)
+		}
+		servicePortsByFrontendPort[key] = port.Port
+
+		port.Port = frontendPort
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestGetServiceFrontendPorts(t *testing.T) {
+	for _, tc := range []struct {
+		desc          string
+		annotations   map[string]string
+		expectedPorts []int32
+		expectedErr   bool
+	}{
+		{
+			desc:          "the service ports are the frontend ports by default",
+			expectedPorts: []int32{80, 443},
+		},
+		{
+			desc:          "the frontend port of a port is remapped by the annotation",
+			annotations:   map[string]string{consts.BuildAnnotationKeyForPort(443, consts.PortAnnotationFrontendPort): "8443"},
+			expectedPorts: []int32{80, 8443},
+		},
+		{
+			desc: "the ports without rules are skipped",
+			annotations: map[string]string{
+				consts.BuildAnnotationKeyForPort(80, consts.PortAnnotationNoLBRule):      consts.TrueAnnotationValue,
+				consts.BuildAnnotationKeyForPort(443, consts.PortAnnotationFrontendPort): "80",
+			},
+			expectedPorts: []int32{80},
+		},
+		{
+			desc:        "the ports of the same protocol cannot share a frontend port",
+			annotations: map[string]string{consts.BuildAnnotationKeyForPort(443, consts.PortAnnotationFrontendPort): "80"},
+			expectedErr: true,
+		},
+		{
+			desc:        "the frontend port must be valid",
+			annotations: map[string]string{consts.BuildAnnotationKeyForPort(443, consts.PortAnnotationFrontendPort): "65536"},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := getTestService("test", v1.ProtocolTCP, tc.annotations, false, 80, 443)
+			ports, err := getServiceFrontendPorts(&svc)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var frontendPorts []int32
+			for _, port := range ports {
+				frontendPorts = append(frontendPorts, port.Port)
+			}
+			assert.Equal(t, tc.expectedPorts, frontendPorts)
+		})
+	}
+}
+
+func TestGetExpectedLBRulesWithFrontendPort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+
+	annotations := map[string]string{
+		consts.BuildAnnotationKeyForPort(53, consts.PortAnnotationFrontendPort): "5353",
+		consts.ServiceAnnotationLoadBalancerCombineProtocols:                    consts.TrueAnnotationValue,
+	}
+	svc := getTestService("test1", v1.ProtocolTCP, annotations, false, 53)
+	udpPort := svc.Spec.Ports[0]
+	udpPort.Name = "udp-53"
+	udpPort.Protocol = v1.ProtocolUDP
+	svc.Spec.Ports = append(svc.Spec.Ports, udpPort)
+
+	_, rules, err := az.getExpectedLBRules(&svc, "frontendIPConfigID", "backendPoolID", "lbname", false)
+	assert.NoError(t, err)
+	// the TCP and UDP ports with the same number share the frontend port, so they are still combined
+	assert.Len(t, rules, 1)
+	assert.Equal(t, network.TransportProtocolAll, rules[0].Protocol)
+	assert.Equal(t, int32(5353), pointer.Int32Deref(rules[0].FrontendPort, 0))
+	assert.Equal(t, int32(53), pointer.Int32Deref(rules[0].BackendPort, 0))
+}
@@ -18,12 +18,15 @@ package provider
 
 import (
 	"fmt"
+	"net/http"
 	"strconv"
 
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 	v1 "k8s.io/api/core/v1"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
@@ -38,8 +41,32 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 	}
 	// protocol should be tcp, because sctp is handled in outer loop
 
+	managementPort, err := getHealthProbeManagementPort(serviceManifest, port.Port)
+	if err != nil {
+		return nil, err
+	}
+	if managementPort != nil {
+		probeInterval, numberOfProbes, err := az.getHealthProbeConfigProbeIntervalAndNumOfProbe(serviceManifest, port.Port)
+		if err != nil {
+			return nil, err
+		}
+		properties := &network.ProbePropertiesFormat{
+			Protocol:          network.ProbeProtocolTCP,
+			Port:              managementPort,
+			IntervalInSeconds: probeInterval,
+		}
+		az.setProbeNumberOfProbes(properties, numberOfProbes)
+		return &network.Probe{
+			Name:                  &lbrule,
+			ProbePropertiesFormat: properties,
+		}, nil
+	}
+
+	backendPort, err := az.getHealthProbeBackendPort(serviceManifest, port)
+	if err != nil {
+		return nil, err
+	}
 	properties := &network.ProbePropertiesFormat{}
-	var err error
 
 	// order - Specific Override
 	// port_ annotation
@@ -69,7 +96,15 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 		}
 	}
 
-	// 4. Finally, if protocol is still nil, default to HTTP
+	// 4. If protocol is still nil, derive the health probe from the readiness probes of the pods if enabled
+	var detectedProbe *detectedHealthProbe
+	if protocol == nil {
+		if detectedProbe = az.detectHealthProbeOfPort(serviceManifest, port); detectedProbe != nil {
+			protocol = pointer.String(string(detectedProbe.protocol))
+		}
+	}
+
+	// 5. Finally, if protocol is still nil, default to HTTP
 	if protocol == nil {
 		protocol = pointer.String(string(network.ProtocolHTTP))
 	}
@@ -78,13 +113,13 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 	switch {
 	case strings.EqualFold(*protocol, string(network.ProtocolTCP)):
 		properties.Protocol = network.ProbeProtocolTCP
-		properties.Port = &port.NodePort
+		properties.Port = &backendPort
 	case strings.EqualFold(*protocol, string(network.ProtocolHTTPS)):
 		//HTTPS probe is only supported in standard loadbalancer
 		//For backward compatibility,when unsupported protocol is used, fall back to tcp protocol in basic lb mode instead
 		if !az.useStandardLoadBalancer() {
 			properties.Protocol = network.ProbeProtocolTCP
-			properties.Port = &port.NodePort
+			properties.Port = &backendPort
 		} else {
 			properties.Protocol = network.ProbeProtocolHTTPS
 		}
@@ -93,12 +128,19 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 	default:
 		//For backward compatibility,when unsupported protocol is used, fall back to tcp protocol in basic lb mode instead
 		properties.Protocol = network.ProbeProtocolTCP
-		properties.Port = &port.NodePort
+		properties.Port = &backendPort
 	}
 
 	// Lookup or Override Health Probe Port
+	if detectedProbe != nil {
+		properties.Port = pointer.Int32(detectedProbe.port)
+	}
 	if properties.Port == nil {
 		properties.Port = pointer.Int32Ptr(consts.HealthProbeDefaultRequestPort)
+		// kube-proxy is not in the path of the traffic if the pods are the backends, so the pods are probed instead.
+		if az.usePodIPBackendPool() {
+			properties.Port = pointer.Int32(backendPort)
+		}
 	}
 
 	probePort, err := consts.GetHealthProbeConfigOfPortFromK8sSvcAnnotation(serviceManifest.Annotations, port.Port, consts.HealthProbeParamsPort, func(s *string) error {
@@ -134,28 +176,43 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 			for _, item := range serviceManifest.Spec.Ports {
 				if strings.EqualFold(item.Name, *probePort) {
 					//found the port
-					properties.Port = pointer.Int32(item.NodePort)
+					itemBackendPort, err := az.getHealthProbeBackendPort(serviceManifest, item)
+					if err != nil {
+						return nil, err
+					}
+					properties.Port = pointer.Int32(itemBackendPort)
 				}
 			}
 		} else {
 			// Not need to verify probePort is in correct range again.
-			var found bool
-			for _, item := range serviceManifest.Spec.Ports {
-				//nolint:gosec
-				if item.Port == int32(port) {
-					//found the port
-					properties.Port = pointer.Int32(item.NodePort)
-					found = true
-					break
+			//nolint:gosec
+			item, conflict := findHealthProbeServicePortByNumber(serviceManifest, int32(port))
+			if item != nil {
+				//found the port
+				itemBackendPort, err := az.getHealthProbeBackendPort(serviceManifest, *item)
+				if err != nil {
+					return nil, err
 				}
-			}
-			if !found {
+				if conflict {
+					warningMsg := fmt.Sprintf("health probe port %d of rule %s matches more than one service port, probing %s port %d", port, lbrule, item.Protocol, itemBackendPort)
+					klog.Warning(warningMsg)
+					az.Event(serviceManifest, v1.EventTypeWarning, "ConflictingHealthProbeConfig", warningMsg)
+				}
+				properties.Port = pointer.Int32(itemBackendPort)
+			} else {
 				//nolint:gosec
 				properties.Port = pointer.Int32(int32(port))
 			}
 		}
 	}
 
+	// The backends expect the proxy protocol header, which is not sent by the HTTP and HTTPS probes.
+	if isPLSProxyProtocolEnabled(serviceManifest) && properties.Protocol != network.ProbeProtocolTCP && pointer.Int32Deref(properties.Port, 0) == backendPort {
+		klog.V(2).Infof("buildHealthProbeRulesForPort: using TCP probe for port %d of service %s because the proxy protocol of the private link service is enabled",
+			port.Port, getServiceName(serviceManifest))
+		properties.Protocol = network.ProbeProtocolTCP
+	}
+
 	// Select request path
 	if strings.EqualFold(string(properties.Protocol), string(network.ProtocolHTTPS)) || strings.EqualFold(string(properties.Protocol), string(network.ProtocolHTTP)) {
 		// get request path ,only used with http/https probe
@@ -168,10 +225,17 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 				return nil, fmt.Errorf("failed to parse annotation %s: %w", consts.ServiceAnnotationLoadBalancerHealthProbeRequestPath, err)
 			}
 		}
+		if path == nil && detectedProbe != nil {
+			path = detectedProbe.requestPath
+		}
 		if path == nil {
 			path = pointer.String(consts.HealthProbeDefaultRequestPath)
 		}
 		properties.RequestPath = path
+
+		if err := az.checkHealthProbeRequestOptions(serviceManifest, port.Port); err != nil {
+			return nil, err
+		}
 	}
 	// get number of probes
 	var numOfProbeValidator = func(val *int32) error {
@@ -229,7 +293,7 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 		return nil, fmt.Errorf("total probe should be less than 120, please adjust interval and number of probe accordingly")
 	}
 	properties.IntervalInSeconds = probeInterval
-	properties.ProbeThreshold = numberOfProbes
+	az.setProbeNumberOfProbes(properties, numberOfProbes)
 	probe := &network.Probe{
 		Name:                  &lbrule,
 		ProbePropertiesFormat: properties,
@@ -237,6 +301,193 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 	return probe, nil
 }
 
+// getHealthProbeBackendPort returns the port of the backends serving the service port, which is
+// the target port of the pods if the pod IPs are in the backend pools, or the node port otherwise.
+func (az *Cloud) getHealthProbeBackendPort(service *v1.Service, port v1.ServicePort) (int32, error) {
+	if az.usePodIPBackendPool() {
+		return az.getPodBackendPort(service, port)
+	}
+	return port.NodePort, nil
+}
+
+// buildHealthProbeForTarget builds the health probe shared by all load balancing rules
+// of the service from the health probe target annotation. It returns nil if the annotation
+// is not set or the service uses externalTrafficPolicy=Local, in which case the probes
+// always target the health check node port of the service.
+func (az *Cloud) buildHealthProbeForTarget(service *v1.Service, isIPv6 bool) (*network.Probe, error) {
+	if servicehelpers.NeedsHealthCheck(service) {
+		return nil, nil
+	}
+	target, err := consts.GetAttributeValueInSvcAnnotation(service.Annotations, consts.ServiceAnnotationLoadBalancerHealthProbeTarget)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s: %w", consts.ServiceAnnotationLoadBalancerHealthProbeTarget, err)
+	}
+	if target == nil {
+		return nil, nil
+	}
+
+	properties := &network.ProbePropertiesFormat{}
+	if strings.EqualFold(*target, consts.HealthProbeTargetKubeProxy) {
+		properties.Protocol = network.ProbeProtocolHTTP
+		properties.Port = pointer.Int32(consts.HealthProbeDefaultRequestPort)
+		properties.RequestPath = pointer.String(consts.HealthProbeDefaultRequestPath)
+	} else {
+		portStr, path, hasPath := strings.Cut(*target, "/")
+		port, err := strconv.ParseInt(portStr, 10, 32)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid health probe target %q in annotation %s: the port must be an integer between 1 and 65535",
+				*target, consts.ServiceAnnotationLoadBalancerHealthProbeTarget)
+		}
+		properties.Port = pointer.Int32(int32(port))
+		properties.Protocol = network.ProbeProtocolTCP
+		if hasPath {
+			properties.Protocol = network.ProbeProtocolHTTP
+			properties.RequestPath = pointer.String("/" + path)
+		}
+	}
+
+	probeInterval, numberOfProbes, err := az.getHealthProbeConfigProbeIntervalAndNumOfProbe(service, *properties.Port)
+	if err != nil {
+		return nil, err
+	}
+	properties.IntervalInSeconds = probeInterval
+	az.setProbeNumberOfProbes(properties, numberOfProbes)
+
+	probeName := az.getLoadBalancerRuleName(service, v1.ProtocolTCP, *properties.Port, isIPv6)
+	return &network.Probe{
+		Name:                  &probeName,
+		ProbePropertiesFormat: properties,
+	}, nil
+}
+
+// getHealthProbeManagementPort returns the management port replacing the health probe of the port, and validates
+// that the health probe of the port is neither disabled nor customized by the health probe port annotation.
+func getHealthProbeManagementPort(service *v1.Service, port int32) (*int32, error) {
+	key := consts.BuildAnnotationKeyForPort(port, consts.PortAnnotationHealthProbeManagementPort)
+	managementPort, err := consts.Getint32ValueFromK8sSvcAnnotation(service.Annotations, key, func(val *int32) error {
+		if *val < 1 || *val > 65535 {
+			return fmt.Errorf("port %d is out of range", *val)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s: %w", key, err)
+	}
+	if managementPort == nil {
+		return nil, nil
+	}
+	if isNoHealthProbeRule, _ := consts.IsHealthProbeRuleOnK8sServicePortDisabled(service.Annotations, port); isNoHealthProbeRule {
+		return nil, fmt.Errorf("annotation %s conflicts with %s", key, consts.BuildAnnotationKeyForPort(port, consts.PortAnnotationNoHealthProbeRule))
+	}
+	if _, found := service.Annotations[consts.BuildHealthProbeAnnotationKeyForPort(port, consts.HealthProbeParamsPort)]; found {
+		return nil, fmt.Errorf("annotation %s conflicts with %s", key, consts.BuildHealthProbeAnnotationKeyForPort(port, consts.HealthProbeParamsPort))
+	}
+	return managementPort, nil
+}
+
+// checkHealthProbeRequestOptions validates the request headers and the expected status codes of the HTTP(S) health
+// probe of the port. The port-specific annotations take precedence over the global ones. The network API version in
+// use does not support them yet, so valid ones are reported to be ignored instead of failing the reconciliation.
+func (az *Cloud) checkHealthProbeRequestOptions(service *v1.Service, port int32) error {
+	headers, err := getHealthProbeConfigOfPortOrService(service.Annotations, port, consts.HealthProbeParamsRequestHeaders, consts.ServiceAnnotationLoadBalancerHealthProbeRequestHeaders)
+	if err != nil {
+		return err
+	}
+	if headers != nil {
+		if _, err := parseHealthProbeRequestHeaders(*headers); err != nil {
+			return fmt.Errorf("invalid health probe request headers %q of port %d: %w", *headers, port, err)
+		}
+	}
+	statusCodes, err := getHealthProbeConfigOfPortOrService(service.Annotations, port, consts.HealthProbeParamsExpectedStatusCodes, consts.ServiceAnnotationLoadBalancerHealthProbeExpectedStatusCodes)
+	if err != nil {
+		return err
+	}
+	if statusCodes != nil {
+		if _, err := parseHealthProbeExpectedStatusCodes(*statusCodes); err != nil {
+			return fmt.Errorf("invalid health probe expected status codes %q of port %d: %w", *statusCodes, port, err)
+		}
+	}
+
+	if headers != nil || statusCodes != nil {
+		warningMsg := fmt.Sprintf("the request headers and expected status codes of the health probe of port %d are ignored because they are not supported by the network API version in use", port)
+		klog.V(2).Info(warningMsg)
+		az.Event(service, v1.EventTypeWarning, "UnsupportedHealthProbeConfig", warningMsg)
+	}
+	return nil
+}
+
+// getHealthProbeConfigOfPortOrService returns the value of the port-specific health probe annotation, or the value of
+// the service annotation if the former is not set.
+func getHealthProbeConfigOfPortOrService(annotations map[string]string, port int32, key consts.HealthProbeParams, serviceAnnotation string) (*string, error) {
+	value, err := consts.GetHealthProbeConfigOfPortFromK8sSvcAnnotation(annotations, port, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s: %w", consts.BuildHealthProbeAnnotationKeyForPort(port, key), err)
+	}
+	if value != nil {
+		return value, nil
+	}
+	if value, err = consts.GetAttributeValueInSvcAnnotation(annotations, serviceAnnotation); err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s: %w", serviceAnnotation, err)
+	}
+	return value, nil
+}
+
+// parseHealthProbeRequestHeaders parses the health probe request headers in the format of `name1:value1,name2:value2`.
+// The header names must be valid HTTP tokens, and the values must not contain control characters.
+func parseHealthProbeRequestHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		name, headerValue, found := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("header %q is not in the format of name:value", item)
+		}
+		for _, c := range name {
+			if !isHTTPTokenChar(c) {
+				return nil, fmt.Errorf("header name %q contains invalid character %q", name, c)
+			}
+		}
+		headerValue = strings.TrimSpace(headerValue)
+		for _, c := range headerValue {
+			if c < ' ' || c == 0x7f {
+				return nil, fmt.Errorf("value of header %q contains control characters", name)
+			}
+		}
+		headers[http.CanonicalHeaderKey(name)] = headerValue
+	}
+	return headers, nil
+}
+
+// isHTTPTokenChar returns true if the character is allowed in an HTTP token, ref: RFC 7230 section 3.2.6.
+func isHTTPTokenChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
+
+// parseHealthProbeExpectedStatusCodes parses the health probe expected status codes in the format of comma-separated
+// codes or ranges, e.g., `200-299,301`, into the inclusive ranges of status codes between 100 and 599.
+func parseHealthProbeExpectedStatusCodes(value string) ([][2]int, error) {
+	var ranges [][2]int
+	for _, item := range strings.Split(value, ",") {
+		startStr, endStr, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		if !isRange {
+			endStr = startStr
+		}
+		start, err := strconv.Atoi(strings.TrimSpace(startStr))
+		if err != nil {
+			return nil, fmt.Errorf("status code %q is not an integer", startStr)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(endStr))
+		if err != nil {
+			return nil, fmt.Errorf("status code %q is not an integer", endStr)
+		}
+		if start < 100 || end > 599 || start > end {
+			return nil, fmt.Errorf("status code range %q must be between 100 and 599 in ascending order", item)
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges, nil
+}
+
 // getHealthProbeConfigProbeIntervalAndNumOfProbe
 func (az *Cloud) getHealthProbeConfigProbeIntervalAndNumOfProbe(serviceManifest *v1.Service, port int32) (*int32, *int32, error) {
 
@@ -314,6 +565,55 @@ func (*Cloud) getHealthProbeConfigNumOfProbe(serviceManifest *v1.Service, port i
 	return numberOfProbes, nil
 }
 
+// findHealthProbeServicePortByNumber returns the service port referenced by number in the health probe port
+// annotation. A port number can be used by more than one service port with different protocols, e.g. TCP and UDP
+// 53, whose node ports differ. In that case the TCP port is preferred since only it can answer the probes, then the
+// lowest node port, so the result does not depend on the order of the ports in the service spec.
+// The conflicts are only possible within a service. The rules and the probes on a shared load balancer are named
+// after the UID of their service, so the services never share a probe, and a frontend port already used by another
+// service is rejected by checkLoadBalancerResourcesConflicts before the probes are applied.
+func findHealthProbeServicePortByNumber(service *v1.Service, port int32) (match *v1.ServicePort, conflict bool) {
+	for i := range service.Spec.Ports {
+		item := &service.Spec.Ports[i]
+		if item.Port != port {
+			continue
+		}
+		if match == nil {
+			match = item
+			continue
+		}
+		if item.NodePort != match.NodePort || item.TargetPort != match.TargetPort {
+			conflict = true
+		}
+		isTCP, matchIsTCP := item.Protocol != v1.ProtocolUDP && item.Protocol != v1.ProtocolSCTP, match.Protocol != v1.ProtocolUDP && match.Protocol != v1.ProtocolSCTP
+		if (isTCP && !matchIsTCP) || (isTCP == matchIsTCP && item.NodePort < match.NodePort) {
+			match = item
+		}
+	}
+	return match, conflict
+}
+
+// setProbeNumberOfProbes sets the number of consecutive failed probes before the backend is marked down.
+// ProbeThreshold is used if the target cloud supports it, otherwise the legacy NumberOfProbes is used.
+func (az *Cloud) setProbeNumberOfProbes(properties *network.ProbePropertiesFormat, numberOfProbes *int32) {
+	if az.getCloudCapabilities().probeThreshold {
+		properties.ProbeThreshold = numberOfProbes
+		return
+	}
+	properties.NumberOfProbes = numberOfProbes
+}
+
+// getProbeNumberOfProbes returns the ProbeThreshold of the probe, or the legacy NumberOfProbes if it is not set.
+func getProbeNumberOfProbes(properties *network.ProbePropertiesFormat) int32 {
+	if properties == nil {
+		return 0
+	}
+	if properties.ProbeThreshold != nil {
+		return *properties.ProbeThreshold
+	}
+	return pointer.Int32Deref(properties.NumberOfProbes, 0)
+}
+
 func findProbe(probes []network.Probe, probe network.Probe) bool {
 	for _, existingProbe := range probes {
 		if strings.EqualFold(pointer.StringDeref(existingProbe.Name, ""), pointer.StringDeref(probe.Name, "")) &&
@@ -321,7 +621,7 @@ func findProbe(probes []network.Probe, probe network.Probe) bool {
 			strings.EqualFold(string(existingProbe.Protocol), string(probe.Protocol)) &&
 			strings.EqualFold(pointer.StringDeref(existingProbe.RequestPath, ""), pointer.StringDeref(probe.RequestPath, "")) &&
 			pointer.Int32Deref(existingProbe.IntervalInSeconds, 0) == pointer.Int32Deref(probe.IntervalInSeconds, 0) &&
-			pointer.Int32Deref(existingProbe.ProbeThreshold, 0) == pointer.Int32Deref(probe.ProbeThreshold, 0) {
+			getProbeNumberOfProbes(existingProbe.ProbePropertiesFormat) == getProbeNumberOfProbes(probe.ProbePropertiesFormat) {
 			return true
 		}
 	}
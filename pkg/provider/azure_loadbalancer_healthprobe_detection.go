@@ -0,0 +1,197 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// detectedHealthProbe is the health probe derived from the readiness probes of the pods of a service.
+type detectedHealthProbe struct {
+	protocol network.ProbeProtocol
+	// port is the node port of the service port targeting the port of the readiness probes.
+	port        int32
+	requestPath *string
+}
+
+// detectHealthProbeOfPort derives the health probe of the service port from the readiness probes of the pods selected
+// by the service. It returns nil if the auto-detection is disabled, any health probe annotation of the port is set,
+// or the pods do not agree on a readiness probe reachable by a node port of the service.
+func (az *Cloud) detectHealthProbeOfPort(service *v1.Service, port v1.ServicePort) *detectedHealthProbe {
+	if az.podLister == nil || len(service.Spec.Selector) == 0 || hasHealthProbeAnnotationOfPort(service.Annotations, port.Port) {
+		return nil
+	}
+	pods, err := az.podLister.Pods(service.Namespace).List(labels.SelectorFromSet(service.Spec.Selector))
+	if err != nil {
+		klog.Warningf("detectHealthProbeOfPort: failed to list the pods of service %s/%s: %v", service.Namespace, service.Name, err)
+		return nil
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+
+	var detected *detectedHealthProbe
+	var detectedFrom string
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		probe := getHealthProbeFromReadinessProbe(service, port, pod, az.usePodIPBackendPool())
+		if probe == nil {
+			continue
+		}
+		if detected == nil {
+			detected, detectedFrom = probe, pod.Name
+			continue
+		}
+		if detected.protocol != probe.protocol || detected.port != probe.port ||
+			pointer.StringDeref(detected.requestPath, "") != pointer.StringDeref(probe.requestPath, "") {
+			warningMsg := fmt.Sprintf("the readiness probes of pods %s and %s of port %d are different, the health probe is not derived from them", detectedFrom, pod.Name, port.Port)
+			klog.Warning(warningMsg)
+			az.Event(service, v1.EventTypeWarning, "ConflictingHealthProbeConfig", warningMsg)
+			return nil
+		}
+	}
+	if detected != nil {
+		klog.V(4).Infof("detectHealthProbeOfPort: derived health probe (protocol: %s, port: %d, path: %s) of port %d of service %s/%s from the readiness probes",
+			detected.protocol, detected.port, pointer.StringDeref(detected.requestPath, ""), port.Port, service.Namespace, service.Name)
+	}
+	return detected
+}
+
+// hasHealthProbeAnnotationOfPort returns true if any annotation deciding the protocol, the port or the request path
+// of the health probe of the port is set.
+func hasHealthProbeAnnotationOfPort(annotations map[string]string, port int32) bool {
+	for _, key := range []string{
+		consts.BuildHealthProbeAnnotationKeyForPort(port, consts.HealthProbeParamsProtocol),
+		consts.BuildHealthProbeAnnotationKeyForPort(port, consts.HealthProbeParamsPort),
+		consts.BuildHealthProbeAnnotationKeyForPort(port, consts.HealthProbeParamsRequestPath),
+		consts.ServiceAnnotationLoadBalancerHealthProbeProtocol,
+		consts.ServiceAnnotationLoadBalancerHealthProbeRequestPath,
+	} {
+		if _, found := annotations[key]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// getHealthProbeFromReadinessProbe derives the health probe of the service port from the readiness probe of the
+// container serving the port in the pod. The readiness probe must target a port served by a node port of the service,
+// since the load balancer probes the nodes, unless podBackends is true, in which case the load balancer probes the
+// container port of the pods directly. It returns nil if the port is not served by the pod or the readiness probe
+// is neither an HTTP nor a TCP probe.
+func getHealthProbeFromReadinessProbe(service *v1.Service, port v1.ServicePort, pod *v1.Pod, podBackends bool) *detectedHealthProbe {
+	container, targetPort := findContainerOfServicePort(pod, port)
+	if container == nil || container.ReadinessProbe == nil {
+		return nil
+	}
+
+	probe := &detectedHealthProbe{}
+	var probePort intstr.IntOrString
+	switch {
+	case container.ReadinessProbe.HTTPGet != nil:
+		httpGet := container.ReadinessProbe.HTTPGet
+		probe.protocol = network.ProbeProtocolHTTP
+		if httpGet.Scheme == v1.URISchemeHTTPS {
+			probe.protocol = network.ProbeProtocolHTTPS
+		}
+		probe.requestPath = pointer.String("/")
+		if httpGet.Path != "" {
+			probe.requestPath = pointer.String(httpGet.Path)
+		}
+		probePort = httpGet.Port
+	case container.ReadinessProbe.TCPSocket != nil:
+		probe.protocol = network.ProbeProtocolTCP
+		probePort = container.ReadinessProbe.TCPSocket.Port
+	default:
+		return nil
+	}
+	probeContainerPort, found := resolveContainerPort(container, probePort)
+	if !found {
+		return nil
+	}
+
+	if podBackends {
+		probe.port = probeContainerPort
+		return probe
+	}
+
+	// The service port itself is preferred if the readiness probe targets the port serving the traffic.
+	if probeContainerPort == targetPort && port.NodePort != 0 {
+		probe.port = port.NodePort
+		return probe
+	}
+	for _, item := range service.Spec.Ports {
+		if item.Protocol != v1.ProtocolTCP || item.NodePort == 0 {
+			continue
+		}
+		if c, itemTargetPort := findContainerOfServicePort(pod, item); c == container && itemTargetPort == probeContainerPort {
+			probe.port = item.NodePort
+			return probe
+		}
+	}
+	return nil
+}
+
+// findContainerOfServicePort returns the container serving the service port in the pod and the resolved container port.
+// A numeric target port not declared by any container is regarded as served by the only container of the pod.
+func findContainerOfServicePort(pod *v1.Pod, port v1.ServicePort) (*v1.Container, int32) {
+	targetPort := port.TargetPort
+	if targetPort.Type == intstr.Int && targetPort.IntVal == 0 {
+		targetPort = intstr.FromInt(int(port.Port))
+	}
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		for _, containerPort := range container.Ports {
+			if containerPort.Protocol != "" && containerPort.Protocol != port.Protocol {
+				continue
+			}
+			if (targetPort.Type == intstr.String && containerPort.Name == targetPort.StrVal) ||
+				(targetPort.Type == intstr.Int && containerPort.ContainerPort == targetPort.IntVal) {
+				return container, containerPort.ContainerPort
+			}
+		}
+	}
+	if targetPort.Type == intstr.Int && len(pod.Spec.Containers) == 1 {
+		return &pod.Spec.Containers[0], targetPort.IntVal
+	}
+	return nil, 0
+}
+
+// resolveContainerPort resolves the numeric or named port of a probe of the container.
+func resolveContainerPort(container *v1.Container, port intstr.IntOrString) (int32, bool) {
+	if port.Type == intstr.Int {
+		return port.IntVal, port.IntVal > 0
+	}
+	for _, containerPort := range container.Ports {
+		if containerPort.Name == port.StrVal {
+			return containerPort.ContainerPort, true
+		}
+	}
+	return 0, false
+}
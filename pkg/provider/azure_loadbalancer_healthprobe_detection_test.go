@@ -0,0 +1,162 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestBuildHealthProbeRulesForPortWithAutoDetection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newPod := func(name string, readinessProbe *v1.Probe) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{"app": "test"},
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{
+						Name: "app",
+						Ports: []v1.ContainerPort{
+							{Name: "https", ContainerPort: 8443, Protocol: v1.ProtocolTCP},
+							{Name: "metrics", ContainerPort: 9090, Protocol: v1.ProtocolTCP},
+						},
+						ReadinessProbe: readinessProbe,
+					},
+				},
+			},
+		}
+	}
+	httpsProbe := &v1.Probe{
+		ProbeHandler: v1.ProbeHandler{
+			HTTPGet: &v1.HTTPGetAction{Path: "/ready", Port: intstr.FromString("https"), Scheme: v1.URISchemeHTTPS},
+		},
+	}
+	metricsProbe := &v1.Probe{
+		ProbeHandler: v1.ProbeHandler{
+			HTTPGet: &v1.HTTPGetAction{Port: intstr.FromInt(9090)},
+		},
+	}
+	tcpProbe := &v1.Probe{
+		ProbeHandler: v1.ProbeHandler{
+			TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(8443)},
+		},
+	}
+	execProbe := &v1.Probe{
+		ProbeHandler: v1.ProbeHandler{
+			Exec: &v1.ExecAction{Command: []string{"true"}},
+		},
+	}
+
+	for _, tc := range []struct {
+		desc             string
+		disabled         bool
+		annotations      map[string]string
+		pods             []*v1.Pod
+		expectedProtocol network.ProbeProtocol
+		expectedPort     int32
+		expectedPath     *string
+	}{
+		{
+			desc:             "HTTPS readiness probe on the target port",
+			pods:             []*v1.Pod{newPod("pod1", httpsProbe), newPod("pod2", httpsProbe)},
+			expectedProtocol: network.ProbeProtocolHTTPS,
+			expectedPort:     getBackendPort(443),
+			expectedPath:     pointer.String("/ready"),
+		},
+		{
+			desc:             "HTTP readiness probe on another port of the service",
+			pods:             []*v1.Pod{newPod("pod1", metricsProbe)},
+			expectedProtocol: network.ProbeProtocolHTTP,
+			expectedPort:     getBackendPort(9090),
+			expectedPath:     pointer.String("/"),
+		},
+		{
+			desc:             "TCP readiness probe",
+			pods:             []*v1.Pod{newPod("pod1", tcpProbe), newPod("pod2", nil)},
+			expectedProtocol: network.ProbeProtocolTCP,
+			expectedPort:     getBackendPort(443),
+		},
+		{
+			desc:             "no detection for exec readiness probes",
+			pods:             []*v1.Pod{newPod("pod1", execProbe)},
+			expectedProtocol: network.ProbeProtocolHTTP,
+			expectedPort:     consts.HealthProbeDefaultRequestPort,
+			expectedPath:     pointer.String(consts.HealthProbeDefaultRequestPath),
+		},
+		{
+			desc:             "no detection if the readiness probes are different",
+			pods:             []*v1.Pod{newPod("pod1", httpsProbe), newPod("pod2", tcpProbe)},
+			expectedProtocol: network.ProbeProtocolHTTP,
+			expectedPort:     consts.HealthProbeDefaultRequestPort,
+			expectedPath:     pointer.String(consts.HealthProbeDefaultRequestPath),
+		},
+		{
+			desc:             "no detection if any health probe annotation is set",
+			annotations:      map[string]string{consts.ServiceAnnotationLoadBalancerHealthProbeRequestPath: "/healthz"},
+			pods:             []*v1.Pod{newPod("pod1", httpsProbe)},
+			expectedProtocol: network.ProbeProtocolHTTP,
+			expectedPort:     consts.HealthProbeDefaultRequestPort,
+			expectedPath:     pointer.String("/healthz"),
+		},
+		{
+			desc:             "no detection if disabled",
+			disabled:         true,
+			pods:             []*v1.Pod{newPod("pod1", httpsProbe)},
+			expectedProtocol: network.ProbeProtocolHTTP,
+			expectedPort:     consts.HealthProbeDefaultRequestPort,
+			expectedPath:     pointer.String(consts.HealthProbeDefaultRequestPath),
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			if !tc.disabled {
+				indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+				for _, pod := range tc.pods {
+					assert.NoError(t, indexer.Add(pod))
+				}
+				az.podLister = corelisters.NewPodLister(indexer)
+			}
+			svc := getTestService("test1", v1.ProtocolTCP, tc.annotations, false, 443, 9090)
+			svc.Spec.Selector = map[string]string{"app": "test"}
+			svc.Spec.Ports[0].TargetPort = intstr.FromString("https")
+
+			probe, err := az.buildHealthProbeRulesForPort(&svc, svc.Spec.Ports[0], "rule")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedProtocol, probe.Protocol)
+			assert.Equal(t, tc.expectedPort, pointer.Int32Deref(probe.Port, 0))
+			assert.Equal(t, tc.expectedPath, probe.RequestPath)
+		})
+	}
+}
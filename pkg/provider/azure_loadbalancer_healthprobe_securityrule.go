@@ -0,0 +1,189 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// getHealthProbePorts returns the sorted node ports targeted by the health probes of the service.
+func (az *Cloud) getHealthProbePorts(service *v1.Service) ([]int32, error) {
+	probes, _, err := az.getExpectedLBRules(service, "", "", "", false)
+	if err != nil {
+		return nil, err
+	}
+	ports := []int32{}
+	seen := map[int32]bool{}
+	for _, probe := range probes {
+		if probe.ProbePropertiesFormat == nil || probe.Port == nil || seen[*probe.Port] {
+			continue
+		}
+		seen[*probe.Port] = true
+		ports = append(ports, *probe.Port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	return ports, nil
+}
+
+// getHealthProbeSecurityRuleName returns the name of the security rule allowing the health probes to the port.
+func (az *Cloud) getHealthProbeSecurityRuleName(service *v1.Service, port int32) string {
+	return fmt.Sprintf("%s-probe-%d-%s", az.getRulePrefix(service), port, consts.AzureLoadBalancerServiceTag)
+}
+
+// getExpectedHealthProbeSecurityRules returns the security rules allowing the health probes of the service from
+// the AzureLoadBalancer service tag, for the probe ports denied by the other rules of the security group.
+func (az *Cloud) getExpectedHealthProbeSecurityRules(service *v1.Service, rules []network.SecurityRule, probePorts []int32) []network.SecurityRule {
+	if !az.EnsureHealthProbeSecurityRule {
+		return nil
+	}
+
+	// the rules created for the health probes should not hide the rules denying them
+	otherRules := []network.SecurityRule{}
+	for _, rule := range rules {
+		if !strings.HasPrefix(strings.ToLower(pointer.StringDeref(rule.Name, "")), strings.ToLower(az.getRulePrefix(service)+"-probe-")) {
+			otherRules = append(otherRules, rule)
+		}
+	}
+
+	expectedRules := []network.SecurityRule{}
+	for _, port := range probePorts {
+		if _, blocked := findHealthProbeBlockingSecurityRule(otherRules, port); !blocked {
+			continue
+		}
+		expectedRules = append(expectedRules, network.SecurityRule{
+			Name: pointer.String(az.getHealthProbeSecurityRuleName(service, port)),
+			SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+				Protocol:                 network.SecurityRuleProtocolTCP,
+				SourcePortRange:          pointer.String("*"),
+				DestinationPortRange:     pointer.String(strconv.Itoa(int(port))),
+				SourceAddressPrefix:      pointer.String(consts.AzureLoadBalancerServiceTag),
+				DestinationAddressPrefix: pointer.String("*"),
+				Access:                   network.SecurityRuleAccessAllow,
+				Direction:                network.SecurityRuleDirectionInbound,
+			},
+		})
+	}
+	return expectedRules
+}
+
+// verifyHealthProbeSecurityRules emits a warning event for each probe port of the service whose health probes
+// are denied by the security group, which would mark all the backends of the load balancer as unhealthy.
+func (az *Cloud) verifyHealthProbeSecurityRules(service *v1.Service, sgName string, rules []network.SecurityRule, probePorts []int32) {
+	for _, port := range probePorts {
+		rule, blocked := findHealthProbeBlockingSecurityRule(rules, port)
+		if !blocked {
+			continue
+		}
+		warningMsg := fmt.Sprintf("health probes from %s to port %d are likely denied by security rule %s of security group %s, the backends of the load balancer may be marked as unhealthy",
+			consts.AzureLoadBalancerServiceTag, port, pointer.StringDeref(rule.Name, ""), sgName)
+		klog.Warningf("verifyHealthProbeSecurityRules(%s): %s", getServiceName(service), warningMsg)
+		az.Event(service, v1.EventTypeWarning, "HealthProbeDeniedBySecurityGroup", warningMsg)
+	}
+}
+
+// findHealthProbeBlockingSecurityRule returns the rule denying the health probes to the port. The rules are
+// evaluated by priority, and the default rule AllowAzureLoadBalancerInBound allows the probes if no rule matches.
+func findHealthProbeBlockingSecurityRule(rules []network.SecurityRule, port int32) (network.SecurityRule, bool) {
+	sortedRules := make([]network.SecurityRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.SecurityRulePropertiesFormat != nil && rule.Priority != nil {
+			sortedRules = append(sortedRules, rule)
+		}
+	}
+	sort.SliceStable(sortedRules, func(i, j int) bool {
+		return *sortedRules[i].Priority < *sortedRules[j].Priority
+	})
+
+	for _, rule := range sortedRules {
+		if !securityRuleMatchesHealthProbe(rule, port) {
+			continue
+		}
+		if strings.EqualFold(string(rule.Access), string(network.SecurityRuleAccessDeny)) {
+			return rule, true
+		}
+		return network.SecurityRule{}, false
+	}
+	return network.SecurityRule{}, false
+}
+
+// securityRuleMatchesHealthProbe returns true if the inbound rule applies to the TCP traffic from the
+// AzureLoadBalancer service tag to the port of any node in the virtual network.
+func securityRuleMatchesHealthProbe(rule network.SecurityRule, port int32) bool {
+	if !strings.EqualFold(string(rule.Direction), string(network.SecurityRuleDirectionInbound)) {
+		return false
+	}
+	if !strings.EqualFold(string(rule.Protocol), string(network.SecurityRuleProtocolAsterisk)) &&
+		!strings.EqualFold(string(rule.Protocol), string(network.SecurityRuleProtocolTCP)) {
+		return false
+	}
+	if !containsAnyFold(append(stringSlice(rule.SourceAddressPrefixes), pointer.StringDeref(rule.SourceAddressPrefix, "")),
+		"*", consts.AzureLoadBalancerServiceTag) {
+		return false
+	}
+	if !containsAnyFold(append(stringSlice(rule.DestinationAddressPrefixes), pointer.StringDeref(rule.DestinationAddressPrefix, "")),
+		"*", consts.VirtualNetworkServiceTag) {
+		return false
+	}
+	for _, portRange := range append(stringSlice(rule.DestinationPortRanges), pointer.StringDeref(rule.DestinationPortRange, "")) {
+		if portRangeContains(portRange, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// portRangeContains returns true if the port range of a security rule, e.g. "*", "80" or "30000-32767", contains the port.
+func portRangeContains(portRange string, port int32) bool {
+	portRange = strings.TrimSpace(portRange)
+	if portRange == "*" {
+		return true
+	}
+	low, high, isRange := strings.Cut(portRange, "-")
+	if !isRange {
+		high = low
+	}
+	lowPort, err := strconv.ParseInt(strings.TrimSpace(low), 10, 32)
+	if err != nil {
+		return false
+	}
+	highPort, err := strconv.ParseInt(strings.TrimSpace(high), 10, 32)
+	if err != nil {
+		return false
+	}
+	return int64(port) >= lowPort && int64(port) <= highPort
+}
+
+func containsAnyFold(values []string, targets ...string) bool {
+	for _, value := range values {
+		for _, target := range targets {
+			if strings.EqualFold(value, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func getTestInboundSecurityRule(name string, priority int32, access network.SecurityRuleAccess, src, dstPortRange string) network.SecurityRule {
+	return network.SecurityRule{
+		Name: pointer.String(name),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Protocol:                 network.SecurityRuleProtocolAsterisk,
+			SourcePortRange:          pointer.String("*"),
+			SourceAddressPrefix:      pointer.String(src),
+			DestinationPortRange:     pointer.String(dstPortRange),
+			DestinationAddressPrefix: pointer.String("*"),
+			Access:                   access,
+			Direction:                network.SecurityRuleDirectionInbound,
+			Priority:                 pointer.Int32(priority),
+		},
+	}
+}
+
+func TestFindHealthProbeBlockingSecurityRule(t *testing.T) {
+	for _, tc := range []struct {
+		desc            string
+		rules           []network.SecurityRule
+		port            int32
+		expectedBlocked bool
+		expectedRule    string
+	}{
+		{
+			desc: "no rule should allow the probes by the default rule",
+			port: 30000,
+		},
+		{
+			desc: "deny all rule should block the probes",
+			rules: []network.SecurityRule{
+				getTestInboundSecurityRule("deny-all", 4000, network.SecurityRuleAccessDeny, "*", "*"),
+			},
+			port:            30000,
+			expectedBlocked: true,
+			expectedRule:    "deny-all",
+		},
+		{
+			desc: "allow rule with a higher priority should allow the probes",
+			rules: []network.SecurityRule{
+				getTestInboundSecurityRule("deny-all", 4000, network.SecurityRuleAccessDeny, "*", "*"),
+				getTestInboundSecurityRule("allow-lb", 500, network.SecurityRuleAccessAllow, consts.AzureLoadBalancerServiceTag, "30000-32767"),
+			},
+			port: 30000,
+		},
+		{
+			desc: "allow rule for other ports should not allow the probes",
+			rules: []network.SecurityRule{
+				getTestInboundSecurityRule("deny-all", 4000, network.SecurityRuleAccessDeny, "*", "*"),
+				getTestInboundSecurityRule("allow-lb", 500, network.SecurityRuleAccessAllow, consts.AzureLoadBalancerServiceTag, "80"),
+			},
+			port:            30000,
+			expectedBlocked: true,
+			expectedRule:    "deny-all",
+		},
+		{
+			desc: "deny rule for other sources should not block the probes",
+			rules: []network.SecurityRule{
+				getTestInboundSecurityRule("deny-internet", 500, network.SecurityRuleAccessDeny, "Internet", "*"),
+			},
+			port: 30000,
+		},
+		{
+			desc: "deny rule for UDP should not block the probes",
+			rules: []network.SecurityRule{
+				func() network.SecurityRule {
+					rule := getTestInboundSecurityRule("deny-udp", 500, network.SecurityRuleAccessDeny, "*", "*")
+					rule.Protocol = network.SecurityRuleProtocolUDP
+					return rule
+				}(),
+			},
+			port: 30000,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			rule, blocked := findHealthProbeBlockingSecurityRule(tc.rules, tc.port)
+			assert.Equal(t, tc.expectedBlocked, blocked)
+			assert.Equal(t, tc.expectedRule, pointer.StringDeref(rule.Name, ""))
+		})
+	}
+}
+
+func TestPortRangeContains(t *testing.T) {
+	assert.True(t, portRangeContains("*", 80))
+	assert.True(t, portRangeContains("80", 80))
+	assert.False(t, portRangeContains("81", 80))
+	assert.True(t, portRangeContains("30000-32767", 30000))
+	assert.True(t, portRangeContains("30000-32767", 32767))
+	assert.False(t, portRangeContains("30000-32767", 80))
+	assert.False(t, portRangeContains("", 80))
+}
+
+func TestGetExpectedHealthProbeSecurityRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	probePorts, err := az.getHealthProbePorts(&svc)
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{consts.HealthProbeDefaultRequestPort}, probePorts)
+
+	denyAll := getTestInboundSecurityRule("deny-all", 4000, network.SecurityRuleAccessDeny, "*", "*")
+	assert.Empty(t, az.getExpectedHealthProbeSecurityRules(&svc, []network.SecurityRule{denyAll}, probePorts))
+
+	az.EnsureHealthProbeSecurityRule = true
+	expectedRules := az.getExpectedHealthProbeSecurityRules(&svc, []network.SecurityRule{denyAll}, probePorts)
+	assert.Len(t, expectedRules, 1)
+	assert.Equal(t, az.getHealthProbeSecurityRuleName(&svc, consts.HealthProbeDefaultRequestPort), pointer.StringDeref(expectedRules[0].Name, ""))
+	assert.Equal(t, consts.AzureLoadBalancerServiceTag, pointer.StringDeref(expectedRules[0].SourceAddressPrefix, ""))
+	assert.Equal(t, strconv.Itoa(int(consts.HealthProbeDefaultRequestPort)), pointer.StringDeref(expectedRules[0].DestinationPortRange, ""))
+	assert.True(t, az.serviceOwnsRule(&svc, pointer.StringDeref(expectedRules[0].Name, "")))
+
+	// the existing rule allowing the probes should be kept
+	existingRule := getTestInboundSecurityRule(pointer.StringDeref(expectedRules[0].Name, ""), 500, network.SecurityRuleAccessAllow,
+		consts.AzureLoadBalancerServiceTag, strconv.Itoa(int(consts.HealthProbeDefaultRequestPort)))
+	assert.Len(t, az.getExpectedHealthProbeSecurityRules(&svc, []network.SecurityRule{denyAll, existingRule}, probePorts), 1)
+
+	assert.Empty(t, az.getExpectedHealthProbeSecurityRules(&svc, nil, probePorts))
+}
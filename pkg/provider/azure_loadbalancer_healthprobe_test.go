@@ -22,7 +22,10 @@ import (
 	"testing"
 
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
@@ -197,3 +200,425 @@ func TestFindProbe(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildHealthProbeForTarget(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc          string
+		target        string
+		local         bool
+		expectedProbe *network.Probe
+		expectedErr   bool
+	}{
+		{
+			desc: "no probe if the annotation is not set",
+		},
+		{
+			desc:   "no probe for local services",
+			target: consts.HealthProbeTargetKubeProxy,
+			local:  true,
+		},
+		{
+			desc:   "kube-proxy healthz",
+			target: consts.HealthProbeTargetKubeProxy,
+			expectedProbe: &network.Probe{
+				Name: pointer.String("atest1-TCP-10256"),
+				ProbePropertiesFormat: &network.ProbePropertiesFormat{
+					Protocol:          network.ProbeProtocolHTTP,
+					Port:              pointer.Int32(10256),
+					RequestPath:       pointer.String("/healthz"),
+					IntervalInSeconds: pointer.Int32(consts.HealthProbeDefaultProbeInterval),
+					ProbeThreshold:    pointer.Int32(consts.HealthProbeDefaultNumOfProbe),
+				},
+			},
+		},
+		{
+			desc:   "custom port",
+			target: "30000",
+			expectedProbe: &network.Probe{
+				Name: pointer.String("atest1-TCP-30000"),
+				ProbePropertiesFormat: &network.ProbePropertiesFormat{
+					Protocol:          network.ProbeProtocolTCP,
+					Port:              pointer.Int32(30000),
+					IntervalInSeconds: pointer.Int32(consts.HealthProbeDefaultProbeInterval),
+					ProbeThreshold:    pointer.Int32(consts.HealthProbeDefaultNumOfProbe),
+				},
+			},
+		},
+		{
+			desc:   "custom port and path",
+			target: "30000/ready/check",
+			expectedProbe: &network.Probe{
+				Name: pointer.String("atest1-TCP-30000"),
+				ProbePropertiesFormat: &network.ProbePropertiesFormat{
+					Protocol:          network.ProbeProtocolHTTP,
+					Port:              pointer.Int32(30000),
+					RequestPath:       pointer.String("/ready/check"),
+					IntervalInSeconds: pointer.Int32(consts.HealthProbeDefaultProbeInterval),
+					ProbeThreshold:    pointer.Int32(consts.HealthProbeDefaultNumOfProbe),
+				},
+			},
+		},
+		{
+			desc:        "invalid port",
+			target:      "healthz",
+			expectedErr: true,
+		},
+		{
+			desc:        "port out of range",
+			target:      "70000/healthz",
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			svc := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+			if tc.target != "" {
+				svc.Annotations[consts.ServiceAnnotationLoadBalancerHealthProbeTarget] = tc.target
+			}
+			if tc.local {
+				svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyLocal
+			}
+
+			probe, err := az.buildHealthProbeForTarget(&svc, false)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedProbe, probe)
+		})
+	}
+}
+
+func TestGetExpectedLBRulesWithHealthProbeTarget(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("test1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerHealthProbeTarget: consts.HealthProbeTargetKubeProxy,
+	}, false, 80, 443)
+
+	probes, rules, err := az.getExpectedLBRules(&svc, "frontendIPConfigID", "backendPoolID", "lbname", false)
+	assert.NoError(t, err)
+	assert.Len(t, probes, 1)
+	assert.Equal(t, "atest1-TCP-10256", pointer.StringDeref(probes[0].Name, ""))
+	assert.Len(t, rules, 2)
+	for _, rule := range rules {
+		assert.Equal(t, az.getLoadBalancerProbeID("lbname", "atest1-TCP-10256"), pointer.StringDeref(rule.Probe.ID, ""))
+	}
+}
+
+func TestReconcileLBProbesReplacesStaleProbe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	otherSvc := getTestService("test2", v1.ProtocolTCP, nil, false, 80)
+	otherProbe := network.Probe{
+		Name: pointer.String("atest2-TCP-80"),
+		ProbePropertiesFormat: &network.ProbePropertiesFormat{
+			Protocol: network.ProbeProtocolTCP,
+			Port:     pointer.Int32(10080),
+		},
+	}
+	staleProbe := network.Probe{
+		Name: pointer.String("atest1-TCP-80"),
+		ProbePropertiesFormat: &network.ProbePropertiesFormat{
+			Protocol: network.ProbeProtocolTCP,
+			Port:     pointer.Int32(10080),
+		},
+	}
+	expectedProbe := network.Probe{
+		Name: pointer.String("atest1-TCP-80"),
+		ProbePropertiesFormat: &network.ProbePropertiesFormat{
+			Protocol:    network.ProbeProtocolHTTP,
+			Port:        pointer.Int32(20080),
+			RequestPath: pointer.String("/healthz"),
+		},
+	}
+	// the health probe annotations of the service are changed while the other service
+	// sharing the load balancer keeps its own probe
+	lb := &network.LoadBalancer{
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			Probes: &[]network.Probe{otherProbe, staleProbe},
+		},
+	}
+
+	dirty := az.reconcileLBProbes(lb, &svc, "default/test1", true, []network.Probe{expectedProbe})
+	assert.True(t, dirty)
+	assert.Equal(t, []network.Probe{otherProbe, expectedProbe}, *lb.Probes)
+
+	dirty = az.reconcileLBProbes(lb, &otherSvc, "default/test2", true, []network.Probe{otherProbe})
+	assert.False(t, dirty)
+}
+
+func TestParseHealthProbeRequestHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		desc            string
+		value           string
+		expectedHeaders map[string]string
+		expectedErr     bool
+	}{
+		{
+			desc:            "headers are parsed with canonical names",
+			value:           "host:example.com, X-Probe-Token : abc:def",
+			expectedHeaders: map[string]string{"Host": "example.com", "X-Probe-Token": "abc:def"},
+		},
+		{
+			desc:        "header without value separator",
+			value:       "Host",
+			expectedErr: true,
+		},
+		{
+			desc:        "empty header name",
+			value:       ":example.com",
+			expectedErr: true,
+		},
+		{
+			desc:        "invalid header name",
+			value:       "Ho st:example.com",
+			expectedErr: true,
+		},
+		{
+			desc:        "control characters in header value",
+			value:       "Host:example.com\r\nX-Injected:1",
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			headers, err := parseHealthProbeRequestHeaders(tc.value)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedHeaders, headers)
+		})
+	}
+}
+
+func TestParseHealthProbeExpectedStatusCodes(t *testing.T) {
+	for _, tc := range []struct {
+		desc           string
+		value          string
+		expectedRanges [][2]int
+		expectedErr    bool
+	}{
+		{
+			desc:           "codes and ranges",
+			value:          "200-299, 301",
+			expectedRanges: [][2]int{{200, 299}, {301, 301}},
+		},
+		{
+			desc:        "not an integer",
+			value:       "2xx",
+			expectedErr: true,
+		},
+		{
+			desc:        "out of range",
+			value:       "200-600",
+			expectedErr: true,
+		},
+		{
+			desc:        "descending range",
+			value:       "299-200",
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ranges, err := parseHealthProbeExpectedStatusCodes(tc.value)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedRanges, ranges)
+		})
+	}
+}
+
+func TestBuildHealthProbeRulesForPortWithRequestOptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc        string
+		annotations map[string]string
+		expectedErr bool
+	}{
+		{
+			desc: "valid global request options are ignored",
+			annotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerHealthProbeRequestHeaders:      "Host:example.com",
+				consts.ServiceAnnotationLoadBalancerHealthProbeExpectedStatusCodes: "200-299",
+			},
+		},
+		{
+			desc: "invalid global request headers",
+			annotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerHealthProbeRequestHeaders: "Host",
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "port-specific request options take precedence",
+			annotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerHealthProbeExpectedStatusCodes:                           "999",
+				consts.BuildHealthProbeAnnotationKeyForPort(80, consts.HealthProbeParamsExpectedStatusCodes): "200",
+			},
+		},
+		{
+			desc: "invalid port-specific expected status codes",
+			annotations: map[string]string{
+				consts.BuildHealthProbeAnnotationKeyForPort(80, consts.HealthProbeParamsExpectedStatusCodes): "200-",
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "request options are not validated for TCP probes",
+			annotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerHealthProbeProtocol:       "Tcp",
+				consts.ServiceAnnotationLoadBalancerHealthProbeRequestHeaders: "Host",
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			svc := getTestService("test1", v1.ProtocolTCP, tc.annotations, false, 80)
+
+			probe, err := az.buildHealthProbeRulesForPort(&svc, svc.Spec.Ports[0], "rule")
+			assert.Equal(t, tc.expectedErr, err != nil)
+			if !tc.expectedErr {
+				assert.NotNil(t, probe)
+			}
+		})
+	}
+}
+
+func TestBuildHealthProbeRulesForPortWithPLSProxyProtocol(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc                     string
+		annotations              map[string]string
+		backendPoolType          string
+		expectedProtocol         network.ProbeProtocol
+		expectedPort             int32
+		expectedRequestPathIsSet bool
+	}{
+		{
+			desc: "HTTP probe on the node port is replaced by TCP probe",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSCreation:                                               "true",
+				consts.ServiceAnnotationPLSProxyProtocol:                                          "true",
+				consts.BuildHealthProbeAnnotationKeyForPort(80, consts.HealthProbeParamsPort):     "80",
+				consts.BuildHealthProbeAnnotationKeyForPort(80, consts.HealthProbeParamsProtocol): "http",
+			},
+			expectedProtocol: network.ProbeProtocolTCP,
+			expectedPort:     10080,
+		},
+		{
+			desc: "HTTP probe on kube-proxy is kept",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSCreation:      "true",
+				consts.ServiceAnnotationPLSProxyProtocol: "true",
+			},
+			expectedProtocol:         network.ProbeProtocolHTTP,
+			expectedPort:             consts.HealthProbeDefaultRequestPort,
+			expectedRequestPathIsSet: true,
+		},
+		{
+			desc: "HTTP probe on the pod port is replaced by TCP probe",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSCreation:      "true",
+				consts.ServiceAnnotationPLSProxyProtocol: "true",
+			},
+			backendPoolType:  consts.LoadBalancerBackendPoolConfigurationTypePODIP,
+			expectedProtocol: network.ProbeProtocolTCP,
+			expectedPort:     80,
+		},
+		{
+			desc: "proxy protocol is ignored without private link service",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSProxyProtocol:                                          "true",
+				consts.BuildHealthProbeAnnotationKeyForPort(80, consts.HealthProbeParamsPort):     "80",
+				consts.BuildHealthProbeAnnotationKeyForPort(80, consts.HealthProbeParamsProtocol): "http",
+			},
+			expectedProtocol:         network.ProbeProtocolHTTP,
+			expectedPort:             10080,
+			expectedRequestPathIsSet: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			if tc.backendPoolType != "" {
+				az.LoadBalancerBackendPoolConfigurationType = tc.backendPoolType
+			}
+			svc := getTestService("test1", v1.ProtocolTCP, tc.annotations, false, 80)
+
+			probe, err := az.buildHealthProbeRulesForPort(&svc, svc.Spec.Ports[0], "rule")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedProtocol, probe.Protocol)
+			assert.Equal(t, tc.expectedPort, pointer.Int32Deref(probe.Port, 0))
+			assert.Equal(t, tc.expectedRequestPathIsSet, probe.RequestPath != nil)
+		})
+	}
+}
+
+func TestFindHealthProbeServicePortByNumber(t *testing.T) {
+	for _, tc := range []struct {
+		desc             string
+		ports            []v1.ServicePort
+		expectedNodePort int32
+		expectedConflict bool
+	}{
+		{
+			desc:  "no matching port",
+			ports: []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}},
+		},
+		{
+			desc:             "single matching port",
+			ports:            []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}, {Protocol: v1.ProtocolTCP, Port: 53, NodePort: 30053}},
+			expectedNodePort: 30053,
+		},
+		{
+			desc:             "TCP port takes precedence regardless of the port order",
+			ports:            []v1.ServicePort{{Protocol: v1.ProtocolUDP, Port: 53, NodePort: 30001}, {Protocol: v1.ProtocolTCP, Port: 53, NodePort: 30053}},
+			expectedNodePort: 30053,
+			expectedConflict: true,
+		},
+		{
+			desc:             "lowest node port is used among the ports of the same protocol",
+			ports:            []v1.ServicePort{{Protocol: v1.ProtocolUDP, Port: 53, NodePort: 30054}, {Protocol: v1.ProtocolSCTP, Port: 53, NodePort: 30053}},
+			expectedNodePort: 30053,
+			expectedConflict: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := &v1.Service{Spec: v1.ServiceSpec{Ports: tc.ports}}
+			match, conflict := findHealthProbeServicePortByNumber(svc, 53)
+			if tc.expectedNodePort == 0 {
+				assert.Nil(t, match)
+			} else {
+				assert.Equal(t, tc.expectedNodePort, match.NodePort)
+			}
+			assert.Equal(t, tc.expectedConflict, conflict)
+		})
+	}
+}
+
+func TestBuildHealthProbeRulesForPortWithConflictingProbePort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	svc := getTestService("test1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerHealthProbeProtocol:                       "Tcp",
+		consts.BuildHealthProbeAnnotationKeyForPort(80, consts.HealthProbeParamsPort): "53",
+	}, false, 80)
+	svc.Spec.Ports = append(svc.Spec.Ports,
+		v1.ServicePort{Name: "dns-udp", Protocol: v1.ProtocolUDP, Port: 53, NodePort: 30001},
+		v1.ServicePort{Name: "dns-tcp", Protocol: v1.ProtocolTCP, Port: 53, NodePort: 30053},
+	)
+
+	probe, err := az.buildHealthProbeRulesForPort(&svc, svc.Spec.Ports[0], "rule")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(30053), pointer.Int32Deref(probe.Port, 0))
+	assert.Contains(t, <-recorder.Events, "ConflictingHealthProbeConfig")
+}
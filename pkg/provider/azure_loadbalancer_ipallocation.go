@@ -0,0 +1,236 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	// subnetIPConfigurationsExpand expands the IP configurations using the addresses of a subnet.
+	subnetIPConfigurationsExpand = "ipConfigurations"
+
+	// maxIPAllocationCandidates limits the number of addresses checked when allocating
+	// a private IP from a range, which matters for large IPv6 ranges.
+	maxIPAllocationCandidates = 65536
+)
+
+// internalIPAllocation is the parsed value of the internal IP allocation annotation.
+// Exactly one of ip and prefix is valid.
+type internalIPAllocation struct {
+	subnetName string
+	ip         netip.Addr
+	prefix     netip.Prefix
+}
+
+func (a *internalIPAllocation) isIPv6() bool {
+	if a.ip.IsValid() {
+		return a.ip.Is6()
+	}
+	return a.prefix.Addr().Is6()
+}
+
+func (a *internalIPAllocation) address() string {
+	if a.ip.IsValid() {
+		return a.ip.String()
+	}
+	return a.prefix.String()
+}
+
+// contains returns true if the ip is the static IP or in the range of the allocation.
+func (a *internalIPAllocation) contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	if a.ip.IsValid() {
+		return a.ip == addr
+	}
+	return a.prefix.Contains(addr)
+}
+
+// parseInternalIPAllocation parses the internal IP allocation annotation of the service.
+// It returns nil if the annotation is not set or the service is not internal.
+func parseInternalIPAllocation(service *v1.Service) (*internalIPAllocation, error) {
+	if !requiresInternalLoadBalancer(service) {
+		return nil, nil
+	}
+	value, found := service.Annotations[consts.ServiceAnnotationLoadBalancerInternalIPAllocation]
+	if !found || strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	subnetName, address, found := strings.Cut(strings.TrimSpace(value), "/")
+	if !found || subnetName == "" || address == "" {
+		return nil, fmt.Errorf("invalid value %q of annotation %s: expected <subnet>/<ip> or <subnet>/<cidr>", value, consts.ServiceAnnotationLoadBalancerInternalIPAllocation)
+	}
+	if subnet, found := service.Annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet]; found && strings.TrimSpace(subnet) != "" && !strings.EqualFold(subnet, subnetName) {
+		return nil, fmt.Errorf("the subnet %s of annotation %s conflicts with the subnet %s of annotation %s", subnetName, consts.ServiceAnnotationLoadBalancerInternalIPAllocation, subnet, consts.ServiceAnnotationLoadBalancerInternalSubnet)
+	}
+
+	allocation := &internalIPAllocation{subnetName: subnetName}
+	if strings.Contains(address, "/") {
+		prefix, err := netip.ParsePrefix(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address range %q of annotation %s: %w", address, consts.ServiceAnnotationLoadBalancerInternalIPAllocation, err)
+		}
+		allocation.prefix = prefix.Masked()
+	} else {
+		ip, err := netip.ParseAddr(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q of annotation %s: %w", address, consts.ServiceAnnotationLoadBalancerInternalIPAllocation, err)
+		}
+		allocation.ip = ip
+	}
+
+	for _, isIPv6 := range []bool{false, true} {
+		if getServiceLoadBalancerIP(service, isIPv6) != "" {
+			return nil, fmt.Errorf("annotation %s cannot be used together with the loadBalancerIP of the service", consts.ServiceAnnotationLoadBalancerInternalIPAllocation)
+		}
+	}
+	return allocation, nil
+}
+
+// getSubnetPrefixes returns the address prefixes of the subnet.
+func getSubnetPrefixes(subnet *network.Subnet) []netip.Prefix {
+	if subnet == nil || subnet.SubnetPropertiesFormat == nil {
+		return nil
+	}
+	cidrs := make([]string, 0)
+	if subnet.AddressPrefix != nil {
+		cidrs = append(cidrs, *subnet.AddressPrefix)
+	}
+	if subnet.AddressPrefixes != nil {
+		cidrs = append(cidrs, *subnet.AddressPrefixes...)
+	}
+	var prefixes []netip.Prefix
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			klog.Errorf("getSubnetPrefixes: failed to parse ip cidr %s: %v", cidr, err)
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// isAzureReservedIP returns true if the ip is one of the addresses Azure reserves in the subnet,
+// i.e., the first four addresses and, for IPv4, the last address of the subnet.
+func isAzureReservedIP(ip netip.Addr, prefix netip.Prefix) bool {
+	first := prefix.Addr()
+	for i := 0; i < 4; i++ {
+		if ip == first {
+			return true
+		}
+		first = first.Next()
+	}
+	if ip.Is4() {
+		last := prefix.Addr().As4()
+		hostBits := 32 - prefix.Bits()
+		for i := 3; i >= 0 && hostBits > 0; i-- {
+			bits := hostBits
+			if bits > 8 {
+				bits = 8
+			}
+			last[i] |= byte(1<<bits - 1)
+			hostBits -= bits
+		}
+		return ip == netip.AddrFrom4(last)
+	}
+	return false
+}
+
+// getSubnetUsedIPs returns the private IPs of the IP configurations in the subnet, keyed by the IP.
+func getSubnetUsedIPs(subnet *network.Subnet) map[netip.Addr]string {
+	usedIPs := make(map[netip.Addr]string)
+	if subnet == nil || subnet.SubnetPropertiesFormat == nil || subnet.IPConfigurations == nil {
+		return usedIPs
+	}
+	for _, ipConfig := range *subnet.IPConfigurations {
+		if ipConfig.IPConfigurationPropertiesFormat == nil {
+			continue
+		}
+		ip, err := netip.ParseAddr(pointer.StringDeref(ipConfig.PrivateIPAddress, ""))
+		if err != nil {
+			continue
+		}
+		usedIPs[ip] = pointer.StringDeref(ipConfig.ID, "")
+	}
+	return usedIPs
+}
+
+// getInternalIPAllocationPrivateIP returns the private IP of the frontend specified by the internal
+// IP allocation annotation. The subnet must be expanded with its IP configurations. The current IPs
+// of the service are kept if they satisfy the allocation. It returns an empty string if the annotation
+// is not set or targets the other IP family.
+func getInternalIPAllocationPrivateIP(service *v1.Service, subnet *network.Subnet, isIPv6 bool, currentIPs []string) (string, error) {
+	allocation, err := parseInternalIPAllocation(service)
+	if err != nil || allocation == nil || allocation.isIPv6() != isIPv6 {
+		return "", err
+	}
+
+	subnetName := pointer.StringDeref(subnet.Name, allocation.subnetName)
+	prefixes := getSubnetPrefixes(subnet)
+	var subnetPrefix netip.Prefix
+	for _, prefix := range prefixes {
+		if (allocation.ip.IsValid() && prefix.Contains(allocation.ip)) ||
+			(allocation.prefix.IsValid() && prefix.Contains(allocation.prefix.Addr()) && prefix.Bits() <= allocation.prefix.Bits()) {
+			subnetPrefix = prefix
+			break
+		}
+	}
+	if !subnetPrefix.IsValid() {
+		return "", fmt.Errorf("the address %s of annotation %s is not in the address prefixes %v of subnet %s", allocation.address(), consts.ServiceAnnotationLoadBalancerInternalIPAllocation, prefixes, subnetName)
+	}
+
+	for _, currentIP := range currentIPs {
+		if allocation.contains(currentIP) {
+			return currentIP, nil
+		}
+	}
+
+	usedIPs := getSubnetUsedIPs(subnet)
+	if allocation.ip.IsValid() {
+		if isAzureReservedIP(allocation.ip, subnetPrefix) {
+			return "", fmt.Errorf("the IP address %s is reserved by Azure in subnet %s", allocation.ip, subnetName)
+		}
+		if ipConfigID, used := usedIPs[allocation.ip]; used {
+			return "", fmt.Errorf("the IP address %s of subnet %s is already used by %s", allocation.ip, subnetName, ipConfigID)
+		}
+		return allocation.ip.String(), nil
+	}
+
+	ip := allocation.prefix.Addr()
+	for i := 0; i < maxIPAllocationCandidates && ip.IsValid() && allocation.prefix.Contains(ip); i++ {
+		if _, used := usedIPs[ip]; !used && !isAzureReservedIP(ip, subnetPrefix) {
+			return ip.String(), nil
+		}
+		ip = ip.Next()
+	}
+	return "", fmt.Errorf("no available IP address in range %s of subnet %s", allocation.prefix, subnetName)
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func getTestInternalServiceWithIPAllocation(allocation string) v1.Service {
+	svc := getInternalTestService("test1", 80)
+	svc.Annotations[consts.ServiceAnnotationLoadBalancerInternalIPAllocation] = allocation
+	return svc
+}
+
+func TestParseInternalIPAllocation(t *testing.T) {
+	for _, tc := range []struct {
+		desc               string
+		service            v1.Service
+		expectedAllocation *internalIPAllocation
+		expectedErr        bool
+	}{
+		{
+			desc:    "annotation not set",
+			service: getInternalTestService("test1", 80),
+		},
+		{
+			desc: "external service",
+			service: func() v1.Service {
+				svc := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+				svc.Annotations[consts.ServiceAnnotationLoadBalancerInternalIPAllocation] = "subnet/10.0.0.10"
+				return svc
+			}(),
+		},
+		{
+			desc:               "static IP",
+			service:            getTestInternalServiceWithIPAllocation("subnet/10.0.0.10"),
+			expectedAllocation: &internalIPAllocation{subnetName: "subnet", ip: netip.MustParseAddr("10.0.0.10")},
+		},
+		{
+			desc:               "address range",
+			service:            getTestInternalServiceWithIPAllocation("subnet/10.0.0.17/28"),
+			expectedAllocation: &internalIPAllocation{subnetName: "subnet", prefix: netip.MustParsePrefix("10.0.0.16/28")},
+		},
+		{
+			desc:        "missing subnet",
+			service:     getTestInternalServiceWithIPAllocation("10.0.0.10"),
+			expectedErr: true,
+		},
+		{
+			desc:        "invalid IP",
+			service:     getTestInternalServiceWithIPAllocation("subnet/10.0.0"),
+			expectedErr: true,
+		},
+		{
+			desc: "conflicting subnet annotation",
+			service: func() v1.Service {
+				svc := getTestInternalServiceWithIPAllocation("subnet/10.0.0.10")
+				svc.Annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet] = "other"
+				return svc
+			}(),
+			expectedErr: true,
+		},
+		{
+			desc: "used together with loadBalancerIP",
+			service: func() v1.Service {
+				svc := getTestInternalServiceWithIPAllocation("subnet/10.0.0.10")
+				svc.Spec.LoadBalancerIP = "10.0.0.11"
+				return svc
+			}(),
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			allocation, err := parseInternalIPAllocation(&tc.service)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedAllocation, allocation)
+		})
+	}
+}
+
+func TestGetInternalIPAllocationPrivateIP(t *testing.T) {
+	subnet := &network.Subnet{
+		Name: pointer.String("subnet"),
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+			AddressPrefix: pointer.String("10.0.0.0/24"),
+			IPConfigurations: &[]network.IPConfiguration{
+				{
+					ID:                              pointer.String("nic1"),
+					IPConfigurationPropertiesFormat: &network.IPConfigurationPropertiesFormat{PrivateIPAddress: pointer.String("10.0.0.4")},
+				},
+				{
+					ID:                              pointer.String("nic2"),
+					IPConfigurationPropertiesFormat: &network.IPConfigurationPropertiesFormat{PrivateIPAddress: pointer.String("10.0.0.5")},
+				},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		desc        string
+		allocation  string
+		isIPv6      bool
+		currentIPs  []string
+		expectedIP  string
+		expectedErr bool
+	}{
+		{
+			desc:       "annotation targets the other IP family",
+			allocation: "subnet/10.0.0.10",
+			isIPv6:     true,
+		},
+		{
+			desc:       "available static IP",
+			allocation: "subnet/10.0.0.10",
+			expectedIP: "10.0.0.10",
+		},
+		{
+			desc:        "static IP in use",
+			allocation:  "subnet/10.0.0.4",
+			expectedErr: true,
+		},
+		{
+			desc:       "static IP used by the service itself",
+			allocation: "subnet/10.0.0.4",
+			currentIPs: []string{"10.0.0.4"},
+			expectedIP: "10.0.0.4",
+		},
+		{
+			desc:        "static IP reserved by Azure",
+			allocation:  "subnet/10.0.0.255",
+			expectedErr: true,
+		},
+		{
+			desc:        "static IP out of the subnet",
+			allocation:  "subnet/10.0.1.10",
+			expectedErr: true,
+		},
+		{
+			desc:       "first available IP of the range",
+			allocation: "subnet/10.0.0.0/29",
+			expectedIP: "10.0.0.6",
+		},
+		{
+			desc:       "keep the current IP in the range",
+			allocation: "subnet/10.0.0.0/29",
+			currentIPs: []string{"10.0.0.7"},
+			expectedIP: "10.0.0.7",
+		},
+		{
+			desc:        "no available IP in the range",
+			allocation:  "subnet/10.0.0.0/30",
+			expectedErr: true,
+		},
+		{
+			desc:        "range larger than the subnet",
+			allocation:  "subnet/10.0.0.0/16",
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := getTestInternalServiceWithIPAllocation(tc.allocation)
+			ip, err := getInternalIPAllocationPrivateIP(&svc, subnet, tc.isIPv6, tc.currentIPs)
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+			assert.Equal(t, tc.expectedIP, ip)
+		})
+	}
+}
+
+func TestIsAzureReservedIP(t *testing.T) {
+	prefix := netip.MustParsePrefix("10.0.0.0/22")
+	for ip, expected := range map[string]bool{
+		"10.0.0.0":   true,
+		"10.0.0.3":   true,
+		"10.0.0.4":   false,
+		"10.0.1.255": false,
+		"10.0.3.255": true,
+	} {
+		assert.Equal(t, expected, isAzureReservedIP(netip.MustParseAddr(ip), prefix), ip)
+	}
+}
+
+func TestReconcileFrontendIPConfigsWithInternalIPAllocation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.LoadBalancerSku = string(network.LoadBalancerSkuNameStandard)
+	service := getTestInternalServiceWithIPAllocation("subnet/10.0.0.0/29")
+	lb := getTestLoadBalancer(pointer.String("lb"), pointer.String("rg"), pointer.String("testCluster"), pointer.String("testCluster"), service, "standard")
+	lb.FrontendIPConfigurations = &[]network.FrontendIPConfiguration{}
+
+	mockSubnetsClient := cloud.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", subnetIPConfigurationsExpand).Return(network.Subnet{
+		Name: pointer.String("subnet"),
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+			AddressPrefix: pointer.String("10.0.0.0/24"),
+			IPConfigurations: &[]network.IPConfiguration{
+				{
+					ID:                              pointer.String("nic1"),
+					IPConfigurationPropertiesFormat: &network.IPConfigurationPropertiesFormat{PrivateIPAddress: pointer.String("10.0.0.4")},
+				},
+			},
+		},
+	}, nil)
+
+	lbFrontendIPConfigNames := map[bool]string{false: cloud.getDefaultFrontendIPConfigName(&service)}
+	_, _, dirty, err := cloud.reconcileFrontendIPConfigs("testCluster", &service, &lb, nil, true, lbFrontendIPConfigNames)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Len(t, *lb.FrontendIPConfigurations, 1)
+	fip := (*lb.FrontendIPConfigurations)[0]
+	assert.Equal(t, network.Static, fip.PrivateIPAllocationMethod)
+	assert.Equal(t, "10.0.0.5", pointer.StringDeref(fip.PrivateIPAddress, ""))
+}
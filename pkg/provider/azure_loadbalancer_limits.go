@@ -0,0 +1,194 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// loadBalancerResourceCounts is the number of the sub-resources of a load balancer limited by Azure.
+type loadBalancerResourceCounts struct {
+	frontendIPConfigurations int
+	rules                    int
+	probes                   int
+}
+
+// add returns the sum of the counts.
+func (c loadBalancerResourceCounts) add(other loadBalancerResourceCounts) loadBalancerResourceCounts {
+	return loadBalancerResourceCounts{
+		frontendIPConfigurations: c.frontendIPConfigurations + other.frontendIPConfigurations,
+		rules:                    c.rules + other.rules,
+		probes:                   c.probes + other.probes,
+	}
+}
+
+// exceeded returns the descriptions of the counts above the limits, ignoring the ones not grown from the base
+// counts so that the load balancers already above the limits can still be updated without adding to them. The
+// limits of 0 are not enforced.
+func (c loadBalancerResourceCounts) exceeded(base, limits loadBalancerResourceCounts) []string {
+	var exceeded []string
+	check := func(resource string, count, baseCount, limit int) {
+		if limit > 0 && count > limit && count > baseCount {
+			exceeded = append(exceeded, fmt.Sprintf("%d %s (limit %d)", count, resource, limit))
+		}
+	}
+	check("frontend IP configurations", c.frontendIPConfigurations, base.frontendIPConfigurations, limits.frontendIPConfigurations)
+	check("rules", c.rules, base.rules, limits.rules)
+	check("probes", c.probes, base.probes, limits.probes)
+	return exceeded
+}
+
+// getLoadBalancerResourceCounts counts the sub-resources of the load balancer.
+func getLoadBalancerResourceCounts(lb *network.LoadBalancer) loadBalancerResourceCounts {
+	var counts loadBalancerResourceCounts
+	if lb == nil || lb.LoadBalancerPropertiesFormat == nil {
+		return counts
+	}
+	if lb.FrontendIPConfigurations != nil {
+		counts.frontendIPConfigurations = len(*lb.FrontendIPConfigurations)
+	}
+	if lb.LoadBalancingRules != nil {
+		counts.rules = len(*lb.LoadBalancingRules)
+	}
+	if lb.Probes != nil {
+		counts.probes = len(*lb.Probes)
+	}
+	return counts
+}
+
+// getLoadBalancerResourceLimits returns the configured limits of the sub-resources of the load balancers.
+func (az *Cloud) getLoadBalancerResourceLimits() loadBalancerResourceCounts {
+	return loadBalancerResourceCounts{
+		frontendIPConfigurations: az.MaximumLoadBalancerFrontendIPConfigurationCount,
+		rules:                    az.MaximumLoadBalancerRuleCount,
+		probes:                   az.MaximumLoadBalancerProbeCount,
+	}
+}
+
+// getServiceLoadBalancerResourceCounts estimates the sub-resources a new service adds to the load balancer, which
+// is a frontend IP configuration per IP family, and a rule and a probe per port and IP family at most.
+func getServiceLoadBalancerResourceCounts(service *v1.Service) loadBalancerResourceCounts {
+	v4Enabled, v6Enabled := getIPFamiliesEnabled(service)
+	var families int
+	if v4Enabled {
+		families++
+	}
+	if v6Enabled {
+		families++
+	}
+	ports := len(service.Spec.Ports)
+	if consts.IsK8sServiceHasHAModeEnabled(service) {
+		ports = 1
+	}
+	return loadBalancerResourceCounts{
+		frontendIPConfigurations: families,
+		rules:                    ports * families,
+		probes:                   ports * families,
+	}
+}
+
+// updateLoadBalancerResourceCounts records the counts of the sub-resources of the load balancers read or updated.
+func (az *Cloud) updateLoadBalancerResourceCounts(lbs ...network.LoadBalancer) {
+	for i := range lbs {
+		if lbs[i].Name == nil {
+			continue
+		}
+		az.lbResourceCounts.Store(strings.ToLower(*lbs[i].Name), getLoadBalancerResourceCounts(&lbs[i]))
+	}
+}
+
+// deleteLoadBalancerResourceCounts forgets the counts of the sub-resources of the deleted load balancer.
+func (az *Cloud) deleteLoadBalancerResourceCounts(lbName string) {
+	az.lbResourceCounts.Delete(strings.ToLower(lbName))
+}
+
+// getCachedLoadBalancerResourceCounts returns the last known counts of the sub-resources of the load balancer,
+// which are zero if the load balancer is not known.
+func (az *Cloud) getCachedLoadBalancerResourceCounts(lbName string) loadBalancerResourceCounts {
+	if value, ok := az.lbResourceCounts.Load(strings.ToLower(lbName)); ok {
+		return value.(loadBalancerResourceCounts)
+	}
+	return loadBalancerResourceCounts{}
+}
+
+// checkLoadBalancerLimits refuses the update of the load balancer if it adds sub-resources beyond the limits to the
+// last known ones, which would be rejected by Azure after being sent.
+func (az *Cloud) checkLoadBalancerLimits(service *v1.Service, lb *network.LoadBalancer) error {
+	if !az.EnableLoadBalancerLimitGuardrails {
+		return nil
+	}
+
+	lbName := pointer.StringDeref(lb.Name, "")
+	exceeded := getLoadBalancerResourceCounts(lb).exceeded(az.getCachedLoadBalancerResourceCounts(lbName), az.getLoadBalancerResourceLimits())
+	if len(exceeded) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("load balancer %s would have %s after placing service %s", lbName, strings.Join(exceeded, ", "), getServiceName(service))
+	klog.Errorf("checkLoadBalancerLimits: %v", err)
+	az.Event(service, v1.EventTypeWarning, "LoadBalancerLimitExceeded", err.Error())
+	return err
+}
+
+// filterLoadBalancersWithinLimits filters out the eligible load balancers the service would exceed the limits of, if
+// EnableLoadBalancerAutoSelectionOnLimits is set. The load balancer currently used by the service is always kept,
+// and all the eligible load balancers are returned if they are all full, so that the update is refused by
+// checkLoadBalancerLimits with an event.
+func (az *Cloud) filterLoadBalancersWithinLimits(service *v1.Service, currentLBName string, eligibleLBs []string, isInternal bool) []string {
+	if !az.EnableLoadBalancerLimitGuardrails || !az.EnableLoadBalancerAutoSelectionOnLimits {
+		return eligibleLBs
+	}
+
+	serviceCounts := getServiceLoadBalancerResourceCounts(service)
+	limits := az.getLoadBalancerResourceLimits()
+	var withinLimits, full []string
+	for _, eligibleLB := range eligibleLBs {
+		lbName := eligibleLB
+		if isInternal {
+			lbName += consts.InternalLoadBalancerNameSuffix
+		}
+		counts := az.getCachedLoadBalancerResourceCounts(lbName)
+		if !strings.EqualFold(eligibleLB, currentLBName) && len(counts.add(serviceCounts).exceeded(counts, limits)) > 0 {
+			full = append(full, eligibleLB)
+			continue
+		}
+		withinLimits = append(withinLimits, eligibleLB)
+	}
+
+	if len(full) == 0 {
+		return eligibleLBs
+	}
+	if len(withinLimits) == 0 {
+		klog.Warningf("filterLoadBalancersWithinLimits: service %q would exceed the limits of all the eligible load balancers %q", getServiceName(service), eligibleLBs)
+		return eligibleLBs
+	}
+	klog.V(2).Infof("filterLoadBalancersWithinLimits: service %q skips the load balancers %q which would exceed the limits", getServiceName(service), full)
+	if currentLBName == "" {
+		az.Event(service, v1.EventTypeNormal, "LoadBalancerSkippedOnLimits", fmt.Sprintf(
+			"Skipped the load balancers %s which would exceed the limits", strings.Join(full, ", ")))
+	}
+	return withinLimits
+}
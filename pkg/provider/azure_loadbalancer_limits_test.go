@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+)
+
+func buildLoadBalancerWithCounts(name string, frontends, rules, probes int) network.LoadBalancer {
+	fips := make([]network.FrontendIPConfiguration, frontends)
+	lbRules := make([]network.LoadBalancingRule, rules)
+	lbProbes := make([]network.Probe, probes)
+	return network.LoadBalancer{
+		Name: pointer.String(name),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &fips,
+			LoadBalancingRules:       &lbRules,
+			Probes:                   &lbProbes,
+		},
+	}
+}
+
+func TestCheckLoadBalancerLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.MaximumLoadBalancerFrontendIPConfigurationCount = 2
+	az.MaximumLoadBalancerRuleCount = 4
+	service := getTestService("service", v1.ProtocolTCP, nil, false, 80, 443)
+
+	lb := buildLoadBalancerWithCounts("lb", 3, 4, 4)
+	// the guardrails are disabled by default
+	assert.NoError(t, az.checkLoadBalancerLimits(&service, &lb))
+
+	az.EnableLoadBalancerLimitGuardrails = true
+	assert.EqualError(t, az.checkLoadBalancerLimits(&service, &lb), "load balancer lb would have 3 frontend IP configurations (limit 2) after placing service default/service")
+
+	// the load balancers already above the limits can be updated without adding to them
+	az.updateLoadBalancerResourceCounts(buildLoadBalancerWithCounts("lb", 3, 2, 2))
+	assert.NoError(t, az.checkLoadBalancerLimits(&service, &lb))
+	lb = buildLoadBalancerWithCounts("lb", 3, 6, 6)
+	assert.EqualError(t, az.checkLoadBalancerLimits(&service, &lb), "load balancer lb would have 6 rules (limit 4) after placing service default/service")
+
+	// the probes are not limited unless configured
+	az.MaximumLoadBalancerProbeCount = 5
+	assert.EqualError(t, az.checkLoadBalancerLimits(&service, &lb), "load balancer lb would have 6 rules (limit 4), 6 probes (limit 5) after placing service default/service")
+
+	az.deleteLoadBalancerResourceCounts("lb")
+	assert.Equal(t, loadBalancerResourceCounts{}, az.getCachedLoadBalancerResourceCounts("lb"))
+}
+
+func TestFilterLoadBalancersWithinLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.MaximumLoadBalancerFrontendIPConfigurationCount = 10
+	az.MaximumLoadBalancerRuleCount = 10
+	service := getTestService("service", v1.ProtocolTCP, nil, false, 80, 443)
+	az.updateLoadBalancerResourceCounts(
+		buildLoadBalancerWithCounts("lb1", 5, 9, 9),
+		buildLoadBalancerWithCounts("lb2", 5, 8, 8),
+		buildLoadBalancerWithCounts("lb2-internal", 5, 9, 9),
+	)
+	eligibleLBs := []string{"lb1", "lb2", "lb3"}
+
+	// the auto-selection is disabled by default
+	az.EnableLoadBalancerLimitGuardrails = true
+	assert.Equal(t, eligibleLBs, az.filterLoadBalancersWithinLimits(&service, "", eligibleLBs, false))
+
+	az.EnableLoadBalancerAutoSelectionOnLimits = true
+	assert.Equal(t, []string{"lb2", "lb3"}, az.filterLoadBalancersWithinLimits(&service, "", eligibleLBs, false))
+	assert.Equal(t, []string{"lb1", "lb3"}, az.filterLoadBalancersWithinLimits(&service, "", eligibleLBs, true))
+
+	// the load balancer used by the service is kept
+	assert.Equal(t, []string{"lb1", "lb2", "lb3"}, az.filterLoadBalancersWithinLimits(&service, "lb1", eligibleLBs, false))
+
+	// all the load balancers are kept if they are all full
+	assert.Equal(t, []string{"lb1"}, az.filterLoadBalancersWithinLimits(&service, "", []string{"lb1"}, false))
+}
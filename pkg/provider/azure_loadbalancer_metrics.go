@@ -0,0 +1,223 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/metricclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+const (
+	loadBalancerMetricAllocatedSNATPorts   = "AllocatedSnatPorts"
+	loadBalancerMetricUsedSNATPorts        = "UsedSnatPorts"
+	loadBalancerMetricDataPathAvailability = "VipAvailability"
+	// loadBalancerMetricFrontendIPDimension is the dimension splitting the metrics by the frontend IPs.
+	loadBalancerMetricFrontendIPDimension = "FrontendIPAddress"
+	loadBalancerMetricAggregation         = "Average"
+	loadBalancerMetricInterval            = "PT1M"
+	// loadBalancerMetricTimespan is the timespan of the queried metrics, of which the latest values are exported.
+	loadBalancerMetricTimespan = 5 * time.Minute
+)
+
+// runLoadBalancerMetricsExportLoop periodically exports the Azure Monitor metrics of the load balancers of the
+// LoadBalancer services.
+func (az *Cloud) runLoadBalancerMetricsExportLoop(ctx context.Context, interval time.Duration) {
+	klog.V(2).Info("runLoadBalancerMetricsExportLoop: started")
+	err := wait.PollUntilContextCancel(ctx, interval, false, func(ctx context.Context) (bool, error) {
+		if err := az.exportLoadBalancerMetrics(ctx); err != nil {
+			klog.Warningf("runLoadBalancerMetricsExportLoop: failed to export the metrics of the load balancers: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runLoadBalancerMetricsExportLoop: stopped due to %s", err.Error())
+}
+
+// exportLoadBalancerMetrics queries Azure Monitor for the SNAT port usage and the data path availability of the
+// frontend IPs of the LoadBalancer services, and exports them by metrics labeled by the services. The metrics are kept
+// unchanged if the load balancers cannot be listed, and the metrics of the load balancers failed to be queried are
+// removed until the next successful query.
+func (az *Cloud) exportLoadBalancerMetrics(ctx context.Context) error {
+	if az.serviceLister == nil {
+		klog.V(4).Info("exportLoadBalancerMetrics: the service lister is not initialized, skip exporting")
+		return nil
+	}
+	services, err := az.serviceLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	// the services keyed by the frontend IPs of each load balancer keyed by its lower-cased ID
+	frontendServices := make(map[string]map[string]*v1.Service)
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil ||
+			!az.isServiceReconciledByLoadBalancerClass(service) {
+			continue
+		}
+		isInternal := requiresInternalLoadBalancer(service)
+		for i := range lbs {
+			if isInternalLoadBalancer(&lbs[i]) != isInternal {
+				continue
+			}
+			status, _, _, err := az.getServiceLoadBalancerStatus(service, &lbs[i])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get the load balancer status of service %s: %w", getServiceName(service), err))
+				break
+			}
+			if status == nil {
+				continue
+			}
+			lbID := strings.ToLower(pointer.StringDeref(lbs[i].ID, ""))
+			if frontendServices[lbID] == nil {
+				frontendServices[lbID] = make(map[string]*v1.Service)
+			}
+			for _, ingress := range status.Ingress {
+				if ingress.IP != "" {
+					frontendServices[lbID][ingress.IP] = service
+				}
+			}
+			break
+		}
+	}
+
+	end := time.Now().UTC()
+	timespan := fmt.Sprintf("%s/%s", end.Add(-loadBalancerMetricTimespan).Format(time.RFC3339), end.Format(time.RFC3339))
+	var records []metrics.ServiceLoadBalancerMetrics
+	for _, lb := range lbs {
+		lbFrontendServices := frontendServices[strings.ToLower(pointer.StringDeref(lb.ID, ""))]
+		if len(lbFrontendServices) == 0 {
+			continue
+		}
+		lbRecords, err := az.getServiceLoadBalancerMetrics(ctx, lb, lbFrontendServices, timespan)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		records = append(records, lbRecords...)
+	}
+	metrics.SetServiceLoadBalancerMetrics(records)
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// getServiceLoadBalancerMetrics queries the metrics of the load balancer split by the frontend IPs in the timespan,
+// and returns the latest values of the frontend IPs of the services.
+func (az *Cloud) getServiceLoadBalancerMetrics(ctx context.Context, lb network.LoadBalancer, frontendServices map[string]*v1.Service, timespan string) ([]metrics.ServiceLoadBalancerMetrics, error) {
+	lbName := pointer.StringDeref(lb.Name, "")
+	metricNames := strings.Join([]string{
+		loadBalancerMetricAllocatedSNATPorts,
+		loadBalancerMetricUsedSNATPorts,
+		loadBalancerMetricDataPathAvailability,
+	}, ",")
+	filter := fmt.Sprintf("%s eq '*'", loadBalancerMetricFrontendIPDimension)
+	response, rerr := az.MetricsClient.List(ctx, pointer.StringDeref(lb.ID, ""), timespan, loadBalancerMetricInterval, metricNames, loadBalancerMetricAggregation, filter)
+	if rerr != nil {
+		return nil, fmt.Errorf("failed to query the metrics of load balancer %s: %w", lbName, rerr.Error())
+	}
+	if response.Value == nil {
+		return nil, nil
+	}
+
+	recordsByIP := make(map[string]*metrics.ServiceLoadBalancerMetrics)
+	var records []*metrics.ServiceLoadBalancerMetrics
+	for _, metric := range *response.Value {
+		if metric.Name == nil || metric.Timeseries == nil {
+			continue
+		}
+		metricName := pointer.StringDeref(metric.Name.Value, "")
+		for _, timeseries := range *metric.Timeseries {
+			ip := getMetricDimensionValue(timeseries, loadBalancerMetricFrontendIPDimension)
+			service, found := frontendServices[ip]
+			if !found {
+				continue
+			}
+			value := getLatestMetricAverage(timeseries)
+			if value == nil {
+				continue
+			}
+			record, found := recordsByIP[ip]
+			if !found {
+				record = &metrics.ServiceLoadBalancerMetrics{
+					Namespace:    service.Namespace,
+					Name:         service.Name,
+					LoadBalancer: lbName,
+					FrontendIP:   ip,
+				}
+				recordsByIP[ip] = record
+				records = append(records, record)
+			}
+			switch {
+			case strings.EqualFold(metricName, loadBalancerMetricAllocatedSNATPorts):
+				record.AllocatedSNATPorts = value
+			case strings.EqualFold(metricName, loadBalancerMetricUsedSNATPorts):
+				record.UsedSNATPorts = value
+			case strings.EqualFold(metricName, loadBalancerMetricDataPathAvailability):
+				record.DataPathAvailability = value
+			}
+		}
+	}
+
+	result := make([]metrics.ServiceLoadBalancerMetrics, 0, len(records))
+	for _, record := range records {
+		result = append(result, *record)
+	}
+	return result, nil
+}
+
+// getMetricDimensionValue returns the value of the dimension of the time series, or empty if not found.
+func getMetricDimensionValue(timeseries metricclient.TimeSeriesElement, dimension string) string {
+	if timeseries.Metadatavalues == nil {
+		return ""
+	}
+	for _, metadata := range *timeseries.Metadatavalues {
+		if metadata.Name != nil && strings.EqualFold(pointer.StringDeref(metadata.Name.Value, ""), dimension) {
+			return pointer.StringDeref(metadata.Value, "")
+		}
+	}
+	return ""
+}
+
+// getLatestMetricAverage returns the latest average value of the time series, or nil if there is none, e.g., when
+// the metric has not been emitted in the timespan.
+func getLatestMetricAverage(timeseries metricclient.TimeSeriesElement) *float64 {
+	if timeseries.Data == nil {
+		return nil
+	}
+	for i := len(*timeseries.Data) - 1; i >= 0; i-- {
+		if average := (*timeseries.Data)[i].Average; average != nil {
+			return average
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/metricclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/metricclient/mockmetricclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getTestMetricTimeSeries(frontendIP string, averages ...*float64) metricclient.TimeSeriesElement {
+	data := make([]metricclient.MetricValue, 0, len(averages))
+	for _, average := range averages {
+		data = append(data, metricclient.MetricValue{Average: average})
+	}
+	return metricclient.TimeSeriesElement{
+		Metadatavalues: &[]metricclient.MetadataValue{
+			{
+				Name:  &metricclient.LocalizableString{Value: pointer.String("frontendipaddress")},
+				Value: pointer.String(frontendIP),
+			},
+		},
+		Data: &data,
+	}
+}
+
+func getTestMetric(name string, timeseries ...metricclient.TimeSeriesElement) metricclient.Metric {
+	return metricclient.Metric{
+		Name:       &metricclient.LocalizableString{Value: pointer.String(name)},
+		Timeseries: &timeseries,
+	}
+}
+
+func TestExportLoadBalancerMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	internalSvc := getInternalTestService("svc1", 80)
+	publicSvc := getTestService("svc2", v1.ProtocolTCP, nil, false, 80)
+	client := fake.NewSimpleClientset(&internalSvc, &publicSvc)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	az.serviceLister = informerFactory.Core().V1().Services().Lister()
+	for _, svc := range []*v1.Service{&internalSvc, &publicSvc} {
+		_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(svc)
+	}
+
+	internalLBID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/testCluster-internal"
+	publicLBID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/testCluster"
+	pipID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pip2"
+	lbs := []network.LoadBalancer{
+		{
+			ID:   pointer.String(internalLBID),
+			Name: pointer.String("testCluster-internal"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+					{
+						Name: pointer.String(az.getDefaultFrontendIPConfigName(&internalSvc)),
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							PrivateIPAddress: pointer.String("10.0.0.6"),
+						},
+					},
+				},
+			},
+		},
+		{
+			ID:   pointer.String(publicLBID),
+			Name: pointer.String("testCluster"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+					{
+						Name: pointer.String(az.getDefaultFrontendIPConfigName(&publicSvc)),
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							PublicIPAddress: &network.PublicIPAddress{ID: pointer.String(pipID)},
+						},
+					},
+				},
+			},
+		},
+		{
+			// without any frontend of the services
+			ID:   pointer.String("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/other"),
+			Name: pointer.String("other"),
+		},
+	}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(lbs, nil).Times(1)
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.PublicIPAddress{
+		{
+			Name: pointer.String("pip2"),
+			ID:   pointer.String(pipID),
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress: pointer.String("1.2.3.4"),
+			},
+		},
+	}, nil).AnyTimes()
+
+	mockMetricClient := az.MetricsClient.(*mockmetricclient.MockInterface)
+	mockMetricClient.EXPECT().List(gomock.Any(), internalLBID, gomock.Any(), "PT1M", "AllocatedSnatPorts,UsedSnatPorts,VipAvailability", "Average", "FrontendIPAddress eq '*'").
+		Return(metricclient.Response{}, &retry.Error{HTTPStatusCode: http.StatusForbidden}).Times(1)
+	mockMetricClient.EXPECT().List(gomock.Any(), publicLBID, gomock.Any(), "PT1M", "AllocatedSnatPorts,UsedSnatPorts,VipAvailability", "Average", "FrontendIPAddress eq '*'").
+		Return(metricclient.Response{
+			Value: &[]metricclient.Metric{
+				getTestMetric("AllocatedSnatPorts", getTestMetricTimeSeries("1.2.3.4", pointer.Float64(1024), pointer.Float64(1024))),
+				// the latest value is not emitted yet
+				getTestMetric("UsedSnatPorts", getTestMetricTimeSeries("1.2.3.4", pointer.Float64(128), pointer.Float64(256), nil)),
+				getTestMetric("VipAvailability",
+					getTestMetricTimeSeries("1.2.3.4", pointer.Float64(100)),
+					// not the frontend of any service
+					getTestMetricTimeSeries("5.6.7.8", pointer.Float64(100)),
+				),
+			},
+		}, nil).Times(2)
+
+	// the metrics of the internal load balancer failed to be queried
+	err := az.exportLoadBalancerMetrics(context.TODO())
+	assert.Error(t, err)
+
+	records, err := az.getServiceLoadBalancerMetrics(context.TODO(), lbs[1], map[string]*v1.Service{"1.2.3.4": &publicSvc}, "timespan")
+	assert.NoError(t, err)
+	assert.Equal(t, []metrics.ServiceLoadBalancerMetrics{
+		{
+			Namespace:            "default",
+			Name:                 "svc2",
+			LoadBalancer:         "testCluster",
+			FrontendIP:           "1.2.3.4",
+			AllocatedSNATPorts:   pointer.Float64(1024),
+			UsedSNATPorts:        pointer.Float64(256),
+			DataPathAvailability: pointer.Float64(100),
+		},
+	}, records)
+}
+
+func TestGetLatestMetricAverage(t *testing.T) {
+	assert.Nil(t, getLatestMetricAverage(metricclient.TimeSeriesElement{}))
+	assert.Nil(t, getLatestMetricAverage(getTestMetricTimeSeries("1.2.3.4", nil, nil)))
+	assert.Equal(t, pointer.Float64(2), getLatestMetricAverage(getTestMetricTimeSeries("1.2.3.4", pointer.Float64(1), pointer.Float64(2), nil)))
+	assert.Equal(t, "1.2.3.4", getMetricDimensionValue(getTestMetricTimeSeries("1.2.3.4"), "FrontendIPAddress"))
+	assert.Empty(t, getMetricDimensionValue(metricclient.TimeSeriesElement{}, "FrontendIPAddress"))
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// getServicePIPTagSelector returns the tags selecting the public IP pool of the service, or nil if
+// ServiceAnnotationPIPTagSelector is not set.
+func getServicePIPTagSelector(service *v1.Service) map[string]*string {
+	if service == nil || service.Annotations == nil {
+		return nil
+	}
+	selector := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationPIPTagSelector])
+	if selector == "" {
+		return nil
+	}
+	tags := parseTags(selector, nil)
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+// pipMatchesTagSelector returns true if the public IP has all the tags of the selector. The keys are
+// compared case-insensitively.
+func pipMatchesTagSelector(pip *network.PublicIPAddress, selector map[string]*string) bool {
+	if len(selector) == 0 || pip == nil || pip.Tags == nil {
+		return false
+	}
+	for key, value := range selector {
+		found, k := findKeyInMapCaseInsensitive(pip.Tags, key)
+		if !found || pointer.StringDeref(pip.Tags[k], "") != pointer.StringDeref(value, "") {
+			return false
+		}
+	}
+	return true
+}
+
+// isPublicIPInServicePool returns true if the public IP is in the pool selected by the service.
+func isPublicIPInServicePool(service *v1.Service, pip *network.PublicIPAddress) bool {
+	return pipMatchesTagSelector(pip, getServicePIPTagSelector(service))
+}
+
+// isPublicIPClaimedFromPool returns true if the public IP has been claimed from a pool.
+func isPublicIPClaimedFromPool(pip *network.PublicIPAddress) bool {
+	if pip == nil || pip.Tags == nil {
+		return false
+	}
+	found, key := findKeyInMapCaseInsensitive(pip.Tags, consts.ClaimedFromPoolTagKey)
+	return found && strings.EqualFold(pointer.StringDeref(pip.Tags[key], ""), consts.TrueAnnotationValue)
+}
+
+// selectPublicIPFromPool returns the name of the public IP in the pool selected by the service. The public IP
+// already tagged with the service is preferred, otherwise the first free one by name is selected. A public IP
+// is free if it is not tagged with any service and not associated with any IP configuration.
+func (az *Cloud) selectPublicIPFromPool(service *v1.Service, selector map[string]*string, isIPv6 bool) (string, error) {
+	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
+	pips, err := az.listPIP(pipResourceGroup, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(pips, func(i, j int) bool {
+		return pointer.StringDeref(pips[i].Name, "") < pointer.StringDeref(pips[j].Name, "")
+	})
+
+	serviceName := getServiceName(service)
+	var freePIPName string
+	for i := range pips {
+		pip := pips[i]
+		if pip.Name == nil || !pipMatchesTagSelector(&pip, selector) {
+			continue
+		}
+		if pip.PublicIPAddressPropertiesFormat != nil && (pip.PublicIPAddressVersion == network.IPv6) != isIPv6 {
+			continue
+		}
+		serviceTag := getServiceFromPIPServiceTags(pip.Tags)
+		if isSVCNameInPIPTag(serviceTag, serviceName) {
+			return *pip.Name, nil
+		}
+		if freePIPName == "" && serviceTag == "" &&
+			(pip.PublicIPAddressPropertiesFormat == nil || (pip.IPConfiguration == nil && pip.NatGateway == nil)) {
+			freePIPName = *pip.Name
+		}
+	}
+	if freePIPName == "" {
+		return "", fmt.Errorf("no free public IP matching the tag selector %q for service %s in resource group %s",
+			service.Annotations[consts.ServiceAnnotationPIPTagSelector], serviceName, pipResourceGroup)
+	}
+	klog.V(2).Infof("selectPublicIPFromPool for service(%s): selected the free public IP %s", serviceName, freePIPName)
+	return freePIPName, nil
+}
+
+// claimPublicIPFromPool marks the public IP of the pool in use by tagging it with the service and the cluster.
+func claimPublicIPFromPool(pip *network.PublicIPAddress, serviceName, clusterName string) (bool, error) {
+	changed, err := bindServicesToPIP(pip, []string{serviceName}, false)
+	if err != nil {
+		return false, err
+	}
+	if !isPublicIPClaimedFromPool(pip) {
+		pip.Tags[consts.ClaimedFromPoolTagKey] = pointer.String(consts.TrueAnnotationValue)
+		changed = true
+	}
+	if !strings.EqualFold(getClusterFromPIPClusterTags(pip.Tags), clusterName) {
+		pip.Tags[consts.ClusterNameKey] = pointer.String(clusterName)
+		changed = true
+	}
+	return changed, nil
+}
+
+// returnPublicIPToPool removes the cluster and claim tags from the public IP of the pool once it is not tagged
+// with any service, so that it can be selected by the services of other clusters.
+func returnPublicIPToPool(pip *network.PublicIPAddress) {
+	if pip.Tags == nil || getServiceFromPIPServiceTags(pip.Tags) != "" {
+		return
+	}
+	delete(pip.Tags, consts.ClusterNameKey)
+	delete(pip.Tags, consts.LegacyClusterNameKey)
+	if found, key := findKeyInMapCaseInsensitive(pip.Tags, consts.ClaimedFromPoolTagKey); found {
+		delete(pip.Tags, key)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func newPoolTestPIP(name, pool, serviceTag string) network.PublicIPAddress {
+	tags := map[string]*string{"pool": pointer.String(pool)}
+	if serviceTag != "" {
+		tags[consts.ServiceTagKey] = pointer.String(serviceTag)
+	}
+	return network.PublicIPAddress{
+		Name: pointer.String(name),
+		ID:   pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/" + name),
+		Tags: tags,
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			IPAddress:              pointer.String("1.2.3.4"),
+			PublicIPAddressVersion: network.IPv4,
+		},
+	}
+}
+
+func TestSelectPublicIPFromPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	inUse := newPoolTestPIP("pip-in-use", "web", "")
+	inUse.IPConfiguration = &network.IPConfiguration{ID: pointer.String("ipconfig")}
+
+	for _, tc := range []struct {
+		desc            string
+		pips            []network.PublicIPAddress
+		expectedPIPName string
+		expectedErr     bool
+	}{
+		{
+			desc:            "the public IP already claimed by the service should be selected",
+			pips:            []network.PublicIPAddress{newPoolTestPIP("pip-a", "web", ""), newPoolTestPIP("pip-b", "web", "default/test1")},
+			expectedPIPName: "pip-b",
+		},
+		{
+			desc:            "the first free public IP by name should be selected",
+			pips:            []network.PublicIPAddress{newPoolTestPIP("pip-c", "web", ""), newPoolTestPIP("pip-b", "web", ""), newPoolTestPIP("pip-a", "db", "")},
+			expectedPIPName: "pip-b",
+		},
+		{
+			desc:            "the public IPs used by other services or IP configurations should not be selected",
+			pips:            []network.PublicIPAddress{newPoolTestPIP("pip-a", "web", "default/other"), inUse, newPoolTestPIP("pip-z", "web", "")},
+			expectedPIPName: "pip-z",
+		},
+		{
+			desc:        "an error should be returned if there is no free public IP",
+			pips:        []network.PublicIPAddress{newPoolTestPIP("pip-a", "web", "default/other")},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+			mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return(tc.pips, nil).Times(1)
+
+			svc := getTestService("test1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationPIPTagSelector: "pool=web"}, false, 80)
+			pipName, shouldPIPExisted, err := az.determinePublicIPName(testClusterName, &svc, false)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.True(t, shouldPIPExisted)
+			assert.Equal(t, tc.expectedPIPName, pipName)
+		})
+	}
+}
+
+func TestClaimAndReturnPublicIPOfPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pip := newPoolTestPIP("pip-a", "web", "")
+	changed, err := claimPublicIPFromPool(&pip, "default/test1", testClusterName)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "default/test1", getServiceFromPIPServiceTags(pip.Tags))
+	assert.Equal(t, testClusterName, getClusterFromPIPClusterTags(pip.Tags))
+	assert.True(t, isPublicIPClaimedFromPool(&pip))
+
+	// The claimed public IP is returned to the pool even if the selector of the service is removed.
+	az := GetTestCloud(ctrl)
+	svc := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	_, pipsToBeDeleted, _, pipsToBeUpdated, err := az.getPublicIPUpdates(
+		testClusterName, &svc, []network.PublicIPAddress{pip}, false, false, "", "default/test1", serviceIPTagRequest{}, false, false)
+	assert.NoError(t, err)
+	assert.Empty(t, pipsToBeDeleted)
+	assert.Equal(t, 1, len(pipsToBeUpdated))
+	returned := pipsToBeUpdated[0]
+	assert.Equal(t, "", getServiceFromPIPServiceTags(returned.Tags))
+	assert.Equal(t, "", getClusterFromPIPClusterTags(returned.Tags))
+	assert.False(t, isPublicIPClaimedFromPool(returned))
+	assert.Equal(t, "web", pointer.StringDeref(returned.Tags["pool"], ""))
+}
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/Azure/go-autorest/autorest"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -41,12 +42,14 @@ import (
 func (az *Cloud) DeleteLB(service *v1.Service, lbName string) *retry.Error {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 
 	rgName := az.getLoadBalancerResourceGroup()
 	rerr := az.LoadBalancerClient.Delete(ctx, rgName, lbName)
 	if rerr == nil {
 		// Invalidate the cache right after updating
 		_ = az.lbCache.Delete(lbName)
+		az.deleteLoadBalancerResourceCounts(lbName)
 		return nil
 	}
 
@@ -59,6 +62,7 @@ func (az *Cloud) DeleteLB(service *v1.Service, lbName string) *retry.Error {
 func (az *Cloud) ListLB(service *v1.Service) ([]network.LoadBalancer, error) {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 
 	rgName := az.getLoadBalancerResourceGroup()
 	allLBs, rerr := az.LoadBalancerClient.List(ctx, rgName)
@@ -71,6 +75,7 @@ func (az *Cloud) ListLB(service *v1.Service) ([]network.LoadBalancer, error) {
 		return nil, rerr.Error()
 	}
 	klog.V(2).Infof("LoadBalancerClient.List(%v) success", rgName)
+	az.updateLoadBalancerResourceCounts(allLBs...)
 	return allLBs, nil
 }
 
@@ -132,8 +137,13 @@ func (az *Cloud) ListManagedLBs(service *v1.Service, nodes []*v1.Node, clusterNa
 
 // CreateOrUpdateLB invokes az.LoadBalancerClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateLB(service *v1.Service, lb network.LoadBalancer) error {
-	ctx, cancel := getContextWithCancel()
+	if err := az.degradedMode.checkWrites(); err != nil {
+		return err
+	}
+
+	ctx, cancel := getContextWithTimeout(az.LoadBalancerProvisioningTimeoutInSeconds)
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 
 	lb = cleanupSubnetInFrontendIPConfigurations(&lb)
 
@@ -143,6 +153,7 @@ func (az *Cloud) CreateOrUpdateLB(service *v1.Service, lb network.LoadBalancer)
 	if rerr == nil {
 		// Invalidate the cache right after updating
 		_ = az.lbCache.Delete(*lb.Name)
+		az.updateLoadBalancerResourceCounts(lb)
 		return nil
 	}
 
@@ -155,6 +166,14 @@ func (az *Cloud) CreateOrUpdateLB(service *v1.Service, lb network.LoadBalancer)
 		_ = az.lbCache.Delete(*lb.Name)
 	}
 
+	// Invalidate the cache because the operation is canceled after the provisioning timeout while the load balancer
+	// may still be updated, and the controller manager would retry the LB update in the next reconcile loop.
+	if isContextDeadlineExceeded(rerr) {
+		klog.V(3).Infof("LoadBalancer cache for %s is cleanup because CreateOrUpdate is not completed in %d seconds", pointer.StringDeref(lb.Name, ""), az.LoadBalancerProvisioningTimeoutInSeconds)
+		_ = az.lbCache.Delete(*lb.Name)
+		return fmt.Errorf("timed out creating or updating load balancer %s after %d seconds: %w", pointer.StringDeref(lb.Name, ""), az.LoadBalancerProvisioningTimeoutInSeconds, rerr.Error())
+	}
+
 	retryErrorMessage := rerr.Error().Error()
 	// Invalidate the cache because another new operation has canceled the current request.
 	if strings.Contains(strings.ToLower(retryErrorMessage), consts.OperationCanceledErrorMessage) {
@@ -191,6 +210,14 @@ func (az *Cloud) CreateOrUpdateLB(service *v1.Service, lb network.LoadBalancer)
 }
 
 func (az *Cloud) CreateOrUpdateLBBackendPool(lbName string, backendPool network.BackendAddressPool) error {
+	if rerr := az.createOrUpdateLBBackendPool(lbName, backendPool); rerr != nil {
+		return rerr.Error()
+	}
+	return nil
+}
+
+// createOrUpdateLBBackendPool updates the backend pool with its ETag and invalidates the cache of the load balancer if needed.
+func (az *Cloud) createOrUpdateLBBackendPool(lbName string, backendPool network.BackendAddressPool) *retry.Error {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -215,7 +242,38 @@ func (az *Cloud) CreateOrUpdateLBBackendPool(lbName string, backendPool network.
 		_ = az.lbCache.Delete(lbName)
 	}
 
-	return rerr.Error()
+	return rerr
+}
+
+// updateLBBackendPoolAddresses updates the backend pool whose addresses have been changed incrementally by applyChanges.
+// The network API has neither PATCH nor per-address operations for backend address pools, so the whole pool is sent
+// with its ETag. On ETag mismatch, instead of overwriting the addresses changed concurrently by others, applyChanges is
+// applied again to the latest backend pool, which is then updated if there is still anything to change.
+func (az *Cloud) updateLBBackendPoolAddresses(lbName string, backendPool network.BackendAddressPool, applyChanges func(*network.BackendAddressPool) bool) error {
+	backendPoolName := pointer.StringDeref(backendPool.Name, "")
+	for attempt := 1; ; attempt++ {
+		rerr := az.createOrUpdateLBBackendPool(lbName, backendPool)
+		if rerr == nil {
+			return nil
+		}
+		if rerr.HTTPStatusCode != http.StatusPreconditionFailed || attempt >= consts.BackendPoolUpdateMaxAttempts {
+			return rerr.Error()
+		}
+
+		klog.V(3).Infof("updateLBBackendPoolAddresses: backend pool %s of load balancer %s has been changed by others, applying the changes to the latest one", backendPoolName, lbName)
+		ctx, cancel := getContextWithCancel()
+		latest, rerr := az.LoadBalancerClient.GetLBBackendPool(ctx, az.getLoadBalancerResourceGroup(), lbName, backendPoolName, "")
+		cancel()
+		if rerr != nil {
+			return rerr.Error()
+		}
+		latest.Response = autorest.Response{}
+		if !applyChanges(&latest) {
+			klog.V(3).Infof("updateLBBackendPoolAddresses: the latest backend pool %s of load balancer %s is already up to date", backendPoolName, lbName)
+			return nil
+		}
+		backendPool = latest
+	}
 }
 
 func (az *Cloud) DeleteLBBackendPool(lbName, backendPoolName string) error {
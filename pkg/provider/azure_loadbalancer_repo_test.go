@@ -17,6 +17,7 @@ limitations under the License.
 package provider
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -183,6 +184,36 @@ func TestCreateOrUpdateLB(t *testing.T) {
 	}
 }
 
+func TestCreateOrUpdateLBTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerProvisioningTimeoutInSeconds = 600
+	az.lbCache.Set("lb", "test")
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, "lb", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName, loadBalancerName string, parameters network.LoadBalancer, etag string) *retry.Error {
+			_, hasDeadline := ctx.Deadline()
+			assert.True(t, hasDeadline)
+			return retry.GetError(nil, fmt.Errorf("context has been cancelled: %w", context.DeadlineExceeded))
+		})
+	mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "lb", gomock.Any()).Return(network.LoadBalancer{}, nil)
+
+	err := az.CreateOrUpdateLB(&v1.Service{}, network.LoadBalancer{
+		Name: pointer.String("lb"),
+		Etag: pointer.String("etag"),
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "timed out creating or updating load balancer lb after 600 seconds")
+
+	// loadbalancer should be removed from cache since it may still be updated
+	shouldBeEmpty, err := az.lbCache.GetWithDeepCopy("lb", cache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Empty(t, shouldBeEmpty)
+}
+
 func TestCreateOrUpdateLBBackendPool(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -407,3 +438,102 @@ func TestIsBackendPoolOnSameLB(t *testing.T) {
 		assert.Equal(t, test.expectedLBName, lbName)
 	}
 }
+
+func TestUpdateLBBackendPoolAddresses(t *testing.T) {
+	newBackendPool := func(etag string, ips ...string) network.BackendAddressPool {
+		addresses := make([]network.LoadBalancerBackendAddress, 0, len(ips))
+		for _, ip := range ips {
+			addresses = append(addresses, network.LoadBalancerBackendAddress{
+				LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String(ip)},
+			})
+		}
+		return network.BackendAddressPool{
+			Name: pointer.String("pool"),
+			Etag: pointer.String(etag),
+			BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+				LoadBalancerBackendAddresses: &addresses,
+			},
+		}
+	}
+	preconditionFailed := &retry.Error{HTTPStatusCode: http.StatusPreconditionFailed}
+
+	for _, tc := range []struct {
+		desc           string
+		latest         network.BackendAddressPool
+		putErrs        []*retry.Error
+		expectedPuts   []network.BackendAddressPool
+		expectedGetCnt int
+		expectedErr    bool
+	}{
+		{
+			desc:         "should update the backend pool",
+			putErrs:      []*retry.Error{nil},
+			expectedPuts: []network.BackendAddressPool{newBackendPool("1", "10.0.0.1", "10.0.0.2")},
+		},
+		{
+			desc:           "should apply the changes to the latest backend pool on ETag mismatch",
+			latest:         newBackendPool("2", "10.0.0.1", "10.0.0.3"),
+			putErrs:        []*retry.Error{preconditionFailed, nil},
+			expectedPuts:   []network.BackendAddressPool{newBackendPool("1", "10.0.0.1", "10.0.0.2"), newBackendPool("2", "10.0.0.1", "10.0.0.3", "10.0.0.2")},
+			expectedGetCnt: 1,
+		},
+		{
+			desc:           "should not update the latest backend pool if it is up to date",
+			latest:         newBackendPool("2", "10.0.0.1", "10.0.0.2"),
+			putErrs:        []*retry.Error{preconditionFailed},
+			expectedPuts:   []network.BackendAddressPool{newBackendPool("1", "10.0.0.1", "10.0.0.2")},
+			expectedGetCnt: 1,
+		},
+		{
+			desc:           "should give up after the maximum attempts",
+			latest:         newBackendPool("2", "10.0.0.1"),
+			putErrs:        []*retry.Error{preconditionFailed, preconditionFailed, preconditionFailed},
+			expectedPuts:   []network.BackendAddressPool{newBackendPool("1", "10.0.0.1", "10.0.0.2"), newBackendPool("2", "10.0.0.1", "10.0.0.2"), newBackendPool("2", "10.0.0.1", "10.0.0.2")},
+			expectedGetCnt: 2,
+			expectedErr:    true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			lbClient := mockloadbalancerclient.NewMockInterface(ctrl)
+			var puts []network.BackendAddressPool
+			lbClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), az.ResourceGroup, "lb", "pool", gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, _, _, _ string, bp network.BackendAddressPool, etag string) *retry.Error {
+					assert.Equal(t, pointer.StringDeref(bp.Etag, ""), etag)
+					puts = append(puts, bp)
+					return tc.putErrs[len(puts)-1]
+				}).Times(len(tc.putErrs))
+			lbClient.EXPECT().GetLBBackendPool(gomock.Any(), az.ResourceGroup, "lb", "pool", "").DoAndReturn(
+				func(_ context.Context, _, _, _, _ string) (network.BackendAddressPool, *retry.Error) {
+					latest := newBackendPool(pointer.StringDeref(tc.latest.Etag, ""))
+					*latest.LoadBalancerBackendAddresses = append(*latest.LoadBalancerBackendAddresses, *tc.latest.LoadBalancerBackendAddresses...)
+					return latest, nil
+				}).Times(tc.expectedGetCnt)
+			az.LoadBalancerClient = lbClient
+
+			backendPool := newBackendPool("1", "10.0.0.1")
+			addIP := func(bp *network.BackendAddressPool) bool {
+				return az.addNodeIPAddressesToBackendPool(bp, []string{"10.0.0.2"})
+			}
+			assert.True(t, addIP(&backendPool))
+			err := az.updateLBBackendPoolAddresses("lb", backendPool, addIP)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, len(tc.expectedPuts), len(puts))
+			for i := range puts {
+				assert.Equal(t, tc.expectedPuts[i].Etag, puts[i].Etag)
+				var ips []string
+				for _, address := range *puts[i].LoadBalancerBackendAddresses {
+					ips = append(ips, pointer.StringDeref(address.IPAddress, ""))
+				}
+				var expectedIPs []string
+				for _, address := range *tc.expectedPuts[i].LoadBalancerBackendAddresses {
+					expectedIPs = append(expectedIPs, pointer.StringDeref(address.IPAddress, ""))
+				}
+				assert.Equal(t, expectedIPs, ips)
+			}
+		})
+	}
+}
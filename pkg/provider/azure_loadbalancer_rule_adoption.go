@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// adoptLoadBalancerRules removes the load balancing rules created out-of-band on the frontend IP configuration and
+// ports of the service, and the health probes only referenced by them, if the service is annotated with
+// ServiceAnnotationLoadBalancerAdoptExistingRules. The rules and probes of the service are created in the same
+// update of the load balancer, so that the traffic is taken over without conflicts or duplicate rules.
+// It returns true if any rule is adopted.
+func (az *Cloud) adoptLoadBalancerRules(lb *network.LoadBalancer, frontendIPConfigID string, service *v1.Service) bool {
+	if !consts.IsLBRuleAdoptionEnabled(service.Annotations) || lb.LoadBalancerPropertiesFormat == nil || lb.LoadBalancingRules == nil {
+		return false
+	}
+	services := []*v1.Service{service}
+	if az.serviceLister != nil {
+		existingServices, err := az.serviceLister.List(labels.Everything())
+		if err != nil {
+			klog.Warningf("adoptLoadBalancerRules: failed to list services, skip adopting the rules of service %s: %v", getServiceName(service), err)
+			return false
+		}
+		services = append(services, existingServices...)
+	}
+	ownedByServices := func(name string) bool {
+		for _, svc := range services {
+			if az.serviceOwnsRule(svc, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	frontendPorts, err := getServiceFrontendPorts(service)
+	if err != nil {
+		klog.Warningf("adoptLoadBalancerRules: skip adopting the rules of service %s: %v", getServiceName(service), err)
+		return false
+	}
+	isHAMode := consts.IsK8sServiceHasHAModeEnabled(service)
+	adoptedProbeIDs := sets.New[string]()
+	var rules []network.LoadBalancingRule
+	var adoptedRules []string
+	for _, rule := range *lb.LoadBalancingRules {
+		ruleName := pointer.StringDeref(rule.Name, "")
+		if !lbRuleMatchesServicePorts(rule, frontendIPConfigID, frontendPorts, isHAMode) || ownedByServices(ruleName) {
+			rules = append(rules, rule)
+			continue
+		}
+		adoptedRules = append(adoptedRules, ruleName)
+		if rule.Probe != nil && rule.Probe.ID != nil {
+			adoptedProbeIDs.Insert(strings.ToLower(*rule.Probe.ID))
+		}
+	}
+	if len(adoptedRules) == 0 {
+		return false
+	}
+	klog.V(2).Infof("adoptLoadBalancerRules: service %s adopts the load balancing rules %v of load balancer %s", getServiceName(service), adoptedRules, pointer.StringDeref(lb.Name, ""))
+	lb.LoadBalancingRules = &rules
+
+	// The probes still referenced by the remaining rules are kept.
+	for _, rule := range rules {
+		if rule.LoadBalancingRulePropertiesFormat != nil && rule.Probe != nil && rule.Probe.ID != nil {
+			adoptedProbeIDs.Delete(strings.ToLower(*rule.Probe.ID))
+		}
+	}
+	if lb.Probes != nil && adoptedProbeIDs.Len() > 0 {
+		var probes []network.Probe
+		for _, probe := range *lb.Probes {
+			if adoptedProbeIDs.Has(strings.ToLower(pointer.StringDeref(probe.ID, ""))) && !ownedByServices(pointer.StringDeref(probe.Name, "")) {
+				klog.V(2).Infof("adoptLoadBalancerRules: service %s adopts the health probe %s of load balancer %s", getServiceName(service), pointer.StringDeref(probe.Name, ""), pointer.StringDeref(lb.Name, ""))
+				continue
+			}
+			probes = append(probes, probe)
+		}
+		lb.Probes = &probes
+	}
+	return true
+}
+
+// lbRuleMatchesServicePorts returns true if the load balancing rule is on the frontend IP configuration and serves
+// any port of the service, including the rules with protocol All and the HA ports rules in HA mode.
+func lbRuleMatchesServicePorts(rule network.LoadBalancingRule, frontendIPConfigID string, ports []v1.ServicePort, isHAMode bool) bool {
+	if rule.LoadBalancingRulePropertiesFormat == nil || rule.FrontendIPConfiguration == nil ||
+		!strings.EqualFold(pointer.StringDeref(rule.FrontendIPConfiguration.ID, ""), frontendIPConfigID) {
+		return false
+	}
+	if isHAMode && rule.Protocol == network.TransportProtocolAll && pointer.Int32Deref(rule.FrontendPort, -1) == 0 {
+		return true
+	}
+	for _, port := range ports {
+		if (rule.Protocol == network.TransportProtocolAll || strings.EqualFold(string(rule.Protocol), string(port.Protocol))) &&
+			pointer.Int32Deref(rule.FrontendPort, -1) == port.Port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestAdoptLoadBalancerRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const frontendIPConfigID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/frontendIPConfigurations/fe"
+	probeID := func(name string) string {
+		return "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/probes/" + name
+	}
+	newRule := func(name string, protocol network.TransportProtocol, port int32, probeName string) network.LoadBalancingRule {
+		return network.LoadBalancingRule{
+			Name: pointer.String(name),
+			LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+				FrontendIPConfiguration: &network.SubResource{ID: pointer.String(frontendIPConfigID)},
+				Protocol:                protocol,
+				FrontendPort:            pointer.Int32(port),
+				Probe:                   &network.SubResource{ID: pointer.String(probeID(probeName))},
+			},
+		}
+	}
+	newProbe := func(name string) network.Probe {
+		return network.Probe{Name: pointer.String(name), ID: pointer.String(probeID(name))}
+	}
+
+	for _, tc := range []struct {
+		desc               string
+		annotations        map[string]string
+		expectedAdopted    bool
+		expectedRuleNames  []string
+		expectedProbeNames []string
+	}{
+		{
+			desc:               "the manual rules on the ports of the service and their probes should be adopted",
+			annotations:        map[string]string{consts.ServiceAnnotationLoadBalancerAdoptExistingRules: "true"},
+			expectedAdopted:    true,
+			expectedRuleNames:  []string{"manual-8080", "aexisting-TCP-443"},
+			expectedProbeNames: []string{"manual-shared-probe", "aexisting-TCP-443"},
+		},
+		{
+			desc:               "no rule should be adopted without the annotation",
+			expectedRuleNames:  []string{"manual-http", "manual-all-53", "manual-8080", "aexisting-TCP-443"},
+			expectedProbeNames: []string{"manual-http-probe", "manual-shared-probe", "aexisting-TCP-443"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			svc := getTestService("test1", v1.ProtocolTCP, tc.annotations, false, 80, 53, 443)
+			existingSvc := getTestService("existing", v1.ProtocolTCP, nil, false, 443)
+			existingSvc.UID = types.UID("existing")
+			client := fake.NewSimpleClientset(&existingSvc)
+			informerFactory := informers.NewSharedInformerFactory(client, 0)
+			az.serviceLister = informerFactory.Core().V1().Services().Lister()
+			_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&existingSvc)
+
+			lb := &network.LoadBalancer{
+				Name: pointer.String("lb"),
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					LoadBalancingRules: &[]network.LoadBalancingRule{
+						newRule("manual-http", network.TransportProtocolTCP, 80, "manual-http-probe"),
+						newRule("manual-all-53", network.TransportProtocolAll, 53, "manual-shared-probe"),
+						newRule("manual-8080", network.TransportProtocolTCP, 8080, "manual-shared-probe"),
+						newRule("aexisting-TCP-443", network.TransportProtocolTCP, 443, "aexisting-TCP-443"),
+					},
+					Probes: &[]network.Probe{newProbe("manual-http-probe"), newProbe("manual-shared-probe"), newProbe("aexisting-TCP-443")},
+				},
+			}
+
+			assert.Equal(t, tc.expectedAdopted, az.adoptLoadBalancerRules(lb, frontendIPConfigID, &svc))
+			var ruleNames, probeNames []string
+			for _, rule := range *lb.LoadBalancingRules {
+				ruleNames = append(ruleNames, pointer.StringDeref(rule.Name, ""))
+			}
+			for _, probe := range *lb.Probes {
+				probeNames = append(probeNames, pointer.StringDeref(probe.Name, ""))
+			}
+			assert.Equal(t, tc.expectedRuleNames, ruleNames)
+			assert.Equal(t, tc.expectedProbeNames, probeNames)
+		})
+	}
+}
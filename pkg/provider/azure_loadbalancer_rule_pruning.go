@@ -0,0 +1,196 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// pruneLoadBalancerRulesByOwnership removes the load balancing rules of the service which are not expected any more
+// but are not recognized by their names, e.g., the rules of the ports removed from the service which were named by
+// an earlier version of the provider. The rules are owned by the service if they use a frontend IP configuration
+// created for the service and a backend pool managed by the provider, or a frontend IP configuration being deleted.
+// The rules named after other services or after their frontend IP configurations are kept, and so are the rules
+// named after the service, which are reconciled by reconcileLBRules. The health probes only referenced by the removed rules
+// are removed as well. Since the rules without the ownership marker may have been created out-of-band, they are only
+// pruned if the service adopts the existing rules by ServiceAnnotationLoadBalancerAdoptExistingRules.
+// It returns true if any rule is removed.
+func (az *Cloud) pruneLoadBalancerRulesByOwnership(
+	lb *network.LoadBalancer,
+	service *v1.Service,
+	clusterName string,
+	ownedFIPConfigs []*network.FrontendIPConfiguration,
+	toDeleteFIPConfigs []network.FrontendIPConfiguration,
+	lbBackendPoolIDs map[bool]string,
+	expectedRules []network.LoadBalancingRule,
+) bool {
+	if !consts.IsLBRuleAdoptionEnabled(service.Annotations) || lb.LoadBalancerPropertiesFormat == nil || lb.LoadBalancingRules == nil {
+		return false
+	}
+	lbName := pointer.StringDeref(lb.Name, "")
+
+	primaryFrontendIDs := sets.New[string]()
+	primaryFrontendNames := sets.New[string]()
+	for _, fip := range ownedFIPConfigs {
+		if fip == nil {
+			continue
+		}
+		if _, isPrimaryService, _ := az.serviceOwnsFrontendIP(*fip, service); isPrimaryService {
+			primaryFrontendIDs.Insert(strings.ToLower(pointer.StringDeref(fip.ID, "")))
+			primaryFrontendNames.Insert(strings.ToLower(pointer.StringDeref(fip.Name, "")))
+		}
+	}
+	// The rules are named after the primary frontend IP configurations of their services, so the rules named after
+	// the other frontend IP configurations are owned by other services even if they are not listed yet.
+	var otherFrontendNames []string
+	if lb.FrontendIPConfigurations != nil {
+		for _, fip := range *lb.FrontendIPConfigurations {
+			name := strings.ToLower(pointer.StringDeref(fip.Name, ""))
+			if name != "" && !primaryFrontendNames.Has(name) {
+				otherFrontendNames = append(otherFrontendNames, name)
+			}
+		}
+	}
+	deletingFrontendIDs := sets.New[string]()
+	for _, fip := range toDeleteFIPConfigs {
+		if fip.ID != nil {
+			deletingFrontendIDs.Insert(strings.ToLower(*fip.ID))
+		}
+	}
+	if primaryFrontendIDs.Len() == 0 && deletingFrontendIDs.Len() == 0 {
+		return false
+	}
+
+	managedBackendPoolIDs := sets.New[string]()
+	for _, id := range lbBackendPoolIDs {
+		managedBackendPoolIDs.Insert(strings.ToLower(id))
+	}
+	for _, id := range az.getBackendPoolIDs(clusterName, lbName) {
+		managedBackendPoolIDs.Insert(strings.ToLower(id))
+	}
+
+	expectedRuleNames := sets.New[string]()
+	for _, rule := range expectedRules {
+		expectedRuleNames.Insert(strings.ToLower(pointer.StringDeref(rule.Name, "")))
+	}
+
+	var otherServices []*v1.Service
+	if az.serviceLister != nil {
+		services, err := az.serviceLister.List(labels.Everything())
+		if err != nil {
+			klog.Warningf("pruneLoadBalancerRulesByOwnership: failed to list services, skip pruning the rules of service %s: %v", getServiceName(service), err)
+			return false
+		}
+		for _, svc := range services {
+			if svc.UID != service.UID {
+				otherServices = append(otherServices, svc)
+			}
+		}
+	}
+	ownedByOtherServices := func(name string) bool {
+		for _, frontendName := range otherFrontendNames {
+			if isNameOwnedByPrefix(name, frontendName) {
+				return true
+			}
+		}
+		for _, svc := range otherServices {
+			if az.serviceOwnsRule(svc, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var rules []network.LoadBalancingRule
+	var prunedRules []string
+	prunedProbeIDs := sets.New[string]()
+	for _, rule := range *lb.LoadBalancingRules {
+		ruleName := pointer.StringDeref(rule.Name, "")
+		if !isLoadBalancerRuleOwnedByFrontends(rule, primaryFrontendIDs, deletingFrontendIDs, managedBackendPoolIDs) ||
+			expectedRuleNames.Has(strings.ToLower(ruleName)) || az.serviceOwnsRule(service, ruleName) || ownedByOtherServices(ruleName) {
+			rules = append(rules, rule)
+			continue
+		}
+		prunedRules = append(prunedRules, ruleName)
+		if rule.Probe != nil && rule.Probe.ID != nil {
+			prunedProbeIDs.Insert(strings.ToLower(*rule.Probe.ID))
+		}
+	}
+	if len(prunedRules) == 0 {
+		return false
+	}
+	klog.V(2).Infof("pruneLoadBalancerRulesByOwnership: removing the load balancing rules %v of service %s from load balancer %s", prunedRules, getServiceName(service), lbName)
+	az.Event(service, v1.EventTypeNormal, "LoadBalancerRulesPruned", fmt.Sprintf(
+		"Removing the load balancing rules %s no longer expected on load balancer %s", strings.Join(prunedRules, ", "), lbName))
+	lb.LoadBalancingRules = &rules
+
+	// The probes still referenced by the remaining rules are kept.
+	for _, rule := range rules {
+		if rule.LoadBalancingRulePropertiesFormat != nil && rule.Probe != nil && rule.Probe.ID != nil {
+			prunedProbeIDs.Delete(strings.ToLower(*rule.Probe.ID))
+		}
+	}
+	if lb.Probes != nil && prunedProbeIDs.Len() > 0 {
+		var probes []network.Probe
+		for _, probe := range *lb.Probes {
+			if prunedProbeIDs.Has(strings.ToLower(pointer.StringDeref(probe.ID, ""))) && !ownedByOtherServices(pointer.StringDeref(probe.Name, "")) {
+				klog.V(2).Infof("pruneLoadBalancerRulesByOwnership: removing the health probe %s of service %s from load balancer %s", pointer.StringDeref(probe.Name, ""), getServiceName(service), lbName)
+				continue
+			}
+			probes = append(probes, probe)
+		}
+		lb.Probes = &probes
+	}
+	return true
+}
+
+// isLoadBalancerRuleOwnedByFrontends returns true if the rule uses one of the frontend IP configurations being
+// deleted, or one of the primary frontend IP configurations together with a managed backend pool.
+func isLoadBalancerRuleOwnedByFrontends(rule network.LoadBalancingRule, primaryFrontendIDs, deletingFrontendIDs, managedBackendPoolIDs sets.Set[string]) bool {
+	if rule.LoadBalancingRulePropertiesFormat == nil || rule.FrontendIPConfiguration == nil {
+		return false
+	}
+	frontendID := strings.ToLower(pointer.StringDeref(rule.FrontendIPConfiguration.ID, ""))
+	if deletingFrontendIDs.Has(frontendID) {
+		return true
+	}
+	if !primaryFrontendIDs.Has(frontendID) {
+		return false
+	}
+	if rule.BackendAddressPool != nil && managedBackendPoolIDs.Has(strings.ToLower(pointer.StringDeref(rule.BackendAddressPool.ID, ""))) {
+		return true
+	}
+	if rule.BackendAddressPools != nil {
+		for _, pool := range *rule.BackendAddressPools {
+			if managedBackendPoolIDs.Has(strings.ToLower(pointer.StringDeref(pool.ID, ""))) {
+				return true
+			}
+		}
+	}
+	return false
+}
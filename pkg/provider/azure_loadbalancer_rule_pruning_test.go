@@ -0,0 +1,197 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestPruneLoadBalancerRulesByOwnership(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const lbName = "testCluster"
+	newRule := func(az *Cloud, name, fipName, poolName, probeName string) network.LoadBalancingRule {
+		rule := network.LoadBalancingRule{
+			Name: pointer.String(name),
+			LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+				FrontendIPConfiguration: &network.SubResource{ID: pointer.String(az.getFrontendIPConfigID(lbName, fipName))},
+				BackendAddressPool:      &network.SubResource{ID: pointer.String(az.getBackendPoolID(lbName, poolName))},
+			},
+		}
+		if probeName != "" {
+			rule.Probe = &network.SubResource{ID: pointer.String(az.getLoadBalancerProbeID(lbName, probeName))}
+		}
+		return rule
+	}
+	newProbe := func(az *Cloud, name string) network.Probe {
+		return network.Probe{Name: pointer.String(name), ID: pointer.String(az.getLoadBalancerProbeID(lbName, name))}
+	}
+	newFrontend := func(az *Cloud, name string) network.FrontendIPConfiguration {
+		return network.FrontendIPConfiguration{Name: pointer.String(name), ID: pointer.String(az.getFrontendIPConfigID(lbName, name))}
+	}
+
+	for _, tc := range []struct {
+		desc            string
+		otherServices   []string
+		rules           func(az *Cloud) []network.LoadBalancingRule
+		deleting        bool
+		notAdopting     bool
+		expectedChanged bool
+		expectedRules   []string
+		expectedProbes  []string
+	}{
+		{
+			desc: "should prune the unexpected rules and their probes on the primary frontend with a managed backend pool",
+			rules: func(az *Cloud) []network.LoadBalancingRule {
+				return []network.LoadBalancingRule{
+					newRule(az, "aservice1-TCP-80", "aservice1", lbName, "aservice1-TCP-80"),
+					newRule(az, "legacy-TCP-8080", "aservice1", lbName, "legacy-TCP-8080"),
+					newRule(az, "shared-probe-TCP-8081", "aservice1", lbName, "shared"),
+					newRule(az, "custom-TCP-8082", "aservice2", lbName, "shared"),
+				}
+			},
+			expectedChanged: true,
+			expectedRules:   []string{"aservice1-TCP-80", "custom-TCP-8082"},
+			expectedProbes:  []string{"aservice1-TCP-80", "shared", "aservice2-TCP-80"},
+		},
+		{
+			desc: "should keep the rules without the ownership marker if the service does not adopt the existing rules",
+			rules: func(az *Cloud) []network.LoadBalancingRule {
+				return []network.LoadBalancingRule{
+					newRule(az, "aservice1-TCP-80", "aservice1", lbName, "aservice1-TCP-80"),
+					newRule(az, "legacy-TCP-8080", "aservice1", lbName, "legacy-TCP-8080"),
+					newRule(az, "legacy-TCP-8081", "aservice1-deleting", "custom", "shared"),
+				}
+			},
+			deleting:       true,
+			notAdopting:    true,
+			expectedRules:  []string{"aservice1-TCP-80", "legacy-TCP-8080", "legacy-TCP-8081"},
+			expectedProbes: []string{"aservice1-TCP-80", "legacy-TCP-8080", "shared", "aservice2-TCP-80"},
+		},
+		{
+			desc: "should keep the rules with backend pools not managed by the provider",
+			rules: func(az *Cloud) []network.LoadBalancingRule {
+				return []network.LoadBalancingRule{
+					newRule(az, "aservice1-TCP-80", "aservice1", lbName, "aservice1-TCP-80"),
+					newRule(az, "custom-TCP-8080", "aservice1", "custom", "legacy-TCP-8080"),
+				}
+			},
+			expectedRules:  []string{"aservice1-TCP-80", "custom-TCP-8080"},
+			expectedProbes: []string{"aservice1-TCP-80", "legacy-TCP-8080", "shared", "aservice2-TCP-80"},
+		},
+		{
+			desc: "should keep the rules named after other frontends or other services",
+			rules: func(az *Cloud) []network.LoadBalancingRule {
+				return []network.LoadBalancingRule{
+					newRule(az, "aservice1-TCP-80", "aservice1", lbName, "aservice1-TCP-80"),
+					newRule(az, "aservice2-TCP-80", "aservice1", lbName, "aservice2-TCP-80"),
+					newRule(az, "aservice3-TCP-80", "aservice1", lbName, ""),
+				}
+			},
+			otherServices:  []string{"service3"},
+			expectedRules:  []string{"aservice1-TCP-80", "aservice2-TCP-80", "aservice3-TCP-80"},
+			expectedProbes: []string{"aservice1-TCP-80", "legacy-TCP-8080", "shared", "aservice2-TCP-80"},
+		},
+		{
+			desc: "should prune the rules on the frontends being deleted regardless of the backend pools",
+			rules: func(az *Cloud) []network.LoadBalancingRule {
+				return []network.LoadBalancingRule{
+					newRule(az, "aservice1-TCP-80", "aservice1", lbName, "aservice1-TCP-80"),
+					newRule(az, "legacy-TCP-8080", "aservice1-deleting", "custom", "legacy-TCP-8080"),
+				}
+			},
+			deleting:        true,
+			expectedChanged: true,
+			expectedRules:   []string{"aservice1-TCP-80"},
+			expectedProbes:  []string{"aservice1-TCP-80", "shared", "aservice2-TCP-80"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			recorder := record.NewFakeRecorder(10)
+			az.eventRecorder = recorder
+
+			svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+			if !tc.notAdopting {
+				svc.Annotations = map[string]string{consts.ServiceAnnotationLoadBalancerAdoptExistingRules: consts.TrueAnnotationValue}
+			}
+			client := fake.NewSimpleClientset()
+			informerFactory := informers.NewSharedInformerFactory(client, 0)
+			az.serviceLister = informerFactory.Core().V1().Services().Lister()
+			_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+			for _, name := range tc.otherServices {
+				other := getTestService(name, v1.ProtocolTCP, nil, false, 80)
+				_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&other)
+			}
+
+			primaryFrontend := newFrontend(az, "aservice1")
+			frontends := []network.FrontendIPConfiguration{primaryFrontend, newFrontend(az, "aservice2")}
+			var toDeleteFrontends []network.FrontendIPConfiguration
+			if tc.deleting {
+				toDeleteFrontends = append(toDeleteFrontends, newFrontend(az, "aservice1-deleting"))
+			}
+			rules := tc.rules(az)
+			lb := network.LoadBalancer{
+				Name: pointer.String(lbName),
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					FrontendIPConfigurations: &frontends,
+					LoadBalancingRules:       &rules,
+					Probes: &[]network.Probe{
+						newProbe(az, "aservice1-TCP-80"),
+						newProbe(az, "legacy-TCP-8080"),
+						newProbe(az, "shared"),
+						newProbe(az, "aservice2-TCP-80"),
+					},
+				},
+			}
+			expectedRules := []network.LoadBalancingRule{{Name: pointer.String("aservice1-TCP-80")}}
+
+			changed := az.pruneLoadBalancerRulesByOwnership(&lb, &svc, testClusterName,
+				[]*network.FrontendIPConfiguration{&primaryFrontend}, toDeleteFrontends,
+				az.getBackendPoolIDs(testClusterName, lbName), expectedRules)
+			assert.Equal(t, tc.expectedChanged, changed)
+
+			var ruleNames, probeNames []string
+			for _, rule := range *lb.LoadBalancingRules {
+				ruleNames = append(ruleNames, *rule.Name)
+			}
+			for _, probe := range *lb.Probes {
+				probeNames = append(probeNames, *probe.Name)
+			}
+			assert.Equal(t, tc.expectedRules, ruleNames)
+			assert.Equal(t, tc.expectedProbes, probeNames)
+			if tc.expectedChanged {
+				assert.Contains(t, <-recorder.Events, "LoadBalancerRulesPruned")
+			} else {
+				assert.Empty(t, recorder.Events)
+			}
+		})
+	}
+}
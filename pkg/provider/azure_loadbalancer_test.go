@@ -282,6 +282,21 @@ func TestGetLoadBalancer(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "GetLoadBalancer should return the IPs of both LBs for the internal and external service",
+			service: getTestService("service", v1.ProtocolTCP, map[string]string{
+				consts.ServiceAnnotationLoadBalancerInternalAndExternal: consts.TrueAnnotationValue,
+			}, false, 80),
+			existingLBs:   []network.LoadBalancer{lb2, lb3},
+			pipExists:     true,
+			expectedGotLB: true,
+			expectedStatus: &v1.LoadBalancerStatus{
+				Ingress: []v1.LoadBalancerIngress{
+					{IP: "1.2.3.4"},
+					{IP: "10.0.0.6"},
+				},
+			},
+		},
 	}
 
 	for _, c := range tests {
@@ -600,6 +615,40 @@ func TestFindRule(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			msg: "rule names match while LoadDistributions don't should return false",
+			existingRule: []network.LoadBalancingRule{
+				{
+					Name: pointer.String("matchName"),
+					LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+						LoadDistribution: network.LoadDistributionSourceIP,
+					},
+				},
+			},
+			curRule: network.LoadBalancingRule{
+				Name: pointer.String("matchName"),
+				LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+					LoadDistribution: network.LoadDistributionSourceIPProtocol,
+				},
+			},
+			expected: false,
+		},
+		{
+			msg: "empty LoadDistribution should match Default",
+			existingRule: []network.LoadBalancingRule{
+				{
+					Name:                              pointer.String("matchName"),
+					LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{},
+				},
+			},
+			curRule: network.LoadBalancingRule{
+				Name: pointer.String("matchName"),
+				LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+					LoadDistribution: network.LoadDistributionDefault,
+				},
+			},
+			expected: true,
+		},
 	}
 
 	for _, test := range tests {
@@ -610,6 +659,137 @@ func TestFindRule(t *testing.T) {
 	}
 }
 
+func TestGetExpectedLBRulesWithCombinedProtocols(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc              string
+		annotations       map[string]string
+		loadBalancerSku   string
+		udpNodePort       int32
+		expectedRuleNames []string
+	}{
+		{
+			desc:              "ports should not be combined without the annotation",
+			loadBalancerSku:   consts.LoadBalancerSkuStandard,
+			expectedRuleNames: []string{"atest1-TCP-53", "atest1-UDP-53", "atest1-TCP-443"},
+		},
+		{
+			desc:              "TCP and UDP ports with the same port number should be combined",
+			annotations:       map[string]string{consts.ServiceAnnotationLoadBalancerCombineProtocols: "true"},
+			loadBalancerSku:   consts.LoadBalancerSkuStandard,
+			expectedRuleNames: []string{"atest1-All-53", "atest1-TCP-443"},
+		},
+		{
+			desc:              "ports should not be combined on basic load balancers",
+			annotations:       map[string]string{consts.ServiceAnnotationLoadBalancerCombineProtocols: "true"},
+			loadBalancerSku:   consts.LoadBalancerSkuBasic,
+			expectedRuleNames: []string{"atest1-TCP-53", "atest1-UDP-53", "atest1-TCP-443"},
+		},
+		{
+			desc: "ports with different node ports should not be combined if the floating IP is disabled",
+			annotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerCombineProtocols:  "true",
+				consts.ServiceAnnotationDisableLoadBalancerFloatingIP: "true",
+			},
+			loadBalancerSku:   consts.LoadBalancerSkuStandard,
+			udpNodePort:       30053,
+			expectedRuleNames: []string{"atest1-TCP-53", "atest1-UDP-53", "atest1-TCP-443"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = tc.loadBalancerSku
+			svc := getTestService("test1", v1.ProtocolTCP, tc.annotations, false, 53, 443)
+			udpPort := svc.Spec.Ports[0]
+			udpPort.Name = "udp-53"
+			udpPort.Protocol = v1.ProtocolUDP
+			if tc.udpNodePort != 0 {
+				udpPort.NodePort = tc.udpNodePort
+			}
+			svc.Spec.Ports = []v1.ServicePort{svc.Spec.Ports[0], udpPort, svc.Spec.Ports[1]}
+
+			_, rules, err := az.getExpectedLBRules(&svc, "frontendIPConfigID", "backendPoolID", "lbname", false)
+			assert.NoError(t, err)
+			ruleNames := []string{}
+			for _, rule := range rules {
+				ruleNames = append(ruleNames, pointer.StringDeref(rule.Name, ""))
+				if strings.Contains(pointer.StringDeref(rule.Name, ""), "-All-") {
+					assert.Equal(t, network.TransportProtocolAll, rule.Protocol)
+					assert.NotNil(t, rule.Probe)
+				}
+			}
+			assert.Equal(t, tc.expectedRuleNames, ruleNames)
+		})
+	}
+}
+
+func TestGetLoadDistribution(t *testing.T) {
+	for _, tc := range []struct {
+		desc             string
+		sessionAffinity  v1.ServiceAffinity
+		annotations      map[string]string
+		port             int32
+		expected         network.LoadDistribution
+		expectedErrorMsg string
+	}{
+		{
+			desc:     "Default should be returned by default",
+			port:     80,
+			expected: network.LoadDistributionDefault,
+		},
+		{
+			desc:            "SourceIP should be returned for ClientIP session affinity",
+			sessionAffinity: v1.ServiceAffinityClientIP,
+			port:            80,
+			expected:        network.LoadDistributionSourceIP,
+		},
+		{
+			desc:            "service annotation should take priority over session affinity",
+			sessionAffinity: v1.ServiceAffinityClientIP,
+			annotations:     map[string]string{consts.ServiceAnnotationLoadBalancerSessionPersistence: "none"},
+			port:            80,
+			expected:        network.LoadDistributionDefault,
+		},
+		{
+			desc: "port annotation should take priority over service annotation",
+			annotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerSessionPersistence:   consts.SessionPersistenceClientIP,
+				"service.beta.kubernetes.io/port_80_session_persistence": consts.SessionPersistenceClientIPProtocol,
+			},
+			port:     80,
+			expected: network.LoadDistributionSourceIPProtocol,
+		},
+		{
+			desc: "port annotation of other ports should be ignored",
+			annotations: map[string]string{
+				"service.beta.kubernetes.io/port_443_session_persistence": consts.SessionPersistenceClientIPProtocol,
+			},
+			port:     80,
+			expected: network.LoadDistributionDefault,
+		},
+		{
+			desc:             "invalid value should return error",
+			annotations:      map[string]string{"service.beta.kubernetes.io/port_80_session_persistence": "SourceIP"},
+			port:             80,
+			expectedErrorMsg: `invalid value "SourceIP" of annotation service.beta.kubernetes.io/port_80_session_persistence`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			service := getTestService("service", v1.ProtocolTCP, tc.annotations, false, tc.port)
+			service.Spec.SessionAffinity = tc.sessionAffinity
+			loadDistribution, err := getLoadDistribution(&service, tc.port)
+			if tc.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, loadDistribution)
+		})
+	}
+}
+
 func TestSubnet(t *testing.T) {
 	for i, c := range []struct {
 		desc     string
@@ -2472,6 +2652,79 @@ func TestReconcileLoadBalancerRuleCommon(t *testing.T) {
 				consts.IPVersionIPv6: getHATestRules(true, true, v1.ProtocolTCP, consts.IPVersionIPv6, true),
 			},
 		},
+		{
+			desc: "getExpectedLBRules shall return lbRule without probe (slb with HA enabled and probes disabled on all ports)",
+			service: getTestServiceDualStack("test1", v1.ProtocolTCP, map[string]string{
+				consts.ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts:              "true",
+				consts.ServiceAnnotationLoadBalancerInternal:                                 "true",
+				consts.BuildAnnotationKeyForPort(80, consts.PortAnnotationNoHealthProbeRule): "true",
+			}, 80),
+			loadBalancerSku: "standard",
+			expectedRules: map[bool][]network.LoadBalancingRule{
+				consts.IPVersionIPv4: getHATestRules(true, false, v1.ProtocolTCP, consts.IPVersionIPv4, true),
+				consts.IPVersionIPv6: getHATestRules(true, false, v1.ProtocolTCP, consts.IPVersionIPv6, true),
+			},
+		},
+		{
+			desc: "getExpectedLBRules shall return tcp probe on the management port (slb with HA enabled)",
+			service: getTestServiceDualStack("test1", v1.ProtocolTCP, map[string]string{
+				consts.ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts:                      "true",
+				consts.ServiceAnnotationLoadBalancerInternal:                                         "true",
+				consts.BuildAnnotationKeyForPort(80, consts.PortAnnotationHealthProbeManagementPort): "8081",
+			}, 80),
+			loadBalancerSku: "standard",
+			expectedProbes:  getTestProbes("Tcp", "", pointer.Int32(5), pointer.Int32(80), pointer.Int32(8081), pointer.Int32(2)),
+			expectedRules: map[bool][]network.LoadBalancingRule{
+				consts.IPVersionIPv4: getHATestRules(true, true, v1.ProtocolTCP, consts.IPVersionIPv4, true),
+				consts.IPVersionIPv6: getHATestRules(true, true, v1.ProtocolTCP, consts.IPVersionIPv6, true),
+			},
+		},
+		{
+			desc: "getExpectedLBRules shall report an error if the management ports are different (slb with HA enabled)",
+			service: getTestServiceDualStack("test1", v1.ProtocolTCP, map[string]string{
+				consts.ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts:                        "true",
+				consts.ServiceAnnotationLoadBalancerInternal:                                           "true",
+				consts.BuildAnnotationKeyForPort(80, consts.PortAnnotationHealthProbeManagementPort):   "8081",
+				consts.BuildAnnotationKeyForPort(8080, consts.PortAnnotationHealthProbeManagementPort): "8082",
+			}, 80, 8080),
+			loadBalancerSku: "standard",
+			expectedErr:     true,
+		},
+		{
+			desc: "getExpectedLBRules shall report an error if the management port conflicts with no_probe_rule",
+			service: getTestServiceDualStack("test1", v1.ProtocolTCP, map[string]string{
+				consts.ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts:                      "true",
+				consts.ServiceAnnotationLoadBalancerInternal:                                         "true",
+				consts.BuildAnnotationKeyForPort(80, consts.PortAnnotationHealthProbeManagementPort): "8081",
+				consts.BuildAnnotationKeyForPort(80, consts.PortAnnotationNoHealthProbeRule):         "true",
+			}, 80),
+			loadBalancerSku: "standard",
+			expectedErr:     true,
+		},
+		{
+			desc: "getExpectedLBRules shall report an error if the probe is disabled for local services (slb with HA enabled)",
+			service: func() v1.Service {
+				svc := getTestServiceDualStack("test1", v1.ProtocolTCP, map[string]string{
+					consts.ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts:              "true",
+					consts.ServiceAnnotationLoadBalancerInternal:                                 "true",
+					consts.BuildAnnotationKeyForPort(80, consts.PortAnnotationNoHealthProbeRule): "true",
+				}, 80)
+				svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+				svc.Spec.HealthCheckNodePort = 32000
+				return svc
+			}(),
+			loadBalancerSku: "standard",
+			expectedErr:     true,
+		},
+		{
+			desc: "getExpectedLBRules shall return tcp probe on the management port",
+			service: getTestServiceDualStack("test1", v1.ProtocolTCP, map[string]string{
+				consts.BuildAnnotationKeyForPort(80, consts.PortAnnotationHealthProbeManagementPort): "8081",
+			}, 80),
+			loadBalancerSku: "standard",
+			expectedProbes:  getTestProbes("Tcp", "", pointer.Int32(5), pointer.Int32(80), pointer.Int32(8081), pointer.Int32(2)),
+			expectedRules:   getDefaultTestRules(true),
+		},
 		{
 			desc:            "getExpectedLBRules should leave probe path empty when using TCP probe",
 			service:         getTestServiceDualStack("test1", v1.ProtocolTCP, nil, 80),
@@ -4690,6 +4943,157 @@ func TestSafeDeletePublicIP(t *testing.T) {
 	}
 }
 
+func TestGetPublicIPDeletionBlocker(t *testing.T) {
+	const frontendID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb1/frontendIPConfigurations/fe1"
+	newLB := func(props *network.FrontendIPConfigurationPropertiesFormat) *network.LoadBalancer {
+		return &network.LoadBalancer{
+			Name: pointer.String("lb1"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+					{ID: pointer.String(frontendID), FrontendIPConfigurationPropertiesFormat: props},
+				},
+			},
+		}
+	}
+	newPIP := func(ipConfigurationID string) *network.PublicIPAddress {
+		pip := &network.PublicIPAddress{Name: pointer.String("pip1"), PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{}}
+		if ipConfigurationID != "" {
+			pip.IPConfiguration = &network.IPConfiguration{ID: pointer.String(ipConfigurationID)}
+		}
+		return pip
+	}
+
+	for _, tc := range []struct {
+		desc            string
+		pip             *network.PublicIPAddress
+		lb              *network.LoadBalancer
+		expectedBlocked bool
+	}{
+		{
+			desc: "the public IP without references should not be blocked",
+			pip:  newPIP(""),
+		},
+		{
+			desc: "the public IP referenced by the frontend of the load balancer should not be blocked",
+			pip:  newPIP(frontendID),
+			lb:   newLB(&network.FrontendIPConfigurationPropertiesFormat{LoadBalancingRules: &[]network.SubResource{{ID: pointer.String("rule1")}}}),
+		},
+		{
+			desc:            "the public IP associated with a NAT gateway should be blocked",
+			pip:             &network.PublicIPAddress{PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{NatGateway: &network.NatGateway{ID: pointer.String("natgw")}}},
+			expectedBlocked: true,
+		},
+		{
+			desc:            "the public IP referenced by the frontend of another load balancer should be blocked",
+			pip:             newPIP("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb2/frontendIPConfigurations/fe1"),
+			lb:              newLB(nil),
+			expectedBlocked: true,
+		},
+		{
+			desc:            "the public IP referenced by a network interface should be blocked without the load balancer",
+			pip:             newPIP("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic/ipConfigurations/ipconfig1"),
+			expectedBlocked: true,
+		},
+		{
+			desc:            "the public IP whose frontend is used by inbound NAT rules should be blocked",
+			pip:             newPIP(frontendID),
+			lb:              newLB(&network.FrontendIPConfigurationPropertiesFormat{InboundNatRules: &[]network.SubResource{{ID: pointer.String("nat1")}}}),
+			expectedBlocked: true,
+		},
+		{
+			desc:            "the public IP whose frontend is used by outbound rules should be blocked",
+			pip:             newPIP(frontendID),
+			lb:              newLB(&network.FrontendIPConfigurationPropertiesFormat{OutboundRules: &[]network.SubResource{{ID: pointer.String("outbound1")}}}),
+			expectedBlocked: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expectedBlocked, getPublicIPDeletionBlocker(tc.pip, tc.lb) != "")
+		})
+	}
+}
+
+func TestSafeDeletePublicIPSkipsSharedPublicIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	pip := network.PublicIPAddress{
+		Name: pointer.String("pip1"),
+		Tags: map[string]*string{consts.ServiceTagKey: pointer.String("default/test1,default/test2")},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			IPConfiguration: &network.IPConfiguration{
+				ID: pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb2/frontendIPConfigurations/fe1"),
+			},
+		},
+	}
+	lb := &network.LoadBalancer{
+		Name: pointer.String("lb1"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{ID: pointer.String("id1")}},
+		},
+	}
+
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{pip}, nil)
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+			assert.Equal(t, "default/test2", pointer.StringDeref(parameters.Tags[consts.ServiceTagKey], ""))
+			return nil
+		}).Times(1)
+	mockPIPsClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	assert.NoError(t, az.safeDeletePublicIP(&service, "rg", &pip, lb))
+	assert.Equal(t, 1, len(*lb.FrontendIPConfigurations))
+}
+
+func TestGetPublicIPUpdatesWithRetainedPublicIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc            string
+		annotations     map[string]string
+		expectedDeleted int
+		expectedUpdated int
+	}{
+		{
+			desc:            "the public IP should be deleted without the annotation",
+			expectedDeleted: 1,
+		},
+		{
+			desc:            "the public IP should be untagged instead of deleted with the annotation",
+			annotations:     map[string]string{consts.ServiceAnnotationRetainPublicIP: "true"},
+			expectedUpdated: 1,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			service := getTestService("test1", v1.ProtocolTCP, tc.annotations, false, 80)
+			pips := []network.PublicIPAddress{
+				{
+					Name: pointer.String("testCluster-atest1"),
+					Tags: map[string]*string{
+						consts.ServiceTagKey:  pointer.String("default/test1"),
+						consts.ClusterNameKey: pointer.String(testClusterName),
+					},
+					PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{IPAddress: pointer.String("1.2.3.4"), PublicIPAddressVersion: network.IPv4},
+				},
+			}
+
+			_, pipsToBeDeleted, _, pipsToBeUpdated, err := az.getPublicIPUpdates(
+				testClusterName, &service, pips, false, false, "testCluster-atest1", "default/test1", serviceIPTagRequest{}, false, false)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDeleted, len(pipsToBeDeleted))
+			assert.Equal(t, tc.expectedUpdated, len(pipsToBeUpdated))
+			for _, pip := range pipsToBeUpdated {
+				assert.Equal(t, "", pointer.StringDeref(pip.Tags[consts.ServiceTagKey], ""))
+			}
+		})
+	}
+}
+
 func TestReconcilePublicIPsCommon(t *testing.T) {
 	deleteUnwantedPIPsAndCreateANewOneclientGet := func(client *mockpublicipclient.MockInterface) {
 		client.EXPECT().Get(gomock.Any(), "rg", "testCluster-atest1", gomock.Any()).Return(network.PublicIPAddress{ID: pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/testCluster-atest1")}, nil).Times(1)
@@ -6473,7 +6877,7 @@ func TestEnsurePIPTagged(t *testing.T) {
 				"e":                       pointer.String(""),
 			},
 		}
-		changed := cloud.ensurePIPTagged(&service, &pip)
+		changed := cloud.ensurePIPTagged(testClusterName, &service, &pip)
 		assert.True(t, changed)
 		assert.Equal(t, expectedPIP, pip)
 	})
@@ -6492,7 +6896,7 @@ func TestEnsurePIPTagged(t *testing.T) {
 				"e":                       pointer.String(""),
 			},
 		}
-		changed := cloud.ensurePIPTagged(&service, &pip)
+		changed := cloud.ensurePIPTagged(testClusterName, &service, &pip)
 		assert.True(t, changed)
 		assert.Equal(t, expectedPIP, pip)
 	})
@@ -6512,7 +6916,7 @@ func TestEnsurePIPTagged(t *testing.T) {
 				"e":                       pointer.String(""),
 			},
 		}
-		changed := cloud.ensurePIPTagged(&service, &pip)
+		changed := cloud.ensurePIPTagged(testClusterName, &service, &pip)
 		assert.True(t, changed)
 		assert.Equal(t, expectedPIP, pip)
 	})
@@ -6550,7 +6954,7 @@ func TestEnsureLoadBalancerTagged(t *testing.T) {
 			cloud.SystemTags = tc.systemTags
 			lb := &network.LoadBalancer{Tags: tc.existedTags}
 
-			changed := cloud.ensureLoadBalancerTagged(lb)
+			changed := cloud.ensureLoadBalancerTagged(testClusterName, lb)
 			assert.Equal(t, tc.expectedChanged, changed)
 			assert.Equal(t, tc.expectedTags, lb.Tags)
 		})
@@ -6754,7 +7158,7 @@ func TestReconcileZonesForFrontendIPConfigs(t *testing.T) {
 					Zones: &[]string{"2"},
 				},
 				{
-					Name: pointer.String("atest1"),
+					Name: pointer.String("atest-previous"),
 					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
 						Subnet: &network.Subnet{
 							Name: pointer.String("subnet-1"),
@@ -9031,3 +9435,99 @@ func TestAddOrUpdateLBInList(t *testing.T) {
 	addOrUpdateLBInList(&existingLBs, &targetLB)
 	assert.Equal(t, expectedLBs, existingLBs)
 }
+
+func TestGetServiceIPsOnFlippedLoadBalancer(t *testing.T) {
+	internalLB := network.LoadBalancer{
+		Name: pointer.String("testCluster-internal"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{
+					Name: pointer.String("aservice1"),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddress: pointer.String("10.0.0.5"),
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		desc        string
+		ingressIPs  []string
+		existingLBs []network.LoadBalancer
+		expectList  bool
+		expectedIPs []string
+	}{
+		{
+			desc:       "should not list the load balancers if the ingress IPs are served by the wanted load balancer",
+			ingressIPs: []string{"1.2.3.4"},
+		},
+		{
+			desc:        "should return the frontend IPs on the load balancer of the opposite type",
+			ingressIPs:  []string{"10.0.0.5"},
+			existingLBs: []network.LoadBalancer{internalLB},
+			expectList:  true,
+			expectedIPs: []string{"10.0.0.5"},
+		},
+		{
+			desc:        "should return nothing if the service is not on the load balancer of the opposite type",
+			ingressIPs:  []string{"10.0.0.6"},
+			existingLBs: []network.LoadBalancer{{Name: pointer.String("testCluster-internal"), LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{}}},
+			expectList:  true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			service := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+			for _, ip := range tc.ingressIPs {
+				service.Status.LoadBalancer.Ingress = append(service.Status.LoadBalancer.Ingress, v1.LoadBalancerIngress{IP: ip})
+			}
+			mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+			if tc.expectList {
+				mockLBClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return(tc.existingLBs, nil)
+			}
+
+			ips, err := az.getServiceIPsOnFlippedLoadBalancer("testCluster", &service, []string{"1.2.3.4"})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedIPs, ips)
+		})
+	}
+}
+
+func BenchmarkReconcileLBRulesAndProbes(b *testing.B) {
+	ctrl := gomock.NewController(b)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	service := getTestService("service1", v1.ProtocolTCP, nil, false, 80, 443)
+	expectedProbes, expectedRules, err := az.getExpectedLBRules(&service, "frontendIPConfigID", "backendPoolID", testClusterName, false)
+	assert.NoError(b, err)
+
+	// the load balancer shared by 3000 other services
+	probes := append([]network.Probe{}, expectedProbes...)
+	rules := append([]network.LoadBalancingRule{}, expectedRules...)
+	for i := 0; i < 3000; i++ {
+		name := fmt.Sprintf("a%d-TCP-%d", i, 1000+i)
+		probes = append(probes, network.Probe{Name: pointer.String(name), ProbePropertiesFormat: &network.ProbePropertiesFormat{Port: pointer.Int32(int32(1000 + i))}})
+		rules = append(rules, network.LoadBalancingRule{Name: pointer.String(name), LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{FrontendPort: pointer.Int32(int32(1000 + i))}})
+	}
+	lb := &network.LoadBalancer{
+		Name: pointer.String(testClusterName),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			Probes:             &probes,
+			LoadBalancingRules: &rules,
+		},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if az.reconcileLBProbes(lb, &service, "default/service1", true, expectedProbes) ||
+			az.reconcileLBRules(lb, &service, "default/service1", true, expectedRules) {
+			b.Fatal("the load balancer is changed unexpectedly")
+		}
+	}
+}
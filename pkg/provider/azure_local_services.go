@@ -19,6 +19,7 @@ package provider
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -33,9 +34,11 @@ import (
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
 	"k8s.io/utils/pointer"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
 	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
 )
 
@@ -57,6 +60,7 @@ type batchOperation interface {
 }
 
 // loadBalancerBackendPoolUpdateOperation is an operation that updates the backend pool of a load balancer.
+// The nodeIPs are the IPs of the pods if the pod IPs are in the backend pools.
 type loadBalancerBackendPoolUpdateOperation struct {
 	serviceName      string
 	loadBalancerName string
@@ -120,6 +124,18 @@ func getRemoveIPsFromBackendPoolOperation(serviceName, loadBalancerName, backend
 	}
 }
 
+// getDrainIPsInBackendPoolOperation creates a new loadBalancerBackendPoolUpdateOperation
+// that drains the connections to the pod IPs in the backend pool.
+func getDrainIPsInBackendPoolOperation(serviceName, loadBalancerName, backendPoolName string, podIPs []string) *loadBalancerBackendPoolUpdateOperation {
+	return &loadBalancerBackendPoolUpdateOperation{
+		serviceName:      serviceName,
+		loadBalancerName: loadBalancerName,
+		backendPoolName:  backendPoolName,
+		kind:             consts.LoadBalancerBackendPoolUpdateOperationDrain,
+		nodeIPs:          podIPs,
+	}
+}
+
 // addOperation adds an operation to the loadBalancerBackendPoolUpdater.
 func (updater *loadBalancerBackendPoolUpdater) addOperation(operation batchOperation) batchOperation {
 	updater.lock.Lock()
@@ -211,8 +227,22 @@ func (updater *loadBalancerBackendPoolUpdater) process() {
 				removed := removeNodeIPAddressesFromBackendPool(bp, lbOp.nodeIPs, false, true)
 				changed = changed || removed
 			case consts.LoadBalancerBackendPoolUpdateOperationAdd:
-				added := updater.az.addNodeIPAddressesToBackendPool(&bp, lbOp.nodeIPs)
+				var added bool
+				if updater.az.usePodIPBackendPool() {
+					added = setPodIPAddressesAdminState(&bp, lbOp.nodeIPs, network.LoadBalancerBackendAddressAdminStateNone)
+				} else {
+					added = updater.az.addNodeIPAddressesToBackendPool(&bp, lbOp.nodeIPs)
+				}
 				changed = changed || added
+			case consts.LoadBalancerBackendPoolUpdateOperationDrain:
+				var drained bool
+				if updater.az.getCloudCapabilities().backendAddressAdminState {
+					drained = setPodIPAddressesAdminState(&bp, lbOp.nodeIPs, network.LoadBalancerBackendAddressAdminStateDrain)
+				} else {
+					// the admin state is not supported by the target cloud, the pods are removed instead
+					drained = removeNodeIPAddressesFromBackendPool(bp, lbOp.nodeIPs, false, true)
+				}
+				changed = changed || drained
 			default:
 				panic("loadBalancerBackendPoolUpdater.process: unknown operation type")
 			}
@@ -306,6 +336,8 @@ func (az *Cloud) setUpEndpointSlicesInformer(informerFactory informers.SharedInf
 				}
 
 				klog.V(4).Infof("Detecting EndpointSlice %s/%s update", newES.Namespace, newES.Name)
+				// The serving nodes are decided by the endpoints in all EndpointSlices of the service.
+				otherSlices := az.getCachedServiceEndpointSlices(newES.Namespace, svcName, newES.Name)
 				az.endpointSlicesCache.Store(strings.ToLower(fmt.Sprintf("%s/%s", newES.Namespace, newES.Name)), newES)
 
 				key := strings.ToLower(fmt.Sprintf("%s/%s", newES.Namespace, svcName))
@@ -314,27 +346,41 @@ func (az *Cloud) setUpEndpointSlicesInformer(informerFactory informers.SharedInf
 					klog.V(4).Infof("EndpointSlice %s/%s belongs to service %s, but the service is not a local service, skip updating load balancer backend pool", key, newES.Namespace, newES.Name)
 					return
 				}
+				if az.usePodIPBackendPool() {
+					previousReadyIPs, previousDrainingIPs := az.getBackendPoolPodIPs(append(otherSlices, previousES), si.preferredZone)
+					currentReadyIPs, currentDrainingIPs := az.getBackendPoolPodIPs(append(otherSlices, newES), si.preferredZone)
+					if previousReadyIPs.Equal(currentReadyIPs) && previousDrainingIPs.Equal(currentDrainingIPs) {
+						klog.V(4).Infof("No pod IP change detected for EndpointSlice %s/%s, skip updating load balancer backend pool", newES.Namespace, newES.Name)
+						return
+					}
+					ipsToBeDeleted := previousReadyIPs.Union(previousDrainingIPs).Difference(currentReadyIPs.Union(currentDrainingIPs))
+					az.updatePodIPBackendPools(key, si, sets.List(currentReadyIPs), sets.List(currentDrainingIPs), sets.List(ipsToBeDeleted))
+					return
+				}
 				lbName, ipFamily := si.lbName, si.ipFamily
 
 				var previousIPs, currentIPs, previousNodeNames, currentNodeNames []string
 				if previousES != nil {
-					for _, ep := range previousES.Endpoints {
-						previousNodeNames = append(previousNodeNames, pointer.StringDeref(ep.NodeName, ""))
-					}
+					previousNodeNames = getEndpointSlicesServingNodeNames(append(otherSlices, previousES))
 				}
 				if newES != nil {
-					for _, ep := range newES.Endpoints {
-						currentNodeNames = append(currentNodeNames, pointer.StringDeref(ep.NodeName, ""))
-					}
+					currentNodeNames = getEndpointSlicesServingNodeNames(append(otherSlices, newES))
 				}
 				for _, previousNodeName := range previousNodeNames {
-					nodeIPsSet := az.nodePrivateIPs[previousNodeName]
+					nodeIPsSet := az.nodeTopology.getPrivateIPs(previousNodeName)
 					previousIPs = append(previousIPs, setToStrings(nodeIPsSet)...)
 				}
+				// The IPs of the excluded nodes are removed from the backend pool if they were added before.
+				az.nodeCachesLock.RLock()
 				for _, currentNodeName := range currentNodeNames {
-					nodeIPsSet := az.nodePrivateIPs[currentNodeName]
+					if az.shouldNodeExcludedFromLoadBalancer(currentNodeName) {
+						klog.V(4).Infof("Node %s of EndpointSlice %s/%s is excluded from load balancers, skip adding it to the backend pool", currentNodeName, newES.Namespace, newES.Name)
+						continue
+					}
+					nodeIPsSet := az.nodeTopology.getPrivateIPs(currentNodeName)
 					currentIPs = append(currentIPs, setToStrings(nodeIPsSet)...)
 				}
+				az.nodeCachesLock.RUnlock()
 				ipsToBeDeleted := compareNodeIPs(previousIPs, currentIPs)
 				if len(ipsToBeDeleted) == 0 && len(previousIPs) == len(currentIPs) {
 					klog.V(4).Infof("No IP change detected for EndpointSlice %s/%s, skip updating load balancer backend pool", newES.Namespace, newES.Name)
@@ -343,8 +389,8 @@ func (az *Cloud) setUpEndpointSlicesInformer(informerFactory informers.SharedInf
 
 				if az.backendPoolUpdater != nil {
 					var bpNames []string
-					bpNameIPv4 := getLocalServiceBackendPoolName(key, false)
-					bpNameIPv6 := getLocalServiceBackendPoolName(key, true)
+					bpNameIPv4 := az.getLocalServiceBackendPoolName(key, false)
+					bpNameIPv6 := az.getLocalServiceBackendPoolName(key, true)
 					switch strings.ToLower(ipFamily) {
 					case strings.ToLower(consts.IPVersionIPv4String):
 						bpNames = append(bpNames, bpNameIPv4)
@@ -370,6 +416,213 @@ func (az *Cloud) setUpEndpointSlicesInformer(informerFactory informers.SharedInf
 		})
 }
 
+// runLocalServiceBackendPoolRepairLoop periodically recomputes the desired backend pool
+// members of all local services from endpoint slices and repairs any drift. It covers
+// the cases that the endpoint slice update events are missed or the batch updates are dropped.
+func (az *Cloud) runLocalServiceBackendPoolRepairLoop(ctx context.Context, interval time.Duration) {
+	klog.V(2).Info("runLocalServiceBackendPoolRepairLoop: started")
+	err := wait.PollUntilContextCancel(ctx, interval, false, func(ctx context.Context) (bool, error) {
+		az.repairLocalServiceBackendPools(ctx)
+		return false, nil
+	})
+	klog.Infof("runLocalServiceBackendPoolRepairLoop: stopped due to %s", err.Error())
+}
+
+// repairLocalServiceBackendPools reconciles the backend pools of all local services
+// and returns the number of backend pool addresses that are corrected.
+func (az *Cloud) repairLocalServiceBackendPools(ctx context.Context) int {
+	var corrections int
+	az.localServiceNameToServiceInfoMap.Range(func(key, value interface{}) bool {
+		serviceName := key.(string)
+		si := value.(*serviceInfo)
+		n, err := az.repairLocalServiceBackendPool(ctx, serviceName, si)
+		if err != nil {
+			klog.Warningf("repairLocalServiceBackendPools: failed to repair the backend pool of service %s: %s", serviceName, err.Error())
+		}
+		corrections += n
+		return true
+	})
+	return corrections
+}
+
+// repairLocalServiceBackendPool compares the IP addresses in the backend pools of a local service
+// with the ones computed from the endpoint slices, and sends update operations to the
+// batch updater if there is any drift. It returns the number of addresses to be corrected.
+func (az *Cloud) repairLocalServiceBackendPool(ctx context.Context, serviceName string, si *serviceInfo) (int, error) {
+	svc, found, err := az.getLatestService(serviceName, false)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		klog.V(4).Infof("repairLocalServiceBackendPool: service %s not found, skip repairing", serviceName)
+		return 0, nil
+	}
+	if az.usePodIPBackendPool() {
+		return az.repairPodIPBackendPool(ctx, svc, serviceName, si)
+	}
+
+	nodeNames, err := az.getLocalServiceEndpointsNodeNames(svc)
+	if err != nil {
+		return 0, err
+	}
+
+	desiredIPv4s, desiredIPv6s := sets.New[string](), sets.New[string]()
+	az.nodeCachesLock.RLock()
+	for nodeName := range nodeNames {
+		if az.shouldNodeExcludedFromLoadBalancer(nodeName) {
+			continue
+		}
+		for ip := range az.nodeTopology.getPrivateIPs(nodeName) {
+			if utilnet.IsIPv4String(ip) {
+				desiredIPv4s.Insert(ip)
+			} else {
+				desiredIPv6s.Insert(ip)
+			}
+		}
+	}
+	az.nodeCachesLock.RUnlock()
+
+	desiredIPsByBackendPoolName := make(map[string]sets.Set[string])
+	switch strings.ToLower(si.ipFamily) {
+	case strings.ToLower(consts.IPVersionIPv4String):
+		desiredIPsByBackendPoolName[az.getLocalServiceBackendPoolName(serviceName, false)] = desiredIPv4s
+	case strings.ToLower(consts.IPVersionIPv6String):
+		desiredIPsByBackendPoolName[az.getLocalServiceBackendPoolName(serviceName, true)] = desiredIPv6s
+	default:
+		desiredIPsByBackendPoolName[az.getLocalServiceBackendPoolName(serviceName, false)] = desiredIPv4s
+		desiredIPsByBackendPoolName[az.getLocalServiceBackendPoolName(serviceName, true)] = desiredIPv6s
+	}
+
+	var corrections int
+	for bpName, desiredIPs := range desiredIPsByBackendPoolName {
+		bp, rerr := az.LoadBalancerClient.GetLBBackendPool(ctx, az.ResourceGroup, si.lbName, bpName, "")
+		if rerr != nil {
+			if rerr.IsNotFound() {
+				klog.V(4).Infof("repairLocalServiceBackendPool: backend pool %s/%s not found, skip repairing", si.lbName, bpName)
+				continue
+			}
+			return corrections, rerr.Error()
+		}
+
+		existingIPs := sets.New[string]()
+		if bp.BackendAddressPoolPropertiesFormat != nil && bp.LoadBalancerBackendAddresses != nil {
+			for _, address := range *bp.LoadBalancerBackendAddresses {
+				if address.LoadBalancerBackendAddressPropertiesFormat != nil &&
+					pointer.StringDeref(address.IPAddress, "") != "" {
+					existingIPs.Insert(pointer.StringDeref(address.IPAddress, ""))
+				}
+			}
+		}
+
+		ipsToBeAdded := sets.List(desiredIPs.Difference(existingIPs))
+		ipsToBeDeleted := sets.List(existingIPs.Difference(desiredIPs))
+		if len(ipsToBeAdded) == 0 && len(ipsToBeDeleted) == 0 {
+			continue
+		}
+
+		klog.V(2).InfoS("repairLocalServiceBackendPool: detected backend pool drift",
+			"service", serviceName,
+			"load balancer", si.lbName,
+			"backend pool", bpName,
+			"IPs to be added", strings.Join(ipsToBeAdded, ","),
+			"IPs to be deleted", strings.Join(ipsToBeDeleted, ","))
+		if az.backendPoolUpdater != nil {
+			if len(ipsToBeDeleted) > 0 {
+				az.backendPoolUpdater.addOperation(getRemoveIPsFromBackendPoolOperation(serviceName, si.lbName, bpName, ipsToBeDeleted))
+			}
+			if len(ipsToBeAdded) > 0 {
+				az.backendPoolUpdater.addOperation(getAddIPsToBackendPoolOperation(serviceName, si.lbName, bpName, ipsToBeAdded))
+			}
+		}
+		metrics.ObserveLocalServiceBackendPoolCorrections(si.lbName, string(consts.LoadBalancerBackendPoolUpdateOperationAdd), len(ipsToBeAdded))
+		metrics.ObserveLocalServiceBackendPoolCorrections(si.lbName, string(consts.LoadBalancerBackendPoolUpdateOperationRemove), len(ipsToBeDeleted))
+		corrections += len(ipsToBeAdded) + len(ipsToBeDeleted)
+	}
+
+	return corrections, nil
+}
+
+// updateLocalServiceBackendPoolsOfNode updates the IPs of the node in the backend pools of the local services with
+// endpoints on the node after it is updated. The IPs are added if the node is included in the load balancers by the
+// update, removed if it is excluded, and replaced if the private IPs of the node are changed.
+func (az *Cloud) updateLocalServiceBackendPoolsOfNode(nodeName string, wasExcluded bool, previousIPs []string) {
+	// The node IPs are not in the backend pools of the services if the pod IPs are.
+	if az.backendPoolUpdater == nil || az.usePodIPBackendPool() {
+		return
+	}
+
+	var ipsBefore, ipsAfter sets.Set[string]
+	if !wasExcluded {
+		ipsBefore = sets.New(previousIPs...)
+	}
+	az.nodeCachesLock.RLock()
+	if !az.shouldNodeExcludedFromLoadBalancer(nodeName) {
+		ipsAfter = az.nodeTopology.getPrivateIPs(nodeName).Clone()
+	}
+	az.nodeCachesLock.RUnlock()
+	ipsToBeRemoved := sets.List(ipsBefore.Difference(ipsAfter))
+	ipsToBeAdded := sets.List(ipsAfter.Difference(ipsBefore))
+	if len(ipsToBeRemoved) == 0 && len(ipsToBeAdded) == 0 {
+		return
+	}
+
+	az.localServiceNameToServiceInfoMap.Range(func(key, value interface{}) bool {
+		serviceName := key.(string)
+		si := value.(*serviceInfo)
+		svc, found, err := az.getLatestService(serviceName, false)
+		if err != nil || !found {
+			return true
+		}
+		nodeNames, err := az.getLocalServiceEndpointsNodeNames(svc)
+		if err != nil {
+			klog.Warningf("updateLocalServiceBackendPoolsOfNode: failed to get the endpoints of service %s: %s", serviceName, err.Error())
+			return true
+		}
+		if !nodeNames.Has(nodeName) {
+			return true
+		}
+
+		for isIPv6, bpName := range az.getLocalServiceBackendPoolNamesOfIPFamily(serviceName, si.ipFamily) {
+			if ips := filterIPsByFamily(ipsToBeRemoved, isIPv6); len(ips) > 0 {
+				klog.V(2).Infof("updateLocalServiceBackendPoolsOfNode: removing the IPs %s of the node %s from the backend pool %s of service %s", strings.Join(ips, ","), nodeName, bpName, serviceName)
+				az.backendPoolUpdater.addOperation(getRemoveIPsFromBackendPoolOperation(serviceName, si.lbName, bpName, ips))
+			}
+			if ips := filterIPsByFamily(ipsToBeAdded, isIPv6); len(ips) > 0 {
+				klog.V(2).Infof("updateLocalServiceBackendPoolsOfNode: adding the IPs %s of the node %s to the backend pool %s of service %s", strings.Join(ips, ","), nodeName, bpName, serviceName)
+				az.backendPoolUpdater.addOperation(getAddIPsToBackendPoolOperation(serviceName, si.lbName, bpName, ips))
+			}
+		}
+		return true
+	})
+}
+
+// filterIPsByFamily returns the IPs of the given IP family.
+func filterIPsByFamily(ips []string, isIPv6 bool) []string {
+	var res []string
+	for _, ip := range ips {
+		if utilnet.IsIPv6String(ip) == isIPv6 {
+			res = append(res, ip)
+		}
+	}
+	return res
+}
+
+// getLocalServiceBackendPoolNamesOfIPFamily gets the names of the backend pools of a local service keyed by
+// whether they are IPv6, according to the IP family of the service.
+func (az *Cloud) getLocalServiceBackendPoolNamesOfIPFamily(serviceName, ipFamily string) map[bool]string {
+	switch strings.ToLower(ipFamily) {
+	case strings.ToLower(consts.IPVersionIPv4String):
+		return map[bool]string{consts.IPVersionIPv4: az.getLocalServiceBackendPoolName(serviceName, false)}
+	case strings.ToLower(consts.IPVersionIPv6String):
+		return map[bool]string{consts.IPVersionIPv6: az.getLocalServiceBackendPoolName(serviceName, true)}
+	default:
+		return map[bool]string{
+			consts.IPVersionIPv4: az.getLocalServiceBackendPoolName(serviceName, false),
+			consts.IPVersionIPv6: az.getLocalServiceBackendPoolName(serviceName, true),
+		}
+	}
+}
+
 func (az *Cloud) processBatchOperationResult(op batchOperation, res batchOperationResult) {
 	lbOp := op.(*loadBalancerBackendPoolUpdateOperation)
 	var svc *v1.Service
@@ -405,39 +658,115 @@ func compareNodeIPs(previousIPs, currentIPs []string) []string {
 }
 
 // getLocalServiceBackendPoolName gets the name of the backend pool of a local service.
-func getLocalServiceBackendPoolName(serviceName string, ipv6 bool) string {
-	serviceName = strings.ToLower(strings.Replace(serviceName, "/", "-", -1))
+func (az *Cloud) getLocalServiceBackendPoolName(serviceName string, ipv6 bool) string {
+	return renderLocalServiceBackendPoolName(az.LocalServiceBackendPoolNameTemplate, az.useHashedResourceNaming(), serviceName, ipv6)
+}
+
+// getLocalServiceBackendPoolNameCandidates gets all names the backend pools of a local service
+// could have, including the ones generated by the default and the previous templates in both
+// naming modes. It is used to find the backend pools created before the naming configurations change.
+func (az *Cloud) getLocalServiceBackendPoolNameCandidates(serviceName string) sets.Set[string] {
+	candidates := sets.New[string]()
+	templates := append([]string{consts.DefaultLocalServiceBackendPoolNameTemplate}, az.PreviousLocalServiceBackendPoolNameTemplates...)
+	for _, ipv6 := range []bool{false, true} {
+		candidates.Insert(az.getLocalServiceBackendPoolName(serviceName, ipv6))
+		for _, template := range templates {
+			candidates.Insert(
+				renderLocalServiceBackendPoolName(template, false, serviceName, ipv6),
+				renderLocalServiceBackendPoolName(template, true, serviceName, ipv6),
+			)
+		}
+	}
+	return candidates
+}
+
+// localServiceBackendPoolNameRE matches the legal names of the load balancer backend pools.
+var localServiceBackendPoolNameRE = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_.-]*[a-zA-Z0-9_])?$`)
+
+// validateLocalServiceBackendPoolNameTemplate checks that the template references the service name
+// and renders legal backend pool names.
+func validateLocalServiceBackendPoolNameTemplate(field, template string) error {
+	if !strings.Contains(template, consts.LocalServiceBackendPoolNameTemplateName) &&
+		!strings.Contains(template, consts.LocalServiceBackendPoolNameTemplateHash) {
+		return fmt.Errorf("%s %s must contain %s or %s",
+			field,
+			template,
+			consts.LocalServiceBackendPoolNameTemplateName,
+			consts.LocalServiceBackendPoolNameTemplateHash)
+	}
+	// The namespaces and names of the services are DNS labels, so only the literal parts of
+	// the template can make the rendered names illegal.
+	for _, ipv6 := range []bool{false, true} {
+		bpName := renderLocalServiceBackendPoolName(template, false, "ns/svc", ipv6)
+		if len(bpName) > consts.BackendPoolNameMaxLength || !localServiceBackendPoolNameRE.MatchString(bpName) {
+			return fmt.Errorf("%s %s renders illegal backend pool name %s, the names must have at most %d characters, start with a letter or number, "+
+				"end with a letter, number or underscore, and contain only letters, numbers, underscores, periods, or hyphens",
+				field, template, bpName, consts.BackendPoolNameMaxLength)
+		}
+	}
+	return nil
+}
+
+// renderLocalServiceBackendPoolName renders the name of the backend pool of a local service
+// by the given template. If hashed is true, the name exceeding the length limit will be
+// truncated and suffixed with a hash of the full name.
+func renderLocalServiceBackendPoolName(template string, hashed bool, serviceName string, ipv6 bool) string {
+	if template == "" {
+		template = consts.DefaultLocalServiceBackendPoolNameTemplate
+	}
+	serviceName = strings.ToLower(serviceName)
+	var namespace, name string
+	if parts := strings.SplitN(serviceName, "/", 2); len(parts) == 2 {
+		namespace, name = parts[0], parts[1]
+	} else {
+		name = serviceName
+	}
+	bpName := strings.NewReplacer(
+		consts.LocalServiceBackendPoolNameTemplateNamespace, namespace,
+		consts.LocalServiceBackendPoolNameTemplateName, name,
+		consts.LocalServiceBackendPoolNameTemplateHash, MakeCRC32(serviceName),
+	).Replace(template)
+	if hashed {
+		bpName = truncateNameWithHash(bpName, consts.BackendPoolNameMaxLength-consts.IPFamilySuffixLength)
+	}
 	if ipv6 {
-		return fmt.Sprintf("%s-ipv6", serviceName)
+		return fmt.Sprintf("%s-ipv6", bpName)
 	}
-	return serviceName
+	return bpName
+}
+
+// useDedicatedBackendPool returns true if the service has its own backend pools instead of
+// sharing the ones of the cluster, which is the case for the local services with multiple
+// standard load balancers, and for all services if the pod IPs are in the backend pools.
+func (az *Cloud) useDedicatedBackendPool(service *v1.Service) bool {
+	return (isLocalService(service) && az.useMultipleStandardLoadBalancers()) || az.usePodIPBackendPool()
 }
 
 // getBackendPoolNameForService determine the expected backend pool name
 // by checking the external traffic policy of the service.
 func (az *Cloud) getBackendPoolNameForService(service *v1.Service, clusterName string, ipv6 bool) string {
-	if !isLocalService(service) || !az.useMultipleStandardLoadBalancers() {
+	if !az.useDedicatedBackendPool(service) {
 		return getBackendPoolName(clusterName, ipv6)
 	}
-	return getLocalServiceBackendPoolName(getServiceName(service), ipv6)
+	return az.getLocalServiceBackendPoolName(getServiceName(service), ipv6)
 }
 
 // getBackendPoolNamesForService determine the expected backend pool names
 // by checking the external traffic policy of the service.
 func (az *Cloud) getBackendPoolNamesForService(service *v1.Service, clusterName string) map[bool]string {
-	if !isLocalService(service) || !az.useMultipleStandardLoadBalancers() {
+	if !az.useDedicatedBackendPool(service) {
 		return getBackendPoolNames(clusterName)
 	}
 	return map[bool]string{
-		consts.IPVersionIPv4: getLocalServiceBackendPoolName(getServiceName(service), false),
-		consts.IPVersionIPv6: getLocalServiceBackendPoolName(getServiceName(service), true),
+		consts.IPVersionIPv4: az.getLocalServiceBackendPoolName(getServiceName(service), false),
+		consts.IPVersionIPv6: az.getLocalServiceBackendPoolName(getServiceName(service), true),
 	}
 }
 
 // getBackendPoolIDsForService determine the expected backend pool IDs
 // by checking the external traffic policy of the service.
 func (az *Cloud) getBackendPoolIDsForService(service *v1.Service, clusterName, lbName string) map[bool]string {
-	if !isLocalService(service) || !az.useMultipleStandardLoadBalancers() {
+	if !az.useDedicatedBackendPool(service) {
 		return az.getBackendPoolIDs(clusterName, lbName)
 	}
 	return map[bool]string{
@@ -448,18 +777,20 @@ func (az *Cloud) getBackendPoolIDsForService(service *v1.Service, clusterName, l
 
 // getLocalServiceBackendPoolID gets the ID of the backend pool of a local service.
 func (az *Cloud) getLocalServiceBackendPoolID(serviceName string, lbName string, ipv6 bool) string {
-	return az.getBackendPoolID(lbName, getLocalServiceBackendPoolName(serviceName, ipv6))
+	return az.getBackendPoolID(lbName, az.getLocalServiceBackendPoolName(serviceName, ipv6))
 }
 
 // localServiceOwnsBackendPool checks if a backend pool is owned by a local service.
-func localServiceOwnsBackendPool(serviceName, bpName string) bool {
-	prefix := strings.Replace(serviceName, "/", "-", -1)
-	return strings.HasPrefix(strings.ToLower(bpName), strings.ToLower(prefix))
+func (az *Cloud) localServiceOwnsBackendPool(serviceName, bpName string) bool {
+	return az.getLocalServiceBackendPoolNameCandidates(serviceName).Has(strings.ToLower(bpName))
 }
 
 type serviceInfo struct {
 	ipFamily string
 	lbName   string
+	// preferredZone is the zone whose pods receive the new connections of the service
+	// if its pod IPs are in the backend pools. It is empty if all zones are preferred.
+	preferredZone string
 }
 
 func newServiceInfo(ipFamily, lbName string) *serviceInfo {
@@ -471,42 +802,200 @@ func newServiceInfo(ipFamily, lbName string) *serviceInfo {
 
 // getLocalServiceEndpointsNodeNames gets the node names that host all endpoints of the local service.
 func (az *Cloud) getLocalServiceEndpointsNodeNames(service *v1.Service) (sets.Set[string], error) {
-	var ep *discovery_v1.EndpointSlice
-	az.endpointSlicesCache.Range(func(key, value interface{}) bool {
-		endpointSlice := value.(*discovery_v1.EndpointSlice)
-		if strings.EqualFold(getServiceNameOfEndpointSlice(endpointSlice), service.Name) &&
-			strings.EqualFold(endpointSlice.Namespace, service.Namespace) {
-			ep = endpointSlice
-			return false
+	eps, err := az.getServiceEndpointSlices(service)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ep := range eps {
+		for _, endpoint := range ep.Endpoints {
+			klog.V(4).Infof("EndpointSlice %s/%s has endpoint %s on node %s", ep.Namespace, ep.Name, endpoint.Addresses, pointer.StringDeref(endpoint.NodeName, ""))
 		}
-		return true
-	})
-	if ep == nil {
+	}
+
+	return sets.New[string](getEndpointSlicesServingNodeNames(eps)...), nil
+}
+
+// getServiceEndpointSlices gets the EndpointSlices of the service from the cache, or lists
+// them if none is cached.
+func (az *Cloud) getServiceEndpointSlices(service *v1.Service) ([]*discovery_v1.EndpointSlice, error) {
+	eps := az.getCachedServiceEndpointSlices(service.Namespace, service.Name, "")
+	if len(eps) == 0 {
 		klog.Infof("EndpointSlice for service %s/%s not found, try to list EndpointSlices", service.Namespace, service.Name)
-		eps, err := az.KubeClient.DiscoveryV1().EndpointSlices(service.Namespace).List(context.Background(), metav1.ListOptions{})
+		epsList, err := az.KubeClient.DiscoveryV1().EndpointSlices(service.Namespace).List(context.Background(), metav1.ListOptions{})
 		if err != nil {
 			klog.Errorf("Failed to list EndpointSlices for service %s/%s: %s", service.Namespace, service.Name, err.Error())
 			return nil, err
 		}
-		for _, endpointSlice := range eps.Items {
-			endpointSlice := endpointSlice
-			if strings.EqualFold(getServiceNameOfEndpointSlice(&endpointSlice), service.Name) {
-				ep = &endpointSlice
-				break
+		for i := range epsList.Items {
+			if strings.EqualFold(getServiceNameOfEndpointSlice(&epsList.Items[i]), service.Name) {
+				eps = append(eps, &epsList.Items[i])
 			}
 		}
 	}
-	if ep == nil {
+	if len(eps) == 0 {
 		return nil, fmt.Errorf("failed to find EndpointSlice for service %s/%s", service.Namespace, service.Name)
 	}
+	return eps, nil
+}
+
+// getCachedServiceEndpointSlices returns the cached EndpointSlices of the service, except the one
+// named excludedName.
+func (az *Cloud) getCachedServiceEndpointSlices(namespace, serviceName, excludedName string) []*discovery_v1.EndpointSlice {
+	var eps []*discovery_v1.EndpointSlice
+	az.endpointSlicesCache.Range(func(key, value interface{}) bool {
+		endpointSlice := value.(*discovery_v1.EndpointSlice)
+		if strings.EqualFold(getServiceNameOfEndpointSlice(endpointSlice), serviceName) &&
+			strings.EqualFold(endpointSlice.Namespace, namespace) &&
+			!strings.EqualFold(endpointSlice.Name, excludedName) {
+			eps = append(eps, endpointSlice)
+		}
+		return true
+	})
+	return eps
+}
+
+// getEndpointSlicesServingNodeNames gets the names of the nodes that should receive
+// load balancer traffic for the endpoints in the EndpointSlices of a service. It follows
+// the semantics of kube-proxy for services with externalTrafficPolicy=Local: nodes
+// hosting ready endpoints are used, and only if there is no ready endpoint in any of
+// the EndpointSlices of the service, nodes hosting serving but terminating endpoints are
+// used so that the draining pods can still finish the in-flight connections. A nil
+// condition is regarded as true for ready and serving, and false for terminating.
+func getEndpointSlicesServingNodeNames(eps []*discovery_v1.EndpointSlice) []string {
+	var readyNodeNames, terminatingNodeNames []string
+	for _, es := range eps {
+		for _, endpoint := range es.Endpoints {
+			nodeName := pointer.StringDeref(endpoint.NodeName, "")
+			conditions := endpoint.Conditions
+			terminating := pointer.BoolDeref(conditions.Terminating, false)
+			if !terminating && pointer.BoolDeref(conditions.Ready, true) {
+				readyNodeNames = append(readyNodeNames, nodeName)
+				continue
+			}
+			if terminating && pointer.BoolDeref(conditions.Serving, true) {
+				terminatingNodeNames = append(terminatingNodeNames, nodeName)
+				continue
+			}
+			klog.V(4).Infof("getEndpointSlicesServingNodeNames: endpoint %s on node %s of EndpointSlice %s/%s is not serving, skip it",
+				endpoint.Addresses, nodeName, es.Namespace, es.Name)
+		}
+	}
+	if len(readyNodeNames) > 0 {
+		return readyNodeNames
+	}
+	return terminatingNodeNames
+}
 
-	var nodeNames []string
-	for _, endpoint := range ep.Endpoints {
-		klog.V(4).Infof("EndpointSlice %s/%s has endpoint %s on node %s", ep.Namespace, ep.Name, endpoint.Addresses, pointer.StringDeref(endpoint.NodeName, ""))
-		nodeNames = append(nodeNames, pointer.StringDeref(endpoint.NodeName, ""))
+// hasLocalServiceBackendPool checks if any of the load balancers has a dedicated backend pool of the service.
+func (az *Cloud) hasLocalServiceBackendPool(service *v1.Service, lbs *[]network.LoadBalancer) bool {
+	if lbs == nil {
+		return false
 	}
+	serviceName := getServiceName(service)
+	for _, lb := range *lbs {
+		if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+			continue
+		}
+		for _, bp := range *lb.BackendAddressPools {
+			if az.localServiceOwnsBackendPool(serviceName, pointer.StringDeref(bp.Name, "")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serviceRulesUseSharedBackendPool checks if any load balancing rule of the service
+// on the load balancer is using the shared backend pool of the cluster, which means
+// the service is switching its external traffic policy from Cluster to Local.
+func (az *Cloud) serviceRulesUseSharedBackendPool(service *v1.Service, lb *network.LoadBalancer, clusterName string) bool {
+	if lb == nil || lb.LoadBalancerPropertiesFormat == nil || lb.LoadBalancingRules == nil {
+		return false
+	}
+	sharedBackendPoolIDs := az.getBackendPoolIDs(clusterName, pointer.StringDeref(lb.Name, ""))
+	for _, rule := range *lb.LoadBalancingRules {
+		if !az.serviceOwnsRule(service, pointer.StringDeref(rule.Name, "")) ||
+			rule.LoadBalancingRulePropertiesFormat == nil ||
+			rule.BackendAddressPool == nil {
+			continue
+		}
+		bpID := pointer.StringDeref(rule.BackendAddressPool.ID, "")
+		if strings.EqualFold(bpID, sharedBackendPoolIDs[consts.IPVersionIPv4]) ||
+			strings.EqualFold(bpID, sharedBackendPoolIDs[consts.IPVersionIPv6]) {
+			return true
+		}
+	}
+	return false
+}
 
-	return sets.New[string](nodeNames...), nil
+// removeStaleLocalServiceBackendPools removes the backend pools owned by the local service
+// from the load balancer if their names are different from the expected ones, which happens
+// when the naming configurations of the dedicated backend pools are changed.
+func (az *Cloud) removeStaleLocalServiceBackendPools(service *v1.Service, lb *network.LoadBalancer, lbBackendPoolNames map[bool]string) bool {
+	if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+		return false
+	}
+
+	serviceName := getServiceName(service)
+	var removed bool
+	backendPools := make([]network.BackendAddressPool, 0, len(*lb.BackendAddressPools))
+	for _, bp := range *lb.BackendAddressPools {
+		bpName := pointer.StringDeref(bp.Name, "")
+		if found, _ := isLBBackendPoolsExisting(lbBackendPoolNames, bp.Name); !found && az.localServiceOwnsBackendPool(serviceName, bpName) {
+			klog.V(2).Infof("removeStaleLocalServiceBackendPools: removing backend pool %s of service %s from load balancer %s because it is renamed",
+				bpName, serviceName, pointer.StringDeref(lb.Name, ""))
+			removed = true
+			continue
+		}
+		backendPools = append(backendPools, bp)
+	}
+	if removed {
+		lb.BackendAddressPools = &backendPools
+	}
+	return removed
+}
+
+// prewarmLocalServiceBackendPool adds the IPs of the nodes hosting the endpoints
+// of a local service to its newly created backend pool. The backend pool is
+// created together with the load balancing rules, so without pre-warming the
+// traffic would be blackholed until the endpoint slices are synced.
+func (az *Cloud) prewarmLocalServiceBackendPool(service *v1.Service, backendPool *network.BackendAddressPool, isIPv6 bool) {
+	serviceName := getServiceName(service)
+	nodeNames, err := az.getLocalServiceEndpointsNodeNames(service)
+	if err != nil {
+		klog.V(2).Infof("prewarmLocalServiceBackendPool: failed to get the endpoints of service %s, the backend pool %s will be populated later: %s",
+			serviceName, pointer.StringDeref(backendPool.Name, ""), err.Error())
+		return
+	}
+
+	nodeIPsSet := sets.New[string]()
+	az.nodeCachesLock.RLock()
+	for nodeName := range nodeNames {
+		if az.shouldNodeExcludedFromLoadBalancer(nodeName) {
+			continue
+		}
+		for ip := range az.nodeTopology.getPrivateIPs(nodeName) {
+			if utilnet.IsIPv6String(ip) == isIPv6 {
+				nodeIPsSet.Insert(ip)
+			}
+		}
+	}
+	az.nodeCachesLock.RUnlock()
+	nodeIPs := sets.List(nodeIPsSet)
+	if len(nodeIPs) == 0 {
+		return
+	}
+
+	klog.V(2).Infof("prewarmLocalServiceBackendPool: adding %s to the backend pool %s of service %s",
+		strings.Join(nodeIPs, ","), pointer.StringDeref(backendPool.Name, ""), serviceName)
+	if backendPool.BackendAddressPoolPropertiesFormat == nil {
+		backendPool.BackendAddressPoolPropertiesFormat = &network.BackendAddressPoolPropertiesFormat{}
+	}
+	backendPool.VirtualNetwork = &network.SubResource{
+		ID: pointer.String(az.getVnetResourceID()),
+	}
+	_ = az.addNodeIPAddressesToBackendPool(backendPool, nodeIPs)
 }
 
 // cleanupLocalServiceBackendPool cleans up the backend pool of
@@ -524,7 +1013,7 @@ func (az *Cloud) cleanupLocalServiceBackendPool(
 			if lb.BackendAddressPools != nil {
 				for _, bp := range *lb.BackendAddressPools {
 					bpName := pointer.StringDeref(bp.Name, "")
-					if localServiceOwnsBackendPool(getServiceName(svc), bpName) {
+					if az.localServiceOwnsBackendPool(getServiceName(svc), bpName) {
 						if err := az.DeleteLBBackendPool(lbName, bpName); err != nil {
 							return nil, err
 						}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -558,13 +559,13 @@ func TestEndpointSlicesInformer(t *testing.T) {
 				},
 			}
 			cloud.localServiceNameToServiceInfoMap.Store("test/svc1", newServiceInfo(consts.IPVersionIPv4String, "lb1"))
-			cloud.nodePrivateIPs = map[string]sets.Set[string]{
-				"node1": sets.New[string]("10.0.0.1"),
-				"node2": sets.New[string]("10.0.0.2"),
-			}
+			cloud.nodeTopology.setPrivateIPs("node1", sets.New[string]("10.0.0.1"))
+			cloud.nodeTopology.setPrivateIPs("node2", sets.New[string]("10.0.0.2"))
 
 			existingBackendPool := getTestBackendAddressPoolWithIPs("lb1", "test-svc1", []string{"10.0.0.1"})
 			expectedBackendPool := getTestBackendAddressPoolWithIPs("lb1", "test-svc1", []string{"10.0.0.2"})
+			// the backend addresses are named after the nodes owning the IPs
+			(*expectedBackendPool.LoadBalancerBackendAddresses)[0].Name = pointer.String("node2")
 			mockLBClient := mockloadbalancerclient.NewMockInterface(ctrl)
 			mockLBClient.EXPECT().GetLBBackendPool(gomock.Any(), gomock.Any(), "lb1", "test-svc1", "").Return(existingBackendPool, nil).Times(tc.expectedGetBackendPoolCount)
 			mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), gomock.Any(), "lb1", "test-svc1", expectedBackendPool, "").Return(nil).Times(tc.expectedPutBackendPoolCount)
@@ -604,3 +605,482 @@ func TestGetBackendPoolNamesAndIDsForService(t *testing.T) {
 	_ = cloud.getBackendPoolNamesForService(&svc, "test")
 	_ = cloud.getBackendPoolIDsForService(&svc, "test", "lb")
 }
+
+func TestRepairLocalServiceBackendPools(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		name                string
+		existingIPs         []string
+		endpointNodeNames   []string
+		excludedNodeNames   []string
+		backendPoolNotFound bool
+		expectedOperations  []batchOperation
+		expectedCorrections int
+	}{
+		{
+			name:              "no drift",
+			existingIPs:       []string{"10.0.0.1"},
+			endpointNodeNames: []string{"node1"},
+		},
+		{
+			name:              "add missing IPs and remove unwanted ones",
+			existingIPs:       []string{"10.0.0.1"},
+			endpointNodeNames: []string{"node2", "node3"},
+			expectedOperations: []batchOperation{
+				getRemoveIPsFromBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.0.0.1"}),
+				getAddIPsToBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.0.0.2", "10.0.0.3"}),
+			},
+			expectedCorrections: 3,
+		},
+		{
+			name:              "remove the excluded nodes",
+			existingIPs:       []string{"10.0.0.1", "10.0.0.2"},
+			endpointNodeNames: []string{"node1", "node2"},
+			excludedNodeNames: []string{"node2"},
+			expectedOperations: []batchOperation{
+				getRemoveIPsFromBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.0.0.2"}),
+			},
+			expectedCorrections: 1,
+		},
+		{
+			name:                "skip if the backend pool is not found",
+			endpointNodeNames:   []string{"node1"},
+			backendPoolNotFound: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := GetTestCloud(ctrl)
+			cloud.localServiceNameToServiceInfoMap = sync.Map{}
+			cloud.localServiceNameToServiceInfoMap.Store("default/svc1", newServiceInfo(consts.IPVersionIPv4String, "lb1"))
+			cloud.nodeTopology.setPrivateIPs("node1", sets.New[string]("10.0.0.1"))
+			cloud.nodeTopology.setPrivateIPs("node2", sets.New[string]("10.0.0.2"))
+			cloud.nodeTopology.setPrivateIPs("node3", sets.New[string]("10.0.0.3"))
+			cloud.excludeLoadBalancerNodes = sets.New[string](tc.excludedNodeNames...)
+
+			svc := getTestService("svc1", v1.ProtocolTCP, nil, false)
+			client := fake.NewSimpleClientset(&svc)
+			informerFactory := informers.NewSharedInformerFactory(client, 0)
+			cloud.serviceLister = informerFactory.Core().V1().Services().Lister()
+			_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+			cloud.endpointSlicesCache = sync.Map{}
+			cloud.endpointSlicesCache.Store("default/eps1", getTestEndpointSlice("eps1", "default", "svc1", tc.endpointNodeNames...))
+
+			mockLBClient := mockloadbalancerclient.NewMockInterface(ctrl)
+			if tc.backendPoolNotFound {
+				mockLBClient.EXPECT().GetLBBackendPool(gomock.Any(), gomock.Any(), "lb1", "default-svc1", "").Return(network.BackendAddressPool{}, &retry.Error{HTTPStatusCode: http.StatusNotFound})
+			} else {
+				mockLBClient.EXPECT().GetLBBackendPool(gomock.Any(), gomock.Any(), "lb1", "default-svc1", "").Return(getTestBackendAddressPoolWithIPs("lb1", "default-svc1", tc.existingIPs), nil)
+			}
+			cloud.LoadBalancerClient = mockLBClient
+
+			u := newLoadBalancerBackendPoolUpdater(cloud, time.Second)
+			cloud.backendPoolUpdater = u
+
+			corrections := cloud.repairLocalServiceBackendPools(context.Background())
+			assert.Equal(t, tc.expectedCorrections, corrections)
+			if len(tc.expectedOperations) == 0 {
+				assert.Empty(t, u.operations)
+			} else {
+				assert.Equal(t, tc.expectedOperations, u.operations)
+			}
+		})
+	}
+}
+
+func TestUpdateLocalServiceBackendPoolsOfNode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		name               string
+		nodeName           string
+		wasExcluded        bool
+		excluded           bool
+		previousIPs        []string
+		expectedOperations []batchOperation
+	}{
+		{
+			name:     "remove the node excluded by the update",
+			nodeName: "node1",
+			excluded: true,
+			expectedOperations: []batchOperation{
+				getRemoveIPsFromBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.0.0.1"}),
+			},
+		},
+		{
+			name:        "add the node included by the update",
+			nodeName:    "node1",
+			wasExcluded: true,
+			expectedOperations: []batchOperation{
+				getAddIPsToBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.0.0.1"}),
+			},
+		},
+		{
+			name:        "skip if the exclusion is not changed",
+			nodeName:    "node1",
+			wasExcluded: true,
+			excluded:    true,
+		},
+		{
+			name:     "skip if the node does not host the endpoints",
+			nodeName: "node2",
+			excluded: true,
+		},
+		{
+			name:        "replace the changed IPs of the node",
+			nodeName:    "node1",
+			previousIPs: []string{"10.0.0.11", "fd00::1"},
+			expectedOperations: []batchOperation{
+				getRemoveIPsFromBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.0.0.11"}),
+				getAddIPsToBackendPoolOperation("default/svc1", "lb1", "default-svc1", []string{"10.0.0.1"}),
+			},
+		},
+		{
+			name:        "skip if the changed IPs are not of the IP family of the service",
+			nodeName:    "node1",
+			previousIPs: []string{"10.0.0.1", "fd00::11"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := GetTestCloud(ctrl)
+			cloud.localServiceNameToServiceInfoMap = sync.Map{}
+			cloud.localServiceNameToServiceInfoMap.Store("default/svc1", newServiceInfo(consts.IPVersionIPv4String, "lb1"))
+			cloud.nodeTopology.setPrivateIPs("node1", sets.New[string]("10.0.0.1", "fd00::1"))
+			cloud.nodeTopology.setPrivateIPs("node2", sets.New[string]("10.0.0.2"))
+			if tc.excluded {
+				cloud.excludeLoadBalancerNodes = sets.New[string](tc.nodeName)
+			}
+
+			svc := getTestService("svc1", v1.ProtocolTCP, nil, false)
+			client := fake.NewSimpleClientset(&svc)
+			informerFactory := informers.NewSharedInformerFactory(client, 0)
+			cloud.serviceLister = informerFactory.Core().V1().Services().Lister()
+			_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+			cloud.endpointSlicesCache = sync.Map{}
+			cloud.endpointSlicesCache.Store("default/eps1", getTestEndpointSlice("eps1", "default", "svc1", "node1"))
+
+			u := newLoadBalancerBackendPoolUpdater(cloud, time.Second)
+			cloud.backendPoolUpdater = u
+
+			previousIPs := tc.previousIPs
+			if previousIPs == nil {
+				previousIPs = sets.List(cloud.nodeTopology.getPrivateIPs(tc.nodeName))
+			}
+			cloud.updateLocalServiceBackendPoolsOfNode(tc.nodeName, tc.wasExcluded, previousIPs)
+			if len(tc.expectedOperations) == 0 {
+				assert.Empty(t, u.operations)
+			} else {
+				assert.Equal(t, tc.expectedOperations, u.operations)
+			}
+		})
+	}
+}
+
+func TestGetEndpointSlicesServingNodeNames(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		endpoints         []discovery_v1.Endpoint
+		otherEndpoints    []discovery_v1.Endpoint
+		expectedNodeNames []string
+	}{
+		{
+			name: "endpoints without conditions are regarded as ready",
+			endpoints: []discovery_v1.Endpoint{
+				{NodeName: pointer.String("node1")},
+				{NodeName: pointer.String("node2")},
+			},
+			expectedNodeNames: []string{"node1", "node2"},
+		},
+		{
+			name: "skip not ready and terminating endpoints if there are ready ones",
+			endpoints: []discovery_v1.Endpoint{
+				{NodeName: pointer.String("node1"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(true)}},
+				{NodeName: pointer.String("node2"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(false)}},
+				{NodeName: pointer.String("node3"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(false), Serving: pointer.Bool(true), Terminating: pointer.Bool(true)}},
+			},
+			expectedNodeNames: []string{"node1"},
+		},
+		{
+			name: "fall back to serving terminating endpoints if there is no ready one",
+			endpoints: []discovery_v1.Endpoint{
+				{NodeName: pointer.String("node1"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(false), Serving: pointer.Bool(false), Terminating: pointer.Bool(true)}},
+				{NodeName: pointer.String("node2"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(false)}},
+				{NodeName: pointer.String("node3"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(false), Serving: pointer.Bool(true), Terminating: pointer.Bool(true)}},
+			},
+			expectedNodeNames: []string{"node3"},
+		},
+		{
+			name: "skip terminating endpoints if there are ready ones in another EndpointSlice of the service",
+			endpoints: []discovery_v1.Endpoint{
+				{NodeName: pointer.String("node1"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(false), Serving: pointer.Bool(true), Terminating: pointer.Bool(true)}},
+			},
+			otherEndpoints: []discovery_v1.Endpoint{
+				{NodeName: pointer.String("node2"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(true)}},
+			},
+			expectedNodeNames: []string{"node2"},
+		},
+		{
+			name: "fall back to serving terminating endpoints in all EndpointSlices of the service",
+			endpoints: []discovery_v1.Endpoint{
+				{NodeName: pointer.String("node1"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(false), Serving: pointer.Bool(true), Terminating: pointer.Bool(true)}},
+			},
+			otherEndpoints: []discovery_v1.Endpoint{
+				{NodeName: pointer.String("node2"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(false), Serving: pointer.Bool(true), Terminating: pointer.Bool(true)}},
+			},
+			expectedNodeNames: []string{"node1", "node2"},
+		},
+		{
+			name: "no serving endpoints",
+			endpoints: []discovery_v1.Endpoint{
+				{NodeName: pointer.String("node1"), Conditions: discovery_v1.EndpointConditions{Ready: pointer.Bool(false)}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			es := getTestEndpointSlice("eps1", "default", "svc1")
+			es.Endpoints = tc.endpoints
+			eps := []*discovery_v1.EndpointSlice{es}
+			if tc.otherEndpoints != nil {
+				otherES := getTestEndpointSlice("eps2", "default", "svc1")
+				otherES.Endpoints = tc.otherEndpoints
+				eps = append(eps, otherES)
+			}
+			assert.Equal(t, tc.expectedNodeNames, getEndpointSlicesServingNodeNames(eps))
+		})
+	}
+}
+
+func TestPrewarmLocalServiceBackendPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		name          string
+		eps           *discovery_v1.EndpointSlice
+		isIPv6        bool
+		expectedIPs   []string
+		expectEmptyBP bool
+	}{
+		{
+			name:        "add the IPs of the nodes hosting the endpoints",
+			eps:         getTestEndpointSlice("eps1", "default", "svc1", "node1", "node2"),
+			expectedIPs: []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:        "only add the IPs of the same IP family",
+			eps:         getTestEndpointSlice("eps1", "default", "svc1", "node1", "node2"),
+			isIPv6:      true,
+			expectedIPs: []string{"fd00::1"},
+		},
+		{
+			name:          "leave the backend pool empty if the endpoint slice is not found",
+			expectEmptyBP: true,
+		},
+		{
+			name:        "skip the excluded nodes",
+			eps:         getTestEndpointSlice("eps1", "default", "svc1", "node1", "node2", "node3"),
+			expectedIPs: []string{"10.0.0.1", "10.0.0.2"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := GetTestCloud(ctrl)
+			cloud.nodeTopology.setPrivateIPs("node1", sets.New[string]("10.0.0.1", "fd00::1"))
+			cloud.nodeTopology.setPrivateIPs("node2", sets.New[string]("10.0.0.2"))
+			cloud.nodeTopology.setPrivateIPs("node3", sets.New[string]("10.0.0.3"))
+			cloud.excludeLoadBalancerNodes = sets.New[string]("node3")
+			cloud.endpointSlicesCache = sync.Map{}
+			if tc.eps != nil {
+				cloud.endpointSlicesCache.Store("default/eps1", tc.eps)
+			}
+			cloud.KubeClient = fake.NewSimpleClientset()
+
+			svc := getTestService("svc1", v1.ProtocolTCP, nil, false)
+			bp := network.BackendAddressPool{
+				Name:                               pointer.String("default-svc1"),
+				BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{},
+			}
+			cloud.prewarmLocalServiceBackendPool(&svc, &bp, tc.isIPv6)
+
+			if tc.expectEmptyBP {
+				assert.Nil(t, bp.LoadBalancerBackendAddresses)
+				assert.Nil(t, bp.VirtualNetwork)
+				return
+			}
+			var ips []string
+			for _, address := range *bp.LoadBalancerBackendAddresses {
+				ips = append(ips, pointer.StringDeref(address.IPAddress, ""))
+			}
+			assert.Equal(t, tc.expectedIPs, ips)
+			assert.Equal(t, cloud.getVnetResourceID(), pointer.StringDeref(bp.VirtualNetwork.ID, ""))
+		})
+	}
+}
+
+func TestGetLocalServiceBackendPoolName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	longName := "svc" + strings.Repeat("a", 58)
+	longNamespace := "a-long-namespace-name"
+	for _, tc := range []struct {
+		name           string
+		template       string
+		namingMode     string
+		serviceName    string
+		ipv6           bool
+		expectedBPName string
+	}{
+		{
+			name:           "default template",
+			serviceName:    "ns1/svc1",
+			expectedBPName: "ns1-svc1",
+		},
+		{
+			name:           "default template ipv6",
+			serviceName:    "ns1/svc1",
+			ipv6:           true,
+			expectedBPName: "ns1-svc1-ipv6",
+		},
+		{
+			name:           "custom template with hash",
+			template:       "local-{name}-{hash}",
+			serviceName:    "ns1/svc1",
+			expectedBPName: "local-svc1-" + MakeCRC32("ns1/svc1"),
+		},
+		{
+			name:           "long names are not truncated in compatible mode",
+			serviceName:    longNamespace + "/" + longName,
+			expectedBPName: longNamespace + "-" + longName,
+		},
+		{
+			name:           "long names are truncated with hash in hashed mode",
+			namingMode:     consts.ResourceNamingModeHashed,
+			serviceName:    longNamespace + "/" + longName,
+			ipv6:           true,
+			expectedBPName: (longNamespace + "-" + longName)[:consts.BackendPoolNameMaxLength-consts.IPFamilySuffixLength-len(MakeCRC32(longNamespace+"-"+longName))-1] + "-" + MakeCRC32(longNamespace+"-"+longName) + "-ipv6",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := GetTestCloud(ctrl)
+			cloud.LocalServiceBackendPoolNameTemplate = tc.template
+			cloud.ResourceNamingMode = tc.namingMode
+
+			bpName := cloud.getLocalServiceBackendPoolName(tc.serviceName, tc.ipv6)
+			assert.Equal(t, tc.expectedBPName, bpName)
+			if tc.namingMode == consts.ResourceNamingModeHashed {
+				assert.LessOrEqual(t, len(bpName), consts.BackendPoolNameMaxLength)
+			}
+			assert.True(t, cloud.localServiceOwnsBackendPool(tc.serviceName, bpName))
+		})
+	}
+}
+
+func TestLocalServiceOwnsBackendPoolOfPreviousTemplates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.LocalServiceBackendPoolNameTemplate = "new-{hash}"
+	oldBPName := renderLocalServiceBackendPoolName("old-{name}", false, "ns1/svc1", false)
+	assert.False(t, cloud.localServiceOwnsBackendPool("ns1/svc1", oldBPName))
+
+	cloud.PreviousLocalServiceBackendPoolNameTemplates = []string{"old-{name}"}
+	assert.True(t, cloud.localServiceOwnsBackendPool("ns1/svc1", oldBPName))
+	assert.True(t, cloud.localServiceOwnsBackendPool("ns1/svc1", oldBPName+"-ipv6"))
+	assert.True(t, cloud.localServiceOwnsBackendPool("ns1/svc1", "ns1-svc1"))
+	assert.False(t, cloud.localServiceOwnsBackendPool("ns1/svc2", oldBPName))
+}
+
+func TestRemoveStaleLocalServiceBackendPools(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.LocalServiceBackendPoolNameTemplate = "local-{hash}"
+	cloud.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	cloud.MultipleStandardLoadBalancerConfigurations = []MultipleStandardLoadBalancerConfiguration{{Name: "lb1"}}
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false)
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyLocal
+	lbBackendPoolNames := cloud.getBackendPoolNamesForService(&svc, "kubernetes")
+
+	lb := network.LoadBalancer{
+		Name: pointer.String("lb1"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{Name: pointer.String("kubernetes")},
+				{Name: pointer.String("default-svc1")},
+				{Name: pointer.String("default-svc10")},
+				{Name: pointer.String(cloud.getLocalServiceBackendPoolName("default/svc1", false))},
+			},
+		},
+	}
+
+	assert.True(t, cloud.removeStaleLocalServiceBackendPools(&svc, &lb, lbBackendPoolNames))
+	var bpNames []string
+	for _, bp := range *lb.BackendAddressPools {
+		bpNames = append(bpNames, pointer.StringDeref(bp.Name, ""))
+	}
+	assert.Equal(t, []string{"kubernetes", "default-svc10", "local-" + MakeCRC32("default/svc1")}, bpNames)
+	assert.False(t, cloud.removeStaleLocalServiceBackendPools(&svc, &lb, lbBackendPoolNames))
+}
+
+func TestHasLocalServiceBackendPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false)
+	lbs := []network.LoadBalancer{
+		{
+			Name: pointer.String("lb1"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				BackendAddressPools: &[]network.BackendAddressPool{
+					{Name: pointer.String("kubernetes")},
+					{Name: pointer.String("default-svc10")},
+				},
+			},
+		},
+		{Name: pointer.String("lb2")},
+	}
+	assert.False(t, cloud.hasLocalServiceBackendPool(&svc, nil))
+	assert.False(t, cloud.hasLocalServiceBackendPool(&svc, &lbs))
+
+	lbs[1].LoadBalancerPropertiesFormat = &network.LoadBalancerPropertiesFormat{
+		BackendAddressPools: &[]network.BackendAddressPool{
+			{Name: pointer.String("default-svc1-ipv6")},
+		},
+	}
+	assert.True(t, cloud.hasLocalServiceBackendPool(&svc, &lbs))
+}
+
+func TestServiceRulesUseSharedBackendPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	ruleName := cloud.getLoadBalancerRuleName(&svc, v1.ProtocolTCP, 80, false)
+	getLB := func(bpName string) *network.LoadBalancer {
+		return &network.LoadBalancer{
+			Name: pointer.String("lb1"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				LoadBalancingRules: &[]network.LoadBalancingRule{
+					{
+						Name: pointer.String(ruleName),
+						LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+							BackendAddressPool: &network.SubResource{
+								ID: pointer.String(cloud.getBackendPoolID("lb1", bpName)),
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	assert.False(t, cloud.serviceRulesUseSharedBackendPool(&svc, &network.LoadBalancer{Name: pointer.String("lb1")}, testClusterName))
+	assert.True(t, cloud.serviceRulesUseSharedBackendPool(&svc, getLB(testClusterName), testClusterName))
+	assert.False(t, cloud.serviceRulesUseSharedBackendPool(&svc, getLB("default-svc1"), testClusterName))
+}
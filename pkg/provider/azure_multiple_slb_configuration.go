@@ -0,0 +1,187 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// multipleStandardLoadBalancerConfigurationGVR is the resource of the MultipleStandardLoadBalancerConfiguration custom resources.
+var multipleStandardLoadBalancerConfigurationGVR = schema.GroupVersionResource{
+	Group:    consts.CustomResourceGroup,
+	Version:  consts.CustomResourceVersion,
+	Resource: consts.MultipleStandardLoadBalancerConfigurationResource,
+}
+
+// multipleStandardLoadBalancerConfigurationObject is a MultipleStandardLoadBalancerConfiguration custom resource,
+// named after the load balancer.
+type multipleStandardLoadBalancerConfigurationObject struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MultipleStandardLoadBalancerConfigurationSpec `json:"spec"`
+}
+
+// initMultipleStandardLoadBalancerConfigurationInformer watches the MultipleStandardLoadBalancerConfiguration custom
+// resources and applies them whenever they change. The configurations of the configuration file are used until the
+// custom resources are listed, and whenever there is no custom resource.
+func (az *Cloud) initMultipleStandardLoadBalancerConfigurationInformer(stop <-chan struct{}) error {
+	az.serviceReconcileLock.Lock()
+	az.fileMultipleStandardLoadBalancerConfigurations = make([]MultipleStandardLoadBalancerConfiguration, 0, len(az.MultipleStandardLoadBalancerConfigurations))
+	for _, multiSLBConfig := range az.MultipleStandardLoadBalancerConfigurations {
+		az.fileMultipleStandardLoadBalancerConfigurations = append(az.fileMultipleStandardLoadBalancerConfigurations, MultipleStandardLoadBalancerConfiguration{
+			Name: multiSLBConfig.Name,
+			MultipleStandardLoadBalancerConfigurationSpec: multiSLBConfig.MultipleStandardLoadBalancerConfigurationSpec,
+		})
+	}
+	az.serviceReconcileLock.Unlock()
+
+	namespace := az.MultipleStandardLoadBalancerConfigurationNamespace
+	informerFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(az.dynamicClient, 0, namespace, nil)
+	informer := informerFactory.ForResource(multipleStandardLoadBalancerConfigurationGVR)
+	syncConfigurations := func() {
+		objs, err := informer.Lister().ByNamespace(namespace).List(labels.Everything())
+		if err != nil {
+			klog.Errorf("initMultipleStandardLoadBalancerConfigurationInformer: failed to list the multiple standard load balancer configurations: %v", err)
+			return
+		}
+		if err := az.applyMultipleStandardLoadBalancerConfigurationObjects(objs); err != nil {
+			klog.Errorf("initMultipleStandardLoadBalancerConfigurationInformer: failed to apply the multiple standard load balancer configurations, keeping the current ones: %v", err)
+		}
+	}
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			syncConfigurations()
+		},
+		UpdateFunc: func(prevObj, obj interface{}) {
+			syncConfigurations()
+		},
+		DeleteFunc: func(obj interface{}) {
+			syncConfigurations()
+		},
+	})
+	if err != nil {
+		return err
+	}
+	informerFactory.Start(stop)
+	return nil
+}
+
+// applyMultipleStandardLoadBalancerConfigurationObjects replaces the multiple standard load balancer configurations
+// by the custom resources, or by the configurations of the configuration file if there is no custom resource.
+func (az *Cloud) applyMultipleStandardLoadBalancerConfigurationObjects(objs []runtime.Object) error {
+	var multiSLBConfigs []MultipleStandardLoadBalancerConfiguration
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return fmt.Errorf("unexpected object type %T", obj)
+		}
+		var configObj multipleStandardLoadBalancerConfigurationObject
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &configObj); err != nil {
+			return fmt.Errorf("failed to parse multiple standard load balancer configuration %s: %w", u.GetName(), err)
+		}
+		multiSLBConfigs = append(multiSLBConfigs, MultipleStandardLoadBalancerConfiguration{
+			Name: configObj.Name,
+			MultipleStandardLoadBalancerConfigurationSpec: configObj.Spec,
+		})
+	}
+	sort.Slice(multiSLBConfigs, func(i, j int) bool {
+		return multiSLBConfigs[i].Name < multiSLBConfigs[j].Name
+	})
+	if len(multiSLBConfigs) == 0 {
+		multiSLBConfigs = append(multiSLBConfigs, az.fileMultipleStandardLoadBalancerConfigurations...)
+	}
+
+	if err := az.validateMultipleStandardLoadBalancerConfigurations(multiSLBConfigs); err != nil {
+		return err
+	}
+	az.setMultipleStandardLoadBalancerConfigurations(multiSLBConfigs)
+	return nil
+}
+
+// setMultipleStandardLoadBalancerConfigurations replaces the multiple standard load balancer configurations between
+// the reconciliations. The active services of the remaining load balancers are kept, and so are their active nodes
+// unless the primary VMSet or the node selector changed, in which case the nodes are placed again by the next
+// reconciliation. The active services are recomputed by the next reconciliation of the services.
+func (az *Cloud) setMultipleStandardLoadBalancerConfigurations(multiSLBConfigs []MultipleStandardLoadBalancerConfiguration) {
+	az.serviceReconcileLock.Lock()
+	defer az.serviceReconcileLock.Unlock()
+
+	if isMultipleStandardLoadBalancerConfigurationSpecsEqual(az.MultipleStandardLoadBalancerConfigurations, multiSLBConfigs) {
+		return
+	}
+
+	az.multipleStandardLoadBalancersActiveServicesLock.Lock()
+	az.multipleStandardLoadBalancersActiveNodesLock.Lock()
+	releasedNodes := sets.New[string]()
+	for _, current := range az.MultipleStandardLoadBalancerConfigurations {
+		keepNodes := false
+		for i := range multiSLBConfigs {
+			if !strings.EqualFold(multiSLBConfigs[i].Name, current.Name) {
+				continue
+			}
+			multiSLBConfigs[i].ActiveServices = current.ActiveServices
+			if strings.EqualFold(multiSLBConfigs[i].PrimaryVMSet, current.PrimaryVMSet) &&
+				reflect.DeepEqual(multiSLBConfigs[i].NodeSelector, current.NodeSelector) {
+				multiSLBConfigs[i].ActiveNodes = current.ActiveNodes
+				keepNodes = true
+			}
+			break
+		}
+		if !keepNodes {
+			releasedNodes = releasedNodes.Union(current.ActiveNodes)
+		}
+	}
+	az.MultipleStandardLoadBalancerConfigurations = multiSLBConfigs
+	az.multipleStandardLoadBalancerConfigurationsSynced = false
+	az.multipleStandardLoadBalancersActiveNodesLock.Unlock()
+	az.multipleStandardLoadBalancersActiveServicesLock.Unlock()
+
+	for nodeName := range releasedNodes {
+		az.nodesWithCorrectLoadBalancerByPrimaryVMSet.Delete(nodeName)
+		az.setNodeLoadBalancerName(nodeName, "")
+	}
+	klog.V(2).Infof("setMultipleStandardLoadBalancerConfigurations: applied %d multiple standard load balancer configurations, %d nodes to be placed again", len(multiSLBConfigs), releasedNodes.Len())
+}
+
+// isMultipleStandardLoadBalancerConfigurationSpecsEqual returns true if the configurations have the same names and specs.
+func isMultipleStandardLoadBalancerConfigurationSpecsEqual(a, b []MultipleStandardLoadBalancerConfiguration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || !reflect.DeepEqual(a[i].MultipleStandardLoadBalancerConfigurationSpec, b[i].MultipleStandardLoadBalancerConfigurationSpec) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func getTestMultipleStandardLoadBalancerConfigurationObject(name, primaryVMSet string, nodeSelector map[string]interface{}) runtime.Object {
+	spec := map[string]interface{}{
+		"primaryVMSet": primaryVMSet,
+	}
+	if nodeSelector != nil {
+		spec["nodeSelector"] = map[string]interface{}{"matchLabels": nodeSelector}
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": consts.CustomResourceGroup + "/" + consts.CustomResourceVersion,
+		"kind":       "MultipleStandardLoadBalancerConfiguration",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "kube-system",
+		},
+		"spec": spec,
+	}}
+}
+
+func TestApplyMultipleStandardLoadBalancerConfigurationObjects(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIP
+	az.fileMultipleStandardLoadBalancerConfigurations = []MultipleStandardLoadBalancerConfiguration{
+		{Name: "kubernetes", MultipleStandardLoadBalancerConfigurationSpec: MultipleStandardLoadBalancerConfigurationSpec{PrimaryVMSet: "vmss-1"}},
+	}
+	az.MultipleStandardLoadBalancerConfigurations = []MultipleStandardLoadBalancerConfiguration{
+		{
+			Name: "kubernetes",
+			MultipleStandardLoadBalancerConfigurationSpec: MultipleStandardLoadBalancerConfigurationSpec{PrimaryVMSet: "vmss-1"},
+			MultipleStandardLoadBalancerConfigurationStatus: MultipleStandardLoadBalancerConfigurationStatus{
+				ActiveServices: sets.New[string]("default/svc1"),
+				ActiveNodes:    sets.New[string]("node1"),
+			},
+		},
+	}
+	az.nodesWithCorrectLoadBalancerByPrimaryVMSet.Store("node1", struct{}{})
+	az.multipleStandardLoadBalancerConfigurationsSynced = true
+
+	// the custom resources replace the configurations, keeping the status of the unchanged ones
+	err := az.applyMultipleStandardLoadBalancerConfigurationObjects([]runtime.Object{
+		getTestMultipleStandardLoadBalancerConfigurationObject("lb2", "vmss-2", map[string]interface{}{"pool": "lb2"}),
+		getTestMultipleStandardLoadBalancerConfigurationObject("kubernetes", "vmss-1", nil),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(az.MultipleStandardLoadBalancerConfigurations))
+	assert.Equal(t, "kubernetes", az.MultipleStandardLoadBalancerConfigurations[0].Name)
+	assert.Equal(t, sets.New[string]("default/svc1"), az.MultipleStandardLoadBalancerConfigurations[0].ActiveServices)
+	assert.Equal(t, sets.New[string]("node1"), az.MultipleStandardLoadBalancerConfigurations[0].ActiveNodes)
+	assert.Equal(t, "lb2", az.MultipleStandardLoadBalancerConfigurations[1].Name)
+	assert.Equal(t, "vmss-2", az.MultipleStandardLoadBalancerConfigurations[1].PrimaryVMSet)
+	assert.Equal(t, map[string]string{"pool": "lb2"}, az.MultipleStandardLoadBalancerConfigurations[1].NodeSelector.MatchLabels)
+	assert.False(t, az.multipleStandardLoadBalancerConfigurationsSynced)
+
+	// the invalid configurations are refused
+	err = az.applyMultipleStandardLoadBalancerConfigurationObjects([]runtime.Object{
+		getTestMultipleStandardLoadBalancerConfigurationObject("kubernetes", "vmss-1", nil),
+		getTestMultipleStandardLoadBalancerConfigurationObject("lb2", "vmss-1", nil),
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 2, len(az.MultipleStandardLoadBalancerConfigurations))
+
+	// the nodes are placed again if the primary VMSet changes
+	err = az.applyMultipleStandardLoadBalancerConfigurationObjects([]runtime.Object{
+		getTestMultipleStandardLoadBalancerConfigurationObject("kubernetes", "vmss-3", nil),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(az.MultipleStandardLoadBalancerConfigurations))
+	assert.Equal(t, sets.New[string]("default/svc1"), az.MultipleStandardLoadBalancerConfigurations[0].ActiveServices)
+	assert.Nil(t, az.MultipleStandardLoadBalancerConfigurations[0].ActiveNodes)
+	_, found := az.nodesWithCorrectLoadBalancerByPrimaryVMSet.Load("node1")
+	assert.False(t, found)
+
+	// the configurations of the configuration file are used without custom resources
+	err = az.applyMultipleStandardLoadBalancerConfigurationObjects(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(az.MultipleStandardLoadBalancerConfigurations))
+	assert.Equal(t, "vmss-1", az.MultipleStandardLoadBalancerConfigurations[0].PrimaryVMSet)
+	assert.Equal(t, sets.New[string]("default/svc1"), az.MultipleStandardLoadBalancerConfigurations[0].ActiveServices)
+	assert.Nil(t, az.fileMultipleStandardLoadBalancerConfigurations[0].ActiveServices)
+}
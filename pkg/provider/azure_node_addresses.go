@@ -0,0 +1,220 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+// NodeAddressChangeHandler is notified when the cached addresses of a node change. The current addresses are nil
+// if the node is removed. The handlers must not block, and must not modify the addresses.
+type NodeAddressChangeHandler func(nodeName types.NodeName, previous, current []v1.NodeAddress)
+
+// nodeAddressCache caches the addresses of the nodes returned by NodeAddresses, so that the repeated calls for the
+// same node within the TTL do not look up the VM or the instance metadata again. Only one entry is kept per node,
+// which expires lazily and is removed together with the node. The subscribers are notified when the addresses of a
+// cached node change or the node is removed.
+type nodeAddressCache struct {
+	lock     sync.RWMutex
+	ttl      time.Duration
+	entries  map[string]*nodeAddressEntry
+	handlers []NodeAddressChangeHandler
+	now      func() time.Time
+}
+
+type nodeAddressEntry struct {
+	addresses []v1.NodeAddress
+	expiresOn time.Time
+}
+
+func newNodeAddressCache(ttl time.Duration) *nodeAddressCache {
+	return &nodeAddressCache{
+		ttl:     ttl,
+		entries: make(map[string]*nodeAddressEntry),
+		now:     time.Now,
+	}
+}
+
+// subscribe registers the handler notified of the changes of the addresses.
+func (c *nodeAddressCache) subscribe(handler NodeAddressChangeHandler) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.handlers = append(c.handlers, handler)
+}
+
+// get returns a copy of the unexpired addresses of the node.
+func (c *nodeAddressCache) get(nodeName types.NodeName) ([]v1.NodeAddress, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	entry, ok := c.entries[strings.ToLower(string(nodeName))]
+	if !ok || c.now().After(entry.expiresOn) {
+		return nil, false
+	}
+	return append([]v1.NodeAddress{}, entry.addresses...), true
+}
+
+// set caches the addresses of the node, and notifies the subscribers if the previously cached addresses differ.
+func (c *nodeAddressCache) set(nodeName types.NodeName, addresses []v1.NodeAddress) {
+	c.lock.Lock()
+	key := strings.ToLower(string(nodeName))
+	var previous []v1.NodeAddress
+	entry, ok := c.entries[key]
+	if ok {
+		previous = entry.addresses
+	}
+	current := append([]v1.NodeAddress{}, addresses...)
+	c.entries[key] = &nodeAddressEntry{addresses: current, expiresOn: c.now().Add(c.ttl)}
+	handlers := c.handlers
+	c.lock.Unlock()
+
+	if ok && !nodeAddressesEqual(previous, current) {
+		klog.V(2).Infof("the addresses of the node %s are changed from %v to %v", nodeName, previous, current)
+		for _, handler := range handlers {
+			handler(nodeName, previous, current)
+		}
+	}
+}
+
+// delete removes the addresses of the node, and notifies the subscribers if the node was cached.
+func (c *nodeAddressCache) delete(nodeName types.NodeName) {
+	c.lock.Lock()
+	key := strings.ToLower(string(nodeName))
+	entry, ok := c.entries[key]
+	delete(c.entries, key)
+	handlers := c.handlers
+	c.lock.Unlock()
+
+	if ok {
+		for _, handler := range handlers {
+			handler(nodeName, entry.addresses, nil)
+		}
+	}
+}
+
+func nodeAddressesEqual(a, b []v1.NodeAddress) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func getInternalIPsFromNodeAddresses(addresses []v1.NodeAddress) []string {
+	ips := []string{}
+	for _, address := range addresses {
+		if address.Type == v1.NodeInternalIP {
+			ips = append(ips, address.Address)
+		}
+	}
+	return ips
+}
+
+// subscribeNodeAddressChanges registers the components interested in the changes of the addresses of the nodes.
+func (az *Cloud) subscribeNodeAddressChanges() {
+	if az.nodeAddressCache == nil {
+		return
+	}
+	az.nodeAddressCache.subscribe(az.updateNodePrivateIPsOnAddressChange)
+	az.nodeAddressCache.subscribe(az.updateRoutesOnAddressChange)
+}
+
+// updateNodePrivateIPsOnAddressChange updates the private IPs of the node before the node status is updated, so
+// that the stale private IPs in the backend pools are replaced earlier. The removed nodes are handled by the node
+// informer instead.
+func (az *Cloud) updateNodePrivateIPsOnAddressChange(nodeName types.NodeName, _, current []v1.NodeAddress) {
+	if current == nil {
+		return
+	}
+
+	az.nodeCachesLock.Lock()
+	defer az.nodeCachesLock.Unlock()
+
+	if !az.nodeNames.Has(string(nodeName)) {
+		return
+	}
+	az.updateNodePrivateIPs(string(nodeName), getInternalIPsFromNodeAddresses(current))
+}
+
+// updateRoutesOnAddressChange updates the next hops of the routes of the node to its current private IPs of the same
+// IP family. The routes of the removed nodes are deleted by the route controller instead.
+func (az *Cloud) updateRoutesOnAddressChange(nodeName types.NodeName, previous, current []v1.NodeAddress) {
+	if current == nil || az.routeUpdater == nil {
+		return
+	}
+	currentIPs := getInternalIPsFromNodeAddresses(current)
+	if sets.New(currentIPs...).Equal(sets.New(getInternalIPsFromNodeAddresses(previous)...)) {
+		return
+	}
+
+	routeTable, exists, err := az.getRouteTable(azcache.CacheReadTypeDefault)
+	if err != nil {
+		klog.Warningf("updateRoutesOnAddressChange(%s): failed to get the route table: %s", nodeName, err.Error())
+		return
+	}
+	if !exists || routeTable.RouteTablePropertiesFormat == nil || routeTable.Routes == nil {
+		return
+	}
+
+	for _, route := range *routeTable.Routes {
+		if route.RoutePropertiesFormat == nil || !strings.EqualFold(string(MapRouteNameToNodeName(az.ipv6DualStackEnabled, pointer.StringDeref(route.Name, ""))), string(nodeName)) {
+			continue
+		}
+		isIPv6 := utilnet.IsIPv6CIDRString(pointer.StringDeref(route.AddressPrefix, ""))
+		// the routes through the network virtual appliances do not depend on the node addresses.
+		if _, useNextHopIP, err := az.getRouteNextHopIPAddress(nodeName, isIPv6); useNextHopIP || err != nil {
+			continue
+		}
+		targetIP, err := findFirstIPByFamily(currentIPs, isIPv6)
+		if err != nil || strings.EqualFold(targetIP, pointer.StringDeref(route.NextHopIPAddress, "")) {
+			continue
+		}
+
+		klog.V(2).Infof("updateRoutesOnAddressChange: updating the next hop of route %s from %s to %s", pointer.StringDeref(route.Name, ""), pointer.StringDeref(route.NextHopIPAddress, ""), targetIP)
+		op := az.routeUpdater.addOperation(getAddRouteOperation(network.Route{
+			Name: route.Name,
+			RoutePropertiesFormat: &network.RoutePropertiesFormat{
+				AddressPrefix:    route.AddressPrefix,
+				NextHopType:      network.RouteNextHopTypeVirtualAppliance,
+				NextHopIPAddress: pointer.String(targetIP),
+			},
+		}))
+		go func(routeName string) {
+			if err := op.wait().err; err != nil {
+				klog.Errorf("updateRoutesOnAddressChange: failed to update route %s: %v", routeName, err)
+			}
+		}(pointer.StringDeref(route.Name, ""))
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/routetableclient/mockroutetableclient"
+)
+
+type nodeAddressChange struct {
+	nodeName          types.NodeName
+	previous, current []v1.NodeAddress
+}
+
+func TestNodeAddressCache(t *testing.T) {
+	now := time.Now()
+	c := newNodeAddressCache(time.Minute)
+	c.now = func() time.Time { return now }
+	var changes []nodeAddressChange
+	c.subscribe(func(nodeName types.NodeName, previous, current []v1.NodeAddress) {
+		changes = append(changes, nodeAddressChange{nodeName, previous, current})
+	})
+
+	addresses := []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.4"}, {Type: v1.NodeHostName, Address: "node1"}}
+	newAddresses := []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.5"}, {Type: v1.NodeHostName, Address: "node1"}}
+
+	// the first addresses of the node are not a change
+	_, ok := c.get("node1")
+	assert.False(t, ok)
+	c.set("node1", addresses)
+	cached, ok := c.get("NODE1")
+	assert.True(t, ok)
+	assert.Equal(t, addresses, cached)
+	cached[0].Address = "modified"
+	cached, _ = c.get("node1")
+	assert.Equal(t, addresses, cached)
+	assert.Empty(t, changes)
+
+	// the addresses expire after the TTL
+	now = now.Add(2 * time.Minute)
+	_, ok = c.get("node1")
+	assert.False(t, ok)
+
+	// the unchanged addresses are not notified
+	c.set("node1", addresses)
+	assert.Empty(t, changes)
+
+	// the changed addresses are notified
+	c.set("node1", newAddresses)
+	assert.Equal(t, []nodeAddressChange{{"node1", addresses, newAddresses}}, changes)
+
+	// the removal of the node is notified
+	c.delete("node1")
+	c.delete("node2")
+	assert.Equal(t, nodeAddressChange{"node1", newAddresses, nil}, changes[1])
+	assert.Equal(t, 2, len(changes))
+	_, ok = c.get("node1")
+	assert.False(t, ok)
+}
+
+func TestUpdateNodePrivateIPsOnAddressChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.nodeNames = sets.New("node1")
+	az.updateNodePrivateIPs("node1", []string{"10.0.0.4"})
+
+	az.updateNodePrivateIPsOnAddressChange("node1", nil, []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.5"}, {Type: v1.NodeHostName, Address: "node1"}})
+	assert.Equal(t, sets.New("10.0.0.5"), az.nodeTopology.getPrivateIPs("node1"))
+	assert.Equal(t, "node1", az.nodeTopology.nodeNamesByIP["10.0.0.5"])
+	assert.True(t, az.nodesWithStalePrivateIPs["node1"].ips.Has("10.0.0.4"))
+
+	// the unknown nodes are ignored
+	az.updateNodePrivateIPsOnAddressChange("node2", nil, []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.6"}})
+	assert.NotContains(t, az.nodeTopology.nodes, "node2")
+}
+
+type fakeBatchProcessor struct {
+	operations []batchOperation
+}
+
+func (f *fakeBatchProcessor) run(ctx context.Context) {}
+
+func (f *fakeBatchProcessor) addOperation(operation batchOperation) batchOperation {
+	f.operations = append(f.operations, operation)
+	return operation
+}
+
+func (f *fakeBatchProcessor) removeOperation(name string) {}
+
+func TestUpdateRoutesOnAddressChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.ipv6DualStackEnabled = true
+	routeUpdater := &fakeBatchProcessor{}
+	az.routeUpdater = routeUpdater
+	mockRTClient := az.RouteTablesClient.(*mockroutetableclient.MockInterface)
+	mockRTClient.EXPECT().Get(gomock.Any(), "rg", "rt", "").Return(network.RouteTable{
+		Name: pointer.String("rt"),
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{
+				{
+					Name: pointer.String(mapNodeNameToRouteName(true, "node1", "10.244.0.0/24")),
+					RoutePropertiesFormat: &network.RoutePropertiesFormat{
+						AddressPrefix:    pointer.String("10.244.0.0/24"),
+						NextHopIPAddress: pointer.String("10.0.0.4"),
+					},
+				},
+				{
+					Name: pointer.String(mapNodeNameToRouteName(true, "node1", "fd00::/64")),
+					RoutePropertiesFormat: &network.RoutePropertiesFormat{
+						AddressPrefix:    pointer.String("fd00::/64"),
+						NextHopIPAddress: pointer.String("fd01::4"),
+					},
+				},
+				{
+					Name: pointer.String(mapNodeNameToRouteName(true, "node2", "10.244.1.0/24")),
+					RoutePropertiesFormat: &network.RoutePropertiesFormat{
+						AddressPrefix:    pointer.String("10.244.1.0/24"),
+						NextHopIPAddress: pointer.String("10.0.0.4"),
+					},
+				},
+			},
+		},
+	}, nil)
+
+	previous := []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.4"}, {Type: v1.NodeInternalIP, Address: "fd01::4"}}
+	current := []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.5"}, {Type: v1.NodeInternalIP, Address: "fd01::4"}}
+
+	// the addresses other than the internal IPs are ignored
+	az.updateRoutesOnAddressChange("node1", previous, append(previous, v1.NodeAddress{Type: v1.NodeExternalIP, Address: "1.2.3.4"}))
+	assert.Empty(t, routeUpdater.operations)
+
+	// only the next hop of the IPv4 route of the node is updated
+	az.updateRoutesOnAddressChange("node1", previous, current)
+	assert.Equal(t, 1, len(routeUpdater.operations))
+	op := routeUpdater.operations[0].(*delayedRouteOperation)
+	assert.Equal(t, routeOperationAdd, op.operation)
+	assert.Equal(t, "10.244.0.0/24", pointer.StringDeref(op.route.AddressPrefix, ""))
+	assert.Equal(t, "10.0.0.5", pointer.StringDeref(op.route.NextHopIPAddress, ""))
+	op.result <- newBatchOperationResult("", false, nil)
+}
+
+func TestNodeAddressesFromCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.nodeAddressCache = newNodeAddressCache(time.Minute)
+	addresses := []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.4"}, {Type: v1.NodeHostName, Address: "node1"}}
+	az.nodeAddressCache.set("node1", addresses)
+
+	// the cached addresses are returned without looking up the VM
+	result, err := az.NodeAddresses(context.TODO(), "node1")
+	assert.NoError(t, err)
+	assert.Equal(t, addresses, result)
+}
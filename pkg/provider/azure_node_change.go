@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	servicecontroller "k8s.io/cloud-provider/controllers/service"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// nodeLoadBalancerLabels are the labels of the nodes read by the load balancer reconciliation.
+var nodeLoadBalancerLabels = []string{
+	v1.LabelNodeExcludeBalancers,
+	consts.ManagedByAzureLabel,
+	consts.InstanceProviderLabel,
+	consts.ExternalResourceGroupLabel,
+}
+
+// IsNodeChangeRelevantToLoadBalancers returns true if the update of the node may change the load balancers, i.e. the
+// exclusion of the node from the load balancers, the load balancer or node pool it is placed on by the configured
+// node selectors, its provider ID, backend NIC, addresses, readiness or deletion taint changed.
+func (az *Cloud) IsNodeChangeRelevantToLoadBalancers(prevNode, newNode *v1.Node) bool {
+	if prevNode == nil || newNode == nil {
+		return true
+	}
+
+	for _, label := range nodeLoadBalancerLabels {
+		prevValue, prevFound := prevNode.Labels[label]
+		newValue, newFound := newNode.Labels[label]
+		if prevFound != newFound || prevValue != newValue {
+			klog.V(4).Infof("IsNodeChangeRelevantToLoadBalancers: label %s of node %s changed", label, newNode.Name)
+			return true
+		}
+	}
+	if prevNode.Annotations[consts.NodeLoadBalancerBackendNICAnnotation] != newNode.Annotations[consts.NodeLoadBalancerBackendNICAnnotation] {
+		klog.V(4).Infof("IsNodeChangeRelevantToLoadBalancers: backend NIC of node %s changed", newNode.Name)
+		return true
+	}
+	if prevNode.Spec.ProviderID != newNode.Spec.ProviderID {
+		klog.V(4).Infof("IsNodeChangeRelevantToLoadBalancers: provider ID of node %s changed", newNode.Name)
+		return true
+	}
+	if !prevNode.DeletionTimestamp.Equal(newNode.DeletionTimestamp) ||
+		hasToBeDeletedTaint(prevNode) != hasToBeDeletedTaint(newNode) {
+		klog.V(4).Infof("IsNodeChangeRelevantToLoadBalancers: deletion of node %s changed", newNode.Name)
+		return true
+	}
+	if isNodeReady(prevNode) != isNodeReady(newNode) {
+		klog.V(4).Infof("IsNodeChangeRelevantToLoadBalancers: readiness of node %s changed", newNode.Name)
+		return true
+	}
+	if !sameContentInSlices(getNodeAddressStrings(prevNode), getNodeAddressStrings(newNode)) {
+		klog.V(4).Infof("IsNodeChangeRelevantToLoadBalancers: addresses of node %s changed", newNode.Name)
+		return true
+	}
+	if az.isNodeSelectedByLoadBalancerNodeExclusion(prevNode) != az.isNodeSelectedByLoadBalancerNodeExclusion(newNode) {
+		klog.V(4).Infof("IsNodeChangeRelevantToLoadBalancers: loadBalancerNodeExclusion of node %s changed", newNode.Name)
+		return true
+	}
+
+	var selectors []*metav1.LabelSelector
+	for _, multiSLBConfig := range az.MultipleStandardLoadBalancerConfigurations {
+		selectors = append(selectors, multiSLBConfig.NodeSelector)
+	}
+	for _, nodePoolOutboundConfig := range az.NodePoolOutboundConfigurations {
+		selectors = append(selectors, nodePoolOutboundConfig.NodeSelector)
+	}
+	for _, selector := range selectors {
+		if selector == nil {
+			continue
+		}
+		nodeSelector, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			// the selectors are validated when the configuration is loaded, so the error is not expected
+			klog.Errorf("IsNodeChangeRelevantToLoadBalancers: failed to parse node selector %q: %v", selector.String(), err)
+			return true
+		}
+		if nodeSelector.Matches(labels.Set(prevNode.Labels)) != nodeSelector.Matches(labels.Set(newNode.Labels)) {
+			klog.V(4).Infof("IsNodeChangeRelevantToLoadBalancers: node %s matches node selector %q differently", newNode.Name, selector.String())
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasToBeDeletedTaint returns true if the node is tainted for deletion by the cluster autoscaler.
+func hasToBeDeletedTaint(node *v1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == servicecontroller.ToBeDeletedTaint {
+			return true
+		}
+	}
+	return false
+}
+
+// getNodeAddressStrings returns the addresses of the node prefixed by their types.
+func getNodeAddressStrings(node *v1.Node) []string {
+	addresses := make([]string, 0, len(node.Status.Addresses))
+	for _, address := range node.Status.Addresses {
+		addresses = append(addresses, string(address.Type)+"/"+address.Address)
+	}
+	return addresses
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestIsNodeChangeRelevantToLoadBalancers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.MultipleStandardLoadBalancerConfigurations = []MultipleStandardLoadBalancerConfiguration{
+		{
+			Name: "lb",
+			MultipleStandardLoadBalancerConfigurationSpec: MultipleStandardLoadBalancerConfigurationSpec{
+				NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"lb": "true"}},
+			},
+		},
+	}
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: map[string]string{"app": "a"}},
+		Spec:       v1.NodeSpec{ProviderID: "azure:///vm"},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+			Addresses:  []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.4"}},
+		},
+	}
+
+	for _, tc := range []struct {
+		desc     string
+		update   func(node *v1.Node)
+		relevant bool
+	}{
+		{
+			desc:   "the changes of the other labels are irrelevant",
+			update: func(node *v1.Node) { node.Labels["app"] = "b" },
+		},
+		{
+			desc:   "the heartbeats are irrelevant",
+			update: func(node *v1.Node) { node.Status.Conditions[0].LastHeartbeatTime = metav1.Now() },
+		},
+		{
+			desc:     "the exclusion label is relevant",
+			update:   func(node *v1.Node) { node.Labels[v1.LabelNodeExcludeBalancers] = "" },
+			relevant: true,
+		},
+		{
+			desc:     "the label selected by the load balancer configuration is relevant",
+			update:   func(node *v1.Node) { node.Labels["lb"] = "true" },
+			relevant: true,
+		},
+		{
+			desc: "the backend NIC is relevant",
+			update: func(node *v1.Node) {
+				node.Annotations = map[string]string{consts.NodeLoadBalancerBackendNICAnnotation: "nic"}
+			},
+			relevant: true,
+		},
+		{
+			desc:     "the provider ID is relevant",
+			update:   func(node *v1.Node) { node.Spec.ProviderID = "azure:///vm2" },
+			relevant: true,
+		},
+		{
+			desc:     "the readiness is relevant",
+			update:   func(node *v1.Node) { node.Status.Conditions[0].Status = v1.ConditionFalse },
+			relevant: true,
+		},
+		{
+			desc:     "the addresses are relevant",
+			update:   func(node *v1.Node) { node.Status.Addresses[0].Address = "10.0.0.5" },
+			relevant: true,
+		},
+		{
+			desc:     "the deletion taint is relevant",
+			update:   func(node *v1.Node) { node.Spec.Taints = []v1.Taint{{Key: "ToBeDeletedByClusterAutoscaler"}} },
+			relevant: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			newNode := node.DeepCopy()
+			tc.update(newNode)
+			assert.Equal(t, tc.relevant, az.IsNodeChangeRelevantToLoadBalancers(node, newNode))
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	nodeutil "k8s.io/component-helpers/node/util"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/util/taints"
+)
+
+const (
+	// nodeDeallocatedCondition is the condition of the node reporting whether its VM is deallocated.
+	nodeDeallocatedCondition v1.NodeConditionType = "VMDeallocated"
+
+	nodeDeallocatedReason = "VMDeallocated"
+	nodeHibernatedReason  = "VMHibernated"
+	nodeStartedReason     = "VMStarted"
+)
+
+// updateNodeDeallocation excludes the node from the load balancers when its VM is deallocated or hibernated,
+// and includes the node again once the VM is started. The node lifecycle controller taints the node with
+// "node.cloudprovider.kubernetes.io/shutdown" while the VM is shut down, which is used to detect the transitions.
+func (az *Cloud) updateNodeDeallocation(node *v1.Node) {
+	if !az.PreserveDeallocatedNodes {
+		return
+	}
+	if node == nil {
+		klog.Warningf("node is nil, skip updating node deallocation (should not happen)")
+		return
+	}
+	if az.KubeClient == nil {
+		klog.Warningf("az.KubeClient is nil, skip updating node deallocation")
+		return
+	}
+
+	_, condition := nodeutil.GetNodeCondition(&node.Status, nodeDeallocatedCondition)
+	deallocated := condition != nil && condition.Status == v1.ConditionTrue
+	shutdown := taints.TaintExists(node.Spec.Taints, nodeShutdownTaint)
+
+	switch {
+	case shutdown && !deallocated:
+		unmanaged, err := az.IsNodeUnmanaged(node.Name)
+		if err != nil || unmanaged {
+			return
+		}
+		reason, err := az.getNodeDeallocatedReason(node.Name)
+		if err != nil {
+			klog.Errorf("updateNodeDeallocation: failed to get the power state of node %s: %v", node.Name, err)
+			return
+		}
+		if reason == "" {
+			klog.V(4).Infof("updateNodeDeallocation: node %s is shut down but its VM is not deallocated", node.Name)
+			return
+		}
+		if err := az.excludeDeallocatedNode(node, reason); err != nil {
+			klog.Errorf("updateNodeDeallocation: failed to exclude deallocated node %s from load balancers: %v", node.Name, err)
+		}
+	case !shutdown && deallocated:
+		if err := az.includeStartedNode(node); err != nil {
+			klog.Errorf("updateNodeDeallocation: failed to include started node %s in load balancers: %v", node.Name, err)
+		}
+	}
+}
+
+// getNodeDeallocatedReason returns the condition reason of the node if its VM is deallocated or hibernated,
+// or an empty string otherwise.
+func (az *Cloud) getNodeDeallocatedReason(nodeName string) (string, error) {
+	if az.VMSet == nil {
+		return "", fmt.Errorf("no credentials provided for Azure cloud provider")
+	}
+	powerState, err := az.VMSet.GetPowerStatusByNodeName(nodeName)
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(powerState) {
+	case vmPowerStateDeallocated, vmPowerStateDeallocating:
+		return nodeDeallocatedReason, nil
+	case vmPowerStateHibernated:
+		return nodeHibernatedReason, nil
+	default:
+		return "", nil
+	}
+}
+
+// excludeDeallocatedNode labels the node with "node.kubernetes.io/exclude-from-external-load-balancers", so that
+// the service controller removes it from the load balancers, and sets the deallocated condition. The label set by
+// the users is kept untouched.
+func (az *Cloud) excludeDeallocatedNode(node *v1.Node, reason string) error {
+	if _, found := node.Labels[v1.LabelNodeExcludeBalancers]; !found {
+		klog.V(2).Infof("excludeDeallocatedNode: excluding node %s from load balancers since its VM is deallocated", node.Name)
+		if err := az.patchNodeMetadata(node.Name, map[string]interface{}{
+			"labels":      map[string]interface{}{v1.LabelNodeExcludeBalancers: "true"},
+			"annotations": map[string]interface{}{consts.NodeExcludedWhileDeallocatedAnnotation: "true"},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nodeutil.SetNodeCondition(az.KubeClient, types.NodeName(node.Name), v1.NodeCondition{
+		Type:               nodeDeallocatedCondition,
+		Status:             v1.ConditionTrue,
+		Reason:             reason,
+		Message:            "The VM of the node is deallocated and the node is excluded from load balancers",
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// includeStartedNode removes the label added by excludeDeallocatedNode and clears the deallocated condition.
+func (az *Cloud) includeStartedNode(node *v1.Node) error {
+	if _, found := node.Annotations[consts.NodeExcludedWhileDeallocatedAnnotation]; found {
+		klog.V(2).Infof("includeStartedNode: including node %s in load balancers since its VM is started", node.Name)
+		if err := az.patchNodeMetadata(node.Name, map[string]interface{}{
+			"labels":      map[string]interface{}{v1.LabelNodeExcludeBalancers: nil},
+			"annotations": map[string]interface{}{consts.NodeExcludedWhileDeallocatedAnnotation: nil},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nodeutil.SetNodeCondition(az.KubeClient, types.NodeName(node.Name), v1.NodeCondition{
+		Type:               nodeDeallocatedCondition,
+		Status:             v1.ConditionFalse,
+		Reason:             nodeStartedReason,
+		Message:            "The VM of the node is started",
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// patchNodeMetadata patches the metadata of the node with a merge patch. A nil value removes the key.
+func (az *Cloud) patchNodeMetadata(nodeName string, metadata map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return fmt.Errorf("failed to marshal the metadata patch: %w", err)
+	}
+	if _, err := az.KubeClient.CoreV1().Nodes().Patch(context.TODO(), nodeName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to patch node %s: %w", nodeName, err)
+	}
+	return nil
+}
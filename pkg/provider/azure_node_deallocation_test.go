@@ -0,0 +1,155 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	nodeutil "k8s.io/component-helpers/node/util"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestUpdateNodeDeallocation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	deallocatedCondition := func(status v1.ConditionStatus) []v1.NodeCondition {
+		return []v1.NodeCondition{{Type: nodeDeallocatedCondition, Status: status}}
+	}
+	tests := []struct {
+		desc                string
+		disabled            bool
+		node                *v1.Node
+		powerState          string
+		expectedExcluded    bool
+		expectedAnnotated   bool
+		expectedCondition   v1.ConditionStatus
+		expectedReason      string
+		expectPowerStateGet bool
+	}{
+		{
+			desc: "should do nothing if the mode is disabled",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node"},
+				Spec:       v1.NodeSpec{Taints: []v1.Taint{*nodeShutdownTaint}},
+			},
+			disabled: true,
+		},
+		{
+			desc: "should exclude the shut down node of the deallocated VM",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node"},
+				Spec:       v1.NodeSpec{Taints: []v1.Taint{*nodeShutdownTaint}},
+			},
+			powerState:          vmPowerStateDeallocated,
+			expectPowerStateGet: true,
+			expectedExcluded:    true,
+			expectedAnnotated:   true,
+			expectedCondition:   v1.ConditionTrue,
+			expectedReason:      nodeDeallocatedReason,
+		},
+		{
+			desc: "should keep the exclude label set by the users when the VM is hibernated",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: map[string]string{v1.LabelNodeExcludeBalancers: ""}},
+				Spec:       v1.NodeSpec{Taints: []v1.Taint{*nodeShutdownTaint}},
+			},
+			powerState:          vmPowerStateHibernated,
+			expectPowerStateGet: true,
+			expectedExcluded:    true,
+			expectedCondition:   v1.ConditionTrue,
+			expectedReason:      nodeHibernatedReason,
+		},
+		{
+			desc: "should not exclude the shut down node of the stopped VM",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node"},
+				Spec:       v1.NodeSpec{Taints: []v1.Taint{*nodeShutdownTaint}},
+			},
+			powerState:          vmPowerStateStopped,
+			expectPowerStateGet: true,
+		},
+		{
+			desc: "should include the node again once the VM is started",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "node",
+					Labels:      map[string]string{v1.LabelNodeExcludeBalancers: "true"},
+					Annotations: map[string]string{consts.NodeExcludedWhileDeallocatedAnnotation: "true"},
+				},
+				Status: v1.NodeStatus{Conditions: deallocatedCondition(v1.ConditionTrue)},
+			},
+			expectedCondition: v1.ConditionFalse,
+			expectedReason:    nodeStartedReason,
+		},
+		{
+			desc: "should not touch the deallocated node which is still shut down",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "node",
+					Labels:      map[string]string{v1.LabelNodeExcludeBalancers: "true"},
+					Annotations: map[string]string{consts.NodeExcludedWhileDeallocatedAnnotation: "true"},
+				},
+				Spec:   v1.NodeSpec{Taints: []v1.Taint{*nodeShutdownTaint}},
+				Status: v1.NodeStatus{Conditions: deallocatedCondition(v1.ConditionTrue)},
+			},
+			expectedExcluded:  true,
+			expectedAnnotated: true,
+			expectedCondition: v1.ConditionTrue,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.PreserveDeallocatedNodes = !test.disabled
+			mockVMSet := NewMockVMSet(ctrl)
+			if test.expectPowerStateGet {
+				mockVMSet.EXPECT().GetPowerStatusByNodeName("node").Return(test.powerState, nil)
+			}
+			az.VMSet = mockVMSet
+			cs := fake.NewSimpleClientset(test.node)
+			az.KubeClient = cs
+
+			az.updateNodeDeallocation(test.node)
+
+			node, err := cs.CoreV1().Nodes().Get(context.Background(), "node", metav1.GetOptions{})
+			assert.NoError(t, err)
+			_, excluded := node.Labels[v1.LabelNodeExcludeBalancers]
+			assert.Equal(t, test.expectedExcluded, excluded)
+			_, annotated := node.Annotations[consts.NodeExcludedWhileDeallocatedAnnotation]
+			assert.Equal(t, test.expectedAnnotated, annotated)
+			_, condition := nodeutil.GetNodeCondition(&node.Status, nodeDeallocatedCondition)
+			if test.expectedCondition == "" {
+				assert.Nil(t, condition)
+				return
+			}
+			assert.Equal(t, test.expectedCondition, condition.Status)
+			if test.expectedReason != "" {
+				assert.Equal(t, test.expectedReason, condition.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+)
+
+// isNodeSelectedByLoadBalancerNodeExclusion returns true if the node matches the node selector or has any of the
+// taints of LoadBalancerNodeExclusion.
+func (az *Cloud) isNodeSelectedByLoadBalancerNodeExclusion(node *v1.Node) bool {
+	if az.LoadBalancerNodeExclusion == nil {
+		return false
+	}
+	if az.loadBalancerNodeExclusionSelector != nil && az.loadBalancerNodeExclusionSelector.Matches(labels.Set(node.Labels)) {
+		return true
+	}
+	if len(az.LoadBalancerNodeExclusion.TaintKeys) > 0 {
+		taintKeys := sets.New(az.LoadBalancerNodeExclusion.TaintKeys...)
+		for _, taint := range node.Spec.Taints {
+			if taintKeys.Has(taint.Key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runLoadBalancerNodeExclusionLoop periodically removes the nodes newly excluded by LoadBalancerNodeExclusion from
+// the IP-based backend pools.
+func (az *Cloud) runLoadBalancerNodeExclusionLoop(ctx context.Context, interval time.Duration) {
+	klog.V(2).Info("runLoadBalancerNodeExclusionLoop: started")
+	err := wait.PollUntilContextCancel(ctx, interval, false, func(ctx context.Context) (bool, error) {
+		if _, err := az.removeNewlyExcludedNodesFromBackendPools(); err != nil {
+			klog.Warningf("runLoadBalancerNodeExclusionLoop: failed to remove the excluded nodes from the backend pools: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runLoadBalancerNodeExclusionLoop: stopped due to %s", err.Error())
+}
+
+// removeNewlyExcludedNodesFromBackendPools removes the IP addresses of the nodes excluded from LoadBalancer since the
+// last run from the backend pools of the load balancers. The nodes are retried in the next run if any backend pool
+// fails to be updated. It returns the number of backend pools updated.
+func (az *Cloud) removeNewlyExcludedNodesFromBackendPools() (int, error) {
+	az.nodeCachesLock.Lock()
+	nodeNames := az.newlyExcludedNodes
+	az.newlyExcludedNodes = nil
+	var nodeIPs []string
+	for nodeName := range nodeNames {
+		// The node may be included again before the removal.
+		if az.excludeLoadBalancerNodes.Has(nodeName) {
+			nodeIPs = append(nodeIPs, sets.List(az.nodeTopology.getPrivateIPs(nodeName))...)
+		}
+	}
+	az.nodeCachesLock.Unlock()
+	if len(nodeIPs) == 0 {
+		return 0, nil
+	}
+
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		az.requeueNewlyExcludedNodes(nodeNames)
+		return 0, err
+	}
+	var updated int
+	var errs []error
+	for _, lb := range lbs {
+		if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+			continue
+		}
+		lbName := pointer.StringDeref(lb.Name, "")
+		for _, bp := range *lb.BackendAddressPools {
+			if !removeNodeIPAddressesFromBackendPool(bp, nodeIPs, false, az.useMultipleStandardLoadBalancers()) {
+				continue
+			}
+			klog.V(2).Infof("removeNewlyExcludedNodesFromBackendPools: removing the excluded nodes from the backend pool %s of the load balancer %s", pointer.StringDeref(bp.Name, ""), lbName)
+			removeExcludedNodeIPs := func(latest *network.BackendAddressPool) bool {
+				return removeNodeIPAddressesFromBackendPool(*latest, nodeIPs, false, az.useMultipleStandardLoadBalancers())
+			}
+			if err := az.updateLBBackendPoolAddresses(lbName, bp, removeExcludedNodeIPs); err != nil {
+				errs = append(errs, fmt.Errorf("failed to update the backend pool %s of the load balancer %s: %w", pointer.StringDeref(bp.Name, ""), lbName, err))
+				continue
+			}
+			updated++
+		}
+	}
+	if len(errs) > 0 {
+		az.requeueNewlyExcludedNodes(nodeNames)
+	}
+	return updated, utilerrors.NewAggregate(errs)
+}
+
+// requeueNewlyExcludedNodes adds the nodes back to newlyExcludedNodes so that they are removed from the backend pools
+// in the next run.
+func (az *Cloud) requeueNewlyExcludedNodes(nodeNames sets.Set[string]) {
+	az.nodeCachesLock.Lock()
+	defer az.nodeCachesLock.Unlock()
+
+	if az.newlyExcludedNodes == nil {
+		az.newlyExcludedNodes = sets.New[string]()
+	}
+	for nodeName := range nodeNames {
+		if az.excludeLoadBalancerNodes.Has(nodeName) {
+			az.newlyExcludedNodes.Insert(nodeName)
+		}
+	}
+}
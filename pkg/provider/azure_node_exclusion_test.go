@@ -0,0 +1,141 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestUpdateNodeCachesWithLoadBalancerNodeExclusion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.nodeNames = sets.New[string]()
+	az.LoadBalancerNodeExclusion = &LoadBalancerNodeExclusionConfig{TaintKeys: []string{"infra"}}
+	az.loadBalancerNodeExclusionSelector = labels.SelectorFromSet(labels.Set{"role": "infra"})
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	az.updateNodeCaches(nil, node)
+	assert.False(t, az.excludeLoadBalancerNodes.Has("node"))
+
+	// A node excluded by the update is removed from the backend pools separately.
+	labeledNode := node.DeepCopy()
+	labeledNode.Labels = map[string]string{"role": "infra"}
+	az.updateNodeCaches(node, labeledNode)
+	assert.True(t, az.excludeLoadBalancerNodes.Has("node"))
+	assert.True(t, az.newlyExcludedNodes.Has("node"))
+
+	// A node included again is not removed.
+	az.updateNodeCaches(labeledNode, node)
+	assert.False(t, az.excludeLoadBalancerNodes.Has("node"))
+	assert.False(t, az.newlyExcludedNodes.Has("node"))
+
+	taintedNode := node.DeepCopy()
+	taintedNode.Spec.Taints = []v1.Taint{{Key: "infra", Effect: v1.TaintEffectNoSchedule}}
+	az.updateNodeCaches(node, taintedNode)
+	assert.True(t, az.excludeLoadBalancerNodes.Has("node"))
+	assert.True(t, az.newlyExcludedNodes.Has("node"))
+
+	// A node excluded when it is added is not in the backend pools yet.
+	az.updateNodeCaches(nil, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"role": "infra"}}})
+	assert.True(t, az.excludeLoadBalancerNodes.Has("node1"))
+	assert.False(t, az.newlyExcludedNodes.Has("node1"))
+}
+
+func TestRemoveNewlyExcludedNodesFromBackendPools(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.excludeLoadBalancerNodes = sets.New("node1", "node2")
+	az.newlyExcludedNodes = sets.New("node1", "node3")
+	az.nodeTopology.setPrivateIPs("node1", sets.New("10.0.0.1"))
+	az.nodeTopology.setPrivateIPs("node2", sets.New("10.0.0.2"))
+	az.nodeTopology.setPrivateIPs("node3", sets.New("10.0.0.3"))
+
+	newBackendPool := func(name string, ips ...string) network.BackendAddressPool {
+		addresses := make([]network.LoadBalancerBackendAddress, 0, len(ips))
+		for _, ip := range ips {
+			addresses = append(addresses, network.LoadBalancerBackendAddress{
+				LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String(ip)},
+			})
+		}
+		return network.BackendAddressPool{
+			Name: pointer.String(name),
+			BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+				LoadBalancerBackendAddresses: &addresses,
+			},
+		}
+	}
+	newLBs := func() []network.LoadBalancer {
+		return []network.LoadBalancer{
+			{
+				Name: pointer.String("lb"),
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					BackendAddressPools: &[]network.BackendAddressPool{
+						newBackendPool("bp1", "10.0.0.1", "10.0.0.3", "10.0.0.4"),
+						newBackendPool("bp2", "10.0.0.2", "10.0.0.3"),
+					},
+				},
+			},
+		}
+	}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").DoAndReturn(func(_, _ interface{}) ([]network.LoadBalancer, *retry.Error) {
+		return newLBs(), nil
+	}).Times(2)
+	mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), "rg", "lb", "bp1", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_, _, _, _ interface{}, bp network.BackendAddressPool, _ interface{}) *retry.Error {
+			// node3 is not excluded any more, and node2 has been removed by the reconciliation of the services.
+			assert.Equal(t, []network.LoadBalancerBackendAddress{
+				{LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String("10.0.0.3")}},
+				{LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String("10.0.0.4")}},
+			}, *bp.LoadBalancerBackendAddresses)
+			return &retry.Error{HTTPStatusCode: http.StatusInternalServerError}
+		}).Times(1)
+
+	// The nodes are retried if the backend pool fails to be updated.
+	updated, err := az.removeNewlyExcludedNodesFromBackendPools()
+	assert.Error(t, err)
+	assert.Equal(t, 0, updated)
+	assert.Equal(t, sets.New("node1"), az.newlyExcludedNodes)
+
+	mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), "rg", "lb", "bp1", gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	updated, err = az.removeNewlyExcludedNodesFromBackendPools()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+	assert.Empty(t, az.newlyExcludedNodes)
+
+	// Nothing is listed if no node is newly excluded.
+	updated, err = az.removeNewlyExcludedNodesFromBackendPools()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updated)
+}
@@ -0,0 +1,387 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// checkNodePoolOutboundConfigurations returns an error if the node pool outbound configurations are not supported
+// by the load balancer settings, or are malformed.
+func (az *Cloud) checkNodePoolOutboundConfigurations() error {
+	if !az.useStandardLoadBalancer() {
+		return fmt.Errorf("nodePoolOutboundConfigurations is only supported by the standard load balancer")
+	}
+	if !az.useNodeIPBackendPool() {
+		return fmt.Errorf("nodePoolOutboundConfigurations is only supported by the node IP-based backend pool types, e.g., %s", consts.LoadBalancerBackendPoolConfigurationTypeNodeIP)
+	}
+	if az.useNATGatewayOutbound() {
+		return fmt.Errorf("nodePoolOutboundConfigurations should not be set when outboundType is %s", consts.OutboundTypeNATGateway)
+	}
+	// The load balancing rules must disable the outbound SNAT if the nodes are referenced by an outbound rule.
+	if !az.disableLoadBalancerOutboundSNAT() {
+		return fmt.Errorf("nodePoolOutboundConfigurations requires disableOutboundSNAT to be true")
+	}
+
+	names := sets.New[string]()
+	for i := range az.NodePoolOutboundConfigurations {
+		config := &az.NodePoolOutboundConfigurations[i]
+		switch {
+		case config.Name == "":
+			return fmt.Errorf("node pool outbound configuration %d must have a name", i)
+		case strings.EqualFold(config.Name, v6Suffix):
+			return fmt.Errorf("node pool outbound configuration name %s is reserved for the IPv6 outbound rules", config.Name)
+		case names.Has(strings.ToLower(config.Name)):
+			return fmt.Errorf("duplicated node pool outbound configuration name %s", config.Name)
+		case config.NodeSelector == nil:
+			return fmt.Errorf("node pool outbound configuration %s must have a node selector", config.Name)
+		case config.PublicIPPrefixID == "":
+			return fmt.Errorf("node pool outbound configuration %s must have a public IP prefix ID", config.Name)
+		case config.AllocatedOutboundPorts < 0 || config.AllocatedOutboundPorts > 64000 || config.AllocatedOutboundPorts%8 != 0:
+			return fmt.Errorf("allocatedOutboundPorts %d of node pool outbound configuration %s must be a multiple of 8 between 0 and 64000", config.AllocatedOutboundPorts, config.Name)
+		case config.IdleTimeoutInMinutes != 0 && (config.IdleTimeoutInMinutes < 4 || config.IdleTimeoutInMinutes > 120):
+			return fmt.Errorf("idleTimeoutInMinutes %d of node pool outbound configuration %s must be between 4 and 120", config.IdleTimeoutInMinutes, config.Name)
+		case config.MaxAllocatedOutboundPorts < 0 || config.MaxAllocatedOutboundPorts > 64000 || config.MaxAllocatedOutboundPorts%8 != 0:
+			return fmt.Errorf("maxAllocatedOutboundPorts %d of node pool outbound configuration %s must be a multiple of 8 between 0 and 64000", config.MaxAllocatedOutboundPorts, config.Name)
+		case config.MaxAllocatedOutboundPorts != 0 && config.MaxAllocatedOutboundPorts < config.AllocatedOutboundPorts:
+			return fmt.Errorf("maxAllocatedOutboundPorts %d of node pool outbound configuration %s must not be less than allocatedOutboundPorts %d", config.MaxAllocatedOutboundPorts, config.Name, config.AllocatedOutboundPorts)
+		}
+		for _, prefixID := range config.AdditionalPublicIPPrefixIDs {
+			if prefixID == "" || strings.EqualFold(prefixID, config.PublicIPPrefixID) {
+				return fmt.Errorf("additional public IP prefix ID %q of node pool outbound configuration %s must not be empty or the public IP prefix ID", prefixID, config.Name)
+			}
+		}
+		if _, err := metav1.LabelSelectorAsSelector(config.NodeSelector); err != nil {
+			return fmt.Errorf("invalid node selector of node pool outbound configuration %s: %w", config.Name, err)
+		}
+		if config.IdleTimeoutInMinutes == 0 {
+			config.IdleTimeoutInMinutes = consts.DefaultIPv6OutboundIdleTimeoutInMinutes
+		}
+		names.Insert(strings.ToLower(config.Name))
+	}
+	return nil
+}
+
+// getNodePoolOutboundName returns the name of the outbound rule, the frontend IP configuration and the backend pool
+// of the node pool outbound configuration on the load balancer.
+func getNodePoolOutboundName(lbName, configName string) string {
+	return lbName + consts.OutboundNameInfix + configName
+}
+
+// getNodePoolOutboundAdditionalName returns the name of the frontend IP configuration of the additional public IP
+// prefix of the node pool outbound rule at the index.
+func getNodePoolOutboundAdditionalName(name string, index int) string {
+	return fmt.Sprintf("%s%s%d", name, consts.NodePoolOutboundAdditionalNameInfix, index+1)
+}
+
+// reconcileNodePoolOutboundRules ensures the outbound rule, the frontend IP configuration and the backend pool of
+// each node pool outbound configuration on the external load balancer with the frontend IP configurations of the
+// services, and removes those of the configurations no longer existing. The members of the backend pools are not
+// changed if nodes is nil. It returns true if the load balancer is changed.
+func (az *Cloud) reconcileNodePoolOutboundRules(lb *network.LoadBalancer, nodes []*v1.Node) (bool, error) {
+	if lb == nil || lb.LoadBalancerPropertiesFormat == nil || isInternalLoadBalancer(lb) {
+		return false, nil
+	}
+	lbName := pointer.StringDeref(lb.Name, "")
+
+	var changed bool
+	expectedNames := sets.New[string]()
+	if az.useStandardLoadBalancer() && az.useNodeIPBackendPool() && hasServiceFrontendIPConfigs(lb) {
+		var nodeIPs map[string]map[string]string
+		if nodes != nil {
+			var err error
+			if nodeIPs, err = az.getNodePoolOutboundNodeIPs(lbName, nodes); err != nil {
+				return false, err
+			}
+		}
+
+		for _, config := range az.NodePoolOutboundConfigurations {
+			name := getNodePoolOutboundName(lbName, config.Name)
+			expectedNames.Insert(strings.ToLower(name))
+
+			backendPoolID := az.getBackendPoolID(lbName, name)
+			if az.ensureOutboundBackendPool(lb, name, backendPoolID, nodeIPs[config.Name], nodes != nil) {
+				changed = true
+			}
+
+			// keep the SNAT exhaustion mitigations applied to the outbound rule
+			allocatedOutboundPorts, additionalPrefixes := az.getNodePoolOutboundMitigations(lb, config)
+			for i := 0; i < additionalPrefixes; i++ {
+				expectedNames.Insert(strings.ToLower(getNodePoolOutboundAdditionalName(name, i)))
+			}
+			if az.ensureNodePoolOutboundRule(lb, config, allocatedOutboundPorts, additionalPrefixes) {
+				klog.V(2).Infof("reconcileNodePoolOutboundRules: updating the outbound rule %s of the load balancer %s", name, lbName)
+				changed = true
+			}
+		}
+	}
+
+	// Remove the outbound rules of the configurations no longer existing, or all of them if the load balancer
+	// has no frontend IP configurations of the services, so that it can be deleted.
+	staleNames := sets.New[string]()
+	ipv6OutboundName := strings.ToLower(getIPv6OutboundName(lbName))
+	collectStaleName := func(name *string) {
+		lowerName := strings.ToLower(pointer.StringDeref(name, ""))
+		if isManagedOutboundResourceName(lbName, lowerName) && lowerName != ipv6OutboundName && !expectedNames.Has(lowerName) {
+			staleNames.Insert(lowerName)
+		}
+	}
+	if lb.OutboundRules != nil {
+		for _, rule := range *lb.OutboundRules {
+			collectStaleName(rule.Name)
+		}
+	}
+	if lb.FrontendIPConfigurations != nil {
+		for _, fipConfig := range *lb.FrontendIPConfigurations {
+			collectStaleName(fipConfig.Name)
+		}
+	}
+	if lb.BackendAddressPools != nil {
+		for _, bp := range *lb.BackendAddressPools {
+			collectStaleName(bp.Name)
+		}
+	}
+	for _, name := range sets.List(staleNames) {
+		klog.V(2).Infof("reconcileNodePoolOutboundRules: removing the outbound rule %s from the load balancer %s", name, lbName)
+		removeOutboundRule(lb, name)
+		removeBackendPoolByName(lb, name)
+		changed = true
+	}
+	return changed, nil
+}
+
+// getNodePoolOutboundMitigations returns the SNAT ports allocated to each node by the node pool outbound rule on the
+// load balancer, and the number of the additional public IP prefixes attached to it. The ports scaled by the SNAT
+// exhaustion advisor up to maxAllocatedOutboundPorts, and the additional public IP prefixes attached in order, are kept.
+func (az *Cloud) getNodePoolOutboundMitigations(lb *network.LoadBalancer, config NodePoolOutboundConfiguration) (int32, int) {
+	allocatedOutboundPorts := config.AllocatedOutboundPorts
+	if lb.OutboundRules == nil {
+		return allocatedOutboundPorts, 0
+	}
+	lbName := pointer.StringDeref(lb.Name, "")
+	name := getNodePoolOutboundName(lbName, config.Name)
+	i := findOutboundRuleByName(*lb.OutboundRules, name)
+	if i < 0 || (*lb.OutboundRules)[i].OutboundRulePropertiesFormat == nil {
+		return allocatedOutboundPorts, 0
+	}
+	rule := (*lb.OutboundRules)[i]
+
+	existingPorts := pointer.Int32Deref(rule.AllocatedOutboundPorts, 0)
+	if config.MaxAllocatedOutboundPorts > 0 && existingPorts > allocatedOutboundPorts && existingPorts <= config.MaxAllocatedOutboundPorts {
+		allocatedOutboundPorts = existingPorts
+	}
+
+	var additionalPrefixes int
+	if rule.FrontendIPConfigurations != nil {
+		fipConfigIDs := sets.New[string]()
+		for _, fipConfig := range *rule.FrontendIPConfigurations {
+			fipConfigIDs.Insert(strings.ToLower(pointer.StringDeref(fipConfig.ID, "")))
+		}
+		for additionalPrefixes < len(config.AdditionalPublicIPPrefixIDs) &&
+			fipConfigIDs.Has(strings.ToLower(az.getFrontendIPConfigID(lbName, getNodePoolOutboundAdditionalName(name, additionalPrefixes)))) {
+			additionalPrefixes++
+		}
+	}
+	return allocatedOutboundPorts, additionalPrefixes
+}
+
+// ensureNodePoolOutboundRule ensures the outbound rule of the node pool outbound configuration on the load balancer
+// allocating the ports to each node, with the frontend IP configurations of the public IP prefix and the first
+// additionalPrefixes additional public IP prefixes. It returns true if the load balancer is changed.
+func (az *Cloud) ensureNodePoolOutboundRule(lb *network.LoadBalancer, config NodePoolOutboundConfiguration, allocatedOutboundPorts int32, additionalPrefixes int) bool {
+	lbName := pointer.StringDeref(lb.Name, "")
+	name := getNodePoolOutboundName(lbName, config.Name)
+	fipConfigID := az.getFrontendIPConfigID(lbName, name)
+	expectedFIPConfig := network.FrontendIPConfiguration{
+		Name: pointer.String(name),
+		ID:   pointer.String(fipConfigID),
+		FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+			PublicIPPrefix: &network.SubResource{ID: pointer.String(config.PublicIPPrefixID)},
+		},
+	}
+	fipConfigRefs := []network.SubResource{{ID: pointer.String(fipConfigID)}}
+
+	var changed bool
+	for i := 0; i < additionalPrefixes && i < len(config.AdditionalPublicIPPrefixIDs); i++ {
+		additionalName := getNodePoolOutboundAdditionalName(name, i)
+		additionalFIPConfigID := az.getFrontendIPConfigID(lbName, additionalName)
+		if ensureOutboundFrontendIPConfig(lb, network.FrontendIPConfiguration{
+			Name: pointer.String(additionalName),
+			ID:   pointer.String(additionalFIPConfigID),
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+				PublicIPPrefix: &network.SubResource{ID: pointer.String(config.AdditionalPublicIPPrefixIDs[i])},
+			},
+		}) {
+			changed = true
+		}
+		fipConfigRefs = append(fipConfigRefs, network.SubResource{ID: pointer.String(additionalFIPConfigID)})
+	}
+
+	expectedRule := network.OutboundRule{
+		Name: pointer.String(name),
+		OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+			Protocol:                 network.LoadBalancerOutboundRuleProtocolAll,
+			AllocatedOutboundPorts:   pointer.Int32(allocatedOutboundPorts),
+			IdleTimeoutInMinutes:     pointer.Int32(config.IdleTimeoutInMinutes),
+			EnableTCPReset:           pointer.Bool(true),
+			FrontendIPConfigurations: &fipConfigRefs,
+			BackendAddressPool:       &network.SubResource{ID: pointer.String(az.getBackendPoolID(lbName, name))},
+		},
+	}
+	if ensureOutboundRule(lb, expectedFIPConfig, expectedRule) {
+		changed = true
+	}
+	return changed
+}
+
+// getNodePoolOutboundNodeIPs returns the names of the nodes selected by each node pool outbound configuration keyed
+// by their private IPv4 addresses, keyed by the configuration name. A node selected by multiple configurations only
+// joins the first one.
+func (az *Cloud) getNodePoolOutboundNodeIPs(lbName string, nodes []*v1.Node) (map[string]map[string]string, error) {
+	selectors := make([]labels.Selector, len(az.NodePoolOutboundConfigurations))
+	for i, config := range az.NodePoolOutboundConfigurations {
+		selector, err := metav1.LabelSelectorAsSelector(config.NodeSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node selector of node pool outbound configuration %s: %w", config.Name, err)
+		}
+		selectors[i] = selector
+	}
+
+	var activeNodes sets.Set[string]
+	if az.useMultipleStandardLoadBalancers() {
+		activeNodes = az.getActiveNodesByLoadBalancerName(lbName)
+	}
+	nodeIPs := make(map[string]map[string]string)
+	for _, node := range nodes {
+		if isControlPlaneNode(node) || (activeNodes != nil && !activeNodes.Has(node.Name)) {
+			continue
+		}
+		shouldExclude, err := az.ShouldNodeExcludedFromLoadBalancer(node.Name)
+		if err != nil {
+			return nil, err
+		}
+		if shouldExclude {
+			continue
+		}
+		privateIP := getNodePrivateIPAddress(node, consts.IPVersionIPv4)
+		if privateIP == "" {
+			continue
+		}
+		for i, selector := range selectors {
+			if selector.Matches(labels.Set(node.Labels)) {
+				configName := az.NodePoolOutboundConfigurations[i].Name
+				if nodeIPs[configName] == nil {
+					nodeIPs[configName] = make(map[string]string)
+				}
+				nodeIPs[configName][privateIP] = node.Name
+				break
+			}
+		}
+	}
+	return nodeIPs, nil
+}
+
+// ensureOutboundBackendPool adds the IP-based backend pool to the load balancer if it does not exist, and updates
+// its members to the node IPs if updateMembers is true. It returns true if the load balancer is changed.
+func (az *Cloud) ensureOutboundBackendPool(lb *network.LoadBalancer, name, backendPoolID string, nodeIPs map[string]string, updateMembers bool) bool {
+	var backendPools []network.BackendAddressPool
+	if lb.BackendAddressPools != nil {
+		backendPools = *lb.BackendAddressPools
+	}
+	var changed bool
+	i := findBackendPoolByName(backendPools, name)
+	if i < 0 {
+		backendPools = append(backendPools, network.BackendAddressPool{
+			Name:                               pointer.String(name),
+			ID:                                 pointer.String(backendPoolID),
+			BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{},
+		})
+		i = len(backendPools) - 1
+		changed = true
+	}
+	lb.BackendAddressPools = &backendPools
+	if !updateMembers {
+		return changed
+	}
+
+	bp := &backendPools[i]
+	if bp.BackendAddressPoolPropertiesFormat == nil {
+		bp.BackendAddressPoolPropertiesFormat = &network.BackendAddressPoolPropertiesFormat{}
+	}
+	existingIPs := sets.New[string]()
+	if bp.LoadBalancerBackendAddresses != nil {
+		for _, address := range *bp.LoadBalancerBackendAddresses {
+			if address.LoadBalancerBackendAddressPropertiesFormat != nil {
+				existingIPs.Insert(pointer.StringDeref(address.IPAddress, ""))
+			}
+		}
+	}
+	expectedIPs := sets.KeySet(nodeIPs)
+	if existingIPs.Equal(expectedIPs) {
+		return changed
+	}
+
+	klog.V(2).Infof("ensureOutboundBackendPool: updating the backend pool %s to add %d nodes and remove %d nodes",
+		name, expectedIPs.Difference(existingIPs).Len(), existingIPs.Difference(expectedIPs).Len())
+	ips := sets.List(expectedIPs)
+	sort.Strings(ips)
+	addresses := make([]network.LoadBalancerBackendAddress, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, network.LoadBalancerBackendAddress{
+			Name: pointer.String(nodeIPs[ip]),
+			LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+				IPAddress: pointer.String(ip),
+			},
+		})
+	}
+	bp.LoadBalancerBackendAddresses = &addresses
+	bp.VirtualNetwork = &network.SubResource{ID: pointer.String(az.getVnetResourceID())}
+	return true
+}
+
+// removeBackendPoolByName removes the backend pool from the load balancer.
+func removeBackendPoolByName(lb *network.LoadBalancer, name string) {
+	if lb.BackendAddressPools == nil {
+		return
+	}
+	backendPools := *lb.BackendAddressPools
+	if i := findBackendPoolByName(backendPools, name); i >= 0 {
+		backendPools = append(backendPools[:i], backendPools[i+1:]...)
+		lb.BackendAddressPools = &backendPools
+	}
+}
+
+func findBackendPoolByName(backendPools []network.BackendAddressPool, name string) int {
+	for i := range backendPools {
+		if strings.EqualFold(pointer.StringDeref(backendPools[i].Name, ""), name) {
+			return i
+		}
+	}
+	return -1
+}
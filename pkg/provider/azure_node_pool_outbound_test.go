@@ -0,0 +1,309 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestCheckNodePoolOutboundConfigurations(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "a"}}
+	prefixID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/prefix"
+	for _, tc := range []struct {
+		desc                string
+		configs             []NodePoolOutboundConfiguration
+		loadBalancerSku     string
+		backendPoolType     string
+		disableOutboundSNAT *bool
+		outboundType        string
+		expectedErr         bool
+	}{
+		{
+			desc:    "valid configurations should be allowed",
+			configs: []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID, AllocatedOutboundPorts: 1024}},
+		},
+		{
+			desc:            "basic load balancer should not be allowed",
+			configs:         []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID}},
+			loadBalancerSku: consts.LoadBalancerSkuBasic,
+			expectedErr:     true,
+		},
+		{
+			desc:            "nodeIPConfiguration backend pool type should not be allowed",
+			configs:         []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID}},
+			backendPoolType: consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration,
+			expectedErr:     true,
+		},
+		{
+			desc:                "outbound SNAT of the load balancing rules should be disabled",
+			configs:             []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID}},
+			disableOutboundSNAT: pointer.Bool(false),
+			expectedErr:         true,
+		},
+		{
+			desc:         "natGateway outbound type should not be allowed",
+			configs:      []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID}},
+			outboundType: consts.OutboundTypeNATGateway,
+			expectedErr:  true,
+		},
+		{
+			desc:        "name should not be empty",
+			configs:     []NodePoolOutboundConfiguration{{NodeSelector: selector, PublicIPPrefixID: prefixID}},
+			expectedErr: true,
+		},
+		{
+			desc:        "name should not be reserved",
+			configs:     []NodePoolOutboundConfiguration{{Name: "ipv6", NodeSelector: selector, PublicIPPrefixID: prefixID}},
+			expectedErr: true,
+		},
+		{
+			desc: "names should not be duplicated",
+			configs: []NodePoolOutboundConfiguration{
+				{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID},
+				{Name: "A", NodeSelector: selector, PublicIPPrefixID: prefixID},
+			},
+			expectedErr: true,
+		},
+		{
+			desc:        "node selector should be set",
+			configs:     []NodePoolOutboundConfiguration{{Name: "a", PublicIPPrefixID: prefixID}},
+			expectedErr: true,
+		},
+		{
+			desc: "node selector should be valid",
+			configs: []NodePoolOutboundConfiguration{{
+				Name: "a",
+				NodeSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "pool", Operator: "invalid"},
+				}},
+				PublicIPPrefixID: prefixID,
+			}},
+			expectedErr: true,
+		},
+		{
+			desc:        "public IP prefix should be set",
+			configs:     []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector}},
+			expectedErr: true,
+		},
+		{
+			desc:        "allocated outbound ports should be a multiple of 8",
+			configs:     []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID, AllocatedOutboundPorts: 1001}},
+			expectedErr: true,
+		},
+		{
+			desc:        "idle timeout should not be less than 4",
+			configs:     []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID, IdleTimeoutInMinutes: 3}},
+			expectedErr: true,
+		},
+		{
+			desc: "max allocated outbound ports and additional public IP prefixes should be allowed",
+			configs: []NodePoolOutboundConfiguration{{
+				Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID, AllocatedOutboundPorts: 1024,
+				MaxAllocatedOutboundPorts: 4096, AdditionalPublicIPPrefixIDs: []string{prefixID + "2"},
+			}},
+		},
+		{
+			desc:        "max allocated outbound ports should not be less than allocated outbound ports",
+			configs:     []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID, AllocatedOutboundPorts: 1024, MaxAllocatedOutboundPorts: 512}},
+			expectedErr: true,
+		},
+		{
+			desc:        "max allocated outbound ports should be a multiple of 8",
+			configs:     []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID, MaxAllocatedOutboundPorts: 1001}},
+			expectedErr: true,
+		},
+		{
+			desc:        "additional public IP prefixes should not be the public IP prefix",
+			configs:     []NodePoolOutboundConfiguration{{Name: "a", NodeSelector: selector, PublicIPPrefixID: prefixID, AdditionalPublicIPPrefixIDs: []string{prefixID}}},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			if tc.loadBalancerSku != "" {
+				az.LoadBalancerSku = tc.loadBalancerSku
+			}
+			az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIP
+			if tc.backendPoolType != "" {
+				az.LoadBalancerBackendPoolConfigurationType = tc.backendPoolType
+			}
+			az.DisableOutboundSNAT = pointer.Bool(true)
+			if tc.disableOutboundSNAT != nil {
+				az.DisableOutboundSNAT = tc.disableOutboundSNAT
+			}
+			az.OutboundType = tc.outboundType
+			az.NodePoolOutboundConfigurations = tc.configs
+
+			err := az.checkNodePoolOutboundConfigurations()
+			assert.Equal(t, tc.expectedErr, err != nil)
+			if !tc.expectedErr {
+				assert.Equal(t, int32(consts.DefaultIPv6OutboundIdleTimeoutInMinutes), az.NodePoolOutboundConfigurations[0].IdleTimeoutInMinutes)
+			}
+		})
+	}
+}
+
+func TestReconcileNodePoolOutboundRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIP
+	prefixA := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/a"
+	prefixB := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/b"
+	az.NodePoolOutboundConfigurations = []NodePoolOutboundConfiguration{
+		{
+			Name:                   "a",
+			NodeSelector:           &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+			PublicIPPrefixID:       prefixA,
+			AllocatedOutboundPorts: 1024,
+			IdleTimeoutInMinutes:   4,
+		},
+		{
+			Name:                 "b",
+			NodeSelector:         &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tenant", Operator: metav1.LabelSelectorOpExists}}},
+			PublicIPPrefixID:     prefixB,
+			IdleTimeoutInMinutes: 4,
+		},
+	}
+
+	newNode := func(name, ip string, nodeLabels map[string]string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: nodeLabels},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: ip}},
+			},
+		}
+	}
+	nodes := []*v1.Node{
+		newNode("node1", "10.0.0.1", map[string]string{"tenant": "a"}),
+		newNode("node2", "10.0.0.2", map[string]string{"tenant": "b"}),
+		newNode("node3", "10.0.0.3", nil),
+		newNode("node4", "10.0.0.4", map[string]string{"tenant": "a", consts.ControlPlaneNodeRoleLabel: ""}),
+	}
+
+	nameA, nameB := "testCluster-outbound-a", "testCluster-outbound-b"
+	lb := &network.LoadBalancer{
+		Name: pointer.String("testCluster"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: pointer.String("service-fip")}},
+			BackendAddressPools:      &[]network.BackendAddressPool{{Name: pointer.String("testCluster")}},
+		},
+	}
+	changed, err := az.reconcileNodePoolOutboundRules(lb, nodes)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, *lb.FrontendIPConfigurations, 3)
+	assert.Equal(t, prefixA, *(*lb.FrontendIPConfigurations)[1].PublicIPPrefix.ID)
+	assert.Equal(t, prefixB, *(*lb.FrontendIPConfigurations)[2].PublicIPPrefix.ID)
+	assert.Len(t, *lb.BackendAddressPools, 3)
+	// A node selected by both configurations only joins the first one, and the control plane nodes are excluded.
+	assert.Equal(t, []network.LoadBalancerBackendAddress{
+		{
+			Name: pointer.String("node1"),
+			LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String("10.0.0.1")},
+		},
+	}, *(*lb.BackendAddressPools)[1].LoadBalancerBackendAddresses)
+	assert.Equal(t, []network.LoadBalancerBackendAddress{
+		{
+			Name: pointer.String("node2"),
+			LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String("10.0.0.2")},
+		},
+	}, *(*lb.BackendAddressPools)[2].LoadBalancerBackendAddresses)
+	assert.Equal(t, []network.OutboundRule{
+		{
+			Name: pointer.String(nameA),
+			OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+				Protocol:                 network.LoadBalancerOutboundRuleProtocolAll,
+				AllocatedOutboundPorts:   pointer.Int32(1024),
+				IdleTimeoutInMinutes:     pointer.Int32(4),
+				EnableTCPReset:           pointer.Bool(true),
+				FrontendIPConfigurations: &[]network.SubResource{{ID: pointer.String(az.getFrontendIPConfigID("testCluster", nameA))}},
+				BackendAddressPool:       &network.SubResource{ID: pointer.String(az.getBackendPoolID("testCluster", nameA))},
+			},
+		},
+		{
+			Name: pointer.String(nameB),
+			OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+				Protocol:                 network.LoadBalancerOutboundRuleProtocolAll,
+				AllocatedOutboundPorts:   pointer.Int32(0),
+				IdleTimeoutInMinutes:     pointer.Int32(4),
+				EnableTCPReset:           pointer.Bool(true),
+				FrontendIPConfigurations: &[]network.SubResource{{ID: pointer.String(az.getFrontendIPConfigID("testCluster", nameB))}},
+				BackendAddressPool:       &network.SubResource{ID: pointer.String(az.getBackendPoolID("testCluster", nameB))},
+			},
+		},
+	}, *lb.OutboundRules)
+
+	changed, err = az.reconcileNodePoolOutboundRules(lb, nodes)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// The members of the backend pools are kept if the nodes are not given.
+	changed, err = az.reconcileNodePoolOutboundRules(lb, nil)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Len(t, *(*lb.BackendAddressPools)[1].LoadBalancerBackendAddresses, 1)
+
+	nodes[2].Labels = map[string]string{"tenant": "c"}
+	changed, err = az.reconcileNodePoolOutboundRules(lb, nodes)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, *(*lb.BackendAddressPools)[2].LoadBalancerBackendAddresses, 2)
+
+	// The resources of the removed configuration are removed.
+	az.NodePoolOutboundConfigurations = az.NodePoolOutboundConfigurations[:1]
+	changed, err = az.reconcileNodePoolOutboundRules(lb, nodes)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, *lb.FrontendIPConfigurations, 2)
+	assert.Len(t, *lb.BackendAddressPools, 2)
+	assert.Len(t, *lb.OutboundRules, 1)
+
+	// All the resources are removed together with the last frontend IP configuration of the services.
+	*lb.FrontendIPConfigurations = (*lb.FrontendIPConfigurations)[1:]
+	changed, err = az.reconcileNodePoolOutboundRules(lb, nodes)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Empty(t, *lb.FrontendIPConfigurations)
+	assert.Empty(t, *lb.OutboundRules)
+	assert.Equal(t, []network.BackendAddressPool{{Name: pointer.String("testCluster")}}, *lb.BackendAddressPools)
+
+	// Internal load balancers are not changed.
+	internalLB := &network.LoadBalancer{
+		Name:                         pointer.String("testCluster-internal"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+	}
+	changed, err = az.reconcileNodePoolOutboundRules(internalLB, nodes)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Nil(t, internalLB.OutboundRules)
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+	"k8s.io/utils/pointer"
+)
+
+// stalePrivateIPs holds the private IPs removed from a node, which may still be in the IP-based backend pools.
+type stalePrivateIPs struct {
+	ips sets.Set[string]
+	// primaryIPs are the current primary IPs of the node keyed by whether they are IPv6, which replace the stale IPs
+	// of the same IP family in the backend pools.
+	primaryIPs map[bool]string
+}
+
+// updateNodePrivateIPs updates the private IPs of the node in the caches to the given addresses, including the IPs
+// of the secondary IP configurations. The IPs removed from an existing node are recorded as stale, so that they are
+// replaced by the current primary IPs of the node in the IP-based backend pools, e.g., after the node is re-imaged.
+// The caller should hold the lock of the node caches.
+func (az *Cloud) updateNodePrivateIPs(nodeName string, addresses []string) {
+	previousIPs := az.nodeTopology.getPrivateIPs(nodeName)
+	currentIPs := sets.New(addresses...)
+	removedIPs := previousIPs.Difference(currentIPs)
+	addedIPs := currentIPs.Difference(previousIPs)
+	if removedIPs.Len() == 0 && addedIPs.Len() == 0 {
+		return
+	}
+
+	for ip := range removedIPs {
+		klog.V(4).Infof("removing IP address %s of the node %s", ip, nodeName)
+	}
+	for ip := range addedIPs {
+		klog.V(6).Infof("adding IP address %s of the node %s", ip, nodeName)
+	}
+	// The removed IPs may have been taken by another node.
+	az.nodeTopology.setPrivateIPs(nodeName, currentIPs)
+
+	// The IPs of the deleted nodes are removed by the reconciliation of the services.
+	if addresses == nil {
+		delete(az.nodesWithStalePrivateIPs, nodeName)
+		return
+	}
+	stale, ok := az.nodesWithStalePrivateIPs[nodeName]
+	if !ok && removedIPs.Len() == 0 {
+		return
+	}
+	if !ok {
+		stale = &stalePrivateIPs{ips: sets.New[string]()}
+		if az.nodesWithStalePrivateIPs == nil {
+			az.nodesWithStalePrivateIPs = make(map[string]*stalePrivateIPs)
+		}
+		az.nodesWithStalePrivateIPs[nodeName] = stale
+	}
+	klog.V(2).Infof("the private IPs of the node %s are changed from %s to %s", nodeName,
+		strings.Join(sets.List(previousIPs), ","), strings.Join(addresses, ","))
+	// The IPs may be assigned to the node again.
+	stale.ips = stale.ips.Union(removedIPs).Difference(currentIPs)
+	stale.primaryIPs = make(map[bool]string)
+	for _, ip := range addresses {
+		if _, found := stale.primaryIPs[utilnet.IsIPv6String(ip)]; !found {
+			stale.primaryIPs[utilnet.IsIPv6String(ip)] = ip
+		}
+	}
+	if stale.ips.Len() == 0 {
+		delete(az.nodesWithStalePrivateIPs, nodeName)
+	}
+}
+
+// runNodePrivateIPUpdateLoop periodically replaces the stale private IPs of the nodes in the IP-based backend pools.
+func (az *Cloud) runNodePrivateIPUpdateLoop(ctx context.Context, interval time.Duration) {
+	klog.V(2).Info("runNodePrivateIPUpdateLoop: started")
+	err := wait.PollUntilContextCancel(ctx, interval, false, func(ctx context.Context) (bool, error) {
+		if _, err := az.replaceStaleNodePrivateIPsInBackendPools(); err != nil {
+			klog.Warningf("runNodePrivateIPUpdateLoop: failed to replace the stale private IPs of the nodes: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runNodePrivateIPUpdateLoop: stopped due to %s", err.Error())
+}
+
+// replaceStaleNodePrivateIPsInBackendPools replaces the stale private IPs of the nodes by their current primary IPs of
+// the same IP family in the IP-based backend pools containing them. The primary IPs are not added if the node is
+// excluded from the load balancers. The dedicated backend pools of the local services are updated by the backend pool updater
+// instead. The nodes are retried in the next run if any backend pool fails to be updated. It returns the number of
+// backend pools updated.
+func (az *Cloud) replaceStaleNodePrivateIPsInBackendPools() (int, error) {
+	az.nodeCachesLock.Lock()
+	nodesWithStaleIPs := az.nodesWithStalePrivateIPs
+	az.nodesWithStalePrivateIPs = nil
+	// the primary IPs of the nodes keyed by their stale IPs, or empty if the nodes are excluded from load balancers
+	replacements := make(map[string]string)
+	for nodeName, stale := range nodesWithStaleIPs {
+		excluded := az.shouldNodeExcludedFromLoadBalancer(nodeName)
+		for staleIP := range stale.ips {
+			// The IP may have been taken by another node.
+			if _, ok := az.nodeTopology.getNodeNameByIP(staleIP); ok {
+				continue
+			}
+			if excluded {
+				replacements[staleIP] = ""
+			} else {
+				replacements[staleIP] = stale.primaryIPs[utilnet.IsIPv6String(staleIP)]
+			}
+		}
+	}
+	az.nodeCachesLock.Unlock()
+	if len(replacements) == 0 {
+		return 0, nil
+	}
+
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		az.requeueNodesWithStalePrivateIPs(nodesWithStaleIPs)
+		return 0, err
+	}
+	localServiceBackendPoolNames := az.getLocalServiceBackendPoolNames()
+	var updated int
+	var errs []error
+	for _, lb := range lbs {
+		if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+			continue
+		}
+		lbName := pointer.StringDeref(lb.Name, "")
+		for i := range *lb.BackendAddressPools {
+			bp := (*lb.BackendAddressPools)[i]
+			if localServiceBackendPoolNames.Has(strings.ToLower(pointer.StringDeref(bp.Name, ""))) ||
+				!az.replaceIPAddressesInBackendPool(&bp, replacements) {
+				continue
+			}
+			klog.V(2).Infof("replaceStaleNodePrivateIPsInBackendPools: replacing the stale node IPs in the backend pool %s of the load balancer %s", pointer.StringDeref(bp.Name, ""), lbName)
+			replaceStaleIPs := func(latest *network.BackendAddressPool) bool {
+				return az.replaceIPAddressesInBackendPool(latest, replacements)
+			}
+			if err := az.updateLBBackendPoolAddresses(lbName, bp, replaceStaleIPs); err != nil {
+				errs = append(errs, fmt.Errorf("failed to update the backend pool %s of the load balancer %s: %w", pointer.StringDeref(bp.Name, ""), lbName, err))
+				continue
+			}
+			updated++
+		}
+	}
+	if len(errs) > 0 {
+		az.requeueNodesWithStalePrivateIPs(nodesWithStaleIPs)
+	}
+	return updated, utilerrors.NewAggregate(errs)
+}
+
+// replaceIPAddressesInBackendPool replaces the IP addresses in the backend pool by the IPs keyed by them, or removes
+// them if the replacements are empty. It returns true if the backend pool is changed.
+func (az *Cloud) replaceIPAddressesInBackendPool(backendPool *network.BackendAddressPool, replacements map[string]string) bool {
+	if backendPool.BackendAddressPoolPropertiesFormat == nil || backendPool.LoadBalancerBackendAddresses == nil {
+		return false
+	}
+	var ipsToBeDeleted, ipsToBeAdded []string
+	for _, address := range *backendPool.LoadBalancerBackendAddresses {
+		if address.LoadBalancerBackendAddressPropertiesFormat == nil {
+			continue
+		}
+		ip := pointer.StringDeref(address.IPAddress, "")
+		if newIP, ok := replacements[ip]; ok {
+			ipsToBeDeleted = append(ipsToBeDeleted, ip)
+			if newIP != "" {
+				ipsToBeAdded = append(ipsToBeAdded, newIP)
+			}
+		}
+	}
+	if len(ipsToBeDeleted) == 0 {
+		return false
+	}
+	_ = removeNodeIPAddressesFromBackendPool(*backendPool, ipsToBeDeleted, false, true)
+	_ = az.addNodeIPAddressesToBackendPool(backendPool, ipsToBeAdded)
+	return true
+}
+
+// getLocalServiceBackendPoolNames returns the lower-cased names of the dedicated backend pools of the local services.
+func (az *Cloud) getLocalServiceBackendPoolNames() sets.Set[string] {
+	names := sets.New[string]()
+	az.localServiceNameToServiceInfoMap.Range(func(key, _ interface{}) bool {
+		for name := range az.getLocalServiceBackendPoolNameCandidates(key.(string)) {
+			names.Insert(strings.ToLower(name))
+		}
+		return true
+	})
+	return names
+}
+
+// requeueNodesWithStalePrivateIPs records the stale IPs of the nodes again so that they are replaced in the next run.
+func (az *Cloud) requeueNodesWithStalePrivateIPs(nodesWithStaleIPs map[string]*stalePrivateIPs) {
+	az.nodeCachesLock.Lock()
+	defer az.nodeCachesLock.Unlock()
+
+	for nodeName, stale := range nodesWithStaleIPs {
+		// The node may be deleted.
+		currentIPs := az.nodeTopology.getPrivateIPs(nodeName)
+		if currentIPs.Len() == 0 {
+			continue
+		}
+		if az.nodesWithStalePrivateIPs == nil {
+			az.nodesWithStalePrivateIPs = make(map[string]*stalePrivateIPs)
+		}
+		if latest, ok := az.nodesWithStalePrivateIPs[nodeName]; ok {
+			// The node is updated again, so its latest primary IPs are kept.
+			latest.ips = latest.ips.Union(stale.ips).Difference(currentIPs)
+			continue
+		}
+		stale.ips = stale.ips.Difference(currentIPs)
+		if stale.ips.Len() > 0 {
+			az.nodesWithStalePrivateIPs[nodeName] = stale
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestUpdateNodePrivateIPs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.updateNodePrivateIPs("node1", []string{"10.0.0.1", "10.0.0.11", "fd00::1"})
+	assert.Equal(t, sets.New("10.0.0.1", "10.0.0.11", "fd00::1"), az.nodeTopology.getPrivateIPs("node1"))
+	assert.Equal(t, "node1", az.nodeTopology.nodeNamesByIP["10.0.0.11"])
+	assert.Empty(t, az.nodesWithStalePrivateIPs)
+
+	// The node is re-imaged with a new primary IP, and the IP of the secondary IP configuration is changed.
+	az.updateNodePrivateIPs("node1", []string{"10.0.0.2", "10.0.0.12", "fd00::1"})
+	assert.Equal(t, sets.New("10.0.0.2", "10.0.0.12", "fd00::1"), az.nodeTopology.getPrivateIPs("node1"))
+	assert.Equal(t, map[string]string{"10.0.0.2": "node1", "10.0.0.12": "node1", "fd00::1": "node1"}, az.nodeTopology.nodeNamesByIP)
+	assert.Equal(t, &stalePrivateIPs{
+		ips:        sets.New("10.0.0.1", "10.0.0.11"),
+		primaryIPs: map[bool]string{false: "10.0.0.2", true: "fd00::1"},
+	}, az.nodesWithStalePrivateIPs["node1"])
+
+	// The IP assigned to the node again is not stale.
+	az.updateNodePrivateIPs("node1", []string{"10.0.0.11", "10.0.0.12", "fd00::1"})
+	assert.Equal(t, &stalePrivateIPs{
+		ips:        sets.New("10.0.0.1", "10.0.0.2"),
+		primaryIPs: map[bool]string{false: "10.0.0.11", true: "fd00::1"},
+	}, az.nodesWithStalePrivateIPs["node1"])
+
+	// The IP taken by another node is not removed from the reverse map.
+	az.updateNodePrivateIPs("node2", []string{"10.0.0.12"})
+	az.updateNodePrivateIPs("node1", []string{"10.0.0.11", "fd00::1"})
+	assert.Equal(t, "node2", az.nodeTopology.nodeNamesByIP["10.0.0.12"])
+
+	// The deleted node is removed from the caches.
+	az.updateNodePrivateIPs("node1", nil)
+	assert.NotContains(t, az.nodeTopology.nodes, "node1")
+	assert.NotContains(t, az.nodesWithStalePrivateIPs, "node1")
+	assert.Equal(t, map[string]string{"10.0.0.12": "node2"}, az.nodeTopology.nodeNamesByIP)
+}
+
+func TestReplaceStaleNodePrivateIPsInBackendPools(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.excludeLoadBalancerNodes = sets.New("node3")
+	az.updateNodePrivateIPs("node1", []string{"10.0.0.1", "fd00::1"})
+	az.updateNodePrivateIPs("node2", []string{"10.0.0.2"})
+	az.updateNodePrivateIPs("node3", []string{"10.0.0.3"})
+	az.updateNodePrivateIPs("node1", []string{"10.0.0.11", "fd00::11"})
+	az.updateNodePrivateIPs("node2", []string{"10.0.0.12"})
+	az.updateNodePrivateIPs("node3", []string{"10.0.0.13"})
+	// The stale IP of node2 is taken by node4.
+	az.updateNodePrivateIPs("node4", []string{"10.0.0.2"})
+
+	newBackendPool := func(name string, ips ...string) network.BackendAddressPool {
+		addresses := make([]network.LoadBalancerBackendAddress, 0, len(ips))
+		for _, ip := range ips {
+			addresses = append(addresses, network.LoadBalancerBackendAddress{
+				LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String(ip)},
+			})
+		}
+		return network.BackendAddressPool{
+			Name: pointer.String(name),
+			BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+				LoadBalancerBackendAddresses: &addresses,
+			},
+		}
+	}
+	newLBs := func() []network.LoadBalancer {
+		return []network.LoadBalancer{
+			{
+				Name: pointer.String("lb"),
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					BackendAddressPools: &[]network.BackendAddressPool{
+						newBackendPool("bp1", "10.0.0.1", "10.0.0.2", "10.0.0.3"),
+						newBackendPool("bp2", "10.0.0.2", "10.0.0.4"),
+						newBackendPool("bp3", "fd00::1"),
+					},
+				},
+			},
+		}
+	}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").DoAndReturn(func(_, _ interface{}) ([]network.LoadBalancer, *retry.Error) {
+		return newLBs(), nil
+	}).Times(2)
+	mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), "rg", "lb", "bp1", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_, _, _, _ interface{}, bp network.BackendAddressPool, _ interface{}) *retry.Error {
+			// The excluded node3 is removed, and the IP taken by node4 is kept.
+			var ips []string
+			for _, address := range *bp.LoadBalancerBackendAddresses {
+				ips = append(ips, pointer.StringDeref(address.IPAddress, ""))
+			}
+			assert.ElementsMatch(t, []string{"10.0.0.2", "10.0.0.11"}, ips)
+			return nil
+		}).Times(2)
+	mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), "rg", "lb", "bp3", gomock.Any(), gomock.Any()).Return(&retry.Error{HTTPStatusCode: http.StatusInternalServerError}).Times(1)
+
+	// The nodes are retried if any backend pool fails to be updated.
+	updated, err := az.replaceStaleNodePrivateIPsInBackendPools()
+	assert.Error(t, err)
+	assert.Equal(t, 1, updated)
+	assert.Equal(t, sets.New("10.0.0.1", "fd00::1"), az.nodesWithStalePrivateIPs["node1"].ips)
+
+	mockLBClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), "rg", "lb", "bp3", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_, _, _, _ interface{}, bp network.BackendAddressPool, _ interface{}) *retry.Error {
+			assert.Equal(t, "fd00::11", pointer.StringDeref((*bp.LoadBalancerBackendAddresses)[0].IPAddress, ""))
+			return nil
+		}).Times(1)
+	updated, err = az.replaceStaleNodePrivateIPsInBackendPools()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updated)
+	assert.Empty(t, az.nodesWithStalePrivateIPs)
+
+	// Nothing is listed if no IP is stale.
+	updated, err = az.replaceStaleNodePrivateIPsInBackendPools()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updated)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// nodeTopology is the placement of a node in the cluster known by the cloud provider.
+type nodeTopology struct {
+	// zone is the availability zone of the node, or empty if the node is not in an availability zone.
+	zone string
+	// vmSetName is the name of the scale set of the node parsed from its provider ID, or empty if the node is not a
+	// VMSS uniform instance.
+	vmSetName string
+	// privateIPs are the internal IPs of the node, including the IPs of the secondary IP configurations.
+	privateIPs sets.Set[string]
+	// loadBalancerName is the name of the load balancer the node is placed on with multiple standard load balancers.
+	loadBalancerName string
+}
+
+// nodeTopologyStore holds the topology of the nodes shared by the load balancer, route and local service
+// reconciliations. It is maintained by the node informer handlers and by the placement of the nodes on the multiple
+// standard load balancers. The store is guarded by the lock of the node caches.
+type nodeTopologyStore struct {
+	nodes map[string]*nodeTopology
+	// nodeNamesByIP maps the private IPs to the names of the nodes owning them.
+	nodeNamesByIP map[string]string
+}
+
+// getOrCreate returns the topology of the node, which is created if the node is not known yet.
+func (s *nodeTopologyStore) getOrCreate(nodeName string) *nodeTopology {
+	if s.nodes == nil {
+		s.nodes = make(map[string]*nodeTopology)
+	}
+	if s.nodeNamesByIP == nil {
+		s.nodeNamesByIP = make(map[string]string)
+	}
+	topology, ok := s.nodes[nodeName]
+	if !ok {
+		topology = &nodeTopology{}
+		s.nodes[nodeName] = topology
+	}
+	return topology
+}
+
+// deleteIfEmpty forgets the node if nothing is known about it.
+func (s *nodeTopologyStore) deleteIfEmpty(nodeName string) {
+	if topology, ok := s.nodes[nodeName]; ok && topology.zone == "" && topology.vmSetName == "" &&
+		topology.privateIPs.Len() == 0 && topology.loadBalancerName == "" {
+		delete(s.nodes, nodeName)
+	}
+}
+
+// delete forgets the node and its private IPs.
+func (s *nodeTopologyStore) delete(nodeName string) {
+	s.setPrivateIPs(nodeName, nil)
+	delete(s.nodes, nodeName)
+}
+
+// setPlacement sets the zone and the scale set of the node.
+func (s *nodeTopologyStore) setPlacement(nodeName, zone, vmSetName string) {
+	topology := s.getOrCreate(nodeName)
+	topology.zone = zone
+	topology.vmSetName = vmSetName
+	s.deleteIfEmpty(nodeName)
+}
+
+// setLoadBalancerName sets the load balancer the node is placed on, or clears it if lbName is empty.
+func (s *nodeTopologyStore) setLoadBalancerName(nodeName, lbName string) {
+	s.getOrCreate(nodeName).loadBalancerName = lbName
+	s.deleteIfEmpty(nodeName)
+}
+
+// setPrivateIPs sets the private IPs of the node, and maps the IPs to the node. The removed IPs are only unmapped if
+// they have not been taken by another node.
+func (s *nodeTopologyStore) setPrivateIPs(nodeName string, ips sets.Set[string]) {
+	topology := s.getOrCreate(nodeName)
+	for ip := range topology.privateIPs.Difference(ips) {
+		if s.nodeNamesByIP[ip] == nodeName {
+			delete(s.nodeNamesByIP, ip)
+		}
+	}
+	for ip := range ips.Difference(topology.privateIPs) {
+		s.nodeNamesByIP[ip] = nodeName
+	}
+	topology.privateIPs = ips
+	s.deleteIfEmpty(nodeName)
+}
+
+// getPrivateIPs returns the private IPs of the node, which must not be modified by the caller.
+func (s *nodeTopologyStore) getPrivateIPs(nodeName string) sets.Set[string] {
+	if topology, ok := s.nodes[nodeName]; ok {
+		return topology.privateIPs
+	}
+	return nil
+}
+
+// getNodeNameByIP returns the name of the node owning the private IP.
+func (s *nodeTopologyStore) getNodeNameByIP(ip string) (string, bool) {
+	nodeName, ok := s.nodeNamesByIP[ip]
+	return nodeName, ok
+}
+
+// getAllPrivateIPs returns the private IPs of all the nodes.
+func (s *nodeTopologyStore) getAllPrivateIPs() []string {
+	ips := make([]string, 0, len(s.nodeNamesByIP))
+	for ip := range s.nodeNamesByIP {
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// getZones returns the availability zones of the nodes.
+func (s *nodeTopologyStore) getZones() sets.Set[string] {
+	zones := sets.New[string]()
+	for _, topology := range s.nodes {
+		if topology.zone != "" {
+			zones.Insert(topology.zone)
+		}
+	}
+	return zones
+}
+
+// getVMSetName returns the name of the scale set of the node, or empty if it is not known.
+func (s *nodeTopologyStore) getVMSetName(nodeName string) string {
+	if topology, ok := s.nodes[nodeName]; ok {
+		return topology.vmSetName
+	}
+	return ""
+}
+
+// setNodeLoadBalancerName records the load balancer the node is placed on with multiple standard load balancers.
+func (az *Cloud) setNodeLoadBalancerName(nodeName, lbName string) {
+	az.nodeCachesLock.Lock()
+	defer az.nodeCachesLock.Unlock()
+	az.nodeTopology.setLoadBalancerName(nodeName, lbName)
+}
+
+// getNodeVMSetNameFromTopology returns the name of the scale set of the node known from its provider ID, or empty if
+// it is not known.
+func (az *Cloud) getNodeVMSetNameFromTopology(nodeName string) string {
+	az.nodeCachesLock.RLock()
+	defer az.nodeCachesLock.RUnlock()
+	return az.nodeTopology.getVMSetName(nodeName)
+}
+
+// getNodePrivateIPsFromTopology returns the sorted private IPs of the node known from its addresses.
+func (az *Cloud) getNodePrivateIPsFromTopology(nodeName string) []string {
+	az.nodeCachesLock.RLock()
+	defer az.nodeCachesLock.RUnlock()
+	return sets.List(az.nodeTopology.getPrivateIPs(nodeName))
+}
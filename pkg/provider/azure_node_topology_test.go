@@ -0,0 +1,59 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestNodeTopologyStore(t *testing.T) {
+	var s nodeTopologyStore
+
+	s.setPlacement("node1", "eastus-1", "vmss1")
+	s.setPrivateIPs("node1", sets.New("10.0.0.1", "fd00::1"))
+	s.setPlacement("node2", "eastus-2", "")
+	s.setLoadBalancerName("node2", "lb1")
+	assert.Equal(t, sets.New("eastus-1", "eastus-2"), s.getZones())
+	assert.Equal(t, "vmss1", s.getVMSetName("node1"))
+	assert.Equal(t, "", s.getVMSetName("node2"))
+	assert.Equal(t, sets.New("10.0.0.1", "fd00::1"), s.getPrivateIPs("node1"))
+	assert.ElementsMatch(t, []string{"10.0.0.1", "fd00::1"}, s.getAllPrivateIPs())
+
+	// the IP taken by another node is kept mapped to it
+	s.setPrivateIPs("node2", sets.New("10.0.0.1"))
+	s.setPrivateIPs("node1", sets.New("fd00::1"))
+	nodeName, ok := s.getNodeNameByIP("10.0.0.1")
+	assert.True(t, ok)
+	assert.Equal(t, "node2", nodeName)
+
+	// the nodes are forgotten once nothing is known about them
+	s.setPlacement("node2", "", "")
+	s.setLoadBalancerName("node2", "")
+	s.setPrivateIPs("node2", nil)
+	assert.NotContains(t, s.nodes, "node2")
+	_, ok = s.getNodeNameByIP("10.0.0.1")
+	assert.False(t, ok)
+
+	s.delete("node1")
+	assert.Empty(t, s.nodes)
+	assert.Empty(t, s.nodeNamesByIP)
+	assert.Equal(t, 0, s.getZones().Len())
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// runNodePortSecurityRulesLoop periodically reconciles the security rules of the node port range.
+func (az *Cloud) runNodePortSecurityRulesLoop(ctx context.Context, interval time.Duration) {
+	klog.V(2).Info("runNodePortSecurityRulesLoop: started")
+	err := wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		if _, err := az.reconcileNodePortSecurityRules(); err != nil {
+			klog.Warningf("runNodePortSecurityRulesLoop: failed to reconcile the security rules of the node port range: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runNodePortSecurityRulesLoop: stopped due to %s", err.Error())
+}
+
+// reconcileNodePortSecurityRules adds, updates or removes the security rules of the node port range in the security
+// group. The rules are kept as is if the subnets of the nodes are unknown, e.g. before the nodes are cached. It
+// returns true if the security group is updated.
+func (az *Cloud) reconcileNodePortSecurityRules() (bool, error) {
+	config := az.NodePortSecurityRules
+	if config == nil {
+		return false, nil
+	}
+
+	var expectedRules []network.SecurityRule
+	if config.Enabled {
+		nodeSubnetPrefixes, err := az.getNodeSubnetPrefixes()
+		if err != nil {
+			return false, err
+		}
+		if len(nodeSubnetPrefixes[false]) == 0 && len(nodeSubnetPrefixes[true]) == 0 {
+			klog.V(2).Info("reconcileNodePortSecurityRules: no subnet of the nodes is found, skip reconciling")
+			return false, nil
+		}
+		if expectedRules, err = getExpectedNodePortSecurityRules(config, nodeSubnetPrefixes); err != nil {
+			return false, err
+		}
+	}
+
+	az.serviceReconcileLock.Lock()
+	defer az.serviceReconcileLock.Unlock()
+
+	sg, err := az.getSecurityGroup(azcache.CacheReadTypeDefault)
+	if err != nil {
+		return false, err
+	}
+
+	rules, existingRules := make([]network.SecurityRule, 0), map[string]string{}
+	if sg.SecurityGroupPropertiesFormat != nil && sg.SecurityRules != nil {
+		for _, rule := range *sg.SecurityRules {
+			if !strings.HasPrefix(strings.ToLower(pointer.StringDeref(rule.Name, "")), consts.NodePortSecurityRuleNamePrefix) {
+				rules = append(rules, rule)
+				continue
+			}
+			existingRules[strings.ToLower(pointer.StringDeref(rule.Name, ""))] = getNodePortSecurityRuleFingerprint(rule)
+		}
+	}
+	expectedRuleFingerprints := map[string]string{}
+	for _, rule := range expectedRules {
+		expectedRuleFingerprints[strings.ToLower(pointer.StringDeref(rule.Name, ""))] = getNodePortSecurityRuleFingerprint(rule)
+	}
+	if reflect.DeepEqual(existingRules, expectedRuleFingerprints) {
+		return false, nil
+	}
+
+	usedPriorities := sets.New[int32]()
+	for _, rule := range rules {
+		if rule.SecurityRulePropertiesFormat != nil && rule.Priority != nil && strings.EqualFold(string(rule.Direction), string(network.SecurityRuleDirectionInbound)) {
+			usedPriorities.Insert(*rule.Priority)
+		}
+	}
+	for _, rule := range expectedRules {
+		if usedPriorities.Has(*rule.Priority) {
+			return false, fmt.Errorf("reconcileNodePortSecurityRules: priority %d of security rule %s is used by another rule of security group %s",
+				*rule.Priority, pointer.StringDeref(rule.Name, ""), az.SecurityGroupName)
+		}
+	}
+
+	rules = append(rules, expectedRules...)
+	if sg.SecurityGroupPropertiesFormat == nil {
+		sg.SecurityGroupPropertiesFormat = &network.SecurityGroupPropertiesFormat{}
+	}
+	sg.SecurityRules = &rules
+	klog.V(2).Infof("reconcileNodePortSecurityRules: updating security group %s with %d security rules of the node port range", az.SecurityGroupName, len(expectedRules))
+	if err := az.CreateOrUpdateSecurityGroup(sg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// getNodeSubnetPrefixes returns the sorted address prefixes of the subnets of the virtual network containing the
+// private IPs of the nodes, keyed by whether they are IPv6.
+func (az *Cloud) getNodeSubnetPrefixes() (map[bool][]string, error) {
+	az.nodeCachesLock.RLock()
+	privateIPs := az.nodeTopology.getAllPrivateIPs()
+	nodeIPs := make([]net.IP, 0, len(privateIPs))
+	for _, ip := range privateIPs {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			nodeIPs = append(nodeIPs, parsed)
+		}
+	}
+	az.nodeCachesLock.RUnlock()
+	if len(nodeIPs) == 0 {
+		return nil, nil
+	}
+
+	vnetResourceGroup := az.ResourceGroup
+	if len(az.VnetResourceGroup) > 0 {
+		vnetResourceGroup = az.VnetResourceGroup
+	}
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	subnets, rerr := az.SubnetsClient.List(ctx, vnetResourceGroup, az.VnetName)
+	if rerr != nil {
+		return nil, rerr.Error()
+	}
+
+	prefixes := map[bool]sets.Set[string]{false: sets.New[string](), true: sets.New[string]()}
+	for _, subnet := range subnets {
+		if subnet.SubnetPropertiesFormat == nil {
+			continue
+		}
+		subnetPrefixes := stringSlice(subnet.AddressPrefixes)
+		if subnet.AddressPrefix != nil {
+			subnetPrefixes = append(subnetPrefixes, *subnet.AddressPrefix)
+		}
+		for _, prefix := range subnetPrefixes {
+			_, cidr, err := net.ParseCIDR(prefix)
+			if err != nil {
+				klog.Warningf("getNodeSubnetPrefixes: failed to parse address prefix %q of subnet %s: %s", prefix, pointer.StringDeref(subnet.Name, ""), err.Error())
+				continue
+			}
+			for _, ip := range nodeIPs {
+				if cidr.Contains(ip) {
+					prefixes[utilnet.IsIPv6CIDR(cidr)].Insert(cidr.String())
+					break
+				}
+			}
+		}
+	}
+	return map[bool][]string{false: sets.List(prefixes[false]), true: sets.List(prefixes[true])}, nil
+}
+
+// getExpectedNodePortSecurityRules returns the security rules of the node port range for each IP family with node
+// subnets: allowing the AzureLoadBalancer service tag, allowing the allowed source CIDRs, and denying the others.
+func getExpectedNodePortSecurityRules(config *NodePortSecurityRulesConfig, nodeSubnetPrefixes map[bool][]string) ([]network.SecurityRule, error) {
+	portRange := config.NodePortRange
+	if portRange == "" {
+		portRange = consts.DefaultNodePortRange
+	}
+	low, high, err := parseNodePortRange(portRange)
+	if err != nil {
+		return nil, err
+	}
+	portRange = fmt.Sprintf("%d-%d", low, high)
+
+	priority := config.Priority
+	if priority == 0 {
+		priority = consts.DefaultNodePortSecurityRulePriority
+	}
+	if priority < consts.LoadBalancerMinimumPriority || priority+5 > consts.LoadBalancerMaximumPriority {
+		return nil, fmt.Errorf("getExpectedNodePortSecurityRules: priority %d is out of range [%d, %d]", priority, consts.LoadBalancerMinimumPriority, consts.LoadBalancerMaximumPriority-5)
+	}
+
+	allowedCIDRs := map[bool][]string{}
+	for _, cidr := range config.AllowedSourceCIDRs {
+		_, parsed, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("getExpectedNodePortSecurityRules: invalid allowed source CIDR %q: %w", cidr, err)
+		}
+		isIPv6 := utilnet.IsIPv6CIDR(parsed)
+		allowedCIDRs[isIPv6] = append(allowedCIDRs[isIPv6], parsed.String())
+	}
+
+	rules := []network.SecurityRule{}
+	for _, isIPv6 := range []bool{consts.IPVersionIPv4, consts.IPVersionIPv6} {
+		destinationPrefixes := nodeSubnetPrefixes[isIPv6]
+		if len(destinationPrefixes) == 0 {
+			continue
+		}
+		suffix := ""
+		if isIPv6 {
+			suffix = "-" + consts.IPVersionIPv6String
+		}
+		familyPriority := priority
+		if isIPv6 {
+			familyPriority += 3
+		}
+
+		newRule := func(name string, priority int32, sources []string, access network.SecurityRuleAccess) network.SecurityRule {
+			return network.SecurityRule{
+				Name: pointer.String(consts.NodePortSecurityRuleNamePrefix + name + suffix),
+				SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+					Protocol:                   network.SecurityRuleProtocolAsterisk,
+					SourcePortRange:            pointer.String("*"),
+					SourceAddressPrefixes:      &sources,
+					DestinationPortRange:       pointer.String(portRange),
+					DestinationAddressPrefixes: &destinationPrefixes,
+					Access:                     access,
+					Priority:                   pointer.Int32(priority),
+					Direction:                  network.SecurityRuleDirectionInbound,
+				},
+			}
+		}
+		rules = append(rules, newRule("allow-lb", familyPriority, []string{consts.AzureLoadBalancerServiceTag}, network.SecurityRuleAccessAllow))
+		if cidrs := allowedCIDRs[isIPv6]; len(cidrs) > 0 {
+			sort.Strings(cidrs)
+			rules = append(rules, newRule("allow-cidrs", familyPriority+1, cidrs, network.SecurityRuleAccessAllow))
+		}
+		rules = append(rules, newRule("deny", familyPriority+2, []string{"*"}, network.SecurityRuleAccessDeny))
+	}
+	return rules, nil
+}
+
+// parseNodePortRange parses the node port range, e.g. "30000-32767".
+func parseNodePortRange(portRange string) (int32, int32, error) {
+	var low, high int32
+	if _, err := fmt.Sscanf(strings.TrimSpace(portRange), "%d-%d", &low, &high); err != nil || low <= 0 || low > high || high > 65535 {
+		return 0, 0, fmt.Errorf("invalid node port range %q", portRange)
+	}
+	return low, high, nil
+}
+
+func getNodePortSecurityRuleFingerprint(rule network.SecurityRule) string {
+	if rule.SecurityRulePropertiesFormat == nil {
+		return ""
+	}
+	sortedStrings := func(s []string) []string {
+		sorted := append([]string{}, s...)
+		sort.Strings(sorted)
+		return sorted
+	}
+	return fmt.Sprintf("%s|%s|%s|%v|%v|%s|%s|%d", strings.ToLower(string(rule.Protocol)), strings.ToLower(string(rule.Access)),
+		strings.ToLower(string(rule.Direction)), sortedStrings(stringSlice(rule.SourceAddressPrefixes)),
+		sortedStrings(stringSlice(rule.DestinationAddressPrefixes)), pointer.StringDeref(rule.SourcePortRange, ""),
+		pointer.StringDeref(rule.DestinationPortRange, ""), pointer.Int32Deref(rule.Priority, 0))
+}
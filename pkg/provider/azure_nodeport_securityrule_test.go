@@ -0,0 +1,157 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestReconcileNodePortSecurityRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.NodePortSecurityRules = &NodePortSecurityRulesConfig{
+		Enabled:            true,
+		AllowedSourceCIDRs: []string{"20.0.0.0/16", "10.240.0.0/16", "fd00::/64"},
+	}
+	az.nodeTopology.nodeNamesByIP = map[string]string{"10.0.0.4": "node1", "10.1.0.4": "node2"}
+	mockSubnetClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetClient.EXPECT().List(gomock.Any(), "rg", "vnet").Return([]network.Subnet{
+		{Name: pointer.String("subnet1"), SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: pointer.String("10.0.0.0/24")}},
+		{Name: pointer.String("subnet2"), SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefixes: &[]string{"10.1.0.0/24", "fd01::/64"}}},
+		{Name: pointer.String("subnet3"), SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: pointer.String("10.2.0.0/24")}},
+	}, nil).AnyTimes()
+
+	otherRule := network.SecurityRule{
+		Name: pointer.String("other"),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Priority:  pointer.Int32(500),
+			Direction: network.SecurityRuleDirectionInbound,
+		},
+	}
+	sg := network.SecurityGroup{
+		Name:                          pointer.String("nsg"),
+		Etag:                          pointer.String("etag"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{SecurityRules: &[]network.SecurityRule{otherRule}},
+	}
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", "").DoAndReturn(func(ctx context.Context, resourceGroupName, networkSecurityGroupName, expand string) (network.SecurityGroup, *retry.Error) {
+		return sg, nil
+	}).AnyTimes()
+	mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "nsg", gomock.Any(), "etag").DoAndReturn(
+		func(ctx context.Context, resourceGroupName, networkSecurityGroupName string, parameters network.SecurityGroup, etag string) *retry.Error {
+			sg = parameters
+			return nil
+		}).Times(2)
+
+	// the rules are added
+	updated, err := az.reconcileNodePortSecurityRules()
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	rules := *sg.SecurityRules
+	assert.Equal(t, otherRule, rules[0])
+	names := []string{}
+	for _, rule := range rules[1:] {
+		names = append(names, pointer.StringDeref(rule.Name, ""))
+	}
+	assert.Equal(t, []string{"k8s-azure-nodeport-allow-lb", "k8s-azure-nodeport-allow-cidrs", "k8s-azure-nodeport-deny"}, names)
+	assert.Equal(t, &[]string{"10.0.0.0/24", "10.1.0.0/24"}, rules[3].DestinationAddressPrefixes)
+	assert.Equal(t, &[]string{"10.240.0.0/16", "20.0.0.0/16"}, rules[2].SourceAddressPrefixes)
+	assert.Equal(t, consts.DefaultNodePortRange, pointer.StringDeref(rules[3].DestinationPortRange, ""))
+	assert.Equal(t, int32(consts.DefaultNodePortSecurityRulePriority+2), pointer.Int32Deref(rules[3].Priority, 0))
+	assert.Equal(t, network.SecurityRuleAccessDeny, rules[3].Access)
+
+	// nothing is updated if the rules are up to date
+	_ = az.nsgCache.Delete("nsg")
+	updated, err = az.reconcileNodePortSecurityRules()
+	assert.NoError(t, err)
+	assert.False(t, updated)
+
+	// the rules are removed once disabled
+	_ = az.nsgCache.Delete("nsg")
+	az.NodePortSecurityRules.Enabled = false
+	updated, err = az.reconcileNodePortSecurityRules()
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, []network.SecurityRule{otherRule}, *sg.SecurityRules)
+}
+
+func TestGetExpectedNodePortSecurityRules(t *testing.T) {
+	nodeSubnetPrefixes := map[bool][]string{false: {"10.0.0.0/24"}, true: {"fd01::/64"}}
+
+	rules, err := getExpectedNodePortSecurityRules(&NodePortSecurityRulesConfig{NodePortRange: "31000-31999", Priority: 3000}, nodeSubnetPrefixes)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(rules))
+	assert.Equal(t, "k8s-azure-nodeport-allow-lb-IPv6", pointer.StringDeref(rules[2].Name, ""))
+	assert.Equal(t, int32(3003), pointer.Int32Deref(rules[2].Priority, 0))
+	assert.Equal(t, "31000-31999", pointer.StringDeref(rules[3].DestinationPortRange, ""))
+	assert.Equal(t, &[]string{"fd01::/64"}, rules[3].DestinationAddressPrefixes)
+
+	for _, config := range []*NodePortSecurityRulesConfig{
+		{NodePortRange: "32767-30000"},
+		{NodePortRange: "30000"},
+		{Priority: 4095},
+		{AllowedSourceCIDRs: []string{"10.0.0.1"}},
+	} {
+		_, err := getExpectedNodePortSecurityRules(config, nodeSubnetPrefixes)
+		assert.Error(t, err)
+	}
+}
+
+func TestReconcileNodePortSecurityRulesPriorityConflict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.NodePortSecurityRules = &NodePortSecurityRulesConfig{Enabled: true}
+	az.nodeTopology.nodeNamesByIP = map[string]string{"10.0.0.4": "node1"}
+	mockSubnetClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetClient.EXPECT().List(gomock.Any(), "rg", "vnet").Return([]network.Subnet{
+		{Name: pointer.String("subnet1"), SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: pointer.String("10.0.0.0/24")}},
+	}, nil)
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", "").Return(network.SecurityGroup{
+		Name: pointer.String("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{
+				{
+					Name: pointer.String("other"),
+					SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+						Priority:  pointer.Int32(consts.DefaultNodePortSecurityRulePriority + 2),
+						Direction: network.SecurityRuleDirectionInbound,
+					},
+				},
+			},
+		},
+	}, nil)
+
+	_, err := az.reconcileNodePortSecurityRules()
+	assert.ErrorContains(t, err, "is used by another rule")
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+)
+
+// serviceControllerName is the controller put into the operation annotation of the ARM requests of the service reconciles.
+const serviceControllerName = "service"
+
+// startServiceReconcile generates the reconcile ID of the service, which annotates the ARM requests issued for the
+// service until the returned function is called.
+func (az *Cloud) startServiceReconcile(service *v1.Service) func() {
+	serviceName := getServiceName(service)
+	annotation := armclient.OperationAnnotation{
+		Controller:  serviceControllerName,
+		ReconcileID: string(uuid.NewUUID()),
+	}
+	az.serviceOperationAnnotations.Store(serviceName, annotation)
+	klog.V(5).Infof("startServiceReconcile: reconciling service %s with reconcile ID %s", serviceName, annotation.ReconcileID)
+
+	return func() {
+		az.serviceOperationAnnotations.Delete(serviceName)
+	}
+}
+
+// withServiceOperationAnnotation returns a copy of the context annotating the ARM requests with the current
+// reconcile of the service, or the context itself if the service is not being reconciled.
+func (az *Cloud) withServiceOperationAnnotation(ctx context.Context, service *v1.Service) context.Context {
+	if service == nil {
+		return ctx
+	}
+	annotation, ok := az.serviceOperationAnnotations.Load(getServiceName(service))
+	if !ok {
+		return ctx
+	}
+	return armclient.WithOperationAnnotation(ctx, annotation.(armclient.OperationAnnotation))
+}
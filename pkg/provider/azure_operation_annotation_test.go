@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+)
+
+func TestServiceOperationAnnotation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	service := getTestService("service", v1.ProtocolTCP, nil, false, 80)
+	otherService := getTestService("other", v1.ProtocolTCP, nil, false, 80)
+
+	_, ok := armclient.OperationAnnotationFromContext(az.withServiceOperationAnnotation(context.Background(), &service))
+	assert.False(t, ok)
+
+	done := az.startServiceReconcile(&service)
+	annotation, ok := armclient.OperationAnnotationFromContext(az.withServiceOperationAnnotation(context.Background(), &service))
+	assert.True(t, ok)
+	assert.Equal(t, serviceControllerName, annotation.Controller)
+	assert.NotEmpty(t, annotation.ReconcileID)
+
+	_, ok = armclient.OperationAnnotationFromContext(az.withServiceOperationAnnotation(context.Background(), &otherService))
+	assert.False(t, ok)
+	_, ok = armclient.OperationAnnotationFromContext(az.withServiceOperationAnnotation(context.Background(), nil))
+	assert.False(t, ok)
+
+	done()
+	_, ok = armclient.OperationAnnotationFromContext(az.withServiceOperationAnnotation(context.Background(), &service))
+	assert.False(t, ok)
+
+	// each reconcile has its own ID
+	done = az.startServiceReconcile(&service)
+	defer done()
+	nextAnnotation, ok := armclient.OperationAnnotationFromContext(az.withServiceOperationAnnotation(context.Background(), &service))
+	assert.True(t, ok)
+	assert.NotEqual(t, annotation.ReconcileID, nextAnnotation.ReconcileID)
+}
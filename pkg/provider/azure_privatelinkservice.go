@@ -17,6 +17,8 @@ limitations under the License.
 package provider
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net"
 	"strings"
@@ -24,6 +26,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 
@@ -80,6 +83,11 @@ func (az *Cloud) reconcilePrivateLinkService(
 	}()
 
 	if createPLS {
+		if _, err := getPLSConfig(service); err != nil {
+			az.Event(service, v1.EventTypeWarning, "InvalidPrivateLinkServiceConfig", err.Error())
+			return err
+		}
+
 		// Firstly, make sure it's internal service
 		if !isinternal && !consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) {
 			return fmt.Errorf("reconcilePrivateLinkService for service(%s): service requiring private link service must be internal or disable floating ip", serviceName)
@@ -310,7 +318,11 @@ func (az *Cloud) getExpectedPrivateLinkService(
 		dirtyPLS = true
 	}
 
-	if reconcilePLSFqdn(existingPLS, service) {
+	changed, err = reconcilePLSFqdn(existingPLS, service)
+	if err != nil {
+		return false, err
+	}
+	if changed {
 		dirtyPLS = true
 	}
 
@@ -323,6 +335,9 @@ func (az *Cloud) getExpectedPrivateLinkService(
 	}
 
 	if az.reconcilePLSTags(existingPLS, clusterName, service) {
+		if err := az.ensureResourceTagsValid(service, pointer.StringDeref(existingPLS.Name, ""), existingPLS.Tags); err != nil {
+			return false, err
+		}
 		dirtyPLS = true
 	}
 
@@ -336,8 +351,15 @@ func (az *Cloud) reconcilePLSIpConfigs(
 ) (bool, error) {
 	changed := false
 	serviceName := getServiceName(service)
+	plsConfig, err := getPLSConfig(service)
+	if err != nil {
+		return false, err
+	}
 
 	subnetName := getPLSSubnetName(service)
+	if plsConfig != nil && plsConfig.NATSubnet != nil {
+		subnetName = plsConfig.NATSubnet
+	}
 	if subnetName == nil {
 		subnetName = &az.SubnetName
 	}
@@ -353,11 +375,19 @@ func (az *Cloud) reconcilePLSIpConfigs(
 	if err != nil {
 		return false, err
 	}
+	if plsConfig != nil && plsConfig.NATIPAddressCount != nil {
+		ipConfigCount = *plsConfig.NATIPAddressCount
+	}
 
 	staticIps, primaryIP, err := getPLSStaticIPs(service)
 	if err != nil {
 		return false, err
 	}
+	if plsConfig != nil && plsConfig.NATIPAddresses != nil {
+		if staticIps, primaryIP, err = parsePLSStaticIPs(*plsConfig.NATIPAddresses); err != nil {
+			return false, err
+		}
+	}
 
 	if int(ipConfigCount) < len(staticIps) {
 		return false, fmt.Errorf("checkAndUpdatePLSIPConfigs: ipConfigCount(%d) must be no smaller than number of static IPs specified(%d)", ipConfigCount, len(staticIps))
@@ -465,6 +495,13 @@ func serviceRequiresPLS(service *v1.Service) bool {
 	return getBoolValueFromServiceAnnotations(service, consts.ServiceAnnotationPLSCreation)
 }
 
+// isPLSProxyProtocolEnabled returns true if the service is consumed through a PLS adding the proxy protocol
+// header to the connections. The backends serving the traffic expect the header, which the load balancer
+// health probes do not send.
+func isPLSProxyProtocolEnabled(service *v1.Service) bool {
+	return consts.IsPLSEnabled(service.Annotations) && consts.IsPLSProxyProtocolEnabled(service.Annotations)
+}
+
 func reconcilePLSEnableProxyProtocol(
 	existingPLS *network.PrivateLinkService,
 	service *v1.Service,
@@ -485,9 +522,20 @@ func reconcilePLSEnableProxyProtocol(
 func reconcilePLSFqdn(
 	existingPLS *network.PrivateLinkService,
 	service *v1.Service,
-) bool {
+) (bool, error) {
+	plsConfig, err := getPLSConfig(service)
+	if err != nil {
+		return false, err
+	}
 	changed := false
 	fqdns := getPLSFqdns(service)
+	if plsConfig != nil {
+		if plsConfig.FQDNs != nil {
+			fqdns = *plsConfig.FQDNs
+		} else if _, found := service.Annotations[consts.ServiceAnnotationPLSFqdns]; !found {
+			return false, nil
+		}
+	}
 	if existingPLS.Fqdns == nil {
 		if len(fqdns) != 0 {
 			changed = true
@@ -499,51 +547,90 @@ func reconcilePLSFqdn(
 	if changed {
 		existingPLS.Fqdns = &fqdns
 	}
-	return changed
+	return changed, nil
 }
 
+// reconcilePLSVisibility reconciles the visibility and the auto-approval of the PLS separately,
+// so that the manual changes to the one not configured by the service are kept.
 func reconcilePLSVisibility(
 	existingPLS *network.PrivateLinkService,
 	service *v1.Service,
 ) (bool, error) {
-	changed := false
+	plsConfig, err := getPLSConfig(service)
+	if err != nil {
+		return false, err
+	}
 	visibilitySubs, _ := getPLSVisibility(service)
 	autoApprovalSubs := getPLSAutoApproval(service)
-
-	if existingPLS.Visibility == nil || existingPLS.Visibility.Subscriptions == nil {
-		if len(visibilitySubs) != 0 {
-			changed = true
+	reconcileVisibility, reconcileAutoApproval := true, true
+	if plsConfig != nil {
+		if plsConfig.Visibility != nil {
+			visibilitySubs = *plsConfig.Visibility
+		} else {
+			_, reconcileVisibility = service.Annotations[consts.ServiceAnnotationPLSVisibility]
+		}
+		if plsConfig.AutoApproval != nil {
+			autoApprovalSubs = *plsConfig.AutoApproval
+		} else {
+			_, reconcileAutoApproval = service.Annotations[consts.ServiceAnnotationPLSAutoApproval]
 		}
-	} else if !sameContentInSlices(visibilitySubs, *existingPLS.Visibility.Subscriptions) {
-		changed = true
 	}
 
-	if existingPLS.AutoApproval == nil || existingPLS.AutoApproval.Subscriptions == nil {
-		if len(autoApprovalSubs) != 0 {
+	changed := false
+	if reconcileVisibility {
+		var existingSubs *[]string
+		if existingPLS.Visibility != nil {
+			existingSubs = existingPLS.Visibility.Subscriptions
+		}
+		if !samePLSSubscriptions(visibilitySubs, existingSubs) {
+			existingPLS.Visibility = &network.PrivateLinkServicePropertiesVisibility{
+				Subscriptions: &visibilitySubs,
+			}
 			changed = true
 		}
-	} else if !sameContentInSlices(autoApprovalSubs, *existingPLS.AutoApproval.Subscriptions) {
-		changed = true
 	}
-
-	if changed {
-		existingPLS.Visibility = &network.PrivateLinkServicePropertiesVisibility{
-			Subscriptions: &visibilitySubs,
+	if reconcileAutoApproval {
+		var existingSubs *[]string
+		if existingPLS.AutoApproval != nil {
+			existingSubs = existingPLS.AutoApproval.Subscriptions
 		}
-		existingPLS.AutoApproval = &network.PrivateLinkServicePropertiesAutoApproval{
-			Subscriptions: &autoApprovalSubs,
+		if !samePLSSubscriptions(autoApprovalSubs, existingSubs) {
+			existingPLS.AutoApproval = &network.PrivateLinkServicePropertiesAutoApproval{
+				Subscriptions: &autoApprovalSubs,
+			}
+			changed = true
 		}
 	}
 	return changed, nil
 }
 
+// samePLSSubscriptions returns true if the existing subscriptions of the PLS are the expected ones.
+// Unset existing subscriptions are the same as an empty list.
+func samePLSSubscriptions(expected []string, existing *[]string) bool {
+	if existing == nil {
+		return len(expected) == 0
+	}
+	return sameContentInSlices(expected, *existing)
+}
+
 func (az *Cloud) reconcilePLSTags(
 	existingPLS *network.PrivateLinkService,
 	clusterName *string,
 	service *v1.Service,
 ) bool {
-	configTags := parseTags(az.Tags, az.TagsMap)
+	configTags := az.getConfigTags(consts.TagTemplateResourcePrivateLinkService, newServiceTagTemplateValues(pointer.StringDeref(clusterName, ""), service))
 	serviceName := getServiceName(service)
+	serviceTags, err := getServiceResourceTags(service)
+	if err != nil {
+		// the annotation is validated before reconciling the service
+		klog.Warningf("reconcilePLSTags: ignoring the invalid tags of service %s: %v", serviceName, err)
+	}
+	for k, v := range serviceTags {
+		if found, key := findKeyInMapCaseInsensitive(configTags, k); found {
+			delete(configTags, key)
+		}
+		configTags[k] = v
+	}
 
 	if existingPLS.Tags == nil {
 		existingPLS.Tags = make(map[string]*string)
@@ -563,10 +650,11 @@ func (az *Cloud) reconcilePLSTags(
 		configTags[consts.OwnerServiceTagKey] = &serviceName
 	}
 
+	removed := reconcileServiceResourceTags(existingPLS.Tags, configTags, serviceTags)
 	tags, changed := az.reconcileTags(existingPLS.Tags, configTags)
 	existingPLS.Tags = tags
 
-	return changed
+	return changed || removed
 }
 
 func getPLSSubnetName(service *v1.Service) *string {
@@ -587,19 +675,7 @@ func getPLSIPConfigCount(service *v1.Service) (int32, error) {
 	ipConfigCnt, err := consts.Getint32ValueFromK8sSvcAnnotation(
 		service.Annotations,
 		consts.ServiceAnnotationPLSIpConfigurationIPAddressCount,
-		func(val *int32) error {
-			const (
-				MinimumNumOfIPConfig = 1
-				MaximumNumOfIPConfig = 8
-			)
-			if *val < MinimumNumOfIPConfig {
-				return fmt.Errorf("minimum number of private link service ipConfig is %d, %d provided", MinimumNumOfIPConfig, *val)
-			}
-			if *val > MaximumNumOfIPConfig {
-				return fmt.Errorf("maximum number of private link service ipConfig is %d, %d provided", MaximumNumOfIPConfig, *val)
-			}
-			return nil
-		},
+		validatePLSIPConfigCount,
 	)
 	if err != nil {
 		return 0, err
@@ -610,6 +686,21 @@ func getPLSIPConfigCount(service *v1.Service) (int32, error) {
 	return consts.PLSDefaultNumOfIPConfig, nil
 }
 
+// validatePLSIPConfigCount validates the number of the IP configs of the PLS.
+func validatePLSIPConfigCount(val *int32) error {
+	const (
+		MinimumNumOfIPConfig = 1
+		MaximumNumOfIPConfig = 8
+	)
+	if *val < MinimumNumOfIPConfig {
+		return fmt.Errorf("minimum number of private link service ipConfig is %d, %d provided", MinimumNumOfIPConfig, *val)
+	}
+	if *val > MaximumNumOfIPConfig {
+		return fmt.Errorf("maximum number of private link service ipConfig is %d, %d provided", MaximumNumOfIPConfig, *val)
+	}
+	return nil
+}
+
 func getPLSFqdns(service *v1.Service) []string {
 	fqdns := make([]string, 0)
 	if v, ok := service.Annotations[consts.ServiceAnnotationPLSFqdns]; ok {
@@ -660,35 +751,119 @@ func getPLSAutoApproval(service *v1.Service) []string {
 }
 
 func getPLSStaticIPs(service *v1.Service) (map[string]bool, string, error) {
+	if val, ok := service.Annotations[consts.ServiceAnnotationPLSIpConfigurationIPAddress]; ok {
+		return parsePLSStaticIPs(strings.Split(strings.TrimSpace(val), " "))
+	}
+	return make(map[string]bool), "", nil
+}
+
+// parsePLSStaticIPs validates the static IPs of the PLS and returns them with the primary one, which is the first IP.
+func parsePLSStaticIPs(ips []string) (map[string]bool, string, error) {
 	result := make(map[string]bool)
 	primaryIP := ""
-	if val, ok := service.Annotations[consts.ServiceAnnotationPLSIpConfigurationIPAddress]; ok {
-		ips := strings.Split(strings.TrimSpace(val), " ")
-		for _, ip := range ips {
-			ip = strings.TrimSpace(ip)
-			if ip == "" {
-				continue // skip empty string
-			}
+	for _, ip := range ips {
+		ip = strings.TrimSpace(ip)
+		if ip == "" {
+			continue // skip empty string
+		}
 
-			parsedIP := net.ParseIP(ip)
-			if parsedIP == nil {
-				return nil, "", fmt.Errorf("getPLSStaticIPs: %s is not a valid IP address", ip)
-			}
+		parsedIP := net.ParseIP(ip)
+		if parsedIP == nil {
+			return nil, "", fmt.Errorf("getPLSStaticIPs: %s is not a valid IP address", ip)
+		}
 
-			if parsedIP.To4() == nil {
-				return nil, "", fmt.Errorf("getPLSStaticIPs: private link service ip config only supports IPv4, %s provided", ip)
-			}
+		if parsedIP.To4() == nil {
+			return nil, "", fmt.Errorf("getPLSStaticIPs: private link service ip config only supports IPv4, %s provided", ip)
+		}
 
-			result[ip] = true
-			if primaryIP == "" {
-				primaryIP = ip
-			}
+		result[ip] = true
+		if primaryIP == "" {
+			primaryIP = ip
 		}
 	}
 
 	return result, primaryIP, nil
 }
 
+// privateLinkServiceConfig is the PLS configuration in the annotation ServiceAnnotationPLSConfig.
+// A nil field is not configured by the annotation.
+type privateLinkServiceConfig struct {
+	Visibility        *[]string `json:"visibility,omitempty"`
+	AutoApproval      *[]string `json:"autoApproval,omitempty"`
+	NATSubnet         *string   `json:"natSubnet,omitempty"`
+	NATIPAddressCount *int32    `json:"natIPAddressCount,omitempty"`
+	NATIPAddresses    *[]string `json:"natIPAddresses,omitempty"`
+	FQDNs             *[]string `json:"fqdns,omitempty"`
+}
+
+// getPLSConfig parses and validates the annotation ServiceAnnotationPLSConfig of the service.
+// It returns nil if the service does not have the annotation.
+func getPLSConfig(service *v1.Service) (*privateLinkServiceConfig, error) {
+	val, found := service.Annotations[consts.ServiceAnnotationPLSConfig]
+	if !found {
+		return nil, nil
+	}
+
+	config := &privateLinkServiceConfig{}
+	decoder := json.NewDecoder(bytes.NewBufferString(val))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("getPLSConfig: failed to parse annotation %s: %w", consts.ServiceAnnotationPLSConfig, err)
+	}
+
+	for _, field := range []struct {
+		name       string
+		set        bool
+		annotation string
+	}{
+		{"visibility", config.Visibility != nil, consts.ServiceAnnotationPLSVisibility},
+		{"autoApproval", config.AutoApproval != nil, consts.ServiceAnnotationPLSAutoApproval},
+		{"natSubnet", config.NATSubnet != nil, consts.ServiceAnnotationPLSIpConfigurationSubnet},
+		{"natIPAddressCount", config.NATIPAddressCount != nil, consts.ServiceAnnotationPLSIpConfigurationIPAddressCount},
+		{"natIPAddresses", config.NATIPAddresses != nil, consts.ServiceAnnotationPLSIpConfigurationIPAddress},
+		{"fqdns", config.FQDNs != nil, consts.ServiceAnnotationPLSFqdns},
+	} {
+		if _, found := service.Annotations[field.annotation]; field.set && found {
+			return nil, fmt.Errorf("getPLSConfig: %s in annotation %s cannot be used together with annotation %s", field.name, consts.ServiceAnnotationPLSConfig, field.annotation)
+		}
+	}
+
+	for _, field := range []struct {
+		name   string
+		values *[]string
+	}{
+		{"visibility", config.Visibility},
+		{"autoApproval", config.AutoApproval},
+		{"fqdns", config.FQDNs},
+	} {
+		if field.values == nil {
+			continue
+		}
+		for _, value := range *field.values {
+			if strings.TrimSpace(value) == "" {
+				return nil, fmt.Errorf("getPLSConfig: %s in annotation %s contains an empty value", field.name, consts.ServiceAnnotationPLSConfig)
+			}
+		}
+	}
+	if config.Visibility != nil && len(*config.Visibility) > 1 && sets.New(*config.Visibility...).Has("*") {
+		return nil, fmt.Errorf("getPLSConfig: visibility in annotation %s cannot contain \"*\" together with subscriptions", consts.ServiceAnnotationPLSConfig)
+	}
+	if config.NATSubnet != nil && strings.TrimSpace(*config.NATSubnet) == "" {
+		return nil, fmt.Errorf("getPLSConfig: natSubnet in annotation %s is empty", consts.ServiceAnnotationPLSConfig)
+	}
+	if config.NATIPAddressCount != nil {
+		if err := validatePLSIPConfigCount(config.NATIPAddressCount); err != nil {
+			return nil, fmt.Errorf("getPLSConfig: invalid natIPAddressCount in annotation %s: %w", consts.ServiceAnnotationPLSConfig, err)
+		}
+	}
+	if config.NATIPAddresses != nil {
+		if _, _, err := parsePLSStaticIPs(*config.NATIPAddresses); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
 func isManagedPrivateLinkSerivce(existingPLS *network.PrivateLinkService, clusterName string) bool {
 	tags := existingPLS.Tags
 	v, ok := tags[consts.ClusterNameTagKey]
@@ -715,7 +890,8 @@ func serviceHasAdditionalConfigs(service *v1.Service) bool {
 		consts.ServiceAnnotationPLSFqdns,
 		consts.ServiceAnnotationPLSProxyProtocol,
 		consts.ServiceAnnotationPLSVisibility,
-		consts.ServiceAnnotationPLSAutoApproval}
+		consts.ServiceAnnotationPLSAutoApproval,
+		consts.ServiceAnnotationPLSConfig}
 	for _, k := range tagKeyList {
 		if _, found := service.Annotations[k]; found {
 			return true
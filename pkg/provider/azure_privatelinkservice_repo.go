@@ -18,6 +18,7 @@ package provider
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -33,8 +34,9 @@ import (
 )
 
 func (az *Cloud) CreateOrUpdatePLS(service *v1.Service, pls network.PrivateLinkService) error {
-	ctx, cancel := getContextWithCancel()
+	ctx, cancel := getContextWithTimeout(az.PrivateLinkServiceProvisioningTimeoutInSeconds)
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 
 	rerr := az.PrivateLinkServiceClient.CreateOrUpdate(ctx, az.PrivateLinkServiceResourceGroup, pointer.StringDeref(pls.Name, ""), pls, pointer.StringDeref(pls.Etag, ""))
 	if rerr == nil {
@@ -51,6 +53,13 @@ func (az *Cloud) CreateOrUpdatePLS(service *v1.Service, pls network.PrivateLinkS
 		klog.V(3).Infof("Private link service cache for %s is cleanup because of http.StatusPreconditionFailed", pointer.StringDeref(pls.Name, ""))
 		_ = az.plsCache.Delete(pointer.StringDeref((*pls.LoadBalancerFrontendIPConfigurations)[0].ID, ""))
 	}
+	// Invalidate the cache because the operation is canceled after the provisioning timeout while the private link
+	// service may still be provisioned.
+	if isContextDeadlineExceeded(rerr) {
+		klog.V(3).Infof("Private link service cache for %s is cleanup because CreateOrUpdatePrivateLinkService is not completed in %d seconds", pointer.StringDeref(pls.Name, ""), az.PrivateLinkServiceProvisioningTimeoutInSeconds)
+		_ = az.plsCache.Delete(pointer.StringDeref((*pls.LoadBalancerFrontendIPConfigurations)[0].ID, ""))
+		return fmt.Errorf("timed out creating or updating private link service %s after %d seconds: %w", pointer.StringDeref(pls.Name, ""), az.PrivateLinkServiceProvisioningTimeoutInSeconds, rerr.Error())
+	}
 	// Invalidate the cache because another new operation has canceled the current request.
 	if strings.Contains(strings.ToLower(rerr.Error().Error()), consts.OperationCanceledErrorMessage) {
 		klog.V(3).Infof("Private link service for %s is cleanup because CreateOrUpdatePrivateLinkService is canceled by another operation", pointer.StringDeref(pls.Name, ""))
@@ -64,6 +73,7 @@ func (az *Cloud) CreateOrUpdatePLS(service *v1.Service, pls network.PrivateLinkS
 func (az *Cloud) DeletePLS(service *v1.Service, plsName string, plsLBFrontendID string) *retry.Error {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 
 	rerr := az.PrivateLinkServiceClient.Delete(ctx, az.PrivateLinkServiceResourceGroup, plsName)
 	if rerr == nil {
@@ -81,6 +91,7 @@ func (az *Cloud) DeletePLS(service *v1.Service, plsName string, plsLBFrontendID
 func (az *Cloud) DeletePEConn(service *v1.Service, plsName string, peConnName string) *retry.Error {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 
 	rerr := az.PrivateLinkServiceClient.DeletePEConnection(ctx, az.PrivateLinkServiceResourceGroup, plsName, peConnName)
 	if rerr == nil {
@@ -630,6 +630,43 @@ func TestReconcilePLSIpConfigs(t *testing.T) {
 			},
 			expectedErr: true,
 		},
+		{
+			desc:    "reconcilePLSIpConfigs should report error when ip count in pls config is fewer than number of static IPs",
+			plsName: "testpls",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"natSubnet":"subnet","natIPAddressCount":1,"natIPAddresses":["10.2.0.4","10.2.0.5"]}`,
+			},
+			expectedErr: true,
+		},
+		{
+			desc:    "reconcilePLSIpConfigs should use the nat configurations in pls config",
+			plsName: "testpls",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"natSubnet":"subnet","natIPAddressCount":2,"natIPAddresses":["10.2.0.4"]}`,
+			},
+			expectedIPConfigs: &[]network.PrivateLinkServiceIPConfiguration{
+				{
+					Name: pointer.String("subnet-testpls-static-10.2.0.4"),
+					PrivateLinkServiceIPConfigurationProperties: &network.PrivateLinkServiceIPConfigurationProperties{
+						PrivateIPAddress:          pointer.String("10.2.0.4"),
+						PrivateIPAllocationMethod: network.Static,
+						Subnet:                    &network.Subnet{ID: pointer.String("subnetID")},
+						Primary:                   pointer.Bool(true),
+						PrivateIPAddressVersion:   network.IPv4,
+					},
+				},
+				{
+					Name: pointer.String("subnet-testpls-dynamic-0"),
+					PrivateLinkServiceIPConfigurationProperties: &network.PrivateLinkServiceIPConfigurationProperties{
+						PrivateIPAllocationMethod: network.Dynamic,
+						Subnet:                    &network.Subnet{ID: pointer.String("subnetID")},
+						Primary:                   pointer.Bool(false),
+						PrivateIPAddressVersion:   network.IPv4,
+					},
+				},
+			},
+			expectedChanged: true,
+		},
 		{
 			desc:    "reconcilePLSIpConfigs should change existingPLS if its ipConfig is nil",
 			plsName: "testpls",
@@ -1176,11 +1213,37 @@ func TestReconcilePLSFqdn(t *testing.T) {
 			expectedChanged: true,
 			expectedfqdns:   &[]string{"fqdns1", "fqdns2"},
 		},
+		{
+			desc: "fqdns should be changed according to pls config",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"fqdns":["fqdns1"]}`,
+			},
+			pls: &network.PrivateLinkService{
+				PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+					Fqdns: &[]string{"fqdns2"},
+				},
+			},
+			expectedChanged: true,
+			expectedfqdns:   &[]string{"fqdns1"},
+		},
+		{
+			desc: "fqdns not in pls config should not be changed",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"visibility":["*"]}`,
+			},
+			pls: &network.PrivateLinkService{
+				PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+					Fqdns: &[]string{"fqdns2"},
+				},
+			},
+			expectedfqdns: &[]string{"fqdns2"},
+		},
 	}
 	for i, test := range tests {
 		s := &v1.Service{}
 		s.Annotations = test.annotations
-		changed := reconcilePLSFqdn(test.pls, s)
+		changed, err := reconcilePLSFqdn(test.pls, s)
+		assert.NoError(t, err, "TestCase[%d]: %s", i, test.desc)
 		assert.Equal(t, test.expectedChanged, changed, "TestCase[%d]: %s", i, test.desc)
 		assert.Equal(t, test.expectedfqdns, test.pls.Fqdns, "TestCase[%d]: %s", i, test.desc)
 	}
@@ -1267,9 +1330,6 @@ func TestReconcilePLSVisibility(t *testing.T) {
 				Visibility: &network.PrivateLinkServicePropertiesVisibility{
 					Subscriptions: &[]string{"sub1", "sub2"},
 				},
-				AutoApproval: &network.PrivateLinkServicePropertiesAutoApproval{
-					Subscriptions: &[]string{},
-				},
 			},
 		}
 		service.Annotations = annotations
@@ -1341,6 +1401,44 @@ func TestReconcilePLSVisibility(t *testing.T) {
 		assert.True(t, changed)
 		assert.Equal(t, pls, expectedPLS)
 	})
+
+	t.Run("reconcilePLSVisibility should only change the fields in pls config", func(t *testing.T) {
+		service.Annotations = map[string]string{
+			consts.ServiceAnnotationPLSConfig: `{"visibility":["*"]}`,
+		}
+		pls = network.PrivateLinkService{
+			PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+				Visibility: &network.PrivateLinkServicePropertiesVisibility{
+					Subscriptions: &[]string{"sub1"},
+				},
+				AutoApproval: &network.PrivateLinkServicePropertiesAutoApproval{
+					Subscriptions: &[]string{"sub1"},
+				},
+			},
+		}
+		expectedPLS := network.PrivateLinkService{
+			PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+				Visibility: &network.PrivateLinkServicePropertiesVisibility{
+					Subscriptions: &[]string{"*"},
+				},
+				AutoApproval: &network.PrivateLinkServicePropertiesAutoApproval{
+					Subscriptions: &[]string{"sub1"},
+				},
+			},
+		}
+		changed, err := reconcilePLSVisibility(&pls, &service)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		assert.Equal(t, expectedPLS, pls)
+	})
+
+	t.Run("reconcilePLSVisibility should report error for invalid pls config", func(t *testing.T) {
+		service.Annotations = map[string]string{
+			consts.ServiceAnnotationPLSConfig: `{"visibility":"*"}`,
+		}
+		_, err := reconcilePLSVisibility(&pls, &service)
+		assert.Error(t, err)
+	})
 }
 
 func TestReconcilePLSTags(t *testing.T) {
@@ -1913,6 +2011,11 @@ func TestServiceHasAdditionalConfigs(t *testing.T) {
 			annotations: map[string]string{consts.ServiceAnnotationPLSAutoApproval: "test"},
 			expected:    true,
 		},
+		{
+			desc:        "Service with pls-config annotation should return true",
+			annotations: map[string]string{consts.ServiceAnnotationPLSConfig: "{}"},
+			expected:    true,
+		},
 	}
 	for i, c := range tests {
 		s := &v1.Service{}
@@ -1921,3 +2024,105 @@ func TestServiceHasAdditionalConfigs(t *testing.T) {
 		assert.Equal(t, actual, c.expected, "TestCase[%d]: %s", i, c.desc)
 	}
 }
+
+func TestGetPLSConfig(t *testing.T) {
+	for _, tc := range []struct {
+		desc           string
+		annotations    map[string]string
+		expectedConfig *privateLinkServiceConfig
+		expectedErr    bool
+	}{
+		{
+			desc: "no pls config",
+		},
+		{
+			desc: "all fields",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"visibility":["*"],"autoApproval":["sub1"],"natSubnet":"subnet","natIPAddressCount":2,"natIPAddresses":["10.2.0.4"],"fqdns":["pls.example.com"]}`,
+			},
+			expectedConfig: &privateLinkServiceConfig{
+				Visibility:        &[]string{"*"},
+				AutoApproval:      &[]string{"sub1"},
+				NATSubnet:         pointer.String("subnet"),
+				NATIPAddressCount: pointer.Int32(2),
+				NATIPAddresses:    &[]string{"10.2.0.4"},
+				FQDNs:             &[]string{"pls.example.com"},
+			},
+		},
+		{
+			desc: "pls config together with the annotations of other fields",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig:     `{"autoApproval":[]}`,
+				consts.ServiceAnnotationPLSVisibility: "sub1",
+			},
+			expectedConfig: &privateLinkServiceConfig{
+				AutoApproval: &[]string{},
+			},
+		},
+		{
+			desc: "invalid json",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"visibility":`,
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "unknown field",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"visibilities":["*"]}`,
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "field set both in pls config and by its annotation",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"fqdns":["pls.example.com"]}`,
+				consts.ServiceAnnotationPLSFqdns:  "pls.example.com",
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "visibility with * and subscriptions",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"visibility":["*","sub1"]}`,
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "empty auto-approval subscription",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"autoApproval":[" "]}`,
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "empty nat subnet",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"natSubnet":""}`,
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "too many nat IPs",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"natIPAddressCount":9}`,
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "IPv6 nat IP",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConfig: `{"natIPAddresses":["fd00::1"]}`,
+			},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			s := &v1.Service{}
+			s.Annotations = tc.annotations
+			config, err := getPLSConfig(s)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedConfig, config)
+		})
+	}
+}
@@ -37,8 +37,9 @@ import (
 
 // CreateOrUpdatePIP invokes az.PublicIPAddressesClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdatePIP(service *v1.Service, pipResourceGroup string, pip network.PublicIPAddress) error {
-	ctx, cancel := getContextWithCancel()
+	ctx, cancel := getContextWithTimeout(az.PublicIPProvisioningTimeoutInSeconds)
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 
 	rerr := az.PublicIPAddressesClient.CreateOrUpdate(ctx, pipResourceGroup, pointer.StringDeref(pip.Name, ""), pip)
 	klog.V(10).Infof("PublicIPAddressesClient.CreateOrUpdate(%s, %s): end", pipResourceGroup, pointer.StringDeref(pip.Name, ""))
@@ -58,6 +59,14 @@ func (az *Cloud) CreateOrUpdatePIP(service *v1.Service, pipResourceGroup string,
 		_ = az.pipCache.Delete(pipResourceGroup)
 	}
 
+	// Invalidate the cache because the operation is canceled after the provisioning timeout while the public IP
+	// may still be provisioned.
+	if isContextDeadlineExceeded(rerr) {
+		klog.V(3).Infof("PublicIP cache for (%s, %s) is cleanup because CreateOrUpdate is not completed in %d seconds", pipResourceGroup, pointer.StringDeref(pip.Name, ""), az.PublicIPProvisioningTimeoutInSeconds)
+		_ = az.pipCache.Delete(pipResourceGroup)
+		return fmt.Errorf("timed out creating or updating public IP (%s, %s) after %d seconds: %w", pipResourceGroup, pointer.StringDeref(pip.Name, ""), az.PublicIPProvisioningTimeoutInSeconds, rerr.Error())
+	}
+
 	retryErrorMessage := rerr.Error().Error()
 	// Invalidate the cache because another new operation has canceled the current request.
 	if strings.Contains(strings.ToLower(retryErrorMessage), consts.OperationCanceledErrorMessage) {
@@ -72,6 +81,7 @@ func (az *Cloud) CreateOrUpdatePIP(service *v1.Service, pipResourceGroup string,
 func (az *Cloud) DeletePublicIP(service *v1.Service, pipResourceGroup string, pipName string) error {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 
 	rerr := az.PublicIPAddressesClient.Delete(ctx, pipResourceGroup, pipName)
 	if rerr != nil {
@@ -17,6 +17,7 @@ limitations under the License.
 package provider
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -60,6 +61,11 @@ func TestCreateOrUpdatePIP(t *testing.T) {
 			expectedErr:        fmt.Errorf("Retriable: false, RetryAfter: 0s, HTTPStatusCode: 500, RawError: %w", error(nil)),
 			cacheExpectedEmpty: false,
 		},
+		{
+			clientErr:          &retry.Error{Retriable: true, RawError: context.DeadlineExceeded},
+			expectedErr:        fmt.Errorf("timed out creating or updating public IP (rg, nic) after 0 seconds: %w", fmt.Errorf("Retriable: true, RetryAfter: 0s, HTTPStatusCode: 0, RawError: %w", context.DeadlineExceeded)),
+			cacheExpectedEmpty: true,
+		},
 	}
 
 	for _, test := range tests {
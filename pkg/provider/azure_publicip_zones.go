@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// getZoneRedundantPublicIPName returns the name of the managed public IP of the service given its default name.
+// The zones of an existing public IP cannot be updated, so if ServiceAnnotationPIPZoneRedundant is set and the
+// default public IP is regional while the region has zones, the name of the zone-redundant public IP replacing it is
+// returned. The new public IP gets the zones of the region when it is created, the frontend of the service is
+// switched to it because the name differs, and the regional public IP is released as it is no longer desired.
+// Once created, the zone-redundant public IP is kept even if the annotation is removed, to avoid changing the IP again.
+func (az *Cloud) getZoneRedundantPublicIPName(service *v1.Service, pipName string) (string, error) {
+	if !az.useStandardLoadBalancer() || az.HasExtendedLocation() {
+		return pipName, nil
+	}
+
+	// the cached public IPs are looked up, which are refreshed whenever a public IP is created or updated, so that
+	// no more requests are sent for the services not asking for the replacement
+	pips, err := az.listPIP(az.getPublicIPAddressResourceGroup(service), azcache.CacheReadTypeDefault)
+	if err != nil {
+		return "", err
+	}
+	zoneRedundantPIPName := pipName + consts.ZoneRedundantPublicIPNameSuffix
+	var pip *network.PublicIPAddress
+	for i := range pips {
+		switch pointer.StringDeref(pips[i].Name, "") {
+		case zoneRedundantPIPName:
+			return zoneRedundantPIPName, nil
+		case pipName:
+			pip = &pips[i]
+		}
+	}
+	if !consts.IsPIPZoneRedundant(service.Annotations) {
+		return pipName, nil
+	}
+
+	// the new public IPs get the zones of the region anyway
+	if pip == nil || (pip.Zones != nil && len(*pip.Zones) > 0) {
+		return pipName, nil
+	}
+
+	location := pointer.StringDeref(pip.Location, az.Location)
+	zones, err := az.getRegionZonesBackoff(location)
+	if err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		klog.V(2).Infof("getZoneRedundantPublicIPName for service(%s): keeping the regional public IP %s since region %s has no zones", getServiceName(service), pipName, location)
+		return pipName, nil
+	}
+
+	klog.V(2).Infof("getZoneRedundantPublicIPName for service(%s): replacing the regional public IP %s with the zone-redundant public IP %s in zones %q", getServiceName(service), pipName, zoneRedundantPIPName, zones)
+	az.Event(service, v1.EventTypeNormal, "ReplacingRegionalPublicIP", fmt.Sprintf(
+		"Replacing the regional public IP %s with the zone-redundant public IP %s, the IP of the service will change", pipName, zoneRedundantPIPName))
+	return zoneRedundantPIPName, nil
+}
+
+// isDomainNameLabelHeldByRegionalPublicIP returns true if the regional public IP replaced by the zone-redundant
+// public IP still holds the domain name label. The label is unique in the region, so it is only set on the
+// zone-redundant public IP after the regional one is released.
+func (az *Cloud) isDomainNameLabelHeldByRegionalPublicIP(service *v1.Service, pipName, domainNameLabel string) (bool, error) {
+	if domainNameLabel == "" || !strings.HasSuffix(pipName, consts.ZoneRedundantPublicIPNameSuffix) {
+		return false, nil
+	}
+
+	regionalPIPName := strings.TrimSuffix(pipName, consts.ZoneRedundantPublicIPNameSuffix)
+	regionalPIP, exists, err := az.getPublicIPAddress(az.getPublicIPAddressResourceGroup(service), regionalPIPName, azcache.CacheReadTypeDefault)
+	if err != nil || !exists {
+		return false, err
+	}
+	return strings.EqualFold(getDomainNameLabel(&regionalPIP), domainNameLabel), nil
+}
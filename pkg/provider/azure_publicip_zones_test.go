@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestGetZoneRedundantPublicIPName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	regionalPIP := network.PublicIPAddress{
+		Name: pointer.String("pip"),
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			DNSSettings: &network.PublicIPAddressDNSSettings{DomainNameLabel: pointer.String("label")},
+		},
+	}
+	zonalPIP := network.PublicIPAddress{Name: pointer.String("pip"), Zones: &[]string{"1", "2", "3"}}
+	zoneRedundantPIP := network.PublicIPAddress{Name: pointer.String("pip-zr"), Zones: &[]string{"1", "2", "3"}}
+
+	for _, tc := range []struct {
+		desc         string
+		annotated    bool
+		basicSKU     bool
+		regionZones  []string
+		existingPIPs []network.PublicIPAddress
+		expectedName string
+	}{
+		{
+			desc:         "the regional public IP is kept without the annotation",
+			regionZones:  []string{"1", "2", "3"},
+			existingPIPs: []network.PublicIPAddress{regionalPIP},
+			expectedName: "pip",
+		},
+		{
+			desc:         "the regional public IP is replaced with the annotation if the region has zones",
+			annotated:    true,
+			regionZones:  []string{"1", "2", "3"},
+			existingPIPs: []network.PublicIPAddress{regionalPIP},
+			expectedName: "pip-zr",
+		},
+		{
+			desc:         "the regional public IP is kept if the region has no zones",
+			annotated:    true,
+			existingPIPs: []network.PublicIPAddress{regionalPIP},
+			expectedName: "pip",
+		},
+		{
+			desc:         "the zonal public IP is kept",
+			annotated:    true,
+			regionZones:  []string{"1", "2", "3"},
+			existingPIPs: []network.PublicIPAddress{zonalPIP},
+			expectedName: "pip",
+		},
+		{
+			desc:         "the new public IP gets the default name",
+			annotated:    true,
+			regionZones:  []string{"1", "2", "3"},
+			expectedName: "pip",
+		},
+		{
+			desc:         "the zone-redundant public IP is kept once created",
+			regionZones:  []string{"1", "2", "3"},
+			existingPIPs: []network.PublicIPAddress{regionalPIP, zoneRedundantPIP},
+			expectedName: "pip-zr",
+		},
+		{
+			desc:         "the basic public IPs are not replaced",
+			annotated:    true,
+			basicSKU:     true,
+			regionZones:  []string{"1", "2", "3"},
+			existingPIPs: []network.PublicIPAddress{regionalPIP},
+			expectedName: "pip",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			if !tc.basicSKU {
+				az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			}
+			az.regionZonesMap = map[string][]string{az.Location: tc.regionZones}
+			mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+			mockPIPClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return(tc.existingPIPs, nil).AnyTimes()
+
+			service := getTestService("service", v1.ProtocolTCP, nil, false, 80)
+			if tc.annotated {
+				service.Annotations[consts.ServiceAnnotationPIPZoneRedundant] = consts.TrueAnnotationValue
+			}
+
+			name, err := az.getZoneRedundantPublicIPName(&service, "pip")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedName, name)
+
+			// the DNS label is only set on the zone-redundant public IP once the regional one is released
+			held, err := az.isDomainNameLabelHeldByRegionalPublicIP(&service, name, "label")
+			assert.NoError(t, err)
+			assert.Equal(t, name == "pip-zr", held)
+		})
+	}
+}
@@ -19,6 +19,7 @@ package provider
 import (
 	"context"
 	"fmt"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +27,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
@@ -106,11 +108,17 @@ func (d *delayedRouteUpdater) updateRoutes() {
 	}
 
 	var err error
+	// rejectedOperations records the operations conflicting with the routes not managed by the provider.
+	rejectedOperations := make(map[*delayedRouteOperation]error)
 	defer func() {
 		// Notify all the goroutines.
 		for _, op := range d.routesToUpdate {
 			rt := op.(*delayedRouteOperation)
-			rt.result <- newBatchOperationResult("", false, err)
+			opErr := err
+			if rejectErr, ok := rejectedOperations[rt]; ok && opErr == nil {
+				opErr = rejectErr
+			}
+			rt.result <- newBatchOperationResult("", false, opErr)
 		}
 		// Clear all the jobs.
 		d.routesToUpdate = make([]batchOperation, 0)
@@ -127,7 +135,9 @@ func (d *delayedRouteUpdater) updateRoutes() {
 	}
 
 	// create route table if it doesn't exists yet.
-	if !existsRouteTable {
+	if !existsRouteTable && d.az.RouteReconciliationDryRun {
+		klog.Infof("updateRoutes: dry-run: would create route table %s", d.az.RouteTableName)
+	} else if !existsRouteTable {
 		err = d.az.createRouteTable()
 		if err != nil {
 			klog.Errorf("createRouteTable() failed with error: %v", err)
@@ -142,11 +152,13 @@ func (d *delayedRouteUpdater) updateRoutes() {
 	}
 
 	// reconcile routes.
-	dirty, onlyUpdateTags := false, true
-	routes := []network.Route{}
+	dirty, onlyUpdateTags, tagsUpdated := false, true, false
+	existingRoutes := []network.Route{}
 	if routeTable.RouteTablePropertiesFormat != nil && routeTable.RouteTablePropertiesFormat.Routes != nil {
-		routes = *routeTable.Routes
+		existingRoutes = *routeTable.Routes
 	}
+	// work on a copy so that the cached route table is not modified.
+	routes := append([]network.Route{}, existingRoutes...)
 
 	routes, dirty = d.cleanupOutdatedRoutes(routes)
 	if dirty {
@@ -157,14 +169,23 @@ func (d *delayedRouteUpdater) updateRoutes() {
 		rt := op.(*delayedRouteOperation)
 		if rt.operation == routeTableOperationUpdateTags {
 			routeTable.Tags = rt.routeTableTags
-			dirty = true
+			dirty, tagsUpdated = true, true
 			continue
 		}
 
-		routeMatch := false
+		routeMatch, protected := false, false
 		onlyUpdateTags = false
 		for i, existingRoute := range routes {
 			if strings.EqualFold(pointer.StringDeref(existingRoute.Name, ""), pointer.StringDeref(rt.route.Name, "")) {
+				// never change the routes not created by the provider even if their names collide.
+				if !isManagedRoute(existingRoute) {
+					protected = true
+					break
+				}
+				// the route of the node may have been replaced by the one of its new pod CIDR, which must be kept.
+				if rt.operation == routeOperationDelete && !routeAddressPrefixMatches(existingRoute, rt.route) {
+					break
+				}
 				// delete the name-matched routes here (missing routes would be added later if the operation is add).
 				routes = append(routes[:i], routes[i+1:]...)
 				if existingRoute.RoutePropertiesFormat != nil &&
@@ -179,6 +200,13 @@ func (d *delayedRouteUpdater) updateRoutes() {
 				break
 			}
 		}
+		if protected {
+			klog.Warningf("updateRoutes: skipping %s operation on route %s, which is not managed by the cloud provider", rt.operation, pointer.StringDeref(rt.route.Name, ""))
+			if rt.operation == routeOperationAdd {
+				rejectedOperations[rt] = fmt.Errorf("route %s conflicts with an existing route not managed by the cloud provider", pointer.StringDeref(rt.route.Name, ""))
+			}
+			continue
+		}
 		if rt.operation == routeOperationDelete && !dirty {
 			klog.Warningf("updateRoutes: route to be deleted %s does not match any of the existing route", pointer.StringDeref(rt.route.Name, ""))
 		}
@@ -193,6 +221,18 @@ func (d *delayedRouteUpdater) updateRoutes() {
 		}
 	}
 
+	if dirty && d.az.RouteReconciliationDryRun {
+		if !onlyUpdateTags {
+			logRouteChanges(existingRoutes, routes)
+		}
+		if tagsUpdated {
+			klog.Infof("updateRoutes: dry-run: would update the tags of route table %s", d.az.RouteTableName)
+		}
+		// fail the operations, so that the route controller does not take the routes as created.
+		err = fmt.Errorf("route table %s is not updated in the route reconciliation dry-run", d.az.RouteTableName)
+		return
+	}
+
 	if dirty {
 		if !onlyUpdateTags {
 			klog.V(2).Infof("updateRoutes: updating routes")
@@ -220,7 +260,7 @@ func (d *delayedRouteUpdater) cleanupOutdatedRoutes(existingRoutes []network.Rou
 
 		// filter out unmanaged routes
 		deleteRoute := false
-		if d.az.nodeNames.Has(split[0]) {
+		if d.az.nodeNames.Has(split[0]) && isManagedRoute(existingRoutes[i]) {
 			if d.az.ipv6DualStackEnabled && len(split) == 1 {
 				klog.V(2).Infof("cleanupOutdatedRoutes: deleting outdated non-dualstack route %s", existingRouteName)
 				deleteRoute = true
@@ -239,6 +279,71 @@ func (d *delayedRouteUpdater) cleanupOutdatedRoutes(existingRoutes []network.Rou
 	return existingRoutes, changed
 }
 
+// isManagedRoute returns true if the route has the format of the routes created by the provider, i.e., its next hop
+// is the virtual appliance of a node and its address prefix matches the pod CIDR in its name if any.
+// Other routes, e.g., the custom routes of a hub-spoke topology, are never changed by the provider.
+func isManagedRoute(route network.Route) bool {
+	if route.RoutePropertiesFormat == nil || route.NextHopType != network.RouteNextHopTypeVirtualAppliance {
+		return false
+	}
+	split := strings.Split(pointer.StringDeref(route.Name, ""), consts.RouteNameSeparator)
+	switch len(split) {
+	case 1:
+		return true
+	case 2:
+		return strings.EqualFold(split[1], cidrtoRfc1035(pointer.StringDeref(route.AddressPrefix, "")))
+	default:
+		return false
+	}
+}
+
+// routeAddressPrefixMatches returns true if the route of an operation, which may not specify the address prefix,
+// targets the same destination as the existing route.
+func routeAddressPrefixMatches(existingRoute, route network.Route) bool {
+	if route.RoutePropertiesFormat == nil || pointer.StringDeref(route.AddressPrefix, "") == "" {
+		return true
+	}
+	return strings.EqualFold(pointer.StringDeref(existingRoute.AddressPrefix, ""), pointer.StringDeref(route.AddressPrefix, ""))
+}
+
+// logRouteChanges logs the routes that would be added, updated or deleted in the dry-run mode.
+func logRouteChanges(existingRoutes, routes []network.Route) {
+	existing := make(map[string]network.Route, len(existingRoutes))
+	for _, route := range existingRoutes {
+		existing[strings.ToLower(pointer.StringDeref(route.Name, ""))] = route
+	}
+	for _, route := range routes {
+		name := pointer.StringDeref(route.Name, "")
+		existingRoute, ok := existing[strings.ToLower(name)]
+		delete(existing, strings.ToLower(name))
+		if !ok {
+			klog.Infof("updateRoutes: dry-run: would add route %s to %s via %s", name, getRouteAddressPrefix(route), getRouteNextHopIPAddress(route))
+			continue
+		}
+		if getRouteAddressPrefix(existingRoute) != getRouteAddressPrefix(route) || getRouteNextHopIPAddress(existingRoute) != getRouteNextHopIPAddress(route) {
+			klog.Infof("updateRoutes: dry-run: would update route %s from %s via %s to %s via %s", name,
+				getRouteAddressPrefix(existingRoute), getRouteNextHopIPAddress(existingRoute), getRouteAddressPrefix(route), getRouteNextHopIPAddress(route))
+		}
+	}
+	for _, route := range existing {
+		klog.Infof("updateRoutes: dry-run: would delete route %s to %s via %s", pointer.StringDeref(route.Name, ""), getRouteAddressPrefix(route), getRouteNextHopIPAddress(route))
+	}
+}
+
+func getRouteAddressPrefix(route network.Route) string {
+	if route.RoutePropertiesFormat == nil {
+		return ""
+	}
+	return pointer.StringDeref(route.AddressPrefix, "")
+}
+
+func getRouteNextHopIPAddress(route network.Route) string {
+	if route.RoutePropertiesFormat == nil {
+		return ""
+	}
+	return pointer.StringDeref(route.NextHopIPAddress, "")
+}
+
 func getAddRouteOperation(route network.Route) batchOperation {
 	return &delayedRouteOperation{
 		route:     route,
@@ -277,6 +382,12 @@ func (d *delayedRouteUpdater) removeOperation(name string) {}
 // ListRoutes lists all managed routes that belong to the specified clusterName
 func (az *Cloud) ListRoutes(ctx context.Context, clusterName string) ([]*cloudprovider.Route, error) {
 	klog.V(10).Infof("ListRoutes: START clusterName=%q", clusterName)
+	// the route controller skips the reconciliation until its next period while the writes are paused, instead of
+	// failing to create the route of every node
+	if err := az.degradedMode.checkWrites(); err != nil {
+		klog.Warningf("ListRoutes: pausing the routes: %s", err.Error())
+		return nil, err
+	}
 	routeTable, existsRouteTable, err := az.getRouteTable(azcache.CacheReadTypeDefault)
 	routes, err := processRoutes(az.ipv6DualStackEnabled, routeTable, existsRouteTable, err)
 	if err != nil {
@@ -301,7 +412,7 @@ func (az *Cloud) ListRoutes(ctx context.Context, clusterName string) ([]*cloudpr
 	}
 
 	// ensure the route table is tagged as configured
-	tags, changed := az.ensureRouteTableTagged(&routeTable)
+	tags, changed := az.ensureRouteTableTagged(clusterName, &routeTable)
 	if changed {
 		klog.V(2).Infof("ListRoutes: updating tags on route table %s", pointer.StringDeref(routeTable.Name, ""))
 		op := az.routeUpdater.addOperation(getUpdateRouteTableTagsOperation(tags))
@@ -368,12 +479,17 @@ func (az *Cloud) createRouteTable() error {
 // route.Name will be ignored, although the cloud-provider may use nameHint
 // to create a more user-meaningful name.
 func (az *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint string, kubeRoute *cloudprovider.Route) error {
-	mc := metrics.NewMetricContext("routes", "create_route", az.ResourceGroup, az.getNetworkResourceSubscriptionID(), string(kubeRoute.TargetNode))
+	mc := metrics.NewMetricContext("routes", "create_route", az.RouteTableResourceGroup, az.getRouteTableSubscriptionID(), string(kubeRoute.TargetNode))
 	isOperationSucceeded := false
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded)
 	}()
 
+	if err := az.degradedMode.checkWrites(); err != nil {
+		klog.Warningf("CreateRoute: pausing the route of node %q: %s", kubeRoute.TargetNode, err.Error())
+		return err
+	}
+
 	// Returns  for unmanaged nodes because azure cloud provider couldn't fetch information for them.
 	var targetIP string
 	nodeName := string(kubeRoute.TargetNode)
@@ -389,11 +505,24 @@ func (az *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint s
 		return nil
 	}
 
+	if az.usesRouteTableInPeeredVNet() {
+		az.validateRouteTableAssociation(kubeRoute.TargetNode)
+	}
+
 	CIDRv6 := utilnet.IsIPv6CIDRString(kubeRoute.DestinationCIDR)
-	// if single stack IPv4 then get the IP for the primary ip config
+	nextHopIP, useNextHopIP, err := az.getRouteNextHopIPAddress(kubeRoute.TargetNode, CIDRv6)
+	if err != nil {
+		klog.Errorf("CreateRoute: failed to get the next hop of the route for node %q: %v", kubeRoute.TargetNode, err)
+		return err
+	}
+	// route the pod CIDR through the network virtual appliance of the node pool if configured.
+	// Otherwise, if single stack IPv4 then get the IP for the primary ip config
 	// single stack IPv6 is supported on dual stack host. So the IPv6 IP is secondary IP for both single stack IPv6 and dual stack
 	// Get all private IPs for the machine and find the first one that matches the IPv6 family
-	if !az.ipv6DualStackEnabled && !CIDRv6 {
+	if useNextHopIP {
+		klog.V(4).Infof("CreateRoute: routing cidr=%q of instance=%q through the network virtual appliance %s", kubeRoute.DestinationCIDR, kubeRoute.TargetNode, nextHopIP)
+		targetIP = nextHopIP
+	} else if !az.ipv6DualStackEnabled && !CIDRv6 {
 		targetIP, _, err = az.getIPForMachine(kubeRoute.TargetNode)
 		if err != nil {
 			return err
@@ -402,13 +531,19 @@ func (az *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint s
 		// for dual stack and single stack IPv6 we need to select
 		// a private ip that matches family of the cidr
 		klog.V(4).Infof("CreateRoute: create route instance=%q cidr=%q is in dual stack mode", kubeRoute.TargetNode, kubeRoute.DestinationCIDR)
-		nodePrivateIPs, err := az.getPrivateIPsForMachine(kubeRoute.TargetNode)
-		if nil != err {
-			klog.V(3).Infof("CreateRoute: create route: failed(GetPrivateIPsByNodeName) instance=%q cidr=%q with error=%v", kubeRoute.TargetNode, kubeRoute.DestinationCIDR, err)
-			return err
-		}
+		// the private IP known from the node addresses is used first to save the calls to get the VM, unless the
+		// node has several IPs of the family
+		targetIP, err = findOnlyIPByFamily(az.getNodePrivateIPsFromTopology(string(kubeRoute.TargetNode)), CIDRv6)
+		if err != nil {
+			var nodePrivateIPs []string
+			nodePrivateIPs, err = az.getPrivateIPsForMachine(kubeRoute.TargetNode)
+			if nil != err {
+				klog.V(3).Infof("CreateRoute: create route: failed(GetPrivateIPsByNodeName) instance=%q cidr=%q with error=%v", kubeRoute.TargetNode, kubeRoute.DestinationCIDR, err)
+				return err
+			}
 
-		targetIP, err = findFirstIPByFamily(nodePrivateIPs, CIDRv6)
+			targetIP, err = findFirstIPByFamily(nodePrivateIPs, CIDRv6)
+		}
 		if nil != err {
 			klog.V(3).Infof("CreateRoute: create route: failed(findFirstIpByFamily) instance=%q cidr=%q with error=%v", kubeRoute.TargetNode, kubeRoute.DestinationCIDR, err)
 			return err
@@ -443,12 +578,17 @@ func (az *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint s
 // DeleteRoute deletes the specified managed route
 // Route should be as returned by ListRoutes
 func (az *Cloud) DeleteRoute(ctx context.Context, clusterName string, kubeRoute *cloudprovider.Route) error {
-	mc := metrics.NewMetricContext("routes", "delete_route", az.ResourceGroup, az.getNetworkResourceSubscriptionID(), string(kubeRoute.TargetNode))
+	mc := metrics.NewMetricContext("routes", "delete_route", az.RouteTableResourceGroup, az.getRouteTableSubscriptionID(), string(kubeRoute.TargetNode))
 	isOperationSucceeded := false
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded)
 	}()
 
+	if err := az.degradedMode.checkWrites(); err != nil {
+		klog.Warningf("DeleteRoute: pausing the route of node %q: %s", kubeRoute.TargetNode, err.Error())
+		return err
+	}
+
 	// Returns  for unmanaged nodes because azure cloud provider couldn't fetch information for them.
 	nodeName := string(kubeRoute.TargetNode)
 	unmanaged, err := az.IsNodeUnmanaged(nodeName)
@@ -466,8 +606,10 @@ func (az *Cloud) DeleteRoute(ctx context.Context, clusterName string, kubeRoute
 	routeName := mapNodeNameToRouteName(az.ipv6DualStackEnabled, kubeRoute.TargetNode, kubeRoute.DestinationCIDR)
 	klog.V(2).Infof("DeleteRoute: deleting route. clusterName=%q instance=%q cidr=%q routeName=%q", clusterName, kubeRoute.TargetNode, kubeRoute.DestinationCIDR, routeName)
 	route := network.Route{
-		Name:                  pointer.String(routeName),
-		RoutePropertiesFormat: &network.RoutePropertiesFormat{},
+		Name: pointer.String(routeName),
+		RoutePropertiesFormat: &network.RoutePropertiesFormat{
+			AddressPrefix: pointer.String(kubeRoute.DestinationCIDR),
+		},
 	}
 	op := az.routeUpdater.addOperation(getDeleteRouteOperation(route))
 
@@ -539,6 +681,20 @@ func findFirstIPByFamily(ips []string, v6 bool) (string, error) {
 	return "", fmt.Errorf("no match found matching the ipfamily requested")
 }
 
+// findOnlyIPByFamily returns the IP of the family if there is exactly one.
+func findOnlyIPByFamily(ips []string, v6 bool) (string, error) {
+	var found []string
+	for _, ip := range ips {
+		if utilnet.IsIPv6String(ip) == v6 {
+			found = append(found, ip)
+		}
+	}
+	if len(found) != 1 {
+		return "", fmt.Errorf("found %d IPs matching the ipfamily requested", len(found))
+	}
+	return found[0], nil
+}
+
 // strips : . /
 func cidrtoRfc1035(cidr string) string {
 	cidr = strings.ReplaceAll(cidr, ":", "")
@@ -548,11 +704,11 @@ func cidrtoRfc1035(cidr string) string {
 }
 
 // ensureRouteTableTagged ensures the route table is tagged as configured
-func (az *Cloud) ensureRouteTableTagged(rt *network.RouteTable) (map[string]*string, bool) {
-	if az.Tags == "" && (az.TagsMap == nil || len(az.TagsMap) == 0) {
+func (az *Cloud) ensureRouteTableTagged(clusterName string, rt *network.RouteTable) (map[string]*string, bool) {
+	if !az.hasConfigTags(consts.TagTemplateResourceRouteTable) {
 		return nil, false
 	}
-	tags := parseTags(az.Tags, az.TagsMap)
+	tags := az.getConfigTags(consts.TagTemplateResourceRouteTable, tagTemplateValues{clusterName: clusterName})
 	if rt.Tags == nil {
 		rt.Tags = make(map[string]*string)
 	}
@@ -562,3 +718,67 @@ func (az *Cloud) ensureRouteTableTagged(rt *network.RouteTable) (map[string]*str
 
 	return rt.Tags, changed
 }
+
+// validateRouteNextHops validates the network virtual appliances configured for the pod CIDR routes.
+func validateRouteNextHops(nextHops []RouteNextHopConfig) error {
+	vmSetNames := sets.New[string]()
+	for i, nextHop := range nextHops {
+		if len(nextHop.VMSetNames) == 0 {
+			return fmt.Errorf("routeNextHops[%d]: vmSetNames must not be empty", i)
+		}
+		for _, vmSetName := range nextHop.VMSetNames {
+			if vmSetNames.Has(strings.ToLower(vmSetName)) {
+				return fmt.Errorf("routeNextHops[%d]: vmSet %s is configured more than once", i, vmSetName)
+			}
+			vmSetNames.Insert(strings.ToLower(vmSetName))
+		}
+
+		if len(nextHop.NextHopIPAddresses) == 0 {
+			return fmt.Errorf("routeNextHops[%d]: nextHopIPAddresses must not be empty", i)
+		}
+		families := sets.New[bool]()
+		for _, ip := range nextHop.NextHopIPAddresses {
+			if net.ParseIP(ip) == nil {
+				return fmt.Errorf("routeNextHops[%d]: invalid next hop IP address %q", i, ip)
+			}
+			if families.Has(utilnet.IsIPv6String(ip)) {
+				return fmt.Errorf("routeNextHops[%d]: more than one next hop IP address of the same IP family", i)
+			}
+			families.Insert(utilnet.IsIPv6String(ip))
+		}
+	}
+	return nil
+}
+
+// getRouteNextHopIPAddress returns the IP address of the network virtual appliance configured for the node pool
+// of the node and the IP family of the pod CIDR, and false if the routes of the node pool go to the node.
+func (az *Cloud) getRouteNextHopIPAddress(nodeName types.NodeName, isIPv6 bool) (string, bool, error) {
+	if len(az.RouteNextHops) == 0 {
+		return "", false, nil
+	}
+	if az.nodeLister == nil {
+		return "", false, fmt.Errorf("getRouteNextHopIPAddress: node lister is not initialized")
+	}
+
+	node, err := az.nodeLister.Get(string(nodeName))
+	if err != nil {
+		return "", false, err
+	}
+	vmSetName, err := az.VMSet.GetNodeVMSetName(node)
+	if err != nil {
+		return "", false, err
+	}
+	for _, nextHop := range az.RouteNextHops {
+		for _, name := range nextHop.VMSetNames {
+			if !strings.EqualFold(name, vmSetName) {
+				continue
+			}
+			ip, err := findFirstIPByFamily(nextHop.NextHopIPAddresses, isIPv6)
+			if err != nil {
+				return "", false, fmt.Errorf("no next hop IP address of the IP family of the pod CIDR is configured for vmSet %s: %w", vmSetName, err)
+			}
+			return ip, true, nil
+		}
+	}
+	return "", false, nil
+}
@@ -28,8 +28,12 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/utils/pointer"
 
@@ -66,9 +70,7 @@ func TestDeleteRoute(t *testing.T) {
 		Location: &cloud.Location,
 		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
 			Routes: &[]network.Route{
-				{
-					Name: &routeName,
-				},
+				getTestManagedRoute(routeName, route.DestinationCIDR),
 			},
 		},
 	}
@@ -141,12 +143,8 @@ func TestDeleteRouteDualStack(t *testing.T) {
 		Location: &cloud.Location,
 		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
 			Routes: &[]network.Route{
-				{
-					Name: &routeName,
-				},
-				{
-					Name: &routeNameIPV4,
-				},
+				getTestManagedRoute(routeName, route.DestinationCIDR),
+				getTestManagedRoute(routeNameIPV4, route.DestinationCIDR),
 			},
 		},
 	}
@@ -155,9 +153,7 @@ func TestDeleteRouteDualStack(t *testing.T) {
 		Location: &cloud.Location,
 		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
 			Routes: &[]network.Route{
-				{
-					Name: &routeNameIPV4,
-				},
+				getTestManagedRoute(routeNameIPV4, route.DestinationCIDR),
 			},
 		},
 	}
@@ -747,11 +743,11 @@ func TestCleanupOutdatedRoutes(t *testing.T) {
 		{
 			description: "cleanupOutdatedRoutes should delete outdated non-dualstack routes when dualstack is enabled",
 			existingRoutes: []network.Route{
-				{Name: pointer.String("aks-node1-vmss000000____xxx")},
-				{Name: pointer.String("aks-node1-vmss000000")},
+				getTestManagedRoute("aks-node1-vmss000000____102440024", "10.244.0.0/24"),
+				getTestManagedRoute("aks-node1-vmss000000", "10.244.0.0/24"),
 			},
 			expectedRoutes: []network.Route{
-				{Name: pointer.String("aks-node1-vmss000000____xxx")},
+				getTestManagedRoute("aks-node1-vmss000000____102440024", "10.244.0.0/24"),
 			},
 			existingNodeNames:   sets.New("aks-node1-vmss000000"),
 			enableIPV6DualStack: true,
@@ -760,11 +756,11 @@ func TestCleanupOutdatedRoutes(t *testing.T) {
 		{
 			description: "cleanupOutdatedRoutes should delete outdated dualstack routes when dualstack is disabled",
 			existingRoutes: []network.Route{
-				{Name: pointer.String("aks-node1-vmss000000____xxx")},
-				{Name: pointer.String("aks-node1-vmss000000")},
+				getTestManagedRoute("aks-node1-vmss000000____102440024", "10.244.0.0/24"),
+				getTestManagedRoute("aks-node1-vmss000000", "10.244.0.0/24"),
 			},
 			expectedRoutes: []network.Route{
-				{Name: pointer.String("aks-node1-vmss000000")},
+				getTestManagedRoute("aks-node1-vmss000000", "10.244.0.0/24"),
 			},
 			existingNodeNames: sets.New("aks-node1-vmss000000"),
 			expectedChanged:   true,
@@ -772,12 +768,12 @@ func TestCleanupOutdatedRoutes(t *testing.T) {
 		{
 			description: "cleanupOutdatedRoutes should not delete unmanaged routes when dualstack is enabled",
 			existingRoutes: []network.Route{
-				{Name: pointer.String("aks-node1-vmss000000____xxx")},
-				{Name: pointer.String("aks-node1-vmss000000")},
+				getTestManagedRoute("aks-node1-vmss000000____102440024", "10.244.0.0/24"),
+				getTestManagedRoute("aks-node1-vmss000000", "10.244.0.0/24"),
 			},
 			expectedRoutes: []network.Route{
-				{Name: pointer.String("aks-node1-vmss000000____xxx")},
-				{Name: pointer.String("aks-node1-vmss000000")},
+				getTestManagedRoute("aks-node1-vmss000000____102440024", "10.244.0.0/24"),
+				getTestManagedRoute("aks-node1-vmss000000", "10.244.0.0/24"),
 			},
 			existingNodeNames:   sets.New("aks-node1-vmss000001"),
 			enableIPV6DualStack: true,
@@ -785,15 +781,40 @@ func TestCleanupOutdatedRoutes(t *testing.T) {
 		{
 			description: "cleanupOutdatedRoutes should not delete unmanaged routes when dualstack is disabled",
 			existingRoutes: []network.Route{
-				{Name: pointer.String("aks-node1-vmss000000____xxx")},
-				{Name: pointer.String("aks-node1-vmss000000")},
+				getTestManagedRoute("aks-node1-vmss000000____102440024", "10.244.0.0/24"),
+				getTestManagedRoute("aks-node1-vmss000000", "10.244.0.0/24"),
 			},
 			expectedRoutes: []network.Route{
-				{Name: pointer.String("aks-node1-vmss000000____xxx")},
-				{Name: pointer.String("aks-node1-vmss000000")},
+				getTestManagedRoute("aks-node1-vmss000000____102440024", "10.244.0.0/24"),
+				getTestManagedRoute("aks-node1-vmss000000", "10.244.0.0/24"),
 			},
 			existingNodeNames: sets.New("aks-node1-vmss000001"),
 		},
+		{
+			description: "cleanupOutdatedRoutes should not delete the routes not created by the provider even if their names collide",
+			existingRoutes: []network.Route{
+				getTestManagedRoute("aks-node1-vmss000000____102440024", "10.244.0.0/24"),
+				{
+					Name: pointer.String("aks-node1-vmss000000"),
+					RoutePropertiesFormat: &network.RoutePropertiesFormat{
+						AddressPrefix: pointer.String("10.0.0.0/8"),
+						NextHopType:   network.RouteNextHopTypeVirtualNetworkGateway,
+					},
+				},
+			},
+			expectedRoutes: []network.Route{
+				getTestManagedRoute("aks-node1-vmss000000____102440024", "10.244.0.0/24"),
+				{
+					Name: pointer.String("aks-node1-vmss000000"),
+					RoutePropertiesFormat: &network.RoutePropertiesFormat{
+						AddressPrefix: pointer.String("10.0.0.0/8"),
+						NextHopType:   network.RouteNextHopTypeVirtualNetworkGateway,
+					},
+				},
+			},
+			existingNodeNames:   sets.New("aks-node1-vmss000000"),
+			enableIPV6DualStack: true,
+		},
 	} {
 		t.Run(testCase.description, func(t *testing.T) {
 			cloud := &Cloud{
@@ -811,3 +832,282 @@ func TestCleanupOutdatedRoutes(t *testing.T) {
 		})
 	}
 }
+
+func getTestManagedRoute(name, addressPrefix string) network.Route {
+	return network.Route{
+		Name: pointer.String(name),
+		RoutePropertiesFormat: &network.RoutePropertiesFormat{
+			AddressPrefix:    pointer.String(addressPrefix),
+			NextHopType:      network.RouteNextHopTypeVirtualAppliance,
+			NextHopIPAddress: pointer.String("10.0.0.4"),
+		},
+	}
+}
+
+func TestIsManagedRoute(t *testing.T) {
+	for _, testCase := range []struct {
+		description string
+		route       network.Route
+		expected    bool
+	}{
+		{
+			description: "should return true for the routes created by the provider",
+			route:       getTestManagedRoute("node1", "10.244.0.0/24"),
+			expected:    true,
+		},
+		{
+			description: "should return true for the dualstack routes created by the provider",
+			route:       getTestManagedRoute("node1____fd0012480", "fd00:1:2:4::/80"),
+			expected:    true,
+		},
+		{
+			description: "should return false for the routes without virtual appliance next hop",
+			route: network.Route{
+				Name: pointer.String("node1"),
+				RoutePropertiesFormat: &network.RoutePropertiesFormat{
+					AddressPrefix: pointer.String("0.0.0.0/0"),
+					NextHopType:   network.RouteNextHopTypeInternet,
+				},
+			},
+		},
+		{
+			description: "should return false for the dualstack routes whose address prefix does not match their name",
+			route:       getTestManagedRoute("node1____10244024", "10.0.0.0/8"),
+		},
+		{
+			description: "should return false for the routes without properties",
+			route:       network.Route{Name: pointer.String("node1")},
+		},
+	} {
+		t.Run(testCase.description, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, isManagedRoute(testCase.route))
+		})
+	}
+}
+
+func TestUpdateRoutesProtectsUnmanagedRoutes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	customRoute := network.Route{
+		Name: pointer.String("node1"),
+		RoutePropertiesFormat: &network.RoutePropertiesFormat{
+			AddressPrefix:    pointer.String("10.0.0.0/8"),
+			NextHopType:      network.RouteNextHopTypeVirtualAppliance,
+			NextHopIPAddress: pointer.String("10.1.0.4"),
+		},
+	}
+	firewallRoute := network.Route{
+		Name: pointer.String("node2"),
+		RoutePropertiesFormat: &network.RoutePropertiesFormat{
+			AddressPrefix: pointer.String("0.0.0.0/0"),
+			NextHopType:   network.RouteNextHopTypeVirtualNetworkGateway,
+		},
+	}
+	routeTable := network.RouteTable{
+		Name: pointer.String("rt"),
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{customRoute, firewallRoute},
+		},
+	}
+	mockRouteTableClient := cloud.RouteTablesClient.(*mockroutetableclient.MockInterface)
+	mockRouteTableClient.EXPECT().Get(gomock.Any(), "rg", "rt", "").Return(routeTable, nil)
+	mockRouteTableClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	d := newDelayedRouteUpdater(cloud, time.Second).(*delayedRouteUpdater)
+	cloud.routeUpdater = d
+	deleteOp := d.addOperation(getDeleteRouteOperation(network.Route{
+		Name:                  pointer.String("node1"),
+		RoutePropertiesFormat: &network.RoutePropertiesFormat{AddressPrefix: pointer.String("10.244.0.0/24")},
+	}))
+	addOp := d.addOperation(getAddRouteOperation(getTestManagedRoute("node2", "10.244.1.0/24")))
+	go d.updateRoutes()
+
+	assert.NoError(t, deleteOp.wait().err)
+	assert.EqualError(t, addOp.wait().err, "route node2 conflicts with an existing route not managed by the cloud provider")
+	assert.Equal(t, &[]network.Route{customRoute, firewallRoute}, routeTable.Routes)
+}
+
+func TestUpdateRoutesDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.RouteReconciliationDryRun = true
+	routeTable := network.RouteTable{
+		Name: pointer.String("rt"),
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{getTestManagedRoute("node1", "10.244.0.0/24")},
+		},
+	}
+	mockRouteTableClient := cloud.RouteTablesClient.(*mockroutetableclient.MockInterface)
+	mockRouteTableClient.EXPECT().Get(gomock.Any(), "rg", "rt", "").Return(routeTable, nil)
+	mockRouteTableClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	d := newDelayedRouteUpdater(cloud, time.Second).(*delayedRouteUpdater)
+	cloud.routeUpdater = d
+	deleteOp := d.addOperation(getDeleteRouteOperation(network.Route{
+		Name:                  pointer.String("node1"),
+		RoutePropertiesFormat: &network.RoutePropertiesFormat{AddressPrefix: pointer.String("10.244.0.0/24")},
+	}))
+	addOp := d.addOperation(getAddRouteOperation(getTestManagedRoute("node2", "10.244.1.0/24")))
+	go d.updateRoutes()
+
+	assert.EqualError(t, deleteOp.wait().err, "route table rt is not updated in the route reconciliation dry-run")
+	assert.EqualError(t, addOp.wait().err, "route table rt is not updated in the route reconciliation dry-run")
+	assert.Equal(t, &[]network.Route{getTestManagedRoute("node1", "10.244.0.0/24")}, routeTable.Routes)
+
+	// the operations not changing the route table succeed
+	addOp = d.addOperation(getAddRouteOperation(getTestManagedRoute("node1", "10.244.0.0/24")))
+	go d.updateRoutes()
+	assert.NoError(t, addOp.wait().err)
+}
+
+func TestUpdateRoutesReplacesManagedRoutes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.RouteUpdateWaitingInSeconds = 0
+	routeTable := network.RouteTable{
+		Name: pointer.String("rt"),
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{getTestManagedRoute("node1", "10.244.0.0/24")},
+		},
+	}
+	expectedRouteTable := network.RouteTable{
+		Name: pointer.String("rt"),
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{
+			Routes: &[]network.Route{getTestManagedRoute("node1", "10.244.5.0/24")},
+		},
+	}
+	mockRouteTableClient := cloud.RouteTablesClient.(*mockroutetableclient.MockInterface)
+	mockRouteTableClient.EXPECT().Get(gomock.Any(), "rg", "rt", "").Return(routeTable, nil)
+	mockRouteTableClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "rt", expectedRouteTable, "").Return(nil)
+
+	d := newDelayedRouteUpdater(cloud, time.Second).(*delayedRouteUpdater)
+	cloud.routeUpdater = d
+	// the pod CIDR of the node is changed, and the route of the new pod CIDR is added before the old one is deleted
+	addOp := d.addOperation(getAddRouteOperation(getTestManagedRoute("node1", "10.244.5.0/24")))
+	deleteOp := d.addOperation(getDeleteRouteOperation(network.Route{
+		Name:                  pointer.String("node1"),
+		RoutePropertiesFormat: &network.RoutePropertiesFormat{AddressPrefix: pointer.String("10.244.0.0/24")},
+	}))
+	go d.updateRoutes()
+
+	assert.NoError(t, addOp.wait().err)
+	assert.NoError(t, deleteOp.wait().err)
+}
+
+func TestValidateRouteNextHops(t *testing.T) {
+	for _, testCase := range []struct {
+		description string
+		nextHops    []RouteNextHopConfig
+		expectedErr string
+	}{
+		{
+			description: "should accept one next hop IP address per IP family",
+			nextHops: []RouteNextHopConfig{
+				{VMSetNames: []string{"pool1", "pool2"}, NextHopIPAddresses: []string{"10.1.0.4", "fd00::4"}},
+				{VMSetNames: []string{"pool3"}, NextHopIPAddresses: []string{"10.2.0.4"}},
+			},
+		},
+		{
+			description: "should reject empty vmSetNames",
+			nextHops:    []RouteNextHopConfig{{NextHopIPAddresses: []string{"10.1.0.4"}}},
+			expectedErr: "routeNextHops[0]: vmSetNames must not be empty",
+		},
+		{
+			description: "should reject the vmSets configured more than once",
+			nextHops: []RouteNextHopConfig{
+				{VMSetNames: []string{"pool1"}, NextHopIPAddresses: []string{"10.1.0.4"}},
+				{VMSetNames: []string{"POOL1"}, NextHopIPAddresses: []string{"10.2.0.4"}},
+			},
+			expectedErr: "routeNextHops[1]: vmSet POOL1 is configured more than once",
+		},
+		{
+			description: "should reject empty nextHopIPAddresses",
+			nextHops:    []RouteNextHopConfig{{VMSetNames: []string{"pool1"}}},
+			expectedErr: "routeNextHops[0]: nextHopIPAddresses must not be empty",
+		},
+		{
+			description: "should reject invalid next hop IP addresses",
+			nextHops:    []RouteNextHopConfig{{VMSetNames: []string{"pool1"}, NextHopIPAddresses: []string{"10.1.0.0/24"}}},
+			expectedErr: `routeNextHops[0]: invalid next hop IP address "10.1.0.0/24"`,
+		},
+		{
+			description: "should reject more than one next hop IP address of the same IP family",
+			nextHops:    []RouteNextHopConfig{{VMSetNames: []string{"pool1"}, NextHopIPAddresses: []string{"10.1.0.4", "10.1.0.5"}}},
+			expectedErr: "routeNextHops[0]: more than one next hop IP address of the same IP family",
+		},
+	} {
+		t.Run(testCase.description, func(t *testing.T) {
+			err := validateRouteNextHops(testCase.nextHops)
+			if testCase.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testCase.expectedErr)
+			}
+		})
+	}
+}
+
+func TestCreateRouteWithNextHop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cloud := GetTestCloud(ctrl)
+	cloud.RouteNextHops = []RouteNextHopConfig{
+		{VMSetNames: []string{"pool1"}, NextHopIPAddresses: []string{"10.1.0.4", "fd00::4"}},
+	}
+	node1 := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	node2 := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}}
+	indexer := toolscache.NewIndexer(toolscache.MetaNamespaceKeyFunc, toolscache.Indexers{})
+	_ = indexer.Add(node1)
+	_ = indexer.Add(node2)
+	cloud.nodeLister = corelisters.NewNodeLister(indexer)
+
+	mockVMSet := NewMockVMSet(ctrl)
+	mockVMSet.EXPECT().GetNodeVMSetName(node1).Return("POOL1", nil).AnyTimes()
+	mockVMSet.EXPECT().GetNodeVMSetName(node2).Return("pool2", nil).AnyTimes()
+	mockVMSet.EXPECT().GetIPByNodeName("node2").Return("10.0.0.5", "", nil)
+	cloud.VMSet = mockVMSet
+
+	nextHopIP, useNextHopIP, err := cloud.getRouteNextHopIPAddress("node1", true)
+	assert.NoError(t, err)
+	assert.True(t, useNextHopIP)
+	assert.Equal(t, "fd00::4", nextHopIP)
+	_, useNextHopIP, err = cloud.getRouteNextHopIPAddress("node3", false)
+	assert.Error(t, err)
+	assert.False(t, useNextHopIP)
+
+	mockRouteTableClient := cloud.RouteTablesClient.(*mockroutetableclient.MockInterface)
+	mockRouteTableClient.EXPECT().Get(gomock.Any(), "rg", "rt", "").Return(network.RouteTable{
+		Name:                       pointer.String("rt"),
+		RouteTablePropertiesFormat: &network.RouteTablePropertiesFormat{},
+	}, nil).AnyTimes()
+	mockRouteTableClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "rt", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, routeTable network.RouteTable, _ string) *retry.Error {
+			assert.Len(t, *routeTable.Routes, 1)
+			route := (*routeTable.Routes)[0]
+			switch pointer.StringDeref(route.Name, "") {
+			case "node1":
+				assert.Equal(t, "10.1.0.4", pointer.StringDeref(route.NextHopIPAddress, ""))
+			case "node2":
+				assert.Equal(t, "10.0.0.5", pointer.StringDeref(route.NextHopIPAddress, ""))
+			default:
+				t.Errorf("unexpected route %s", pointer.StringDeref(route.Name, ""))
+			}
+			assert.Equal(t, network.RouteNextHopTypeVirtualAppliance, route.NextHopType)
+			return nil
+		}).Times(2)
+
+	cloud.routeUpdater = newDelayedRouteUpdater(cloud, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cloud.routeUpdater.run(ctx)
+
+	assert.NoError(t, cloud.CreateRoute(ctx, "cluster", "", &cloudprovider.Route{TargetNode: "node1", DestinationCIDR: "10.244.0.0/24"}))
+	assert.NoError(t, cloud.CreateRoute(ctx, "cluster", "", &cloudprovider.Route{TargetNode: "node2", DestinationCIDR: "10.244.1.0/24"}))
+}
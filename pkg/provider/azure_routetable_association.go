@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+var subnetIDRE = regexp.MustCompile(`(?i)/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Network/virtualNetworks/(.+)/subnets/(.+)`)
+
+// getRouteTableSubscriptionID returns the subscription id which hosts the route table
+func (az *Cloud) getRouteTableSubscriptionID() string {
+	if az.RouteTableSubscriptionID != "" {
+		return az.RouteTableSubscriptionID
+	}
+	return az.getNetworkResourceSubscriptionID()
+}
+
+// returns the full identifier of the route table.
+func (az *Cloud) getRouteTableID() string {
+	return fmt.Sprintf(
+		consts.RouteTableIDTemplate,
+		az.getRouteTableSubscriptionID(),
+		az.RouteTableResourceGroup,
+		az.RouteTableName)
+}
+
+// usesRouteTableInPeeredVNet returns true if the route table is brought by the user outside the network resources
+// of the cluster, e.g., in a hub VNet peered with the cluster VNet, so that its association with the node subnets
+// is not managed together with the cluster.
+func (az *Cloud) usesRouteTableInPeeredVNet() bool {
+	return az.RouteTableSubscriptionID != "" || az.RouteTableCredentials != nil
+}
+
+// validateRouteTableAssociation checks that the subnet of the node is associated with the route table, and emits
+// a warning event on the node otherwise, since the routes to the pod CIDRs would not apply to the node's traffic.
+// The subnets found associated are remembered so that they are not fetched again for every new node.
+func (az *Cloud) validateRouteTableAssociation(nodeName types.NodeName) {
+	nic, err := az.VMSet.GetPrimaryInterface(string(nodeName))
+	if err != nil {
+		klog.Warningf("validateRouteTableAssociation: failed to get the primary interface of node %q: %v", nodeName, err)
+		return
+	}
+	ipConfig, err := getPrimaryIPConfig(nic)
+	if err != nil {
+		klog.Warningf("validateRouteTableAssociation: failed to get the primary ip config of node %q: %v", nodeName, err)
+		return
+	}
+	if ipConfig.Subnet == nil || ipConfig.Subnet.ID == nil {
+		return
+	}
+	subnetID := *ipConfig.Subnet.ID
+	if _, ok := az.routeTableAssociatedSubnets.Load(strings.ToLower(subnetID)); ok {
+		return
+	}
+
+	matches := subnetIDRE.FindStringSubmatch(subnetID)
+	if len(matches) != 4 {
+		klog.Warningf("validateRouteTableAssociation: failed to parse the subnet ID %q of node %q", subnetID, nodeName)
+		return
+	}
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	subnet, rerr := az.SubnetsClient.Get(ctx, matches[1], matches[2], matches[3], "")
+	if rerr != nil {
+		klog.Warningf("validateRouteTableAssociation: failed to get the subnet %q of node %q: %v", subnetID, nodeName, rerr.Error())
+		return
+	}
+
+	routeTableID := az.getRouteTableID()
+	var associatedRouteTableID string
+	if subnet.SubnetPropertiesFormat != nil && subnet.RouteTable != nil {
+		associatedRouteTableID = pointer.StringDeref(subnet.RouteTable.ID, "")
+	}
+	if strings.EqualFold(associatedRouteTableID, routeTableID) {
+		az.routeTableAssociatedSubnets.Store(strings.ToLower(subnetID), true)
+		return
+	}
+
+	var message string
+	if associatedRouteTableID == "" {
+		message = fmt.Sprintf("subnet %s of node %s is not associated with route table %s", subnetID, nodeName, routeTableID)
+	} else {
+		message = fmt.Sprintf("subnet %s of node %s is associated with route table %s instead of %s", subnetID, nodeName, associatedRouteTableID, routeTableID)
+	}
+	klog.Warningf("validateRouteTableAssociation: %s", message)
+	nodeRef := &v1.ObjectReference{
+		Kind: "Node",
+		Name: string(nodeName),
+		UID:  types.UID(nodeName),
+	}
+	az.Event(nodeRef, v1.EventTypeWarning, "RouteTableNotAssociated", message)
+}
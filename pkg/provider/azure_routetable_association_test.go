@@ -0,0 +1,162 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
+	ratelimitconfig "sigs.k8s.io/cloud-provider-azure/pkg/provider/config"
+)
+
+func TestGetRouteTableSubscriptionID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.SubscriptionID = "sub"
+	assert.Equal(t, "sub", az.getRouteTableSubscriptionID())
+	assert.False(t, az.usesRouteTableInPeeredVNet())
+
+	az.NetworkResourceSubscriptionID = "network-sub"
+	assert.Equal(t, "network-sub", az.getRouteTableSubscriptionID())
+
+	az.RouteTableSubscriptionID = "hub-sub"
+	az.RouteTableResourceGroup = "hub-rg"
+	assert.Equal(t, "hub-sub", az.getRouteTableSubscriptionID())
+	assert.Equal(t, "/subscriptions/hub-sub/resourceGroups/hub-rg/providers/Microsoft.Network/routeTables/rt", az.getRouteTableID())
+	assert.True(t, az.usesRouteTableInPeeredVNet())
+
+	az.RouteTableSubscriptionID = ""
+	az.RouteTableCredentials = &ratelimitconfig.AzureAuthConfig{AADClientID: "hub-client"}
+	assert.True(t, az.usesRouteTableInPeeredVNet())
+}
+
+func TestGetRouteTableServicePrincipalToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	token, err := az.getRouteTableServicePrincipalToken()
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+
+	az.TenantID = "tenant"
+	az.Environment = azure.PublicCloud
+	az.RouteTableCredentials = &ratelimitconfig.AzureAuthConfig{}
+	_, err = az.getRouteTableServicePrincipalToken()
+	assert.ErrorIs(t, err, ratelimitconfig.ErrorNoAuth)
+
+	az.RouteTableCredentials = &ratelimitconfig.AzureAuthConfig{
+		AADClientID:     "hub-client",
+		AADClientSecret: "hub-secret",
+	}
+	token, err = az.getRouteTableServicePrincipalToken()
+	assert.NoError(t, err)
+	assert.NotNil(t, token)
+}
+
+func TestValidateRouteTableAssociation(t *testing.T) {
+	subnetID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet"
+	routeTableID := "/subscriptions/hub-sub/resourceGroups/hub-rg/providers/Microsoft.Network/routeTables/rt"
+
+	for _, tc := range []struct {
+		description            string
+		associatedRouteTableID *string
+		expectedEvent          string
+	}{
+		{
+			description:            "should not emit an event if the subnet is associated with the route table",
+			associatedRouteTableID: pointer.String("/subscriptions/hub-sub/resourceGroups/HUB-RG/providers/Microsoft.Network/routeTables/rt"),
+		},
+		{
+			description:   "should emit an event if the subnet is not associated with any route table",
+			expectedEvent: "Warning RouteTableNotAssociated subnet " + subnetID + " of node node1 is not associated with route table " + routeTableID,
+		},
+		{
+			description:            "should emit an event if the subnet is associated with another route table",
+			associatedRouteTableID: pointer.String("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/routeTables/other"),
+			expectedEvent: "Warning RouteTableNotAssociated subnet " + subnetID + " of node node1 is associated with route table " +
+				"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/routeTables/other instead of " + routeTableID,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			az.RouteTableSubscriptionID = "hub-sub"
+			az.RouteTableResourceGroup = "hub-rg"
+			recorder := record.NewFakeRecorder(10)
+			az.eventRecorder = recorder
+
+			nic := network.Interface{
+				Name: pointer.String("nic"),
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+					IPConfigurations: &[]network.InterfaceIPConfiguration{
+						{
+							InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+								Primary: pointer.Bool(true),
+								Subnet:  &network.Subnet{ID: pointer.String(subnetID)},
+							},
+						},
+					},
+				},
+			}
+			mockVMSet := NewMockVMSet(ctrl)
+			mockVMSet.EXPECT().GetPrimaryInterface("node1").Return(nic, nil).Times(2)
+			az.VMSet = mockVMSet
+
+			subnet := network.Subnet{
+				ID:                     pointer.String(subnetID),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{},
+			}
+			if tc.associatedRouteTableID != nil {
+				subnet.RouteTable = &network.RouteTable{ID: tc.associatedRouteTableID}
+			}
+			expectedGets := 2
+			if tc.expectedEvent == "" {
+				// the association is remembered
+				expectedGets = 1
+			}
+			mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+			mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", "").Return(subnet, nil).Times(expectedGets)
+
+			az.validateRouteTableAssociation("node1")
+			az.validateRouteTableAssociation("node1")
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if tc.expectedEvent == "" {
+				assert.Empty(t, events)
+			} else {
+				assert.Equal(t, []string{tc.expectedEvent, tc.expectedEvent}, events)
+			}
+		})
+	}
+}
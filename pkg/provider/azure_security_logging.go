@@ -0,0 +1,314 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/diagnosticsettingclient"
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// securityLoggingRetryInterval is the interval for retrying to ensure the security logging at startup.
+const securityLoggingRetryInterval = time.Minute
+
+// validateSecurityLoggingConfig returns an error if the destinations of the security logging are not configured.
+func validateSecurityLoggingConfig(config *SecurityLoggingConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.WorkspaceID == "" && config.StorageAccountID == "" {
+		return errors.New("securityLogging: at least one of workspaceID and storageAccountID is required")
+	}
+	if config.NetworkWatcherName != "" && config.StorageAccountID == "" {
+		return errors.New("securityLogging: storageAccountID is required by the flow logs")
+	}
+	if config.FlowLogRetentionDays < 0 {
+		return fmt.Errorf("securityLogging: flowLogRetentionDays %d should not be negative", config.FlowLogRetentionDays)
+	}
+	return nil
+}
+
+// runSecurityLoggingLoop ensures the diagnostic settings and the flow logs of the managed load balancers and security
+// group at startup, retrying until they are all ensured, and then periodically if IntervalInSeconds is set.
+func (az *Cloud) runSecurityLoggingLoop(ctx context.Context, config *SecurityLoggingConfig) {
+	klog.V(2).Info("runSecurityLoggingLoop: started")
+	err := wait.PollUntilContextCancel(ctx, securityLoggingRetryInterval, true, func(ctx context.Context) (bool, error) {
+		if err := az.ensureSecurityLogging(ctx, config); err != nil {
+			klog.Warningf("runSecurityLoggingLoop: failed to ensure the security logging, will retry: %s", err.Error())
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		klog.Infof("runSecurityLoggingLoop: stopped due to %s", err.Error())
+		return
+	}
+	if config.IntervalInSeconds <= 0 {
+		klog.V(2).Info("runSecurityLoggingLoop: the security logging is ensured")
+		return
+	}
+	err = wait.PollUntilContextCancel(ctx, time.Duration(config.IntervalInSeconds)*time.Second, false, func(ctx context.Context) (bool, error) {
+		if err := az.ensureSecurityLogging(ctx, config); err != nil {
+			klog.Warningf("runSecurityLoggingLoop: failed to ensure the security logging: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runSecurityLoggingLoop: stopped due to %s", err.Error())
+}
+
+// ensureSecurityLogging ensures the diagnostic settings of the security group and the load balancers managed by the
+// provider, and the flow logs of the security group if the network watcher is configured.
+func (az *Cloud) ensureSecurityLogging(ctx context.Context, config *SecurityLoggingConfig) error {
+	var errs []error
+	if az.SecurityGroupName != "" {
+		sg, err := az.getSecurityGroup(azcache.CacheReadTypeDefault)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get security group %s: %w", az.SecurityGroupName, err))
+		} else {
+			logs := &[]diagnosticsettingclient.LogSettings{
+				{CategoryGroup: pointer.String(consts.SecurityLoggingAllLogsCategoryGroup), Enabled: pointer.Bool(true)},
+			}
+			if err := az.ensureDiagnosticSetting(ctx, config, pointer.StringDeref(sg.ID, ""), logs, nil); err != nil {
+				errs = append(errs, err)
+			}
+			if config.NetworkWatcherName != "" {
+				if err := az.ensureSecurityGroupFlowLog(ctx, config, sg); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+
+	lbs, err := az.getSecurityLoggingLoadBalancers()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, lb := range lbs {
+		metrics := &[]diagnosticsettingclient.MetricSettings{
+			{Category: pointer.String(consts.SecurityLoggingAllMetricsCategory), Enabled: pointer.Bool(true)},
+		}
+		if err := az.ensureDiagnosticSetting(ctx, config, pointer.StringDeref(lb.ID, ""), nil, metrics); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// getSecurityLoggingLoadBalancers returns the load balancers managed by the provider, i.e. the load balancers of the
+// multiple standard load balancer configurations and the load balancers with the load balancing rules of the services.
+func (az *Cloud) getSecurityLoggingLoadBalancers() ([]network.LoadBalancer, error) {
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list load balancers: %w", err)
+	}
+	var services []*v1.Service
+	if az.serviceLister != nil {
+		services, err = az.serviceLister.List(labels.Everything())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list services: %w", err)
+		}
+	}
+
+	var managedLBs []network.LoadBalancer
+	for _, lb := range lbs {
+		if az.isSecurityLoggingLoadBalancer(lb, services) {
+			managedLBs = append(managedLBs, lb)
+		}
+	}
+	return managedLBs, nil
+}
+
+// isSecurityLoggingLoadBalancer returns true if the load balancer is managed by the provider.
+func (az *Cloud) isSecurityLoggingLoadBalancer(lb network.LoadBalancer, services []*v1.Service) bool {
+	lbName := strings.TrimSuffix(pointer.StringDeref(lb.Name, ""), consts.InternalLoadBalancerNameSuffix)
+	for _, multiSLBConfig := range az.MultipleStandardLoadBalancerConfigurations {
+		if strings.EqualFold(lbName, multiSLBConfig.Name) {
+			return true
+		}
+	}
+	if lb.LoadBalancerPropertiesFormat == nil || lb.LoadBalancingRules == nil {
+		return false
+	}
+	for _, rule := range *lb.LoadBalancingRules {
+		for _, service := range services {
+			if az.serviceOwnsRule(service, pointer.StringDeref(rule.Name, "")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ensureDiagnosticSetting creates or updates the diagnostic setting of the resource if it does not exist, or does not
+// send the expected logs and metrics to the configured destinations.
+func (az *Cloud) ensureDiagnosticSetting(
+	ctx context.Context,
+	config *SecurityLoggingConfig,
+	resourceID string,
+	logs *[]diagnosticsettingclient.LogSettings,
+	metrics *[]diagnosticsettingclient.MetricSettings,
+) error {
+	name := config.DiagnosticSettingName
+	if name == "" {
+		name = consts.SecurityLoggingDiagnosticSettingNameDefault
+	}
+	expected := diagnosticsettingclient.DiagnosticSettingsResource{
+		Name: pointer.String(name),
+		Properties: &diagnosticsettingclient.DiagnosticSettings{
+			Logs:    logs,
+			Metrics: metrics,
+		},
+	}
+	if config.WorkspaceID != "" {
+		expected.Properties.WorkspaceID = pointer.String(config.WorkspaceID)
+	}
+	if config.StorageAccountID != "" {
+		expected.Properties.StorageAccountID = pointer.String(config.StorageAccountID)
+	}
+
+	existing, rerr := az.DiagnosticSettingsClient.Get(ctx, resourceID, name)
+	if rerr != nil && !rerr.IsNotFound() {
+		return fmt.Errorf("failed to get diagnostic setting %s of %s: %w", name, resourceID, rerr.Error())
+	}
+	if rerr == nil && isDiagnosticSettingUpToDate(existing, expected) {
+		klog.V(4).Infof("ensureDiagnosticSetting: diagnostic setting %s of %s is up to date", name, resourceID)
+		return nil
+	}
+
+	klog.V(2).Infof("ensureDiagnosticSetting: enabling diagnostic setting %s of %s", name, resourceID)
+	if rerr := az.DiagnosticSettingsClient.CreateOrUpdate(ctx, resourceID, name, expected); rerr != nil {
+		return fmt.Errorf("failed to create or update diagnostic setting %s of %s: %w", name, resourceID, rerr.Error())
+	}
+	return nil
+}
+
+// isDiagnosticSettingUpToDate returns true if the existing diagnostic setting sends to the expected destinations and
+// enables all the expected logs and metrics.
+func isDiagnosticSettingUpToDate(existing, expected diagnosticsettingclient.DiagnosticSettingsResource) bool {
+	if existing.Properties == nil {
+		return false
+	}
+	if !strings.EqualFold(pointer.StringDeref(existing.Properties.WorkspaceID, ""), pointer.StringDeref(expected.Properties.WorkspaceID, "")) ||
+		!strings.EqualFold(pointer.StringDeref(existing.Properties.StorageAccountID, ""), pointer.StringDeref(expected.Properties.StorageAccountID, "")) {
+		return false
+	}
+	if expected.Properties.Logs != nil {
+		for _, expectedLog := range *expected.Properties.Logs {
+			found := false
+			if existing.Properties.Logs != nil {
+				for _, log := range *existing.Properties.Logs {
+					if pointer.BoolDeref(log.Enabled, false) &&
+						strings.EqualFold(pointer.StringDeref(log.Category, ""), pointer.StringDeref(expectedLog.Category, "")) &&
+						strings.EqualFold(pointer.StringDeref(log.CategoryGroup, ""), pointer.StringDeref(expectedLog.CategoryGroup, "")) {
+						found = true
+						break
+					}
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	if expected.Properties.Metrics != nil {
+		for _, expectedMetric := range *expected.Properties.Metrics {
+			found := false
+			if existing.Properties.Metrics != nil {
+				for _, metric := range *existing.Properties.Metrics {
+					if pointer.BoolDeref(metric.Enabled, false) &&
+						strings.EqualFold(pointer.StringDeref(metric.Category, ""), pointer.StringDeref(expectedMetric.Category, "")) {
+						found = true
+						break
+					}
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ensureSecurityGroupFlowLog creates or updates the flow log of the security group if it does not exist, or is not
+// enabled to the configured storage account with the configured retention. The traffic analytics and the tags of
+// the existing flow log are kept.
+func (az *Cloud) ensureSecurityGroupFlowLog(ctx context.Context, config *SecurityLoggingConfig, sg network.SecurityGroup) error {
+	nwResourceGroup := config.NetworkWatcherResourceGroup
+	if nwResourceGroup == "" {
+		nwResourceGroup = consts.SecurityLoggingNetworkWatcherResourceGroupDefault
+	}
+	name := fmt.Sprintf(consts.SecurityLoggingFlowLogNameTemplate, pointer.StringDeref(sg.Name, ""), az.SecurityGroupResourceGroup)
+	retentionDays := config.FlowLogRetentionDays
+
+	existing, rerr := az.FlowLogsClient.Get(ctx, nwResourceGroup, config.NetworkWatcherName, name)
+	if rerr != nil && !rerr.IsNotFound() {
+		return fmt.Errorf("failed to get flow log %s of security group %s: %w", name, pointer.StringDeref(sg.Name, ""), rerr.Error())
+	}
+	if rerr == nil && existing.FlowLogPropertiesFormat != nil &&
+		pointer.BoolDeref(existing.Enabled, false) &&
+		strings.EqualFold(pointer.StringDeref(existing.TargetResourceID, ""), pointer.StringDeref(sg.ID, "")) &&
+		strings.EqualFold(pointer.StringDeref(existing.StorageID, ""), config.StorageAccountID) &&
+		existing.RetentionPolicy != nil && pointer.Int32Deref(existing.RetentionPolicy.Days, 0) == retentionDays {
+		klog.V(4).Infof("ensureSecurityGroupFlowLog: flow log %s of security group %s is up to date", name, pointer.StringDeref(sg.Name, ""))
+		return nil
+	}
+
+	flowLog := network.FlowLog{
+		Location: pointer.String(az.Location),
+		FlowLogPropertiesFormat: &network.FlowLogPropertiesFormat{
+			TargetResourceID: sg.ID,
+			StorageID:        pointer.String(config.StorageAccountID),
+			Enabled:          pointer.Bool(true),
+			RetentionPolicy: &network.RetentionPolicyParameters{
+				Days:    pointer.Int32(retentionDays),
+				Enabled: pointer.Bool(retentionDays > 0),
+			},
+			Format: &network.FlowLogFormatParameters{
+				Type:    network.JSON,
+				Version: pointer.Int32(2),
+			},
+		},
+	}
+	if rerr == nil {
+		flowLog.Tags = existing.Tags
+		if existing.FlowLogPropertiesFormat != nil {
+			flowLog.FlowAnalyticsConfiguration = existing.FlowAnalyticsConfiguration
+		}
+	}
+
+	klog.V(2).Infof("ensureSecurityGroupFlowLog: enabling flow log %s of security group %s", name, pointer.StringDeref(sg.Name, ""))
+	if rerr := az.FlowLogsClient.CreateOrUpdate(ctx, nwResourceGroup, config.NetworkWatcherName, name, flowLog); rerr != nil {
+		return fmt.Errorf("failed to create or update flow log %s of security group %s: %w", name, pointer.StringDeref(sg.Name, ""), rerr.Error())
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/diagnosticsettingclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/diagnosticsettingclient/mockdiagnosticsettingclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/flowlogclient/mockflowlogclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestValidateSecurityLoggingConfig(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		config      *SecurityLoggingConfig
+		expectedErr bool
+	}{
+		{
+			desc: "nil config should be valid",
+		},
+		{
+			desc:        "config without destinations should be invalid",
+			config:      &SecurityLoggingConfig{},
+			expectedErr: true,
+		},
+		{
+			desc:   "config with workspace should be valid",
+			config: &SecurityLoggingConfig{WorkspaceID: "workspace"},
+		},
+		{
+			desc:        "flow logs without storage account should be invalid",
+			config:      &SecurityLoggingConfig{WorkspaceID: "workspace", NetworkWatcherName: "nw"},
+			expectedErr: true,
+		},
+		{
+			desc:        "negative retention should be invalid",
+			config:      &SecurityLoggingConfig{StorageAccountID: "storage", NetworkWatcherName: "nw", FlowLogRetentionDays: -1},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := validateSecurityLoggingConfig(tc.config)
+			assert.Equal(t, tc.expectedErr, err != nil)
+		})
+	}
+}
+
+func TestEnsureSecurityLogging(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	svc := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	client := fake.NewSimpleClientset(&svc)
+	az.KubeClient = client
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	az.serviceLister = informerFactory.Core().V1().Services().Lister()
+	_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+
+	config := &SecurityLoggingConfig{
+		WorkspaceID:          "workspace",
+		StorageAccountID:     "storage",
+		NetworkWatcherName:   "nw",
+		FlowLogRetentionDays: 7,
+	}
+	sgID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/nsg"
+	lbs := []network.LoadBalancer{
+		{
+			ID:   pointer.String("lb-service"),
+			Name: pointer.String("testCluster"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				LoadBalancingRules: &[]network.LoadBalancingRule{
+					{Name: pointer.String(az.getLoadBalancerRuleName(&svc, v1.ProtocolTCP, 80, false))},
+				},
+			},
+		},
+		{
+			ID:   pointer.String("lb-up-to-date"),
+			Name: pointer.String("testCluster-internal"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				LoadBalancingRules: &[]network.LoadBalancingRule{
+					{Name: pointer.String(az.getLoadBalancerRuleName(&svc, v1.ProtocolTCP, 80, false))},
+				},
+			},
+		},
+		{
+			// not managed by the provider
+			ID:   pointer.String("lb-unmanaged"),
+			Name: pointer.String("unmanaged"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				LoadBalancingRules: &[]network.LoadBalancingRule{{Name: pointer.String("rule")}},
+			},
+		},
+	}
+
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), "rg", "nsg", gomock.Any()).Return(network.SecurityGroup{ID: pointer.String(sgID), Name: pointer.String("nsg")}, nil)
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), "rg").Return(lbs, nil)
+
+	notFound := &retry.Error{HTTPStatusCode: http.StatusNotFound}
+	mockDSClient := az.DiagnosticSettingsClient.(*mockdiagnosticsettingclient.MockInterface)
+	mockDSClient.EXPECT().Get(gomock.Any(), sgID, consts.SecurityLoggingDiagnosticSettingNameDefault).Return(diagnosticsettingclient.DiagnosticSettingsResource{}, notFound)
+	mockDSClient.EXPECT().CreateOrUpdate(gomock.Any(), sgID, consts.SecurityLoggingDiagnosticSettingNameDefault, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, setting diagnosticsettingclient.DiagnosticSettingsResource) *retry.Error {
+			assert.Equal(t, "workspace", *setting.Properties.WorkspaceID)
+			assert.Equal(t, "storage", *setting.Properties.StorageAccountID)
+			assert.Equal(t, consts.SecurityLoggingAllLogsCategoryGroup, *(*setting.Properties.Logs)[0].CategoryGroup)
+			assert.Nil(t, setting.Properties.Metrics)
+			return nil
+		})
+	mockDSClient.EXPECT().Get(gomock.Any(), "lb-service", consts.SecurityLoggingDiagnosticSettingNameDefault).Return(diagnosticsettingclient.DiagnosticSettingsResource{
+		Properties: &diagnosticsettingclient.DiagnosticSettings{
+			// sent to another workspace
+			WorkspaceID:      pointer.String("other"),
+			StorageAccountID: pointer.String("storage"),
+			Metrics:          &[]diagnosticsettingclient.MetricSettings{{Category: pointer.String(consts.SecurityLoggingAllMetricsCategory), Enabled: pointer.Bool(true)}},
+		},
+	}, nil)
+	mockDSClient.EXPECT().CreateOrUpdate(gomock.Any(), "lb-service", consts.SecurityLoggingDiagnosticSettingNameDefault, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, setting diagnosticsettingclient.DiagnosticSettingsResource) *retry.Error {
+			assert.Equal(t, "workspace", *setting.Properties.WorkspaceID)
+			assert.Equal(t, consts.SecurityLoggingAllMetricsCategory, *(*setting.Properties.Metrics)[0].Category)
+			assert.Nil(t, setting.Properties.Logs)
+			return nil
+		})
+	mockDSClient.EXPECT().Get(gomock.Any(), "lb-up-to-date", consts.SecurityLoggingDiagnosticSettingNameDefault).Return(diagnosticsettingclient.DiagnosticSettingsResource{
+		Properties: &diagnosticsettingclient.DiagnosticSettings{
+			WorkspaceID:      pointer.String("Workspace"),
+			StorageAccountID: pointer.String("storage"),
+			Metrics:          &[]diagnosticsettingclient.MetricSettings{{Category: pointer.String(consts.SecurityLoggingAllMetricsCategory), Enabled: pointer.Bool(true)}},
+		},
+	}, nil)
+
+	analytics := &network.TrafficAnalyticsProperties{}
+	mockFlowLogClient := az.FlowLogsClient.(*mockflowlogclient.MockInterface)
+	mockFlowLogClient.EXPECT().Get(gomock.Any(), consts.SecurityLoggingNetworkWatcherResourceGroupDefault, "nw", "nsg-rg-flowlog").Return(network.FlowLog{
+		Tags: map[string]*string{"key": pointer.String("value")},
+		FlowLogPropertiesFormat: &network.FlowLogPropertiesFormat{
+			TargetResourceID:           pointer.String(sgID),
+			StorageID:                  pointer.String("storage"),
+			Enabled:                    pointer.Bool(false),
+			FlowAnalyticsConfiguration: analytics,
+		},
+	}, nil)
+	mockFlowLogClient.EXPECT().CreateOrUpdate(gomock.Any(), consts.SecurityLoggingNetworkWatcherResourceGroupDefault, "nw", "nsg-rg-flowlog", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _, _ string, flowLog network.FlowLog) *retry.Error {
+			assert.Equal(t, sgID, *flowLog.TargetResourceID)
+			assert.Equal(t, "storage", *flowLog.StorageID)
+			assert.True(t, *flowLog.Enabled)
+			assert.Equal(t, int32(7), *flowLog.RetentionPolicy.Days)
+			assert.True(t, *flowLog.RetentionPolicy.Enabled)
+			assert.Equal(t, analytics, flowLog.FlowAnalyticsConfiguration)
+			assert.Equal(t, "value", *flowLog.Tags["key"])
+			return nil
+		})
+
+	err := az.ensureSecurityLogging(context.TODO(), config)
+	assert.NoError(t, err)
+}
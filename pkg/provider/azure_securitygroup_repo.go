@@ -33,6 +33,10 @@ import (
 
 // CreateOrUpdateSecurityGroup invokes az.SecurityGroupsClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateSecurityGroup(sg network.SecurityGroup) error {
+	if err := az.degradedMode.checkWrites(); err != nil {
+		return err
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
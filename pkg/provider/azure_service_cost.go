@@ -0,0 +1,183 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+// runServiceCostAttributionLoop periodically exports the Azure resources consumed by the LoadBalancer services.
+func (az *Cloud) runServiceCostAttributionLoop(ctx context.Context, interval time.Duration) {
+	klog.V(2).Info("runServiceCostAttributionLoop: started")
+	err := wait.PollUntilContextCancel(ctx, interval, false, func(ctx context.Context) (bool, error) {
+		if err := az.exportServiceCostAttribution(); err != nil {
+			klog.Warningf("runServiceCostAttributionLoop: failed to export the Azure resources of the services: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runServiceCostAttributionLoop: stopped due to %s", err.Error())
+}
+
+// exportServiceCostAttribution maps each LoadBalancer service to the Azure resources it consumes, and exports them
+// by metrics. The metrics are kept unchanged if the load balancers or the private link services cannot be listed.
+func (az *Cloud) exportServiceCostAttribution() error {
+	if az.serviceLister == nil {
+		klog.V(4).Info("exportServiceCostAttribution: the service lister is not initialized, skip exporting")
+		return nil
+	}
+	services, err := az.serviceLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		return err
+	}
+	plsIDs, err := az.listPrivateLinkServiceIDsByFrontendIPConfig()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	var records []metrics.ServiceAzureResources
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer || service.DeletionTimestamp != nil ||
+			!az.isServiceReconciledByLoadBalancerClass(service) {
+			continue
+		}
+		record, err := az.getServiceAzureResources(service, lbs, plsIDs)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get the Azure resources of service %s: %w", getServiceName(service), err))
+			continue
+		}
+		if record != nil {
+			records = append(records, *record)
+		}
+	}
+	metrics.SetServiceAzureResources(records)
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// listPrivateLinkServiceIDsByFrontendIPConfig returns the IDs of the private link services keyed by the lower-cased
+// IDs of the frontend IP configurations they are attached to.
+func (az *Cloud) listPrivateLinkServiceIDsByFrontendIPConfig() (map[string]string, error) {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	plsList, rerr := az.PrivateLinkServiceClient.List(ctx, az.PrivateLinkServiceResourceGroup)
+	exists, rerr := checkResourceExistsFromError(rerr)
+	if rerr != nil {
+		return nil, fmt.Errorf("failed to list private link services: %w", rerr.Error())
+	}
+
+	plsIDs := make(map[string]string)
+	if !exists {
+		return plsIDs, nil
+	}
+	for _, pls := range plsList {
+		if pls.PrivateLinkServiceProperties == nil || pls.LoadBalancerFrontendIPConfigurations == nil {
+			continue
+		}
+		for _, fipConfig := range *pls.LoadBalancerFrontendIPConfigurations {
+			plsIDs[strings.ToLower(pointer.StringDeref(fipConfig.ID, ""))] = pointer.StringDeref(pls.ID, "")
+		}
+	}
+	return plsIDs, nil
+}
+
+// getServiceAzureResources returns the Azure resources on the frontend IP configurations of the service, or nil if
+// the service has no load balancer.
+func (az *Cloud) getServiceAzureResources(service *v1.Service, lbs []network.LoadBalancer, plsIDs map[string]string) (*metrics.ServiceAzureResources, error) {
+	isInternal := requiresInternalLoadBalancer(service)
+	var (
+		lb         *network.LoadBalancer
+		fipConfigs []*network.FrontendIPConfiguration
+	)
+	for i := range lbs {
+		if isInternalLoadBalancer(&lbs[i]) != isInternal {
+			continue
+		}
+		status, _, lbFIPConfigs, err := az.getServiceLoadBalancerStatus(service, &lbs[i])
+		if err != nil {
+			return nil, err
+		}
+		if status != nil {
+			lb, fipConfigs = &lbs[i], lbFIPConfigs
+			break
+		}
+	}
+	if lb == nil {
+		return nil, nil
+	}
+
+	record := &metrics.ServiceAzureResources{
+		Namespace:    service.Namespace,
+		Name:         service.Name,
+		LoadBalancer: pointer.StringDeref(lb.Name, ""),
+	}
+	fipConfigIDs := sets.New[string]()
+	for _, fipConfig := range fipConfigs {
+		fipConfigID := strings.ToLower(pointer.StringDeref(fipConfig.ID, ""))
+		fipConfigIDs.Insert(fipConfigID)
+		if fipConfig.FrontendIPConfigurationPropertiesFormat != nil && fipConfig.PublicIPAddress != nil && fipConfig.PublicIPAddress.ID != nil {
+			record.PublicIPIDs = append(record.PublicIPIDs, *fipConfig.PublicIPAddress.ID)
+		}
+		if plsID, found := plsIDs[fipConfigID]; found {
+			record.PrivateLinkServiceIDs = append(record.PrivateLinkServiceIDs, plsID)
+		}
+	}
+
+	if lb.LoadBalancerPropertiesFormat == nil {
+		return record, nil
+	}
+	if lb.LoadBalancingRules != nil {
+		for _, rule := range *lb.LoadBalancingRules {
+			if rule.LoadBalancingRulePropertiesFormat != nil && rule.FrontendIPConfiguration != nil &&
+				fipConfigIDs.Has(strings.ToLower(pointer.StringDeref(rule.FrontendIPConfiguration.ID, ""))) {
+				record.LoadBalancingRules++
+			}
+		}
+	}
+	if lb.OutboundRules != nil {
+		for _, rule := range *lb.OutboundRules {
+			if rule.OutboundRulePropertiesFormat == nil || rule.FrontendIPConfigurations == nil {
+				continue
+			}
+			for _, fipConfig := range *rule.FrontendIPConfigurations {
+				if fipConfigIDs.Has(strings.ToLower(pointer.StringDeref(fipConfig.ID, ""))) {
+					record.OutboundPorts += int(pointer.Int32Deref(rule.AllocatedOutboundPorts, 0))
+					break
+				}
+			}
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient/mockprivatelinkserviceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+func TestExportServiceCostAttribution(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	internalSvc := getInternalTestService("svc1", 80, 443)
+	publicSvc := getTestService("svc2", v1.ProtocolTCP, nil, false, 80)
+	clusterIPSvc := getTestService("svc3", v1.ProtocolTCP, nil, false, 80)
+	clusterIPSvc.Spec.Type = v1.ServiceTypeClusterIP
+	client := fake.NewSimpleClientset(&internalSvc, &publicSvc, &clusterIPSvc)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	az.serviceLister = informerFactory.Core().V1().Services().Lister()
+	for _, svc := range []*v1.Service{&internalSvc, &publicSvc, &clusterIPSvc} {
+		_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(svc)
+	}
+
+	pipID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pip2"
+	lbs := []network.LoadBalancer{
+		{
+			Name: pointer.String("testCluster-internal"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+					{
+						Name: pointer.String(az.getDefaultFrontendIPConfigName(&internalSvc)),
+						ID:   pointer.String("fip1"),
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							PrivateIPAddress: pointer.String("10.0.0.6"),
+						},
+					},
+				},
+				LoadBalancingRules: &[]network.LoadBalancingRule{
+					{
+						Name: pointer.String("rule1"),
+						LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+							FrontendIPConfiguration: &network.SubResource{ID: pointer.String("FIP1")},
+						},
+					},
+					{
+						Name: pointer.String("rule2"),
+						LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+							FrontendIPConfiguration: &network.SubResource{ID: pointer.String("fip1")},
+						},
+					},
+					{
+						Name: pointer.String("rule3"),
+						LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+							FrontendIPConfiguration: &network.SubResource{ID: pointer.String("other")},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name: pointer.String("testCluster"),
+			LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+				FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+					{
+						Name: pointer.String(az.getDefaultFrontendIPConfigName(&publicSvc)),
+						ID:   pointer.String("fip2"),
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							PublicIPAddress: &network.PublicIPAddress{ID: pointer.String(pipID)},
+						},
+					},
+				},
+				OutboundRules: &[]network.OutboundRule{
+					{
+						Name: pointer.String("outbound"),
+						OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+							AllocatedOutboundPorts:   pointer.Int32(1024),
+							FrontendIPConfigurations: &[]network.SubResource{{ID: pointer.String("fip2")}},
+						},
+					},
+				},
+			},
+		},
+	}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(lbs, nil).Times(1)
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.PublicIPAddress{
+		{
+			Name: pointer.String("pip2"),
+			ID:   pointer.String(pipID),
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress: pointer.String("1.2.3.4"),
+			},
+		},
+	}, nil).AnyTimes()
+	mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+	mockPLSClient.EXPECT().List(gomock.Any(), az.PrivateLinkServiceResourceGroup).Return([]network.PrivateLinkService{
+		{
+			ID: pointer.String("pls1"),
+			PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+				LoadBalancerFrontendIPConfigurations: &[]network.FrontendIPConfiguration{{ID: pointer.String("FIP1")}},
+			},
+		},
+	}, nil).Times(2)
+
+	assert.NoError(t, az.exportServiceCostAttribution())
+
+	plsIDs, err := az.listPrivateLinkServiceIDsByFrontendIPConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"fip1": "pls1"}, plsIDs)
+
+	record, err := az.getServiceAzureResources(&internalSvc, lbs, plsIDs)
+	assert.NoError(t, err)
+	assert.Equal(t, &metrics.ServiceAzureResources{
+		Namespace:             "default",
+		Name:                  "svc1",
+		LoadBalancer:          "testCluster-internal",
+		PrivateLinkServiceIDs: []string{"pls1"},
+		LoadBalancingRules:    2,
+	}, record)
+
+	record, err = az.getServiceAzureResources(&publicSvc, lbs, plsIDs)
+	assert.NoError(t, err)
+	assert.Equal(t, &metrics.ServiceAzureResources{
+		Namespace:     "default",
+		Name:          "svc2",
+		LoadBalancer:  "testCluster",
+		PublicIPIDs:   []string{pipID},
+		OutboundPorts: 1024,
+	}, record)
+
+	record, err = az.getServiceAzureResources(&internalSvc, lbs[1:], plsIDs)
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+}
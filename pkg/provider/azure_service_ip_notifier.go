@@ -0,0 +1,155 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// serviceIPChangeNotification is posted to the webhook when the external IPs of a service change. The current IPs
+// are empty if the load balancer of the service is deleted.
+type serviceIPChangeNotification struct {
+	Namespace   string    `json:"namespace"`
+	Name        string    `json:"name"`
+	UID         string    `json:"uid"`
+	PreviousIPs []string  `json:"previousIPs"`
+	CurrentIPs  []string  `json:"currentIPs"`
+	Time        time.Time `json:"time"`
+}
+
+// serviceIPChangeNotifier notifies the changes of the external IPs of the services with events and, if configured,
+// by posting them to the webhook.
+type serviceIPChangeNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// initServiceIPChangeNotifier sets up the notifier if ServiceIPChangeNotification is configured.
+func (az *Cloud) initServiceIPChangeNotifier(config *ServiceIPChangeNotificationConfig) error {
+	az.serviceIPChangeNotifier = nil
+	if config == nil {
+		return nil
+	}
+
+	if config.WebhookURL != "" {
+		u, err := url.Parse(config.WebhookURL)
+		if err != nil {
+			return fmt.Errorf("serviceIPChangeNotification: invalid webhookURL: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("serviceIPChangeNotification: the scheme of webhookURL must be http or https, got %q", u.Scheme)
+		}
+	}
+
+	timeout := consts.DefaultServiceIPChangeWebhookTimeoutInSeconds
+	if config.TimeoutInSeconds > 0 {
+		timeout = config.TimeoutInSeconds
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	if az.transport != nil {
+		client.Transport = az.transport
+	}
+	az.serviceIPChangeNotifier = &serviceIPChangeNotifier{
+		webhookURL: config.WebhookURL,
+		client:     client,
+	}
+	return nil
+}
+
+// notifyServiceIPChange records an event on the service and posts the change to the webhook if the external IPs of
+// the service changed. The webhook is called asynchronously, so that it never blocks the reconciliation, and the
+// failures are only logged.
+func (az *Cloud) notifyServiceIPChange(service *v1.Service, previousIPs, currentIPs []string) {
+	n := az.serviceIPChangeNotifier
+	if n == nil {
+		return
+	}
+	previous, current := sets.New(previousIPs...), sets.New(currentIPs...)
+	if previous.Equal(current) {
+		return
+	}
+
+	serviceName := getServiceName(service)
+	klog.V(2).Infof("notifyServiceIPChange: the external IPs of service %s changed from %q to %q", serviceName, sets.List(previous), sets.List(current))
+	az.Event(service, v1.EventTypeNormal, consts.ServiceExternalIPsChangedEventReason, fmt.Sprintf(
+		"The external IPs of the service changed from %q to %q", sets.List(previous), sets.List(current)))
+	if n.webhookURL == "" {
+		return
+	}
+
+	notification := &serviceIPChangeNotification{
+		Namespace:   service.Namespace,
+		Name:        service.Name,
+		UID:         string(service.UID),
+		PreviousIPs: sets.List(previous),
+		CurrentIPs:  sets.List(current),
+		Time:        time.Now().UTC(),
+	}
+	go func() {
+		if err := n.post(notification); err != nil {
+			klog.Errorf("notifyServiceIPChange: failed to notify the webhook of the change of service %s: %v", serviceName, err)
+		}
+	}()
+}
+
+// post posts the notification to the webhook.
+func (n *serviceIPChangeNotifier) post(notification *serviceIPChangeNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// getLoadBalancerStatusIPs returns the IPs of the load balancer status.
+func getLoadBalancerStatusIPs(status *v1.LoadBalancerStatus) []string {
+	if status == nil {
+		return nil
+	}
+	var ips []string
+	for _, ingress := range status.Ingress {
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
+		}
+	}
+	return ips
+}
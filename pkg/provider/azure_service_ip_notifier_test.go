@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestInitServiceIPChangeNotifier(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	assert.NoError(t, az.initServiceIPChangeNotifier(nil))
+	assert.Nil(t, az.serviceIPChangeNotifier)
+
+	assert.NoError(t, az.initServiceIPChangeNotifier(&ServiceIPChangeNotificationConfig{}))
+	assert.NotNil(t, az.serviceIPChangeNotifier)
+	assert.Equal(t, time.Duration(consts.DefaultServiceIPChangeWebhookTimeoutInSeconds)*time.Second, az.serviceIPChangeNotifier.client.Timeout)
+
+	assert.Error(t, az.initServiceIPChangeNotifier(&ServiceIPChangeNotificationConfig{WebhookURL: "ftp://example.com"}))
+	assert.Nil(t, az.serviceIPChangeNotifier)
+}
+
+func TestNotifyServiceIPChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+
+	notifications := make(chan serviceIPChangeNotification, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification serviceIPChangeNotification
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+		notifications <- notification
+	}))
+	defer server.Close()
+
+	service := getTestService("svc", v1.ProtocolTCP, nil, false, 80)
+	service.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+
+	// nothing is notified if not configured
+	az.notifyServiceIPChange(&service, []string{"1.2.3.4"}, []string{"5.6.7.8"})
+	assert.Empty(t, recorder.Events)
+
+	assert.NoError(t, az.initServiceIPChangeNotifier(&ServiceIPChangeNotificationConfig{WebhookURL: server.URL}))
+
+	// the unchanged IPs are not notified
+	az.notifyServiceIPChange(&service, []string{"1.2.3.4"}, []string{"1.2.3.4"})
+	assert.Empty(t, recorder.Events)
+
+	az.notifyServiceIPChange(&service, getLoadBalancerStatusIPs(&service.Status.LoadBalancer), []string{"5.6.7.8", "1.2.3.4"})
+	assert.Equal(t, `Normal ServiceExternalIPsChanged The external IPs of the service changed from ["1.2.3.4"] to ["1.2.3.4" "5.6.7.8"]`, <-recorder.Events)
+	select {
+	case notification := <-notifications:
+		assert.Equal(t, "default", notification.Namespace)
+		assert.Equal(t, "svc", notification.Name)
+		assert.Equal(t, []string{"1.2.3.4"}, notification.PreviousIPs)
+		assert.Equal(t, []string{"1.2.3.4", "5.6.7.8"}, notification.CurrentIPs)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook is not notified")
+	}
+
+	// the release of the IPs is notified
+	az.notifyServiceIPChange(&service, []string{"1.2.3.4"}, nil)
+	assert.Equal(t, `Normal ServiceExternalIPsChanged The external IPs of the service changed from ["1.2.3.4"] to []`, <-recorder.Events)
+	select {
+	case notification := <-notifications:
+		assert.Empty(t, notification.CurrentIPs)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook is not notified")
+	}
+}
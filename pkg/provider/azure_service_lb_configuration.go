@@ -0,0 +1,387 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// serviceAnnotationPrefix is the prefix of the annotations of the services read by the cloud provider.
+const serviceAnnotationPrefix = "service.beta.kubernetes.io/"
+
+// azureLoadBalancerConfigurationGVR is the resource of the AzureLoadBalancerConfiguration custom resources.
+var azureLoadBalancerConfigurationGVR = schema.GroupVersionResource{
+	Group:    consts.CustomResourceGroup,
+	Version:  consts.CustomResourceVersion,
+	Resource: consts.AzureLoadBalancerConfigurationResource,
+}
+
+// AzureLoadBalancerConfigurationSpec configures the load balancer of a service with typed fields, each of them
+// equivalent to an annotation of the service. The fields are validated and defaulted by the schema of the
+// AzureLoadBalancerConfiguration custom resource definition.
+type AzureLoadBalancerConfigurationSpec struct {
+	// Internal is equivalent to the annotation service.beta.kubernetes.io/azure-load-balancer-internal.
+	Internal *bool `json:"internal,omitempty"`
+	// InternalSubnet is equivalent to the annotation service.beta.kubernetes.io/azure-load-balancer-internal-subnet.
+	InternalSubnet string `json:"internalSubnet,omitempty"`
+	// ResourceGroup is equivalent to the annotation service.beta.kubernetes.io/azure-load-balancer-resource-group.
+	ResourceGroup string `json:"resourceGroup,omitempty"`
+	// DNSLabelName is equivalent to the annotation service.beta.kubernetes.io/azure-dns-label-name.
+	DNSLabelName string `json:"dnsLabelName,omitempty"`
+	// PublicIPZoneRedundant is equivalent to the annotation service.beta.kubernetes.io/azure-pip-zone-redundant.
+	PublicIPZoneRedundant *bool `json:"publicIPZoneRedundant,omitempty"`
+	// IdleTimeoutInMinutes is equivalent to the annotation service.beta.kubernetes.io/azure-load-balancer-tcp-idle-timeout.
+	IdleTimeoutInMinutes *int32 `json:"idleTimeoutInMinutes,omitempty"`
+	// DisableTCPReset is equivalent to the annotation service.beta.kubernetes.io/azure-load-balancer-disable-tcp-reset.
+	DisableTCPReset *bool `json:"disableTCPReset,omitempty"`
+	// DisableFloatingIP is equivalent to the annotation service.beta.kubernetes.io/azure-disable-load-balancer-floating-ip.
+	DisableFloatingIP *bool `json:"disableFloatingIP,omitempty"`
+	// EnableHighAvailabilityPorts is equivalent to the annotation service.beta.kubernetes.io/azure-load-balancer-enable-high-availability-ports.
+	EnableHighAvailabilityPorts *bool `json:"enableHighAvailabilityPorts,omitempty"`
+
+	// HealthProbe configures the health probes of the load balancing rules.
+	HealthProbe AzureLoadBalancerHealthProbeConfiguration `json:"healthProbe,omitempty"`
+	// NetworkSecurity configures the security rules of the service.
+	NetworkSecurity AzureLoadBalancerNetworkSecurityConfiguration `json:"networkSecurity,omitempty"`
+	// PrivateLinkService configures the private link service of the service.
+	PrivateLinkService AzureLoadBalancerPrivateLinkServiceConfiguration `json:"privateLinkService,omitempty"`
+}
+
+// AzureLoadBalancerHealthProbeConfiguration configures the health probes of the load balancing rules.
+type AzureLoadBalancerHealthProbeConfiguration struct {
+	// Protocol is equivalent to the annotation service.beta.kubernetes.io/azure-load-balancer-health-probe-protocol.
+	Protocol string `json:"protocol,omitempty"`
+	// RequestPath is equivalent to the annotation service.beta.kubernetes.io/azure-load-balancer-health-probe-request-path.
+	RequestPath string `json:"requestPath,omitempty"`
+	// IntervalInSeconds is equivalent to the annotation service.beta.kubernetes.io/azure-load-balancer-health-probe-interval.
+	IntervalInSeconds *int32 `json:"intervalInSeconds,omitempty"`
+	// NumOfProbe is equivalent to the annotation service.beta.kubernetes.io/azure-load-balancer-health-probe-num-of-probe.
+	NumOfProbe *int32 `json:"numOfProbe,omitempty"`
+}
+
+// AzureLoadBalancerNetworkSecurityConfiguration configures the security rules of the service.
+type AzureLoadBalancerNetworkSecurityConfiguration struct {
+	// AllowedServiceTags is equivalent to the annotation service.beta.kubernetes.io/azure-allowed-service-tags.
+	AllowedServiceTags []string `json:"allowedServiceTags,omitempty"`
+	// SharedSecurityRule is equivalent to the annotation service.beta.kubernetes.io/azure-shared-securityrule.
+	SharedSecurityRule *bool `json:"sharedSecurityRule,omitempty"`
+	// DenyAllExceptLoadBalancerSourceRanges is equivalent to the annotation service.beta.kubernetes.io/azure-deny-all-except-load-balancer-source-ranges.
+	DenyAllExceptLoadBalancerSourceRanges *bool `json:"denyAllExceptLoadBalancerSourceRanges,omitempty"`
+}
+
+// AzureLoadBalancerPrivateLinkServiceConfiguration configures the private link service of the service.
+type AzureLoadBalancerPrivateLinkServiceConfiguration struct {
+	// Create is equivalent to the annotation service.beta.kubernetes.io/azure-pls-create.
+	Create *bool `json:"create,omitempty"`
+	// Name is equivalent to the annotation service.beta.kubernetes.io/azure-pls-name.
+	Name string `json:"name,omitempty"`
+	// IPConfigurationSubnet is equivalent to the annotation service.beta.kubernetes.io/azure-pls-ip-configuration-subnet.
+	IPConfigurationSubnet string `json:"ipConfigurationSubnet,omitempty"`
+	// IPConfigurationIPAddressCount is equivalent to the annotation service.beta.kubernetes.io/azure-pls-ip-configuration-ip-address-count.
+	IPConfigurationIPAddressCount *int32 `json:"ipConfigurationIPAddressCount,omitempty"`
+	// IPConfigurationIPAddresses is equivalent to the annotation service.beta.kubernetes.io/azure-pls-ip-configuration-ip-address.
+	IPConfigurationIPAddresses []string `json:"ipConfigurationIPAddresses,omitempty"`
+	// FQDNs is equivalent to the annotation service.beta.kubernetes.io/azure-pls-fqdns.
+	FQDNs []string `json:"fqdns,omitempty"`
+	// ProxyProtocol is equivalent to the annotation service.beta.kubernetes.io/azure-pls-proxy-protocol.
+	ProxyProtocol *bool `json:"proxyProtocol,omitempty"`
+	// Visibility is equivalent to the annotation service.beta.kubernetes.io/azure-pls-visibility.
+	Visibility []string `json:"visibility,omitempty"`
+	// AutoApproval is equivalent to the annotation service.beta.kubernetes.io/azure-pls-auto-approval.
+	AutoApproval []string `json:"autoApproval,omitempty"`
+}
+
+// azureLoadBalancerConfigurationObject is an AzureLoadBalancerConfiguration custom resource.
+type azureLoadBalancerConfigurationObject struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AzureLoadBalancerConfigurationSpec `json:"spec"`
+}
+
+// azureLoadBalancerConfigurationField is a field of AzureLoadBalancerConfigurationSpec and its equivalent annotation.
+type azureLoadBalancerConfigurationField struct {
+	// name is the path of the field in the spec.
+	name       string
+	annotation string
+	// get returns the value of the annotation, or false if the field is not set.
+	get func(spec *AzureLoadBalancerConfigurationSpec) (string, bool)
+	// set sets the field by the value of the annotation.
+	set func(spec *AzureLoadBalancerConfigurationSpec, value string) error
+}
+
+func boolConfigurationField(name, annotation string, field func(spec *AzureLoadBalancerConfigurationSpec) **bool) azureLoadBalancerConfigurationField {
+	return azureLoadBalancerConfigurationField{
+		name:       name,
+		annotation: annotation,
+		get: func(spec *AzureLoadBalancerConfigurationSpec) (string, bool) {
+			if value := *field(spec); value != nil {
+				return strconv.FormatBool(*value), true
+			}
+			return "", false
+		},
+		set: func(spec *AzureLoadBalancerConfigurationSpec, value string) error {
+			*field(spec) = pointer.Bool(strings.EqualFold(strings.TrimSpace(value), consts.TrueAnnotationValue))
+			return nil
+		},
+	}
+}
+
+func int32ConfigurationField(name, annotation string, field func(spec *AzureLoadBalancerConfigurationSpec) **int32) azureLoadBalancerConfigurationField {
+	return azureLoadBalancerConfigurationField{
+		name:       name,
+		annotation: annotation,
+		get: func(spec *AzureLoadBalancerConfigurationSpec) (string, bool) {
+			if value := *field(spec); value != nil {
+				return strconv.FormatInt(int64(*value), 10), true
+			}
+			return "", false
+		},
+		set: func(spec *AzureLoadBalancerConfigurationSpec, value string) error {
+			parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+			if err != nil {
+				return err
+			}
+			*field(spec) = pointer.Int32(int32(parsed))
+			return nil
+		},
+	}
+}
+
+func stringConfigurationField(name, annotation string, field func(spec *AzureLoadBalancerConfigurationSpec) *string) azureLoadBalancerConfigurationField {
+	return azureLoadBalancerConfigurationField{
+		name:       name,
+		annotation: annotation,
+		get: func(spec *AzureLoadBalancerConfigurationSpec) (string, bool) {
+			value := *field(spec)
+			return value, value != ""
+		},
+		set: func(spec *AzureLoadBalancerConfigurationSpec, value string) error {
+			*field(spec) = strings.TrimSpace(value)
+			return nil
+		},
+	}
+}
+
+// listConfigurationField is a field of the annotation listing the values separated by the separator.
+func listConfigurationField(name, annotation, separator string, field func(spec *AzureLoadBalancerConfigurationSpec) *[]string) azureLoadBalancerConfigurationField {
+	return azureLoadBalancerConfigurationField{
+		name:       name,
+		annotation: annotation,
+		get: func(spec *AzureLoadBalancerConfigurationSpec) (string, bool) {
+			values := *field(spec)
+			return strings.Join(values, separator), len(values) > 0
+		},
+		set: func(spec *AzureLoadBalancerConfigurationSpec, value string) error {
+			var values []string
+			for _, v := range strings.Split(value, separator) {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+			*field(spec) = values
+			return nil
+		},
+	}
+}
+
+// azureLoadBalancerConfigurationFields are the fields of AzureLoadBalancerConfigurationSpec.
+var azureLoadBalancerConfigurationFields = []azureLoadBalancerConfigurationField{
+	boolConfigurationField("internal", consts.ServiceAnnotationLoadBalancerInternal, func(spec *AzureLoadBalancerConfigurationSpec) **bool { return &spec.Internal }),
+	stringConfigurationField("internalSubnet", consts.ServiceAnnotationLoadBalancerInternalSubnet, func(spec *AzureLoadBalancerConfigurationSpec) *string { return &spec.InternalSubnet }),
+	stringConfigurationField("resourceGroup", consts.ServiceAnnotationLoadBalancerResourceGroup, func(spec *AzureLoadBalancerConfigurationSpec) *string { return &spec.ResourceGroup }),
+	stringConfigurationField("dnsLabelName", consts.ServiceAnnotationDNSLabelName, func(spec *AzureLoadBalancerConfigurationSpec) *string { return &spec.DNSLabelName }),
+	boolConfigurationField("publicIPZoneRedundant", consts.ServiceAnnotationPIPZoneRedundant, func(spec *AzureLoadBalancerConfigurationSpec) **bool { return &spec.PublicIPZoneRedundant }),
+	int32ConfigurationField("idleTimeoutInMinutes", consts.ServiceAnnotationLoadBalancerIdleTimeout, func(spec *AzureLoadBalancerConfigurationSpec) **int32 { return &spec.IdleTimeoutInMinutes }),
+	boolConfigurationField("disableTCPReset", consts.ServiceAnnotationDisableTCPReset, func(spec *AzureLoadBalancerConfigurationSpec) **bool { return &spec.DisableTCPReset }),
+	boolConfigurationField("disableFloatingIP", consts.ServiceAnnotationDisableLoadBalancerFloatingIP, func(spec *AzureLoadBalancerConfigurationSpec) **bool { return &spec.DisableFloatingIP }),
+	boolConfigurationField("enableHighAvailabilityPorts", consts.ServiceAnnotationLoadBalancerEnableHighAvailabilityPorts, func(spec *AzureLoadBalancerConfigurationSpec) **bool { return &spec.EnableHighAvailabilityPorts }),
+
+	stringConfigurationField("healthProbe.protocol", consts.ServiceAnnotationLoadBalancerHealthProbeProtocol, func(spec *AzureLoadBalancerConfigurationSpec) *string { return &spec.HealthProbe.Protocol }),
+	stringConfigurationField("healthProbe.requestPath", consts.ServiceAnnotationLoadBalancerHealthProbeRequestPath, func(spec *AzureLoadBalancerConfigurationSpec) *string { return &spec.HealthProbe.RequestPath }),
+	int32ConfigurationField("healthProbe.intervalInSeconds", consts.ServiceAnnotationLoadBalancerHealthProbeInterval, func(spec *AzureLoadBalancerConfigurationSpec) **int32 { return &spec.HealthProbe.IntervalInSeconds }),
+	int32ConfigurationField("healthProbe.numOfProbe", consts.ServiceAnnotationLoadBalancerHealthProbeNumOfProbe, func(spec *AzureLoadBalancerConfigurationSpec) **int32 { return &spec.HealthProbe.NumOfProbe }),
+
+	listConfigurationField("networkSecurity.allowedServiceTags", consts.ServiceAnnotationAllowedServiceTag, ",", func(spec *AzureLoadBalancerConfigurationSpec) *[]string {
+		return &spec.NetworkSecurity.AllowedServiceTags
+	}),
+	boolConfigurationField("networkSecurity.sharedSecurityRule", consts.ServiceAnnotationSharedSecurityRule, func(spec *AzureLoadBalancerConfigurationSpec) **bool { return &spec.NetworkSecurity.SharedSecurityRule }),
+	boolConfigurationField("networkSecurity.denyAllExceptLoadBalancerSourceRanges", consts.ServiceAnnotationDenyAllExceptLoadBalancerSourceRanges, func(spec *AzureLoadBalancerConfigurationSpec) **bool {
+		return &spec.NetworkSecurity.DenyAllExceptLoadBalancerSourceRanges
+	}),
+
+	boolConfigurationField("privateLinkService.create", consts.ServiceAnnotationPLSCreation, func(spec *AzureLoadBalancerConfigurationSpec) **bool { return &spec.PrivateLinkService.Create }),
+	stringConfigurationField("privateLinkService.name", consts.ServiceAnnotationPLSName, func(spec *AzureLoadBalancerConfigurationSpec) *string { return &spec.PrivateLinkService.Name }),
+	stringConfigurationField("privateLinkService.ipConfigurationSubnet", consts.ServiceAnnotationPLSIpConfigurationSubnet, func(spec *AzureLoadBalancerConfigurationSpec) *string {
+		return &spec.PrivateLinkService.IPConfigurationSubnet
+	}),
+	int32ConfigurationField("privateLinkService.ipConfigurationIPAddressCount", consts.ServiceAnnotationPLSIpConfigurationIPAddressCount, func(spec *AzureLoadBalancerConfigurationSpec) **int32 {
+		return &spec.PrivateLinkService.IPConfigurationIPAddressCount
+	}),
+	listConfigurationField("privateLinkService.ipConfigurationIPAddresses", consts.ServiceAnnotationPLSIpConfigurationIPAddress, " ", func(spec *AzureLoadBalancerConfigurationSpec) *[]string {
+		return &spec.PrivateLinkService.IPConfigurationIPAddresses
+	}),
+	listConfigurationField("privateLinkService.fqdns", consts.ServiceAnnotationPLSFqdns, " ", func(spec *AzureLoadBalancerConfigurationSpec) *[]string { return &spec.PrivateLinkService.FQDNs }),
+	boolConfigurationField("privateLinkService.proxyProtocol", consts.ServiceAnnotationPLSProxyProtocol, func(spec *AzureLoadBalancerConfigurationSpec) **bool { return &spec.PrivateLinkService.ProxyProtocol }),
+	listConfigurationField("privateLinkService.visibility", consts.ServiceAnnotationPLSVisibility, " ", func(spec *AzureLoadBalancerConfigurationSpec) *[]string { return &spec.PrivateLinkService.Visibility }),
+	listConfigurationField("privateLinkService.autoApproval", consts.ServiceAnnotationPLSAutoApproval, " ", func(spec *AzureLoadBalancerConfigurationSpec) *[]string { return &spec.PrivateLinkService.AutoApproval }),
+}
+
+// ConvertAnnotationsToAzureLoadBalancerConfigurationSpec converts the annotations of a service to the equivalent
+// AzureLoadBalancerConfigurationSpec, to migrate the service to an AzureLoadBalancerConfiguration custom resource.
+// The names of the annotations without an equivalent field are returned, which are to be kept on the service.
+func ConvertAnnotationsToAzureLoadBalancerConfigurationSpec(annotations map[string]string) (*AzureLoadBalancerConfigurationSpec, []string, error) {
+	spec := &AzureLoadBalancerConfigurationSpec{}
+	converted := make(map[string]bool)
+	for _, field := range azureLoadBalancerConfigurationFields {
+		value, found := annotations[field.annotation]
+		if !found {
+			continue
+		}
+		if err := field.set(spec, value); err != nil {
+			return nil, nil, fmt.Errorf("failed to convert annotation %s to field %s: %w", field.annotation, field.name, err)
+		}
+		converted[field.annotation] = true
+	}
+
+	var unconverted []string
+	for annotation := range annotations {
+		if !converted[annotation] && strings.HasPrefix(annotation, serviceAnnotationPrefix) {
+			unconverted = append(unconverted, annotation)
+		}
+	}
+	sort.Strings(unconverted)
+	return spec, unconverted, nil
+}
+
+// applyAzureLoadBalancerConfiguration returns a copy of the service with the annotations equivalent to the fields of
+// the configuration. A field cannot be set both in the configuration and by its own annotation.
+func applyAzureLoadBalancerConfiguration(service *v1.Service, configName string, spec *AzureLoadBalancerConfigurationSpec) (*v1.Service, error) {
+	service = service.DeepCopy()
+	annotations := make(map[string]string, len(service.Annotations))
+	for key, value := range service.Annotations {
+		annotations[key] = value
+	}
+	for _, field := range azureLoadBalancerConfigurationFields {
+		value, found := field.get(spec)
+		if !found {
+			continue
+		}
+		if _, found := service.Annotations[field.annotation]; found {
+			return nil, fmt.Errorf("%s in AzureLoadBalancerConfiguration %s cannot be used together with annotation %s", field.name, configName, field.annotation)
+		}
+		annotations[field.annotation] = value
+	}
+	service.Annotations = annotations
+	return service, nil
+}
+
+// withAzureLoadBalancerConfiguration returns a copy of the service with the annotations equivalent to the
+// AzureLoadBalancerConfiguration custom resource referenced by the annotation ServiceAnnotationAzureLoadBalancerConfigurationName,
+// and the default annotations of its namespace, or the service itself if it references none and has no defaults.
+// The configuration name can be defaulted by the namespace as well.
+func (az *Cloud) withAzureLoadBalancerConfiguration(ctx context.Context, service *v1.Service) (*v1.Service, error) {
+	defaults := az.NamespaceDefaultServiceAnnotations[service.Namespace]
+	configName, found := service.Annotations[consts.ServiceAnnotationAzureLoadBalancerConfigurationName]
+	if !found {
+		configName = defaults[consts.ServiceAnnotationAzureLoadBalancerConfigurationName]
+	}
+	configName = strings.TrimSpace(configName)
+	if configName == "" {
+		return applyNamespaceDefaultServiceAnnotations(service, defaults), nil
+	}
+
+	spec, err := az.getAzureLoadBalancerConfiguration(ctx, service.Namespace, configName)
+	if err == nil {
+		var configured *v1.Service
+		if configured, err = applyAzureLoadBalancerConfiguration(service, configName, spec); err == nil {
+			klog.V(4).Infof("withAzureLoadBalancerConfiguration: service %s is configured by AzureLoadBalancerConfiguration %s", getServiceName(service), configName)
+			return applyNamespaceDefaultServiceAnnotations(configured, defaults), nil
+		}
+	}
+	az.Event(service, v1.EventTypeWarning, "InvalidAzureLoadBalancerConfiguration", err.Error())
+	return nil, err
+}
+
+// getAzureLoadBalancerConfiguration gets the spec of the AzureLoadBalancerConfiguration custom resource.
+func (az *Cloud) getAzureLoadBalancerConfiguration(ctx context.Context, namespace, name string) (*AzureLoadBalancerConfigurationSpec, error) {
+	if az.dynamicClient == nil {
+		return nil, fmt.Errorf("failed to get AzureLoadBalancerConfiguration %s/%s: the dynamic client is not initialized", namespace, name)
+	}
+	u, err := az.dynamicClient.Resource(azureLoadBalancerConfigurationGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AzureLoadBalancerConfiguration %s/%s: %w", namespace, name, err)
+	}
+	var configObj azureLoadBalancerConfigurationObject
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &configObj); err != nil {
+		return nil, fmt.Errorf("failed to parse AzureLoadBalancerConfiguration %s/%s: %w", namespace, name, err)
+	}
+	return &configObj.Spec, nil
+}
+
+// applyNamespaceDefaultServiceAnnotations returns a copy of the service with the default annotations it omits, or the
+// service itself if it omits none of them.
+func applyNamespaceDefaultServiceAnnotations(service *v1.Service, defaults map[string]string) *v1.Service {
+	var applied []string
+	for annotation := range defaults {
+		if _, found := service.Annotations[annotation]; !found {
+			applied = append(applied, annotation)
+		}
+	}
+	if len(applied) == 0 {
+		return service
+	}
+
+	service = service.DeepCopy()
+	if service.Annotations == nil {
+		service.Annotations = make(map[string]string, len(applied))
+	}
+	for _, annotation := range applied {
+		service.Annotations[annotation] = defaults[annotation]
+	}
+	sort.Strings(applied)
+	klog.V(4).Infof("applyNamespaceDefaultServiceAnnotations: applying the default annotations %s of namespace %s to service %s", strings.Join(applied, ", "), service.Namespace, getServiceName(service))
+	return service
+}
+
+// checkNamespaceDefaultServiceAnnotations validates the default annotations of the namespaces.
+func (az *Cloud) checkNamespaceDefaultServiceAnnotations() error {
+	for namespace, defaults := range az.NamespaceDefaultServiceAnnotations {
+		if namespace == "" {
+			return fmt.Errorf("the namespace of namespaceDefaultServiceAnnotations must not be empty")
+		}
+		for annotation := range defaults {
+			if !strings.HasPrefix(annotation, serviceAnnotationPrefix) {
+				return fmt.Errorf("the default annotation %s of namespace %s must be prefixed with %s", annotation, namespace, serviceAnnotationPrefix)
+			}
+		}
+	}
+	return nil
+}
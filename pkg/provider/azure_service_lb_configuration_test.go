@@ -0,0 +1,170 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestConvertAnnotationsToAzureLoadBalancerConfigurationSpec(t *testing.T) {
+	annotations := map[string]string{
+		consts.ServiceAnnotationLoadBalancerInternal:            "true",
+		consts.ServiceAnnotationLoadBalancerIdleTimeout:         "10",
+		consts.ServiceAnnotationLoadBalancerHealthProbeProtocol: "Http",
+		consts.ServiceAnnotationAllowedServiceTag:               "AzureCloud, Internet",
+		consts.ServiceAnnotationPLSVisibility:                   "sub1 sub2",
+		consts.ServiceAnnotationPLSProxyProtocol:                "false",
+		consts.ServiceAnnotationAzurePIPTags:                    "a=b",
+		"example.com/other":                                     "value",
+	}
+	spec, unconverted, err := ConvertAnnotationsToAzureLoadBalancerConfigurationSpec(annotations)
+	assert.NoError(t, err)
+	assert.Equal(t, &AzureLoadBalancerConfigurationSpec{
+		Internal:             pointer.Bool(true),
+		IdleTimeoutInMinutes: pointer.Int32(10),
+		HealthProbe:          AzureLoadBalancerHealthProbeConfiguration{Protocol: "Http"},
+		NetworkSecurity:      AzureLoadBalancerNetworkSecurityConfiguration{AllowedServiceTags: []string{"AzureCloud", "Internet"}},
+		PrivateLinkService: AzureLoadBalancerPrivateLinkServiceConfiguration{
+			ProxyProtocol: pointer.Bool(false),
+			Visibility:    []string{"sub1", "sub2"},
+		},
+	}, spec)
+	assert.Equal(t, []string{consts.ServiceAnnotationAzurePIPTags}, unconverted)
+
+	// the spec is converted back to the equivalent annotations
+	service := getTestService("service", v1.ProtocolTCP, nil, false, 80)
+	configured, err := applyAzureLoadBalancerConfiguration(&service, "config", spec)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		consts.ServiceAnnotationLoadBalancerInternal:            "true",
+		consts.ServiceAnnotationLoadBalancerIdleTimeout:         "10",
+		consts.ServiceAnnotationLoadBalancerHealthProbeProtocol: "Http",
+		consts.ServiceAnnotationAllowedServiceTag:               "AzureCloud,Internet",
+		consts.ServiceAnnotationPLSVisibility:                   "sub1 sub2",
+		consts.ServiceAnnotationPLSProxyProtocol:                "false",
+	}, configured.Annotations)
+	assert.Empty(t, service.Annotations)
+
+	_, _, err = ConvertAnnotationsToAzureLoadBalancerConfigurationSpec(map[string]string{
+		consts.ServiceAnnotationLoadBalancerHealthProbeInterval: "five",
+	})
+	assert.Error(t, err)
+}
+
+func TestApplyAzureLoadBalancerConfiguration(t *testing.T) {
+	service := getTestService("service", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationAzurePIPTags: "a=b",
+	}, false, 80)
+	spec := &AzureLoadBalancerConfigurationSpec{
+		DisableTCPReset: pointer.Bool(true),
+		HealthProbe:     AzureLoadBalancerHealthProbeConfiguration{NumOfProbe: pointer.Int32(3)},
+	}
+	configured, err := applyAzureLoadBalancerConfiguration(&service, "config", spec)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		consts.ServiceAnnotationAzurePIPTags:                      "a=b",
+		consts.ServiceAnnotationDisableTCPReset:                   "true",
+		consts.ServiceAnnotationLoadBalancerHealthProbeNumOfProbe: "3",
+	}, configured.Annotations)
+
+	// a field cannot be set by its own annotation at the same time
+	service.Annotations[consts.ServiceAnnotationDisableTCPReset] = "false"
+	_, err = applyAzureLoadBalancerConfiguration(&service, "config", spec)
+	assert.EqualError(t, err, "disableTCPReset in AzureLoadBalancerConfiguration config cannot be used together with annotation "+consts.ServiceAnnotationDisableTCPReset)
+}
+
+func TestWithAzureLoadBalancerConfiguration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+
+	// the services without the annotation are not changed
+	service := getTestService("service", v1.ProtocolTCP, nil, false, 80)
+	configured, err := az.withAzureLoadBalancerConfiguration(context.TODO(), &service)
+	assert.NoError(t, err)
+	assert.Same(t, &service, configured)
+
+	// the configuration cannot be read without the dynamic client
+	service.Annotations[consts.ServiceAnnotationAzureLoadBalancerConfigurationName] = "config"
+	_, err = az.withAzureLoadBalancerConfiguration(context.TODO(), &service)
+	assert.Error(t, err)
+	assert.Contains(t, <-recorder.Events, "InvalidAzureLoadBalancerConfiguration")
+}
+
+func TestWithNamespaceDefaultServiceAnnotations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	az.NamespaceDefaultServiceAnnotations = map[string]map[string]string{
+		"internal": {
+			consts.ServiceAnnotationLoadBalancerInternal:       "true",
+			consts.ServiceAnnotationLoadBalancerInternalSubnet: "subnet",
+		},
+	}
+
+	// the services in the other namespaces are not changed
+	service := getTestService("service", v1.ProtocolTCP, nil, false, 80)
+	configured, err := az.withAzureLoadBalancerConfiguration(context.TODO(), &service)
+	assert.NoError(t, err)
+	assert.Same(t, &service, configured)
+
+	// the annotations omitted by the service are defaulted, and the service itself is not changed
+	service.Namespace = "internal"
+	service.Annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet] = "other"
+	configured, err = az.withAzureLoadBalancerConfiguration(context.TODO(), &service)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		consts.ServiceAnnotationLoadBalancerInternal:       "true",
+		consts.ServiceAnnotationLoadBalancerInternalSubnet: "other",
+	}, configured.Annotations)
+	assert.NotContains(t, service.Annotations, consts.ServiceAnnotationLoadBalancerInternal)
+
+	// the configuration name is defaulted as well
+	az.NamespaceDefaultServiceAnnotations["internal"][consts.ServiceAnnotationAzureLoadBalancerConfigurationName] = "config"
+	_, err = az.withAzureLoadBalancerConfiguration(context.TODO(), &service)
+	assert.Error(t, err)
+	assert.Contains(t, <-recorder.Events, "InvalidAzureLoadBalancerConfiguration")
+}
+
+func TestCheckNamespaceDefaultServiceAnnotations(t *testing.T) {
+	az := &Cloud{}
+	az.NamespaceDefaultServiceAnnotations = map[string]map[string]string{
+		"internal": {consts.ServiceAnnotationLoadBalancerInternal: "true"},
+	}
+	assert.NoError(t, az.checkNamespaceDefaultServiceAnnotations())
+
+	az.NamespaceDefaultServiceAnnotations[""] = map[string]string{consts.ServiceAnnotationLoadBalancerInternal: "true"}
+	assert.Error(t, az.checkNamespaceDefaultServiceAnnotations())
+
+	delete(az.NamespaceDefaultServiceAnnotations, "")
+	az.NamespaceDefaultServiceAnnotations["internal"]["team"] = "a"
+	assert.Error(t, az.checkNamespaceDefaultServiceAnnotations())
+}
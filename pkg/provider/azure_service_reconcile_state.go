@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+)
+
+// serviceReconcileStateTTL bounds how long the phases completed by a failed reconcile are skipped by the retries,
+// so that the changes made to the resources out of band are eventually reconciled.
+const serviceReconcileStateTTL = 10 * time.Minute
+
+// reconcilePhase is a phase of reconcileService writing to a sub-resource of the service.
+type reconcilePhase string
+
+const (
+	reconcilePhaseLoadBalancer            reconcilePhase = "LoadBalancer"
+	reconcilePhaseCounterpartLoadBalancer reconcilePhase = "CounterpartLoadBalancer"
+	reconcilePhaseSecurityGroup           reconcilePhase = "SecurityGroup"
+	reconcilePhasePrivateLinkService      reconcilePhase = "PrivateLinkService"
+)
+
+// serviceReconcileState tracks the phases completed by a failed reconcile of a service, so that the retries with
+// the same service and nodes resume at the failed phase instead of writing the completed ones again.
+type serviceReconcileState struct {
+	// fingerprint identifies the service spec and the nodes the phases were completed for.
+	fingerprint uint64
+	// startedAt is the time the first phase was completed.
+	startedAt time.Time
+	// completedPhases maps the completed phases to the name of the load balancer they reconciled, if any.
+	completedPhases map[reconcilePhase]string
+}
+
+// isCompleted returns true if the phase has been completed by a previous attempt.
+func (s *serviceReconcileState) isCompleted(phase reconcilePhase) bool {
+	_, ok := s.completedPhases[phase]
+	return ok
+}
+
+// complete records the phase as completed.
+func (s *serviceReconcileState) complete(phase reconcilePhase, lbName string) {
+	if len(s.completedPhases) == 0 {
+		s.startedAt = time.Now()
+	}
+	s.completedPhases[phase] = lbName
+}
+
+// getServiceReconcileState returns the state of the previous failed reconcile of the service if it was for the same
+// service spec and nodes and has not expired, or a new state otherwise.
+func (az *Cloud) getServiceReconcileState(service *v1.Service, nodes []*v1.Node) *serviceReconcileState {
+	key := strings.ToLower(getServiceName(service))
+	fingerprint := az.getServiceReconcileFingerprint(service, nodes)
+	if value, ok := az.serviceReconcileStates.Load(key); ok {
+		state := value.(*serviceReconcileState)
+		if state.fingerprint == fingerprint && time.Since(state.startedAt) < serviceReconcileStateTTL {
+			return state
+		}
+	}
+
+	state := &serviceReconcileState{
+		fingerprint:     fingerprint,
+		completedPhases: make(map[reconcilePhase]string),
+	}
+	az.serviceReconcileStates.Store(key, state)
+	return state
+}
+
+// resetServiceReconcileState forgets the phases completed for the service, which is done once the service is
+// reconciled or deleted.
+func (az *Cloud) resetServiceReconcileState(service *v1.Service) {
+	az.serviceReconcileStates.Delete(strings.ToLower(getServiceName(service)))
+}
+
+// reconcileFingerprintNode is the part of a node the reconcile depends on.
+type reconcileFingerprintNode struct {
+	Name      string
+	Addresses []v1.NodeAddress
+	Excluded  bool
+}
+
+// getServiceReconcileFingerprint hashes the parts of the service and the nodes the reconcile depends on, including
+// the addresses of the nodes in the IP-based backend pools and whether the nodes are excluded from the load balancers.
+func (az *Cloud) getServiceReconcileFingerprint(service *v1.Service, nodes []*v1.Node) uint64 {
+	fingerprintNodes := make([]reconcileFingerprintNode, 0, len(nodes))
+	for _, node := range nodes {
+		excluded, err := az.ShouldNodeExcludedFromLoadBalancer(node.Name)
+		if err != nil {
+			excluded = az.isNodeSelectedByLoadBalancerNodeExclusion(node)
+		}
+		fingerprintNodes = append(fingerprintNodes, reconcileFingerprintNode{
+			Name:      node.Name,
+			Addresses: node.Status.Addresses,
+			Excluded:  excluded,
+		})
+	}
+	sort.Slice(fingerprintNodes, func(i, j int) bool {
+		return fingerprintNodes[i].Name < fingerprintNodes[j].Name
+	})
+
+	// the maps are marshaled in the order of the keys, so the same input always has the same fingerprint
+	data, _ := json.Marshal(struct {
+		UID         string
+		Annotations map[string]string
+		Spec        v1.ServiceSpec
+		Nodes       []reconcileFingerprintNode
+	}{
+		UID:         string(service.UID),
+		Annotations: service.Annotations,
+		Spec:        service.Spec,
+		Nodes:       fingerprintNodes,
+	})
+	hash := fnv.New64a()
+	_, _ = hash.Write(data)
+	return hash.Sum64()
+}
+
+// ensureServiceLoadBalancer reconciles the load balancer of the service in the phase, unless a previous attempt
+// completed the phase, in which case the load balancer it reconciled is read instead of being written again.
+func (az *Cloud) ensureServiceLoadBalancer(state *serviceReconcileState, phase reconcilePhase, clusterName string, service *v1.Service, nodes []*v1.Node) (*network.LoadBalancer, error) {
+	if lbName, ok := state.completedPhases[phase]; ok {
+		lb, exists, err := az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeDefault)
+		if err == nil && exists {
+			klog.V(2).Infof("ensureServiceLoadBalancer: skipping phase %s of service %q completed by the previous attempt, load balancer %q", phase, getServiceName(service), lbName)
+			return lb, nil
+		}
+		klog.V(2).Infof("ensureServiceLoadBalancer: reconciling phase %s of service %q again since the load balancer %q cannot be read, exists = %t: %v", phase, getServiceName(service), lbName, exists, err)
+	}
+
+	lb, err := az.reconcileLoadBalancer(clusterName, service, nodes, true /* wantLb */)
+	if err != nil {
+		return nil, err
+	}
+	state.complete(phase, pointer.StringDeref(lb.Name, ""))
+	return lb, nil
+}
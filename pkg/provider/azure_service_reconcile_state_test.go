@@ -0,0 +1,118 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestGetServiceReconcileState(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	service := getTestService("service", v1.ProtocolTCP, nil, false, 80)
+	nodes := []*v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, {ObjectMeta: metav1.ObjectMeta{Name: "node2"}}}
+
+	state := az.getServiceReconcileState(&service, nodes)
+	assert.False(t, state.isCompleted(reconcilePhaseLoadBalancer))
+	state.complete(reconcilePhaseLoadBalancer, "lb")
+	assert.True(t, state.isCompleted(reconcilePhaseLoadBalancer))
+
+	// the retry with the same service and nodes in any order resumes the state
+	reorderedNodes := []*v1.Node{nodes[1], nodes[0]}
+	assert.Same(t, state, az.getServiceReconcileState(service.DeepCopy(), reorderedNodes))
+
+	// the changes of the service or the nodes start over
+	updatedService := service.DeepCopy()
+	updatedService.Annotations = map[string]string{"key": "value"}
+	assert.False(t, az.getServiceReconcileState(updatedService, nodes).isCompleted(reconcilePhaseLoadBalancer))
+	state = az.getServiceReconcileState(&service, nodes)
+	assert.False(t, state.isCompleted(reconcilePhaseLoadBalancer))
+	state.complete(reconcilePhaseLoadBalancer, "lb")
+	assert.False(t, az.getServiceReconcileState(&service, nodes[:1]).isCompleted(reconcilePhaseLoadBalancer))
+
+	// the expired state starts over
+	state = az.getServiceReconcileState(&service, nodes)
+	state.complete(reconcilePhaseLoadBalancer, "lb")
+	state.startedAt = time.Now().Add(-serviceReconcileStateTTL)
+	assert.False(t, az.getServiceReconcileState(&service, nodes).isCompleted(reconcilePhaseLoadBalancer))
+
+	// the state is reset once the service is reconciled
+	state = az.getServiceReconcileState(&service, nodes)
+	state.complete(reconcilePhaseLoadBalancer, "lb")
+	az.resetServiceReconcileState(&service)
+	assert.False(t, az.getServiceReconcileState(&service, nodes).isCompleted(reconcilePhaseLoadBalancer))
+}
+
+func TestEnsureServiceLoadBalancerSkipsCompletedPhase(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc           string
+		getErr         *retry.Error
+		expectedLB     bool
+		expectedRecall bool
+	}{
+		{
+			desc:       "the load balancer reconciled by the previous attempt is read instead of being written",
+			expectedLB: true,
+		},
+		{
+			desc:           "the phase is reconciled again if the load balancer is gone",
+			getErr:         &retry.Error{HTTPStatusCode: http.StatusNotFound},
+			expectedRecall: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			service := getTestService("service", v1.ProtocolTCP, nil, false, 80)
+			state := az.getServiceReconcileState(&service, nil)
+			state.complete(reconcilePhaseLoadBalancer, "lb")
+
+			mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+			mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "lb", gomock.Any()).Return(network.LoadBalancer{Name: pointer.String("lb")}, tc.getErr)
+			mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			if tc.expectedRecall {
+				// the load balancer is reconciled again, which fails on listing the load balancers here
+				mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, &retry.Error{HTTPStatusCode: http.StatusInternalServerError})
+			}
+
+			lb, err := az.ensureServiceLoadBalancer(state, reconcilePhaseLoadBalancer, "kubernetes", &service, nil)
+			if tc.expectedLB {
+				assert.NoError(t, err)
+				assert.Equal(t, "lb", pointer.StringDeref(lb.Name, ""))
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// getServiceShardKey returns the lower case name of the load balancer the service is placed on, without the name of
+// the cluster, e.g., "" for the primary load balancer and "-internal" for the primary internal load balancer. Only
+// the service and the default annotations of its namespace are read, so that every replica gets the same key. The
+// services placed dynamically, e.g., by the multiple standard load balancers without a single load balancer in the
+// annotation or by the "__auto__" load balancer mode, are keyed by the primary load balancer, and their updates
+// conflicting with the other shards are rejected by the ETag preconditions of the load balancer and the security
+// group, or serialized by the shared resource lease.
+func (az *Cloud) getServiceShardKey(service *v1.Service) string {
+	service = applyNamespaceDefaultServiceAnnotations(service, az.NamespaceDefaultServiceAnnotations[service.Namespace])
+
+	var lbName string
+	if az.useMultipleStandardLoadBalancers() {
+		if names := consts.GetLoadBalancerConfigurationsNames(service); len(names) == 1 {
+			lbName = names[0]
+		}
+	} else if !az.useStandardLoadBalancer() {
+		if hasMode, isAuto, mode := az.getServiceLoadBalancerMode(service); hasMode && !isAuto && !strings.Contains(mode, ",") &&
+			(az.VMSet == nil || !strings.EqualFold(mode, az.VMSet.GetPrimaryVMSetName())) {
+			lbName = strings.ToLower(mode)
+		}
+	}
+
+	if requiresInternalLoadBalancer(service) {
+		return lbName + consts.InternalLoadBalancerNameSuffix
+	}
+	return lbName
+}
+
+// GetServiceShard returns the shard of the service controller reconciling the service, which is chosen by the hash
+// of the name of the load balancer the service is placed on. The services on the same load balancer are reconciled
+// by the same shard, in order, and the load balancers are spread across the shards.
+func (az *Cloud) GetServiceShard(service *v1.Service, shardCount int) int {
+	if shardCount <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(az.getServiceShardKey(service)))
+	return int(h.Sum32() % uint32(shardCount))
+}
+
+// errServiceReconciledByOtherShard is returned when the load balancer of a service reconciled by another shard would
+// be deleted, so that the service controller neither deletes the load balancer nor removes the cleanup finalizer.
+type errServiceReconciledByOtherShard struct {
+	service string
+	shard   int
+}
+
+func (e *errServiceReconciledByOtherShard) Error() string {
+	return fmt.Sprintf("service %s is reconciled by shard %d of the service controller", e.service, e.shard)
+}
+
+// serviceShardCloud is the cloud provider of a shard of the service controller. The load balancers of the services
+// reconciled by other shards are skipped instead of being ensured or deleted, so that a service moved to another
+// shard, e.g., by switching between the external and the internal load balancers, is reconciled by the new shard only.
+type serviceShardCloud struct {
+	*Cloud
+	shard      int
+	shardCount int
+}
+
+// ServiceShardCloud returns the cloud provider of the shard of the service controller.
+func (az *Cloud) ServiceShardCloud(shard, shardCount int) cloudprovider.Interface {
+	return &serviceShardCloud{Cloud: az, shard: shard, shardCount: shardCount}
+}
+
+// LoadBalancer returns the load balancer implementation of the shard.
+func (c *serviceShardCloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
+	return c, true
+}
+
+// ownsService returns the error of the service being reconciled by another shard, or nil if the shard owns it.
+func (c *serviceShardCloud) ownsService(service *v1.Service) error {
+	if shard := c.GetServiceShard(service, c.shardCount); shard != c.shard {
+		klog.V(4).Infof("serviceShardCloud: skipping service %s in shard %d, which is reconciled by shard %d", getServiceName(service), c.shard, shard)
+		return &errServiceReconciledByOtherShard{service: getServiceName(service), shard: shard}
+	}
+	return nil
+}
+
+// GetLoadBalancer fails for the services reconciled by other shards, so that the cleanup finalizer is not removed.
+func (c *serviceShardCloud) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	if err := c.ownsService(service); err != nil {
+		return nil, false, err
+	}
+	return c.Cloud.GetLoadBalancer(ctx, clusterName, service)
+}
+
+// EnsureLoadBalancer returns cloudprovider.ImplementedElsewhere for the services reconciled by other shards, so that
+// the service controller leaves their status as is.
+func (c *serviceShardCloud) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	if err := c.ownsService(service); err != nil {
+		return nil, cloudprovider.ImplementedElsewhere
+	}
+	return c.Cloud.EnsureLoadBalancer(ctx, clusterName, service, nodes)
+}
+
+// UpdateLoadBalancer returns cloudprovider.ImplementedElsewhere for the services reconciled by other shards.
+func (c *serviceShardCloud) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	if err := c.ownsService(service); err != nil {
+		return cloudprovider.ImplementedElsewhere
+	}
+	return c.Cloud.UpdateLoadBalancer(ctx, clusterName, service, nodes)
+}
+
+// EnsureLoadBalancerDeleted fails for the existing services reconciled by other shards, so that the cleanup finalizer
+// is not removed. The deleted services are left to the shard reconciling them.
+func (c *serviceShardCloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	if err := c.ownsService(service); err != nil {
+		if c.serviceLister != nil {
+			current, getErr := c.serviceLister.Services(service.Namespace).Get(service.Name)
+			if apierrors.IsNotFound(getErr) || (getErr == nil && current.UID != service.UID) {
+				return nil
+			}
+		}
+		return err
+	}
+	return c.Cloud.EnsureLoadBalancerDeleted(ctx, clusterName, service)
+}
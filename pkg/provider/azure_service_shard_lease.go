@@ -0,0 +1,210 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// sharedResourceLeaseAcquireTimeout is the time to wait for the shared resource lease before the reconciliation
+	// of the service fails and is retried by the service controller.
+	sharedResourceLeaseAcquireTimeout = 2 * time.Minute
+)
+
+var errSharedResourceLeaseHeld = errors.New("the shared resource lease is held by another replica")
+
+// sharedResourceLease serializes the writes of the shards of the service controller on different replicas to the
+// resources shared by all the load balancers, i.e., the backend pool references of the VMSS, the VMs and the NICs,
+// which are updated without ETag preconditions. The writes of the shards on the same replica are serialized by the
+// mutex, and the lease is renewed while it is held.
+type sharedResourceLease struct {
+	lock          resourcelock.Interface
+	leaseDuration time.Duration
+	retryPeriod   time.Duration
+
+	mutex sync.Mutex
+	// lockMutex guards lock, which is not safe for concurrent use, against the renewals.
+	lockMutex sync.Mutex
+	stopRenew chan struct{}
+	renewDone chan struct{}
+}
+
+// SetSharedResourceLock enables serializing the writes to the resources shared by the load balancers across the
+// replicas by the lock, which is needed when the service controller is sharded.
+func (az *Cloud) SetSharedResourceLock(lock resourcelock.Interface, leaseDuration, retryPeriod time.Duration) {
+	az.sharedResourceLease = &sharedResourceLease{
+		lock:          lock,
+		leaseDuration: leaseDuration,
+		retryPeriod:   retryPeriod,
+	}
+}
+
+// lockSharedResources acquires the shared resource lease if it is enabled, and returns the function releasing it.
+func (az *Cloud) lockSharedResources() (func(), error) {
+	if az.sharedResourceLease == nil {
+		return func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedResourceLeaseAcquireTimeout)
+	defer cancel()
+	if err := az.sharedResourceLease.acquire(ctx); err != nil {
+		return nil, fmt.Errorf("failed to acquire the lease %s of the resources shared by the load balancers: %w", az.sharedResourceLease.lock.Describe(), err)
+	}
+	return az.sharedResourceLease.release, nil
+}
+
+// acquire blocks until the lease is acquired or the context is done.
+func (l *sharedResourceLease) acquire(ctx context.Context) error {
+	l.mutex.Lock()
+	for {
+		err := l.tryAcquireOrRenew(ctx)
+		if err == nil {
+			l.stopRenew = make(chan struct{})
+			l.renewDone = make(chan struct{})
+			go l.renew(l.stopRenew, l.renewDone)
+			return nil
+		}
+		if !errors.Is(err, errSharedResourceLeaseHeld) && !apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err) {
+			klog.Warningf("sharedResourceLease: failed to acquire %s: %v", l.lock.Describe(), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			l.mutex.Unlock()
+			return ctx.Err()
+		case <-time.After(wait.Jitter(l.retryPeriod, 1.0)):
+		}
+	}
+}
+
+// tryAcquireOrRenew takes the lease if it is free, expired or held by this replica.
+func (l *sharedResourceLease) tryAcquireOrRenew(ctx context.Context) error {
+	l.lockMutex.Lock()
+	defer l.lockMutex.Unlock()
+
+	now := metav1.NewTime(time.Now())
+	record := resourcelock.LeaderElectionRecord{
+		HolderIdentity:       l.lock.Identity(),
+		LeaseDurationSeconds: int(l.leaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+	current, _, err := l.lock.Get(ctx)
+	if apierrors.IsNotFound(err) {
+		return l.lock.Create(ctx, record)
+	}
+	if err != nil {
+		return err
+	}
+
+	if current.HolderIdentity == l.lock.Identity() {
+		record.AcquireTime = current.AcquireTime
+		record.LeaderTransitions = current.LeaderTransitions
+	} else {
+		if current.HolderIdentity != "" && current.RenewTime.Add(time.Duration(current.LeaseDurationSeconds)*time.Second).After(now.Time) {
+			return errSharedResourceLeaseHeld
+		}
+		record.LeaderTransitions = current.LeaderTransitions + 1
+	}
+	return l.lock.Update(ctx, record)
+}
+
+// renew renews the lease until it is released.
+func (l *sharedResourceLease) renew(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(l.leaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.leaseDuration/3)
+			if err := l.tryAcquireOrRenew(ctx); err != nil {
+				klog.Warningf("sharedResourceLease: failed to renew %s: %v", l.lock.Describe(), err)
+			}
+			cancel()
+		}
+	}
+}
+
+// release gives up the lease so that the other replicas can take it without waiting for it to expire.
+func (l *sharedResourceLease) release() {
+	close(l.stopRenew)
+	<-l.renewDone
+	defer l.mutex.Unlock()
+
+	l.lockMutex.Lock()
+	defer l.lockMutex.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), l.leaseDuration/3)
+	defer cancel()
+	current, _, err := l.lock.Get(ctx)
+	if err != nil || current.HolderIdentity != l.lock.Identity() {
+		return
+	}
+	now := metav1.NewTime(time.Now())
+	if err := l.lock.Update(ctx, resourcelock.LeaderElectionRecord{
+		LeaseDurationSeconds: 1,
+		AcquireTime:          now,
+		RenewTime:            now,
+		LeaderTransitions:    current.LeaderTransitions,
+	}); err != nil {
+		klog.Warningf("sharedResourceLease: failed to release %s: %v", l.lock.Describe(), err)
+	}
+}
+
+// ensureHostsInVMSetPool calls VMSet.EnsureHostsInPool under the shared resource lease.
+func (az *Cloud) ensureHostsInVMSetPool(service *v1.Service, nodes []*v1.Node, backendPoolID, vmSetName string) error {
+	unlock, err := az.lockSharedResources()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return az.VMSet.EnsureHostsInPool(service, nodes, backendPoolID, vmSetName)
+}
+
+// ensureBackendPoolDeletedFromVMSet calls VMSet.EnsureBackendPoolDeleted under the shared resource lease.
+func (az *Cloud) ensureBackendPoolDeletedFromVMSet(service *v1.Service, backendPoolIDs []string, vmSetName string, backendAddressPools *[]network.BackendAddressPool, deleteFromVMSet bool) (bool, error) {
+	unlock, err := az.lockSharedResources()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	return az.VMSet.EnsureBackendPoolDeleted(service, backendPoolIDs, vmSetName, backendAddressPools, deleteFromVMSet)
+}
+
+// ensureBackendPoolDeletedFromVMSets calls VMSet.EnsureBackendPoolDeletedFromVMSets under the shared resource lease.
+func (az *Cloud) ensureBackendPoolDeletedFromVMSets(vmSetNamesMap map[string]bool, backendPoolIDs []string) error {
+	unlock, err := az.lockSharedResources()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return az.VMSet.EnsureBackendPoolDeletedFromVMSets(vmSetNamesMap, backendPoolIDs)
+}
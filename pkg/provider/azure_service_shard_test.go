@@ -0,0 +1,162 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	cloudprovider "k8s.io/cloud-provider"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestGetServiceShard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("svc", v1.ProtocolTCP, nil, false, 80)
+	internalSvc := getInternalTestService("svc", 80)
+	assert.Equal(t, "", az.getServiceShardKey(&svc))
+	assert.Equal(t, consts.InternalLoadBalancerNameSuffix, az.getServiceShardKey(&internalSvc))
+	assert.Equal(t, 0, az.GetServiceShard(&internalSvc, 1))
+
+	// the namespace defaults are applied
+	az.NamespaceDefaultServiceAnnotations = map[string]map[string]string{
+		"default": {consts.ServiceAnnotationLoadBalancerInternal: consts.TrueAnnotationValue},
+	}
+	assert.Equal(t, consts.InternalLoadBalancerNameSuffix, az.getServiceShardKey(&svc))
+	az.NamespaceDefaultServiceAnnotations = nil
+
+	// the services on the same load balancer are reconciled by the same shard, and the load balancers are spread
+	// across the shards
+	shardCount := 4
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.MultipleStandardLoadBalancerConfigurations = []MultipleStandardLoadBalancerConfiguration{}
+	shards := make(map[int]bool)
+	for i := 0; i < 32; i++ {
+		lbName := fmt.Sprintf("lb%d", i)
+		az.MultipleStandardLoadBalancerConfigurations = append(az.MultipleStandardLoadBalancerConfigurations, MultipleStandardLoadBalancerConfiguration{Name: lbName})
+		svc1 := getTestService("svc1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerConfigurations: lbName}, false, 80)
+		svc2 := getTestService("svc2", v1.ProtocolUDP, map[string]string{consts.ServiceAnnotationLoadBalancerConfigurations: lbName}, false, 53)
+		assert.Equal(t, lbName, az.getServiceShardKey(&svc1))
+		assert.Equal(t, az.GetServiceShard(&svc1, shardCount), az.GetServiceShard(&svc2, shardCount))
+		shards[az.GetServiceShard(&svc1, shardCount)] = true
+	}
+	assert.Len(t, shards, shardCount)
+
+	// the services placed dynamically are keyed by the primary load balancer
+	dynamicSvc := getTestService("dynamic", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerConfigurations: "lb1,lb2"}, false, 80)
+	assert.Equal(t, "", az.getServiceShardKey(&dynamicSvc))
+
+	az.LoadBalancerSku = consts.LoadBalancerSkuBasic
+	az.MultipleStandardLoadBalancerConfigurations = nil
+	modeSvc := getTestService("mode", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerMode: "AS1"}, false, 80)
+	autoSvc := getTestService("auto", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationLoadBalancerMode: consts.ServiceAnnotationLoadBalancerAutoModeValue}, false, 80)
+	assert.Equal(t, "as1", az.getServiceShardKey(&modeSvc))
+	assert.Equal(t, "", az.getServiceShardKey(&autoSvc))
+}
+
+func TestServiceShardCloud(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("svc", v1.ProtocolTCP, nil, false, 80)
+	svc.UID = "uid"
+	shardCount := 4
+	otherShard := (az.GetServiceShard(&svc, shardCount) + 1) % shardCount
+	client := fake.NewSimpleClientset(&svc)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	az.serviceLister = informerFactory.Core().V1().Services().Lister()
+	_ = informerFactory.Core().V1().Services().Informer().GetStore().Add(&svc)
+
+	// the services reconciled by other shards are skipped without touching Azure
+	shardCloud := az.ServiceShardCloud(otherShard, shardCount)
+	lb, ok := shardCloud.LoadBalancer()
+	assert.True(t, ok)
+	_, err := lb.EnsureLoadBalancer(context.TODO(), testClusterName, &svc, nil)
+	assert.Equal(t, cloudprovider.ImplementedElsewhere, err)
+	assert.Equal(t, cloudprovider.ImplementedElsewhere, lb.UpdateLoadBalancer(context.TODO(), testClusterName, &svc, nil))
+
+	// the cleanup finalizer of an existing service is not removed by other shards
+	_, _, err = lb.GetLoadBalancer(context.TODO(), testClusterName, &svc)
+	assert.Error(t, err)
+	assert.Error(t, lb.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, &svc))
+
+	// the deleted and the recreated services are left to the shard reconciling them
+	recreated := svc.DeepCopy()
+	recreated.UID = "recreated"
+	_ = informerFactory.Core().V1().Services().Informer().GetStore().Update(recreated)
+	assert.NoError(t, lb.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, &svc))
+	_ = informerFactory.Core().V1().Services().Informer().GetStore().Delete(recreated)
+	assert.NoError(t, lb.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, &svc))
+}
+
+func TestSharedResourceLease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := fake.NewSimpleClientset()
+	newLock := func(identity string) resourcelock.Interface {
+		return &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: "kube-system", Name: "shared"},
+			Client:     client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		}
+	}
+	az1 := GetTestCloud(ctrl)
+	az1.SetSharedResourceLock(newLock("replica1"), time.Minute, 10*time.Millisecond)
+	az2 := GetTestCloud(ctrl)
+	az2.SetSharedResourceLock(newLock("replica2"), time.Minute, 10*time.Millisecond)
+
+	// the lease is held by one replica at a time
+	unlock, err := az1.lockSharedResources()
+	assert.NoError(t, err)
+	lease, err := client.CoordinationV1().Leases("kube-system").Get(context.TODO(), "shared", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "replica1", *lease.Spec.HolderIdentity)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, az2.sharedResourceLease.acquire(ctx))
+
+	// the released lease is taken by another replica at once
+	unlock()
+	unlock, err = az2.lockSharedResources()
+	assert.NoError(t, err)
+	lease, err = client.CoordinationV1().Leases("kube-system").Get(context.TODO(), "shared", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "replica2", *lease.Spec.HolderIdentity)
+	unlock()
+
+	// the lease is not used if the service controller is not sharded
+	az3 := GetTestCloud(ctrl)
+	unlock, err = az3.lockSharedResources()
+	assert.NoError(t, err)
+	unlock()
+}
@@ -0,0 +1,329 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+const (
+	// loadBalancerMetricBackendIPDimension is the dimension splitting the metrics by the backend IPs.
+	loadBalancerMetricBackendIPDimension = "BackendIPAddress"
+
+	snatExhaustionMitigationScalePorts     = "scale_ports"
+	snatExhaustionMitigationAttachIPPrefix = "attach_ip_prefix"
+)
+
+// nodePoolSNATExhaustion is a node pool approaching SNAT exhaustion on a load balancer.
+type nodePoolSNATExhaustion struct {
+	// allocatedPorts is the highest number of the SNAT ports allocated to the nodes reported by Azure Monitor.
+	allocatedPorts int32
+	// nodes are the names of the nodes using the SNAT ports above the threshold.
+	nodes []string
+}
+
+// checkSNATExhaustionAdvisorConfig returns an error if the SNAT exhaustion advisor is not supported by the node pool
+// outbound configurations or is malformed, and sets the defaults of it.
+func (az *Cloud) checkSNATExhaustionAdvisorConfig() error {
+	config := az.SNATExhaustionAdvisor
+	if len(az.NodePoolOutboundConfigurations) == 0 {
+		return fmt.Errorf("snatExhaustionAdvisor requires nodePoolOutboundConfigurations")
+	}
+	if config.IntervalInSeconds < 0 {
+		return fmt.Errorf("intervalInSeconds %d of snatExhaustionAdvisor must not be negative", config.IntervalInSeconds)
+	}
+	if config.UtilizationThresholdPercent < 0 || config.UtilizationThresholdPercent > 100 {
+		return fmt.Errorf("utilizationThresholdPercent %d of snatExhaustionAdvisor must be between 1 and 100", config.UtilizationThresholdPercent)
+	}
+	if config.IntervalInSeconds == 0 {
+		config.IntervalInSeconds = consts.DefaultSNATExhaustionAdvisorIntervalInSeconds
+	}
+	if config.UtilizationThresholdPercent == 0 {
+		config.UtilizationThresholdPercent = consts.DefaultSNATExhaustionUtilizationThresholdPercent
+	}
+	return nil
+}
+
+// runSNATExhaustionAdvisorLoop periodically checks the SNAT port utilization of the node pools, and warns about and
+// mitigates the SNAT exhaustion of them.
+func (az *Cloud) runSNATExhaustionAdvisorLoop(ctx context.Context, interval time.Duration) {
+	klog.V(2).Info("runSNATExhaustionAdvisorLoop: started")
+	err := wait.PollUntilContextCancel(ctx, interval, false, func(ctx context.Context) (bool, error) {
+		if err := az.adviseSNATExhaustion(ctx); err != nil {
+			klog.Warningf("runSNATExhaustionAdvisorLoop: failed to check the SNAT exhaustion of the node pools: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runSNATExhaustionAdvisorLoop: stopped due to %s", err.Error())
+}
+
+// adviseSNATExhaustion queries Azure Monitor for the SNAT ports allocated to and used by the nodes of the node pool
+// outbound configurations on each external load balancer, and exports the utilization of the node pools by metrics.
+// Each node using the SNAT ports above the threshold is warned by an event, and the exhaustion of its node pool is
+// mitigated if configured. The utilization of the load balancers failed to be queried is removed until the next
+// successful query.
+func (az *Cloud) adviseSNATExhaustion(ctx context.Context) error {
+	lbs, err := az.ListLB(nil)
+	if err != nil {
+		return err
+	}
+
+	end := time.Now().UTC()
+	timespan := fmt.Sprintf("%s/%s", end.Add(-loadBalancerMetricTimespan).Format(time.RFC3339), end.Format(time.RFC3339))
+	threshold := float64(az.SNATExhaustionAdvisor.UtilizationThresholdPercent) / 100
+	var errs []error
+	var utilizations []metrics.NodePoolSNATPortUtilization
+	for _, lb := range lbs {
+		if lb.LoadBalancerPropertiesFormat == nil || isInternalLoadBalancer(&lb) {
+			continue
+		}
+		lbName := pointer.StringDeref(lb.Name, "")
+		lbUtilizations, exhaustions, err := az.getNodePoolSNATPortUtilizations(ctx, lb, timespan, threshold)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		utilizations = append(utilizations, lbUtilizations...)
+		if len(exhaustions) == 0 {
+			continue
+		}
+
+		mitigable := make(map[string]*nodePoolSNATExhaustion)
+		for _, config := range az.NodePoolOutboundConfigurations {
+			exhaustion, found := exhaustions[config.Name]
+			if !found {
+				continue
+			}
+			message := fmt.Sprintf("node pool %s is approaching SNAT exhaustion on load balancer %s: the used SNAT ports exceed %d%% of the %d allocated ports",
+				config.Name, lbName, az.SNATExhaustionAdvisor.UtilizationThresholdPercent, exhaustion.allocatedPorts)
+			klog.Warningf("adviseSNATExhaustion: %s on nodes %q", message, exhaustion.nodes)
+			az.eventNodes(exhaustion.nodes, v1.EventTypeWarning, consts.SNATPortExhaustionEventReason, message)
+			// the load balancers are not changed in the read-only mode
+			if !az.ReadOnlyMode && (config.MaxAllocatedOutboundPorts > 0 || len(config.AdditionalPublicIPPrefixIDs) > 0) {
+				mitigable[config.Name] = exhaustion
+			}
+		}
+		if len(mitigable) > 0 {
+			if err := az.mitigateSNATExhaustion(lbName, mitigable); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	metrics.SetNodePoolSNATPortUtilization(utilizations)
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// getNodePoolSNATPortUtilizations queries the SNAT port metrics of the load balancer split by the backend IPs in the
+// timespan, and returns the utilization of the node pools with the nodes on the load balancer, and the node pools
+// approaching SNAT exhaustion keyed by the names of their configurations.
+func (az *Cloud) getNodePoolSNATPortUtilizations(ctx context.Context, lb network.LoadBalancer, timespan string, threshold float64) ([]metrics.NodePoolSNATPortUtilization, map[string]*nodePoolSNATExhaustion, error) {
+	lbName := pointer.StringDeref(lb.Name, "")
+	// the node pool and the name of the node keyed by each backend IP of the node pool outbound backend pools
+	type backendNode struct {
+		nodePool string
+		name     string
+	}
+	backendNodes := make(map[string]backendNode)
+	if lb.BackendAddressPools != nil {
+		for _, config := range az.NodePoolOutboundConfigurations {
+			name := getNodePoolOutboundName(lbName, config.Name)
+			for _, bp := range *lb.BackendAddressPools {
+				if !strings.EqualFold(pointer.StringDeref(bp.Name, ""), name) || bp.BackendAddressPoolPropertiesFormat == nil ||
+					bp.LoadBalancerBackendAddresses == nil {
+					continue
+				}
+				for _, address := range *bp.LoadBalancerBackendAddresses {
+					if address.LoadBalancerBackendAddressPropertiesFormat != nil && address.IPAddress != nil {
+						backendNodes[*address.IPAddress] = backendNode{nodePool: config.Name, name: pointer.StringDeref(address.Name, "")}
+					}
+				}
+			}
+		}
+	}
+	if len(backendNodes) == 0 {
+		return nil, nil, nil
+	}
+
+	metricNames := strings.Join([]string{loadBalancerMetricAllocatedSNATPorts, loadBalancerMetricUsedSNATPorts}, ",")
+	filter := fmt.Sprintf("%s eq '*'", loadBalancerMetricBackendIPDimension)
+	response, rerr := az.MetricsClient.List(ctx, pointer.StringDeref(lb.ID, ""), timespan, loadBalancerMetricInterval, metricNames, loadBalancerMetricAggregation, filter)
+	if rerr != nil {
+		return nil, nil, fmt.Errorf("failed to query the SNAT port metrics of load balancer %s: %w", lbName, rerr.Error())
+	}
+	if response.Value == nil {
+		return nil, nil, nil
+	}
+
+	allocatedPorts := make(map[string]float64)
+	usedPorts := make(map[string]float64)
+	for _, metric := range *response.Value {
+		if metric.Name == nil || metric.Timeseries == nil {
+			continue
+		}
+		metricName := pointer.StringDeref(metric.Name.Value, "")
+		for _, timeseries := range *metric.Timeseries {
+			ip := getMetricDimensionValue(timeseries, loadBalancerMetricBackendIPDimension)
+			value := getLatestMetricAverage(timeseries)
+			if _, found := backendNodes[ip]; !found || value == nil {
+				continue
+			}
+			switch {
+			case strings.EqualFold(metricName, loadBalancerMetricAllocatedSNATPorts):
+				allocatedPorts[ip] = *value
+			case strings.EqualFold(metricName, loadBalancerMetricUsedSNATPorts):
+				usedPorts[ip] = *value
+			}
+		}
+	}
+
+	ratios := make(map[string]float64)
+	exhaustions := make(map[string]*nodePoolSNATExhaustion)
+	for ip, allocated := range allocatedPorts {
+		used, found := usedPorts[ip]
+		if !found || allocated <= 0 {
+			continue
+		}
+		node := backendNodes[ip]
+		ratio := used / allocated
+		if current, found := ratios[node.nodePool]; !found || ratio > current {
+			ratios[node.nodePool] = ratio
+		}
+		if ratio < threshold {
+			continue
+		}
+		exhaustion, found := exhaustions[node.nodePool]
+		if !found {
+			exhaustion = &nodePoolSNATExhaustion{}
+			exhaustions[node.nodePool] = exhaustion
+		}
+		if int32(allocated) > exhaustion.allocatedPorts {
+			exhaustion.allocatedPorts = int32(allocated)
+		}
+		exhaustion.nodes = append(exhaustion.nodes, node.name)
+	}
+	for _, exhaustion := range exhaustions {
+		sort.Strings(exhaustion.nodes)
+	}
+
+	utilizations := make([]metrics.NodePoolSNATPortUtilization, 0, len(ratios))
+	for _, config := range az.NodePoolOutboundConfigurations {
+		if ratio, found := ratios[config.Name]; found {
+			utilizations = append(utilizations, metrics.NodePoolSNATPortUtilization{LoadBalancer: lbName, NodePool: config.Name, Ratio: ratio})
+		}
+	}
+	return utilizations, exhaustions, nil
+}
+
+// mitigateSNATExhaustion mitigates the SNAT exhaustion of the node pools on the load balancer, by doubling the SNAT
+// ports allocated to each node up to maxAllocatedOutboundPorts, or attaching the next additional public IP prefix to
+// the outbound rule if the ports cannot be scaled further.
+func (az *Cloud) mitigateSNATExhaustion(lbName string, exhaustions map[string]*nodePoolSNATExhaustion) error {
+	az.serviceReconcileLock.Lock()
+	defer az.serviceReconcileLock.Unlock()
+
+	lb, exists, err := az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeForceRefresh)
+	if err != nil {
+		return err
+	}
+	if !exists || lb.LoadBalancerPropertiesFormat == nil {
+		return nil
+	}
+
+	actions := make(map[string]string)
+	for _, config := range az.NodePoolOutboundConfigurations {
+		exhaustion, found := exhaustions[config.Name]
+		if !found {
+			continue
+		}
+		if action := az.mitigateNodePoolSNATExhaustion(lb, config, exhaustion.allocatedPorts); action != "" {
+			actions[config.Name] = action
+		}
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+
+	if err := az.CreateOrUpdateLB(nil, *lb); err != nil {
+		return fmt.Errorf("failed to mitigate the SNAT exhaustion of the node pools on load balancer %s: %w", lbName, err)
+	}
+	for nodePool, action := range actions {
+		message := fmt.Sprintf("mitigated the SNAT exhaustion of node pool %s on load balancer %s by %s", nodePool, lbName, action)
+		klog.V(2).Infof("mitigateSNATExhaustion: %s", message)
+		metrics.ObserveSNATExhaustionMitigation(lbName, nodePool, action)
+		az.eventNodes(exhaustions[nodePool].nodes, v1.EventTypeNormal, consts.SNATPortExhaustionMitigatedEventReason, message)
+	}
+	return nil
+}
+
+// mitigateNodePoolSNATExhaustion updates the outbound rule of the node pool outbound configuration on the load
+// balancer to mitigate its SNAT exhaustion, where allocatedPorts is the number of the SNAT ports allocated to each
+// node reported by Azure Monitor, which is used when the ports are allocated by the size of the backend pool. It
+// returns the applied mitigation, or empty if the outbound rule does not exist or cannot be mitigated further.
+func (az *Cloud) mitigateNodePoolSNATExhaustion(lb *network.LoadBalancer, config NodePoolOutboundConfiguration, allocatedPorts int32) string {
+	if lb.OutboundRules == nil ||
+		findOutboundRuleByName(*lb.OutboundRules, getNodePoolOutboundName(pointer.StringDeref(lb.Name, ""), config.Name)) < 0 {
+		return ""
+	}
+
+	ports, additionalPrefixes := az.getNodePoolOutboundMitigations(lb, config)
+	currentPorts := ports
+	if currentPorts == 0 {
+		currentPorts = allocatedPorts - allocatedPorts%8
+	}
+	if scaledPorts := (currentPorts*2 + 7) / 8 * 8; config.MaxAllocatedOutboundPorts > 0 && currentPorts < config.MaxAllocatedOutboundPorts {
+		if scaledPorts > config.MaxAllocatedOutboundPorts {
+			scaledPorts = config.MaxAllocatedOutboundPorts
+		}
+		if az.ensureNodePoolOutboundRule(lb, config, scaledPorts, additionalPrefixes) {
+			return snatExhaustionMitigationScalePorts
+		}
+	}
+	if additionalPrefixes < len(config.AdditionalPublicIPPrefixIDs) &&
+		az.ensureNodePoolOutboundRule(lb, config, ports, additionalPrefixes+1) {
+		return snatExhaustionMitigationAttachIPPrefix
+	}
+	return ""
+}
+
+// eventNodes records the event on each of the nodes.
+func (az *Cloud) eventNodes(nodeNames []string, eventType, reason, message string) {
+	for _, nodeName := range nodeNames {
+		nodeRef := &v1.ObjectReference{
+			Kind: "Node",
+			Name: nodeName,
+			UID:  types.UID(nodeName),
+		}
+		az.Event(nodeRef, eventType, reason, message)
+	}
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/metricclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/metricclient/mockmetricclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getTestBackendMetricTimeSeries(backendIP string, average float64) metricclient.TimeSeriesElement {
+	return metricclient.TimeSeriesElement{
+		Metadatavalues: &[]metricclient.MetadataValue{
+			{
+				Name:  &metricclient.LocalizableString{Value: pointer.String("backendipaddress")},
+				Value: pointer.String(backendIP),
+			},
+		},
+		Data: &[]metricclient.MetricValue{{Average: pointer.Float64(average)}},
+	}
+}
+
+func TestCheckSNATExhaustionAdvisorConfig(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		config      SNATExhaustionAdvisorConfig
+		noNodePools bool
+		expectedErr bool
+	}{
+		{
+			desc: "defaults should be set",
+		},
+		{
+			desc:        "node pool outbound configurations should be set",
+			noNodePools: true,
+			expectedErr: true,
+		},
+		{
+			desc:        "threshold should not be larger than 100",
+			config:      SNATExhaustionAdvisorConfig{UtilizationThresholdPercent: 101},
+			expectedErr: true,
+		},
+		{
+			desc:        "interval should not be negative",
+			config:      SNATExhaustionAdvisorConfig{IntervalInSeconds: -1},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			az := GetTestCloud(ctrl)
+			if !tc.noNodePools {
+				az.NodePoolOutboundConfigurations = []NodePoolOutboundConfiguration{{Name: "a"}}
+			}
+			config := tc.config
+			az.SNATExhaustionAdvisor = &config
+
+			err := az.checkSNATExhaustionAdvisorConfig()
+			assert.Equal(t, tc.expectedErr, err != nil)
+			if !tc.expectedErr {
+				assert.Equal(t, consts.DefaultSNATExhaustionAdvisorIntervalInSeconds, config.IntervalInSeconds)
+				assert.Equal(t, int32(consts.DefaultSNATExhaustionUtilizationThresholdPercent), config.UtilizationThresholdPercent)
+			}
+		})
+	}
+}
+
+func TestAdviseSNATExhaustion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIP
+	az.SNATExhaustionAdvisor = &SNATExhaustionAdvisorConfig{UtilizationThresholdPercent: 80}
+	prefixA := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/a"
+	prefixA2 := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/a2"
+	prefixB := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/b"
+	az.NodePoolOutboundConfigurations = []NodePoolOutboundConfiguration{
+		{
+			Name:                        "a",
+			NodeSelector:                &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+			PublicIPPrefixID:            prefixA,
+			AllocatedOutboundPorts:      1024,
+			IdleTimeoutInMinutes:        4,
+			MaxAllocatedOutboundPorts:   2048,
+			AdditionalPublicIPPrefixIDs: []string{prefixA2},
+		},
+		{
+			Name:                 "b",
+			NodeSelector:         &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "b"}},
+			PublicIPPrefixID:     prefixB,
+			IdleTimeoutInMinutes: 4,
+		},
+	}
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"tenant": "a"}},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"tenant": "b"}},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.2"}}},
+		},
+	}
+	lbID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/testCluster"
+	lb := network.LoadBalancer{
+		ID:   pointer.String(lbID),
+		Name: pointer.String("testCluster"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: pointer.String("service-fip")}},
+		},
+	}
+	_, err := az.reconcileNodePoolOutboundRules(&lb, nodes)
+	assert.NoError(t, err)
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.LoadBalancer{lb}, nil).Times(1)
+	mockLBClient.EXPECT().Get(gomock.Any(), "rg", "testCluster", gomock.Any()).Return(lb, nil).Times(1)
+	var updatedLB network.LoadBalancer
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "testCluster", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, lb network.LoadBalancer, _ string) *retry.Error {
+			updatedLB = lb
+			return nil
+		}).Times(1)
+	mockMetricClient := az.MetricsClient.(*mockmetricclient.MockInterface)
+	mockMetricClient.EXPECT().List(gomock.Any(), lbID, gomock.Any(), "PT1M", "AllocatedSnatPorts,UsedSnatPorts", "Average", "BackendIPAddress eq '*'").
+		Return(metricclient.Response{
+			Value: &[]metricclient.Metric{
+				getTestMetric("AllocatedSnatPorts",
+					getTestBackendMetricTimeSeries("10.0.0.1", 1024),
+					getTestBackendMetricTimeSeries("10.0.0.2", 1024),
+					// not a node of the node pools
+					getTestBackendMetricTimeSeries("10.0.0.3", 1024),
+				),
+				getTestMetric("UsedSnatPorts",
+					getTestBackendMetricTimeSeries("10.0.0.1", 900),
+					getTestBackendMetricTimeSeries("10.0.0.2", 100),
+					getTestBackendMetricTimeSeries("10.0.0.3", 1024),
+				),
+			},
+		}, nil).Times(1)
+
+	err = az.adviseSNATExhaustion(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "Warning SNATPortExhaustion node pool a is approaching SNAT exhaustion on load balancer testCluster: the used SNAT ports exceed 80% of the 1024 allocated ports", <-recorder.Events)
+	assert.Equal(t, "Normal SNATPortExhaustionMitigated mitigated the SNAT exhaustion of node pool a on load balancer testCluster by scale_ports", <-recorder.Events)
+	assert.Empty(t, recorder.Events)
+
+	// the scaled ports are kept by the reconciliation
+	i := findOutboundRuleByName(*updatedLB.OutboundRules, "testCluster-outbound-a")
+	assert.Equal(t, int32(2048), *(*updatedLB.OutboundRules)[i].AllocatedOutboundPorts)
+	changed, err := az.reconcileNodePoolOutboundRules(&updatedLB, nodes)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestMitigateNodePoolSNATExhaustion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIP
+	prefix := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/a"
+	prefix2 := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPPrefixes/a2"
+	config := NodePoolOutboundConfiguration{
+		Name:                        "a",
+		NodeSelector:                &metav1.LabelSelector{},
+		PublicIPPrefixID:            prefix,
+		IdleTimeoutInMinutes:        4,
+		MaxAllocatedOutboundPorts:   1000,
+		AdditionalPublicIPPrefixIDs: []string{prefix2},
+	}
+	az.NodePoolOutboundConfigurations = []NodePoolOutboundConfiguration{config}
+	lb := &network.LoadBalancer{
+		Name: pointer.String("testCluster"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: pointer.String("service-fip")}},
+		},
+	}
+	assert.Empty(t, az.mitigateNodePoolSNATExhaustion(lb, config, 512))
+
+	_, err := az.reconcileNodePoolOutboundRules(lb, nil)
+	assert.NoError(t, err)
+	name := "testCluster-outbound-a"
+	rule := func() network.OutboundRule {
+		return (*lb.OutboundRules)[findOutboundRuleByName(*lb.OutboundRules, name)]
+	}
+
+	// the ports allocated by the size of the backend pool are doubled up to the max allocated outbound ports
+	assert.Equal(t, snatExhaustionMitigationScalePorts, az.mitigateNodePoolSNATExhaustion(lb, config, 516))
+	assert.Equal(t, int32(1000), *rule().AllocatedOutboundPorts)
+
+	// the next additional public IP prefix is attached when the ports cannot be scaled further
+	assert.Equal(t, snatExhaustionMitigationAttachIPPrefix, az.mitigateNodePoolSNATExhaustion(lb, config, 1000))
+	assert.Equal(t, []network.SubResource{
+		{ID: pointer.String(az.getFrontendIPConfigID("testCluster", name))},
+		{ID: pointer.String(az.getFrontendIPConfigID("testCluster", name+"-additional-1"))},
+	}, *rule().FrontendIPConfigurations)
+	fipConfigs := *lb.FrontendIPConfigurations
+	assert.Equal(t, prefix2, *fipConfigs[findFrontendIPConfigByName(fipConfigs, name+"-additional-1")].PublicIPPrefix.ID)
+
+	// both the mitigations are kept by the reconciliation
+	changed, err := az.reconcileNodePoolOutboundRules(lb, nil)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	assert.Empty(t, az.mitigateNodePoolSNATExhaustion(lb, config, 1000))
+
+	// the additional public IP prefix is removed with the configuration
+	config.AdditionalPublicIPPrefixIDs = nil
+	az.NodePoolOutboundConfigurations = []NodePoolOutboundConfiguration{config}
+	changed, err = az.reconcileNodePoolOutboundRules(lb, nil)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, *rule().FrontendIPConfigurations, 1)
+	assert.Len(t, *lb.FrontendIPConfigurations, 2)
+}
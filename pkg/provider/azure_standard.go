@@ -34,6 +34,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
@@ -42,15 +43,14 @@ import (
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/providerid"
 )
 
 var (
 	errNotInVMSet      = errors.New("vm is not in the vmset")
-	providerIDRE       = regexp.MustCompile(`.*/subscriptions/(?:.*)/Microsoft.Compute/virtualMachines/(.+)$`)
 	backendPoolIDRE    = regexp.MustCompile(`^/subscriptions/(?:.*)/resourceGroups/(?:.*)/providers/Microsoft.Network/loadBalancers/(.+)/backendAddressPools/(?:.*)`)
 	nicResourceGroupRE = regexp.MustCompile(`.*/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Network/networkInterfaces/(?:.*)`)
 	nicIDRE            = regexp.MustCompile(`(?i)/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Network/networkInterfaces/(.+)/ipConfigurations/(?:.*)`)
-	vmIDRE             = regexp.MustCompile(`(?i)/subscriptions/(?:.*)/resourceGroups/(?:.*)/providers/Microsoft.Compute/virtualMachines/(.+)`)
 	vmasIDRE           = regexp.MustCompile(`/subscriptions/(?:.*)/resourceGroups/(?:.*)/providers/Microsoft.Compute/availabilitySets/(.+)`)
 )
 
@@ -305,6 +305,12 @@ func (az *Cloud) getLoadBalancerRuleName(service *v1.Service, protocol v1.Protoc
 	// Load balancer rule name must be less or equal to 80 characters, so excluding the hyphen two segments cannot exceed 79
 	subnetSegment := *subnet
 	maxLength := consts.LoadBalancerRuleNameMaxLength - consts.IPFamilySuffixLength
+	if az.useHashedResourceNaming() {
+		// Keep the "<prefix>-<subnet>" part unique after truncation so that the rules
+		// and probes of different subnets with the same long prefix will not collide.
+		prefixedSubnet := truncateNameWithHash(fmt.Sprintf("%s-%s", prefix, subnetSegment), maxLength-len(ruleName)+len(prefix))
+		return getResourceByIPFamily(fmt.Sprintf("%s-%s-%d", prefixedSubnet, protocol, port), isDualStack, isIPv6)
+	}
 	if len(ruleName)+len(subnetSegment)+1 > maxLength {
 		subnetSegment = subnetSegment[:maxLength-len(ruleName)-1]
 	}
@@ -341,6 +347,18 @@ func (az *Cloud) getRulePrefix(service *v1.Service) string {
 	return az.GetLoadBalancerName(context.TODO(), "", service)
 }
 
+// isNameOwnedByPrefix returns true if the name of a managed sub-resource carries the ownership marker, i.e. the
+// resource base name derived from the UID of the service, as its first segment. The marker must be followed by a
+// hyphen or the end of the name, so that the resources of the services whose markers share a prefix are not claimed
+// by each other, and the resources renamed with different suffixes, e.g. after the subnet or the naming scheme is
+// changed, are still recognized.
+func isNameOwnedByPrefix(name, prefix string) bool {
+	if prefix == "" || len(name) < len(prefix) || !strings.EqualFold(name[:len(prefix)], prefix) {
+		return false
+	}
+	return len(name) == len(prefix) || name[len(prefix)] == '-'
+}
+
 func (az *Cloud) getPublicIPName(clusterName string, service *v1.Service, isIPv6 bool) (string, error) {
 	isDualStack := isServiceDualStack(service)
 	pipName := fmt.Sprintf("%s-%s", clusterName, az.GetLoadBalancerName(context.TODO(), clusterName, service))
@@ -353,10 +371,9 @@ func (az *Cloud) getPublicIPName(clusterName string, service *v1.Service, isIPv6
 	return getResourceByIPFamily(pipName, isDualStack, isIPv6), nil
 }
 
-// TODO: UT
+// serviceOwnsRule returns true if the load balancing rule, health probe or security rule is named after the service.
 func (az *Cloud) serviceOwnsRule(service *v1.Service, rule string) bool {
-	prefix := az.getRulePrefix(service)
-	return strings.HasPrefix(strings.ToUpper(rule), strings.ToUpper(prefix))
+	return isNameOwnedByPrefix(rule, az.getRulePrefix(service))
 }
 
 func publicIPOwnsFrontendIP(service *v1.Service, fip *network.FrontendIPConfiguration, pip *network.PublicIPAddress) bool {
@@ -395,6 +412,25 @@ outer:
 	return -1, fmt.Errorf("securityGroup priorities are exhausted")
 }
 
+// useHashedResourceNaming returns true if the names of load balancer sub-resources
+// exceeding the length limit should be truncated with a hash suffix.
+func (az *Cloud) useHashedResourceNaming() bool {
+	return strings.EqualFold(az.ResourceNamingMode, consts.ResourceNamingModeHashed)
+}
+
+// truncateNameWithHash truncates the name to maxLength if it is too long, and
+// replaces the tail with the hash of the full name to avoid collisions.
+func truncateNameWithHash(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+	hash := MakeCRC32(name)
+	if maxLength <= len(hash) {
+		return hash[:maxLength]
+	}
+	return fmt.Sprintf("%s-%s", name[:maxLength-len(hash)-1], hash)
+}
+
 var polyTable = crc32.MakeTable(crc32.Koopman)
 
 // MakeCRC32 : convert string to CRC32 format
@@ -410,6 +446,12 @@ type availabilitySet struct {
 	*Cloud
 
 	vmasCache azcache.Resource
+
+	// ensuredBackendPools records the backend pools the nodes have been ensured in, keyed by
+	// the lower-cased backend pool ID. It is used by the NIC reconciliation routine to detect
+	// missing and stale backend pool references of the NICs.
+	ensuredBackendPools     map[string]*ensuredBackendPool
+	ensuredBackendPoolsLock sync.Mutex
 }
 
 type AvailabilitySetEntry struct {
@@ -513,12 +555,8 @@ func (as *availabilitySet) GetPowerStatusByNodeName(name string) (powerState str
 	}
 
 	if vm.InstanceView != nil && vm.InstanceView.Statuses != nil {
-		statuses := *vm.InstanceView.Statuses
-		for _, status := range statuses {
-			state := pointer.StringDeref(status.Code, "")
-			if strings.HasPrefix(state, vmPowerStatePrefix) {
-				return strings.TrimPrefix(state, vmPowerStatePrefix), nil
-			}
+		if powerState, found := getPowerStateFromStatuses(*vm.InstanceView.Statuses); found {
+			return powerState, nil
 		}
 	}
 
@@ -544,12 +582,12 @@ func (as *availabilitySet) GetProvisioningStateByNodeName(name string) (provisio
 // GetNodeNameByProviderID gets the node name by provider ID.
 func (as *availabilitySet) GetNodeNameByProviderID(providerID string) (types.NodeName, error) {
 	// NodeName is part of providerID for standard instances.
-	matches := providerIDRE.FindStringSubmatch(providerID)
-	if len(matches) != 2 {
+	parsed, err := providerid.Parse(providerID)
+	if err != nil || parsed.IsScaleSetVM() {
 		return "", errors.New("error splitting providerID")
 	}
 
-	return types.NodeName(matches[1]), nil
+	return types.NodeName(parsed.Name), nil
 }
 
 // GetInstanceTypeByNodeName gets the instance type by node name.
@@ -815,14 +853,48 @@ func (as *availabilitySet) getPrimaryInterfaceWithVMSet(nodeName, vmSetName stri
 	if err != nil {
 		return network.Interface{}, "", err
 	}
-	nicName, err := getLastSegment(primaryNicID, "/")
+	if _, err := getLastSegment(primaryNicID, "/"); err != nil {
+		return network.Interface{}, "", err
+	}
+
+	availabilitySetID, err := as.getAvailabilitySetIDWithVMSet(machine, nodeName, vmSetName)
 	if err != nil {
 		return network.Interface{}, "", err
 	}
-	nodeResourceGroup, err := as.GetNodeResourceGroup(nodeName)
+
+	nic, err := as.getInterfaceByID(primaryNicID)
 	if err != nil {
 		return network.Interface{}, "", err
 	}
+	return nic, availabilitySetID, nil
+}
+
+// getInterfaceWithVMSet gets the network interface of the machine by the node name, vmSet and the ID of the network interface.
+func (as *availabilitySet) getInterfaceWithVMSet(nodeName, vmSetName, nicID string) (network.Interface, string, error) {
+	machine, err := as.GetVirtualMachineWithRetry(types.NodeName(nodeName), azcache.CacheReadTypeDefault)
+	if err != nil {
+		klog.V(2).Infof("getInterfaceWithVMSet(%s, %s) abort backoff", nodeName, vmSetName)
+		return network.Interface{}, "", err
+	}
+
+	availabilitySetID, err := as.getAvailabilitySetIDWithVMSet(machine, nodeName, vmSetName)
+	if err != nil {
+		return network.Interface{}, "", err
+	}
+
+	nic, err := as.getInterfaceByID(nicID)
+	if err != nil {
+		return network.Interface{}, "", err
+	}
+	return nic, availabilitySetID, nil
+}
+
+// getAvailabilitySetIDWithVMSet returns the availability set ID of the VM, and checks if the VM is in the vmSet.
+func (as *availabilitySet) getAvailabilitySetIDWithVMSet(machine compute.VirtualMachine, nodeName, vmSetName string) (string, error) {
+	nodeResourceGroup, err := as.GetNodeResourceGroup(nodeName)
+	if err != nil {
+		return "", err
+	}
 
 	// Check availability set name. Note that vmSetName is empty string when getting
 	// the Node's IP address. While vmSetName is not empty, it should be checked with
@@ -841,36 +913,45 @@ func (as *availabilitySet) getPrimaryInterfaceWithVMSet(nodeName, vmSetName stri
 		expectedAvailabilitySetID := as.getAvailabilitySetID(nodeResourceGroup, vmSetName)
 		if machine.AvailabilitySet == nil || !strings.EqualFold(*machine.AvailabilitySet.ID, expectedAvailabilitySetID) {
 			klog.V(3).Infof(
-				"GetPrimaryInterface: nic (%s) is not in the availabilitySet(%s)", nicName, vmSetName)
-			return network.Interface{}, "", errNotInVMSet
+				"GetPrimaryInterface: node (%s) is not in the availabilitySet(%s)", nodeName, vmSetName)
+			return "", errNotInVMSet
 		}
 	}
 
-	nicResourceGroup, err := extractResourceGroupByNicID(primaryNicID)
+	var availabilitySetID string
+	if machine.VirtualMachineProperties != nil && machine.AvailabilitySet != nil {
+		availabilitySetID = pointer.StringDeref(machine.AvailabilitySet.ID, "")
+	}
+	return availabilitySetID, nil
+}
+
+// getInterfaceByID gets the network interface by its ID.
+func (as *availabilitySet) getInterfaceByID(nicID string) (network.Interface, error) {
+	nicName, err := getLastSegment(nicID, "/")
 	if err != nil {
-		return network.Interface{}, "", err
+		return network.Interface{}, err
+	}
+	nicResourceGroup, err := extractResourceGroupByNicID(nicID)
+	if err != nil {
+		return network.Interface{}, err
 	}
 
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 	nic, rerr := as.InterfacesClient.Get(ctx, nicResourceGroup, nicName, "")
 	if rerr != nil {
-		return network.Interface{}, "", rerr.Error()
-	}
-
-	var availabilitySetID string
-	if machine.VirtualMachineProperties != nil && machine.AvailabilitySet != nil {
-		availabilitySetID = pointer.StringDeref(machine.AvailabilitySet.ID, "")
+		return network.Interface{}, rerr.Error()
 	}
-	return nic, availabilitySetID, nil
+	return nic, nil
 }
 
 // EnsureHostInPool ensures the given VM's Primary NIC's Primary IP Configuration is
-// participating in the specified LoadBalancer Backend Pool.
+// participating in the specified LoadBalancer Backend Pool. For VMs with multiple NICs, the
+// NIC and IP Configuration can be chosen by the node annotation or the cloud config.
 func (as *availabilitySet) EnsureHostInPool(service *v1.Service, nodeName types.NodeName, backendPoolID string, vmSetName string) (string, string, string, *compute.VirtualMachineScaleSetVM, error) {
 	vmName := mapNodeNameToVMName(nodeName)
 	serviceName := getServiceName(service)
-	nic, _, err := as.getPrimaryInterfaceWithVMSet(vmName, vmSetName)
+	nic, _, ipConfigSelector, err := as.getBackendPoolInterfaceWithVMSet(vmName, vmSetName)
 	if err != nil {
 		if errors.Is(err, errNotInVMSet) {
 			klog.V(3).Infof("EnsureHostInPool skips node %s because it is not in the vmSet %s", nodeName, vmSetName)
@@ -886,18 +967,9 @@ func (as *availabilitySet) EnsureHostInPool(service *v1.Service, nodeName types.
 		return "", "", "", nil, nil
 	}
 
-	var primaryIPConfig *network.InterfaceIPConfiguration
-	ipv6 := isBackendPoolIPv6(backendPoolID)
-	if !as.Cloud.ipv6DualStackEnabled && !ipv6 {
-		primaryIPConfig, err = getPrimaryIPConfig(nic)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-	} else {
-		primaryIPConfig, err = getIPConfigByIPFamily(nic, ipv6)
-		if err != nil {
-			return "", "", "", nil, err
-		}
+	primaryIPConfig, err := selectBackendPoolIPConfig(nic, backendPoolID, as.Cloud.ipv6DualStackEnabled, ipConfigSelector)
+	if err != nil {
+		return "", "", "", nil, err
 	}
 
 	foundPool := false
@@ -959,7 +1031,8 @@ func (as *availabilitySet) EnsureHostsInPool(service *v1.Service, nodes []*v1.No
 		mc.ObserveOperationWithResult(isOperationSucceeded)
 	}()
 
-	hostUpdates := make([]func() error, 0, len(nodes))
+	hostGroups := make(map[string][]string)
+	nodeNames := sets.New[string]()
 	for _, node := range nodes {
 		localNodeName := node.Name
 		if as.useStandardLoadBalancer() && as.excludeMasterNodesFromStandardLB() && isControlPlaneNode(node) {
@@ -976,26 +1049,42 @@ func (as *availabilitySet) EnsureHostsInPool(service *v1.Service, nodes []*v1.No
 			klog.V(4).Infof("Excluding unmanaged/external-resource-group node %q", localNodeName)
 			continue
 		}
+		nodeNames.Insert(localNodeName)
 
-		f := func() error {
-			_, _, _, _, err := as.EnsureHostInPool(service, types.NodeName(localNodeName), backendPoolID, vmSetName)
-			if err != nil {
-				return fmt.Errorf("ensure(%s): backendPoolID(%s) - failed to ensure host in pool: %w", getServiceName(service), backendPoolID, err)
-			}
-			return nil
-		}
-		hostUpdates = append(hostUpdates, f)
+		asName := as.getNodeAvailabilitySetName(localNodeName)
+		hostGroups[asName] = append(hostGroups[asName], localNodeName)
 	}
 
-	errs := utilerrors.AggregateGoroutines(hostUpdates...)
-	if errs != nil {
-		return utilerrors.Flatten(errs)
+	err := as.ensureHostGroupsInPool(hostGroups, func(nodeName string) error {
+		_, _, _, _, err := as.EnsureHostInPool(service, types.NodeName(nodeName), backendPoolID, vmSetName)
+		if err != nil {
+			return fmt.Errorf("ensure(%s): backendPoolID(%s) - failed to ensure host in pool: %w", getServiceName(service), backendPoolID, err)
+		}
+		return nil
+	}, as.DeleteCacheForNode)
+	if err != nil {
+		return err
 	}
 
+	as.recordEnsuredBackendPool(backendPoolID, vmSetName, nodeNames)
 	isOperationSucceeded = true
 	return nil
 }
 
+// getNodeAvailabilitySetName returns the lower case name of the availability set of the node from the VM cache,
+// or an empty string for the standalone VMs and the VMs failed to be got.
+func (as *availabilitySet) getNodeAvailabilitySetName(nodeName string) string {
+	vm, err := as.getVirtualMachine(types.NodeName(nodeName), azcache.CacheReadTypeDefault)
+	if err != nil || vm.VirtualMachineProperties == nil || vm.AvailabilitySet == nil {
+		return ""
+	}
+	asName, err := getLastSegment(pointer.StringDeref(vm.AvailabilitySet.ID, ""), "/")
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(asName)
+}
+
 // EnsureBackendPoolDeleted ensures the loadBalancer backendAddressPools deleted from the specified nodes.
 // backendPoolIDs are the IDs of the backendpools to be deleted.
 func (as *availabilitySet) EnsureBackendPoolDeleted(service *v1.Service, backendPoolIDs []string, vmSetName string, backendAddressPools *[]network.BackendAddressPool, deleteFromVMSet bool) (bool, error) {
@@ -1003,6 +1092,9 @@ func (as *availabilitySet) EnsureBackendPoolDeleted(service *v1.Service, backend
 	if backendAddressPools == nil {
 		return false, nil
 	}
+	if deleteFromVMSet {
+		as.forgetEnsuredBackendPools(backendPoolIDs)
+	}
 
 	mc := metrics.NewMetricContext("services", "vmas_ensure_backend_pool_deleted", as.ResourceGroup, as.SubscriptionID, getServiceName(service))
 	isOperationSucceeded := false
@@ -1048,8 +1140,10 @@ func (as *availabilitySet) EnsureBackendPoolDeleted(service *v1.Service, backend
 			continue
 		}
 
+		// The backend pool may be referenced by a secondary NIC of the node, so the NIC is got from
+		// the ID of the ipconfig instead of using the primary one.
 		vmName := mapNodeNameToVMName(types.NodeName(nodeName))
-		nic, vmasID, err := as.getPrimaryInterfaceWithVMSet(vmName, vmSetName)
+		nic, vmasID, err := as.getInterfaceWithVMSet(vmName, vmSetName, getResourceIDPrefix(ipConfigIDPrefix))
 		if err != nil {
 			if errors.Is(err, errNotInVMSet) {
 				klog.V(3).Infof("EnsureBackendPoolDeleted skips node %s because it is not in the vmSet %s", nodeName, vmSetName)
@@ -1110,6 +1204,7 @@ func (as *availabilitySet) EnsureBackendPoolDeleted(service *v1.Service, backend
 		nicUpdaters = append(nicUpdaters, func() error {
 			ctx, cancel := getContextWithCancel()
 			defer cancel()
+			ctx = as.withServiceOperationAnnotation(ctx, service)
 			klog.V(2).Infof("EnsureBackendPoolDeleted begins to CreateOrUpdate for NIC(%s, %s) with backendPoolIDs %q", as.ResourceGroup, pointer.StringDeref(nic.Name, ""), backendPoolIDs)
 			rerr := as.InterfacesClient.CreateOrUpdate(ctx, as.ResourceGroup, pointer.StringDeref(nic.Name, ""), nic)
 			if rerr != nil {
@@ -1182,11 +1277,11 @@ func (as *availabilitySet) GetNodeNameByIPConfigurationID(ipConfigurationID stri
 		return "", "", nil
 	}
 
-	matches = vmIDRE.FindStringSubmatch(vmID)
-	if len(matches) != 2 {
+	parsedVMID, err := providerid.Parse(vmID)
+	if err != nil || parsedVMID.IsScaleSetVM() {
 		return "", "", fmt.Errorf("invalid virtual machine ID %s", vmID)
 	}
-	vmName := matches[1]
+	vmName := parsedVMID.Name
 
 	vm, err := as.getVirtualMachine(types.NodeName(vmName), azcache.CacheReadTypeDefault)
 	if err != nil {
@@ -1227,13 +1322,13 @@ func (as *availabilitySet) getAvailabilitySetByNodeName(nodeName string, crt azc
 		if vmas != nil && vmas.AvailabilitySetProperties != nil && vmas.VirtualMachines != nil {
 			for _, vmIDRef := range *vmas.VirtualMachines {
 				if vmIDRef.ID != nil {
-					matches := vmIDRE.FindStringSubmatch(pointer.StringDeref(vmIDRef.ID, ""))
-					if len(matches) != 2 {
+					parsedVMID, parseErr := providerid.Parse(pointer.StringDeref(vmIDRef.ID, ""))
+					if parseErr != nil || parsedVMID.IsScaleSetVM() {
 						err = fmt.Errorf("invalid vm ID %s", pointer.StringDeref(vmIDRef.ID, ""))
 						return false
 					}
 
-					vmName := matches[1]
+					vmName := parsedVMID.Name
 					if strings.EqualFold(vmName, nodeName) {
 						result = vmas
 						return false
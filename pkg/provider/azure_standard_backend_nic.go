@@ -0,0 +1,191 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// backendIPConfigSelector selects the ip configuration of the network interface which joins the
+// backend pools. The zero value selects the primary ip configuration.
+type backendIPConfigSelector struct {
+	ipConfigName string
+	subnetName   string
+}
+
+// getNodeBackendNIC returns the network interface and the ip configuration specified by the
+// annotation of the node.
+func (az *Cloud) getNodeBackendNIC(nodeName string) (string, string) {
+	az.nodeCachesLock.RLock()
+	defer az.nodeCachesLock.RUnlock()
+
+	nicName, ipConfigName, _ := strings.Cut(az.nodeBackendNICs[nodeName], "/")
+	return strings.TrimSpace(nicName), strings.TrimSpace(ipConfigName)
+}
+
+// hasLoadBalancerBackendNICSelector returns true if the selector of the backend network interface is configured.
+func (az *Cloud) hasLoadBalancerBackendNICSelector() bool {
+	selector := az.LoadBalancerBackendNICSelector
+	return selector != nil && (selector.SubnetName != "" || selector.TagKey != "")
+}
+
+// getBackendPoolInterfaceWithVMSet gets the network interface of the node which joins the backend pools,
+// and the selector of its ip configuration. The network interface is chosen by:
+// 1. the node annotation "kubernetes.azure.com/load-balancer-backend-nic";
+// 2. the loadBalancerBackendNICSelector in the cloud config;
+// 3. the primary network interface if neither of the above is set or matches.
+func (as *availabilitySet) getBackendPoolInterfaceWithVMSet(nodeName, vmSetName string) (network.Interface, string, backendIPConfigSelector, error) {
+	nicName, ipConfigName := as.getNodeBackendNIC(nodeName)
+	if nicName == "" && !as.hasLoadBalancerBackendNICSelector() {
+		nic, availabilitySetID, err := as.getPrimaryInterfaceWithVMSet(nodeName, vmSetName)
+		return nic, availabilitySetID, backendIPConfigSelector{}, err
+	}
+
+	machine, err := as.GetVirtualMachineWithRetry(types.NodeName(nodeName), azcache.CacheReadTypeDefault)
+	if err != nil {
+		klog.V(2).Infof("getBackendPoolInterfaceWithVMSet(%s, %s) abort backoff", nodeName, vmSetName)
+		return network.Interface{}, "", backendIPConfigSelector{}, err
+	}
+	availabilitySetID, err := as.getAvailabilitySetIDWithVMSet(machine, nodeName, vmSetName)
+	if err != nil {
+		return network.Interface{}, "", backendIPConfigSelector{}, err
+	}
+	var nicIDs []string
+	if machine.VirtualMachineProperties != nil && machine.NetworkProfile != nil && machine.NetworkProfile.NetworkInterfaces != nil {
+		for _, ref := range *machine.NetworkProfile.NetworkInterfaces {
+			if ref.ID != nil {
+				nicIDs = append(nicIDs, *ref.ID)
+			}
+		}
+	}
+
+	if nicName != "" {
+		for _, nicID := range nicIDs {
+			name, err := getLastSegment(nicID, "/")
+			if err != nil || !strings.EqualFold(name, nicName) {
+				continue
+			}
+			nic, err := as.getInterfaceByID(nicID)
+			if err != nil {
+				return network.Interface{}, "", backendIPConfigSelector{}, err
+			}
+			return nic, availabilitySetID, backendIPConfigSelector{ipConfigName: ipConfigName}, nil
+		}
+		return network.Interface{}, "", backendIPConfigSelector{}, fmt.Errorf("network interface %q specified by the annotation %s is not attached to node %s", nicName, consts.NodeLoadBalancerBackendNICAnnotation, nodeName)
+	}
+
+	selector := as.LoadBalancerBackendNICSelector
+	for _, nicID := range nicIDs {
+		nic, err := as.getInterfaceByID(nicID)
+		if err != nil {
+			return network.Interface{}, "", backendIPConfigSelector{}, err
+		}
+		if isBackendNICSelected(nic, selector) {
+			klog.V(4).Infof("getBackendPoolInterfaceWithVMSet: network interface %s of node %s is selected", pointer.StringDeref(nic.Name, ""), nodeName)
+			return nic, availabilitySetID, backendIPConfigSelector{subnetName: selector.SubnetName}, nil
+		}
+	}
+
+	klog.V(4).Infof("getBackendPoolInterfaceWithVMSet: no network interface of node %s matches the selector, use the primary one", nodeName)
+	primaryNicID, err := getPrimaryInterfaceID(machine)
+	if err != nil {
+		return network.Interface{}, "", backendIPConfigSelector{}, err
+	}
+	nic, err := as.getInterfaceByID(primaryNicID)
+	if err != nil {
+		return network.Interface{}, "", backendIPConfigSelector{}, err
+	}
+	return nic, availabilitySetID, backendIPConfigSelector{}, nil
+}
+
+// isBackendNICSelected returns true if the network interface has the tag and an ip configuration
+// in the subnet of the selector.
+func isBackendNICSelected(nic network.Interface, selector *LoadBalancerBackendNICSelector) bool {
+	if selector.TagKey != "" {
+		value, found := nic.Tags[selector.TagKey]
+		if !found || (selector.TagValue != "" && !strings.EqualFold(pointer.StringDeref(value, ""), selector.TagValue)) {
+			return false
+		}
+	}
+	if selector.SubnetName != "" {
+		if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil {
+			return false
+		}
+		for _, ipConfig := range *nic.IPConfigurations {
+			if isIPConfigInSubnet(ipConfig, selector.SubnetName) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// isIPConfigInSubnet returns true if the ip configuration is in the subnet.
+func isIPConfigInSubnet(ipConfig network.InterfaceIPConfiguration, subnetName string) bool {
+	if ipConfig.InterfaceIPConfigurationPropertiesFormat == nil || ipConfig.Subnet == nil {
+		return false
+	}
+	name, err := getLastSegment(pointer.StringDeref(ipConfig.Subnet.ID, ""), "/")
+	return err == nil && strings.EqualFold(name, subnetName)
+}
+
+// selectBackendPoolIPConfig returns the ip configuration of the network interface which joins the backend pool.
+// The ip configuration chosen by the selector is used if it is of the IP family of the backend pool. Otherwise,
+// it is the primary ip configuration for IPv4 backend pools of single stack clusters, or the first ip
+// configuration of the IP family of the backend pool.
+func selectBackendPoolIPConfig(nic network.Interface, backendPoolID string, ipv6DualStackEnabled bool, selector backendIPConfigSelector) (*network.InterfaceIPConfiguration, error) {
+	if nic.IPConfigurations == nil {
+		return nil, fmt.Errorf("nic.IPConfigurations for nic (nicname=%q) is nil", pointer.StringDeref(nic.Name, ""))
+	}
+
+	ipv6 := isBackendPoolIPv6(backendPoolID)
+	if selector.ipConfigName != "" || selector.subnetName != "" {
+		found := false
+		for i := range *nic.IPConfigurations {
+			ipConfig := &(*nic.IPConfigurations)[i]
+			if selector.ipConfigName != "" && !strings.EqualFold(pointer.StringDeref(ipConfig.Name, ""), selector.ipConfigName) {
+				continue
+			}
+			if selector.subnetName != "" && !isIPConfigInSubnet(*ipConfig, selector.subnetName) {
+				continue
+			}
+			found = true
+			if ipConfig.InterfaceIPConfigurationPropertiesFormat != nil && (ipConfig.PrivateIPAddressVersion == network.IPv6) == ipv6 {
+				return ipConfig, nil
+			}
+		}
+		if selector.ipConfigName != "" && !found {
+			return nil, fmt.Errorf("failed to find the ipconfig %q. nicname=%q", selector.ipConfigName, pointer.StringDeref(nic.Name, ""))
+		}
+	}
+
+	if !ipv6DualStackEnabled && !ipv6 {
+		return getPrimaryIPConfig(nic)
+	}
+	return getIPConfigByIPFamily(nic, ipv6)
+}
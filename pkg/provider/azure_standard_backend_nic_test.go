@@ -0,0 +1,284 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient/mockinterfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	testBackendNIC1ID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic1"
+	testBackendNIC2ID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic2"
+)
+
+func buildTestBackendNIC(nicID string, tags map[string]*string, subnets ...string) network.Interface {
+	name, _ := getLastSegment(nicID, "/")
+	ipConfigs := make([]network.InterfaceIPConfiguration, 0, len(subnets))
+	for i, subnet := range subnets {
+		ipConfigName := "ipconfig" + string(rune('1'+i))
+		ipConfigs = append(ipConfigs, network.InterfaceIPConfiguration{
+			ID:   pointer.String(nicID + "/ipConfigurations/" + ipConfigName),
+			Name: pointer.String(ipConfigName),
+			InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+				Primary: pointer.Bool(i == 0),
+				Subnet:  &network.Subnet{ID: pointer.String("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/" + subnet)},
+			},
+		})
+	}
+	return network.Interface{
+		ID:   pointer.String(nicID),
+		Name: pointer.String(name),
+		Tags: tags,
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			ProvisioningState: network.ProvisioningStateSucceeded,
+			IPConfigurations:  &ipConfigs,
+		},
+	}
+}
+
+func TestSelectBackendPoolIPConfig(t *testing.T) {
+	nic := buildTestBackendNIC(testBackendNIC1ID, nil, "subnet1", "subnet2")
+	ipv6Config := network.InterfaceIPConfiguration{
+		Name: pointer.String("ipconfig-v6"),
+		InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+			Primary:                 pointer.Bool(false),
+			PrivateIPAddress:        pointer.String("fd00::4"),
+			PrivateIPAddressVersion: network.IPv6,
+			Subnet:                  &network.Subnet{ID: pointer.String("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet2")},
+		},
+	}
+	*nic.IPConfigurations = append(*nic.IPConfigurations, ipv6Config)
+	ipv4PoolID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/backendAddressPools/pool"
+	ipv6PoolID := ipv4PoolID + "-" + consts.IPVersionIPv6String
+
+	for _, tc := range []struct {
+		description    string
+		backendPoolID  string
+		selector       backendIPConfigSelector
+		expectedConfig string
+		expectedErr    bool
+	}{
+		{
+			description:    "should select the primary ipconfig by default",
+			backendPoolID:  ipv4PoolID,
+			expectedConfig: "ipconfig1",
+		},
+		{
+			description:    "should select the ipconfig by name",
+			backendPoolID:  ipv4PoolID,
+			selector:       backendIPConfigSelector{ipConfigName: "IPConfig2"},
+			expectedConfig: "ipconfig2",
+		},
+		{
+			description:    "should select the ipconfig by subnet",
+			backendPoolID:  ipv4PoolID,
+			selector:       backendIPConfigSelector{subnetName: "subnet2"},
+			expectedConfig: "ipconfig2",
+		},
+		{
+			description:    "should select the ipconfig of the IP family of the backend pool in the subnet",
+			backendPoolID:  ipv6PoolID,
+			selector:       backendIPConfigSelector{subnetName: "subnet2"},
+			expectedConfig: "ipconfig-v6",
+		},
+		{
+			description:    "should fall back to the ipconfig of the IP family if the selected one is of another family",
+			backendPoolID:  ipv6PoolID,
+			selector:       backendIPConfigSelector{ipConfigName: "ipconfig2"},
+			expectedConfig: "ipconfig-v6",
+		},
+		{
+			description:   "should report an error if the ipconfig is not found",
+			backendPoolID: ipv4PoolID,
+			selector:      backendIPConfigSelector{ipConfigName: "ipconfig3"},
+			expectedErr:   true,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			ipConfig, err := selectBackendPoolIPConfig(nic, tc.backendPoolID, false, tc.selector)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedConfig, pointer.StringDeref(ipConfig.Name, ""))
+		})
+	}
+}
+
+func TestIsBackendNICSelected(t *testing.T) {
+	nic := buildTestBackendNIC(testBackendNIC2ID, map[string]*string{"lb": pointer.String("Backend")}, "subnet2")
+	for _, tc := range []struct {
+		description string
+		selector    LoadBalancerBackendNICSelector
+		expected    bool
+	}{
+		{
+			description: "should select the nic by subnet",
+			selector:    LoadBalancerBackendNICSelector{SubnetName: "subnet2"},
+			expected:    true,
+		},
+		{
+			description: "should not select the nic in another subnet",
+			selector:    LoadBalancerBackendNICSelector{SubnetName: "subnet1"},
+		},
+		{
+			description: "should select the nic by tag key",
+			selector:    LoadBalancerBackendNICSelector{TagKey: "lb"},
+			expected:    true,
+		},
+		{
+			description: "should select the nic by tag key and value",
+			selector:    LoadBalancerBackendNICSelector{TagKey: "lb", TagValue: "backend"},
+			expected:    true,
+		},
+		{
+			description: "should not select the nic with another tag value",
+			selector:    LoadBalancerBackendNICSelector{TagKey: "lb", TagValue: "frontend"},
+		},
+		{
+			description: "should require both the tag and the subnet to match",
+			selector:    LoadBalancerBackendNICSelector{TagKey: "lb", SubnetName: "subnet1"},
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expected, isBackendNICSelected(nic, &tc.selector))
+		})
+	}
+}
+
+func TestStandardEnsureHostInPoolWithBackendNIC(t *testing.T) {
+	backendPoolID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb1/backendAddressPools/pool1"
+
+	for _, tc := range []struct {
+		description         string
+		annotation          string
+		selector            *LoadBalancerBackendNICSelector
+		expectedNIC         string
+		expectedIPConfig    string
+		expectedErr         bool
+		expectedNICsFetched []string
+	}{
+		{
+			description:         "should use the primary nic by default",
+			expectedNIC:         "nic1",
+			expectedIPConfig:    "ipconfig1",
+			expectedNICsFetched: []string{"nic1"},
+		},
+		{
+			description:         "should use the nic and ipconfig of the node annotation",
+			annotation:          "nic2/ipconfig2",
+			selector:            &LoadBalancerBackendNICSelector{SubnetName: "subnet1"},
+			expectedNIC:         "nic2",
+			expectedIPConfig:    "ipconfig2",
+			expectedNICsFetched: []string{"nic2"},
+		},
+		{
+			description:         "should use the nic selected by the subnet",
+			selector:            &LoadBalancerBackendNICSelector{SubnetName: "subnet3"},
+			expectedNIC:         "nic2",
+			expectedIPConfig:    "ipconfig2",
+			expectedNICsFetched: []string{"nic1", "nic2"},
+		},
+		{
+			description:         "should use the nic selected by the tag",
+			selector:            &LoadBalancerBackendNICSelector{TagKey: "lb-backend"},
+			expectedNIC:         "nic2",
+			expectedIPConfig:    "ipconfig1",
+			expectedNICsFetched: []string{"nic1", "nic2"},
+		},
+		{
+			description:         "should fall back to the primary nic if no nic matches the selector",
+			selector:            &LoadBalancerBackendNICSelector{SubnetName: "subnet4"},
+			expectedNIC:         "nic1",
+			expectedIPConfig:    "ipconfig1",
+			expectedNICsFetched: []string{"nic1", "nic2", "nic1"},
+		},
+		{
+			description: "should report an error if the nic of the node annotation is not attached",
+			annotation:  "nic3",
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			az.LoadBalancerBackendNICSelector = tc.selector
+			az.nodeNames = sets.New[string]()
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "vm1"}}
+			if tc.annotation != "" {
+				node.Annotations = map[string]string{consts.NodeLoadBalancerBackendNICAnnotation: tc.annotation}
+			}
+			az.updateNodeCaches(nil, node)
+
+			vm := buildDefaultTestVirtualMachine(asID, []string{testBackendNIC1ID, testBackendNIC2ID})
+			(*vm.NetworkProfile.NetworkInterfaces)[0].NetworkInterfaceReferenceProperties = &compute.NetworkInterfaceReferenceProperties{Primary: pointer.Bool(true)}
+			mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+			mockVMClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "vm1", gomock.Any()).Return(vm, nil)
+
+			nics := map[string]network.Interface{
+				"nic1": buildTestBackendNIC(testBackendNIC1ID, nil, "subnet1"),
+				"nic2": buildTestBackendNIC(testBackendNIC2ID, map[string]*string{"lb-backend": nil}, "subnet2", "subnet3"),
+			}
+			mockInterfaceClient := az.InterfacesClient.(*mockinterfaceclient.MockInterface)
+			var fetched []string
+			mockInterfaceClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ interface{}, _, name, _ string) (network.Interface, *retry.Error) {
+					fetched = append(fetched, name)
+					return nics[name], nil
+				}).AnyTimes()
+			if !tc.expectedErr {
+				mockInterfaceClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, tc.expectedNIC, gomock.Any()).DoAndReturn(
+					func(_ interface{}, _, _ string, nic network.Interface) *retry.Error {
+						for _, ipConfig := range *nic.IPConfigurations {
+							var pools []network.BackendAddressPool
+							if ipConfig.LoadBalancerBackendAddressPools != nil {
+								pools = *ipConfig.LoadBalancerBackendAddressPools
+							}
+							if pointer.StringDeref(ipConfig.Name, "") == tc.expectedIPConfig {
+								assert.Equal(t, []network.BackendAddressPool{{ID: pointer.String(backendPoolID)}}, pools)
+							} else {
+								assert.Empty(t, pools)
+							}
+						}
+						return nil
+					})
+			}
+
+			_, _, _, _, err := az.VMSet.EnsureHostInPool(&v1.Service{}, "vm1", backendPoolID, "")
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedNICsFetched, fetched)
+		})
+	}
+}
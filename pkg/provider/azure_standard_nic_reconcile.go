@@ -0,0 +1,328 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+// ensuredBackendPool is a backend pool the nodes of availability sets have been ensured in.
+type ensuredBackendPool struct {
+	id        string
+	vmSetName string
+	nodeNames sets.Set[string]
+}
+
+// recordEnsuredBackendPool records the nodes ensured in the backend pool by EnsureHostsInPool.
+func (as *availabilitySet) recordEnsuredBackendPool(backendPoolID, vmSetName string, nodeNames sets.Set[string]) {
+	as.ensuredBackendPoolsLock.Lock()
+	defer as.ensuredBackendPoolsLock.Unlock()
+
+	if as.ensuredBackendPools == nil {
+		as.ensuredBackendPools = make(map[string]*ensuredBackendPool)
+	}
+	as.ensuredBackendPools[strings.ToLower(backendPoolID)] = &ensuredBackendPool{
+		id:        backendPoolID,
+		vmSetName: vmSetName,
+		nodeNames: nodeNames,
+	}
+}
+
+// forgetEnsuredBackendPools stops reconciling the NIC references of the backend pools.
+func (as *availabilitySet) forgetEnsuredBackendPools(backendPoolIDs []string) {
+	as.ensuredBackendPoolsLock.Lock()
+	defer as.ensuredBackendPoolsLock.Unlock()
+
+	for _, backendPoolID := range backendPoolIDs {
+		delete(as.ensuredBackendPools, strings.ToLower(backendPoolID))
+	}
+}
+
+// getEnsuredBackendPools returns a snapshot of the recorded backend pools.
+func (as *availabilitySet) getEnsuredBackendPools() []ensuredBackendPool {
+	as.ensuredBackendPoolsLock.Lock()
+	defer as.ensuredBackendPoolsLock.Unlock()
+
+	pools := make([]ensuredBackendPool, 0, len(as.ensuredBackendPools))
+	for _, pool := range as.ensuredBackendPools {
+		pools = append(pools, ensuredBackendPool{
+			id:        pool.id,
+			vmSetName: pool.vmSetName,
+			nodeNames: pool.nodeNames.Clone(),
+		})
+	}
+	return pools
+}
+
+// runAvailabilitySetNICReconcileLoop periodically repairs the backend pool references
+// of the NICs of availability set nodes.
+func (az *Cloud) runAvailabilitySetNICReconcileLoop(ctx context.Context, interval time.Duration) {
+	as, ok := az.VMSet.(*availabilitySet)
+	if !ok {
+		klog.V(2).Info("runAvailabilitySetNICReconcileLoop: the vmType is not availability set, skip running")
+		return
+	}
+
+	klog.V(2).Info("runAvailabilitySetNICReconcileLoop: started")
+	err := wait.PollUntilContextCancel(ctx, interval, false, func(ctx context.Context) (bool, error) {
+		if _, _, err := as.reconcileNICBackendPools(); err != nil {
+			klog.Warningf("runAvailabilitySetNICReconcileLoop: failed to reconcile the backend pools of NICs: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runAvailabilitySetNICReconcileLoop: stopped due to %s", err.Error())
+}
+
+// reconcileNICBackendPools compares the backend pool references of the NICs of availability
+// set nodes with the backend pools the nodes have been ensured in, and repairs the drift:
+//   - missing references on the primary ipconfig (or the first ipconfig of the IP family) are added;
+//   - references floating on the other ipconfigs are removed;
+//   - references to backend pools that no longer exist are removed.
+//
+// It returns the number of backend pool references added and removed.
+func (as *availabilitySet) reconcileNICBackendPools() (int, int, error) {
+	pools := as.getEnsuredBackendPools()
+	if len(pools) == 0 {
+		return 0, 0, nil
+	}
+
+	stalePoolIDs := sets.New[string]()
+	activePools := make([]ensuredBackendPool, 0, len(pools))
+	for _, pool := range pools {
+		exists, err := as.backendPoolExists(pool.id)
+		if err != nil {
+			return 0, 0, err
+		}
+		if exists {
+			activePools = append(activePools, pool)
+			continue
+		}
+		klog.V(2).Infof("reconcileNICBackendPools: backend pool %s no longer exists", pool.id)
+		stalePoolIDs.Insert(strings.ToLower(pool.id))
+	}
+
+	clusterNodeNames, err := as.GetNodeNames()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Collect the nodes referenced by the recorded backend pools.
+	nodeNames := sets.New[string]()
+	for _, pool := range pools {
+		nodeNames = nodeNames.Union(pool.nodeNames)
+	}
+
+	var added, removed int
+	var errs []error
+	for _, nodeName := range sets.List(nodeNames) {
+		if !clusterNodeNames.Has(nodeName) {
+			continue
+		}
+		shouldExclude, err := as.ShouldNodeExcludedFromLoadBalancer(nodeName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if shouldExclude {
+			continue
+		}
+
+		nodeAdded, nodeRemoved, err := as.reconcileNodeNICBackendPools(nodeName, activePools, stalePoolIDs)
+		if err != nil {
+			klog.Errorf("reconcileNICBackendPools: failed to reconcile the NIC of node %s: %v", nodeName, err)
+			errs = append(errs, err)
+			continue
+		}
+		added += nodeAdded
+		removed += nodeRemoved
+	}
+
+	metrics.ObserveNICBackendPoolRepairs("add", added)
+	metrics.ObserveNICBackendPoolRepairs("remove", removed)
+
+	if len(errs) == 0 {
+		// The stale backend pools are cleaned up from all the NICs.
+		as.forgetEnsuredBackendPools(sets.List(stalePoolIDs))
+	}
+	return added, removed, utilerrors.NewAggregate(errs)
+}
+
+// backendPoolExists returns true if the backend pool exists on its load balancer.
+func (as *availabilitySet) backendPoolExists(backendPoolID string) (bool, error) {
+	lbName, err := getLBNameFromBackendPoolID(backendPoolID)
+	if err != nil {
+		return false, err
+	}
+	lb, exists, err := as.getAzureLoadBalancer(lbName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return false, err
+	}
+	if !exists || lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+		return false, nil
+	}
+	for _, bp := range *lb.BackendAddressPools {
+		if strings.EqualFold(pointer.StringDeref(bp.ID, ""), backendPoolID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reconcileNodeNICBackendPools repairs the backend pool references of the NIC of the node joining the backend pools.
+func (as *availabilitySet) reconcileNodeNICBackendPools(nodeName string, pools []ensuredBackendPool, stalePoolIDs sets.Set[string]) (int, int, error) {
+	vmName := mapNodeNameToVMName(types.NodeName(nodeName))
+	nic, vmasID, ipConfigSelector, err := as.getBackendPoolInterfaceWithVMSet(vmName, "")
+	if err != nil {
+		if errors.Is(err, errNotInVMSet) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	if nic.ProvisioningState == consts.NicFailedState {
+		klog.Warningf("reconcileNodeNICBackendPools skips node %s because its primary nic %s is in Failed state", nodeName, pointer.StringDeref(nic.Name, ""))
+		return 0, 0, nil
+	}
+	if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil {
+		return 0, 0, nil
+	}
+	vmasName, err := getAvailabilitySetNameByID(vmasID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ipConfigs := *nic.IPConfigurations
+	// desired is the backend pools expected on each ipconfig, keyed by the index of the ipconfig.
+	// desiredIPConfigIndex maps the lower-cased ID of the backend pools to the index.
+	desired := make(map[int][]string)
+	desiredIPConfigIndex := make(map[string]int)
+	for _, pool := range pools {
+		if !pool.nodeNames.Has(nodeName) {
+			continue
+		}
+		// The backend pools of the basic load balancer only contain the nodes of the vmSet.
+		if !as.useStandardLoadBalancer() && pool.vmSetName != "" && !strings.EqualFold(vmasName, pool.vmSetName) {
+			continue
+		}
+		idx, err := as.getNICBackendPoolIPConfigIndex(nic, pool.id, ipConfigSelector)
+		if err != nil {
+			return 0, 0, err
+		}
+		desired[idx] = append(desired[idx], pool.id)
+		desiredIPConfigIndex[strings.ToLower(pool.id)] = idx
+	}
+
+	var added, removed int
+	for i := range ipConfigs {
+		if ipConfigs[i].InterfaceIPConfigurationPropertiesFormat == nil {
+			continue
+		}
+		var backendPools []network.BackendAddressPool
+		if ipConfigs[i].LoadBalancerBackendAddressPools != nil {
+			backendPools = *ipConfigs[i].LoadBalancerBackendAddressPools
+		}
+
+		newBackendPools := make([]network.BackendAddressPool, 0, len(backendPools))
+		existingPoolIDs := sets.New[string]()
+		for _, bp := range backendPools {
+			id := strings.ToLower(pointer.StringDeref(bp.ID, ""))
+			idx, isDesired := desiredIPConfigIndex[id]
+			if stalePoolIDs.Has(id) || (isDesired && idx != i) {
+				klog.V(2).Infof("reconcileNodeNICBackendPools: removing backend pool %s from ipconfig %s of nic %s", id, pointer.StringDeref(ipConfigs[i].Name, ""), pointer.StringDeref(nic.Name, ""))
+				removed++
+				continue
+			}
+			existingPoolIDs.Insert(id)
+			newBackendPools = append(newBackendPools, bp)
+		}
+
+		for _, poolID := range desired[i] {
+			if existingPoolIDs.Has(strings.ToLower(poolID)) {
+				continue
+			}
+			if as.useStandardLoadBalancer() && len(newBackendPools) > 0 {
+				// The same network interface couldn't be added to more than one load balancer of the same type.
+				ids := make([]string, 0, len(newBackendPools))
+				for _, bp := range newBackendPools {
+					if bp.ID != nil {
+						ids = append(ids, *bp.ID)
+					}
+				}
+				isSameLB, oldLBName, err := isBackendPoolOnSameLB(poolID, ids)
+				if err != nil {
+					return 0, 0, err
+				}
+				if !isSameLB {
+					klog.V(4).Infof("reconcileNodeNICBackendPools: node %q has already been added to LB %q, omit adding it to backend pool %s", nodeName, oldLBName, poolID)
+					continue
+				}
+			}
+			klog.V(2).Infof("reconcileNodeNICBackendPools: adding backend pool %s to ipconfig %s of nic %s", poolID, pointer.StringDeref(ipConfigs[i].Name, ""), pointer.StringDeref(nic.Name, ""))
+			newBackendPools = append(newBackendPools, network.BackendAddressPool{ID: pointer.String(poolID)})
+			added++
+		}
+		ipConfigs[i].LoadBalancerBackendAddressPools = &newBackendPools
+	}
+
+	if added == 0 && removed == 0 {
+		return 0, 0, nil
+	}
+
+	nicResourceGroup, err := extractResourceGroupByNicID(pointer.StringDeref(nic.ID, ""))
+	if err != nil {
+		nicResourceGroup = as.ResourceGroup
+	}
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	klog.V(2).Infof("reconcileNodeNICBackendPools begins to CreateOrUpdate for NIC(%s, %s): %d added, %d removed", nicResourceGroup, pointer.StringDeref(nic.Name, ""), added, removed)
+	rerr := as.InterfacesClient.CreateOrUpdate(ctx, nicResourceGroup, pointer.StringDeref(nic.Name, ""), nic)
+	if rerr != nil {
+		return 0, 0, fmt.Errorf("failed to update nic %s: %w", pointer.StringDeref(nic.Name, ""), rerr.Error())
+	}
+	return added, removed, nil
+}
+
+// getNICBackendPoolIPConfigIndex returns the index of the ipconfig which should join the backend pool.
+func (as *availabilitySet) getNICBackendPoolIPConfigIndex(nic network.Interface, backendPoolID string, ipConfigSelector backendIPConfigSelector) (int, error) {
+	ipConfig, err := selectBackendPoolIPConfig(nic, backendPoolID, as.ipv6DualStackEnabled, ipConfigSelector)
+	if err != nil {
+		return -1, err
+	}
+	for i, c := range *nic.IPConfigurations {
+		if strings.EqualFold(pointer.StringDeref(c.ID, ""), pointer.StringDeref(ipConfig.ID, "")) &&
+			strings.EqualFold(pointer.StringDeref(c.Name, ""), pointer.StringDeref(ipConfig.Name, "")) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("failed to find the ipconfig %s of nic %s", pointer.StringDeref(ipConfig.Name, ""), pointer.StringDeref(nic.Name, ""))
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient/mockinterfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestReconcileNICBackendPools(t *testing.T) {
+	const (
+		nicID       = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic1"
+		pool1ID     = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb1/backendAddressPools/pool1"
+		stalePoolID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb1/backendAddressPools/pool2"
+		goneLBPool  = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb2/backendAddressPools/pool3"
+	)
+
+	buildNIC := func(primaryPools, secondaryPools []string) network.Interface {
+		toPools := func(ids []string) *[]network.BackendAddressPool {
+			pools := make([]network.BackendAddressPool, 0, len(ids))
+			for _, id := range ids {
+				pools = append(pools, network.BackendAddressPool{ID: pointer.String(id)})
+			}
+			return &pools
+		}
+		return network.Interface{
+			ID:   pointer.String(nicID),
+			Name: pointer.String("nic1"),
+			InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+				ProvisioningState: network.ProvisioningStateSucceeded,
+				IPConfigurations: &[]network.InterfaceIPConfiguration{
+					{
+						ID:   pointer.String(nicID + "/ipConfigurations/ipconfig1"),
+						Name: pointer.String("ipconfig1"),
+						InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+							Primary:                         pointer.Bool(true),
+							LoadBalancerBackendAddressPools: toPools(primaryPools),
+						},
+					},
+					{
+						ID:   pointer.String(nicID + "/ipConfigurations/ipconfig2"),
+						Name: pointer.String("ipconfig2"),
+						InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+							Primary:                         pointer.Bool(false),
+							LoadBalancerBackendAddressPools: toPools(secondaryPools),
+						},
+					},
+				},
+			},
+		}
+	}
+	poolIDs := func(config network.InterfaceIPConfiguration) []string {
+		ids := []string{}
+		for _, pool := range *config.LoadBalancerBackendAddressPools {
+			ids = append(ids, *pool.ID)
+		}
+		return ids
+	}
+
+	for _, tc := range []struct {
+		description       string
+		ensuredPools      []string
+		existingNIC       network.Interface
+		expectedAdded     int
+		expectedRemoved   int
+		expectedPrimary   []string
+		expectedSecondary []string
+		expectedRemaining []string
+	}{
+		{
+			description:       "should do nothing if the references are in sync",
+			ensuredPools:      []string{pool1ID},
+			existingNIC:       buildNIC([]string{pool1ID}, nil),
+			expectedRemaining: []string{pool1ID},
+		},
+		{
+			description:       "should add the missing reference to the primary ipconfig",
+			ensuredPools:      []string{pool1ID},
+			existingNIC:       buildNIC(nil, nil),
+			expectedAdded:     1,
+			expectedPrimary:   []string{pool1ID},
+			expectedSecondary: []string{},
+			expectedRemaining: []string{pool1ID},
+		},
+		{
+			description:       "should move the reference floating on the secondary ipconfig and remove stale references",
+			ensuredPools:      []string{pool1ID, stalePoolID, goneLBPool},
+			existingNIC:       buildNIC([]string{goneLBPool}, []string{pool1ID, stalePoolID}),
+			expectedAdded:     1,
+			expectedRemoved:   3,
+			expectedPrimary:   []string{pool1ID},
+			expectedSecondary: []string{},
+			expectedRemaining: []string{pool1ID},
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			az.nodeInformerSynced = func() bool { return true }
+			az.nodeNames = sets.New("vm1")
+			as := az.VMSet.(*availabilitySet)
+			for _, id := range tc.ensuredPools {
+				as.recordEnsuredBackendPool(id, "", sets.New("vm1"))
+			}
+
+			mockLBClient := mockloadbalancerclient.NewMockInterface(ctrl)
+			mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "lb1", gomock.Any()).Return(network.LoadBalancer{
+				Name: pointer.String("lb1"),
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					BackendAddressPools: &[]network.BackendAddressPool{{ID: pointer.String(pool1ID)}},
+				},
+			}, nil).AnyTimes()
+			mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "lb2", gomock.Any()).Return(network.LoadBalancer{}, &retry.Error{HTTPStatusCode: http.StatusNotFound}).AnyTimes()
+			az.LoadBalancerClient = mockLBClient
+
+			mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+			mockVMClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "vm1", gomock.Any()).Return(buildDefaultTestVirtualMachine(asID, []string{nicID}), nil)
+			mockInterfaceClient := az.InterfacesClient.(*mockinterfaceclient.MockInterface)
+			mockInterfaceClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "nic1", gomock.Any()).Return(tc.existingNIC, nil)
+			if tc.expectedAdded+tc.expectedRemoved > 0 {
+				mockInterfaceClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, "nic1", gomock.Any()).DoAndReturn(
+					func(_ interface{}, _, _ string, nic network.Interface) *retry.Error {
+						ipConfigs := *nic.IPConfigurations
+						assert.Equal(t, tc.expectedPrimary, poolIDs(ipConfigs[0]))
+						assert.Equal(t, tc.expectedSecondary, poolIDs(ipConfigs[1]))
+						return nil
+					})
+			}
+
+			added, removed, err := as.reconcileNICBackendPools()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedAdded, added)
+			assert.Equal(t, tc.expectedRemoved, removed)
+
+			var remaining []string
+			for _, pool := range as.getEnsuredBackendPools() {
+				remaining = append(remaining, pool.id)
+			}
+			assert.ElementsMatch(t, tc.expectedRemaining, remaining)
+		})
+	}
+}
+
+func TestReconcileNICBackendPoolsSkipsExcludedNodes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.nodeInformerSynced = func() bool { return true }
+	az.nodeNames = sets.New("vm1", "vm2")
+	az.excludeLoadBalancerNodes = sets.New("vm2")
+	as := az.VMSet.(*availabilitySet)
+	poolID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb1/backendAddressPools/pool1"
+	// vm3 has been deleted from the cluster.
+	as.recordEnsuredBackendPool(poolID, "", sets.New("vm2", "vm3"))
+
+	mockLBClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "lb1", gomock.Any()).Return(network.LoadBalancer{
+		Name: pointer.String("lb1"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{{ID: pointer.String(poolID)}},
+		},
+	}, nil)
+	az.LoadBalancerClient = mockLBClient
+
+	added, removed, err := as.reconcileNICBackendPools()
+	assert.NoError(t, err)
+	assert.Zero(t, added)
+	assert.Zero(t, removed)
+}
+
+func TestEnsureBackendPoolDeletedForgetsEnsuredBackendPools(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	as := az.VMSet.(*availabilitySet)
+	as.recordEnsuredBackendPool("pool1", "", sets.New("vm1"))
+	as.recordEnsuredBackendPool("pool2", "", sets.New("vm1"))
+
+	service := getTestService("test", "TCP", nil, false, 80)
+	_, err := as.EnsureBackendPoolDeleted(&service, []string{"POOL1"}, "", &[]network.BackendAddressPool{}, true)
+	assert.NoError(t, err)
+
+	pools := as.getEnsuredBackendPools()
+	assert.Len(t, pools, 1)
+	assert.Equal(t, "pool2", pools[0].id)
+}
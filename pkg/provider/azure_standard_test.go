@@ -251,6 +251,7 @@ func TestGetLoadBalancingRuleName(t *testing.T) {
 		isInternal    bool
 		isIPv6        bool
 		useStandardLB bool
+		hashedNaming  bool
 		port          int32
 	}{
 		{
@@ -310,6 +311,27 @@ func TestGetLoadBalancingRuleName(t *testing.T) {
 			port:          9000,
 			expected:      "a257b965551374ad2b091ef3f07043ad-averylonnnngggnnnnnnnnnnnnnnnnnnn-TCP-9000-IPv6",
 		},
+		{
+			description:   "internal lb should have subnet name on the rule name in hashed naming mode",
+			subnetName:    "shortsubnet",
+			isInternal:    true,
+			useStandardLB: true,
+			hashedNaming:  true,
+			protocol:      v1.ProtocolTCP,
+			port:          9000,
+			expected:      "a257b965551374ad2b091ef3f07043ad-shortsubnet-TCP-9000",
+		},
+		{
+			description:   "internal lb should have subnet name on the rule name truncated with hash in hashed naming mode",
+			subnetName:    "averylonnnngggnnnnnnnnnnnnnnnnnnnnnngggggggggggggggggggggggggggggggggggggsubet",
+			isInternal:    true,
+			isIPv6:        true,
+			useStandardLB: true,
+			hashedNaming:  true,
+			protocol:      v1.ProtocolTCP,
+			port:          9000,
+			expected:      "a257b965551374ad2b091ef3f07043ad-averylonnnngggnnnnnnnn-1153761489-TCP-9000-IPv6",
+		},
 		{
 			description:   "external standard lb should not have subnet name on the rule name",
 			subnetName:    "shortsubnet",
@@ -357,11 +379,16 @@ func TestGetLoadBalancingRuleName(t *testing.T) {
 			} else {
 				az.Config.LoadBalancerSku = consts.LoadBalancerSkuBasic
 			}
+			az.ResourceNamingMode = ""
+			if c.hashedNaming {
+				az.ResourceNamingMode = consts.ResourceNamingModeHashed
+			}
 			svc.Annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet] = c.subnetName
 			svc.Annotations[consts.ServiceAnnotationLoadBalancerInternal] = strconv.FormatBool(c.isInternal)
 
 			loadbalancerRuleName := az.getLoadBalancerRuleName(svc, c.protocol, c.port, c.isIPv6)
 			assert.Equal(t, c.expected, loadbalancerRuleName)
+			assert.LessOrEqual(t, len(loadbalancerRuleName), consts.LoadBalancerRuleNameMaxLength)
 		})
 	}
 }
@@ -942,6 +969,30 @@ func TestIsBackendPoolIPv6(t *testing.T) {
 	}
 }
 
+func TestServiceOwnsRule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	testcases := []struct {
+		name          string
+		expectedOwned bool
+	}{
+		{"aservice1", true},
+		{"aservice1-TCP-80", true},
+		{"ASERVICE1-subnet-TCP-80-IPv6", true},
+		{"aservice10-TCP-80", false},
+		{"aservice1TCP80", false},
+		{"aservice", false},
+		{"shared-TCP-80-Internet", false},
+		{"", false},
+	}
+	for _, test := range testcases {
+		assert.Equal(t, test.expectedOwned, az.serviceOwnsRule(&svc, test.name), test.name)
+	}
+}
+
 func TestGetStandardInstanceIDByNodeName(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
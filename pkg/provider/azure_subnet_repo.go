@@ -17,15 +17,21 @@ limitations under the License.
 package provider
 
 import (
+	"fmt"
+
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 )
 
 // CreateOrUpdateSubnet invokes az.SubnetClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateSubnet(service *v1.Service, subnet network.Subnet) error {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
+	ctx = az.withServiceOperationAnnotation(ctx, service)
 
 	var rg string
 	if len(az.VnetResourceGroup) > 0 {
@@ -46,6 +52,12 @@ func (az *Cloud) CreateOrUpdateSubnet(service *v1.Service, subnet network.Subnet
 }
 
 func (az *Cloud) getSubnet(virtualNetworkName string, subnetName string) (network.Subnet, bool, error) {
+	return az.GetSubnetWithExpand(virtualNetworkName, subnetName, "")
+}
+
+// GetSubnetWithExpand gets the subnet with the referenced resources specified by expand, e.g.,
+// "ipConfigurations" returns the IP configurations using the addresses of the subnet.
+func (az *Cloud) GetSubnetWithExpand(virtualNetworkName, subnetName, expand string) (network.Subnet, bool, error) {
 	var rg string
 	if len(az.VnetResourceGroup) > 0 {
 		rg = az.VnetResourceGroup
@@ -55,7 +67,7 @@ func (az *Cloud) getSubnet(virtualNetworkName string, subnetName string) (networ
 
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
-	subnet, err := az.SubnetsClient.Get(ctx, rg, virtualNetworkName, subnetName, "")
+	subnet, err := az.SubnetsClient.Get(ctx, rg, virtualNetworkName, subnetName, expand)
 	exists, rerr := checkResourceExistsFromError(err)
 	if rerr != nil {
 		return subnet, false, rerr.Error()
@@ -66,3 +78,38 @@ func (az *Cloud) getSubnet(virtualNetworkName string, subnetName string) (networ
 	}
 	return subnet, exists, nil
 }
+
+// ListSubnets lists the subnets in the virtual network.
+func (az *Cloud) ListSubnets(virtualNetworkName string) ([]network.Subnet, error) {
+	var rg string
+	if len(az.VnetResourceGroup) > 0 {
+		rg = az.VnetResourceGroup
+	} else {
+		rg = az.ResourceGroup
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	subnets, rerr := az.SubnetsClient.List(ctx, rg, virtualNetworkName)
+	if rerr != nil {
+		return nil, rerr.Error()
+	}
+	return subnets, nil
+}
+
+// checkSubnetNATGatewayAssociation returns an error if the subnet of the nodes is not associated with a NAT gateway
+// when the outbound traffic is handled by the NAT gateway.
+func (az *Cloud) checkSubnetNATGatewayAssociation() error {
+	subnet, exists, err := az.getSubnet(az.VnetName, az.SubnetName)
+	if err != nil {
+		return fmt.Errorf("failed to get subnet %s/%s to check the NAT gateway association: %w", az.VnetName, az.SubnetName, err)
+	}
+	if !exists {
+		return fmt.Errorf("subnet %s/%s is not found, which is required to be associated with a NAT gateway when outboundType is %s", az.VnetName, az.SubnetName, consts.OutboundTypeNATGateway)
+	}
+	if subnet.SubnetPropertiesFormat == nil || subnet.NatGateway == nil || pointer.StringDeref(subnet.NatGateway.ID, "") == "" {
+		return fmt.Errorf("subnet %s/%s is not associated with a NAT gateway, which is required when outboundType is %s", az.VnetName, az.SubnetName, consts.OutboundTypeNATGateway)
+	}
+	klog.V(2).Infof("checkSubnetNATGatewayAssociation: subnet %s/%s is associated with the NAT gateway %s", az.VnetName, az.SubnetName, *subnet.NatGateway.ID)
+	return nil
+}
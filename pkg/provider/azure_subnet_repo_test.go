@@ -15,3 +15,59 @@ limitations under the License.
 */
 
 package provider
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestCheckSubnetNATGatewayAssociation(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		subnet      network.Subnet
+		rerr        *retry.Error
+		expectedErr string
+	}{
+		{
+			desc: "subnet associated with a NAT gateway should be allowed",
+			subnet: network.Subnet{
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+					NatGateway: &network.SubResource{ID: pointer.String("natgw")},
+				},
+			},
+		},
+		{
+			desc:        "subnet without NAT gateway should not be allowed",
+			subnet:      network.Subnet{SubnetPropertiesFormat: &network.SubnetPropertiesFormat{}},
+			expectedErr: "subnet vnet/subnet is not associated with a NAT gateway, which is required when outboundType is natGateway",
+		},
+		{
+			desc:        "nonexistent subnet should not be allowed",
+			rerr:        &retry.Error{HTTPStatusCode: http.StatusNotFound},
+			expectedErr: "subnet vnet/subnet is not found, which is required to be associated with a NAT gateway when outboundType is natGateway",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			az := GetTestCloud(ctrl)
+			mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+			mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", "").Return(tc.subnet, tc.rerr)
+
+			err := az.checkSubnetNATGatewayAssociation()
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// securityRuleDescriptionTemplateResource is the key of the security rule description template
+// in supportedTagTemplatePlaceholders, which is not a tag template.
+const securityRuleDescriptionTemplateResource = "securityRuleDescription"
+
+// supportedTagTemplatePlaceholders are the placeholders supported by the templates of each resource type.
+// The service placeholders are not supported by the resources shared by services.
+var supportedTagTemplatePlaceholders = map[string]sets.Set[string]{
+	consts.TagTemplateResourcePublicIPAddress: sets.New(
+		consts.TagTemplateClusterName, consts.TagTemplateServiceNamespace, consts.TagTemplateServiceName),
+	consts.TagTemplateResourceLoadBalancer: sets.New(
+		consts.TagTemplateClusterName, consts.TagTemplateNodePool),
+	consts.TagTemplateResourcePrivateLinkService: sets.New(
+		consts.TagTemplateClusterName, consts.TagTemplateServiceNamespace, consts.TagTemplateServiceName),
+	consts.TagTemplateResourceRouteTable: sets.New(
+		consts.TagTemplateClusterName),
+	securityRuleDescriptionTemplateResource: sets.New(
+		consts.TagTemplateClusterName, consts.TagTemplateServiceNamespace, consts.TagTemplateServiceName),
+}
+
+var tagTemplatePlaceholderRE = regexp.MustCompile(`\{[^{}]*\}`)
+
+// tagTemplateValues are the values of the placeholders in the tag templates.
+type tagTemplateValues struct {
+	clusterName      string
+	serviceNamespace string
+	serviceName      string
+	nodePool         string
+}
+
+func newServiceTagTemplateValues(clusterName string, service *v1.Service) tagTemplateValues {
+	return tagTemplateValues{
+		clusterName:      clusterName,
+		serviceNamespace: service.Namespace,
+		serviceName:      service.Name,
+	}
+}
+
+// validateTagTemplates returns an error if a tag template targets an unknown resource type,
+// or uses a placeholder not supported by the resource type.
+func validateTagTemplates(tagTemplates map[string]map[string]string, securityRuleDescriptionTemplate string) error {
+	for resourceType, tags := range tagTemplates {
+		if resourceType == securityRuleDescriptionTemplateResource {
+			return fmt.Errorf("tagTemplates of resource type %s is not supported, please use securityRuleDescriptionTemplate instead", resourceType)
+		}
+		placeholders, ok := supportedTagTemplatePlaceholders[resourceType]
+		if !ok {
+			return fmt.Errorf("tagTemplates of resource type %s is not supported, supported resource types are %v",
+				resourceType, []string{consts.TagTemplateResourcePublicIPAddress, consts.TagTemplateResourceLoadBalancer,
+					consts.TagTemplateResourcePrivateLinkService, consts.TagTemplateResourceRouteTable})
+		}
+		for key, value := range tags {
+			if strings.TrimSpace(key) == "" {
+				return fmt.Errorf("tagTemplates of resource type %s has an empty tag key", resourceType)
+			}
+			for _, placeholder := range tagTemplatePlaceholderRE.FindAllString(value, -1) {
+				if !placeholders.Has(placeholder) {
+					return fmt.Errorf("placeholder %s in tag %s of tagTemplates of resource type %s is not supported, supported placeholders are %v",
+						placeholder, key, resourceType, sets.List(placeholders))
+				}
+			}
+		}
+	}
+
+	placeholders := supportedTagTemplatePlaceholders[securityRuleDescriptionTemplateResource]
+	for _, placeholder := range tagTemplatePlaceholderRE.FindAllString(securityRuleDescriptionTemplate, -1) {
+		if !placeholders.Has(placeholder) {
+			return fmt.Errorf("placeholder %s in securityRuleDescriptionTemplate is not supported, supported placeholders are %v",
+				placeholder, sets.List(placeholders))
+		}
+	}
+	return nil
+}
+
+// renderTagTemplate replaces the placeholders in the template by the values.
+func renderTagTemplate(template string, values tagTemplateValues) string {
+	return strings.NewReplacer(
+		consts.TagTemplateClusterName, values.clusterName,
+		consts.TagTemplateServiceNamespace, values.serviceNamespace,
+		consts.TagTemplateServiceName, values.serviceName,
+		consts.TagTemplateNodePool, values.nodePool,
+	).Replace(template)
+}
+
+// hasConfigTags returns true if any tag is configured for the resource type.
+func (az *Cloud) hasConfigTags(resourceType string) bool {
+	return az.Tags != "" || len(az.TagsMap) > 0 || len(az.TagTemplates[resourceType]) > 0
+}
+
+// getConfigTags returns the tags configured by `Tags` and `TagsMap`, overridden by the rendered tag templates of the
+// resource type.
+func (az *Cloud) getConfigTags(resourceType string, values tagTemplateValues) map[string]*string {
+	configTags := parseTags(az.Tags, az.TagsMap)
+	for k, v := range az.TagTemplates[resourceType] {
+		value := renderTagTemplate(v, values)
+		if found, key := findKeyInMapCaseInsensitive(configTags, k); found {
+			delete(configTags, key)
+		}
+		configTags[strings.TrimSpace(k)] = pointer.String(value)
+	}
+	return configTags
+}
+
+// getSecurityRuleDescription returns the description of the security rules of the service, or nil if
+// SecurityRuleDescriptionTemplate is not set.
+func (az *Cloud) getSecurityRuleDescription(clusterName string, service *v1.Service) *string {
+	if az.SecurityRuleDescriptionTemplate == "" {
+		return nil
+	}
+	return pointer.String(renderTagTemplate(az.SecurityRuleDescriptionTemplate, newServiceTagTemplateValues(clusterName, service)))
+}
+
+// getLoadBalancerNodePool returns the primary VMSet of the load balancer.
+func (az *Cloud) getLoadBalancerNodePool(lbName, clusterName string) string {
+	if az.useMultipleStandardLoadBalancers() {
+		lbConfigName := strings.TrimSuffix(strings.ToLower(lbName), consts.InternalLoadBalancerNameSuffix)
+		for _, multiSLBConfig := range az.MultipleStandardLoadBalancerConfigurations {
+			if strings.EqualFold(multiSLBConfig.Name, lbConfigName) {
+				return multiSLBConfig.PrimaryVMSet
+			}
+		}
+	}
+	return az.mapLoadBalancerNameToVMSet(lbName, clusterName)
+}
+
+// getServiceResourceTags parses the tags in ServiceAnnotationAzureResourceTags, and returns an error if the tags are
+// malformed or exceed the limits of Azure tags.
+func getServiceResourceTags(service *v1.Service) (map[string]*string, error) {
+	value, found := service.Annotations[consts.ServiceAnnotationAzureResourceTags]
+	if !found || strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	tags := make(map[string]*string)
+	for _, kv := range strings.Split(value, consts.TagsDelimiter) {
+		res := strings.Split(kv, consts.TagKeyValueDelimiter)
+		if len(res) != 2 {
+			return nil, fmt.Errorf("%s: tag %q is not in the format of key=value", consts.ServiceAnnotationAzureResourceTags, kv)
+		}
+		k, v := strings.TrimSpace(res[0]), strings.TrimSpace(res[1])
+		switch {
+		case k == "":
+			return nil, fmt.Errorf("%s: tag %q has an empty key", consts.ServiceAnnotationAzureResourceTags, kv)
+		case len(k) > consts.TagKeyMaxLength:
+			return nil, fmt.Errorf("%s: the key of tag %q is longer than %d characters", consts.ServiceAnnotationAzureResourceTags, k, consts.TagKeyMaxLength)
+		case len(v) > consts.TagValueMaxLength:
+			return nil, fmt.Errorf("%s: the value of tag %q is longer than %d characters", consts.ServiceAnnotationAzureResourceTags, k, consts.TagValueMaxLength)
+		case strings.ContainsAny(k, `<>%&\?/`):
+			return nil, fmt.Errorf("%s: the key of tag %q contains the characters not allowed by Azure: <>%%&\\?/", consts.ServiceAnnotationAzureResourceTags, k)
+		case strings.HasPrefix(strings.ToLower(k), consts.ReservedTagKeyPrefix):
+			return nil, fmt.Errorf("%s: the key of tag %q has the reserved prefix %s", consts.ServiceAnnotationAzureResourceTags, k, consts.ReservedTagKeyPrefix)
+		}
+		if found, _ := findKeyInMapCaseInsensitive(tags, k); found {
+			return nil, fmt.Errorf("%s: tag %q is duplicated", consts.ServiceAnnotationAzureResourceTags, k)
+		}
+		tags[k] = pointer.String(v)
+	}
+	if len(tags) > consts.MaxTagsPerResource {
+		return nil, fmt.Errorf("%s: %d tags exceed the limit of %d tags per resource", consts.ServiceAnnotationAzureResourceTags, len(tags), consts.MaxTagsPerResource)
+	}
+	return tags, nil
+}
+
+// getServiceResourceTagsKeys returns the keys of the tags applied by ServiceAnnotationAzureResourceTags recorded in
+// the tags of the resource, and the keys of the tags holding the record. The record is split into the chunks of at most
+// TagValueMaxLength characters stored in ServiceResourceTagsKey, ServiceResourceTagsKey-1, ServiceResourceTagsKey-2, etc.
+func getServiceResourceTagsKeys(tags map[string]*string) (keys, recordKeys []string) {
+	var record strings.Builder
+	for i := 0; ; i++ {
+		found, key := findKeyInMapCaseInsensitive(tags, getServiceResourceTagsRecordKey(i))
+		if !found {
+			break
+		}
+		record.WriteString(pointer.StringDeref(tags[key], ""))
+		recordKeys = append(recordKeys, key)
+	}
+	for _, k := range strings.Split(record.String(), consts.TagsDelimiter) {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys, recordKeys
+}
+
+// getServiceResourceTagsRecordKey returns the key of the tag holding the i-th chunk of the record of the keys of the
+// tags applied by ServiceAnnotationAzureResourceTags.
+func getServiceResourceTagsRecordKey(i int) string {
+	if i == 0 {
+		return consts.ServiceResourceTagsKey
+	}
+	return fmt.Sprintf("%s-%d", consts.ServiceResourceTagsKey, i)
+}
+
+// reconcileServiceResourceTags removes the tags applied by ServiceAnnotationAzureResourceTags but no longer in the
+// annotation from the current tags of the resource, unless they are still in the new tags. The keys of the tags from
+// the annotation are recorded in the new tags, split across several tags if they do not fit in the value of one tag.
+// It returns true if the current tags are changed.
+func reconcileServiceResourceTags(currentTags, newTags, serviceTags map[string]*string) bool {
+	var changed bool
+	recordedKeys, recordKeys := getServiceResourceTagsKeys(currentTags)
+	for _, k := range recordedKeys {
+		if found, _ := findKeyInMapCaseInsensitive(newTags, k); found {
+			continue
+		}
+		if found, existingKey := findKeyInMapCaseInsensitive(currentTags, k); found {
+			klog.V(2).Infof("reconcileServiceResourceTags: delete tag %s removed from the service annotation", existingKey)
+			delete(currentTags, existingKey)
+			changed = true
+		}
+	}
+
+	var record string
+	if len(serviceTags) > 0 {
+		keys := make([]string, 0, len(serviceTags))
+		for k := range serviceTags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		record = strings.Join(keys, consts.TagsDelimiter)
+	}
+	var chunks int
+	for ; len(record) > 0; chunks++ {
+		n := len(record)
+		if n > consts.TagValueMaxLength {
+			n = consts.TagValueMaxLength
+		}
+		newTags[getServiceResourceTagsRecordKey(chunks)] = pointer.String(record[:n])
+		record = record[n:]
+	}
+	// the chunks no longer needed are removed
+	for i := chunks; i < len(recordKeys); i++ {
+		delete(currentTags, recordKeys[i])
+		changed = true
+	}
+	return changed
+}
+
+// validateResourceTags returns an error if the tags exceed the limits of Azure tags, so that the resource is not
+// updated with the tags rejected by Azure.
+func validateResourceTags(tags map[string]*string) error {
+	if len(tags) > consts.MaxTagsPerResource {
+		return fmt.Errorf("%d tags exceed the limit of %d tags per resource", len(tags), consts.MaxTagsPerResource)
+	}
+	for k, v := range tags {
+		if len(k) > consts.TagKeyMaxLength {
+			return fmt.Errorf("the key of tag %q is longer than %d characters", k, consts.TagKeyMaxLength)
+		}
+		if len(pointer.StringDeref(v, "")) > consts.TagValueMaxLength {
+			return fmt.Errorf("the value of tag %q is longer than %d characters", k, consts.TagValueMaxLength)
+		}
+	}
+	return nil
+}
+
+// ensureResourceTagsValid validates the tags of the resource of the service before it is updated, and emits an event
+// on the service if the tags exceed the limits of Azure tags.
+func (az *Cloud) ensureResourceTagsValid(service *v1.Service, resourceName string, tags map[string]*string) error {
+	if err := validateResourceTags(tags); err != nil {
+		err = fmt.Errorf("invalid tags of resource %s: %w", resourceName, err)
+		az.Event(service, v1.EventTypeWarning, "InvalidResourceTags", err.Error())
+		return err
+	}
+	return nil
+}
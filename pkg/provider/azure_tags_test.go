@@ -0,0 +1,391 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestValidateTagTemplates(t *testing.T) {
+	for _, tc := range []struct {
+		desc                            string
+		tagTemplates                    map[string]map[string]string
+		securityRuleDescriptionTemplate string
+		expectedErr                     bool
+	}{
+		{
+			desc: "supported placeholders should be accepted",
+			tagTemplates: map[string]map[string]string{
+				consts.TagTemplateResourcePublicIPAddress:    {"owner": "{clusterName}/{serviceNamespace}/{serviceName}"},
+				consts.TagTemplateResourceLoadBalancer:       {"pool": "{clusterName}-{nodePool}"},
+				consts.TagTemplateResourcePrivateLinkService: {"owner": "{serviceNamespace}/{serviceName}"},
+				consts.TagTemplateResourceRouteTable:         {"cluster": "{clusterName}", "static": "value"},
+			},
+			securityRuleDescriptionTemplate: "{clusterName}: {serviceNamespace}/{serviceName}",
+		},
+		{
+			desc:         "unknown resource types should be rejected",
+			tagTemplates: map[string]map[string]string{"virtualMachine": {"a": "b"}},
+			expectedErr:  true,
+		},
+		{
+			desc:         "service placeholders should be rejected for the load balancers",
+			tagTemplates: map[string]map[string]string{consts.TagTemplateResourceLoadBalancer: {"owner": "{serviceName}"}},
+			expectedErr:  true,
+		},
+		{
+			desc:         "unknown placeholders should be rejected",
+			tagTemplates: map[string]map[string]string{consts.TagTemplateResourceRouteTable: {"a": "{unknown}"}},
+			expectedErr:  true,
+		},
+		{
+			desc:         "empty tag keys should be rejected",
+			tagTemplates: map[string]map[string]string{consts.TagTemplateResourceRouteTable: {" ": "b"}},
+			expectedErr:  true,
+		},
+		{
+			desc:                            "unsupported placeholders in the security rule description should be rejected",
+			securityRuleDescriptionTemplate: "{nodePool}",
+			expectedErr:                     true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := validateTagTemplates(tc.tagTemplates, tc.securityRuleDescriptionTemplate)
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+		})
+	}
+}
+
+func TestGetConfigTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.Tags = "a=b,Owner=config"
+	az.TagTemplates = map[string]map[string]string{
+		consts.TagTemplateResourcePublicIPAddress: {"owner": "{clusterName}/{serviceNamespace}/{serviceName}"},
+	}
+
+	tags := az.getConfigTags(consts.TagTemplateResourcePublicIPAddress, tagTemplateValues{
+		clusterName:      testClusterName,
+		serviceNamespace: "ns",
+		serviceName:      "svc",
+	})
+	assert.Equal(t, map[string]*string{"a": pointer.String("b"), "owner": pointer.String("testCluster/ns/svc")}, tags)
+
+	tags = az.getConfigTags(consts.TagTemplateResourceRouteTable, tagTemplateValues{clusterName: testClusterName})
+	assert.Equal(t, map[string]*string{"a": pointer.String("b"), "Owner": pointer.String("config")}, tags)
+}
+
+func TestEnsureTaggedWithTagTemplates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.SystemTags = "user"
+	az.TagTemplates = map[string]map[string]string{
+		consts.TagTemplateResourcePublicIPAddress:    {"owner": "{serviceNamespace}/{serviceName}"},
+		consts.TagTemplateResourceLoadBalancer:       {"pool": "{clusterName}-{nodePool}"},
+		consts.TagTemplateResourcePrivateLinkService: {"owner": "{clusterName}/{serviceName}"},
+		consts.TagTemplateResourceRouteTable:         {"cluster": "{clusterName}"},
+	}
+	service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+
+	t.Run("public IPs should be tagged by the template without deleting the system tags", func(t *testing.T) {
+		pip := network.PublicIPAddress{Tags: map[string]*string{"user": pointer.String("keep"), "stale": pointer.String("x")}}
+		assert.True(t, az.ensurePIPTagged(testClusterName, &service, &pip))
+		assert.Equal(t, map[string]*string{"user": pointer.String("keep"), "owner": pointer.String("default/svc1")}, pip.Tags)
+		assert.False(t, az.ensurePIPTagged(testClusterName, &service, &pip))
+	})
+
+	t.Run("load balancers should be tagged by the template of the node pool", func(t *testing.T) {
+		lb := network.LoadBalancer{Name: pointer.String("pool1-internal")}
+		assert.True(t, az.ensureLoadBalancerTagged(testClusterName, &lb))
+		assert.Equal(t, map[string]*string{"pool": pointer.String("testCluster-pool1")}, lb.Tags)
+
+		lb = network.LoadBalancer{Name: pointer.String(testClusterName)}
+		assert.True(t, az.ensureLoadBalancerTagged(testClusterName, &lb))
+		assert.Equal(t, map[string]*string{"pool": pointer.String("testCluster-as")}, lb.Tags)
+	})
+
+	t.Run("load balancers should be tagged by the primary VMSet of the multiple standard load balancer configuration", func(t *testing.T) {
+		az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+		az.MultipleStandardLoadBalancerConfigurations = []MultipleStandardLoadBalancerConfiguration{
+			{Name: "lb1", MultipleStandardLoadBalancerConfigurationSpec: MultipleStandardLoadBalancerConfigurationSpec{PrimaryVMSet: "vmss1"}},
+		}
+		defer func() {
+			az.LoadBalancerSku = ""
+			az.MultipleStandardLoadBalancerConfigurations = nil
+		}()
+		lb := network.LoadBalancer{Name: pointer.String("lb1-internal"), Tags: map[string]*string{"pool": pointer.String("old")}}
+		assert.True(t, az.ensureLoadBalancerTagged(testClusterName, &lb))
+		assert.Equal(t, map[string]*string{"pool": pointer.String("testCluster-vmss1")}, lb.Tags)
+	})
+
+	t.Run("private link services should be tagged by the template", func(t *testing.T) {
+		pls := network.PrivateLinkService{}
+		clusterName := testClusterName
+		assert.True(t, az.reconcilePLSTags(&pls, &clusterName, &service))
+		assert.Equal(t, pointer.String("testCluster/svc1"), pls.Tags["owner"])
+	})
+
+	t.Run("route tables should be tagged by the template", func(t *testing.T) {
+		rt := network.RouteTable{}
+		tags, changed := az.ensureRouteTableTagged(testClusterName, &rt)
+		assert.True(t, changed)
+		assert.Equal(t, map[string]*string{"cluster": pointer.String("testCluster")}, tags)
+	})
+}
+
+func TestReconcileSecurityRulesDescription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.SecurityRuleDescriptionTemplate = "{clusterName}: {serviceNamespace}/{serviceName}"
+	service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	ruleName := az.getSecurityRuleName(&service, service.Spec.Ports[0], "Internet", false)
+	newRule := func(description *string) network.SecurityRule {
+		return network.SecurityRule{
+			Name: pointer.String(ruleName),
+			SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+				Protocol:                 network.SecurityRuleProtocolTCP,
+				SourcePortRange:          pointer.String("*"),
+				DestinationPortRange:     pointer.String("80"),
+				SourceAddressPrefix:      pointer.String("Internet"),
+				DestinationAddressPrefix: pointer.String("1.2.3.4"),
+				Access:                   network.SecurityRuleAccessAllow,
+				Direction:                network.SecurityRuleDirectionInbound,
+				Priority:                 pointer.Int32(500),
+				Description:              description,
+			},
+		}
+	}
+	expectedRule := newRule(az.getSecurityRuleDescription(testClusterName, &service))
+	assert.Equal(t, "testCluster: default/svc1", *expectedRule.Description)
+
+	existingRules := []network.SecurityRule{newRule(pointer.String("old"))}
+	sg := network.SecurityGroup{
+		Name: pointer.String("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &existingRules,
+		},
+	}
+	dirty, updatedRules, err := az.reconcileSecurityRules(sg, &service, "default/svc1", true, []network.SecurityRule{expectedRule}, service.Spec.Ports, nil, nil)
+	assert.NoError(t, err)
+	assert.True(t, dirty)
+	assert.Equal(t, []network.SecurityRule{expectedRule}, updatedRules)
+
+	sg.SecurityRules = &updatedRules
+	dirty, _, err = az.reconcileSecurityRules(sg, &service, "default/svc1", true, []network.SecurityRule{expectedRule}, service.Spec.Ports, nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, dirty)
+}
+
+func TestGetServiceResourceTags(t *testing.T) {
+	for _, tc := range []struct {
+		desc         string
+		annotation   string
+		expectedTags map[string]*string
+		expectedErr  bool
+	}{
+		{
+			desc: "no tags should be returned if the annotation is not set",
+		},
+		{
+			desc:         "tags should be parsed",
+			annotation:   "a=b, c = d,e=",
+			expectedTags: map[string]*string{"a": pointer.String("b"), "c": pointer.String("d"), "e": pointer.String("")},
+		},
+		{
+			desc:        "malformed tags should be rejected",
+			annotation:  "a=b,c",
+			expectedErr: true,
+		},
+		{
+			desc:        "empty keys should be rejected",
+			annotation:  "=b",
+			expectedErr: true,
+		},
+		{
+			desc:        "duplicated keys should be rejected",
+			annotation:  "a=b,A=c",
+			expectedErr: true,
+		},
+		{
+			desc:        "keys with invalid characters should be rejected",
+			annotation:  "a/b=c",
+			expectedErr: true,
+		},
+		{
+			desc:        "reserved keys should be rejected",
+			annotation:  consts.ClusterNameKey + "=c",
+			expectedErr: true,
+		},
+		{
+			desc:        "too long values should be rejected",
+			annotation:  "a=" + strings.Repeat("b", consts.TagValueMaxLength+1),
+			expectedErr: true,
+		},
+		{
+			desc: "too many tags should be rejected",
+			annotation: func() string {
+				var tags []string
+				for i := 0; i <= consts.MaxTagsPerResource; i++ {
+					tags = append(tags, fmt.Sprintf("k%d=v", i))
+				}
+				return strings.Join(tags, ",")
+			}(),
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			service := getTestService("svc1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationAzureResourceTags: tc.annotation}, false, 80)
+			tags, err := getServiceResourceTags(&service)
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+			assert.Equal(t, tc.expectedTags, tags)
+		})
+	}
+}
+
+func TestEnsureTaggedWithServiceResourceTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.Tags = "a=config"
+	service := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationAzureResourceTags: "a=service,b=c,d=e",
+		consts.ServiceAnnotationAzurePIPTags:      "d=pip",
+	}, false, 80)
+
+	pip := network.PublicIPAddress{Tags: map[string]*string{"user": pointer.String("keep")}}
+	assert.True(t, az.ensurePIPTagged(testClusterName, &service, &pip))
+	assert.Equal(t, map[string]*string{
+		"user":                        pointer.String("keep"),
+		"a":                           pointer.String("service"),
+		"b":                           pointer.String("c"),
+		"d":                           pointer.String("pip"),
+		consts.ServiceResourceTagsKey: pointer.String("a,b,d"),
+	}, pip.Tags)
+
+	pls := network.PrivateLinkService{}
+	clusterName := testClusterName
+	assert.True(t, az.reconcilePLSTags(&pls, &clusterName, &service))
+	assert.Equal(t, pointer.String("service"), pls.Tags["a"])
+	assert.Equal(t, pointer.String("e"), pls.Tags["d"])
+
+	// the tags removed from the annotation are removed from the resources even if SystemTags is not set
+	service.Annotations[consts.ServiceAnnotationAzureResourceTags] = "b=f"
+	assert.True(t, az.ensurePIPTagged(testClusterName, &service, &pip))
+	assert.Equal(t, map[string]*string{
+		"user":                        pointer.String("keep"),
+		"a":                           pointer.String("config"),
+		"b":                           pointer.String("f"),
+		"d":                           pointer.String("pip"),
+		consts.ServiceResourceTagsKey: pointer.String("b"),
+	}, pip.Tags)
+	assert.False(t, az.ensurePIPTagged(testClusterName, &service, &pip))
+
+	delete(service.Annotations, consts.ServiceAnnotationAzureResourceTags)
+	assert.True(t, az.reconcilePLSTags(&pls, &clusterName, &service))
+	assert.Equal(t, map[string]*string{
+		"a":                       pointer.String("config"),
+		consts.ClusterNameTagKey:  pointer.String(testClusterName),
+		consts.OwnerServiceTagKey: pointer.String("default/svc1"),
+	}, pls.Tags)
+}
+
+func TestReconcileServiceResourceTagsSplitsRecord(t *testing.T) {
+	serviceTags := make(map[string]*string)
+	var keys []string
+	for i := 0; i < 40; i++ {
+		k := fmt.Sprintf("%s%02d", strings.Repeat("k", 20), i)
+		serviceTags[k] = pointer.String("v")
+		keys = append(keys, k)
+	}
+	currentTags := map[string]*string{consts.ServiceResourceTagsKey: pointer.String("legacy")}
+	newTags := make(map[string]*string)
+	reconcileServiceResourceTags(currentTags, newTags, serviceTags)
+	assert.NoError(t, validateResourceTags(newTags))
+	assert.Len(t, newTags, 4)
+	recorded, _ := getServiceResourceTagsKeys(newTags)
+	assert.Equal(t, keys, recorded)
+
+	// the keys removed from the annotation are removed with the chunks of the record no longer needed
+	for k, v := range newTags {
+		currentTags[k] = v
+	}
+	for _, k := range keys {
+		currentTags[k] = pointer.String("v")
+	}
+	serviceTags = map[string]*string{keys[0]: pointer.String("v")}
+	newTags = map[string]*string{keys[0]: pointer.String("v")}
+	assert.True(t, reconcileServiceResourceTags(currentTags, newTags, serviceTags))
+	assert.Len(t, currentTags, 2)
+	assert.Contains(t, currentTags, keys[0])
+	assert.Contains(t, currentTags, consts.ServiceResourceTagsKey)
+	assert.Equal(t, map[string]*string{
+		keys[0]:                       pointer.String("v"),
+		consts.ServiceResourceTagsKey: pointer.String(keys[0]),
+	}, newTags)
+}
+
+func TestEnsurePublicIPExistsWithTooManyTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	var tags []string
+	for i := 0; i < consts.MaxTagsPerResource; i++ {
+		tags = append(tags, fmt.Sprintf("k%d=v", i))
+	}
+	service := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationAzureResourceTags: strings.Join(tags, ","),
+	}, false, 80)
+	pip := network.PublicIPAddress{
+		Name:     pointer.String("pip1"),
+		Location: pointer.String("eastus"),
+		Tags: map[string]*string{
+			consts.ServiceTagKey:  pointer.String("default/svc1"),
+			consts.ClusterNameKey: pointer.String(testClusterName),
+		},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			PublicIPAddressVersion: network.IPv4,
+		},
+	}
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return([]network.PublicIPAddress{pip}, nil)
+
+	_, err := az.ensurePublicIPExists(&service, "pip1", "", testClusterName, false, false, false)
+	assert.ErrorContains(t, err, "exceed the limit of 50 tags per resource")
+	assert.Contains(t, <-recorder.Events, "InvalidResourceTags")
+}
@@ -102,6 +102,40 @@ func TestFlipServiceInternalAnnotation(t *testing.T) {
 	}
 }
 
+func TestGetCounterpartService(t *testing.T) {
+	svc := getTestService("servicea", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerInternalAndExternal:    consts.TrueAnnotationValue,
+		consts.ServiceAnnotationLoadBalancerIPDualStack[false]:     "1.2.3.4",
+		consts.ServiceAnnotationLoadBalancerAdditionalFrontends:    "1",
+		consts.ServiceAnnotationLoadBalancerInternalSubnet:         "subnet",
+		consts.ServiceAnnotationLoadBalancerHealthProbeRequestPath: "/healthz",
+	}, false, 80)
+	svc.Spec.LoadBalancerIP = "1.2.3.4"
+
+	counterpart := getCounterpartService(&svc)
+	assert.True(t, requiresInternalLoadBalancer(counterpart))
+	assert.Empty(t, counterpart.Spec.LoadBalancerIP)
+	assert.Empty(t, getServiceLoadBalancerIP(counterpart, false))
+	assert.NotContains(t, counterpart.Annotations, consts.ServiceAnnotationLoadBalancerAdditionalFrontends)
+	assert.Equal(t, "subnet", pointer.StringDeref(getInternalSubnet(counterpart), ""))
+	assert.Equal(t, "/healthz", counterpart.Annotations[consts.ServiceAnnotationLoadBalancerHealthProbeRequestPath])
+	// The original service is not changed.
+	assert.False(t, requiresInternalLoadBalancer(&svc))
+	assert.Equal(t, "1.2.3.4", getServiceLoadBalancerIP(&svc, false))
+
+	assert.False(t, requiresInternalLoadBalancer(getCounterpartService(counterpart)))
+}
+
+func TestMergeLoadBalancerStatus(t *testing.T) {
+	status := &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "1.2.3.4"}, {IP: "5.6.7.8"}}}
+	other := &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.4"}, {IP: "5.6.7.8"}}}
+
+	merged := mergeLoadBalancerStatus(status, other)
+	assert.Equal(t, []v1.LoadBalancerIngress{{IP: "1.2.3.4"}, {IP: "5.6.7.8"}, {IP: "10.0.0.4"}}, merged.Ingress)
+	assert.Equal(t, other.Ingress, mergeLoadBalancerStatus(nil, other).Ingress)
+	assert.Equal(t, status, mergeLoadBalancerStatus(status, nil))
+}
+
 // Test additional of a new service/port.
 func TestAddPort(t *testing.T) {
 	ctrl := gomock.NewController(t)
@@ -1276,7 +1310,7 @@ func TestServiceRespectsNoSessionAffinity(t *testing.T) {
 	defer ctrl.Finish()
 
 	az := GetTestCloud(ctrl)
-	svc := getTestService("service-sa-none", v1.ProtocolTCP, nil, false, 8081)
+	svc := getTestService("service-sa-none1", v1.ProtocolTCP, nil, false, 8081)
 	svc.Spec.SessionAffinity = v1.ServiceAffinityNone
 	clusterResources, expectedInterfaces, expectedVirtualMachines := getClusterResources(az, 1, 1)
 	setMockEnv(az, ctrl, expectedInterfaces, expectedVirtualMachines, 1)
@@ -1285,27 +1319,27 @@ func TestServiceRespectsNoSessionAffinity(t *testing.T) {
 	setMockLBs(az, ctrl, &expectedLBs, "service-sa-none", 1, 1, false)
 
 	expectedPIP := network.PublicIPAddress{
-		Name:     pointer.String("testCluster-aservicesanone"),
+		Name:     pointer.String("testCluster-aservicesanone1"),
 		Location: &az.Location,
 		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
 			PublicIPAllocationMethod: network.Static,
 			PublicIPAddressVersion:   network.IPv4,
 		},
 		Tags: map[string]*string{
-			consts.ServiceTagKey:  pointer.String("aservicesanone"),
+			consts.ServiceTagKey:  pointer.String("aservicesanone1"),
 			consts.ClusterNameKey: pointer.String(testClusterName),
 		},
 		Sku: &network.PublicIPAddressSku{
 			Name: network.PublicIPAddressSkuNameStandard,
 		},
-		ID: pointer.String("testCluster-aservicesanone"),
+		ID: pointer.String("testCluster-aservicesanone1"),
 	}
 
 	mockPIPsClient := mockpublicipclient.NewMockInterface(ctrl)
 	az.PublicIPAddressesClient = mockPIPsClient
 	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 	mockPIPsClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return([]network.PublicIPAddress{expectedPIP}, nil).AnyTimes()
-	mockPIPsClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "testCluster-aservicesanone", gomock.Any()).Return(expectedPIP, nil).AnyTimes()
+	mockPIPsClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "testCluster-aservicesanone1", gomock.Any()).Return(expectedPIP, nil).AnyTimes()
 
 	expectedPLS := make([]network.PrivateLinkService, 0)
 	mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
@@ -1337,7 +1371,7 @@ func TestServiceRespectsClientIPSessionAffinity(t *testing.T) {
 	defer ctrl.Finish()
 
 	az := GetTestCloud(ctrl)
-	svc := getTestService("service-sa-clientip", v1.ProtocolTCP, nil, false, 8081)
+	svc := getTestService("service-sa-clientip1", v1.ProtocolTCP, nil, false, 8081)
 	svc.Spec.SessionAffinity = v1.ServiceAffinityClientIP
 	clusterResources, expectedInterfaces, expectedVirtualMachines := getClusterResources(az, 1, 1)
 	setMockEnv(az, ctrl, expectedInterfaces, expectedVirtualMachines, 1)
@@ -1346,26 +1380,26 @@ func TestServiceRespectsClientIPSessionAffinity(t *testing.T) {
 	setMockLBs(az, ctrl, &expectedLBs, "service-sa-clientip", 1, 1, false)
 
 	expectedPIP := network.PublicIPAddress{
-		Name:     pointer.String("testCluster-aservicesaclientip"),
+		Name:     pointer.String("testCluster-aservicesaclientip1"),
 		Location: &az.Location,
 		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
 			PublicIPAllocationMethod: network.Static,
 			PublicIPAddressVersion:   network.IPv4,
 		},
 		Tags: map[string]*string{
-			consts.ServiceTagKey:  pointer.String("aservicesaclientip"),
+			consts.ServiceTagKey:  pointer.String("aservicesaclientip1"),
 			consts.ClusterNameKey: pointer.String(testClusterName),
 		},
 		Sku: &network.PublicIPAddressSku{
 			Name: network.PublicIPAddressSkuNameStandard,
 		},
-		ID: pointer.String("testCluster-aservicesaclientip"),
+		ID: pointer.String("testCluster-aservicesaclientip1"),
 	}
 
 	mockPIPsClient := mockpublicipclient.NewMockInterface(ctrl)
 	az.PublicIPAddressesClient = mockPIPsClient
 	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
-	mockPIPsClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "testCluster-aservicesaclientip", gomock.Any()).Return(expectedPIP, nil).AnyTimes()
+	mockPIPsClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "testCluster-aservicesaclientip1", gomock.Any()).Return(expectedPIP, nil).AnyTimes()
 	mockPIPsClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return([]network.PublicIPAddress{expectedPIP}, nil).AnyTimes()
 
 	expectedPLS := make([]network.PrivateLinkService, 0)
@@ -2598,7 +2632,6 @@ func getCloudFromConfig(t *testing.T, config string) *Cloud {
 
 	az := &Cloud{
 		nodeNames:                sets.New[string](),
-		nodeZones:                map[string]sets.Set[string]{},
 		nodeResourceGroups:       map[string]string{},
 		unmanagedNodes:           sets.New[string](),
 		excludeLoadBalancerNodes: sets.New[string](),
@@ -2607,6 +2640,7 @@ func getCloudFromConfig(t *testing.T, config string) *Cloud {
 	}
 	mockZoneClient := az.ZoneClient.(*mockzoneclient.MockInterface)
 	mockZoneClient.EXPECT().GetZones(gomock.Any(), gomock.Any()).Return(map[string][]string{"eastus": {"1", "2", "3"}}, nil)
+	mockZoneClient.EXPECT().GetAPIVersions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]string{"2022-07-01"}, nil)
 
 	err = az.InitializeCloudFromConfig(context.Background(), c, false, true)
 	assert.NoError(t, err)
@@ -3500,8 +3534,7 @@ func TestUpdateNodeCaches(t *testing.T) {
 	az := GetTestCloud(ctrl)
 	// delete node appearing in unmanagedNodes and excludeLoadBalancerNodes
 	zone := fmt.Sprintf("%s-0", az.Location)
-	nodesInZone := sets.New("prevNode")
-	az.nodeZones = map[string]sets.Set[string]{zone: nodesInZone}
+	az.nodeTopology.setPlacement("prevNode", zone, "")
 	az.nodeResourceGroups = map[string]string{"prevNode": "rg"}
 	az.unmanagedNodes = sets.New("prevNode")
 	az.excludeLoadBalancerNodes = sets.New("prevNode")
@@ -3519,7 +3552,7 @@ func TestUpdateNodeCaches(t *testing.T) {
 	}
 
 	az.updateNodeCaches(&prevNode, nil)
-	assert.Equal(t, 0, len(az.nodeZones[zone]))
+	assert.Equal(t, 0, az.nodeTopology.getZones().Len())
 	assert.Equal(t, 0, len(az.nodeResourceGroups))
 	assert.Equal(t, 0, len(az.unmanagedNodes))
 	assert.Equal(t, 1, len(az.excludeLoadBalancerNodes))
@@ -3539,7 +3572,7 @@ func TestUpdateNodeCaches(t *testing.T) {
 	}
 
 	az.updateNodeCaches(nil, &newNode)
-	assert.Equal(t, 1, len(az.nodeZones[zone]))
+	assert.Equal(t, 1, az.nodeTopology.getZones().Len())
 	assert.Equal(t, 1, len(az.nodeResourceGroups))
 	assert.Equal(t, 1, len(az.unmanagedNodes))
 	assert.Equal(t, 2, len(az.excludeLoadBalancerNodes))
@@ -3670,8 +3703,7 @@ func TestUpdateNodeCacheExcludeLoadBalancer(t *testing.T) {
 	az := GetTestCloud(ctrl)
 
 	zone := fmt.Sprintf("%s-0", az.Location)
-	nodesInZone := sets.New("aNode")
-	az.nodeZones = map[string]sets.Set[string]{zone: nodesInZone}
+	az.nodeTopology.setPlacement("aNode", zone, "")
 	az.nodeResourceGroups = map[string]string{"aNode": "rg"}
 
 	// a non-ready node should be included
@@ -3764,8 +3796,7 @@ func TestGetActiveZones(t *testing.T) {
 
 	az.nodeInformerSynced = func() bool { return true }
 	zone := fmt.Sprintf("%s-0", az.Location)
-	nodesInZone := sets.New("node1")
-	az.nodeZones = map[string]sets.Set[string]{zone: nodesInZone}
+	az.nodeTopology.setPlacement("node1", zone, "")
 
 	expectedZones := sets.New(zone)
 	zones, err = az.GetActiveZones()
@@ -3780,6 +3811,7 @@ func TestInitializeCloudFromConfig(t *testing.T) {
 
 	mockZoneClient := mockzoneclient.NewMockInterface(ctrl)
 	mockZoneClient.EXPECT().GetZones(gomock.Any(), gomock.Any()).Return(map[string][]string{"eastus": {"1", "2", "3"}}, nil).AnyTimes()
+	mockZoneClient.EXPECT().GetAPIVersions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]string{"2022-07-01"}, nil).AnyTimes()
 	az.ZoneClient = mockZoneClient
 
 	err := az.InitializeCloudFromConfig(context.Background(), nil, false, true)
@@ -3793,6 +3825,20 @@ func TestInitializeCloudFromConfig(t *testing.T) {
 	expectedErr := fmt.Errorf("disableAvailabilitySetNodes true is only supported when vmType is 'vmss'")
 	assert.Equal(t, expectedErr, err)
 
+	config = Config{
+		IgnoreServicesWithoutLoadBalancerClass: true,
+	}
+	err = az.InitializeCloudFromConfig(context.Background(), &config, false, true)
+	expectedErr = fmt.Errorf("ignoreServicesWithoutLoadBalancerClass is only supported when loadBalancerClass is set")
+	assert.Equal(t, expectedErr, err)
+
+	config = Config{
+		NodeShutdownPowerStates: &NodeShutdownPowerStates{Hibernated: "invalid"},
+	}
+	err = az.InitializeCloudFromConfig(context.Background(), &config, false, true)
+	expectedErr = fmt.Errorf("nodeShutdownPowerStates.hibernated \"invalid\" is not supported, supported values are \"Taint\" and \"Ignore\"")
+	assert.Equal(t, expectedErr, err)
+
 	config = Config{
 		AzureAuthConfig: providerconfig.AzureAuthConfig{
 			Cloud: "AZUREPUBLICCLOUD",
@@ -3810,10 +3856,63 @@ func TestInitializeCloudFromConfig(t *testing.T) {
 	expectedErr = errors.New("loadBalancerBackendPoolConfigurationType invalid is not supported, supported values are")
 	assert.Contains(t, err.Error(), expectedErr.Error())
 
+	config = Config{
+		ResourceNamingMode: "invalid",
+	}
+	err = az.InitializeCloudFromConfig(context.Background(), &config, false, true)
+	expectedErr = errors.New("resourceNamingMode invalid is not supported, supported values are")
+	assert.Contains(t, err.Error(), expectedErr.Error())
+
+	config = Config{
+		LocalServiceBackendPoolNameTemplate: "{namespace}",
+	}
+	err = az.InitializeCloudFromConfig(context.Background(), &config, false, true)
+	expectedErr = errors.New("localServiceBackendPoolNameTemplate {namespace} must contain {name} or {hash}")
+	assert.Equal(t, expectedErr, err)
+
+	config = Config{
+		LocalServiceBackendPoolNameTemplate: "{name}/{namespace}",
+	}
+	err = az.InitializeCloudFromConfig(context.Background(), &config, false, true)
+	assert.ErrorContains(t, err, "localServiceBackendPoolNameTemplate {name}/{namespace} renders illegal backend pool name svc/ns")
+
+	config = Config{
+		PreviousLocalServiceBackendPoolNameTemplates: []string{"{hash}-"},
+	}
+	err = az.InitializeCloudFromConfig(context.Background(), &config, false, true)
+	assert.ErrorContains(t, err, "previousLocalServiceBackendPoolNameTemplates {hash}- renders illegal backend pool name")
+
+	config = Config{
+		OutboundType: "invalid",
+	}
+	err = az.InitializeCloudFromConfig(context.Background(), &config, false, true)
+	expectedErr = errors.New("outboundType invalid is not supported, supported values are")
+	assert.Contains(t, err.Error(), expectedErr.Error())
+
+	config = Config{
+		OutboundType:        consts.OutboundTypeNATGateway,
+		DisableOutboundSNAT: pointer.Bool(true),
+		IPv6OutboundConfig:  &IPv6OutboundConfig{Enabled: true},
+	}
+	err = az.InitializeCloudFromConfig(context.Background(), &config, false, true)
+	expectedErr = errors.New("ipv6OutboundConfig should not be enabled when outboundType is natGateway")
+	assert.Equal(t, expectedErr, err)
+
+	config = Config{
+		LoadBalancerNodeExclusion: &LoadBalancerNodeExclusionConfig{
+			NodeSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "role", Operator: "invalid"}}},
+		},
+	}
+	err = az.InitializeCloudFromConfig(context.Background(), &config, false, true)
+	assert.ErrorContains(t, err, "invalid node selector of loadBalancerNodeExclusion")
+
 	config = Config{}
 	err = az.InitializeCloudFromConfig(context.Background(), &config, false, true)
 	assert.NoError(t, err)
+	assert.Equal(t, consts.OutboundTypeLoadBalancer, az.Config.OutboundType)
 	assert.Equal(t, az.Config.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration)
+	assert.Equal(t, consts.ResourceNamingModeCompatible, az.Config.ResourceNamingMode)
+	assert.Equal(t, consts.DefaultLocalServiceBackendPoolNameTemplate, az.Config.LocalServiceBackendPoolNameTemplate)
 }
 
 func TestFindSecurityRule(t *testing.T) {
@@ -4015,6 +4114,19 @@ func TestSetLBDefaults(t *testing.T) {
 	config := &Config{}
 	_ = az.setLBDefaults(config)
 	assert.Equal(t, config.LoadBalancerSku, consts.LoadBalancerSkuStandard)
+	assert.False(t, *config.DisableOutboundSNAT)
+
+	config = &Config{OutboundType: consts.OutboundTypeNATGateway}
+	assert.NoError(t, az.setLBDefaults(config))
+	assert.True(t, *config.DisableOutboundSNAT)
+
+	config = &Config{OutboundType: consts.OutboundTypeNATGateway, DisableOutboundSNAT: pointer.Bool(false)}
+	err := az.setLBDefaults(config)
+	assert.EqualError(t, err, "disableOutboundSNAT should not be false when outboundType is natGateway, because the outbound traffic is handled by the NAT gateway")
+
+	config = &Config{OutboundType: consts.OutboundTypeNATGateway, LoadBalancerSku: consts.LoadBalancerSkuBasic}
+	err = az.setLBDefaults(config)
+	assert.EqualError(t, err, "outboundType natGateway should only set when loadBalancerSku is standard")
 }
 
 func TestCheckEnableMultipleStandardLoadBalancers(t *testing.T) {
@@ -4150,3 +4262,20 @@ func TestIsNodeReady(t *testing.T) {
 		}
 	}
 }
+
+func TestNewOutboundTransport(t *testing.T) {
+	transport, err := newOutboundTransport(&Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, transport)
+
+	transport, err = newOutboundTransport(&Config{HTTPSProxy: "http://proxy.example.com:3128", NoProxy: ".internal"})
+	assert.NoError(t, err)
+	assert.NotNil(t, transport)
+	req, _ := http.NewRequest(http.MethodGet, "https://management.azure.com/", nil)
+	proxyURL, err := transport.Proxy(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "proxy.example.com:3128", proxyURL.Host)
+
+	_, err = newOutboundTransport(&Config{CABundlePath: "/non-existing/ca.pem"})
+	assert.Error(t, err)
+}
@@ -18,10 +18,12 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 
@@ -33,6 +35,7 @@ import (
 
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
 )
 
 const (
@@ -86,6 +89,20 @@ func getContextWithCancel() (context.Context, context.CancelFunc) {
 	return context.WithCancel(context.Background())
 }
 
+// getContextWithTimeout returns a context canceled after the timeout. If the timeout is not positive, the
+// context has no deadline, and the long-running operations are only bounded by the polling duration of the client.
+func getContextWithTimeout(timeoutInSeconds int) (context.Context, context.CancelFunc) {
+	if timeoutInSeconds <= 0 {
+		return getContextWithCancel()
+	}
+	return context.WithTimeout(context.Background(), time.Duration(timeoutInSeconds)*time.Second)
+}
+
+// isContextDeadlineExceeded returns true if the request failed because the deadline of its context is exceeded.
+func isContextDeadlineExceeded(rerr *retry.Error) bool {
+	return rerr != nil && errors.Is(rerr.RawError, context.DeadlineExceeded)
+}
+
 func convertMapToMapPointer(origin map[string]string) map[string]*string {
 	newly := make(map[string]*string)
 	for k, v := range origin {
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"sort"
+	"sync"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+// ensureHostGroupsInPool ensures the hosts of the VM sets, keyed by the VM set names, in a backend pool. The VM sets
+// are processed in parallel, while at most HostUpdateConcurrency hosts of a VM set are updated at the same time so
+// that a large VM set doesn't starve the others. The hosts failed with retriable errors are retried once after
+// invalidating their caches. The errors of all hosts are aggregated.
+func (az *Cloud) ensureHostGroupsInPool(hostGroups map[string][]string, ensureHost, invalidateHost func(nodeName string) error) error {
+	var errsLock sync.Mutex
+	errs := make([]error, 0)
+	wg := sync.WaitGroup{}
+	for vmSetName, nodeNames := range hostGroups {
+		vmSetName := vmSetName
+		nodeNames := nodeNames
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if groupErrs := az.ensureHostGroupInPool(vmSetName, nodeNames, ensureHost, invalidateHost); len(groupErrs) > 0 {
+				errsLock.Lock()
+				errs = append(errs, groupErrs...)
+				errsLock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return utilerrors.Flatten(utilerrors.NewAggregate(errs))
+}
+
+// ensureHostGroupInPool ensures the hosts of a VM set in a backend pool and returns the errors of the failed hosts.
+func (az *Cloud) ensureHostGroupInPool(vmSetName string, nodeNames []string, ensureHost, invalidateHost func(nodeName string) error) []error {
+	failures := az.ensureHostsConcurrently(nodeNames, ensureHost)
+
+	retriableNodeNames := make([]string, 0)
+	for nodeName, err := range failures {
+		if retry.IsErrorRetriable(err) {
+			retriableNodeNames = append(retriableNodeNames, nodeName)
+		}
+	}
+	if len(retriableNodeNames) > 0 {
+		klog.V(2).Infof("ensureHostGroupInPool: retrying %d of %d hosts of VM set %q", len(retriableNodeNames), len(nodeNames), vmSetName)
+		for _, nodeName := range retriableNodeNames {
+			_ = invalidateHost(nodeName)
+			delete(failures, nodeName)
+		}
+		for nodeName, err := range az.ensureHostsConcurrently(retriableNodeNames, ensureHost) {
+			failures[nodeName] = err
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+
+	failedNodeNames := make([]string, 0, len(failures))
+	for nodeName := range failures {
+		failedNodeNames = append(failedNodeNames, nodeName)
+	}
+	sort.Strings(failedNodeNames)
+	klog.Errorf("ensureHostGroupInPool: failed to ensure %d of %d hosts of VM set %q: %v", len(failedNodeNames), len(nodeNames), vmSetName, failedNodeNames)
+
+	errs := make([]error, 0, len(failedNodeNames))
+	for _, nodeName := range failedNodeNames {
+		errs = append(errs, failures[nodeName])
+	}
+	return errs
+}
+
+// ensureHostsConcurrently ensures the hosts with at most HostUpdateConcurrency hosts at the same time, and returns
+// the errors keyed by the node names of the failed hosts.
+func (az *Cloud) ensureHostsConcurrently(nodeNames []string, ensureHost func(nodeName string) error) map[string]error {
+	var failuresLock sync.Mutex
+	failures := make(map[string]error)
+	concurrency := make(chan struct{}, az.getHostUpdateConcurrency())
+	wg := sync.WaitGroup{}
+	for _, nodeName := range nodeNames {
+		nodeName := nodeName
+		concurrency <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-concurrency }()
+			if err := ensureHost(nodeName); err != nil {
+				failuresLock.Lock()
+				failures[nodeName] = err
+				failuresLock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return failures
+}
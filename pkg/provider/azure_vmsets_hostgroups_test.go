@@ -0,0 +1,85 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestEnsureHostGroupsInPool(t *testing.T) {
+	az := &Cloud{Config: Config{HostUpdateConcurrency: 2}}
+
+	var lock sync.Mutex
+	running, maxRunning := map[string]int{}, map[string]int{}
+	attempts, invalidated := map[string]int{}, map[string]int{}
+	hostGroups := map[string][]string{
+		"as1": {"as1-vm0", "as1-vm1", "as1-vm2", "as1-vm3", "as1-vm4"},
+		"as2": {"as2-vm0", "as2-retriable", "as2-failed"},
+	}
+	groupOf := func(nodeName string) string {
+		return nodeName[:3]
+	}
+
+	err := az.ensureHostGroupsInPool(hostGroups, func(nodeName string) error {
+		lock.Lock()
+		group := groupOf(nodeName)
+		running[group]++
+		if running[group] > maxRunning[group] {
+			maxRunning[group] = running[group]
+		}
+		attempts[nodeName]++
+		attempt := attempts[nodeName]
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		running[group]--
+		lock.Unlock()
+
+		switch {
+		case nodeName == "as2-retriable" && attempt == 1:
+			return retry.NewError(true, errors.New("etag mismatch")).Error()
+		case nodeName == "as2-failed":
+			return fmt.Errorf("node %s failed", nodeName)
+		}
+		return nil
+	}, func(nodeName string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		invalidated[nodeName]++
+		return nil
+	})
+
+	assert.EqualError(t, err, "node as2-failed failed")
+	assert.Equal(t, 2, maxRunning["as1"])
+	assert.LessOrEqual(t, maxRunning["as2"], 2)
+	assert.Equal(t, 2, attempts["as2-retriable"])
+	assert.Equal(t, 1, attempts["as2-failed"], "non-retriable errors should not be retried")
+	assert.Equal(t, map[string]int{"as2-retriable": 1}, invalidated)
+	for _, nodeName := range hostGroups["as1"] {
+		assert.Equal(t, 1, attempts[nodeName])
+	}
+}
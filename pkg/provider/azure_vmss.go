@@ -40,6 +40,7 @@ import (
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
 	"sigs.k8s.io/cloud-provider-azure/pkg/provider/virtualmachine"
+	"sigs.k8s.io/cloud-provider-azure/pkg/providerid"
 )
 
 var (
@@ -47,13 +48,8 @@ var (
 	ErrorNotVmssInstance = errors.New("not a vmss instance")
 	ErrScaleSetNotFound  = errors.New("scale set not found")
 
-	scaleSetNameRE           = regexp.MustCompile(`.*/subscriptions/(?:.*)/Microsoft.Compute/virtualMachineScaleSets/(.+)/virtualMachines(?:.*)`)
-	resourceGroupRE          = regexp.MustCompile(`.*/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Compute/virtualMachineScaleSets/(?:.*)/virtualMachines(?:.*)`)
-	vmssIPConfigurationRE    = regexp.MustCompile(`.*/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Compute/virtualMachineScaleSets/(.+)/virtualMachines/(.+)/networkInterfaces(?:.*)`)
-	vmssPIPConfigurationRE   = regexp.MustCompile(`.*/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Compute/virtualMachineScaleSets/(.+)/virtualMachines/(.+)/networkInterfaces/(.+)/ipConfigurations/(.+)/publicIPAddresses/(.+)`)
-	vmssVMResourceIDTemplate = `/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Compute/virtualMachineScaleSets/(.+)/virtualMachines/(?:\d+)`
-	vmssVMResourceIDRE       = regexp.MustCompile(vmssVMResourceIDTemplate)
-	vmssVMProviderIDRE       = regexp.MustCompile(fmt.Sprintf("%s%s", "azure://", vmssVMResourceIDTemplate))
+	vmssIPConfigurationRE  = regexp.MustCompile(`.*/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Compute/virtualMachineScaleSets/(.+)/virtualMachines/(.+)/networkInterfaces(?:.*)`)
+	vmssPIPConfigurationRE = regexp.MustCompile(`.*/subscriptions/(?:.*)/resourceGroups/(.+)/providers/Microsoft.Compute/virtualMachineScaleSets/(.+)/virtualMachines/(.+)/networkInterfaces/(.+)/ipConfigurations/(.+)/publicIPAddresses/(.+)`)
 )
 
 // vmssMetaInfo contains the metadata for a VMSS.
@@ -102,6 +98,10 @@ type ScaleSet struct {
 
 	// lockMap in cache refresh
 	lockMap *lockMap
+
+	// vmssConvergence records the VMSS VMs whose backend pool membership has not
+	// converged because the VMSS VM update failed.
+	vmssConvergence vmssConvergenceTracker
 }
 
 // newScaleSet creates a new ScaleSet.
@@ -282,12 +282,8 @@ func (ss *ScaleSet) GetPowerStatusByNodeName(name string) (powerState string, er
 	if vm.IsVirtualMachineScaleSetVM() {
 		v := vm.AsVirtualMachineScaleSetVM()
 		if v.InstanceView != nil && v.InstanceView.Statuses != nil {
-			statuses := *v.InstanceView.Statuses
-			for _, status := range statuses {
-				state := pointer.StringDeref(status.Code, "")
-				if strings.HasPrefix(state, vmPowerStatePrefix) {
-					return strings.TrimPrefix(state, vmPowerStatePrefix), nil
-				}
+			if powerState, found := getPowerStateFromStatuses(*v.InstanceView.Statuses); found {
+				return powerState, nil
 			}
 		}
 	}
@@ -445,31 +441,19 @@ func (ss *ScaleSet) GetNodeNameByProviderID(providerID string) (types.NodeName,
 		return ss.flexScaleSet.GetNodeNameByProviderID(providerID)
 	}
 
-	// NodeName is not part of providerID for vmss instances.
-	scaleSetName, err := extractScaleSetNameByProviderID(providerID)
+	// NodeName is not part of providerID for vmss instances. The instanceID that contains
+	// scaleSetName (returned by disk.ManagedBy), e.g. k8s-agentpool-36841236-vmss_1, is normalized by the parser.
+	parsed, err := providerid.Parse(providerID)
 	if err != nil {
 		return "", fmt.Errorf("error of extracting vmss name for node %q", providerID)
 	}
-	resourceGroup, err := extractResourceGroupByProviderID(providerID)
-	if err != nil {
-		return "", fmt.Errorf("error of extracting resource group for node %q", providerID)
-	}
-
-	instanceID, err := getLastSegment(providerID, "/")
-	if err != nil {
-		klog.V(4).Infof("Can not extract instanceID from providerID (%s), assuming it is managed by availability set: %v", providerID, err)
+	if !parsed.IsScaleSetVM() {
+		// The management type is VMSS uniform for all nodes if the availability set nodes are disabled.
+		klog.V(4).Infof("ProviderID (%s) is not a vmss instance, assuming it is managed by availability set", providerID)
 		return ss.availabilitySet.GetNodeNameByProviderID(providerID)
 	}
 
-	// instanceID contains scaleSetName (returned by disk.ManagedBy), e.g. k8s-agentpool-36841236-vmss_1
-	if strings.HasPrefix(strings.ToLower(instanceID), strings.ToLower(scaleSetName)) {
-		instanceID, err = getLastSegment(instanceID, "_")
-		if err != nil {
-			return "", err
-		}
-	}
-
-	vm, err := ss.getVmssVMByInstanceID(resourceGroup, scaleSetName, instanceID, azcache.CacheReadTypeUnsafe)
+	vm, err := ss.getVmssVMByInstanceID(parsed.ResourceGroup, parsed.ScaleSetName, parsed.Name, azcache.CacheReadTypeUnsafe)
 	if err != nil {
 		klog.Errorf("Unable to find node by providerID %s: %v", providerID, err)
 		return "", err
@@ -735,22 +719,12 @@ func getScaleSetVMInstanceID(machineName string) (string, error) {
 
 // extractScaleSetNameByProviderID extracts the scaleset name by vmss node's ProviderID.
 func extractScaleSetNameByProviderID(providerID string) (string, error) {
-	matches := scaleSetNameRE.FindStringSubmatch(providerID)
-	if len(matches) != 2 {
-		return "", ErrorNotVmssInstance
-	}
-
-	return matches[1], nil
-}
-
-// extractResourceGroupByProviderID extracts the resource group name by vmss node's ProviderID.
-func extractResourceGroupByProviderID(providerID string) (string, error) {
-	matches := resourceGroupRE.FindStringSubmatch(providerID)
-	if len(matches) != 2 {
+	parsed, err := providerid.Parse(providerID)
+	if err != nil || !parsed.IsScaleSetVM() {
 		return "", ErrorNotVmssInstance
 	}
 
-	return matches[1], nil
+	return parsed.ScaleSetName, nil
 }
 
 // listScaleSets lists all scale sets with orchestrationMode ScaleSetVM.
@@ -1184,19 +1158,19 @@ func (ss *ScaleSet) EnsureHostInPool(service *v1.Service, nodeName types.NodeNam
 }
 
 func getVmssAndResourceGroupNameByVMProviderID(providerID string) (string, string, error) {
-	matches := vmssVMProviderIDRE.FindStringSubmatch(providerID)
-	if len(matches) != 3 {
+	parsed, err := providerid.Parse(providerID)
+	if err != nil || !parsed.IsScaleSetVM() || !providerid.IsAzure(providerID) {
 		return "", "", ErrorNotVmssInstance
 	}
-	return matches[1], matches[2], nil
+	return parsed.ResourceGroup, parsed.ScaleSetName, nil
 }
 
 func getVmssAndResourceGroupNameByVMID(id string) (string, string, error) {
-	matches := vmssVMResourceIDRE.FindStringSubmatch(id)
-	if len(matches) != 3 {
+	parsed, err := providerid.Parse(id)
+	if err != nil || !parsed.IsScaleSetVM() {
 		return "", "", ErrorNotVmssInstance
 	}
-	return matches[1], matches[2], nil
+	return parsed.ResourceGroup, parsed.ScaleSetName, nil
 }
 
 func (ss *ScaleSet) ensureVMSSInPool(service *v1.Service, nodes []*v1.Node, backendPoolID string, vmSetNameOfLB string) error {
@@ -1353,6 +1327,7 @@ func (ss *ScaleSet) ensureHostsInPool(service *v1.Service, nodes []*v1.Node, bac
 
 	hostUpdates := make([]func() error, 0, len(nodes))
 	nodeUpdates := make(map[vmssMetaInfo]map[string]compute.VirtualMachineScaleSetVM)
+	instanceNodeNames := make(map[vmssMetaInfo]map[string]string)
 	errors := make([]error, 0)
 	for _, node := range nodes {
 		localNodeName := node.Name
@@ -1392,6 +1367,10 @@ func (ss *ScaleSet) ensureHostsInPool(service *v1.Service, nodes []*v1.Node, bac
 				nodeInstanceID: *nodeVMSSVM,
 			}
 		}
+		if _, ok := instanceNodeNames[nodeVMSSMetaInfo]; !ok {
+			instanceNodeNames[nodeVMSSMetaInfo] = make(map[string]string)
+		}
+		instanceNodeNames[nodeVMSSMetaInfo][nodeInstanceID] = localNodeName
 
 		// Invalidate the cache since the VMSS VM would be updated.
 		defer func() {
@@ -1405,9 +1384,6 @@ func (ss *ScaleSet) ensureHostsInPool(service *v1.Service, nodes []*v1.Node, bac
 		meta := meta
 		update := update
 		hostUpdates = append(hostUpdates, func() error {
-			ctx, cancel := getContextWithCancel()
-			defer cancel()
-
 			logFields := []interface{}{
 				"operation", "EnsureHostsInPool UpdateVMSSVMs",
 				"vmssName", meta.vmssName,
@@ -1422,30 +1398,29 @@ func (ss *ScaleSet) ensureHostsInPool(service *v1.Service, nodes []*v1.Node, bac
 			}
 
 			klog.V(2).InfoS("Begin to update VMs for VMSS with new backendPoolID", logFields...)
-			rerr := ss.VirtualMachineScaleSetVMsClient.UpdateVMs(ctx, meta.resourceGroup, meta.vmssName, update, "network_update", batchSize)
-			if rerr != nil {
-				klog.ErrorS(err, "Failed to update VMs for VMSS", logFields...)
-				return rerr.Error()
+			failedInstanceIDs, err := ss.updateVMSSVMsInChunks(meta, update, batchSize, logFields...)
+			ss.vmssConvergence.track(meta, instanceNodeNames[meta], failedInstanceIDs, []string{backendPoolID}, true)
+			if err != nil {
+				return err
 			}
 
 			return nil
 		})
 	}
-	errs := utilerrors.AggregateGoroutines(hostUpdates...)
-	if errs != nil {
-		return utilerrors.Flatten(errs)
+	if errs := utilerrors.AggregateGoroutines(hostUpdates...); errs != nil {
+		errors = append(errors, utilerrors.Flatten(errs))
 	}
 
-	// Fail if there are other errors.
-	if len(errors) > 0 {
-		return utilerrors.Flatten(utilerrors.NewAggregate(errors))
+	// Ensure the backendPoolID is also added on VMSS itself even if some VMSS VMs failed to be
+	// updated, the failed VMSS VMs are retried by the convergence tracker.
+	// Refer to issue kubernetes/kubernetes#80365 for detailed information
+	if err := ss.ensureVMSSInPool(service, nodes, backendPoolID, vmSetNameOfLB); err != nil {
+		errors = append(errors, err)
 	}
 
-	// Ensure the backendPoolID is also added on VMSS itself.
-	// Refer to issue kubernetes/kubernetes#80365 for detailed information
-	err := ss.ensureVMSSInPool(service, nodes, backendPoolID, vmSetNameOfLB)
-	if err != nil {
-		return err
+	// Fail if there are any errors.
+	if len(errors) > 0 {
+		return utilerrors.Flatten(utilerrors.NewAggregate(errors))
 	}
 
 	isOperationSucceeded = true
@@ -1811,6 +1786,7 @@ func (ss *ScaleSet) ensureBackendPoolDeleted(service *v1.Service, backendPoolIDs
 	// Ensure the backendPoolID is deleted from the VMSS VMs.
 	hostUpdates := make([]func() error, 0, len(ipConfigurationIDs))
 	nodeUpdates := make(map[vmssMetaInfo]map[string]compute.VirtualMachineScaleSetVM)
+	instanceNodeNames := make(map[vmssMetaInfo]map[string]string)
 	allErrs := make([]error, 0)
 	visitedIPConfigIDPrefix := map[string]bool{}
 	for i := range ipConfigurationIDs {
@@ -1823,7 +1799,7 @@ func (ss *ScaleSet) ensureBackendPoolDeleted(service *v1.Service, backendPoolIDs
 
 		var scaleSetName string
 		var err error
-		if scaleSetName, err = extractScaleSetNameByProviderID(ipConfigurationID); err == nil {
+		if _, scaleSetName, err = getVmssAndResourceGroupNameByVMID(ipConfigurationID); err == nil {
 			// Only remove nodes belonging to specified vmSet to basic LB backends.
 			if !ss.useStandardLoadBalancer() && !strings.EqualFold(scaleSetName, vmSetName) {
 				continue
@@ -1869,6 +1845,10 @@ func (ss *ScaleSet) ensureBackendPoolDeleted(service *v1.Service, backendPoolIDs
 				nodeInstanceID: *nodeVMSSVM,
 			}
 		}
+		if _, ok := instanceNodeNames[nodeVMSSMetaInfo]; !ok {
+			instanceNodeNames[nodeVMSSMetaInfo] = make(map[string]string)
+		}
+		instanceNodeNames[nodeVMSSMetaInfo][nodeInstanceID] = nodeName
 
 		// Invalidate the cache since the VMSS VM would be updated.
 		defer func() {
@@ -1883,9 +1863,6 @@ func (ss *ScaleSet) ensureBackendPoolDeleted(service *v1.Service, backendPoolIDs
 		meta := meta
 		update := update
 		hostUpdates = append(hostUpdates, func() error {
-			ctx, cancel := getContextWithCancel()
-			defer cancel()
-
 			logFields := []interface{}{
 				"operation", "EnsureBackendPoolDeleted UpdateVMSSVMs",
 				"vmssName", meta.vmssName,
@@ -1900,10 +1877,10 @@ func (ss *ScaleSet) ensureBackendPoolDeleted(service *v1.Service, backendPoolIDs
 			}
 
 			klog.V(2).InfoS("Begin to update VMs for VMSS with new backendPoolID", logFields...)
-			rerr := ss.VirtualMachineScaleSetVMsClient.UpdateVMs(ctx, meta.resourceGroup, meta.vmssName, update, "network_update", batchSize)
-			if rerr != nil {
-				klog.ErrorS(err, "Failed to update VMs for VMSS", logFields...)
-				return rerr.Error()
+			failedInstanceIDs, err := ss.updateVMSSVMsInChunks(meta, update, batchSize, logFields...)
+			ss.vmssConvergence.track(meta, instanceNodeNames[meta], failedInstanceIDs, backendPoolIDs, false)
+			if err != nil {
+				return err
 			}
 
 			updatedVM.Store(true)
@@ -1965,11 +1942,10 @@ func (ss *ScaleSet) EnsureBackendPoolDeleted(service *v1.Service, backendPoolIDs
 
 	// make sure all vmss including uniform and flex are decoupled from
 	// the lb backend pool even if there is no ipConfigs in the backend pool.
+	// The VMSS VMs are still updated if the VMSS model fails to be updated.
+	var vmssErr error
 	if deleteFromVMSet {
-		err := ss.ensureBackendPoolDeletedFromVMSS(backendPoolIDs, vmSetName)
-		if err != nil {
-			return false, err
-		}
+		vmssErr = ss.ensureBackendPoolDeletedFromVMSS(backendPoolIDs, vmSetName)
 	}
 
 	var updated bool
@@ -1985,12 +1961,15 @@ func (ss *ScaleSet) EnsureBackendPoolDeleted(service *v1.Service, backendPoolIDs
 	}
 	if len(vmssUniformBackendPools) > 0 {
 		updatedVM, err := ss.ensureBackendPoolDeleted(service, backendPoolIDs, vmSetName, &vmssUniformBackendPools)
-		if err != nil {
-			return false, err
-		}
 		if updatedVM {
 			updated = true
 		}
+		if err != nil {
+			return updated, utilerrors.Flatten(utilerrors.NewAggregate([]error{vmssErr, err}))
+		}
+	}
+	if vmssErr != nil {
+		return updated, vmssErr
 	}
 
 	vmssFlexBackendPools := []network.BackendAddressPool{}
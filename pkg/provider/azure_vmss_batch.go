@@ -0,0 +1,146 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+// splitVMSSVMUpdates splits the VMSS VM updates into chunks, each of which has at most maxInstances
+// VMs. The VMs are ordered by instance ID so that the chunks are stable.
+func splitVMSSVMUpdates(updates map[string]compute.VirtualMachineScaleSetVM, maxInstances int) []map[string]compute.VirtualMachineScaleSetVM {
+	instanceIDs := make([]string, 0, len(updates))
+	for instanceID := range updates {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	sort.Strings(instanceIDs)
+
+	var chunks []map[string]compute.VirtualMachineScaleSetVM
+	var chunk map[string]compute.VirtualMachineScaleSetVM
+	for _, instanceID := range instanceIDs {
+		if chunk == nil || len(chunk) >= maxInstances {
+			chunk = make(map[string]compute.VirtualMachineScaleSetVM)
+			chunks = append(chunks, chunk)
+		}
+		chunk[instanceID] = updates[instanceID]
+	}
+	return chunks
+}
+
+// updateVMSSVMsInChunks updates the VMSS VMs in chunks. The chunks are updated in parallel with
+// bounded concurrency. If some VMs of a chunk fail, only the failed VMs are retried so that the
+// failure of one VM does not block the update of the others. It returns the instance IDs of the failed VMs.
+func (ss *ScaleSet) updateVMSSVMsInChunks(meta vmssMetaInfo, updates map[string]compute.VirtualMachineScaleSetVM, batchSize int, logFields ...interface{}) (sets.Set[string], error) {
+	chunks := splitVMSSVMUpdates(updates, ss.getVMSSVMUpdateChunkSize())
+	if len(chunks) > 1 {
+		klog.V(2).InfoS("Split the VMSS VM updates into chunks", append(logFields, "instances", len(updates), "chunks", len(chunks))...)
+	}
+
+	var errsLock sync.Mutex
+	errs := make([]error, 0)
+	failedInstanceIDs := sets.New[string]()
+	concurrency := make(chan struct{}, ss.getVMSSVMUpdateChunkConcurrency())
+	wg := sync.WaitGroup{}
+	for _, chunk := range chunks {
+		chunk := chunk
+		concurrency <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-concurrency }()
+			if failed, err := ss.updateVMSSVMsChunk(meta, chunk, batchSize, logFields...); err != nil {
+				errsLock.Lock()
+				errs = append(errs, err)
+				failedInstanceIDs.Insert(failed...)
+				errsLock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return failedInstanceIDs, utilerrors.Flatten(utilerrors.NewAggregate(errs))
+}
+
+// updateVMSSVMsChunk updates a chunk of VMSS VMs, and retries the failed VMs once if the client
+// tells them apart. Throttled errors are returned directly. It returns the instance IDs of the
+// VMs which are failed or not updated.
+func (ss *ScaleSet) updateVMSSVMsChunk(meta vmssMetaInfo, chunk map[string]compute.VirtualMachineScaleSetVM, batchSize int, logFields ...interface{}) ([]string, error) {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	rerr := ss.VirtualMachineScaleSetVMsClient.UpdateVMs(ctx, meta.resourceGroup, meta.vmssName, chunk, "network_update", batchSize)
+	if rerr == nil {
+		return nil, nil
+	}
+	failedInstanceIDs, isolated := getFailedVMSSVMInstanceIDs(rerr, chunk)
+	if !isolated || rerr.IsThrottled() {
+		klog.ErrorS(rerr.Error(), "Failed to update VMs for VMSS", logFields...)
+		return failedInstanceIDs, fmt.Errorf("instances %v: %w", failedInstanceIDs, rerr.Error())
+	}
+
+	klog.V(2).InfoS("Failed to update some VMSS VMs of the chunk, retry them", append(logFields, "instances", failedInstanceIDs, "error", rerr.Error())...)
+	retries := make(map[string]compute.VirtualMachineScaleSetVM, len(failedInstanceIDs))
+	for _, instanceID := range failedInstanceIDs {
+		retries[instanceID] = chunk[instanceID]
+	}
+	rerr = ss.VirtualMachineScaleSetVMsClient.UpdateVMs(ctx, meta.resourceGroup, meta.vmssName, retries, "network_update", batchSize)
+	if rerr == nil {
+		return nil, nil
+	}
+	failedInstanceIDs, _ = getFailedVMSSVMInstanceIDs(rerr, retries)
+	klog.ErrorS(rerr.Error(), "Failed to update VMSS VMs", append(logFields, "instances", failedInstanceIDs)...)
+	return failedInstanceIDs, fmt.Errorf("instances %v: %w", failedInstanceIDs, rerr.Error())
+}
+
+// getFailedVMSSVMInstanceIDs returns the sorted instance IDs of the VMs failed in UpdateVMs. If the
+// error does not tell the failed VMs apart, e.g., the request is rate limited before being sent,
+// all VMs of the request are regarded as failed and isolated is false.
+func getFailedVMSSVMInstanceIDs(rerr *retry.Error, instances map[string]compute.VirtualMachineScaleSetVM) (failedInstanceIDs []string, isolated bool) {
+	errs := []error{rerr.RawError}
+	var agg utilerrors.Aggregate
+	if errors.As(rerr.RawError, &agg) {
+		errs = agg.Errors()
+	}
+
+	failed := sets.New[string]()
+	isolated = true
+	for _, err := range errs {
+		var instanceErr *vmssvmclient.InstanceError
+		if !errors.As(err, &instanceErr) {
+			isolated = false
+			break
+		}
+		failed.Insert(instanceErr.InstanceID)
+	}
+	if !isolated || failed.Len() == 0 {
+		failed = sets.KeySet(instances)
+		isolated = false
+	}
+	return sets.List(failed), isolated
+}
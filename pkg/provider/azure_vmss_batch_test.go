@@ -0,0 +1,196 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func buildTestVMSSVMUpdates(count int) map[string]compute.VirtualMachineScaleSetVM {
+	updates := make(map[string]compute.VirtualMachineScaleSetVM)
+	for i := 0; i < count; i++ {
+		instanceID := fmt.Sprintf("%d", i)
+		updates[instanceID] = compute.VirtualMachineScaleSetVM{Tags: map[string]*string{"id": pointer.String(instanceID)}}
+	}
+	return updates
+}
+
+func TestSplitVMSSVMUpdates(t *testing.T) {
+	for _, tc := range []struct {
+		description        string
+		count              int
+		maxInstances       int
+		expectedChunkSizes []int
+	}{
+		{
+			description:        "should return no chunks if there are no updates",
+			maxInstances:       2,
+			expectedChunkSizes: nil,
+		},
+		{
+			description:        "should split by the number of instances",
+			count:              5,
+			maxInstances:       2,
+			expectedChunkSizes: []int{2, 2, 1},
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			updates := buildTestVMSSVMUpdates(tc.count)
+			chunks := splitVMSSVMUpdates(updates, tc.maxInstances)
+
+			var chunkSizes []int
+			merged := make(map[string]compute.VirtualMachineScaleSetVM)
+			for _, chunk := range chunks {
+				chunkSizes = append(chunkSizes, len(chunk))
+				for instanceID, vm := range chunk {
+					merged[instanceID] = vm
+				}
+			}
+			assert.Equal(t, tc.expectedChunkSizes, chunkSizes)
+			assert.Len(t, merged, tc.count)
+		})
+	}
+}
+
+func TestUpdateVMSSVMsInChunks(t *testing.T) {
+	meta := vmssMetaInfo{vmssName: testVMSSName, resourceGroup: "rg"}
+
+	for _, tc := range []struct {
+		description    string
+		count          int
+		chunkSize      int
+		failedInstance string
+		throttled      bool
+		rateLimited    bool
+		expectedCalls  int
+		expectedFailed []string
+		expectedErr    string
+	}{
+		{
+			description:   "should update all chunks",
+			count:         5,
+			chunkSize:     2,
+			expectedCalls: 3,
+		},
+		{
+			description:    "should retry only the failed instance of a chunk",
+			count:          5,
+			chunkSize:      2,
+			failedInstance: "3",
+			expectedCalls:  4,
+			expectedFailed: []string{"3"},
+			expectedErr:    "instances [3]:",
+		},
+		{
+			description:    "should not retry the failed instance if the chunk is throttled",
+			count:          5,
+			chunkSize:      2,
+			failedInstance: "3",
+			throttled:      true,
+			expectedCalls:  3,
+			expectedFailed: []string{"3"},
+			expectedErr:    "instances [3]:",
+		},
+		{
+			description:    "should regard all instances of the chunk as failed if the error does not tell them apart",
+			count:          5,
+			chunkSize:      2,
+			failedInstance: "3",
+			rateLimited:    true,
+			expectedCalls:  3,
+			expectedFailed: []string{"2", "3"},
+			expectedErr:    "instances [2 3]:",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			ss, err := NewTestScaleSet(ctrl)
+			assert.NoError(t, err)
+			ss.VMSSVMUpdateChunkSize = tc.chunkSize
+			ss.VMSSVMUpdateChunkConcurrency = 2
+
+			var lock sync.Mutex
+			var updated []string
+			mockVMSSVMClient := ss.cloud.VirtualMachineScaleSetVMsClient.(*mockvmssvmclient.MockInterface)
+			mockVMSSVMClient.EXPECT().UpdateVMs(gomock.Any(), "rg", testVMSSName, gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, _, _ string, instances map[string]compute.VirtualMachineScaleSetVM, _ string, _ int) *retry.Error {
+					lock.Lock()
+					defer lock.Unlock()
+					_, found := instances[tc.failedInstance]
+					if found && tc.rateLimited {
+						return retry.GetRateLimitError(true, "VMSSVMUpdateVMs")
+					}
+					for instanceID := range instances {
+						if instanceID != tc.failedInstance {
+							updated = append(updated, instanceID)
+						}
+					}
+					if !found {
+						return nil
+					}
+					rerr := &retry.Error{RawError: utilerrors.NewAggregate([]error{
+						&vmssvmclient.InstanceError{InstanceID: tc.failedInstance, Err: fmt.Errorf("error")},
+					})}
+					if tc.throttled {
+						rerr.HTTPStatusCode = http.StatusTooManyRequests
+						rerr.RetryAfter = time.Now().Add(time.Minute)
+					}
+					return rerr
+				}).Times(tc.expectedCalls)
+
+			failed, err := ss.updateVMSSVMsInChunks(meta, buildTestVMSSVMUpdates(tc.count), 0)
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.True(t, strings.Contains(err.Error(), tc.expectedErr), err.Error())
+			}
+
+			expectedFailed := sets.New[string](tc.expectedFailed...)
+			expectedUpdated := []string{}
+			for instanceID := range buildTestVMSSVMUpdates(tc.count) {
+				if !expectedFailed.Has(instanceID) {
+					expectedUpdated = append(expectedUpdated, instanceID)
+				}
+			}
+			sort.Strings(updated)
+			sort.Strings(expectedUpdated)
+			assert.Equal(t, expectedUpdated, updated)
+			assert.Equal(t, expectedFailed, failed)
+		})
+	}
+}
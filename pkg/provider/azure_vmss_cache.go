@@ -31,6 +31,7 @@ import (
 
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/providerid"
 )
 
 type VMSSVirtualMachineEntry struct {
@@ -347,12 +348,12 @@ func (ss *ScaleSet) newNonVmssUniformNodesCache() (azcache.Resource, error) {
 					if vm.VirtualMachineScaleSet != nil {
 						vmssFlexVMNodeNames.Insert(strings.ToLower(pointer.StringDeref(vm.OsProfile.ComputerName, "")))
 						if vm.ID != nil {
-							vmssFlexVMProviderIDs.Insert(ss.ProviderName() + "://" + pointer.StringDeref(vm.ID, ""))
+							vmssFlexVMProviderIDs.Insert(providerid.FromResourceID(pointer.StringDeref(vm.ID, "")))
 						}
 					} else {
 						avSetVMNodeNames.Insert(strings.ToLower(pointer.StringDeref(vm.OsProfile.ComputerName, "")))
 						if vm.ID != nil {
-							avSetVMProviderIDs.Insert(ss.ProviderName() + "://" + pointer.StringDeref(vm.ID, ""))
+							avSetVMProviderIDs.Insert(providerid.FromResourceID(pointer.StringDeref(vm.ID, "")))
 						}
 					}
 				}
@@ -0,0 +1,259 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+// vmssInstanceState is the desired backend pool membership of a VMSS VM which has not been
+// converged, i.e., the VMSS VM update failed after the VMSS model had been updated.
+type vmssInstanceState struct {
+	meta       vmssMetaInfo
+	instanceID string
+	// backendPools maps the lower-cased backend pool ID to the desired membership.
+	backendPools map[string]bool
+	// backendPoolIDs keeps the original backend pool IDs.
+	backendPoolIDs map[string]string
+}
+
+// vmssConvergenceTracker records the VMSS VMs whose backend pool membership diverges from the
+// desired state, keyed by the node name. The recorded states are replaced instead of modified so
+// that they can be read without the lock. The zero value is ready to use.
+type vmssConvergenceTracker struct {
+	lock      sync.Mutex
+	instances map[string]*vmssInstanceState
+	// reported records the VMSS whose number of unconverged VMs has been reported.
+	reported map[vmssMetaInfo]bool
+}
+
+// track records the result of the update of the VMSS VMs in the backend pools: the failed
+// VMs are recorded as divergent, and the desired states of the other VMs are cleared.
+func (t *vmssConvergenceTracker) track(meta vmssMetaInfo, instanceNodeNames map[string]string, failedInstanceIDs sets.Set[string], backendPoolIDs []string, member bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.instances == nil {
+		t.instances = make(map[string]*vmssInstanceState)
+	}
+	for instanceID, nodeName := range instanceNodeNames {
+		failed := failedInstanceIDs.Has(instanceID)
+		current, found := t.instances[nodeName]
+		if !found && !failed {
+			continue
+		}
+
+		state := &vmssInstanceState{
+			meta:           meta,
+			instanceID:     instanceID,
+			backendPools:   make(map[string]bool),
+			backendPoolIDs: make(map[string]string),
+		}
+		if found && current.meta == meta && current.instanceID == instanceID {
+			for key, member := range current.backendPools {
+				state.backendPools[key] = member
+				state.backendPoolIDs[key] = current.backendPoolIDs[key]
+			}
+		}
+		for _, backendPoolID := range backendPoolIDs {
+			key := strings.ToLower(backendPoolID)
+			if failed {
+				state.backendPools[key] = member
+				state.backendPoolIDs[key] = backendPoolID
+			} else {
+				delete(state.backendPools, key)
+				delete(state.backendPoolIDs, key)
+			}
+		}
+
+		if len(state.backendPools) == 0 {
+			delete(t.instances, nodeName)
+			continue
+		}
+		t.instances[nodeName] = state
+	}
+	t.reportLocked()
+}
+
+// converge removes the divergent state of the node if it has not been replaced.
+func (t *vmssConvergenceTracker) converge(nodeName string, state *vmssInstanceState) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if current, found := t.instances[nodeName]; found && current == state {
+		delete(t.instances, nodeName)
+	}
+	t.reportLocked()
+}
+
+// snapshot returns the divergent VMSS VMs.
+func (t *vmssConvergenceTracker) snapshot() map[string]*vmssInstanceState {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	instances := make(map[string]*vmssInstanceState, len(t.instances))
+	for nodeName, state := range t.instances {
+		instances[nodeName] = state
+	}
+	return instances
+}
+
+// reportLocked updates the metric of the number of unconverged VMSS VMs per VMSS.
+func (t *vmssConvergenceTracker) reportLocked() {
+	if t.reported == nil {
+		t.reported = make(map[vmssMetaInfo]bool)
+	}
+	counts := make(map[vmssMetaInfo]int)
+	for _, state := range t.instances {
+		counts[state.meta]++
+		t.reported[state.meta] = true
+	}
+	for meta := range t.reported {
+		metrics.SetVMSSUnconvergedInstances(meta.resourceGroup, meta.vmssName, counts[meta])
+	}
+}
+
+// runVMSSConvergenceLoop periodically retries the update of the unconverged VMSS VMs.
+func (az *Cloud) runVMSSConvergenceLoop(ctx context.Context, interval time.Duration) {
+	ss, ok := az.VMSet.(*ScaleSet)
+	if !ok {
+		klog.V(2).Info("runVMSSConvergenceLoop: the vmType is not vmss, skip running")
+		return
+	}
+
+	klog.V(2).Info("runVMSSConvergenceLoop: started")
+	err := wait.PollUntilContextCancel(ctx, interval, false, func(ctx context.Context) (bool, error) {
+		if err := ss.convergeVMSSVMs(); err != nil {
+			klog.Warningf("runVMSSConvergenceLoop: failed to converge the VMSS VMs: %s", err.Error())
+		}
+		return false, nil
+	})
+	klog.Infof("runVMSSConvergenceLoop: stopped due to %s", err.Error())
+}
+
+// convergeVMSSVMs retries the update of the unconverged VMSS VMs only. The VMSS VMs are updated
+// in parallel with the same bounded concurrency of the chunked VMSS VM updates.
+func (ss *ScaleSet) convergeVMSSVMs() error {
+	instances := ss.vmssConvergence.snapshot()
+	if len(instances) == 0 {
+		return nil
+	}
+	klog.V(2).Infof("convergeVMSSVMs: %d VMSS VMs are not converged", len(instances))
+
+	nodeNames := make([]string, 0, len(instances))
+	for nodeName := range instances {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+
+	var errsLock sync.Mutex
+	errs := make([]error, 0)
+	concurrency := make(chan struct{}, ss.getVMSSVMUpdateChunkConcurrency())
+	wg := sync.WaitGroup{}
+	for _, nodeName := range nodeNames {
+		nodeName := nodeName
+		state := instances[nodeName]
+		concurrency <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-concurrency }()
+			if err := ss.convergeVMSSVM(nodeName, state); err != nil {
+				errsLock.Lock()
+				errs = append(errs, fmt.Errorf("node %s: %w", nodeName, err))
+				errsLock.Unlock()
+				return
+			}
+			ss.vmssConvergence.converge(nodeName, state)
+		}()
+	}
+	wg.Wait()
+
+	return utilerrors.Flatten(utilerrors.NewAggregate(errs))
+}
+
+// convergeVMSSVM applies the desired backend pool membership to the VMSS VM of the node.
+func (ss *ScaleSet) convergeVMSSVM(nodeName string, state *vmssInstanceState) error {
+	var toRemove, toAdd []string
+	for key, member := range state.backendPools {
+		if member {
+			toAdd = append(toAdd, state.backendPoolIDs[key])
+		} else {
+			toRemove = append(toRemove, state.backendPoolIDs[key])
+		}
+	}
+	sort.Strings(toRemove)
+	sort.Strings(toAdd)
+
+	update := func(vm *compute.VirtualMachineScaleSetVM) error {
+		defer func() {
+			_ = ss.DeleteCacheForNode(nodeName)
+		}()
+		ctx, cancel := getContextWithCancel()
+		defer cancel()
+		rerr := ss.VirtualMachineScaleSetVMsClient.UpdateVMs(ctx, state.meta.resourceGroup, state.meta.vmssName, map[string]compute.VirtualMachineScaleSetVM{state.instanceID: *vm}, "network_update", 0)
+		if rerr != nil {
+			return rerr.Error()
+		}
+		return nil
+	}
+
+	if len(toRemove) > 0 {
+		_, _, _, vm, err := ss.ensureBackendPoolDeletedFromNode(nodeName, toRemove)
+		if err != nil {
+			if errors.Is(err, cloudprovider.InstanceNotFound) {
+				return nil
+			}
+			return err
+		}
+		if vm != nil {
+			if err := update(vm); err != nil {
+				return err
+			}
+		}
+	}
+	for _, backendPoolID := range toAdd {
+		_, _, _, vm, err := ss.EnsureHostInPool(&v1.Service{}, types.NodeName(nodeName), backendPoolID, "")
+		if err != nil {
+			return err
+		}
+		if vm != nil {
+			if err := update(vm); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
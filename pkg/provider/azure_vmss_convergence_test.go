@@ -0,0 +1,168 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestVMSSConvergenceTrackerTrack(t *testing.T) {
+	meta := vmssMetaInfo{vmssName: "vmss", resourceGroup: "rg"}
+	nodeNames := map[string]string{"0": "node-0", "1": "node-1"}
+	tracker := vmssConvergenceTracker{}
+
+	tracker.track(meta, nodeNames, sets.New("0"), []string{"Pool1"}, true)
+	instances := tracker.snapshot()
+	assert.Len(t, instances, 1)
+	assert.Equal(t, map[string]bool{"pool1": true}, instances["node-0"].backendPools)
+	assert.Equal(t, "Pool1", instances["node-0"].backendPoolIDs["pool1"])
+
+	// A later failure of removing the backend pool overrides the desired membership.
+	tracker.track(meta, nodeNames, sets.New("0", "1"), []string{"pool1", "pool2"}, false)
+	instances = tracker.snapshot()
+	assert.Len(t, instances, 2)
+	assert.Equal(t, map[string]bool{"pool1": false, "pool2": false}, instances["node-0"].backendPools)
+
+	// The replaced state is not removed by the convergence of the old state.
+	oldState := instances["node-1"]
+	tracker.track(meta, nodeNames, sets.New("1"), []string{"pool3"}, true)
+	tracker.converge("node-1", oldState)
+	assert.Len(t, tracker.snapshot(), 2)
+
+	// A successful update clears the desired membership of the backend pools.
+	tracker.track(meta, nodeNames, sets.New[string](), []string{"pool1", "pool2"}, true)
+	instances = tracker.snapshot()
+	assert.Len(t, instances, 1)
+	assert.Equal(t, map[string]bool{"pool3": true}, instances["node-1"].backendPools)
+
+	tracker.converge("node-1", instances["node-1"])
+	assert.Empty(t, tracker.snapshot())
+}
+
+func TestConvergeVMSSVMs(t *testing.T) {
+	for _, tc := range []struct {
+		description     string
+		member          bool
+		updateErr       *retry.Error
+		expectedUpdates int
+		expectedErr     bool
+	}{
+		{
+			description:     "should add the unconverged VMSS VM to the backend pool",
+			member:          true,
+			expectedUpdates: 1,
+		},
+		{
+			description:     "should remove the unconverged VMSS VM from the backend pool",
+			expectedUpdates: 1,
+		},
+		{
+			description:     "should keep the VMSS VM unconverged if the update fails",
+			member:          true,
+			updateErr:       &retry.Error{RawError: fmt.Errorf("error")},
+			expectedUpdates: 1,
+			expectedErr:     true,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			ss, err := NewTestScaleSet(ctrl)
+			assert.NoError(t, err)
+			ss.LoadBalancerSku = consts.LoadBalancerSkuStandard
+
+			expectedVMSS := buildTestVMSSWithLB(testVMSSName, "vmss-vm-", []string{testLBBackendpoolID0}, false)
+			mockVMSSClient := ss.cloud.VirtualMachineScaleSetsClient.(*mockvmssclient.MockInterface)
+			mockVMSSClient.EXPECT().List(gomock.Any(), ss.ResourceGroup).Return([]compute.VirtualMachineScaleSet{expectedVMSS}, nil).AnyTimes()
+			expectedVMSSVMs, _, _ := buildTestVirtualMachineEnv(ss.cloud, testVMSSName, "", 0, []string{"vmss-vm-000000"}, "", false)
+			mockVMSSVMClient := ss.cloud.VirtualMachineScaleSetVMsClient.(*mockvmssvmclient.MockInterface)
+			mockVMSSVMClient.EXPECT().List(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any()).Return(expectedVMSSVMs, nil).AnyTimes()
+			mockVMSSVMClient.EXPECT().UpdateVMs(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any(), gomock.Any(), gomock.Any()).Return(tc.updateErr).Times(tc.expectedUpdates)
+			mockVMClient := ss.cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+			mockVMClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			backendPoolID := testLBBackendpoolID0
+			if tc.member {
+				backendPoolID = testLBBackendpoolID1
+			}
+			meta := vmssMetaInfo{vmssName: testVMSSName, resourceGroup: ss.ResourceGroup}
+			ss.vmssConvergence.track(meta, map[string]string{"0": "vmss-vm-000000"}, sets.New("0"), []string{backendPoolID}, tc.member)
+
+			err = ss.convergeVMSSVMs()
+			assert.Equal(t, tc.expectedErr, err != nil)
+			if tc.expectedErr {
+				assert.Len(t, ss.vmssConvergence.snapshot(), 1)
+			} else {
+				assert.Empty(t, ss.vmssConvergence.snapshot())
+			}
+		})
+	}
+}
+
+func TestEnsureHostsInPoolTracksUnconvergedVMSSVMs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ss, err := NewTestScaleSet(ctrl)
+	assert.NoError(t, err)
+	ss.LoadBalancerSku = consts.LoadBalancerSkuStandard
+
+	expectedVMSS := buildTestVMSSWithLB(testVMSSName, "vmss-vm-", []string{testLBBackendpoolID0}, false)
+	mockVMSSClient := ss.cloud.VirtualMachineScaleSetsClient.(*mockvmssclient.MockInterface)
+	mockVMSSClient.EXPECT().List(gomock.Any(), ss.ResourceGroup).Return([]compute.VirtualMachineScaleSet{expectedVMSS}, nil).AnyTimes()
+	mockVMSSClient.EXPECT().Get(gomock.Any(), ss.ResourceGroup, testVMSSName).Return(expectedVMSS, nil).MaxTimes(1)
+	// The VMSS model is updated even if the VMSS VM update fails.
+	mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any()).Return(nil).Times(1)
+
+	expectedVMSSVMs, _, _ := buildTestVirtualMachineEnv(ss.cloud, testVMSSName, "", 0, []string{"vmss-vm-000000"}, "", false)
+	mockVMSSVMClient := ss.cloud.VirtualMachineScaleSetVMsClient.(*mockvmssvmclient.MockInterface)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any()).Return(expectedVMSSVMs, nil).AnyTimes()
+	mockVMSSVMClient.EXPECT().UpdateVMs(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any(), gomock.Any(), gomock.Any()).Return(&retry.Error{RawError: fmt.Errorf("error")}).Times(1)
+	mockVMClient := ss.cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "vmss-vm-000000"},
+			Spec: v1.NodeSpec{
+				ProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/0",
+			},
+		},
+	}
+	err = ss.EnsureHostsInPool(&v1.Service{}, nodes, testLBBackendpoolID1, testVMSSName)
+	assert.Error(t, err)
+
+	instances := ss.vmssConvergence.snapshot()
+	assert.Len(t, instances, 1)
+	assert.Equal(t, "0", instances["vmss-vm-000000"].instanceID)
+	assert.True(t, instances["vmss-vm-000000"].backendPools[strings.ToLower(testLBBackendpoolID1)])
+}
@@ -1358,16 +1358,21 @@ func TestExtractScaleSetNameByProviderID(t *testing.T) {
 	assert.Equal(t, "", vmssName, "extractScaleSetNameByProviderID should return an empty string")
 }
 
-func TestExtractResourceGroupByProviderID(t *testing.T) {
-	providerID := "/subscriptions/script/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/vmss-vm-000000"
-	vmssName, err := extractResourceGroupByProviderID(providerID)
-	assert.Nil(t, err, fmt.Errorf("unexpected error %w happened", err))
-	assert.Equal(t, "rg", vmssName, "extractScaleSetNameByProviderID should return the correct vmss name")
+func TestGetNodeNameByProviderIDOfAvailabilitySetNode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-	providerID = "/invalid/id"
-	vmssName, err = extractResourceGroupByProviderID(providerID)
-	assert.Equal(t, ErrorNotVmssInstance, err, "extractScaleSetNameByProviderID should return the error of ErrorNotVmssInstance if the providerID is not a valid vmss ID")
-	assert.Equal(t, "", vmssName, "extractScaleSetNameByProviderID should return an empty string")
+	ss, err := NewTestScaleSet(ctrl)
+	assert.NoError(t, err)
+	// All nodes are regarded as VMSS uniform instances, while a node pool of standalone VMs is still there.
+	ss.DisableAvailabilitySetNodes = true
+
+	nodeName, err := ss.GetNodeNameByProviderID("azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1")
+	assert.NoError(t, err)
+	assert.Equal(t, types.NodeName("vm1"), nodeName)
+
+	_, err = ss.GetNodeNameByProviderID("azure:///invalid/id")
+	assert.Error(t, err)
 }
 
 func TestListScaleSets(t *testing.T) {
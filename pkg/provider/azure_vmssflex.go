@@ -37,6 +37,7 @@ import (
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/providerid"
 )
 
 var (
@@ -163,13 +164,12 @@ func (fs *FlexScaleSet) GetVMSetNames(service *v1.Service, nodes []*v1.Node) (*[
 // Different from vmas where vm name is always equal to nodeName, we need to further map vmName to actual nodeName in vmssflex.
 // Note: nodeName is always equal pointer.StringDerefs.ToLower(*vm.OsProfile.ComputerName, "")
 func (fs *FlexScaleSet) GetNodeNameByProviderID(providerID string) (types.NodeName, error) {
-	// NodeName is part of providerID for standard instances.
-	matches := providerIDRE.FindStringSubmatch(providerID)
-	if len(matches) != 2 {
+	parsed, err := providerid.Parse(providerID)
+	if err != nil || parsed.IsScaleSetVM() {
 		return "", errors.New("error splitting providerID")
 	}
 
-	nodeName, err := fs.getNodeNameByVMName(matches[1])
+	nodeName, err := fs.getNodeNameByVMName(parsed.Name)
 	if err != nil {
 		return "", err
 	}
@@ -269,12 +269,8 @@ func (fs *FlexScaleSet) GetPowerStatusByNodeName(name string) (powerState string
 	}
 
 	if vm.InstanceView != nil && vm.InstanceView.Statuses != nil {
-		statuses := *vm.InstanceView.Statuses
-		for _, status := range statuses {
-			state := pointer.StringDeref(status.Code, "")
-			if strings.HasPrefix(state, vmPowerStatePrefix) {
-				return strings.TrimPrefix(state, vmPowerStatePrefix), nil
-			}
+		if powerState, found := getPowerStateFromStatuses(*vm.InstanceView.Statuses); found {
+			return powerState, nil
 		}
 	}
 
@@ -406,11 +402,11 @@ func (fs *FlexScaleSet) getNodeInformationByIPConfigurationID(ipConfigurationID
 		return "", "", "", fmt.Errorf("failed to get vm ID of ip config ID %s", ipConfigurationID)
 	}
 	vmID := pointer.StringDeref(nic.InterfacePropertiesFormat.VirtualMachine.ID, "")
-	matches = vmIDRE.FindStringSubmatch(vmID)
-	if len(matches) != 2 {
+	parsedVMID, err := providerid.Parse(vmID)
+	if err != nil || parsedVMID.IsScaleSetVM() {
 		return "", "", "", fmt.Errorf("invalid virtual machine ID %s", vmID)
 	}
-	vmName := matches[1]
+	vmName := parsedVMID.Name
 
 	nodeName, err := fs.getNodeNameByVMName(vmName)
 	if err != nil {
@@ -730,8 +726,7 @@ func (fs *FlexScaleSet) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node,
 	defer func() {
 		mc.ObserveOperationWithResult(isOperationSucceeded)
 	}()
-	hostUpdates := make([]func() error, 0, len(nodes))
-
+	hostGroups := make(map[string][]string)
 	for _, node := range nodes {
 		localNodeName := node.Name
 		if fs.useStandardLoadBalancer() && fs.excludeMasterNodesFromStandardLB() && isControlPlaneNode(node) {
@@ -749,22 +744,24 @@ func (fs *FlexScaleSet) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node,
 			continue
 		}
 
-		f := func() error {
-			_, _, _, _, err := fs.EnsureHostInPool(service, types.NodeName(localNodeName), backendPoolID, vmSetNameOfLB)
-			if err != nil {
-				return fmt.Errorf("ensure(%s): backendPoolID(%s) - failed to ensure host in pool: %w", getServiceName(service), backendPoolID, err)
-			}
-			return nil
-		}
-		hostUpdates = append(hostUpdates, f)
+		// The nodes whose VMSS Flex can't be got are grouped together and fail in EnsureHostInPool.
+		vmssFlexName, _ := fs.getNodeVmssFlexName(localNodeName)
+		vmssFlexName = strings.ToLower(vmssFlexName)
+		hostGroups[vmssFlexName] = append(hostGroups[vmssFlexName], localNodeName)
 	}
 
-	errs := utilerrors.AggregateGoroutines(hostUpdates...)
-	if errs != nil {
-		return utilerrors.Flatten(errs)
+	err := fs.ensureHostGroupsInPool(hostGroups, func(nodeName string) error {
+		_, _, _, _, err := fs.EnsureHostInPool(service, types.NodeName(nodeName), backendPoolID, vmSetNameOfLB)
+		if err != nil {
+			return fmt.Errorf("ensure(%s): backendPoolID(%s) - failed to ensure host in pool: %w", getServiceName(service), backendPoolID, err)
+		}
+		return nil
+	}, fs.DeleteCacheForNode)
+	if err != nil {
+		return err
 	}
 
-	err := fs.ensureVMSSFlexInPool(service, nodes, backendPoolID, vmSetNameOfLB)
+	err = fs.ensureVMSSFlexInPool(service, nodes, backendPoolID, vmSetNameOfLB)
 	if err != nil {
 		return err
 	}
@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/providerid"
 	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
 )
 
@@ -33,8 +34,8 @@ var (
 	routeTableCacheTTLDefaultInSeconds   = 120
 	publicIPCacheTTLDefaultInSeconds     = 120
 	plsCacheTTLDefaultInSeconds          = 120
+	computeSKUCacheTTLDefaultInSeconds   = 86400
 
-	azureNodeProviderIDRE    = regexp.MustCompile(`^azure:///subscriptions/(?:.*)/resourceGroups/(?:.*)/providers/Microsoft.Compute/(?:.*)`)
 	azureResourceGroupNameRE = regexp.MustCompile(`.*/subscriptions/(?:.*)/resourceGroups/(.+)/providers/(?:.*)`)
 )
 
@@ -57,6 +58,11 @@ func (az *Cloud) useStandardLoadBalancer() bool {
 	return strings.EqualFold(az.LoadBalancerSku, consts.LoadBalancerSkuStandard)
 }
 
+// useNATGatewayOutbound returns true if the outbound traffic of the nodes is handled by the NAT gateway.
+func (az *Cloud) useNATGatewayOutbound() bool {
+	return az.useStandardLoadBalancer() && strings.EqualFold(az.OutboundType, consts.OutboundTypeNATGateway)
+}
+
 func (az *Cloud) excludeMasterNodesFromStandardLB() bool {
 	return az.ExcludeMasterFromStandardLB != nil && *az.ExcludeMasterFromStandardLB
 }
@@ -84,7 +90,7 @@ func (az *Cloud) IsNodeUnmanaged(nodeName string) (bool, error) {
 // IsNodeUnmanagedByProviderID returns true if the node is not managed by Azure cloud provider.
 // All managed node's providerIDs are in format 'azure:///subscriptions/<id>/resourceGroups/<rg>/providers/Microsoft.Compute/.*'
 func (az *Cloud) IsNodeUnmanagedByProviderID(providerID string) bool {
-	return !azureNodeProviderIDRE.Match([]byte(providerID))
+	return !providerid.IsAzure(providerID)
 }
 
 // ConvertResourceGroupNameToLower converts the resource group name in the resource ID to be lowered.
@@ -143,6 +143,10 @@ func TestIsNodeUnmanagedByProviderID(t *testing.T) {
 			providerID: "k8s-agent-AAAAAAAA-0",
 			expected:   true,
 		},
+		{
+			providerID: consts.CloudProviderName + ":///subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.HybridCompute/machines/k8s-agent-AAAAAAAA-0",
+			expected:   true,
+		},
 	}
 
 	az := GetTestCloud(ctrl)
@@ -60,6 +60,12 @@ type AzureAuthConfig struct {
 	AADClientCertPath string `json:"aadClientCertPath,omitempty" yaml:"aadClientCertPath,omitempty"`
 	// The password of the client certificate for an AAD application with RBAC access to talk to Azure RM APIs
 	AADClientCertPassword string `json:"aadClientCertPassword,omitempty" yaml:"aadClientCertPassword,omitempty" datapolicy:"password"`
+	// The URL of the Azure Key Vault storing the client certificate for an AAD application with RBAC access to talk to Azure RM APIs,
+	// e.g. https://vault-name.vault.azure.net/. The certificate is read with the managed identity of the virtual machine, or the one
+	// specified by UserAssignedIdentityID, and is re-fetched when it expires or is rotated.
+	AADClientCertKeyVaultURL string `json:"aadClientCertKeyVaultURL,omitempty" yaml:"aadClientCertKeyVaultURL,omitempty"`
+	// The name of the client certificate in the Azure Key Vault specified by AADClientCertKeyVaultURL
+	AADClientCertKeyVaultCertName string `json:"aadClientCertKeyVaultCertName,omitempty" yaml:"aadClientCertKeyVaultCertName,omitempty"`
 	// Use managed service identity for the virtual machine to access Azure ARM APIs
 	UseManagedIdentityExtension bool `json:"useManagedIdentityExtension,omitempty" yaml:"useManagedIdentityExtension,omitempty"`
 	// UserAssignedIdentityID contains the Client ID of the user assigned MSI which is assigned to the underlying VMs. If empty the user assigned identity is not used.
@@ -82,6 +88,50 @@ type AzureAuthConfig struct {
 	AADFederatedTokenFile string `json:"aadFederatedTokenFile,omitempty" yaml:"aadFederatedTokenFile,omitempty"`
 	// Use workload identity federation for the virtual machine to access Azure ARM APIs
 	UseFederatedWorkloadIdentityExtension bool `json:"useFederatedWorkloadIdentityExtension,omitempty" yaml:"useFederatedWorkloadIdentityExtension,omitempty"`
+	// ActiveDirectoryEndpoint overrides the AAD authority host of the cloud environment.
+	// It is used by custom or disconnected clouds whose environment does not report the right endpoint.
+	ActiveDirectoryEndpoint string `json:"activeDirectoryEndpoint,omitempty" yaml:"activeDirectoryEndpoint,omitempty"`
+	// TokenAudience overrides the resource the access tokens are requested for.
+	// It is used by custom or disconnected clouds whose environment does not report the right audience.
+	TokenAudience string `json:"tokenAudience,omitempty" yaml:"tokenAudience,omitempty"`
+}
+
+// AuthEndpoints holds the endpoints used to acquire the access tokens of a cloud.
+type AuthEndpoints struct {
+	// ActiveDirectoryEndpoint is the AAD authority host.
+	ActiveDirectoryEndpoint string
+	// TokenAudience is the resource the service principal and managed identity tokens are requested for.
+	TokenAudience string
+	// FederatedTokenAudience is the resource the workload identity tokens are requested for.
+	FederatedTokenAudience string
+}
+
+// GetAuthEndpoints resolves the token audiences and the AAD authority host of the cloud environment,
+// e.g., Azure public cloud, Azure China, Azure Government or Azure Stack.
+// The endpoints set in the AzureAuthConfig take precedence over the ones of the environment.
+func GetAuthEndpoints(config *AzureAuthConfig, env *azure.Environment) *AuthEndpoints {
+	endpoints := &AuthEndpoints{
+		ActiveDirectoryEndpoint: env.ActiveDirectoryEndpoint,
+		TokenAudience:           env.ServiceManagementEndpoint,
+		FederatedTokenAudience:  env.ResourceManagerEndpoint,
+	}
+	// the environments loaded from the metadata endpoint of a custom cloud may only report the token audience
+	if endpoints.TokenAudience == "" {
+		endpoints.TokenAudience = env.TokenAudience
+	}
+	if endpoints.FederatedTokenAudience == "" {
+		endpoints.FederatedTokenAudience = endpoints.TokenAudience
+	}
+
+	if config.ActiveDirectoryEndpoint != "" {
+		endpoints.ActiveDirectoryEndpoint = config.ActiveDirectoryEndpoint
+	}
+	if config.TokenAudience != "" {
+		endpoints.TokenAudience = config.TokenAudience
+		endpoints.FederatedTokenAudience = config.TokenAudience
+	}
+
+	return endpoints
 }
 
 // GetServicePrincipalToken creates a new service principal token based on the configuration.
@@ -100,13 +150,14 @@ func GetServicePrincipalToken(config *AzureAuthConfig, env *azure.Environment, r
 		tenantID = config.TenantID
 	}
 
+	endpoints := GetAuthEndpoints(config, env)
 	if resource == "" {
-		resource = env.ServiceManagementEndpoint
+		resource = endpoints.TokenAudience
 	}
 
 	if config.UseFederatedWorkloadIdentityExtension {
 		klog.V(2).Infoln("azure: using workload identity extension to retrieve access token")
-		oauthConfig, err := adal.NewOAuthConfigWithAPIVersion(env.ActiveDirectoryEndpoint, config.TenantID, nil)
+		oauthConfig, err := adal.NewOAuthConfigWithAPIVersion(endpoints.ActiveDirectoryEndpoint, config.TenantID, nil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create the OAuth config: %w", err)
 		}
@@ -119,7 +170,7 @@ func GetServicePrincipalToken(config *AzureAuthConfig, env *azure.Environment, r
 			return string(jwt), nil
 		}
 
-		token, err := adal.NewServicePrincipalTokenFromFederatedTokenCallback(*oauthConfig, config.AADClientID, jwtCallback, env.ResourceManagerEndpoint)
+		token, err := adal.NewServicePrincipalTokenFromFederatedTokenCallback(*oauthConfig, config.AADClientID, jwtCallback, endpoints.FederatedTokenAudience)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create a workload identity token: %w", err)
 		}
@@ -128,34 +179,10 @@ func GetServicePrincipalToken(config *AzureAuthConfig, env *azure.Environment, r
 
 	if config.UseManagedIdentityExtension {
 		klog.V(2).Infoln("azure: using managed identity extension to retrieve access token")
-		msiEndpoint, err := adal.GetMSIVMEndpoint()
-		if err != nil {
-			return nil, fmt.Errorf("error getting the managed service identity endpoint: %w", err)
-		}
-		if len(config.UserAssignedIdentityID) > 0 {
-			klog.V(4).Info("azure: using User Assigned MSI ID to retrieve access token")
-			resourceID, err := azure.ParseResourceID(config.UserAssignedIdentityID)
-			if err == nil &&
-				strings.EqualFold(resourceID.Provider, "Microsoft.ManagedIdentity") &&
-				strings.EqualFold(resourceID.ResourceType, "userAssignedIdentities") {
-				klog.V(4).Info("azure: User Assigned MSI ID is resource ID")
-				return adal.NewServicePrincipalTokenFromMSIWithIdentityResourceID(msiEndpoint,
-					resource,
-					config.UserAssignedIdentityID)
-			}
-
-			klog.V(4).Info("azure: User Assigned MSI ID is client ID")
-			return adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(msiEndpoint,
-				resource,
-				config.UserAssignedIdentityID)
-		}
-		klog.V(4).Info("azure: using System Assigned MSI to retrieve access token")
-		return adal.NewServicePrincipalTokenFromMSI(
-			msiEndpoint,
-			resource)
+		return getManagedIdentityToken(config, resource)
 	}
 
-	oauthConfig, err := adal.NewOAuthConfigWithAPIVersion(env.ActiveDirectoryEndpoint, tenantID, nil)
+	oauthConfig, err := adal.NewOAuthConfigWithAPIVersion(endpoints.ActiveDirectoryEndpoint, tenantID, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating the OAuth config: %w", err)
 	}
@@ -169,6 +196,19 @@ func GetServicePrincipalToken(config *AzureAuthConfig, env *azure.Environment, r
 			resource)
 	}
 
+	if len(config.AADClientCertKeyVaultURL) > 0 && len(config.AADClientCertKeyVaultCertName) > 0 {
+		klog.V(2).Infoln("azure: using jwt client_assertion (client certificate in Azure Key Vault) to retrieve access token")
+		secret, err := getKeyVaultCertificateSecret(config, env)
+		if err != nil {
+			return nil, err
+		}
+		return adal.NewServicePrincipalTokenWithSecret(
+			*oauthConfig,
+			config.AADClientID,
+			resource,
+			secret)
+	}
+
 	if len(config.AADClientCertPath) > 0 && len(config.AADClientCertPassword) > 0 {
 		klog.V(2).Infoln("azure: using jwt client_assertion (client_cert+client_private_key) to retrieve access token")
 		certData, err := os.ReadFile(config.AADClientCertPath)
@@ -190,6 +230,75 @@ func GetServicePrincipalToken(config *AzureAuthConfig, env *azure.Environment, r
 	return nil, ErrorNoAuth
 }
 
+// getManagedIdentityToken returns the cached token of the managed identity for the resource. The token is shared
+// by all the clients using the same identity and resource, and is refreshed in the background before it expires.
+func getManagedIdentityToken(config *AzureAuthConfig, resource string) (*adal.ServicePrincipalToken, error) {
+	msiEndpoint, err := adal.GetMSIVMEndpoint()
+	if err != nil {
+		return nil, fmt.Errorf("error getting the managed service identity endpoint: %w", err)
+	}
+
+	key := tokenCacheKey{
+		identity: config.UserAssignedIdentityID,
+		audience: resource,
+		endpoint: msiEndpoint,
+	}
+	return defaultTokenCache.getOrCreate(key, func() (*adal.ServicePrincipalToken, error) {
+		if len(config.UserAssignedIdentityID) > 0 {
+			klog.V(4).Info("azure: using User Assigned MSI ID to retrieve access token")
+			resourceID, err := azure.ParseResourceID(config.UserAssignedIdentityID)
+			if err == nil &&
+				strings.EqualFold(resourceID.Provider, "Microsoft.ManagedIdentity") &&
+				strings.EqualFold(resourceID.ResourceType, "userAssignedIdentities") {
+				klog.V(4).Info("azure: User Assigned MSI ID is resource ID")
+				return adal.NewServicePrincipalTokenFromMSIWithIdentityResourceID(msiEndpoint,
+					resource,
+					config.UserAssignedIdentityID)
+			}
+
+			klog.V(4).Info("azure: User Assigned MSI ID is client ID")
+			return adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(msiEndpoint,
+				resource,
+				config.UserAssignedIdentityID)
+		}
+		klog.V(4).Info("azure: using System Assigned MSI to retrieve access token")
+		return adal.NewServicePrincipalTokenFromMSI(
+			msiEndpoint,
+			resource)
+	})
+}
+
+// getManagedIdentityFederatedToken returns the cached token of the application AADClientID in the tenant for the
+// resource. The application is a multi-tenant application trusting the managed identity as a federated credential,
+// and the token is acquired by exchanging the token of the managed identity.
+func getManagedIdentityFederatedToken(config *AzureAuthConfig, endpoints *AuthEndpoints, tenantID, resource string) (*adal.ServicePrincipalToken, error) {
+	assertion, err := getManagedIdentityToken(config, tokenExchangeAudience)
+	if err != nil {
+		return nil, err
+	}
+
+	key := tokenCacheKey{
+		identity: config.AADClientID,
+		tenantID: tenantID,
+		audience: resource,
+		endpoint: endpoints.ActiveDirectoryEndpoint,
+	}
+	return defaultTokenCache.getOrCreate(key, func() (*adal.ServicePrincipalToken, error) {
+		oauthConfig, err := adal.NewOAuthConfigWithAPIVersion(endpoints.ActiveDirectoryEndpoint, tenantID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating the OAuth config for tenant %s: %w", tenantID, err)
+		}
+
+		jwtCallback := func() (string, error) {
+			if err := assertion.EnsureFresh(); err != nil {
+				return "", fmt.Errorf("failed to get the managed identity token for the token exchange: %w", err)
+			}
+			return assertion.OAuthToken(), nil
+		}
+		return adal.NewServicePrincipalTokenFromFederatedTokenCallback(*oauthConfig, config.AADClientID, jwtCallback, resource)
+	})
+}
+
 // GetMultiTenantServicePrincipalToken is used when (and only when) NetworkResourceTenantID and NetworkResourceSubscriptionID are specified to have different values than TenantID and SubscriptionID.
 //
 // In that scenario, network resources are deployed in different AAD Tenant and Subscription than those for the cluster,
@@ -204,19 +313,36 @@ func GetMultiTenantServicePrincipalToken(config *AzureAuthConfig, env *azure.Env
 		return nil, fmt.Errorf("got error getting multi-tenant service principal token: %w", err)
 	}
 
+	endpoints := GetAuthEndpoints(config, env)
 	multiTenantOAuthConfig, err := adal.NewMultiTenantOAuthConfig(
-		env.ActiveDirectoryEndpoint, config.TenantID, []string{config.NetworkResourceTenantID}, adal.OAuthOptions{})
+		endpoints.ActiveDirectoryEndpoint, config.TenantID, []string{config.NetworkResourceTenantID}, adal.OAuthOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("creating the multi-tenant OAuth config: %w", err)
 	}
 
+	if config.UseManagedIdentityExtension {
+		klog.V(2).Infoln("azure: using managed identity extension to retrieve multi-tenant access token")
+		primaryToken, err := getManagedIdentityFederatedToken(config, endpoints, config.TenantID, endpoints.TokenAudience)
+		if err != nil {
+			return nil, fmt.Errorf("creating the primary token: %w", err)
+		}
+		auxiliaryToken, err := getManagedIdentityFederatedToken(config, endpoints, config.NetworkResourceTenantID, endpoints.TokenAudience)
+		if err != nil {
+			return nil, fmt.Errorf("creating the auxiliary token for network resources tenant: %w", err)
+		}
+		return &adal.MultiTenantServicePrincipalToken{
+			PrimaryToken:    primaryToken,
+			AuxiliaryTokens: []*adal.ServicePrincipalToken{auxiliaryToken},
+		}, nil
+	}
+
 	if len(config.AADClientSecret) > 0 {
 		klog.V(2).Infoln("azure: using client_id+client_secret to retrieve multi-tenant access token")
 		return adal.NewMultiTenantServicePrincipalToken(
 			multiTenantOAuthConfig,
 			config.AADClientID,
 			config.AADClientSecret,
-			env.ServiceManagementEndpoint)
+			endpoints.TokenAudience)
 	}
 
 	if len(config.AADClientCertPath) > 0 && len(config.AADClientCertPassword) > 0 {
@@ -238,18 +364,24 @@ func GetNetworkResourceServicePrincipalToken(config *AzureAuthConfig, env *azure
 		return nil, fmt.Errorf("got error(%w) in getting network resources service principal token", err)
 	}
 
-	oauthConfig, err := adal.NewOAuthConfigWithAPIVersion(env.ActiveDirectoryEndpoint, config.NetworkResourceTenantID, nil)
+	endpoints := GetAuthEndpoints(config, env)
+	oauthConfig, err := adal.NewOAuthConfigWithAPIVersion(endpoints.ActiveDirectoryEndpoint, config.NetworkResourceTenantID, nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating the OAuth config for network resources tenant: %w", err)
 	}
 
+	if config.UseManagedIdentityExtension {
+		klog.V(2).Infoln("azure: using managed identity extension to retrieve access token for network resources tenant")
+		return getManagedIdentityFederatedToken(config, endpoints, config.NetworkResourceTenantID, endpoints.TokenAudience)
+	}
+
 	if len(config.AADClientSecret) > 0 {
 		klog.V(2).Infoln("azure: using client_id+client_secret to retrieve access token for network resources tenant")
 		return adal.NewServicePrincipalToken(
 			*oauthConfig,
 			config.AADClientID,
 			config.AADClientSecret,
-			env.ServiceManagementEndpoint)
+			endpoints.TokenAudience)
 	}
 
 	if len(config.AADClientCertPath) > 0 && len(config.AADClientCertPassword) > 0 {
@@ -362,8 +494,9 @@ func (config *AzureAuthConfig) checkConfigWhenNetworkResourceInDifferentTenant()
 		return fmt.Errorf("ADFS identity system is not supported")
 	}
 
-	if config.UseManagedIdentityExtension {
-		return fmt.Errorf("managed identity is not supported")
+	// the managed identity is exchanged for the tokens of the multi-tenant application AADClientID
+	if config.UseManagedIdentityExtension && len(config.AADClientID) == 0 {
+		return fmt.Errorf("managed identity is not supported without AADClientID of a multi-tenant application federated with it")
 	}
 
 	return nil
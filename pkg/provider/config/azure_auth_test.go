@@ -21,7 +21,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/Azure/go-autorest/autorest/azure"
@@ -47,8 +49,6 @@ var (
 		},
 		{
 			TenantID:                      "TenantID",
-			AADClientID:                   "AADClientID",
-			AADClientSecret:               "AADClientSecret",
 			NetworkResourceTenantID:       "NetworkResourceTenantID",
 			NetworkResourceSubscriptionID: "NetworkResourceSubscriptionID",
 			UseManagedIdentityExtension:   true,
@@ -280,6 +280,56 @@ func TestGetMultiTenantServicePrincipalToken(t *testing.T) {
 	assert.Equal(t, multiTenantToken, spt)
 }
 
+func TestGetMultiTenantServicePrincipalTokenFromMSI(t *testing.T) {
+	config := &AzureAuthConfig{
+		TenantID:                      "TenantID",
+		AADClientID:                   "MultiTenantAADClientID",
+		UseManagedIdentityExtension:   true,
+		NetworkResourceTenantID:       "NetworkResourceTenantID",
+		NetworkResourceSubscriptionID: "NetworkResourceSubscriptionID",
+		ActiveDirectoryEndpoint:       "https://login.multitenant.test/",
+	}
+	env := &azure.PublicCloud
+
+	multiTenantToken, err := GetMultiTenantServicePrincipalToken(config, env)
+	assert.NoError(t, err)
+	networkToken, err := GetNetworkResourceServicePrincipalToken(config, env)
+	assert.NoError(t, err)
+	// the network resource clients share the auxiliary token of the network resources tenant
+	assert.Len(t, multiTenantToken.AuxiliaryTokens, 1)
+	assert.Same(t, multiTenantToken.AuxiliaryTokens[0], networkToken)
+	token, err := GetMultiTenantServicePrincipalToken(config, env)
+	assert.NoError(t, err)
+	assert.Same(t, multiTenantToken.PrimaryToken, token.PrimaryToken)
+
+	// the managed identity token is exchanged for the tokens of the multi-tenant application in both tenants
+	sender := adal.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		var accessToken string
+		if r.Method == http.MethodGet {
+			assert.Equal(t, tokenExchangeAudience, r.URL.Query().Get("resource"))
+			accessToken = "msi-token"
+		} else {
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "MultiTenantAADClientID", r.PostForm.Get("client_id"))
+			assert.Equal(t, "msi-token", r.PostForm.Get("client_assertion"))
+			accessToken = strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")[0] + "-token"
+		}
+		recorder := httptest.NewRecorder()
+		_, err := fmt.Fprintf(recorder, `{"access_token":%q,"expires_in":"3600","expires_on":"%d","resource":"resource","token_type":"Bearer"}`,
+			accessToken, time.Now().Add(time.Hour).Unix())
+		assert.NoError(t, err)
+		return recorder.Result(), nil
+	})
+	msiToken, err := getManagedIdentityToken(config, tokenExchangeAudience)
+	assert.NoError(t, err)
+	for _, spt := range []*adal.ServicePrincipalToken{msiToken, multiTenantToken.PrimaryToken, networkToken} {
+		spt.SetSender(sender)
+		assert.NoError(t, spt.EnsureFresh())
+	}
+	assert.Equal(t, "TenantID-token", multiTenantToken.PrimaryOAuthToken())
+	assert.Equal(t, []string{"NetworkResourceTenantID-token"}, multiTenantToken.AuxiliaryOAuthTokens())
+}
+
 func TestGetServicePrincipalTokenFromCertificate(t *testing.T) {
 	config := &AzureAuthConfig{
 		TenantID:              "TenantID",
@@ -424,3 +474,104 @@ func TestUsesNetworkResourceInDifferentTenant(t *testing.T) {
 	assert.Equal(t, config.UsesNetworkResourceInDifferentTenant(), false)
 	assert.Equal(t, config.UsesNetworkResourceInDifferentSubscription(), false)
 }
+
+func TestGetAuthEndpoints(t *testing.T) {
+	for _, tc := range []struct {
+		desc      string
+		cloudName string
+		env       *azure.Environment
+		config    *AzureAuthConfig
+		expected  *AuthEndpoints
+	}{
+		{
+			desc:      "should use the endpoints of Azure public cloud",
+			cloudName: "AzurePublicCloud",
+			config:    &AzureAuthConfig{},
+			expected: &AuthEndpoints{
+				ActiveDirectoryEndpoint: "https://login.microsoftonline.com/",
+				TokenAudience:           "https://management.core.windows.net/",
+				FederatedTokenAudience:  "https://management.azure.com/",
+			},
+		},
+		{
+			desc:      "should use the endpoints of Azure China",
+			cloudName: "AzureChinaCloud",
+			config:    &AzureAuthConfig{},
+			expected: &AuthEndpoints{
+				ActiveDirectoryEndpoint: "https://login.chinacloudapi.cn/",
+				TokenAudience:           "https://management.core.chinacloudapi.cn/",
+				FederatedTokenAudience:  "https://management.chinacloudapi.cn/",
+			},
+		},
+		{
+			desc:      "should use the endpoints of Azure Government",
+			cloudName: "AzureUSGovernmentCloud",
+			config:    &AzureAuthConfig{},
+			expected: &AuthEndpoints{
+				ActiveDirectoryEndpoint: "https://login.microsoftonline.us/",
+				TokenAudience:           "https://management.core.usgovcloudapi.net/",
+				FederatedTokenAudience:  "https://management.usgovcloudapi.net/",
+			},
+		},
+		{
+			desc: "should fall back to the token audience of the environment loaded from the metadata endpoint",
+			env: &azure.Environment{
+				ActiveDirectoryEndpoint: "https://adfs.local.azurestack.external/",
+				ResourceManagerEndpoint: "https://management.local.azurestack.external/",
+				TokenAudience:           "https://management.adfs.azurestack.local/",
+			},
+			config: &AzureAuthConfig{},
+			expected: &AuthEndpoints{
+				ActiveDirectoryEndpoint: "https://adfs.local.azurestack.external/",
+				TokenAudience:           "https://management.adfs.azurestack.local/",
+				FederatedTokenAudience:  "https://management.local.azurestack.external/",
+			},
+		},
+		{
+			desc:      "should use the endpoints overridden by the config",
+			cloudName: "AzurePublicCloud",
+			config: &AzureAuthConfig{
+				ActiveDirectoryEndpoint: "https://login.disconnected.local/",
+				TokenAudience:           "https://management.disconnected.local/",
+			},
+			expected: &AuthEndpoints{
+				ActiveDirectoryEndpoint: "https://login.disconnected.local/",
+				TokenAudience:           "https://management.disconnected.local/",
+				FederatedTokenAudience:  "https://management.disconnected.local/",
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			env := tc.env
+			if env == nil {
+				e, err := azure.EnvironmentFromName(tc.cloudName)
+				assert.NoError(t, err)
+				env = &e
+			}
+			assert.Equal(t, tc.expected, GetAuthEndpoints(tc.config, env))
+		})
+	}
+}
+
+func TestGetServicePrincipalTokenWithTokenAudienceOverride(t *testing.T) {
+	config := &AzureAuthConfig{
+		TenantID:                "TenantID",
+		AADClientID:             "AADClientID",
+		AADClientSecret:         "AADClientSecret",
+		ActiveDirectoryEndpoint: "https://login.disconnected.local/",
+		TokenAudience:           "https://management.disconnected.local/",
+	}
+	env, err := azure.EnvironmentFromName("AzurePublicCloud")
+	assert.NoError(t, err)
+
+	token, err := GetServicePrincipalToken(config, &env, "")
+	assert.NoError(t, err)
+
+	oauthConfig, err := adal.NewOAuthConfigWithAPIVersion(config.ActiveDirectoryEndpoint, config.TenantID, nil)
+	assert.NoError(t, err)
+
+	spt, err := adal.NewServicePrincipalToken(*oauthConfig, config.AADClientID, config.AADClientSecret, config.TokenAudience)
+	assert.NoError(t, err)
+
+	assert.Equal(t, token, spt)
+}
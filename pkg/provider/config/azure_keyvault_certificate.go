@@ -0,0 +1,279 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	"golang.org/x/crypto/pkcs12"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+const (
+	// keyVaultAPIVersion is the API version of the Azure Key Vault data plane.
+	keyVaultAPIVersion = "7.4"
+	// defaultKeyVaultResource is the resource the Azure Key Vault tokens are requested for if the cloud
+	// environment does not report it.
+	defaultKeyVaultResource = "https://vault.azure.net"
+	// keyVaultCertificateRefetchInterval is the interval of re-fetching the client certificate from
+	// Azure Key Vault to pick up the rotated certificate before the current one expires.
+	keyVaultCertificateRefetchInterval = time.Hour
+
+	keyVaultContentTypePKCS12 = "application/x-pkcs12"
+	keyVaultContentTypePEM    = "application/x-pem-file"
+)
+
+// keyVaultCertificateSecret implements adal.ServicePrincipalSecret with the client certificate stored in
+// Azure Key Vault. The certificate is fetched when a token is acquired for the first time, and re-fetched
+// when it expires or every keyVaultCertificateRefetchInterval to pick up the rotated certificate.
+type keyVaultCertificateSecret struct {
+	vaultURL        string
+	certificateName string
+	// token is the token of the managed identity reading the certificate.
+	token  *adal.ServicePrincipalToken
+	sender adal.Sender
+	now    func() time.Time
+
+	lock        sync.Mutex
+	certificate *x509.Certificate
+	privateKey  *rsa.PrivateKey
+	fetchedAt   time.Time
+}
+
+var (
+	keyVaultCertificateSecretsLock sync.Mutex
+	// keyVaultCertificateSecrets shares the certificates among the tokens of all the resources.
+	keyVaultCertificateSecrets = map[string]*keyVaultCertificateSecret{}
+)
+
+// getKeyVaultCertificateSecret returns the secret of the client certificate AADClientCertKeyVaultCertName
+// stored in the Azure Key Vault AADClientCertKeyVaultURL.
+func getKeyVaultCertificateSecret(config *AzureAuthConfig, env *azure.Environment) (*keyVaultCertificateSecret, error) {
+	vaultURL := strings.TrimSuffix(config.AADClientCertKeyVaultURL, "/")
+	if _, err := url.ParseRequestURI(vaultURL); err != nil {
+		return nil, fmt.Errorf("invalid aadClientCertKeyVaultURL %q: %w", config.AADClientCertKeyVaultURL, err)
+	}
+
+	resource := strings.TrimSuffix(env.KeyVaultEndpoint, "/")
+	if resource == "" {
+		resource = defaultKeyVaultResource
+	}
+	token, err := getManagedIdentityToken(config, resource)
+	if err != nil {
+		return nil, fmt.Errorf("creating the managed identity token for Azure Key Vault: %w", err)
+	}
+
+	keyVaultCertificateSecretsLock.Lock()
+	defer keyVaultCertificateSecretsLock.Unlock()
+
+	key := strings.ToLower(vaultURL) + "/" + config.AADClientCertKeyVaultCertName
+	if secret, ok := keyVaultCertificateSecrets[key]; ok {
+		return secret, nil
+	}
+	secret := &keyVaultCertificateSecret{
+		vaultURL:        vaultURL,
+		certificateName: config.AADClientCertKeyVaultCertName,
+		token:           token,
+		sender:          &http.Client{Timeout: time.Minute},
+		now:             time.Now,
+	}
+	keyVaultCertificateSecrets[key] = secret
+	return secret, nil
+}
+
+// SetAuthenticationValues implements adal.ServicePrincipalSecret. It populates the form submitted during
+// the token acquisition with a JWT signed with the current certificate.
+func (secret *keyVaultCertificateSecret) SetAuthenticationValues(spt *adal.ServicePrincipalToken, v *url.Values) error {
+	certificate, privateKey, err := secret.getCertificate()
+	if err != nil {
+		return err
+	}
+	certificateSecret := &adal.ServicePrincipalCertificateSecret{
+		Certificate: certificate,
+		PrivateKey:  privateKey,
+	}
+	return certificateSecret.SetAuthenticationValues(spt, v)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (secret *keyVaultCertificateSecret) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("marshalling keyVaultCertificateSecret is not supported")
+}
+
+// getCertificate returns the current certificate, and re-fetches it from Azure Key Vault if needed. The current
+// certificate is still used if the re-fetching fails before it expires.
+func (secret *keyVaultCertificateSecret) getCertificate() (*x509.Certificate, *rsa.PrivateKey, error) {
+	secret.lock.Lock()
+	defer secret.lock.Unlock()
+
+	now := secret.now()
+	valid := secret.certificate != nil && now.Before(secret.certificate.NotAfter)
+	if !valid || now.Sub(secret.fetchedAt) >= keyVaultCertificateRefetchInterval {
+		certificate, privateKey, err := secret.fetchCertificate()
+		switch {
+		case err == nil:
+			if secret.certificate == nil || !secret.certificate.Equal(certificate) {
+				klog.V(2).Infof("azure: fetched the client certificate %s from Azure Key Vault %s, thumbprint %x, expires at %v",
+					secret.certificateName, secret.vaultURL, certificateThumbprint(certificate), certificate.NotAfter)
+			}
+			secret.certificate, secret.privateKey, secret.fetchedAt = certificate, privateKey, now
+		case valid:
+			klog.Warningf("azure: failed to re-fetch the client certificate %s from Azure Key Vault %s, using the current one expiring at %v: %v",
+				secret.certificateName, secret.vaultURL, secret.certificate.NotAfter, err)
+		default:
+			return nil, nil, fmt.Errorf("fetching the client certificate %s from Azure Key Vault %s: %w", secret.certificateName, secret.vaultURL, err)
+		}
+	}
+
+	metrics.SetAADClientCertificateAge(secret.vaultURL, secret.certificateName, now.Sub(secret.certificate.NotBefore))
+	return secret.certificate, secret.privateKey, nil
+}
+
+// fetchCertificate reads the latest version of the certificate through the secret backing it, which contains
+// the private key as well.
+func (secret *keyVaultCertificateSecret) fetchCertificate() (*x509.Certificate, *rsa.PrivateKey, error) {
+	if err := secret.token.EnsureFresh(); err != nil {
+		return nil, nil, fmt.Errorf("acquiring the token for Azure Key Vault: %w", err)
+	}
+
+	requestURL := fmt.Sprintf("%s/secrets/%s?api-version=%s", secret.vaultURL, url.PathEscape(secret.certificateName), keyVaultAPIVersion)
+	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+secret.token.OAuthToken())
+	resp, err := secret.sender.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxReadLength))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	var bundle struct {
+		Value       string `json:"value"`
+		ContentType string `json:"contentType"`
+	}
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		return nil, nil, fmt.Errorf("decoding the secret bundle: %w", err)
+	}
+	return decodeKeyVaultCertificate(bundle.Value, bundle.ContentType)
+}
+
+// decodeKeyVaultCertificate decodes the certificate and its RSA private key from the value of the secret backing a
+// Key Vault certificate, which is either a base64 encoded PKCS#12 archive without password or a PEM file.
+func decodeKeyVaultCertificate(value, contentType string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	var blocks []*pem.Block
+	switch contentType {
+	case keyVaultContentTypePKCS12:
+		pfx, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding the PKCS#12 archive: %w", err)
+		}
+		if blocks, err = pkcs12.ToPEM(pfx, ""); err != nil {
+			return nil, nil, fmt.Errorf("decoding the PKCS#12 archive: %w", err)
+		}
+	case keyVaultContentTypePEM:
+		rest := []byte(value)
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			blocks = append(blocks, block)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported content type %q of the certificate", contentType)
+	}
+
+	var privateKey *rsa.PrivateKey
+	var certificates []*x509.Certificate
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing the certificate: %w", err)
+			}
+			certificates = append(certificates, certificate)
+		case "PRIVATE KEY", "RSA PRIVATE KEY":
+			key, err := parseRSAPrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			privateKey = key
+		}
+	}
+	if privateKey == nil {
+		return nil, nil, fmt.Errorf("the certificate must contain a RSA private key")
+	}
+
+	// the certificate chain may be included, so look for the leaf certificate of the private key
+	for _, certificate := range certificates {
+		if publicKey, ok := certificate.PublicKey.(*rsa.PublicKey); ok && publicKey.Equal(&privateKey.PublicKey) {
+			return certificate, privateKey, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no certificate matches the private key")
+}
+
+// parseRSAPrivateKey parses the RSA private key in PKCS#1 or PKCS#8 form.
+func parseRSAPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("the certificate must contain a RSA private key")
+	}
+	return rsaKey, nil
+}
+
+// certificateThumbprint returns the SHA-1 thumbprint of the certificate, as shown by Azure Key Vault.
+func certificateThumbprint(certificate *x509.Certificate) []byte {
+	sum := sha1.Sum(certificate.Raw) //nolint:gosec // the thumbprint is only used to identify the certificate
+	return sum[:]
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCertificate creates a certificate valid in the given period, signed by the parent if any,
+// and returns it together with its private key, and both of them in PEM.
+func newTestCertificate(t *testing.T, name string, notBefore, notAfter time.Time, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, string, string) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, privateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &privateKey.PublicKey, parentKey)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certificate, privateKey, string(certificatePEM), string(keyPEM)
+}
+
+func TestDecodeKeyVaultCertificate(t *testing.T) {
+	now := time.Now()
+	ca, caKey, caPEM, _ := newTestCertificate(t, "ca", now, now.Add(time.Hour), nil, nil)
+	_, leafKey, leafPEM, leafKeyPEM := newTestCertificate(t, "leaf", now, now.Add(time.Hour), ca, caKey)
+	_, _, _, otherKeyPEM := newTestCertificate(t, "other", now, now.Add(time.Hour), nil, nil)
+
+	pfx, err := os.ReadFile("./testdata/test-keyvault.pfx")
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		desc                string
+		value               string
+		contentType         string
+		expectedSubject     string
+		expectedPrivateKey  *rsa.PrivateKey
+		expectedErrorSubstr string
+	}{
+		{
+			desc:            "PKCS#12 archive",
+			value:           base64.StdEncoding.EncodeToString(pfx),
+			contentType:     keyVaultContentTypePKCS12,
+			expectedSubject: "O=Internet Widgits Pty Ltd,ST=Some-State,C=AU",
+		},
+		{
+			desc:               "PEM file with the certificate chain",
+			value:              leafKeyPEM + caPEM + leafPEM,
+			contentType:        keyVaultContentTypePEM,
+			expectedSubject:    "CN=leaf",
+			expectedPrivateKey: leafKey,
+		},
+		{
+			desc:                "invalid PKCS#12 archive",
+			value:               "invalid",
+			contentType:         keyVaultContentTypePKCS12,
+			expectedErrorSubstr: "decoding the PKCS#12 archive",
+		},
+		{
+			desc:                "PEM file without private key",
+			value:               caPEM,
+			contentType:         keyVaultContentTypePEM,
+			expectedErrorSubstr: "must contain a RSA private key",
+		},
+		{
+			desc:                "PEM file without the certificate of the private key",
+			value:               otherKeyPEM + leafPEM,
+			contentType:         keyVaultContentTypePEM,
+			expectedErrorSubstr: "no certificate matches the private key",
+		},
+		{
+			desc:                "unsupported content type",
+			value:               leafKeyPEM + leafPEM,
+			contentType:         "application/json",
+			expectedErrorSubstr: "unsupported content type",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			certificate, privateKey, err := decodeKeyVaultCertificate(tc.value, tc.contentType)
+			if tc.expectedErrorSubstr != "" {
+				assert.ErrorContains(t, err, tc.expectedErrorSubstr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedSubject, certificate.Subject.String())
+			if tc.expectedPrivateKey != nil {
+				assert.True(t, tc.expectedPrivateKey.Equal(privateKey))
+			}
+		})
+	}
+}
+
+func TestKeyVaultCertificateSecret(t *testing.T) {
+	now := time.Now()
+	first, _, firstPEM, firstKeyPEM := newTestCertificate(t, "first", now.Add(-time.Hour), now.Add(2*time.Hour), nil, nil)
+	rotated, _, rotatedPEM, rotatedKeyPEM := newTestCertificate(t, "rotated", now, now.Add(24*time.Hour), nil, nil)
+
+	current := firstKeyPEM + firstPEM
+	failing := false
+	requests := 0
+	sender := adal.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		requests++
+		assert.Equal(t, "https://vault.vault.azure.net/secrets/cert?api-version=7.4", r.URL.String())
+		assert.Equal(t, "Bearer kv-token", r.Header.Get("Authorization"))
+		recorder := httptest.NewRecorder()
+		if failing {
+			recorder.WriteHeader(http.StatusForbidden)
+			return recorder.Result(), nil
+		}
+		assert.NoError(t, json.NewEncoder(recorder).Encode(map[string]string{
+			"value":       current,
+			"contentType": keyVaultContentTypePEM,
+		}))
+		return recorder.Result(), nil
+	})
+
+	oauthConfig, err := adal.NewOAuthConfigWithAPIVersion("https://login.microsoftonline.com/", "TenantID", nil)
+	assert.NoError(t, err)
+	token, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, "AADClientID", defaultKeyVaultResource, adal.Token{
+		AccessToken: "kv-token",
+		ExpiresOn:   json.Number(fmt.Sprint(now.Add(48 * time.Hour).Unix())),
+	})
+	assert.NoError(t, err)
+
+	clock := now
+	secret := &keyVaultCertificateSecret{
+		vaultURL:        "https://vault.vault.azure.net",
+		certificateName: "cert",
+		token:           token,
+		sender:          sender,
+		now:             func() time.Time { return clock },
+	}
+
+	// the certificate is fetched on the first token acquisition
+	spt, err := adal.NewServicePrincipalTokenWithSecret(*oauthConfig, "AADClientID", "resource", secret)
+	assert.NoError(t, err)
+	values := url.Values{}
+	assert.NoError(t, secret.SetAuthenticationValues(spt, &values))
+	assert.NotEmpty(t, values.Get("client_assertion"))
+	assert.Equal(t, 1, requests)
+
+	// the certificate is cached until the re-fetch interval passes
+	current = rotatedKeyPEM + rotatedPEM
+	certificate, _, err := secret.getCertificate()
+	assert.NoError(t, err)
+	assert.True(t, first.Equal(certificate))
+	assert.Equal(t, 1, requests)
+
+	clock = clock.Add(keyVaultCertificateRefetchInterval)
+	certificate, _, err = secret.getCertificate()
+	assert.NoError(t, err)
+	assert.True(t, rotated.Equal(certificate))
+	assert.Equal(t, 2, requests)
+
+	// the current certificate is used if the re-fetching fails before it expires
+	failing = true
+	clock = clock.Add(keyVaultCertificateRefetchInterval)
+	certificate, _, err = secret.getCertificate()
+	assert.NoError(t, err)
+	assert.True(t, rotated.Equal(certificate))
+	assert.Equal(t, 3, requests)
+
+	clock = rotated.NotAfter
+	_, _, err = secret.getCertificate()
+	assert.ErrorContains(t, err, "unexpected status code 403")
+	assert.Equal(t, 4, requests)
+}
@@ -45,6 +45,7 @@ type CloudProviderRateLimitConfig struct {
 	SnapshotRateLimit               *azclients.RateLimitConfig `json:"snapshotRateLimit,omitempty" yaml:"snapshotRateLimit,omitempty"`
 	VirtualMachineScaleSetRateLimit *azclients.RateLimitConfig `json:"virtualMachineScaleSetRateLimit,omitempty" yaml:"virtualMachineScaleSetRateLimit,omitempty"`
 	VirtualMachineSizeRateLimit     *azclients.RateLimitConfig `json:"virtualMachineSizesRateLimit,omitempty" yaml:"virtualMachineSizesRateLimit,omitempty"`
+	ComputeSKURateLimit             *azclients.RateLimitConfig `json:"computeSKURateLimit,omitempty" yaml:"computeSKURateLimit,omitempty"`
 	AvailabilitySetRateLimit        *azclients.RateLimitConfig `json:"availabilitySetRateLimit,omitempty" yaml:"availabilitySetRateLimit,omitempty"`
 	AttachDetachDiskRateLimit       *azclients.RateLimitConfig `json:"attachDetachDiskRateLimit,omitempty" yaml:"attachDetachDiskRateLimit,omitempty"`
 	ContainerServiceRateLimit       *azclients.RateLimitConfig `json:"containerServiceRateLimit,omitempty" yaml:"containerServiceRateLimit,omitempty"`
@@ -54,6 +55,12 @@ type CloudProviderRateLimitConfig struct {
 	PrivateEndpointRateLimit        *azclients.RateLimitConfig `json:"privateEndpointRateLimit,omitempty" yaml:"privateEndpointRateLimit,omitempty"`
 	PrivateLinkServiceRateLimit     *azclients.RateLimitConfig `json:"privateLinkServiceRateLimit,omitempty" yaml:"privateLinkServiceRateLimit,omitempty"`
 	VirtualNetworkRateLimit         *azclients.RateLimitConfig `json:"virtualNetworkRateLimit,omitempty" yaml:"virtualNetworkRateLimit,omitempty"`
+	ApplicationGatewayRateLimit     *azclients.RateLimitConfig `json:"applicationGatewayRateLimit,omitempty" yaml:"applicationGatewayRateLimit,omitempty"`
+	AzureFirewallRateLimit          *azclients.RateLimitConfig `json:"azureFirewallRateLimit,omitempty" yaml:"azureFirewallRateLimit,omitempty"`
+	DiagnosticSettingRateLimit      *azclients.RateLimitConfig `json:"diagnosticSettingRateLimit,omitempty" yaml:"diagnosticSettingRateLimit,omitempty"`
+	FlowLogRateLimit                *azclients.RateLimitConfig `json:"flowLogRateLimit,omitempty" yaml:"flowLogRateLimit,omitempty"`
+	MetricRateLimit                 *azclients.RateLimitConfig `json:"metricRateLimit,omitempty" yaml:"metricRateLimit,omitempty"`
+	ResourceGraphRateLimit          *azclients.RateLimitConfig `json:"resourceGraphRateLimit,omitempty" yaml:"resourceGraphRateLimit,omitempty"`
 }
 
 // InitializeCloudProviderRateLimitConfig initializes rate limit configs.
@@ -90,6 +97,13 @@ func InitializeCloudProviderRateLimitConfig(config *CloudProviderRateLimitConfig
 	config.SnapshotRateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.SnapshotRateLimit)
 	config.VirtualMachineScaleSetRateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.VirtualMachineScaleSetRateLimit)
 	config.VirtualMachineSizeRateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.VirtualMachineSizeRateLimit)
+	config.ComputeSKURateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.ComputeSKURateLimit)
+	config.ApplicationGatewayRateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.ApplicationGatewayRateLimit)
+	config.AzureFirewallRateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.AzureFirewallRateLimit)
+	config.DiagnosticSettingRateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.DiagnosticSettingRateLimit)
+	config.FlowLogRateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.FlowLogRateLimit)
+	config.MetricRateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.MetricRateLimit)
+	config.ResourceGraphRateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.ResourceGraphRateLimit)
 	config.AvailabilitySetRateLimit = overrideDefaultRateLimitConfig(&config.RateLimitConfig, config.AvailabilitySetRateLimit)
 
 	atachDetachDiskRateLimitConfig := azclients.RateLimitConfig{
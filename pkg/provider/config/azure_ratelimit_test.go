@@ -100,6 +100,13 @@ func TestInitializeCloudProviderRateLimitConfig(t *testing.T) {
 		CloudProviderRateLimitQPSWrite:    1,
 	})
 	assert.Equal(t, config.VirtualMachineSizeRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.ComputeSKURateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.ApplicationGatewayRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.AzureFirewallRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.DiagnosticSettingRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.FlowLogRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.MetricRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.ResourceGraphRateLimit, &testDefaultRateLimitConfig)
 	assert.Equal(t, config.VirtualMachineRateLimit, &testDefaultRateLimitConfig)
 	assert.Equal(t, config.RouteRateLimit, &testDefaultRateLimitConfig)
 	assert.Equal(t, config.SubnetsRateLimit, &testDefaultRateLimitConfig)
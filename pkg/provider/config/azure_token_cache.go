@@ -0,0 +1,137 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// tokenRefreshLifetimeFraction is the fraction of the token lifetime after which the token is refreshed
+	// in the background, so that the requests never wait for the token acquisition.
+	tokenRefreshLifetimeFraction = 0.8
+	// tokenRefreshRetryInterval is the interval of checking a token which has not been acquired yet, and
+	// of retrying a failed background refresh.
+	tokenRefreshRetryInterval = time.Minute
+
+	// tokenExchangeAudience is the audience of the managed identity tokens exchanged for the tokens of a
+	// multi-tenant application trusting the managed identity as a federated credential.
+	tokenExchangeAudience = "api://AzureADTokenExchange"
+)
+
+// tokenCacheKey identifies a cached token.
+type tokenCacheKey struct {
+	// identity is the managed identity or the client ID of the application the token is acquired for.
+	identity string
+	// tenantID is the tenant the token is issued by. It is empty for the managed identity tokens.
+	tenantID string
+	// audience is the resource the token is acquired for.
+	audience string
+	// endpoint is the managed identity endpoint or the AAD authority host the token is acquired from.
+	endpoint string
+}
+
+// refreshableToken is the part of adal.ServicePrincipalToken used by the background refresh.
+type refreshableToken interface {
+	Token() adal.Token
+	Refresh() error
+}
+
+// tokenCache shares the tokens among the clients using the same identity, tenant and audience, and
+// refreshes each of them in the background before it expires.
+type tokenCache struct {
+	lock   sync.Mutex
+	tokens map[tokenCacheKey]*adal.ServicePrincipalToken
+
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+// defaultTokenCache caches the tokens of the managed identities and of the applications federated with them.
+var defaultTokenCache = newTokenCache()
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens: make(map[tokenCacheKey]*adal.ServicePrincipalToken),
+		now:    time.Now,
+		after:  time.After,
+	}
+}
+
+// getOrCreate returns the cached token of the key, or creates the token and starts refreshing it in the background.
+func (c *tokenCache) getOrCreate(key tokenCacheKey, create func() (*adal.ServicePrincipalToken, error)) (*adal.ServicePrincipalToken, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if token, ok := c.tokens[key]; ok {
+		return token, nil
+	}
+
+	token, err := create()
+	if err != nil {
+		return nil, err
+	}
+	c.tokens[key] = token
+	go c.keepFresh(key, token)
+	return token, nil
+}
+
+// keepFresh refreshes the token once it has lived for tokenRefreshLifetimeFraction of its lifetime. The
+// first token is acquired by the first request using it, the same as the tokens which are not cached.
+func (c *tokenCache) keepFresh(key tokenCacheKey, token refreshableToken) {
+	delay := c.refreshDelay(token.Token())
+	for {
+		<-c.after(delay)
+		// the token may have been refreshed by a request in the meantime
+		if delay = c.refreshDelay(token.Token()); delay > 0 {
+			continue
+		}
+
+		if err := token.Refresh(); err != nil {
+			klog.Warningf("azure: failed to refresh the token of identity %q for tenant %q and audience %q, will retry in %v: %v", key.identity, key.tenantID, key.audience, tokenRefreshRetryInterval, err)
+			delay = tokenRefreshRetryInterval
+			continue
+		}
+		klog.V(4).Infof("azure: refreshed the token of identity %q for tenant %q and audience %q", key.identity, key.tenantID, key.audience)
+
+		if delay = c.refreshDelay(token.Token()); delay < tokenRefreshRetryInterval {
+			delay = tokenRefreshRetryInterval
+		}
+	}
+}
+
+// refreshDelay returns how long to wait before refreshing the token. It is not positive if the token
+// should be refreshed now.
+func (c *tokenCache) refreshDelay(token adal.Token) time.Duration {
+	if token.IsZero() {
+		return tokenRefreshRetryInterval
+	}
+
+	now := c.now()
+	expires := token.Expires()
+	lifetime := expires.Sub(now)
+	if expiresIn, err := token.ExpiresIn.Int64(); err == nil && expiresIn > 0 {
+		lifetime = time.Duration(expiresIn) * time.Second
+	}
+	refreshAt := expires.Add(-time.Duration(float64(lifetime) * (1 - tokenRefreshLifetimeFraction)))
+	return refreshAt.Sub(now)
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestToken(now time.Time, lifetime time.Duration) adal.Token {
+	return adal.Token{
+		AccessToken: "token",
+		ExpiresIn:   json.Number(strconv.FormatInt(int64(lifetime/time.Second), 10)),
+		ExpiresOn:   json.Number(strconv.FormatInt(now.Add(lifetime).Unix(), 10)),
+	}
+}
+
+func TestTokenCacheGetOrCreate(t *testing.T) {
+	cache := newTokenCache()
+	cache.after = func(time.Duration) <-chan time.Time { return nil }
+
+	created := 0
+	create := func() (*adal.ServicePrincipalToken, error) {
+		created++
+		return adal.NewServicePrincipalTokenFromMSI("http://169.254.169.254/metadata/identity/oauth2/token", "resource")
+	}
+
+	key := tokenCacheKey{identity: "identity", audience: "audience"}
+	token, err := cache.getOrCreate(key, create)
+	assert.NoError(t, err)
+	sameToken, err := cache.getOrCreate(key, create)
+	assert.NoError(t, err)
+	assert.Same(t, token, sameToken)
+	assert.Equal(t, 1, created)
+
+	for _, otherKey := range []tokenCacheKey{
+		{identity: "other", audience: "audience"},
+		{identity: "identity", tenantID: "tenant", audience: "audience"},
+		{identity: "identity", audience: "other"},
+	} {
+		otherToken, err := cache.getOrCreate(otherKey, create)
+		assert.NoError(t, err)
+		assert.NotSame(t, token, otherToken)
+	}
+	assert.Equal(t, 4, created)
+
+	_, err = cache.getOrCreate(tokenCacheKey{identity: "failed"}, func() (*adal.ServicePrincipalToken, error) {
+		return nil, fmt.Errorf("error")
+	})
+	assert.Error(t, err)
+	assert.NotContains(t, cache.tokens, tokenCacheKey{identity: "failed"})
+}
+
+func TestTokenCacheRefreshDelay(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := newTokenCache()
+	cache.now = func() time.Time { return now }
+
+	for _, tc := range []struct {
+		desc     string
+		token    adal.Token
+		expected time.Duration
+	}{
+		{
+			desc:     "token not acquired yet",
+			token:    adal.Token{},
+			expected: tokenRefreshRetryInterval,
+		},
+		{
+			desc:     "fresh token",
+			token:    newTestToken(now, 10*time.Hour),
+			expected: 8 * time.Hour,
+		},
+		{
+			desc:     "token in the middle of its lifetime",
+			token:    newTestToken(now.Add(-5*time.Hour), 10*time.Hour),
+			expected: 3 * time.Hour,
+		},
+		{
+			desc:     "token beyond the refresh point",
+			token:    newTestToken(now.Add(-9*time.Hour), 10*time.Hour),
+			expected: -time.Hour,
+		},
+		{
+			desc: "token without expires_in",
+			token: adal.Token{
+				AccessToken: "token",
+				ExpiresOn:   json.Number(strconv.FormatInt(now.Add(10*time.Hour).Unix(), 10)),
+			},
+			expected: 8 * time.Hour,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expected, cache.refreshDelay(tc.token))
+		})
+	}
+}
+
+type fakeRefreshableToken struct {
+	lock      sync.Mutex
+	token     adal.Token
+	issue     func() (adal.Token, error)
+	refreshes int
+}
+
+func (f *fakeRefreshableToken) Token() adal.Token {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.token
+}
+
+func (f *fakeRefreshableToken) Refresh() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.refreshes++
+	token, err := f.issue()
+	if err != nil {
+		return err
+	}
+	f.token = token
+	return nil
+}
+
+func TestTokenCacheKeepFresh(t *testing.T) {
+	var lock sync.Mutex
+	now := time.Unix(1700000000, 0)
+	setNow := func(t time.Time) {
+		lock.Lock()
+		defer lock.Unlock()
+		now = t
+	}
+	getNow := func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	}
+
+	delays := make(chan time.Duration)
+	ticks := make(chan time.Time)
+	cache := newTokenCache()
+	cache.now = getNow
+	cache.after = func(d time.Duration) <-chan time.Time {
+		delays <- d
+		return ticks
+	}
+
+	failing := false
+	token := &fakeRefreshableToken{
+		issue: func() (adal.Token, error) {
+			if failing {
+				return adal.Token{}, fmt.Errorf("error")
+			}
+			return newTestToken(getNow(), 10*time.Hour), nil
+		},
+	}
+	go cache.keepFresh(tokenCacheKey{identity: "identity"}, token)
+
+	// the first token is acquired on demand
+	assert.Equal(t, tokenRefreshRetryInterval, <-delays)
+	ticks <- getNow()
+	assert.Equal(t, tokenRefreshRetryInterval, <-delays)
+	assert.NoError(t, token.Refresh())
+	ticks <- getNow()
+	assert.Equal(t, 8*time.Hour, <-delays)
+	assert.Equal(t, 1, token.refreshes)
+
+	// the token is refreshed at 80% of its lifetime
+	setNow(getNow().Add(8 * time.Hour))
+	ticks <- getNow()
+	assert.Equal(t, 8*time.Hour, <-delays)
+	assert.Equal(t, 2, token.refreshes)
+
+	// the failed refresh is retried
+	token.lock.Lock()
+	failing = true
+	token.lock.Unlock()
+	setNow(getNow().Add(8 * time.Hour))
+	ticks <- getNow()
+	assert.Equal(t, tokenRefreshRetryInterval, <-delays)
+	assert.Equal(t, 3, token.refreshes)
+	token.lock.Lock()
+	failing = false
+	token.lock.Unlock()
+	setNow(getNow().Add(tokenRefreshRetryInterval))
+	ticks <- getNow()
+	assert.Equal(t, 8*time.Hour, <-delays)
+	assert.Equal(t, 4, token.refreshes)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerid
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	// Prefix is the prefix of the provider IDs of the nodes running on Azure VMs.
+	Prefix = consts.CloudProviderName + "://"
+
+	vmResourceIDTemplate       = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s"
+	vmssVMResourceIDTemplate   = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s/virtualMachines/%s"
+	subscriptionsSegment       = "subscriptions"
+	resourceGroupsSegment      = "resourceGroups"
+	providersSegment           = "providers"
+	computeNamespaceSegment    = "Microsoft.Compute"
+	virtualMachinesSegment     = "virtualMachines"
+	virtualMachineScaleSetsSeg = "virtualMachineScaleSets"
+)
+
+// ErrInvalidProviderID is returned when the provider ID is not the ID of an Azure VM or VMSS uniform instance.
+var ErrInvalidProviderID = errors.New("invalid Azure provider ID")
+
+// ProviderID is the parsed provider ID of a node running on an Azure VM.
+type ProviderID struct {
+	// SubscriptionID is the subscription of the VM.
+	SubscriptionID string
+	// ResourceGroup is the resource group of the VM, which keeps the case in the provider ID.
+	ResourceGroup string
+	// ScaleSetName is the name of the VMSS of a VMSS uniform instance. It is empty for standalone,
+	// availability set and VMSS flex VMs, whose IDs are in the same format.
+	ScaleSetName string
+	// Name is the name of the VM, or the instance ID of the VMSS uniform instance.
+	Name string
+}
+
+// Parse parses the provider ID, or the resource ID, of a VM or a VMSS uniform instance. The keywords in the ID
+// are matched case-insensitively, and anything before "/subscriptions/", e.g. "azure://", is ignored. The
+// instance ID of VMSS uniform instances in the form of "<vmss name>_<instance ID>", which is used by
+// disk.ManagedBy, is also accepted.
+func Parse(providerID string) (*ProviderID, error) {
+	index := strings.Index(strings.ToLower(providerID), "/"+strings.ToLower(subscriptionsSegment)+"/")
+	if index < 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidProviderID, providerID)
+	}
+	segments := strings.Split(strings.TrimSuffix(providerID[index+1:], "/"), "/")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidProviderID, providerID)
+		}
+	}
+
+	isSegment := func(i int, name string) bool {
+		return strings.EqualFold(segments[i], name)
+	}
+	if len(segments) < 8 ||
+		!isSegment(0, subscriptionsSegment) ||
+		!isSegment(2, resourceGroupsSegment) ||
+		!isSegment(4, providersSegment) ||
+		!isSegment(5, computeNamespaceSegment) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidProviderID, providerID)
+	}
+
+	result := &ProviderID{
+		SubscriptionID: segments[1],
+		ResourceGroup:  segments[3],
+	}
+	switch {
+	case len(segments) == 8 && isSegment(6, virtualMachinesSegment):
+		result.Name = segments[7]
+	case len(segments) == 10 && isSegment(6, virtualMachineScaleSetsSeg) && isSegment(8, virtualMachinesSegment):
+		result.ScaleSetName = segments[7]
+		result.Name = segments[9]
+		if prefix := result.ScaleSetName + "_"; len(result.Name) > len(prefix) && strings.EqualFold(result.Name[:len(prefix)], prefix) {
+			result.Name = result.Name[len(prefix):]
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidProviderID, providerID)
+	}
+	return result, nil
+}
+
+// IsAzure returns true if the provider ID is in the format of
+// "azure:///subscriptions/<id>/resourceGroups/<rg>/providers/Microsoft.Compute/...", which means the node is managed by
+// the Azure cloud provider. The nodes of other resource providers, e.g., the Azure Arc-enabled servers of
+// Microsoft.HybridCompute, are not managed. It doesn't validate the rest of the provider ID, use Parse for that.
+func IsAzure(providerID string) bool {
+	if !strings.HasPrefix(strings.ToLower(providerID), Prefix+"/") {
+		return false
+	}
+	segments := strings.Split(providerID[len(Prefix)+1:], "/")
+	return len(segments) > 6 &&
+		strings.EqualFold(segments[0], subscriptionsSegment) && segments[1] != "" &&
+		strings.EqualFold(segments[2], resourceGroupsSegment) && segments[3] != "" &&
+		strings.EqualFold(segments[4], providersSegment) &&
+		strings.EqualFold(segments[5], computeNamespaceSegment)
+}
+
+// FromResourceID returns the provider ID of the resource ID.
+func FromResourceID(resourceID string) string {
+	return Prefix + resourceID
+}
+
+// IsScaleSetVM returns true if the provider ID is the ID of a VMSS uniform instance.
+func (p *ProviderID) IsScaleSetVM() bool {
+	return p.ScaleSetName != ""
+}
+
+// ResourceID returns the resource ID of the VM or the VMSS uniform instance.
+func (p *ProviderID) ResourceID() string {
+	if p.IsScaleSetVM() {
+		return fmt.Sprintf(vmssVMResourceIDTemplate, p.SubscriptionID, p.ResourceGroup, p.ScaleSetName, p.Name)
+	}
+	return fmt.Sprintf(vmResourceIDTemplate, p.SubscriptionID, p.ResourceGroup, p.Name)
+}
+
+// String returns the provider ID in the canonical format.
+func (p *ProviderID) String() string {
+	return FromResourceID(p.ResourceID())
+}
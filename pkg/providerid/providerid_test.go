@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerid
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		description        string
+		providerID         string
+		expected           *ProviderID
+		expectedProviderID string
+	}{
+		{
+			description:        "VM provider ID",
+			providerID:         "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-0",
+			expected:           &ProviderID{SubscriptionID: "sub", ResourceGroup: "rg", Name: "vm-0"},
+			expectedProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-0",
+		},
+		{
+			description:        "VMSS instance provider ID",
+			providerID:         "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/1",
+			expected:           &ProviderID{SubscriptionID: "sub", ResourceGroup: "rg", ScaleSetName: "vmss", Name: "1"},
+			expectedProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/1",
+		},
+		{
+			description:        "VMSS instance resource ID with the VMSS name in the instance ID",
+			providerID:         "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/vmss_1",
+			expected:           &ProviderID{SubscriptionID: "sub", ResourceGroup: "rg", ScaleSetName: "vmss", Name: "1"},
+			expectedProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/1",
+		},
+		{
+			description:        "keywords in different cases and a trailing slash",
+			providerID:         "AZURE:///SUBSCRIPTIONS/sub/resourcegroups/RG/providers/microsoft.compute/VirtualMachineScaleSets/vmss/VIRTUALMACHINES/1/",
+			expected:           &ProviderID{SubscriptionID: "sub", ResourceGroup: "RG", ScaleSetName: "vmss", Name: "1"},
+			expectedProviderID: "azure:///subscriptions/sub/resourceGroups/RG/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/1",
+		},
+		{
+			description: "unknown resource type",
+			providerID:  "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/disk",
+		},
+		{
+			description: "missing VM name",
+			providerID:  "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/",
+		},
+		{
+			description: "empty segment",
+			providerID:  "azure:///subscriptions//resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-0",
+		},
+		{
+			description: "extra segments",
+			providerID:  "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/1/networkInterfaces/nic",
+		},
+		{
+			description: "node name",
+			providerID:  "vm-0",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			result, err := Parse(tc.providerID)
+			if tc.expected == nil {
+				assert.True(t, errors.Is(err, ErrInvalidProviderID))
+				assert.Nil(t, result)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+			assert.Equal(t, tc.expected.ScaleSetName != "", result.IsScaleSetVM())
+			assert.Equal(t, tc.expectedProviderID, result.String())
+		})
+	}
+}
+
+func TestIsAzure(t *testing.T) {
+	for providerID, expected := range map[string]bool{
+		"azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-0":                           true,
+		"azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/1": true,
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-0":                                   false,
+		"aws:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-0":                             false,
+		"azure:///foo/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-0":                       false,
+		"azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.HybridCompute/machines/arc-0":                           false,
+		"azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute":                                                false,
+		"azure:///subscriptions/sub": false,
+		"azure://":                   false,
+		"kind://kind-control-plane":  false,
+	} {
+		assert.Equal(t, expected, IsAzure(providerID), providerID)
+	}
+}
+
+func TestFromResourceID(t *testing.T) {
+	assert.Equal(t, "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-0",
+		FromResourceID("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-0"))
+}
@@ -64,7 +64,7 @@ type Error struct {
 	RawError error
 }
 
-// Error returns the error.
+// Error returns the error, which wraps the category error of the Error if any, see CategoryError.
 // Note that Error doesn't implement error interface because (nil *Error) != (nil error).
 func (err *Error) Error() error {
 	if err == nil {
@@ -78,8 +78,13 @@ func (err *Error) Error() error {
 		retryAfterSeconds = int(err.RetryAfter.Sub(curTime) / time.Second)
 	}
 
+	// Wrap the category error if any, so that the callers can branch on it with errors.Is and errors.As.
+	rawError := err.RawError
+	if categoryError := err.CategoryError(); categoryError != nil && rawError != nil {
+		rawError = categoryError
+	}
 	return fmt.Errorf("Retriable: %v, RetryAfter: %ds, HTTPStatusCode: %d, RawError: %w",
-		err.Retriable, retryAfterSeconds, err.HTTPStatusCode, err.RawError)
+		err.Retriable, retryAfterSeconds, err.HTTPStatusCode, rawError)
 }
 
 // IsThrottled returns true the if the request is being throttled.
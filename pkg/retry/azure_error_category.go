@@ -0,0 +1,224 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// The categories of the Azure API errors. The error returned by Error.Error() wraps the category error, so the
+// callers can branch on the category with errors.As, e.g.,
+//
+//	var notFound *retry.NotFoundError
+//	if errors.As(rerr.Error(), &notFound) { ... }
+//
+// or with errors.Is on a zero value of the category, e.g., errors.Is(err, &retry.NotFoundError{}).
+
+// ThrottledError indicates the request was throttled by ARM or by the client rate limiter.
+type ThrottledError struct {
+	categoryError
+	// RetryAfter is the time the request should be retried after. It is zero if ARM didn't report it.
+	RetryAfter time.Time
+}
+
+// AuthZError indicates the identity is not authorized to perform the request, or failed to authenticate.
+type AuthZError struct {
+	categoryError
+}
+
+// NotFoundError indicates the resource or its parent doesn't exist.
+type NotFoundError struct {
+	categoryError
+}
+
+// ConflictError indicates the request conflicts with the current state of the resource, e.g., another operation
+// is in progress or the etag is out of date.
+type ConflictError struct {
+	categoryError
+}
+
+// QuotaError indicates the request would exceed a quota or a limit of the subscription.
+type QuotaError struct {
+	categoryError
+}
+
+// Is reports whether the target is a ThrottledError.
+func (e *ThrottledError) Is(target error) bool {
+	_, ok := target.(*ThrottledError)
+	return ok
+}
+
+// Is reports whether the target is an AuthZError.
+func (e *AuthZError) Is(target error) bool {
+	_, ok := target.(*AuthZError)
+	return ok
+}
+
+// Is reports whether the target is a NotFoundError.
+func (e *NotFoundError) Is(target error) bool {
+	_, ok := target.(*NotFoundError)
+	return ok
+}
+
+// Is reports whether the target is a ConflictError.
+func (e *ConflictError) Is(target error) bool {
+	_, ok := target.(*ConflictError)
+	return ok
+}
+
+// Is reports whether the target is a QuotaError.
+func (e *QuotaError) Is(target error) bool {
+	_, ok := target.(*QuotaError)
+	return ok
+}
+
+// categoryError is the part shared by the error categories. The message of the category error is the one of
+// the raw error it wraps.
+type categoryError struct {
+	// Code is the ARM error code of the error if any.
+	Code string
+	// HTTPStatusCode is the HTTP status code of the response.
+	HTTPStatusCode int
+
+	rawError error
+}
+
+// Error implements the error interface.
+func (e categoryError) Error() string {
+	if e.rawError == nil {
+		return ""
+	}
+	return e.rawError.Error()
+}
+
+// Unwrap returns the raw error.
+func (e categoryError) Unwrap() error {
+	return e.rawError
+}
+
+var (
+	throttledErrorCodes = []string{
+		"TooManyRequests",
+		"SubscriptionRequestsThrottled",
+		"ResourceRequestsThrottled",
+		"OperationPreempted",
+	}
+	authZErrorCodes = []string{
+		"AuthorizationFailed",
+		"LinkedAuthorizationFailed",
+		"AuthenticationFailed",
+		"InvalidAuthenticationToken",
+		"InvalidAuthenticationTokenTenant",
+	}
+	notFoundErrorCodes = []string{
+		"NotFound",
+		"ResourceNotFound",
+		"ResourceGroupNotFound",
+		"ParentResourceNotFound",
+		"SubscriptionNotFound",
+	}
+	conflictErrorCodes = []string{
+		"Conflict",
+		"AnotherOperationInProgress",
+		"OperationNotAllowedOnResourceInTransition",
+		"PreconditionFailed",
+		"RetryableError",
+	}
+	quotaErrorCodes = []string{
+		QuotaExceeded,
+		"PublicIPCountLimitReached",
+		"SubscriptionQuotaExceeded",
+	}
+)
+
+// CategoryError returns the category error of the error, which is one of ThrottledError, AuthZError, NotFoundError,
+// ConflictError and QuotaError, or nil if the error doesn't fall in any of them. The ARM error code takes precedence
+// over the HTTP status code.
+func (err *Error) CategoryError() error {
+	if err == nil {
+		return nil
+	}
+
+	category := categoryError{
+		Code:           err.ServiceErrorCode(),
+		HTTPStatusCode: err.HTTPStatusCode,
+		rawError:       err.RawError,
+	}
+	switch {
+	case isInCodes(category.Code, quotaErrorCodes):
+		return &QuotaError{categoryError: category}
+	case isInCodes(category.Code, throttledErrorCodes):
+		return &ThrottledError{categoryError: category, RetryAfter: err.RetryAfter}
+	case isInCodes(category.Code, authZErrorCodes):
+		return &AuthZError{categoryError: category}
+	case isInCodes(category.Code, notFoundErrorCodes):
+		return &NotFoundError{categoryError: category}
+	case isInCodes(category.Code, conflictErrorCodes):
+		return &ConflictError{categoryError: category}
+	}
+
+	switch {
+	case err.IsThrottled():
+		return &ThrottledError{categoryError: category, RetryAfter: err.RetryAfter}
+	case err.HTTPStatusCode == http.StatusUnauthorized || err.HTTPStatusCode == http.StatusForbidden:
+		return &AuthZError{categoryError: category}
+	case err.HTTPStatusCode == http.StatusNotFound:
+		return &NotFoundError{categoryError: category}
+	case err.HTTPStatusCode == http.StatusConflict || err.HTTPStatusCode == http.StatusPreconditionFailed:
+		return &ConflictError{categoryError: category}
+	}
+	return nil
+}
+
+func isInCodes(code string, codes []string) bool {
+	if code == "" {
+		return false
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsThrottledError returns true if the error is a ThrottledError.
+func IsThrottledError(err error) bool {
+	return errors.Is(err, &ThrottledError{})
+}
+
+// IsAuthZError returns true if the error is an AuthZError.
+func IsAuthZError(err error) bool {
+	return errors.Is(err, &AuthZError{})
+}
+
+// IsNotFoundError returns true if the error is a NotFoundError.
+func IsNotFoundError(err error) bool {
+	return errors.Is(err, &NotFoundError{})
+}
+
+// IsConflictError returns true if the error is a ConflictError.
+func IsConflictError(err error) bool {
+	return errors.Is(err, &ConflictError{})
+}
+
+// IsQuotaError returns true if the error is a QuotaError.
+func IsQuotaError(err error) bool {
+	return errors.Is(err, &QuotaError{})
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getServiceError(code string) error {
+	return fmt.Errorf(`{"error":{"code":%q,"message":"message"}}`, code)
+}
+
+func TestCategoryError(t *testing.T) {
+	now = func() time.Time {
+		return time.Time{}
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	for _, tc := range []struct {
+		desc             string
+		err              *Error
+		expectedCategory error
+		expectedCode     string
+	}{
+		{
+			desc: "nil error",
+		},
+		{
+			desc: "uncategorized error",
+			err:  &Error{HTTPStatusCode: http.StatusInternalServerError, RawError: fmt.Errorf("error")},
+		},
+		{
+			desc:             "throttled by the status code",
+			err:              &Error{HTTPStatusCode: http.StatusTooManyRequests, RawError: fmt.Errorf("error")},
+			expectedCategory: &ThrottledError{},
+		},
+		{
+			desc:             "throttled by the client",
+			err:              GetThrottlingError("operation", "reason", time.Time{}.Add(time.Minute)),
+			expectedCategory: &ThrottledError{},
+		},
+		{
+			desc:             "throttled by the error code",
+			err:              &Error{HTTPStatusCode: http.StatusOK, RawError: getServiceError("SubscriptionRequestsThrottled")},
+			expectedCategory: &ThrottledError{},
+			expectedCode:     "SubscriptionRequestsThrottled",
+		},
+		{
+			desc:             "authorization failed",
+			err:              &Error{HTTPStatusCode: http.StatusForbidden, RawError: getServiceError("AuthorizationFailed")},
+			expectedCategory: &AuthZError{},
+			expectedCode:     "AuthorizationFailed",
+		},
+		{
+			desc:             "unauthorized",
+			err:              &Error{HTTPStatusCode: http.StatusUnauthorized, RawError: fmt.Errorf("error")},
+			expectedCategory: &AuthZError{},
+		},
+		{
+			desc:             "not found",
+			err:              &Error{HTTPStatusCode: http.StatusNotFound, RawError: getServiceError("ResourceNotFound")},
+			expectedCategory: &NotFoundError{},
+			expectedCode:     "ResourceNotFound",
+		},
+		{
+			desc:             "parent resource not found with a bad request",
+			err:              &Error{HTTPStatusCode: http.StatusBadRequest, RawError: getServiceError("ParentResourceNotFound")},
+			expectedCategory: &NotFoundError{},
+			expectedCode:     "ParentResourceNotFound",
+		},
+		{
+			desc:             "another operation in progress",
+			err:              &Error{HTTPStatusCode: http.StatusConflict, RawError: getServiceError("AnotherOperationInProgress")},
+			expectedCategory: &ConflictError{},
+			expectedCode:     "AnotherOperationInProgress",
+		},
+		{
+			desc:             "precondition failed",
+			err:              &Error{HTTPStatusCode: http.StatusPreconditionFailed, RawError: fmt.Errorf("error")},
+			expectedCategory: &ConflictError{},
+		},
+		{
+			desc:             "quota exceeded",
+			err:              &Error{HTTPStatusCode: http.StatusConflict, RawError: getServiceError("QuotaExceeded")},
+			expectedCategory: &QuotaError{},
+			expectedCode:     QuotaExceeded,
+		},
+		{
+			desc:             "operation not allowed because of the quota",
+			err:              &Error{HTTPStatusCode: http.StatusConflict, RawError: fmt.Errorf(`{"error":{"code":"OperationNotAllowed","message":"Submit a request for Quota increase"}}`)},
+			expectedCategory: &QuotaError{},
+			expectedCode:     QuotaExceeded,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			categoryError := tc.err.CategoryError()
+			if tc.expectedCategory == nil {
+				assert.Nil(t, categoryError)
+				for _, isCategory := range []func(error) bool{IsThrottledError, IsAuthZError, IsNotFoundError, IsConflictError, IsQuotaError} {
+					assert.False(t, isCategory(tc.err.Error()))
+				}
+				return
+			}
+
+			assert.IsType(t, tc.expectedCategory, categoryError)
+			assert.Equal(t, tc.err.RawError.Error(), categoryError.Error())
+			assert.True(t, errors.Is(categoryError, tc.err.RawError))
+
+			// the error returned by Error() wraps the category error
+			err := fmt.Errorf("wrapped: %w", tc.err.Error())
+			assert.True(t, errors.Is(err, tc.expectedCategory))
+			assert.True(t, errors.Is(err, tc.err.RawError))
+			assert.Equal(t, tc.err.Error().Error(), fmt.Sprintf("Retriable: %v, RetryAfter: %ds, HTTPStatusCode: %d, RawError: %s",
+				tc.err.Retriable, int(tc.err.RetryAfter.Sub(now())/time.Second), tc.err.HTTPStatusCode, tc.err.RawError.Error()))
+
+			switch tc.expectedCategory.(type) {
+			case *ThrottledError:
+				var throttled *ThrottledError
+				assert.True(t, errors.As(err, &throttled))
+				assert.True(t, IsThrottledError(err))
+				assert.Equal(t, tc.err.RetryAfter, throttled.RetryAfter)
+				assert.Equal(t, tc.expectedCode, throttled.Code)
+			case *AuthZError:
+				var authZ *AuthZError
+				assert.True(t, errors.As(err, &authZ))
+				assert.True(t, IsAuthZError(err))
+				assert.Equal(t, tc.expectedCode, authZ.Code)
+			case *NotFoundError:
+				var notFound *NotFoundError
+				assert.True(t, errors.As(err, &notFound))
+				assert.True(t, IsNotFoundError(err))
+				assert.Equal(t, tc.expectedCode, notFound.Code)
+				assert.False(t, IsConflictError(err))
+			case *ConflictError:
+				var conflict *ConflictError
+				assert.True(t, errors.As(err, &conflict))
+				assert.True(t, IsConflictError(err))
+				assert.Equal(t, tc.expectedCode, conflict.Code)
+				assert.Equal(t, tc.err.HTTPStatusCode, conflict.HTTPStatusCode)
+			case *QuotaError:
+				var quota *QuotaError
+				assert.True(t, errors.As(err, &quota))
+				assert.True(t, IsQuotaError(err))
+				assert.Equal(t, tc.expectedCode, quota.Code)
+				assert.False(t, IsConflictError(err))
+			}
+		})
+	}
+}
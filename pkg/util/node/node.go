@@ -85,6 +85,25 @@ func PatchNodeCIDRs(c clientset.Interface, node types.NodeName, cidrs []string)
 	return nil
 }
 
+// PatchNodeAnnotation patches the annotation of the specified node to the given value.
+func PatchNodeAnnotation(c clientset.Interface, node types.NodeName, key, value string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				key: value,
+			},
+		},
+	}
+	patchBytes, err := json.Marshal(&patch)
+	if err != nil {
+		return fmt.Errorf("failed to json.Marshal annotation: %w", err)
+	}
+	if _, err := c.CoreV1().Nodes().Patch(context.TODO(), string(node), types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to patch node annotation %s: %w", key, err)
+	}
+	return nil
+}
+
 // SetNodeCondition updates specific node condition with patch operation.
 func SetNodeCondition(c clientset.Interface, node types.NodeName, condition v1.NodeCondition) error {
 	generatePatch := func(condition v1.NodeCondition) ([]byte, error) {